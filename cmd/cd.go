@@ -5,9 +5,14 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"strings"
 
 	"github.com/hansbonini/tombatools/pkg"
 	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/profiles"
+	"github.com/hansbonini/tombatools/pkg/psx"
 	"github.com/spf13/cobra"
 )
 
@@ -21,9 +26,29 @@ var cdCmd = &cobra.Command{
 
 Commands:
   dump      Extract files from CD image files (.bin format)
+  sheet     Generate .cue/.ccd description files for a CD image
+  tracks    List the data and CD-DA audio tracks of a CUE sheet
+  checksum  Validate license region, boot path and TOC coherency
+  orphans   Report and dump sectors not referenced by any directory record
+  id        Identify the disc serial, build date and matching release
+  diff      Report the files and sectors that differ between two CD images
+  verify    Check the ISO9660 file system against the standard
+  finalize  Fix the volume size and sector count of an image that grew
+  convert-region  Apply a region conversion profile (video mode, timing, FLA)
+  build     Encode, inject and update the FLA table in memory (for CI)
 
 Examples:
-  tombatools cd dump original.bin ./output/`,
+  tombatools cd dump original.bin ./output/
+  tombatools cd sheet patched.bin --ccd
+  tombatools cd tracks original.cue
+  tombatools cd checksum patched.bin
+  tombatools cd orphans original.bin ./orphans/
+  tombatools cd id original.bin
+  tombatools cd diff original.bin modified.bin
+  tombatools cd verify --strict patched.bin
+  tombatools cd finalize --in-place patched.bin
+  tombatools cd convert-region --to NTSC-U original.bin
+  tombatools cd build --wfm DATA/CFNT999H.WFM=dialogues.yaml original.bin patched.bin`,
 }
 
 // cdDumpCmd extracts files from CD image files.
@@ -35,7 +60,11 @@ var cdDumpCmd = &cobra.Command{
 	Long: `Extract files from CD image files (.bin format).
 
 This command reads PlayStation CD images in .bin format and extracts all files
-from the ISO9660 file system. When verbose mode is enabled (-v), it displays
+from the ISO9660 file system. ECM (.ecm) and CHD v5 (.chd) images are read
+directly, without converting them back to .bin first. CHD images may use the
+default chdman createcd codecs (cdlz, cdzl and cdfl); zstd-compressed (cdzs)
+images must be recompressed first. A .cue file opens its data
+track (single-file and one-file-per-track images). When verbose mode is enabled (-v), it displays
 detailed information about each file including:
   - ID (4-digit hex)
   - MSF (Minutes:Seconds:Frames)
@@ -47,13 +76,51 @@ Output:
   - Extracted files maintain the original directory structure
   - Detailed log of file information (when -v flag is used)
 
+Safety:
+  - Files whose names would escape the output directory are skipped
+  - Files larger than --max-file-size or extending past the image end are skipped
+  - Extraction stops adding files once --max-total-size bytes were written
+  - Files sharing sectors (overlapping extents) are reported as warnings
+
+Flags:
+  --max-file-size    Largest file to extract in bytes (default: 700 MiB)
+  --max-total-size   Total bytes to extract (default: twice the image data size)
+  --archive          Write the extracted files into a single .zip archive instead of
+                     a directory, keeping the directory structure
+  --name-template    Name extracted files from a template (directories keep their
+                     names). Placeholders:
+                       {index}  entry ID, as listed by -v (4 hex digits)
+                       {msf}    start position as MM-SS-FF
+                       {lba}    start sector (8 digits)
+                       {size}   size in bytes
+                       {name}   ISO9660 file name
+  --preserve-msf-names  Shorthand for --name-template "{index}_{msf}_{name}",
+                     e.g. 0001_00-02-16_SLES_0025.61, so listings sort by disc layout
+  --manifest         Also write the layout of the image to this file, in the spirit
+                     of dumpsxiso: every directory, file and unreferenced gap ordered
+                     by LBA, with its MSF, sectors, size, XA attributes and the dumped
+                     file it was extracted to. XML for .xml files, YAML otherwise.
+  --audio-tracks     Also write the CD-DA audio tracks listed by the CUE sheet (the
+                     .cue given, or the one next to the image) as trackNN.wav files
+                     (44.1 kHz 16-bit stereo) next to the extracted files
+  --raw-xa           Write XA audio and STR movies (files with Form 2 or interleaved
+                     sectors) as raw 2352-byte sectors, subheaders included (2336
+                     bytes from a MODE2/2336 image). Otherwise a Form 2 sector keeps
+                     its 2324 bytes of data and a Form 1 sector its 2048
+
 Example:
   tombatools cd dump original.bin ./output/
-  tombatools cd dump -v original.bin ./output/`,
-	Args: cobra.ExactArgs(2),
+  tombatools cd dump --archive original.zip original.bin
+  tombatools cd dump -v original.bin ./output/
+  tombatools cd dump --preserve-msf-names original.bin ./output/
+  tombatools cd dump --name-template "{lba}_{name}" original.bin ./output/
+  tombatools cd dump --manifest layout.yaml original.bin ./output/
+  tombatools cd dump --audio-tracks original.cue ./output/
+  tombatools cd dump --raw-xa original.bin ./output/`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		inputFile := args[0]
-		outputDir := args[1]
+		common.RecordInput(inputFile)
 
 		// Enable verbose mode if requested
 		verbose, err := cmd.Flags().GetBool("verbose")
@@ -62,24 +129,1036 @@ Example:
 		}
 		common.SetVerboseMode(verbose)
 
+		maxFileSize, err := cmd.Flags().GetInt64("max-file-size")
+		if err != nil {
+			return fmt.Errorf("error getting max-file-size flag: %w", err)
+		}
+
+		maxTotalSize, err := cmd.Flags().GetInt64("max-total-size")
+		if err != nil {
+			return fmt.Errorf("error getting max-total-size flag: %w", err)
+		}
+
+		nameTemplate, err := cmd.Flags().GetString("name-template")
+		if err != nil {
+			return fmt.Errorf("error getting name-template flag: %w", err)
+		}
+
+		preserveMSFNames, err := cmd.Flags().GetBool("preserve-msf-names")
+		if err != nil {
+			return fmt.Errorf("error getting preserve-msf-names flag: %w", err)
+		}
+		if preserveMSFNames {
+			if nameTemplate != "" {
+				return fmt.Errorf("--preserve-msf-names and --name-template cannot be used together")
+			}
+			nameTemplate = pkg.PreserveMSFNameTemplate
+		}
+
+		audioTracks, err := cmd.Flags().GetBool("audio-tracks")
+		if err != nil {
+			return fmt.Errorf("error getting audio-tracks flag: %w", err)
+		}
+
+		rawXA, err := cmd.Flags().GetBool("raw-xa")
+		if err != nil {
+			return fmt.Errorf("error getting raw-xa flag: %w", err)
+		}
+
 		// Create CD processor for handling dump operations
 		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		processor.SetAudioTracks(audioTracks)
+		processor.SetRawXA(rawXA)
+		if err := processor.SetExtractionLimits(maxFileSize, maxTotalSize); err != nil {
+			return err
+		}
+		if err := processor.SetNameTemplate(nameTemplate); err != nil {
+			return err
+		}
+
+		outputDir, archive, err := outputTarget(cmd, args)
+		if err != nil {
+			return err
+		}
+		if archive != nil {
+			defer archive.Discard()
+		}
+
+		manifestFile, err := cmd.Flags().GetString("manifest")
+		if err != nil {
+			return fmt.Errorf("error getting manifest flag: %w", err)
+		}
+		if manifestFile != "" {
+			// Sources are named relative to the directory or archive the user sees
+			sourceRoot := outputDir
+			if archive != nil {
+				sourceRoot = archive.Path()
+			}
+			processor.SetLayoutManifest(manifestFile, sourceRoot)
+		}
 
 		// Process the CD image file: parse structure and extract files
-		fmt.Printf("Processing CD image file: %s\n", inputFile)
-		fmt.Printf("Output directory: %s\n", outputDir)
+		common.Printf("Processing CD image file: %s\n", inputFile)
+		if archive == nil {
+			common.Printf("Output directory: %s\n", outputDir)
+		}
 
-		if err := processor.Dump(inputFile, outputDir); err != nil {
+		if err := processor.Dump(cmd.Context(), inputFile, outputDir); err != nil {
 			return fmt.Errorf("failed to process CD image file: %w", err)
 		}
 
-		fmt.Println("CD image file processed successfully!")
-		fmt.Printf("Files extracted to: %s\n", outputDir)
+		common.Println("CD image file processed successfully!")
+		if archive != nil {
+			return closeOutputTarget(cmd.Context(), archive)
+		}
+		common.Printf("Files extracted to: %s\n", outputDir)
+
+		return nil
+	},
+}
+
+// cdSheetCmd generates disc description files for raw CD images.
+// The sheets are written next to the image so emulators and burning
+// software can load a rebuilt image without hand-written metadata.
+var cdSheetCmd = &cobra.Command{
+	Use:   "sheet [image_file]",
+	Short: "Generate .cue/.ccd description files for a CD image",
+	Long: `Generate disc description files for a raw CD image (.bin format).
+
+This command inspects a 2352-byte/sector CD image, detects the data track
+mode (MODE1 or MODE2) and writes matching description files next to it using
+the same base name:
+  - .cue  Single data track sheet (always written)
+  - .ccd  CloneCD control file (optional, with --ccd)
+
+Alcohol 120% (.mds) descriptors are not supported.
+
+Flags:
+  --ccd           Also write a CloneCD control file
+  -v, --verbose   Enable verbose output
+
+Examples:
+  tombatools cd sheet patched.bin
+  tombatools cd sheet patched.bin --ccd`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		writeCCD, err := cmd.Flags().GetBool("ccd")
+		if err != nil {
+			return fmt.Errorf("error getting ccd flag: %w", err)
+		}
+
+		formats := []string{psx.SheetFormatCUE}
+		if writeCCD {
+			formats = append(formats, psx.SheetFormatCCD)
+		}
+
+		// Create CD processor for handling sheet generation
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		common.Printf("Generating disc sheets for: %s\n", imageFile)
+
+		written, err := processor.GenerateSheets(imageFile, formats)
+		if err != nil {
+			return fmt.Errorf("failed to generate disc sheets: %w", err)
+		}
+
+		for _, sheetPath := range written {
+			common.Printf("Written: %s\n", sheetPath)
+		}
+
+		return nil
+	},
+}
+
+// cdChecksumCmd validates the boot-relevant metadata of a CD image.
+// It catches the mistakes that make patched images unbootable before
+// they are burned or loaded in an emulator.
+var cdChecksumCmd = &cobra.Command{
+	Use:   "checksum [image_file]",
+	Short: "Validate license region, boot path and TOC coherency of a CD image",
+	Long: `Validate that a PlayStation CD image (.bin format) is bootable.
+
+The following checks are performed:
+  - Image size is a whole number of sectors, and the image is raw (2352 bytes/sector)
+  - Volume size in the ISO9660 descriptor fits in the image
+  - License sector contains Sony license text and its region
+  - SYSTEM.CNF has a BOOT line pointing at an existing file (cdrom:\...)
+  - Boot executable has a PS-X EXE header
+  - License region matches the executable product code and header region
+
+The command exits with code 4 when any error-level issue is found.
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools cd checksum patched.bin
+  tombatools cd checksum -f json -o boot.json patched.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		// Create CD processor for handling the boot check
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		report, err := processor.CheckBoot(imageFile)
+		if err != nil {
+			return fmt.Errorf("failed to check CD image file: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteBootCheckReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write boot check report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Boot check report written to: %s\n", outputFile)
+		}
+
+		if errorCount := report.ErrorCount(); errorCount > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("boot check found %d error(s) in %s", errorCount, imageFile))
+		}
+
+		return nil
+	},
+}
+
+// cdTracksCmd lists the tracks of a multi-track disc described by a CUE sheet.
+var cdTracksCmd = &cobra.Command{
+	Use:   "tracks [image_file]",
+	Short: "List the data and CD-DA audio tracks of a CUE sheet",
+	Long: `List the tracks of a CD image: the data track and the CD-DA audio tracks.
+
+The tracks are read from a .cue file, or from the CUE sheet next to a .bin image
+(same name). Both single-file and one-file-per-track images are supported. An
+image without a CUE sheet lists its single data track. Extract the audio tracks
+as WAV files with cd dump --audio-tracks.
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools cd tracks original.cue
+  tombatools cd tracks -f json -o tracks.json original.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Tracks(imageFile)
+		if err != nil {
+			return err
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteTrackReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write track report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Track report written to: %s\n", outputFile)
+		}
+		return nil
+	},
+}
+
+// cdIDCmd fingerprints a CD image and matches it against the known releases.
+// The matched release selects the format profile used for the disc.
+var cdIDCmd = &cobra.Command{
+	Use:   "id [image_file]",
+	Short: "Identify the disc serial, build date and matching release of a CD image",
+	Long: `Identify a PlayStation CD image (.bin format).
+
+The serial (e.g. SCUS-94236) is taken from the boot executable named in
+SYSTEM.CNF and the build date from the volume creation date of the primary
+volume descriptor. Both are matched against the releases listed by the format
+profiles, which selects the profile for the disc; the same lookup is used by
+"profiles show --disc". Override profiles may list additional releases.
+
+The command exits with code 2 when the disc is not a known release.
+
+Flags:
+  -f, --format          Report format: json or markdown (default: markdown)
+  -o, --output          Write the report to a file instead of stdout
+  -d, --profiles-dir    Override directory for user-supplied profiles
+
+Examples:
+  tombatools cd id original.bin
+  tombatools cd id -f json -o id.json original.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		report, _, matchErr := detectDiscProfile(imageFile, overrideDir)
+		if report == nil {
+			return fmt.Errorf("failed to identify CD image file: %w", matchErr)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteDiscIDReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write disc identity report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Disc identity report written to: %s\n", outputFile)
+		}
+
+		if matchErr != nil {
+			return fmt.Errorf("unknown release in %s: %w", imageFile, matchErr)
+		}
+		return nil
+	},
+}
+
+// cdOrphansCmd reports disc regions that are not referenced by the file system.
+// Such regions often hold debug leftovers or data loaded by raw sector access.
+var cdOrphansCmd = &cobra.Command{
+	Use:   "orphans [image_file] [output_directory]",
+	Short: "Report and dump sectors not referenced by any directory record",
+	Long: `Find the sectors of a PlayStation CD image (.bin format) that are not part of
+the system area, the volume descriptors, the path tables, a directory or a file.
+
+Every unreferenced region is listed with its position, size, the item it follows
+and whether it is zero-filled. Directory records with the ISO9660 hidden flag are
+listed as well. When an output directory is given, the user data of every region
+that is not zero-filled is written to orphan_<LBA>_<sectors>.bin.
+
+Flags:
+  -f, --format         Report format: json or markdown (default: markdown)
+  -o, --output         Write the report to a file instead of stdout
+      --include-empty  Also dump zero-filled regions
+
+Examples:
+  tombatools cd orphans original.bin
+  tombatools cd orphans original.bin ./orphans/
+  tombatools cd orphans -f json -o orphans.json original.bin ./orphans/`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+		outputDir := ""
+		if len(args) > 1 {
+			outputDir = args[1]
+		}
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		includeEmpty, err := cmd.Flags().GetBool("include-empty")
+		if err != nil {
+			return fmt.Errorf("error getting include-empty flag: %w", err)
+		}
+
+		// Create CD processor for handling the orphan analysis
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		report, err := processor.FindOrphans(imageFile, outputDir, includeEmpty)
+		if err != nil {
+			return fmt.Errorf("failed to analyze CD image file: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteOrphanReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write orphan report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Orphan report written to: %s\n", outputFile)
+		}
 
 		return nil
 	},
 }
 
+// cdDiffCmd compares the on-disk layout of two CD images.
+// It is the higher-level companion to fla recalc for reviewing what a patch did.
+var cdDiffCmd = &cobra.Command{
+	Use:   "diff [original.bin] [modified.bin]",
+	Short: "Report the files and sectors that differ between two CD images",
+	Long: `Compare the files and raw sectors of two PlayStation CD images (.bin format).
+
+Files present in both images are matched by path and compared by position, size
+and SHA-256 of their contents. Every file is reported as:
+  added      only in the modified image
+  removed    only in the original image
+  renamed    same contents under another path
+  moved      starts at another LBA
+  resized    size differs
+  changed    same size, different contents
+
+The summary also counts the raw sectors present in both images whose bytes
+differ, and lists them as runs of consecutive sectors.
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools cd diff original.bin modified.bin
+  tombatools cd diff -f json -o diff.json original.bin modified.bin`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		originalFile := args[0]
+		modifiedFile := args[1]
+		common.RecordInput(originalFile)
+		common.RecordInput(modifiedFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		// Create CD processor for handling the comparison
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		report, err := processor.Diff(cmd.Context(), originalFile, modifiedFile)
+		if err != nil {
+			return fmt.Errorf("failed to compare CD image files: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteCDDiffReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write CD diff report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("CD diff report written to: %s\n", outputFile)
+		}
+
+		return nil
+	},
+}
+
+// cdVerifyCmd checks the ISO9660 file system of a CD image, typically one rebuilt
+// after patching, against the standard.
+var cdVerifyCmd = &cobra.Command{
+	Use:   "verify [image_file]",
+	Short: "Check the ISO9660 file system of a CD image against the standard",
+	Long: `Check the ISO9660 file system of a CD image against ECMA-119.
+
+Every violation names the clause it breaks. The basic checks cover what a reader
+needs to find the files:
+  - Volume space size in both byte orders, and against the image size
+  - Root directory record (length, identifier, flags, extent)
+  - Directory records: sector boundaries, byte-order fields, extents in the volume,
+    and the . and .. records
+  - Path tables: type L and type M agree and list exactly the directories
+
+--strict adds the rules lenient readers ignore but picky emulators enforce:
+  - Directory records sorted by name, extension and version
+  - Zero padding byte after even-length identifiers
+  - Path table records ordered by level, parent and name
+  - d-character identifiers with ;version suffixes
+  - Volume descriptor set terminator, and no sectors after the volume
+
+An image ending with an incomplete sector is reported as a warning; "cd finalize"
+completes it and updates the volume space size.
+
+The command exits with code 4 when an error is found, or any violation with --strict.
+
+Flags:
+  --strict        Apply the full conformance suite
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools cd verify patched.bin
+  tombatools cd verify --strict -f json -o iso.json patched.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		strict, err := cmd.Flags().GetBool("strict")
+		if err != nil {
+			return fmt.Errorf("error getting strict flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		// Create CD processor for handling the conformance check
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		report, err := processor.VerifyISO9660(imageFile, strict)
+		if err != nil {
+			return fmt.Errorf("failed to verify CD image file: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteISOVerifyReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write verification report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Verification report written to: %s\n", outputFile)
+		}
+
+		if report.Failed() {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("ISO9660 check found %d violation(s) (%d errors) in %s", len(report.Violations), report.ErrorCount(), imageFile))
+		}
+
+		return nil
+	},
+}
+
+// cdFinalizeCmd corrects the volume space size and sector count of an image that grew
+// while being patched, optionally padding it to a standard disc length.
+var cdFinalizeCmd = &cobra.Command{
+	Use:   "finalize [image_file]",
+	Short: "Fix the volume size and sector count of a CD image that grew",
+	Long: `Finalize a CD image whose size changed while injecting files.
+
+When injections grow the image, the volume space size of the Primary Volume
+Descriptor and the sector count of the image become stale. Finalizing:
+  - Completes an incomplete last sector with zeros (raw sectors get their EDC/ECC)
+  - Optionally appends empty sectors, with their address and EDC/ECC in raw images,
+    up to the data track of a standard 74- or 80-minute disc (--pad-to)
+  - Sets the volume space size, in both byte orders, to the sectors of the image
+
+Run "cd verify" afterwards to check the result. Images with audio tracks after the
+data track in the same file are not supported.
+
+The input image is never changed unless --in-place is given: the finalized image is
+written to a copy (image_final.bin next to it, or --output). --dry-run reports the
+corrections without writing anything.
+
+Flags:
+      --pad-to        Pad the image to a 74- or 80-minute disc (default: no padding)
+  -o, --output        Write the finalized image to this file
+                      (default: image_final.bin next to the input)
+      --in-place      Finalize the input image itself
+      --dry-run       Report the corrections without writing
+  -f, --format        Report format: json or markdown (default: markdown)
+
+Examples:
+  tombatools cd finalize --dry-run patched.bin
+  tombatools cd finalize --in-place patched.bin
+  tombatools cd finalize --pad-to 74 -o patched_74.bin patched.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		padTo, err := cmd.Flags().GetInt("pad-to")
+		if err != nil {
+			return fmt.Errorf("error getting pad-to flag: %w", err)
+		}
+		if padTo != 0 {
+			if _, err := psx.DiscCapacity(padTo); err != nil {
+				return err
+			}
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			return fmt.Errorf("error getting in-place flag: %w", err)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("error getting dry-run flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		options := psx.FinalizeOptions{PadMinutes: padTo, DryRun: dryRun}
+
+		// Create CD processor for handling the finalization
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		var report *psx.FinalizeReport
+		finalize := func(path string) error {
+			report, err = processor.FinalizeImage(cmd.Context(), path, options)
+			return err
+		}
+		switch {
+		case dryRun || inPlace:
+			err = finalize(imageFile)
+		default:
+			if outputFile == "" {
+				outputFile = pkg.CopiedImagePath(imageFile, "_final")
+			}
+			err = pkg.WithImageCopy(cmd.Context(), imageFile, outputFile, finalize)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to finalize %s: %w", imageFile, err)
+		}
+
+		if err := pkg.WriteFinalizeReport(report, format, os.Stdout); err != nil {
+			return fmt.Errorf("failed to write finalization report: %w", err)
+		}
+
+		if !dryRun && !inPlace {
+			common.Printf("Finalized image written to: %s\n", outputFile)
+		}
+		return nil
+	},
+}
+
+// cdConvertRegionCmd converts a disc to another region with the conversion listed by
+// its profile: byte patches of known locations, FLA re-points and the manual steps left.
+var cdConvertRegionCmd = &cobra.Command{
+	Use:   "convert-region [image_file]",
+	Short: "Convert a CD image to another region with the patches of its profile",
+	Long: `Convert a PlayStation CD image (.bin format) to another region.
+
+The disc is identified as with "cd id", and the profile of its release must list a
+conversion to the target region. A conversion holds:
+  - Byte patches of known locations (video mode flags, PAL/NTSC timing tables).
+    The bytes expected before patching are checked for every patch before any is
+    written, so an image of another release or revision is refused whole.
+  - FLA entries to point at other files of the image, e.g. region-specific videos;
+    each entry takes the position and size of its file.
+  - Manual steps that cannot be automated.
+
+The report lists every patch with its status (pending, applied or already-applied),
+the FLA entries and the manual steps: the conversion's own, plus the license
+sectors, boot executable serial and EXE header that still name another region.
+
+The input image is never changed unless --in-place is given: the converted image is
+written to a copy (image_ntsc-u.bin next to it, or --output). --dry-run checks the
+patches and prints the report without writing anything. Conversions ship in
+override profiles; "profiles show tomba" prints the schema.
+
+Flags:
+      --to              Target region: NTSC-U, NTSC-J or PAL (required)
+  -o, --output          Write the converted image to this file
+                        (default: image_<region>.bin next to the input)
+      --in-place        Convert the input image itself
+      --dry-run         Check the patches and report without writing
+  -f, --format          Report format: json or markdown (default: markdown)
+  -d, --profiles-dir    Override directory for user-supplied profiles
+
+Examples:
+  tombatools cd convert-region --to NTSC-U --dry-run original.bin
+  tombatools cd convert-region --to NTSC-U original.bin
+  tombatools cd convert-region --to PAL -o tomba_pal.bin original.bin
+  tombatools cd convert-region --to NTSC-U --in-place -f json original.bin`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		to, err := cmd.Flags().GetString("to")
+		if err != nil {
+			return fmt.Errorf("error getting to flag: %w", err)
+		}
+		to = strings.ToUpper(to)
+		switch to {
+		case psx.RegionNTSCU, psx.RegionNTSCJ, psx.RegionPAL:
+		default:
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("invalid target region %q (want NTSC-U, NTSC-J or PAL)", to))
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			return fmt.Errorf("error getting in-place flag: %w", err)
+		}
+
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("error getting dry-run flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		identity, profile, err := detectDiscProfile(imageFile, overrideDir)
+		if err != nil {
+			return fmt.Errorf("failed to identify CD image file: %w", err)
+		}
+		if identity.Region == to {
+			common.LogWarn("%s is already a %s release", identity.Serial, to)
+		}
+		conversion := profile.FindConversion(identity.Serial, to)
+		if conversion == nil {
+			return common.WithCategory(common.ErrCategoryInputNotFound,
+				fmt.Errorf("profile %s lists no conversion of %s to %s; add one to an override profile in %s",
+					profile.Name, identity.Serial, to, overrideDir))
+		}
+
+		options := pkg.RegionConversionOptions{
+			To:      to,
+			Patches: conversion.Patches,
+			FLA:     make(map[uint32]string, len(conversion.FLA)),
+			Manual:  conversion.Manual,
+			DryRun:  dryRun,
+		}
+		for _, repoint := range conversion.FLA {
+			options.FLA[repoint.Entry] = repoint.File
+		}
+
+		// Create CD processor for handling the conversion
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		var report *pkg.RegionConversionReport
+		convert := func(path string) error {
+			report, err = processor.ConvertRegion(cmd.Context(), path, options)
+			return err
+		}
+		switch {
+		case dryRun || inPlace:
+			err = convert(imageFile)
+		default:
+			if outputFile == "" {
+				outputFile = pkg.CopiedImagePath(imageFile, "_"+strings.ToLower(to))
+			}
+			err = pkg.WithImageCopy(cmd.Context(), imageFile, outputFile, convert)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to convert %s to %s: %w", imageFile, to, err)
+		}
+
+		if err := pkg.WriteRegionConversionReport(report, format, os.Stdout); err != nil {
+			return fmt.Errorf("failed to write conversion report: %w", err)
+		}
+
+		if !dryRun && !inPlace {
+			common.Printf("Converted image written to: %s\n", outputFile)
+		}
+		return nil
+	},
+}
+
+// cdBuildCmd runs the encode, inject and FLA update steps in memory and writes the
+// final image and a report
+var cdBuildCmd = &cobra.Command{
+	Use:   "build [image_file] [output.bin]",
+	Short: "Encode, inject and update the FLA table of a CD image in memory",
+	Long: `Build a patched CD image in one pass without intermediate files.
+
+Every --wfm dialogue file is encoded (as wfm encode does) and every --file is read,
+and each replaces the disc file of the same path in a copy-on-write view of the
+image held in memory. The directory records and the FLA entries of the replaced
+files get their new sizes. Only the final image and the report are written, so CI
+machines with slow disks or little scratch space run the full build quickly. The
+input image is never changed and may be an ECM or CHD image (see cd dump); the
+output is a plain .bin image. The report holds the SHA-256 of the output and no timestamps, so
+identical inputs produce identical reports.
+
+Files are replaced in place: a new file must fit the sectors of the file it
+replaces. A file that grows past them is refused (exit code 4); rebuild the disc
+with a disc rebuild tool and run fla recalc for those. Form 2 files (XA audio)
+take an XA file of 2336-byte or 2352-byte sectors, such as the output of xa
+encode, with at most the sectors of the file it replaces.
+
+Flags:
+      --wfm DISC_PATH=dialogues.yaml  Encode a dialogue file into a WFM file of the disc
+                                      (repeatable)
+      --file DISC_PATH=FILE           Replace a disc file with a prebuilt file, e.g. a
+                                      packed GAM (repeatable)
+      --glyphs-from-disc              Encode with the glyphs of the WFM file being
+                                      replaced instead of the fonts/ PNG tree
+  -r, --report                        Write the report to a file instead of stdout
+  -f, --format                        Report format: json or markdown (default: markdown)
+
+Examples:
+  tombatools cd build --wfm DATA/CFNT999H.WFM=dialogues.yaml original.bin patched.bin
+  tombatools cd build --wfm DATA/CFNT999H.WFM=dialogues.yaml --glyphs-from-disc \
+    --file DATA/ITEM.GAM=build/ITEM.GAM -f json -r build.json original.chd patched.bin
+  tombatools cd build --file XA/VOICE.XA=build/VOICE.XA original.bin patched.bin`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		wfmSpecs, err := cmd.Flags().GetStringArray("wfm")
+		if err != nil {
+			return fmt.Errorf("error getting wfm flag: %w", err)
+		}
+
+		fileSpecs, err := cmd.Flags().GetStringArray("file")
+		if err != nil {
+			return fmt.Errorf("error getting file flag: %w", err)
+		}
+
+		glyphsFromDisc, err := cmd.Flags().GetBool("glyphs-from-disc")
+		if err != nil {
+			return fmt.Errorf("error getting glyphs-from-disc flag: %w", err)
+		}
+
+		reportFile, err := cmd.Flags().GetString("report")
+		if err != nil {
+			return fmt.Errorf("error getting report flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		options := pkg.MemoryBuildOptions{GlyphsFromDisc: glyphsFromDisc}
+		for _, spec := range wfmSpecs {
+			file, err := pkg.ParseMemoryBuildFile(spec, true)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryValidationFailed, err)
+			}
+			options.Files = append(options.Files, file)
+		}
+		for _, spec := range fileSpecs {
+			file, err := pkg.ParseMemoryBuildFile(spec, false)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryValidationFailed, err)
+			}
+			options.Files = append(options.Files, file)
+		}
+		if len(options.Files) == 0 {
+			return fmt.Errorf("at least one --wfm or --file is required")
+		}
+
+		// Create CD processor for handling the build
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		report, err := processor.BuildInMemory(cmd.Context(), imageFile, outputFile, options)
+		if err != nil {
+			return fmt.Errorf("failed to build %s: %w", outputFile, err)
+		}
+
+		var writer io.Writer = os.Stdout
+		if reportFile != "" {
+			file, err := common.CreateOutput(reportFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+		if err := pkg.WriteMemoryBuildReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write build report: %w", err)
+		}
+
+		common.Printf("Built image written to: %s\n", outputFile)
+		return nil
+	},
+}
+
 // init initializes the CD command with its subcommands and flags.
 func init() {
 	// Add the CD command to the root command
@@ -90,4 +1169,106 @@ func init() {
 
 	// Add verbose flag to the dump command
 	cdDumpCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output with detailed file information")
+	cdDumpCmd.Flags().Int64("max-file-size", 0, "Largest file to extract in bytes (0 uses the default of 700 MiB)")
+	cdDumpCmd.Flags().Int64("max-total-size", 0, "Total bytes to extract (0 uses twice the image data size)")
+	cdDumpCmd.Flags().String("archive", "", "Write the extracted files into this .zip archive instead of an output directory")
+	cdDumpCmd.Flags().String("name-template", "", "Name extracted files from {index}, {msf}, {lba}, {size} and {name} placeholders")
+	cdDumpCmd.Flags().Bool("preserve-msf-names", false, "Name extracted files {index}_{msf}_{name} so listings sort by disc layout")
+	cdDumpCmd.Flags().Bool("audio-tracks", false, "Also write the CD-DA tracks of a CUE sheet as trackNN.wav files")
+	cdDumpCmd.Flags().Bool("raw-xa", false, "Write XA and STR files as raw 2352-byte sectors")
+	cdDumpCmd.Flags().String("manifest", "", "Write the layout of the image (LBA, size, XA attributes, dumped file) to this .yaml or .xml file")
+
+	// Add the sheet subcommand to the CD command
+	cdCmd.AddCommand(cdSheetCmd)
+
+	// Add flags to the sheet command
+	cdSheetCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdSheetCmd.Flags().Bool("ccd", false, "Also write a CloneCD (.ccd) control file")
+
+	// Add the checksum subcommand to the CD command
+	cdCmd.AddCommand(cdChecksumCmd)
+
+	// Add flags to the checksum command
+	cdChecksumCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdChecksumCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdChecksumCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add the orphans subcommand to the CD command
+	cdCmd.AddCommand(cdOrphansCmd)
+
+	// Add flags to the orphans command
+	cdOrphansCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdOrphansCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdOrphansCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	cdOrphansCmd.Flags().Bool("include-empty", false, "Also dump zero-filled regions")
+
+	// Add id subcommand to the cd command
+	cdCmd.AddCommand(cdTracksCmd)
+
+	// Add flags to tracks command
+	cdTracksCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdTracksCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdTracksCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	cdCmd.AddCommand(cdIDCmd)
+
+	// Add flags to the id command
+	cdIDCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdIDCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdIDCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	cdIDCmd.Flags().StringP("profiles-dir", "d", profiles.DefaultOverrideDir(), "Override directory for user-supplied profiles")
+
+	// Add diff subcommand to the cd command
+	cdCmd.AddCommand(cdDiffCmd)
+
+	// Add flags to the diff command
+	cdDiffCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdDiffCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdDiffCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add verify subcommand to the cd command
+	cdCmd.AddCommand(cdVerifyCmd)
+
+	// Add flags to the verify command
+	cdVerifyCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdVerifyCmd.Flags().Bool("strict", false, "Apply the full conformance suite (ordering, padding, identifiers)")
+	cdVerifyCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdVerifyCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add finalize subcommand to the cd command
+	cdCmd.AddCommand(cdFinalizeCmd)
+
+	// Add flags to the finalize command
+	cdFinalizeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdFinalizeCmd.Flags().Int("pad-to", 0, "Pad the image to a 74- or 80-minute disc (0 disables)")
+	cdFinalizeCmd.Flags().StringP("output", "o", "", "Write the finalized image to this file (default: <image>_final.bin)")
+	cdFinalizeCmd.Flags().Bool("in-place", false, "Finalize the input image itself")
+	cdFinalizeCmd.Flags().Bool("dry-run", false, "Report the corrections without writing")
+	cdFinalizeCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdFinalizeCmd.MarkFlagsMutuallyExclusive("output", "in-place", "dry-run")
+
+	// Add convert-region subcommand to the cd command
+	cdCmd.AddCommand(cdConvertRegionCmd)
+
+	// Add flags to the convert-region command
+	cdConvertRegionCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdConvertRegionCmd.Flags().String("to", "", "Target region: NTSC-U, NTSC-J or PAL")
+	cdConvertRegionCmd.Flags().StringP("output", "o", "", "Write the converted image to this file (default: <image>_<region>.bin)")
+	cdConvertRegionCmd.Flags().Bool("in-place", false, "Convert the input image itself")
+	cdConvertRegionCmd.Flags().Bool("dry-run", false, "Check the patches and print the report without writing")
+	cdConvertRegionCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	cdConvertRegionCmd.Flags().StringP("profiles-dir", "d", profiles.DefaultOverrideDir(), "Override directory for user-supplied profiles")
+	_ = cdConvertRegionCmd.MarkFlagRequired("to")
+	cdConvertRegionCmd.MarkFlagsMutuallyExclusive("output", "in-place", "dry-run")
+
+	// Add build subcommand to the cd command
+	cdCmd.AddCommand(cdBuildCmd)
+
+	// Add flags to the build command
+	cdBuildCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	cdBuildCmd.Flags().StringArray("wfm", nil, "Encode a dialogue file into a WFM file of the disc: DISC_PATH=dialogues.yaml (repeatable)")
+	cdBuildCmd.Flags().StringArray("file", nil, "Replace a disc file with a prebuilt file: DISC_PATH=FILE (repeatable)")
+	cdBuildCmd.Flags().Bool("glyphs-from-disc", false, "Encode with the glyphs of the WFM file being replaced")
+	cdBuildCmd.Flags().StringP("report", "r", "", "Write the report to a file instead of stdout")
+	cdBuildCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
 }
@@ -0,0 +1,161 @@
+// Package cmd provides command-line interface for staff roll text processing.
+// This file contains commands for extracting and injecting the packed credits
+// text stream used by the Tomba! PlayStation game.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// creditsCmd represents the parent command for all staff roll operations.
+var creditsCmd = &cobra.Command{
+	Use:   "credits",
+	Short: "Extract and inject the staff roll (credits) text",
+	Long: `Extract and inject the staff roll text, a packed stream of lines separate from
+the WFM dialogues, using a YAML profile that describes where each stream lives.
+GAM files are decompressed before reading and recompressed after injecting; any
+other file is read and written as is.
+
+Profile format:
+  files:
+    STAFF.GAM:
+      streams:
+        - name: staff
+          offset: 0x200     # Offset in the (decompressed) file
+          size: 0x800       # Bytes reserved for the stream
+          charset: ascii    # ascii, windows-1252 or shift-jis
+          line_end: 0x00    # Byte ending every line
+          stream_end: 0xFF  # Byte ending the stream
+          pad_byte: 0xFF    # Byte filling unused space (default: stream_end)
+          styles:           # Leading byte of every line (omit for none)
+            heading: 0x01
+            name: 0x02
+
+Lines whose style byte is not listed keep it in hexadecimal ("0x07").
+
+Commands:
+  extract   Write the configured streams of a file to a YAML file
+  inject    Write translated lines back into a file
+
+Examples:
+  tombatools credits extract --profile credits.yaml STAFF.GAM credits.yaml
+  tombatools credits inject --profile credits.yaml STAFF.GAM credits.yaml STAFF_new.GAM`,
+}
+
+// creditsExtractCmd extracts staff roll streams from a file to YAML.
+var creditsExtractCmd = &cobra.Command{
+	Use:   "extract [input_file] [output.yaml]",
+	Short: "Extract the staff roll text of a file",
+	Long: `Extract the staff roll streams configured for a file to a YAML file.
+
+The file is matched against the profile by file name.
+
+Example:
+  tombatools credits extract --profile credits.yaml STAFF.GAM credits.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profileFile, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return fmt.Errorf("error getting profile flag: %w", err)
+		}
+
+		profile, err := pkg.LoadCreditsProfile(profileFile)
+		if err != nil {
+			return fmt.Errorf("failed to load credits profile: %w", err)
+		}
+
+		// Create credits processor for handling extract operations
+		processor := pkg.NewCreditsProcessor()
+
+		common.Printf("Processing file: %s\n", inputFile)
+		common.Printf("Output file: %s\n", outputFile)
+
+		if err := processor.Extract(inputFile, profile, outputFile); err != nil {
+			return fmt.Errorf("failed to extract credits: %w", err)
+		}
+
+		common.Println("Credits extracted successfully!")
+		return nil
+	},
+}
+
+// creditsInjectCmd writes translated staff roll streams back into a file.
+var creditsInjectCmd = &cobra.Command{
+	Use:   "inject [input_file] [credits.yaml] [output_file]",
+	Short: "Inject translated staff roll text into a file",
+	Long: `Inject translated staff roll streams from a YAML file into a copy of a file.
+
+Every stream must fit the space reserved for it once packed; the remaining space
+is padded. GAM files are recompressed, other files keep their size.
+
+Example:
+  tombatools credits inject --profile credits.yaml STAFF.GAM credits.yaml STAFF_new.GAM`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		creditsFile := args[1]
+		outputFile := args[2]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profileFile, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return fmt.Errorf("error getting profile flag: %w", err)
+		}
+
+		profile, err := pkg.LoadCreditsProfile(profileFile)
+		if err != nil {
+			return fmt.Errorf("failed to load credits profile: %w", err)
+		}
+
+		// Create credits processor for handling inject operations
+		processor := pkg.NewCreditsProcessor()
+
+		common.Printf("Input file: %s\n", inputFile)
+		common.Printf("Credits file: %s\n", creditsFile)
+		common.Printf("Output file: %s\n", outputFile)
+
+		if err := processor.Inject(cmd.Context(), inputFile, profile, creditsFile, outputFile); err != nil {
+			return fmt.Errorf("failed to inject credits: %w", err)
+		}
+
+		common.Println("Credits injected successfully!")
+		return nil
+	},
+}
+
+// init initializes the credits command and its subcommands with appropriate flags.
+func init() {
+	// Register the credits command with the root command
+	rootCmd.AddCommand(creditsCmd)
+
+	// Add subcommands to the credits command
+	creditsCmd.AddCommand(creditsExtractCmd)
+	creditsCmd.AddCommand(creditsInjectCmd)
+
+	// Add flags to the credits subcommands
+	for _, subCmd := range []*cobra.Command{creditsExtractCmd, creditsInjectCmd} {
+		subCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+		subCmd.Flags().StringP("profile", "p", "", "YAML profile describing the credits streams")
+		_ = subCmd.MarkFlagRequired("profile")
+	}
+}
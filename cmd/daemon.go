@@ -0,0 +1,145 @@
+// Package cmd provides command-line interface for the editor daemon.
+// This file contains the daemon command, which keeps a WFM font and a dialogue file
+// loaded and answers decode, preview and validation requests of editor plugins.
+package cmd
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/daemonserver"
+	"github.com/spf13/cobra"
+)
+
+// daemonCmd serves editor plugins until interrupted
+var daemonCmd = &cobra.Command{
+	Use:   "daemon [wfm_file] [dialogues.yaml]",
+	Short: "Serve decode, preview and validation requests of editor plugins",
+	Long: `Run a long-lived process that keeps a WFM font and a dialogue file loaded, so
+text editor plugins can show the line budget and wrap preview while a translator
+types in dialogues.yaml.
+
+The daemon serves the gRPC service tombatools.daemon.v1.Daemon, defined in
+pkg/daemonpb/daemon.proto, on a TCP address. Server reflection is enabled, so
+grpcurl and similar clients need no copy of the proto file. The dialogue file
+is watched: when it changes on disk it is reloaded and every WatchDialogues
+stream receives an event. A file that fails to parse (saved half way) keeps the
+previous dialogues.
+
+Methods:
+  DecodeDialogue  {"id": 12}
+                  Dialogue 12 decoded from the WFM file, with its current
+                  content in the dialogue file
+  RenderPreview   {"text": "Hello!", "height": 16, "width": 200}
+                  {"id": 12, "box": 0, "width": 200}
+                  PNG of the text, or of a box of a dialogue, in the game
+                  font; width wraps lines at spaces
+  ValidateEdit    {"id": 12, "text": "Edited text"}
+                  Lint issues (line and glyph widths, terminators, glossary)
+                  and every text box page with its widest line and overflow,
+                  for unsaved text or content
+  WatchDialogues  {}
+                  Stream of events, one per reload of the dialogue file
+
+Flags:
+      --listen    TCP address to listen on (default: 127.0.0.1:7420)
+      --fonts     Reference font directory (default: fonts)
+      --glossary  Glossary checked by ValidateEdit (default: none)
+      --original  Original dialogue YAML file for the glossary and terminator checks
+      --profile   Game profile providing the glyph width limits (default: tomba)
+      --width     Line width in pixels (default: widest original line per height)
+      --poll      How often the dialogue file is checked for changes (default: 500ms)
+  -v, --verbose   Enable verbose output
+
+Examples:
+  tombatools daemon CFNT999H.WFM translated.yaml
+  tombatools daemon --listen 127.0.0.1:9000 --glossary glossary.yaml CFNT999H.WFM translated.yaml
+  grpcurl -plaintext -d '{"id": 0}' 127.0.0.1:7420 tombatools.daemon.v1.Daemon/DecodeDialogue`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		listen, err := cmd.Flags().GetString("listen")
+		if err != nil {
+			return fmt.Errorf("error getting listen flag: %w", err)
+		}
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+		glossaryFile, err := cmd.Flags().GetString("glossary")
+		if err != nil {
+			return fmt.Errorf("error getting glossary flag: %w", err)
+		}
+		originalFile, err := cmd.Flags().GetString("original")
+		if err != nil {
+			return fmt.Errorf("error getting original flag: %w", err)
+		}
+		width, err := cmd.Flags().GetInt("width")
+		if err != nil {
+			return fmt.Errorf("error getting width flag: %w", err)
+		}
+		poll, err := cmd.Flags().GetDuration("poll")
+		if err != nil {
+			return fmt.Errorf("error getting poll flag: %w", err)
+		}
+
+		// The rules of wfm lint; the glossary is only checked when given
+		terminatorRule, err := pkg.LoadTerminatorRule(originalFile)
+		if err != nil {
+			return fmt.Errorf("failed to load terminator rule: %w", err)
+		}
+		glyphWidthLimits, err := profileGlyphWidthLimits(cmd)
+		if err != nil {
+			return err
+		}
+		rules := []pkg.LintRule{pkg.NewLineWidthRule(), terminatorRule, pkg.NewGlyphWidthRule(fontDir, glyphWidthLimits)}
+		if glossaryFile != "" {
+			glossaryRule, err := pkg.LoadGlossaryRule(glossaryFile, originalFile)
+			if err != nil {
+				return fmt.Errorf("failed to load glossary rule: %w", err)
+			}
+			rules = append(rules, glossaryRule)
+		}
+
+		daemon, err := pkg.NewDaemon(pkg.DaemonOptions{
+			WFMFile:      args[0],
+			Dialogues:    args[1],
+			FontDir:      fontDir,
+			Rules:        rules,
+			Width:        width,
+			PollInterval: poll,
+		})
+		if err != nil {
+			return err
+		}
+
+		listener, err := net.Listen("tcp", listen)
+		if err != nil {
+			return fmt.Errorf("failed to listen on %s: %w", listen, err)
+		}
+		common.LogInfo("Serving gRPC on %s", listener.Addr())
+		return daemonserver.Serve(cmd.Context(), daemon, listener)
+	},
+}
+
+// init registers the daemon command and its flags
+func init() {
+	rootCmd.AddCommand(daemonCmd)
+
+	daemonCmd.Flags().String("listen", pkg.DefaultDaemonAddress, "TCP address to listen on")
+	daemonCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to map glyphs to characters")
+	daemonCmd.Flags().String("glossary", "", "Glossary file checked by ValidateEdit (empty skips the glossary check)")
+	daemonCmd.Flags().String("original", "", "Original dialogue YAML file for the glossary and terminator checks")
+	daemonCmd.Flags().String("profile", "tomba", "Game profile providing the glyph width limits")
+	daemonCmd.Flags().Int("width", 0, "Line width in pixels (0 uses the widest original line of each font height)")
+	daemonCmd.Flags().Duration("poll", pkg.DefaultDaemonPollInterval, "How often the dialogue file is checked for changes")
+	daemonCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+}
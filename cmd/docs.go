@@ -0,0 +1,141 @@
+// Package cmd provides command-line interface for offline documentation.
+// This file contains the man page generator and the file format help topics
+// rendered from the documentation embedded in the binary.
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/formats"
+	"github.com/spf13/cobra"
+	"github.com/spf13/cobra/doc"
+)
+
+// formatsCmd groups the file format help topics. It has no action of its own;
+// topics are read with the help command.
+var formatsCmd = &cobra.Command{
+	Use:   "formats",
+	Short: "File format documentation (tombatools help formats wfm|gam|fla)",
+	Long: `File format documentation embedded in TombaTools.
+
+Every topic lists the field tables and offsets of a game format. formats export
+writes the same layouts as machine-readable descriptors.
+
+Examples:
+  tombatools help formats wfm
+  tombatools help formats gam
+  tombatools help formats fla
+  tombatools formats export ./schemas/`,
+}
+
+// formatsExportCmd writes the machine-readable format descriptors
+var formatsExportCmd = &cobra.Command{
+	Use:   "export [output_directory]",
+	Short: "Export Kaitai Struct and JSON descriptors of the WFM, GAM and FLA formats",
+	Long: `Export the binary layouts of the WFM, GAM and FLA formats as machine-readable
+descriptors, so other tools and hex-editor templates stay in sync with TombaTools.
+
+Every format gets two files:
+  <format>.ksy   Kaitai Struct description (compile it with kaitai-struct-compiler
+                 or open it in the Kaitai Web IDE)
+  <format>.json  JSON layout descriptor: every type with its size and the offset,
+                 size, type and description of each field
+
+The descriptors are generated from the Go structs TombaTools reads the formats
+with (go generate ./pkg/formats), so they always match this version.
+
+Flags:
+  --kind  Export only ksy or json descriptors (default: both)
+
+Examples:
+  tombatools formats export ./schemas/
+  tombatools formats export --kind ksy ./schemas/`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputDir := args[0]
+
+		kind, err := cmd.Flags().GetString("kind")
+		if err != nil {
+			return fmt.Errorf("error getting kind flag: %w", err)
+		}
+
+		paths, err := formats.ExportSchemas(outputDir, kind)
+		if err != nil {
+			return err
+		}
+		for _, schemaPath := range paths {
+			common.Printf("- %s\n", schemaPath)
+		}
+		common.Printf("%d format descriptors written to: %s\n", len(paths), outputDir)
+		return nil
+	},
+}
+
+// manCmd writes a man page for every command
+var manCmd = &cobra.Command{
+	Use:   "man [output_directory]",
+	Short: "Generate man pages for every command",
+	Long: `Generate a man page (section 1) for TombaTools and each of its commands.
+
+Pages are named after the command path (e.g. tombatools-wfm-decode.1). Install
+them into a man directory to read them with man:
+
+Example:
+  tombatools man ./man/
+  sudo cp ./man/*.1 /usr/local/share/man/man1/
+  man tombatools-wfm-decode`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		outputDir := args[0]
+
+		if err := os.MkdirAll(outputDir, 0o750); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create output directory: %w", err))
+		}
+
+		header := &doc.GenManHeader{
+			Title:   "TOMBATOOLS",
+			Section: "1",
+			Source:  "TombaTools " + toolVersion,
+			Manual:  "TombaTools Manual",
+		}
+		root := cmd.Root()
+		root.DisableAutoGenTag = true
+		if err := doc.GenManTree(root, header, outputDir); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to generate man pages: %w", err))
+		}
+
+		common.Printf("Man pages written to: %s\n", outputDir)
+		return nil
+	},
+}
+
+// addFormatTopics adds a help topic for every embedded format document
+func addFormatTopics() {
+	topics, err := formats.List()
+	if err != nil {
+		common.LogWarn("Format help topics unavailable: %v", err)
+		return
+	}
+	for _, topic := range topics {
+		formatsCmd.AddCommand(&cobra.Command{
+			Use:   topic.Name,
+			Short: topic.Title,
+			Long:  topic.Title + "\n\n" + topic.Text,
+		})
+	}
+}
+
+// init registers the documentation commands with the root command
+func init() {
+	rootCmd.AddCommand(formatsCmd)
+	rootCmd.AddCommand(manCmd)
+
+	// Add the export subcommand to the formats command
+	formatsCmd.AddCommand(formatsExportCmd)
+	formatsExportCmd.Flags().String("kind", "", "Export only ksy (Kaitai Struct) or json (layout) descriptors")
+
+	// Format topics come from the embedded documentation
+	addFormatTopics()
+}
@@ -0,0 +1,130 @@
+// Package cmd provides command-line interface for diagnosing a translation project.
+// This file contains the doctor command, which checks the working directory for the
+// files TombaTools expects and prints how to fix what is missing or broken.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/profiles"
+	"github.com/spf13/cobra"
+)
+
+// doctorCmd checks the setup of a translation project directory
+var doctorCmd = &cobra.Command{
+	Use:   "doctor [directory]",
+	Short: "Diagnose the setup of a translation project directory",
+	Long: `Check a translation project directory (default: the working directory) and
+print an actionable fix for every problem found:
+
+  profile      The format profile loads, user overrides included
+  fonts        fonts/ exists, fonts/br (read by encode) is present and every
+               region has a font per profile height with the letters and digits
+  palettes     palettes.yaml is present and valid
+  dialogues    dialogues.yaml parses (when present)
+  glossary     glossary.yaml is valid (when present)
+  cache        unmapped-codes.yaml is readable and no temporary workspaces
+               were left behind by interrupted or --keep-temp runs
+  images       Disc images (.bin, .img, .iso) are present and readable
+  permissions  The directory and the temporary root are writable
+
+The command fails (exit code 4) when errors are found; warnings only point
+at optional setup.
+
+Flags:
+  -f, --format        Report format: json or markdown (default: markdown)
+  -o, --output        Write the report to a file instead of stdout
+      --profile       Game profile whose font heights are checked (default: tomba)
+  -d, --profiles-dir  Override directory for user-supplied profiles
+
+Examples:
+  tombatools doctor
+  tombatools doctor ./project/
+  tombatools doctor -f json -o doctor.json`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		profileName, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return fmt.Errorf("error getting profile flag: %w", err)
+		}
+
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		// Font heights come from the profile; a broken profile is reported, not fatal
+		doctorProfile := pkg.DoctorProfile{Name: profileName, OverrideDir: overrideDir}
+		profile, err := profiles.Load(profileName, overrideDir)
+		if err != nil {
+			doctorProfile.Err = err
+		} else {
+			doctorProfile.Source = profile.Source
+			doctorProfile.FontHeights = profile.Constraints.FontHeights
+		}
+
+		report := pkg.NewDoctor(dir, doctorProfile).Run()
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteDoctorReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write doctor report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Doctor report written to: %s\n", outputFile)
+		}
+
+		if report.Errors > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d errors and %d warnings found", report.Errors, report.Warnings))
+		}
+		return nil
+	},
+}
+
+// init registers the doctor command and its flags.
+func init() {
+	rootCmd.AddCommand(doctorCmd)
+
+	doctorCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	doctorCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	doctorCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	doctorCmd.Flags().String("profile", "tomba", "Game profile whose font heights are checked")
+	doctorCmd.Flags().StringP("profiles-dir", "d", profiles.DefaultOverrideDir(), "Override directory for user-supplied profiles")
+}
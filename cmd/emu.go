@@ -0,0 +1,157 @@
+// Package cmd provides command-line interface for emulator integration.
+// This file contains commands for hot-loading freshly encoded files into the RAM
+// of a running emulator through its GDB stub, without rebuilding the disc image.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/emu"
+	"github.com/spf13/cobra"
+)
+
+// defaultEmulatorTarget is the address of the emulator GDB stub when --target is not given
+const defaultEmulatorTarget = "127.0.0.1:3333"
+
+// emuCmd represents the parent command for all emulator operations.
+var emuCmd = &cobra.Command{
+	Use:   "emu",
+	Short: "Patch files into a running emulator for instant testing",
+	Long: `Patch files into a running PlayStation emulator for instant testing.
+
+The emulator must have its GDB server enabled (DuckStation and PCSX-Redux both
+provide one in their debugging settings). Only the GDB remote protocol is
+supported; TCP SIO links need a loader running on the emulated console.
+
+Commands:
+  patch-ram    Write a file into main RAM at a given address
+
+Examples:
+  tombatools emu patch-ram --addr 0x80100000 --from CFNT999H.WFM
+  tombatools emu patch-ram --target 127.0.0.1:1234 --addr 0x80100000 --from CFNT999H.WFM`,
+}
+
+// emuPatchRAMCmd writes a file (or part of it) into the main RAM of a running emulator
+var emuPatchRAMCmd = &cobra.Command{
+	Use:   "patch-ram",
+	Short: "Write a file into the main RAM of a running emulator",
+	Long: `Write a file into the main RAM of a running emulator through its GDB stub.
+
+The emulated CPU is halted during the write and resumed afterwards, so a freshly
+encoded WFM or GAM can replace the copy the game already loaded. The address is
+a main RAM address (0x80000000-0x801FFFFF; KUSEG and KSEG1 mirrors are accepted).
+
+Flags:
+  -v, --verbose    Enable verbose output (show debug messages)
+  --target         GDB stub address as host:port (default: 127.0.0.1:3333)
+  --addr           RAM address to write to (required)
+  --from           File whose contents are written (required)
+  --offset         Skip this many bytes of the file
+  --length         Write only this many bytes (0 writes up to the end of the file)
+  --verify         Read the range back and compare it with the file
+  --no-halt        Write while the CPU keeps running
+
+Examples:
+  tombatools emu patch-ram --addr 0x80100000 --from CFNT999H.WFM
+  tombatools emu patch-ram --addr 0x80100000 --from CFNT999H.WFM --verify
+  tombatools emu patch-ram --target 127.0.0.1:1234 --addr 0x80100000 --from STAGE.UNGAM --offset 0x800 --length 0x400`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		target, err := cmd.Flags().GetString("target")
+		if err != nil {
+			return fmt.Errorf("error getting target flag: %w", err)
+		}
+
+		addrStr, err := cmd.Flags().GetString("addr")
+		if err != nil {
+			return fmt.Errorf("error getting addr flag: %w", err)
+		}
+		address, err := strconv.ParseUint(addrStr, 0, 32)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %w", addrStr, err)
+		}
+
+		inputFile, err := cmd.Flags().GetString("from")
+		if err != nil {
+			return fmt.Errorf("error getting from flag: %w", err)
+		}
+
+		offset, err := cmd.Flags().GetInt64("offset")
+		if err != nil {
+			return fmt.Errorf("error getting offset flag: %w", err)
+		}
+
+		length, err := cmd.Flags().GetInt64("length")
+		if err != nil {
+			return fmt.Errorf("error getting length flag: %w", err)
+		}
+
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			return fmt.Errorf("error getting verify flag: %w", err)
+		}
+
+		noHalt, err := cmd.Flags().GetBool("no-halt")
+		if err != nil {
+			return fmt.Errorf("error getting no-halt flag: %w", err)
+		}
+
+		data, err := os.ReadFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to read input file: %w", err)
+		}
+		if offset < 0 || offset > int64(len(data)) || length < 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("invalid range: offset %d, length %d for a %d-byte file", offset, length, len(data)))
+		}
+		data = data[offset:]
+		if length > 0 {
+			if length > int64(len(data)) {
+				return common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("length %d runs past the end of the file", length))
+			}
+			data = data[:length]
+		}
+
+		common.Printf("Emulator: %s\n", target)
+		common.Printf("Writing %d bytes of %s to 0x%08X\n", len(data), inputFile, address)
+
+		options := emu.PatchOptions{Halt: !noHalt, Verify: verify}
+		if err := emu.PatchRAM(target, uint32(address), data, options); err != nil {
+			return fmt.Errorf("failed to patch emulator RAM: %w", err)
+		}
+
+		common.Println("RAM patched successfully!")
+		return nil
+	},
+}
+
+func init() {
+	// Register the emu command with the root command
+	rootCmd.AddCommand(emuCmd)
+
+	// Add subcommands to the emu command
+	emuCmd.AddCommand(emuPatchRAMCmd)
+
+	// Add flags to patch-ram command
+	emuPatchRAMCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	emuPatchRAMCmd.Flags().String("target", defaultEmulatorTarget, "GDB stub address of the emulator (host:port)")
+	emuPatchRAMCmd.Flags().String("addr", "", "RAM address to write to (e.g. 0x80100000)")
+	emuPatchRAMCmd.Flags().String("from", "", "File whose contents are written to RAM")
+	emuPatchRAMCmd.Flags().Int64("offset", 0, "Skip this many bytes of the file")
+	emuPatchRAMCmd.Flags().Int64("length", 0, "Write only this many bytes (0 writes up to the end of the file)")
+	emuPatchRAMCmd.Flags().Bool("verify", false, "Read the range back and compare it with the file")
+	emuPatchRAMCmd.Flags().Bool("no-halt", false, "Write while the emulated CPU keeps running")
+	_ = emuPatchRAMCmd.MarkFlagRequired("addr")
+	_ = emuPatchRAMCmd.MarkFlagRequired("from")
+}
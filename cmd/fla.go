@@ -4,6 +4,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/hansbonini/tombatools/pkg"
@@ -21,9 +22,11 @@ var flaCmd = &cobra.Command{
 
 Commands:
   recalc    Recalculate file addresses after modifications
+  verify    Check the FLA table of a modified image against its files
 
 Examples:
-  tombatools fla recalc original.bin`,
+  tombatools fla recalc -o patched.bin original.bin modified.bin
+  tombatools fla verify original.bin modified.bin`,
 }
 
 // flaRecalcCmd recalculates file link addresses by comparing original and modified CD images.
@@ -34,7 +37,22 @@ var flaRecalcCmd = &cobra.Command{
 	Long: `Recalculate file link addresses by comparing original and modified CD images.
 
 This command compares two CD images, detects files with different MSF timecodes
-and sizes, and recalculates the File Link Address (FLA) table in the modified image.
+and sizes, and recalculates the File Link Address (FLA) table of the modified image.
+New timecodes are taken from where the directory records of the modified image put
+each file, so alignment padding and Form 2 or CD-DA regions between files are kept;
+entries pointing into a gap keep their distance from the file before it.
+
+The modified image is never changed unless --in-place is given: the recalculated
+table is written to a copy (modified_recalc.bin next to it, or --output). With
+--in-place, the bytes about to be replaced are backed up and restored if the
+write fails or is interrupted.
+
+The written table is then read back and every entry is resolved against the
+directory records of the modified image; entries that no longer point at their
+file, or whose size no longer matches it, are reported and the command fails.
+
+With an artifact store (see store init), recalculating unchanged images into a
+copy restores the copy from the store.
 
 Arguments:
   original.bin    Original CD image file (reference)
@@ -42,16 +60,25 @@ Arguments:
 
 Flags:
   -v, --verbose       Enable verbose output (show debug messages)
-  -s, --save-table    Save the recalculated FLA table to a .bin file
+  -o, --output        Write the recalculated image to this file
+                      (default: modified_recalc.bin next to the modified image)
+      --in-place      Write the recalculated table into the modified image itself
+  -s, --save-table    Save the recalculated FLA table to a file (.bin raw table,
+                      .json/.yaml table with the detected differences)
 
 Examples:
   tombatools fla recalc original.bin modified.bin
+  tombatools fla recalc -o patched.bin original.bin modified.bin
+  tombatools fla recalc --in-place original.bin modified.bin
   tombatools fla recalc -v original.bin modified.bin
-  tombatools fla recalc --save-table fla_table.bin original.bin modified.bin`,
+  tombatools fla recalc --save-table fla_table.bin original.bin modified.bin
+  tombatools fla recalc --save-table fla_table.json original.bin modified.bin`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		originalBin := args[0]
 		modifiedBin := args[1]
+		common.RecordInput(originalBin)
+		common.RecordInput(modifiedBin)
 
 		// Enable verbose mode if requested
 		verbose, err := cmd.Flags().GetBool("verbose")
@@ -66,104 +93,243 @@ Examples:
 			return fmt.Errorf("error getting save-table flag: %w", err)
 		}
 
-		fmt.Printf("Original CD image: %s\n", originalBin)
-		fmt.Printf("Modified CD image: %s\n", modifiedBin)
+		outputBin, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
 
-		// Create FLA processor for handling recalculation operations
-		processor := pkg.NewFLAProcessor()
+		inPlace, err := cmd.Flags().GetBool("in-place")
+		if err != nil {
+			return fmt.Errorf("error getting in-place flag: %w", err)
+		}
+		if outputBin == "" && !inPlace {
+			outputBin = pkg.CopiedImagePath(modifiedBin, "_recalc")
+		}
 
-		fmt.Printf("\nAnalyzing original CD image...\n")
+		common.Printf("Original CD image: %s\n", originalBin)
+		common.Printf("Modified CD image: %s\n", modifiedBin)
 
-		// Analyze the original CD image and extract FLA table
-		originalTable, err := processor.AnalyzeCDImage(originalBin)
-		if err != nil {
-			return fmt.Errorf("failed to analyze original CD image: %w", err)
+		// An in-place recalculation changes its own input, so it is never restored from the store
+		if inPlace {
+			return recalculateFLA(cmd.Context(), originalBin, modifiedBin, "", saveTable)
+		}
+		outputs := []string{outputBin}
+		if saveTable != "" {
+			outputs = append(outputs, saveTable)
 		}
+		return runStoredBuild(cmd, []string{originalBin, modifiedBin}, outputs, func() error {
+			return recalculateFLA(cmd.Context(), originalBin, modifiedBin, outputBin, saveTable)
+		})
+	},
+}
 
-		fmt.Printf("Original FLA Table: Found %d entries at offset 0x%X\n", originalTable.Count, originalTable.Offset)
+// recalculateFLA recalculates the FLA table of the modified image into outputBin, or
+// into the modified image itself when outputBin is empty, and saves the table to
+// saveTable when given
+func recalculateFLA(ctx context.Context, originalBin, modifiedBin, outputBin, saveTable string) error {
+	// Create FLA processor for handling recalculation operations
+	processor := pkg.NewFLAProcessor()
 
-		fmt.Printf("\nAnalyzing modified CD image...\n")
+	common.Printf("\nAnalyzing original CD image...\n")
 
-		// Analyze the modified CD image and extract FLA table
-		modifiedTable, err := processor.AnalyzeCDImage(modifiedBin)
-		if err != nil {
-			return fmt.Errorf("failed to analyze modified CD image: %w", err)
-		}
+	// Analyze the original CD image and extract FLA table
+	originalTable, err := processor.AnalyzeCDImage(originalBin)
+	if err != nil {
+		return fmt.Errorf("failed to analyze original CD image: %w", err)
+	}
 
-		fmt.Printf("Modified FLA Table: Found %d entries at offset 0x%X\n", modifiedTable.Count, modifiedTable.Offset)
+	common.Printf("Original FLA Table: Found %d entries at offset 0x%X\n", originalTable.Count, originalTable.Offset)
 
-		fmt.Printf("\nComparing actual files between CD images to detect differences...\n")
+	common.Printf("\nAnalyzing modified CD image...\n")
 
-		// Compare actual files in CD images to detect differences
-		fileDifferences, err := processor.CompareCDFiles(originalBin, modifiedBin, originalTable, modifiedTable)
-		if err != nil {
-			return fmt.Errorf("failed to compare CD files: %w", err)
-		}
+	// Analyze the modified CD image and extract FLA table
+	modifiedTable, err := processor.AnalyzeCDImage(modifiedBin)
+	if err != nil {
+		return fmt.Errorf("failed to analyze modified CD image: %w", err)
+	}
 
-		if len(fileDifferences) == 0 {
-			fmt.Printf("No differences found between CD files.\n")
-			return nil
-		}
+	common.Printf("Modified FLA Table: Found %d entries at offset 0x%X\n", modifiedTable.Count, modifiedTable.Offset)
 
-		fmt.Printf("Found %d file differences that require FLA table updates:\n\n", len(fileDifferences))
+	common.Printf("\nComparing actual files between CD images to detect differences...\n")
 
-		fmt.Printf("\nRecalculating FLA table in modified image...\n")
+	// Compare actual files in CD images to detect differences
+	fileDifferences, err := processor.CompareCDFiles(originalBin, modifiedBin, originalTable, modifiedTable)
+	if err != nil {
+		return fmt.Errorf("failed to compare CD files: %w", err)
+	}
 
-		// Recalculate and update the FLA table in the modified image
-		err = processor.RecalculateFLATable(modifiedBin, originalTable, modifiedTable, fileDifferences)
-		if err != nil {
+	if len(fileDifferences) == 0 {
+		common.Printf("No differences found between CD files.\n")
+		return nil
+	}
+
+	common.Printf("Found %d file differences that require FLA table updates:\n\n", len(fileDifferences))
+
+	// Recalculate the FLA table and read it back from the image it was written to
+	recalculate := func(imagePath string) error {
+		if err := processor.RecalculateFLATable(ctx, imagePath, originalTable, modifiedTable, fileDifferences); err != nil {
 			return fmt.Errorf("failed to recalculate FLA table: %w", err)
 		}
 
-		// Save FLA table to separate file if requested
-		if saveTable != "" {
-			fmt.Printf("Saving recalculated FLA table to: %s\n", saveTable)
+		common.Printf("\nVerifying written FLA table...\n")
+		verification, err := processor.VerifyFLATable(imagePath, originalTable, modifiedTable)
+		if err != nil {
+			return fmt.Errorf("failed to verify FLA table: %w", err)
+		}
+		return printFLAVerification(verification)
+	}
+
+	targetBin := modifiedBin
+	if outputBin == "" {
+		common.LogWarn("Modifying %s in place; keep a copy of your original dump", modifiedBin)
+		common.Printf("\nRecalculating FLA table in modified image...\n")
+		err = recalculate(modifiedBin)
+	} else {
+		targetBin = outputBin
+		common.Printf("\nRecalculating FLA table into a copy: %s\n", outputBin)
+		err = pkg.WithImageCopy(ctx, modifiedBin, outputBin, recalculate)
+	}
+	if err != nil {
+		return err
+	}
+
+	// Save FLA table to separate file if requested
+	if saveTable != "" {
+		common.Printf("Saving recalculated FLA table to: %s\n", saveTable)
+		if format, ok := pkg.FLAFormatFromPath(saveTable); ok {
+			err = saveFLADocument(&pkg.FLADocument{Table: modifiedTable, Differences: fileDifferences}, format, saveTable)
+		} else {
 			err = processor.SaveFLATableToFile(modifiedTable, saveTable)
-			if err != nil {
-				return fmt.Errorf("failed to save FLA table to file: %w", err)
-			}
-			fmt.Printf("FLA table saved successfully!\n")
 		}
+		if err != nil {
+			return fmt.Errorf("failed to save FLA table to file: %w", err)
+		}
+		common.Printf("FLA table saved successfully!\n")
+	}
+
+	// Display differences after recalculation to show updated values
+	common.Printf("ID   | FLA MSF        | Original Size | Modified Size | Size Diff | File\n")
+	common.Printf("-----|----------------|---------------|---------------|-----------|--------------------------------------------------\n")
+
+	for _, diff := range fileDifferences {
+		originalEntry := originalTable.Entries[diff.EntryIndex]
+		modifiedEntry := modifiedTable.Entries[diff.EntryIndex]
+
+		filename := "NOT LINKED"
+		if modifiedEntry.LinkedFile != nil {
+			filename = modifiedEntry.LinkedFile.FullPath
+		} else if originalEntry.LinkedFile != nil {
+			filename = originalEntry.LinkedFile.FullPath
+		}
+
+		// Use FLA table sizes for display (after recalculation they will show the updated sizes)
+		originalSize := originalEntry.FileSize
+		modifiedSize := modifiedEntry.FileSize
+
+		sizeDiff := int64(modifiedSize) - int64(originalSize)
+		sizeDiffStr := fmt.Sprintf("%+d", sizeDiff)
+
+		common.Printf("%04X | %-14s | %-13d | %-13d | %-9s | %s\n",
+			diff.EntryIndex,
+			originalEntry.Timecode.String(),
+			originalSize,
+			modifiedSize,
+			sizeDiffStr,
+			filename)
+	}
+
+	common.Printf("FLA table recalculation complete!\n")
+	common.Printf("\nSummary:\n")
+	common.Printf("- Detected %d file(s) with size changes\n", len(fileDifferences))
+	common.Printf("- Updated FLA table written to: %s\n", targetBin)
+	common.Printf("- All subsequent file positions have been recalculated\n")
+
+	return nil
+}
+
+// flaVerifyCmd checks the FLA table of a modified image without writing to it.
+var flaVerifyCmd = &cobra.Command{
+	Use:   "verify [original.bin] [modified.bin]",
+	Short: "Check the FLA table of a modified CD image against its directory records",
+	Long: `Check the FLA table of a modified CD image against its directory records.
+
+Every FLA entry that points at a file in the original image is resolved against
+the directory records of the modified image. Entries whose timecode no longer
+points at the same file, or whose size no longer matches the file, are reported.
+Neither image is modified.
+
+Arguments:
+  original.bin    Original CD image file (reference)
+  modified.bin    Modified CD image file (to be checked)
+
+Flags:
+  -v, --verbose    Enable verbose output (show debug messages)
+
+Examples:
+  tombatools fla verify original.bin modified.bin`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		originalBin := args[0]
+		modifiedBin := args[1]
+		common.RecordInput(originalBin)
+		common.RecordInput(modifiedBin)
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
 
-		// Display differences after recalculation to show updated values
-		fmt.Printf("ID   | FLA MSF        | Original Size | Modified Size | Size Diff | File\n")
-		fmt.Printf("-----|----------------|---------------|---------------|-----------|--------------------------------------------------\n")
-
-		for _, diff := range fileDifferences {
-			originalEntry := originalTable.Entries[diff.EntryIndex]
-			modifiedEntry := modifiedTable.Entries[diff.EntryIndex]
-
-			filename := "NOT LINKED"
-			if modifiedEntry.LinkedFile != nil {
-				filename = modifiedEntry.LinkedFile.FullPath
-			} else if originalEntry.LinkedFile != nil {
-				filename = originalEntry.LinkedFile.FullPath
-			}
-
-			// Use FLA table sizes for display (after recalculation they will show the updated sizes)
-			originalSize := originalEntry.FileSize
-			modifiedSize := modifiedEntry.FileSize
-
-			sizeDiff := int64(modifiedSize) - int64(originalSize)
-			sizeDiffStr := fmt.Sprintf("%+d", sizeDiff)
-
-			fmt.Printf("%04X | %-14s | %-13d | %-13d | %-9s | %s\n",
-				diff.EntryIndex,
-				originalEntry.Timecode.String(),
-				originalSize,
-				modifiedSize,
-				sizeDiffStr,
-				filename)
+		processor := pkg.NewFLAProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		originalTable, err := processor.AnalyzeCDImage(originalBin)
+		if err != nil {
+			return fmt.Errorf("failed to analyze original CD image: %w", err)
 		}
 
-		fmt.Printf("FLA table recalculation complete!\n")
-		fmt.Printf("\nSummary:\n")
-		fmt.Printf("- Detected %d file(s) with size changes\n", len(fileDifferences))
-		fmt.Printf("- Updated FLA table written to: %s\n", modifiedBin)
-		fmt.Printf("- All subsequent file positions have been recalculated\n")
+		verification, err := processor.VerifyFLATable(modifiedBin, originalTable, nil)
+		if err != nil {
+			return fmt.Errorf("failed to verify FLA table: %w", err)
+		}
+		return printFLAVerification(verification)
+	},
+}
 
+// printFLAVerification prints the result of an FLA verification and returns a validation
+// error when any entry does not match the image
+func printFLAVerification(verification *pkg.FLAVerification) error {
+	if verification.OK() {
+		common.Printf("Verified %d linked FLA entries: all match their files\n", verification.Checked)
 		return nil
-	},
+	}
+
+	common.Printf("ID   | FLA MSF        | FLA Size      | Problem       | File\n")
+	common.Printf("-----|----------------|---------------|---------------|--------------------------------------------------\n")
+	for _, issue := range verification.Issues {
+		common.Printf("%04X | %-14s | %-13d | %-13s | %s (%s)\n",
+			issue.EntryIndex,
+			issue.Timecode.String(),
+			issue.FileSize,
+			issue.Problem,
+			issue.File,
+			issue.Detail)
+	}
+
+	return common.WithCategory(common.ErrCategoryValidationFailed,
+		fmt.Errorf("%d of %d FLA entries do not match the image; do not burn it", len(verification.Issues), verification.Checked))
+}
+
+// saveFLADocument writes an FLA table and its differences as JSON or YAML
+func saveFLADocument(document *pkg.FLADocument, format string, filename string) error {
+	file, err := common.CreateOutput(filename)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create FLA document: %w", err))
+	}
+	defer file.Close()
+
+	return pkg.WriteFLADocument(document, format, file)
 }
 
 // init initializes the FLA command and its subcommands with appropriate flags.
@@ -173,10 +339,19 @@ func init() {
 
 	// Add subcommands to the FLA command
 	flaCmd.AddCommand(flaRecalcCmd)
+	flaCmd.AddCommand(flaVerifyCmd)
 
 	// Add verbose flag to recalc command for detailed output
 	flaRecalcCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
 
-	// Add save-table flag to save the recalculated FLA table to a separate .bin file
-	flaRecalcCmd.Flags().StringP("save-table", "s", "", "Save the recalculated FLA table to a .bin file")
+	// Add save-table flag to save the recalculated FLA table to a separate file
+	flaRecalcCmd.Flags().StringP("save-table", "s", "", "Save the recalculated FLA table to a .bin, .json or .yaml file")
+
+	// Add output flags; the modified image is only written with --in-place
+	flaRecalcCmd.Flags().StringP("output", "o", "", "Write the recalculated image to this file (default: <modified>_recalc.bin)")
+	flaRecalcCmd.Flags().Bool("in-place", false, "Write the recalculated FLA table into the modified image itself")
+	flaRecalcCmd.MarkFlagsMutuallyExclusive("output", "in-place")
+
+	// Add verbose flag to verify command for detailed output
+	flaVerifyCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
 }
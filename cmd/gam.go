@@ -5,6 +5,9 @@ package cmd
 
 import (
 	"fmt"
+	"io"
+	"os"
+	"path/filepath"
 
 	"github.com/hansbonini/tombatools/pkg"
 	"github.com/hansbonini/tombatools/pkg/common"
@@ -20,12 +23,20 @@ var gamCmd = &cobra.Command{
 	Long: `Process GAM files used in Tomba! PSX game.
 
 Commands:
-  unpack    Extract data from GAM files
-  pack      Create GAM files from extracted data
+  unpack      Extract data from GAM files
+  pack        Create GAM files from extracted data
+  unpack-all  Extract every GAM file of a dumped directory and write a manifest
+  pack-all    Pack every file listed in an unpack-all manifest
+  tables      Extract and inject fixed-length string tables (item/event names)
+  trace       Print the compressed token stream of a GAM file
 
 Examples:
   tombatools gam unpack input.GAM output.UNGAM
-  tombatools gam pack input.UNGAM output.GAM`,
+  tombatools gam pack input.UNGAM output.GAM
+  tombatools gam unpack-all ./dump/ ./gam/
+  tombatools gam pack-all -o ./patched/ ./gam/gam-manifest.yaml
+  tombatools gam trace input.GAM
+  tombatools gam tables extract --profile tables.yaml ITEM.GAM items.yaml`,
 }
 
 // gamUnpackCmd extracts data from GAM files.
@@ -56,16 +67,17 @@ Example:
 
 		// Create GAM processor for handling unpack operations
 		processor := pkg.NewGAMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
 
-		fmt.Printf("Processing GAM file: %s\n", inputFile)
-		fmt.Printf("Output file: %s\n", outputFile)
+		common.Printf("Processing GAM file: %s\n", inputFile)
+		common.Printf("Output file: %s\n", outputFile)
 
 		// Unpack the GAM file
 		if err := processor.UnpackGAM(inputFile, outputFile); err != nil {
 			return fmt.Errorf("failed to unpack GAM file: %w", err)
 		}
 
-		fmt.Println("GAM file unpacked successfully!")
+		common.Println("GAM file unpacked successfully!")
 		return nil
 	},
 }
@@ -79,13 +91,46 @@ var gamPackCmd = &cobra.Command{
 	Long: `Create GAM files from extracted data.
 
 Requirements:
-  - Uncompressed data file (from unpack command)
+  - Uncompressed data file (from unpack command), or a .zip archive holding
+    exactly that file
 
 Output:
   - Complete GAM file ready for use in Tomba! PSX game
 
+Flags:
+  --fit           Original GAM file whose disc slot (its size rounded up to whole
+                  sectors) the output must fit in
+  --target-size   Largest allowed output size in bytes, header included
+  --keep-padding  Never trim the trailing zero padding of the data to fit
+  --preset        Compression preset: fast, default or max (default "default")
+  --reuse-tokens  Original GAM file whose compressed tokens the output reuses
+
+Presets trade speed for size: fast searches only the nearest distances, default
+takes the longest match of the whole window, and max finds the cheapest parse.
+Payloads are compressed in fixed 64 KiB blocks on all CPUs; the output does not
+depend on the number of CPUs.
+
+With --reuse-tokens, the output copies the tokens of the original file's stream
+wherever they still produce the same bytes. The bytes no original token covers
+are compressed with a greedy parse whose length limits and distance order are
+fitted to the original tokens; it is not the game's own compressor. Unpacking a
+GAM file and packing it back with --reuse-tokens rebuilds it byte for byte;
+around edited data the stream is this greedy parse.
+
+When the output overflows the target, it is reported right after compression and
+recompressed with an optimal parse; if it still does not fit, the trailing zero
+padding is left to the zero-filled decompression buffer. If nothing fits, nothing
+is written and the chunks that grew the most (or compress worst) are listed.
+
+With an artifact store (see store init), packing unchanged data with the same
+flags restores the output from the store.
+
 Example:
-  tombatools gam pack data.UNGAM GAME_modified.GAM`,
+  tombatools gam pack data.UNGAM GAME_modified.GAM
+  tombatools gam pack data.zip GAME_modified.GAM
+  tombatools gam pack --preset max data.UNGAM GAME_modified.GAM
+  tombatools gam pack --fit GAME.GAM data.UNGAM GAME_modified.GAM
+  tombatools gam pack --reuse-tokens GAME.GAM data.UNGAM GAME_modified.GAM`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		inputFile := args[0]
@@ -100,16 +145,485 @@ Example:
 
 		// Create GAM processor for handling pack operations
 		processor := pkg.NewGAMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		common.Printf("Input file: %s\n", inputFile)
+		common.Printf("Output GAM file: %s\n", outputFile)
+
+		preset, err := cmd.Flags().GetString("preset")
+		if err != nil {
+			return fmt.Errorf("error getting preset flag: %w", err)
+		}
+		if err := processor.SetPreset(preset); err != nil {
+			return err
+		}
+
+		reuseFile, err := cmd.Flags().GetString("reuse-tokens")
+		if err != nil {
+			return fmt.Errorf("error getting reuse-tokens flag: %w", err)
+		}
+		if reuseFile != "" {
+			if cmd.Flags().Changed("preset") {
+				return fmt.Errorf("--preset and --reuse-tokens cannot be used together")
+			}
+			if err := processor.SetReuseTokens(reuseFile); err != nil {
+				return err
+			}
+		}
+
+		if err := setGAMFitTarget(cmd, processor); err != nil {
+			return err
+		}
+
+		inputs := []string{inputFile}
+		fitFile, err := cmd.Flags().GetString("fit")
+		if err != nil {
+			return fmt.Errorf("error getting fit flag: %w", err)
+		}
+		if fitFile != "" {
+			inputs = append(inputs, fitFile)
+		}
+		if reuseFile != "" {
+			inputs = append(inputs, reuseFile)
+		}
+
+		return runStoredBuild(cmd, inputs, []string{outputFile}, func() error {
+			// Extract the data file when it comes inside a zip archive
+			inputFile, cleanup, err := pkg.OpenArchiveInput(inputFile, "")
+			if err != nil {
+				return fmt.Errorf("failed to open input archive: %w", err)
+			}
+			defer cleanup()
+
+			// Pack the file into GAM format
+			err = processor.PackGAM(cmd.Context(), inputFile, outputFile)
+			if report := processor.ReuseReport(); report != nil {
+				common.Printf("Original tokens reused: %d of %d\n", report.Reused, report.Tokens)
+				common.Printf("Fill-in parse: %s\n", report.Heuristic)
+			}
+			if report := processor.FitReport(); report != nil {
+				printGAMFitReport(report)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to pack GAM file: %w", err)
+			}
+
+			common.Println("GAM file packed successfully!")
+			return nil
+		})
+	},
+}
 
-		fmt.Printf("Input file: %s\n", inputFile)
-		fmt.Printf("Output GAM file: %s\n", outputFile)
+// setGAMFitTarget applies the --fit, --target-size and --keep-padding flags of the pack command
+func setGAMFitTarget(cmd *cobra.Command, processor *pkg.GAMProcessor) error {
+	fitFile, err := cmd.Flags().GetString("fit")
+	if err != nil {
+		return fmt.Errorf("error getting fit flag: %w", err)
+	}
 
-		// Pack the file into GAM format
-		if err := processor.PackGAM(inputFile, outputFile); err != nil {
-			return fmt.Errorf("failed to pack GAM file: %w", err)
+	targetSize, err := cmd.Flags().GetInt64("target-size")
+	if err != nil {
+		return fmt.Errorf("error getting target-size flag: %w", err)
+	}
+
+	keepPadding, err := cmd.Flags().GetBool("keep-padding")
+	if err != nil {
+		return fmt.Errorf("error getting keep-padding flag: %w", err)
+	}
+
+	if fitFile != "" && targetSize != 0 {
+		return fmt.Errorf("--fit and --target-size cannot be used together")
+	}
+	if targetSize < 0 {
+		return fmt.Errorf("invalid target size: %d", targetSize)
+	}
+
+	processor.SetKeepPadding(keepPadding)
+	processor.SetTargetSize(targetSize)
+	if fitFile != "" {
+		if err := processor.SetFitOriginal(fitFile); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// printGAMFitReport prints the compression attempts of the fitting stage and, when the
+// file does not fit, the chunks to shrink
+func printGAMFitReport(report *pkg.GAMFitReport) {
+	common.Printf("Target size: %d bytes\n", report.TargetSize)
+	for _, attempt := range report.Attempts {
+		status := "fits"
+		if attempt.Size > report.TargetSize {
+			status = fmt.Sprintf("%d bytes over", attempt.Size-report.TargetSize)
+		}
+		common.Printf("- %-13s %d bytes (%s)\n", attempt.Method, attempt.Size, status)
+	}
+	if report.TrimmedBytes > 0 {
+		common.Printf("Trimmed %d trailing zero bytes of padding\n", report.TrimmedBytes)
+	}
+	if report.Fits() {
+		return
+	}
+
+	common.Printf("Does not fit: %d bytes over. Shrink these chunks first:\n", report.Overflow())
+	for _, chunk := range report.Chunks {
+		if chunk.Growth > 0 {
+			common.Printf("- 0x%06X-0x%06X: %d compressed bytes (%+d against the original)\n",
+				chunk.Offset, chunk.Offset+chunk.Size, chunk.CompressedSize, chunk.Growth)
+		} else {
+			common.Printf("- 0x%06X-0x%06X: %d compressed bytes\n", chunk.Offset, chunk.Offset+chunk.Size, chunk.CompressedSize)
+		}
+	}
+}
+
+// gamUnpackAllCmd extracts every GAM file of a dumped CD directory.
+// The manifest it writes is the input of pack-all.
+var gamUnpackAllCmd = &cobra.Command{
+	Use:   "unpack-all [input_dir] [output_dir]",
+	Short: "Extract every GAM file of a dumped directory and write a manifest",
+	Long: `Extract every GAM file below a directory, such as the output of cd dump.
+
+GAM files are detected by their magic, whatever their name. Each one is unpacked
+into the output directory at the same relative path with .UNGAM appended, and
+gam-manifest.yaml records the path, original size and uncompressed size of every
+file for pack-all.
+
+Examples:
+  tombatools gam unpack-all ./dump/ ./gam/`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputDir := args[0]
+		outputDir := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
 		}
+		common.SetVerboseMode(verbose)
+
+		processor := pkg.NewGAMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		common.Printf("Input directory: %s\n", inputDir)
+		common.Printf("Output directory: %s\n", outputDir)
 
-		fmt.Println("GAM file packed successfully!")
+		manifest, err := processor.UnpackAll(cmd.Context(), inputDir, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to unpack GAM files: %w", err)
+		}
+
+		for _, entry := range manifest.Files {
+			common.Printf("- %s: %d -> %d bytes\n", entry.Path, entry.OriginalSize, entry.UncompressedSize)
+		}
+		common.Printf("Manifest written to: %s\n", filepath.Join(outputDir, pkg.GAMManifestFile))
+		common.Printf("%d GAM files unpacked successfully!\n", len(manifest.Files))
+		return nil
+	},
+}
+
+// gamPackAllCmd packs every file of an unpack-all manifest.
+// Each file is fitted into the disc slot of its original unless --no-fit is given.
+var gamPackAllCmd = &cobra.Command{
+	Use:   "pack-all [manifest]",
+	Short: "Pack every file listed in an unpack-all manifest",
+	Long: `Pack the .UNGAM files listed in a manifest written by unpack-all back into GAM
+files, at the relative path of their originals.
+
+Every file must fit the disc slot of its original (its size rounded up to whole
+sectors, as with pack --fit); a file that does not fit, or fails otherwise, is
+reported and the others are still packed.
+
+Flags:
+  -o, --output          Output directory (default: packed/ next to the manifest)
+  --no-fit              Do not limit the files to the slots of their originals
+  --keep-padding        Never trim the trailing zero padding of the data to fit
+  --preset              Compression preset: fast, default or max (default "default")
+  --reuse-tokens        Reuse the compressed tokens of every original file
+                        (see pack --reuse-tokens); the originals are read from
+                        the source directory of the manifest
+
+Examples:
+  tombatools gam pack-all ./gam/gam-manifest.yaml
+  tombatools gam pack-all --reuse-tokens -o ./patched/ ./gam/gam-manifest.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		manifestFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		outputDir, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+		if outputDir == "" {
+			outputDir = filepath.Join(filepath.Dir(manifestFile), "packed")
+		}
+
+		noFit, err := cmd.Flags().GetBool("no-fit")
+		if err != nil {
+			return fmt.Errorf("error getting no-fit flag: %w", err)
+		}
+
+		keepPadding, err := cmd.Flags().GetBool("keep-padding")
+		if err != nil {
+			return fmt.Errorf("error getting keep-padding flag: %w", err)
+		}
+
+		preset, err := cmd.Flags().GetString("preset")
+		if err != nil {
+			return fmt.Errorf("error getting preset flag: %w", err)
+		}
+
+		reuseTokens, err := cmd.Flags().GetBool("reuse-tokens")
+		if err != nil {
+			return fmt.Errorf("error getting reuse-tokens flag: %w", err)
+		}
+		if reuseTokens && cmd.Flags().Changed("preset") {
+			return fmt.Errorf("--preset and --reuse-tokens cannot be used together")
+		}
+
+		processor := pkg.NewGAMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		processor.SetKeepPadding(keepPadding)
+		if err := processor.SetPreset(preset); err != nil {
+			return err
+		}
+
+		common.Printf("Manifest: %s\n", manifestFile)
+		common.Printf("Output directory: %s\n", outputDir)
+
+		report, err := processor.PackAll(cmd.Context(), manifestFile, outputDir, pkg.GAMBatchOptions{Fit: !noFit, ReuseTokens: reuseTokens})
+		if err != nil {
+			return fmt.Errorf("failed to pack GAM files: %w", err)
+		}
+
+		for _, file := range report.Files {
+			switch {
+			case file.Error != "":
+				common.Printf("- %s: FAILED: %s\n", file.Path, file.Error)
+			case file.TargetSize > 0:
+				common.Printf("- %s: %d bytes (%d free in its %d byte slot)\n", file.Path, file.Size, file.TargetSize-file.Size, file.TargetSize)
+			default:
+				common.Printf("- %s: %d bytes\n", file.Path, file.Size)
+			}
+		}
+
+		if !report.OK() {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d of %d GAM files failed to pack", report.Failed, len(report.Files)))
+		}
+
+		common.Printf("%d GAM files packed successfully!\n", report.Packed)
+		return nil
+	},
+}
+
+// gamTraceCmd prints the compressed token stream of a GAM file.
+// It is a reverse engineering aid for checking compressor parity and
+// locating the point where a corrupted archive goes wrong.
+var gamTraceCmd = &cobra.Command{
+	Use:   "trace [input_file]",
+	Short: "Print the compressed token stream of a GAM file",
+	Long: `Print the LZ token stream of a GAM file without decompressing it.
+
+Every token is listed with its file offset and the decompressed offset it writes to:
+  bitmask     16-bit flag word selecting literals (0) and references (1)
+  literal     Run of bytes copied from the stream
+  reference   Distance/length pair copying earlier output (overlap marks RLE-style copies)
+
+Tracing stops at the first invalid reference and reports it, so corrupted archives
+can be inspected up to the point of failure. Text traces of an original file and a
+repacked one can be compared with diff to check compressor parity.
+
+Flags:
+  -f, --format    Output format: text, json or html (default: text)
+  -o, --output    Write the trace to a file instead of stdout
+
+Examples:
+  tombatools gam trace GAME.GAM
+  tombatools gam trace -f html -o trace.html GAME.GAM`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		// Create GAM processor for handling the trace
+		processor := pkg.NewGAMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		trace, err := processor.TraceFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to trace GAM file: %w", err)
+		}
+
+		// Write trace to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create trace file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteGAMTrace(trace, format, writer); err != nil {
+			return fmt.Errorf("failed to write GAM trace: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("GAM trace written to: %s\n", outputFile)
+		}
+
+		return nil
+	},
+}
+
+// gamTablesCmd groups the string table operations on GAM payloads.
+var gamTablesCmd = &cobra.Command{
+	Use:   "tables",
+	Short: "Extract and inject fixed-length string tables in GAM files",
+	Long: `Extract and inject fixed-length string tables (item and event names) stored
+inside GAM payloads, using a YAML profile that describes each table.
+
+Profile format:
+  files:
+    ITEM.GAM:
+      tables:
+        - name: items
+          offset: 0x1A00    # Offset in the decompressed payload
+          stride: 16        # Distance between entries
+          count: 32         # Number of entries
+          length: 15        # Maximum string bytes (default: stride)
+          charset: ascii    # ascii, windows-1252 or shift-jis
+          terminator: 0x00  # Byte ending shorter strings
+          pad_byte: 0x00    # Byte filling unused space (default: terminator)
+
+Commands:
+  extract   Write the configured tables of a GAM file to a YAML file
+  inject    Write translated strings back into a GAM file
+
+Examples:
+  tombatools gam tables extract --profile tables.yaml ITEM.GAM items.yaml
+  tombatools gam tables inject --profile tables.yaml ITEM.GAM items.yaml ITEM_new.GAM`,
+}
+
+// gamTablesExtractCmd extracts string tables from a GAM file to YAML.
+var gamTablesExtractCmd = &cobra.Command{
+	Use:   "extract [input_file] [output.yaml]",
+	Short: "Extract string tables from a GAM file",
+	Long: `Extract the string tables configured for a GAM file to a YAML file.
+
+The GAM file is matched against the profile by file name.
+
+Example:
+  tombatools gam tables extract --profile tables.yaml ITEM.GAM items.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profileFile, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return fmt.Errorf("error getting profile flag: %w", err)
+		}
+
+		profile, err := pkg.LoadStringTableProfile(profileFile)
+		if err != nil {
+			return fmt.Errorf("failed to load table profile: %w", err)
+		}
+
+		// Create string table processor for handling extract operations
+		processor := pkg.NewStringTableProcessor()
+
+		common.Printf("Processing GAM file: %s\n", inputFile)
+		common.Printf("Output file: %s\n", outputFile)
+
+		if err := processor.Extract(inputFile, profile, outputFile); err != nil {
+			return fmt.Errorf("failed to extract string tables: %w", err)
+		}
+
+		common.Println("String tables extracted successfully!")
+		return nil
+	},
+}
+
+// gamTablesInjectCmd writes translated string tables back into a GAM file.
+var gamTablesInjectCmd = &cobra.Command{
+	Use:   "inject [input_file] [strings.yaml] [output_file]",
+	Short: "Inject translated string tables into a GAM file",
+	Long: `Inject translated string tables from a YAML file into a GAM file.
+
+Each string must fit the table length once encoded; shorter strings are
+terminated and padded. The payload is recompressed into a new GAM file.
+
+Example:
+  tombatools gam tables inject --profile tables.yaml ITEM.GAM items.yaml ITEM_new.GAM`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		stringsFile := args[1]
+		outputFile := args[2]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profileFile, err := cmd.Flags().GetString("profile")
+		if err != nil {
+			return fmt.Errorf("error getting profile flag: %w", err)
+		}
+
+		profile, err := pkg.LoadStringTableProfile(profileFile)
+		if err != nil {
+			return fmt.Errorf("failed to load table profile: %w", err)
+		}
+
+		// Create string table processor for handling inject operations
+		processor := pkg.NewStringTableProcessor()
+
+		common.Printf("Input GAM file: %s\n", inputFile)
+		common.Printf("Strings file: %s\n", stringsFile)
+		common.Printf("Output GAM file: %s\n", outputFile)
+
+		if err := processor.Inject(cmd.Context(), inputFile, profile, stringsFile, outputFile); err != nil {
+			return fmt.Errorf("failed to inject string tables: %w", err)
+		}
+
+		common.Println("String tables injected successfully!")
 		return nil
 	},
 }
@@ -128,4 +642,42 @@ func init() {
 
 	// Add verbose flag to pack command for detailed output
 	gamPackCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+
+	// Add target-size fitting flags to pack command
+	gamPackCmd.Flags().String("fit", "", "Original GAM file whose disc slot the output must fit in")
+	gamPackCmd.Flags().Int64("target-size", 0, "Largest allowed output size in bytes, header included (0 disables)")
+	gamPackCmd.Flags().Bool("keep-padding", false, "Never trim trailing zero padding of the data to fit the target")
+
+	// Add compression preset flag to pack command
+	gamPackCmd.Flags().String("preset", pkg.GAMPresetDefault, "Compression preset: fast, default or max")
+	gamPackCmd.Flags().String("reuse-tokens", "", "Original GAM file whose compressed tokens the output reuses")
+
+	// Add batch subcommands and their flags
+	gamCmd.AddCommand(gamUnpackAllCmd)
+	gamCmd.AddCommand(gamPackAllCmd)
+	gamUnpackAllCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	gamPackAllCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	gamPackAllCmd.Flags().StringP("output", "o", "", "Output directory (default: packed/ next to the manifest)")
+	gamPackAllCmd.Flags().Bool("no-fit", false, "Do not limit the files to the disc slots of their originals")
+	gamPackAllCmd.Flags().Bool("keep-padding", false, "Never trim trailing zero padding of the data to fit the slot")
+	gamPackAllCmd.Flags().String("preset", pkg.GAMPresetDefault, "Compression preset: fast, default or max")
+	gamPackAllCmd.Flags().Bool("reuse-tokens", false, "Reuse the compressed tokens of every original file")
+
+	// Add trace subcommand and its flags
+	gamCmd.AddCommand(gamTraceCmd)
+	gamTraceCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	gamTraceCmd.Flags().StringP("format", "f", pkg.TraceFormatText, "Output format: text, json or html")
+	gamTraceCmd.Flags().StringP("output", "o", "", "Write the trace to a file instead of stdout")
+
+	// Add string table subcommands
+	gamCmd.AddCommand(gamTablesCmd)
+	gamTablesCmd.AddCommand(gamTablesExtractCmd)
+	gamTablesCmd.AddCommand(gamTablesInjectCmd)
+
+	// Add flags to string table commands
+	for _, tablesCmd := range []*cobra.Command{gamTablesExtractCmd, gamTablesInjectCmd} {
+		tablesCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+		tablesCmd.Flags().StringP("profile", "p", "", "YAML profile describing the string tables")
+		_ = tablesCmd.MarkFlagRequired("profile")
+	}
 }
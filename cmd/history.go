@@ -0,0 +1,314 @@
+// Package cmd provides command-line interface for the project history.
+// This file contains the history commands, which enable and list the record of every
+// tombatools invocation of a project, the replay command re-running recorded
+// invocations, and the hooks recording each invocation.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// historyCmd represents the parent command for the project history operations
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Record every tombatools invocation of a project",
+	Long: `Manage the history of a project: a record of every tombatools invocation.
+
+Once 'history init' has created .tombatools/history.jsonl in the working
+directory, every command run from that directory appends a JSON line with its
+arguments, exit code, the tool version, the SHA-256 of the existing files and
+directories its arguments name (hashed before it runs) and of the files it wrote.
+'tombatools replay' runs the recorded commands again, so the history documents
+exactly how a released patch was produced. The history, replay and run commands
+are not recorded themselves; the steps of a task and the commands a replay runs
+are.
+
+Hashing the inputs reads them in full, so large disc images add a moment to
+every recorded command. Delete the history file to stop recording.
+
+Commands:
+  init   Start recording the invocations of the working directory
+  list   List the recorded invocations
+
+Examples:
+  tombatools history init
+  tombatools history list
+  tombatools replay --input original.bin=fresh.bin`,
+}
+
+// historyInitCmd enables the history of the working directory
+var historyInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Start recording the invocations of the working directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		path, err := pkg.InitHistory(".")
+		if err != nil {
+			return err
+		}
+		common.Printf("Recording invocations in %s\n", path)
+		return nil
+	},
+}
+
+// historyListCmd lists the recorded invocations
+var historyListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the recorded invocations",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := pkg.LoadHistory(pkg.HistoryPath("."))
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			common.Println("No invocations recorded.")
+			return nil
+		}
+		for i := range entries {
+			common.Printf("%s\n", pkg.FormatHistorySummary(&entries[i]))
+		}
+		return nil
+	},
+}
+
+// replayCmd re-runs recorded invocations
+var replayCmd = &cobra.Command{
+	Use:   "replay",
+	Short: "Re-run the invocations recorded in the project history",
+	Long: `Re-run the successful invocations recorded in .tombatools/history.jsonl, in
+order, from the working directory.
+
+--input OLD=NEW replays against fresh inputs: every argument naming OLD (also as
+the value of FLAG=OLD or DISC_PATH=OLD) names NEW instead. Recorded inputs that
+were not replaced and changed since they were recorded are reported. After each
+command, its outputs are compared with the recorded hashes; with unchanged
+inputs, every output should be reproduced.
+
+Every command is checked before the first one runs. Replay stops at the first
+failing command and exits with its exit code. Global flags (--quiet, --jobs, ...)
+given to replay are passed on to every command.
+
+Flags:
+      --from N             First entry to replay (default: the first)
+      --to N               Last entry to replay (default: the last)
+  -i, --input OLD=NEW      Replace an input path (repeatable)
+      --dry-run            Check and print the commands without running them
+      --verify             Exit with code 4 when an output differs from the record
+  -v, --verbose            Enable verbose output
+
+Examples:
+  tombatools replay --dry-run
+  tombatools replay --verify
+  tombatools replay --from 3 --input "Tomba (USA).bin=Tomba (USA) (Rev 1).bin"`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		from, err := cmd.Flags().GetInt("from")
+		if err != nil {
+			return fmt.Errorf("error getting from flag: %w", err)
+		}
+		to, err := cmd.Flags().GetInt("to")
+		if err != nil {
+			return fmt.Errorf("error getting to flag: %w", err)
+		}
+		inputSpecs, err := cmd.Flags().GetStringArray("input")
+		if err != nil {
+			return fmt.Errorf("error getting input flag: %w", err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("error getting dry-run flag: %w", err)
+		}
+		verify, err := cmd.Flags().GetBool("verify")
+		if err != nil {
+			return fmt.Errorf("error getting verify flag: %w", err)
+		}
+
+		replacements, err := pkg.ParseHistoryReplacements(inputSpecs)
+		if err != nil {
+			return err
+		}
+		entries, err := pkg.LoadHistory(pkg.HistoryPath("."))
+		if err != nil {
+			return err
+		}
+
+		// Pick the successful entries of the range and check them before running any
+		var selected []pkg.HistoryEntry
+		for _, entry := range entries {
+			if entry.ID < from || (to > 0 && entry.ID > to) {
+				continue
+			}
+			if entry.ExitCode != 0 {
+				common.LogDebug("Entry #%d skipped: it failed with exit code %d", entry.ID, entry.ExitCode)
+				continue
+			}
+			entry.Args = pkg.ReplaceHistoryArgs(entry.Args, replacements)
+			if err := validateProjectStep(entry.Args); err != nil {
+				return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("entry #%d (%s): %w", entry.ID, strings.Join(entry.Args, " "), err))
+			}
+			selected = append(selected, entry)
+		}
+		if len(selected) == 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no successful invocations recorded in the selected range"))
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the tombatools executable: %w", err)
+		}
+		globalArgs := projectGlobalArgs(cmd)
+
+		reproduced, differing := 0, 0
+		for i, entry := range selected {
+			if err := common.Canceled(cmd.Context()); err != nil {
+				return err
+			}
+			line := strings.Join(entry.Args, " ")
+			if dryRun {
+				common.Printf("[%d/%d] #%d %s (not run: dry run)\n", i+1, len(selected), entry.ID, line)
+				continue
+			}
+			common.Printf("[%d/%d] #%d %s\n", i+1, len(selected), entry.ID, line)
+
+			changed, err := pkg.ChangedHistoryInputs(entry, replacements)
+			if err != nil {
+				return err
+			}
+			if len(changed) > 0 {
+				common.LogWarn("Entry #%d: inputs changed since it was recorded: %s", entry.ID, strings.Join(changed, ", "))
+			}
+
+			if err := runProjectStep(cmd.Context(), exe, ".", append(append([]string{}, globalArgs...), entry.Args...)); err != nil {
+				return fmt.Errorf("entry #%d (%s) failed: %w", entry.ID, line, err)
+			}
+
+			check, err := pkg.CheckHistoryOutputs(entry, replacements)
+			if err != nil {
+				return err
+			}
+			reproduced += len(check.Matching)
+			differing += len(check.Differing)
+			for _, path := range check.Differing {
+				common.LogInfo("Entry #%d: %s differs from the recorded output", entry.ID, path)
+			}
+		}
+
+		if dryRun {
+			common.Printf("Dry run: %d commands checked\n", len(selected))
+			return nil
+		}
+		common.Printf("Replayed %d commands: %d outputs reproduced, %d differ\n", len(selected), reproduced, differing)
+		if verify && differing > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%d outputs differ from the recorded history", differing))
+		}
+		return nil
+	},
+}
+
+// historyInvocation holds the invocation being recorded (nil when the history is off)
+var historyInvocation *pkg.HistoryEntry
+
+// historyExcluded lists the top-level commands that are not recorded: the history
+// commands themselves, task runs (their steps are recorded) and help output
+var historyExcluded = map[string]bool{
+	"history": true, "replay": true, "run": true,
+	"help": true, "completion": true, cobra.ShellCompRequestCmd: true, cobra.ShellCompNoDescRequestCmd: true,
+}
+
+// startHistory hashes the inputs of the invocation when the working directory records
+// its history, and enables the recording of the files it writes
+func startHistory(cmd *cobra.Command) error {
+	historyInvocation = nil
+	top := cmd
+	for top.HasParent() && top.Parent().HasParent() {
+		top = top.Parent()
+	}
+	if !top.HasParent() || historyExcluded[top.Name()] || !pkg.HistoryEnabled(".") {
+		return nil
+	}
+
+	// The command names are not inputs, even where a directory has the same name
+	args := os.Args[1:]
+	names := strings.Fields(cmd.CommandPath())[1:]
+	var operands []string
+	for _, arg := range args {
+		if len(names) > 0 && arg == names[0] {
+			names = names[1:]
+			continue
+		}
+		operands = append(operands, arg)
+	}
+	inputs, err := pkg.HashHistoryInputs(operands)
+	if err != nil {
+		return fmt.Errorf("failed to hash the inputs for the history: %w", err)
+	}
+	historyInvocation = &pkg.HistoryEntry{
+		Time:    time.Now().UTC(),
+		Version: toolVersion,
+		Command: cmd.CommandPath(),
+		Args:    args,
+		Inputs:  inputs,
+	}
+	common.SetOutputHashes(true)
+	return nil
+}
+
+// recordHistory appends the finished invocation to the history with its exit code and
+// the files it wrote. Files of the project store are left out.
+func recordHistory(err error) {
+	entry := historyInvocation
+	if entry == nil {
+		return
+	}
+	entry.ExitCode = common.ExitCodeFor(err)
+
+	entry.Outputs = []pkg.ArtifactFile{}
+	summary, summaryErr := common.OutputSummary()
+	if summaryErr != nil {
+		common.LogWarn("Outputs left out of the history: %v", summaryErr)
+	}
+	for _, file := range summary {
+		path := filepath.ToSlash(file.Path)
+		if file.Role != common.SummaryRoleOutput || path == pkg.DefaultStoreDir || strings.HasPrefix(path, pkg.DefaultStoreDir+"/") {
+			continue
+		}
+		entry.Outputs = append(entry.Outputs, pkg.ArtifactFile{Path: path, Hash: file.SHA256, Size: file.Size})
+	}
+
+	if err := pkg.AppendHistory(pkg.HistoryPath("."), entry); err != nil {
+		common.LogWarn("Invocation not recorded in the history: %v", err)
+	}
+}
+
+// init registers the history and replay commands
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyInitCmd)
+	historyCmd.AddCommand(historyListCmd)
+
+	rootCmd.AddCommand(replayCmd)
+
+	// Add flags to replay command
+	replayCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	replayCmd.Flags().Int("from", 0, "First history entry to replay")
+	replayCmd.Flags().Int("to", 0, "Last history entry to replay (0 replays to the end)")
+	replayCmd.Flags().StringArrayP("input", "i", nil, "Replace an input path: OLD=NEW (repeatable)")
+	replayCmd.Flags().Bool("dry-run", false, "Check and print the commands without running them")
+	replayCmd.Flags().Bool("verify", false, "Exit with code 4 when an output differs from the recorded one")
+}
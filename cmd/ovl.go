@@ -0,0 +1,231 @@
+// Package cmd provides command-line interface for stage overlay processing.
+// This file contains commands for dumping, rebuilding and checking the event
+// tables of .OVL overlays, which trigger WFM dialogues by their slot.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// ovlCmd groups the event table operations on stage overlays.
+var ovlCmd = &cobra.Command{
+	Use:   "ovl",
+	Short: "Dump and rebuild the event tables of stage overlays",
+	Long: `Dump, rebuild and check the event tables of stage overlays (.OVL), using a
+YAML profile that describes each table. Every event record triggers a WFM dialogue
+by its slot, so the dumped mapping shows which NPC or scene uses which dialogue.
+
+Profile format:
+  files:
+    STAGE01.OVL:
+      wfm: CFNT01.WFM           # WFM file holding the dialogues (informational)
+      tables:
+        - name: npc_talk
+          offset: 0x2C40        # File offset of the first record
+          # pattern: "45 56 ?? ??"  # ...or the single match of a byte pattern
+          # start_at: 4             # First record relative to the match
+          stride: 8             # Distance between records
+          count: 12             # Number of records
+          event: {at: 0, type: u16}
+          flag: {at: 2, type: u16}
+          dialogue: {at: 4, type: u16}
+          labels:
+            0: Village elder
+            1: Shop keeper
+
+Commands:
+  dump      Write the event to dialogue mapping of an overlay to a YAML file
+  rebuild   Write edited event records back into an overlay
+  check     Validate the dialogue slots of an overlay against a dialogues.yaml
+
+Examples:
+  tombatools ovl dump --profile events.yaml --dialogues dialogues.yaml STAGE01.OVL events01.yaml
+  tombatools ovl rebuild --profile events.yaml STAGE01.OVL events01.yaml STAGE01_new.OVL
+  tombatools ovl check --profile events.yaml STAGE01_new.OVL dialogues.yaml`,
+}
+
+// ovlDumpCmd dumps the event tables of an overlay to YAML.
+var ovlDumpCmd = &cobra.Command{
+	Use:   "dump [input_file] [output.yaml]",
+	Short: "Dump the event tables of an overlay",
+	Long: `Dump the event tables configured for an overlay to a YAML file.
+
+The overlay is matched against the profile by file name. With --dialogues, every
+event is annotated with the start of the text of the dialogue it triggers.
+
+Flags:
+  -p, --profile     YAML profile describing the event tables (required)
+      --dialogues   dialogues.yaml used to annotate events with their text
+
+Example:
+  tombatools ovl dump --profile events.yaml --dialogues dialogues.yaml STAGE01.OVL events01.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profile, err := loadOverlayEventProfile(cmd)
+		if err != nil {
+			return err
+		}
+
+		dialoguesFile, err := cmd.Flags().GetString("dialogues")
+		if err != nil {
+			return fmt.Errorf("error getting dialogues flag: %w", err)
+		}
+
+		// Create overlay event processor for handling dump operations
+		processor := pkg.NewOverlayEventProcessor()
+
+		common.Printf("Processing overlay file: %s\n", inputFile)
+		common.Printf("Output file: %s\n", outputFile)
+
+		if err := processor.Dump(inputFile, profile, dialoguesFile, outputFile); err != nil {
+			return fmt.Errorf("failed to dump event tables: %w", err)
+		}
+
+		common.Println("Event tables dumped successfully!")
+		return nil
+	},
+}
+
+// ovlRebuildCmd writes edited event tables back into an overlay.
+var ovlRebuildCmd = &cobra.Command{
+	Use:   "rebuild [input_file] [events.yaml] [output_file]",
+	Short: "Rebuild the event tables of an overlay",
+	Long: `Write the event IDs, flags and dialogue slots of a YAML file into a copy of
+an overlay. Offsets, labels and text in the YAML are informational and ignored.
+
+Flags:
+  -p, --profile   YAML profile describing the event tables (required)
+
+Example:
+  tombatools ovl rebuild --profile events.yaml STAGE01.OVL events01.yaml STAGE01_new.OVL`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		eventsFile := args[1]
+		outputFile := args[2]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profile, err := loadOverlayEventProfile(cmd)
+		if err != nil {
+			return err
+		}
+
+		// Create overlay event processor for handling rebuild operations
+		processor := pkg.NewOverlayEventProcessor()
+
+		common.Printf("Input overlay file: %s\n", inputFile)
+		common.Printf("Events file: %s\n", eventsFile)
+		common.Printf("Output overlay file: %s\n", outputFile)
+
+		if err := processor.Rebuild(inputFile, profile, eventsFile, outputFile); err != nil {
+			return fmt.Errorf("failed to rebuild event tables: %w", err)
+		}
+
+		common.Println("Event tables rebuilt successfully!")
+		return nil
+	},
+}
+
+// ovlCheckCmd validates the dialogue slots triggered by an overlay.
+var ovlCheckCmd = &cobra.Command{
+	Use:   "check [input_file] [dialogues.yaml]",
+	Short: "Check the dialogue slots triggered by an overlay",
+	Long: `Compare the dialogue slots referenced by the event tables of an overlay with
+the dialogues of a dialogues.yaml file. A slot is stale when it no longer exists
+or now holds a dialogue with a different ID. Exits with status 4 when any
+problem is found.
+
+Flags:
+  -p, --profile   YAML profile describing the event tables (required)
+
+Example:
+  tombatools ovl check --profile events.yaml STAGE01.OVL dialogues.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		dialoguesFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		profile, err := loadOverlayEventProfile(cmd)
+		if err != nil {
+			return err
+		}
+
+		processor := pkg.NewOverlayEventProcessor()
+		warnings, err := processor.Check(inputFile, profile, dialoguesFile)
+		if err != nil {
+			return fmt.Errorf("failed to check event tables: %w", err)
+		}
+
+		if len(warnings) == 0 {
+			common.Println("All event dialogue slots match the dialogues.")
+			return nil
+		}
+		for _, warning := range warnings {
+			common.Printf("  %s\n", warning)
+		}
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%d stale dialogue slots in %s", len(warnings), inputFile))
+	},
+}
+
+// loadOverlayEventProfile loads the event profile named by the profile flag
+func loadOverlayEventProfile(cmd *cobra.Command) (*pkg.OverlayEventProfile, error) {
+	profileFile, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return nil, fmt.Errorf("error getting profile flag: %w", err)
+	}
+
+	profile, err := pkg.LoadOverlayEventProfile(profileFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load event profile: %w", err)
+	}
+	return profile, nil
+}
+
+// init initializes the ovl command and its subcommands with appropriate flags.
+func init() {
+	// Register the ovl command with the root command
+	rootCmd.AddCommand(ovlCmd)
+
+	// Add subcommands to the ovl command
+	ovlCmd.AddCommand(ovlDumpCmd)
+	ovlCmd.AddCommand(ovlRebuildCmd)
+	ovlCmd.AddCommand(ovlCheckCmd)
+
+	// Add flags shared by every event table command
+	for _, eventsCmd := range []*cobra.Command{ovlDumpCmd, ovlRebuildCmd, ovlCheckCmd} {
+		eventsCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+		eventsCmd.Flags().StringP("profile", "p", "", "YAML profile describing the event tables")
+		_ = eventsCmd.MarkFlagRequired("profile")
+	}
+
+	// Add dialogue annotation flag to dump command
+	ovlDumpCmd.Flags().String("dialogues", "", "dialogues.yaml used to annotate events with their text")
+}
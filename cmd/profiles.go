@@ -0,0 +1,192 @@
+// Package cmd provides command-line interface for format profiles.
+// This file contains commands for listing and showing the format profiles
+// embedded in the binary and those supplied in the override directory.
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/profiles"
+	"github.com/spf13/cobra"
+)
+
+// profilesCmd represents the parent command for all format profile operations.
+var profilesCmd = &cobra.Command{
+	Use:   "profiles",
+	Short: "List and show the format profiles shipped with TombaTools",
+	Long: `List and show the format profiles shipped with TombaTools.
+
+A profile holds the region offsets, control-code table, palettes and format
+constraints of a game release. Profiles are embedded in the binary; YAML files
+in the override directory add new profiles or replace embedded ones with the
+same name. The override directory is $TOMBATOOLS_PROFILES, or
+<user config dir>/tombatools/profiles when it is not set.
+
+Commands:
+  list          List the available profiles
+  show          Print the YAML data of a profile
+  capabilities  Compare what the format features of every profile support
+
+Flags:
+  -d, --profiles-dir    Override directory for user-supplied profiles
+      --disc            Show the profile selected for a CD image (show only)
+
+Examples:
+  tombatools profiles list
+  tombatools profiles show tomba
+  tombatools profiles capabilities
+  tombatools profiles show --disc original.bin
+  tombatools profiles show tomba > ~/.config/tombatools/profiles/tomba.yaml
+  tombatools profiles list --profiles-dir ./profiles/`,
+}
+
+// profilesListCmd lists the embedded and user-supplied profiles
+var profilesListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the available format profiles",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		all, err := profiles.List(overrideDir)
+		if err != nil {
+			return fmt.Errorf("failed to list profiles: %w", err)
+		}
+
+		common.Printf("Name            | Regions              | Source\n")
+		common.Printf("----------------|----------------------|--------------------------------\n")
+		for _, profile := range all {
+			common.Printf("%-15s | %-20s | %s\n", profile.Name, strings.Join(profile.Regions, ","), profile.Source)
+		}
+		return nil
+	},
+}
+
+// profilesShowCmd prints the YAML data of a profile
+var profilesShowCmd = &cobra.Command{
+	Use:   "show [name]",
+	Short: "Print the YAML data of a format profile",
+	Args:  cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		discFile, err := cmd.Flags().GetString("disc")
+		if err != nil {
+			return fmt.Errorf("error getting disc flag: %w", err)
+		}
+		if (len(args) == 1) == (discFile != "") {
+			return fmt.Errorf("specify either a profile name or --disc")
+		}
+
+		var profile *profiles.Profile
+		if discFile != "" {
+			_, profile, err = detectDiscProfile(discFile, overrideDir)
+		} else {
+			profile, err = profiles.Load(args[0], overrideDir)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to load profile: %w", err)
+		}
+
+		common.Printf("%s", profile.Raw)
+		return nil
+	},
+}
+
+// profilesCapabilitiesCmd prints the capability matrix of the profiles
+var profilesCapabilitiesCmd = &cobra.Command{
+	Use:   "capabilities [name...]",
+	Short: "Print the capability matrix of the format profiles",
+	Long: `Print a matrix of the format features every profile supports: glyph pointer
+width, glyph ID range, font heights, glyph width limits, known releases and
+region conversions. Without names every
+available profile is listed.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		overrideDir, err := cmd.Flags().GetString("profiles-dir")
+		if err != nil {
+			return fmt.Errorf("error getting profiles-dir flag: %w", err)
+		}
+
+		var selected []*profiles.Profile
+		if len(args) == 0 {
+			if selected, err = profiles.List(overrideDir); err != nil {
+				return fmt.Errorf("failed to list profiles: %w", err)
+			}
+		}
+		for _, name := range args {
+			profile, err := profiles.Load(name, overrideDir)
+			if err != nil {
+				return fmt.Errorf("failed to load profile: %w", err)
+			}
+			selected = append(selected, profile)
+		}
+		if len(selected) == 0 {
+			return nil
+		}
+
+		// One row per capability, one column per profile
+		rows := [][]string{{"Capability"}}
+		for _, capability := range selected[0].Capabilities() {
+			rows = append(rows, []string{capability.Name})
+		}
+		for _, profile := range selected {
+			rows[0] = append(rows[0], profile.Name)
+			for i, capability := range profile.Capabilities() {
+				rows[i+1] = append(rows[i+1], capability.Value)
+			}
+		}
+
+		for i, row := range rows {
+			common.Printf("| %s |\n", strings.Join(row, " | "))
+			if i == 0 {
+				common.Printf("|%s\n", strings.Repeat("---|", len(row)))
+			}
+		}
+		return nil
+	},
+}
+
+// detectDiscProfile fingerprints a CD image and selects the profile listing its serial.
+// The profile is nil when the disc is not a known release.
+func detectDiscProfile(imageFile, overrideDir string) (*pkg.DiscIDReport, *profiles.Profile, error) {
+	identity, err := pkg.NewCDProcessor().Identify(imageFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	report := &pkg.DiscIDReport{DiscIdentity: *identity}
+	profile, release, err := profiles.ForDisc(identity.Serial, identity.BuildDate, overrideDir)
+	if err != nil {
+		return report, nil, err
+	}
+	report.Known = true
+	report.Title = release.Title
+	report.Profile = profile.Name
+	common.LogInfo("Disc %s is %s (%s), using profile %s", identity.Serial, release.Title, release.Region, profile.Name)
+	return report, profile, nil
+}
+
+func init() {
+	// Register the profiles command with the root command
+	rootCmd.AddCommand(profilesCmd)
+
+	// Add subcommands to the profiles command
+	profilesCmd.AddCommand(profilesListCmd)
+	profilesCmd.AddCommand(profilesShowCmd)
+	profilesCmd.AddCommand(profilesCapabilitiesCmd)
+
+	// Add profiles-dir flag shared by every profiles subcommand
+	profilesCmd.PersistentFlags().StringP("profiles-dir", "d", profiles.DefaultOverrideDir(), "Override directory for user-supplied profiles")
+
+	// Add disc flag to select the profile from a CD image
+	profilesShowCmd.Flags().String("disc", "", "Show the profile selected for this CD image instead of a named profile")
+}
@@ -4,8 +4,15 @@
 package cmd
 
 import (
+	"context"
+	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
 	"github.com/spf13/cobra"
 )
 
@@ -20,8 +27,20 @@ game files from Tomba! (Ore no Tomba) for PlayStation.
 Currently supports:
   - WFM font files (extract/create glyphs and dialogues)
   - GAM files (unpack/pack game data)
+  - Staff roll text (extract/inject the packed credits stream)
   - CD image files (extract files from ISO9660 file system)
   - FLA files (recalculate file link addresses)
+  - XA audio (split interleaved XA-ADPCM streams into WAV files and back)
+  - STR movies (decode FMV frames to PNG and their audio to WAV)
+  - TIM images (convert 4/8/16bpp TIM graphics to PNG and back)
+  - Stage overlays (dump and rebuild event to dialogue tables)
+  - Emulator RAM patching (hot-load files through the emulator GDB stub)
+  - Disc-wide text search (raw files, GAM payloads and WFM dialogues)
+  - Project diagnosis (fonts, palettes, configuration, disc images)
+  - Artifact store of build outputs (no-op rebuilds and rollback)
+  - Project history of every invocation, with replay against fresh inputs
+  - Project tasks and aliases (tombatools.yaml, see 'tombatools run')
+  - Editor plugin daemon (gRPC decode, preview and validation)
 
 Examples:
   tombatools wfm decode CFNT999H.WFM ./output/
@@ -31,17 +50,194 @@ Examples:
   tombatools cd dump original.bin ./output/
   tombatools cd dump -v original.bin ./output/
   tombatools fla recalc original.bin
+  tombatools search original.bin "Baron"
+  tombatools doctor
+  tombatools store init
+  tombatools run rebuild
 
-Use 'tombatools [command] --help' for more information about a command.`,
+Resource limits (global flags):
+  -j, --jobs N          Maximum parallel workers (default: all CPUs)
+      --max-memory SIZE Memory budget such as 512M or 2G; large files and images
+                        that would not fit are refused before being loaded
+      --sector-cache N  Disc image sectors each reader keeps for revisits such as
+                        directory walks (default: 256, 0 disables)
+
+Artifact store (global flag):
+      --no-store        Rebuild even when the inputs are unchanged and do not
+                        record the build in .tombatools (see 'tombatools store')
+
+Output summary (global flag):
+      --hashes          End with a summary of every file written (and of the disc
+                        images read): path, size, CRC32 and SHA-256
+
+Project history:
+  After 'tombatools history init', every invocation in the working directory is
+  recorded in .tombatools/history.jsonl; 'tombatools replay' re-runs them
+
+Exit codes:
+  0  Success
+  1  Unclassified failure or invalid command usage
+  2  Input file or directory not found
+  3  Input file format error
+  4  Validation failed
+  5  Output could not be written
+  130 Interrupted (Ctrl-C); pending writes were rolled back
+
+Use 'tombatools [command] --help' for more information about a command,
+'tombatools help formats wfm|gam|fla' for the file format documentation and
+'tombatools man DIR' to generate man pages.`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		quiet, err := cmd.Flags().GetBool("quiet")
+		if err != nil {
+			return err
+		}
+		common.SetQuietMode(quiet)
+
+		jobs, err := cmd.Flags().GetInt("jobs")
+		if err != nil {
+			return err
+		}
+		maxMemoryValue, err := cmd.Flags().GetString("max-memory")
+		if err != nil {
+			return err
+		}
+		var maxMemory int64
+		if maxMemoryValue != "" {
+			if maxMemory, err = common.ParseByteSize(maxMemoryValue); err != nil {
+				return fmt.Errorf("invalid --max-memory: %w", err)
+			}
+		}
+		if err := common.SetResourceLimits(jobs, maxMemory); err != nil {
+			return err
+		}
+
+		sectorCache, err := cmd.Flags().GetInt("sector-cache")
+		if err != nil {
+			return err
+		}
+		psx.SetDefaultSectorCacheSize(sectorCache)
+
+		tempDir, err := cmd.Flags().GetString("temp-dir")
+		if err != nil {
+			return err
+		}
+		keepTemp, err := cmd.Flags().GetBool("keep-temp")
+		if err != nil {
+			return err
+		}
+		common.SetTempOptions(tempDir, keepTemp)
+
+		hashes, err := cmd.Flags().GetBool("hashes")
+		if err != nil {
+			return err
+		}
+		common.SetOutputHashes(hashes)
+		printHashes = hashes
+		return startHistory(cmd)
+	},
+}
+
+// printHashes is set by --hashes; the output summary is also recorded, but not
+// printed, for the project history
+var printHashes bool
+
+// toolVersion is the release version of the binary, recorded in provenance trailers
+var toolVersion = "dev"
+
+// SetVersion sets the release version injected into main at build time
+func SetVersion(version string) {
+	toolVersion = version
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main() and serves as the entry point for command execution.
+// The process exits with the code matching the error category (see common.ExitCodeFor).
+// Ctrl-C (or SIGTERM) cancels the running operation, which rolls back its pending
+// writes; a second Ctrl-C terminates the process immediately. The temporary workspace
+// is removed before exiting unless --keep-temp is given. With --hashes, a successful
+// command ends with the summary of the files it wrote (see common.WriteOutputSummary).
+// In a project recording its history, the invocation is then appended to it.
 func Execute() {
-	err := rootCmd.Execute()
+	wrapRunE(rootCmd)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	err := rootCmd.ExecuteContext(ctx)
+	recordHistory(err)
+	common.CleanupTemp()
+	if err == nil && printHashes {
+		if err = common.WriteOutputSummary(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+	}
+	if err != nil {
+		if common.IsAborted(err) {
+			fmt.Fprintln(os.Stderr, common.AbortedMessage)
+		}
+		os.Exit(common.ExitCodeFor(err))
+	}
+}
+
+// wrapRunE wraps the RunE of every subcommand so that failures raised while
+// running a command do not print the usage text, which is kept for argument errors.
+// Interrupted commands only print the aborted message.
+func wrapRunE(cmd *cobra.Command) {
+	for _, subCmd := range cmd.Commands() {
+		if runE := subCmd.RunE; runE != nil {
+			subCmd.RunE = func(c *cobra.Command, args []string) error {
+				err := runE(c, args)
+				if err != nil {
+					c.SilenceUsage = true
+					c.SilenceErrors = common.IsAborted(err)
+				}
+				return err
+			}
+		}
+		wrapRunE(subCmd)
+	}
+}
+
+// outputTarget resolves where a command writing a directory tree puts its output:
+// the output_directory argument, or the staging directory of the --archive zip.
+// The returned archive is nil when writing to a plain directory.
+func outputTarget(cmd *cobra.Command, args []string) (string, *pkg.OutputArchive, error) {
+	archivePath, err := cmd.Flags().GetString("archive")
+	if err != nil {
+		return "", nil, fmt.Errorf("error getting archive flag: %w", err)
+	}
+
+	switch {
+	case archivePath == "" && len(args) < 2:
+		return "", nil, fmt.Errorf("an output directory or --archive is required")
+	case archivePath != "" && len(args) > 1:
+		return "", nil, fmt.Errorf("output directory %s and --archive %s are mutually exclusive", args[1], archivePath)
+	case archivePath == "":
+		return args[1], nil, nil
+	}
+
+	archive, err := pkg.NewOutputArchive(archivePath)
 	if err != nil {
-		os.Exit(1)
+		return "", nil, err
 	}
+	return archive.Dir(), archive, nil
+}
+
+// closeOutputTarget packs the staged output into the --archive zip, if any
+func closeOutputTarget(ctx context.Context, archive *pkg.OutputArchive) error {
+	if archive == nil {
+		return nil
+	}
+	count, err := archive.Close(ctx)
+	if err != nil {
+		return err
+	}
+	common.Printf("Archived %d files to: %s\n", count, archive.Path())
+	return nil
 }
 
 // init initializes the root command with flags and configuration settings.
@@ -51,4 +247,22 @@ func init() {
 
 	// Example toggle flag (can be removed if not needed)
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
+
+	// Quiet flag suppresses non-error output for every command
+	rootCmd.PersistentFlags().BoolP("quiet", "q", false, "Suppress non-error output (for batch pipelines)")
+
+	// Resource limits keep parallel work and large loads predictable on small machines
+	rootCmd.PersistentFlags().IntP("jobs", "j", 0, "Maximum number of parallel workers (0 uses all CPUs)")
+	rootCmd.PersistentFlags().String("max-memory", "", "Memory budget for data loaded at once, e.g. 512M or 2G (empty is unlimited)")
+	rootCmd.PersistentFlags().Int("sector-cache", psx.DefaultSectorCacheSize, "Disc image sectors cached by each reader for revisits (0 disables)")
+
+	// Intermediate files of multi-step commands live in a per-invocation temporary workspace
+	rootCmd.PersistentFlags().String("temp-dir", "", "Parent directory of the temporary workspace (default: $"+common.TempRootEnv+" or the system temporary directory)")
+	rootCmd.PersistentFlags().Bool("keep-temp", false, "Keep the temporary workspace and intermediate files for inspection")
+
+	// Build commands restore unchanged outputs from the project artifact store (see store)
+	rootCmd.PersistentFlags().Bool("no-store", false, "Always rebuild and do not record the build in the project artifact store")
+
+	// Release notes and bug reports quote the hashes of the files a command wrote
+	rootCmd.PersistentFlags().Bool("hashes", false, "End with the path, size, CRC32 and SHA-256 of every output file and input disc image")
 }
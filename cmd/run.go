@@ -0,0 +1,270 @@
+// Package cmd provides command-line interface for project tasks and aliases.
+// This file contains the run command, which runs a task (a sequence of tombatools
+// command lines) or an alias defined in the project configuration (tombatools.yaml).
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// runCmd runs a task or alias of the project configuration
+var runCmd = &cobra.Command{
+	Use:   "run [task] [args...]",
+	Short: "Run a task or alias defined in tombatools.yaml",
+	Long: `Run a named task or alias from the project configuration (tombatools.yaml).
+
+A task is a list of tombatools command lines run in order; an alias expands to a
+single command line and appends the arguments given after its name. Command
+lines are split like a shell would (quotes and backslashes are honored) and may
+start with "tombatools". Steps run from the directory holding the configuration.
+
+  tasks:
+    rebuild:
+      - wfm encode dialogues.yaml build/CFNT999H.WFM
+      - gam pack data.UNGAM build/GAME.GAM
+      - fla recalc --in-place "Tomba (USA).bin"
+  aliases:
+    enc: wfm encode --verbose
+
+Every step is checked before the first one runs: the command must exist and its
+flags, arguments and required flags must be valid, so a typo in the last step
+does not leave a half-built project. The task stops at the first failing step
+and exits with that step's exit code. Global flags (--quiet, --jobs, ...) given
+to run are passed on to every step.
+
+With --dry-run the steps are checked and printed; steps whose command has its
+own --dry-run flag are run with it, the others are not run.
+
+Flags:
+  -c, --config   Project configuration file (default: tombatools.yaml)
+      --dry-run  Check and print the steps, running only those supporting --dry-run
+  -l, --list     List the tasks and aliases of the configuration
+  -v, --verbose  Enable verbose output
+
+Flags after the task or alias name belong to it: 'run enc -v a.yaml b.WFM'
+passes -v to wfm encode.
+
+Examples:
+  tombatools run --list
+  tombatools run rebuild
+  tombatools run --dry-run rebuild
+  tombatools run enc dialogues.yaml CFNT999H.WFM`,
+	Args: cobra.ArbitraryArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		configPath, err := cmd.Flags().GetString("config")
+		if err != nil {
+			return fmt.Errorf("error getting config flag: %w", err)
+		}
+		dryRun, err := cmd.Flags().GetBool("dry-run")
+		if err != nil {
+			return fmt.Errorf("error getting dry-run flag: %w", err)
+		}
+		list, err := cmd.Flags().GetBool("list")
+		if err != nil {
+			return fmt.Errorf("error getting list flag: %w", err)
+		}
+
+		config, err := pkg.LoadProjectConfig(configPath)
+		if err != nil {
+			return err
+		}
+
+		if list {
+			printProjectTasks(config)
+			return nil
+		}
+		if len(args) == 0 {
+			return fmt.Errorf("a task or alias name is required (see --list)")
+		}
+
+		steps, err := config.Steps(args[0], args[1:])
+		if err != nil {
+			return err
+		}
+
+		// Check every step before running the first one
+		runnable := make([]bool, len(steps))
+		for i := range steps {
+			if err := validateProjectStep(steps[i].Args); err != nil {
+				return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s step %d (%s): %w", args[0], i+1, steps[i].Line, err))
+			}
+			runnable[i] = !dryRun
+			if dryRun && supportsDryRun(steps[i].Args) {
+				withDryRun := append(append([]string{}, steps[i].Args...), "--dry-run")
+				if validateProjectStep(withDryRun) == nil {
+					steps[i].Args = withDryRun
+					runnable[i] = true
+				}
+			}
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			return fmt.Errorf("failed to locate the tombatools executable: %w", err)
+		}
+		globalArgs := projectGlobalArgs(cmd)
+		dir := filepath.Dir(configPath)
+
+		for i, step := range steps {
+			if err := common.Canceled(cmd.Context()); err != nil {
+				return err
+			}
+			if !runnable[i] {
+				common.Printf("[%d/%d] %s (not run: dry run)\n", i+1, len(steps), step.Line)
+				continue
+			}
+			common.Printf("[%d/%d] %s\n", i+1, len(steps), step.Line)
+			common.LogDebug("Running %s %s in %s", exe, strings.Join(step.Args, " "), dir)
+
+			if err := runProjectStep(cmd.Context(), exe, dir, append(append([]string{}, globalArgs...), step.Args...)); err != nil {
+				return fmt.Errorf("%s step %d (%s) failed: %w", args[0], i+1, step.Line, err)
+			}
+		}
+		if dryRun {
+			common.Printf("Dry run: %d steps checked\n", len(steps))
+		}
+		return nil
+	},
+}
+
+// printProjectTasks lists the tasks and aliases of a project configuration
+func printProjectTasks(config *pkg.ProjectConfig) {
+	names := config.Names()
+	if len(names) == 0 {
+		common.Println("No tasks or aliases defined.")
+		return
+	}
+	for _, name := range names {
+		if lines, ok := config.Tasks[name]; ok {
+			common.Printf("%s (task, %d steps)\n", name, len(lines))
+			for _, line := range lines {
+				common.Printf("  %s\n", line)
+			}
+			continue
+		}
+		common.Printf("%s (alias)\n  %s\n", name, config.Aliases[name])
+	}
+}
+
+// validateProjectStep checks that a step names a runnable command and that its flags,
+// arguments and required flags are valid, without running it
+func validateProjectStep(args []string) error {
+	target, rest, err := rootCmd.Find(args)
+	if err != nil {
+		return err
+	}
+	if target == rootCmd || target.Name() == "run" || !target.Runnable() {
+		return fmt.Errorf("%q is not a runnable command", strings.Join(args, " "))
+	}
+
+	// Parsing stores the values in the command's flags; reset them so the next
+	// step using the same command is checked on its own
+	defer resetFlags(target)
+	if err := target.ParseFlags(rest); err != nil {
+		return err
+	}
+	if err := target.ValidateArgs(target.Flags().Args()); err != nil {
+		return err
+	}
+	if err := target.ValidateRequiredFlags(); err != nil {
+		return err
+	}
+	return target.ValidateFlagGroups()
+}
+
+// supportsDryRun reports whether the command of a step has a --dry-run flag
+func supportsDryRun(args []string) bool {
+	target, _, err := rootCmd.Find(args)
+	return err == nil && target.Flags().Lookup("dry-run") != nil
+}
+
+// resetFlags restores the default value of every flag set by parsing a step
+func resetFlags(c *cobra.Command) {
+	c.Flags().VisitAll(func(flag *pflag.Flag) {
+		if !flag.Changed {
+			return
+		}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			_ = slice.Replace(nil)
+		} else {
+			_ = flag.Value.Set(flag.DefValue)
+		}
+		flag.Changed = false
+	})
+}
+
+// projectGlobalArgs returns the global flags given to run, passed on to every step
+func projectGlobalArgs(cmd *cobra.Command) []string {
+	var args []string
+	rootCmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+		if set := cmd.Flags().Lookup(flag.Name); set != nil && set.Changed {
+			args = append(args, "--"+flag.Name+"="+set.Value.String())
+		}
+	})
+	return args
+}
+
+// runProjectStep runs one step as a tombatools process in dir. A failing step
+// returns an error of the category matching its exit code.
+func runProjectStep(ctx context.Context, exe, dir string, args []string) error {
+	process := exec.CommandContext(ctx, exe, args...)
+	process.Dir = dir
+	process.Stdin = os.Stdin
+	process.Stdout = os.Stdout
+	process.Stderr = os.Stderr
+
+	err := process.Run()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return err
+	}
+	if err := common.Canceled(ctx); err != nil {
+		return err
+	}
+
+	failure := fmt.Errorf("exit code %d", exitErr.ExitCode())
+	switch exitErr.ExitCode() {
+	case common.ExitInputNotFound:
+		return common.WithCategory(common.ErrCategoryInputNotFound, failure)
+	case common.ExitFormatError:
+		return common.WithCategory(common.ErrCategoryFormat, failure)
+	case common.ExitValidationFailed:
+		return common.WithCategory(common.ErrCategoryValidationFailed, failure)
+	case common.ExitWriteError:
+		return common.WithCategory(common.ErrCategoryWrite, failure)
+	case common.ExitAborted:
+		return common.WithCategory(common.ErrCategoryAborted, failure)
+	}
+	return failure
+}
+
+// init registers the run command and its flags
+func init() {
+	rootCmd.AddCommand(runCmd)
+
+	runCmd.Flags().StringP("config", "c", pkg.DefaultProjectConfigFile, "Project configuration file")
+	runCmd.Flags().Bool("dry-run", false, "Check and print the steps, running only those supporting --dry-run")
+	runCmd.Flags().BoolP("list", "l", false, "List the tasks and aliases of the configuration")
+	runCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+
+	// Everything after the task name is passed on to the alias
+	runCmd.Flags().SetInterspersed(false)
+}
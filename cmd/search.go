@@ -0,0 +1,124 @@
+// Package cmd provides command-line interface for searching text across a CD image.
+// This file contains the search command, which looks for a term in every file of a
+// PlayStation CD image to find where a particular string actually lives.
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// searchCmd searches every file of a CD image for a term
+var searchCmd = &cobra.Command{
+	Use:   "search [image_file] [term]",
+	Short: "Find text across every file of a CD image",
+	Long: `Search every file of a PlayStation CD image (.bin format) for a term.
+
+GAM files are searched after decompression and WFM files through their decoded
+dialogues (using the reference fonts to map glyphs to characters). All other
+files, executables included, are scanned byte by byte for the UTF-8/ASCII,
+Shift-JIS and Windows-1252 encodings of the term.
+
+Every match is reported with its file, kind (raw, gam or wfm), offset, dialogue ID
+for WFM matches and the surrounding context.
+
+Flags:
+  -f, --format       Report format: json or markdown (default: markdown)
+  -o, --output       Write the report to a file instead of stdout
+  -i, --ignore-case  Match ASCII letters regardless of case
+      --fonts        Reference font directory for WFM dialogues (default: fonts)
+      --context      Bytes or characters shown around each match (default: 16)
+
+Examples:
+  tombatools search original.bin "Baron"
+  tombatools search -i original.bin "baron"
+  tombatools search -f json -o baron.json original.bin "Baron"`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		imageFile := args[0]
+		common.RecordInput(imageFile)
+		term := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		ignoreCase, err := cmd.Flags().GetBool("ignore-case")
+		if err != nil {
+			return fmt.Errorf("error getting ignore-case flag: %w", err)
+		}
+
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+
+		contextSize, err := cmd.Flags().GetInt("context")
+		if err != nil {
+			return fmt.Errorf("error getting context flag: %w", err)
+		}
+
+		// Create CD processor for walking the image
+		processor := pkg.NewCDProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+
+		options := pkg.SearchOptions{IgnoreCase: ignoreCase, FontDir: fontDir, ContextSize: contextSize}
+		report, err := processor.Search(imageFile, term, options)
+		if err != nil {
+			return fmt.Errorf("failed to search CD image file: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteSearchReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write search report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Search report written to: %s (%d matches)\n", outputFile, len(report.Matches))
+		}
+
+		return nil
+	},
+}
+
+// init registers the search command and its flags.
+func init() {
+	// Add the search command to the root command
+	rootCmd.AddCommand(searchCmd)
+
+	// Add flags to the search command
+	searchCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	searchCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	searchCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	searchCmd.Flags().BoolP("ignore-case", "i", false, "Match ASCII letters regardless of case")
+	searchCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to decode WFM dialogues")
+	searchCmd.Flags().Int("context", pkg.DefaultSearchContext, "Bytes or characters shown around each match")
+}
@@ -0,0 +1,211 @@
+// Package cmd provides command-line interface for the project artifact store.
+// This file contains the store commands, which create the .tombatools store, list the
+// recorded builds and check out the outputs of an earlier build, and the helper build
+// commands run through to restore unchanged builds from the store.
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// storeCmd represents the parent command for the artifact store operations
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Manage the project artifact store of build outputs",
+	Long: `Manage the content-addressable artifact store of a project.
+
+Once 'store init' has created the .tombatools/ directory in the working
+directory, the build commands (wfm encode, gam pack and fla recalc without
+--in-place) keep every file they write under .tombatools/objects, named by its
+SHA-256 hash, so identical outputs are stored once. The manifest
+(.tombatools/manifest.yaml) links the hashes of the inputs and options of each
+build to its outputs. A build whose inputs and options did not change restores
+its outputs from the store instead of running again.
+
+Pass --no-store to a build command to bypass the store for one run.
+
+Commands:
+  init      Create the artifact store in the working directory
+  list      List the recorded builds
+  checkout  Restore the outputs of a recorded build
+
+Examples:
+  tombatools store init
+  tombatools store list
+  tombatools store checkout 3`,
+}
+
+// storeInitCmd creates the artifact store of the working directory
+var storeInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the artifact store in the working directory",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := pkg.InitArtifactStore(".")
+		if err != nil {
+			return err
+		}
+		common.Printf("Artifact store ready: %s (%d builds recorded)\n", store.Dir(), len(store.Builds()))
+		return nil
+	},
+}
+
+// storeListCmd lists the builds recorded in the artifact store
+var storeListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the builds recorded in the artifact store",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		store, err := openProjectStore()
+		if err != nil {
+			return err
+		}
+
+		builds := store.Builds()
+		if len(builds) == 0 {
+			common.Println("No builds recorded.")
+			return nil
+		}
+		for i := range builds {
+			common.Printf("%s\n", pkg.FormatBuildSummary(&builds[i]))
+		}
+		return nil
+	},
+}
+
+// storeCheckoutCmd restores the outputs of a recorded build
+var storeCheckoutCmd = &cobra.Command{
+	Use:   "checkout build_id",
+	Short: "Restore the outputs of a recorded build",
+	Long: `Write the outputs of a recorded build (see store list) back to their paths,
+rolling them back to that build. Outputs already holding the stored content are
+left alone.
+
+Example:
+  tombatools store checkout 3`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		id, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid build ID %q: %w", args[0], err)
+		}
+
+		store, err := openProjectStore()
+		if err != nil {
+			return err
+		}
+		build := store.Build(id)
+		if build == nil {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("build %d is not recorded", id))
+		}
+
+		written, err := store.Checkout(build)
+		if err != nil {
+			return err
+		}
+		common.Printf("Checked out build #%d: %d of %d outputs restored\n", build.ID, written, len(build.Outputs))
+		return nil
+	},
+}
+
+// openProjectStore opens the artifact store of the working directory, which must exist
+func openProjectStore() (*pkg.ArtifactStore, error) {
+	store, err := pkg.OpenArtifactStore(".")
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound,
+			fmt.Errorf("no artifact store in the working directory; run 'tombatools store init'"))
+	}
+	return store, nil
+}
+
+// runStoredBuild runs build through the artifact store of the working directory, if
+// any. When a build with the same inputs and options was recorded for the same outputs,
+// they are restored from the store instead; otherwise build runs and its outputs are
+// recorded. Outputs build did not write (e.g. nothing to patch) are not recorded.
+func runStoredBuild(cmd *cobra.Command, inputs, outputs []string, build func() error) error {
+	noStore, err := cmd.Flags().GetBool("no-store")
+	if err != nil {
+		return fmt.Errorf("error getting no-store flag: %w", err)
+	}
+	var store *pkg.ArtifactStore
+	if !noStore {
+		if store, err = pkg.OpenArtifactStore("."); err != nil {
+			return err
+		}
+	}
+	if store == nil {
+		return build()
+	}
+
+	request := pkg.BuildRequest{
+		Command: cmd.CommandPath(),
+		Options: buildOptions(cmd),
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+	key, inputFiles, err := store.BuildKey(request)
+	if err != nil {
+		return err
+	}
+
+	if recorded := store.Lookup(key, outputs); recorded != nil {
+		written, err := store.Checkout(recorded)
+		if err != nil {
+			return err
+		}
+		common.Printf("Inputs unchanged since build #%d: %d of %d outputs restored from the artifact store\n",
+			recorded.ID, written, len(recorded.Outputs))
+		return nil
+	}
+
+	if err := build(); err != nil {
+		return err
+	}
+
+	for _, output := range outputs {
+		if _, err := os.Stat(output); err != nil {
+			common.LogDebug("Build not recorded: %s was not written", output)
+			return nil
+		}
+	}
+	recorded, err := store.Record(request, key, inputFiles)
+	if err != nil {
+		return fmt.Errorf("failed to record build: %w", err)
+	}
+	common.Printf("Recorded build #%d in the artifact store\n", recorded.ID)
+	return nil
+}
+
+// buildOptions returns the tool version and the changed flags of a build command,
+// which change its result together with the inputs
+func buildOptions(cmd *cobra.Command) []string {
+	options := []string{"version=" + toolVersion}
+	cmd.LocalNonPersistentFlags().Visit(func(flag *pflag.Flag) {
+		if flag.Name == "verbose" {
+			return
+		}
+		options = append(options, flag.Name+"="+flag.Value.String())
+	})
+	sort.Strings(options[1:])
+	return options
+}
+
+// init registers the store commands
+func init() {
+	rootCmd.AddCommand(storeCmd)
+
+	storeCmd.AddCommand(storeInitCmd)
+	storeCmd.AddCommand(storeListCmd)
+	storeCmd.AddCommand(storeCheckoutCmd)
+}
@@ -0,0 +1,90 @@
+// Package cmd provides command-line interface for STR movie processing.
+// This file contains the command decoding the FMVs of the Tomba! PlayStation
+// game into PNG frames and WAV audio.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// strCmd represents the parent command for all STR movie operations.
+var strCmd = &cobra.Command{
+	Use:   "str",
+	Short: "Process STR movies from Tomba! PSX game",
+	Long: `Process the STR movies (FMVs) of Tomba! PSX game.
+
+Commands:
+  decode    Decode a movie into PNG frames and WAV audio
+
+Examples:
+  tombatools str decode --image original.bin MOVIE/OPENING.STR ./opening/
+  tombatools str decode OPENING.STR ./opening/`,
+}
+
+// strDecodeCmd decodes a movie into PNG frames and WAV audio.
+var strDecodeCmd = &cobra.Command{
+	Use:   "decode [str_file] [output_directory]",
+	Short: "Decode a movie into PNG frames and WAV audio",
+	Long: `Decode the MDEC video frames of an STR movie (bitstream versions 2 and 3) into
+frame_NNNNN.png files and its interleaved XA-ADPCM audio into WAV files, named
+as xa decode names them.
+
+The audio sectors are Mode 2 Form 2 sectors, which cd dump does not keep: read
+the movie from the disc with --image, or from a dump of 2336-byte or 2352-byte
+sectors, to get the audio. A movie copied by cd dump still decodes its frames.
+Frames whose bitstream cannot be decoded are skipped with a warning.
+
+Flags:
+  --image         Read str_file as a path of this disc image
+  -v, --verbose   Enable verbose output
+
+Examples:
+  tombatools str decode --image original.bin MOVIE/OPENING.STR ./opening/
+  tombatools str decode OPENING.STR ./opening/`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		outputDir := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		imageFile, err := cmd.Flags().GetString("image")
+		if err != nil {
+			return fmt.Errorf("error getting image flag: %w", err)
+		}
+		recordXAInput(source, imageFile)
+
+		processor := pkg.NewSTRProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Decode(cmd.Context(), source, imageFile, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", source, err)
+		}
+
+		common.Printf("Decoded %d frames (%dx%d, %d skipped) and %d audio streams of %s to %s\n",
+			report.Frames, report.Width, report.Height, report.Skipped, len(report.Streams), source, outputDir)
+		return nil
+	},
+}
+
+// init initializes the STR command and its subcommands with appropriate flags.
+func init() {
+	// Register the STR command with the root command
+	rootCmd.AddCommand(strCmd)
+
+	// Add subcommands to the STR command
+	strCmd.AddCommand(strDecodeCmd)
+
+	// Add flags to decode command
+	strDecodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	strDecodeCmd.Flags().String("image", "", "Read the movie from this disc image")
+}
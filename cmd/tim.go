@@ -0,0 +1,167 @@
+// Package cmd provides command-line interface for TIM image processing.
+// This file contains commands for converting the TIM images of the Tomba!
+// PlayStation game to PNG and back.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// timCmd represents the parent command for all TIM image operations.
+var timCmd = &cobra.Command{
+	Use:   "tim",
+	Short: "Process TIM images from Tomba! PSX game",
+	Long: `Process the TIM images (4bpp and 8bpp with CLUTs, 16bpp and 24bpp direct
+color) of Tomba! PSX game.
+
+Commands:
+  decode    Convert a TIM image to PNG
+  encode    Convert a PNG image to TIM
+
+Examples:
+  tombatools tim decode TITLE.TIM title.png
+  tombatools tim encode --clut TITLE.TIM title.png TITLE_new.TIM`,
+}
+
+// timDecodeCmd converts a TIM image to PNG.
+var timDecodeCmd = &cobra.Command{
+	Use:   "decode [tim_file] [output_png]",
+	Short: "Convert a TIM image to PNG",
+	Long: `Convert a TIM image to a PNG image.
+
+4bpp and 8bpp images are written as indexed-color PNG files holding every color
+of the selected CLUT, so an image edited without adding colors encodes back to
+the same palette indices. Color 0 is transparent, as the GPU draws it. 16bpp
+and 24bpp images are written as RGBA PNG files.
+
+Flags:
+  --clut-index N   CLUT of the TIM to draw the image with (default: 0)
+  -v, --verbose    Enable verbose output
+
+Examples:
+  tombatools tim decode TITLE.TIM title.png
+  tombatools tim decode --clut-index 2 ITEMS.TIM items_2.png`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		clutIndex, err := cmd.Flags().GetInt("clut-index")
+		if err != nil {
+			return fmt.Errorf("error getting clut-index flag: %w", err)
+		}
+
+		processor := pkg.NewTIMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Decode(inputFile, outputFile, clutIndex)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", inputFile, err)
+		}
+
+		common.Printf("Decoded %dbpp %dx%d image of %s (CLUT %d of %d) to %s\n",
+			report.BPP, report.Width, report.Height, inputFile, report.Clut, report.Palettes, outputFile)
+		return nil
+	},
+}
+
+// timEncodeCmd converts a PNG image to TIM.
+var timEncodeCmd = &cobra.Command{
+	Use:   "encode [input_png] [output_tim]",
+	Short: "Convert a PNG image to TIM",
+	Long: `Convert a PNG image to a TIM image of 4, 8 or 16 bits per pixel.
+
+With --clut, the image replaces the one of an original TIM: it is quantized
+against the CLUT selected with --clut-index, and the output keeps the whole CLUT
+block and the VRAM positions of the original. An indexed-color PNG written by
+tim decode keeps its palette indices. Without --clut, the CLUT is built from the
+colors of the image (in palette order for indexed-color PNG files) and both
+blocks are placed at 0,0 unless --position and --clut-position say otherwise.
+
+Transparent pixels become color 0; opaque black gets the semi-transparency bit
+so the GPU does not draw it as transparent. 4bpp images must be a multiple of 4
+pixels wide and 8bpp images a multiple of 2.
+
+Flags:
+  --bpp N               Bits per pixel: 4, 8 or 16 (default: the depth of --clut, or 4)
+  --clut FILE           Original TIM whose CLUT and VRAM positions are reused
+  --clut-index N        CLUT of --clut the image is quantized against (default: 0)
+  --position X,Y        VRAM position of the image
+  --clut-position X,Y   VRAM position of the CLUT
+  -v, --verbose         Enable verbose output
+
+Examples:
+  tombatools tim encode --clut TITLE.TIM title.png TITLE_new.TIM
+  tombatools tim encode --bpp 8 --position 640,0 --clut-position 0,480 logo.png LOGO.TIM`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		var options pkg.TIMEncodeOptions
+		if options.BPP, err = cmd.Flags().GetInt("bpp"); err != nil {
+			return fmt.Errorf("error getting bpp flag: %w", err)
+		}
+		if options.ClutFile, err = cmd.Flags().GetString("clut"); err != nil {
+			return fmt.Errorf("error getting clut flag: %w", err)
+		}
+		if options.ClutIndex, err = cmd.Flags().GetInt("clut-index"); err != nil {
+			return fmt.Errorf("error getting clut-index flag: %w", err)
+		}
+		if options.Position, err = cmd.Flags().GetString("position"); err != nil {
+			return fmt.Errorf("error getting position flag: %w", err)
+		}
+		if options.ClutPosition, err = cmd.Flags().GetString("clut-position"); err != nil {
+			return fmt.Errorf("error getting clut-position flag: %w", err)
+		}
+
+		processor := pkg.NewTIMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Encode(inputFile, outputFile, options)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", inputFile, err)
+		}
+
+		common.Printf("Encoded %s as a %dbpp %dx%d TIM: %s\n", inputFile, report.BPP, report.Width, report.Height, outputFile)
+		return nil
+	},
+}
+
+// init initializes the TIM command and its subcommands with appropriate flags.
+func init() {
+	// Register the TIM command with the root command
+	rootCmd.AddCommand(timCmd)
+
+	// Add subcommands to the TIM command
+	timCmd.AddCommand(timDecodeCmd)
+	timCmd.AddCommand(timEncodeCmd)
+
+	// Add flags to decode command
+	timDecodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	timDecodeCmd.Flags().Int("clut-index", 0, "CLUT of the TIM to draw the image with")
+
+	// Add flags to encode command
+	timEncodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	timEncodeCmd.Flags().Int("bpp", 0, "Bits per pixel: 4, 8 or 16 (0 takes the depth of --clut, or 4)")
+	timEncodeCmd.Flags().String("clut", "", "Original TIM whose CLUT and VRAM positions are reused")
+	timEncodeCmd.Flags().Int("clut-index", 0, "CLUT of --clut the image is quantized against")
+	timEncodeCmd.Flags().String("position", "", "VRAM position X,Y of the image")
+	timEncodeCmd.Flags().String("clut-position", "", "VRAM position X,Y of the CLUT")
+}
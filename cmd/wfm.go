@@ -5,10 +5,17 @@ package cmd
 
 import (
 	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
 	"path/filepath"
+	"strconv"
 
 	"github.com/hansbonini/tombatools/pkg"
 	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/profiles"
+	"github.com/hansbonini/tombatools/pkg/psx"
 	"github.com/spf13/cobra"
 )
 
@@ -21,12 +28,47 @@ var wfmCmd = &cobra.Command{
 	Long: `Process WFM font files used in Tomba! PSX game.
 
 Commands:
-  decode    Extract glyphs (PNG) and dialogues (YAML) from WFM files
-  encode    Create WFM files from YAML dialogues and font PNG files
+  decode      Extract glyphs (PNG) and dialogues (YAML) from WFM files
+  encode      Create WFM files from YAML dialogues and font PNG files
+  progress    Report translation progress between two dialogue YAML files
+  pauses      Report and normalize [PAUSE FOR] durations in dialogue YAML files
+  import      Convert legacy Shift-JIS/Windows-1252 script dumps to dialogue YAML
+  unmapped    Summarize the unmapped codes recorded across decode/encode runs
+  palettes    Discover the glyph CLUTs from a VRAM dump or the executable
+  provenance  Show the build provenance embedded by encode --provenance
+  lint        Check dialogue YAML files against the glossary, line and glyph widths and terminators
+  mt          Fill drafts of untranslated dialogues from a machine translation backend
+  render      Render arbitrary text with the glyphs of a WFM font
+  shotdiff    Compare an emulator screenshot of a text box with the expected rendering
+  stats       Summarize a WFM file and report the space free for new content
+  opcodes     Propose argument counts for undecoded control codes
+  graph       Export the dialogue flow of the overlay events as a Graphviz or JSON graph
+  measure     Report characters per line by font height and predict line overflows
+  baseline    Compare glyph ink rows with the original font and preview the baseline shifts
+  selftest    Check that every WFM file of a local corpus encodes back byte for byte
+  remap       Append new dialogues after the decoded ones and list the slot of every named dialogue
+  fonttool    Scale, shift or trim every glyph PNG of a font directory
 
 Examples:
   tombatools wfm decode CFNT999H.WFM ./output/
-  tombatools wfm encode dialogues.yaml output.wfm`,
+  tombatools wfm encode dialogues.yaml output.wfm
+  tombatools wfm progress original.yaml translated.yaml
+  tombatools wfm pauses --scale 0.5 --write fast.yaml dialogues.yaml
+  tombatools wfm import --base dialogues.yaml script.txt imported.yaml
+  tombatools wfm unmapped unmapped-codes.yaml
+  tombatools wfm palettes --vram vram.bin CFNT999H.WFM ./output/
+  tombatools wfm lint --glossary glossary.yaml translated.yaml
+  tombatools wfm mt --url http://localhost:5000/translate --target pt original.yaml translated.yaml
+  tombatools wfm render CFNT999H.WFM "Hello, Tomba!" hello.png
+  tombatools wfm shotdiff CFNT999H.WFM translated.yaml 12 shot.png diff.png
+  tombatools wfm stats --space CFNT999H.WFM
+  tombatools wfm opcodes -f yaml -o hypotheses.yaml *.WFM
+  tombatools wfm graph --events events01.yaml -o flow.dot dialogues.yaml
+  tombatools wfm measure -f csv -o measure.csv CFNT999H.WFM translated.yaml
+  tombatools wfm baseline --overrides baseline.yaml CFNT999H.WFM translated.yaml
+  tombatools wfm selftest --corpus ./dumps/
+  tombatools wfm remap --write remapped.yaml translated.yaml
+  tombatools wfm fonttool shift fonts/16 --dx 1`,
 }
 
 // wfmDecodeCmd extracts glyphs and dialogues from WFM font files.
@@ -41,13 +83,56 @@ Output:
   - Individual glyph PNG files in ./glyphs/
   - Dialogue YAML file with decoded text and metadata
   - Automatic glyph-to-character mapping (if fonts/ directory exists)
+  - Glyphs rendered with the project palettes (palettes.yaml in the output
+    directory, see wfm palettes) instead of the built-in CLUTs when present
+  - Unmapped codes ([XXXX] glyphs without a font character, unknown <XXXX>
+    control codes) recorded with file, dialogue ID and count in the project
+    dictionary (unmapped-codes.yaml)
+
+Flags:
+  --unmapped-log  Dictionary file for unmapped codes (default: unmapped-codes.yaml, "" disables)
+  --archive       Write all outputs into a single .zip archive instead of a directory,
+                  keeping the same layout (accepted as input by wfm encode)
+  --raw-dialogues Also store the original bytes of every dialogue as a raw: hex string.
+                  Encode writes dialogues with a raw: entry verbatim (delete it after
+                  editing the content), keeping dialogues with unknown opcodes lossless.
+                  Glyph codes in raw: entries assume the original glyph order.
+  --salvage       Decode corrupted files without stopping at the first bad field: every
+                  glyph and dialogue is located through its pointer, unreadable ones are
+                  left empty and a recovery report (recovery-report.yaml) lists exactly
+                  which items were lost
+  --widths        Store the measured pixel width of every dialogue line (widths:) and
+                  the glyph widths of the font (glyph_widths:), so wfm lint can warn
+                  about lines that grew wider than the original while editing
+  --double-newline  How DOUBLE_NEWLINE (0xFFFB) is written: newline (a blank line) or
+                  page (a [PAGE] tag, for scripts where it clears the text box).
+                  Defaults to the double_newline setting of the game profile.
+  --profile       Game profile providing the defaults and the speaker names written
+                  next to the id of [SPEAKER] items (default: tomba)
+  --dialogues-only  Skip the glyph PNG export and only write dialogues.yaml; glyphs
+                  are mapped to characters in memory. Glyph images are always read
+                  from the file on demand, so large fonts are not held in memory.
+  --merge-existing  Merge into this existing (translated) dialogues.yaml instead of
+                  starting over, e.g. after a new game revision. Dialogues are aligned
+                  by ID and by the fingerprint of their original text: unchanged ones
+                  keep their translation, moved ones take it along, and translated ones
+                  whose original text changed get the new text with the translation
+                  under conflict: for manual resolution (encode refuses them until the
+                  conflict entry is deleted). Dialogues appended by wfm remap follow.
 
 Example:
-  tombatools wfm decode CFNT999H.WFM ./output/`,
-	Args: cobra.ExactArgs(2),
+  tombatools wfm decode CFNT999H.WFM ./output/
+  tombatools wfm decode --archive CFNT999H.zip CFNT999H.WFM
+  tombatools wfm decode --raw-dialogues CFNT999H.WFM ./output/
+  tombatools wfm decode --salvage BROKEN.WFM ./rescued/
+  tombatools wfm decode --widths CFNT999H.WFM ./output/
+  tombatools wfm decode --dialogues-only CFNT999H.WFM ./output/
+  tombatools wfm decode --double-newline page CFNT999H.WFM ./output/
+  tombatools wfm decode --merge-existing translated/dialogues.yaml CFNT999H.WFM ./translated/
+  tombatools wfm decode --unmapped-log research/unmapped-codes.yaml CFNT999H.WFM ./output/`,
+	Args: cobra.RangeArgs(1, 2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		inputFile := args[0]
-		outputDir := args[1]
 
 		// Enable verbose mode if requested
 		verbose, err := cmd.Flags().GetBool("verbose")
@@ -56,21 +141,108 @@ Example:
 		}
 		common.SetVerboseMode(verbose)
 
+		outputDir, archive, err := outputTarget(cmd, args)
+		if err != nil {
+			return err
+		}
+		if archive != nil {
+			defer archive.Discard()
+		}
+
+		unmappedLog, err := cmd.Flags().GetString("unmapped-log")
+		if err != nil {
+			return fmt.Errorf("error getting unmapped-log flag: %w", err)
+		}
+
+		rawDialogues, err := cmd.Flags().GetBool("raw-dialogues")
+		if err != nil {
+			return fmt.Errorf("error getting raw-dialogues flag: %w", err)
+		}
+
+		salvage, err := cmd.Flags().GetBool("salvage")
+		if err != nil {
+			return fmt.Errorf("error getting salvage flag: %w", err)
+		}
+
+		lineWidths, err := cmd.Flags().GetBool("widths")
+		if err != nil {
+			return fmt.Errorf("error getting widths flag: %w", err)
+		}
+
+		dialoguesOnly, err := cmd.Flags().GetBool("dialogues-only")
+		if err != nil {
+			return fmt.Errorf("error getting dialogues-only flag: %w", err)
+		}
+
+		doubleNewline, err := decodeDoubleNewlineMode(cmd)
+		if err != nil {
+			return err
+		}
+
+		mergeExisting, err := cmd.Flags().GetString("merge-existing")
+		if err != nil {
+			return fmt.Errorf("error getting merge-existing flag: %w", err)
+		}
+
 		// Create WFM processor for handling decode operations
 		processor := pkg.NewWFMProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		processor.SetUnmappedLog(unmappedLog)
+		processor.SetRawDialogues(rawDialogues)
+		processor.SetSalvage(salvage)
+		processor.SetLineWidths(lineWidths)
+		processor.SetDialoguesOnly(dialoguesOnly)
+		processor.SetMergeExisting(mergeExisting)
+		if err := processor.SetDoubleNewlineMode(doubleNewline); err != nil {
+			return err
+		}
+
+		// The profile names the speakers of the name tag codes
+		profile, err := loadFlagProfile(cmd)
+		if err != nil {
+			return err
+		}
+		processor.SetSpeakerNames(profile.Speakers)
 
 		// Process the WFM file: decode structure and export data
-		fmt.Printf("Processing WFM file: %s\n", inputFile)
-		fmt.Printf("Output directory: %s\n", outputDir)
+		common.Printf("Processing WFM file: %s\n", inputFile)
+		if archive == nil {
+			common.Printf("Output directory: %s\n", outputDir)
+		}
 
 		if err := processor.Process(inputFile, outputDir); err != nil {
 			return fmt.Errorf("failed to process WFM file: %w", err)
 		}
 
+		if report := processor.RecoveryReport(); report != nil {
+			common.Printf("Salvage: recovered %d/%d glyphs and %d/%d dialogues (%d issues)\n",
+				report.Glyphs.Recovered, report.Glyphs.Total, report.Dialogues.Recovered, report.Dialogues.Total, len(report.Issues))
+			if archive == nil {
+				common.Printf("- Recovery report written to: %s\n", filepath.Join(outputDir, pkg.DefaultRecoveryReportFile))
+			}
+		}
+
+		if report := processor.MergeReport(); report != nil {
+			common.Printf("Merged into %s: %d kept, %d moved, %d updated, %d new, %d conflicts, %d removed, %d appended\n",
+				report.Existing, report.Counts[pkg.MergeStatusKept], report.Counts[pkg.MergeStatusMoved],
+				report.Counts[pkg.MergeStatusUpdated], report.Counts[pkg.MergeStatusNew], report.Counts[pkg.MergeStatusConflict],
+				report.Counts[pkg.MergeStatusRemoved], report.Counts[pkg.MergeStatusAppended])
+			for _, conflict := range report.Conflicts() {
+				common.Printf("- Dialogue %d needs its translation checked against the new text (conflict:)\n", conflict.ID)
+			}
+		}
+
+		if archive != nil {
+			common.Println("WFM file processed successfully!")
+			return closeOutputTarget(cmd.Context(), archive)
+		}
+
 		// Display success message with output locations
-		fmt.Println("WFM file processed successfully!")
-		fmt.Printf("- Individual glyph PNG files saved to: %s\n", filepath.Join(outputDir, "glyphs"))
-		fmt.Printf("- Dialogues extracted to: %s\n", filepath.Join(outputDir, "dialogues.yaml"))
+		common.Println("WFM file processed successfully!")
+		if !dialoguesOnly {
+			common.Printf("- Individual glyph PNG files saved to: %s\n", filepath.Join(outputDir, "glyphs"))
+		}
+		common.Printf("- Dialogues extracted to: %s\n", filepath.Join(outputDir, "dialogues.yaml"))
 
 		return nil
 	},
@@ -85,14 +257,75 @@ var wfmEncodeCmd = &cobra.Command{
 	Long: `Create WFM font files from YAML dialogue data and PNG font files.
 
 Requirements:
-  - YAML file with dialogue data (from decode command)
-  - fonts/ directory with character PNG files (8/, 16/, 24/ subdirectories)
+  - YAML file with dialogue data (from decode command), or a .zip archive
+    written by decode --archive (its dialogues.yaml is used)
+  - fonts/ directory with character PNG files (8/, 16/, 24/ subdirectories),
+    or a donor WFM file given with --glyphs-from
 
 Output:
   - Complete WFM file ready for use in Tomba! PSX game
+  - Glyph PNGs are quantized with the project palettes (palettes.yaml next to
+    the YAML file, see wfm palettes) instead of the built-in CLUTs when present
 
-Example:
-  tombatools wfm encode dialogues.yaml CFNT999H_modified.WFM`,
+Dialogue IDs are checked when the YAML file is loaded, since the pointer table
+is written in ID order: an ID used twice, or past total_dialogues on a dialogue
+without a name (wfm remap names the dialogues it appends), fails with the line
+of its id key. Missing IDs are warned about, as the later dialogues move to
+earlier slots.
+
+Flags:
+  --align         Round the output size up to a multiple of this value (e.g. 2048)
+  --pad-byte      Byte used for final padding (default: 0xFF)
+  --alpha-threshold  Make glyph pixels with alpha below this value transparent and the rest opaque (1-255)
+  --matte         Blend semi-transparent glyph pixels over this RRGGBB color before thresholding
+  --premultiplied Treat glyph PNG colors as premultiplied by alpha
+  --warn-partial-alpha  Warn about glyph PNGs containing semi-transparent pixels
+  --glyphs-from   Copy the glyph table of an existing WFM instead of reading fonts/ PNGs.
+                  Characters are matched to glyphs through the unedited donor dialogues,
+                  so every character used must appear in the donor text.
+  --unmapped-log  Dictionary file for unmapped codes (default: unmapped-codes.yaml, "" disables)
+  --provenance    Store the tool version, source YAML hash and timestamp at the end of
+                  the final padding (the game never reads it). Fails when the padding
+                  is too small; use --align to add some.
+  --encode-map    Also write a YAML file listing every encode value (0x8000+) with its
+                  character, glyph size, glyph hash and source PNG (or donor glyph)
+  --width-report  Also write a report comparing every character's width with the
+                  original font (glyph_widths, stored by decode --widths) and the
+                  line width changes of every dialogue. .json files are written as
+                  JSON, anything else as markdown.
+  --check-refs    Reference profile locating the dialogue indices hardcoded in the
+                  executable (fixed offsets or byte patterns per WFM file name, matched
+                  against the output file name). Warns when the encode removes
+                  dialogues or a referenced slot is removed or holds another ID.
+  --exe           Executable scanned by --check-refs (e.g. MAIN0.EXE)
+  --double-newline  newline encodes a blank line as DOUBLE_NEWLINE; page encodes
+                  [PAGE] as DOUBLE_NEWLINE and every newline as NEWLINE. Defaults to
+                  the mode the YAML file was decoded with. [PAGE] is accepted in both.
+  --profile       Game profile whose max_glyph_widths limits are enforced (default:
+                  tomba). Glyph PNGs wider than the limit of their font height fail
+                  the encode, since the game would draw them over the next glyph.
+                  Dialogues whose font_clut is neither in its font_cluts nor in the
+                  project palettes.yaml fail, since the game would draw black boxes.
+                  Its ignored_characters (translator markers) are dropped from the text.
+  --align-baseline  Original WFM file whose glyph ink rows the new glyphs are moved
+                  onto (see wfm baseline), so mixed 16px/24px text lines up
+  --baseline-overrides  YAML file of per-character shifts replacing the automatic
+                  ones; usable without --align-baseline
+
+With an artifact store (see store init), an encode whose YAML file, fonts/,
+palettes, donor and flags are unchanged restores its output from the store.
+
+Examples:
+  tombatools wfm encode dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode CFNT999H.zip CFNT999H_modified.WFM
+  tombatools wfm encode --provenance --align 2048 dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --encode-map encode_map.yaml dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --width-report widths.md dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --check-refs refs.yaml --exe MAIN0.EXE dialogues.yaml CFNT999H.WFM
+  tombatools wfm encode --align 2048 --pad-byte 0x00 dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --alpha-threshold 128 --matte 000000 dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --glyphs-from CFNT999H.WFM dialogues.yaml CFNT999H_modified.WFM
+  tombatools wfm encode --align-baseline CFNT999H.WFM --baseline-overrides baseline.yaml dialogues.yaml CFNT999H_modified.WFM`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		inputFile := args[0]
@@ -105,34 +338,2158 @@ Example:
 		}
 		common.SetVerboseMode(verbose)
 
-		fmt.Printf("Input file: %s\n", inputFile)
-		fmt.Printf("Output WFM file: %s\n", outputFile)
+		common.Printf("Input file: %s\n", inputFile)
+		common.Printf("Output WFM file: %s\n", outputFile)
+
+		alignment, err := cmd.Flags().GetInt64("align")
+		if err != nil {
+			return fmt.Errorf("error getting align flag: %w", err)
+		}
+
+		padByteStr, err := cmd.Flags().GetString("pad-byte")
+		if err != nil {
+			return fmt.Errorf("error getting pad-byte flag: %w", err)
+		}
+
+		padByte, err := strconv.ParseUint(padByteStr, 0, 8)
+		if err != nil {
+			return fmt.Errorf("invalid pad byte %q: %w", padByteStr, err)
+		}
+
+		alphaOptions, warnPartialAlpha, err := getAlphaOptions(cmd)
+		if err != nil {
+			return err
+		}
 
 		// Create WFM encoder for handling encode operations
 		encoder := pkg.NewWFMEncoder()
+		encoder.SetLogger(common.NewLogger(verbose))
+		if err := encoder.SetPaddingPolicy(alignment, byte(padByte)); err != nil {
+			return fmt.Errorf("invalid padding policy: %w", err)
+		}
+		encoder.SetAlphaPreprocessing(alphaOptions, warnPartialAlpha)
+
+		// The profile limits the glyph widths and the font CLUTs
+		profile, err := loadFlagProfile(cmd)
+		if err != nil {
+			return err
+		}
+		encoder.SetGlyphWidthLimits(profile.Constraints.MaxGlyphWidths)
+		encoder.SetFontCluts(profile.FontCluts)
+		common.LogDebug("Profile %s: glyph width limits %v", profile.Name, profile.Constraints.MaxGlyphWidths)
+
+		glyphsFrom, err := cmd.Flags().GetString("glyphs-from")
+		if err != nil {
+			return fmt.Errorf("error getting glyphs-from flag: %w", err)
+		}
+		if glyphsFrom != "" {
+			common.Printf("Glyph donor WFM: %s\n", glyphsFrom)
+			if err := encoder.SetGlyphDonor(glyphsFrom); err != nil {
+				return fmt.Errorf("failed to load glyph donor: %w", err)
+			}
+		}
+
+		alignBaseline, err := cmd.Flags().GetString("align-baseline")
+		if err != nil {
+			return fmt.Errorf("error getting align-baseline flag: %w", err)
+		}
+		baselineOverridesFile, err := cmd.Flags().GetString("baseline-overrides")
+		if err != nil {
+			return fmt.Errorf("error getting baseline-overrides flag: %w", err)
+		}
+		if glyphsFrom != "" && (alignBaseline != "" || baselineOverridesFile != "") {
+			return fmt.Errorf("--glyphs-from copies the donor glyphs unchanged and cannot be combined with baseline alignment")
+		}
+		var baselineReference *pkg.GlyphBaselineReference
+		if alignBaseline != "" {
+			common.Printf("Baseline reference WFM: %s\n", alignBaseline)
+			if baselineReference, err = pkg.LoadGlyphBaselineReference(alignBaseline, pkg.DefaultFontDir); err != nil {
+				return fmt.Errorf("failed to load baseline reference: %w", err)
+			}
+		}
+		var baselineOverrides *pkg.GlyphBaselineOverrides
+		if baselineOverridesFile != "" {
+			if baselineOverrides, err = pkg.LoadGlyphBaselineOverrides(baselineOverridesFile); err != nil {
+				return err
+			}
+		}
+		encoder.SetBaselineAlignment(baselineReference, baselineOverrides)
+
+		unmappedLog, err := cmd.Flags().GetString("unmapped-log")
+		if err != nil {
+			return fmt.Errorf("error getting unmapped-log flag: %w", err)
+		}
+		encoder.SetUnmappedLog(unmappedLog)
+
+		provenance, err := cmd.Flags().GetBool("provenance")
+		if err != nil {
+			return fmt.Errorf("error getting provenance flag: %w", err)
+		}
+		if provenance {
+			encoder.SetProvenance(toolVersion)
+		}
+
+		encodeMap, err := cmd.Flags().GetString("encode-map")
+		if err != nil {
+			return fmt.Errorf("error getting encode-map flag: %w", err)
+		}
+		encoder.SetEncodeMap(encodeMap)
+
+		widthReport, err := cmd.Flags().GetString("width-report")
+		if err != nil {
+			return fmt.Errorf("error getting width-report flag: %w", err)
+		}
+		encoder.SetWidthReport(widthReport)
+
+		doubleNewline, err := cmd.Flags().GetString("double-newline")
+		if err != nil {
+			return fmt.Errorf("error getting double-newline flag: %w", err)
+		}
+		if err := encoder.SetDoubleNewlineMode(doubleNewline); err != nil {
+			return err
+		}
+
+		refsProfileFile, err := cmd.Flags().GetString("check-refs")
+		if err != nil {
+			return fmt.Errorf("error getting check-refs flag: %w", err)
+		}
+		exeFile, err := cmd.Flags().GetString("exe")
+		if err != nil {
+			return fmt.Errorf("error getting exe flag: %w", err)
+		}
+		if (refsProfileFile == "") != (exeFile == "") {
+			return fmt.Errorf("--check-refs and --exe must be used together")
+		}
+		if refsProfileFile != "" {
+			refsProfile, err := pkg.LoadDialogueReferenceProfile(refsProfileFile)
+			if err != nil {
+				return err
+			}
+			encoder.SetReferenceCheck(exeFile, refsProfile)
+		}
+
+		// Everything the encoder reads changes the result, the fonts and palettes included
+		inputs := []string{inputFile, pkg.DefaultFontDir,
+			filepath.Join(filepath.Dir(inputFile), pkg.DefaultPaletteFile)}
+		for _, path := range []string{glyphsFrom, refsProfileFile, exeFile, alignBaseline, baselineOverridesFile} {
+			if path != "" {
+				inputs = append(inputs, path)
+			}
+		}
+		outputs := []string{outputFile}
+		if encodeMap != "" {
+			outputs = append(outputs, encodeMap)
+		}
+		if widthReport != "" {
+			outputs = append(outputs, widthReport)
+		}
+
+		return runStoredBuild(cmd, inputs, outputs, func() error {
+			// Extract decode archives so the YAML file sits next to its glyphs and palettes
+			inputFile, cleanup, err := pkg.OpenArchiveInput(inputFile, "dialogues.yaml")
+			if err != nil {
+				return fmt.Errorf("failed to open input archive: %w", err)
+			}
+			defer cleanup()
+
+			// Encode the YAML file to WFM format
+			if err := encoder.Encode(cmd.Context(), inputFile, outputFile); err != nil {
+				return fmt.Errorf("failed to encode WFM file: %w", err)
+			}
+
+			common.Println("WFM file encoded successfully!")
+			return nil
+		})
+	},
+}
+
+// decodeDoubleNewlineMode returns the DOUBLE_NEWLINE mode of the decode command: the
+// --double-newline flag, or the double_newline setting of the --profile game profile
+func decodeDoubleNewlineMode(cmd *cobra.Command) (string, error) {
+	doubleNewline, err := cmd.Flags().GetString("double-newline")
+	if err != nil {
+		return "", fmt.Errorf("error getting double-newline flag: %w", err)
+	}
+	if cmd.Flags().Changed("double-newline") {
+		return doubleNewline, nil
+	}
+
+	profile, err := loadFlagProfile(cmd)
+	if err != nil {
+		return "", err
+	}
+	common.LogDebug("Double newline mode %q from profile %s", profile.DoubleNewline, profile.Name)
+	return profile.DoubleNewline, nil
+}
+
+// loadFlagProfile loads the --profile game profile and declares its ignored characters
+func loadFlagProfile(cmd *cobra.Command) (*profiles.Profile, error) {
+	profileName, err := cmd.Flags().GetString("profile")
+	if err != nil {
+		return nil, fmt.Errorf("error getting profile flag: %w", err)
+	}
+	profile, err := profiles.Load(profileName, profiles.DefaultOverrideDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profile: %w", err)
+	}
+	// The marker characters of the profile draw no glyph in every command using it
+	if err := pkg.SetIgnoredCharacters(profile.IgnoredCharacters); err != nil {
+		return nil, fmt.Errorf("invalid profile %s: %w", profile.Name, err)
+	}
+	return profile, nil
+}
+
+// profileGlyphWidthLimits returns the glyph width limits of the --profile game profile
+func profileGlyphWidthLimits(cmd *cobra.Command) (pkg.GlyphWidthLimits, error) {
+	profile, err := loadFlagProfile(cmd)
+	if err != nil {
+		return nil, err
+	}
+	common.LogDebug("Glyph width limits %v from profile %s", profile.Constraints.MaxGlyphWidths, profile.Name)
+	return profile.Constraints.MaxGlyphWidths, nil
+}
+
+// getAlphaOptions reads the glyph transparency preprocessing flags of the encode command
+func getAlphaOptions(cmd *cobra.Command) (psx.AlphaOptions, bool, error) {
+	var options psx.AlphaOptions
+
+	threshold, err := cmd.Flags().GetUint8("alpha-threshold")
+	if err != nil {
+		return options, false, fmt.Errorf("error getting alpha-threshold flag: %w", err)
+	}
+	options.Threshold = threshold
+
+	matte, err := cmd.Flags().GetString("matte")
+	if err != nil {
+		return options, false, fmt.Errorf("error getting matte flag: %w", err)
+	}
+	if matte != "" {
+		matteColor, err := psx.ParseHexColor(matte)
+		if err != nil {
+			return options, false, err
+		}
+		options.Matte = &matteColor
+	}
+
+	options.Premultiplied, err = cmd.Flags().GetBool("premultiplied")
+	if err != nil {
+		return options, false, fmt.Errorf("error getting premultiplied flag: %w", err)
+	}
+
+	warnPartialAlpha, err := cmd.Flags().GetBool("warn-partial-alpha")
+	if err != nil {
+		return options, false, fmt.Errorf("error getting warn-partial-alpha flag: %w", err)
+	}
+
+	return options, warnPartialAlpha, nil
+}
+
+// wfmProgressCmd reports translation progress by comparing an original
+// dialogue YAML file against its translated counterpart.
+var wfmProgressCmd = &cobra.Command{
+	Use:   "progress [original.yaml] [translated.yaml]",
+	Short: "Report translation progress between two dialogue YAML files",
+	Long: `Report translation progress by comparing original and translated dialogue YAML files.
+
+Each dialogue is classified as:
+  untranslated    All text is identical to the original
+  partial         Some text is unchanged or contains placeholder markers (TODO, TBD, FIXME, ???)
+  complete        All text differs from the original and has no placeholders
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm progress original/dialogues.yaml translated/dialogues.yaml
+  tombatools wfm progress -f json -o progress.json original.yaml translated.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		originalFile := args[0]
+		translatedFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		// Compare both dialogue files
+		analyzer := pkg.NewProgressAnalyzer()
+		report, err := analyzer.Analyze(originalFile, translatedFile)
+		if err != nil {
+			return fmt.Errorf("failed to analyze translation progress: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteProgressReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write progress report: %w", err)
+		}
 
-		// Encode the YAML file to WFM format
-		if err := encoder.Encode(inputFile, outputFile); err != nil {
-			return fmt.Errorf("failed to encode WFM file: %w", err)
+		if outputFile != "" {
+			common.Printf("Progress report written to: %s\n", outputFile)
 		}
 
-		fmt.Println("WFM file encoded successfully!")
 		return nil
 	},
 }
 
-// init initializes the WFM command and its subcommands with appropriate flags.
-func init() {
-	// Register the WFM command with the root command
-	rootCmd.AddCommand(wfmCmd)
+// wfmPausesCmd reports pause durations and prompts in a dialogue YAML file
+// and optionally scales or caps every pause to change the text speed globally.
+var wfmPausesCmd = &cobra.Command{
+	Use:   "pauses [dialogues.yaml]",
+	Short: "Report and normalize [PAUSE FOR] durations in dialogue YAML files",
+	Long: `Report and normalize [PAUSE FOR] durations in a dialogue YAML file.
 
-	// Add subcommands to the WFM command
-	wfmCmd.AddCommand(wfmDecodeCmd)
-	wfmCmd.AddCommand(wfmEncodeCmd)
+The report lists pause statistics, the number of input prompts ([PROMPT],
+[WAIT FOR INPUT]) and outliers whose duration differs from the median by more
+than the outlier factor. Durations are read like the encoder reads them
+(integers, floats, hex and quoted numbers); durations it would reject are
+listed in the report and the command exits with code 4.
 
-	// Add verbose flag to decode command for detailed output
-	wfmDecodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+When --scale or --cap is given, every pause duration is rewritten and the
+result is saved to the file given by --write. Only pause durations change;
+text and other control codes are kept as they are.
 
-	// Add verbose flag to encode command for detailed output
-	wfmEncodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+Flags:
+  -f, --format          Report format: json or markdown (default: markdown)
+  -o, --output          Write the report to a file instead of stdout
+  --outlier-factor      Ratio to the median that marks an outlier (default: 3)
+  --scale               Multiply every pause duration by this factor
+  --cap                 Limit every pause duration to this value
+  --write               Output YAML file for normalized dialogues
+
+Examples:
+  tombatools wfm pauses dialogues.yaml
+  tombatools wfm pauses --scale 0.5 --write fast.yaml dialogues.yaml
+  tombatools wfm pauses --cap 30 --write capped.yaml dialogues.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		outlierFactor, err := cmd.Flags().GetFloat64("outlier-factor")
+		if err != nil {
+			return fmt.Errorf("error getting outlier-factor flag: %w", err)
+		}
+
+		scale, err := cmd.Flags().GetFloat64("scale")
+		if err != nil {
+			return fmt.Errorf("error getting scale flag: %w", err)
+		}
+
+		maxDuration, err := cmd.Flags().GetInt("cap")
+		if err != nil {
+			return fmt.Errorf("error getting cap flag: %w", err)
+		}
+
+		writeFile, err := cmd.Flags().GetString("write")
+		if err != nil {
+			return fmt.Errorf("error getting write flag: %w", err)
+		}
+
+		normalize := cmd.Flags().Changed("scale") || cmd.Flags().Changed("cap")
+		if normalize && writeFile == "" {
+			return fmt.Errorf("--write is required when using --scale or --cap")
+		}
+
+		analyzer := pkg.NewPauseAnalyzer()
+		analyzer.OutlierFactor = outlierFactor
+
+		// Report on the input file before any rewriting
+		report, err := analyzer.AnalyzeFile(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to analyze pauses: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WritePauseReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write pause report: %w", err)
+		}
+
+		if len(report.Invalid) > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d pause durations are not valid", len(report.Invalid)))
+		}
+
+		if normalize {
+			options := pkg.PauseNormalizeOptions{Scale: scale, MaxDuration: maxDuration}
+			changed, err := analyzer.NormalizeFile(inputFile, writeFile, options)
+			if err != nil {
+				return fmt.Errorf("failed to normalize pauses: %w", err)
+			}
+			common.LogInfo("Normalized %d pauses, written to: %s", changed, writeFile)
+		}
+
+		return nil
+	},
+}
+
+// wfmImportCmd converts legacy per-line script dumps from older fan
+// translations into the dialogues.yaml structure used by the encoder.
+var wfmImportCmd = &cobra.Command{
+	Use:   "import [script.txt] [output.yaml]",
+	Short: "Convert legacy Shift-JIS/Windows-1252 script dumps to dialogue YAML",
+	Long: `Convert a legacy per-line script dump into the dialogues.yaml structure.
+
+The source encoding (UTF-8, Shift-JIS or Windows-1252) is detected automatically
+unless --encoding is given.
+
+Script layout:
+  - Lines starting with # are comments
+  - Without @ markers, every non-empty line is one dialogue, numbered from 0
+  - With @ markers, "@12" starts dialogue 12 and the lines up to the next
+    marker are its text; a "---" line separates text items (boxes)
+
+Legacy control-code markup is converted with a YAML mapping file:
+  markup:
+    "<END>": "[HALT]"
+    "<W>": "[WAIT FOR INPUT]"
+
+Flags:
+  --encoding      Source encoding: auto, utf-8, shift-jis, windows-1252 (default: auto)
+  --mapping       YAML file mapping legacy markup to tombatools tags
+  --base          Existing dialogues.yaml to merge the imported text into
+  --font-height   Font height for dialogues not present in the base file (default: 16)
+
+Examples:
+  tombatools wfm import script.txt dialogues.yaml
+  tombatools wfm import --encoding shift-jis --mapping markup.yaml --base original.yaml script.txt imported.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scriptFile := args[0]
+		outputFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		sourceEncoding, err := cmd.Flags().GetString("encoding")
+		if err != nil {
+			return fmt.Errorf("error getting encoding flag: %w", err)
+		}
+
+		mappingFile, err := cmd.Flags().GetString("mapping")
+		if err != nil {
+			return fmt.Errorf("error getting mapping flag: %w", err)
+		}
+
+		baseFile, err := cmd.Flags().GetString("base")
+		if err != nil {
+			return fmt.Errorf("error getting base flag: %w", err)
+		}
+
+		fontHeight, err := cmd.Flags().GetInt("font-height")
+		if err != nil {
+			return fmt.Errorf("error getting font-height flag: %w", err)
+		}
+
+		// Create importer for legacy script conversion
+		importer := pkg.NewLegacyScriptImporter()
+		importer.Encoding = sourceEncoding
+		importer.FontHeight = fontHeight
+
+		if mappingFile != "" {
+			if err := importer.LoadMarkupMapping(mappingFile); err != nil {
+				return fmt.Errorf("failed to load markup mapping: %w", err)
+			}
+		}
+
+		common.Printf("Input script: %s\n", scriptFile)
+		common.Printf("Output YAML file: %s\n", outputFile)
+
+		count, err := importer.Import(scriptFile, baseFile, outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to import script: %w", err)
+		}
+
+		common.Printf("Imported %d dialogues successfully!\n", count)
+		return nil
+	},
+}
+
+// wfmUnmappedCmd summarizes the unmapped code dictionary built by decode and encode runs
+var wfmUnmappedCmd = &cobra.Command{
+	Use:   "unmapped [unmapped-codes.yaml]",
+	Short: "Summarize the unmapped codes recorded across runs",
+	Long: `Summarize the unmapped codes recorded by wfm decode and wfm encode.
+
+Every run records the [XXXX] glyph IDs without a font character and the unknown
+<XXXX> control codes of each file, with dialogue ID and count. Re-running a file
+replaces its previous occurrences. Add name and notes fields to the dictionary
+entries as codes are identified; they are kept across runs.
+
+Arguments:
+  unmapped-codes.yaml    Dictionary file (default: unmapped-codes.yaml)
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm unmapped
+  tombatools wfm unmapped -f json -o unmapped.json research/unmapped-codes.yaml`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dictionaryFile := pkg.DefaultUnmappedCodesFile
+		if len(args) == 1 {
+			dictionaryFile = args[0]
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		if _, err := os.Stat(dictionaryFile); err != nil {
+			return fmt.Errorf("failed to open unmapped codes file: %w", err)
+		}
+		dictionary, err := pkg.LoadUnmappedDictionary(dictionaryFile)
+		if err != nil {
+			return fmt.Errorf("failed to load unmapped codes: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteUnmappedReport(dictionary, format, writer); err != nil {
+			return fmt.Errorf("failed to write unmapped codes report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Unmapped codes report written to: %s\n", outputFile)
+		}
+
+		return nil
+	},
+}
+
+// wfmPalettesCmd reads the CLUTs referenced by the glyphs of a WFM file into the project palette file
+var wfmPalettesCmd = &cobra.Command{
+	Use:   "palettes [input_file] [project_directory]",
+	Short: "Discover the glyph CLUTs from a VRAM dump or the executable",
+	Long: `Read the CLUTs referenced by the GlyphClut values of a WFM file and store them
+in the project palette file (palettes.yaml), which decode and encode then use
+instead of the built-in dialogue and event palettes.
+
+Every GlyphClut value is a VRAM position, so a raw VRAM dump taken while the
+font is loaded provides all of them. Palettes stored in the executable are read
+from the file offsets given with --exe-palette, which take precedence over VRAM.
+Entries already in the palette file for other CLUT values are kept.
+
+Arguments:
+  input_file           WFM file whose glyph CLUTs are discovered
+  project_directory    Directory of the decode output (default: current directory)
+
+Flags:
+  --vram          Raw 1024x512 16-bit VRAM dump (1 MiB)
+  --exe           Executable containing the palettes
+  --exe-palette   CLUT=OFFSET pair locating a palette in the executable (repeatable)
+
+Examples:
+  tombatools wfm palettes --vram vram.bin CFNT999H.WFM ./output/
+  tombatools wfm palettes --exe SLUS_006.23 --exe-palette 0x7F3C=0x1A2B0 CFNT999H.WFM ./output/`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		projectDir := "."
+		if len(args) > 1 {
+			projectDir = args[1]
+		}
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		vramFile, err := cmd.Flags().GetString("vram")
+		if err != nil {
+			return fmt.Errorf("error getting vram flag: %w", err)
+		}
+
+		exeFile, err := cmd.Flags().GetString("exe")
+		if err != nil {
+			return fmt.Errorf("error getting exe flag: %w", err)
+		}
+
+		exePalettes, err := cmd.Flags().GetStringArray("exe-palette")
+		if err != nil {
+			return fmt.Errorf("error getting exe-palette flag: %w", err)
+		}
+
+		if vramFile == "" && exeFile == "" {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no palette source: use --vram and/or --exe"))
+		}
+
+		sources := pkg.PaletteSources{VRAMName: filepath.Base(vramFile), EXEName: filepath.Base(exeFile)}
+		if vramFile != "" {
+			if sources.VRAM, err = os.ReadFile(vramFile); err != nil {
+				return fmt.Errorf("failed to read VRAM dump: %w", err)
+			}
+		}
+		if exeFile != "" {
+			if sources.EXE, err = os.ReadFile(exeFile); err != nil {
+				return fmt.Errorf("failed to read executable: %w", err)
+			}
+		}
+		if sources.EXEOffsets, err = pkg.ParseEXEPaletteOffsets(exePalettes); err != nil {
+			return common.WithCategory(common.ErrCategoryValidationFailed, err)
+		}
+
+		if err := os.MkdirAll(projectDir, 0o750); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create project directory: %w", err))
+		}
+		paletteFile := filepath.Join(projectDir, pkg.DefaultPaletteFile)
+
+		processor := pkg.NewWFMProcessor()
+		set, missing, err := processor.DiscoverPalettes(inputFile, paletteFile, sources)
+		if err != nil {
+			return fmt.Errorf("failed to discover palettes: %w", err)
+		}
+
+		for _, clut := range missing {
+			common.LogWarn("No source for CLUT 0x%04X; the built-in palette is used for it", clut)
+		}
+		common.Printf("%d palettes written to: %s\n", len(set.Palettes), paletteFile)
+		return nil
+	},
+}
+
+// wfmProvenanceCmd reads back the provenance trailer written by encode --provenance
+var wfmProvenanceCmd = &cobra.Command{
+	Use:   "provenance [wfm_file]",
+	Short: "Show the build provenance embedded by encode --provenance",
+	Long: `Show the provenance trailer stored in the final padding of a WFM file encoded
+with --provenance: the tool version, the SHA-256 of the source YAML file and the
+encoding time. Compare the hash with your dialogue YAML files to find which
+build produced a distributed file.
+
+Example:
+  tombatools wfm provenance CFNT999H_modified.WFM`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		provenance, err := pkg.ReadProvenanceFile(args[0])
+		if err != nil {
+			return fmt.Errorf("failed to read provenance: %w", err)
+		}
+
+		common.Printf("Tool: %s %s\n", provenance.Tool, provenance.Version)
+		common.Printf("Source SHA-256: %s\n", provenance.SourceSHA256)
+		common.Printf("Created: %s\n", provenance.Created)
+		return nil
+	},
+}
+
+// wfmLintCmd checks a dialogue YAML file against the lint rules
+var wfmLintCmd = &cobra.Command{
+	Use:   "lint [dialogues.yaml]",
+	Short: "Check dialogue YAML files against the glossary, line and glyph widths and terminators",
+	Long: `Check a dialogue YAML file for translation consistency problems.
+
+The glossary rule reads a glossary file mapping source terms to their approved
+translation and flags dialogues using a listed non-approved variant (errors).
+When the original dialogue file is given, translated dialogues whose original
+contains a source term but which lack the approved translation are flagged too
+(warnings). Control tags are ignored, so terms split by [NEWLINE] still match.
+
+The line-width rule uses the widths metadata stored by wfm decode --widths and
+warns about lines wider than the widest line of the original dialogue.
+
+The glyph-width rule reads the fonts/ glyph PNG of every character used and
+flags characters whose glyph is wider than the max_glyph_widths limit of the
+dialogue font height in the --profile game profile (errors): the game renderer
+wraps wider glyphs in VRAM, corrupting the glyphs next to them, and encode
+refuses them.
+
+The terminator rule checks the terminator of every dialogue: continue returns
+control to the event script at once, halt once the box is closed. A dialogue
+ending with [PROMPT] must halt (error). A [HALT] right before a halt terminator
+is redundant, and a terminator changed from the original dialogue moves the
+point where the event script resumes (warnings).
+
+Glossary format:
+  terms:
+    - source: "Evil Pig"        # Term in the original text
+      approved: "Evil Pig"      # Approved translation
+      variants: ["Wicked Pig"]  # Non-approved translations to flag
+      case_sensitive: false
+
+The report groups issues by rule and term. The command fails (exit code 4)
+when errors are found, so it can gate a build.
+
+Flags:
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+  --glossary      Glossary file (default: glossary.yaml)
+  --original      Original dialogue YAML file for the missing-term and terminator checks
+  --profile       Game profile providing the glyph width limits (default: tomba)
+
+Examples:
+  tombatools wfm lint translated.yaml
+  tombatools wfm lint --glossary glossary.yaml --original original.yaml translated.yaml
+  tombatools wfm lint -f json -o lint.json translated.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		glossaryFile, err := cmd.Flags().GetString("glossary")
+		if err != nil {
+			return fmt.Errorf("error getting glossary flag: %w", err)
+		}
+
+		originalFile, err := cmd.Flags().GetString("original")
+		if err != nil {
+			return fmt.Errorf("error getting original flag: %w", err)
+		}
+
+		glossaryRule, err := pkg.LoadGlossaryRule(glossaryFile, originalFile)
+		if err != nil {
+			return fmt.Errorf("failed to load glossary rule: %w", err)
+		}
+
+		terminatorRule, err := pkg.LoadTerminatorRule(originalFile)
+		if err != nil {
+			return fmt.Errorf("failed to load terminator rule: %w", err)
+		}
+
+		glyphWidthLimits, err := profileGlyphWidthLimits(cmd)
+		if err != nil {
+			return err
+		}
+
+		linter := pkg.NewLinter(glossaryRule, pkg.NewLineWidthRule(), terminatorRule,
+			pkg.NewGlyphWidthRule(pkg.DefaultFontDir, glyphWidthLimits))
+		report, err := linter.Lint(inputFile)
+		if err != nil {
+			return fmt.Errorf("failed to lint dialogues: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteLintReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write lint report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Lint report written to: %s\n", outputFile)
+		}
+
+		if report.Errors > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d lint errors and %d warnings found", report.Errors, report.Warnings))
+		}
+		return nil
+	},
+}
+
+// wfmRenderCmd draws arbitrary text with the glyphs of a WFM font
+var wfmRenderCmd = &cobra.Command{
+	Use:   "render [wfm_file] [text] [output.png]",
+	Short: "Render arbitrary text with the glyphs of a WFM font",
+	Long: `Render a string with the glyphs of a WFM font to a PNG image, to preview
+translated text in the game font.
+
+Glyphs are mapped to characters with the reference fonts, the same way decode
+does. Lines end at "\n" and [PAGE]; other control tags are ignored. With
+--width, lines are wrapped at spaces to fit that many pixels. Characters without
+a glyph are left blank and reported as warnings.
+
+Flags:
+  --height     Font height of the glyphs to use (default: 16)
+  --width      Wrap lines to this many pixels (default: 0, no wrapping)
+  --fonts      Reference font directory (default: fonts)
+  --palettes   Project palette file (default: built-in CLUTs)
+
+Examples:
+  tombatools wfm render CFNT999H.WFM "Hello, Tomba!" hello.png
+  tombatools wfm render --width 200 --palettes output/palettes.yaml CFNT999H.WFM "A long translated line" preview.png`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		text := args[1]
+		outputFile := args[2]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		height, err := cmd.Flags().GetInt("height")
+		if err != nil {
+			return fmt.Errorf("error getting height flag: %w", err)
+		}
+
+		width, err := cmd.Flags().GetInt("width")
+		if err != nil {
+			return fmt.Errorf("error getting width flag: %w", err)
+		}
+
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+
+		paletteFile, err := cmd.Flags().GetString("palettes")
+		if err != nil {
+			return fmt.Errorf("error getting palettes flag: %w", err)
+		}
+
+		renderer, err := pkg.LoadTextRenderer(inputFile, fontDir)
+		if err != nil {
+			return fmt.Errorf("failed to load font: %w", err)
+		}
+		if paletteFile != "" {
+			palettes, err := pkg.LoadPaletteSet(paletteFile)
+			if err != nil {
+				return fmt.Errorf("failed to load palettes: %w", err)
+			}
+			renderer.SetPalettes(palettes)
+		}
+
+		img, err := renderer.RenderString(text, height, width)
+		if err != nil {
+			return fmt.Errorf("failed to render text: %w", err)
+		}
+
+		file, err := common.CreateOutput(outputFile)
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create PNG file: %w", err))
+		}
+		defer file.Close()
+
+		if err := png.Encode(file, img); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode PNG: %w", err))
+		}
+
+		common.Printf("Rendered text written to: %s\n", outputFile)
+		return nil
+	},
+}
+
+// wfmShotdiffCmd compares an emulator screenshot of a text box with the expected rendering
+var wfmShotdiffCmd = &cobra.Command{
+	Use:   "shotdiff [wfm_file] [dialogues.yaml] [dialogue_id] [screenshot.png] [diff.png]",
+	Short: "Compare an emulator screenshot of a text box with the expected rendering",
+	Long: `Render a text box of a dialogue with the glyphs of a WFM font, align it with an
+emulator screenshot of that box and write a diff image, to check that the game
+draws the text exactly as the tools expect.
+
+The screenshot background is its most common color; pixels farther from it than
+--tolerance count as drawn. The expected box is placed where the fewest pixels
+differ unless --offset is given. In the diff image, white pixels are drawn in both
+images, red ones only in the expected box and green ones only in the screenshot.
+Characters whose cells differ are listed, and the command fails when any pixel
+differs.
+
+Flags:
+  --box        Text box of the dialogue, from 0 (default: 0)
+  --scale      Integer upscaling of the emulator output (default: 1)
+  --width      Wrap lines to this many pixels (default: 0, no wrapping)
+  --tolerance  Color distance from the background counted as drawn (default: 48)
+  --offset     Position of the text in the screenshot as x,y (default: searched)
+  --fonts      Reference font directory (default: fonts)
+  --palettes   Project palette file (default: built-in CLUTs)
+
+Examples:
+  tombatools wfm shotdiff CFNT999H.WFM translated.yaml 12 shot.png diff.png
+  tombatools wfm shotdiff --scale 2 --box 1 CFNT999H.WFM translated.yaml 12 shot.png diff.png`,
+	Args: cobra.ExactArgs(5),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		yamlFile := args[1]
+		screenshotFile := args[3]
+		outputFile := args[4]
+
+		dialogueID, err := strconv.Atoi(args[2])
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid dialogue ID %q: %w", args[2], err))
+		}
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		var options pkg.ScreenshotDiffOptions
+		if options.Box, err = cmd.Flags().GetInt("box"); err != nil {
+			return fmt.Errorf("error getting box flag: %w", err)
+		}
+		if options.Scale, err = cmd.Flags().GetInt("scale"); err != nil {
+			return fmt.Errorf("error getting scale flag: %w", err)
+		}
+		if options.Width, err = cmd.Flags().GetInt("width"); err != nil {
+			return fmt.Errorf("error getting width flag: %w", err)
+		}
+		if options.Tolerance, err = cmd.Flags().GetInt("tolerance"); err != nil {
+			return fmt.Errorf("error getting tolerance flag: %w", err)
+		}
+
+		offset, err := cmd.Flags().GetIntSlice("offset")
+		if err != nil {
+			return fmt.Errorf("error getting offset flag: %w", err)
+		}
+		if len(offset) > 0 {
+			if len(offset) != 2 {
+				return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("--offset takes x,y, got %v", offset))
+			}
+			options.Offset = &image.Point{X: offset[0], Y: offset[1]}
+		}
+
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+
+		paletteFile, err := cmd.Flags().GetString("palettes")
+		if err != nil {
+			return fmt.Errorf("error getting palettes flag: %w", err)
+		}
+
+		renderer, err := pkg.LoadTextRenderer(inputFile, fontDir)
+		if err != nil {
+			return fmt.Errorf("failed to load font: %w", err)
+		}
+		if paletteFile != "" {
+			palettes, err := pkg.LoadPaletteSet(paletteFile)
+			if err != nil {
+				return fmt.Errorf("failed to load palettes: %w", err)
+			}
+			renderer.SetPalettes(palettes)
+		}
+
+		dialogue, err := pkg.LoadDialogue(yamlFile, dialogueID)
+		if err != nil {
+			return fmt.Errorf("failed to load dialogue: %w", err)
+		}
+
+		screenshotReader, err := os.Open(screenshotFile)
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open screenshot: %w", err))
+		}
+		screenshot, err := png.Decode(screenshotReader)
+		screenshotReader.Close()
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to decode screenshot: %w", err))
+		}
+
+		report, err := renderer.CompareScreenshot(*dialogue, screenshot, options)
+		if err != nil {
+			return fmt.Errorf("failed to compare screenshot: %w", err)
+		}
+
+		file, err := common.CreateOutput(outputFile)
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create PNG file: %w", err))
+		}
+		defer file.Close()
+
+		if err := png.Encode(file, report.Diff); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode PNG: %w", err))
+		}
+
+		common.Printf("Dialogue %d box %d aligned at %d,%d: %d of %d pixels differ\n",
+			report.DialogueID, report.Box, report.OffsetX, report.OffsetY, report.Mismatched, report.Pixels)
+		for _, glyph := range report.Glyphs {
+			common.Printf("  line %d x %d '%s': %d pixels differ\n", glyph.Line, glyph.X, glyph.Char, glyph.Pixels)
+		}
+		common.Printf("Diff image written to: %s\n", outputFile)
+
+		if !report.Matches() {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d characters differ from the screenshot", len(report.Glyphs)))
+		}
+		return nil
+	},
+}
+
+// wfmStatsCmd summarizes the sections of a WFM file and reports its free space
+var wfmStatsCmd = &cobra.Command{
+	Use:   "stats [wfm_file]",
+	Short: "Summarize a WFM file and report the space free for new content",
+	Long: `Summarize the glyphs and dialogues of an original WFM file.
+
+With --space the unused ranges between sections are listed: alignment padding, bytes
+no pointer reaches and the final padding. Encoding packs every section back to back
+and pads to the original size, so the report also shows how many extra bytes new
+dialogues and glyphs can take without growing the file, and so without changing the
+FLA table of the disc image.
+
+Flags:
+      --space     Analyze padding and pointer gaps for free space
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm stats CFNT999H.WFM
+  tombatools wfm stats --space -f json -o space.json CFNT999H.WFM`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		space, err := cmd.Flags().GetBool("space")
+		if err != nil {
+			return fmt.Errorf("error getting space flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		stats, err := pkg.AnalyzeWFMFile(args[0], space)
+		if err != nil {
+			return fmt.Errorf("failed to analyze WFM file: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteWFMStats(stats, format, writer); err != nil {
+			return fmt.Errorf("failed to write stats report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Stats report written to: %s\n", outputFile)
+		}
+
+		return nil
+	},
+}
+
+// wfmSelftestCmd decodes and encodes again every WFM file of a local corpus and reports
+// the bytes that differ from the originals
+var wfmSelftestCmd = &cobra.Command{
+	Use:   "selftest",
+	Short: "Check that every WFM file of a corpus encodes back byte for byte",
+	Long: `Decode every .WFM file found below the corpus directory (for example the files
+extracted from your own disc images), encode it again and compare the result with
+the original. Differing bytes are attributed to the section of the original file
+they fall in: header, glyph pointer table, glyph N, dialogue pointer table,
+dialogue N, gap (bytes no pointer reaches), padding or size.
+
+Glyph records are taken from the original file, so the round trip covers the
+dialogue streams, the header, the pointer tables, the layout and the final padding.
+Nothing is written next to the corpus; game data never leaves your machine.
+The command fails when any file differs or cannot be decoded.
+
+Flags:
+      --corpus    Directory searched recursively for .WFM files (required)
+  -f, --format    Report format: json or markdown (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm selftest --corpus ./dumps/
+  tombatools wfm selftest --corpus ./dumps/ -f json -o selftest.json`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		corpus, err := cmd.Flags().GetString("corpus")
+		if err != nil {
+			return fmt.Errorf("error getting corpus flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		report, err := pkg.SelfTestWFMCorpus(cmd.Context(), corpus)
+		if err != nil {
+			return fmt.Errorf("failed to self-test corpus: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteWFMSelfTestReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write self-test report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Self-test report written to: %s\n", outputFile)
+		}
+
+		if !report.OK() {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("self-test found %d differing and %d failed file(s) in %s", report.Different, report.Failed, corpus))
+		}
+
+		return nil
+	},
+}
+
+// wfmRemapCmd assigns slots to the new dialogues of a dialogue YAML file and reports the
+// slot of every named dialogue
+var wfmRemapCmd = &cobra.Command{
+	Use:   "remap [dialogues.yaml]",
+	Short: "Append new dialogues after the decoded ones and list the slot of every named dialogue",
+	Long: `Give brand-new dialogues of an extended translation a slot after the decoded ones.
+
+The executable selects dialogues by their slot in the WFM pointer table, so new
+dialogues are never inserted between existing ones. Add them anywhere in the YAML
+with a logical name and a negative ID:
+
+  - id: -1
+    name: shop_extra_hint
+    ...
+
+The remap gives every new dialogue the next free slot after the decoded
+(total_dialogues) and previously appended dialogues, sorts the dialogues by ID
+and reports the slot of every named dialogue, to be wired into the executable.
+It fails when a decoded dialogue is missing or duplicated, when a dialogue
+appended by an earlier remap would move, or when names are missing or repeated.
+
+With --check-refs, the dialogue indices hardcoded in the executable are checked
+against the remapped dialogues as encode --check-refs does, and the command fails
+when a referenced slot is gone or holds another dialogue.
+
+Flags:
+  -f, --format      Report format: json or markdown (default: markdown)
+  -o, --output      Write the report to a file instead of stdout
+  --write           Output YAML file for the remapped dialogues
+  --check-refs      Reference profile locating the dialogue indices in the executable
+  --exe             Executable scanned by --check-refs (e.g. MAIN0.EXE)
+  --wfm             WFM file name the references are configured for (e.g. CFNT999H.WFM)
+
+Examples:
+  tombatools wfm remap translated.yaml
+  tombatools wfm remap --write remapped.yaml -f json -o slots.json translated.yaml
+  tombatools wfm remap --check-refs refs.yaml --exe MAIN0.EXE --wfm CFNT999H.WFM translated.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		writeFile, err := cmd.Flags().GetString("write")
+		if err != nil {
+			return fmt.Errorf("error getting write flag: %w", err)
+		}
+
+		refsProfileFile, err := cmd.Flags().GetString("check-refs")
+		if err != nil {
+			return fmt.Errorf("error getting check-refs flag: %w", err)
+		}
+		exeFile, err := cmd.Flags().GetString("exe")
+		if err != nil {
+			return fmt.Errorf("error getting exe flag: %w", err)
+		}
+		wfmFile, err := cmd.Flags().GetString("wfm")
+		if err != nil {
+			return fmt.Errorf("error getting wfm flag: %w", err)
+		}
+		if (refsProfileFile == "") != (exeFile == "") || (refsProfileFile == "") != (wfmFile == "") {
+			return fmt.Errorf("--check-refs, --exe and --wfm must be used together")
+		}
+
+		remapper := pkg.NewDialogueRemapper()
+		if refsProfileFile != "" {
+			refsProfile, err := pkg.LoadDialogueReferenceProfile(refsProfileFile)
+			if err != nil {
+				return err
+			}
+			remapper.SetReferenceCheck(exeFile, wfmFile, refsProfile)
+		}
+
+		report, err := remapper.RemapFile(inputFile, writeFile)
+		if err != nil {
+			return fmt.Errorf("failed to remap dialogues: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteDialogueRemapReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write remap report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Remap report written to: %s\n", outputFile)
+		}
+		if writeFile != "" {
+			common.LogInfo("Assigned %d new dialogue slots, written to: %s", report.Assigned, writeFile)
+		}
+
+		if len(report.Problems) > 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%d stale dialogue reference(s) in %s", len(report.Problems), exeFile))
+		}
+
+		return nil
+	},
+}
+
+// wfmOpcodesCmd clusters the undecoded control codes of WFM files into hypotheses
+var wfmOpcodesCmd = &cobra.Command{
+	Use:   "opcodes [wfm_files...]",
+	Short: "Propose argument counts for undecoded control codes",
+	Long: `Collect the undecoded 0xC0xx and 0xFFxx codes (those missing from the control
+code table) across every dialogue of the given WFM files and propose a hypothesis
+for each one:
+
+  likely args  The most frequent number of parameter words (values below the
+               glyph range) following the code, with the share of occurrences
+               that agree as confidence
+  neighbours   The codes, glyphs or dialogue boundaries before and after it
+  positions    Where it appears: before the text (start), after NEWLINE
+               (line-start), between glyphs (inline) or after the text (end)
+
+With -f yaml the hypotheses are written as controlcodes.yaml entries, ready to be
+reviewed and merged into the control code table.
+
+Flags:
+  -f, --format    Report format: json, markdown or yaml (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm opcodes CFNT999H.WFM
+  tombatools wfm opcodes -f yaml -o hypotheses.yaml *.WFM`,
+	Args: cobra.MinimumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		report, err := pkg.DiscoverOpcodes(args)
+		if err != nil {
+			return fmt.Errorf("failed to analyze opcodes: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create report file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteOpcodeReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write opcode report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Opcode report written to: %s\n", outputFile)
+		}
+
+		return nil
+	},
+}
+
+// wfmGraphCmd exports the flow between the dialogues of a YAML file as a graph
+var wfmGraphCmd = &cobra.Command{
+	Use:   "graph [dialogues.yaml]",
+	Short: "Export the dialogue flow of the overlay events as a Graphviz or JSON graph",
+	Long: `Export the flow between the dialogues of a YAML file as a graph whose nodes are
+the dialogue IDs.
+
+The text of a dialogue holds no jump targets: [PROMPT] takes no argument and the
+event script reads the answer once the dialogue ends. The edges come from the
+event mappings written by ovl dump instead:
+
+  trigger  An event record to the dialogue it triggers
+  next     A dialogue to the one the next record of the same event triggers
+  branch   A [PROMPT] dialogue to every later dialogue of the same event, up to
+           the next [PROMPT]: the answer selects which one is shown, so these
+           answers have no next edges between them
+
+Dialogues no event reaches are listed as unreachable (drawn in red), and dialogue
+slots triggered by events but absent from the YAML file as missing. Without
+--events the graph holds the dialogues only.
+
+Flags:
+  --events        Event mapping written by ovl dump (repeatable)
+  -f, --format    Graph format: dot or json (default: dot)
+  -o, --output    Write the graph to a file instead of stdout
+
+Examples:
+  tombatools wfm graph --events events01.yaml dialogues.yaml | dot -Tsvg -o flow.svg
+  tombatools wfm graph --events events01.yaml --events events02.yaml -f json -o flow.json dialogues.yaml`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dialoguesFile := args[0]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		eventFiles, err := cmd.Flags().GetStringArray("events")
+		if err != nil {
+			return fmt.Errorf("error getting events flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		graph, err := pkg.BuildDialogueFlowGraph(dialoguesFile, eventFiles)
+		if err != nil {
+			return fmt.Errorf("failed to build dialogue flow graph: %w", err)
+		}
+
+		// Write graph to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return fmt.Errorf("failed to create graph file: %w", err)
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteDialogueFlowGraph(graph, format, writer); err != nil {
+			return fmt.Errorf("failed to write dialogue flow graph: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Dialogue flow graph written to: %s\n", outputFile)
+			common.Printf("Dialogues: %d, events: %d, edges: %d\n", len(graph.Nodes), len(graph.Events), len(graph.Edges))
+			if len(eventFiles) > 0 {
+				common.Printf("Unreachable dialogues: %d, missing dialogues: %d\n", len(graph.Unreachable), len(graph.Missing))
+			}
+		}
+
+		return nil
+	},
+}
+
+// wfmMTCmd sends untranslated dialogues to a machine translation backend and stores
+// the results as drafts in the translated dialogue YAML file.
+var wfmMTCmd = &cobra.Command{
+	Use:   "mt [original.yaml] [translated.yaml]",
+	Short: "Fill drafts of untranslated dialogues from a machine translation backend",
+	Long: `Send the untranslated dialogues of a translated dialogue YAML file to a machine
+translation backend and store the results as drafts.
+
+A dialogue is untranslated when all its text is identical to the original, as
+reported by wfm progress. Its text items are posted to the backend URL as JSON:
+  {"source": "en", "target": "pt", "texts": ["...", "..."]}
+and the backend answers with one translation per text:
+  {"translations": ["...", "..."]}
+Control tags and symbols are replaced by {0}, {1}... tokens before sending and
+restored in the drafts.
+
+Drafts are written under the dialogue's drafts key, by target language. The
+encoder ignores them: review a draft and move its text into the content. A draft
+whose estimated encoded size exceeds the dialogue's byte budget, or that lost a
+control code, lists the reason under attention.
+
+Flags:
+  --url               MT backend endpoint (required)
+  --api-key           Bearer token sent to the backend (default: $TOMBATOOLS_MT_API_KEY)
+  --source            Language of the original dialogues (default: en)
+  --target            Language of the drafts (required)
+  --budget            Draft size allowed, in percent of the original text size (default: 100)
+  --limit             Maximum number of dialogues to send (0 sends all)
+  --overwrite         Replace existing drafts of the target language
+  --timeout           Time allowed for each backend request
+  --write             Output YAML file (default: overwrite translated.yaml)
+
+Examples:
+  tombatools wfm mt --url http://localhost:5000/translate --target pt original.yaml translated.yaml
+  tombatools wfm mt --url http://localhost:5000/translate --target es --budget 120 --write draft.yaml original.yaml translated.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		originalFile := args[0]
+		translatedFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		url, err := cmd.Flags().GetString("url")
+		if err != nil {
+			return fmt.Errorf("error getting url flag: %w", err)
+		}
+
+		apiKey, err := cmd.Flags().GetString("api-key")
+		if err != nil {
+			return fmt.Errorf("error getting api-key flag: %w", err)
+		}
+		if apiKey == "" {
+			apiKey = os.Getenv("TOMBATOOLS_MT_API_KEY")
+		}
+
+		var options pkg.MTOptions
+		if options.Source, err = cmd.Flags().GetString("source"); err != nil {
+			return fmt.Errorf("error getting source flag: %w", err)
+		}
+		if options.Target, err = cmd.Flags().GetString("target"); err != nil {
+			return fmt.Errorf("error getting target flag: %w", err)
+		}
+		if options.BudgetPercent, err = cmd.Flags().GetInt("budget"); err != nil {
+			return fmt.Errorf("error getting budget flag: %w", err)
+		}
+		if options.Limit, err = cmd.Flags().GetInt("limit"); err != nil {
+			return fmt.Errorf("error getting limit flag: %w", err)
+		}
+		if options.Overwrite, err = cmd.Flags().GetBool("overwrite"); err != nil {
+			return fmt.Errorf("error getting overwrite flag: %w", err)
+		}
+
+		timeout, err := cmd.Flags().GetDuration("timeout")
+		if err != nil {
+			return fmt.Errorf("error getting timeout flag: %w", err)
+		}
+
+		writeFile, err := cmd.Flags().GetString("write")
+		if err != nil {
+			return fmt.Errorf("error getting write flag: %w", err)
+		}
+		if writeFile == "" {
+			writeFile = translatedFile
+		}
+
+		translator := pkg.NewMachineTranslator(pkg.NewHTTPMTBackend(url, apiKey, timeout))
+		report, err := translator.TranslateFile(originalFile, translatedFile, writeFile, options)
+		if err != nil {
+			return fmt.Errorf("failed to translate dialogues: %w", err)
+		}
+
+		common.LogInfo("Drafted %d of %d untranslated dialogues (%d already drafted), written to: %s",
+			report.Translated, report.Untranslated, report.Skipped, writeFile)
+		for _, id := range report.OverBudget {
+			common.LogWarn("Dialogue %d: draft is over its byte budget", id)
+		}
+		for _, id := range report.CodesLost {
+			common.LogWarn("Dialogue %d: draft lost control codes of the original", id)
+		}
+
+		return nil
+	},
+}
+
+// wfmMeasureCmd measures how much text fits on a line at every font height of a WFM
+// font and predicts the dialogue pages that overflow, for wrap planning.
+var wfmMeasureCmd = &cobra.Command{
+	Use:   "measure [wfm_file] [dialogues.yaml]",
+	Short: "Report characters per line by font height and predict line overflows",
+	Long: `Measure how much text fits on a line with the glyphs of a WFM font.
+
+Glyphs are mapped to characters with the reference fonts, the same way decode
+does. For every font height, the line width is the widest line of the original
+dialogues of that height in the WFM file (or --width), and the report lists how
+many characters fit on it for:
+  - the widest and narrowest glyph
+  - the average character, weighted by how often the dialogues use it
+  - every --sample string, repeated as needed
+
+With a dialogue YAML file, every text box page (a box item or [PAGE] starts a
+new one) is measured: lines, characters and the width of its widest line. Pages
+wider than their line width are predicted to overflow; a dialogue decoded with
+--widths is held to its own widest original line instead. The report includes a
+histogram of the page lengths of every font height. The CSV format writes one
+row per page, for spreadsheets.
+
+Flags:
+      --width     Line width in pixels (default: widest original line per height)
+      --sample    Representative string to measure (repeatable)
+      --fonts     Reference font directory (default: fonts)
+  -f, --format    Report format: json, markdown or csv (default: markdown)
+  -o, --output    Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm measure CFNT999H.WFM
+  tombatools wfm measure --sample "Tomba jumps!" CFNT999H.WFM translated.yaml
+  tombatools wfm measure -f csv -o measure.csv CFNT999H.WFM translated.yaml`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		inputFile := args[0]
+		yamlFile := ""
+		if len(args) > 1 {
+			yamlFile = args[1]
+		}
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		width, err := cmd.Flags().GetInt("width")
+		if err != nil {
+			return fmt.Errorf("error getting width flag: %w", err)
+		}
+
+		samples, err := cmd.Flags().GetStringArray("sample")
+		if err != nil {
+			return fmt.Errorf("error getting sample flag: %w", err)
+		}
+
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		report, err := pkg.MeasureTextFiles(inputFile, yamlFile, fontDir, pkg.TextMeasureOptions{Width: width, Samples: samples})
+		if err != nil {
+			return fmt.Errorf("failed to measure text: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteTextMeasureReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write measurement report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Measurement report written to: %s\n", outputFile)
+		}
+		return nil
+	},
+}
+
+// wfmBaselineCmd compares the glyph ink rows of an encode with the original font and
+// lists the shifts encode --align-baseline applies
+var wfmBaselineCmd = &cobra.Command{
+	Use:   "baseline [original.wfm] [dialogues.yaml]",
+	Short: "Compare glyph ink rows with the original font and preview the baseline shifts",
+	Long: `Compare the vertical ink bounds of the glyphs an encode would load from the
+fonts/ PNG tree with an original WFM file, and list the shift encode
+--align-baseline would apply to each glyph.
+
+Text of mixed font heights (event captions next to dialogue) is misaligned when
+new glyphs are not drawn at the height of the originals. For every glyph used
+by the dialogues:
+  - a character of the original font (mapped with the reference fonts, the
+    same way decode does) is moved so that its last inked row matches its
+    original glyph
+  - the other characters of a font height are moved together, so that the
+    bottom row most of them share lands on the original baseline (the bottom
+    row most original glyphs of that height share); descenders keep their
+    depth below the baseline
+  - an override replaces both
+Glyphs only move within their blank rows; larger shifts are clamped.
+
+The overrides file lists per-character shifts in rows (positive moves down);
+height 0 or no height applies to every font height:
+
+  overrides:
+    - character: "j"
+      shift: 1
+    - character: "Q"
+      height: 24
+      shift: -1
+
+Flags:
+      --fonts      Reference font directory mapping original glyphs (default: fonts)
+      --overrides  Per-character shifts file
+  -f, --format     Report format: json or markdown (default: markdown)
+  -o, --output     Write the report to a file instead of stdout
+
+Examples:
+  tombatools wfm baseline CFNT999H.WFM translated.yaml
+  tombatools wfm baseline --fonts pristine/fonts CFNT999H.WFM translated.yaml
+  tombatools wfm baseline --overrides baseline.yaml -f json -o baseline.json CFNT999H.WFM translated.yaml`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		originalFile := args[0]
+		yamlFile := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		fontDir, err := cmd.Flags().GetString("fonts")
+		if err != nil {
+			return fmt.Errorf("error getting fonts flag: %w", err)
+		}
+
+		overridesFile, err := cmd.Flags().GetString("overrides")
+		if err != nil {
+			return fmt.Errorf("error getting overrides flag: %w", err)
+		}
+
+		format, err := cmd.Flags().GetString("format")
+		if err != nil {
+			return fmt.Errorf("error getting format flag: %w", err)
+		}
+
+		outputFile, err := cmd.Flags().GetString("output")
+		if err != nil {
+			return fmt.Errorf("error getting output flag: %w", err)
+		}
+
+		var overrides *pkg.GlyphBaselineOverrides
+		if overridesFile != "" {
+			if overrides, err = pkg.LoadGlyphBaselineOverrides(overridesFile); err != nil {
+				return err
+			}
+		}
+
+		report, err := pkg.AnalyzeGlyphBaselines(originalFile, yamlFile, fontDir, overrides)
+		if err != nil {
+			return fmt.Errorf("failed to analyze glyph baselines: %w", err)
+		}
+
+		// Write report to stdout or to the requested file
+		var writer io.Writer = os.Stdout
+		if outputFile != "" {
+			file, err := common.CreateOutput(outputFile)
+			if err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create report file: %w", err))
+			}
+			defer file.Close()
+			writer = file
+		}
+
+		if err := pkg.WriteGlyphBaselineReport(report, format, writer); err != nil {
+			return fmt.Errorf("failed to write baseline report: %w", err)
+		}
+
+		if outputFile != "" {
+			common.Printf("Baseline report written to: %s\n", outputFile)
+		}
+		return nil
+	},
+}
+
+// wfmFonttoolCmd groups the batch transforms of glyph PNG trees
+var wfmFonttoolCmd = &cobra.Command{
+	Use:   "fonttool",
+	Short: "Scale, shift or trim every glyph PNG of a font directory",
+	Long: `Apply a geometric transform to every glyph PNG below a directory (such as
+fonts/16), so global font tweaks do not require re-exporting every glyph from
+an image editor.
+
+Pixels are copied by nearest neighbor, never blended, and indexed PNGs keep
+their palette and color indices, so glyphs quantize to the same 4bpp colors
+on encode. Uncovered pixels are transparent.
+
+The glyphs are replaced in place (unchanged glyphs are left alone) unless
+--output gives a directory for the transformed tree.
+
+Commands:
+  scale   Resize every glyph by a factor
+  shift   Move the pixels of every glyph within its bounds
+  trim    Cut the blank columns around the ink of every glyph
+
+Examples:
+  tombatools wfm fonttool shift fonts/16 --dx 1
+  tombatools wfm fonttool scale --sx 0.75 --sy 0.75 -o fonts/12 fonts/16
+  tombatools wfm fonttool trim --spacing 1 --dry-run fonts/16`,
+}
+
+// wfmFonttoolScaleCmd resizes every glyph of a tree
+var wfmFonttoolScaleCmd = &cobra.Command{
+	Use:   "scale [glyph_directory]",
+	Short: "Resize every glyph PNG by a factor",
+	Long: `Resize every glyph PNG below a directory by nearest neighbor. The new size is
+the original size times the factor, rounded, and at least one pixel.
+
+Flags:
+  -v, --verbose  Enable verbose output (show debug messages)
+      --sx       Horizontal factor (default: 1)
+      --sy       Vertical factor (default: 1)
+  -o, --output   Write the transformed tree to this directory
+      --dry-run  List the changes without writing anything
+
+Examples:
+  tombatools wfm fonttool scale --sx 2 --sy 2 -o fonts/32 fonts/16
+  tombatools wfm fonttool scale --sx 0.75 --sy 0.75 -o fonts/12 fonts/16`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		scaleX, err := cmd.Flags().GetFloat64("sx")
+		if err != nil {
+			return fmt.Errorf("error getting sx flag: %w", err)
+		}
+		scaleY, err := cmd.Flags().GetFloat64("sy")
+		if err != nil {
+			return fmt.Errorf("error getting sy flag: %w", err)
+		}
+		return runFontTransform(cmd, args[0], pkg.FontTransform{Operation: pkg.FontTransformScale, ScaleX: scaleX, ScaleY: scaleY})
+	},
+}
+
+// wfmFonttoolShiftCmd moves the pixels of every glyph of a tree
+var wfmFonttoolShiftCmd = &cobra.Command{
+	Use:   "shift [glyph_directory]",
+	Short: "Move the pixels of every glyph PNG within its bounds",
+	Long: `Move the pixels of every glyph PNG below a directory by whole pixels. Glyph
+sizes do not change: pixels moved out of a glyph are lost.
+
+Flags:
+  -v, --verbose  Enable verbose output (show debug messages)
+      --dx       Columns to move, positive moves right
+      --dy       Rows to move, positive moves down
+  -o, --output   Write the transformed tree to this directory
+      --dry-run  List the changes without writing anything
+
+Examples:
+  tombatools wfm fonttool shift fonts/16 --dx 1
+  tombatools wfm fonttool shift --dy -1 fonts/24/lowercase`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dx, err := cmd.Flags().GetInt("dx")
+		if err != nil {
+			return fmt.Errorf("error getting dx flag: %w", err)
+		}
+		dy, err := cmd.Flags().GetInt("dy")
+		if err != nil {
+			return fmt.Errorf("error getting dy flag: %w", err)
+		}
+		return runFontTransform(cmd, args[0], pkg.FontTransform{Operation: pkg.FontTransformShift, DX: dx, DY: dy})
+	},
+}
+
+// wfmFonttoolTrimCmd cuts the blank columns of every glyph of a tree
+var wfmFonttoolTrimCmd = &cobra.Command{
+	Use:   "trim [glyph_directory]",
+	Short: "Cut the blank columns around the ink of every glyph PNG",
+	Long: `Cut the fully transparent columns on both sides of every glyph PNG below a
+directory, then leave --spacing blank columns after the last inked column.
+Glyph widths are the advance of the text, so this evens out the letter
+spacing of a font. Blank glyphs (spaces) are left alone.
+
+Flags:
+  -v, --verbose  Enable verbose output (show debug messages)
+      --spacing  Blank columns left after the ink (default: 0)
+  -o, --output   Write the transformed tree to this directory
+      --dry-run  List the changes without writing anything
+
+Examples:
+  tombatools wfm fonttool trim --spacing 1 fonts/16
+  tombatools wfm fonttool trim --spacing 1 --dry-run -v fonts/16`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		spacing, err := cmd.Flags().GetInt("spacing")
+		if err != nil {
+			return fmt.Errorf("error getting spacing flag: %w", err)
+		}
+		return runFontTransform(cmd, args[0], pkg.FontTransform{Operation: pkg.FontTransformTrim, Spacing: spacing})
+	},
+}
+
+// runFontTransform applies a transform to a glyph tree with the shared fonttool flags
+func runFontTransform(cmd *cobra.Command, glyphDir string, transform pkg.FontTransform) error {
+	// Enable verbose mode if requested
+	verbose, err := cmd.Flags().GetBool("verbose")
+	if err != nil {
+		return fmt.Errorf("error getting verbose flag: %w", err)
+	}
+	common.SetVerboseMode(verbose)
+
+	outputDir, err := cmd.Flags().GetString("output")
+	if err != nil {
+		return fmt.Errorf("error getting output flag: %w", err)
+	}
+
+	dryRun, err := cmd.Flags().GetBool("dry-run")
+	if err != nil {
+		return fmt.Errorf("error getting dry-run flag: %w", err)
+	}
+
+	report, err := pkg.TransformGlyphTree(cmd.Context(), glyphDir, outputDir, transform, dryRun)
+	if err != nil {
+		return fmt.Errorf("failed to %s glyphs: %w", transform.Operation, err)
+	}
+
+	switch {
+	case dryRun:
+		common.Printf("Would change %d of %d glyphs in %s\n", report.Changed, len(report.Files), glyphDir)
+	case outputDir != "":
+		common.Printf("Wrote %d glyphs (%d changed) to %s\n", len(report.Files), report.Changed, outputDir)
+	default:
+		common.Printf("Changed %d of %d glyphs in %s\n", report.Changed, len(report.Files), glyphDir)
+	}
+	return nil
+}
+
+// init initializes the WFM command and its subcommands with appropriate flags.
+func init() {
+	// Register the WFM command with the root command
+	rootCmd.AddCommand(wfmCmd)
+
+	// Add subcommands to the WFM command
+	wfmCmd.AddCommand(wfmDecodeCmd)
+	wfmCmd.AddCommand(wfmEncodeCmd)
+	wfmCmd.AddCommand(wfmProgressCmd)
+	wfmCmd.AddCommand(wfmPausesCmd)
+	wfmCmd.AddCommand(wfmImportCmd)
+	wfmCmd.AddCommand(wfmUnmappedCmd)
+	wfmCmd.AddCommand(wfmPalettesCmd)
+	wfmCmd.AddCommand(wfmProvenanceCmd)
+	wfmCmd.AddCommand(wfmLintCmd)
+	wfmCmd.AddCommand(wfmRenderCmd)
+	wfmCmd.AddCommand(wfmShotdiffCmd)
+	wfmCmd.AddCommand(wfmStatsCmd)
+	wfmCmd.AddCommand(wfmOpcodesCmd)
+	wfmCmd.AddCommand(wfmGraphCmd)
+	wfmCmd.AddCommand(wfmMTCmd)
+	wfmCmd.AddCommand(wfmMeasureCmd)
+	wfmCmd.AddCommand(wfmBaselineCmd)
+	wfmCmd.AddCommand(wfmSelftestCmd)
+	wfmCmd.AddCommand(wfmRemapCmd)
+	wfmCmd.AddCommand(wfmFonttoolCmd)
+	wfmFonttoolCmd.AddCommand(wfmFonttoolScaleCmd)
+	wfmFonttoolCmd.AddCommand(wfmFonttoolShiftCmd)
+	wfmFonttoolCmd.AddCommand(wfmFonttoolTrimCmd)
+
+	// Add verbose flag to decode command for detailed output
+	wfmDecodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmDecodeCmd.Flags().String("unmapped-log", pkg.DefaultUnmappedCodesFile, "Dictionary file unmapped codes are recorded in (empty disables)")
+	wfmDecodeCmd.Flags().String("archive", "", "Write all outputs into this .zip archive instead of an output directory")
+	wfmDecodeCmd.Flags().Bool("raw-dialogues", false, "Store the original bytes of every dialogue as hex next to the decoded content")
+	wfmDecodeCmd.Flags().Bool("salvage", false, "Skip unreadable glyphs and dialogues and write a recovery report")
+	wfmDecodeCmd.Flags().Bool("widths", false, "Store the measured pixel width of every dialogue line for wfm lint")
+	wfmDecodeCmd.Flags().String("double-newline", "", "Write DOUBLE_NEWLINE as a blank line (newline) or a [PAGE] tag (page); default from the profile")
+	wfmDecodeCmd.Flags().String("profile", "tomba", "Game profile providing the decode defaults")
+	wfmDecodeCmd.Flags().Bool("dialogues-only", false, "Skip the glyph PNG export and only write dialogues.yaml")
+	wfmDecodeCmd.Flags().String("merge-existing", "", "Merge into this translated dialogues.yaml, keeping translations of unchanged dialogues")
+
+	// Add verbose flag to encode command for detailed output
+	wfmEncodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmEncodeCmd.Flags().Int64("align", 0, "Round the output size up to a multiple of this value (0 disables)")
+	wfmEncodeCmd.Flags().String("pad-byte", "0xFF", "Byte used for final padding (e.g. 0x00 or 0xFF)")
+	wfmEncodeCmd.Flags().Uint8("alpha-threshold", 0, "Glyph pixels with alpha below this become transparent, the rest opaque (0 disables)")
+	wfmEncodeCmd.Flags().String("matte", "", "Blend semi-transparent glyph pixels over this RRGGBB color")
+	wfmEncodeCmd.Flags().Bool("premultiplied", false, "Treat glyph PNG colors as premultiplied by alpha")
+	wfmEncodeCmd.Flags().Bool("warn-partial-alpha", false, "Warn about glyph PNGs with semi-transparent pixels")
+	wfmEncodeCmd.Flags().String("glyphs-from", "", "Take glyphs from an existing WFM file instead of the fonts/ PNG tree")
+	wfmEncodeCmd.Flags().String("unmapped-log", pkg.DefaultUnmappedCodesFile, "Dictionary file unmapped codes are recorded in (empty disables)")
+	wfmEncodeCmd.Flags().Bool("provenance", false, "Store tool version, source YAML hash and timestamp in the final padding")
+	wfmEncodeCmd.Flags().String("encode-map", "", "Write the encode value → character map to this YAML file (e.g. "+pkg.DefaultEncodeMapFile+")")
+	wfmEncodeCmd.Flags().String("width-report", "", "Write a glyph and line width comparison with the original font to this file (.json or markdown)")
+	wfmEncodeCmd.Flags().String("check-refs", "", "Reference profile of dialogue indices hardcoded in the executable")
+	wfmEncodeCmd.Flags().String("exe", "", "Executable scanned for dialogue references (used with --check-refs)")
+	wfmEncodeCmd.Flags().String("double-newline", "", "Encode blank lines (newline) or [PAGE] tags (page) as DOUBLE_NEWLINE; default from the YAML file")
+	wfmEncodeCmd.Flags().String("profile", "tomba", "Game profile providing the glyph width limits, glyph pointer width and font CLUTs")
+	wfmEncodeCmd.Flags().String("align-baseline", "", "Move the glyph rows onto the ink bounds of this original WFM file")
+	wfmEncodeCmd.Flags().String("baseline-overrides", "", "YAML file of per-character baseline shifts")
+
+	// Add flags to progress command
+	wfmProgressCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmProgressCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmProgressCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add flags to pauses command
+	wfmPausesCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmPausesCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmPausesCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	wfmPausesCmd.Flags().Float64("outlier-factor", pkg.DefaultPauseOutlierFactor, "Ratio to the median that marks a pause as an outlier")
+	wfmPausesCmd.Flags().Float64("scale", 1.0, "Multiply every pause duration by this factor")
+	wfmPausesCmd.Flags().Int("cap", 0, "Limit every pause duration to this value (0 disables)")
+	wfmPausesCmd.Flags().String("write", "", "Output YAML file for normalized dialogues")
+
+	// Add flags to import command
+	wfmImportCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmImportCmd.Flags().String("encoding", pkg.EncodingAuto, "Source encoding: auto, utf-8, shift-jis, windows-1252")
+	wfmImportCmd.Flags().String("mapping", "", "YAML file mapping legacy markup to tombatools tags")
+	wfmImportCmd.Flags().String("base", "", "Existing dialogues.yaml to merge the imported text into")
+	wfmImportCmd.Flags().Int("font-height", 16, "Font height for dialogues not present in the base file")
+
+	// Add flags to unmapped command
+	wfmUnmappedCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmUnmappedCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add flags to palettes command
+	wfmPalettesCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmPalettesCmd.Flags().String("vram", "", "Raw 1024x512 16-bit VRAM dump")
+	wfmPalettesCmd.Flags().String("exe", "", "Executable containing the palettes")
+	wfmPalettesCmd.Flags().StringArray("exe-palette", nil, "CLUT=OFFSET pair locating a palette in the executable (repeatable)")
+
+	// Add flags to lint command
+	wfmLintCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmLintCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmLintCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	wfmLintCmd.Flags().String("glossary", pkg.DefaultGlossaryFile, "Glossary file mapping source terms to approved translations")
+	wfmLintCmd.Flags().String("original", "", "Original dialogue YAML file for the missing-term and terminator checks")
+	wfmLintCmd.Flags().String("profile", "tomba", "Game profile providing the glyph width limits")
+
+	// Add flags to render command
+	wfmRenderCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmRenderCmd.Flags().Int("height", 16, "Font height of the glyphs to use")
+	wfmRenderCmd.Flags().Int("width", 0, "Wrap lines to this many pixels (0 disables wrapping)")
+	wfmRenderCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to map glyphs to characters")
+	wfmRenderCmd.Flags().String("palettes", "", "Project palette file (default: built-in CLUTs)")
+
+	// Add flags to shotdiff command
+	wfmShotdiffCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmShotdiffCmd.Flags().Int("box", 0, "Text box of the dialogue to compare, from 0")
+	wfmShotdiffCmd.Flags().Int("scale", 1, "Integer upscaling of the emulator output")
+	wfmShotdiffCmd.Flags().Int("width", 0, "Wrap lines to this many pixels (0 disables wrapping)")
+	wfmShotdiffCmd.Flags().Int("tolerance", pkg.DefaultScreenshotTolerance, "Color distance from the background counted as drawn")
+	wfmShotdiffCmd.Flags().IntSlice("offset", nil, "Position of the text in the screenshot as x,y (default: searched)")
+	wfmShotdiffCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to map glyphs to characters")
+	wfmShotdiffCmd.Flags().String("palettes", "", "Project palette file (default: built-in CLUTs)")
+
+	// Add flags to stats command
+	wfmStatsCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmStatsCmd.Flags().Bool("space", false, "Analyze padding and pointer gaps for free space")
+	wfmStatsCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmStatsCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add flags to selftest command
+	wfmSelftestCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmSelftestCmd.Flags().String("corpus", "", "Directory searched recursively for .WFM files")
+	wfmSelftestCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmSelftestCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	_ = wfmSelftestCmd.MarkFlagRequired("corpus")
+
+	// Add flags to remap command
+	wfmRemapCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmRemapCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmRemapCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+	wfmRemapCmd.Flags().String("write", "", "Output YAML file for the remapped dialogues")
+	wfmRemapCmd.Flags().String("check-refs", "", "Reference profile locating the dialogue indices hardcoded in the executable")
+	wfmRemapCmd.Flags().String("exe", "", "Executable scanned by --check-refs")
+	wfmRemapCmd.Flags().String("wfm", "", "WFM file name the references of --check-refs are configured for")
+
+	// Add flags to fonttool commands
+	for _, fonttoolCmd := range []*cobra.Command{wfmFonttoolScaleCmd, wfmFonttoolShiftCmd, wfmFonttoolTrimCmd} {
+		fonttoolCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+		fonttoolCmd.Flags().StringP("output", "o", "", "Write the transformed tree to this directory instead of replacing the glyphs")
+		fonttoolCmd.Flags().Bool("dry-run", false, "List the changes without writing anything")
+	}
+	wfmFonttoolScaleCmd.Flags().Float64("sx", 1, "Horizontal scale factor")
+	wfmFonttoolScaleCmd.Flags().Float64("sy", 1, "Vertical scale factor")
+	wfmFonttoolShiftCmd.Flags().Int("dx", 0, "Columns to move the pixels, positive moves right")
+	wfmFonttoolShiftCmd.Flags().Int("dy", 0, "Rows to move the pixels, positive moves down")
+	wfmFonttoolTrimCmd.Flags().Int("spacing", 0, "Blank columns left after the last inked column")
+
+	// Add flags to opcodes command
+	wfmOpcodesCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmOpcodesCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json, markdown or yaml (controlcodes.yaml entries)")
+	wfmOpcodesCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add flags to graph command
+	wfmGraphCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmGraphCmd.Flags().StringArray("events", nil, "Event mapping written by ovl dump (repeatable)")
+	wfmGraphCmd.Flags().StringP("format", "f", pkg.DialogueFlowFormatDOT, "Graph format: dot or json")
+	wfmGraphCmd.Flags().StringP("output", "o", "", "Write the graph to a file instead of stdout")
+
+	// Add flags to mt command
+	wfmMTCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmMTCmd.Flags().String("url", "", "MT backend endpoint receiving the JSON requests")
+	wfmMTCmd.Flags().String("api-key", "", "Bearer token sent to the backend (default: $TOMBATOOLS_MT_API_KEY)")
+	wfmMTCmd.Flags().String("source", "en", "Language of the original dialogues")
+	wfmMTCmd.Flags().String("target", "", "Language of the drafts")
+	wfmMTCmd.Flags().Int("budget", 100, "Draft size allowed, in percent of the original text size")
+	wfmMTCmd.Flags().Int("limit", 0, "Maximum number of dialogues to send (0 sends all)")
+	wfmMTCmd.Flags().Bool("overwrite", false, "Replace existing drafts of the target language")
+	wfmMTCmd.Flags().Duration("timeout", pkg.DefaultMTTimeout, "Time allowed for each backend request")
+	wfmMTCmd.Flags().String("write", "", "Output YAML file (default: overwrite translated.yaml)")
+	_ = wfmMTCmd.MarkFlagRequired("url")
+	_ = wfmMTCmd.MarkFlagRequired("target")
+
+	// Add flags to measure command
+	wfmMeasureCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmMeasureCmd.Flags().Int("width", 0, "Line width in pixels (0 uses the widest original line of each font height)")
+	wfmMeasureCmd.Flags().StringArray("sample", nil, "Representative string to measure (repeatable)")
+	wfmMeasureCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to map glyphs to characters")
+	wfmMeasureCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json, markdown or csv")
+	wfmMeasureCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
+
+	// Add flags to baseline command
+	wfmBaselineCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output (show debug messages)")
+	wfmBaselineCmd.Flags().String("fonts", pkg.DefaultFontDir, "Reference font directory used to map original glyphs to characters")
+	wfmBaselineCmd.Flags().String("overrides", "", "YAML file of per-character baseline shifts")
+	wfmBaselineCmd.Flags().StringP("format", "f", pkg.ReportFormatMarkdown, "Report format: json or markdown")
+	wfmBaselineCmd.Flags().StringP("output", "o", "", "Write the report to a file instead of stdout")
 }
@@ -0,0 +1,164 @@
+// Package cmd provides command-line interface for XA audio processing.
+// This file contains commands for splitting the interleaved XA-ADPCM streams of
+// the Tomba! PlayStation game into WAV files and encoding them back.
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/spf13/cobra"
+)
+
+// xaCmd represents the parent command for all XA audio operations.
+var xaCmd = &cobra.Command{
+	Use:   "xa",
+	Short: "Process XA-ADPCM audio files from Tomba! PSX game",
+	Long: `Process the interleaved XA audio files (voices and music) of Tomba! PSX game.
+
+An XA file interleaves several streams; the file and channel numbers of every
+sector subheader tell them apart. XA files are stored in 2336-byte Mode 2 Form 2
+sectors, which cd dump does not keep, so read them from the disc with --image or
+from a raw dump of 2336-byte or 2352-byte sectors.
+
+Commands:
+  decode    Split the streams of an XA file into WAV files
+  encode    Re-encode edited WAV files into an XA file
+
+Examples:
+  tombatools xa decode --image original.bin XA/VOICE.XA ./audio/
+  tombatools xa encode --image original.bin XA/VOICE.XA ./audio/ VOICE.XA
+  tombatools cd build original.bin patched.bin --file XA/VOICE.XA=VOICE.XA`,
+}
+
+// xaDecodeCmd splits the streams of an XA file into WAV files.
+var xaDecodeCmd = &cobra.Command{
+	Use:   "decode [xa_file] [output_directory]",
+	Short: "Split the streams of an XA file into WAV files",
+	Long: `Decode every XA-ADPCM stream of an XA file into a 16-bit PCM WAV file.
+
+Each stream (file and channel number of the subheaders) is written as
+<name>_fNN_cNN.wav at its own sample rate (37800 or 18900 Hz), mono or stereo.
+Sectors that are not audio (video, data) are ignored.
+
+Flags:
+  --image         Read xa_file as a path of this disc image
+  -v, --verbose   Enable verbose output
+
+Examples:
+  tombatools xa decode --image original.bin XA/VOICE.XA ./audio/
+  tombatools xa decode VOICE.XA ./audio/`,
+	Args: cobra.ExactArgs(2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		outputDir := args[1]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		imageFile, err := cmd.Flags().GetString("image")
+		if err != nil {
+			return fmt.Errorf("error getting image flag: %w", err)
+		}
+		recordXAInput(source, imageFile)
+
+		processor := pkg.NewXAProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Decode(cmd.Context(), source, imageFile, outputDir)
+		if err != nil {
+			return fmt.Errorf("failed to decode %s: %w", source, err)
+		}
+
+		common.Printf("Decoded %d streams of %s to %s\n", len(report.Streams), source, outputDir)
+		return nil
+	},
+}
+
+// xaEncodeCmd re-encodes edited WAV files into an XA file.
+var xaEncodeCmd = &cobra.Command{
+	Use:   "encode [xa_file] [wav_directory] [output_file]",
+	Short: "Re-encode edited WAV files into an XA file",
+	Long: `Encode the WAV files of a directory into the streams of an XA file.
+
+Every stream with a WAV file named as xa decode names it is encoded as 4-bit
+XA-ADPCM into its own sectors; the other streams and sectors are copied
+unchanged, so the interleave and the file size stay the same. A WAV file must
+have the sample rate and channels of its stream and may not be longer than it;
+shorter audio is padded with silence. The output has the sector size of the
+input and can be injected with cd build --file.
+
+Flags:
+  --image         Read xa_file as a path of this disc image
+  -v, --verbose   Enable verbose output
+
+Examples:
+  tombatools xa encode --image original.bin XA/VOICE.XA ./audio/ VOICE.XA
+  tombatools xa encode VOICE.XA ./audio/ VOICE_new.XA`,
+	Args: cobra.ExactArgs(3),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		source := args[0]
+		wavDir := args[1]
+		outputFile := args[2]
+
+		// Enable verbose mode if requested
+		verbose, err := cmd.Flags().GetBool("verbose")
+		if err != nil {
+			return fmt.Errorf("error getting verbose flag: %w", err)
+		}
+		common.SetVerboseMode(verbose)
+
+		imageFile, err := cmd.Flags().GetString("image")
+		if err != nil {
+			return fmt.Errorf("error getting image flag: %w", err)
+		}
+		recordXAInput(source, imageFile)
+
+		processor := pkg.NewXAProcessor()
+		processor.SetLogger(common.NewLogger(verbose))
+		report, err := processor.Encode(cmd.Context(), source, imageFile, wavDir, outputFile)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s: %w", source, err)
+		}
+
+		encoded := 0
+		for _, stream := range report.Streams {
+			if stream.Encoded {
+				encoded++
+			}
+		}
+		common.Printf("Encoded %d of %d streams into %s\n", encoded, len(report.Streams), outputFile)
+		return nil
+	},
+}
+
+// recordXAInput records the file an XA command reads: the disc image or the XA file
+func recordXAInput(source, imageFile string) {
+	if imageFile != "" {
+		common.RecordInput(imageFile)
+		return
+	}
+	common.RecordInput(source)
+}
+
+// init initializes the XA command and its subcommands with appropriate flags.
+func init() {
+	// Register the XA command with the root command
+	rootCmd.AddCommand(xaCmd)
+
+	// Add subcommands to the XA command
+	xaCmd.AddCommand(xaDecodeCmd)
+	xaCmd.AddCommand(xaEncodeCmd)
+
+	// Add flags to decode command
+	xaDecodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	xaDecodeCmd.Flags().String("image", "", "Read the XA file from this disc image")
+
+	// Add flags to encode command
+	xaEncodeCmd.Flags().BoolP("verbose", "v", false, "Enable verbose output")
+	xaEncodeCmd.Flags().String("image", "", "Read the XA file from this disc image")
+}
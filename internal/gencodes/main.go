@@ -0,0 +1,146 @@
+// Command gencodes generates the dialogue control code constants and table of package pkg
+// from the declarative table in pkg/controlcodes.yaml. It is run by go generate:
+//
+//	go generate ./pkg
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// controlCode is an entry of the declarative table
+type controlCode struct {
+	Name    string   `yaml:"name"`
+	Value   uint16   `yaml:"value"`
+	Args    int      `yaml:"args"`
+	Tag     string   `yaml:"tag"`
+	Symbol  string   `yaml:"symbol"`
+	Text    string   `yaml:"text"`
+	Content string   `yaml:"content"`
+	Params  []string `yaml:"params"`
+	Comment string   `yaml:"comment"`
+}
+
+// table is the declarative control code table
+type table struct {
+	Codes []controlCode `yaml:"codes"`
+}
+
+func main() {
+	input := flag.String("in", "controlcodes.yaml", "Declarative control code table")
+	output := flag.String("out", "controlcodes_gen.go", "Generated Go file")
+	pkgName := flag.String("package", "pkg", "Package of the generated file")
+	flag.Parse()
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		log.Fatalf("gencodes: %v", err)
+	}
+	source, err := generate(data, filepath.Base(*input), *pkgName)
+	if err != nil {
+		log.Fatalf("gencodes: %v", err)
+	}
+	if err := os.WriteFile(*output, source, 0644); err != nil {
+		log.Fatalf("gencodes: %v", err)
+	}
+}
+
+// generate returns the formatted Go source for a control code table
+func generate(data []byte, inputName, pkgName string) ([]byte, error) {
+	var codes table
+	if err := yaml.Unmarshal(data, &codes); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", inputName, err)
+	}
+	if err := validate(codes.Codes); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", inputName, err)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by gencodes from %s. DO NOT EDIT.\n\n", inputName)
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+
+	buf.WriteString("// Dialogue control codes\nconst (\n")
+	for _, code := range codes.Codes {
+		fmt.Fprintf(&buf, "\t%s uint16 = 0x%04X", code.Name, code.Value)
+		if code.Comment != "" {
+			fmt.Fprintf(&buf, " // %s", code.Comment)
+		}
+		buf.WriteString("\n")
+	}
+	buf.WriteString(")\n\n")
+
+	buf.WriteString("// controlCodeTable lists every control code in declaration order\n")
+	buf.WriteString("var controlCodeTable = []ControlCode{\n")
+	for _, code := range codes.Codes {
+		fmt.Fprintf(&buf, "\t{Name: %q, Value: %s", code.Name, code.Name)
+		if code.Args != 0 {
+			fmt.Fprintf(&buf, ", Args: %d", code.Args)
+		}
+		for _, field := range []struct{ name, value string }{{"Tag", code.Tag}, {"Symbol", code.Symbol}, {"Text", code.Text}, {"Content", code.Content}} {
+			if field.value != "" {
+				fmt.Fprintf(&buf, ", %s: %s", field.name, strconv.Quote(field.value))
+			}
+		}
+		if len(code.Params) > 0 {
+			quoted := make([]string, len(code.Params))
+			for i, param := range code.Params {
+				quoted[i] = strconv.Quote(param)
+			}
+			fmt.Fprintf(&buf, ", Params: []string{%s}", strings.Join(quoted, ", "))
+		}
+		buf.WriteString("},\n")
+	}
+	buf.WriteString("}\n")
+
+	source, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated source: %w", err)
+	}
+	return source, nil
+}
+
+// validate rejects duplicate names, values, tags, symbols and content keys, which would
+// make decode and encode disagree, and parameter names that do not match the args
+func validate(codes []controlCode) error {
+	seen := make(map[string]string)
+	claim := func(kind, key, name string) error {
+		if key == "" {
+			return nil
+		}
+		if owner, exists := seen[kind+key]; exists {
+			return fmt.Errorf("%s %q of %s is already used by %s", kind, key, name, owner)
+		}
+		seen[kind+key] = name
+		return nil
+	}
+
+	for _, code := range codes {
+		if code.Name == "" {
+			return fmt.Errorf("code 0x%04X has no name", code.Value)
+		}
+		if code.Args < 0 {
+			return fmt.Errorf("code %s has a negative argument count", code.Name)
+		}
+		if code.Content != "" && len(code.Params) != code.Args {
+			return fmt.Errorf("code %s has %d args but %d params", code.Name, code.Args, len(code.Params))
+		}
+		for _, key := range []struct{ kind, value string }{
+			{"name", code.Name}, {"value", fmt.Sprintf("0x%04X", code.Value)}, {"tag", code.Tag}, {"symbol", code.Symbol}, {"content", code.Content},
+		} {
+			if err := claim(key.kind, key.value, code.Name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
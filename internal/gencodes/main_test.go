@@ -0,0 +1,47 @@
+// Package main provides tests for the control code generator.
+package main
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+func TestGenerate_UpToDate(t *testing.T) {
+	data, err := os.ReadFile("../../pkg/controlcodes.yaml")
+	if err != nil {
+		t.Fatalf("failed to read table: %v", err)
+	}
+	want, err := os.ReadFile("../../pkg/controlcodes_gen.go")
+	if err != nil {
+		t.Fatalf("failed to read generated file: %v", err)
+	}
+
+	got, err := generate(data, "controlcodes.yaml", "pkg")
+	if err != nil {
+		t.Fatalf("generate() failed: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Error("pkg/controlcodes_gen.go is out of date; run go generate ./pkg")
+	}
+}
+
+func TestGenerate_Duplicates(t *testing.T) {
+	tests := []struct {
+		name  string
+		table string
+	}{
+		{"value", "codes:\n  - {name: A, value: 0xFFF3}\n  - {name: B, value: 0xFFF3}\n"},
+		{"tag", "codes:\n  - {name: A, value: 0xFFF3, tag: \"[A]\"}\n  - {name: B, value: 0xFFF4, tag: \"[A]\"}\n"},
+		{"symbol", "codes:\n  - {name: A, value: 0xFFF3, symbol: \"▼\"}\n  - {name: B, value: 0xFFF4, symbol: \"▼\"}\n"},
+		{"no name", "codes:\n  - {value: 0xFFF3}\n"},
+		{"content", "codes:\n  - {name: A, value: 0xFFF3, content: a}\n  - {name: B, value: 0xFFF4, content: a}\n"},
+		{"params", "codes:\n  - {name: A, value: 0xFFF3, args: 2, content: a, params: [value]}\n"},
+	}
+
+	for _, tt := range tests {
+		if _, err := generate([]byte(tt.table), "codes.yaml", "pkg"); err == nil {
+			t.Errorf("generate(%s) should fail", tt.name)
+		}
+	}
+}
@@ -0,0 +1,486 @@
+// Command genschemas generates the machine-readable format descriptors of package formats:
+// a Kaitai Struct (.ksy) file and a JSON layout descriptor for every format listed in
+// pkg/formats/schemas.yaml. The fields of each type are read from the Go struct that
+// tombatools decodes the format with, so the descriptors cannot drift from the code.
+// It is run by go generate:
+//
+//	go generate ./pkg/formats
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// typeSpec names the Go struct a format type is read from
+type typeSpec struct {
+	Name     string            `yaml:"name"`     // Type name in the descriptors
+	Source   string            `yaml:"source"`   // Go file relative to the module root
+	Struct   string            `yaml:"struct"`   // Struct declared in Source
+	Fields   []string          `yaml:"fields"`   // Fields stored in the file, in order (default: every exported field)
+	Sizes    map[string]string `yaml:"sizes"`    // Size expressions of variable-length byte fields
+	Contents map[string]string `yaml:"contents"` // Fixed values of magic fields
+	Docs     map[string]string `yaml:"docs"`     // Field docs replacing comments about in-memory state
+}
+
+// formatSpec is a format of the declarative table
+type formatSpec struct {
+	ID         string     `yaml:"id"`
+	Title      string     `yaml:"title"`
+	Extension  string     `yaml:"extension"`
+	Endian     string     `yaml:"endian"`
+	Doc        string     `yaml:"doc"`
+	Types      []typeSpec `yaml:"types"`
+	Seq        yaml.Node  `yaml:"seq"`         // Kaitai seq of the file
+	Instances  yaml.Node  `yaml:"instances"`   // Kaitai instances of the file
+	ExtraTypes yaml.Node  `yaml:"extra_types"` // Kaitai types not backed by a Go struct
+}
+
+// table is the declarative format table
+type table struct {
+	Formats []formatSpec `yaml:"formats"`
+}
+
+// field is a field of a format type, as read from its Go struct
+type field struct {
+	ID       string `json:"id"`
+	GoName   string `json:"go_name"`
+	Type     string `json:"type,omitempty"`   // Integer type (u1, u2, u4...) or another type; empty for bytes
+	Offset   *int   `json:"offset,omitempty"` // Set while every earlier field has a fixed size
+	Size     int    `json:"size,omitempty"`   // Fixed size in bytes (0 when variable)
+	SizeExpr string `json:"size_expr,omitempty"`
+	Contents string `json:"contents,omitempty"`
+	Doc      string `json:"doc,omitempty"`
+}
+
+// recordType is a format type with the fields of its Go struct
+type recordType struct {
+	Name     string  `json:"name"`
+	Source   string  `json:"source"`
+	GoStruct string  `json:"go_struct"`
+	Size     int     `json:"size,omitempty"` // Fixed size in bytes (0 when variable)
+	Doc      string  `json:"doc,omitempty"`
+	Fields   []field `json:"fields"`
+}
+
+// descriptor is the JSON layout descriptor of a format
+type descriptor struct {
+	Format     string       `json:"format"`
+	Title      string       `json:"title"`
+	Extension  string       `json:"extension,omitempty"`
+	Endian     string       `json:"endian"`
+	Doc        string       `json:"doc,omitempty"`
+	Types      []recordType `json:"types"`
+	Seq        interface{}  `json:"seq,omitempty"`
+	Instances  interface{}  `json:"instances,omitempty"`
+	ExtraTypes interface{}  `json:"extra_types,omitempty"`
+}
+
+// primitives maps the Go integer types to their Kaitai type and size
+var primitives = map[string]struct {
+	kaitai string
+	size   int
+}{
+	"byte": {"u1", 1}, "uint8": {"u1", 1}, "uint16": {"u2", 2}, "uint32": {"u4", 4},
+	"int8": {"s1", 1}, "int16": {"s2", 2}, "int32": {"s4", 4},
+}
+
+func main() {
+	input := flag.String("in", "schemas.yaml", "Declarative format table")
+	root := flag.String("root", "../..", "Module root the Go sources are relative to")
+	output := flag.String("out", "data/schemas", "Directory of the generated descriptors")
+	flag.Parse()
+
+	data, err := os.ReadFile(*input)
+	if err != nil {
+		log.Fatalf("genschemas: %v", err)
+	}
+	files, err := generate(data, filepath.Base(*input), func(source string) ([]byte, error) {
+		return os.ReadFile(filepath.Join(*root, filepath.FromSlash(source)))
+	})
+	if err != nil {
+		log.Fatalf("genschemas: %v", err)
+	}
+
+	if err := os.MkdirAll(*output, 0o755); err != nil {
+		log.Fatalf("genschemas: %v", err)
+	}
+	for _, name := range sortedNames(files) {
+		if err := os.WriteFile(filepath.Join(*output, name), files[name], 0644); err != nil {
+			log.Fatalf("genschemas: %v", err)
+		}
+	}
+}
+
+// generate returns the descriptors of every format of the table by file name (<id>.ksy
+// and <id>.json); readSource reads a Go file by its path relative to the module root
+func generate(data []byte, inputName string, readSource func(string) ([]byte, error)) (map[string][]byte, error) {
+	var formats table
+	if err := yaml.Unmarshal(data, &formats); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", inputName, err)
+	}
+
+	reader := &structReader{readSource: readSource, files: make(map[string]*ast.File)}
+	files := make(map[string][]byte)
+	for _, format := range formats.Formats {
+		if format.ID == "" || (format.Endian != "le" && format.Endian != "be") {
+			return nil, fmt.Errorf("invalid %s: format %q needs an id and an endian (le or be)", inputName, format.ID)
+		}
+		if _, exists := files[format.ID+".ksy"]; exists {
+			return nil, fmt.Errorf("invalid %s: format %s is listed twice", inputName, format.ID)
+		}
+
+		types, err := reader.readTypes(format.Types)
+		if err != nil {
+			return nil, fmt.Errorf("format %s: %w", format.ID, err)
+		}
+		ksy, err := kaitaiSchema(format, types, inputName)
+		if err != nil {
+			return nil, fmt.Errorf("format %s: %w", format.ID, err)
+		}
+		layout, err := layoutDescriptor(format, types)
+		if err != nil {
+			return nil, fmt.Errorf("format %s: %w", format.ID, err)
+		}
+		files[format.ID+".ksy"] = ksy
+		files[format.ID+".json"] = layout
+	}
+	return files, nil
+}
+
+// structReader reads format types from the Go structs of the module, parsing each file once
+type structReader struct {
+	readSource func(string) ([]byte, error)
+	files      map[string]*ast.File
+}
+
+// readTypes reads the types of a format in order; a type may use the types listed before it
+func (r *structReader) readTypes(specs []typeSpec) ([]recordType, error) {
+	types := make([]recordType, 0, len(specs))
+	byStruct := make(map[string]recordType)
+	for _, spec := range specs {
+		record, err := r.readType(spec, byStruct)
+		if err != nil {
+			return nil, fmt.Errorf("type %s: %w", spec.Name, err)
+		}
+		types = append(types, record)
+		byStruct[spec.Struct] = record
+	}
+	return types, nil
+}
+
+// readType reads the fields of a type from its Go struct
+func (r *structReader) readType(spec typeSpec, byStruct map[string]recordType) (recordType, error) {
+	file, err := r.parse(spec.Source)
+	if err != nil {
+		return recordType{}, err
+	}
+	structType, doc := findStruct(file, spec.Struct)
+	if structType == nil {
+		return recordType{}, fmt.Errorf("struct %s not found in %s", spec.Struct, spec.Source)
+	}
+
+	declared := make(map[string]*ast.Field)
+	var order []string
+	for _, astField := range structType.Fields.List {
+		for _, name := range astField.Names {
+			if name.IsExported() {
+				declared[name.Name] = astField
+				order = append(order, name.Name)
+			}
+		}
+	}
+	if len(spec.Fields) > 0 {
+		order = spec.Fields
+	}
+
+	record := recordType{Name: spec.Name, Source: spec.Source, GoStruct: file.Name.Name + "." + spec.Struct, Doc: doc}
+	offset, fixed := 0, true
+	for _, goName := range order {
+		astField, found := declared[goName]
+		if !found {
+			return recordType{}, fmt.Errorf("field %s not found in struct %s", goName, spec.Struct)
+		}
+		item := field{ID: snakeCase(goName), GoName: goName, Doc: commentText(astField.Comment, astField.Doc)}
+		if doc, found := spec.Docs[goName]; found {
+			item.Doc = doc
+		}
+		if err := fieldType(&item, astField.Type, spec, byStruct); err != nil {
+			return recordType{}, fmt.Errorf("field %s: %w", goName, err)
+		}
+		if fixed {
+			fieldOffset := offset
+			item.Offset = &fieldOffset
+		}
+		if item.Size == 0 {
+			fixed = false
+		}
+		offset += item.Size
+		record.Fields = append(record.Fields, item)
+	}
+	if fixed {
+		record.Size = offset
+	}
+	for _, names := range []map[string]string{spec.Sizes, spec.Contents, spec.Docs} {
+		for name := range names {
+			if _, used := declared[name]; !used {
+				return recordType{}, fmt.Errorf("field %s not found in struct %s", name, spec.Struct)
+			}
+		}
+	}
+	return record, nil
+}
+
+// fieldType sets the type and size of a field from its Go type
+func fieldType(item *field, expr ast.Expr, spec typeSpec, byStruct map[string]recordType) error {
+	switch goType := expr.(type) {
+	case *ast.Ident:
+		if primitive, found := primitives[goType.Name]; found {
+			item.Type, item.Size = primitive.kaitai, primitive.size
+			return nil
+		}
+		nested, found := byStruct[goType.Name]
+		if !found {
+			return fmt.Errorf("type %s is neither an integer nor a struct listed before", goType.Name)
+		}
+		item.Type, item.Size = nested.Name, nested.Size
+		return nil
+	case *ast.ArrayType:
+		if element, ok := goType.Elt.(*ast.Ident); !ok || primitives[element.Name].size != 1 {
+			return fmt.Errorf("only byte arrays are supported")
+		}
+		if goType.Len == nil {
+			item.SizeExpr = spec.Sizes[item.GoName]
+			if item.SizeExpr == "" {
+				return fmt.Errorf("variable-length bytes need a size expression")
+			}
+			return nil
+		}
+		length, ok := goType.Len.(*ast.BasicLit)
+		if !ok || length.Kind != token.INT {
+			return fmt.Errorf("array length must be an integer literal")
+		}
+		size, err := strconv.Atoi(length.Value)
+		if err != nil {
+			return fmt.Errorf("invalid array length %s: %w", length.Value, err)
+		}
+		item.Size = size
+		if contents, found := spec.Contents[item.GoName]; found {
+			if len(contents) != size {
+				return fmt.Errorf("contents %q do not fill %d bytes", contents, size)
+			}
+			item.Contents = contents
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported Go type %T", expr)
+	}
+}
+
+// parse parses a Go file of the module with its comments
+func (r *structReader) parse(source string) (*ast.File, error) {
+	if file, found := r.files[source]; found {
+		return file, nil
+	}
+	data, err := r.readSource(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), source, data, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", source, err)
+	}
+	r.files[source] = file
+	return file, nil
+}
+
+// findStruct returns the struct type declared with the given name and its doc comment
+func findStruct(file *ast.File, name string) (*ast.StructType, string) {
+	for _, decl := range file.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			typeSpec := spec.(*ast.TypeSpec)
+			structType, ok := typeSpec.Type.(*ast.StructType)
+			if !ok || typeSpec.Name.Name != name {
+				continue
+			}
+			// The first line of the doc comment summarizes the type
+			doc, _, _ := strings.Cut(strings.TrimSpace(firstGroup(typeSpec.Doc, genDecl.Doc).Text()), "\n")
+			return structType, doc
+		}
+	}
+	return nil, ""
+}
+
+// firstGroup returns the first comment group that is present
+func firstGroup(groups ...*ast.CommentGroup) *ast.CommentGroup {
+	for _, group := range groups {
+		if group != nil {
+			return group
+		}
+	}
+	return nil
+}
+
+// commentText returns the first comment group that is present as a single line
+func commentText(groups ...*ast.CommentGroup) string {
+	return strings.Join(strings.Fields(firstGroup(groups...).Text()), " ")
+}
+
+// snakeCase converts a Go field name to a Kaitai identifier (DialoguePointerTable to
+// dialogue_pointer_table, CRC32Value to crc32_value)
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) && i > 0 {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				sb.WriteByte('_')
+			}
+		}
+		sb.WriteRune(unicode.ToLower(r))
+	}
+	return sb.String()
+}
+
+// kaitaiSchema returns the Kaitai Struct description of a format
+func kaitaiSchema(format formatSpec, types []recordType, inputName string) ([]byte, error) {
+	meta := mapping("id", format.ID, "title", format.Title)
+	if format.Extension != "" {
+		appendPair(meta, "file-extension", format.Extension)
+	}
+	appendPair(meta, "endian", format.Endian)
+
+	root := mapping("meta", meta)
+	root.HeadComment = fmt.Sprintf("Generated by genschemas from %s. DO NOT EDIT.", inputName)
+	if format.Doc != "" {
+		appendPair(root, "doc", format.Doc)
+	}
+	if format.Seq.Kind != 0 {
+		appendPair(root, "seq", &format.Seq)
+	}
+	if format.Instances.Kind != 0 {
+		appendPair(root, "instances", &format.Instances)
+	}
+
+	kaitaiTypes := mapping()
+	for _, record := range types {
+		seq := &yaml.Node{Kind: yaml.SequenceNode}
+		for _, item := range record.Fields {
+			attributes := mapping("id", item.ID)
+			switch {
+			case item.Contents != "":
+				appendPair(attributes, "contents", item.Contents)
+			case item.Type != "":
+				appendPair(attributes, "type", item.Type)
+			case item.SizeExpr != "":
+				appendPair(attributes, "size", item.SizeExpr)
+			default:
+				appendPair(attributes, "size", item.Size)
+			}
+			if item.Doc != "" {
+				appendPair(attributes, "doc", item.Doc)
+			}
+			seq.Content = append(seq.Content, attributes)
+		}
+		kaitaiType := mapping()
+		if record.Doc != "" {
+			appendPair(kaitaiType, "doc", record.Doc)
+		}
+		appendPair(kaitaiType, "seq", seq)
+		appendPair(kaitaiTypes, record.Name, kaitaiType)
+	}
+	if format.ExtraTypes.Kind == yaml.MappingNode {
+		kaitaiTypes.Content = append(kaitaiTypes.Content, format.ExtraTypes.Content...)
+	}
+	appendPair(root, "types", kaitaiTypes)
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(root); err != nil {
+		return nil, fmt.Errorf("failed to encode Kaitai schema: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode Kaitai schema: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// layoutDescriptor returns the JSON layout descriptor of a format
+func layoutDescriptor(format formatSpec, types []recordType) ([]byte, error) {
+	layout := descriptor{
+		Format: format.ID, Title: format.Title, Extension: format.Extension, Endian: format.Endian,
+		Doc: strings.TrimSpace(format.Doc), Types: types,
+	}
+	for _, attribute := range []struct {
+		node   *yaml.Node
+		target *interface{}
+	}{{&format.Seq, &layout.Seq}, {&format.Instances, &layout.Instances}, {&format.ExtraTypes, &layout.ExtraTypes}} {
+		if attribute.node.Kind == 0 {
+			continue
+		}
+		if err := attribute.node.Decode(attribute.target); err != nil {
+			return nil, fmt.Errorf("failed to read Kaitai attributes: %w", err)
+		}
+	}
+
+	data, err := json.MarshalIndent(layout, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode layout descriptor: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// mapping returns a YAML mapping node of key/value pairs, keeping their order
+func mapping(pairs ...interface{}) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for i := 0; i+1 < len(pairs); i += 2 {
+		appendPair(node, pairs[i].(string), pairs[i+1])
+	}
+	return node
+}
+
+// appendPair appends a key and its value (a node, a string or an int) to a mapping node
+func appendPair(node *yaml.Node, key string, value interface{}) {
+	var valueNode *yaml.Node
+	switch v := value.(type) {
+	case *yaml.Node:
+		valueNode = v
+	case int:
+		valueNode = &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!int", Value: strconv.Itoa(v)}
+	default:
+		valueNode = &yaml.Node{}
+		valueNode.SetString(fmt.Sprint(v))
+	}
+	node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+}
+
+// sortedNames returns the file names of the generated descriptors in order
+func sortedNames(files map[string][]byte) []string {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
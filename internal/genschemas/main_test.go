@@ -0,0 +1,76 @@
+// Package main provides tests for the format descriptor generator.
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readModuleSource reads a Go file relative to the module root
+func readModuleSource(source string) ([]byte, error) {
+	return os.ReadFile(filepath.Join("../..", filepath.FromSlash(source)))
+}
+
+func TestGenerate_UpToDate(t *testing.T) {
+	data, err := os.ReadFile("../../pkg/formats/schemas.yaml")
+	if err != nil {
+		t.Fatalf("failed to read table: %v", err)
+	}
+	files, err := generate(data, "schemas.yaml", readModuleSource)
+	if err != nil {
+		t.Fatalf("generate() failed: %v", err)
+	}
+
+	committed, err := filepath.Glob("../../pkg/formats/data/schemas/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(committed) != len(files) {
+		t.Errorf("pkg/formats/data/schemas holds %d files, want %d; run go generate ./pkg/formats", len(committed), len(files))
+	}
+	for _, name := range sortedNames(files) {
+		want, err := os.ReadFile(filepath.Join("../../pkg/formats/data/schemas", name))
+		if err != nil || !bytes.Equal(files[name], want) {
+			t.Errorf("pkg/formats/data/schemas/%s is out of date; run go generate ./pkg/formats", name)
+		}
+	}
+}
+
+func TestGenerate_Invalid(t *testing.T) {
+	const header = "formats:\n  - id: wfm\n    endian: le\n    types:\n      - {name: header, source: pkg/wfm/wfm.go, struct: Header"
+	tests := []struct {
+		name  string
+		table string
+		want  string
+	}{
+		{"no endian", "formats:\n  - id: wfm\n", "needs an id and an endian"},
+		{"unknown struct", header + "x}\n", "struct Headerx not found"},
+		{"unknown field", header + ", fields: [Missing]}\n", "field Missing not found"},
+		{"contents size", header + ", contents: {Magic: WFM}}\n", "do not fill 4 bytes"},
+		{"variable size", "formats:\n  - id: wfm\n    endian: le\n    types:\n      - {name: glyph, source: pkg/wfm/wfm.go, struct: Glyph, fields: [GlyphImage]}\n", "need a size expression"},
+		{"nested order", "formats:\n  - id: fla\n    endian: le\n    types:\n      - {name: entry, source: pkg/types.go, struct: FileLinkAddressEntry, fields: [Timecode]}\n", "struct listed before"},
+	}
+
+	for _, tt := range tests {
+		_, err := generate([]byte(tt.table), "schemas.yaml", readModuleSource)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("generate(%s) error = %v, want it to contain %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, want := range map[string]string{
+		"DialoguePointerTable": "dialogue_pointer_table",
+		"CRC32Value":           "crc32_value",
+		"LBA":                  "lba",
+		"Magic":                "magic",
+	} {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -29,5 +29,6 @@ func main() {
 		os.Exit(0)
 	}
 
+	cmd.SetVersion(Version)
 	cmd.Execute()
 }
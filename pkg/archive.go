@@ -0,0 +1,250 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains zip packaging of command outputs: decode and dump write into a staging
+// directory that is streamed into a single archive with the same internal layout, and
+// encode and pack accept such archives as input.
+package pkg
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// IsArchive reports whether a path names a zip archive
+func IsArchive(path string) bool {
+	return strings.EqualFold(filepath.Ext(path), ".zip")
+}
+
+// OutputArchive collects the output of a command in a staging directory and packs it
+// into a zip archive on Close
+type OutputArchive struct {
+	path string // Archive file
+	dir  string // Staging directory
+}
+
+// NewOutputArchive creates the staging directory of an output archive
+func NewOutputArchive(archivePath string) (*OutputArchive, error) {
+	if !IsArchive(archivePath) {
+		return nil, fmt.Errorf("unsupported archive %s: only .zip archives are supported", archivePath)
+	}
+	dir, err := common.MkdirTemp("archive-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create staging directory: %w", err)
+	}
+	return &OutputArchive{path: archivePath, dir: dir}, nil
+}
+
+// Dir returns the directory the command writes its output to
+func (a *OutputArchive) Dir() string {
+	return a.dir
+}
+
+// Path returns the archive file
+func (a *OutputArchive) Path() string {
+	return a.path
+}
+
+// Close packs the staging directory into the archive and removes it.
+// Returns the number of files archived.
+func (a *OutputArchive) Close(ctx context.Context) (int, error) {
+	defer a.Discard()
+	return ArchiveDirectory(ctx, a.dir, a.path)
+}
+
+// Discard removes the staging directory without writing the archive (kept with --keep-temp)
+func (a *OutputArchive) Discard() {
+	common.RemoveTemp(a.dir)
+}
+
+// ArchiveDirectory streams every file below dir into a zip archive, keeping the
+// relative paths. Returns the number of files archived.
+func ArchiveDirectory(ctx context.Context, dir, archivePath string) (int, error) {
+	file, err := common.CreateAtomic(archivePath)
+	if err != nil {
+		return 0, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create archive: %w", err))
+	}
+	defer file.Abort()
+
+	writer := zip.NewWriter(common.NewProgressWriter(ctx, file, archivePath, 0))
+	count := 0
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return nil
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if err := addArchiveFile(writer, path, filepath.ToSlash(name)); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write archive: %w", err))
+	}
+
+	if err := writer.Close(); err != nil {
+		return 0, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to finish archive: %w", err))
+	}
+	if err := file.Commit(); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// addArchiveFile copies a file into the archive under name
+func addArchiveFile(writer *zip.Writer, path, name string) error {
+	source, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+
+	destination, err := writer.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(destination, source)
+	return err
+}
+
+// ExtractArchive extracts a zip archive into dir. Entries whose names would escape
+// dir are rejected.
+func ExtractArchive(archivePath, dir string) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("archive %s not found", archivePath))
+		}
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to open archive %s: %w", archivePath, err))
+	}
+	defer reader.Close()
+
+	for _, entry := range reader.File {
+		if !filepath.IsLocal(entry.Name) {
+			return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("archive entry %q escapes the extraction directory", entry.Name))
+		}
+		target := filepath.Join(dir, filepath.FromSlash(entry.Name))
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0o750); err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, err)
+			}
+			continue
+		}
+		if err := extractArchiveFile(entry, target); err != nil {
+			return fmt.Errorf("failed to extract %s: %w", entry.Name, err)
+		}
+	}
+	return nil
+}
+
+// extractArchiveFile writes a single archive entry to target
+func extractArchiveFile(entry *zip.File, target string) error {
+	if err := common.CheckMemory(entry.Name, int64(entry.UncompressedSize64)); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, err)
+	}
+
+	source, err := entry.Open()
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, err)
+	}
+	defer source.Close()
+
+	destination, err := os.Create(target)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, err)
+	}
+	defer destination.Close()
+
+	if _, err := io.Copy(destination, source); err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, err)
+	}
+	return nil
+}
+
+// OpenArchiveInput resolves an input that may be a zip archive. Plain files are returned
+// unchanged. Archives are extracted to a directory of the temporary workspace and the path of member is
+// returned; an empty member selects the only file of the archive. The cleanup function
+// removes the temporary directory and must always be called.
+func OpenArchiveInput(path, member string) (string, func(), error) {
+	if !IsArchive(path) {
+		return path, func() {}, nil
+	}
+
+	dir, err := common.MkdirTemp("input-")
+	if err != nil {
+		return "", func() {}, fmt.Errorf("failed to create extraction directory: %w", err)
+	}
+	cleanup := func() { common.RemoveTemp(dir) }
+
+	if err := ExtractArchive(path, dir); err != nil {
+		cleanup()
+		return "", func() {}, err
+	}
+
+	if member == "" {
+		files, err := archiveFiles(dir)
+		if err != nil {
+			cleanup()
+			return "", func() {}, err
+		}
+		if len(files) != 1 {
+			cleanup()
+			return "", func() {}, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("archive %s holds %d files, expected exactly one", path, len(files)))
+		}
+		member = files[0]
+	}
+
+	resolved := filepath.Join(dir, filepath.FromSlash(member))
+	if _, err := os.Stat(resolved); err != nil {
+		cleanup()
+		return "", func() {}, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("archive %s has no %s", path, member))
+	}
+	return resolved, cleanup, nil
+}
+
+// archiveFiles lists the files extracted into dir, relative to it
+func archiveFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+		name, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(name))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
@@ -0,0 +1,98 @@
+// Package pkg provides tests for zip packaging of command outputs and inputs
+package pkg
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutputArchive_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "out.zip")
+
+	archive, err := NewOutputArchive(archivePath)
+	if err != nil {
+		t.Fatalf("NewOutputArchive() failed: %v", err)
+	}
+	files := map[string]string{
+		"dialogues.yaml":  "dialogues: []\n",
+		"glyphs/8/0.png":  "png",
+		"glyphs/16/1.png": "png16",
+	}
+	for name, content := range files {
+		path := filepath.Join(archive.Dir(), filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o750); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	count, err := archive.Close(context.Background())
+	if err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if count != len(files) {
+		t.Errorf("Close() = %d files, want %d", count, len(files))
+	}
+	if _, err := os.Stat(archive.Dir()); !os.IsNotExist(err) {
+		t.Errorf("staging directory still exists after Close()")
+	}
+
+	resolved, cleanup, err := OpenArchiveInput(archivePath, "dialogues.yaml")
+	if err != nil {
+		t.Fatalf("OpenArchiveInput() failed: %v", err)
+	}
+	defer cleanup()
+	root := filepath.Dir(resolved)
+	for name, content := range files {
+		data, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("extracted %s: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("extracted %s = %q, want %q", name, data, content)
+		}
+	}
+
+	if _, _, err := OpenArchiveInput(archivePath, ""); err == nil {
+		t.Error("OpenArchiveInput() of a multi-file archive without a member succeeded, want error")
+	}
+	if path, _, err := OpenArchiveInput("data.UNGAM", ""); err != nil || path != "data.UNGAM" {
+		t.Errorf("OpenArchiveInput(plain file) = %q, %v, want the path unchanged", path, err)
+	}
+}
+
+func TestExtractArchive_RejectsEscapingEntries(t *testing.T) {
+	dir := t.TempDir()
+	archivePath := filepath.Join(dir, "evil.zip")
+
+	file, err := os.Create(archivePath)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	writer := zip.NewWriter(file)
+	entry, err := writer.Create("../escaped.txt")
+	if err != nil {
+		t.Fatalf("failed to add entry: %v", err)
+	}
+	if _, err := entry.Write([]byte("x")); err != nil {
+		t.Fatalf("failed to write entry: %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+	file.Close()
+
+	target := filepath.Join(dir, "extract")
+	if err := ExtractArchive(archivePath, target); err == nil {
+		t.Fatal("ExtractArchive() succeeded, want error for an escaping entry")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); !os.IsNotExist(err) {
+		t.Error("escaping entry was written outside the extraction directory")
+	}
+}
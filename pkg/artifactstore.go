@@ -0,0 +1,405 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the content-addressable artifact store of a project: every file a
+// build command writes (encoded WFMs, packed GAMs, patched images) is kept once under
+// .tombatools/objects, named by its SHA-256 hash, and a manifest links the hashes of the
+// inputs and options of each build to its outputs. Running a build whose inputs did not
+// change restores the outputs from the store instead of rebuilding them, and any earlier
+// build can be checked out again.
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Artifact store layout
+const (
+	// DefaultStoreDir is the project directory holding the artifact store. Build
+	// commands only use the store when this directory exists (see store init).
+	DefaultStoreDir = ".tombatools"
+
+	// storeObjectsDir holds the stored files, named by hash
+	storeObjectsDir = "objects"
+
+	// storeManifestFile lists the recorded builds
+	storeManifestFile = "manifest.yaml"
+
+	// missingInputHash is recorded for inputs that do not exist, such as an
+	// optional palette file, so creating them later changes the build key
+	missingInputHash = "missing"
+)
+
+// ArtifactFile is an input or output of a build with the hash of its content.
+// Directory inputs are hashed over the names and contents of all their files.
+type ArtifactFile struct {
+	Path string `yaml:"path" json:"path"`
+	Hash string `yaml:"hash" json:"hash"`
+	Size int64  `yaml:"size,omitempty" json:"size,omitempty"`
+}
+
+// ArtifactBuild is a recorded run of a build command
+type ArtifactBuild struct {
+	ID      int            `yaml:"id" json:"id"`
+	Command string         `yaml:"command" json:"command"`
+	Key     string         `yaml:"key" json:"key"`
+	Time    time.Time      `yaml:"time" json:"time"`
+	Options []string       `yaml:"options,omitempty" json:"options,omitempty"`
+	Inputs  []ArtifactFile `yaml:"inputs" json:"inputs"`
+	Outputs []ArtifactFile `yaml:"outputs" json:"outputs"`
+}
+
+// ArtifactManifest is the content of the store manifest
+type ArtifactManifest struct {
+	Builds []ArtifactBuild `yaml:"builds" json:"builds"`
+}
+
+// BuildRequest describes a build: the command, the options changing its result and
+// the paths it reads and writes
+type BuildRequest struct {
+	Command string
+	Options []string
+	Inputs  []string
+	Outputs []string
+}
+
+// ArtifactStore is an opened project artifact store
+type ArtifactStore struct {
+	dir      string
+	manifest ArtifactManifest
+}
+
+// InitArtifactStore creates the artifact store in a project directory, or opens the
+// existing one
+func InitArtifactStore(projectDir string) (*ArtifactStore, error) {
+	dir := filepath.Join(projectDir, DefaultStoreDir)
+	if err := os.MkdirAll(filepath.Join(dir, storeObjectsDir), 0755); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create artifact store: %w", err))
+	}
+	return openArtifactStore(dir)
+}
+
+// OpenArtifactStore opens the artifact store of a project directory. It returns nil
+// without an error when the project has no store.
+func OpenArtifactStore(projectDir string) (*ArtifactStore, error) {
+	dir := filepath.Join(projectDir, DefaultStoreDir)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, nil
+	}
+	return openArtifactStore(dir)
+}
+
+// openArtifactStore reads the manifest of the store in dir; a missing manifest is empty
+func openArtifactStore(dir string) (*ArtifactStore, error) {
+	store := &ArtifactStore{dir: dir}
+	data, err := os.ReadFile(filepath.Join(dir, storeManifestFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read store manifest: %w", err)
+	}
+	if err := yaml.Unmarshal(data, &store.manifest); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse store manifest: %w", err))
+	}
+	return store, nil
+}
+
+// Dir returns the store directory
+func (s *ArtifactStore) Dir() string {
+	return s.dir
+}
+
+// Builds returns the recorded builds, oldest first
+func (s *ArtifactStore) Builds() []ArtifactBuild {
+	return s.manifest.Builds
+}
+
+// Build returns the recorded build with the given ID, or nil
+func (s *ArtifactStore) Build(id int) *ArtifactBuild {
+	for i := range s.manifest.Builds {
+		if s.manifest.Builds[i].ID == id {
+			return &s.manifest.Builds[i]
+		}
+	}
+	return nil
+}
+
+// BuildKey hashes the inputs of a request and returns the key identifying its result:
+// the command, its options and the hash of every input
+func (s *ArtifactStore) BuildKey(request BuildRequest) (string, []ArtifactFile, error) {
+	inputs := make([]ArtifactFile, 0, len(request.Inputs))
+	hasher := sha256.New()
+	fmt.Fprintf(hasher, "command %s\n", request.Command)
+	for _, option := range request.Options {
+		fmt.Fprintf(hasher, "option %s\n", option)
+	}
+	for _, path := range request.Inputs {
+		input, err := hashArtifactInput(path)
+		if err != nil {
+			return "", nil, err
+		}
+		inputs = append(inputs, input)
+		fmt.Fprintf(hasher, "input %s %s\n", filepath.ToSlash(path), input.Hash)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), inputs, nil
+}
+
+// Lookup returns the latest build recorded under key for the same outputs whose
+// objects are all in the store, or nil
+func (s *ArtifactStore) Lookup(key string, outputs []string) *ArtifactBuild {
+	for i := len(s.manifest.Builds) - 1; i >= 0; i-- {
+		build := &s.manifest.Builds[i]
+		if build.Key == key && sameArtifactPaths(build.Outputs, outputs) && s.hasObjects(build.Outputs) {
+			return build
+		}
+	}
+	return nil
+}
+
+// Record stores the outputs of a finished build and adds the build to the manifest.
+// Outputs already in the store are not copied again.
+func (s *ArtifactStore) Record(request BuildRequest, key string, inputs []ArtifactFile) (*ArtifactBuild, error) {
+	build := ArtifactBuild{
+		ID:      s.nextID(),
+		Command: request.Command,
+		Key:     key,
+		Time:    time.Now().UTC().Truncate(time.Second),
+		Options: request.Options,
+		Inputs:  inputs,
+		Outputs: make([]ArtifactFile, 0, len(request.Outputs)),
+	}
+	for _, path := range request.Outputs {
+		output, err := s.Put(path)
+		if err != nil {
+			return nil, err
+		}
+		build.Outputs = append(build.Outputs, output)
+	}
+
+	s.manifest.Builds = append(s.manifest.Builds, build)
+	if err := s.save(); err != nil {
+		return nil, err
+	}
+	return &s.manifest.Builds[len(s.manifest.Builds)-1], nil
+}
+
+// Put copies a file into the store and returns its hash. A file whose content is
+// already stored is not copied again.
+func (s *ArtifactStore) Put(path string) (ArtifactFile, error) {
+	hash, size, err := hashFile(path)
+	if err != nil {
+		return ArtifactFile{}, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to hash %s: %w", path, err))
+	}
+	artifact := ArtifactFile{Path: filepath.ToSlash(path), Hash: hash, Size: size}
+
+	objectPath := s.objectPath(hash)
+	if _, err := os.Stat(objectPath); err == nil {
+		common.LogDebug("Object %s of %s already stored", hash[:12], path)
+		return artifact, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0755); err != nil {
+		return artifact, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create object directory: %w", err))
+	}
+	if err := copyFileAtomic(path, objectPath); err != nil {
+		return artifact, err
+	}
+	common.LogDebug("Stored %s as object %s", path, hash[:12])
+	return artifact, nil
+}
+
+// Checkout writes the outputs of a build back to their paths. Outputs that already
+// hold the stored content are left alone. It returns the number of files written.
+func (s *ArtifactStore) Checkout(build *ArtifactBuild) (int, error) {
+	if !s.hasObjects(build.Outputs) {
+		return 0, common.WithCategory(common.ErrCategoryInputNotFound,
+			fmt.Errorf("objects of build %d are missing from %s", build.ID, s.dir))
+	}
+
+	written := 0
+	for _, output := range build.Outputs {
+		path := filepath.FromSlash(output.Path)
+		if hash, _, err := hashFile(path); err == nil && hash == output.Hash {
+			continue
+		}
+		if err := copyFileAtomic(s.objectPath(output.Hash), path); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+// objectPath returns where the object with the given hash is stored
+func (s *ArtifactStore) objectPath(hash string) string {
+	return filepath.Join(s.dir, storeObjectsDir, hash[:2], hash[2:])
+}
+
+// hasObjects reports whether every file is in the store
+func (s *ArtifactStore) hasObjects(files []ArtifactFile) bool {
+	for _, file := range files {
+		if len(file.Hash) < 3 {
+			return false
+		}
+		if _, err := os.Stat(s.objectPath(file.Hash)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// nextID returns the ID of the next recorded build
+func (s *ArtifactStore) nextID() int {
+	next := 1
+	for _, build := range s.manifest.Builds {
+		if build.ID >= next {
+			next = build.ID + 1
+		}
+	}
+	return next
+}
+
+// save writes the manifest
+func (s *ArtifactStore) save() error {
+	data, err := yaml.Marshal(&s.manifest)
+	if err != nil {
+		return fmt.Errorf("failed to encode store manifest: %w", err)
+	}
+	file, err := common.CreateAtomic(filepath.Join(s.dir, storeManifestFile))
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create store manifest: %w", err))
+	}
+	defer file.Abort()
+	if _, err := file.Write(data); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write store manifest: %w", err))
+	}
+	return file.Commit()
+}
+
+// sameArtifactPaths reports whether files are exactly the given paths, in order
+func sameArtifactPaths(files []ArtifactFile, paths []string) bool {
+	if len(files) != len(paths) {
+		return false
+	}
+	for i, path := range paths {
+		if files[i].Path != filepath.ToSlash(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// hashArtifactInput hashes a build input: a file, a directory or a missing path
+func hashArtifactInput(path string) (ArtifactFile, error) {
+	input := ArtifactFile{Path: filepath.ToSlash(path)}
+	info, err := os.Stat(path)
+	switch {
+	case os.IsNotExist(err):
+		input.Hash = missingInputHash
+		return input, nil
+	case err != nil:
+		return input, fmt.Errorf("failed to stat %s: %w", path, err)
+	case info.IsDir():
+		input.Hash, input.Size, err = hashDirectory(path)
+	default:
+		input.Hash, input.Size, err = hashFile(path)
+	}
+	if err != nil {
+		return input, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return input, nil
+}
+
+// hashFile returns the SHA-256 hash and size of a file
+func hashFile(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, file)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), size, nil
+}
+
+// hashDirectory hashes the relative names and contents of the files of a directory
+// tree in sorted order, and returns their total size
+func hashDirectory(dir string) (string, int64, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", 0, err
+	}
+	sort.Strings(files)
+
+	hasher := sha256.New()
+	var total int64
+	for _, path := range files {
+		hash, size, err := hashFile(path)
+		if err != nil {
+			return "", 0, err
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			return "", 0, err
+		}
+		fmt.Fprintf(hasher, "%s %s\n", filepath.ToSlash(relative), hash)
+		total += size
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), total, nil
+}
+
+// copyFileAtomic copies source over target through a temporary file next to target
+func copyFileAtomic(source, target string) error {
+	input, err := os.Open(source)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open %s: %w", source, err))
+	}
+	defer input.Close()
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create directory of %s: %w", target, err))
+	}
+	output, err := common.CreateAtomic(target)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", target, err))
+	}
+	defer output.Abort()
+
+	if _, err := io.Copy(output, input); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", target, err))
+	}
+	return output.Commit()
+}
+
+// FormatBuildSummary returns a one-line description of a build for listings
+func FormatBuildSummary(build *ArtifactBuild) string {
+	outputs := make([]string, len(build.Outputs))
+	for i, output := range build.Outputs {
+		outputs[i] = output.Path
+	}
+	return fmt.Sprintf("#%d  %s  %-12s %s  %s", build.ID, build.Time.Local().Format("2006-01-02 15:04:05"),
+		build.Command, build.Key[:12], strings.Join(outputs, ", "))
+}
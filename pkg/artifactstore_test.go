@@ -0,0 +1,125 @@
+// Package pkg provides tests for the project artifact store
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeStoreTestFile writes a test file, creating its directory
+func writeStoreTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArtifactStore_RecordLookupCheckout(t *testing.T) {
+	dir := t.TempDir()
+	if store, err := OpenArtifactStore(dir); err != nil || store != nil {
+		t.Fatalf("OpenArtifactStore() without a store = %v, %v, want nil", store, err)
+	}
+	store, err := InitArtifactStore(dir)
+	if err != nil {
+		t.Fatalf("InitArtifactStore() failed: %v", err)
+	}
+
+	input := filepath.Join(dir, "dialogues.yaml")
+	fonts := filepath.Join(dir, "fonts")
+	output := filepath.Join(dir, "out.WFM")
+	writeStoreTestFile(t, input, "dialogues: []\n")
+	writeStoreTestFile(t, filepath.Join(fonts, "br", "8", "0041.png"), "A")
+
+	request := BuildRequest{Command: "tombatools wfm encode", Options: []string{"align=2048"},
+		Inputs: []string{input, fonts, filepath.Join(dir, DefaultPaletteFile)}, Outputs: []string{output}}
+	key, inputs, err := store.BuildKey(request)
+	if err != nil {
+		t.Fatalf("BuildKey() failed: %v", err)
+	}
+	if inputs[2].Hash != missingInputHash {
+		t.Errorf("missing palette file hash = %q, want %q", inputs[2].Hash, missingInputHash)
+	}
+	if store.Lookup(key, request.Outputs) != nil {
+		t.Fatal("Lookup() found a build in an empty store")
+	}
+
+	writeStoreTestFile(t, output, "first build")
+	first, err := store.Record(request, key, inputs)
+	if err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+
+	// A store reopened from the manifest finds the build for unchanged inputs
+	store, err = OpenArtifactStore(dir)
+	if err != nil || store == nil {
+		t.Fatalf("OpenArtifactStore() = %v, %v", store, err)
+	}
+	if again, _, _ := store.BuildKey(request); again != key {
+		t.Errorf("BuildKey() changed for unchanged inputs")
+	}
+	if found := store.Lookup(key, request.Outputs); found == nil || found.ID != first.ID {
+		t.Fatalf("Lookup() = %+v, want build %d", found, first.ID)
+	}
+
+	// Changing a font changes the key; the second build is stored next to the first
+	writeStoreTestFile(t, filepath.Join(fonts, "br", "8", "0041.png"), "A2")
+	secondKey, secondInputs, _ := store.BuildKey(request)
+	if secondKey == key {
+		t.Fatal("BuildKey() did not change with the fonts directory")
+	}
+	writeStoreTestFile(t, output, "second build")
+	if _, err := store.Record(request, secondKey, secondInputs); err != nil {
+		t.Fatalf("Record() failed: %v", err)
+	}
+
+	// Rolling back restores the first output; a repeated checkout writes nothing
+	written, err := store.Checkout(store.Build(first.ID))
+	if err != nil || written != 1 {
+		t.Fatalf("Checkout() = %d, %v, want 1 file", written, err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "first build" {
+		t.Errorf("checked out output = %q, want first build", data)
+	}
+	if written, _ := store.Checkout(store.Build(first.ID)); written != 0 {
+		t.Errorf("repeated Checkout() wrote %d files, want 0", written)
+	}
+}
+
+func TestArtifactStore_Deduplicates(t *testing.T) {
+	dir := t.TempDir()
+	store, err := InitArtifactStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := filepath.Join(dir, "A.GAM")
+	second := filepath.Join(dir, "B.GAM")
+	writeStoreTestFile(t, first, "same content")
+	writeStoreTestFile(t, second, "same content")
+	a, err := store.Put(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := store.Put(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Hash != b.Hash {
+		t.Fatalf("hashes differ for identical files: %s, %s", a.Hash, b.Hash)
+	}
+
+	objects := 0
+	filepath.WalkDir(filepath.Join(store.Dir(), storeObjectsDir), func(path string, entry os.DirEntry, err error) error {
+		if err == nil && entry.Type().IsRegular() {
+			objects++
+		}
+		return nil
+	})
+	if objects != 1 {
+		t.Errorf("store holds %d objects, want 1", objects)
+	}
+}
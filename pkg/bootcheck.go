@@ -0,0 +1,79 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the CD image boot check entry point and its report writers.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// CheckBoot validates license region, SYSTEM.CNF boot path and TOC sizes of a CD image
+func (p *CDFileProcessor) CheckBoot(imageFile string) (*psx.BootCheckReport, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	report, err := reader.CheckBoot()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check CD image: %w", err)
+	}
+
+	p.logger.Debug("Boot check of %s: %d issues (%d errors)", imageFile, len(report.Issues), report.ErrorCount())
+	return report, nil
+}
+
+// WriteBootCheckReport writes the report in the requested format (json or markdown)
+func WriteBootCheckReport(report *psx.BootCheckReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeBootCheckMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeBootCheckMarkdown renders the report as a markdown document
+func writeBootCheckMarkdown(report *psx.BootCheckReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Boot Check\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| System ID | %s |\n", report.SystemID))
+	sb.WriteString(fmt.Sprintf("| Volume ID | %s |\n", report.VolumeID))
+	sb.WriteString(fmt.Sprintf("| Volume sectors | %d |\n", report.VolumeSectors))
+	sb.WriteString(fmt.Sprintf("| Image sectors | %d |\n", report.ImageSectors))
+	sb.WriteString(fmt.Sprintf("| License region | %s |\n", report.LicenseRegion))
+	sb.WriteString(fmt.Sprintf("| Boot path | %s |\n", report.BootPath))
+	sb.WriteString(fmt.Sprintf("| Executable region | %s |\n", report.ExecutableRegion))
+	sb.WriteString(fmt.Sprintf("| Executable header region | %s |\n", report.ExeHeaderRegion))
+
+	sb.WriteString("\n## Issues\n\n")
+	if len(report.Issues) == 0 {
+		sb.WriteString("No issues found.\n")
+	} else {
+		sb.WriteString("| Severity | Check | Message |\n")
+		sb.WriteString("|----------|-------|---------|\n")
+		for _, issue := range report.Issues {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", issue.Severity, issue.Check, issue.Message))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,399 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the on-disk layout comparison of two CD images: every file is matched
+// by path (or, when renamed, by content hash) and reported as added, removed, renamed,
+// moved, resized or changed, next to a summary of the raw sectors that differ.
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// Changes reported for a file by the CD diff
+const (
+	CDDiffAdded   = "added"   // Only in the modified image
+	CDDiffRemoved = "removed" // Only in the original image
+	CDDiffRenamed = "renamed" // Same contents under another path
+	CDDiffMoved   = "moved"   // Starts at another LBA
+	CDDiffResized = "resized" // Size differs
+	CDDiffChanged = "changed" // Same size, different contents
+)
+
+// cdDiffCancelCheckInterval is the number of sectors compared between cancellation checks
+const cdDiffCancelCheckInterval = 4096
+
+// CDDiffFile is a file that differs between two CD images
+type CDDiffFile struct {
+	Path           string   `json:"path"`
+	OriginalPath   string   `json:"original_path,omitempty"` // Path in the original image of a renamed file
+	Changes        []string `json:"changes"`
+	OriginalLBA    uint32   `json:"original_lba,omitempty"`
+	ModifiedLBA    uint32   `json:"modified_lba,omitempty"`
+	OriginalSize   uint32   `json:"original_size,omitempty"`
+	ModifiedSize   uint32   `json:"modified_size,omitempty"`
+	OriginalSHA256 string   `json:"original_sha256,omitempty"`
+	ModifiedSHA256 string   `json:"modified_sha256,omitempty"`
+}
+
+// CDSectorRange is a run of consecutive sectors
+type CDSectorRange struct {
+	FirstLBA uint32 `json:"first_lba"`
+	Sectors  uint32 `json:"sectors"`
+}
+
+// CDDiffSummary counts the differences between two CD images
+type CDDiffSummary struct {
+	Added           int   `json:"added"`
+	Removed         int   `json:"removed"`
+	Renamed         int   `json:"renamed"`
+	Moved           int   `json:"moved"`
+	Resized         int   `json:"resized"`
+	Changed         int   `json:"changed"`
+	Unchanged       int   `json:"unchanged"`
+	OriginalSectors int64 `json:"original_sectors"`
+	ModifiedSectors int64 `json:"modified_sectors"`
+	ChangedSectors  int64 `json:"changed_sectors"` // Sectors present in both images whose contents differ
+}
+
+// CDDiffReport lists the files and sectors that differ between two CD images
+type CDDiffReport struct {
+	Original     string          `json:"original"`
+	Modified     string          `json:"modified"`
+	Summary      CDDiffSummary   `json:"summary"`
+	Files        []CDDiffFile    `json:"files"`
+	SectorRanges []CDSectorRange `json:"sector_ranges"` // Runs of changed sectors present in both images
+}
+
+// cdDiffEntry is a file of one image and the hash of its contents
+type cdDiffEntry struct {
+	entry psx.CDFileEntry
+	hash  string
+}
+
+// Diff compares the files and raw sectors of two CD images. Files present in both images
+// are matched by path; a removed file and an added file with the same contents are
+// reported as a rename. Resized files are not also reported as changed.
+func (p *CDFileProcessor) Diff(ctx context.Context, originalFile, modifiedFile string) (*CDDiffReport, error) {
+	originalEntries, originalGeometry, originalSectors, err := hashCDFiles(ctx, originalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original CD image: %w", err)
+	}
+	modifiedEntries, modifiedGeometry, modifiedSectors, err := hashCDFiles(ctx, modifiedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read modified CD image: %w", err)
+	}
+
+	report := &CDDiffReport{
+		Original: originalFile,
+		Modified: modifiedFile,
+		Summary:  CDDiffSummary{OriginalSectors: originalSectors, ModifiedSectors: modifiedSectors},
+	}
+
+	modifiedByPath := make(map[string]cdDiffEntry, len(modifiedEntries))
+	for _, modified := range modifiedEntries {
+		modifiedByPath[modified.entry.Path] = modified
+	}
+
+	removed := make(map[string][]cdDiffEntry)
+	for _, original := range originalEntries {
+		modified, found := modifiedByPath[original.entry.Path]
+		if !found {
+			removed[original.hash] = append(removed[original.hash], original)
+			continue
+		}
+		delete(modifiedByPath, original.entry.Path)
+		if file, differs := diffCDFile(original, modified); differs {
+			report.Files = append(report.Files, file)
+		} else {
+			report.Summary.Unchanged++
+		}
+	}
+
+	// The remaining modified files are added, or renamed when a removed file has the same contents
+	for _, modified := range modifiedEntries {
+		if _, added := modifiedByPath[modified.entry.Path]; !added {
+			continue
+		}
+		if candidates := removed[modified.hash]; len(candidates) > 0 {
+			removed[modified.hash] = candidates[1:]
+			file, _ := diffCDFile(candidates[0], modified)
+			file.OriginalPath = candidates[0].entry.Path
+			file.Changes = append([]string{CDDiffRenamed}, file.Changes...)
+			report.Files = append(report.Files, file)
+			continue
+		}
+		report.Files = append(report.Files, CDDiffFile{
+			Path:           modified.entry.Path,
+			Changes:        []string{CDDiffAdded},
+			ModifiedLBA:    modified.entry.LBA,
+			ModifiedSize:   modified.entry.Size,
+			ModifiedSHA256: modified.hash,
+		})
+	}
+	for _, candidates := range removed {
+		for _, original := range candidates {
+			report.Files = append(report.Files, CDDiffFile{
+				Path:           original.entry.Path,
+				Changes:        []string{CDDiffRemoved},
+				OriginalLBA:    original.entry.LBA,
+				OriginalSize:   original.entry.Size,
+				OriginalSHA256: original.hash,
+			})
+		}
+	}
+
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Path < report.Files[j].Path
+	})
+	for _, file := range report.Files {
+		report.Summary.count(file.Changes)
+	}
+
+	report.SectorRanges, report.Summary.ChangedSectors, err = diffCDSectors(ctx, originalFile, modifiedFile, originalGeometry, modifiedGeometry)
+	if err != nil {
+		return nil, err
+	}
+
+	p.logger.Debug("CD diff of %s and %s: %d files differ, %d sectors changed",
+		originalFile, modifiedFile, len(report.Files), report.Summary.ChangedSectors)
+	return report, nil
+}
+
+// count adds the changes of a file to the summary
+func (s *CDDiffSummary) count(changes []string) {
+	for _, change := range changes {
+		switch change {
+		case CDDiffAdded:
+			s.Added++
+		case CDDiffRemoved:
+			s.Removed++
+		case CDDiffRenamed:
+			s.Renamed++
+		case CDDiffMoved:
+			s.Moved++
+		case CDDiffResized:
+			s.Resized++
+		case CDDiffChanged:
+			s.Changed++
+		}
+	}
+}
+
+// diffCDFile compares a file of the original image with its counterpart in the modified image
+func diffCDFile(original, modified cdDiffEntry) (CDDiffFile, bool) {
+	file := CDDiffFile{
+		Path:           modified.entry.Path,
+		OriginalLBA:    original.entry.LBA,
+		ModifiedLBA:    modified.entry.LBA,
+		OriginalSize:   original.entry.Size,
+		ModifiedSize:   modified.entry.Size,
+		OriginalSHA256: original.hash,
+		ModifiedSHA256: modified.hash,
+	}
+	if original.entry.LBA != modified.entry.LBA {
+		file.Changes = append(file.Changes, CDDiffMoved)
+	}
+	if original.entry.Size != modified.entry.Size {
+		file.Changes = append(file.Changes, CDDiffResized)
+	} else if original.hash != modified.hash {
+		file.Changes = append(file.Changes, CDDiffChanged)
+	}
+	return file, len(file.Changes) > 0
+}
+
+// hashCDFiles lists the files of a CD image with the SHA-256 of their contents, and
+// returns the sector geometry and number of sectors of the image
+func hashCDFiles(ctx context.Context, imageFile string) ([]cdDiffEntry, psx.SectorGeometry, int64, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, psx.SectorGeometry{}, 0, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	if err := reader.ValidateISO9660(); err != nil {
+		return nil, psx.SectorGeometry{}, 0, fmt.Errorf("invalid ISO9660 image: %w", err)
+	}
+
+	files, err := reader.ListFiles()
+	if err != nil {
+		return nil, psx.SectorGeometry{}, 0, fmt.Errorf("failed to list files: %w", err)
+	}
+
+	entries := make([]cdDiffEntry, 0, len(files))
+	for _, file := range files {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, psx.SectorGeometry{}, 0, err
+		}
+		hasher := sha256.New()
+		if err := reader.CopyEntry(file, hasher); err != nil {
+			return nil, psx.SectorGeometry{}, 0, fmt.Errorf("failed to read %s: %w", file.Path, err)
+		}
+		entries = append(entries, cdDiffEntry{entry: file, hash: hex.EncodeToString(hasher.Sum(nil))})
+	}
+
+	return entries, reader.Geometry(), reader.TotalSectors(), nil
+}
+
+// diffCDSectors compares the sectors present in both images and returns the runs of
+// sectors that differ and their total count. Images of the same geometry are compared
+// byte for byte; otherwise only the user data of each sector is compared.
+func diffCDSectors(ctx context.Context, originalFile, modifiedFile string, originalGeometry, modifiedGeometry psx.SectorGeometry) ([]CDSectorRange, int64, error) {
+	original, err := psx.OpenImage(originalFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open original CD image: %w", err)
+	}
+	defer original.Close()
+
+	modified, err := psx.OpenImage(modifiedFile)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open modified CD image: %w", err)
+	}
+	defer modified.Close()
+
+	originalReader := bufio.NewReader(io.NewSectionReader(original, 0, original.Size()))
+	modifiedReader := bufio.NewReader(io.NewSectionReader(modified, 0, modified.Size()))
+	originalSector := make([]byte, originalGeometry.SectorSize)
+	modifiedSector := make([]byte, modifiedGeometry.SectorSize)
+	originalData, modifiedData := originalSector, modifiedSector
+	if originalGeometry != modifiedGeometry {
+		originalData = originalSector[originalGeometry.DataOffset : originalGeometry.DataOffset+psx.CD_DATA_SIZE]
+		modifiedData = modifiedSector[modifiedGeometry.DataOffset : modifiedGeometry.DataOffset+psx.CD_DATA_SIZE]
+	}
+
+	var ranges []CDSectorRange
+	var changed int64
+	for lba := uint32(0); ; lba++ {
+		if lba%cdDiffCancelCheckInterval == 0 {
+			if err := common.Canceled(ctx); err != nil {
+				return nil, 0, err
+			}
+		}
+
+		if _, err := io.ReadFull(originalReader, originalSector); err != nil {
+			break
+		}
+		if _, err := io.ReadFull(modifiedReader, modifiedSector); err != nil {
+			break
+		}
+		if bytes.Equal(originalData, modifiedData) {
+			continue
+		}
+
+		changed++
+		if last := len(ranges) - 1; last >= 0 && ranges[last].FirstLBA+ranges[last].Sectors == lba {
+			ranges[last].Sectors++
+		} else {
+			ranges = append(ranges, CDSectorRange{FirstLBA: lba, Sectors: 1})
+		}
+	}
+
+	return ranges, changed, nil
+}
+
+// WriteCDDiffReport writes the report in the requested format (json or markdown)
+func WriteCDDiffReport(report *CDDiffReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeCDDiffMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeCDDiffMarkdown renders the report as a markdown document
+func writeCDDiffMarkdown(report *CDDiffReport, writer io.Writer) error {
+	var sb strings.Builder
+	summary := report.Summary
+
+	sb.WriteString("# CD Diff\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Original | %s |\n", report.Original))
+	sb.WriteString(fmt.Sprintf("| Modified | %s |\n", report.Modified))
+	sb.WriteString(fmt.Sprintf("| Added | %d |\n", summary.Added))
+	sb.WriteString(fmt.Sprintf("| Removed | %d |\n", summary.Removed))
+	sb.WriteString(fmt.Sprintf("| Renamed | %d |\n", summary.Renamed))
+	sb.WriteString(fmt.Sprintf("| Moved | %d |\n", summary.Moved))
+	sb.WriteString(fmt.Sprintf("| Resized | %d |\n", summary.Resized))
+	sb.WriteString(fmt.Sprintf("| Changed | %d |\n", summary.Changed))
+	sb.WriteString(fmt.Sprintf("| Unchanged | %d |\n", summary.Unchanged))
+	sb.WriteString(fmt.Sprintf("| Original sectors | %d |\n", summary.OriginalSectors))
+	sb.WriteString(fmt.Sprintf("| Modified sectors | %d |\n", summary.ModifiedSectors))
+	sb.WriteString(fmt.Sprintf("| Changed sectors | %d |\n", summary.ChangedSectors))
+
+	sb.WriteString("\n## Files\n\n")
+	if len(report.Files) == 0 {
+		sb.WriteString("No file differences found.\n")
+	} else {
+		sb.WriteString("| Path | Changes | LBA | Size | SHA-256 |\n")
+		sb.WriteString("|------|---------|-----|------|---------|\n")
+		for _, file := range report.Files {
+			path := file.Path
+			if file.OriginalPath != "" {
+				path = file.OriginalPath + " → " + file.Path
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s |\n",
+				path,
+				strings.Join(file.Changes, ", "),
+				cdDiffValue(file.Changes, fmt.Sprint(file.OriginalLBA), fmt.Sprint(file.ModifiedLBA)),
+				cdDiffValue(file.Changes, fmt.Sprint(file.OriginalSize), fmt.Sprint(file.ModifiedSize)),
+				cdDiffValue(file.Changes, shortHash(file.OriginalSHA256), shortHash(file.ModifiedSHA256))))
+		}
+	}
+
+	sb.WriteString("\n## Changed Sectors\n\n")
+	if len(report.SectorRanges) == 0 {
+		sb.WriteString("No sector differences found.\n")
+	} else {
+		sb.WriteString("| LBA | MSF | Sectors |\n")
+		sb.WriteString("|-----|-----|---------|\n")
+		for _, sectorRange := range report.SectorRanges {
+			sb.WriteString(fmt.Sprintf("| %d | %s | %d |\n",
+				sectorRange.FirstLBA, psx.LBAToMSF(sectorRange.FirstLBA), sectorRange.Sectors))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
+
+// cdDiffValue formats the original and modified values of a field: a single value when
+// they are equal or only one image holds the file, "original → modified" otherwise
+func cdDiffValue(changes []string, original, modified string) string {
+	switch {
+	case changes[0] == CDDiffAdded:
+		return modified
+	case changes[0] == CDDiffRemoved, original == modified:
+		return original
+	default:
+		return original + " → " + modified
+	}
+}
+
+// shortHash abbreviates a hex hash for display
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
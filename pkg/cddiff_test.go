@@ -0,0 +1,84 @@
+// Package pkg provides tests for the CD image layout comparison
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCDFileProcessor_Diff(t *testing.T) {
+	dir := t.TempDir()
+	filled := func(size int, value byte) []byte {
+		return bytes.Repeat([]byte{value}, size)
+	}
+
+	originalImage := filepath.Join(dir, "original.bin")
+	writeSyntheticDisc(t, originalImage, []discFile{
+		{dir: "DATA", name: "SAME.BIN", data: filled(100, 1)},
+		{dir: "DATA", name: "GROW.BIN", data: filled(1000, 2)},
+		{dir: "DATA", name: "EDIT.BIN", data: filled(1000, 3)},
+		{dir: "DATA", name: "OLD.BIN", data: filled(500, 4)},
+		{dir: "DATA", name: "GONE.BIN", data: filled(500, 5)},
+	})
+
+	// GROW.BIN takes a second sector and pushes every later file by one
+	modifiedImage := filepath.Join(dir, "modified.bin")
+	writeSyntheticDisc(t, modifiedImage, []discFile{
+		{dir: "DATA", name: "SAME.BIN", data: filled(100, 1)},
+		{dir: "DATA", name: "GROW.BIN", data: filled(3000, 2)},
+		{dir: "DATA", name: "EDIT.BIN", data: filled(1000, 6)},
+		{dir: "DATA", name: "NEW.BIN", data: filled(500, 4)},
+		{dir: "EXE", name: "ADDED.BIN", data: filled(10, 7)},
+	})
+
+	report, err := NewCDProcessor().Diff(context.Background(), originalImage, modifiedImage)
+	if err != nil {
+		t.Fatalf("Diff() failed: %v", err)
+	}
+
+	want := map[string][]string{
+		"DATA/EDIT.BIN": {CDDiffMoved, CDDiffChanged},
+		"DATA/GONE.BIN": {CDDiffRemoved},
+		"DATA/GROW.BIN": {CDDiffResized},
+		"DATA/NEW.BIN":  {CDDiffRenamed, CDDiffMoved},
+		"EXE/ADDED.BIN": {CDDiffAdded},
+	}
+	got := make(map[string][]string, len(report.Files))
+	for _, file := range report.Files {
+		got[file.Path] = file.Changes
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() changes = %v, want %v", got, want)
+	}
+
+	summary := report.Summary
+	if summary.Unchanged != 1 || summary.Moved != 2 || summary.Renamed != 1 || summary.Added != 1 || summary.Removed != 1 {
+		t.Errorf("Diff() summary = %+v, want 1 unchanged, 2 moved, 1 renamed, 1 added and 1 removed", summary)
+	}
+	if summary.ModifiedSectors != summary.OriginalSectors+1 {
+		t.Errorf("Diff() sectors = %d → %d, want one more sector", summary.OriginalSectors, summary.ModifiedSectors)
+	}
+	if summary.ChangedSectors == 0 || len(report.SectorRanges) == 0 {
+		t.Errorf("Diff() found no changed sectors")
+	}
+
+	var markdown bytes.Buffer
+	if err := WriteCDDiffReport(report, ReportFormatMarkdown, &markdown); err != nil {
+		t.Fatalf("WriteCDDiffReport() failed: %v", err)
+	}
+	if !strings.Contains(markdown.String(), "DATA/OLD.BIN → DATA/NEW.BIN") {
+		t.Errorf("markdown report does not show the rename:\n%s", markdown.String())
+	}
+
+	same, err := NewCDProcessor().Diff(context.Background(), originalImage, originalImage)
+	if err != nil {
+		t.Fatalf("Diff(same) failed: %v", err)
+	}
+	if len(same.Files) != 0 || same.Summary.ChangedSectors != 0 || same.Summary.Unchanged != 5 {
+		t.Errorf("Diff(same) = %+v, want no differences", same)
+	}
+}
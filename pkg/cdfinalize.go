@@ -0,0 +1,78 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the CD image finalization entry point and its report writers.
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// FinalizeImage completes the last sector of a plain CD image, optionally pads it to a
+// standard disc length and sets its volume space size to the sectors of the image
+func (p *CDFileProcessor) FinalizeImage(ctx context.Context, imageFile string, options psx.FinalizeOptions) (*psx.FinalizeReport, error) {
+	report, err := psx.FinalizeImage(ctx, imageFile, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to finalize CD image: %w", err)
+	}
+
+	p.logger.Debug("Finalized %s: %d -> %d sectors, volume %d -> %d sectors", imageFile,
+		report.ImageSectorsBefore, report.ImageSectors, report.VolumeSectorsBefore, report.VolumeSectors)
+	return report, nil
+}
+
+// WriteFinalizeReport writes the report in the requested format (json or markdown)
+func WriteFinalizeReport(report *psx.FinalizeReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeFinalizeMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeFinalizeMarkdown renders the report as a markdown document
+func writeFinalizeMarkdown(report *psx.FinalizeReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	title := "Image Finalization"
+	if report.DryRun {
+		title += " (dry run)"
+	}
+	sb.WriteString(fmt.Sprintf("# %s\n\n", title))
+	sb.WriteString("| Field | Before | After |\n")
+	sb.WriteString("|-------|--------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Image sectors | %d | %d |\n", report.ImageSectorsBefore, report.ImageSectors))
+	sb.WriteString(fmt.Sprintf("| Volume space size | %d | %d |\n", report.VolumeSectorsBefore, report.VolumeSectors))
+	sb.WriteString(fmt.Sprintf("\nGeometry: %s\n", report.Geometry))
+
+	sb.WriteString("\n## Corrections\n\n")
+	if !report.Changed() {
+		sb.WriteString("None; the image is already final.\n")
+	}
+	if report.TrailingBytes > 0 {
+		sb.WriteString(fmt.Sprintf("- Incomplete last sector (%d bytes) completed\n", report.TrailingBytes))
+	}
+	if report.PaddingSectors > 0 {
+		sb.WriteString(fmt.Sprintf("- %d empty sectors appended\n", report.PaddingSectors))
+	}
+	if report.VolumeSectors != report.VolumeSectorsBefore {
+		sb.WriteString(fmt.Sprintf("- Volume space size set to %d sectors\n", report.VolumeSectors))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the safety checks applied while extracting files from CD images:
+// output path containment, per-file and total size caps, and overlapping extent detection.
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// Default CD extraction limits
+const (
+	DefaultMaxExtractFileSize    = 700 * 1024 * 1024 // Largest file accepted from a CD image
+	DefaultExtractTotalSizeRatio = 2                 // Total output cap as a multiple of the image data size
+)
+
+// extractedExtent records the sectors read for an extracted file
+type extractedExtent struct {
+	path      string
+	firstLBA  uint32
+	endLBA    uint32 // Exclusive
+	entrySize uint32
+}
+
+// extractionGuard enforces the extraction limits for a single dump operation
+type extractionGuard struct {
+	outputDir    string
+	imageSectors int64
+	maxFileSize  int64
+	maxTotalSize int64
+	totalSize    int64
+	extents      []extractedExtent
+	batch        *common.AtomicBatch // Files extracted so far, committed together once the dump completes
+	sources      map[string]string   // Extracted files relative to the output directory, by ISO9660 path
+	logger       *common.Logger
+}
+
+// SetExtractionLimits configures the per-file and total size caps of Dump (0 selects the default)
+func (p *CDFileProcessor) SetExtractionLimits(maxFileSize, maxTotalSize int64) error {
+	if maxFileSize < 0 || maxTotalSize < 0 {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid extraction limits %d/%d: must not be negative", maxFileSize, maxTotalSize))
+	}
+	p.maxFileSize = maxFileSize
+	p.maxTotalSize = maxTotalSize
+	return nil
+}
+
+// newExtractionGuard creates the guard for extracting from the given reader into outputDir
+func (p *CDFileProcessor) newExtractionGuard(reader *psx.CDReader, outputDir string) *extractionGuard {
+	guard := &extractionGuard{
+		outputDir:    filepath.Clean(outputDir),
+		imageSectors: reader.TotalSectors(),
+		maxFileSize:  p.maxFileSize,
+		maxTotalSize: p.maxTotalSize,
+		batch:        common.NewAtomicBatch(),
+		logger:       p.logger,
+	}
+	if guard.maxFileSize == 0 {
+		guard.maxFileSize = DefaultMaxExtractFileSize
+	}
+	if guard.maxTotalSize == 0 {
+		guard.maxTotalSize = guard.imageSectors * psx.CD_DATA_SIZE * DefaultExtractTotalSizeRatio
+	}
+	return guard
+}
+
+// outputPath joins CD path components below the output directory, rejecting
+// absolute paths and ".." components that would escape it
+func (g *extractionGuard) outputPath(components ...string) (string, error) {
+	for _, component := range components {
+		normalized := strings.ReplaceAll(component, "\\", "/")
+		if normalized == "" || strings.HasPrefix(normalized, "/") || filepath.IsAbs(component) {
+			return "", fmt.Errorf("unsafe CD path %q", strings.Join(components, "/"))
+		}
+		for _, part := range strings.Split(normalized, "/") {
+			if part == ".." {
+				return "", fmt.Errorf("unsafe CD path %q", strings.Join(components, "/"))
+			}
+		}
+	}
+
+	outputPath := filepath.Join(append([]string{g.outputDir}, components...)...)
+	relative, err := filepath.Rel(g.outputDir, outputPath)
+	if err != nil || relative == "." || strings.HasPrefix(relative, ".."+string(filepath.Separator)) || relative == ".." {
+		return "", fmt.Errorf("CD path %q escapes the output directory", strings.Join(components, "/"))
+	}
+	return outputPath, nil
+}
+
+// admit checks a file against the image bounds and size caps and records its extents
+func (g *extractionGuard) admit(entry psx.CDFileEntry, displayPath string) error {
+	if int64(entry.Size) > g.maxFileSize {
+		return fmt.Errorf("%s is %d bytes, above the %d byte per-file limit", displayPath, entry.Size, g.maxFileSize)
+	}
+
+	for _, extent := range entry.Extents {
+		endLBA := int64(extent.LBA) + int64(psx.DataSectors(extent.Size))
+		if endLBA > g.imageSectors {
+			return fmt.Errorf("%s extent at LBA %d (%d bytes) extends beyond the image (%d sectors)",
+				displayPath, extent.LBA, extent.Size, g.imageSectors)
+		}
+	}
+
+	if g.totalSize+int64(entry.Size) > g.maxTotalSize {
+		return fmt.Errorf("extracting %s would exceed the %d byte total size limit", displayPath, g.maxTotalSize)
+	}
+	g.totalSize += int64(entry.Size)
+
+	for _, extent := range entry.Extents {
+		g.extents = append(g.extents, extractedExtent{
+			path:      displayPath,
+			firstLBA:  extent.LBA,
+			endLBA:    extent.LBA + psx.DataSectors(extent.Size),
+			entrySize: extent.Size,
+		})
+	}
+	return nil
+}
+
+// recordSource remembers the output path of an extracted file by its ISO9660 path. The
+// components are the directories and the output name of the file below the output directory.
+func (g *extractionGuard) recordSource(file psx.CDFileEntry, outputPath string, components ...string) {
+	relative, err := filepath.Rel(g.outputDir, outputPath)
+	if err != nil {
+		return
+	}
+	if g.sources == nil {
+		g.sources = make(map[string]string)
+	}
+	isoPath := path.Join(append(components[:len(components)-1:len(components)-1], file.Name)...)
+	g.sources[isoPath] = filepath.ToSlash(relative)
+}
+
+// commit makes the files extracted so far permanent, syncing each output directory once
+func (g *extractionGuard) commit() error {
+	return g.batch.Commit()
+}
+
+// rollback undoes the files extracted so far when a dump is interrupted: new files are
+// removed, with their directories once empty, and the files they replaced are restored
+func (g *extractionGuard) rollback() {
+	extracted := g.batch.Paths()
+	g.batch.Rollback()
+	for i := len(extracted) - 1; i >= 0; i-- {
+		for dir := filepath.Dir(extracted[i]); dir != g.outputDir && strings.HasPrefix(dir, g.outputDir); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	g.logger.Debug("Rolled back %d extracted files", len(extracted))
+}
+
+// overlaps returns a description of every pair of extracted files sharing sectors
+func (g *extractionGuard) overlaps() []string {
+	extents := make([]extractedExtent, len(g.extents))
+	copy(extents, g.extents)
+	sort.Slice(extents, func(i, j int) bool {
+		return extents[i].firstLBA < extents[j].firstLBA
+	})
+
+	var overlaps []string
+	for i := range extents {
+		for j := i + 1; j < len(extents) && extents[j].firstLBA < extents[i].endLBA; j++ {
+			if extents[i].path == extents[j].path {
+				continue
+			}
+			overlaps = append(overlaps, fmt.Sprintf("%s (LBA %d-%d) overlaps %s (LBA %d-%d)",
+				extents[i].path, extents[i].firstLBA, extents[i].endLBA-1,
+				extents[j].path, extents[j].firstLBA, extents[j].endLBA-1))
+		}
+	}
+	return overlaps
+}
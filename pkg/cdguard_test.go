@@ -0,0 +1,157 @@
+// Package pkg provides tests for CD extraction safety checks
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// newTestGuard creates an extraction guard for a 100-sector image
+func newTestGuard(maxFileSize, maxTotalSize int64) *extractionGuard {
+	return &extractionGuard{
+		outputDir:    filepath.Clean("out"),
+		imageSectors: 100,
+		maxFileSize:  maxFileSize,
+		maxTotalSize: maxTotalSize,
+	}
+}
+
+// testEntry creates a single-extent file entry
+func testEntry(lba, size uint32) psx.CDFileEntry {
+	return psx.CDFileEntry{LBA: lba, Size: size, Extents: []psx.CDFileExtent{{LBA: lba, Size: size}}}
+}
+
+func TestExtractionGuard_OutputPath(t *testing.T) {
+	tests := []struct {
+		name       string
+		components []string
+		wantErr    bool
+	}{
+		{"plain file", []string{"SYSTEM.CNF"}, false},
+		{"subdirectory", []string{"DATA", "GAME.GAM"}, false},
+		{"parent reference", []string{"..", "evil.txt"}, true},
+		{"embedded parent", []string{"DATA", "../../evil.txt"}, true},
+		{"backslash parent", []string{"..\\evil.txt"}, true},
+		{"absolute", []string{"/etc/passwd"}, true},
+		{"empty", []string{""}, true},
+	}
+
+	guard := newTestGuard(DefaultMaxExtractFileSize, 1<<30)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path, err := guard.outputPath(tt.components...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("outputPath(%q) error = %v, wantErr %v", tt.components, err, tt.wantErr)
+			}
+			if err == nil && !strings.HasPrefix(path, guard.outputDir+string(filepath.Separator)) {
+				t.Errorf("outputPath(%q) = %q, want a path inside %q", tt.components, path, guard.outputDir)
+			}
+		})
+	}
+}
+
+func TestExtractionGuard_Admit(t *testing.T) {
+	guard := newTestGuard(10000, 12000)
+
+	if err := guard.admit(testEntry(20, 8000), "A.DAT"); err != nil {
+		t.Fatalf("admit(A.DAT) failed: %v", err)
+	}
+	if err := guard.admit(testEntry(30, 20000), "BIG.DAT"); err == nil {
+		t.Error("admit() should reject files above the per-file limit")
+	}
+	if err := guard.admit(testEntry(99, 4096), "END.DAT"); err == nil {
+		t.Error("admit() should reject extents beyond the image end")
+	}
+	if err := guard.admit(testEntry(40, 5000), "C.DAT"); err == nil {
+		t.Error("admit() should reject files exceeding the total size limit")
+	}
+	if guard.totalSize != 8000 {
+		t.Errorf("totalSize = %d, want 8000", guard.totalSize)
+	}
+}
+
+func TestExtractionGuard_Overlaps(t *testing.T) {
+	guard := newTestGuard(DefaultMaxExtractFileSize, 1<<30)
+	for _, file := range []struct {
+		path string
+		lba  uint32
+		size uint32
+	}{
+		{"A.DAT", 20, 3 * 2048}, // LBA 20-22
+		{"B.DAT", 22, 2048},     // LBA 22, shared with A.DAT
+		{"C.DAT", 23, 2048},     // LBA 23, no overlap
+	} {
+		if err := guard.admit(testEntry(file.lba, file.size), file.path); err != nil {
+			t.Fatalf("admit(%s) failed: %v", file.path, err)
+		}
+	}
+
+	overlaps := guard.overlaps()
+	if len(overlaps) != 1 || !strings.Contains(overlaps[0], "A.DAT") || !strings.Contains(overlaps[0], "B.DAT") {
+		t.Errorf("overlaps() = %q, want one overlap between A.DAT and B.DAT", overlaps)
+	}
+}
+
+func TestExtractionGuard_Rollback(t *testing.T) {
+	outputDir := t.TempDir()
+	previous := filepath.Join(outputDir, "SYSTEM.CNF")
+	if err := os.WriteFile(previous, []byte("previous dump"), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", previous, err)
+	}
+
+	guard := &extractionGuard{outputDir: outputDir, batch: common.NewAtomicBatch()}
+	for _, name := range []string{"SYSTEM.CNF", "DATA/ITEM.GAM", "DATA/FONT.WFM"} {
+		path := filepath.Join(outputDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+		file, err := guard.batch.Create(path)
+		if err != nil {
+			t.Fatalf("Create(%s) failed: %v", name, err)
+		}
+		if _, err := file.WriteString(name); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+		if err := file.Commit(); err != nil {
+			t.Fatalf("Commit(%s) failed: %v", name, err)
+		}
+	}
+
+	guard.rollback()
+
+	// The new files and their directory are gone; the file of the previous dump is back
+	entries, err := os.ReadDir(outputDir)
+	if err != nil {
+		t.Fatalf("output directory removed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "SYSTEM.CNF" {
+		t.Errorf("output directory holds %v after rollback, want only SYSTEM.CNF", entries)
+	}
+	if data, err := os.ReadFile(previous); err != nil || string(data) != "previous dump" {
+		t.Errorf("SYSTEM.CNF = %q, %v after rollback, want the previous dump restored", data, err)
+	}
+}
+
+func TestCDFileProcessor_Dump_Canceled(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "disc.bin")
+	writeSyntheticDisc(t, imagePath, []discFile{{dir: "DATA", name: "ITEM.GAM", data: make([]byte, 100)}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	outputDir := filepath.Join(dir, "out")
+	err := NewCDProcessor().Dump(ctx, imagePath, outputDir)
+	if common.ExitCodeFor(err) != common.ExitAborted {
+		t.Fatalf("Dump() = %v, want aborted error", err)
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("output directory has %d entries, want 0", len(entries))
+	}
+}
@@ -0,0 +1,68 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the layout manifest of cd dump: the position, size and XA attributes
+// of every directory, file and gap of the image, with the dumped file of each file entry,
+// written as YAML or XML so a rebuild can reproduce the original layout.
+package pkg
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// SetLayoutManifest makes Dump write the layout manifest of the image to manifestFile
+// (empty disables): XML for a .xml file, YAML otherwise. sourceRoot is the dump directory
+// or archive the manifest names, to which every source path is relative.
+func (p *CDFileProcessor) SetLayoutManifest(manifestFile, sourceRoot string) {
+	p.layoutFile = manifestFile
+	p.layoutSourceRoot = sourceRoot
+}
+
+// writeLayoutManifest reads the layout of the image and writes it with the dumped file of
+// every extracted file entry
+func (p *CDFileProcessor) writeLayoutManifest(reader *psx.CDReader, sources map[string]string) error {
+	layout, err := reader.ReadLayout()
+	if err != nil {
+		return fmt.Errorf("failed to read disc layout: %w", err)
+	}
+	layout.SourceRoot = p.layoutSourceRoot
+	for i := range layout.Entries {
+		if layout.Entries[i].Kind == psx.LayoutEntryFile {
+			layout.Entries[i].Source = sources[layout.Entries[i].Path]
+		}
+	}
+
+	var data bytes.Buffer
+	if strings.EqualFold(filepath.Ext(p.layoutFile), ".xml") {
+		data.WriteString(xml.Header)
+		encoder := xml.NewEncoder(&data)
+		encoder.Indent("", "  ")
+		if err := encoder.Encode(layout); err != nil {
+			return fmt.Errorf("failed to encode layout manifest: %w", err)
+		}
+		data.WriteByte('\n')
+	} else {
+		encoder := yaml.NewEncoder(&data)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(layout); err != nil {
+			return fmt.Errorf("failed to encode layout manifest: %w", err)
+		}
+	}
+
+	file, err := common.CreateAtomic(p.layoutFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create layout manifest: %w", err))
+	}
+	defer file.Abort()
+	if _, err := file.Write(data.Bytes()); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write layout manifest: %w", err))
+	}
+	p.logger.Debug("Layout manifest: %d entries", len(layout.Entries))
+	return file.Commit()
+}
@@ -0,0 +1,70 @@
+// Package pkg provides tests for the layout manifest of cd dump
+package pkg
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+func TestCDFileProcessor_Dump_LayoutManifest(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "disc.bin")
+	lbas := writeSyntheticDisc(t, imagePath, []discFile{{dir: "DATA", name: "ITEM.GAM", data: make([]byte, 100)}})
+	outputDir := filepath.Join(dir, "out")
+
+	for _, manifestName := range []string{"layout.yaml", "layout.xml"} {
+		processor := NewCDProcessor()
+		if err := processor.SetNameTemplate("{lba}_{name}"); err != nil {
+			t.Fatal(err)
+		}
+		manifestFile := filepath.Join(dir, manifestName)
+		processor.SetLayoutManifest(manifestFile, outputDir)
+		if err := processor.Dump(context.Background(), imagePath, outputDir); err != nil {
+			t.Fatalf("Dump() failed: %v", err)
+		}
+
+		data, err := os.ReadFile(manifestFile)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", manifestName, err)
+		}
+		var layout psx.DiscLayout
+		if filepath.Ext(manifestName) == ".xml" {
+			err = xml.Unmarshal(data, &layout)
+		} else {
+			err = yaml.Unmarshal(data, &layout)
+		}
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", manifestName, err)
+		}
+
+		if layout.SourceRoot != outputDir {
+			t.Errorf("%s: source_root = %q, want %q", manifestName, layout.SourceRoot, outputDir)
+		}
+		lba := lbas["DATA/ITEM.GAM"]
+		var found bool
+		for _, entry := range layout.Entries {
+			if entry.Path != "DATA/ITEM.GAM" {
+				continue
+			}
+			found = true
+			want := psx.LayoutEntry{
+				Kind: psx.LayoutEntryFile, Path: "DATA/ITEM.GAM", LBA: lba, MSF: psx.LBAToMSF(lba),
+				Sectors: 1, Size: 100, Type: psx.LayoutTypeData,
+				Source: "DATA/" + processor.nameTemplate.Name(0, psx.CDFileEntry{Name: "ITEM.GAM", LBA: lba}),
+			}
+			if entry.Kind != want.Kind || entry.LBA != want.LBA || entry.MSF != want.MSF || entry.Sectors != want.Sectors ||
+				entry.Size != want.Size || entry.Type != want.Type || entry.Source != want.Source {
+				t.Errorf("%s: DATA/ITEM.GAM = %+v, want %+v", manifestName, entry, want)
+			}
+		}
+		if !found {
+			t.Errorf("%s lists no DATA/ITEM.GAM: %+v", manifestName, layout.Entries)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the orphaned sector analysis entry point, which dumps disc regions
+// that no directory record references, and its report writers.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// FindOrphans reports the unreferenced sectors and hidden records of a CD image.
+// When outputDir is set, the user data of each region is written there as
+// orphan_<LBA>_<sectors>.bin; zero-filled regions are skipped unless includeEmpty is set.
+func (p *CDFileProcessor) FindOrphans(imageFile, outputDir string, includeEmpty bool) (*psx.OrphanReport, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	if err := reader.ValidateISO9660(); err != nil {
+		return nil, fmt.Errorf("invalid ISO9660 image: %w", err)
+	}
+
+	report, err := reader.FindOrphans()
+	if err != nil {
+		return nil, fmt.Errorf("failed to analyze CD image: %w", err)
+	}
+	p.logger.Debug("Orphan analysis of %s: %d regions, %d sectors", imageFile, len(report.Regions), report.OrphanSectors)
+
+	if outputDir == "" {
+		return report, nil
+	}
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create output directory: %w", err))
+	}
+
+	for i := range report.Regions {
+		region := &report.Regions[i]
+		if region.Empty && !includeEmpty {
+			continue
+		}
+
+		data, err := reader.ReadRegion(*region)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read orphan region at LBA %d: %w", region.FirstLBA, err)
+		}
+
+		fileName := fmt.Sprintf("orphan_%06d_%d.bin", region.FirstLBA, region.Sectors)
+		if err := common.WriteOutput(filepath.Join(outputDir, fileName), data, 0644); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", fileName, err))
+		}
+		region.File = fileName
+		p.logger.Debug("Dumped orphan region LBA %d (%d sectors) to %s", region.FirstLBA, region.Sectors, fileName)
+	}
+
+	return report, nil
+}
+
+// WriteOrphanReport writes the report in the requested format (json or markdown)
+func WriteOrphanReport(report *psx.OrphanReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeOrphanMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeOrphanMarkdown renders the report as a markdown document
+func writeOrphanMarkdown(report *psx.OrphanReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Orphaned Sectors\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Volume sectors | %d |\n", report.VolumeSectors))
+	sb.WriteString(fmt.Sprintf("| Image sectors | %d |\n", report.ImageSectors))
+	sb.WriteString(fmt.Sprintf("| Referenced sectors | %d |\n", report.ReferencedSectors))
+	sb.WriteString(fmt.Sprintf("| Orphan sectors | %d |\n", report.OrphanSectors))
+
+	sb.WriteString("\n## Regions\n\n")
+	if len(report.Regions) == 0 {
+		sb.WriteString("No unreferenced sectors found.\n")
+	} else {
+		sb.WriteString("| LBA | MSF | Sectors | Content | After | File |\n")
+		sb.WriteString("|-----|-----|---------|---------|-------|------|\n")
+		for _, region := range report.Regions {
+			content := "data"
+			if region.Empty {
+				content = "empty"
+			}
+			if region.BeyondVolume {
+				content += ", beyond volume"
+			}
+			sb.WriteString(fmt.Sprintf("| %d | %s | %d | %s | %s | %s |\n",
+				region.FirstLBA, region.MSF, region.Sectors, content, region.After, region.File))
+		}
+	}
+
+	sb.WriteString("\n## Hidden Entries\n\n")
+	if len(report.HiddenEntries) == 0 {
+		sb.WriteString("No hidden directory records found.\n")
+	} else {
+		sb.WriteString("| Path | LBA | Size | Directory |\n")
+		sb.WriteString("|------|-----|------|-----------|\n")
+		for _, entry := range report.HiddenEntries {
+			sb.WriteString(fmt.Sprintf("| %s | %d | %d | %t |\n", entry.Path, entry.LBA, entry.Size, entry.IsDir))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the track list of multi-track discs (CUE sheets) and the export of
+// their CD-DA audio tracks as WAV files during cd dump.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// TrackReport lists the tracks of a disc image
+type TrackReport struct {
+	Image  string      `json:"image"`
+	Tracks []psx.Track `json:"tracks"`
+}
+
+// SetAudioTracks makes Dump also write every CD-DA audio track of the disc as a WAV file
+// (trackNN.wav) next to the extracted files
+func (p *CDFileProcessor) SetAudioTracks(enabled bool) {
+	p.audioTracks = enabled
+}
+
+// Tracks lists the tracks of a CD image or CUE sheet
+func (p *CDFileProcessor) Tracks(imageFile string) (*TrackReport, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	return &TrackReport{Image: imageFile, Tracks: reader.Tracks()}, nil
+}
+
+// extractAudioTracks writes every audio track of the disc into outputDir as trackNN.wav
+// and returns the number of tracks written
+func (p *CDFileProcessor) extractAudioTracks(reader *psx.CDReader, outputDir string) (int, error) {
+	written := 0
+	for _, track := range reader.Tracks() {
+		if !track.IsAudio() {
+			continue
+		}
+		wavPath := filepath.Join(outputDir, fmt.Sprintf("track%02d.wav", track.Number))
+		if err := writeTrackWAV(reader, track.Number, wavPath); err != nil {
+			return written, err
+		}
+		p.logger.Debug("Track %02d: %d sectors written to %s", track.Number, track.Sectors, wavPath)
+		written++
+	}
+	return written, nil
+}
+
+// writeTrackWAV writes an audio track to a WAV file atomically
+func writeTrackWAV(reader *psx.CDReader, number int, wavPath string) error {
+	output, err := common.CreateAtomic(wavPath)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", wavPath, err))
+	}
+	defer output.Abort()
+
+	if err := reader.WriteTrackWAV(number, output); err != nil {
+		return err
+	}
+	return common.WithCategory(common.ErrCategoryWrite, output.Commit())
+}
+
+// WriteTrackReport writes the report in the requested format (json or markdown)
+func WriteTrackReport(report *TrackReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeTrackMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeTrackMarkdown renders the report as a markdown document
+func writeTrackMarkdown(report *TrackReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Tracks of %s\n\n", report.Image))
+	sb.WriteString("| Track | Type | Start (MSF) | LBA | Pregap | Sectors | File |\n")
+	sb.WriteString("|-------|------|-------------|-----|--------|---------|------|\n")
+	for _, track := range report.Tracks {
+		sb.WriteString(fmt.Sprintf("| %02d | %s | %s | %d | %d | %d | %s |\n",
+			track.Number, track.Type, track.MSF(), track.LBA, track.Pregap, track.Sectors, filepath.Base(track.File)))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+// Package pkg provides tests guarding the dependencies of the codec and adapter packages
+package pkg
+
+import (
+	"go/build"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// codecPackages may import the standard library and each other only, so tools embedding
+// the codecs do not pull in the command line, YAML or image adapters of this package
+var codecPackages = map[string]string{
+	"github.com/hansbonini/tombatools/pkg/common": "common",
+	"github.com/hansbonini/tombatools/pkg/gam":    "gam",
+	"github.com/hansbonini/tombatools/pkg/psx":    "psx",
+	"github.com/hansbonini/tombatools/pkg/wfm":    "wfm",
+}
+
+// adapterPackages serialize codec data and may import the codecs, the standard library
+// and the listed modules only, so tools reading translations do not pull in pkg
+var adapterPackages = map[string][]string{
+	"dialogueyaml": {"gopkg.in/yaml.v3"},
+}
+
+// checkImports reports the imports of the package in dir that are neither codec packages,
+// the standard library nor in allowed
+func checkImports(t *testing.T, dir string, allowed []string) {
+	t.Helper()
+	pkg, err := build.ImportDir(dir, 0)
+	if err != nil {
+		t.Fatalf("failed to read package %s: %v", dir, err)
+	}
+	for _, path := range pkg.Imports {
+		_, codec := codecPackages[path]
+		standard := !strings.Contains(strings.SplitN(path, "/", 2)[0], ".")
+		if !codec && !standard && !slices.Contains(allowed, path) {
+			t.Errorf("package %s imports %s", dir, path)
+		}
+	}
+}
+
+func TestCodecPackages_Dependencies(t *testing.T) {
+	for _, dir := range codecPackages {
+		checkImports(t, dir, nil)
+	}
+}
+
+func TestAdapterPackages_Dependencies(t *testing.T) {
+	for dir, allowed := range adapterPackages {
+		checkImports(t, dir, allowed)
+	}
+}
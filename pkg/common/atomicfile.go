@@ -0,0 +1,202 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains AtomicFile, an output file written to a temporary file next to
+// its target and only moved into place on Commit, so an interrupted or failed
+// operation never leaves a half-written file behind, and AtomicBatch, which commits
+// the many outputs of one operation with a single sync per directory and can undo
+// them all.
+package common
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AtomicFile is an output file that replaces its target only when committed
+type AtomicFile struct {
+	*os.File
+	path      string
+	batch     *AtomicBatch // Batch the file is committed in (nil syncs it on its own)
+	committed bool
+}
+
+// CreateAtomic creates a temporary file in the directory of path. Call Commit to move
+// it into place and defer Abort to remove it when the operation does not complete.
+func CreateAtomic(path string) (*AtomicFile, error) {
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, err
+	}
+	return &AtomicFile{File: file, path: path}, nil
+}
+
+// Path returns the target path of the file
+func (f *AtomicFile) Path() string {
+	return f.path
+}
+
+// Commit renames the temporary file over the target path. A file of its own is synced
+// first; a file of a batch is not, its directory is synced by the batch's Commit, and
+// the target it replaces is kept until then so a Rollback can restore it.
+func (f *AtomicFile) Commit() error {
+	if f.batch == nil {
+		if err := f.File.Sync(); err != nil {
+			return WithCategory(ErrCategoryWrite, fmt.Errorf("failed to flush %s: %w", f.path, err))
+		}
+	}
+	if err := f.File.Close(); err != nil {
+		return WithCategory(ErrCategoryWrite, fmt.Errorf("failed to close %s: %w", f.path, err))
+	}
+
+	backup := ""
+	if f.batch != nil {
+		var err error
+		if backup, err = backupTarget(f.path); err != nil {
+			return WithCategory(ErrCategoryWrite, fmt.Errorf("failed to keep the original %s: %w", f.path, err))
+		}
+	}
+	if err := os.Rename(f.File.Name(), f.path); err != nil {
+		if backup != "" {
+			os.Rename(backup, f.path)
+		}
+		return WithCategory(ErrCategoryWrite, fmt.Errorf("failed to replace %s: %w", f.path, err))
+	}
+	f.committed = true
+	if f.batch != nil {
+		f.batch.renamed = append(f.batch.renamed, batchRename{path: f.path, backup: backup})
+	}
+	RecordOutput(f.path)
+	return nil
+}
+
+// Abort removes the temporary file unless the file has been committed
+func (f *AtomicFile) Abort() {
+	if f.committed {
+		return
+	}
+	f.File.Close()
+	if err := os.Remove(f.File.Name()); err != nil && !os.IsNotExist(err) {
+		LogDebug("Failed to remove temporary file %s: %v", f.File.Name(), err)
+	}
+}
+
+// batchRename records a file committed in a batch and the original it replaced
+type batchRename struct {
+	path   string
+	backup string // Original file moved aside ("" if the target did not exist)
+}
+
+// AtomicBatch commits the output files of an operation that writes many of them, such as
+// a CD dump. Its files are renamed into place without syncing each one; Commit syncs every
+// directory they went into once and drops the originals they replaced, and Rollback
+// removes them and moves the originals back.
+type AtomicBatch struct {
+	renamed []batchRename
+}
+
+// NewAtomicBatch creates an empty batch
+func NewAtomicBatch() *AtomicBatch {
+	return &AtomicBatch{}
+}
+
+// Create creates a temporary file for path that is committed as part of the batch
+func (b *AtomicBatch) Create(path string) (*AtomicFile, error) {
+	file, err := CreateAtomic(path)
+	if err != nil {
+		return nil, err
+	}
+	file.batch = b
+	return file, nil
+}
+
+// Paths returns the target paths of the files committed in the batch so far
+func (b *AtomicBatch) Paths() []string {
+	paths := make([]string, len(b.renamed))
+	for i, renamed := range b.renamed {
+		paths[i] = renamed.path
+	}
+	return paths
+}
+
+// Commit syncs every directory holding a file of the batch once, then removes the
+// originals the files replaced. The batch is empty afterwards.
+func (b *AtomicBatch) Commit() error {
+	synced := make(map[string]bool)
+	for _, renamed := range b.renamed {
+		dir := filepath.Dir(renamed.path)
+		if synced[dir] {
+			continue
+		}
+		if err := syncDirectory(dir); err != nil {
+			return WithCategory(ErrCategoryWrite, fmt.Errorf("failed to sync %s: %w", dir, err))
+		}
+		synced[dir] = true
+	}
+	for _, renamed := range b.renamed {
+		if renamed.backup == "" {
+			continue
+		}
+		if err := os.Remove(renamed.backup); err != nil {
+			LogDebug("Failed to remove original %s: %v", renamed.backup, err)
+		}
+	}
+	LogDebug("Committed %d files with %d directory syncs", len(b.renamed), len(synced))
+	b.renamed = nil
+	return nil
+}
+
+// Rollback undoes the files committed in the batch, newest first: each one is removed
+// and the original it replaced, if any, is moved back. The batch is empty afterwards.
+func (b *AtomicBatch) Rollback() {
+	for i := len(b.renamed) - 1; i >= 0; i-- {
+		renamed := b.renamed[i]
+		if renamed.backup != "" {
+			if err := os.Rename(renamed.backup, renamed.path); err != nil {
+				LogDebug("Failed to restore %s: %v", renamed.path, err)
+			}
+			continue
+		}
+		if err := os.Remove(renamed.path); err != nil {
+			LogDebug("Failed to remove %s: %v", renamed.path, err)
+		}
+	}
+	b.renamed = nil
+}
+
+// backupTarget moves an existing file at path aside, next to it, and returns its new
+// path ("" if there is no file at path)
+func backupTarget(path string) (string, error) {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return "", nil
+	}
+	placeholder, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".orig-*")
+	if err != nil {
+		return "", err
+	}
+	placeholder.Close()
+	if err := os.Rename(path, placeholder.Name()); err != nil {
+		os.Remove(placeholder.Name())
+		return "", err
+	}
+	return placeholder.Name(), nil
+}
+
+// syncDirectory syncs a directory so the renames into it survive a crash. Windows
+// cannot sync directories; its renames are left to the file system.
+func syncDirectory(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+	handle, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer handle.Close()
+	return handle.Sync()
+}
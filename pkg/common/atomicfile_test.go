@@ -0,0 +1,103 @@
+// Package common provides tests for atomically replaced output files
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "OUT.WFM")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// An aborted file leaves the target untouched and no temporary file behind
+	file, err := CreateAtomic(path)
+	if err != nil {
+		t.Fatalf("CreateAtomic() failed: %v", err)
+	}
+	if _, err := file.WriteString("partial"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	file.Abort()
+	assertDirectory(t, dir, path, "original")
+
+	// A committed file replaces the target
+	file, err = CreateAtomic(path)
+	if err != nil {
+		t.Fatalf("CreateAtomic() failed: %v", err)
+	}
+	if _, err := file.WriteString("replaced"); err != nil {
+		t.Fatalf("WriteString() failed: %v", err)
+	}
+	if err := file.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	file.Abort()
+	assertDirectory(t, dir, path, "replaced")
+}
+
+func TestAtomicBatch(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "OUT.WFM")
+	if err := os.WriteFile(path, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	// commit writes a file of the batch over path
+	commit := func(batch *AtomicBatch, path, content string) {
+		t.Helper()
+		file, err := batch.Create(path)
+		if err != nil {
+			t.Fatalf("Create() failed: %v", err)
+		}
+		defer file.Abort()
+		if _, err := file.WriteString(content); err != nil {
+			t.Fatalf("WriteString() failed: %v", err)
+		}
+		if err := file.Commit(); err != nil {
+			t.Fatalf("Commit() failed: %v", err)
+		}
+	}
+
+	// A rollback removes the new files and restores the ones they replaced
+	batch := NewAtomicBatch()
+	commit(batch, path, "replaced")
+	commit(batch, filepath.Join(dir, "NEW.GAM"), "new")
+	if paths := batch.Paths(); len(paths) != 2 || paths[0] != path {
+		t.Errorf("Paths() = %q, want %s and NEW.GAM", paths, path)
+	}
+	batch.Rollback()
+	assertDirectory(t, dir, path, "original")
+
+	// A committed batch keeps its files and drops the originals
+	batch = NewAtomicBatch()
+	commit(batch, path, "replaced")
+	if err := batch.Commit(); err != nil {
+		t.Fatalf("batch Commit() failed: %v", err)
+	}
+	batch.Rollback()
+	assertDirectory(t, dir, path, "replaced")
+}
+
+// assertDirectory checks that dir only holds path with the given content
+func assertDirectory(t *testing.T, dir, path, want string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only %s", len(entries), filepath.Base(path))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if string(data) != want {
+		t.Errorf("content = %q, want %q", data, want)
+	}
+}
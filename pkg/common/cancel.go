@@ -0,0 +1,72 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains the cancellation shared by long-running operations: the aborted
+// error returned once the context passed to an operation is canceled (the CLI cancels it
+// on Ctrl-C) and the byte-counting ProgressWriter, which refuses further writes once its
+// operation has been canceled.
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// AbortedMessage is printed when an operation is interrupted before committing its output
+const AbortedMessage = "aborted, no changes committed"
+
+// progressSteps is the number of progress lines logged over a ProgressWriter's total
+const progressSteps = 10
+
+// Canceled returns an aborted error once ctx has been canceled, nil otherwise.
+// Long operations call it between steps and roll back their pending writes on error.
+func Canceled(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return WithCategory(ErrCategoryAborted, fmt.Errorf("operation interrupted: %w", err))
+	}
+	return nil
+}
+
+// IsAborted reports whether err was caused by a canceled operation
+func IsAborted(err error) bool {
+	return errors.Is(err, ErrCategoryAborted)
+}
+
+// ProgressWriter counts the bytes written to an underlying writer, logs the progress
+// in verbose mode and fails every write once the operation has been canceled
+type ProgressWriter struct {
+	ctx     context.Context
+	writer  io.Writer
+	label   string
+	total   int64
+	written int64
+	next    int64
+}
+
+// NewProgressWriter wraps writer for an operation running under ctx; total is the
+// expected size in bytes (0 if unknown)
+func NewProgressWriter(ctx context.Context, writer io.Writer, label string, total int64) *ProgressWriter {
+	return &ProgressWriter{ctx: ctx, writer: writer, label: label, total: total, next: total / progressSteps}
+}
+
+// Write writes p unless the operation has been canceled
+func (w *ProgressWriter) Write(p []byte) (int, error) {
+	if err := Canceled(w.ctx); err != nil {
+		return 0, err
+	}
+
+	n, err := w.writer.Write(p)
+	w.written += int64(n)
+	if w.total > 0 && w.next > 0 && w.written >= w.next {
+		LogDebug("%s: %d/%d bytes (%d%%)", w.label, w.written, w.total, w.written*100/w.total)
+		for w.next <= w.written {
+			w.next += w.total / progressSteps
+		}
+	}
+	return n, err
+}
+
+// Written returns the number of bytes written so far
+func (w *ProgressWriter) Written() int64 {
+	return w.written
+}
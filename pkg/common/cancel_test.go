@@ -0,0 +1,32 @@
+// Package common provides tests for operation cancellation and progress counting
+package common
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestProgressWriter_Cancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var buffer bytes.Buffer
+	writer := NewProgressWriter(ctx, &buffer, "test", 8)
+	if _, err := writer.Write([]byte("abcd")); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if err := Canceled(ctx); err != nil {
+		t.Errorf("Canceled() = %v before cancel, want nil", err)
+	}
+
+	cancel()
+	if _, err := writer.Write([]byte("efgh")); !IsAborted(err) {
+		t.Errorf("Write() after cancel = %v, want aborted error", err)
+	}
+	if ExitCodeFor(Canceled(ctx)) != ExitAborted {
+		t.Errorf("ExitCodeFor(Canceled(ctx)) = %d, want %d", ExitCodeFor(Canceled(ctx)), ExitAborted)
+	}
+	if writer.Written() != 4 || buffer.String() != "abcd" {
+		t.Errorf("Written() = %d with %q, want 4 bytes abcd", writer.Written(), buffer.String())
+	}
+}
@@ -1,27 +1,7 @@
 // Package common provides common utilities for CD-ROM operations.
-// This file contains functions for MSF conversion and CD-ROM related utilities.
+// This file contains ISO9660 file name and directory record utilities.
 package common
 
-import "fmt"
-
-// LBAToMSF converts LBA (Logical Block Address) to MSF (Minutes:Seconds:Frames) format
-// LBA to MSF conversion: LBA + 150 (pregap)
-func LBAToMSF(lba uint32) string {
-	totalFrames := lba + 150
-
-	minutes := totalFrames / (60 * 75)
-	seconds := (totalFrames % (60 * 75)) / 75
-	frames := totalFrames % 75
-
-	return fmt.Sprintf("%02d:%02d:%02d", minutes, seconds, frames)
-}
-
-// GetSizeInSectors calculates the number of sectors needed for a given size in bytes
-func GetSizeInSectors(sizeBytes uint32) uint32 {
-	const sectorSize = 2048
-	return (sizeBytes + sectorSize - 1) / sectorSize
-}
-
 // CleanFileName removes version numbers from ISO9660 file names
 func CleanFileName(fileName string) string {
 	// Remove version numbers (e.g., "FILE.EXT;1" -> "FILE.EXT")
@@ -0,0 +1,76 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file defines the process exit codes returned by the CLI and the error
+// categories used to select them.
+package common
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Process exit codes returned by the CLI
+const (
+	ExitOK               = 0   // Command completed successfully
+	ExitFailure          = 1   // Unclassified failure or invalid command usage
+	ExitInputNotFound    = 2   // An input file or directory does not exist
+	ExitFormatError      = 3   // An input file has an invalid or unsupported format
+	ExitValidationFailed = 4   // Input data was read but failed validation
+	ExitWriteError       = 5   // An output file could not be created or written
+	ExitAborted          = 130 // The operation was interrupted (Ctrl-C) and rolled back
+)
+
+// Error categories attached to errors to select the exit code
+var (
+	ErrCategoryInputNotFound    = errors.New("input not found")
+	ErrCategoryFormat           = errors.New("format error")
+	ErrCategoryValidationFailed = errors.New("validation failed")
+	ErrCategoryWrite            = errors.New("write error")
+	ErrCategoryAborted          = errors.New("aborted")
+)
+
+// categorizedError tags an error with a category without changing its message
+type categorizedError struct {
+	category error
+	err      error
+}
+
+// Error returns the message of the wrapped error
+func (e *categorizedError) Error() string {
+	return e.err.Error()
+}
+
+// Unwrap exposes both the category and the wrapped error to errors.Is/As
+func (e *categorizedError) Unwrap() []error {
+	return []error{e.category, e.err}
+}
+
+// WithCategory tags err with one of the ErrCategory* values; nil stays nil
+func WithCategory(category error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &categorizedError{category: category, err: err}
+}
+
+// ExitCodeFor maps an error returned by a command to its process exit code.
+// Aborted operations take precedence, since an interrupted write also reports a
+// write error. Write errors come next, since creating an output file in a missing
+// directory also reports fs.ErrNotExist.
+func ExitCodeFor(err error) int {
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.Is(err, ErrCategoryAborted):
+		return ExitAborted
+	case errors.Is(err, ErrCategoryWrite):
+		return ExitWriteError
+	case errors.Is(err, ErrCategoryInputNotFound), errors.Is(err, fs.ErrNotExist):
+		return ExitInputNotFound
+	case errors.Is(err, ErrCategoryFormat):
+		return ExitFormatError
+	case errors.Is(err, ErrCategoryValidationFailed):
+		return ExitValidationFailed
+	default:
+		return ExitFailure
+	}
+}
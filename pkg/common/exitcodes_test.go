@@ -0,0 +1,54 @@
+// Package common provides tests for exit code selection
+package common
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExitCodeFor(t *testing.T) {
+	_, statErr := os.Stat(filepath.Join(t.TempDir(), "missing.wfm"))
+
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"nil", nil, ExitOK},
+		{"unclassified", errors.New("boom"), ExitFailure},
+		{"missing file", fmt.Errorf("failed to open: %w", statErr), ExitInputNotFound},
+		{"explicit not found", WithCategory(ErrCategoryInputNotFound, errors.New("no such track")), ExitInputNotFound},
+		{"format", fmt.Errorf("decode: %w", WithCategory(ErrCategoryFormat, errors.New("bad magic"))), ExitFormatError},
+		{"validation", WithCategory(ErrCategoryValidationFailed, errors.New("too long")), ExitValidationFailed},
+		{"write", WithCategory(ErrCategoryWrite, errors.New("disk full")), ExitWriteError},
+		{"write wins over not exist", WithCategory(ErrCategoryWrite, &fs.PathError{Op: "open", Path: "out/x", Err: fs.ErrNotExist}), ExitWriteError},
+		{"aborted wins over write", WithCategory(ErrCategoryWrite, WithCategory(ErrCategoryAborted, errors.New("interrupted"))), ExitAborted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCodeFor(tt.err); got != tt.want {
+				t.Errorf("ExitCodeFor(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCategory_PreservesMessage(t *testing.T) {
+	base := errors.New("invalid GAM magic")
+	err := WithCategory(ErrCategoryFormat, base)
+
+	if err.Error() != base.Error() {
+		t.Errorf("Error() = %q, want %q", err.Error(), base.Error())
+	}
+	if !errors.Is(err, base) {
+		t.Error("categorized error should still match the wrapped error")
+	}
+	if WithCategory(ErrCategoryFormat, nil) != nil {
+		t.Error("WithCategory(category, nil) should return nil")
+	}
+}
@@ -0,0 +1,128 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains the global resource limits (worker count and memory budget) set by
+// the --jobs and --max-memory flags, and the guard checked before loading large data
+// fully into memory.
+package common
+
+import (
+	"fmt"
+	"image"
+	"io"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// Jobs is the maximum number of parallel workers (0 uses every CPU)
+var Jobs int = 0
+
+// MaxMemory is the memory budget in bytes for data loaded at once (0 is unlimited)
+var MaxMemory int64 = 0
+
+// SetResourceLimits sets the worker count and memory budget. The worker count also
+// limits the threads running Go code and the memory budget is set as the soft memory
+// limit of the garbage collector.
+func SetResourceLimits(jobs int, maxMemory int64) error {
+	if jobs < 0 {
+		return fmt.Errorf("invalid job count %d: must be 0 (all CPUs) or more", jobs)
+	}
+	if maxMemory < 0 {
+		return fmt.Errorf("invalid memory limit %d: must be 0 (unlimited) or more", maxMemory)
+	}
+
+	Jobs = jobs
+	MaxMemory = maxMemory
+	if jobs > 0 {
+		runtime.GOMAXPROCS(jobs)
+	}
+	if maxMemory > 0 {
+		debug.SetMemoryLimit(maxMemory)
+	}
+	return nil
+}
+
+// Workers returns the number of parallel workers to use for n tasks
+func Workers(n int) int {
+	workers := Jobs
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	return workers
+}
+
+// byteSizeUnits maps size suffixes to their multipliers (binary units)
+var byteSizeUnits = []struct {
+	suffix     string
+	multiplier int64
+}{
+	{"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+	{"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10},
+	{"B", 1},
+}
+
+// ParseByteSize parses a size such as "512M", "2GB" or "1048576" (units are powers of 1024)
+func ParseByteSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range byteSizeUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+
+	number, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || number < 0 {
+		return 0, fmt.Errorf("invalid size %q: use a number of bytes with an optional K, M or G suffix", value)
+	}
+	if number > (1<<63-1)/multiplier {
+		return 0, fmt.Errorf("size %q is too large", value)
+	}
+	return number * multiplier, nil
+}
+
+// FormatByteSize formats a size in bytes with a binary unit (e.g. "1.5 MiB")
+func FormatByteSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// CheckMemory returns a validation error if loading what, estimated at size bytes, would
+// exceed the memory budget
+func CheckMemory(what string, size int64) error {
+	if MaxMemory <= 0 || size <= MaxMemory {
+		return nil
+	}
+	return WithCategory(ErrCategoryValidationFailed, fmt.Errorf("loading %s needs about %s, above the memory limit of %s (see --max-memory)",
+		what, FormatByteSize(size), FormatByteSize(MaxMemory)))
+}
+
+// CheckImageMemory reads the header of an image and checks its decoded size (4 bytes
+// per pixel) against the memory budget. Nothing is read without a budget; otherwise the
+// reader is left after the header.
+func CheckImageMemory(what string, reader io.Reader) error {
+	if MaxMemory <= 0 {
+		return nil
+	}
+	config, _, err := image.DecodeConfig(reader)
+	if err != nil {
+		return err
+	}
+	return CheckMemory(what, int64(config.Width)*int64(config.Height)*4)
+}
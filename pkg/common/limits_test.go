@@ -0,0 +1,73 @@
+// Package common provides tests for the global resource limits
+package common
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    int64
+		wantErr bool
+	}{
+		{value: "1048576", want: 1 << 20},
+		{value: "512M", want: 512 << 20},
+		{value: "2gb", want: 2 << 30},
+		{value: "64 KB", want: 64 << 10},
+		{value: "10B", want: 10},
+		{value: "1.5G", wantErr: true},
+		{value: "-1", wantErr: true},
+		{value: "1Q", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseByteSize(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseByteSize(%q) = %d, want %d", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMemory(t *testing.T) {
+	defer func() { MaxMemory = 0 }()
+
+	MaxMemory = 0
+	if err := CheckMemory("file", 1<<40); err != nil {
+		t.Errorf("CheckMemory() without a budget = %v, want nil", err)
+	}
+
+	MaxMemory = 1 << 20
+	if err := CheckMemory("file", 1<<20); err != nil {
+		t.Errorf("CheckMemory() within the budget = %v, want nil", err)
+	}
+	if err := CheckMemory("file", 1<<20+1); ExitCodeFor(err) != ExitValidationFailed {
+		t.Errorf("CheckMemory() above the budget = %v, want validation error", err)
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, image.NewNRGBA(image.Rect(0, 0, 1024, 512))); err != nil {
+		t.Fatalf("failed to encode image: %v", err)
+	}
+	if err := CheckImageMemory("image.png", bytes.NewReader(buffer.Bytes())); ExitCodeFor(err) != ExitValidationFailed {
+		t.Errorf("CheckImageMemory() of a 2 MiB image = %v, want validation error", err)
+	}
+}
+
+func TestWorkers(t *testing.T) {
+	defer func() { Jobs = 0 }()
+
+	Jobs = 4
+	for _, tt := range []struct{ tasks, want int }{{10, 4}, {2, 2}, {0, 1}} {
+		if got := Workers(tt.tasks); got != tt.want {
+			t.Errorf("Workers(%d) = %d, want %d", tt.tasks, got, tt.want)
+		}
+	}
+}
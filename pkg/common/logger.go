@@ -0,0 +1,39 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains Logger, the per-operation logging configuration. Processors given
+// their own Logger log at their own verbosity, so a library consumer can run several
+// operations concurrently with different settings.
+package common
+
+import "log"
+
+// Logger holds the verbosity of an operation. A nil *Logger follows the process-wide
+// SetVerboseMode setting, so processors without a Logger keep the CLI behavior. Info and
+// warning output is still suppressed by SetQuietMode.
+type Logger struct {
+	verbose bool
+}
+
+// NewLogger creates a logger writing debug messages when verbose is true
+func NewLogger(verbose bool) *Logger {
+	return &Logger{verbose: verbose}
+}
+
+// Verbose reports whether debug messages and detailed listings are written
+func (l *Logger) Verbose() bool {
+	if l == nil {
+		return IsVerbose()
+	}
+	return l.verbose
+}
+
+// Debug logs a debug message when the logger is verbose
+func (l *Logger) Debug(message string, args ...interface{}) {
+	if !l.Verbose() {
+		return
+	}
+	if len(args) > 0 {
+		log.Printf("[DEBUG] "+message, args...)
+	} else {
+		log.Printf("[DEBUG] %s", message)
+	}
+}
@@ -0,0 +1,44 @@
+// Package common provides tests for the per-operation logger
+package common
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestLogger_NilFollowsVerboseMode(t *testing.T) {
+	defer SetVerboseMode(false)
+	var logger *Logger
+
+	SetVerboseMode(true)
+	if !logger.Verbose() {
+		t.Error("nil logger should be verbose after SetVerboseMode(true)")
+	}
+	SetVerboseMode(false)
+	if logger.Verbose() {
+		t.Error("nil logger should not be verbose after SetVerboseMode(false)")
+	}
+}
+
+func TestLogger_OverridesVerboseMode(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetVerboseMode(false)
+
+	SetVerboseMode(true)
+	NewLogger(false).Debug("quiet operation %d", 1)
+	SetVerboseMode(false)
+	NewLogger(true).Debug("verbose operation %d", 2)
+
+	output := buf.String()
+	if strings.Contains(output, "quiet operation") {
+		t.Errorf("non-verbose logger wrote a debug message: %q", output)
+	}
+	if !strings.Contains(output, "[DEBUG] verbose operation 2") {
+		t.Errorf("verbose logger output = %q, want the debug message", output)
+	}
+}
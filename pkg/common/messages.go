@@ -3,14 +3,56 @@ package common
 import (
 	"fmt"
 	"log"
+	"sync/atomic"
 )
 
-// Global variable to control debug output
+// verboseMode is the process-wide verbosity of operations without their own Logger
+var verboseMode atomic.Bool
+
+// VerboseMode is the debug output switch of earlier releases.
+//
+// Deprecated: call SetVerboseMode and IsVerbose, or give each processor its own Logger.
+// It is kept so existing code compiles, but it has no effect.
 var VerboseMode bool = false
 
-// SetVerboseMode enables or disables verbose/debug output
+// SetVerboseMode enables or disables verbose/debug output of operations without their own
+// Logger. It is safe for concurrent use.
 func SetVerboseMode(verbose bool) {
-	VerboseMode = verbose
+	verboseMode.Store(verbose)
+}
+
+// IsVerbose reports whether verbose/debug output is enabled process-wide
+func IsVerbose() bool {
+	return verboseMode.Load()
+}
+
+// quietMode suppresses informational and warning output for batch pipelines
+var quietMode atomic.Bool
+
+// SetQuietMode enables or disables quiet output. It is safe for concurrent use.
+func SetQuietMode(quiet bool) {
+	quietMode.Store(quiet)
+}
+
+// IsQuiet reports whether informational and warning output is suppressed
+func IsQuiet() bool {
+	return quietMode.Load()
+}
+
+// Printf prints progress output to stdout unless quiet mode is enabled
+func Printf(format string, args ...interface{}) {
+	if IsQuiet() {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// Println prints a progress line to stdout unless quiet mode is enabled
+func Println(args ...interface{}) {
+	if IsQuiet() {
+		return
+	}
+	fmt.Println(args...)
 }
 
 // Error messages
@@ -42,6 +84,7 @@ const (
 	ErrCharacterIgnored             = "character is ignored - no glyph needed"
 	ErrCharacterIgnoredNoGlyph      = "character is ignored - no glyph loaded"
 	ErrReservedDataSize             = "reservedData must be exactly 128 bytes"
+	ErrLayoutMismatch               = "WFM layout mismatch"
 )
 
 // Info messages
@@ -61,9 +104,10 @@ const (
 	InfoSpecialDialoguesFound   = "Special dialogues found"
 	InfoReservedSectionBuilt    = "Reserved section built with special dialogue IDs"
 	InfoReservedSectionUsed     = "Reserved section bytes used in header"
-	InfoPaddingAdded            = "Added bytes of 0xFF padding to maintain original file size"
+	InfoPaddingAdded            = "Added final padding"
 	InfoNoSpecialDialogues      = "No special dialogues found - Reserved section will be zero-filled"
 	InfoGlyphLoaded             = "Loaded glyph for character at font height"
+	InfoPlaceholderGlyphsKept   = "Reserved placeholder glyph slots"
 
 	// Exporter info messages
 	InfoGlyphsExported           = "Successfully exported %d individual glyph PNG files to: %s"
@@ -72,6 +116,7 @@ const (
 	InfoGlyphMappingBuilt        = "Built glyph mapping: %d glyphs mapped to characters"
 	InfoNoSpecialDialoguesInFile = "All Reserved section bytes are zero - no special dialogues in file"
 	InfoNoValidSpecialDialogues  = "No valid special dialogue IDs found in Reserved section"
+	InfoPlaceholderGlyphsFound   = "Found %d placeholder glyph slots (0x0 dimensions)"
 )
 
 // Debug messages
@@ -115,8 +160,11 @@ const (
 	WarnSeekToDialogue            = "Could not seek to dialogue %d at offset %d: %v"
 )
 
-// LogInfo logs an informational message
+// LogInfo logs an informational message (suppressed in quiet mode)
 func LogInfo(message string, args ...interface{}) {
+	if IsQuiet() {
+		return
+	}
 	if len(args) > 0 {
 		log.Printf("[INFO] "+message, args...)
 	} else {
@@ -124,8 +172,11 @@ func LogInfo(message string, args ...interface{}) {
 	}
 }
 
-// LogWarn logs a warning message
+// LogWarn logs a warning message (suppressed in quiet mode)
 func LogWarn(message string, args ...interface{}) {
+	if IsQuiet() {
+		return
+	}
 	if len(args) > 0 {
 		log.Printf("[WARN] "+message, args...)
 	} else {
@@ -142,16 +193,10 @@ func LogError(message string, args ...interface{}) {
 	}
 }
 
-// LogDebug logs a debug message (only if VerboseMode is enabled)
+// LogDebug logs a debug message (only if verbose mode is enabled process-wide)
 func LogDebug(message string, args ...interface{}) {
-	if !VerboseMode {
-		return
-	}
-	if len(args) > 0 {
-		log.Printf("[DEBUG] "+message, args...)
-	} else {
-		log.Printf("[DEBUG] %s", message)
-	}
+	var processWide *Logger
+	processWide.Debug(message, args...)
 }
 
 // FormatError creates a formatted error with additional context
@@ -13,13 +13,13 @@ import (
 func TestSetVerboseMode(t *testing.T) {
 	// Test enabling verbose mode
 	SetVerboseMode(true)
-	if !VerboseMode {
+	if !IsVerbose() {
 		t.Error("SetVerboseMode(true) should enable verbose mode")
 	}
 
 	// Test disabling verbose mode
 	SetVerboseMode(false)
-	if VerboseMode {
+	if IsVerbose() {
 		t.Error("SetVerboseMode(false) should disable verbose mode")
 	}
 }
@@ -169,6 +169,7 @@ func TestErrorConstants(t *testing.T) {
 		"ErrCharacterIgnored":             ErrCharacterIgnored,
 		"ErrCharacterIgnoredNoGlyph":      ErrCharacterIgnoredNoGlyph,
 		"ErrReservedDataSize":             ErrReservedDataSize,
+		"ErrLayoutMismatch":               ErrLayoutMismatch,
 	}
 
 	for name, value := range errorConstants {
@@ -227,20 +228,36 @@ func TestLogFunctions_NoArgs(t *testing.T) {
 	}
 }
 
-// Test VerboseMode as global variable
+// Test that the deprecated VerboseMode variable no longer enables debug output
 func TestVerboseMode_GlobalVariable(t *testing.T) {
-	// Test initial state
-	originalMode := VerboseMode
-	defer SetVerboseMode(originalMode) // Restore original state
+	defer func() { VerboseMode = false }()
 
-	// Test direct assignment
 	VerboseMode = true
-	if !VerboseMode {
-		t.Error("Direct assignment VerboseMode = true should work")
+	if IsVerbose() {
+		t.Error("IsVerbose() should ignore the deprecated VerboseMode variable")
 	}
+}
+
+// Test that quiet mode suppresses info and warning output but not errors
+func TestSetQuietMode(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer SetQuietMode(false)
 
-	VerboseMode = false
-	if VerboseMode {
-		t.Error("Direct assignment VerboseMode = false should work")
+	SetQuietMode(true)
+	if !IsQuiet() {
+		t.Error("IsQuiet() should be true after SetQuietMode(true)")
+	}
+	LogInfo("quiet info")
+	LogWarn("quiet warning")
+	LogError("loud error")
+
+	output := buf.String()
+	if strings.Contains(output, "quiet") {
+		t.Errorf("quiet mode wrote info or warning output: %q", output)
+	}
+	if !strings.Contains(output, "[ERROR] loud error") {
+		t.Errorf("quiet mode output = %q, want the error message", output)
 	}
 }
@@ -0,0 +1,236 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains the output summary of an invocation: with --hashes, every file a
+// command writes (and the disc images it reads) is recorded, and the CLI ends with a
+// block listing each path, size, CRC32 and SHA-256, so release notes and bug reports
+// carry verifiable identifiers.
+package common
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// Roles of the files of the output summary
+const (
+	SummaryRoleInput  = "input"
+	SummaryRoleOutput = "output"
+)
+
+// OutputSummaryEntry identifies a file read or written by the command
+type OutputSummaryEntry struct {
+	Role   string `json:"role"`
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	CRC32  string `json:"crc32"`
+	SHA256 string `json:"sha256"`
+}
+
+// outputSummary holds the recorded files. Access is serialized so parallel workers can
+// record their outputs.
+var outputSummary struct {
+	mu      sync.Mutex
+	enabled bool
+	inputs  []OutputSummaryEntry // Hashed when recorded, before in-place updates change them
+	outputs []string             // Files or directories, hashed when the summary is built
+	seen    map[string]bool
+}
+
+// SetOutputHashes enables or disables the recording of the files of the output summary
+func SetOutputHashes(enabled bool) {
+	outputSummary.mu.Lock()
+	defer outputSummary.mu.Unlock()
+	outputSummary.enabled = enabled
+}
+
+// OutputHashesEnabled reports whether the files of the output summary are recorded
+func OutputHashesEnabled() bool {
+	outputSummary.mu.Lock()
+	defer outputSummary.mu.Unlock()
+	return outputSummary.enabled
+}
+
+// ResetOutputSummary forgets every recorded file
+func ResetOutputSummary() {
+	outputSummary.mu.Lock()
+	defer outputSummary.mu.Unlock()
+	outputSummary.inputs, outputSummary.outputs, outputSummary.seen = nil, nil, nil
+}
+
+// RecordInput hashes an input file (a disc image read or updated in place) for the output
+// summary. Does nothing unless SetOutputHashes is enabled.
+func RecordInput(path string) {
+	if !OutputHashesEnabled() {
+		return
+	}
+	entry, err := hashSummaryFile(SummaryRoleInput, path)
+	if err != nil {
+		LogDebug("Input %s left out of the summary: %v", path, err)
+		return
+	}
+
+	outputSummary.mu.Lock()
+	defer outputSummary.mu.Unlock()
+	key := SummaryRoleInput + ":" + entry.Path
+	if outputSummary.seen[key] {
+		return
+	}
+	if outputSummary.seen == nil {
+		outputSummary.seen = make(map[string]bool)
+	}
+	outputSummary.seen[key] = true
+	outputSummary.inputs = append(outputSummary.inputs, entry)
+}
+
+// RecordOutput records a file or directory written by the command for the output summary.
+// Files of the temporary workspace are left out. Does nothing unless SetOutputHashes is
+// enabled.
+func RecordOutput(path string) {
+	if !OutputHashesEnabled() || inTempWorkspace(path) {
+		return
+	}
+
+	outputSummary.mu.Lock()
+	defer outputSummary.mu.Unlock()
+	key := SummaryRoleOutput + ":" + filepath.Clean(path)
+	if outputSummary.seen[key] {
+		return
+	}
+	if outputSummary.seen == nil {
+		outputSummary.seen = make(map[string]bool)
+	}
+	outputSummary.seen[key] = true
+	outputSummary.outputs = append(outputSummary.outputs, filepath.Clean(path))
+}
+
+// CreateOutput creates an output file like os.Create and records it for the output summary
+func CreateOutput(path string) (*os.File, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	RecordOutput(path)
+	return file, nil
+}
+
+// WriteOutput writes an output file like os.WriteFile and records it for the output summary
+func WriteOutput(path string, data []byte, perm os.FileMode) error {
+	if err := os.WriteFile(path, data, perm); err != nil {
+		return err
+	}
+	RecordOutput(path)
+	return nil
+}
+
+// inTempWorkspace reports whether path lies in the temporary workspace of the invocation
+func inTempWorkspace(path string) bool {
+	tempWorkspace.mu.Lock()
+	dir := tempWorkspace.dir
+	tempWorkspace.mu.Unlock()
+	if dir == "" {
+		return false
+	}
+	relative, err := filepath.Rel(dir, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// OutputSummary hashes the recorded outputs and returns them after the recorded inputs.
+// Directories list every file below them; outputs that no longer exist are left out.
+func OutputSummary() ([]OutputSummaryEntry, error) {
+	outputSummary.mu.Lock()
+	entries := append([]OutputSummaryEntry(nil), outputSummary.inputs...)
+	outputs := append([]string(nil), outputSummary.outputs...)
+	outputSummary.mu.Unlock()
+
+	listed := make(map[string]bool)
+	add := func(path string) error {
+		if listed[path] {
+			return nil
+		}
+		listed[path] = true
+		entry, err := hashSummaryFile(SummaryRoleOutput, path)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, entry)
+		return nil
+	}
+
+	for _, output := range outputs {
+		info, err := os.Stat(output)
+		if err != nil {
+			LogDebug("Output %s left out of the summary: %v", output, err)
+			continue
+		}
+		if !info.IsDir() {
+			if err := add(output); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		err = filepath.WalkDir(output, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil || entry.IsDir() {
+				return err
+			}
+			return add(path)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list output directory %s: %w", output, err)
+		}
+	}
+	return entries, nil
+}
+
+// hashSummaryFile reads a file once to compute its size, CRC32 and SHA-256
+func hashSummaryFile(role, path string) (OutputSummaryEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return OutputSummaryEntry{}, err
+	}
+	defer file.Close()
+
+	crc := crc32.NewIEEE()
+	sha := sha256.New()
+	size, err := io.Copy(io.MultiWriter(crc, sha), file)
+	if err != nil {
+		return OutputSummaryEntry{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return OutputSummaryEntry{
+		Role:   role,
+		Path:   filepath.Clean(path),
+		Size:   size,
+		CRC32:  fmt.Sprintf("%08X", crc.Sum32()),
+		SHA256: hex.EncodeToString(sha.Sum(nil)),
+	}, nil
+}
+
+// WriteOutputSummary writes the summary block of the recorded files (nothing when no file
+// was recorded)
+func WriteOutputSummary(writer io.Writer) error {
+	entries, err := OutputSummary()
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	table := tabwriter.NewWriter(writer, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "\nSummary:")
+	fmt.Fprintln(table, "  Role\tPath\tSize\tCRC32\tSHA-256")
+	for _, entry := range entries {
+		fmt.Fprintf(table, "  %s\t%s\t%d\t%s\t%s\n", entry.Role, entry.Path, entry.Size, entry.CRC32, entry.SHA256)
+	}
+	if err := table.Flush(); err != nil {
+		return fmt.Errorf("failed to write output summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+// Package common provides tests for the output summary of recorded files
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOutputSummary(t *testing.T) {
+	SetOutputHashes(true)
+	defer SetOutputHashes(false)
+	defer ResetOutputSummary()
+	defer CleanupTemp()
+	SetTempOptions(t.TempDir(), false)
+	defer SetTempOptions("", false)
+
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image.bin")
+	if err := os.WriteFile(image, []byte("abc"), 0644); err != nil {
+		t.Fatalf("failed to write image: %v", err)
+	}
+	RecordInput(image)
+	// The input is hashed when recorded, before an in-place update changes it
+	if err := os.WriteFile(image, []byte("changed"), 0644); err != nil {
+		t.Fatalf("failed to update image: %v", err)
+	}
+
+	report := filepath.Join(dir, "out", "report.md")
+	if err := os.MkdirAll(filepath.Dir(report), 0755); err != nil {
+		t.Fatalf("failed to create output directory: %v", err)
+	}
+	if err := WriteOutput(report, []byte("abc"), 0644); err != nil {
+		t.Fatalf("WriteOutput() error = %v", err)
+	}
+	RecordOutput(filepath.Dir(report)) // Directories list the files below them once
+	RecordOutput(filepath.Join(dir, "missing.bin"))
+
+	intermediate, err := CreateTemp("part-*.bin")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	intermediate.Close()
+	RecordOutput(intermediate.Name())
+
+	entries, err := OutputSummary()
+	if err != nil {
+		t.Fatalf("OutputSummary() error = %v", err)
+	}
+	want := []OutputSummaryEntry{
+		{Role: SummaryRoleInput, Path: image, Size: 3, CRC32: "352441C2",
+			SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{Role: SummaryRoleOutput, Path: report, Size: 3, CRC32: "352441C2",
+			SHA256: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("OutputSummary() = %+v, want %+v", entries, want)
+	}
+	for i := range want {
+		if entries[i] != want[i] {
+			t.Errorf("entries[%d] = %+v, want %+v", i, entries[i], want[i])
+		}
+	}
+
+	var sb strings.Builder
+	if err := WriteOutputSummary(&sb); err != nil {
+		t.Fatalf("WriteOutputSummary() error = %v", err)
+	}
+	if !strings.Contains(sb.String(), "Summary:") || !strings.Contains(sb.String(), report) {
+		t.Errorf("WriteOutputSummary() = %q, want the summary block listing %s", sb.String(), report)
+	}
+}
+
+func TestOutputSummaryDisabled(t *testing.T) {
+	defer ResetOutputSummary()
+
+	path := filepath.Join(t.TempDir(), "out.bin")
+	if err := WriteOutput(path, []byte{1}, 0644); err != nil {
+		t.Fatalf("WriteOutput() error = %v", err)
+	}
+	RecordInput(path)
+
+	var sb strings.Builder
+	if err := WriteOutputSummary(&sb); err != nil {
+		t.Fatalf("WriteOutputSummary() error = %v", err)
+	}
+	if sb.Len() != 0 {
+		t.Errorf("WriteOutputSummary() = %q without --hashes, want nothing", sb.String())
+	}
+}
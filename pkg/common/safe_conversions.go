@@ -3,6 +3,8 @@ package common
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 // SafeIntToUint16 safely converts int to uint16 with bounds checking
@@ -67,3 +69,69 @@ func SafeInt32ToUint32(value int32) (uint32, error) {
 	}
 	return uint32(value), nil
 }
+
+// SafeValueToUint16 converts a decoded YAML/JSON scalar to uint16 with bounds checking.
+// Any integer type, integral floats and strings in decimal or 0x/0o/0b notation are accepted.
+func SafeValueToUint16(value interface{}) (uint16, error) {
+	switch v := value.(type) {
+	case int:
+		return SafeIntToUint16(v)
+	case int8:
+		return safeInt64ToUint16(int64(v))
+	case int16:
+		return safeInt64ToUint16(int64(v))
+	case int32:
+		return safeInt64ToUint16(int64(v))
+	case int64:
+		return safeInt64ToUint16(v)
+	case uint:
+		return safeUint64ToUint16(uint64(v))
+	case uint8:
+		return uint16(v), nil
+	case uint16:
+		return v, nil
+	case uint32:
+		return SafeUint32ToUint16(v)
+	case uint64:
+		return safeUint64ToUint16(v)
+	case float32:
+		return safeFloatToUint16(float64(v))
+	case float64:
+		return safeFloatToUint16(v)
+	case string:
+		n, err := strconv.ParseInt(strings.TrimSpace(v), 0, 64)
+		if err != nil {
+			return 0, fmt.Errorf("value %q is not an integer", v)
+		}
+		return safeInt64ToUint16(n)
+	default:
+		return 0, fmt.Errorf("value %v of type %T is not a number", value, value)
+	}
+}
+
+// safeInt64ToUint16 converts int64 to uint16 with bounds checking
+func safeInt64ToUint16(value int64) (uint16, error) {
+	if value < 0 || value > math.MaxUint16 {
+		return 0, fmt.Errorf("value %d out of range for uint16 (0-%d)", value, math.MaxUint16)
+	}
+	return uint16(value), nil
+}
+
+// safeUint64ToUint16 converts uint64 to uint16 with bounds checking
+func safeUint64ToUint16(value uint64) (uint16, error) {
+	if value > math.MaxUint16 {
+		return 0, fmt.Errorf("value %d out of range for uint16 (0-%d)", value, math.MaxUint16)
+	}
+	return uint16(value), nil
+}
+
+// safeFloatToUint16 converts an integral float to uint16 with bounds checking
+func safeFloatToUint16(value float64) (uint16, error) {
+	if value != math.Trunc(value) {
+		return 0, fmt.Errorf("value %v is not an integer", value)
+	}
+	if value < 0 || value > math.MaxUint16 {
+		return 0, fmt.Errorf("value %v out of range for uint16 (0-%d)", value, math.MaxUint16)
+	}
+	return uint16(value), nil
+}
@@ -0,0 +1,133 @@
+// Package common provides shared utilities and helper functions for TombaTools.
+// This file contains the temporary workspace of an invocation: every intermediate file or
+// directory of a multi-step command is created inside one per-process directory, which
+// the CLI removes on exit unless --keep-temp is given.
+package common
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// TempRootEnv names the environment variable selecting the parent directory of the
+// workspace when --temp-dir is not given
+const TempRootEnv = "TOMBATOOLS_TMPDIR"
+
+// tempWorkspace holds the workspace settings and the directory created on first use.
+// Access is serialized so parallel workers share a single workspace.
+var tempWorkspace struct {
+	mu   sync.Mutex
+	root string // Parent directory ("" uses TempRootEnv, then the system temporary directory)
+	keep bool   // Keep intermediates and the workspace for inspection
+	dir  string // Workspace of this invocation ("" until first use)
+}
+
+// SetTempOptions sets the parent directory of the workspace and whether intermediates are
+// kept after the command finishes
+func SetTempOptions(root string, keep bool) {
+	tempWorkspace.mu.Lock()
+	defer tempWorkspace.mu.Unlock()
+	tempWorkspace.root = root
+	tempWorkspace.keep = keep
+}
+
+// tempRoot resolves the parent directory of the workspace: the configured root,
+// then TempRootEnv, then the system temporary directory
+func tempRoot(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	if root := os.Getenv(TempRootEnv); root != "" {
+		return root
+	}
+	return os.TempDir()
+}
+
+// TempRoot returns the parent directory the workspaces of invocations are created in
+func TempRoot() string {
+	tempWorkspace.mu.Lock()
+	defer tempWorkspace.mu.Unlock()
+	return tempRoot(tempWorkspace.root)
+}
+
+// TempWorkspace returns the workspace of this invocation, creating it on first use
+func TempWorkspace() (string, error) {
+	tempWorkspace.mu.Lock()
+	defer tempWorkspace.mu.Unlock()
+	if tempWorkspace.dir != "" {
+		return tempWorkspace.dir, nil
+	}
+
+	root := tempRoot(tempWorkspace.root)
+	if root != os.TempDir() {
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return "", WithCategory(ErrCategoryWrite, fmt.Errorf("failed to create temporary root %s: %w", root, err))
+		}
+	}
+
+	dir, err := os.MkdirTemp(root, fmt.Sprintf("tombatools-%d-", os.Getpid()))
+	if err != nil {
+		return "", WithCategory(ErrCategoryWrite, fmt.Errorf("failed to create temporary workspace: %w", err))
+	}
+	tempWorkspace.dir = dir
+	LogDebug("Created temporary workspace %s", dir)
+	return dir, nil
+}
+
+// MkdirTemp creates a uniquely named directory inside the workspace (pattern as in os.MkdirTemp)
+func MkdirTemp(pattern string) (string, error) {
+	workspace, err := TempWorkspace()
+	if err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(workspace, pattern)
+	if err != nil {
+		return "", WithCategory(ErrCategoryWrite, fmt.Errorf("failed to create temporary directory: %w", err))
+	}
+	return dir, nil
+}
+
+// CreateTemp creates a uniquely named file inside the workspace (pattern as in os.CreateTemp)
+func CreateTemp(pattern string) (*os.File, error) {
+	workspace, err := TempWorkspace()
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.CreateTemp(workspace, pattern)
+	if err != nil {
+		return nil, WithCategory(ErrCategoryWrite, fmt.Errorf("failed to create temporary file: %w", err))
+	}
+	return file, nil
+}
+
+// RemoveTemp removes an intermediate file or directory once it is no longer needed.
+// Intermediates are kept when --keep-temp is given.
+func RemoveTemp(path string) {
+	tempWorkspace.mu.Lock()
+	keep := tempWorkspace.keep
+	tempWorkspace.mu.Unlock()
+	if keep {
+		return
+	}
+	if err := os.RemoveAll(path); err != nil {
+		LogDebug("Failed to remove temporary path %s: %v", path, err)
+	}
+}
+
+// CleanupTemp removes the workspace and everything left in it, or reports where it was
+// kept. The next use creates a new workspace.
+func CleanupTemp() {
+	tempWorkspace.mu.Lock()
+	defer tempWorkspace.mu.Unlock()
+	if tempWorkspace.dir == "" {
+		return
+	}
+
+	if tempWorkspace.keep {
+		LogInfo("Kept temporary files in %s", tempWorkspace.dir)
+	} else if err := os.RemoveAll(tempWorkspace.dir); err != nil {
+		LogWarn("Failed to remove temporary workspace %s: %v", tempWorkspace.dir, err)
+	}
+	tempWorkspace.dir = ""
+}
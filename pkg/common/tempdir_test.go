@@ -0,0 +1,65 @@
+// Package common provides tests for the temporary workspace
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTempWorkspaceCleanup(t *testing.T) {
+	root := t.TempDir()
+	SetTempOptions(root, false)
+	defer SetTempOptions("", false)
+	defer CleanupTemp()
+
+	dir, err := MkdirTemp("stage-")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	file, err := CreateTemp("part-*.bin")
+	if err != nil {
+		t.Fatalf("CreateTemp() error = %v", err)
+	}
+	file.Close()
+
+	workspace, err := TempWorkspace()
+	if err != nil {
+		t.Fatalf("TempWorkspace() error = %v", err)
+	}
+	if filepath.Dir(workspace) != root {
+		t.Errorf("workspace %s is not inside %s", workspace, root)
+	}
+	for _, path := range []string{dir, file.Name()} {
+		if !strings.HasPrefix(path, workspace+string(filepath.Separator)) {
+			t.Errorf("%s is not inside the workspace %s", path, workspace)
+		}
+	}
+
+	RemoveTemp(dir)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("RemoveTemp() left %s behind", dir)
+	}
+
+	CleanupTemp()
+	if _, err := os.Stat(workspace); !os.IsNotExist(err) {
+		t.Errorf("CleanupTemp() left %s behind", workspace)
+	}
+}
+
+func TestTempWorkspaceKeep(t *testing.T) {
+	root := t.TempDir()
+	SetTempOptions(root, true)
+	defer SetTempOptions("", false)
+
+	dir, err := MkdirTemp("stage-")
+	if err != nil {
+		t.Fatalf("MkdirTemp() error = %v", err)
+	}
+	RemoveTemp(dir)
+	CleanupTemp()
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("--keep-temp did not keep %s: %v", dir, err)
+	}
+}
@@ -0,0 +1,107 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue control code table. The constants and the table are
+// generated from controlcodes.yaml, so the values, the text written by decode and the tags
+// accepted by encode cannot drift apart.
+package pkg
+
+import (
+	"regexp"
+	"strings"
+)
+
+//go:generate go run ../internal/gencodes -in controlcodes.yaml -out controlcodes_gen.go
+
+// ControlCode describes a dialogue control code
+type ControlCode struct {
+	Name    string   // Constant name
+	Value   uint16   // Code value
+	Args    int      // Parameter words following the code
+	Tag     string   // Bracketed tag written by decode and accepted by encode (empty if none)
+	Symbol  string   // Character written by decode instead of the tag (empty if none)
+	Text    string   // Text written by decode for layout codes without a tag
+	Content string   // Key of the structured content item of codes with args (empty if none)
+	Params  []string // Names of the args in the structured item and order in inline tags
+}
+
+// DecodedText returns the text decode writes for the code: its symbol, its layout text
+// or its tag, in that order
+func (c ControlCode) DecodedText() string {
+	switch {
+	case c.Symbol != "":
+		return c.Symbol
+	case c.Text != "":
+		return c.Text
+	default:
+		return c.Tag
+	}
+}
+
+// Lookup tables built from the generated control code table
+var (
+	controlCodesByValue  = make(map[uint16]ControlCode, len(controlCodeTable))
+	controlCodesByTag    = make(map[string]uint16, len(controlCodeTable))
+	controlCodesBySymbol = make(map[rune]uint16, len(controlCodeTable))
+	controlCodeTags      []string
+
+	// argumentTagRegex matches the tags of codes with args, with or without inline args
+	argumentTagRegex *regexp.Regexp
+)
+
+func init() {
+	var argumentTags []string
+	for _, code := range controlCodeTable {
+		controlCodesByValue[code.Value] = code
+		if code.Tag != "" {
+			controlCodesByTag[code.Tag] = code.Value
+			controlCodeTags = append(controlCodeTags, code.Tag)
+			if code.Args > 0 {
+				argumentTags = append(argumentTags, regexp.QuoteMeta(tagName(code.Tag)))
+			}
+		}
+		for _, symbol := range code.Symbol {
+			controlCodesBySymbol[symbol] = code.Value
+		}
+	}
+	argumentTagRegex = regexp.MustCompile(`\[(?:` + strings.Join(argumentTags, "|") + `)(?: [^\]]*)?\]`)
+}
+
+// tagName returns a tag without its brackets
+func tagName(tag string) string {
+	return strings.TrimSuffix(strings.TrimPrefix(tag, "["), "]")
+}
+
+// parseControlTag matches a bracketed tag against the control code table. Codes with
+// args also accept them inline after the tag name, in the order of their params:
+// [PAUSE FOR 30] or [INIT TEXT BOX 200 0x40]. The args are returned unparsed.
+func parseControlTag(tag string) (code ControlCode, args []string, found bool) {
+	name := tagName(tag)
+	for _, candidate := range controlCodeTable {
+		if candidate.Tag == "" {
+			continue
+		}
+		codeName := tagName(candidate.Tag)
+		if name == codeName {
+			return candidate, nil, true
+		}
+		if candidate.Args > 0 && strings.HasPrefix(name, codeName+" ") {
+			return candidate, strings.Fields(name[len(codeName):]), true
+		}
+	}
+	return ControlCode{}, nil, false
+}
+
+// ControlCodes returns the control code table in declaration order
+func ControlCodes() []ControlCode {
+	return append([]ControlCode(nil), controlCodeTable...)
+}
+
+// LookupControlCode returns the control code with the given value
+func LookupControlCode(value uint16) (ControlCode, bool) {
+	code, found := controlCodesByValue[value]
+	return code, found
+}
+
+// controlCodeArgs returns the number of parameter words following a control code
+func controlCodeArgs(value uint16) int {
+	return controlCodesByValue[value].Args
+}
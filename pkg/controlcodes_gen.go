@@ -0,0 +1,49 @@
+// Code generated by gencodes from controlcodes.yaml. DO NOT EDIT.
+
+package pkg
+
+// Dialogue control codes
+const (
+	FFF2              uint16 = 0xFFF2 // args: 1
+	HALT              uint16 = 0xFFF3
+	F4                uint16 = 0xFFF4
+	PROMPT            uint16 = 0xFFF5
+	F6                uint16 = 0xFFF6 // args: 2
+	CHANGE_COLOR_TO   uint16 = 0xFFF7 // args: 1
+	INIT_TAIL         uint16 = 0xFFF8 // args: 2
+	PAUSE_FOR         uint16 = 0xFFF9 // args: 1
+	INIT_TEXT_BOX     uint16 = 0xFFFA // Text box initialization, args: 2
+	DOUBLE_NEWLINE    uint16 = 0xFFFB
+	WAIT_FOR_INPUT    uint16 = 0xFFFC
+	NEWLINE           uint16 = 0xFFFD
+	TERMINATOR_1      uint16 = 0xFFFE // Termination marker
+	TERMINATOR_2      uint16 = 0xFFFF // Termination marker
+	C04D              uint16 = 0xC04D // Special character
+	C04E              uint16 = 0xC04E // Special character
+	SPEAKER           uint16 = 0xC040 // Name tag of the speaking character, args: 1
+	NAME_WINDOW       uint16 = 0xC041 // Name window initialization, args: 2
+	CLOSE_NAME_WINDOW uint16 = 0xC042 // Hides the name window
+)
+
+// controlCodeTable lists every control code in declaration order
+var controlCodeTable = []ControlCode{
+	{Name: "FFF2", Value: FFF2, Args: 1, Tag: "[FFF2]", Content: "fff2", Params: []string{"value"}},
+	{Name: "HALT", Value: HALT, Tag: "[HALT]"},
+	{Name: "F4", Value: F4, Tag: "[F4]"},
+	{Name: "PROMPT", Value: PROMPT, Tag: "[PROMPT]"},
+	{Name: "F6", Value: F6, Args: 2, Tag: "[F6]", Content: "f6", Params: []string{"width", "height"}},
+	{Name: "CHANGE_COLOR_TO", Value: CHANGE_COLOR_TO, Args: 1, Tag: "[CHANGE COLOR TO]", Content: "color", Params: []string{"value"}},
+	{Name: "INIT_TAIL", Value: INIT_TAIL, Args: 2, Tag: "[INIT TAIL]", Content: "tail", Params: []string{"width", "height"}},
+	{Name: "PAUSE_FOR", Value: PAUSE_FOR, Args: 1, Tag: "[PAUSE FOR]", Content: "pause", Params: []string{"duration"}},
+	{Name: "INIT_TEXT_BOX", Value: INIT_TEXT_BOX, Args: 2, Tag: "[INIT TEXT BOX]", Content: "box", Params: []string{"width", "height"}},
+	{Name: "DOUBLE_NEWLINE", Value: DOUBLE_NEWLINE, Text: "\n\n"},
+	{Name: "WAIT_FOR_INPUT", Value: WAIT_FOR_INPUT, Tag: "[WAIT FOR INPUT]", Symbol: "⧗"},
+	{Name: "NEWLINE", Value: NEWLINE, Text: "\n"},
+	{Name: "TERMINATOR_1", Value: TERMINATOR_1},
+	{Name: "TERMINATOR_2", Value: TERMINATOR_2},
+	{Name: "C04D", Value: C04D, Tag: "[C04D]", Symbol: "▼"},
+	{Name: "C04E", Value: C04E, Tag: "[C04E]", Symbol: "⏷"},
+	{Name: "SPEAKER", Value: SPEAKER, Args: 1, Tag: "[SPEAKER]", Content: "speaker", Params: []string{"id"}},
+	{Name: "NAME_WINDOW", Value: NAME_WINDOW, Args: 2, Tag: "[NAME WINDOW]", Content: "name_window", Params: []string{"width", "height"}},
+	{Name: "CLOSE_NAME_WINDOW", Value: CLOSE_NAME_WINDOW, Tag: "[CLOSE NAME WINDOW]"},
+}
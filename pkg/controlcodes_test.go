@@ -0,0 +1,38 @@
+// Package pkg provides tests for the generated control code table
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestControlCodes_RoundTrip(t *testing.T) {
+	encoder := NewWFMEncoder()
+	for _, code := range ControlCodes() {
+		text := code.DecodedText()
+		if text == "" {
+			continue
+		}
+		if got := getSpecialCharacterCode(code.Value); got != text {
+			t.Errorf("getSpecialCharacterCode(%s) = %q, want %q", code.Name, got, text)
+		}
+
+		// Layout text is covered by the newline handling of the page break tests
+		for _, form := range []string{code.Tag, code.Symbol} {
+			if form == "" {
+				continue
+			}
+			encoded, _, err := encoder.processTextContent(form, 16, nil, 0)
+			if err != nil {
+				t.Fatalf("processTextContent(%q) failed: %v", form, err)
+			}
+			if want := []uint16{code.Value}; !reflect.DeepEqual(encoded, want) {
+				t.Errorf("processTextContent(%q) = %04X, want %04X", form, encoded, want)
+			}
+		}
+	}
+
+	if got := getSpecialCharacterCode(0xFFF1); got != "<FFF1>" {
+		t.Errorf("getSpecialCharacterCode(0xFFF1) = %q, want %q", got, "<FFF1>")
+	}
+}
@@ -0,0 +1,382 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the profile-driven decoder and encoder for the packed text stream of
+// the staff roll (credits), stored inside a GAM payload or a raw file.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// CreditsStreamDefinition describes a packed staff roll text stream. Every line is an
+// optional style byte, the encoded text and the line end byte; the stream_end byte
+// follows the last line and the rest of the reserved space is padded.
+type CreditsStreamDefinition struct {
+	Name      string         `yaml:"name"`
+	Offset    int            `yaml:"offset"`             // Offset of the stream in the (decompressed) file
+	Size      int            `yaml:"size"`               // Bytes reserved for the stream, stream end included
+	Charset   string         `yaml:"charset,omitempty"`  // ascii, windows-1252 or shift-jis (defaults to ascii)
+	LineEnd   int            `yaml:"line_end"`           // Byte ending every line
+	StreamEnd int            `yaml:"stream_end"`         // Byte ending the stream
+	PadByte   *int           `yaml:"pad_byte,omitempty"` // Byte filling unused space (defaults to the stream end)
+	Styles    map[string]int `yaml:"styles,omitempty"`   // Style names and their leading byte; no style byte when empty
+}
+
+// CreditsFileProfile lists the staff roll streams of a single file
+type CreditsFileProfile struct {
+	Streams []CreditsStreamDefinition `yaml:"streams"`
+}
+
+// CreditsProfile maps file names to their staff roll stream layouts
+type CreditsProfile struct {
+	Files map[string]CreditsFileProfile `yaml:"files"`
+}
+
+// CreditsLine is a single line of the staff roll. Style bytes missing from the profile
+// are kept as hexadecimal ("0x07") so they survive a round-trip.
+type CreditsLine struct {
+	Style string `yaml:"style,omitempty"`
+	Text  string `yaml:"text"`
+}
+
+// CreditsStream holds the decoded lines of a stream
+type CreditsStream struct {
+	Name  string        `yaml:"name"`
+	Lines []CreditsLine `yaml:"lines"`
+}
+
+// CreditsYAML is the translatable staff roll document written by the extractor
+type CreditsYAML struct {
+	File    string          `yaml:"file"`
+	Streams []CreditsStream `yaml:"streams"`
+}
+
+// CreditsProcessor decodes and encodes staff roll text streams
+type CreditsProcessor struct {
+	gam *GAMProcessor
+}
+
+// NewCreditsProcessor creates a new staff roll processor instance
+func NewCreditsProcessor() *CreditsProcessor {
+	return &CreditsProcessor{gam: NewGAMProcessor()}
+}
+
+// LoadCreditsProfile loads a staff roll profile from a YAML file
+func LoadCreditsProfile(profileFile string) (*CreditsProfile, error) {
+	data, err := os.ReadFile(profileFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credits profile: %w", err)
+	}
+
+	var profile CreditsProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse credits profile: %w", err))
+	}
+
+	return &profile, nil
+}
+
+// StreamsFor returns the stream definitions configured for a file (matched by base name)
+func (p *CreditsProfile) StreamsFor(file string) ([]CreditsStreamDefinition, error) {
+	baseName := filepath.Base(file)
+	for name, fileProfile := range p.Files {
+		if strings.EqualFold(name, baseName) {
+			return fileProfile.Streams, nil
+		}
+	}
+	return nil, fmt.Errorf("no credits streams configured for %s", baseName)
+}
+
+// charset returns the stream charset, defaulting to ASCII
+func (d CreditsStreamDefinition) charset() string {
+	if d.Charset == "" {
+		return EncodingASCII
+	}
+	return d.Charset
+}
+
+// padByte returns the byte filling unused stream space
+func (d CreditsStreamDefinition) padByte() byte {
+	if d.PadByte != nil {
+		return byte(*d.PadByte)
+	}
+	return byte(d.StreamEnd)
+}
+
+// validate checks the stream definition against the data size
+func (d CreditsStreamDefinition) validate(dataSize int) error {
+	if d.Offset < 0 || d.Size <= 0 {
+		return fmt.Errorf("stream %s: offset must not be negative and size must be positive", d.Name)
+	}
+	if d.Offset+d.Size > dataSize {
+		return fmt.Errorf("stream %s: ends at 0x%X beyond data size 0x%X", d.Name, d.Offset+d.Size, dataSize)
+	}
+
+	bytesInRange := []int{d.LineEnd, d.StreamEnd}
+	if d.PadByte != nil {
+		bytesInRange = append(bytesInRange, *d.PadByte)
+	}
+	for _, value := range d.Styles {
+		bytesInRange = append(bytesInRange, value)
+	}
+	for _, value := range bytesInRange {
+		if value < 0 || value > 0xFF {
+			return fmt.Errorf("stream %s: control byte %d out of range 0x00-0xFF", d.Name, value)
+		}
+	}
+
+	if d.LineEnd == d.StreamEnd {
+		return fmt.Errorf("stream %s: line_end and stream_end must differ", d.Name)
+	}
+	seen := make(map[int]string, len(d.Styles))
+	for name, value := range d.Styles {
+		if value == d.LineEnd || value == d.StreamEnd {
+			return fmt.Errorf("stream %s: style %s uses a line or stream end byte", d.Name, name)
+		}
+		if other, found := seen[value]; found {
+			return fmt.Errorf("stream %s: styles %s and %s share byte 0x%02X", d.Name, other, name, value)
+		}
+		seen[value] = name
+	}
+	return nil
+}
+
+// styleName returns the name of a style byte, or its hexadecimal value when unnamed
+func (d CreditsStreamDefinition) styleName(value byte) string {
+	for name, styleValue := range d.Styles {
+		if styleValue == int(value) {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%02X", value)
+}
+
+// styleByte returns the leading byte of a named or hexadecimal style
+func (d CreditsStreamDefinition) styleByte(style string) (byte, error) {
+	if value, found := d.Styles[style]; found {
+		return byte(value), nil
+	}
+	if strings.HasPrefix(strings.ToLower(style), "0x") {
+		if value, err := strconv.ParseUint(style[2:], 16, 8); err == nil {
+			return byte(value), nil
+		}
+	}
+	return 0, fmt.Errorf("stream %s: unknown style %q", d.Name, style)
+}
+
+// ReadStream decodes the lines of a staff roll stream from the file data
+func (p *CreditsProcessor) ReadStream(data []byte, definition CreditsStreamDefinition) (*CreditsStream, error) {
+	if err := definition.validate(len(data)); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	stream := &CreditsStream{Name: definition.Name}
+	region := data[definition.Offset : definition.Offset+definition.Size]
+	for pos := 0; ; {
+		if pos >= len(region) {
+			return nil, common.WithCategory(common.ErrCategoryFormat,
+				fmt.Errorf("stream %s: no stream end byte within 0x%X bytes", definition.Name, definition.Size))
+		}
+		if region[pos] == byte(definition.StreamEnd) {
+			break
+		}
+
+		lineStart := pos
+		var line CreditsLine
+		if len(definition.Styles) > 0 {
+			line.Style = definition.styleName(region[pos])
+			pos++
+		}
+
+		end := bytes.IndexByte(region[pos:], byte(definition.LineEnd))
+		if end < 0 {
+			return nil, common.WithCategory(common.ErrCategoryFormat,
+				fmt.Errorf("stream %s: line at 0x%X has no line end byte", definition.Name, definition.Offset+lineStart))
+		}
+
+		text, _, err := DecodeText(region[pos:pos+end], definition.charset())
+		if err != nil {
+			return nil, fmt.Errorf("stream %s line %d: %w", definition.Name, len(stream.Lines), err)
+		}
+		line.Text = text
+		stream.Lines = append(stream.Lines, line)
+		pos += end + 1
+	}
+
+	common.LogDebug("Read credits stream %s: %d lines at 0x%X", definition.Name, len(stream.Lines), definition.Offset)
+	return stream, nil
+}
+
+// EncodeStream packs the lines of a staff roll stream, stream end and padding included
+func (p *CreditsProcessor) EncodeStream(definition CreditsStreamDefinition, stream CreditsStream) ([]byte, error) {
+	packed := make([]byte, 0, definition.Size)
+	for index, line := range stream.Lines {
+		if len(definition.Styles) > 0 {
+			style, err := definition.styleByte(line.Style)
+			if err != nil {
+				return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("line %d: %w", index, err))
+			}
+			packed = append(packed, style)
+		}
+
+		encoded, err := EncodeText(line.Text, definition.charset())
+		if err != nil {
+			return nil, fmt.Errorf("stream %s line %d: %w", definition.Name, index, err)
+		}
+		if bytes.IndexByte(encoded, byte(definition.LineEnd)) >= 0 || bytes.IndexByte(encoded, byte(definition.StreamEnd)) >= 0 {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("stream %s line %d: %q contains a line or stream end byte", definition.Name, index, line.Text))
+		}
+		packed = append(packed, encoded...)
+		packed = append(packed, byte(definition.LineEnd))
+	}
+	packed = append(packed, byte(definition.StreamEnd))
+
+	if len(packed) > definition.Size {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("stream %s: %d bytes exceed the %d reserved (%d over)", definition.Name, len(packed), definition.Size, len(packed)-definition.Size))
+	}
+	for len(packed) < definition.Size {
+		packed = append(packed, definition.padByte())
+	}
+	return packed, nil
+}
+
+// WriteStream encodes the lines of a staff roll stream into the file data
+func (p *CreditsProcessor) WriteStream(data []byte, definition CreditsStreamDefinition, stream CreditsStream) error {
+	if err := definition.validate(len(data)); err != nil {
+		return common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	packed, err := p.EncodeStream(definition, stream)
+	if err != nil {
+		return err
+	}
+	copy(data[definition.Offset:], packed)
+
+	common.LogDebug("Wrote credits stream %s: %d lines at 0x%X", definition.Name, len(stream.Lines), definition.Offset)
+	return nil
+}
+
+// loadData returns the contents of a staff roll file, decompressed when it is a GAM file
+func (p *CreditsProcessor) loadData(file string) (data []byte, isGAM bool, err error) {
+	data, err = os.ReadFile(file)
+	if err != nil {
+		return nil, false, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read %s: %w", file, err))
+	}
+	if !bytes.HasPrefix(data, []byte("GAM")) {
+		return data, false, nil
+	}
+
+	gam, err := p.gam.DecodeGAM(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return gam.UncompressedData, true, nil
+}
+
+// Extract decodes every configured stream of a file and writes them to a YAML file
+func (p *CreditsProcessor) Extract(file string, profile *CreditsProfile, outputFile string) error {
+	definitions, err := profile.StreamsFor(file)
+	if err != nil {
+		return err
+	}
+
+	data, _, err := p.loadData(file)
+	if err != nil {
+		return err
+	}
+
+	document := CreditsYAML{File: filepath.Base(file)}
+	for _, definition := range definitions {
+		stream, err := p.ReadStream(data, definition)
+		if err != nil {
+			return err
+		}
+		document.Streams = append(document.Streams, *stream)
+	}
+
+	yamlWriter, err := common.CreateOutput(outputFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create YAML file: %w", err))
+	}
+	defer yamlWriter.Close()
+
+	encoder := yaml.NewEncoder(yamlWriter)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode YAML: %w", err))
+	}
+
+	common.LogInfo("Extracted %d credits streams from %s", len(document.Streams), file)
+	return nil
+}
+
+// Inject packs translated streams from a YAML file into a copy of the file. GAM files
+// are recompressed; other files keep their size.
+func (p *CreditsProcessor) Inject(ctx context.Context, file string, profile *CreditsProfile, creditsFile, outputFile string) error {
+	definitions, err := profile.StreamsFor(file)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := os.ReadFile(creditsFile)
+	if err != nil {
+		return common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+
+	var document CreditsYAML
+	if err := yaml.Unmarshal(yamlData, &document); err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+
+	data, isGAM, err := p.loadData(file)
+	if err != nil {
+		return err
+	}
+
+	definitionsByName := make(map[string]CreditsStreamDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionsByName[definition.Name] = definition
+	}
+
+	for _, stream := range document.Streams {
+		definition, found := definitionsByName[stream.Name]
+		if !found {
+			return fmt.Errorf("credits stream %s is not configured for %s", stream.Name, filepath.Base(file))
+		}
+		if err := p.WriteStream(data, definition, stream); err != nil {
+			return err
+		}
+	}
+
+	if isGAM {
+		if _, err := p.gam.SaveGAM(ctx, data, outputFile); err != nil {
+			return err
+		}
+	} else {
+		atomicFile, err := common.CreateAtomic(outputFile)
+		if err != nil {
+			return common.FormatError(common.ErrFailedToCreateOutputFile, err)
+		}
+		defer atomicFile.Abort()
+
+		if _, err := atomicFile.Write(data); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", outputFile, err))
+		}
+		if err := atomicFile.Commit(); err != nil {
+			return err
+		}
+	}
+
+	common.LogInfo("Injected %d credits streams into %s", len(document.Streams), outputFile)
+	return nil
+}
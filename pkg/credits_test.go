@@ -0,0 +1,166 @@
+// Package pkg provides tests for staff roll stream extraction and injection
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+const testCreditsProfile = `
+files:
+  STAFF.GAM:
+    streams:
+      - name: staff
+        offset: 0x08
+        size: 0x20
+        line_end: 0x00
+        stream_end: 0xFF
+        styles:
+          heading: 0x01
+          name: 0x02
+  STAFF.BIN:
+    streams:
+      - name: staff
+        offset: 0x04
+        size: 0x10
+        line_end: 0x0A
+        stream_end: 0x00
+`
+
+// testCreditsStream is a packed stream with a heading, a name and an unnamed style
+var testCreditsStream = []byte("\x01PRODUCER\x00\x02Whoopee\x00\x07\x00\xFF")
+
+func loadTestCreditsProfile(t *testing.T) *CreditsProfile {
+	t.Helper()
+	var profile CreditsProfile
+	if err := yaml.Unmarshal([]byte(testCreditsProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+	return &profile
+}
+
+func TestCreditsProcessor_ReadEncodeStream(t *testing.T) {
+	definitions, err := loadTestCreditsProfile(t).StreamsFor("/disc/staff.gam")
+	if err != nil {
+		t.Fatalf("StreamsFor() failed: %v", err)
+	}
+	definition := definitions[0]
+
+	data := make([]byte, 0x30)
+	copy(data[0x08:], testCreditsStream)
+
+	processor := NewCreditsProcessor()
+	stream, err := processor.ReadStream(data, definition)
+	if err != nil {
+		t.Fatalf("ReadStream() failed: %v", err)
+	}
+	want := []CreditsLine{{Style: "heading", Text: "PRODUCER"}, {Style: "name", Text: "Whoopee"}, {Style: "0x07"}}
+	if len(stream.Lines) != len(want) {
+		t.Fatalf("ReadStream() lines = %+v, want %+v", stream.Lines, want)
+	}
+	for i := range want {
+		if stream.Lines[i] != want[i] {
+			t.Errorf("line %d = %+v, want %+v", i, stream.Lines[i], want[i])
+		}
+	}
+
+	// Unchanged lines pack back to the original bytes, padded with the stream end
+	packed, err := processor.EncodeStream(definition, *stream)
+	if err != nil {
+		t.Fatalf("EncodeStream() failed: %v", err)
+	}
+	if got := string(packed[:len(testCreditsStream)]); got != string(testCreditsStream) || len(packed) != definition.Size {
+		t.Errorf("EncodeStream() = %q, want %q padded to %d bytes", packed, testCreditsStream, definition.Size)
+	}
+
+	stream.Lines[1].Text = "A name far too long for the reserved space"
+	if _, err := processor.EncodeStream(definition, *stream); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("EncodeStream() overflow error = %v, want a validation error", err)
+	}
+
+	stream.Lines[1] = CreditsLine{Style: "footer", Text: "X"}
+	if _, err := processor.EncodeStream(definition, *stream); err == nil {
+		t.Error("EncodeStream() should fail for unknown styles")
+	}
+
+	copy(data[0x08:], make([]byte, definition.Size))
+	if _, err := processor.ReadStream(data, definition); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("ReadStream() without a stream end = %v, want a format error", err)
+	}
+}
+
+func TestCreditsProcessor_ExtractInject(t *testing.T) {
+	profile := loadTestCreditsProfile(t)
+	dir := t.TempDir()
+
+	tests := []struct {
+		name       string
+		file       string
+		original   []byte
+		translated string
+		want       string
+	}{
+		{
+			name:       "GAM payload",
+			file:       "STAFF.GAM",
+			original:   append(make([]byte, 0x08), append(testCreditsStream, make([]byte, 0x20)...)...),
+			translated: "file: STAFF.GAM\nstreams:\n  - name: staff\n    lines:\n      - style: heading\n        text: PRODUTOR\n      - style: \"0x07\"\n        text: \"\"\n",
+			want:       "\x01PRODUTOR\x00\x07\x00\xFF\xFF",
+		},
+		{
+			name:       "raw file without styles",
+			file:       "STAFF.BIN",
+			original:   []byte("HEADStaff\nEnd\n\x00\x00\x00\x00\x00\x00\x00TAIL"),
+			translated: "file: STAFF.BIN\nstreams:\n  - name: staff\n    lines:\n      - text: Equipe\n",
+			want:       "Equipe\n\x00\x00",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputFile := filepath.Join(dir, tt.file)
+			if tt.file == "STAFF.GAM" {
+				if _, err := NewGAMProcessor().SaveGAM(context.Background(), tt.original, inputFile); err != nil {
+					t.Fatalf("SaveGAM() failed: %v", err)
+				}
+			} else if err := os.WriteFile(inputFile, tt.original, 0644); err != nil {
+				t.Fatalf("failed to write input: %v", err)
+			}
+
+			processor := NewCreditsProcessor()
+			creditsFile := filepath.Join(dir, tt.file+".yaml")
+			if err := processor.Extract(inputFile, profile, creditsFile); err != nil {
+				t.Fatalf("Extract() failed: %v", err)
+			}
+			if err := os.WriteFile(creditsFile, []byte(tt.translated), 0644); err != nil {
+				t.Fatalf("failed to write credits file: %v", err)
+			}
+
+			outputFile := filepath.Join(dir, "out_"+tt.file)
+			if err := processor.Inject(context.Background(), inputFile, profile, creditsFile, outputFile); err != nil {
+				t.Fatalf("Inject() failed: %v", err)
+			}
+
+			output, _, err := processor.loadData(outputFile)
+			if err != nil {
+				t.Fatalf("loadData() failed: %v", err)
+			}
+			if len(output) != len(tt.original) {
+				t.Fatalf("output is %d bytes, want %d", len(output), len(tt.original))
+			}
+			definitions, _ := profile.StreamsFor(tt.file)
+			start := definitions[0].Offset
+			if got := string(output[start : start+len(tt.want)]); got != tt.want {
+				t.Errorf("injected stream = %q, want %q", got, tt.want)
+			}
+			if end := start + definitions[0].Size; string(output[end:]) != string(tt.original[end:]) {
+				t.Error("bytes after the stream were changed")
+			}
+		})
+	}
+}
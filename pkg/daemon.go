@@ -0,0 +1,358 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the editor daemon: a long-running process that keeps a WFM font and a
+// dialogue YAML file loaded, reloads the YAML file when it changes on disk and answers the
+// requests of editor plugins (decode a dialogue, render a preview, validate an edit), so
+// translators get instant feedback on line widths and page overflows while they type.
+// Package daemonserver serves it over gRPC, keeping the gRPC dependencies out of pkg.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// DefaultDaemonPollInterval is how often the daemon checks the dialogue file for changes
+const DefaultDaemonPollInterval = 500 * time.Millisecond
+
+// DefaultDaemonAddress is the TCP address the daemon listens on
+const DefaultDaemonAddress = "127.0.0.1:7420"
+
+// DaemonOptions configures the editor daemon
+type DaemonOptions struct {
+	WFMFile      string        // Original WFM font: decodes dialogues and draws previews
+	Dialogues    string        // Dialogue YAML file watched for changes
+	FontDir      string        // Reference font directory used to map glyphs to characters
+	Rules        []LintRule    // Rules run by ValidateEdit
+	Width        int           // Line width in pixels (0: widest original line, as wfm measure)
+	PollInterval time.Duration // How often the dialogue file is checked (0: DefaultDaemonPollInterval)
+}
+
+// Daemon serves decode, render and validation requests of editor plugins
+type Daemon struct {
+	options      DaemonOptions
+	wfm          *WFMFile
+	glyphMapping map[uint16]string
+	renderer     *TextRenderer
+
+	mu        sync.Mutex // Guards the dialogues and the lint rules, which keep file state
+	dialogues *DialoguesYAML
+	stamp     fileStamp
+
+	watchersMu sync.Mutex
+	watchers   map[chan DaemonDialoguesChanged]bool // Subscribers told of dialogue file changes
+}
+
+// fileStamp identifies a version of a file on disk
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// DaemonDialogue is the result of DecodeDialogue
+type DaemonDialogue struct {
+	ID         int
+	Type       string
+	FontHeight int
+	Original   []map[string]interface{} // Content decoded from the WFM file
+	Current    []map[string]interface{} // Content of the watched dialogue file
+	Notes      string                   // Translator notes of the watched dialogue file
+}
+
+// DaemonRenderParams selects the text of a preview: Text at Height, or box Box of dialogue
+// ID (its current content) when Text is empty
+type DaemonRenderParams struct {
+	Text   string
+	ID     *int
+	Box    int
+	Height int // Font height (default: the dialogue's, else 16)
+	Width  int // Wrap lines to this many pixels (0 disables wrapping)
+}
+
+// DaemonPreview is the result of RenderPreview
+type DaemonPreview struct {
+	Width  int
+	Height int
+	PNG    []byte // PNG image
+}
+
+// DaemonEditParams is an edited dialogue: Content replaces the dialogue content, or Text
+// replaces it with a single text item
+type DaemonEditParams struct {
+	ID      int
+	Text    *string
+	Content []map[string]interface{}
+}
+
+// DaemonValidation is the result of ValidateEdit
+type DaemonValidation struct {
+	ID       int
+	Errors   int
+	Warnings int
+	Issues   []LintIssue
+	Pages    []TextMeasurePage // Every text box page with its widest line
+	Overflow bool              // A page is wider than its line width
+}
+
+// DaemonDialoguesChanged is the event sent to subscribers when the dialogue file is reloaded
+type DaemonDialoguesChanged struct {
+	File      string
+	Dialogues int
+}
+
+// NewDaemon loads the WFM font and the dialogue file of a daemon
+func NewDaemon(options DaemonOptions) (*Daemon, error) {
+	if options.FontDir == "" {
+		options.FontDir = DefaultFontDir
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = DefaultDaemonPollInterval
+	}
+
+	file, err := os.Open(options.WFMFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open WFM file: %w", err))
+	}
+	defer file.Close()
+	wfm, err := NewWFMDecoder().Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WFM file %s: %w", options.WFMFile, err)
+	}
+
+	d := &Daemon{options: options, wfm: wfm, watchers: make(map[chan DaemonDialoguesChanged]bool)}
+	if d.glyphMapping, err = NewWFMExporter().buildGlyphMappingFromGlyphs(wfm.Glyphs, options.FontDir); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to map glyphs: %w", err))
+	}
+	if d.renderer, err = NewTextRenderer(wfm, options.FontDir); err != nil {
+		return nil, err
+	}
+	if options.Dialogues != "" {
+		palettes, err := LoadProjectPalettes(filepath.Dir(options.Dialogues))
+		if err != nil {
+			return nil, err
+		}
+		d.renderer.SetPalettes(palettes)
+		if _, err := d.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// reload reads the dialogue file when it changed since the last read and reports whether
+// it did
+func (d *Daemon) reload() (bool, error) {
+	info, err := os.Stat(d.options.Dialogues)
+	if err != nil {
+		return false, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("dialogue file %s not found", d.options.Dialogues))
+	}
+	stamp := fileStamp{modTime: info.ModTime(), size: info.Size()}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.dialogues != nil && stamp == d.stamp {
+		return false, nil
+	}
+	dialogues, err := dialogueyaml.Read(d.options.Dialogues)
+	if err != nil {
+		return false, err
+	}
+	d.dialogues, d.stamp = dialogues, stamp
+	for _, rule := range d.options.Rules {
+		if fileRule, ok := rule.(FileLintRule); ok {
+			fileRule.SetFile(dialogues)
+		}
+	}
+	return true, nil
+}
+
+// Watch reloads the dialogue file whenever it changes and tells every subscriber, until
+// ctx is done. A file that fails to parse (an editor saving half a file) keeps the
+// previous dialogues.
+func (d *Daemon) Watch(ctx context.Context) {
+	if d.options.Dialogues == "" {
+		return
+	}
+	ticker := time.NewTicker(d.options.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		changed, err := d.reload()
+		if err != nil {
+			common.LogWarn("Dialogue file not reloaded: %v", err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+		d.mu.Lock()
+		change := DaemonDialoguesChanged{File: d.options.Dialogues, Dialogues: len(d.dialogues.Dialogues)}
+		d.mu.Unlock()
+		common.LogDebug("Reloaded %s (%d dialogues)", change.File, change.Dialogues)
+		d.broadcast(change)
+	}
+}
+
+// Subscribe registers a subscriber of dialogue file changes. Call cancel once it stops
+// reading.
+func (d *Daemon) Subscribe() (changes <-chan DaemonDialoguesChanged, cancel func()) {
+	channel := make(chan DaemonDialoguesChanged, 1)
+	d.watchersMu.Lock()
+	d.watchers[channel] = true
+	d.watchersMu.Unlock()
+	return channel, func() {
+		d.watchersMu.Lock()
+		delete(d.watchers, channel)
+		d.watchersMu.Unlock()
+	}
+}
+
+// broadcast tells every subscriber of a change. A subscriber that has not read the
+// previous change yet gets this one in its place, since only the latest file matters.
+func (d *Daemon) broadcast(change DaemonDialoguesChanged) {
+	d.watchersMu.Lock()
+	defer d.watchersMu.Unlock()
+	for changes := range d.watchers {
+		select {
+		case <-changes:
+		default:
+		}
+		changes <- change
+	}
+}
+
+// currentDialogue returns a dialogue of the watched file, if it has one with that ID
+func (d *Daemon) currentDialogue(id int) (DialogueEntry, bool) {
+	if d.dialogues == nil {
+		return DialogueEntry{}, false
+	}
+	for _, entry := range d.dialogues.Dialogues {
+		if entry.ID == id {
+			return entry, true
+		}
+	}
+	return DialogueEntry{}, false
+}
+
+// originalDialogue decodes a dialogue of the WFM file
+func (d *Daemon) originalDialogue(id int) (DialogueEntry, error) {
+	if id < 0 || id >= len(d.wfm.Dialogues) {
+		return DialogueEntry{}, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("dialogue %d out of range (%d dialogues)", id, len(d.wfm.Dialogues)))
+	}
+	pageBreaks := d.dialogues != nil && d.dialogues.DoubleNewline == DoubleNewlineAsPage
+	content, entryType, fontHeight, fontClut, terminator := processDialogueText(d.wfm.Dialogues[id].Data, d.glyphMapping, d.wfm.Glyphs, pageBreaks)
+	return DialogueEntry{
+		ID:         id,
+		Type:       entryType,
+		FontHeight: fontHeight,
+		FontClut:   fontClut,
+		Terminator: TerminatorFromCode(terminator),
+		Content:    content,
+		Widths:     newDialogueWidths(d.wfm.Dialogues[id].Data, d.wfm.Glyphs),
+	}, nil
+}
+
+// DecodeDialogue decodes a dialogue of the WFM file and returns it with its content in
+// the watched dialogue file
+func (d *Daemon) DecodeDialogue(id int) (*DaemonDialogue, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	original, err := d.originalDialogue(id)
+	if err != nil {
+		return nil, err
+	}
+	result := &DaemonDialogue{ID: id, Type: original.Type, FontHeight: original.FontHeight, Original: original.Content}
+	if current, ok := d.currentDialogue(id); ok {
+		result.Current, result.Notes = current.Content, current.Notes
+	}
+	return result, nil
+}
+
+// RenderPreview draws text, or a box of a dialogue of the watched file, in the game font
+func (d *Daemon) RenderPreview(params DaemonRenderParams) (*DaemonPreview, error) {
+	d.mu.Lock()
+	text, height := params.Text, params.Height
+	if text == "" && params.ID != nil {
+		entry, ok := d.currentDialogue(*params.ID)
+		if !ok {
+			d.mu.Unlock()
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("dialogue %d not found in %s", *params.ID, d.options.Dialogues))
+		}
+		boxes := dialogueBoxTexts(entry)
+		if params.Box < 0 || params.Box >= len(boxes) {
+			d.mu.Unlock()
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("dialogue %d has %d boxes", *params.ID, len(boxes)))
+		}
+		text = boxes[params.Box]
+		if height == 0 {
+			height = entry.FontHeight
+		}
+	}
+	d.mu.Unlock()
+	if height == 0 {
+		height = 16
+	}
+
+	img, err := d.renderer.RenderString(text, height, params.Width)
+	if err != nil {
+		return nil, err
+	}
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		return nil, fmt.Errorf("failed to encode preview: %w", err)
+	}
+	bounds := img.Bounds()
+	return &DaemonPreview{Width: bounds.Dx(), Height: bounds.Dy(), PNG: encoded.Bytes()}, nil
+}
+
+// ValidateEdit checks an edited dialogue with the lint rules and measures its pages
+// against the line width of its font height, without writing anything
+func (d *Daemon) ValidateEdit(params DaemonEditParams) (*DaemonValidation, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	entry, ok := d.currentDialogue(params.ID)
+	if !ok {
+		original, err := d.originalDialogue(params.ID)
+		if err != nil {
+			return nil, err
+		}
+		entry = original
+	}
+	switch {
+	case params.Content != nil:
+		entry.Content = params.Content
+	case params.Text != nil:
+		entry.Content = []map[string]interface{}{{"text": *params.Text}}
+	default:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("an edit needs text or content"))
+	}
+
+	report := NewLinter(d.options.Rules...).Check([]DialogueEntry{entry})
+	edited := &DialoguesYAML{Dialogues: []DialogueEntry{entry}}
+	measure := MeasureText(d.wfm, d.glyphMapping, edited, TextMeasureOptions{Width: d.options.Width})
+
+	result := &DaemonValidation{
+		ID:       params.ID,
+		Errors:   report.Errors,
+		Warnings: report.Warnings,
+		Issues:   report.Issues,
+		Pages:    measure.Pages,
+		Overflow: measure.Overflowing > 0,
+	}
+	return result, nil
+}
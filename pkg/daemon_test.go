@@ -0,0 +1,141 @@
+// Package pkg provides tests for the editor daemon.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+func TestDaemon(t *testing.T) {
+	dir := t.TempDir()
+	wfmFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, wfmFile)
+
+	// Reference fonts mapping the two 8x8 glyphs to A and B
+	wfm := &WFMFile{Glyphs: []Glyph{
+		{GlyphWidth: 8, GlyphHeight: 8, GlyphClut: 0x1234, GlyphImage: bytes.Repeat([]byte{0x11}, 32)},
+		{GlyphWidth: 8, GlyphHeight: 8, GlyphClut: 0x1234, GlyphImage: bytes.Repeat([]byte{0x22}, 32)},
+	}}
+	fontDir := filepath.Join(dir, "fonts")
+	if err := os.MkdirAll(fontDir, 0755); err != nil {
+		t.Fatalf("failed to create font directory: %v", err)
+	}
+	for i, char := range []rune{'A', 'B'} {
+		img, err := NewWFMExporter().convertGlyphToImage(wfm.Glyphs[i])
+		if err != nil {
+			t.Fatalf("convertGlyphToImage(%d) failed: %v", i, err)
+		}
+		file, err := os.Create(filepath.Join(fontDir, fmt.Sprintf("%04X.png", char)))
+		if err != nil {
+			t.Fatalf("failed to create font file: %v", err)
+		}
+		if err := png.Encode(file, img); err != nil {
+			t.Fatalf("failed to encode font file: %v", err)
+		}
+		file.Close()
+	}
+
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{TotalDialogues: 2, Dialogues: []DialogueEntry{
+		textDialogue(0, "BA"),
+		textDialogue(1, "B"),
+	}}
+	for i := range dialogues.Dialogues {
+		dialogues.Dialogues[i].FontHeight = 8
+	}
+	dialogues.Dialogues[0].Notes = "Tomba, after the first fall"
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("failed to write dialogues: %v", err)
+	}
+
+	daemon, err := NewDaemon(DaemonOptions{
+		WFMFile:      wfmFile,
+		Dialogues:    yamlFile,
+		FontDir:      fontDir,
+		Rules:        []LintRule{NewLineWidthRule()},
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewDaemon() failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, unsubscribe := daemon.Subscribe()
+	defer unsubscribe()
+	go daemon.Watch(ctx)
+
+	// The original text comes from the WFM file, the current one from the YAML file
+	dialogue, err := daemon.DecodeDialogue(0)
+	if err != nil {
+		t.Fatalf("DecodeDialogue() failed: %v", err)
+	}
+	if dialogue.Original[0]["text"] != "AB" || dialogue.Current[0]["text"] != "BA" || dialogue.Notes != "Tomba, after the first fall" {
+		t.Errorf("DecodeDialogue() = %+v, want original AB, current BA and the notes", dialogue)
+	}
+	if _, err := daemon.DecodeDialogue(9); !errors.Is(err, common.ErrCategoryInputNotFound) {
+		t.Errorf("DecodeDialogue(9) error = %v, want %v", err, common.ErrCategoryInputNotFound)
+	}
+
+	preview, err := daemon.RenderPreview(DaemonRenderParams{Text: "ABA", Height: 8})
+	if err != nil {
+		t.Fatalf("RenderPreview() failed: %v", err)
+	}
+	if img, err := png.Decode(bytes.NewReader(preview.PNG)); err != nil || preview.Width != 24 || preview.Height != 8 || img.Bounds().Dx() != 24 {
+		t.Errorf("RenderPreview() = %dx%d (%v), want a 24x8 image", preview.Width, preview.Height, err)
+	}
+	id := 1
+	if preview, err = daemon.RenderPreview(DaemonRenderParams{ID: &id}); err != nil || preview.Width != 8 {
+		t.Errorf("RenderPreview(dialogue 1) = %+v, %v, want an 8 pixel wide image", preview, err)
+	}
+
+	// Dialogue 0 is 16 pixels wide in the original font
+	text := "ABA"
+	validation, err := daemon.ValidateEdit(DaemonEditParams{ID: 0, Text: &text})
+	if err != nil {
+		t.Fatalf("ValidateEdit() failed: %v", err)
+	}
+	if !validation.Overflow || len(validation.Pages) != 1 || validation.Pages[0].Overflow != 8 {
+		t.Errorf("ValidateEdit(ABA) = %+v, want an 8 pixel overflow", validation)
+	}
+	if validation, err = daemon.ValidateEdit(DaemonEditParams{ID: 0, Content: []map[string]interface{}{{"text": "BB"}}}); err != nil {
+		t.Fatalf("ValidateEdit() failed: %v", err)
+	}
+	if validation.Overflow {
+		t.Errorf("ValidateEdit(BB) = %+v, want no overflow", validation)
+	}
+	if _, err := daemon.ValidateEdit(DaemonEditParams{ID: 0}); !errors.Is(err, common.ErrCategoryValidationFailed) {
+		t.Errorf("ValidateEdit() without an edit error = %v, want %v", err, common.ErrCategoryValidationFailed)
+	}
+
+	// Saving the dialogue file notifies the subscriber and later requests see the change
+	dialogues.Dialogues[0] = textDialogue(0, "BBB")
+	dialogues.Dialogues[0].FontHeight = 8
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("failed to write dialogues: %v", err)
+	}
+	select {
+	case change := <-changes:
+		if change.File != yamlFile || change.Dialogues != 2 {
+			t.Errorf("change after saving = %+v, want %s with 2 dialogues", change, yamlFile)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no change received after saving the dialogue file")
+	}
+	if dialogue, err = daemon.DecodeDialogue(0); err != nil {
+		t.Fatalf("DecodeDialogue() failed: %v", err)
+	}
+	if dialogue.Current[0]["text"] != "BBB" {
+		t.Errorf("DecodeDialogue() after saving = %+v, want current BBB", dialogue)
+	}
+}
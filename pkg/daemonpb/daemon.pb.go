@@ -0,0 +1,861 @@
+// The gRPC service of tombatools daemon: editor plugins decode dialogues, render previews
+// in the game font and validate unsaved edits while a translator types.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: daemon.proto
+
+package daemonpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	structpb "google.golang.org/protobuf/types/known/structpb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// DecodeDialogueRequest selects a dialogue
+type DecodeDialogueRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DecodeDialogueRequest) Reset() {
+	*x = DecodeDialogueRequest{}
+	mi := &file_daemon_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecodeDialogueRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecodeDialogueRequest) ProtoMessage() {}
+
+func (x *DecodeDialogueRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecodeDialogueRequest.ProtoReflect.Descriptor instead.
+func (*DecodeDialogueRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *DecodeDialogueRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+// Dialogue is a dialogue decoded from the WFM file
+type Dialogue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`
+	FontHeight    int32                  `protobuf:"varint,3,opt,name=font_height,json=fontHeight,proto3" json:"font_height,omitempty"`
+	Original      []*structpb.Struct     `protobuf:"bytes,4,rep,name=original,proto3" json:"original,omitempty"` // Content decoded from the WFM file
+	Current       []*structpb.Struct     `protobuf:"bytes,5,rep,name=current,proto3" json:"current,omitempty"`   // Content of the watched dialogue file
+	Notes         string                 `protobuf:"bytes,6,opt,name=notes,proto3" json:"notes,omitempty"`       // Translator notes of the watched dialogue file
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dialogue) Reset() {
+	*x = Dialogue{}
+	mi := &file_daemon_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dialogue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dialogue) ProtoMessage() {}
+
+func (x *Dialogue) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dialogue.ProtoReflect.Descriptor instead.
+func (*Dialogue) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Dialogue) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Dialogue) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Dialogue) GetFontHeight() int32 {
+	if x != nil {
+		return x.FontHeight
+	}
+	return 0
+}
+
+func (x *Dialogue) GetOriginal() []*structpb.Struct {
+	if x != nil {
+		return x.Original
+	}
+	return nil
+}
+
+func (x *Dialogue) GetCurrent() []*structpb.Struct {
+	if x != nil {
+		return x.Current
+	}
+	return nil
+}
+
+func (x *Dialogue) GetNotes() string {
+	if x != nil {
+		return x.Notes
+	}
+	return ""
+}
+
+// RenderPreviewRequest selects the text of a preview: text at height, or box box of
+// dialogue id (its current content) when text is empty
+type RenderPreviewRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Text          string                 `protobuf:"bytes,1,opt,name=text,proto3" json:"text,omitempty"`
+	Id            *int32                 `protobuf:"varint,2,opt,name=id,proto3,oneof" json:"id,omitempty"`
+	Box           int32                  `protobuf:"varint,3,opt,name=box,proto3" json:"box,omitempty"`
+	Height        int32                  `protobuf:"varint,4,opt,name=height,proto3" json:"height,omitempty"` // Font height (default: the dialogue's, else 16)
+	Width         int32                  `protobuf:"varint,5,opt,name=width,proto3" json:"width,omitempty"`   // Wrap lines to this many pixels (0 disables wrapping)
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RenderPreviewRequest) Reset() {
+	*x = RenderPreviewRequest{}
+	mi := &file_daemon_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RenderPreviewRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RenderPreviewRequest) ProtoMessage() {}
+
+func (x *RenderPreviewRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RenderPreviewRequest.ProtoReflect.Descriptor instead.
+func (*RenderPreviewRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *RenderPreviewRequest) GetText() string {
+	if x != nil {
+		return x.Text
+	}
+	return ""
+}
+
+func (x *RenderPreviewRequest) GetId() int32 {
+	if x != nil && x.Id != nil {
+		return *x.Id
+	}
+	return 0
+}
+
+func (x *RenderPreviewRequest) GetBox() int32 {
+	if x != nil {
+		return x.Box
+	}
+	return 0
+}
+
+func (x *RenderPreviewRequest) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *RenderPreviewRequest) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+// Preview is a rendered preview
+type Preview struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Width         int32                  `protobuf:"varint,1,opt,name=width,proto3" json:"width,omitempty"`
+	Height        int32                  `protobuf:"varint,2,opt,name=height,proto3" json:"height,omitempty"`
+	Png           []byte                 `protobuf:"bytes,3,opt,name=png,proto3" json:"png,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Preview) Reset() {
+	*x = Preview{}
+	mi := &file_daemon_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Preview) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Preview) ProtoMessage() {}
+
+func (x *Preview) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Preview.ProtoReflect.Descriptor instead.
+func (*Preview) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Preview) GetWidth() int32 {
+	if x != nil {
+		return x.Width
+	}
+	return 0
+}
+
+func (x *Preview) GetHeight() int32 {
+	if x != nil {
+		return x.Height
+	}
+	return 0
+}
+
+func (x *Preview) GetPng() []byte {
+	if x != nil {
+		return x.Png
+	}
+	return nil
+}
+
+// ValidateEditRequest is an edited dialogue: content replaces the dialogue content, or
+// text replaces it with a single text item
+type ValidateEditRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Text          *string                `protobuf:"bytes,2,opt,name=text,proto3,oneof" json:"text,omitempty"`
+	Content       []*structpb.Struct     `protobuf:"bytes,3,rep,name=content,proto3" json:"content,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ValidateEditRequest) Reset() {
+	*x = ValidateEditRequest{}
+	mi := &file_daemon_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ValidateEditRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ValidateEditRequest) ProtoMessage() {}
+
+func (x *ValidateEditRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ValidateEditRequest.ProtoReflect.Descriptor instead.
+func (*ValidateEditRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ValidateEditRequest) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ValidateEditRequest) GetText() string {
+	if x != nil && x.Text != nil {
+		return *x.Text
+	}
+	return ""
+}
+
+func (x *ValidateEditRequest) GetContent() []*structpb.Struct {
+	if x != nil {
+		return x.Content
+	}
+	return nil
+}
+
+// Validation is the result of ValidateEdit
+type Validation struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            int32                  `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Errors        int32                  `protobuf:"varint,2,opt,name=errors,proto3" json:"errors,omitempty"`
+	Warnings      int32                  `protobuf:"varint,3,opt,name=warnings,proto3" json:"warnings,omitempty"`
+	Issues        []*LintIssue           `protobuf:"bytes,4,rep,name=issues,proto3" json:"issues,omitempty"`
+	Pages         []*MeasurePage         `protobuf:"bytes,5,rep,name=pages,proto3" json:"pages,omitempty"`        // Every text box page with its widest line
+	Overflow      bool                   `protobuf:"varint,6,opt,name=overflow,proto3" json:"overflow,omitempty"` // A page is wider than its line width
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Validation) Reset() {
+	*x = Validation{}
+	mi := &file_daemon_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Validation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Validation) ProtoMessage() {}
+
+func (x *Validation) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Validation.ProtoReflect.Descriptor instead.
+func (*Validation) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Validation) GetId() int32 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Validation) GetErrors() int32 {
+	if x != nil {
+		return x.Errors
+	}
+	return 0
+}
+
+func (x *Validation) GetWarnings() int32 {
+	if x != nil {
+		return x.Warnings
+	}
+	return 0
+}
+
+func (x *Validation) GetIssues() []*LintIssue {
+	if x != nil {
+		return x.Issues
+	}
+	return nil
+}
+
+func (x *Validation) GetPages() []*MeasurePage {
+	if x != nil {
+		return x.Pages
+	}
+	return nil
+}
+
+func (x *Validation) GetOverflow() bool {
+	if x != nil {
+		return x.Overflow
+	}
+	return false
+}
+
+// LintIssue is a problem found by a lint rule
+type LintIssue struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Rule          string                 `protobuf:"bytes,1,opt,name=rule,proto3" json:"rule,omitempty"`
+	Severity      string                 `protobuf:"bytes,2,opt,name=severity,proto3" json:"severity,omitempty"`
+	DialogueId    int32                  `protobuf:"varint,3,opt,name=dialogue_id,json=dialogueId,proto3" json:"dialogue_id,omitempty"`
+	Term          string                 `protobuf:"bytes,4,opt,name=term,proto3" json:"term,omitempty"` // Subject the issue is grouped by (e.g. a glossary term)
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *LintIssue) Reset() {
+	*x = LintIssue{}
+	mi := &file_daemon_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *LintIssue) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*LintIssue) ProtoMessage() {}
+
+func (x *LintIssue) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use LintIssue.ProtoReflect.Descriptor instead.
+func (*LintIssue) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *LintIssue) GetRule() string {
+	if x != nil {
+		return x.Rule
+	}
+	return ""
+}
+
+func (x *LintIssue) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *LintIssue) GetDialogueId() int32 {
+	if x != nil {
+		return x.DialogueId
+	}
+	return 0
+}
+
+func (x *LintIssue) GetTerm() string {
+	if x != nil {
+		return x.Term
+	}
+	return ""
+}
+
+func (x *LintIssue) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// MeasurePage is the measure of a text box page
+type MeasurePage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DialogueId    int32                  `protobuf:"varint,1,opt,name=dialogue_id,json=dialogueId,proto3" json:"dialogue_id,omitempty"`
+	Page          int32                  `protobuf:"varint,2,opt,name=page,proto3" json:"page,omitempty"` // From 1
+	FontHeight    int32                  `protobuf:"varint,3,opt,name=font_height,json=fontHeight,proto3" json:"font_height,omitempty"`
+	Lines         int32                  `protobuf:"varint,4,opt,name=lines,proto3" json:"lines,omitempty"`
+	Chars         int32                  `protobuf:"varint,5,opt,name=chars,proto3" json:"chars,omitempty"`                                      // Characters drawn, spaces included
+	WidestLine    int32                  `protobuf:"varint,6,opt,name=widest_line,json=widestLine,proto3" json:"widest_line,omitempty"`          // Pixel width of the widest line
+	LineWidth     int32                  `protobuf:"varint,7,opt,name=line_width,json=lineWidth,proto3" json:"line_width,omitempty"`             // Pixel width available, 0 if unknown
+	OverflowLines int32                  `protobuf:"varint,8,opt,name=overflow_lines,json=overflowLines,proto3" json:"overflow_lines,omitempty"` // Lines wider than line_width
+	Overflow      int32                  `protobuf:"varint,9,opt,name=overflow,proto3" json:"overflow,omitempty"`                                // Pixels the widest line exceeds line_width by
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MeasurePage) Reset() {
+	*x = MeasurePage{}
+	mi := &file_daemon_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MeasurePage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MeasurePage) ProtoMessage() {}
+
+func (x *MeasurePage) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MeasurePage.ProtoReflect.Descriptor instead.
+func (*MeasurePage) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *MeasurePage) GetDialogueId() int32 {
+	if x != nil {
+		return x.DialogueId
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetPage() int32 {
+	if x != nil {
+		return x.Page
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetFontHeight() int32 {
+	if x != nil {
+		return x.FontHeight
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetLines() int32 {
+	if x != nil {
+		return x.Lines
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetChars() int32 {
+	if x != nil {
+		return x.Chars
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetWidestLine() int32 {
+	if x != nil {
+		return x.WidestLine
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetLineWidth() int32 {
+	if x != nil {
+		return x.LineWidth
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetOverflowLines() int32 {
+	if x != nil {
+		return x.OverflowLines
+	}
+	return 0
+}
+
+func (x *MeasurePage) GetOverflow() int32 {
+	if x != nil {
+		return x.Overflow
+	}
+	return 0
+}
+
+// WatchDialoguesRequest subscribes to reloads of the dialogue file
+type WatchDialoguesRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchDialoguesRequest) Reset() {
+	*x = WatchDialoguesRequest{}
+	mi := &file_daemon_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchDialoguesRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchDialoguesRequest) ProtoMessage() {}
+
+func (x *WatchDialoguesRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchDialoguesRequest.ProtoReflect.Descriptor instead.
+func (*WatchDialoguesRequest) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{8}
+}
+
+// DialoguesChanged is sent when the dialogue file is reloaded
+type DialoguesChanged struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	File          string                 `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	Dialogues     int32                  `protobuf:"varint,2,opt,name=dialogues,proto3" json:"dialogues,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DialoguesChanged) Reset() {
+	*x = DialoguesChanged{}
+	mi := &file_daemon_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DialoguesChanged) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DialoguesChanged) ProtoMessage() {}
+
+func (x *DialoguesChanged) ProtoReflect() protoreflect.Message {
+	mi := &file_daemon_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DialoguesChanged.ProtoReflect.Descriptor instead.
+func (*DialoguesChanged) Descriptor() ([]byte, []int) {
+	return file_daemon_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *DialoguesChanged) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *DialoguesChanged) GetDialogues() int32 {
+	if x != nil {
+		return x.Dialogues
+	}
+	return 0
+}
+
+var File_daemon_proto protoreflect.FileDescriptor
+
+const file_daemon_proto_rawDesc = "" +
+	"\n" +
+	"\fdaemon.proto\x12\x14tombatools.daemon.v1\x1a\x1cgoogle/protobuf/struct.proto\"'\n" +
+	"\x15DecodeDialogueRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\"\xcd\x01\n" +
+	"\bDialogue\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\x12\x1f\n" +
+	"\vfont_height\x18\x03 \x01(\x05R\n" +
+	"fontHeight\x123\n" +
+	"\boriginal\x18\x04 \x03(\v2\x17.google.protobuf.StructR\boriginal\x121\n" +
+	"\acurrent\x18\x05 \x03(\v2\x17.google.protobuf.StructR\acurrent\x12\x14\n" +
+	"\x05notes\x18\x06 \x01(\tR\x05notes\"\x86\x01\n" +
+	"\x14RenderPreviewRequest\x12\x12\n" +
+	"\x04text\x18\x01 \x01(\tR\x04text\x12\x13\n" +
+	"\x02id\x18\x02 \x01(\x05H\x00R\x02id\x88\x01\x01\x12\x10\n" +
+	"\x03box\x18\x03 \x01(\x05R\x03box\x12\x16\n" +
+	"\x06height\x18\x04 \x01(\x05R\x06height\x12\x14\n" +
+	"\x05width\x18\x05 \x01(\x05R\x05widthB\x05\n" +
+	"\x03_id\"I\n" +
+	"\aPreview\x12\x14\n" +
+	"\x05width\x18\x01 \x01(\x05R\x05width\x12\x16\n" +
+	"\x06height\x18\x02 \x01(\x05R\x06height\x12\x10\n" +
+	"\x03png\x18\x03 \x01(\fR\x03png\"z\n" +
+	"\x13ValidateEditRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x17\n" +
+	"\x04text\x18\x02 \x01(\tH\x00R\x04text\x88\x01\x01\x121\n" +
+	"\acontent\x18\x03 \x03(\v2\x17.google.protobuf.StructR\acontentB\a\n" +
+	"\x05_text\"\xde\x01\n" +
+	"\n" +
+	"Validation\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x05R\x02id\x12\x16\n" +
+	"\x06errors\x18\x02 \x01(\x05R\x06errors\x12\x1a\n" +
+	"\bwarnings\x18\x03 \x01(\x05R\bwarnings\x127\n" +
+	"\x06issues\x18\x04 \x03(\v2\x1f.tombatools.daemon.v1.LintIssueR\x06issues\x127\n" +
+	"\x05pages\x18\x05 \x03(\v2!.tombatools.daemon.v1.MeasurePageR\x05pages\x12\x1a\n" +
+	"\boverflow\x18\x06 \x01(\bR\boverflow\"\x8a\x01\n" +
+	"\tLintIssue\x12\x12\n" +
+	"\x04rule\x18\x01 \x01(\tR\x04rule\x12\x1a\n" +
+	"\bseverity\x18\x02 \x01(\tR\bseverity\x12\x1f\n" +
+	"\vdialogue_id\x18\x03 \x01(\x05R\n" +
+	"dialogueId\x12\x12\n" +
+	"\x04term\x18\x04 \x01(\tR\x04term\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\"\x92\x02\n" +
+	"\vMeasurePage\x12\x1f\n" +
+	"\vdialogue_id\x18\x01 \x01(\x05R\n" +
+	"dialogueId\x12\x12\n" +
+	"\x04page\x18\x02 \x01(\x05R\x04page\x12\x1f\n" +
+	"\vfont_height\x18\x03 \x01(\x05R\n" +
+	"fontHeight\x12\x14\n" +
+	"\x05lines\x18\x04 \x01(\x05R\x05lines\x12\x14\n" +
+	"\x05chars\x18\x05 \x01(\x05R\x05chars\x12\x1f\n" +
+	"\vwidest_line\x18\x06 \x01(\x05R\n" +
+	"widestLine\x12\x1d\n" +
+	"\n" +
+	"line_width\x18\a \x01(\x05R\tlineWidth\x12%\n" +
+	"\x0eoverflow_lines\x18\b \x01(\x05R\roverflowLines\x12\x1a\n" +
+	"\boverflow\x18\t \x01(\x05R\boverflow\"\x17\n" +
+	"\x15WatchDialoguesRequest\"D\n" +
+	"\x10DialoguesChanged\x12\x12\n" +
+	"\x04file\x18\x01 \x01(\tR\x04file\x12\x1c\n" +
+	"\tdialogues\x18\x02 \x01(\x05R\tdialogues2\x89\x03\n" +
+	"\x06Daemon\x12]\n" +
+	"\x0eDecodeDialogue\x12+.tombatools.daemon.v1.DecodeDialogueRequest\x1a\x1e.tombatools.daemon.v1.Dialogue\x12Z\n" +
+	"\rRenderPreview\x12*.tombatools.daemon.v1.RenderPreviewRequest\x1a\x1d.tombatools.daemon.v1.Preview\x12[\n" +
+	"\fValidateEdit\x12).tombatools.daemon.v1.ValidateEditRequest\x1a .tombatools.daemon.v1.Validation\x12g\n" +
+	"\x0eWatchDialogues\x12+.tombatools.daemon.v1.WatchDialoguesRequest\x1a&.tombatools.daemon.v1.DialoguesChanged0\x01B/Z-github.com/hansbonini/tombatools/pkg/daemonpbb\x06proto3"
+
+var (
+	file_daemon_proto_rawDescOnce sync.Once
+	file_daemon_proto_rawDescData []byte
+)
+
+func file_daemon_proto_rawDescGZIP() []byte {
+	file_daemon_proto_rawDescOnce.Do(func() {
+		file_daemon_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_daemon_proto_rawDesc), len(file_daemon_proto_rawDesc)))
+	})
+	return file_daemon_proto_rawDescData
+}
+
+var file_daemon_proto_msgTypes = make([]protoimpl.MessageInfo, 10)
+var file_daemon_proto_goTypes = []any{
+	(*DecodeDialogueRequest)(nil), // 0: tombatools.daemon.v1.DecodeDialogueRequest
+	(*Dialogue)(nil),              // 1: tombatools.daemon.v1.Dialogue
+	(*RenderPreviewRequest)(nil),  // 2: tombatools.daemon.v1.RenderPreviewRequest
+	(*Preview)(nil),               // 3: tombatools.daemon.v1.Preview
+	(*ValidateEditRequest)(nil),   // 4: tombatools.daemon.v1.ValidateEditRequest
+	(*Validation)(nil),            // 5: tombatools.daemon.v1.Validation
+	(*LintIssue)(nil),             // 6: tombatools.daemon.v1.LintIssue
+	(*MeasurePage)(nil),           // 7: tombatools.daemon.v1.MeasurePage
+	(*WatchDialoguesRequest)(nil), // 8: tombatools.daemon.v1.WatchDialoguesRequest
+	(*DialoguesChanged)(nil),      // 9: tombatools.daemon.v1.DialoguesChanged
+	(*structpb.Struct)(nil),       // 10: google.protobuf.Struct
+}
+var file_daemon_proto_depIdxs = []int32{
+	10, // 0: tombatools.daemon.v1.Dialogue.original:type_name -> google.protobuf.Struct
+	10, // 1: tombatools.daemon.v1.Dialogue.current:type_name -> google.protobuf.Struct
+	10, // 2: tombatools.daemon.v1.ValidateEditRequest.content:type_name -> google.protobuf.Struct
+	6,  // 3: tombatools.daemon.v1.Validation.issues:type_name -> tombatools.daemon.v1.LintIssue
+	7,  // 4: tombatools.daemon.v1.Validation.pages:type_name -> tombatools.daemon.v1.MeasurePage
+	0,  // 5: tombatools.daemon.v1.Daemon.DecodeDialogue:input_type -> tombatools.daemon.v1.DecodeDialogueRequest
+	2,  // 6: tombatools.daemon.v1.Daemon.RenderPreview:input_type -> tombatools.daemon.v1.RenderPreviewRequest
+	4,  // 7: tombatools.daemon.v1.Daemon.ValidateEdit:input_type -> tombatools.daemon.v1.ValidateEditRequest
+	8,  // 8: tombatools.daemon.v1.Daemon.WatchDialogues:input_type -> tombatools.daemon.v1.WatchDialoguesRequest
+	1,  // 9: tombatools.daemon.v1.Daemon.DecodeDialogue:output_type -> tombatools.daemon.v1.Dialogue
+	3,  // 10: tombatools.daemon.v1.Daemon.RenderPreview:output_type -> tombatools.daemon.v1.Preview
+	5,  // 11: tombatools.daemon.v1.Daemon.ValidateEdit:output_type -> tombatools.daemon.v1.Validation
+	9,  // 12: tombatools.daemon.v1.Daemon.WatchDialogues:output_type -> tombatools.daemon.v1.DialoguesChanged
+	9,  // [9:13] is the sub-list for method output_type
+	5,  // [5:9] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_daemon_proto_init() }
+func file_daemon_proto_init() {
+	if File_daemon_proto != nil {
+		return
+	}
+	file_daemon_proto_msgTypes[2].OneofWrappers = []any{}
+	file_daemon_proto_msgTypes[4].OneofWrappers = []any{}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_daemon_proto_rawDesc), len(file_daemon_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   10,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_daemon_proto_goTypes,
+		DependencyIndexes: file_daemon_proto_depIdxs,
+		MessageInfos:      file_daemon_proto_msgTypes,
+	}.Build()
+	File_daemon_proto = out.File
+	file_daemon_proto_goTypes = nil
+	file_daemon_proto_depIdxs = nil
+}
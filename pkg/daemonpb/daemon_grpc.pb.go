@@ -0,0 +1,254 @@
+// The gRPC service of tombatools daemon: editor plugins decode dialogues, render previews
+// in the game font and validate unsaved edits while a translator types.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: daemon.proto
+
+package daemonpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Daemon_DecodeDialogue_FullMethodName = "/tombatools.daemon.v1.Daemon/DecodeDialogue"
+	Daemon_RenderPreview_FullMethodName  = "/tombatools.daemon.v1.Daemon/RenderPreview"
+	Daemon_ValidateEdit_FullMethodName   = "/tombatools.daemon.v1.Daemon/ValidateEdit"
+	Daemon_WatchDialogues_FullMethodName = "/tombatools.daemon.v1.Daemon/WatchDialogues"
+)
+
+// DaemonClient is the client API for Daemon service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Daemon keeps a WFM font and a dialogue file loaded
+type DaemonClient interface {
+	// DecodeDialogue decodes a dialogue of the WFM file, with its content in the dialogue file
+	DecodeDialogue(ctx context.Context, in *DecodeDialogueRequest, opts ...grpc.CallOption) (*Dialogue, error)
+	// RenderPreview draws text, or a box of a dialogue, in the game font
+	RenderPreview(ctx context.Context, in *RenderPreviewRequest, opts ...grpc.CallOption) (*Preview, error)
+	// ValidateEdit lints an unsaved dialogue and measures its pages
+	ValidateEdit(ctx context.Context, in *ValidateEditRequest, opts ...grpc.CallOption) (*Validation, error)
+	// WatchDialogues streams an event whenever the dialogue file is reloaded
+	WatchDialogues(ctx context.Context, in *WatchDialoguesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DialoguesChanged], error)
+}
+
+type daemonClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewDaemonClient(cc grpc.ClientConnInterface) DaemonClient {
+	return &daemonClient{cc}
+}
+
+func (c *daemonClient) DecodeDialogue(ctx context.Context, in *DecodeDialogueRequest, opts ...grpc.CallOption) (*Dialogue, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Dialogue)
+	err := c.cc.Invoke(ctx, Daemon_DecodeDialogue_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) RenderPreview(ctx context.Context, in *RenderPreviewRequest, opts ...grpc.CallOption) (*Preview, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Preview)
+	err := c.cc.Invoke(ctx, Daemon_RenderPreview_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) ValidateEdit(ctx context.Context, in *ValidateEditRequest, opts ...grpc.CallOption) (*Validation, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Validation)
+	err := c.cc.Invoke(ctx, Daemon_ValidateEdit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *daemonClient) WatchDialogues(ctx context.Context, in *WatchDialoguesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[DialoguesChanged], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Daemon_ServiceDesc.Streams[0], Daemon_WatchDialogues_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchDialoguesRequest, DialoguesChanged]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_WatchDialoguesClient = grpc.ServerStreamingClient[DialoguesChanged]
+
+// DaemonServer is the server API for Daemon service.
+// All implementations must embed UnimplementedDaemonServer
+// for forward compatibility.
+//
+// Daemon keeps a WFM font and a dialogue file loaded
+type DaemonServer interface {
+	// DecodeDialogue decodes a dialogue of the WFM file, with its content in the dialogue file
+	DecodeDialogue(context.Context, *DecodeDialogueRequest) (*Dialogue, error)
+	// RenderPreview draws text, or a box of a dialogue, in the game font
+	RenderPreview(context.Context, *RenderPreviewRequest) (*Preview, error)
+	// ValidateEdit lints an unsaved dialogue and measures its pages
+	ValidateEdit(context.Context, *ValidateEditRequest) (*Validation, error)
+	// WatchDialogues streams an event whenever the dialogue file is reloaded
+	WatchDialogues(*WatchDialoguesRequest, grpc.ServerStreamingServer[DialoguesChanged]) error
+	mustEmbedUnimplementedDaemonServer()
+}
+
+// UnimplementedDaemonServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedDaemonServer struct{}
+
+func (UnimplementedDaemonServer) DecodeDialogue(context.Context, *DecodeDialogueRequest) (*Dialogue, error) {
+	return nil, status.Error(codes.Unimplemented, "method DecodeDialogue not implemented")
+}
+func (UnimplementedDaemonServer) RenderPreview(context.Context, *RenderPreviewRequest) (*Preview, error) {
+	return nil, status.Error(codes.Unimplemented, "method RenderPreview not implemented")
+}
+func (UnimplementedDaemonServer) ValidateEdit(context.Context, *ValidateEditRequest) (*Validation, error) {
+	return nil, status.Error(codes.Unimplemented, "method ValidateEdit not implemented")
+}
+func (UnimplementedDaemonServer) WatchDialogues(*WatchDialoguesRequest, grpc.ServerStreamingServer[DialoguesChanged]) error {
+	return status.Error(codes.Unimplemented, "method WatchDialogues not implemented")
+}
+func (UnimplementedDaemonServer) mustEmbedUnimplementedDaemonServer() {}
+func (UnimplementedDaemonServer) testEmbeddedByValue()                {}
+
+// UnsafeDaemonServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to DaemonServer will
+// result in compilation errors.
+type UnsafeDaemonServer interface {
+	mustEmbedUnimplementedDaemonServer()
+}
+
+func RegisterDaemonServer(s grpc.ServiceRegistrar, srv DaemonServer) {
+	// If the following call panics, it indicates UnimplementedDaemonServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Daemon_ServiceDesc, srv)
+}
+
+func _Daemon_DecodeDialogue_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DecodeDialogueRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).DecodeDialogue(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Daemon_DecodeDialogue_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).DecodeDialogue(ctx, req.(*DecodeDialogueRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_RenderPreview_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenderPreviewRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).RenderPreview(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Daemon_RenderPreview_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).RenderPreview(ctx, req.(*RenderPreviewRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_ValidateEdit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ValidateEditRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(DaemonServer).ValidateEdit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Daemon_ValidateEdit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(DaemonServer).ValidateEdit(ctx, req.(*ValidateEditRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Daemon_WatchDialogues_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchDialoguesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(DaemonServer).WatchDialogues(m, &grpc.GenericServerStream[WatchDialoguesRequest, DialoguesChanged]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Daemon_WatchDialoguesServer = grpc.ServerStreamingServer[DialoguesChanged]
+
+// Daemon_ServiceDesc is the grpc.ServiceDesc for Daemon service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Daemon_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "tombatools.daemon.v1.Daemon",
+	HandlerType: (*DaemonServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "DecodeDialogue",
+			Handler:    _Daemon_DecodeDialogue_Handler,
+		},
+		{
+			MethodName: "RenderPreview",
+			Handler:    _Daemon_RenderPreview_Handler,
+		},
+		{
+			MethodName: "ValidateEdit",
+			Handler:    _Daemon_ValidateEdit_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchDialogues",
+			Handler:       _Daemon_WatchDialogues_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "daemon.proto",
+}
@@ -0,0 +1,8 @@
+// Package daemonpb holds the protocol buffer messages and the gRPC service of the editor
+// daemon, generated from daemon.proto. Regenerate them with protoc, protoc-gen-go and
+// protoc-gen-go-grpc installed:
+//
+//	go generate ./pkg/daemonpb
+package daemonpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative daemon.proto
@@ -0,0 +1,168 @@
+// Package daemonserver serves the editor daemon of package pkg over gRPC, as the service of
+// package daemonpb. It is kept apart from pkg so that only the daemon command, and not
+// every tool importing pkg, depends on gRPC and protocol buffers.
+package daemonserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/daemonpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Serve answers the gRPC requests of the connections of a listener, and watches the
+// dialogue file of the daemon, until ctx is done
+func Serve(ctx context.Context, daemon *pkg.Daemon, listener net.Listener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go daemon.Watch(ctx)
+
+	server := grpc.NewServer()
+	daemonpb.RegisterDaemonServer(server, &daemonServer{daemon: daemon})
+	reflection.Register(server)
+	go func() {
+		<-ctx.Done()
+		server.Stop()
+	}()
+	if err := server.Serve(listener); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to serve: %w", err)
+	}
+	return nil
+}
+
+// daemonServer adapts a Daemon to the gRPC service of package daemonpb
+type daemonServer struct {
+	daemonpb.UnimplementedDaemonServer
+	daemon *pkg.Daemon
+}
+
+// DecodeDialogue answers the DecodeDialogue method
+func (s *daemonServer) DecodeDialogue(_ context.Context, request *daemonpb.DecodeDialogueRequest) (*daemonpb.Dialogue, error) {
+	dialogue, err := s.daemon.DecodeDialogue(int(request.GetId()))
+	if err != nil {
+		return nil, statusError(err)
+	}
+	original, err := contentStructs(dialogue.Original)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	current, err := contentStructs(dialogue.Current)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &daemonpb.Dialogue{
+		Id:         int32(dialogue.ID),
+		Type:       dialogue.Type,
+		FontHeight: int32(dialogue.FontHeight),
+		Original:   original,
+		Current:    current,
+		Notes:      dialogue.Notes,
+	}, nil
+}
+
+// RenderPreview answers the RenderPreview method
+func (s *daemonServer) RenderPreview(_ context.Context, request *daemonpb.RenderPreviewRequest) (*daemonpb.Preview, error) {
+	params := pkg.DaemonRenderParams{Text: request.GetText(), Box: int(request.GetBox()), Height: int(request.GetHeight()), Width: int(request.GetWidth())}
+	if request.Id != nil {
+		id := int(request.GetId())
+		params.ID = &id
+	}
+	preview, err := s.daemon.RenderPreview(params)
+	if err != nil {
+		return nil, statusError(err)
+	}
+	return &daemonpb.Preview{Width: int32(preview.Width), Height: int32(preview.Height), Png: preview.PNG}, nil
+}
+
+// ValidateEdit answers the ValidateEdit method
+func (s *daemonServer) ValidateEdit(_ context.Context, request *daemonpb.ValidateEditRequest) (*daemonpb.Validation, error) {
+	params := pkg.DaemonEditParams{ID: int(request.GetId()), Text: request.Text}
+	for _, item := range request.GetContent() {
+		params.Content = append(params.Content, item.AsMap())
+	}
+	validation, err := s.daemon.ValidateEdit(params)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	result := &daemonpb.Validation{
+		Id:       int32(validation.ID),
+		Errors:   int32(validation.Errors),
+		Warnings: int32(validation.Warnings),
+		Overflow: validation.Overflow,
+	}
+	for _, issue := range validation.Issues {
+		result.Issues = append(result.Issues, &daemonpb.LintIssue{
+			Rule:       issue.Rule,
+			Severity:   issue.Severity,
+			DialogueId: int32(issue.DialogueID),
+			Term:       issue.Term,
+			Message:    issue.Message,
+		})
+	}
+	for _, page := range validation.Pages {
+		result.Pages = append(result.Pages, &daemonpb.MeasurePage{
+			DialogueId:    int32(page.DialogueID),
+			Page:          int32(page.Page),
+			FontHeight:    int32(page.FontHeight),
+			Lines:         int32(page.Lines),
+			Chars:         int32(page.Chars),
+			WidestLine:    int32(page.WidestLine),
+			LineWidth:     int32(page.LineWidth),
+			OverflowLines: int32(page.OverflowLines),
+			Overflow:      int32(page.Overflow),
+		})
+	}
+	return result, nil
+}
+
+// WatchDialogues streams the reloads of the dialogue file until the client goes away
+func (s *daemonServer) WatchDialogues(_ *daemonpb.WatchDialoguesRequest, stream daemonpb.Daemon_WatchDialoguesServer) error {
+	changes, cancel := s.daemon.Subscribe()
+	defer cancel()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case change := <-changes:
+			if err := stream.Send(&daemonpb.DialoguesChanged{File: change.File, Dialogues: int32(change.Dialogues)}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// contentStructs converts dialogue content items to protocol buffer structs
+func contentStructs(content []map[string]interface{}) ([]*structpb.Struct, error) {
+	items := make([]*structpb.Struct, 0, len(content))
+	for i, item := range content {
+		converted, err := structpb.NewStruct(item)
+		if err != nil {
+			return nil, fmt.Errorf("content item %d: %w", i, err)
+		}
+		items = append(items, converted)
+	}
+	return items, nil
+}
+
+// statusError turns an error of the daemon into a gRPC status with the code of its
+// category
+func statusError(err error) error {
+	code := codes.Internal
+	switch {
+	case errors.Is(err, common.ErrCategoryInputNotFound):
+		code = codes.NotFound
+	case errors.Is(err, common.ErrCategoryValidationFailed):
+		code = codes.InvalidArgument
+	}
+	return status.Error(code, err.Error())
+}
@@ -0,0 +1,215 @@
+// Package daemonserver provides tests for the gRPC service of the editor daemon
+package daemonserver
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"image/png"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/daemonpb"
+	"github.com/hansbonini/tombatools/pkg/wfm"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// writeTestFont writes a WFM file with 8x8 glyphs for 'A' (0x8000) and 'B' (0x8001) and
+// the dialogues "AB" and "B", and a reference font directory mapping the glyphs back
+func writeTestFont(t *testing.T, dir string) (wfmFile, fontDir string) {
+	t.Helper()
+
+	file := &wfm.File{
+		Glyphs: []wfm.Glyph{
+			{GlyphWidth: 8, GlyphHeight: 8, GlyphClut: 0x1234, GlyphImage: bytes.Repeat([]byte{0x11}, 32)},
+			{GlyphWidth: 8, GlyphHeight: 8, GlyphClut: 0x1234, GlyphImage: bytes.Repeat([]byte{0x22}, 32)},
+		},
+	}
+	for _, words := range [][]uint16{{0x8000, 0x8001, 0xFFFF}, {0x8001, 0xFFFF}} {
+		data := make([]byte, 2*len(words))
+		for i, word := range words {
+			binary.LittleEndian.PutUint16(data[2*i:], word)
+		}
+		file.Dialogues = append(file.Dialogues, wfm.Dialogue{Data: data})
+	}
+	layout, err := wfm.PlanLayout(file.Glyphs, file.Dialogues)
+	if err != nil {
+		t.Fatalf("PlanLayout() failed: %v", err)
+	}
+	if file.GlyphPointerTable, err = layout.GlyphPointers(); err != nil {
+		t.Fatalf("GlyphPointers() failed: %v", err)
+	}
+	if file.DialoguePointerTable, err = layout.DialoguePointers(); err != nil {
+		t.Fatalf("DialoguePointers() failed: %v", err)
+	}
+	copy(file.Header.Magic[:], common.WFMFileMagic)
+	file.Header.DialoguePointerTable = layout.DialoguePointerTable
+	file.Header.TotalGlyphs = uint16(len(file.Glyphs))
+	file.Header.TotalDialogues = uint16(len(file.Dialogues))
+
+	wfmFile = filepath.Join(dir, "FONT.WFM")
+	output, err := os.Create(wfmFile)
+	if err != nil {
+		t.Fatalf("failed to create WFM file: %v", err)
+	}
+	defer output.Close()
+	if err := wfm.Write(context.Background(), output, file); err != nil {
+		t.Fatalf("wfm.Write() failed: %v", err)
+	}
+
+	// The exported glyph images, named by character, are the reference font
+	if err := pkg.NewWFMExporter().ExportGlyphs(file, dir); err != nil {
+		t.Fatalf("ExportGlyphs() failed: %v", err)
+	}
+	fontDir = filepath.Join(dir, "fonts")
+	if err := os.MkdirAll(fontDir, 0755); err != nil {
+		t.Fatalf("failed to create font directory: %v", err)
+	}
+	for glyph, char := range []rune{'A', 'B'} {
+		exported := filepath.Join(dir, "glyphs", fmt.Sprintf("glyph_%04d.png", glyph))
+		if err := os.Rename(exported, filepath.Join(fontDir, fmt.Sprintf("%04X.png", char))); err != nil {
+			t.Fatalf("failed to move glyph %d: %v", glyph, err)
+		}
+	}
+	return wfmFile, fontDir
+}
+
+// writeTestDialogues writes a dialogue file in which dialogue 0 reads text
+func writeTestDialogues(t *testing.T, path, text string) {
+	t.Helper()
+
+	yaml := `total_dialogues: 2
+original_size: 0
+dialogues:
+  - id: 0
+    type: dialogue
+    font_height: 8
+    font_clut: 0
+    terminator: halt
+    content:
+      - text: ` + text + `
+    notes: Tomba, after the first fall
+  - id: 1
+    type: dialogue
+    font_height: 8
+    font_clut: 0
+    terminator: halt
+    content:
+      - text: B
+    notes: ""
+`
+	if err := os.WriteFile(path, []byte(yaml), 0644); err != nil {
+		t.Fatalf("failed to write dialogues: %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	dir := t.TempDir()
+	wfmFile, fontDir := writeTestFont(t, dir)
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	writeTestDialogues(t, yamlFile, "BA")
+
+	daemon, err := pkg.NewDaemon(pkg.DaemonOptions{
+		WFMFile:      wfmFile,
+		Dialogues:    yamlFile,
+		FontDir:      fontDir,
+		Rules:        []pkg.LintRule{pkg.NewLineWidthRule()},
+		PollInterval: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("NewDaemon() failed: %v", err)
+	}
+
+	listener := bufconn.Listen(1 << 20)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() { served <- Serve(ctx, daemon, listener) }()
+	defer func() {
+		cancel()
+		if err := <-served; err != nil {
+			t.Errorf("Serve() failed: %v", err)
+		}
+	}()
+	conn, err := grpc.NewClient("passthrough:///daemon",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("grpc.NewClient() failed: %v", err)
+	}
+	defer conn.Close()
+	client := daemonpb.NewDaemonClient(conn)
+	watch, err := client.WatchDialogues(ctx, &daemonpb.WatchDialoguesRequest{})
+	if err != nil {
+		t.Fatalf("WatchDialogues() failed: %v", err)
+	}
+
+	// The original text comes from the WFM file, the current one from the YAML file
+	dialogue, err := client.DecodeDialogue(ctx, &daemonpb.DecodeDialogueRequest{Id: 0})
+	if err != nil {
+		t.Fatalf("DecodeDialogue() failed: %v", err)
+	}
+	if dialogue.Original[0].AsMap()["text"] != "AB" || dialogue.Current[0].AsMap()["text"] != "BA" || dialogue.Notes != "Tomba, after the first fall" {
+		t.Errorf("DecodeDialogue() = %v, want original AB, current BA and the notes", dialogue)
+	}
+	if _, err := client.DecodeDialogue(ctx, &daemonpb.DecodeDialogueRequest{Id: 9}); status.Code(err) != codes.NotFound {
+		t.Errorf("DecodeDialogue(9) error = %v, want %v", err, codes.NotFound)
+	}
+
+	preview, err := client.RenderPreview(ctx, &daemonpb.RenderPreviewRequest{Text: "ABA", Height: 8})
+	if err != nil {
+		t.Fatalf("RenderPreview() failed: %v", err)
+	}
+	if img, err := png.Decode(bytes.NewReader(preview.Png)); err != nil || preview.Width != 24 || preview.Height != 8 || img.Bounds().Dx() != 24 {
+		t.Errorf("RenderPreview() = %dx%d (%v), want a 24x8 image", preview.Width, preview.Height, err)
+	}
+
+	// Dialogue 0 is 16 pixels wide in the original font
+	text := "ABA"
+	validation, err := client.ValidateEdit(ctx, &daemonpb.ValidateEditRequest{Id: 0, Text: &text})
+	if err != nil {
+		t.Fatalf("ValidateEdit() failed: %v", err)
+	}
+	if !validation.Overflow || len(validation.Pages) != 1 || validation.Pages[0].Overflow != 8 {
+		t.Errorf("ValidateEdit(ABA) = %v, want an 8 pixel overflow", validation)
+	}
+	content, err := structpb.NewStruct(map[string]interface{}{"text": "BB"})
+	if err != nil {
+		t.Fatalf("structpb.NewStruct() failed: %v", err)
+	}
+	if validation, err = client.ValidateEdit(ctx, &daemonpb.ValidateEditRequest{Id: 0, Content: []*structpb.Struct{content}}); err != nil {
+		t.Fatalf("ValidateEdit() failed: %v", err)
+	}
+	if validation.Overflow {
+		t.Errorf("ValidateEdit(BB) = %v, want no overflow", validation)
+	}
+	if _, err := client.ValidateEdit(ctx, &daemonpb.ValidateEditRequest{Id: 0}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ValidateEdit() without an edit error = %v, want %v", err, codes.InvalidArgument)
+	}
+
+	// Saving the dialogue file notifies the stream and later requests see the change
+	writeTestDialogues(t, yamlFile, "BBB")
+	change, err := watch.Recv()
+	if err != nil {
+		t.Fatalf("WatchDialogues() Recv failed: %v", err)
+	}
+	if change.File != yamlFile || change.Dialogues != 2 {
+		t.Errorf("change after saving = %v, want %s with 2 dialogues", change, yamlFile)
+	}
+	if dialogue, err = client.DecodeDialogue(ctx, &daemonpb.DecodeDialogueRequest{Id: 0}); err != nil {
+		t.Fatalf("DecodeDialogue() failed: %v", err)
+	}
+	if dialogue.Current[0].AsMap()["text"] != "BBB" {
+		t.Errorf("DecodeDialogue() after saving = %v, want current BBB", dialogue)
+	}
+}
@@ -3,10 +3,16 @@ package pkg
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
 )
 
 // Helper function to write binary data with error checking
@@ -110,6 +116,23 @@ func TestWFMFileDecoder_DecodeHeader_IncompleteData(t *testing.T) {
 	}
 }
 
+func TestWFMFileDecoder_Decode_Truncated(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "FONT.WFM")
+	writeDonorWFM(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Cut in the header, the glyph pointer table and the glyph images
+	for _, size := range []int{10, WFMHeaderSize + 1, WFMHeaderSize + 20} {
+		_, err := NewWFMDecoder().Decode(bytes.NewReader(data[:size]))
+		if common.ExitCodeFor(err) != common.ExitFormatError {
+			t.Errorf("Decode(%d of %d bytes) error = %v, want a format error", size, len(data), err)
+		}
+	}
+}
+
 func TestWFMFileDecoder_DecodeGlyphs(t *testing.T) {
 	decoder := NewWFMDecoder()
 
@@ -392,3 +415,146 @@ func TestWFMFileDecoder_Decode_Complete(t *testing.T) {
 		t.Errorf("len(Dialogues) = %d, want 1", len(wfm.Dialogues))
 	}
 }
+
+func TestWFMFileDecoder_Decode_LazyGlyphs(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+	data, err := os.ReadFile(fontFile)
+	if err != nil {
+		t.Fatalf("failed to read font: %v", err)
+	}
+
+	eager, err := NewWFMDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	decoder := NewWFMDecoder()
+	decoder.SetLazyGlyphs(true)
+	lazy, err := decoder.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode(lazy) failed: %v", err)
+	}
+
+	// The dialogues after the glyphs are found, so the images were skipped exactly
+	if !reflect.DeepEqual(lazy.Dialogues, eager.Dialogues) {
+		t.Errorf("lazy dialogues = %v, want %v", lazy.Dialogues, eager.Dialogues)
+	}
+	for i, glyph := range lazy.Glyphs {
+		if glyph.GlyphImage != nil {
+			t.Errorf("glyph %d image loaded while decoding", i)
+		}
+		if glyph.ImageSize() != 32 {
+			t.Errorf("glyph %d ImageSize() = %d, want 32", i, glyph.ImageSize())
+		}
+		image, err := glyph.Image()
+		if err != nil || !bytes.Equal(image, eager.Glyphs[i].GlyphImage) {
+			t.Errorf("glyph %d Image() = % X, %v; want % X", i, image, err, eager.Glyphs[i].GlyphImage)
+		}
+	}
+
+	glyph := lazy.Glyphs[1]
+	if err := glyph.LoadImage(); err != nil || !bytes.Equal(glyph.GlyphImage, eager.Glyphs[1].GlyphImage) {
+		t.Errorf("LoadImage() = %v, GlyphImage % X", err, glyph.GlyphImage)
+	}
+
+	// A truncated image leaves a placeholder, as it does when read in full
+	truncated := data[:WFMHeaderSize+4+8+32+8+16]
+	_, glyphs, err := decoder.DecodeGlyphs(bytes.NewReader(truncated[WFMHeaderSize:]), &WFMHeader{TotalGlyphs: 2})
+	if err != nil {
+		t.Fatalf("DecodeGlyphs(truncated) failed: %v", err)
+	}
+	if !glyphs[1].IsPlaceholder() || glyphs[0].ImageSize() != 32 {
+		t.Errorf("truncated glyphs = %+v, want a glyph and a placeholder", glyphs)
+	}
+}
+
+func TestWFMFileProcessor_Process_DialoguesOnly(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+
+	outputDir := filepath.Join(dir, "output")
+	processor := NewWFMProcessor()
+	processor.SetDialoguesOnly(true)
+	processor.SetUnmappedLog("")
+	if err := processor.Process(fontFile, outputDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(outputDir, "glyphs")); !os.IsNotExist(err) {
+		t.Errorf("glyphs directory written with dialogues only (stat error %v)", err)
+	}
+	dialogues, err := dialogueyaml.Read(filepath.Join(outputDir, "dialogues.yaml"))
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	if len(dialogues.Dialogues) != 2 {
+		t.Errorf("%d dialogues exported, want 2", len(dialogues.Dialogues))
+	}
+	for _, dialogue := range dialogues.Dialogues {
+		if dialogue.FontClut != 0x1234 || dialogue.Palette != PaletteDialogue {
+			t.Errorf("dialogue %d font_clut 0x%04X palette %q, want 0x1234 drawn with %q", dialogue.ID, dialogue.FontClut, dialogue.Palette, PaletteDialogue)
+		}
+	}
+}
+
+func TestDialogueNotes_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+
+	outputDir := filepath.Join(dir, "output")
+	processor := NewWFMProcessor()
+	processor.SetDialoguesOnly(true)
+	processor.SetUnmappedLog("")
+	if err := processor.Process(fontFile, outputDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+	yamlFile := filepath.Join(outputDir, "dialogues.yaml")
+	exported, err := os.ReadFile(yamlFile)
+	if err != nil {
+		t.Fatalf("failed to read dialogues: %v", err)
+	}
+	if count := strings.Count(string(exported), "notes: \"\""); count != 2 {
+		t.Errorf("exported YAML has %d empty notes fields, want one per dialogue", count)
+	}
+
+	encode := func() []byte {
+		t.Helper()
+		encoder := NewWFMEncoder()
+		if err := encoder.SetGlyphDonor(fontFile); err != nil {
+			t.Fatalf("SetGlyphDonor() failed: %v", err)
+		}
+		data, err := encoder.EncodeBytes(context.Background(), yamlFile, "FONT.WFM")
+		if err != nil {
+			t.Fatalf("EncodeBytes() failed: %v", err)
+		}
+		return data
+	}
+	withoutNotes := encode()
+
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	dialogues.Dialogues[1].Notes = "Speaker: Charles\nScene: village gate"
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+	if !bytes.Equal(encode(), withoutNotes) {
+		t.Error("notes changed the encoded WFM file")
+	}
+
+	// Tools regenerating the YAML file keep the notes
+	if _, err := NewPauseAnalyzer().NormalizeFile(yamlFile, yamlFile, PauseNormalizeOptions{Scale: 1}); err != nil {
+		t.Fatalf("NormalizeFile() failed: %v", err)
+	}
+	regenerated, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	if regenerated.Dialogues[1].Notes != "Speaker: Charles\nScene: village gate" || regenerated.Dialogues[0].Notes != "" {
+		t.Errorf("regenerated notes = %q, %q; want the notes kept", regenerated.Dialogues[0].Notes, regenerated.Dialogues[1].Notes)
+	}
+}
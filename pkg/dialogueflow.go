@@ -0,0 +1,300 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue flow graph. The text of a dialogue holds no jump
+// targets: [PROMPT] takes no argument and the event script reads the answer once the
+// dialogue ends. The flow is taken from the event tables of the stage overlays instead
+// (see overlayevents.go): every event record triggers a dialogue, and the records of one
+// event, in table order, show their dialogues one after another; after a [PROMPT]
+// dialogue the answer selects which of the following ones, up to the next [PROMPT], is
+// shown. Dialogues no record reaches are reported as unreachable.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+// DialogueFlowFormatDOT writes the graph in the Graphviz DOT language
+const DialogueFlowFormatDOT = "dot"
+
+// Edge kinds of the dialogue flow graph
+const (
+	DialogueFlowTrigger = "trigger" // Event record to the dialogue it triggers
+	DialogueFlowNext    = "next"    // Dialogue to the next dialogue of the same event
+	DialogueFlowBranch  = "branch"  // [PROMPT] dialogue to a dialogue the answer may select
+)
+
+// DialogueFlowNode is a dialogue of the flow graph
+type DialogueFlowNode struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name,omitempty"`
+	Text       string `json:"text,omitempty"`   // Start of the text, for context only
+	Prompt     bool   `json:"prompt,omitempty"` // Ends with [PROMPT]
+	Terminator string `json:"terminator"`
+	Triggers   int    `json:"triggers"` // Event records triggering the dialogue
+}
+
+// DialogueFlowEvent is an event record of the flow graph
+type DialogueFlowEvent struct {
+	Key      string `json:"key"` // FILE/TABLE[index]
+	File     string `json:"file"`
+	Table    string `json:"table"`
+	Index    int    `json:"index"`
+	Event    *int   `json:"event,omitempty"`
+	Flag     *int   `json:"flag,omitempty"`
+	Label    string `json:"label,omitempty"`
+	Dialogue int    `json:"dialogue"`
+}
+
+// DialogueFlowEdge links two nodes of the flow graph. Dialogue nodes are named
+// dialogue:ID, event nodes event:KEY.
+type DialogueFlowEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+}
+
+// DialogueFlowGraph is the flow between the dialogues of a YAML file
+type DialogueFlowGraph struct {
+	Dialogues   string              `json:"dialogues"` // Dialogue YAML file
+	EventFiles  []string            `json:"event_files,omitempty"`
+	Nodes       []DialogueFlowNode  `json:"nodes"`
+	Events      []DialogueFlowEvent `json:"events,omitempty"`
+	Edges       []DialogueFlowEdge  `json:"edges"`
+	Unreachable []int               `json:"unreachable,omitempty"` // Dialogues no event reaches (only with event files)
+	Missing     []int               `json:"missing,omitempty"`     // Dialogue slots triggered by events but absent from the YAML file
+}
+
+// dialogueFlowNodeName returns the graph name of a dialogue node
+func dialogueFlowNodeName(id int) string {
+	return fmt.Sprintf("dialogue:%d", id)
+}
+
+// readOverlayEventsYAML reads an event mapping written by ovl dump
+func readOverlayEventsYAML(eventsFile string) (*OverlayEventsYAML, error) {
+	data, err := os.ReadFile(eventsFile)
+	if err != nil {
+		return nil, common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+
+	var document OverlayEventsYAML
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+	return &document, nil
+}
+
+// BuildDialogueFlowGraph builds the flow graph of the dialogues of a YAML file from the
+// event mappings written by ovl dump. Without event files the graph has no edges and no
+// dialogue is reported as unreachable.
+func BuildDialogueFlowGraph(dialoguesFile string, eventFiles []string) (*DialogueFlowGraph, error) {
+	dialogues, err := dialogueyaml.Read(dialoguesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	graph := &DialogueFlowGraph{Dialogues: filepath.Base(dialoguesFile), Nodes: []DialogueFlowNode{}, Edges: []DialogueFlowEdge{}}
+	nodes := make(map[int]int, len(dialogues.Dialogues)) // Node index of every dialogue ID
+	for _, dialogue := range dialogues.Dialogues {
+		nodes[dialogue.ID] = len(graph.Nodes)
+		graph.Nodes = append(graph.Nodes, DialogueFlowNode{
+			ID:         dialogue.ID,
+			Name:       dialogue.Name,
+			Text:       dialoguePreview(dialogue),
+			Prompt:     lastDialogueTag(dialogue) == "[PROMPT]",
+			Terminator: dialogue.Terminator.String(),
+		})
+	}
+
+	seen := make(map[DialogueFlowEdge]bool)
+	reached := make(map[int]bool)
+	missing := make(map[int]bool)
+	addEdge := func(edge DialogueFlowEdge, to int) {
+		if !seen[edge] {
+			seen[edge] = true
+			graph.Edges = append(graph.Edges, edge)
+		}
+		reached[to] = true
+		if _, found := nodes[to]; !found {
+			missing[to] = true
+		}
+	}
+	prompt := func(id int) bool {
+		index, found := nodes[id]
+		return found && graph.Nodes[index].Prompt
+	}
+
+	for _, eventsFile := range eventFiles {
+		document, err := readOverlayEventsYAML(eventsFile)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", eventsFile, err)
+		}
+		file := document.File
+		if file == "" {
+			file = filepath.Base(eventsFile)
+		}
+		graph.EventFiles = append(graph.EventFiles, filepath.Base(eventsFile))
+
+		for _, table := range document.Tables {
+			chains := make(map[int][]int) // Dialogues of every event ID, in table order
+			var order []int
+			for _, entry := range table.Entries {
+				event := DialogueFlowEvent{
+					Key:      fmt.Sprintf("%s/%s[%d]", file, table.Name, entry.Index),
+					File:     file,
+					Table:    table.Name,
+					Index:    entry.Index,
+					Event:    entry.Event,
+					Flag:     entry.Flag,
+					Label:    entry.Label,
+					Dialogue: entry.Dialogue,
+				}
+				graph.Events = append(graph.Events, event)
+				addEdge(DialogueFlowEdge{From: "event:" + event.Key, To: dialogueFlowNodeName(entry.Dialogue), Kind: DialogueFlowTrigger}, entry.Dialogue)
+				if index, found := nodes[entry.Dialogue]; found {
+					graph.Nodes[index].Triggers++
+				}
+
+				if entry.Event != nil {
+					if _, found := chains[*entry.Event]; !found {
+						order = append(order, *entry.Event)
+					}
+					chains[*entry.Event] = append(chains[*entry.Event], entry.Dialogue)
+				}
+			}
+
+			// A [PROMPT] dialogue leads to every dialogue of its event up to the next
+			// [PROMPT], which are alternative answers; a dialogue before the first
+			// [PROMPT] leads to the next one
+			for _, eventID := range order {
+				chain := chains[eventID]
+				answers := false
+				for i, from := range chain {
+					if !prompt(from) {
+						if !answers && i+1 < len(chain) && chain[i+1] != from {
+							addEdge(DialogueFlowEdge{From: dialogueFlowNodeName(from), To: dialogueFlowNodeName(chain[i+1]), Kind: DialogueFlowNext}, chain[i+1])
+						}
+						continue
+					}
+					answers = true
+					for _, to := range chain[i+1:] {
+						if to != from {
+							addEdge(DialogueFlowEdge{From: dialogueFlowNodeName(from), To: dialogueFlowNodeName(to), Kind: DialogueFlowBranch}, to)
+						}
+						if prompt(to) {
+							break
+						}
+					}
+				}
+			}
+		}
+	}
+
+	if len(eventFiles) > 0 {
+		for _, node := range graph.Nodes {
+			if !reached[node.ID] {
+				graph.Unreachable = append(graph.Unreachable, node.ID)
+			}
+		}
+	}
+	for id := range missing {
+		graph.Missing = append(graph.Missing, id)
+	}
+	sort.Ints(graph.Missing)
+	return graph, nil
+}
+
+// WriteDialogueFlowGraph writes the graph in the requested format: dot or json
+func WriteDialogueFlowGraph(graph *DialogueFlowGraph, format string, writer io.Writer) error {
+	switch format {
+	case DialogueFlowFormatDOT:
+		return writeDialogueFlowDOT(graph, writer)
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(graph); err != nil {
+			return fmt.Errorf("failed to encode JSON graph: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported graph format: %s", format)
+	}
+}
+
+// dotQuote returns a DOT string literal; newlines become line breaks of the label
+func dotQuote(text string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + replacer.Replace(text) + `"`
+}
+
+// writeDialogueFlowDOT renders the graph in the Graphviz DOT language: [PROMPT] dialogues
+// are drawn as hexagons, unreachable ones in red and dialogue slots missing from the YAML
+// file as dashed boxes
+func writeDialogueFlowDOT(graph *DialogueFlowGraph, writer io.Writer) error {
+	var sb strings.Builder
+	unreachable := make(map[int]bool, len(graph.Unreachable))
+	for _, id := range graph.Unreachable {
+		unreachable[id] = true
+	}
+
+	sb.WriteString("digraph dialogues {\n")
+	sb.WriteString("  rankdir=LR;\n")
+	sb.WriteString("  node [shape=box, fontname=\"Helvetica\"];\n")
+	for _, node := range graph.Nodes {
+		label := fmt.Sprintf("%d", node.ID)
+		if node.Name != "" {
+			label += " " + node.Name
+		}
+		if node.Text != "" {
+			label += "\n" + node.Text
+		}
+		attributes := "label=" + dotQuote(label)
+		if node.Prompt {
+			attributes += ", shape=hexagon"
+		}
+		if unreachable[node.ID] {
+			attributes += ", color=red, fontcolor=red"
+		}
+		sb.WriteString(fmt.Sprintf("  %s [%s];\n", dotQuote(dialogueFlowNodeName(node.ID)), attributes))
+	}
+	for _, id := range graph.Missing {
+		sb.WriteString(fmt.Sprintf("  %s [label=%s, style=dashed];\n",
+			dotQuote(dialogueFlowNodeName(id)), dotQuote(fmt.Sprintf("%d (missing)", id))))
+	}
+	for _, event := range graph.Events {
+		label := event.Key
+		if event.Label != "" {
+			label += "\n" + event.Label
+		}
+		if event.Event != nil {
+			label += fmt.Sprintf("\nevent %d", *event.Event)
+		}
+		if event.Flag != nil {
+			label += fmt.Sprintf("\nflag %d", *event.Flag)
+		}
+		sb.WriteString(fmt.Sprintf("  %s [label=%s, shape=ellipse, style=filled, fillcolor=lightgrey];\n",
+			dotQuote("event:"+event.Key), dotQuote(label)))
+	}
+	for _, edge := range graph.Edges {
+		attributes := ""
+		switch edge.Kind {
+		case DialogueFlowTrigger:
+			attributes = " [style=dashed]"
+		case DialogueFlowBranch:
+			attributes = " [color=blue, label=\"answer\"]"
+		}
+		sb.WriteString(fmt.Sprintf("  %s -> %s%s;\n", dotQuote(edge.From), dotQuote(edge.To), attributes))
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
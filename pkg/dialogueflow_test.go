@@ -0,0 +1,100 @@
+// Package pkg provides tests for the dialogue flow graph
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+func TestBuildDialogueFlowGraph(t *testing.T) {
+	dir := t.TempDir()
+	text := func(s string) []map[string]interface{} { return []map[string]interface{}{{"text": s}} }
+	dialoguesFile := filepath.Join(dir, "dialogues.yaml")
+	if err := dialogueyaml.Write(dialoguesFile, &DialoguesYAML{TotalDialogues: 5, Dialogues: []DialogueEntry{
+		{ID: 0, Content: text("Want to trade?[PROMPT]"), Terminator: TerminatorHalt},
+		{ID: 1, Content: text("Deal!"), Terminator: TerminatorHalt},
+		{ID: 2, Content: text("Maybe later."), Terminator: TerminatorHalt},
+		{ID: 3, Content: text("Hello \"friend\""), Terminator: TerminatorContinue},
+		{ID: 4, Content: text("Never shown"), Terminator: TerminatorHalt},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Event 7 asks and answers; event 8 greets, then triggers a slot the file lacks
+	seven, eight := 7, 8
+	events := OverlayEventsYAML{File: "STAGE01.OVL", Tables: []OverlayEventTable{{Name: "npc", Entries: []OverlayEvent{
+		{Index: 0, Event: &seven, Dialogue: 0, Label: "Trader"},
+		{Index: 1, Event: &seven, Dialogue: 1},
+		{Index: 2, Event: &seven, Dialogue: 2},
+		{Index: 3, Event: &eight, Dialogue: 3},
+		{Index: 4, Event: &eight, Dialogue: 9},
+	}}}}
+	eventsFile := filepath.Join(dir, "events01.yaml")
+	data, err := yaml.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(eventsFile, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := BuildDialogueFlowGraph(dialoguesFile, []string{eventsFile})
+	if err != nil {
+		t.Fatalf("BuildDialogueFlowGraph() failed: %v", err)
+	}
+	if !graph.Nodes[0].Prompt || graph.Nodes[1].Prompt || graph.Nodes[0].Triggers != 1 {
+		t.Errorf("node 0 = %+v, want a [PROMPT] dialogue triggered once", graph.Nodes[0])
+	}
+	if !reflect.DeepEqual(graph.Unreachable, []int{4}) || !reflect.DeepEqual(graph.Missing, []int{9}) {
+		t.Errorf("unreachable = %v, missing = %v; want [4] and [9]", graph.Unreachable, graph.Missing)
+	}
+
+	var flow []string
+	for _, edge := range graph.Edges {
+		if edge.Kind != DialogueFlowTrigger {
+			flow = append(flow, edge.From+" "+edge.Kind+" "+edge.To)
+		}
+	}
+	want := []string{
+		"dialogue:0 branch dialogue:1",
+		"dialogue:0 branch dialogue:2",
+		"dialogue:3 next dialogue:9",
+	}
+	if !reflect.DeepEqual(flow, want) {
+		t.Errorf("flow edges = %q, want %q", flow, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDialogueFlowGraph(graph, DialogueFlowFormatDOT, &buf); err != nil {
+		t.Fatalf("WriteDialogueFlowGraph(dot) failed: %v", err)
+	}
+	dot := buf.String()
+	for _, line := range []string{
+		`"dialogue:3" [label="3\nHello \"friend\""];`,
+		`"dialogue:4" [label="4\nNever shown", color=red, fontcolor=red];`,
+		`"event:STAGE01.OVL/npc[0]" -> "dialogue:0" [style=dashed];`,
+		`"dialogue:0" -> "dialogue:1" [color=blue, label="answer"];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("DOT output lacks %s", line)
+		}
+	}
+	if err := WriteDialogueFlowGraph(graph, "svg", &buf); err == nil {
+		t.Error("WriteDialogueFlowGraph(svg) succeeded, want an error")
+	}
+
+	// Without events there is nothing to reach the dialogues from
+	if graph, err = BuildDialogueFlowGraph(dialoguesFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(graph.Edges) != 0 || graph.Unreachable != nil {
+		t.Errorf("graph without events has %d edges and unreachable %v", len(graph.Edges), graph.Unreachable)
+	}
+}
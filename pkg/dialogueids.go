@@ -0,0 +1,119 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the validation of the dialogue IDs of a YAML file. The encoder sorts
+// the dialogues by ID and writes the pointer table in that order, so a duplicate ID, an ID
+// past the decoded dialogues or a missing ID silently moves every later dialogue to
+// another slot. Errors and warnings name the line of the offending id key.
+package pkg
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DialogueIDGap is a range of dialogue IDs missing from a YAML file
+type DialogueIDGap struct {
+	First int // First missing ID
+	Last  int // Last missing ID
+	Next  int // ID of the dialogue after the gap
+	Line  int // Line of the id key of that dialogue (0 when unknown)
+}
+
+// String describes the gap for warnings
+func (g DialogueIDGap) String() string {
+	missing := fmt.Sprintf("ID %d is", g.First)
+	if g.Last > g.First {
+		missing = fmt.Sprintf("IDs %d-%d are", g.First, g.Last)
+	}
+	return fmt.Sprintf("dialogue %s missing: dialogue %d and every later one move to earlier slots", missing, g.Next)
+}
+
+// dialogueIDLines returns the line of the id key of every dialogue of a YAML document, in
+// document order (0 where it cannot be found)
+func dialogueIDLines(data []byte, count int) []int {
+	lines := make([]int, count)
+	var document yaml.Node
+	if yaml.Unmarshal(data, &document) != nil || len(document.Content) == 0 {
+		return lines
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return lines
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		if root.Content[i].Value != "dialogues" || root.Content[i+1].Kind != yaml.SequenceNode {
+			continue
+		}
+		for index, item := range root.Content[i+1].Content {
+			if index >= count {
+				break
+			}
+			lines[index] = item.Line
+			for j := 0; j+1 < len(item.Content); j += 2 {
+				if item.Content[j].Value == "id" {
+					lines[index] = item.Content[j].Line
+				}
+			}
+		}
+	}
+	return lines
+}
+
+// dialogueLocation returns the location of a dialogue for messages: the file and the line
+// of its id key, or its position in the file when the line is unknown
+func dialogueLocation(file string, lines []int, index int) string {
+	if index < len(lines) && lines[index] > 0 {
+		return fmt.Sprintf("%s line %d", file, lines[index])
+	}
+	return fmt.Sprintf("%s dialogue %d", file, index+1)
+}
+
+// ValidateDialogueIDs checks the dialogue IDs of a YAML file against its total_dialogues:
+// an ID used twice, and an ID past the decoded dialogues on a dialogue without a name
+// (only wfm remap appends dialogues, and it names them), are errors. Gaps between the IDs
+// are returned, so the caller can warn about them. Negative IDs (new dialogues waiting for
+// wfm remap) are left to the caller; a total of 0 skips the range check.
+func ValidateDialogueIDs(file string, dialogues []DialogueEntry, total int, lines []int) ([]DialogueIDGap, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf(format, args...))
+	}
+
+	first := make(map[int]int, len(dialogues)) // Index of the first dialogue of each ID
+	for index, dialogue := range dialogues {
+		if dialogue.ID < 0 {
+			continue
+		}
+		if previous, used := first[dialogue.ID]; used {
+			return nil, invalid("%s: dialogue ID %d is used more than once (first at %s)",
+				dialogueLocation(file, lines, index), dialogue.ID, dialogueLocation(file, lines, previous))
+		}
+		first[dialogue.ID] = index
+		if total > 0 && dialogue.ID >= total && dialogue.Name == "" {
+			return nil, invalid("%s: dialogue ID %d is out of range: the file was decoded with %d dialogues (0-%d); name it and run wfm remap to append a dialogue",
+				dialogueLocation(file, lines, index), dialogue.ID, total, total-1)
+		}
+	}
+
+	ids := make([]int, 0, len(first))
+	for id := range first {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	var gaps []DialogueIDGap
+	expected := 0
+	for _, id := range ids {
+		if id > expected {
+			gap := DialogueIDGap{First: expected, Last: id - 1, Next: id}
+			if first[id] < len(lines) {
+				gap.Line = lines[first[id]]
+			}
+			gaps = append(gaps, gap)
+		}
+		expected = id + 1
+	}
+	return gaps, nil
+}
@@ -0,0 +1,82 @@
+// Package pkg provides tests for the validation of dialogue IDs
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// dialogueIDsYAML returns a dialogue file with one dialogue per ID, the name given after
+// a colon (e.g. "4:shop")
+func dialogueIDsYAML(total int, ids ...string) string {
+	var sb strings.Builder
+	sb.WriteString("total_dialogues: " + strconv.Itoa(total) + "\ndialogues:\n")
+	for _, id := range ids {
+		number, name, _ := strings.Cut(id, ":")
+		sb.WriteString("  - id: " + number + "\n")
+		if name != "" {
+			sb.WriteString("    name: " + name + "\n")
+		}
+		sb.WriteString("    content:\n      - text: \"Hi\"\n")
+	}
+	return sb.String()
+}
+
+func TestWFMFileEncoder_LoadDialoguesValidatesIDs(t *testing.T) {
+	dir := t.TempDir()
+	load := func(content string) error {
+		yamlFile := filepath.Join(dir, "dialogues.yaml")
+		if err := os.WriteFile(yamlFile, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		_, _, err := NewWFMEncoder().LoadDialogues(yamlFile)
+		return err
+	}
+
+	// Each dialogue takes three lines after the two header lines
+	err := load(dialogueIDsYAML(3, "0", "1", "1"))
+	if err == nil || !strings.Contains(err.Error(), "line 9: dialogue ID 1 is used more than once (first at") ||
+		!strings.Contains(err.Error(), "line 6)") {
+		t.Errorf("duplicate ID error = %v, want lines 9 and 6", err)
+	}
+	if common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("duplicate ID exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+	}
+
+	err = load(dialogueIDsYAML(2, "0", "1", "2"))
+	if err == nil || !strings.Contains(err.Error(), "line 9: dialogue ID 2 is out of range") {
+		t.Errorf("out-of-range ID error = %v, want line 9", err)
+	}
+
+	// Gaps and dialogues appended by wfm remap load
+	if err := load(dialogueIDsYAML(3, "0", "2", "3:shop")); err != nil {
+		t.Errorf("LoadDialogues() with a gap failed: %v", err)
+	}
+}
+
+func TestValidateDialogueIDs_Gaps(t *testing.T) {
+	dialogues := []DialogueEntry{{ID: 4}, {ID: 0}, {ID: NewDialogueID, Name: "new"}, {ID: 1}, {ID: 7}}
+	gaps, err := ValidateDialogueIDs("dialogues.yaml", dialogues, 8, []int{10, 20, 30, 40, 50})
+	if err != nil {
+		t.Fatalf("ValidateDialogueIDs() failed: %v", err)
+	}
+	want := []DialogueIDGap{{First: 2, Last: 3, Next: 4, Line: 10}, {First: 5, Last: 6, Next: 7, Line: 50}}
+	if !reflect.DeepEqual(gaps, want) {
+		t.Errorf("gaps = %+v, want %+v", gaps, want)
+	}
+	if got := gaps[0].String(); got != "dialogue IDs 2-3 are missing: dialogue 4 and every later one move to earlier slots" {
+		t.Errorf("String() = %q", got)
+	}
+
+	// Without lines, messages name the position of the dialogue
+	_, err = ValidateDialogueIDs("dialogues.yaml", []DialogueEntry{{ID: 0}, {ID: 0}}, 0, nil)
+	if err == nil || !strings.Contains(err.Error(), "dialogues.yaml dialogue 2: dialogue ID 0 is used more than once (first at dialogues.yaml dialogue 1)") {
+		t.Errorf("ValidateDialogueIDs() error = %v, want the positions of both dialogues", err)
+	}
+}
@@ -0,0 +1,230 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the merge of a fresh decode into an existing (translated) dialogue export.
+// Decode stores a fingerprint of the original text of every dialogue; when the source WFM file
+// changes (a new game revision), the merge keeps the translation of every dialogue whose
+// original text is unchanged, follows dialogues that moved to another slot, and flags the
+// translated dialogues whose original text changed for manual resolution.
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// Outcomes of a dialogue merge
+const (
+	MergeStatusKept     = "kept"     // Original text unchanged, translation kept
+	MergeStatusMoved    = "moved"    // Original text found at another slot, translation moved along
+	MergeStatusUpdated  = "updated"  // Original text changed before any translation, new text taken
+	MergeStatusConflict = "conflict" // Original text of a translated dialogue changed
+	MergeStatusNew      = "new"      // Dialogue the existing export did not have
+	MergeStatusRemoved  = "removed"  // Dialogue of the existing export the new source no longer has
+	MergeStatusAppended = "appended" // Dialogue added by wfm remap, appended after the decoded ones
+)
+
+// DialogueConflict holds the translation of a dialogue whose original text changed. Encode
+// refuses dialogues with a conflict; merge the translation into the content, then delete it.
+type DialogueConflict = dialogueyaml.Conflict
+
+// DialogueMergeEntry is the outcome of one dialogue of a merge (kept dialogues are only counted)
+type DialogueMergeEntry struct {
+	ID         int    `json:"id"`          // ID in the merged export (-1 for removed dialogues)
+	PreviousID int    `json:"previous_id"` // ID in the existing export (-1 for new dialogues)
+	Name       string `json:"name,omitempty"`
+	Status     string `json:"status"`
+}
+
+// DialogueMergeReport summarizes the merge of a decode into an existing export
+type DialogueMergeReport struct {
+	Existing string               `json:"existing,omitempty"` // Existing export merged into
+	Counts   map[string]int       `json:"counts"`             // Dialogues by status
+	Entries  []DialogueMergeEntry `json:"entries"`
+}
+
+// Conflicts returns the entries flagged for manual resolution
+func (r *DialogueMergeReport) Conflicts() []DialogueMergeEntry {
+	var conflicts []DialogueMergeEntry
+	for _, entry := range r.Entries {
+		if entry.Status == MergeStatusConflict {
+			conflicts = append(conflicts, entry)
+		}
+	}
+	return conflicts
+}
+
+// DialogueFingerprint returns the fingerprint of the text of a dialogue content: the first
+// 8 bytes of the SHA-256 of its items, so any change to a text, control code or argument
+// changes it while the YAML layout does not
+func DialogueFingerprint(content []map[string]interface{}) string {
+	// Maps are encoded with sorted keys, so equal content always gives equal bytes
+	data, err := json.Marshal(content)
+	if err != nil {
+		data = []byte(fmt.Sprint(content))
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// MergeDialogues merges a fresh decode into an existing export, in place of the decoded
+// dialogues. Dialogues are aligned by ID and then by fingerprint: a dialogue whose original
+// text is unchanged keeps the existing entry (translated content, name, notes, drafts); a
+// translated dialogue whose original text changed takes the new text and carries the
+// translation in a conflict. Dialogues appended by wfm remap follow the decoded ones.
+func MergeDialogues(decoded, existing *DialoguesYAML) *DialogueMergeReport {
+	report := &DialogueMergeReport{Counts: make(map[string]int)}
+	record := func(id, previousID int, name, status string) {
+		report.Counts[status]++
+		if status != MergeStatusKept {
+			report.Entries = append(report.Entries, DialogueMergeEntry{ID: id, PreviousID: previousID, Name: name, Status: status})
+		}
+	}
+
+	// Index the existing dialogues taken from a decode by ID and fingerprint
+	byID := make(map[int]int)
+	byFingerprint := make(map[string][]int)
+	var appended []int
+	for i, dialogue := range existing.Dialogues {
+		if dialogue.ID >= existing.TotalDialogues || dialogue.ID < 0 {
+			appended = append(appended, i)
+			continue
+		}
+		byID[dialogue.ID] = i
+		if dialogue.Fingerprint != "" {
+			byFingerprint[dialogue.Fingerprint] = append(byFingerprint[dialogue.Fingerprint], i)
+		}
+	}
+
+	used := make(map[int]bool)
+	matched := make([]int, len(decoded.Dialogues))
+	for i := range matched {
+		matched[i] = -1
+	}
+
+	// Unchanged dialogues at the same slot first, so a moved duplicate cannot take them
+	for i, dialogue := range decoded.Dialogues {
+		if index, found := byID[dialogue.ID]; found && existing.Dialogues[index].Fingerprint == dialogue.Fingerprint {
+			matched[i], used[index] = index, true
+		}
+	}
+	// Then unchanged dialogues that moved to another slot
+	for i, dialogue := range decoded.Dialogues {
+		if matched[i] >= 0 {
+			continue
+		}
+		for _, index := range byFingerprint[dialogue.Fingerprint] {
+			if !used[index] {
+				matched[i], used[index] = index, true
+				break
+			}
+		}
+	}
+
+	for i := range decoded.Dialogues {
+		dialogue := &decoded.Dialogues[i]
+		if index := matched[i]; index >= 0 {
+			previous := existing.Dialogues[index]
+			status := MergeStatusKept
+			if previous.ID != dialogue.ID {
+				status = MergeStatusMoved
+			}
+			decoded.Dialogues[i] = mergeKeptDialogue(*dialogue, previous)
+			record(dialogue.ID, previous.ID, previous.Name, status)
+			continue
+		}
+
+		index, found := byID[dialogue.ID]
+		if !found || used[index] {
+			record(dialogue.ID, NewDialogueID, "", MergeStatusNew)
+			continue
+		}
+		used[index] = true
+		previous := existing.Dialogues[index]
+		dialogue.Name, dialogue.Notes, dialogue.Drafts = previous.Name, previous.Notes, previous.Drafts
+
+		// Untouched content still matches the original it was decoded from (or, for exports
+		// without fingerprints, the new original), so there is no translation to lose
+		contentFingerprint := DialogueFingerprint(previous.Content)
+		if contentFingerprint == previous.Fingerprint || contentFingerprint == dialogue.Fingerprint {
+			record(dialogue.ID, previous.ID, previous.Name, MergeStatusUpdated)
+			continue
+		}
+		dialogue.Conflict = &DialogueConflict{Fingerprint: previous.Fingerprint, Content: previous.Content}
+		if previous.Conflict != nil {
+			// An unresolved conflict of an earlier merge still holds the translation
+			dialogue.Conflict = previous.Conflict
+		}
+		record(dialogue.ID, previous.ID, previous.Name, MergeStatusConflict)
+	}
+
+	// Translations of dialogues the new source no longer has are lost; list them
+	removed := make([]int, 0)
+	for index, dialogue := range existing.Dialogues {
+		if !used[index] && dialogue.ID >= 0 && dialogue.ID < existing.TotalDialogues {
+			removed = append(removed, index)
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return existing.Dialogues[removed[i]].ID < existing.Dialogues[removed[j]].ID })
+	for _, index := range removed {
+		record(NewDialogueID, existing.Dialogues[index].ID, existing.Dialogues[index].Name, MergeStatusRemoved)
+	}
+
+	// Dialogues appended by wfm remap keep their order after the decoded ones
+	sort.SliceStable(appended, func(i, j int) bool {
+		a, b := existing.Dialogues[appended[i]].ID, existing.Dialogues[appended[j]].ID
+		return a >= 0 && (b < 0 || a < b)
+	})
+	for _, index := range appended {
+		dialogue := existing.Dialogues[index]
+		previousID := dialogue.ID
+		if dialogue.ID >= 0 {
+			dialogue.ID = len(decoded.Dialogues)
+		}
+		decoded.Dialogues = append(decoded.Dialogues, dialogue)
+		record(dialogue.ID, previousID, dialogue.Name, MergeStatusAppended)
+	}
+
+	return report
+}
+
+// mergeKeptDialogue returns the existing entry of a dialogue whose original text is
+// unchanged, with the slot and the decode metadata of the fresh decode
+func mergeKeptDialogue(decoded, previous DialogueEntry) DialogueEntry {
+	merged := previous
+	merged.ID = decoded.ID
+	merged.Fingerprint = decoded.Fingerprint
+	merged.Special = decoded.Special
+	merged.Widths = decoded.Widths
+	// raw: is only left on untouched dialogues; its glyph codes follow the new source
+	if previous.Raw != "" {
+		merged.Raw = decoded.Raw
+	}
+	return merged
+}
+
+// mergeExistingDialogues merges the decoded dialogues into the export at existingFile
+func mergeExistingDialogues(decoded *DialoguesYAML, existingFile string) (*DialogueMergeReport, error) {
+	existing, err := dialogueyaml.Read(existingFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read existing dialogues: %w", err)
+	}
+
+	report := MergeDialogues(decoded, existing)
+	report.Existing = existingFile
+	for _, entry := range report.Entries {
+		switch entry.Status {
+		case MergeStatusConflict:
+			common.LogWarn("Dialogue %d: original text changed after translation, resolve the conflict", entry.ID)
+		case MergeStatusRemoved:
+			common.LogWarn("Dialogue %d of %s is gone from the new source", entry.PreviousID, existingFile)
+		default:
+			common.LogDebug("Dialogue %d (was %d): %s", entry.ID, entry.PreviousID, entry.Status)
+		}
+	}
+	return report, nil
+}
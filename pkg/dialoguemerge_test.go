@@ -0,0 +1,147 @@
+// Package pkg provides tests for the merge of a decode into an existing dialogue export
+package pkg
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// mergeDialogue builds a decoded dialogue with the fingerprint of its original text
+func mergeDialogue(id int, original string) DialogueEntry {
+	content := []map[string]interface{}{{"text": original}}
+	return DialogueEntry{ID: id, Content: content, Fingerprint: DialogueFingerprint(content)}
+}
+
+// translateDialogue replaces the text of a decoded dialogue, keeping its fingerprint
+func translateDialogue(dialogue DialogueEntry, text string) DialogueEntry {
+	dialogue.Content = []map[string]interface{}{{"text": text}}
+	return dialogue
+}
+
+func TestMergeDialogues(t *testing.T) {
+	hint := translateDialogue(mergeDialogue(3, "Hint"), "Dica")
+	hint.Name, hint.Notes = "hint", "Shop owner"
+	existing := &DialoguesYAML{TotalDialogues: 5, Dialogues: []DialogueEntry{
+		translateDialogue(mergeDialogue(0, "Hello"), "Olá"),
+		translateDialogue(mergeDialogue(1, "Bye"), "Tchau"),
+		mergeDialogue(2, "Untouched"),
+		hint,
+		translateDialogue(mergeDialogue(4, "Cut"), "Cortado"),
+		{ID: 5, Name: "extra", Content: []map[string]interface{}{{"text": "Novo"}}},
+	}}
+	// The new revision rewrites 1 and 2, moves the hint to 4, inserts a dialogue at 3 and drops "Cut"
+	decoded := &DialoguesYAML{TotalDialogues: 6, Dialogues: []DialogueEntry{
+		mergeDialogue(0, "Hello"),
+		mergeDialogue(1, "Goodbye"),
+		mergeDialogue(2, "Touched"),
+		mergeDialogue(3, "Inserted"),
+		mergeDialogue(4, "Hint"),
+		mergeDialogue(5, "Brand new"),
+	}}
+
+	report := MergeDialogues(decoded, existing)
+
+	wantText := []string{"Olá", "Goodbye", "Touched", "Inserted", "Dica", "Brand new", "Novo"}
+	if len(decoded.Dialogues) != len(wantText) {
+		t.Fatalf("merged %d dialogues, want %d", len(decoded.Dialogues), len(wantText))
+	}
+	for i, want := range wantText {
+		dialogue := decoded.Dialogues[i]
+		if dialogue.ID != i || dialogue.Content[0]["text"] != want {
+			t.Errorf("dialogues[%d] = %d %v, want %d %q", i, dialogue.ID, dialogue.Content, i, want)
+		}
+	}
+	if moved := decoded.Dialogues[4]; moved.Name != "hint" || moved.Notes != "Shop owner" {
+		t.Errorf("moved dialogue = %q/%q, want its name and notes kept", moved.Name, moved.Notes)
+	}
+	conflict := decoded.Dialogues[1].Conflict
+	if conflict == nil || conflict.Content[0]["text"] != "Tchau" || conflict.Fingerprint != existing.Dialogues[1].Fingerprint {
+		t.Errorf("dialogues[1].Conflict = %+v, want the previous translation", conflict)
+	}
+	if decoded.Dialogues[2].Conflict != nil {
+		t.Error("untranslated dialogue 2 got a conflict, want the new text taken")
+	}
+
+	want := map[string]int{
+		MergeStatusKept: 1, MergeStatusConflict: 1, MergeStatusUpdated: 1, MergeStatusNew: 2,
+		MergeStatusMoved: 1, MergeStatusRemoved: 1, MergeStatusAppended: 1,
+	}
+	for status, count := range want {
+		if report.Counts[status] != count {
+			t.Errorf("Counts[%s] = %d, want %d (report %+v)", status, report.Counts[status], count, report.Entries)
+		}
+	}
+	if conflicts := report.Conflicts(); len(conflicts) != 1 || conflicts[0].ID != 1 {
+		t.Errorf("Conflicts() = %+v, want dialogue 1", conflicts)
+	}
+}
+
+func TestWFMFileEncoder_LoadDialoguesRejectsConflicts(t *testing.T) {
+	dialogue := mergeDialogue(0, "Goodbye")
+	dialogue.Conflict = &DialogueConflict{Content: []map[string]interface{}{{"text": "Tchau"}}}
+	yamlFile := filepath.Join(t.TempDir(), "dialogues.yaml")
+	if err := dialogueyaml.Write(yamlFile, &DialoguesYAML{TotalDialogues: 1, Dialogues: []DialogueEntry{dialogue}}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err := NewWFMEncoder().LoadDialogues(yamlFile)
+	if err == nil || !strings.Contains(err.Error(), "unresolved merge conflict") {
+		t.Fatalf("LoadDialogues() error = %v, want the unresolved conflict", err)
+	}
+	if common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("LoadDialogues() exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+	}
+}
+
+func TestWFMFileProcessor_Process_MergeExisting(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+
+	outputDir := filepath.Join(dir, "output")
+	decode := func(mergeExisting string) *WFMFileProcessor {
+		t.Helper()
+		processor := NewWFMProcessor()
+		processor.SetDialoguesOnly(true)
+		processor.SetUnmappedLog("")
+		processor.SetMergeExisting(mergeExisting)
+		if err := processor.Process(fontFile, outputDir); err != nil {
+			t.Fatalf("Process() failed: %v", err)
+		}
+		return processor
+	}
+	decode("")
+
+	yamlFile := filepath.Join(outputDir, "dialogues.yaml")
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	for _, dialogue := range dialogues.Dialogues {
+		if dialogue.Fingerprint != DialogueFingerprint(dialogue.Content) {
+			t.Fatalf("dialogue %d fingerprint %q, want the fingerprint of its content", dialogue.ID, dialogue.Fingerprint)
+		}
+	}
+	dialogues.Dialogues[0].Content = []map[string]interface{}{{"text": "Traduzido"}}
+	dialogues.Dialogues[0].Notes = "translated"
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-decoding the same source keeps every translation
+	report := decode(yamlFile).MergeReport()
+	if report == nil || report.Counts[MergeStatusKept] != 2 || len(report.Entries) != 0 {
+		t.Fatalf("MergeReport() = %+v, want both dialogues kept", report)
+	}
+	merged, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	if merged.Dialogues[0].Content[0]["text"] != "Traduzido" || merged.Dialogues[0].Notes != "translated" {
+		t.Errorf("merged dialogue 0 = %+v, want the translation kept", merged.Dialogues[0])
+	}
+}
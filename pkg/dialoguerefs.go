@@ -0,0 +1,248 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the stale-pointer check between WFM dialogues and the dialogue indices
+// hardcoded in the executable. The executable selects dialogues by their slot in the WFM
+// pointer table, so removing, inserting or renumbering dialogues in the YAML silently
+// breaks the triggers that reference them.
+package pkg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DialogueReferenceDefinition locates dialogue index constants in the executable, either at a
+// fixed offset or at every match of a byte pattern
+type DialogueReferenceDefinition struct {
+	Name    string `yaml:"name"`
+	Offset  *int   `yaml:"offset,omitempty"`   // File offset of the constant
+	Pattern string `yaml:"pattern,omitempty"`  // Hex bytes with ?? wildcards (e.g. "?? 00 05 24")
+	IndexAt int    `yaml:"index_at,omitempty"` // Position of the constant inside a pattern match
+	Type    string `yaml:"type,omitempty"`     // u8, u16 or u32 little endian (defaults to u16)
+}
+
+// DialogueReferenceFileProfile lists the references to the dialogues of a single WFM file
+type DialogueReferenceFileProfile struct {
+	References []DialogueReferenceDefinition `yaml:"references"`
+}
+
+// DialogueReferenceProfile maps WFM file names to the executable references of their dialogues
+type DialogueReferenceProfile struct {
+	Files map[string]DialogueReferenceFileProfile `yaml:"files"`
+}
+
+// DialogueReference is a dialogue index constant found in the executable
+type DialogueReference struct {
+	Name   string
+	Offset int // File offset of the constant
+	Index  int // Dialogue slot referenced
+}
+
+// LoadDialogueReferenceProfile loads a dialogue reference profile from a YAML file
+func LoadDialogueReferenceProfile(profileFile string) (*DialogueReferenceProfile, error) {
+	data, err := os.ReadFile(profileFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read reference profile: %w", err)
+	}
+
+	var profile DialogueReferenceProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse reference profile: %w", err))
+	}
+
+	return &profile, nil
+}
+
+// ReferencesFor returns the reference definitions configured for a WFM file (matched by base name)
+func (p *DialogueReferenceProfile) ReferencesFor(wfmFile string) ([]DialogueReferenceDefinition, error) {
+	baseName := filepath.Base(wfmFile)
+	for name, fileProfile := range p.Files {
+		if strings.EqualFold(name, baseName) {
+			return fileProfile.References, nil
+		}
+	}
+	return nil, fmt.Errorf("no dialogue references configured for %s", baseName)
+}
+
+// size returns the width in bytes of the constant
+func (d DialogueReferenceDefinition) size() (int, error) {
+	switch d.Type {
+	case "u8":
+		return 1, nil
+	case "", "u16":
+		return 2, nil
+	case "u32":
+		return 4, nil
+	default:
+		return 0, fmt.Errorf("reference %s: unsupported type %q (use u8, u16 or u32)", d.Name, d.Type)
+	}
+}
+
+// parseBytePattern parses hex bytes separated by spaces, with ?? matching any byte.
+// The mask is false for wildcard positions.
+func parseBytePattern(pattern string) ([]byte, []bool, error) {
+	fields := strings.Fields(pattern)
+	if len(fields) == 0 {
+		return nil, nil, fmt.Errorf("empty pattern")
+	}
+
+	values := make([]byte, len(fields))
+	mask := make([]bool, len(fields))
+	for i, field := range fields {
+		if field == "??" {
+			continue
+		}
+		decoded, err := hex.DecodeString(field)
+		if err != nil || len(decoded) != 1 {
+			return nil, nil, fmt.Errorf("invalid pattern byte %q", field)
+		}
+		values[i] = decoded[0]
+		mask[i] = true
+	}
+	return values, mask, nil
+}
+
+// matchBytePattern returns the offsets of every match of a masked pattern
+func matchBytePattern(data, values []byte, mask []bool) []int {
+	var offsets []int
+	for start := 0; start+len(values) <= len(data); start++ {
+		matched := true
+		for i := range values {
+			if mask[i] && data[start+i] != values[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			offsets = append(offsets, start)
+		}
+	}
+	return offsets
+}
+
+// ScanDialogueReferences reads every dialogue index constant of the definitions from executable data
+func ScanDialogueReferences(data []byte, definitions []DialogueReferenceDefinition) ([]DialogueReference, error) {
+	var references []DialogueReference
+	for _, definition := range definitions {
+		size, err := definition.size()
+		if err != nil {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+		}
+
+		var offsets []int
+		switch {
+		case definition.Offset != nil && definition.Pattern == "":
+			offsets = []int{*definition.Offset}
+		case definition.Offset == nil && definition.Pattern != "":
+			values, mask, err := parseBytePattern(definition.Pattern)
+			if err != nil {
+				return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("reference %s: %w", definition.Name, err))
+			}
+			if definition.IndexAt < 0 || definition.IndexAt+size > len(values) {
+				return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("reference %s: index_at %d is outside the %d-byte pattern", definition.Name, definition.IndexAt, len(values)))
+			}
+			for _, match := range matchBytePattern(data, values, mask) {
+				offsets = append(offsets, match+definition.IndexAt)
+			}
+			if len(offsets) == 0 {
+				common.LogWarn("Reference %s: pattern not found in the executable", definition.Name)
+			}
+		default:
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("reference %s: exactly one of offset or pattern is required", definition.Name))
+		}
+
+		for _, offset := range offsets {
+			if offset < 0 || offset+size > len(data) {
+				return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("reference %s: offset 0x%X is outside the executable (0x%X bytes)", definition.Name, offset, len(data)))
+			}
+			var index int
+			switch size {
+			case 1:
+				index = int(data[offset])
+			case 2:
+				index = int(binary.LittleEndian.Uint16(data[offset:]))
+			default:
+				index = int(binary.LittleEndian.Uint32(data[offset:]))
+			}
+			references = append(references, DialogueReference{Name: definition.Name, Offset: offset, Index: index})
+		}
+	}
+
+	common.LogDebug("Found %d dialogue references in the executable", len(references))
+	return references, nil
+}
+
+// CheckDialogueReferences compares the dialogue slots referenced by the executable with the
+// dialogues about to be encoded. Decoded dialogue IDs are the original slots, and the encoder
+// writes dialogues sorted by ID, so a referenced slot is stale when it no longer exists or now
+// holds a dialogue with a different ID. originalCount is the dialogue count of the decoded
+// file (0 skips the count check); dialogues appended after it leave every original slot in
+// place and are not a problem. Returns one warning message per problem.
+func CheckDialogueReferences(references []DialogueReference, dialogues []DialogueEntry, originalCount int) []string {
+	ids := make([]int, len(dialogues))
+	for i, dialogue := range dialogues {
+		ids[i] = dialogue.ID
+	}
+	sort.Ints(ids)
+
+	var warnings []string
+	if originalCount > len(ids) && len(references) > 0 {
+		warnings = append(warnings, fmt.Sprintf("dialogue count changed from %d to %d while the executable references %d dialogue slots",
+			originalCount, len(ids), len(references)))
+	}
+
+	for _, reference := range references {
+		location := fmt.Sprintf("%s (0x%X)", reference.Name, reference.Offset)
+		switch {
+		case reference.Index >= len(ids):
+			warnings = append(warnings, fmt.Sprintf("%s references dialogue %d, but only %d dialogues are encoded",
+				location, reference.Index, len(ids)))
+		case ids[reference.Index] != reference.Index:
+			warnings = append(warnings, fmt.Sprintf("%s references dialogue slot %d, which now holds dialogue ID %d",
+				location, reference.Index, ids[reference.Index]))
+		}
+	}
+	return warnings
+}
+
+// SetReferenceCheck makes Encode warn about dialogues referenced by the executable that are
+// removed or renumbered (nil profile disables)
+func (e *WFMFileEncoder) SetReferenceCheck(exeFile string, profile *DialogueReferenceProfile) {
+	e.referenceExe = exeFile
+	e.referenceProfile = profile
+}
+
+// checkReferences runs the stale-pointer check configured with SetReferenceCheck
+func (e *WFMFileEncoder) checkReferences(outputFile string, dialogues []DialogueEntry) error {
+	definitions, err := e.referenceProfile.ReferencesFor(outputFile)
+	if err != nil {
+		common.LogWarn("Skipping dialogue reference check: %v", err)
+		return nil
+	}
+
+	data, err := os.ReadFile(e.referenceExe)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read executable: %w", err))
+	}
+	references, err := ScanDialogueReferences(data, definitions)
+	if err != nil {
+		return err
+	}
+
+	warnings := CheckDialogueReferences(references, dialogues, e.originalDialogues)
+	for _, warning := range warnings {
+		common.LogWarn("Stale dialogue reference: %s", warning)
+	}
+	common.LogInfo("Checked %d dialogue references in %s: %d problems", len(references), filepath.Base(e.referenceExe), len(warnings))
+	return nil
+}
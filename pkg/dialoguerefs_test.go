@@ -0,0 +1,90 @@
+// Package pkg provides tests for the stale-pointer check between WFM dialogues and executable references
+package pkg
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestScanDialogueReferences(t *testing.T) {
+	// 0x10: u16 constant 3; 0x20 and 0x30: "addiu $a1, $zero, N" (bytes N 00 05 24)
+	data := make([]byte, 0x40)
+	data[0x10] = 3
+	copy(data[0x20:], []byte{0x01, 0x00, 0x05, 0x24})
+	copy(data[0x30:], []byte{0x04, 0x00, 0x05, 0x24})
+
+	offset := 0x10
+	definitions := []DialogueReferenceDefinition{
+		{Name: "intro", Offset: &offset},
+		{Name: "npc_talk", Pattern: "?? 00 05 24", IndexAt: 0},
+	}
+	references, err := ScanDialogueReferences(data, definitions)
+	if err != nil {
+		t.Fatalf("ScanDialogueReferences() failed: %v", err)
+	}
+
+	want := []DialogueReference{
+		{Name: "intro", Offset: 0x10, Index: 3},
+		{Name: "npc_talk", Offset: 0x20, Index: 1},
+		{Name: "npc_talk", Offset: 0x30, Index: 4},
+	}
+	if len(references) != len(want) {
+		t.Fatalf("ScanDialogueReferences() = %+v, want %+v", references, want)
+	}
+	for i := range want {
+		if references[i] != want[i] {
+			t.Errorf("references[%d] = %+v, want %+v", i, references[i], want[i])
+		}
+	}
+
+	invalid := []DialogueReferenceDefinition{
+		{Name: "both", Offset: &offset, Pattern: "00"},
+		{Name: "outside", Pattern: "05 24", IndexAt: 1},
+		{Name: "type", Offset: &offset, Type: "u64"},
+		{Name: "pattern", Pattern: "0G"},
+	}
+	for _, definition := range invalid {
+		if _, err := ScanDialogueReferences(data, []DialogueReferenceDefinition{definition}); err == nil {
+			t.Errorf("ScanDialogueReferences(%s) succeeded, want error", definition.Name)
+		}
+	}
+}
+
+func TestCheckDialogueReferences(t *testing.T) {
+	references := []DialogueReference{
+		{Name: "intro", Offset: 0x10, Index: 1},
+		{Name: "ending", Offset: 0x20, Index: 3},
+	}
+	entries := func(ids ...int) []DialogueEntry {
+		dialogues := make([]DialogueEntry, len(ids))
+		for i, id := range ids {
+			dialogues[i] = DialogueEntry{ID: id}
+		}
+		return dialogues
+	}
+
+	tests := []struct {
+		name      string
+		dialogues []DialogueEntry
+		want      []string
+	}{
+		{"unchanged", entries(3, 2, 1, 0), nil},
+		{"removed", entries(0, 1, 2), []string{"count changed from 4 to 3", "only 3 dialogues"}},
+		{"appended", entries(0, 1, 2, 3, 4, 5), nil},
+		{"gap", entries(0, 2, 3, 4), []string{"slot 1, which now holds dialogue ID 2", "slot 3, which now holds dialogue ID 4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckDialogueReferences(references, tt.dialogues, 4)
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("CheckDialogueReferences() = %q, want %d warnings", warnings, len(tt.want))
+			}
+			for i, want := range tt.want {
+				if !strings.Contains(warnings[i], want) {
+					t.Errorf("warnings[%d] = %q, want it to contain %q", i, warnings[i], want)
+				}
+			}
+		})
+	}
+}
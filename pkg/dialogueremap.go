@@ -0,0 +1,262 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue remap used when a translation adds brand-new dialogues. The
+// executable selects dialogues by their slot in the WFM pointer table, so new dialogues are
+// only ever appended after the decoded ones; the remap assigns their slots, lists the slot of
+// every named dialogue and refuses any change to a slot that was already in use.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// NewDialogueID marks a dialogue added to the YAML that has no slot yet (any negative ID does)
+const NewDialogueID = -1
+
+// DialogueRemapEntry is the slot of a named dialogue
+type DialogueRemapEntry struct {
+	Name       string `json:"name"`
+	Index      int    `json:"index"`
+	PreviousID int    `json:"previous_id"` // ID in the input YAML (negative for new dialogues)
+	New        bool   `json:"new"`         // Slot assigned by this remap
+}
+
+// DialogueRemapReport lists the slots of the named dialogues after a remap
+type DialogueRemapReport struct {
+	File          string               `json:"file,omitempty"`
+	OriginalCount int                  `json:"original_count"` // Dialogues of the decoded WFM file
+	TotalCount    int                  `json:"total_count"`
+	Appended      int                  `json:"appended"` // Dialogues after the decoded ones
+	Assigned      int                  `json:"assigned"` // New dialogues given a slot by this remap
+	References    int                  `json:"references"`
+	Problems      []string             `json:"problems,omitempty"` // Stale executable references
+	Entries       []DialogueRemapEntry `json:"entries"`
+}
+
+// DialogueRemapper assigns slots to new dialogues of a dialogue YAML export
+type DialogueRemapper struct {
+	referenceExe     string
+	referenceProfile *DialogueReferenceProfile
+	referenceFile    string
+}
+
+// NewDialogueRemapper creates a new dialogue remapper instance
+func NewDialogueRemapper() *DialogueRemapper {
+	return &DialogueRemapper{}
+}
+
+// SetReferenceCheck makes Remap check the dialogue references of wfmFile in the executable
+// against the remapped dialogues (nil profile disables)
+func (r *DialogueRemapper) SetReferenceCheck(exeFile, wfmFile string, profile *DialogueReferenceProfile) {
+	r.referenceExe = exeFile
+	r.referenceFile = wfmFile
+	r.referenceProfile = profile
+}
+
+// Remap appends the new dialogues (negative ID) after every other dialogue and sorts the
+// dialogues by ID. The decoded dialogues (IDs below total_dialogues) must all still be there
+// exactly once, and dialogues appended by an earlier remap keep their slots, so no index the
+// executable may use changes. Dialogues past the decoded ones need a unique name.
+func (r *DialogueRemapper) Remap(dialogues *DialoguesYAML) (*DialogueRemapReport, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf(format, args...))
+	}
+
+	originalCount := dialogues.TotalDialogues
+	seen := make(map[int]bool, len(dialogues.Dialogues))
+	names := make(map[string]bool)
+	var appended, added []*DialogueEntry
+	for i := range dialogues.Dialogues {
+		dialogue := &dialogues.Dialogues[i]
+		if dialogue.Name != "" {
+			if names[dialogue.Name] {
+				return nil, invalid("dialogue name %q is used more than once", dialogue.Name)
+			}
+			names[dialogue.Name] = true
+		}
+
+		switch {
+		case dialogue.ID < 0:
+			if dialogue.Name == "" {
+				return nil, invalid("new dialogue %d of the YAML needs a name", i+1)
+			}
+			added = append(added, dialogue)
+			continue
+		case dialogue.ID >= originalCount && dialogue.Name == "":
+			return nil, invalid("dialogue %d is past the %d decoded dialogues and needs a name", dialogue.ID, originalCount)
+		case seen[dialogue.ID]:
+			return nil, invalid("dialogue ID %d is used more than once", dialogue.ID)
+		}
+		seen[dialogue.ID] = true
+		if dialogue.ID >= originalCount {
+			appended = append(appended, dialogue)
+		}
+	}
+
+	for id := 0; id < originalCount; id++ {
+		if !seen[id] {
+			return nil, invalid("decoded dialogue %d is missing: removing it would shift every later slot", id)
+		}
+	}
+
+	// Dialogues appended by an earlier remap must be contiguous, or their slots would move
+	sort.SliceStable(appended, func(i, j int) bool { return appended[i].ID < appended[j].ID })
+	for i, dialogue := range appended {
+		if dialogue.ID != originalCount+i {
+			return nil, invalid("appended dialogue %q has ID %d, but slot %d is empty: its slot would change",
+				dialogue.Name, dialogue.ID, originalCount+i)
+		}
+	}
+
+	report := &DialogueRemapReport{OriginalCount: originalCount, Entries: []DialogueRemapEntry{}}
+	previous := make(map[*DialogueEntry]int, len(dialogues.Dialogues))
+	for i := range dialogues.Dialogues {
+		previous[&dialogues.Dialogues[i]] = dialogues.Dialogues[i].ID
+	}
+	next := originalCount + len(appended)
+	for _, dialogue := range added {
+		dialogue.ID = next
+		next++
+		common.LogDebug("Dialogue %q appended as %d", dialogue.Name, dialogue.ID)
+	}
+
+	for i := range dialogues.Dialogues {
+		dialogue := &dialogues.Dialogues[i]
+		if dialogue.Name == "" {
+			continue
+		}
+		report.Entries = append(report.Entries, DialogueRemapEntry{
+			Name:       dialogue.Name,
+			Index:      dialogue.ID,
+			PreviousID: previous[dialogue],
+			New:        previous[dialogue] < 0,
+		})
+	}
+	sort.SliceStable(dialogues.Dialogues, func(i, j int) bool { return dialogues.Dialogues[i].ID < dialogues.Dialogues[j].ID })
+	sort.SliceStable(report.Entries, func(i, j int) bool { return report.Entries[i].Index < report.Entries[j].Index })
+
+	report.TotalCount = len(dialogues.Dialogues)
+	report.Appended = report.TotalCount - originalCount
+	report.Assigned = len(added)
+
+	if r.referenceProfile != nil {
+		if err := r.checkReferences(dialogues, report); err != nil {
+			return nil, err
+		}
+	}
+
+	common.LogDebug("Remapped %d dialogues: %d appended, %d assigned", report.TotalCount, report.Appended, report.Assigned)
+	return report, nil
+}
+
+// checkReferences runs the stale-pointer check configured with SetReferenceCheck on the
+// remapped dialogues and records its problems in the report
+func (r *DialogueRemapper) checkReferences(dialogues *DialoguesYAML, report *DialogueRemapReport) error {
+	definitions, err := r.referenceProfile.ReferencesFor(r.referenceFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	data, err := os.ReadFile(r.referenceExe)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read executable: %w", err))
+	}
+	references, err := ScanDialogueReferences(data, definitions)
+	if err != nil {
+		return err
+	}
+
+	report.References = len(references)
+	report.Problems = CheckDialogueReferences(references, dialogues.Dialogues, dialogues.TotalDialogues)
+	common.LogInfo("Checked %d dialogue references in %s: %d problems", len(references), filepath.Base(r.referenceExe), len(report.Problems))
+	return nil
+}
+
+// RemapFile loads a dialogue YAML file, remaps its dialogues and saves the result to
+// outputFile (empty only reports the slots)
+func (r *DialogueRemapper) RemapFile(inputFile, outputFile string) (*DialogueRemapReport, error) {
+	dialogues, err := dialogueyaml.Read(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dialogues: %w", err)
+	}
+
+	report, err := r.Remap(dialogues)
+	if err != nil {
+		return nil, err
+	}
+	report.File = inputFile
+
+	if outputFile != "" {
+		if err := dialogueyaml.Write(outputFile, dialogues); err != nil {
+			return nil, fmt.Errorf("failed to write dialogues: %w", err)
+		}
+	}
+	return report, nil
+}
+
+// WriteDialogueRemapReport writes the remap report in the requested format (json or markdown)
+func WriteDialogueRemapReport(report *DialogueRemapReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeDialogueRemapMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeDialogueRemapMarkdown renders the remap report as a markdown document
+func writeDialogueRemapMarkdown(report *DialogueRemapReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Dialogue Remap\n\n")
+	sb.WriteString("| Metric | Value |\n")
+	sb.WriteString("|--------|-------|\n")
+	if report.File != "" {
+		sb.WriteString(fmt.Sprintf("| File | %s |\n", report.File))
+	}
+	sb.WriteString(fmt.Sprintf("| Decoded dialogues | %d |\n", report.OriginalCount))
+	sb.WriteString(fmt.Sprintf("| Total dialogues | %d |\n", report.TotalCount))
+	sb.WriteString(fmt.Sprintf("| Appended | %d |\n", report.Appended))
+	sb.WriteString(fmt.Sprintf("| Assigned now | %d |\n", report.Assigned))
+	if report.References > 0 {
+		sb.WriteString(fmt.Sprintf("| Executable references | %d |\n", report.References))
+	}
+
+	sb.WriteString("\n## Named Dialogues\n\n")
+	sb.WriteString("| Name | Index | Status |\n")
+	sb.WriteString("|------|-------|--------|\n")
+	for _, entry := range report.Entries {
+		status := "unchanged"
+		if entry.New {
+			status = "new"
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %d | %s |\n", entry.Name, entry.Index, status))
+	}
+
+	if len(report.Problems) > 0 {
+		sb.WriteString("\n## Stale References\n\n")
+		for _, problem := range report.Problems {
+			sb.WriteString(fmt.Sprintf("- %s\n", problem))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
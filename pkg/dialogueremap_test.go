@@ -0,0 +1,126 @@
+// Package pkg provides tests for the dialogue remap of new dialogues
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// remapDialogues builds a dialogue export of originalCount decoded dialogues with extra entries
+func remapDialogues(originalCount int, extra ...DialogueEntry) *DialoguesYAML {
+	dialogues := &DialoguesYAML{TotalDialogues: originalCount}
+	for id := 0; id < originalCount; id++ {
+		dialogues.Dialogues = append(dialogues.Dialogues, DialogueEntry{ID: id})
+	}
+	dialogues.Dialogues = append(dialogues.Dialogues, extra...)
+	return dialogues
+}
+
+func TestDialogueRemapper_Remap(t *testing.T) {
+	// A new dialogue placed in the middle of the file still goes after the appended ones
+	dialogues := remapDialogues(3, DialogueEntry{ID: 3, Name: "old_hint"})
+	dialogues.Dialogues = append([]DialogueEntry{{ID: NewDialogueID, Name: "new_hint"}}, dialogues.Dialogues...)
+	dialogues.Dialogues[2].Name = "intro"
+
+	report, err := NewDialogueRemapper().Remap(dialogues)
+	if err != nil {
+		t.Fatalf("Remap() failed: %v", err)
+	}
+
+	for i, dialogue := range dialogues.Dialogues {
+		if dialogue.ID != i {
+			t.Errorf("dialogues[%d].ID = %d, want %d", i, dialogue.ID, i)
+		}
+	}
+	if dialogues.Dialogues[4].Name != "new_hint" {
+		t.Errorf("slot 4 holds %q, want new_hint", dialogues.Dialogues[4].Name)
+	}
+
+	want := []DialogueRemapEntry{
+		{Name: "intro", Index: 1, PreviousID: 1},
+		{Name: "old_hint", Index: 3, PreviousID: 3},
+		{Name: "new_hint", Index: 4, PreviousID: NewDialogueID, New: true},
+	}
+	if len(report.Entries) != len(want) {
+		t.Fatalf("Entries = %+v, want %+v", report.Entries, want)
+	}
+	for i := range want {
+		if report.Entries[i] != want[i] {
+			t.Errorf("Entries[%d] = %+v, want %+v", i, report.Entries[i], want[i])
+		}
+	}
+	if report.TotalCount != 5 || report.Appended != 2 || report.Assigned != 1 {
+		t.Errorf("counts = %d/%d/%d, want 5/2/1", report.TotalCount, report.Appended, report.Assigned)
+	}
+
+	// A second remap has nothing to assign and keeps every slot
+	again, err := NewDialogueRemapper().Remap(dialogues)
+	if err != nil {
+		t.Fatalf("second Remap() failed: %v", err)
+	}
+	if again.Assigned != 0 || again.Entries[2].Index != 4 || again.Entries[2].New {
+		t.Errorf("second Remap() = %+v, want new_hint kept at 4", again.Entries)
+	}
+}
+
+func TestDialogueRemapper_RemapRejectsChangedSlots(t *testing.T) {
+	tests := []struct {
+		name      string
+		dialogues *DialoguesYAML
+		want      string
+	}{
+		{"missing decoded", &DialoguesYAML{TotalDialogues: 2, Dialogues: []DialogueEntry{{ID: 0}}}, "decoded dialogue 1 is missing"},
+		{"duplicate id", remapDialogues(2, DialogueEntry{ID: 1}), "used more than once"},
+		{"unnamed new", remapDialogues(2, DialogueEntry{ID: NewDialogueID}), "needs a name"},
+		{"unnamed appended", remapDialogues(2, DialogueEntry{ID: 2}), "needs a name"},
+		{"duplicate name", remapDialogues(2, DialogueEntry{ID: 2, Name: "a"}, DialogueEntry{ID: -1, Name: "a"}), "\"a\" is used more than once"},
+		{"moved appended", remapDialogues(2, DialogueEntry{ID: 3, Name: "late"}), "slot 2 is empty"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewDialogueRemapper().Remap(tt.dialogues)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Remap() error = %v, want it to contain %q", err, tt.want)
+			}
+			if common.ExitCodeFor(err) != common.ExitValidationFailed {
+				t.Errorf("Remap() exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+			}
+		})
+	}
+}
+
+func TestDialogueRemapper_RemapChecksReferences(t *testing.T) {
+	dir := t.TempDir()
+	exeFile := filepath.Join(dir, "MAIN0.EXE")
+	// u16 constants referencing slots 1 and 2
+	if err := os.WriteFile(exeFile, []byte{1, 0, 2, 0}, 0644); err != nil {
+		t.Fatalf("failed to write executable: %v", err)
+	}
+	first, second := 0, 2
+	profile := &DialogueReferenceProfile{Files: map[string]DialogueReferenceFileProfile{
+		"CFNT999H.WFM": {References: []DialogueReferenceDefinition{
+			{Name: "intro", Offset: &first},
+			{Name: "ending", Offset: &second},
+		}},
+	}}
+
+	remapper := NewDialogueRemapper()
+	remapper.SetReferenceCheck(exeFile, "CFNT999H.WFM", profile)
+	report, err := remapper.Remap(remapDialogues(3, DialogueEntry{ID: NewDialogueID, Name: "extra"}))
+	if err != nil {
+		t.Fatalf("Remap() failed: %v", err)
+	}
+	if report.References != 2 || len(report.Problems) != 0 {
+		t.Errorf("appending found %d references and problems %q, want 2 and none", report.References, report.Problems)
+	}
+
+	remapper.SetReferenceCheck(exeFile, "OTHER.WFM", profile)
+	if _, err := remapper.Remap(remapDialogues(3)); err == nil {
+		t.Error("Remap() with an unconfigured WFM file succeeded, want error")
+	}
+}
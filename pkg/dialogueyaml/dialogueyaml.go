@@ -0,0 +1,186 @@
+// Package dialogueyaml reads and writes the dialogue YAML files of WFM fonts
+// (dialogues.yaml): decode writes the text of every dialogue to one, translators edit it
+// and encode reads it back. It is the YAML adapter of package wfm and depends only on
+// yaml.v3, the standard library and pkg/common, so tools embedding the codecs can read
+// and write translations without importing pkg.
+package dialogueyaml
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// Terminator words ending a dialogue in the WFM file (TERMINATOR_1 and TERMINATOR_2 of the
+// control codes)
+const (
+	continueCode = 0xFFFE
+	haltCode     = 0xFFFF
+)
+
+// File is the content of a dialogue YAML file
+type File struct {
+	TotalDialogues    int                    `yaml:"total_dialogues"`
+	OriginalSize      int64                  `yaml:"original_size"`
+	PlaceholderGlyphs []int                  `yaml:"placeholder_glyphs,omitempty"`
+	GlyphWidths       map[int]map[string]int `yaml:"glyph_widths,omitempty"`   // Character widths by font height
+	DoubleNewline     string                 `yaml:"double_newline,omitempty"` // DOUBLE_NEWLINE mode the text was decoded with
+	Dialogues         []Entry                `yaml:"dialogues"`
+}
+
+// Entry is a single dialogue of a dialogue YAML file
+type Entry struct {
+	ID         int                      `yaml:"id"`
+	Name       string                   `yaml:"name,omitempty"` // Logical name of the dialogue (see pkg.DialogueRemapper)
+	Type       string                   `yaml:"type"`
+	FontHeight int                      `yaml:"font_height"`
+	FontClut   uint16                   `yaml:"font_clut"`
+	Palette    string                   `yaml:"palette,omitempty"` // Palette font_clut was drawn with by decode (informational)
+	Terminator Terminator               `yaml:"terminator"`
+	Special    bool                     `yaml:"special,omitempty"`
+	Content    []map[string]interface{} `yaml:"content"`
+	Raw        string                   `yaml:"raw,omitempty"`
+	Widths     *Widths                  `yaml:"widths,omitempty"`
+	Drafts     map[string]*Draft        `yaml:"drafts,omitempty"` // Machine translated drafts by language
+
+	// Fingerprint identifies the original text decode read (see pkg.DialogueFingerprint);
+	// decode --merge-existing uses it to tell which translations are still current
+	Fingerprint string    `yaml:"fingerprint,omitempty"`
+	Conflict    *Conflict `yaml:"conflict,omitempty"` // Translation of a changed original text (see pkg.MergeDialogues)
+
+	// Notes is free text for translators (speaker, scene, context). Decode writes it
+	// empty, encode leaves it out of the WFM file and tools rewriting the YAML keep it.
+	Notes string `yaml:"notes"`
+}
+
+// Widths is the measured width metadata of a dialogue
+type Widths struct {
+	Lines []int `yaml:"lines"` // Pixel width of every line, in order
+	Max   int   `yaml:"max"`   // Width of the widest original line; edited lines should not exceed it
+}
+
+// Draft is a machine translated draft of the text items of a dialogue
+type Draft struct {
+	Backend   string   `yaml:"backend"`             // Backend the draft came from
+	Text      []string `yaml:"text"`                // Draft of every text item, in content order
+	Bytes     int      `yaml:"bytes"`               // Estimated encoded size of the draft text
+	Budget    int      `yaml:"budget"`              // Encoded size the draft text may take
+	Attention []string `yaml:"attention,omitempty"` // Reasons a translator must check the draft
+}
+
+// Conflict holds the translation of a dialogue whose original text changed. Encode
+// refuses dialogues with a conflict; merge the translation into the content, then delete it.
+type Conflict struct {
+	Fingerprint string                   `yaml:"fingerprint,omitempty"` // Fingerprint of the original text the translation was made from
+	Content     []map[string]interface{} `yaml:"content"`               // Translated content of the existing export
+}
+
+// Terminator is the terminator of a dialogue. The word ending a dialogue decides whether
+// control returns to the event script: 0xFFFE hands it back as soon as the text is shown,
+// 0xFFFF keeps it until the box is closed. Files name them continue and halt; the numbers
+// 1 and 2 of older files are still read.
+type Terminator uint16
+
+// Dialogue terminators; the values are the numbers used by older YAML files
+const (
+	TerminatorContinue Terminator = 1 // TERMINATOR_1: control returns to the event script at once
+	TerminatorHalt     Terminator = 2 // TERMINATOR_2: control returns once the box is closed
+)
+
+// terminatorNames maps the YAML names to the terminators
+var terminatorNames = map[string]Terminator{
+	"continue": TerminatorContinue,
+	"halt":     TerminatorHalt,
+}
+
+// TerminatorFromCode returns the terminator of a terminator word; unknown words are halt
+func TerminatorFromCode(code uint16) Terminator {
+	if code == continueCode {
+		return TerminatorContinue
+	}
+	return TerminatorHalt
+}
+
+// Code returns the terminator word written at the end of the dialogue. A missing
+// terminator is halt.
+func (t Terminator) Code() uint16 {
+	if t == TerminatorContinue {
+		return continueCode
+	}
+	return haltCode
+}
+
+// String returns the YAML name of the terminator. A missing terminator is halt.
+func (t Terminator) String() string {
+	if t == TerminatorContinue {
+		return "continue"
+	}
+	return "halt"
+}
+
+// MarshalYAML writes the terminator by name
+func (t Terminator) MarshalYAML() (interface{}, error) {
+	return t.String(), nil
+}
+
+// UnmarshalYAML reads a terminator name, the numbers 1 and 2 of older files or a
+// terminator word (0xFFFE or 0xFFFF)
+func (t *Terminator) UnmarshalYAML(node *yaml.Node) error {
+	if terminator, found := terminatorNames[strings.ToLower(node.Value)]; found {
+		*t = terminator
+		return nil
+	}
+
+	var value uint16
+	if err := node.Decode(&value); err == nil {
+		switch value {
+		case uint16(TerminatorContinue), continueCode:
+			*t = TerminatorContinue
+			return nil
+		case uint16(TerminatorHalt), haltCode:
+			*t = TerminatorHalt
+			return nil
+		}
+	}
+	return common.WithCategory(common.ErrCategoryValidationFailed,
+		fmt.Errorf("line %d: invalid terminator %q: expected continue or halt", node.Line, node.Value))
+}
+
+// Parse parses the content of a dialogue YAML file
+func Parse(data []byte) (*File, error) {
+	var file File
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+	return &file, nil
+}
+
+// Read loads a dialogue YAML file
+func Read(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+	return Parse(data)
+}
+
+// Write writes dialogues to a YAML file with the layout of decode
+func Write(path string, file *File) error {
+	yamlWriter, err := common.CreateOutput(path)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create YAML file: %w", err))
+	}
+	defer yamlWriter.Close()
+
+	encoder := yaml.NewEncoder(yamlWriter)
+	encoder.SetIndent(2)
+
+	if err := encoder.Encode(file); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode YAML: %w", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// Package dialogueyaml provides tests for the dialogue YAML files
+package dialogueyaml
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+func TestTerminator_YAML(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Terminator
+		wantErr bool
+	}{
+		{value: "continue", want: TerminatorContinue},
+		{value: "halt", want: TerminatorHalt},
+		{value: "HALT", want: TerminatorHalt},
+		{value: "1", want: TerminatorContinue},
+		{value: "2", want: TerminatorHalt},
+		{value: "0xFFFE", want: TerminatorContinue},
+		{value: "0xFFFF", want: TerminatorHalt},
+		{value: "3", wantErr: true},
+		{value: "stop", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		var entry Entry
+		err := yaml.Unmarshal([]byte("terminator: "+tt.value), &entry)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Unmarshal(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && entry.Terminator != tt.want {
+			t.Errorf("Unmarshal(%q) = %v, want %v", tt.value, entry.Terminator, tt.want)
+		}
+	}
+
+	data, err := yaml.Marshal(Entry{Terminator: TerminatorContinue})
+	if err != nil {
+		t.Fatalf("Marshal() failed: %v", err)
+	}
+	if !strings.Contains(string(data), "terminator: continue") {
+		t.Errorf("Marshal() = %q, want terminator: continue", data)
+	}
+}
+
+func TestTerminator_Code(t *testing.T) {
+	if got := TerminatorContinue.Code(); got != 0xFFFE {
+		t.Errorf("TerminatorContinue.Code() = 0x%04X, want 0xFFFE", got)
+	}
+	if got := Terminator(0).Code(); got != 0xFFFF {
+		t.Errorf("missing terminator Code() = 0x%04X, want 0xFFFF", got)
+	}
+	if got := TerminatorFromCode(0xFFFE); got != TerminatorContinue {
+		t.Errorf("TerminatorFromCode(0xFFFE) = %v, want continue", got)
+	}
+}
+
+func TestReadWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dialogues.yaml")
+	file := &File{
+		TotalDialogues:    2,
+		OriginalSize:      4096,
+		PlaceholderGlyphs: []int{3},
+		Dialogues: []Entry{
+			{ID: 0, Type: "dialogue", FontHeight: 16, Terminator: TerminatorContinue,
+				Content: []map[string]interface{}{{"text": "Hello!"}}, Notes: "Tomba"},
+			{ID: 1, Type: "event", FontHeight: 8, Terminator: TerminatorHalt,
+				Content: []map[string]interface{}{{"text": "Bye"}}, Widths: &Widths{Lines: []int{24}, Max: 24}},
+		},
+	}
+	if err := Write(path, file); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	got, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() failed: %v", err)
+	}
+	if !reflect.DeepEqual(got, file) {
+		t.Errorf("Read() = %+v, want %+v", got, file)
+	}
+}
+
+func TestRead_Errors(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Read(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("Read() of a missing file succeeded")
+	}
+
+	broken := filepath.Join(dir, "broken.yaml")
+	if err := os.WriteFile(broken, []byte("dialogues: [\n"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+	if _, err := Read(broken); !errors.Is(err, common.ErrCategoryFormat) {
+		t.Errorf("Read() of a broken file error = %v, want %v", err, common.ErrCategoryFormat)
+	}
+}
@@ -0,0 +1,81 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the CD image fingerprint entry point and its report writers.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// DiscIDReport is the fingerprint of a disc and the known release it matches
+type DiscIDReport struct {
+	psx.DiscIdentity
+	Known   bool   `json:"known"`             // The serial is listed by a profile
+	Title   string `json:"title,omitempty"`   // Title of the matched release
+	Profile string `json:"profile,omitempty"` // Name of the profile selected for the disc
+}
+
+// Identify reads the serial, region and build date of a CD image
+func (p *CDFileProcessor) Identify(imageFile string) (*psx.DiscIdentity, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	identity, err := reader.Identify()
+	if err != nil {
+		return nil, fmt.Errorf("failed to identify CD image: %w", err)
+	}
+
+	p.logger.Debug("Identified %s as %s (%s)", imageFile, identity.Serial, identity.Region)
+	return identity, nil
+}
+
+// WriteDiscIDReport writes the report in the requested format (json or markdown)
+func WriteDiscIDReport(report *DiscIDReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeDiscIDMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeDiscIDMarkdown renders the report as a markdown document
+func writeDiscIDMarkdown(report *DiscIDReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Disc Identity\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Serial | %s |\n", report.Serial))
+	sb.WriteString(fmt.Sprintf("| Region | %s |\n", report.Region))
+	sb.WriteString(fmt.Sprintf("| Build date | %s |\n", report.BuildDate))
+	sb.WriteString(fmt.Sprintf("| Boot path | %s |\n", report.BootPath))
+	sb.WriteString(fmt.Sprintf("| System ID | %s |\n", report.SystemID))
+	sb.WriteString(fmt.Sprintf("| Volume ID | %s |\n", report.VolumeID))
+
+	sb.WriteString("\n## Release\n\n")
+	if report.Known {
+		sb.WriteString(fmt.Sprintf("%s, selected profile: %s\n", report.Title, report.Profile))
+	} else {
+		sb.WriteString("Unknown release; no profile lists this serial.\n")
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
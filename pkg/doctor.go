@@ -0,0 +1,360 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the project doctor: a set of checks of the working directory (reference
+// fonts, palettes, configuration files, cached state, disc images and write permissions)
+// that report what is missing or broken together with the command or step that fixes it.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// Doctor check statuses
+const (
+	DoctorOK      = "ok"
+	DoctorWarning = "warning"
+	DoctorError   = "error"
+)
+
+// DefaultDialoguesFile is the dialogue YAML file written by wfm decode
+const DefaultDialoguesFile = "dialogues.yaml"
+
+// encodeFontRegion is the fonts/ subdirectory encode loads glyph PNG files from
+const encodeFontRegion = "br"
+
+// fontCategories are the subdirectories of a font height directory, in search order
+var fontCategories = []string{"lowercase", "uppercase", "numbers", "symbols", "psx"}
+
+// requiredFontCharacters are the characters every font height is expected to provide
+const requiredFontCharacters = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789"
+
+// doctorImageExtensions are the file extensions of disc images looked for by the doctor
+var doctorImageExtensions = []string{".bin", ".img", ".iso"}
+
+// DoctorCheck is the result of one doctor check
+type DoctorCheck struct {
+	Check   string `json:"check"`
+	Status  string `json:"status"` // ok, warning or error
+	Message string `json:"message"`
+	Fix     string `json:"fix,omitempty"` // What to do about a warning or error
+}
+
+// DoctorReport lists the results of the doctor checks of a directory
+type DoctorReport struct {
+	Directory string        `json:"directory"`
+	Errors    int           `json:"errors"`
+	Warnings  int           `json:"warnings"`
+	Checks    []DoctorCheck `json:"checks"`
+}
+
+// add records a check result
+func (r *DoctorReport) add(check, status, fix, format string, args ...interface{}) {
+	r.Checks = append(r.Checks, DoctorCheck{Check: check, Status: status, Message: fmt.Sprintf(format, args...), Fix: fix})
+	switch status {
+	case DoctorError:
+		r.Errors++
+	case DoctorWarning:
+		r.Warnings++
+	}
+}
+
+// DoctorProfile is the outcome of loading the game profile checked by the doctor
+type DoctorProfile struct {
+	Name        string
+	Source      string // "embedded" or the path of the override file
+	OverrideDir string // Directory searched for user-supplied profiles
+	FontHeights []int  // Font heights expected in the fonts/ tree
+	Err         error  // Why the profile could not be loaded (nil if loaded)
+}
+
+// Doctor checks the setup of a translation project directory
+type Doctor struct {
+	dir     string
+	profile DoctorProfile
+}
+
+// NewDoctor creates a doctor for dir checking the fonts against the given profile
+func NewDoctor(dir string, profile DoctorProfile) *Doctor {
+	return &Doctor{dir: dir, profile: profile}
+}
+
+// Run performs every check and returns the report
+func (d *Doctor) Run() *DoctorReport {
+	report := &DoctorReport{Directory: d.dir, Checks: []DoctorCheck{}}
+
+	d.checkProfile(report)
+	d.checkFonts(report, d.profile.FontHeights)
+	d.checkPalettes(report)
+	d.checkConfigFiles(report)
+	d.checkCache(report)
+	d.checkImages(report)
+	d.checkPermissions(report)
+	return report
+}
+
+// checkProfile reports whether the profile could be loaded
+func (d *Doctor) checkProfile(report *DoctorReport) {
+	if d.profile.Err != nil {
+		report.add("profile", DoctorError,
+			fmt.Sprintf("fix or remove the broken file in %s, or pick another profile with --profile", d.profile.OverrideDir),
+			"cannot load profile %s: %v", d.profile.Name, d.profile.Err)
+		return
+	}
+	report.add("profile", DoctorOK, "", "profile %s loaded from %s", d.profile.Name, d.profile.Source)
+}
+
+// checkFonts checks that every region of the fonts/ tree has a directory per font height
+// providing the basic letters and digits
+func (d *Doctor) checkFonts(report *DoctorReport, fontHeights []int) {
+	fontDir := filepath.Join(d.dir, DefaultFontDir)
+	regions, err := os.ReadDir(fontDir)
+	if err != nil {
+		report.add("fonts", DoctorError,
+			"copy the fonts/ directory of the TombaTools release into the working directory",
+			"reference font directory %s not found: decode cannot map glyphs to characters", fontDir)
+		return
+	}
+
+	if _, err := os.Stat(filepath.Join(fontDir, encodeFontRegion)); err != nil {
+		report.add("fonts", DoctorError,
+			fmt.Sprintf("create %s with one directory per font height", filepath.Join(fontDir, encodeFontRegion)),
+			"%s/%s not found: encode loads glyph PNG files from it", DefaultFontDir, encodeFontRegion)
+	}
+
+	for _, region := range regions {
+		if !region.IsDir() {
+			continue
+		}
+		for _, height := range fontHeights {
+			heightDir := filepath.Join(fontDir, region.Name(), fmt.Sprintf("%d", height))
+			if _, err := os.Stat(heightDir); err != nil {
+				report.add("fonts", DoctorWarning,
+					fmt.Sprintf("create %s with the glyph PNG files of that height", heightDir),
+					"%s has no %d px font", region.Name(), height)
+				continue
+			}
+
+			missing := missingFontCharacters(heightDir)
+			if len(missing) == 0 {
+				report.add("fonts", DoctorOK, "", "%s/%d is complete", region.Name(), height)
+				continue
+			}
+			report.add("fonts", DoctorWarning,
+				fmt.Sprintf("add the missing characters as <code point>.png (e.g. %04X.png) under %s", missing[0], heightDir),
+				"%s/%d misses basic characters (%d): %s", region.Name(), height, len(missing), summarizeRunes(missing, 10))
+		}
+	}
+}
+
+// missingFontCharacters returns the required characters without a PNG file in any category
+// of a font height directory
+func missingFontCharacters(heightDir string) []rune {
+	var missing []rune
+	for _, char := range requiredFontCharacters {
+		found := false
+		for _, category := range fontCategories {
+			if _, err := os.Stat(filepath.Join(heightDir, category, fmt.Sprintf("%04X.png", char))); err == nil {
+				found = true
+				break
+			}
+		}
+		if !found {
+			missing = append(missing, char)
+		}
+	}
+	return missing
+}
+
+// summarizeRunes lists up to limit characters, followed by the number of the others
+func summarizeRunes(chars []rune, limit int) string {
+	shown := chars
+	if len(shown) > limit {
+		shown = shown[:limit]
+	}
+	summary := strings.Join(strings.Split(string(shown), ""), " ")
+	if len(chars) > limit {
+		summary += fmt.Sprintf(" and %d more", len(chars)-limit)
+	}
+	return summary
+}
+
+// checkPalettes checks the project palette file
+func (d *Doctor) checkPalettes(report *DoctorReport) {
+	path := filepath.Join(d.dir, DefaultPaletteFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		report.add("palettes", DoctorWarning,
+			"run tombatools wfm palettes --vram vram.bin <file.WFM> . to record the game palettes",
+			"%s not found: glyphs are converted with the built-in CLUTs", DefaultPaletteFile)
+		return
+	}
+
+	set, err := LoadPaletteSet(path)
+	if err != nil {
+		report.add("palettes", DoctorError,
+			"fix the file or run tombatools wfm palettes again to rewrite it", "%v", err)
+		return
+	}
+	report.add("palettes", DoctorOK, "", "%s holds %d palettes", DefaultPaletteFile, len(set.Palettes))
+}
+
+// checkConfigFiles checks the dialogue and glossary files that are present
+func (d *Doctor) checkConfigFiles(report *DoctorReport) {
+	dialoguesFile := filepath.Join(d.dir, DefaultDialoguesFile)
+	if _, err := os.Stat(dialoguesFile); err == nil {
+		dialogues, err := dialogueyaml.Read(dialoguesFile)
+		if err != nil {
+			report.add("dialogues", DoctorError,
+				"fix the YAML syntax at the reported line, or decode the original WFM file again", "%v", err)
+		} else {
+			report.add("dialogues", DoctorOK, "", "%s holds %d dialogues", DefaultDialoguesFile, len(dialogues.Dialogues))
+		}
+	}
+
+	glossaryFile := filepath.Join(d.dir, DefaultGlossaryFile)
+	if _, err := os.Stat(glossaryFile); err == nil {
+		glossary, err := LoadGlossary(glossaryFile)
+		if err != nil {
+			report.add("glossary", DoctorError, "fix the reported term; see tombatools wfm lint --help for the format", "%v", err)
+		} else {
+			report.add("glossary", DoctorOK, "", "%s holds %d terms", DefaultGlossaryFile, len(glossary.Terms))
+		}
+	}
+}
+
+// checkCache checks the unmapped codes dictionary and looks for leftover temporary workspaces
+func (d *Doctor) checkCache(report *DoctorReport) {
+	unmappedFile := filepath.Join(d.dir, DefaultUnmappedCodesFile)
+	if _, err := os.Stat(unmappedFile); err == nil {
+		if _, err := LoadUnmappedDictionary(unmappedFile); err != nil {
+			report.add("cache", DoctorError,
+				fmt.Sprintf("delete %s; the next decode or encode records the codes again", unmappedFile), "%v", err)
+		} else {
+			report.add("cache", DoctorOK, "", "%s is readable", DefaultUnmappedCodesFile)
+		}
+	}
+
+	root := common.TempRoot()
+	leftovers, err := filepath.Glob(filepath.Join(root, "tombatools-*"))
+	if err != nil || len(leftovers) == 0 {
+		report.add("cache", DoctorOK, "", "no temporary workspaces left in %s", root)
+		return
+	}
+	sort.Strings(leftovers)
+	report.add("cache", DoctorWarning,
+		fmt.Sprintf("remove %s once no tombatools command is running; --keep-temp and interrupted runs leave them behind",
+			filepath.Join(root, "tombatools-*")),
+		"%d temporary workspaces left in %s, e.g. %s", len(leftovers), root, filepath.Base(leftovers[0]))
+}
+
+// checkImages looks for disc images and identifies them
+func (d *Doctor) checkImages(report *DoctorReport) {
+	entries, err := os.ReadDir(d.dir)
+	if err != nil {
+		report.add("images", DoctorError, "check the directory path and its permissions", "cannot list %s: %v", d.dir, err)
+		return
+	}
+
+	found := 0
+	processor := NewCDProcessor()
+	for _, entry := range entries {
+		extension := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || !slices.Contains(doctorImageExtensions, extension) {
+			continue
+		}
+		found++
+
+		identity, err := processor.Identify(filepath.Join(d.dir, entry.Name()))
+		if err != nil {
+			report.add("images", DoctorWarning,
+				"use a raw 2352-byte sector image (BIN) of the game disc", "%s is not a readable disc image: %v", entry.Name(), err)
+			continue
+		}
+		report.add("images", DoctorOK, "", "%s: %s (%s)", entry.Name(), identity.Serial, identity.Region)
+	}
+
+	if found == 0 {
+		report.add("images", DoctorWarning,
+			"copy the BIN image of the game disc into the working directory to use the cd and fla commands",
+			"no disc image (%s) found", strings.Join(doctorImageExtensions, ", "))
+	}
+}
+
+// checkPermissions checks that the project directory and the temporary root are writable
+func (d *Doctor) checkPermissions(report *DoctorReport) {
+	for _, dir := range []string{d.dir, common.TempRoot()} {
+		if _, err := os.Stat(dir); os.IsNotExist(err) && dir != d.dir {
+			report.add("permissions", DoctorOK, "", "%s does not exist yet and is created on first use", dir)
+			continue
+		}
+		file, err := os.CreateTemp(dir, ".tombatools-doctor-*")
+		if err != nil {
+			report.add("permissions", DoctorError,
+				fmt.Sprintf("make %s writable, or choose another directory with --temp-dir for temporary files", dir),
+				"%s is not writable: %v", dir, err)
+			continue
+		}
+		file.Close()
+		os.Remove(file.Name())
+		report.add("permissions", DoctorOK, "", "%s is writable", dir)
+	}
+}
+
+// WriteDoctorReport writes the report in the requested format (json or markdown)
+func WriteDoctorReport(report *DoctorReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeDoctorMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeDoctorMarkdown renders the report as a markdown document, listing the fixes of
+// warnings and errors after the results
+func writeDoctorMarkdown(report *DoctorReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Doctor\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Directory | %s |\n", report.Directory))
+	sb.WriteString(fmt.Sprintf("| Errors | %d |\n", report.Errors))
+	sb.WriteString(fmt.Sprintf("| Warnings | %d |\n", report.Warnings))
+
+	sb.WriteString("\n## Checks\n\n")
+	sb.WriteString("| Status | Check | Message |\n")
+	sb.WriteString("|--------|-------|---------|\n")
+	for _, check := range report.Checks {
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s |\n", check.Status, check.Check, markdownCell(check.Message)))
+	}
+
+	if report.Errors+report.Warnings > 0 {
+		sb.WriteString("\n## Fixes\n\n")
+		for _, check := range report.Checks {
+			if check.Fix != "" {
+				sb.WriteString(fmt.Sprintf("- **%s** (%s): %s\n", check.Check, check.Status, check.Fix))
+			}
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+// Package pkg provides tests for the project doctor
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// findDoctorCheck returns the first result of a check with the given status
+func findDoctorCheck(report *DoctorReport, check, status string) *DoctorCheck {
+	for i := range report.Checks {
+		if report.Checks[i].Check == check && report.Checks[i].Status == status {
+			return &report.Checks[i]
+		}
+	}
+	return nil
+}
+
+func TestDoctor_EmptyDirectory(t *testing.T) {
+	common.SetTempOptions(t.TempDir(), false)
+	defer common.SetTempOptions("", false)
+
+	report := NewDoctor(t.TempDir(), DoctorProfile{Name: "tomba", FontHeights: []int{8}}).Run()
+	if findDoctorCheck(report, "fonts", DoctorError) == nil {
+		t.Errorf("missing fonts/ not reported as an error: %+v", report.Checks)
+	}
+	if check := findDoctorCheck(report, "images", DoctorWarning); check == nil || check.Fix == "" {
+		t.Errorf("missing disc image not reported with a fix: %+v", report.Checks)
+	}
+	if findDoctorCheck(report, "permissions", DoctorError) != nil {
+		t.Errorf("writable directory reported as not writable: %+v", report.Checks)
+	}
+}
+
+func TestDoctor_FontsAndFiles(t *testing.T) {
+	tempRoot := t.TempDir()
+	common.SetTempOptions(tempRoot, false)
+	defer common.SetTempOptions("", false)
+	if err := os.Mkdir(filepath.Join(tempRoot, "tombatools-1-123"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	heightDir := filepath.Join(dir, DefaultFontDir, "br", "8")
+	for _, char := range requiredFontCharacters {
+		if char == 'Q' {
+			continue
+		}
+		path := filepath.Join(heightDir, "uppercase", fmt.Sprintf("%04X.png", char))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(dir, DefaultPaletteFile), []byte("palettes:\n  - clut: 1\n    colors: [1, 2]\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	report := NewDoctor(dir, DoctorProfile{Name: "tomba", FontHeights: []int{8, 16, 24}}).Run()
+
+	var fontWarnings []string
+	for _, check := range report.Checks {
+		if check.Check == "fonts" && check.Status == DoctorWarning {
+			fontWarnings = append(fontWarnings, check.Message)
+		}
+	}
+	want := []string{"br/8 misses basic characters (1): Q", "br has no 16 px font", "br has no 24 px font"}
+	if strings.Join(fontWarnings, "|") != strings.Join(want, "|") {
+		t.Errorf("font warnings = %q, want %q", fontWarnings, want)
+	}
+	if findDoctorCheck(report, "palettes", DoctorError) == nil {
+		t.Errorf("invalid palette file not reported: %+v", report.Checks)
+	}
+	if findDoctorCheck(report, "cache", DoctorWarning) == nil {
+		t.Errorf("leftover temporary workspace not reported: %+v", report.Checks)
+	}
+	if report.Errors != 1 {
+		t.Errorf("Errors = %d, want 1", report.Errors)
+	}
+}
@@ -0,0 +1,89 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the file name templates of cd dump. By default files are extracted
+// under their ISO9660 names; a template such as "{index}_{msf}_{name}" adds the directory
+// order and disc position to every name, so a directory listing sorts by disc layout.
+package pkg
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// PreserveMSFNameTemplate is the name template of cd dump --preserve-msf-names
+const PreserveMSFNameTemplate = "{index}_{msf}_{name}"
+
+// dumpNamePlaceholderRegex matches the {placeholder} fields of a name template
+var dumpNamePlaceholderRegex = regexp.MustCompile(`\{[^{}]*\}`)
+
+// dumpNamePlaceholders formats the fields of an extracted file. The index is the entry
+// ID printed by cd dump -v; the MSF uses dashes, since colons are invalid in Windows names.
+var dumpNamePlaceholders = map[string]func(index int, file psx.CDFileEntry) string{
+	"{index}": func(index int, file psx.CDFileEntry) string { return fmt.Sprintf("%04X", index) },
+	"{msf}":   func(index int, file psx.CDFileEntry) string { return strings.ReplaceAll(file.MSF, ":", "-") },
+	"{lba}":   func(index int, file psx.CDFileEntry) string { return fmt.Sprintf("%08d", file.LBA) },
+	"{size}":  func(index int, file psx.CDFileEntry) string { return strconv.FormatUint(uint64(file.Size), 10) },
+	"{name}":  func(index int, file psx.CDFileEntry) string { return file.Name },
+}
+
+// DumpNameTemplate names extracted files from their entry fields
+type DumpNameTemplate struct {
+	template string
+}
+
+// ParseDumpNameTemplate checks a name template. Placeholders are {index}, {msf}, {lba},
+// {size} and {name}; the template must hold {index}, {lba} or {name} so that every file
+// of a directory gets its own name, and it cannot contain path separators.
+func ParseDumpNameTemplate(template string) (*DumpNameTemplate, error) {
+	invalid := func(format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid name template %q: %s", template, fmt.Sprintf(format, args...)))
+	}
+
+	if strings.ContainsAny(template, `/\`) {
+		return nil, invalid("path separators are not allowed")
+	}
+	for _, placeholder := range dumpNamePlaceholderRegex.FindAllString(template, -1) {
+		if _, known := dumpNamePlaceholders[placeholder]; !known {
+			return nil, invalid("unknown placeholder %s (use {index}, {msf}, {lba}, {size} or {name})", placeholder)
+		}
+	}
+	if !strings.Contains(template, "{index}") && !strings.Contains(template, "{lba}") && !strings.Contains(template, "{name}") {
+		return nil, invalid("{index}, {lba} or {name} is required to keep file names unique")
+	}
+	return &DumpNameTemplate{template: template}, nil
+}
+
+// Name returns the output name of the file with the given entry index
+func (t *DumpNameTemplate) Name(index int, file psx.CDFileEntry) string {
+	return dumpNamePlaceholderRegex.ReplaceAllStringFunc(t.template, func(placeholder string) string {
+		return dumpNamePlaceholders[placeholder](index, file)
+	})
+}
+
+// SetNameTemplate sets the template Dump names extracted files with (empty keeps the
+// ISO9660 names). Directories keep their names.
+func (p *CDFileProcessor) SetNameTemplate(template string) error {
+	if template == "" {
+		p.nameTemplate = nil
+		return nil
+	}
+	parsed, err := ParseDumpNameTemplate(template)
+	if err != nil {
+		return err
+	}
+	p.nameTemplate = parsed
+	return nil
+}
+
+// outputName returns the name a file with the given entry index is extracted as
+func (p *CDFileProcessor) outputName(index int, file psx.CDFileEntry) string {
+	if p.nameTemplate == nil {
+		return file.Name
+	}
+	return p.nameTemplate.Name(index, file)
+}
@@ -0,0 +1,64 @@
+// Package pkg provides tests for the cd dump file name templates
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+func TestDumpNameTemplate_Name(t *testing.T) {
+	file := psx.CDFileEntry{Name: "SLES_0025.61", LBA: 16, MSF: psx.LBAToMSF(16), Size: 2048}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{PreserveMSFNameTemplate, "0001_00-02-16_SLES_0025.61"},
+		{"{lba}-{size}-{name}", "00000016-2048-SLES_0025.61"},
+		{"{index}.bin", "0001.bin"},
+	}
+	for _, tt := range tests {
+		template, err := ParseDumpNameTemplate(tt.template)
+		if err != nil {
+			t.Fatalf("ParseDumpNameTemplate(%q) failed: %v", tt.template, err)
+		}
+		if got := template.Name(1, file); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestParseDumpNameTemplate_Invalid(t *testing.T) {
+	for _, template := range []string{"{index}/{name}", "{name}_{crc}", "{msf}_{size}"} {
+		if _, err := ParseDumpNameTemplate(template); common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("ParseDumpNameTemplate(%q) = %v, want a validation error", template, err)
+		}
+	}
+}
+
+func TestCDFileProcessor_Dump_NameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	imagePath := filepath.Join(dir, "disc.bin")
+	lbas := writeSyntheticDisc(t, imagePath, []discFile{{dir: "DATA", name: "ITEM.GAM", data: make([]byte, 100)}})
+
+	processor := NewCDProcessor()
+	if err := processor.SetNameTemplate("{lba}_{msf}_{name}"); err != nil {
+		t.Fatal(err)
+	}
+	outputDir := filepath.Join(dir, "out")
+	if err := processor.Dump(context.Background(), imagePath, outputDir); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+
+	lba := lbas["DATA/ITEM.GAM"]
+	want := processor.nameTemplate.Name(0, psx.CDFileEntry{Name: "ITEM.GAM", LBA: lba, MSF: psx.LBAToMSF(lba)})
+	if _, err := os.Stat(filepath.Join(outputDir, "DATA", want)); err != nil {
+		entries, _ := os.ReadDir(filepath.Join(outputDir, "DATA"))
+		t.Errorf("DATA/%s not extracted (%v); DATA holds %v", want, err, entries)
+	}
+}
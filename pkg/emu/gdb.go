@@ -0,0 +1,219 @@
+// Package emu provides integration with PlayStation emulators for testing patched files
+// without rebuilding the disc image. DuckStation and PCSX-Redux both expose a GDB
+// remote stub over TCP; this package implements the subset of the GDB remote serial
+// protocol needed to halt the emulated CPU, read and write main RAM and resume it.
+package emu
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout bounds every network operation with the emulator
+const DefaultTimeout = 5 * time.Second
+
+// MaxChunkSize is the number of bytes sent per memory write packet
+const MaxChunkSize = 1024
+
+// GDB remote serial protocol framing bytes
+const (
+	gdbPacketStart = '$'
+	gdbChecksumSep = '#'
+	gdbAck         = '+'
+	gdbNak         = '-'
+	gdbInterrupt   = 0x03
+)
+
+// GDBClient is a connection to the GDB stub of an emulator
+type GDBClient struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	timeout time.Duration
+}
+
+// DialGDB connects to the GDB stub listening at address (host:port)
+func DialGDB(address string, timeout time.Duration) (*GDBClient, error) {
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to GDB stub at %s: %w", address, err)
+	}
+	return &GDBClient{conn: conn, reader: bufio.NewReader(conn), timeout: timeout}, nil
+}
+
+// Close closes the connection; the emulator keeps running
+func (c *GDBClient) Close() error {
+	return c.conn.Close()
+}
+
+// Halt interrupts the emulated CPU and waits for the stop reply
+func (c *GDBClient) Halt() error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write([]byte{gdbInterrupt}); err != nil {
+		return fmt.Errorf("failed to send interrupt: %w", err)
+	}
+	reply, err := c.readPacket()
+	if err != nil {
+		return fmt.Errorf("failed to read stop reply: %w", err)
+	}
+	if !strings.HasPrefix(reply, "S") && !strings.HasPrefix(reply, "T") {
+		return fmt.Errorf("unexpected stop reply: %q", reply)
+	}
+	return nil
+}
+
+// Continue resumes the emulated CPU. The stub only replies when the CPU stops
+// again, so no reply is awaited.
+func (c *GDBClient) Continue() error {
+	if err := c.setDeadline(); err != nil {
+		return err
+	}
+	return c.sendPacket("c")
+}
+
+// WriteMemory writes data at address, split into packets of MaxChunkSize bytes
+func (c *GDBClient) WriteMemory(address uint32, data []byte) error {
+	for offset := 0; offset < len(data); offset += MaxChunkSize {
+		end := offset + MaxChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := data[offset:end]
+		chunkAddress := address + uint32(offset)
+
+		reply, err := c.command(fmt.Sprintf("M%x,%x:%s", chunkAddress, len(chunk), hex.EncodeToString(chunk)))
+		if err != nil {
+			return fmt.Errorf("failed to write memory at 0x%08X: %w", chunkAddress, err)
+		}
+		if reply != "OK" {
+			return fmt.Errorf("memory write at 0x%08X rejected: %s", chunkAddress, reply)
+		}
+	}
+	return nil
+}
+
+// ReadMemory reads length bytes at address, split into packets of MaxChunkSize bytes
+func (c *GDBClient) ReadMemory(address uint32, length int) ([]byte, error) {
+	data := make([]byte, 0, length)
+	for offset := 0; offset < length; offset += MaxChunkSize {
+		size := length - offset
+		if size > MaxChunkSize {
+			size = MaxChunkSize
+		}
+		chunkAddress := address + uint32(offset)
+
+		reply, err := c.command(fmt.Sprintf("m%x,%x", chunkAddress, size))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read memory at 0x%08X: %w", chunkAddress, err)
+		}
+		if isErrorReply(reply) {
+			return nil, fmt.Errorf("memory read at 0x%08X rejected: %s", chunkAddress, reply)
+		}
+		chunk, err := hex.DecodeString(reply)
+		if err != nil || len(chunk) != size {
+			return nil, fmt.Errorf("invalid memory read reply at 0x%08X: %q", chunkAddress, reply)
+		}
+		data = append(data, chunk...)
+	}
+	return data, nil
+}
+
+// command sends a packet and returns the reply packet
+func (c *GDBClient) command(payload string) (string, error) {
+	if err := c.setDeadline(); err != nil {
+		return "", err
+	}
+	if err := c.sendPacket(payload); err != nil {
+		return "", err
+	}
+	return c.readPacket()
+}
+
+// sendPacket frames a payload as $payload#checksum and waits for the acknowledgment,
+// retransmitting when the stub answers with a negative acknowledgment
+func (c *GDBClient) sendPacket(payload string) error {
+	packet := fmt.Sprintf("%c%s%c%02x", gdbPacketStart, payload, gdbChecksumSep, checksum(payload))
+	for attempt := 0; attempt < 3; attempt++ {
+		if _, err := c.conn.Write([]byte(packet)); err != nil {
+			return fmt.Errorf("failed to send packet: %w", err)
+		}
+		ack, err := c.reader.ReadByte()
+		if err != nil {
+			return fmt.Errorf("failed to read acknowledgment: %w", err)
+		}
+		switch ack {
+		case gdbAck:
+			return nil
+		case gdbNak:
+			continue
+		default:
+			return fmt.Errorf("unexpected acknowledgment byte 0x%02X", ack)
+		}
+	}
+	return fmt.Errorf("packet rejected by the stub after 3 attempts")
+}
+
+// readPacket reads the next packet, verifies its checksum and acknowledges it
+func (c *GDBClient) readPacket() (string, error) {
+	// Skip stray acknowledgments and noise before the packet start
+	for {
+		b, err := c.reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if b == gdbPacketStart {
+			break
+		}
+	}
+
+	payload, err := c.reader.ReadString(gdbChecksumSep)
+	if err != nil {
+		return "", err
+	}
+	payload = strings.TrimSuffix(payload, string(gdbChecksumSep))
+
+	sum := make([]byte, 2)
+	if _, err := io.ReadFull(c.reader, sum); err != nil {
+		return "", err
+	}
+
+	expected, err := hex.DecodeString(string(sum))
+	if err != nil || expected[0] != checksum(payload) {
+		if _, err := c.conn.Write([]byte{gdbNak}); err != nil {
+			return "", fmt.Errorf("failed to reject packet: %w", err)
+		}
+		return "", fmt.Errorf("bad packet checksum %q", sum)
+	}
+	if _, err := c.conn.Write([]byte{gdbAck}); err != nil {
+		return "", fmt.Errorf("failed to acknowledge packet: %w", err)
+	}
+	return payload, nil
+}
+
+// setDeadline bounds the next network operation by the client timeout
+func (c *GDBClient) setDeadline() error {
+	if c.timeout <= 0 {
+		return nil
+	}
+	return c.conn.SetDeadline(time.Now().Add(c.timeout))
+}
+
+// checksum returns the modulo 256 sum of the payload bytes
+func checksum(payload string) byte {
+	var sum byte
+	for i := 0; i < len(payload); i++ {
+		sum += payload[i]
+	}
+	return sum
+}
+
+// isErrorReply reports whether a reply is an Exx error code
+func isErrorReply(reply string) bool {
+	return len(reply) == 3 && reply[0] == 'E'
+}
@@ -0,0 +1,163 @@
+// Package emu provides tests for the GDB remote protocol client.
+package emu
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// fakeStub emulates the GDB stub of an emulator with 2 MB of RAM at 0x80000000
+type fakeStub struct {
+	listener net.Listener
+	mu       sync.Mutex
+	ram      []byte
+	halted   bool
+	resumed  bool
+}
+
+func newFakeStub(t *testing.T) *fakeStub {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	stub := &fakeStub{listener: listener, ram: make([]byte, 0x200000)}
+	go stub.serve()
+	t.Cleanup(func() { listener.Close() })
+	return stub
+}
+
+func (s *fakeStub) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeStub) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return
+		}
+		switch b {
+		case gdbInterrupt:
+			s.mu.Lock()
+			s.halted = true
+			s.mu.Unlock()
+			s.reply(conn, "S05")
+		case gdbPacketStart:
+			payload, err := reader.ReadString(gdbChecksumSep)
+			if err != nil {
+				return
+			}
+			if _, err := io.ReadFull(reader, make([]byte, 2)); err != nil {
+				return
+			}
+			// Execute before acknowledging so the test sees the state once the client returns
+			response, ok := s.execute(strings.TrimSuffix(payload, "#"))
+			if _, err := conn.Write([]byte{gdbAck}); err != nil {
+				return
+			}
+			if ok {
+				s.reply(conn, response)
+			}
+		}
+	}
+}
+
+func (s *fakeStub) execute(payload string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch payload[0] {
+	case 'c':
+		s.resumed = true
+		return "", false
+	case 'M':
+		header, data, _ := strings.Cut(payload[1:], ":")
+		offset, _ := s.offset(header)
+		bytes, err := hex.DecodeString(data)
+		if err != nil || offset < 0 {
+			return "E01", true
+		}
+		copy(s.ram[offset:], bytes)
+		return "OK", true
+	case 'm':
+		offset, length := s.offset(payload[1:])
+		if offset < 0 {
+			return "E01", true
+		}
+		return hex.EncodeToString(s.ram[offset : offset+length]), true
+	default:
+		return "", true
+	}
+}
+
+func (s *fakeStub) offset(header string) (int, int) {
+	addressText, lengthText, _ := strings.Cut(header, ",")
+	address, err := strconv.ParseUint(addressText, 16, 32)
+	length, _ := strconv.ParseUint(lengthText, 16, 32)
+	if err != nil || address < 0x80000000 || address-0x80000000+length > uint64(len(s.ram)) {
+		return -1, 0
+	}
+	return int(address - 0x80000000), int(length)
+}
+
+func (s *fakeStub) reply(conn net.Conn, payload string) {
+	fmt.Fprintf(conn, "$%s#%02x", payload, checksum(payload))
+}
+
+func TestPatchRAM(t *testing.T) {
+	stub := newFakeStub(t)
+	data := bytes.Repeat([]byte{0xDE, 0xAD, 0xBE, 0xEF, 0x01}, 500) // Spans several packets
+
+	err := PatchRAM(stub.listener.Addr().String(), 0x80010000, data, PatchOptions{Halt: true, Verify: true})
+	if err != nil {
+		t.Fatalf("PatchRAM() failed: %v", err)
+	}
+
+	stub.mu.Lock()
+	defer stub.mu.Unlock()
+	if !bytes.Equal(stub.ram[0x10000:0x10000+len(data)], data) {
+		t.Error("RAM does not contain the patched data")
+	}
+	if !stub.halted || !stub.resumed {
+		t.Errorf("halted = %v, resumed = %v, want both true", stub.halted, stub.resumed)
+	}
+}
+
+func TestPatchRAM_InvalidRange(t *testing.T) {
+	err := PatchRAM("127.0.0.1:1", 0x801FFFFF, []byte{1, 2}, PatchOptions{})
+	if common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("ExitCodeFor() = %d, want %d (%v)", common.ExitCodeFor(err), common.ExitValidationFailed, err)
+	}
+}
+
+func TestGDBClient_ReadMemoryError(t *testing.T) {
+	stub := newFakeStub(t)
+	client, err := DialGDB(stub.listener.Addr().String(), DefaultTimeout)
+	if err != nil {
+		t.Fatalf("DialGDB() failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.ReadMemory(0x1F800000, 4); err == nil {
+		t.Error("ReadMemory() succeeded outside RAM, want error reply")
+	}
+}
@@ -0,0 +1,73 @@
+// Package emu provides integration with PlayStation emulators for testing patched files
+// without rebuilding the disc image.
+// This file contains the RAM patching entry point used by the emu command.
+package emu
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// PatchOptions controls how main RAM is patched
+type PatchOptions struct {
+	Halt    bool          // Halt the CPU during the write and resume it afterwards
+	Verify  bool          // Read the range back and compare it with the written data
+	Timeout time.Duration // Network timeout per operation (0 uses DefaultTimeout)
+}
+
+// PatchRAM writes data to main RAM at address through the GDB stub listening at target
+func PatchRAM(target string, address uint32, data []byte, options PatchOptions) error {
+	if len(data) == 0 {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("nothing to write"))
+	}
+	if err := psx.ValidateRAMRange(address, len(data)); err != nil {
+		return common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	timeout := options.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	client, err := DialGDB(target, timeout)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if options.Halt {
+		common.LogDebug("Halting emulated CPU")
+		if err := client.Halt(); err != nil {
+			return fmt.Errorf("failed to halt emulator: %w", err)
+		}
+	}
+
+	common.LogInfo("Writing %d bytes to RAM at 0x%08X", len(data), address)
+	if err := client.WriteMemory(address, data); err != nil {
+		return err
+	}
+
+	if options.Verify {
+		written, err := client.ReadMemory(address, len(data))
+		if err != nil {
+			return fmt.Errorf("failed to read back patched RAM: %w", err)
+		}
+		if !bytes.Equal(written, data) {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("RAM at 0x%08X does not match the written data", address))
+		}
+		common.LogDebug("Verified %d bytes at 0x%08X", len(data), address)
+	}
+
+	if options.Halt {
+		common.LogDebug("Resuming emulated CPU")
+		if err := client.Continue(); err != nil {
+			return fmt.Errorf("failed to resume emulator: %w", err)
+		}
+	}
+
+	return nil
+}
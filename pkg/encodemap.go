@@ -0,0 +1,100 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the encode map: a companion file written next to an encoded WFM that
+// lists the character behind every assigned glyph encode value, for tools that patch text
+// referencing the same encode values (e.g. EXE strings) and for debugging garbled text.
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path/filepath"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultEncodeMapFile is the conventional name of the encode map
+const DefaultEncodeMapFile = "encode_map.yaml"
+
+// EncodeMapEntry describes the glyph assigned to an encode value
+type EncodeMapEntry struct {
+	Value       string `yaml:"value"`                 // Encode value as written in dialogues (e.g. 0x8000)
+	Character   string `yaml:"character,omitempty"`   // Character drawn by the glyph (empty if unknown)
+	Codepoint   string `yaml:"codepoint,omitempty"`   // Unicode code point of the character (e.g. U+0041)
+	Height      int    `yaml:"height"`                // Glyph height in pixels
+	Width       int    `yaml:"width"`                 // Glyph width in pixels
+	Clut        string `yaml:"clut"`                  // CLUT the glyph is drawn with
+	GlyphSHA256 string `yaml:"glyph_sha256"`          // Hash of the encoded 4bpp glyph data
+	Source      string `yaml:"source,omitempty"`      // PNG file or donor glyph the glyph was taken from
+	Placeholder bool   `yaml:"placeholder,omitempty"` // Empty slot kept so later encode values do not shift
+}
+
+// EncodeMap lists the encode values of an encoded WFM file
+type EncodeMap struct {
+	File   string           `yaml:"file"`
+	Glyphs []EncodeMapEntry `yaml:"glyphs"`
+}
+
+// SetEncodeMap makes Encode write the encode map to path after the WFM file (empty disables)
+func (e *WFMFileEncoder) SetEncodeMap(path string) {
+	e.encodeMapFile = path
+}
+
+// buildEncodeMap describes every glyph of the encode order
+func (e *WFMFileEncoder) buildEncodeMap(outputFile string, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16) *EncodeMap {
+	encodeMap := &EncodeMap{File: filepath.Base(outputFile), Glyphs: make([]EncodeMapEntry, 0, len(encodeOrder))}
+	for _, encodeValue := range encodeOrder {
+		info := encodeValueMap[encodeValue]
+		sum := sha256.Sum256(info.Glyph.GlyphImage)
+		entry := EncodeMapEntry{
+			Value:       fmt.Sprintf("0x%04X", encodeValue),
+			Height:      int(info.Glyph.GlyphHeight),
+			Width:       int(info.Glyph.GlyphWidth),
+			Clut:        fmt.Sprintf("0x%04X", info.Glyph.GlyphClut),
+			GlyphSHA256: hex.EncodeToString(sum[:]),
+			Placeholder: info.Glyph.IsPlaceholder(),
+		}
+		if info.Character != 0 {
+			entry.Character = string(info.Character)
+			entry.Codepoint = fmt.Sprintf("U+%04X", info.Character)
+		}
+		entry.Source = e.glyphSource(encodeValue, info)
+		encodeMap.Glyphs = append(encodeMap.Glyphs, entry)
+	}
+	return encodeMap
+}
+
+// glyphSource returns where the glyph of an encode value was taken from
+func (e *WFMFileEncoder) glyphSource(encodeValue uint16, info GlyphEncodeInfo) string {
+	if info.Glyph.IsPlaceholder() {
+		return ""
+	}
+	if e.donor != nil {
+		return fmt.Sprintf("%s#%d", e.donorFile, int(encodeValue)-GLYPH_ID_BASE)
+	}
+	if info.Character == 0 {
+		return ""
+	}
+	path, err := e.getGlyphPath(info.Character, info.FontHeight)
+	if err != nil {
+		return ""
+	}
+	return filepath.ToSlash(path)
+}
+
+// WriteEncodeMap writes an encode map to a YAML file
+func WriteEncodeMap(path string, encodeMap *EncodeMap) error {
+	writer, err := common.CreateOutput(path)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create encode map: %w", err))
+	}
+	defer writer.Close()
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(encodeMap); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode encode map: %w", err))
+	}
+	return nil
+}
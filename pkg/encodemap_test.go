@@ -0,0 +1,71 @@
+// Package pkg provides tests for the encode map written next to encoded WFM files
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+func TestWFMFileEncoder_Encode_EncodeMap(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{
+		TotalDialogues: 2,
+		Dialogues: []DialogueEntry{
+			{ID: 0, Type: "dialogue", FontHeight: 8, FontClut: 0x1234, Terminator: 2, Content: []map[string]interface{}{{"text": "AB"}}},
+			{ID: 1, Type: "dialogue", FontHeight: 8, FontClut: 0x1234, Terminator: 2, Content: []map[string]interface{}{{"text": "BA"}}},
+		},
+	}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(donorFile); err != nil {
+		t.Fatalf("SetGlyphDonor() failed: %v", err)
+	}
+	mapFile := filepath.Join(dir, DefaultEncodeMapFile)
+	encoder.SetEncodeMap(mapFile)
+	if err := encoder.Encode(context.Background(), yamlFile, filepath.Join(dir, "OUT.WFM")); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(mapFile)
+	if err != nil {
+		t.Fatalf("failed to read encode map: %v", err)
+	}
+	var encodeMap EncodeMap
+	if err := yaml.Unmarshal(data, &encodeMap); err != nil {
+		t.Fatalf("failed to parse encode map: %v", err)
+	}
+
+	if encodeMap.File != "OUT.WFM" || len(encodeMap.Glyphs) != 2 {
+		t.Fatalf("encode map = %+v, want 2 glyphs of OUT.WFM", encodeMap)
+	}
+	tests := []struct {
+		value, character, codepoint, source string
+	}{
+		{"0x8000", "A", "U+0041", donorFile + "#0"},
+		{"0x8001", "B", "U+0042", donorFile + "#1"},
+	}
+	for i, tt := range tests {
+		entry := encodeMap.Glyphs[i]
+		if entry.Value != tt.value || entry.Character != tt.character || entry.Codepoint != tt.codepoint || entry.Source != tt.source {
+			t.Errorf("Glyphs[%d] = %+v, want %s → %s (%s) from %s", i, entry, tt.value, tt.character, tt.codepoint, tt.source)
+		}
+		if entry.Height != 8 || entry.Width != 8 || entry.Clut != "0x1234" || len(entry.GlyphSHA256) != 64 {
+			t.Errorf("Glyphs[%d] = %+v, want an 8x8 glyph with CLUT 0x1234 and a SHA-256 hash", i, entry)
+		}
+	}
+	if encodeMap.Glyphs[0].GlyphSHA256 == encodeMap.Glyphs[1].GlyphSHA256 {
+		t.Error("different glyphs have the same hash")
+	}
+}
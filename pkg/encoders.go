@@ -3,7 +3,9 @@
 package pkg
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"image"
 	"image/png"
@@ -11,18 +13,47 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"github.com/hansbonini/tombatools/pkg/gam"
 	"github.com/hansbonini/tombatools/pkg/psx"
-	"gopkg.in/yaml.v3"
+	"github.com/hansbonini/tombatools/pkg/wfm"
 )
 
 // WFMFileEncoder implements the WFMEncoder interface and provides
 // functionality to encode YAML dialogue data back into WFM file format.
 type WFMFileEncoder struct {
-	originalSize int64 // Store original file size for proper padding
+	originalSize      int64                     // Store original file size for proper padding
+	placeholderGlyphs map[int]bool              // Glyph slots that must be kept as empty placeholders
+	alignment         int64                     // Final file size is rounded up to a multiple of this value (0 disables)
+	padByte           byte                      // Byte value used for final padding
+	alphaOptions      psx.AlphaOptions          // Glyph PNG transparency preprocessing
+	warnPartialAlpha  bool                      // Log glyph PNGs containing semi-transparent pixels
+	donor             *WFMFile                  // WFM whose glyph table replaces the fonts/ PNG tree (nil uses PNGs)
+	unmappedLog       string                    // Dictionary file unmapped codes are recorded in (empty disables)
+	palettes          *PaletteSet               // Project palettes used instead of the built-in CLUTs (nil uses the built-ins)
+	fontCluts         map[uint16]string         // GlyphClut values of the game profile, by palette name (nil checks project palettes only)
+	toolVersion       string                    // Version recorded in the provenance trailer (empty disables the trailer)
+	provenance        *Provenance               // Provenance trailer written into the final padding (nil writes none)
+	donorFile         string                    // Path of the glyph donor WFM (recorded in the encode map)
+	encodeMapFile     string                    // Encode map written after the WFM file (empty disables)
+	widthReportFile   string                    // Glyph width report written after the WFM file (empty disables)
+	originalDialogues int                       // Dialogue count of the decoded file (total_dialogues)
+	referenceExe      string                    // Executable scanned for hardcoded dialogue indices
+	referenceProfile  *DialogueReferenceProfile // Locations of the dialogue indices (nil disables the check)
+	doubleNewline     string                    // DOUBLE_NEWLINE mode (empty uses the mode recorded in the YAML file)
+	pageBreaks        bool                      // "\n\n" encodes as two NEWLINE codes, [PAGE] as DOUBLE_NEWLINE
+
+	glyphWidthLimits    GlyphWidthLimits        // Widest glyph the game draws per font height (nil disables the check)
+	originalGlyphWidths map[int]map[string]int  // Character widths of the original font (glyph_widths of the YAML file)
+	baselineReference   *GlyphBaselineReference // Ink bounds of the original font glyph rows are aligned to (nil disables)
+	baselineOverrides   *GlyphBaselineOverrides // Per-character baseline shifts (nil applies none)
+	logger              *common.Logger          // Logging configuration (nil follows SetVerboseMode)
 }
 
 // GlyphEncodeInfo holds information about a glyph and its assigned encode value.
@@ -50,13 +81,67 @@ type RecodedDialogue struct {
 //   - outputFile: Path where the encoded WFM file will be written
 //
 // Returns an error if the encoding process fails.
-func (e *WFMFileEncoder) Encode(yamlFile, outputFile string) error {
+func (e *WFMFileEncoder) Encode(ctx context.Context, yamlFile, outputFile string) error {
+	return e.encode(ctx, yamlFile, outputFile, nil)
+}
+
+// EncodeBytes creates a WFM file like Encode and returns its contents instead of
+// writing it. name is the file name used by reference checks and companion files.
+func (e *WFMFileEncoder) EncodeBytes(ctx context.Context, yamlFile, name string) ([]byte, error) {
+	output := &memoryFile{}
+	if err := e.encode(ctx, yamlFile, name, output); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// encode runs the encoding pipeline, writing the WFM file to memory when given and to
+// outputFile otherwise
+func (e *WFMFileEncoder) encode(ctx context.Context, yamlFile, outputFile string, memory *memoryFile) error {
 	// Load dialogues from YAML file
 	dialogues, reservedData, err := e.LoadDialogues(yamlFile)
 	if err != nil {
 		return common.FormatError(common.ErrFailedToLoadDialogues, err)
 	}
 
+	// Warn about executable references to dialogues that were removed or renumbered
+	if e.referenceProfile != nil {
+		if err := e.checkReferences(outputFile, dialogues); err != nil {
+			return err
+		}
+	}
+
+	// Record which source and build produced the output, if requested
+	if e.toolVersion != "" {
+		if e.provenance, err = NewProvenance(e.toolVersion, yamlFile); err != nil {
+			return err
+		}
+	}
+
+	// Use the palettes discovered for this project, if any
+	if e.palettes == nil {
+		palettes, err := LoadProjectPalettes(filepath.Dir(yamlFile))
+		if err != nil {
+			return err
+		}
+		e.palettes = palettes
+	}
+
+	// Glyphs drawn with a CLUT the game has no palette for show up as black boxes;
+	// donor glyphs keep the CLUTs of the donor
+	if e.donor == nil {
+		if err := e.checkFontCluts(dialogues); err != nil {
+			return err
+		}
+	}
+
+	// Record unmapped codes in the project dictionary before they are dropped
+	if e.unmappedLog != "" {
+		if err := RecordUnmappedCodes(e.unmappedLog, filepath.Base(outputFile), dialogues); err != nil {
+			return fmt.Errorf("failed to record unmapped codes: %w", err)
+		}
+	}
+
 	// Process characters and build mappings
 	glyphEncodeMap, encodeValueMap, encodeOrder, err := e.processCharactersAndBuildMappings(dialogues)
 	if err != nil {
@@ -70,8 +155,29 @@ func (e *WFMFileEncoder) Encode(yamlFile, outputFile string) error {
 	}
 
 	// Write the WFM file
-	if err := e.writeWFMFile(wfmFile, outputFile); err != nil {
-		return common.FormatError(common.ErrFailedToWriteWFM, err)
+	if memory != nil {
+		err = e.writeWFM(ctx, memory, wfmFile)
+	} else {
+		err = e.writeWFMFile(ctx, wfmFile, outputFile)
+	}
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, common.FormatError(common.ErrFailedToWriteWFM, err))
+	}
+
+	// Write the companion encode map, if requested
+	if e.encodeMapFile != "" {
+		if err := WriteEncodeMap(e.encodeMapFile, e.buildEncodeMap(outputFile, encodeValueMap, encodeOrder)); err != nil {
+			return err
+		}
+		common.LogInfo("Encode map written to %s", e.encodeMapFile)
+	}
+
+	// Compare the new glyph widths with the original font, if requested
+	if e.widthReportFile != "" {
+		if err := e.writeWidthReport(outputFile, dialogues, encodeValueMap); err != nil {
+			return err
+		}
+		common.LogInfo("Glyph width report written to %s", e.widthReportFile)
 	}
 
 	e.logFinalResults(outputFile, wfmFile)
@@ -84,12 +190,26 @@ func (e *WFMFileEncoder) processCharactersAndBuildMappings(dialogues []DialogueE
 	uniqueChars, unmappedBytes := e.collectUniqueCharacters(dialogues)
 	e.logCharacterAnalysis(uniqueChars, unmappedBytes)
 
+	// Take the glyph table from the donor WFM when one is configured
+	if e.donor != nil {
+		return e.mapDonorGlyphs(dialogues)
+	}
+
 	// Step 2: Map glyphs by dialogue considering font_height
 	glyphMap, err := e.mapGlyphsByDialogue(dialogues)
 	if err != nil {
 		return nil, nil, nil, common.FormatError(common.ErrFailedToMapGlyphs, err)
 	}
 
+	// Move the glyph rows onto the baselines of the original font, if requested
+	if e.baselineReference != nil || e.baselineOverrides != nil {
+		report := BuildGlyphBaselineReport(glyphMap, e.baselineReference, e.baselineOverrides)
+		applyGlyphBaselines(glyphMap, report)
+		for _, height := range report.Heights {
+			common.LogInfo("Font height %d: %d of %d glyphs moved to the original baseline", height.Height, height.Shifted, height.Glyphs)
+		}
+	}
+
 	// Step 3: Assign encode values for each mapped glyph
 	glyphEncodeMap, encodeValueMap, encodeOrder := e.assignEncodeValues(glyphMap)
 	e.logGlyphMapping(glyphMap, encodeValueMap, encodeOrder)
@@ -123,7 +243,7 @@ func (e *WFMFileEncoder) logCharacterAnalysis(uniqueChars []rune, unmappedBytes
 
 	// Display characters in sorted order
 	for i, char := range uniqueChars {
-		common.LogDebug(common.DebugCharacterFound, i, char, char)
+		e.logger.Debug(common.DebugCharacterFound, i, char, char)
 	}
 
 	// Display unmapped bytes found
@@ -131,7 +251,7 @@ func (e *WFMFileEncoder) logCharacterAnalysis(uniqueChars []rune, unmappedBytes
 		common.LogInfo("\n%s:", common.InfoUnmappedBytesFound)
 		common.LogInfo("%s: %d", common.InfoTotalUnmappedBytes, len(unmappedBytes))
 		for i, unmappedByte := range unmappedBytes {
-			common.LogDebug(common.DebugUnmappedByte, i, unmappedByte)
+			e.logger.Debug(common.DebugUnmappedByte, i, unmappedByte)
 		}
 		common.LogInfo("\n%s", common.InfoNoteUnmappedBytes)
 	}
@@ -141,7 +261,7 @@ func (e *WFMFileEncoder) logCharacterAnalysis(uniqueChars []rune, unmappedBytes
 func (e *WFMFileEncoder) logGlyphMapping(glyphMap map[int]map[rune]Glyph, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16) {
 	common.LogInfo("\n%s:", common.InfoGlyphMappingByHeight)
 	for fontHeight, glyphs := range glyphMap {
-		common.LogDebug(common.DebugFontHeightGlyphs, fontHeight, len(glyphs))
+		e.logger.Debug(common.DebugFontHeightGlyphs, fontHeight, len(glyphs))
 	}
 
 	encodeMapSize, err := common.SafeIntToUint16(len(encodeValueMap))
@@ -154,7 +274,7 @@ func (e *WFMFileEncoder) logGlyphMapping(glyphMap map[int]map[rune]Glyph, encode
 	// Display in the order they were added
 	for _, encodeValue := range encodeOrder {
 		glyphInfo := encodeValueMap[encodeValue]
-		common.LogDebug(common.DebugEncodeValue, encodeValue, glyphInfo.Character, glyphInfo.Character, glyphInfo.FontHeight)
+		e.logger.Debug(common.DebugEncodeValue, encodeValue, glyphInfo.Character, glyphInfo.Character, glyphInfo.FontHeight)
 	}
 }
 
@@ -163,13 +283,13 @@ func (e *WFMFileEncoder) logRecodingResults(recodedDialogues []RecodedDialogue)
 	common.LogInfo("\n%s:", common.InfoRecodedTexts)
 	for i, dialogue := range recodedDialogues {
 		if i < 5 { // Show only the first 5 with more detail
-			common.LogDebug(common.DebugDialogueEncoded, dialogue.ID, dialogue.OriginalText)
-			common.LogDebug(common.DebugEncodedText, e.formatEncodedText(dialogue.EncodedText))
-			common.LogDebug(common.DebugEncodedLength, len(dialogue.EncodedText)*2) // each uint16 = 2 bytes
+			e.logger.Debug(common.DebugDialogueEncoded, dialogue.ID, dialogue.OriginalText)
+			e.logger.Debug(common.DebugEncodedText, e.formatEncodedText(dialogue.EncodedText))
+			e.logger.Debug(common.DebugEncodedLength, len(dialogue.EncodedText)*2) // each uint16 = 2 bytes
 		}
 	}
 	if len(recodedDialogues) > 5 {
-		common.LogDebug(common.DebugMoreDialogues, len(recodedDialogues)-5)
+		e.logger.Debug(common.DebugMoreDialogues, len(recodedDialogues)-5)
 	}
 
 	common.LogInfo("\n%s:", common.InfoRecodingStatistics)
@@ -185,7 +305,7 @@ func (e *WFMFileEncoder) logRecodingResults(recodedDialogues []RecodedDialogue)
 // logFinalResults logs final encoding results
 func (e *WFMFileEncoder) logFinalResults(outputFile string, wfmFile *WFMFile) {
 	common.LogInfo("\n%s: %s", common.InfoWFMFileCreated, outputFile)
-	common.LogDebug(common.DebugHeaderInfo,
+	e.logger.Debug(common.DebugHeaderInfo,
 		string(wfmFile.Header.Magic[:]), wfmFile.Header.TotalDialogues, wfmFile.Header.TotalGlyphs)
 }
 
@@ -196,14 +316,54 @@ func (e *WFMFileEncoder) LoadDialogues(yamlFile string) ([]DialogueEntry, []byte
 		return nil, nil, common.FormatError(common.ErrFailedToReadYAMLFile, err)
 	}
 
-	var yamlData struct {
-		TotalDialogues int             `yaml:"total_dialogues"`
-		OriginalSize   int64           `yaml:"original_size"`
-		Dialogues      []DialogueEntry `yaml:"dialogues"`
+	yamlData, err := dialogueyaml.Parse(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	e.placeholderGlyphs = make(map[int]bool, len(yamlData.PlaceholderGlyphs))
+	for _, glyphIndex := range yamlData.PlaceholderGlyphs {
+		if glyphIndex < 0 || glyphIndex > 0xFFF0-GLYPH_ID_BASE {
+			return nil, nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid placeholder glyph index %d", glyphIndex))
+		}
+		e.placeholderGlyphs[glyphIndex] = true
 	}
 
-	if err := yaml.Unmarshal(data, &yamlData); err != nil {
-		return nil, nil, common.FormatError(common.ErrFailedToParseYAML, err)
+	// The mode given on the command line wins over the one the file was decoded with
+	doubleNewline := e.doubleNewline
+	if doubleNewline == "" {
+		doubleNewline = yamlData.DoubleNewline
+	}
+	if err := ValidateDoubleNewlineMode(doubleNewline); err != nil {
+		return nil, nil, err
+	}
+	e.pageBreaks = doubleNewline == DoubleNewlineAsPage
+
+	// New dialogues sort before every decoded one until wfm remap gives them a slot, and
+	// merge conflicts hold a translation that may no longer match the text
+	for _, dialogue := range yamlData.Dialogues {
+		if dialogue.ID < 0 {
+			return nil, nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("dialogue %q has no slot (ID %d): run wfm remap first", dialogue.Name, dialogue.ID))
+		}
+		if dialogue.Conflict != nil {
+			return nil, nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("dialogue %d has an unresolved merge conflict: update its content and delete the conflict entry", dialogue.ID))
+		}
+	}
+
+	// Duplicate, out-of-range and missing IDs would move dialogues to other pointer slots
+	lines := dialogueIDLines(data, len(yamlData.Dialogues))
+	gaps, err := ValidateDialogueIDs(yamlFile, yamlData.Dialogues, yamlData.TotalDialogues, lines)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, gap := range gaps {
+		if gap.Line > 0 {
+			common.LogWarn("%s line %d: %s", yamlFile, gap.Line, gap)
+		} else {
+			common.LogWarn("%s: %s", yamlFile, gap)
+		}
 	}
 
 	// Build reserved data based on special dialogues
@@ -211,6 +371,8 @@ func (e *WFMFileEncoder) LoadDialogues(yamlFile string) ([]DialogueEntry, []byte
 
 	// Store original size for later use in padding
 	e.originalSize = yamlData.OriginalSize
+	e.originalDialogues = yamlData.TotalDialogues
+	e.originalGlyphWidths = yamlData.GlyphWidths
 
 	return yamlData.Dialogues, reservedData, nil
 }
@@ -276,10 +438,7 @@ func (e *WFMFileEncoder) collectUniqueCharacters(dialogues []DialogueEntry) (uni
 	unmappedByteRegex := regexp.MustCompile(`\[[0-9A-F]{4}\]`)
 
 	// List of known special tags that should be removed
-	specialTags := []string{
-		"[FFF2]", "[HALT]", "[F4]", "[PROMPT]", "[F6]", "[CHANGE COLOR TO]",
-		"[INIT TAIL]", "[PAUSE FOR]", "[WAIT FOR INPUT]", "[INIT TEXT BOX]",
-	}
+	specialTags := append([]string{PageBreakTag}, controlCodeTags...)
 
 	for _, dialogue := range dialogues {
 		// Process content items to extract text
@@ -298,7 +457,8 @@ func (e *WFMFileEncoder) collectUniqueCharacters(dialogues []DialogueEntry) (uni
 						unmappedSet[match] = true
 					}
 
-					cleanText := originalText
+					// Remove tags with inline args such as [PAUSE FOR 30]
+					cleanText := argumentTagRegex.ReplaceAllString(originalText, "")
 
 					// Remove tags especiais conhecidas
 					for _, tag := range specialTags {
@@ -312,7 +472,7 @@ func (e *WFMFileEncoder) collectUniqueCharacters(dialogues []DialogueEntry) (uni
 					cleanText = strings.ReplaceAll(cleanText, "\n", "")
 
 					// Now count only the actual characters that need mapping
-					for _, char := range cleanText {
+					for _, char := range stripZeroWidth(cleanText) {
 						charSet[char] = true
 					}
 				}
@@ -388,6 +548,10 @@ func (e *WFMFileEncoder) processTextForGlyphMapping(textStr string, fontHeight i
 
 	// Process each character
 	for _, char := range cleanText {
+		// Control code symbols and ignored markers draw no glyph
+		if needsNoGlyph(char) {
+			continue
+		}
 		// Check if the character has already been mapped for this font height
 		if _, exists := globalGlyphCache[fontHeight][char]; !exists {
 			if err := e.tryLoadGlyph(char, fontHeight, fontClut, globalGlyphCache); err != nil {
@@ -405,12 +569,10 @@ func (e *WFMFileEncoder) cleanTextForGlyphMapping(textStr string) string {
 	unmappedByteRegex := regexp.MustCompile(`\[[0-9A-F]{4}\]`)
 
 	// List of known special tags that should be removed
-	specialTags := []string{
-		"[FFF2]", "[HALT]", "[F4]", "[PROMPT]", "[F6]", "[CHANGE COLOR TO]",
-		"[INIT TAIL]", "[PAUSE FOR]", "[WAIT FOR INPUT]", "[INIT TEXT BOX]",
-	}
+	specialTags := append([]string{PageBreakTag}, controlCodeTags...)
 
-	cleanText := textStr
+	// Remove tags with inline args such as [PAUSE FOR 30]
+	cleanText := argumentTagRegex.ReplaceAllString(textStr, "")
 
 	// Remove known special tags
 	for _, tag := range specialTags {
@@ -430,19 +592,18 @@ func (e *WFMFileEncoder) cleanTextForGlyphMapping(textStr string) string {
 func (e *WFMFileEncoder) tryLoadGlyph(char rune, fontHeight int, fontClut uint16, globalGlyphCache map[int]map[rune]Glyph) error {
 	// Try to load the glyph
 	glyph, err := e.loadSingleGlyph(char, fontHeight, fontClut)
+	if errors.Is(err, errGlyphTooWide) {
+		// The game would draw it over its neighbours, so this is not worth a warning only
+		return err
+	}
 	if err != nil {
-		// Check if this is an ignored character
-		if char == '⧗' {
-			// Silently skip ignored characters
-			return nil
-		}
 		common.LogWarn("%s '%c' (U+%04X) at font height %d: %v", common.WarnCouldNotLoadGlyph, char, char, fontHeight, err)
 		return nil
 	}
 
 	// Store in global cache
 	globalGlyphCache[fontHeight][char] = glyph
-	common.LogDebug(common.DebugGlyphLoaded, common.InfoGlyphLoaded, char, char, fontHeight)
+	e.logger.Debug(common.DebugGlyphLoaded, common.InfoGlyphLoaded, char, char, fontHeight)
 	return nil
 }
 
@@ -491,6 +652,9 @@ func (e *WFMFileEncoder) assignEncodeValues(glyphMap map[int]map[rune]Glyph) (gl
 
 	// Assign sequential values for each unique char + fontHeight combination
 	for _, key := range allGlyphKeys {
+		// Skip over slots reserved for placeholder glyphs
+		currentEncodeValue, encodeOrder = e.reservePlaceholderSlots(currentEncodeValue, encodeValueMap, encodeOrder)
+
 		fontHeight := key.fontHeight
 		char := key.char
 		glyph := glyphMap[fontHeight][char]
@@ -517,9 +681,47 @@ func (e *WFMFileEncoder) assignEncodeValues(glyphMap map[int]map[rune]Glyph) (gl
 		currentEncodeValue++
 	}
 
+	// Keep placeholder slots located after the last mapped glyph
+	encodeOrder = e.reserveTrailingPlaceholders(currentEncodeValue, encodeValueMap, encodeOrder)
+
 	return glyphEncodeMap, encodeValueMap, encodeOrder
 }
 
+// reservePlaceholderSlots inserts placeholder glyphs while the current encode value
+// points to a reserved placeholder slot and returns the next free encode value
+func (e *WFMFileEncoder) reservePlaceholderSlots(currentEncodeValue uint16, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16) (nextEncodeValue uint16, order []uint16) {
+	for e.placeholderGlyphs[int(currentEncodeValue-GLYPH_ID_BASE)] {
+		encodeValueMap[currentEncodeValue] = GlyphEncodeInfo{Glyph: NewPlaceholderGlyph()}
+		encodeOrder = append(encodeOrder, currentEncodeValue)
+		currentEncodeValue++
+	}
+	return currentEncodeValue, encodeOrder
+}
+
+// reserveTrailingPlaceholders fills the glyph table with placeholders up to the
+// highest reserved placeholder index so that its position is preserved
+func (e *WFMFileEncoder) reserveTrailingPlaceholders(currentEncodeValue uint16, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16) []uint16 {
+	lastPlaceholder := -1
+	for glyphIndex := range e.placeholderGlyphs {
+		if glyphIndex > lastPlaceholder {
+			lastPlaceholder = glyphIndex
+		}
+	}
+
+	reserved := 0
+	for int(currentEncodeValue-GLYPH_ID_BASE) <= lastPlaceholder {
+		encodeValueMap[currentEncodeValue] = GlyphEncodeInfo{Glyph: NewPlaceholderGlyph()}
+		encodeOrder = append(encodeOrder, currentEncodeValue)
+		currentEncodeValue++
+		reserved++
+	}
+
+	if len(e.placeholderGlyphs) > 0 {
+		common.LogInfo("%s: %d (%d trailing)", common.InfoPlaceholderGlyphsKept, len(e.placeholderGlyphs), reserved)
+	}
+	return encodeOrder
+}
+
 // recodeDialogueTexts recodes dialogue content using the glyph encode mapping and handles content structure
 func (e *WFMFileEncoder) recodeDialogueTexts(dialogues []DialogueEntry, glyphEncodeMap map[int]map[rune]uint16) ([]RecodedDialogue, error) {
 	recodedDialogues := make([]RecodedDialogue, 0, len(dialogues))
@@ -537,6 +739,13 @@ func (e *WFMFileEncoder) recodeDialogueTexts(dialogues []DialogueEntry, glyphEnc
 
 // recodeDialogue recodes a single dialogue entry
 func (e *WFMFileEncoder) recodeDialogue(dialogue DialogueEntry, glyphEncodeMap map[int]map[rune]uint16) (RecodedDialogue, error) {
+	if dialogue.Raw != "" {
+		return e.recodeRawDialogue(dialogue)
+	}
+	if err := ValidateTerminator(dialogue); err != nil {
+		return RecodedDialogue{}, err
+	}
+
 	fontHeight := dialogue.FontHeight
 
 	// Check if we have mapping for this font height
@@ -553,15 +762,14 @@ func (e *WFMFileEncoder) recodeDialogue(dialogue DialogueEntry, glyphEncodeMap m
 	for _, contentItem := range dialogue.Content {
 		contentEncoded, originalText, err := e.processContentItem(contentItem, fontHeight, glyphEncodeMap, dialogue.ID)
 		if err != nil {
-			return RecodedDialogue{}, err
+			return RecodedDialogue{}, fmt.Errorf("dialogue %d: %w", dialogue.ID, err)
 		}
 		encodedText = append(encodedText, contentEncoded...)
 		fullOriginalText.WriteString(originalText)
 	}
 
 	// Add termination marker
-	terminatorHex := e.getTerminatorHex(dialogue.Terminator)
-	encodedText = append(encodedText, terminatorHex)
+	encodedText = append(encodedText, dialogue.Terminator.Code())
 
 	safeFontHeight, err := common.SafeIntToUint16(dialogue.FontHeight)
 	if err != nil {
@@ -581,40 +789,12 @@ func (e *WFMFileEncoder) recodeDialogue(dialogue DialogueEntry, glyphEncodeMap m
 
 // processContentItem processes a single content item and returns encoded text and original text
 func (e *WFMFileEncoder) processContentItem(contentItem map[string]interface{}, fontHeight int, glyphEncodeMap map[int]map[rune]uint16, dialogueID int) (encodedText []uint16, originalText string, err error) {
-	// Handle box content
-	if boxValue, exists := contentItem["box"]; exists {
-		encodedText, originalText, err = e.processBoxContent(boxValue)
-		return
-	}
-
-	// Handle tail content
-	if tailValue, exists := contentItem["tail"]; exists {
-		encodedText, originalText, err = e.processTailContent(tailValue)
-		return
-	}
-
-	// Handle f6 content
-	if f6Value, exists := contentItem["f6"]; exists {
-		encodedText, originalText, err = e.processF6Content(f6Value)
-		return
-	}
-
-	// Handle color content
-	if colorValue, exists := contentItem["color"]; exists {
-		encodedText, originalText, err = e.processColorContent(colorValue)
-		return
-	}
-
-	// Handle pause content
-	if pauseValue, exists := contentItem["pause"]; exists {
-		encodedText, originalText, err = e.processPauseContent(pauseValue)
-		return
-	}
-
-	// Handle fff2 content
-	if fff2Value, exists := contentItem["fff2"]; exists {
-		encodedText, originalText, err = e.processFff2Content(fff2Value)
-		return
+	// Handle structured control codes (box, tail, f6, color, pause, fff2)
+	for _, code := range controlCodeTable {
+		if value, exists := contentItem[code.Content]; exists && code.Content != "" {
+			encodedText, err = e.processControlContent(code, value, dialogueID)
+			return encodedText, "", err
+		}
 	}
 
 	// Handle text content
@@ -626,166 +806,57 @@ func (e *WFMFileEncoder) processContentItem(contentItem map[string]interface{},
 	return nil, "", nil
 }
 
-// processBoxContent handles box content items
-func (e *WFMFileEncoder) processBoxContent(boxValue interface{}) (encodedText []uint16, originalText string, err error) {
-	boxMap, ok := boxValue.(map[string]interface{})
-	if !ok {
-		return nil, "", nil
-	}
-
-	encodedText = append(encodedText, INIT_TEXT_BOX)
-
-	if width, hasWidth := boxMap["width"]; hasWidth {
-		if w, ok := width.(int); ok {
-			safeWidth, err := common.SafeIntToUint16(w)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid width value %d: %w", w, err)
-			}
-			encodedText = append(encodedText, safeWidth)
-		}
-	}
-
-	if height, hasHeight := boxMap["height"]; hasHeight {
-		if h, ok := height.(int); ok {
-			safeHeight, err := common.SafeIntToUint16(h)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid height value %d: %w", h, err)
-			}
-			encodedText = append(encodedText, safeHeight)
-		}
-	}
-
-	return encodedText, "", nil
-}
-
-// processTailContent handles tail content items
-func (e *WFMFileEncoder) processTailContent(tailValue interface{}) (encodedText []uint16, originalText string, err error) {
-	tailMap, ok := tailValue.(map[string]interface{})
-	if !ok {
-		return nil, "", nil
-	}
-
-	encodedText = append(encodedText, INIT_TAIL)
-
-	if width, hasWidth := tailMap["width"]; hasWidth {
-		if w, ok := width.(int); ok {
-			safeWidth, err := common.SafeIntToUint16(w)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid tail width value %d: %w", w, err)
-			}
-			encodedText = append(encodedText, safeWidth)
-		}
-	}
-
-	if height, hasHeight := tailMap["height"]; hasHeight {
-		if h, ok := height.(int); ok {
-			safeHeight, err := common.SafeIntToUint16(h)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid tail height value %d: %w", h, err)
-			}
-			encodedText = append(encodedText, safeHeight)
-		}
-	}
-
-	return encodedText, "", nil
-}
-
-// processF6Content handles f6 content items
-func (e *WFMFileEncoder) processF6Content(f6Value interface{}) (encodedText []uint16, originalText string, err error) {
-	f6Map, ok := f6Value.(map[string]interface{})
+// processControlContent handles structured control code items such as
+// {pause: {duration: 30}}, whose keys are the params of the control code table
+func (e *WFMFileEncoder) processControlContent(code ControlCode, value interface{}, dialogueID int) ([]uint16, error) {
+	params, ok := value.(map[string]interface{})
 	if !ok {
-		return nil, "", nil
-	}
-
-	encodedText = append(encodedText, F6)
-
-	if width, hasWidth := f6Map["width"]; hasWidth {
-		if w, ok := width.(int); ok {
-			safeWidth, err := common.SafeIntToUint16(w)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid f6 width value %d: %w", w, err)
-			}
-			encodedText = append(encodedText, safeWidth)
-		}
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s item must set %s, got %v", code.Content, strings.Join(code.Params, " and "), value))
 	}
 
-	if height, hasHeight := f6Map["height"]; hasHeight {
-		if h, ok := height.(int); ok {
-			safeHeight, err := common.SafeIntToUint16(h)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid f6 height value %d: %w", h, err)
-			}
-			encodedText = append(encodedText, safeHeight)
+	// Decode writes only the params present in truncated data, so trailing ones may be missing
+	args := make([]interface{}, 0, len(code.Params))
+	for _, param := range code.Params {
+		arg, exists := params[param]
+		if !exists {
+			break
 		}
+		args = append(args, arg)
 	}
-
-	return encodedText, "", nil
-}
-
-// processColorContent handles color content items
-func (e *WFMFileEncoder) processColorContent(colorValue interface{}) (encodedText []uint16, originalText string, err error) {
-	colorMap, ok := colorValue.(map[string]interface{})
-	if !ok {
-		return nil, "", nil
-	}
-
-	encodedText = append(encodedText, CHANGE_COLOR_TO)
-
-	if value, hasValue := colorMap["value"]; hasValue {
-		if v, ok := value.(int); ok {
-			safeValue, err := common.SafeIntToUint16(v)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid color value %d: %w", v, err)
-			}
-			encodedText = append(encodedText, safeValue)
+	for _, param := range code.Params[len(args):] {
+		if _, exists := params[param]; exists {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%s item sets %s without %s", code.Content, param, code.Params[len(args)]))
 		}
 	}
-
-	return encodedText, "", nil
+	return encodeControlCode(code, args, dialogueID)
 }
 
-// processPauseContent handles pause content items
-func (e *WFMFileEncoder) processPauseContent(pauseValue interface{}) (encodedText []uint16, originalText string, err error) {
-	pauseMap, ok := pauseValue.(map[string]interface{})
-	if !ok {
-		return nil, "", nil
+// encodeControlCode returns a control code followed by its args. Structured items and
+// inline tags both go through it, so {pause: {duration: 30}} and [PAUSE FOR 30] encode
+// the same. YAML may decode numbers as int, uint64, float64 or (quoted) string, all are
+// accepted, and strings may be decimal or 0x hexadecimal. Missing trailing args are
+// only warned about: the game then reads the following words as the args.
+func encodeControlCode(code ControlCode, args []interface{}, dialogueID int) ([]uint16, error) {
+	if len(args) > code.Args {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s takes %d args (%s), got %d", code.Tag, code.Args, strings.Join(code.Params, ", "), len(args)))
 	}
-
-	encodedText = append(encodedText, PAUSE_FOR)
-
-	if duration, hasDuration := pauseMap["duration"]; hasDuration {
-		if d, ok := duration.(int); ok {
-			safeDuration, err := common.SafeIntToUint16(d)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid pause duration value %d: %w", d, err)
-			}
-			encodedText = append(encodedText, safeDuration)
-		}
+	if len(args) < code.Args {
+		common.LogWarn("%s in dialogue %d has %d of its %d args (%s)", code.Tag, dialogueID, len(args), code.Args, strings.Join(code.Params, ", "))
 	}
 
-	return encodedText, "", nil
-}
-
-// processFff2Content handles fff2 content items
-func (e *WFMFileEncoder) processFff2Content(fff2Value interface{}) (encodedText []uint16, originalText string, err error) {
-	fff2Map, ok := fff2Value.(map[string]interface{})
-	if !ok {
-		return nil, "", nil
-	}
-
-	encodedText = append(encodedText, FFF2)
-
-	if value, hasValue := fff2Map["value"]; hasValue {
-		if v, ok := value.(int); ok {
-			safeValue, err := common.SafeIntToUint16(v)
-			if err != nil {
-				return nil, "", fmt.Errorf("invalid fff2 value %d: %w", v, err)
-			}
-			encodedText = append(encodedText, safeValue)
+	encodedText := append(make([]uint16, 0, 1+len(args)), code.Value)
+	for i, arg := range args {
+		parameter, err := common.SafeValueToUint16(arg)
+		if err != nil {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("invalid %s %s value %v: %w", code.Content, code.Params[i], arg, err))
 		}
+		encodedText = append(encodedText, parameter)
 	}
-
-	return encodedText, "", nil
+	return encodedText, nil
 }
 
 // processTextContent handles text content items
@@ -830,27 +901,23 @@ func (e *WFMFileEncoder) processTextRune(runes []rune, i, fontHeight int, glyphE
 	return e.handleUnicodeCharacter(runes, i, fontHeight, glyphEncodeMap, dialogueID)
 }
 
-// handleSpecialTag processes special tags like [FFF2], [HALT], etc.
+// handleSpecialTag processes special tags like [FFF2 5], [HALT], etc.
 func (e *WFMFileEncoder) handleSpecialTag(runes []rune, i, dialogueID int) (isTag bool, encodedPart []uint16, nextIndex int, err error) {
-	specialTagMap := map[string]uint16{
-		"[FFF2]":            FFF2,
-		"[HALT]":            HALT,
-		"[F4]":              F4,
-		"[PROMPT]":          PROMPT,
-		"[F6]":              F6,
-		"[CHANGE COLOR TO]": CHANGE_COLOR_TO,
-		"[INIT TAIL]":       INIT_TAIL,
-		"[PAUSE FOR]":       PAUSE_FOR,
-		"[C04D]":            C04D,
-		"[C04E]":            C04E,
-		"[WAIT FOR INPUT]":  WAIT_FOR_INPUT,
-		"[INIT TEXT BOX]":   INIT_TEXT_BOX,
-	}
-
 	// Check known special tags
-	for tag, code := range specialTagMap {
-		if found, advance := e.matchesTag(runes, i, tag); found {
-			return true, []uint16{code}, advance, nil
+	if found, advance := e.matchesTag(runes, i, PageBreakTag); found {
+		return true, []uint16{DOUBLE_NEWLINE}, advance, nil
+	}
+	if end := slices.Index(runes[i:], ']'); end > 0 {
+		if code, inlineArgs, found := parseControlTag(string(runes[i : i+end+1])); found {
+			args := make([]interface{}, len(inlineArgs))
+			for j, arg := range inlineArgs {
+				args[j] = arg
+			}
+			encodedPart, err := encodeControlCode(code, args, dialogueID)
+			if err != nil {
+				return false, nil, 0, err
+			}
+			return true, encodedPart, end + 1, nil
 		}
 	}
 
@@ -881,6 +948,18 @@ func (e *WFMFileEncoder) handleUnmappedByte(runes []rune, i, dialogueID int) (is
 	if len(remainingText) >= 6 {
 		possibleUnmapped := remainingText[:6]
 		if unmappedByteRegex.MatchString(possibleUnmapped) {
+			// Keep references to reserved placeholder glyph slots
+			if value, err := strconv.ParseUint(possibleUnmapped[1:5], 16, 16); err == nil {
+				code := uint16(value)
+				if code >= GLYPH_ID_BASE && e.placeholderGlyphs[int(code-GLYPH_ID_BASE)] {
+					return true, []uint16{code}, 6, nil
+				}
+				// Keep references to any glyph of the donor table
+				if e.donor != nil && code >= GLYPH_ID_BASE && int(code-GLYPH_ID_BASE) < len(e.donor.Glyphs) {
+					return true, []uint16{code}, 6, nil
+				}
+			}
+
 			// Skip unmapped bytes (don't include in encode)
 			common.LogWarn("%s %s in dialogue %d", common.WarnSkippingUnmappedByte, possibleUnmapped, dialogueID)
 			return true, nil, 6, nil
@@ -899,6 +978,11 @@ func (e *WFMFileEncoder) handleUnicodeCharacter(runes []rune, i, fontHeight int,
 		return true, []uint16{code}, 1, nil
 	}
 
+	// Drop the markers declared as ignored characters
+	if isIgnoredCharacter(char) {
+		return true, nil, 1, nil
+	}
+
 	// Handle newlines
 	if char == '\n' {
 		return e.handleNewline(runes, i)
@@ -910,22 +994,15 @@ func (e *WFMFileEncoder) handleUnicodeCharacter(runes []rune, i, fontHeight int,
 
 // getSpecialUnicodeCode returns the code for special unicode characters
 func (e *WFMFileEncoder) getSpecialUnicodeCode(char rune) (uint16, bool) {
-	switch char {
-	case '▼':
-		return C04D, true
-	case '⏷':
-		return C04E, true
-	case '⧗':
-		return WAIT_FOR_INPUT, true
-	default:
-		return 0, false
-	}
+	code, found := controlCodesBySymbol[char]
+	return code, found
 }
 
-// handleNewline processes newline characters (single or double)
+// handleNewline processes newline characters (single or double). In page mode
+// DOUBLE_NEWLINE is written as [PAGE], so every newline is a NEWLINE code.
 func (e *WFMFileEncoder) handleNewline(runes []rune, i int) (isNewline bool, encodedPart []uint16, nextIndex int, err error) {
 	// Check if this is a double newline (\n\n)
-	if i+1 < len(runes) && runes[i+1] == '\n' {
+	if !e.pageBreaks && i+1 < len(runes) && runes[i+1] == '\n' {
 		return true, []uint16{DOUBLE_NEWLINE}, 2, nil
 	}
 	return true, []uint16{NEWLINE}, 1, nil
@@ -941,18 +1018,6 @@ func (e *WFMFileEncoder) handleMappedCharacter(char rune, fontHeight int, glyphE
 	return false, nil, 0, nil
 }
 
-// getTerminatorHex converts terminator value to hex
-func (e *WFMFileEncoder) getTerminatorHex(terminator uint16) uint16 {
-	switch terminator {
-	case 1:
-		return 0xFFFE // TERMINATOR_1
-	case 2:
-		return 0xFFFF // TERMINATOR_2
-	default:
-		return 0xFFFF // Default to TERMINATOR_2
-	}
-}
-
 // formatEncodedText formats encoded text as a readable hex string
 func (e *WFMFileEncoder) formatEncodedText(encodedText []uint16) string {
 	if len(encodedText) == 0 {
@@ -978,22 +1043,6 @@ func (e *WFMFileEncoder) formatEncodedText(encodedText []uint16) string {
 	return result.String()
 }
 
-// alignToBytes ensures a value is aligned to the specified byte boundary
-func alignToBytes(value, alignment uint32) uint32 {
-	if alignment == 0 {
-		return value
-	}
-	return ((value + alignment - 1) / alignment) * alignment
-}
-
-// alignToBytes16 ensures a value is aligned to the specified byte boundary for uint16
-func alignToBytes16(value, alignment uint16) uint16 {
-	if alignment == 0 {
-		return value
-	}
-	return ((value + alignment - 1) / alignment) * alignment
-}
-
 // buildWFMFile constructs a complete WFM file from the processed data
 func (e *WFMFileEncoder) buildWFMFile(glyphMap map[int]map[rune]Glyph, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16, recodedDialogues []RecodedDialogue, reservedData []byte) (*WFMFile, error) {
 	// Create ordered list of glyphs and dialogues
@@ -1003,25 +1052,24 @@ func (e *WFMFileEncoder) buildWFMFile(glyphMap map[int]map[rune]Glyph, encodeVal
 		return nil, err
 	}
 
-	// Calculate pointer tables
-	glyphPointerTable, err := e.calculateGlyphPointers(glyphs)
+	// Plan the layout; the header and both pointer tables are derived from it
+	layout, err := planWFMLayout(glyphs, dialogues)
 	if err != nil {
 		return nil, err
 	}
 
-	dialoguePointerTable, err := e.calculateDialoguePointers(dialogues)
+	glyphPointerTable, err := layout.GlyphPointers()
 	if err != nil {
 		return nil, err
 	}
 
-	// Calculate dialogue pointer table offset
-	dialoguePointerTableOffset, err := e.calculateDialoguePointerTableOffset(glyphs)
+	dialoguePointerTable, err := layout.DialoguePointers()
 	if err != nil {
 		return nil, err
 	}
 
 	// Create header
-	header, err := e.buildHeader(dialogues, glyphs, dialoguePointerTableOffset, reservedData)
+	header, err := e.buildHeader(dialogues, glyphs, layout.DialoguePointerTable, reservedData)
 	if err != nil {
 		return nil, err
 	}
@@ -1073,111 +1121,6 @@ func (e *WFMFileEncoder) buildDialogueList(recodedDialogues []RecodedDialogue) (
 	return dialogues, nil
 }
 
-// calculateGlyphPointers calculates glyph pointers relative to WFM file start
-func (e *WFMFileEncoder) calculateGlyphPointers(glyphs []Glyph) ([]uint16, error) {
-	glyphPointerTable := make([]uint16, 0, len(glyphs))
-	headerSize := uint32(4 + 4 + 4 + 2 + 2 + 128) // Magic + Padding + DialoguePointerTable + TotalDialogues + TotalGlyphs + Reserved
-
-	// Safe conversion: len(glyphs) * 2 should not overflow uint32 in reasonable use cases
-	if len(glyphs) > (1<<31-1)/2 {
-		return nil, fmt.Errorf("too many glyphs: %d", len(glyphs))
-	}
-	glyphTableSize, err := common.SafeIntToUint32(len(glyphs) * 2)
-	if err != nil {
-		return nil, fmt.Errorf("glyph table size calculation failed: %w", err)
-	}
-	currentGlyphOffset := headerSize + glyphTableSize // Start of glyph data
-
-	for _, glyph := range glyphs {
-		// Ensure glyph offset fits in uint16
-		if currentGlyphOffset > 65535 {
-			return nil, fmt.Errorf("glyph offset too large: %d", currentGlyphOffset)
-		}
-		glyphPointerTable = append(glyphPointerTable, uint16(currentGlyphOffset)) // Safe: checked above
-
-		// Each glyph has: 2+2+2+2 = 8 bytes of attributes + image size
-		glyphSize := 8 + len(glyph.GlyphImage)
-		// Safe conversion: glyphSize should not cause overflow in reasonable use cases
-		if glyphSize > (1<<31-1) || len(glyph.GlyphImage) > (1<<31-1)-8 {
-			return nil, fmt.Errorf("glyph image too large: %d bytes", len(glyph.GlyphImage))
-		}
-		safeGlyphSize, err := common.SafeIntToUint32(glyphSize)
-		if err != nil {
-			return nil, fmt.Errorf("glyph size conversion failed: %w", err)
-		}
-		currentGlyphOffset += safeGlyphSize
-	}
-
-	return glyphPointerTable, nil
-}
-
-// calculateDialoguePointers calculates dialogue pointers relative to start of dialogue pointer table
-func (e *WFMFileEncoder) calculateDialoguePointers(dialogues []Dialogue) ([]uint16, error) {
-	dialoguePointerTable := make([]uint16, 0, len(dialogues))
-	// Safe conversion: ensure len(dialogues) * 2 fits in uint16
-	if len(dialogues) > 32767 {
-		return nil, fmt.Errorf("too many dialogues: %d", len(dialogues))
-	}
-	safeDialogueOffset, err := common.SafeIntToUint16(len(dialogues) * 2)
-	if err != nil {
-		return nil, fmt.Errorf("dialogue offset calculation failed: %w", err)
-	}
-	currentDialogueOffset := safeDialogueOffset // Size of pointer table, safe: checked above
-
-	// Ensure dialogue data is byte-aligned (2-byte alignment)
-	currentDialogueOffset = alignToBytes16(currentDialogueOffset, 2)
-
-	for _, dialogue := range dialogues {
-		dialoguePointerTable = append(dialoguePointerTable, currentDialogueOffset)
-		// Safe conversion: ensure dialogue data size fits in uint16
-		if len(dialogue.Data) > 65535 {
-			return nil, fmt.Errorf("dialogue data too large: %d bytes", len(dialogue.Data))
-		}
-		safeDialogueSize, err := common.SafeIntToUint16(len(dialogue.Data))
-		if err != nil {
-			return nil, fmt.Errorf("dialogue size conversion failed: %w", err)
-		}
-		dialogueSize := safeDialogueSize
-		// Ensure each dialogue is byte-aligned
-		alignedDialogueSize := alignToBytes16(dialogueSize, 2)
-		currentDialogueOffset += alignedDialogueSize
-	}
-
-	return dialoguePointerTable, nil
-}
-
-// calculateDialoguePointerTableOffset calculates position of dialogue pointer table
-func (e *WFMFileEncoder) calculateDialoguePointerTableOffset(glyphs []Glyph) (uint32, error) {
-	headerSize := uint32(4 + 4 + 4 + 2 + 2 + 128) // Magic + Padding + DialoguePointerTable + TotalDialogues + TotalGlyphs + Reserved
-	safeGlyphTableSize, err := common.SafeIntToUint32(len(glyphs) * 2)
-	if err != nil {
-		return 0, fmt.Errorf("glyph table size calculation failed: %w", err)
-	}
-	glyphTableSize := safeGlyphTableSize // Size of glyph pointer table
-
-	totalGlyphsSize := uint32(0)
-	for _, glyph := range glyphs {
-		// Safe conversion: ensure glyph image size doesn't cause overflow
-		if len(glyph.GlyphImage) > (1<<31-1)-8 {
-			return 0, fmt.Errorf("glyph image too large: %d bytes", len(glyph.GlyphImage))
-		}
-		safeGlyphSize, err := common.SafeIntToUint32(8 + len(glyph.GlyphImage))
-		if err != nil {
-			return 0, fmt.Errorf("glyph size calculation failed: %w", err)
-		}
-		glyphSize := safeGlyphSize
-		// Ensure each glyph is byte-aligned
-		alignedGlyphSize := alignToBytes(glyphSize, 2)
-		totalGlyphsSize += alignedGlyphSize
-	}
-
-	dialoguePointerTableOffset := headerSize + glyphTableSize + totalGlyphsSize
-	// Ensure dialogue pointer table is byte-aligned
-	dialoguePointerTableOffset = alignToBytes(dialoguePointerTableOffset, 2)
-
-	return dialoguePointerTableOffset, nil
-}
-
 // buildHeader creates the WFM header
 func (e *WFMFileEncoder) buildHeader(dialogues []Dialogue, glyphs []Glyph, dialoguePointerTableOffset uint32, reservedData []byte) (WFMHeader, error) {
 	var reservedBytes [128]byte
@@ -1214,233 +1157,138 @@ func (e *WFMFileEncoder) buildHeader(dialogues []Dialogue, glyphs []Glyph, dialo
 	return header, nil
 }
 
-// writeWFMFile writes the WFM file to disk
-func (e *WFMFileEncoder) writeWFMFile(wfm *WFMFile, outputFile string) error {
-	file, err := os.Create(outputFile)
+// writeWFMFile writes the WFM file to disk, replacing the output file only once
+// everything has been written
+func (e *WFMFileEncoder) writeWFMFile(ctx context.Context, wfm *WFMFile, outputFile string) error {
+	atomicFile, err := common.CreateAtomic(outputFile)
 	if err != nil {
 		return common.FormatError(common.ErrFailedToCreateOutputFile, err)
 	}
-	defer file.Close()
-
-	// Write header
-	if err := e.writeHeader(file, &wfm.Header); err != nil {
-		return err
-	}
+	defer atomicFile.Abort()
 
-	// Write glyph pointer table
-	if err := e.writeGlyphPointerTable(file, wfm.GlyphPointerTable); err != nil {
+	if err := e.writeWFM(ctx, atomicFile.File, wfm); err != nil {
 		return err
 	}
-
-	// Write glyphs
-	if err := e.writeGlyphs(file, wfm.Glyphs); err != nil {
-		return err
-	}
-
-	// Ensure alignment before dialogue pointer table
-	if err := e.ensureDialogueAlignment(file); err != nil {
-		return err
-	}
-
-	// Write dialogue pointer table
-	if err := e.writeDialoguePointerTable(file, wfm.DialoguePointerTable); err != nil {
+	if err := common.Canceled(ctx); err != nil {
 		return err
 	}
+	return atomicFile.Commit()
+}
 
-	// Write dialogues
-	if err := e.writeDialogues(file, wfm.Dialogues); err != nil {
+// writeWFM writes the WFM file to file, followed by the final padding
+func (e *WFMFileEncoder) writeWFM(ctx context.Context, file io.WriteSeeker, wfmFile *WFMFile) error {
+	if err := wfm.Write(ctx, file, wfmFile); err != nil {
 		return err
 	}
 
 	// Apply final padding if necessary
-	if err := e.applyFinalPadding(file); err != nil {
-		return err
-	}
-
-	return nil
+	return e.applyFinalPadding(file)
 }
 
-// writeHeader writes the WFM header to file
-func (e *WFMFileEncoder) writeHeader(file *os.File, header *WFMHeader) error {
-	err := binary.Write(file, binary.LittleEndian, header)
+// applyFinalPadding applies final padding to maintain original file size
+func (e *WFMFileEncoder) applyFinalPadding(file io.WriteSeeker) error {
+	currentPos, err := file.Seek(0, io.SeekCurrent)
 	if err != nil {
-		return common.FormatError(common.ErrFailedToWriteHeader, err)
+		return common.FormatError(common.ErrFailedToGetFilePosition, err)
 	}
-	return nil
-}
 
-// writeGlyphPointerTable writes the glyph pointer table to file
-func (e *WFMFileEncoder) writeGlyphPointerTable(file *os.File, glyphPointerTable []uint16) error {
-	for _, pointer := range glyphPointerTable {
-		err := binary.Write(file, binary.LittleEndian, pointer)
-		if err != nil {
-			return common.FormatError(common.ErrFailedToWriteGlyphPointer, err)
-		}
+	if e.originalSize > 0 && currentPos > e.originalSize {
+		common.LogWarn(common.WarnEncodedFileLarger, currentPos, e.originalSize)
 	}
-	return nil
-}
 
-// writeGlyphs writes all glyphs to file
-func (e *WFMFileEncoder) writeGlyphs(file *os.File, glyphs []Glyph) error {
-	for _, glyph := range glyphs {
-		if err := e.writeSingleGlyph(file, glyph); err != nil {
-			return err
+	targetSize := e.paddedSize(currentPos)
+	if targetSize > currentPos || e.provenance != nil {
+		paddingSize := targetSize - currentPos
+		padding := bytes.Repeat([]byte{e.padByte}, int(paddingSize))
+
+		// The provenance trailer replaces the end of the padding, which the game never reads
+		if e.provenance != nil {
+			trailer, err := e.provenance.Trailer()
+			if err != nil {
+				return err
+			}
+			if int64(len(trailer)) > paddingSize {
+				return common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("provenance needs %d bytes of padding, only %d available (use --align to add padding)", len(trailer), paddingSize))
+			}
+			copy(padding[len(padding)-len(trailer):], trailer)
+			e.logger.Debug("Provenance trailer of %d bytes written into the final padding", len(trailer))
 		}
-	}
-	return nil
-}
 
-// writeSingleGlyph writes a single glyph to file
-func (e *WFMFileEncoder) writeSingleGlyph(file *os.File, glyph Glyph) error {
-	// Write glyph attributes
-	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphClut); err != nil {
-		return common.FormatError(common.ErrFailedToWriteGlyphClut, err)
-	}
+		if _, err := file.Write(padding); err != nil {
+			return common.FormatError(common.ErrFailedToWritePadding, err)
+		}
 
-	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphHeight); err != nil {
-		return common.FormatError(common.ErrFailedToWriteGlyphHeight, err)
+		common.LogInfo("%s: %d bytes of 0x%02X (final size %d bytes)",
+			common.InfoPaddingAdded, paddingSize, e.padByte, targetSize)
 	}
 
-	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphWidth); err != nil {
-		return common.FormatError(common.ErrFailedToWriteGlyphWidth, err)
-	}
+	return nil
+}
 
-	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphHandakuten); err != nil {
-		return common.FormatError(common.ErrFailedToWriteGlyphHandakuten, err)
+// paddedSize returns the final file size for the given content size: at least the
+// original size, rounded up to the configured alignment
+func (e *WFMFileEncoder) paddedSize(contentSize int64) int64 {
+	targetSize := contentSize
+	if e.originalSize > targetSize {
+		targetSize = e.originalSize
 	}
 
-	// Write image data
-	if _, err := file.Write(glyph.GlyphImage); err != nil {
-		return common.FormatError(common.ErrFailedToWriteGlyphImage, err)
+	if e.alignment > 0 && targetSize%e.alignment != 0 {
+		targetSize += e.alignment - targetSize%e.alignment
 	}
 
-	// Apply glyph padding
-	return e.applyGlyphPadding(file, glyph)
+	return targetSize
 }
 
-// applyGlyphPadding applies padding for glyph alignment
-func (e *WFMFileEncoder) applyGlyphPadding(file *os.File, glyph Glyph) error {
-	// Safe conversion: ensure glyph image size doesn't cause overflow (already validated in buildWFMFile)
-	safeGlyphSize, err := common.SafeIntToUint32(8 + len(glyph.GlyphImage))
-	if err != nil {
-		return fmt.Errorf("glyph size conversion failed: %w", err)
-	}
-	glyphSize := safeGlyphSize
-	alignedGlyphSize := alignToBytes(glyphSize, 2)
-	paddingSize := alignedGlyphSize - glyphSize
-	if paddingSize > 0 {
-		padding := make([]byte, paddingSize)
-		if _, err := file.Write(padding); err != nil {
-			return common.FormatError(common.ErrFailedToWriteGlyphPadding, err)
-		}
-	}
-	return nil
-}
-
-// ensureDialogueAlignment ensures proper alignment before dialogue pointer table
-func (e *WFMFileEncoder) ensureDialogueAlignment(file *os.File) error {
-	currentPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return common.FormatError(common.ErrFailedToGetFilePosition, err)
+// SetPaddingPolicy configures the final padding stage. Alignment rounds the output
+// size up to a multiple of the given value (e.g. 2048 for sector-aligned slots,
+// 0 keeps the original size only) and padByte is the fill value.
+func (e *WFMFileEncoder) SetPaddingPolicy(alignment int64, padByte byte) error {
+	if alignment < 0 {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid alignment %d: must not be negative", alignment))
 	}
 
-	// Safe conversion: file position should not exceed uint32 range in reasonable cases
-	if currentPos > (1<<32 - 1) {
-		return common.FormatError(common.ErrFailedToGetFilePosition, fmt.Errorf("file too large: %d bytes", currentPos))
-	}
-	safeCurrentPos, err := common.SafeInt64ToUint32(currentPos)
-	if err != nil {
-		return common.FormatError(common.ErrFailedToGetFilePosition, fmt.Errorf("file position conversion failed: %w", err))
-	}
-	alignedPos := alignToBytes(safeCurrentPos, 2)
-	paddingForTable := alignedPos - safeCurrentPos
-	if paddingForTable > 0 {
-		padding := make([]byte, paddingForTable)
-		if _, err := file.Write(padding); err != nil {
-			return common.FormatError(common.ErrFailedToWritePadding, err)
-		}
-	}
+	e.alignment = alignment
+	e.padByte = padByte
 	return nil
 }
 
-// writeDialoguePointerTable writes the dialogue pointer table to file
-func (e *WFMFileEncoder) writeDialoguePointerTable(file *os.File, dialoguePointerTable []uint16) error {
-	for _, pointer := range dialoguePointerTable {
-		err := binary.Write(file, binary.LittleEndian, pointer)
-		if err != nil {
-			return common.FormatError(common.ErrFailedToWriteDialoguePointer, err)
-		}
-	}
-	return nil
+// SetAlphaPreprocessing configures how glyph PNG transparency is normalized before quantization
+func (e *WFMFileEncoder) SetAlphaPreprocessing(options psx.AlphaOptions, warnPartialAlpha bool) {
+	e.alphaOptions = options
+	e.warnPartialAlpha = warnPartialAlpha
 }
 
-// writeDialogues writes all dialogues to file
-func (e *WFMFileEncoder) writeDialogues(file *os.File, dialogues []Dialogue) error {
-	for i, dialogue := range dialogues {
-		if _, err := file.Write(dialogue.Data); err != nil {
-			return common.FormatError(common.ErrFailedToWriteDialogueData, err)
-		}
-
-		// Apply dialogue padding (except for last dialogue)
-		if err := e.applyDialoguePadding(file, dialogue, i, len(dialogues)); err != nil {
-			return err
-		}
-	}
-	return nil
+// SetUnmappedLog sets the dictionary file unmapped codes are recorded in (empty disables)
+func (e *WFMFileEncoder) SetUnmappedLog(path string) {
+	e.unmappedLog = path
 }
 
-// applyDialoguePadding applies padding for dialogue alignment
-func (e *WFMFileEncoder) applyDialoguePadding(file *os.File, dialogue Dialogue, index, total int) error {
-	// Safe conversion: dialogue data size already validated in buildWFMFile
-	safeDialogueSize, err := common.SafeIntToUint16(len(dialogue.Data))
-	if err != nil {
-		return fmt.Errorf("dialogue size conversion failed: %w", err)
-	}
-	dialogueSize := safeDialogueSize
-	alignedDialogueSize := alignToBytes16(dialogueSize, 2)
-	paddingSize := alignedDialogueSize - dialogueSize
-	if paddingSize > 0 && index < total-1 { // Don't apply padding to the last dialogue
-		padding := make([]byte, paddingSize)
-		if _, err := file.Write(padding); err != nil {
-			return common.FormatError(common.ErrFailedToWriteDialoguePadding, err)
-		}
-	}
-	return nil
+// SetProvenance enables the provenance trailer, recording the given tool version (empty disables)
+func (e *WFMFileEncoder) SetProvenance(toolVersion string) {
+	e.toolVersion = toolVersion
 }
 
-// applyFinalPadding applies final padding to maintain original file size
-func (e *WFMFileEncoder) applyFinalPadding(file *os.File) error {
-	currentPos, err := file.Seek(0, io.SeekCurrent)
-	if err != nil {
-		return common.FormatError(common.ErrFailedToGetFilePosition, err)
-	}
-
-	// If we have an original size and current file is smaller, pad with 0xFF
-	if e.originalSize > 0 && currentPos < e.originalSize {
-		paddingSize := e.originalSize - currentPos
-		padding := make([]byte, paddingSize)
-		// Fill with 0xFF
-		for i := range padding {
-			padding[i] = 0xFF
-		}
-
-		if _, err := file.Write(padding); err != nil {
-			return common.FormatError(common.ErrFailedToWritePadding, err)
-		}
+// SetLogger sets the logging configuration of the encoder (nil follows SetVerboseMode)
+func (e *WFMFileEncoder) SetLogger(logger *common.Logger) {
+	e.logger = logger
+}
 
-		common.LogInfo("%s %d bytes of 0xFF padding to maintain original file size (%d bytes)",
-			common.InfoPaddingAdded, paddingSize, e.originalSize)
-	} else if e.originalSize > 0 && currentPos > e.originalSize {
-		common.LogWarn(common.WarnEncodedFileLarger, currentPos, e.originalSize)
-	}
+// SetGlyphWidthLimits sets the widest glyph PNG accepted per font height (nil accepts any width)
+func (e *WFMFileEncoder) SetGlyphWidthLimits(limits GlyphWidthLimits) {
+	e.glyphWidthLimits = limits
+}
 
-	return nil
+// SetPalettes sets the project palettes used to quantize glyph PNGs (nil uses the built-in CLUTs)
+func (e *WFMFileEncoder) SetPalettes(set *PaletteSet) {
+	e.palettes = set
 }
 
 // loadSingleGlyph loads a single glyph from the fonts directory and converts it to 4bpp linear little endian
 func (e *WFMFileEncoder) loadSingleGlyph(char rune, fontHeight int, fontClut uint16) (Glyph, error) {
 	// Check for ignored characters first
-	if char == '⧗' { // U+29D7 - ignore this character
+	if needsNoGlyph(char) {
 		return Glyph{}, fmt.Errorf(common.ErrCharacterIgnoredNoGlyph)
 	}
 
@@ -1456,16 +1304,20 @@ func (e *WFMFileEncoder) loadSingleGlyph(char rune, fontHeight int, fontClut uin
 		return Glyph{}, common.FormatErrorString(common.ErrFailedToLoadPNG, "%s: %w", glyphPath, err)
 	}
 
+	if e.warnPartialAlpha {
+		if partial := psx.CountPartialAlpha(img); partial > 0 {
+			common.LogWarn("Glyph %s has %d semi-transparent pixels", glyphPath, partial)
+		}
+	}
+	if e.alphaOptions.Enabled() {
+		img = psx.PreprocessAlpha(img, e.alphaOptions)
+	}
+
 	// Convert to 4bpp linear little endian using PSX tile processor
 	processor := psx.NewPSXTileProcessor()
 
-	// Get appropriate palette based on font height
-	var palette psx.PSXPalette
-	if fontHeight == 24 {
-		palette = psx.NewPSXPalette(EventClut)
-	} else {
-		palette = psx.NewPSXPalette(DialogueClut)
-	}
+	// Get the project palette of the font CLUT, or the built-in one for the font height
+	palette := glyphPalette(e.palettes, fontClut, fontHeight)
 
 	tile, err := processor.ConvertTo4bppLinearLE(img, palette)
 	if err != nil {
@@ -1484,6 +1336,10 @@ func (e *WFMFileEncoder) loadSingleGlyph(char rune, fontHeight int, fontClut uin
 		return Glyph{}, fmt.Errorf("invalid glyph width: %d", width)
 	}
 
+	if err := e.glyphWidthLimits.Check(fontHeight, width); err != nil {
+		return Glyph{}, fmt.Errorf("glyph %s of '%c' (U+%04X): %w", glyphPath, char, char, err)
+	}
+
 	safeHeight, err := common.SafeIntToUint16(height)
 	if err != nil {
 		return Glyph{}, fmt.Errorf("glyph height conversion failed: %w", err)
@@ -1506,8 +1362,13 @@ func (e *WFMFileEncoder) loadSingleGlyph(char rune, fontHeight int, fontClut uin
 
 // getGlyphPath determines the file path for a character's glyph PNG
 func (e *WFMFileEncoder) getGlyphPath(char rune, fontHeight int) (string, error) {
-	// Ignore the ⧗ character (U+29D7) - skip glyph loading for this character
-	if char == '⧗' { // U+29D7
+	return findGlyphPNG(DefaultFontDir, char, fontHeight)
+}
+
+// findGlyphPNG returns the glyph PNG of a character in the encode region of a fonts directory
+func findGlyphPNG(fontRoot string, char rune, fontHeight int) (string, error) {
+	// Control code symbols and ignored markers have no glyph
+	if needsNoGlyph(char) {
 		return "", fmt.Errorf(common.ErrCharacterIgnored)
 	}
 
@@ -1520,7 +1381,7 @@ func (e *WFMFileEncoder) getGlyphPath(char rune, fontHeight int) (string, error)
 	}
 
 	// Find the file in the corresponding height folder
-	fontDir := filepath.Join("fonts", "br", fmt.Sprintf("%d", fontHeight))
+	fontDir := filepath.Join(fontRoot, encodeFontRegion, fmt.Sprintf("%d", fontHeight))
 
 	// List all subfolders and search for the file
 	subdirs := []string{"lowercase", "uppercase", "numbers", "symbols", "psx"}
@@ -1543,6 +1404,13 @@ func (e *WFMFileEncoder) loadPNGImage(path string) (image.Image, error) {
 	}
 	defer file.Close()
 
+	if err := common.CheckImageMemory(path, file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
 	img, err := png.Decode(file)
 	if err != nil {
 		return nil, err
@@ -1553,35 +1421,27 @@ func (e *WFMFileEncoder) loadPNGImage(path string) (image.Image, error) {
 
 // NewWFMEncoder creates a new WFM encoder instance
 func NewWFMEncoder() *WFMFileEncoder {
-	return &WFMFileEncoder{}
+	return &WFMFileEncoder{padByte: 0xFF}
 }
 
 // PackGAM creates a GAM file from uncompressed data using LZ compression
-func (p *GAMProcessor) PackGAM(inputFile, outputFile string) error {
+func (p *GAMProcessor) PackGAM(ctx context.Context, inputFile, outputFile string) error {
+	// The input and its compressed copy are held in memory
+	if fileInfo, err := os.Stat(inputFile); err == nil {
+		if err := common.CheckMemory(inputFile, 2*fileInfo.Size()); err != nil {
+			return err
+		}
+	}
+
 	// Read uncompressed data
 	uncompressedData, err := os.ReadFile(inputFile)
 	if err != nil {
 		return fmt.Errorf("failed to read input file: %w", err)
 	}
 
-	// Create GAM structure
-	gam := &GAMFile{
-		Header: GAMHeader{
-			Magic:            [3]byte{'G', 'A', 'M'},
-			Reserved:         0x00,
-			UncompressedSize: uint32(len(uncompressedData)),
-		},
-		UncompressedData: uncompressedData,
-	}
-
-	// Compress the data
-	if err := p.compressLZ(gam); err != nil {
-		return fmt.Errorf("failed to compress data: %w", err)
-	}
-
-	// Write GAM file
-	if err := p.writeGAMFile(gam, outputFile); err != nil {
-		return fmt.Errorf("failed to write GAM file: %w", err)
+	gam, err := p.SaveGAM(ctx, uncompressedData, outputFile)
+	if err != nil {
+		return err
 	}
 
 	common.LogInfo("GAM file packed successfully: %s -> %s", inputFile, outputFile)
@@ -1591,100 +1451,48 @@ func (p *GAMProcessor) PackGAM(inputFile, outputFile string) error {
 	return nil
 }
 
-// compressLZ implements LZ compression (reverse of decompression)
-func (p *GAMProcessor) compressLZ(gam *GAMFile) error {
-	input := gam.UncompressedData
-	output := make([]byte, 0)
-
-	pos := 0
-
-	common.LogDebug("Starting LZ compression: input size = %d bytes", len(input))
-
-	for pos < len(input) {
-		bitmask := uint16(0)
-		bitmaskPos := len(output)
-		output = append(output, 0, 0) // Reserve space for bitmask
-
-		// Process up to 16 bytes/references
-		for bit := 0; bit < 16 && pos < len(input); bit++ {
-			// Find best match in previous data
-			bestOffset, bestLength := p.findBestMatch(input, pos)
-
-			if bestLength >= 2 && bestOffset <= 255 && bestLength <= 255 {
-				// Use LZ reference
-				bitmask |= (1 << bit)
-				output = append(output, byte(bestOffset), byte(bestLength))
-				pos += bestLength
-
-				common.LogDebug("LZ reference: offset=%d, length=%d", bestOffset, bestLength)
-			} else {
-				// Use literal byte
-				output = append(output, input[pos])
-				pos++
-
-				common.LogDebug("Literal byte: 0x%02X", input[pos-1])
-			}
-		}
-
-		// Write bitmask in little endian
-		binary.LittleEndian.PutUint16(output[bitmaskPos:bitmaskPos+2], bitmask)
-		common.LogDebug("Bitmask: 0x%04X", bitmask)
+// SaveGAM compresses data in memory and writes it as a GAM file
+func (p *GAMProcessor) SaveGAM(ctx context.Context, uncompressedData []byte, outputFile string) (*GAMFile, error) {
+	// Create GAM structure
+	gamFile, err := gam.New(uncompressedData)
+	if err != nil {
+		return nil, err
 	}
 
-	gam.CompressedData = output
-	common.LogDebug("LZ compression completed: %d -> %d bytes", len(input), len(output))
-
-	return nil
-}
-
-// findBestMatch finds the best LZ match for current position
-func (p *GAMProcessor) findBestMatch(data []byte, pos int) (offset, length int) {
-	bestOffset := 0
-	bestLength := 0
-
-	// Search backwards for matches (up to 255 bytes back)
-	maxOffset := pos
-	if maxOffset > 255 {
-		maxOffset = 255
+	// Compress the data with the selected preset or like the original file
+	if err := p.compress(ctx, gamFile); err != nil {
+		return nil, fmt.Errorf("failed to compress data: %w", err)
 	}
 
-	for o := 1; o <= maxOffset; o++ {
-		srcPos := pos - o
-		matchLength := 0
-
-		// Count matching bytes
-		for matchLength < 255 && pos+matchLength < len(data) &&
-			data[srcPos+matchLength%o] == data[pos+matchLength] {
-			matchLength++
+	// Report an overflow of the target size before anything is written
+	p.fitReport = nil
+	if p.targetSize > 0 {
+		if err := p.fitGAM(ctx, gamFile); err != nil {
+			return nil, err
 		}
+	}
 
-		// Keep best match
-		if matchLength > bestLength {
-			bestOffset = o
-			bestLength = matchLength
-		}
+	// Write GAM file
+	if err := p.writeGAMFile(ctx, gamFile, outputFile); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write GAM file: %w", err))
 	}
 
-	return bestOffset, bestLength
+	return gamFile, nil
 }
 
 // writeGAMFile writes a complete GAM file
-func (p *GAMProcessor) writeGAMFile(gam *GAMFile, outputFile string) error {
-	file, err := os.Create(outputFile)
+func (p *GAMProcessor) writeGAMFile(ctx context.Context, gamFile *GAMFile, outputFile string) error {
+	file, err := common.CreateAtomic(outputFile)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
 	}
-	defer file.Close()
-
-	// Write header
-	if err := binary.Write(file, binary.LittleEndian, gam.Header); err != nil {
-		return fmt.Errorf("failed to write header: %w", err)
-	}
+	defer file.Abort()
+	writer := common.NewProgressWriter(ctx, file, outputFile, gamFile.Size())
 
-	// Write compressed data
-	if _, err := file.Write(gam.CompressedData); err != nil {
-		return fmt.Errorf("failed to write compressed data: %w", err)
+	if err := gamFile.Write(writer); err != nil {
+		return err
 	}
 
-	return nil
+	// Replace the output file only once everything has been written
+	return file.Commit()
 }
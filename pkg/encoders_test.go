@@ -0,0 +1,210 @@
+// Package pkg provides tests for WFM file encoders
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestWFMFileEncoder_AssignEncodeValues_Placeholders(t *testing.T) {
+	encoder := NewWFMEncoder()
+	encoder.placeholderGlyphs = map[int]bool{1: true, 4: true}
+
+	glyphMap := map[int]map[rune]Glyph{
+		16: {
+			'A': {GlyphHeight: 16, GlyphWidth: 8},
+			'B': {GlyphHeight: 16, GlyphWidth: 8},
+		},
+	}
+
+	glyphEncodeMap, encodeValueMap, encodeOrder := encoder.assignEncodeValues(glyphMap)
+
+	if glyphEncodeMap[16]['A'] != 0x8000 {
+		t.Errorf("encode value for 'A' = 0x%04X, want 0x8000", glyphEncodeMap[16]['A'])
+	}
+	if glyphEncodeMap[16]['B'] != 0x8002 {
+		t.Errorf("encode value for 'B' = 0x%04X, want 0x8002", glyphEncodeMap[16]['B'])
+	}
+
+	// Slots 1, 3 and 4 are placeholders (3 fills the gap before trailing slot 4)
+	if len(encodeOrder) != 5 {
+		t.Fatalf("len(encodeOrder) = %d, want 5", len(encodeOrder))
+	}
+	for _, value := range []uint16{0x8001, 0x8003, 0x8004} {
+		if !encodeValueMap[value].Glyph.IsPlaceholder() {
+			t.Errorf("glyph 0x%04X should be a placeholder", value)
+		}
+	}
+}
+
+func TestWFMFileEncoder_PaddedSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		originalSize int64
+		alignment    int64
+		contentSize  int64
+		expected     int64
+	}{
+		{"original size only", 5000, 0, 4000, 5000},
+		{"no original size", 0, 0, 4000, 4000},
+		{"aligned to sector", 0, 2048, 4000, 4096},
+		{"original size then aligned", 5000, 2048, 4000, 6144},
+		{"already aligned", 0, 2048, 4096, 4096},
+		{"content larger than original", 3000, 2048, 4100, 6144},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoder := NewWFMEncoder()
+			encoder.originalSize = tt.originalSize
+			if err := encoder.SetPaddingPolicy(tt.alignment, 0x00); err != nil {
+				t.Fatalf("SetPaddingPolicy() failed: %v", err)
+			}
+
+			if got := encoder.paddedSize(tt.contentSize); got != tt.expected {
+				t.Errorf("paddedSize(%d) = %d, want %d", tt.contentSize, got, tt.expected)
+			}
+		})
+	}
+
+	if err := NewWFMEncoder().SetPaddingPolicy(-1, 0xFF); err == nil {
+		t.Error("SetPaddingPolicy(-1) should fail")
+	}
+}
+
+func TestWFMFileEncoder_ProcessContentItem_NumericTypes(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		want    []uint16
+		wantErr bool
+	}{
+		{"plain integers", "box: {width: 12, height: 3}", []uint16{INIT_TEXT_BOX, 12, 3}, false},
+		{"hex notation", "box: {width: 0x0C, height: 0x3}", []uint16{INIT_TEXT_BOX, 12, 3}, false},
+		{"quoted numbers", "tail: {width: \"12\", height: '0x10'}", []uint16{INIT_TAIL, 12, 16}, false},
+		{"integral floats", "f6: {width: 12.0, height: 1e1}", []uint16{F6, 12, 10}, false},
+		{"large value", "f6: {width: 65535, height: 0}", []uint16{F6, 65535, 0}, false},
+		{"missing height", "box: {width: 8}", []uint16{INIT_TEXT_BOX, 8}, false},
+		{"out of range", "box: {width: 65536, height: 1}", nil, true},
+		{"negative", "tail: {width: -1, height: 1}", nil, true},
+		{"fractional", "box: {width: 1.5, height: 1}", nil, true},
+		{"not a number", "f6: {width: wide, height: 1}", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var item map[string]interface{}
+			if err := yaml.Unmarshal([]byte(tt.yaml), &item); err != nil {
+				t.Fatalf("yaml.Unmarshal() failed: %v", err)
+			}
+
+			got, _, err := NewWFMEncoder().processContentItem(item, 16, nil, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("processContentItem() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("processContentItem() = %04X, want %04X", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("processContentItem()[%d] = %04X, want %04X", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestWFMFileEncoder_ControlArgs_RoundTrip(t *testing.T) {
+	encoder := NewWFMEncoder()
+	for _, code := range ControlCodes() {
+		if code.Content == "" {
+			continue
+		}
+
+		params := make(map[string]interface{}, len(code.Params))
+		inline := []string{tagName(code.Tag)}
+		want := []uint16{code.Value}
+		for i, param := range code.Params {
+			params[param] = 30 + i
+			inline = append(inline, fmt.Sprint(30+i))
+			want = append(want, uint16(30+i))
+		}
+		inlineTag := "[" + strings.Join(inline, " ") + "]"
+
+		structured, _, err := encoder.processContentItem(map[string]interface{}{code.Content: params}, 16, nil, 0)
+		if err != nil {
+			t.Fatalf("processContentItem(%s) failed: %v", code.Content, err)
+		}
+		if !reflect.DeepEqual(structured, want) {
+			t.Errorf("processContentItem(%s) = %04X, want %04X", code.Content, structured, want)
+		}
+		text, _, err := encoder.processTextContent(inlineTag, 16, nil, 0)
+		if err != nil {
+			t.Fatalf("processTextContent(%q) failed: %v", inlineTag, err)
+		}
+		if !reflect.DeepEqual(text, want) {
+			t.Errorf("processTextContent(%q) = %04X, want %04X", inlineTag, text, want)
+		}
+
+		// Both representations decode back to the structured item
+		rawData := make([]byte, 0, 2*len(want)+2)
+		for _, value := range append(want, TERMINATOR_2) {
+			rawData = binary.LittleEndian.AppendUint16(rawData, value)
+		}
+		content, _, _, _, _ := processDialogueText(rawData, nil, nil, false)
+		if len(content) != 1 || !reflect.DeepEqual(content[0][code.Content], params) {
+			t.Errorf("decoded %s = %v, want %v", inlineTag, content, params)
+		}
+	}
+}
+
+func TestWFMFileEncoder_InlineControlArgs(t *testing.T) {
+	glyphEncodeMap := map[int]map[rune]uint16{16: {'A': 0x8000, 'B': 0x8001}}
+
+	tests := []struct {
+		text    string
+		want    []uint16
+		wantErr bool
+	}{
+		{"A[PAUSE FOR 30]B", []uint16{0x8000, PAUSE_FOR, 30, 0x8001}, false},
+		{"[INIT TEXT BOX 0x10  2]", []uint16{INIT_TEXT_BOX, 16, 2}, false},
+		{"[CHANGE COLOR TO red]", nil, true},
+		{"[PAUSE FOR 1 2]", nil, true},
+		{"[PAUSE FOR -1]", nil, true},
+		{"[PAUSE FOR 65536]", nil, true},
+	}
+
+	for _, tt := range tests {
+		got, _, err := NewWFMEncoder().processTextContent(tt.text, 16, glyphEncodeMap, 0)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("processTextContent(%q) error = %v, wantErr %v", tt.text, err, tt.wantErr)
+			continue
+		}
+		if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("processTextContent(%q) = %04X, want %04X", tt.text, got, tt.want)
+		}
+	}
+
+	if got := NewWFMEncoder().cleanTextForGlyphMapping("A[PAUSE FOR 30]B[F6 1 2][HALT]"); got != "AB" {
+		t.Errorf("cleanTextForGlyphMapping() = %q, want %q", got, "AB")
+	}
+}
+
+func TestWFMFileEncoder_ProcessContentItem_ParamOrder(t *testing.T) {
+	item := map[string]interface{}{"box": map[string]interface{}{"height": 3}}
+	if _, _, err := NewWFMEncoder().processContentItem(item, 16, nil, 0); err == nil {
+		t.Error("processContentItem() should reject a box height without width")
+	}
+	item = map[string]interface{}{"pause": 30}
+	if _, _, err := NewWFMEncoder().processContentItem(item, 16, nil, 0); err == nil {
+		t.Error("processContentItem() should reject a pause that is not a map")
+	}
+}
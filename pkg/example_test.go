@@ -0,0 +1,104 @@
+// Package pkg provides runnable examples of the library API
+package pkg_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// exampleWFM builds a minimal WFM file with one 8x8 glyph and one dialogue
+func exampleWFM() []byte {
+	var buffer bytes.Buffer
+	write := func(data interface{}) {
+		_ = binary.Write(&buffer, binary.LittleEndian, data)
+	}
+
+	// Header
+	buffer.WriteString(common.WFMFileMagic)
+	write(uint32(0))      // Padding
+	write(uint32(0x1000)) // DialoguePointerTable
+	write(uint16(1))      // TotalDialogues
+	write(uint16(1))      // TotalGlyphs
+	buffer.Write(make([]byte, 128))
+
+	// Glyph pointer table and glyph
+	write(uint16(0x2000))
+	write(uint16(0x1234))          // GlyphClut
+	write(uint16(8))               // GlyphHeight
+	write(uint16(8))               // GlyphWidth
+	write(uint16(0))               // GlyphHandakuten
+	buffer.Write(make([]byte, 32)) // 8x8 pixels at 4bpp
+
+	// Dialogue pointer table and dialogue
+	write(uint16(0x10))
+	write(uint16(0xFFFA)) // INIT_TEXT_BOX
+	write(uint16(0xFFFF)) // Terminator
+
+	return buffer.Bytes()
+}
+
+func ExampleWFMFileDecoder_Decode() {
+	decoder := pkg.NewWFMDecoder()
+
+	wfm, err := decoder.Decode(bytes.NewReader(exampleWFM()))
+	if err != nil {
+		fmt.Println("decode failed:", err)
+		return
+	}
+
+	glyph := wfm.Glyphs[0]
+	fmt.Printf("magic: %s\n", wfm.Header.Magic[:])
+	fmt.Printf("glyphs: %d, dialogues: %d\n", len(wfm.Glyphs), len(wfm.Dialogues))
+	fmt.Printf("glyph 0: %dx%d, clut 0x%04X\n", glyph.GlyphWidth, glyph.GlyphHeight, glyph.GlyphClut)
+	// Output:
+	// magic: WFM3
+	// glyphs: 1, dialogues: 1
+	// glyph 0: 8x8, clut 0x1234
+}
+
+func ExampleGAMProcessor_UnpackGAM() {
+	dir, err := os.MkdirTemp("", "gam-example")
+	if err != nil {
+		fmt.Println("failed to create temp dir:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	processor := pkg.NewGAMProcessor()
+	gamFile := filepath.Join(dir, "STAGE.GAM")
+	outputFile := filepath.Join(dir, "STAGE.BIN")
+
+	// Create a GAM archive from repetitive data so the LZ references kick in
+	original := bytes.Repeat([]byte("TOMBA!"), 64)
+	gam, err := processor.SaveGAM(context.Background(), original, gamFile)
+	if err != nil {
+		fmt.Println("pack failed:", err)
+		return
+	}
+
+	if err := processor.UnpackGAM(gamFile, outputFile); err != nil {
+		fmt.Println("unpack failed:", err)
+		return
+	}
+
+	unpacked, err := os.ReadFile(outputFile)
+	if err != nil {
+		fmt.Println("failed to read output:", err)
+		return
+	}
+
+	fmt.Printf("uncompressed size: %d\n", gam.Header.UncompressedSize)
+	fmt.Printf("compressed smaller: %t\n", len(gam.CompressedData) < len(original))
+	fmt.Printf("round trip matches: %t\n", bytes.Equal(unpacked, original))
+	// Output:
+	// uncompressed size: 384
+	// compressed smaller: true
+	// round trip matches: true
+}
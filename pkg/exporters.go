@@ -9,19 +9,54 @@ import (
 	"fmt"
 	"image"
 	"image/png"
+	"io"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
 	"github.com/hansbonini/tombatools/pkg/psx"
-	"gopkg.in/yaml.v3"
 )
 
 // WFMFileExporter implements the WFMExporter interface and provides
 // functionality to export WFM data to external formats (PNG, YAML).
-type WFMFileExporter struct{}
+type WFMFileExporter struct {
+	palettes      *PaletteSet // Project palettes used instead of the built-in CLUTs (nil uses the built-ins)
+	rawDialogues  bool        // Store the original bytes of every dialogue as hex
+	lineWidths    bool        // Store the measured line widths of every dialogue
+	pageBreaks    bool        // Write DOUBLE_NEWLINE as [PAGE] instead of a blank line
+	dialoguesOnly bool        // Map glyphs in memory instead of from the exported glyph PNGs
+
+	mergeExisting string               // Existing export the decoded dialogues are merged into (empty disables)
+	merge         *DialogueMergeReport // Merge report of the last export
+
+	speakerNames map[uint16]string // Names written next to the id of speaker items (nil writes ids only)
+
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
+
+// glyphPNGEncoder writes the glyph PNG files, reusing its compression buffers across
+// glyphs and concurrent exports
+var glyphPNGEncoder = &png.Encoder{BufferPool: &pngBufferPool{}}
+
+// pngBufferPool is a png.EncoderBufferPool safe for concurrent use
+type pngBufferPool struct {
+	pool sync.Pool
+}
+
+// Get returns a pooled encoder buffer, or nil to let the encoder allocate one
+func (p *pngBufferPool) Get() *png.EncoderBuffer {
+	buffer, _ := p.pool.Get().(*png.EncoderBuffer)
+	return buffer
+}
+
+// Put returns an encoder buffer to the pool
+func (p *pngBufferPool) Put(buffer *png.EncoderBuffer) {
+	p.pool.Put(buffer)
+}
 
 // NewWFMExporter creates a new WFM exporter instance.
 // Returns a pointer to a WFMFileExporter ready for use.
@@ -29,6 +64,11 @@ func NewWFMExporter() *WFMFileExporter {
 	return &WFMFileExporter{}
 }
 
+// SetLogger sets the logging configuration of the exporter (nil follows SetVerboseMode)
+func (e *WFMFileExporter) SetLogger(logger *common.Logger) {
+	e.logger = logger
+}
+
 // ExportGlyphs exports each glyph as an individual PNG file.
 // This function processes all glyphs in the WFM file and creates separate PNG images
 // for each glyph in a "glyphs" subdirectory within the output directory.
@@ -57,7 +97,7 @@ func (e *WFMFileExporter) validateGlyphCount(wfm *WFMFile) error {
 	expectedGlyphs := int(wfm.Header.TotalGlyphs)
 	actualGlyphs := len(wfm.Glyphs)
 	if actualGlyphs != expectedGlyphs {
-		return fmt.Errorf("glyph count mismatch: expected %d, got %d", expectedGlyphs, actualGlyphs)
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("glyph count mismatch: expected %d, got %d", expectedGlyphs, actualGlyphs))
 	}
 	return nil
 }
@@ -79,7 +119,7 @@ func (e *WFMFileExporter) exportAllGlyphs(wfm *WFMFile, glyphsDir string) int {
 func (e *WFMFileExporter) exportSingleGlyph(glyphIndex int, glyph Glyph, glyphsDir string) bool {
 	// Skip invalid glyphs
 	if !e.isValidGlyph(glyph) {
-		common.LogDebug(common.DebugGlyphSkipped, glyphIndex)
+		e.logger.Debug(common.DebugGlyphSkipped, glyphIndex)
 		return false
 	}
 
@@ -94,7 +134,7 @@ func (e *WFMFileExporter) exportSingleGlyph(glyphIndex int, glyph Glyph, glyphsD
 		return false
 	}
 
-	common.LogDebug(common.DebugGlyphExported,
+	e.logger.Debug(common.DebugGlyphExported,
 		glyphIndex, glyph.GlyphWidth, glyph.GlyphHeight,
 		glyph.GlyphClut, glyph.GlyphHandakuten, filename)
 	return true
@@ -102,7 +142,7 @@ func (e *WFMFileExporter) exportSingleGlyph(glyphIndex int, glyph Glyph, glyphsD
 
 // isValidGlyph checks if a glyph has valid data for export
 func (e *WFMFileExporter) isValidGlyph(glyph Glyph) bool {
-	return len(glyph.GlyphImage) > 0 && glyph.GlyphWidth > 0 && glyph.GlyphHeight > 0
+	return glyph.ImageSize() > 0 && glyph.GlyphWidth > 0 && glyph.GlyphHeight > 0
 }
 
 // convertGlyphToImage converts glyph data to image
@@ -112,52 +152,56 @@ func (e *WFMFileExporter) convertGlyphToImage(glyph Glyph) (image.Image, error)
 
 	palette := e.selectPalette(glyph)
 
+	imageData, err := glyph.Image()
+	if err != nil {
+		return nil, err
+	}
+
 	tile := &psx.PSXTile{
 		Width:   width,
 		Height:  height,
-		Data:    glyph.GlyphImage,
+		Data:    imageData,
 		Palette: palette,
 	}
 
+	// Glyphs keep their 4bpp palette indices; an RGBA copy of every glyph is not needed
 	processor := psx.NewPSXTileProcessor()
-	return processor.ConvertFromTile(tile)
+	return processor.ConvertFromTilePaletted(tile)
 }
 
-// selectPalette selects the appropriate palette based on glyph height
+// selectPalette selects the project palette of the glyph CLUT, falling back to the
+// built-in palette for the glyph height
 func (e *WFMFileExporter) selectPalette(glyph Glyph) psx.PSXPalette {
-	if glyph.GlyphHeight == 24 {
-		// Use EventClut for glyphs with height 24
-		return psx.NewPSXPalette(EventClut)
-	}
-	// Use DialogueClut for all other heights
-	return psx.NewPSXPalette(DialogueClut)
+	return glyphPalette(e.palettes, glyph.GlyphClut, int(glyph.GlyphHeight))
+}
+
+// SetPalettes sets the project palettes used to render glyphs (nil uses the built-in CLUTs)
+func (e *WFMFileExporter) SetPalettes(set *PaletteSet) {
+	e.palettes = set
 }
 
 // saveGlyphImage saves the glyph image as PNG file
 func (e *WFMFileExporter) saveGlyphImage(glyphImg image.Image, glyphsDir, filename string, glyphIndex int) error {
 	pngFile := filepath.Join(glyphsDir, filename)
-	file, err := os.Create(pngFile)
+	file, err := common.CreateOutput(pngFile)
 	if err != nil {
 		return fmt.Errorf("failed to create PNG file for glyph %d: %w", glyphIndex, err)
 	}
 	defer file.Close()
 
-	if err := png.Encode(file, glyphImg); err != nil {
+	if err := glyphPNGEncoder.Encode(file, glyphImg); err != nil {
 		return fmt.Errorf("failed to encode PNG for glyph %d: %w", glyphIndex, err)
 	}
 
 	return nil
 }
 
-// DialoguesYAML represents the complete dialogues structure for YAML export
-type DialoguesYAML struct {
-	TotalDialogues int             `yaml:"total_dialogues"`
-	OriginalSize   int64           `yaml:"original_size"`
-	Dialogues      []DialogueEntry `yaml:"dialogues"`
-}
+// DialoguesYAML is the content of a dialogue YAML file
+type DialoguesYAML = dialogueyaml.File
 
 // processDialogueText processes dialogue text using the new content-based structure
-func processDialogueText(rawData []byte, glyphMapping map[uint16]string, glyphs []Glyph) (content []map[string]interface{}, entryType string, fontHeight int, fontClut, terminator uint16) {
+// and writes DOUBLE_NEWLINE as [PAGE] when pageBreaks is set
+func processDialogueText(rawData []byte, glyphMapping map[uint16]string, glyphs []Glyph, pageBreaks bool) (content []map[string]interface{}, entryType string, fontHeight int, fontClut, terminator uint16) {
 	processor := &dialogueTextProcessor{
 		content:            make([]map[string]interface{}, 0),
 		currentText:        "",
@@ -167,6 +211,7 @@ func processDialogueText(rawData []byte, glyphMapping map[uint16]string, glyphs
 		terminator:         0xFFFF,
 		glyphMapping:       glyphMapping,
 		glyphs:             glyphs,
+		pageBreaks:         pageBreaks,
 	}
 
 	processor.processRawData(rawData)
@@ -183,6 +228,7 @@ type dialogueTextProcessor struct {
 	terminator         uint16
 	glyphMapping       map[uint16]string
 	glyphs             []Glyph
+	pageBreaks         bool
 }
 
 // addTextContent adds current text to content if it exists
@@ -244,10 +290,29 @@ func (p *dialogueTextProcessor) handleSpecialCommands(glyphID uint16, rawData []
 	case TERMINATOR_1, TERMINATOR_2:
 		return 0, true
 	default:
+		// Other codes with args, such as the name tag family, follow the code table
+		if code, found := LookupControlCode(glyphID); found && code.Args > 0 && code.Content != "" {
+			return p.handleControlCodeArgs(code, rawData, i), false
+		}
 		return 0, false
 	}
 }
 
+// handleControlCodeArgs writes a code with args as its structured content item, keyed
+// by the params of the code table. Args cut off by the end of the data are left out.
+func (p *dialogueTextProcessor) handleControlCodeArgs(code ControlCode, rawData []byte, i int) int {
+	// Add current text before adding the code
+	p.addTextContent()
+	params := make(map[string]interface{}, code.Args)
+	for arg := 0; arg < code.Args && i+4+arg*2 <= len(rawData); arg++ {
+		params[code.Params[arg]] = int(binary.LittleEndian.Uint16(rawData[i+2+arg*2 : i+4+arg*2]))
+	}
+	p.content = append(p.content, map[string]interface{}{
+		code.Content: params,
+	})
+	return len(params) * 2 // Skip the arg bytes
+}
+
 // handleInitTextBox handles INIT_TEXT_BOX command
 func (p *dialogueTextProcessor) handleInitTextBox(rawData []byte, i int) int {
 	p.entryType = "dialogue" // Set type to dialogue when INIT TEXT BOX is found
@@ -417,100 +482,34 @@ func (p *dialogueTextProcessor) handleSpecialGlyphID(glyphID uint16) {
 	case C04E:
 		p.currentText += TriangleRight
 	default:
+		// Codes of the table in the glyph range, such as the name tag family
+		if code, found := LookupControlCode(glyphID); found && code.DecodedText() != "" {
+			p.currentText += code.DecodedText()
+			return
+		}
 		p.currentText += fmt.Sprintf("[%04X]", glyphID)
 	}
 }
 
 // handleSpecialCharacter handles special control codes
 func (p *dialogueTextProcessor) handleSpecialCharacter(glyphID uint16) {
-	switch glyphID {
-	case C04D:
-		p.currentText += "▼" // Unicode down-pointing triangle for C04D
-	case C04E:
-		p.currentText += "⏷" // Unicode down-pointing triangle for C04E
-	case WAIT_FOR_INPUT:
-		p.currentText += "⧗" // Unicode hourglass for WAIT_FOR_INPUT
-	case NEWLINE:
-		p.currentText += "\n"
-	case DOUBLE_NEWLINE:
-		p.currentText += "\n\n"
-	default:
-		specialCode := getSpecialCharacterCode(glyphID)
-		p.currentText += specialCode
+	if glyphID == DOUBLE_NEWLINE && p.pageBreaks {
+		p.currentText += PageBreakTag
+		return
 	}
+	p.currentText += getSpecialCharacterCode(glyphID)
 }
 
 // getSpecialCharacterCode returns the formatted string for special control codes
 func getSpecialCharacterCode(code uint16) string {
-	// Handle control flow codes
-	if controlCode := getControlFlowCode(code); controlCode != "" {
-		return controlCode
-	}
-
-	// Handle command codes with arguments
-	if commandCode := getCommandCode(code); commandCode != "" {
-		return commandCode
-	}
-
-	// Handle formatting codes
-	if formatCode := getFormattingCode(code); formatCode != "" {
-		return formatCode
+	if controlCode, found := LookupControlCode(code); found && controlCode.DecodedText() != "" {
+		return controlCode.DecodedText()
 	}
 
 	// Handle unknown codes
 	return fmt.Sprintf("<%04X>", code)
 }
 
-// getControlFlowCode returns control flow codes like HALT, PROMPT
-func getControlFlowCode(code uint16) string {
-	switch code {
-	case HALT:
-		return "[HALT]"
-	case PROMPT:
-		return "[PROMPT]"
-	case WAIT_FOR_INPUT:
-		return "[WAIT FOR INPUT]"
-	default:
-		return ""
-	}
-}
-
-// getCommandCode returns command codes with arguments
-func getCommandCode(code uint16) string {
-	switch code {
-	case FFF2:
-		return "[FFF2]" // args: 1
-	case F4:
-		return "[F4]"
-	case F6:
-		return "[F6]" // args: 2
-	case CHANGE_COLOR_TO:
-		return "[CHANGE COLOR TO]" // args: 1
-	case INIT_TAIL:
-		return "[INIT TAIL]" // args: 2
-	case PAUSE_FOR:
-		return "[PAUSE FOR]" // args: 1
-	default:
-		return ""
-	}
-}
-
-// getFormattingCode returns formatting codes like newlines and special characters
-func getFormattingCode(code uint16) string {
-	switch code {
-	case DOUBLE_NEWLINE:
-		return "\n\n"
-	case NEWLINE:
-		return "\n" // Convert [NEWLINE] to actual newline
-	case C04D:
-		return "[C04D]"
-	case C04E:
-		return "[C04E]"
-	default:
-		return ""
-	}
-}
-
 // ExportDialogues exports all dialogue entries from a WFM file to a YAML file.
 // This function processes dialogue data, extracts text content with special control codes,
 // and exports it as a structured YAML file with metadata.
@@ -524,13 +523,19 @@ func (e *WFMFileExporter) ExportDialogues(wfm *WFMFile, outputDir string) error
 	expectedDialogues := int(wfm.Header.TotalDialogues)
 	actualDialogues := len(wfm.Dialogues)
 	if actualDialogues != expectedDialogues {
-		return fmt.Errorf("dialogue count mismatch: expected %d, got %d", expectedDialogues, actualDialogues)
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("dialogue count mismatch: expected %d, got %d", expectedDialogues, actualDialogues))
 	}
 
 	// Build glyph hash to character mapping from font files for text decoding
 	glyphsDir := filepath.Join(outputDir, "glyphs")
-	fontDir := "fonts" // User should have a 'fonts' directory with character-named PNG files
-	glyphMapping, err := e.buildGlyphMapping(glyphsDir, fontDir)
+	fontDir := DefaultFontDir // User should have a 'fonts' directory with character-named PNG files
+	var glyphMapping map[uint16]string
+	var err error
+	if e.dialoguesOnly {
+		glyphMapping, err = e.buildGlyphMappingFromGlyphs(wfm.Glyphs, fontDir)
+	} else {
+		glyphMapping, err = e.buildGlyphMapping(glyphsDir, fontDir)
+	}
 	if err != nil {
 		common.LogWarn(common.WarnCouldNotBuildGlyphMapping, err)
 		common.LogWarn(common.WarnDialoguesWithoutDecoding)
@@ -540,26 +545,28 @@ func (e *WFMFileExporter) ExportDialogues(wfm *WFMFile, outputDir string) error
 	dialogueEntries := make([]DialogueEntry, 0, len(wfm.Dialogues))
 	for i, dialogue := range wfm.Dialogues {
 		// Process dialogue text using the new content-based structure
-		content, dialogueType, fontHeight, fontClut, terminator := processDialogueText(dialogue.Data, glyphMapping, wfm.Glyphs)
-
-		// Convert terminator from hex value to simple 1 or 2
-		var terminatorValue uint16
-		switch terminator {
-		case 0xFFFE: // TERMINATOR_1
-			terminatorValue = 1
-		case 0xFFFF: // TERMINATOR_2
-			terminatorValue = 2
-		default:
-			terminatorValue = 2 // Default to TERMINATOR_2
+		content, dialogueType, fontHeight, fontClut, terminator := processDialogueText(dialogue.Data, glyphMapping, wfm.Glyphs, e.pageBreaks)
+		if e.speakerNames != nil {
+			nameSpeakers(content, e.speakerNames)
 		}
 
 		dialogueEntry := DialogueEntry{
-			ID:         i,
-			Type:       dialogueType,
-			FontHeight: fontHeight,
-			FontClut:   fontClut,
-			Terminator: terminatorValue,
-			Content:    content,
+			ID:          i,
+			Type:        dialogueType,
+			FontHeight:  fontHeight,
+			FontClut:    fontClut,
+			Terminator:  TerminatorFromCode(terminator),
+			Content:     content,
+			Fingerprint: DialogueFingerprint(content),
+		}
+		if fontClut != 0 {
+			dialogueEntry.Palette = glyphPaletteName(e.palettes, fontClut, fontHeight)
+		}
+		if e.rawDialogues {
+			dialogueEntry.Raw = FormatRawDialogue(dialogue.Data)
+		}
+		if e.lineWidths {
+			dialogueEntry.Widths = newDialogueWidths(dialogue.Data, wfm.Glyphs)
 		}
 		dialogueEntries = append(dialogueEntries, dialogueEntry)
 	}
@@ -572,7 +579,7 @@ func (e *WFMFileExporter) ExportDialogues(wfm *WFMFile, outputDir string) error
 		for _, specialID := range specialDialogueIDs {
 			if dialogueEntries[i].ID == specialID {
 				dialogueEntries[i].Special = true
-				common.LogDebug(common.DebugDialogueMarkedSpecial, specialID)
+				e.logger.Debug(common.DebugDialogueMarkedSpecial, specialID)
 				break
 			}
 		}
@@ -580,30 +587,50 @@ func (e *WFMFileExporter) ExportDialogues(wfm *WFMFile, outputDir string) error
 
 	// Create YAML structure
 	dialoguesYAML := DialoguesYAML{
-		TotalDialogues: expectedDialogues,
-		OriginalSize:   wfm.OriginalSize,
-		Dialogues:      dialogueEntries,
+		TotalDialogues:    expectedDialogues,
+		OriginalSize:      wfm.OriginalSize,
+		PlaceholderGlyphs: e.collectPlaceholderGlyphs(wfm),
+		Dialogues:         dialogueEntries,
 	}
-
-	// Export to YAML file in output root directory
-	yamlFile := filepath.Join(outputDir, "dialogues.yaml")
-	yamlWriter, err := os.Create(yamlFile)
-	if err != nil {
-		return fmt.Errorf("failed to create YAML file: %w", err)
+	if e.pageBreaks {
+		dialoguesYAML.DoubleNewline = DoubleNewlineAsPage
+	}
+	if e.lineWidths && glyphMapping != nil {
+		dialoguesYAML.GlyphWidths = glyphWidthTable(glyphMapping, wfm.Glyphs)
 	}
-	defer yamlWriter.Close()
 
-	encoder := yaml.NewEncoder(yamlWriter)
-	encoder.SetIndent(2)
+	// Keep the translations of the existing export whose original text is unchanged
+	if e.mergeExisting != "" {
+		if e.merge, err = mergeExistingDialogues(&dialoguesYAML, e.mergeExisting); err != nil {
+			return err
+		}
+	}
 
-	if err := encoder.Encode(dialoguesYAML); err != nil {
-		return fmt.Errorf("failed to encode YAML: %w", err)
+	// Export to YAML file in output root directory
+	yamlFile := filepath.Join(outputDir, "dialogues.yaml")
+	if err := dialogueyaml.Write(yamlFile, &dialoguesYAML); err != nil {
+		return err
 	}
 
 	common.LogInfo(common.InfoDialoguesExported, len(dialogueEntries), yamlFile)
 	return nil
 }
 
+// collectPlaceholderGlyphs returns the indices of empty placeholder glyphs so
+// the encoder can reserve the same slots when rebuilding the WFM file
+func (e *WFMFileExporter) collectPlaceholderGlyphs(wfm *WFMFile) []int {
+	var placeholders []int
+	for glyphIndex, glyph := range wfm.Glyphs {
+		if glyph.IsPlaceholder() {
+			placeholders = append(placeholders, glyphIndex)
+		}
+	}
+	if len(placeholders) > 0 {
+		common.LogInfo(common.InfoPlaceholderGlyphsFound, len(placeholders))
+	}
+	return placeholders
+}
+
 // parseSpecialDialogues extracts special dialogue IDs from the Reserved section.
 // Special dialogues are marked differently in the WFM file structure and require
 // special handling during export and import operations.
@@ -633,7 +660,7 @@ func (e *WFMFileExporter) debugReservedSection(reservedData []byte) {
 	for i := 0; i < 32 && i < len(reservedData); i++ {
 		debugOutput += fmt.Sprintf(common.DebugReservedSectionHex, reservedData[i])
 	}
-	common.LogDebug(common.DebugReservedSectionBytes + debugOutput)
+	e.logger.Debug(common.DebugReservedSectionBytes + debugOutput)
 }
 
 // isAllZero checks if all bytes in the data are zero
@@ -653,7 +680,7 @@ func (e *WFMFileExporter) extractSpecialDialogueIDs(reservedData []byte, totalDi
 	// Handle special case where dialogue 0 should be included
 	if e.shouldIncludeDialogueZero(reservedData) {
 		specialIDs = append(specialIDs, 0)
-		common.LogDebug(common.DebugDialogueZeroIncluded)
+		e.logger.Debug(common.DebugDialogueZeroIncluded)
 	}
 
 	// Parse uint16 IDs stored in little endian format
@@ -758,6 +785,44 @@ func (e *WFMFileExporter) buildGlyphMapping(glyphsDir, fontDir string) (map[uint
 	return mapping, nil
 }
 
+// buildGlyphMappingFromGlyphs matches decoded glyphs against reference font files
+// in memory, without exporting them as PNG files first
+func (e *WFMFileExporter) buildGlyphMappingFromGlyphs(glyphs []Glyph, fontDir string) (map[uint16]string, error) {
+	if _, err := os.Stat(fontDir); os.IsNotExist(err) {
+		return nil, fmt.Errorf("font directory '%s' does not exist", fontDir)
+	}
+
+	fontFiles, err := e.collectFontFiles(fontDir)
+	if err != nil {
+		return nil, err
+	}
+
+	fontHashes, err := e.buildFontHashMap(fontFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	mapping := make(map[uint16]string)
+	for i, glyph := range glyphs {
+		if !e.isValidGlyph(glyph) {
+			continue
+		}
+		img, err := e.convertGlyphToImage(glyph)
+		if err != nil {
+			continue
+		}
+		hash, err := hashImage(img)
+		if err != nil {
+			continue
+		}
+		if charName, found := fontHashes[hash]; found {
+			mapping[uint16(i)] = charName
+		}
+	}
+
+	return mapping, nil
+}
+
 // collectFontFiles recursively collects PNG files from the font directory
 func (e *WFMFileExporter) collectFontFiles(fontDir string) ([]string, error) {
 	fontFiles := make([]string, 0)
@@ -821,7 +886,7 @@ func (e *WFMFileExporter) matchGlyphsToFonts(glyphsDir string, fontHashes map[st
 		glyphID, charName, found := e.processGlyphFile(glyphFile, fontHashes)
 		if found {
 			mapping[glyphID] = charName
-			common.LogDebug(common.DebugGlyphMapped, glyphID, charName)
+			e.logger.Debug(common.DebugGlyphMapped, glyphID, charName)
 		}
 	}
 
@@ -875,11 +940,23 @@ func (e *WFMFileExporter) calculateImageHash(imagePath string) (string, error) {
 	}
 	defer file.Close()
 
+	if err := common.CheckImageMemory(imagePath, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
 	img, err := png.Decode(file)
 	if err != nil {
 		return "", err
 	}
 
+	return hashImage(img)
+}
+
+// hashImage calculates a SHA256 hash of the pixel content of an image
+func hashImage(img image.Image) (string, error) {
 	// Calculate hash based on image pixel content
 	hasher := sha256.New()
 	bounds := img.Bounds()
@@ -927,6 +1004,9 @@ func (e *WFMFileExporter) calculateImageHash(imagePath string) (string, error) {
 type WFMFileProcessor struct {
 	*WFMFileDecoder
 	*WFMFileExporter
+	unmappedLog string         // Dictionary file unmapped codes are recorded in (empty disables)
+	salvage     bool           // Decode with DecodeSalvage and write a recovery report
+	recovery    *SalvageReport // Recovery report of the last salvaged file
 }
 
 // NewWFMProcessor creates a new WFM processor with both decoder and exporter
@@ -937,6 +1017,13 @@ func NewWFMProcessor() *WFMFileProcessor {
 	}
 }
 
+// SetLogger sets the logging configuration of the decoder and the exporter (nil follows
+// SetVerboseMode)
+func (p *WFMFileProcessor) SetLogger(logger *common.Logger) {
+	p.WFMFileDecoder.SetLogger(logger)
+	p.WFMFileExporter.SetLogger(logger)
+}
+
 // Process handles the complete workflow of decoding and exporting a WFM file
 func (p *WFMFileProcessor) Process(inputFile, outputDir string) error {
 	// Open input file
@@ -953,8 +1040,15 @@ func (p *WFMFileProcessor) Process(inputFile, outputDir string) error {
 	}
 	originalSize := fileInfo.Size()
 
-	// Decode WFM file
-	wfm, err := p.Decode(file)
+	// Decode WFM file, skipping unreadable items in salvage mode. Glyph images are read
+	// from the file on demand; it stays open until Process returns.
+	var wfm *WFMFile
+	p.SetLazyGlyphs(true)
+	if p.salvage {
+		wfm, err = p.salvageDecode(file, originalSize)
+	} else {
+		wfm, err = p.Decode(file)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to decode WFM file: %w", err)
 	}
@@ -967,9 +1061,30 @@ func (p *WFMFileProcessor) Process(inputFile, outputDir string) error {
 		return fmt.Errorf("failed to create output directory: %w", err)
 	}
 
+	// List what could not be rescued next to the decoded files
+	if p.recovery != nil {
+		if err := WriteSalvageReport(filepath.Join(outputDir, DefaultRecoveryReportFile), p.recovery); err != nil {
+			return err
+		}
+	}
+
+	// Use the palettes discovered for this project, if any
+	if p.palettes == nil {
+		palettes, err := LoadProjectPalettes(outputDir)
+		if err != nil {
+			return err
+		}
+		if palettes != nil {
+			common.LogInfo("Using %d project palettes from %s", len(palettes.Palettes), DefaultPaletteFile)
+		}
+		p.SetPalettes(palettes)
+	}
+
 	// Export glyphs
-	if err := p.ExportGlyphs(wfm, outputDir); err != nil {
-		return fmt.Errorf("failed to export glyphs: %w", err)
+	if !p.dialoguesOnly {
+		if err := p.ExportGlyphs(wfm, outputDir); err != nil {
+			return fmt.Errorf("failed to export glyphs: %w", err)
+		}
 	}
 
 	// Export dialogues
@@ -977,5 +1092,38 @@ func (p *WFMFileProcessor) Process(inputFile, outputDir string) error {
 		return fmt.Errorf("failed to export dialogues: %w", err)
 	}
 
+	// Record unmapped codes of the exported dialogues in the project dictionary
+	if p.unmappedLog != "" {
+		dialogues, err := dialogueyaml.Read(filepath.Join(outputDir, "dialogues.yaml"))
+		if err != nil {
+			return err
+		}
+		if err := RecordUnmappedCodes(p.unmappedLog, filepath.Base(inputFile), dialogues.Dialogues); err != nil {
+			return fmt.Errorf("failed to record unmapped codes: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// SetDialoguesOnly makes Process skip the glyph PNG export; ExportDialogues then maps
+// the glyphs to characters in memory
+func (e *WFMFileExporter) SetDialoguesOnly(enabled bool) {
+	e.dialoguesOnly = enabled
+}
+
+// SetMergeExisting makes ExportDialogues merge the decoded dialogues into the existing export
+// at path instead of overwriting it (see MergeDialogues; empty disables)
+func (e *WFMFileExporter) SetMergeExisting(path string) {
+	e.mergeExisting = path
+}
+
+// MergeReport returns the merge report of the last export (nil without SetMergeExisting)
+func (e *WFMFileExporter) MergeReport() *DialogueMergeReport {
+	return e.merge
+}
+
+// SetUnmappedLog sets the dictionary file unmapped codes are recorded in (empty disables)
+func (p *WFMFileProcessor) SetUnmappedLog(path string) {
+	p.unmappedLog = path
+}
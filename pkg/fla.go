@@ -0,0 +1,382 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the public File Link Address (FLA) API: constructors, the
+// difference model applied to tables, and JSON/YAML serialization so external
+// build systems can compute and apply FLA changes without the CLI.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// FLA document serialization formats
+const (
+	FLAFormatJSON = "json"
+	FLAFormatYAML = "yaml"
+)
+
+// FLADocument bundles an FLA table with the differences that produced it
+type FLADocument struct {
+	Table       *FileLinkAddressTable `json:"table" yaml:"table"`
+	Differences []FLADifference       `json:"differences,omitempty" yaml:"differences,omitempty"`
+}
+
+// NewFileLinkAddressEntry creates an FLA entry for a file position and size
+func NewFileLinkAddressEntry(timecode MSFTimecode, fileSize uint32) FileLinkAddressEntry {
+	return FileLinkAddressEntry{
+		Timecode:        timecode,
+		FileSize:        fileSize,
+		TimecodeDecimal: timecode.ToDecimalString(),
+	}
+}
+
+// NewFileLinkAddressTable creates an FLA table from its entries and executable offset
+func NewFileLinkAddressTable(offset uint32, entries []FileLinkAddressEntry) (*FileLinkAddressTable, error) {
+	count, err := common.SafeIntToUint32(len(entries))
+	if err != nil {
+		return nil, fmt.Errorf("too many FLA entries: %w", err)
+	}
+	return &FileLinkAddressTable{Entries: entries, Offset: offset, Count: count}, nil
+}
+
+// NewFLAComparisonResult wraps a list of differences in a comparison result
+func NewFLAComparisonResult(differences []FLADifference) *FLAComparisonResult {
+	return &FLAComparisonResult{Differences: differences, TotalChanges: len(differences)}
+}
+
+// Validate checks that Count matches the entries of the table
+func (t *FileLinkAddressTable) Validate() error {
+	if int(t.Count) != len(t.Entries) {
+		return fmt.Errorf("FLA table count %d does not match %d entries", t.Count, len(t.Entries))
+	}
+	return nil
+}
+
+// Clone returns a deep copy of the table, so differences can be applied to the copy
+func (t *FileLinkAddressTable) Clone() *FileLinkAddressTable {
+	clone := &FileLinkAddressTable{Offset: t.Offset, Count: t.Count, Entries: make([]FileLinkAddressEntry, len(t.Entries))}
+	copy(clone.Entries, t.Entries)
+	if t.Files != nil {
+		clone.Files = append([]CDFileInfo(nil), t.Files...)
+	}
+	for i := range clone.Entries {
+		if linked := clone.Entries[i].LinkedFile; linked != nil {
+			linkedCopy := *linked
+			clone.Entries[i].LinkedFile = &linkedCopy
+		}
+	}
+	return clone
+}
+
+// Sectors returns the number of sectors the file occupies. Directory records count 2048
+// bytes per sector for every file, Form 2 and CD-DA files included.
+func (f *CDFileInfo) Sectors() uint32 {
+	return psx.DataSectors(f.Size)
+}
+
+// FLASize returns the file size expressed in the data bytes per sector of the file: the
+// directory record size for Form 1 files, whole sectors of 2336 or 2352 bytes for Form 2
+// and CD-DA files
+func (f *CDFileInfo) FLASize() uint32 {
+	if f.SectorPayload == 0 || f.SectorPayload == psx.CD_DATA_SIZE {
+		return f.Size
+	}
+	return f.Sectors() * f.SectorPayload
+}
+
+// MatchesFLASize reports whether an FLA size describes the file, either as the directory
+// record size or expressed in the data bytes per sector of the file
+func (f *CDFileInfo) MatchesFLASize(size uint32) bool {
+	return size == f.Size || size == f.FLASize()
+}
+
+// cdFileSizeChanged reports whether a file changed size between two images. Form 2 and
+// CD-DA files are compared in sectors, since their byte sizes depend on how the image
+// builder expressed them.
+func cdFileSizeChanged(original, modified *CDFileInfo) bool {
+	if original.FLASize() != original.Size || modified.FLASize() != modified.Size {
+		return original.Sectors() != modified.Sectors()
+	}
+	return original.Size != modified.Size
+}
+
+// flaDifferenceSizes returns the sizes of a changed file as the FLA entry expresses them:
+// in the data bytes per sector of the file when the entry did so in the original image,
+// otherwise as directory record sizes. payload is 0 for directory record sizes.
+func flaDifferenceSizes(entry FileLinkAddressEntry, original, modified *CDFileInfo) (originalSize, modifiedSize, payload uint32) {
+	if entry.FileSize != original.Size && entry.FileSize == original.FLASize() {
+		return original.FLASize(), modified.FLASize(), original.SectorPayload
+	}
+	return original.Size, modified.Size, 0
+}
+
+// ApplyFLADifferences updates the modified table in memory from a list of differences.
+// Each difference sets the entry size to ModifiedSize and shifts the timecodes of the
+// following entries that are linked to a CD file by the accumulated change in sectors
+// occupied by the changed files, counted in SectorPayload bytes per sector.
+func ApplyFLADifferences(originalTable, modifiedTable *FileLinkAddressTable, differences []FLADifference) error {
+	if err := validateFLATables(originalTable, modifiedTable); err != nil {
+		return err
+	}
+
+	// Sort differences by entry index to process them in order
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].EntryIndex < differences[j].EntryIndex
+	})
+
+	// Calculate cumulative sector offset for each file change
+	var sectorOffset int64 = 0
+
+	for _, diff := range differences {
+		if diff.EntryIndex >= originalTable.Count {
+			return fmt.Errorf("FLA difference index %d out of range (count %d)", diff.EntryIndex, originalTable.Count)
+		}
+
+		originalEntry := originalTable.Entries[diff.EntryIndex]
+		modifiedEntry := &modifiedTable.Entries[diff.EntryIndex]
+
+		// Calculate size difference; the following files move by whole sectors
+		sizeDiff := int64(diff.ModifiedSize) - int64(diff.OriginalSize)
+		sectorOffset += int64(psx.PayloadSectors(diff.ModifiedSize, diff.SectorPayload)) -
+			int64(psx.PayloadSectors(diff.OriginalSize, diff.SectorPayload))
+
+		common.LogDebug("Entry %04X: Size changed by %d bytes, cumulative offset: %d sectors",
+			diff.EntryIndex, sizeDiff, sectorOffset)
+
+		// Update the file size in the current entry
+		modifiedEntry.FileSize = diff.ModifiedSize
+		common.LogDebug("Updated entry %04X: FileSize %d -> %d",
+			diff.EntryIndex, originalEntry.FileSize, modifiedEntry.FileSize)
+
+		// Update MSF positions for all subsequent entries. Files that moved are no longer
+		// linked in the modified image, so links from the original image count too.
+		for i := diff.EntryIndex + 1; i < originalTable.Count; i++ {
+			if originalTable.Entries[i].LinkedFile == nil && modifiedTable.Entries[i].LinkedFile == nil {
+				continue
+			}
+
+			originalMSF := originalTable.Entries[i].Timecode
+
+			// Calculate new MSF by adding sector offset
+			newTotalSectors := int64(originalMSF.ToSectors()) + sectorOffset
+			if newTotalSectors < 0 {
+				newTotalSectors = 0
+			}
+
+			// Convert back to MSF
+			newMSF := MSFFromSectors(uint32(newTotalSectors))
+			modifiedTable.Entries[i].Timecode = newMSF
+			modifiedTable.Entries[i].TimecodeDecimal = newMSF.ToDecimalString()
+
+			common.LogDebug("Updated entry %04X: MSF %s -> %s",
+				i, originalMSF.String(), newMSF.String())
+		}
+	}
+
+	return nil
+}
+
+// ApplyFLAAllocation updates the modified table in memory from a list of differences and
+// the files of both images. Sizes come from the differences as in ApplyFLADifferences, but
+// every timecode is moved to where its file really lies in the modified image, read from
+// the directory records, so alignment padding and Form 2 or CD-DA regions the builder
+// moved do not throw off the following entries. Tables without files (read from an FLA
+// document) fall back to ApplyFLADifferences.
+func ApplyFLAAllocation(originalTable, modifiedTable *FileLinkAddressTable, differences []FLADifference) error {
+	if originalTable.Files == nil || modifiedTable.Files == nil {
+		return ApplyFLADifferences(originalTable, modifiedTable, differences)
+	}
+	if err := validateFLATables(originalTable, modifiedTable); err != nil {
+		return err
+	}
+
+	for _, diff := range differences {
+		if diff.EntryIndex >= originalTable.Count {
+			return fmt.Errorf("FLA difference index %d out of range (count %d)", diff.EntryIndex, originalTable.Count)
+		}
+		modifiedTable.Entries[diff.EntryIndex].FileSize = diff.ModifiedSize
+		common.LogDebug("Updated entry %04X: FileSize %d -> %d",
+			diff.EntryIndex, originalTable.Entries[diff.EntryIndex].FileSize, diff.ModifiedSize)
+	}
+
+	allocation := newFLAAllocation(originalTable.Files, modifiedTable.Files)
+	for i := range originalTable.Entries {
+		originalMSF := originalTable.Entries[i].Timecode
+		sectors, ok := allocation.relocate(originalMSF.ToSectors())
+		if !ok {
+			continue
+		}
+
+		newMSF := MSFFromSectors(sectors)
+		modifiedTable.Entries[i].Timecode = newMSF
+		modifiedTable.Entries[i].TimecodeDecimal = newMSF.ToDecimalString()
+		if newMSF != originalMSF {
+			common.LogDebug("Updated entry %04X: MSF %s -> %s", i, originalMSF.String(), newMSF.String())
+		}
+	}
+
+	return nil
+}
+
+// validateFLATables checks that an original and a modified table can be compared entry by entry
+func validateFLATables(originalTable, modifiedTable *FileLinkAddressTable) error {
+	if err := originalTable.Validate(); err != nil {
+		return fmt.Errorf("invalid original table: %w", err)
+	}
+	if err := modifiedTable.Validate(); err != nil {
+		return fmt.Errorf("invalid modified table: %w", err)
+	}
+	if originalTable.Count != modifiedTable.Count {
+		return fmt.Errorf("FLA tables have different entry counts: original=%d, modified=%d",
+			originalTable.Count, modifiedTable.Count)
+	}
+	return nil
+}
+
+// flaAllocation maps positions of the original image to the modified image through the
+// files both images have
+type flaAllocation struct {
+	original []CDFileInfo          // Files of the original image ordered by LBA
+	modified map[string]CDFileInfo // Files of the modified image by path
+}
+
+// newFLAAllocation indexes the files of an original and a modified image
+func newFLAAllocation(originalFiles, modifiedFiles []CDFileInfo) *flaAllocation {
+	allocation := &flaAllocation{
+		original: append([]CDFileInfo(nil), originalFiles...),
+		modified: make(map[string]CDFileInfo, len(modifiedFiles)),
+	}
+	sort.SliceStable(allocation.original, func(i, j int) bool { return allocation.original[i].LBA < allocation.original[j].LBA })
+	for _, file := range modifiedFiles {
+		allocation.modified[file.FullPath] = file
+	}
+	return allocation
+}
+
+// relocate returns the absolute sector (pregap included) of the modified image holding
+// what the original image had at sectors. A position inside a file keeps its offset in
+// the file; a position in a gap no directory record reaches keeps its distance from the
+// end of the file before it. ok is false before the first file both images have.
+func (a *flaAllocation) relocate(sectors uint32) (uint32, bool) {
+	if sectors < psx.CD_PREGAP_SECTORS {
+		return 0, false
+	}
+	lba := sectors - psx.CD_PREGAP_SECTORS
+
+	for i := len(a.original) - 1; i >= 0; i-- {
+		original := a.original[i]
+		if original.LBA > lba {
+			continue
+		}
+		modified, found := a.modified[original.FullPath]
+		if !found {
+			// Removed file: what follows it moves with the file before it
+			continue
+		}
+
+		if end := original.LBA + original.Sectors(); lba >= end && lba > original.LBA {
+			return modified.LBA + modified.Sectors() + (lba - end) + psx.CD_PREGAP_SECTORS, true
+		}
+		return modified.LBA + (lba - original.LBA) + psx.CD_PREGAP_SECTORS, true
+	}
+	return 0, false
+}
+
+// MarshalText encodes the timecode as MM:SS:FF BCD digits (plus :UU if the unused byte is set)
+func (msf MSFTimecode) MarshalText() ([]byte, error) {
+	if msf.Unused != 0 {
+		return []byte(fmt.Sprintf("%s:%02X", msf.String(), msf.Unused)), nil
+	}
+	return []byte(msf.String()), nil
+}
+
+// UnmarshalText decodes a timecode written by MarshalText
+func (msf *MSFTimecode) UnmarshalText(text []byte) error {
+	parts := strings.Split(string(text), ":")
+	if len(parts) != 3 && len(parts) != 4 {
+		return fmt.Errorf("invalid MSF timecode %q: expected MM:SS:FF", string(text))
+	}
+
+	values := make([]byte, 4)
+	for i, part := range parts {
+		value, err := strconv.ParseUint(part, 16, 8)
+		if err != nil {
+			return fmt.Errorf("invalid MSF timecode %q: %w", string(text), err)
+		}
+		values[i] = byte(value)
+	}
+
+	*msf = MSFTimecode{Minutes: values[0], Seconds: values[1], Sectors: values[2], Unused: values[3]}
+	return nil
+}
+
+// FLAFormatFromPath selects the serialization format from a file extension
+func FLAFormatFromPath(path string) (string, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FLAFormatJSON, true
+	case ".yaml", ".yml":
+		return FLAFormatYAML, true
+	default:
+		return "", false
+	}
+}
+
+// WriteFLADocument serializes an FLA document as JSON or YAML
+func WriteFLADocument(document *FLADocument, format string, writer io.Writer) error {
+	switch format {
+	case FLAFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(document); err != nil {
+			return fmt.Errorf("failed to encode FLA document as JSON: %w", err)
+		}
+	case FLAFormatYAML:
+		encoder := yaml.NewEncoder(writer)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(document); err != nil {
+			return fmt.Errorf("failed to encode FLA document as YAML: %w", err)
+		}
+		if err := encoder.Close(); err != nil {
+			return fmt.Errorf("failed to encode FLA document as YAML: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported FLA document format: %s", format)
+	}
+	return nil
+}
+
+// ReadFLADocument parses an FLA document written by WriteFLADocument
+func ReadFLADocument(reader io.Reader, format string) (*FLADocument, error) {
+	document := &FLADocument{}
+
+	switch format {
+	case FLAFormatJSON:
+		if err := json.NewDecoder(reader).Decode(document); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse FLA document: %w", err))
+		}
+	case FLAFormatYAML:
+		if err := yaml.NewDecoder(reader).Decode(document); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse FLA document: %w", err))
+		}
+	default:
+		return nil, fmt.Errorf("unsupported FLA document format: %s", format)
+	}
+
+	if document.Table == nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("FLA document has no table"))
+	}
+	if err := document.Table.Validate(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+	return document, nil
+}
@@ -0,0 +1,229 @@
+// Package pkg provides tests for the public FLA table API
+package pkg
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// newLinkedTestTable builds an FLA table whose entries are linked to CD files
+func newLinkedTestTable(t *testing.T, sectors []uint32, sizes []uint32) *FileLinkAddressTable {
+	t.Helper()
+
+	entries := make([]FileLinkAddressEntry, len(sectors))
+	for i := range sectors {
+		entries[i] = NewFileLinkAddressEntry(MSFFromSectors(sectors[i]), sizes[i])
+		entries[i].LinkedFile = &CDFileInfo{Name: "FILE", Size: sizes[i]}
+	}
+
+	table, err := NewFileLinkAddressTable(0x1000, entries)
+	if err != nil {
+		t.Fatalf("NewFileLinkAddressTable() failed: %v", err)
+	}
+	return table
+}
+
+func TestMSFTimecode_TextRoundTrip(t *testing.T) {
+	tests := []struct {
+		msf  MSFTimecode
+		text string
+	}{
+		{MSFTimecode{0x00, 0x02, 0x16, 0x00}, "00:02:16"},
+		{MSFTimecode{0x12, 0x59, 0x74, 0x00}, "12:59:74"},
+		{MSFTimecode{0x00, 0x02, 0x00, 0x01}, "00:02:00:01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			text, err := tt.msf.MarshalText()
+			if err != nil {
+				t.Fatalf("MarshalText() failed: %v", err)
+			}
+			if string(text) != tt.text {
+				t.Errorf("MarshalText() = %q, want %q", text, tt.text)
+			}
+
+			var decoded MSFTimecode
+			if err := decoded.UnmarshalText(text); err != nil {
+				t.Fatalf("UnmarshalText() failed: %v", err)
+			}
+			if decoded != tt.msf {
+				t.Errorf("UnmarshalText(%q) = %+v, want %+v", text, decoded, tt.msf)
+			}
+		})
+	}
+
+	var invalid MSFTimecode
+	if err := invalid.UnmarshalText([]byte("00:02")); err == nil {
+		t.Error("UnmarshalText(\"00:02\") should fail")
+	}
+}
+
+func TestFLADocument_RoundTrip(t *testing.T) {
+	table := newLinkedTestTable(t, []uint32{150, 160}, []uint32{4096, 100})
+	document := &FLADocument{
+		Table: table,
+		Differences: []FLADifference{{
+			EntryIndex:       0,
+			SizeChanged:      true,
+			OriginalTimecode: table.Entries[0].Timecode,
+			ModifiedTimecode: table.Entries[0].Timecode,
+			OriginalSize:     4096,
+			ModifiedSize:     8192,
+		}},
+	}
+
+	for _, format := range []string{FLAFormatJSON, FLAFormatYAML} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := WriteFLADocument(document, format, &buf); err != nil {
+				t.Fatalf("WriteFLADocument() failed: %v", err)
+			}
+
+			decoded, err := ReadFLADocument(&buf, format)
+			if err != nil {
+				t.Fatalf("ReadFLADocument() failed: %v", err)
+			}
+
+			if decoded.Table.Count != 2 || decoded.Table.Offset != 0x1000 {
+				t.Errorf("table = count %d, offset 0x%X, want count 2, offset 0x1000", decoded.Table.Count, decoded.Table.Offset)
+			}
+			if decoded.Table.Entries[1].Timecode != table.Entries[1].Timecode {
+				t.Errorf("entry 1 timecode = %v, want %v", decoded.Table.Entries[1].Timecode, table.Entries[1].Timecode)
+			}
+			if len(decoded.Differences) != 1 || decoded.Differences[0].ModifiedSize != 8192 {
+				t.Errorf("differences = %+v, want one with modified size 8192", decoded.Differences)
+			}
+		})
+	}
+}
+
+func TestReadFLADocument_CountMismatch(t *testing.T) {
+	input := `{"table": {"entries": [], "offset": 0, "count": 3}}`
+	if _, err := ReadFLADocument(bytes.NewBufferString(input), FLAFormatJSON); err == nil {
+		t.Error("ReadFLADocument() should reject a count that does not match the entries")
+	}
+}
+
+func TestApplyFLADifferences(t *testing.T) {
+	original := newLinkedTestTable(t, []uint32{150, 152, 160}, []uint32{4096, 100, 100})
+	modified := original.Clone()
+
+	differences := []FLADifference{{EntryIndex: 0, SizeChanged: true, OriginalSize: 4096, ModifiedSize: 6000}}
+	if err := ApplyFLADifferences(original, modified, differences); err != nil {
+		t.Fatalf("ApplyFLADifferences() failed: %v", err)
+	}
+
+	if modified.Entries[0].FileSize != 6000 {
+		t.Errorf("entry 0 size = %d, want 6000", modified.Entries[0].FileSize)
+	}
+	// 6000 bytes take one sector more than 4096
+	for i, want := range []uint32{150, 153, 161} {
+		if got := modified.Entries[i].Timecode.ToSectors(); got != want {
+			t.Errorf("entry %d sectors = %d, want %d", i, got, want)
+		}
+	}
+	if original.Entries[1].Timecode.ToSectors() != 152 {
+		t.Error("ApplyFLADifferences() should not modify the original table")
+	}
+
+	outOfRange := []FLADifference{{EntryIndex: 5}}
+	if err := ApplyFLADifferences(original, modified, outOfRange); err == nil {
+		t.Error("ApplyFLADifferences() should reject an out-of-range entry index")
+	}
+}
+
+func TestCDFileSizeChanged_Form2(t *testing.T) {
+	form2 := func(size uint32) *CDFileInfo {
+		return &CDFileInfo{Name: "MOVIE.STR", Size: size, SectorPayload: psx.CD_XA_DATA_SIZE}
+	}
+
+	// Same 10 sectors, expressed by different image builders
+	if cdFileSizeChanged(form2(10*psx.CD_DATA_SIZE), form2(10*psx.CD_DATA_SIZE-100)) {
+		t.Error("cdFileSizeChanged() reported a Form 2 file with the same sector count")
+	}
+	if !cdFileSizeChanged(form2(10*psx.CD_DATA_SIZE), form2(11*psx.CD_DATA_SIZE)) {
+		t.Error("cdFileSizeChanged() missed a Form 2 file that grew by a sector")
+	}
+	if !cdFileSizeChanged(&CDFileInfo{Size: 100}, &CDFileInfo{Size: 101}) {
+		t.Error("cdFileSizeChanged() missed a Form 1 file that changed size")
+	}
+
+	file := form2(10 * psx.CD_DATA_SIZE)
+	if !file.MatchesFLASize(10*psx.CD_XA_DATA_SIZE) || !file.MatchesFLASize(10*psx.CD_DATA_SIZE) {
+		t.Error("MatchesFLASize() rejected a size of 10 Form 2 sectors")
+	}
+
+	entry := NewFileLinkAddressEntry(MSFFromSectors(150), 10*psx.CD_XA_DATA_SIZE)
+	originalSize, modifiedSize, payload := flaDifferenceSizes(entry, file, form2(12*psx.CD_DATA_SIZE))
+	if originalSize != 10*psx.CD_XA_DATA_SIZE || modifiedSize != 12*psx.CD_XA_DATA_SIZE || payload != psx.CD_XA_DATA_SIZE {
+		t.Errorf("flaDifferenceSizes() = %d, %d, %d, want sizes of 10 and 12 Form 2 sectors", originalSize, modifiedSize, payload)
+	}
+}
+
+func TestApplyFLADifferences_Form2(t *testing.T) {
+	original := newLinkedTestTable(t, []uint32{150, 160, 170}, []uint32{7 * psx.CD_XA_DATA_SIZE, 100, 100})
+	modified := original.Clone()
+
+	differences := []FLADifference{{
+		EntryIndex:    0,
+		SizeChanged:   true,
+		OriginalSize:  7 * psx.CD_XA_DATA_SIZE,
+		ModifiedSize:  8 * psx.CD_XA_DATA_SIZE,
+		SectorPayload: psx.CD_XA_DATA_SIZE,
+	}}
+	if err := ApplyFLADifferences(original, modified, differences); err != nil {
+		t.Fatalf("ApplyFLADifferences() failed: %v", err)
+	}
+
+	// One Form 2 sector more; counted in 2048-byte sectors the sizes would differ by two
+	for i, want := range []uint32{150, 161, 171} {
+		if got := modified.Entries[i].Timecode.ToSectors(); got != want {
+			t.Errorf("entry %d sectors = %d, want %d", i, got, want)
+		}
+	}
+}
+
+func TestApplyFLAAllocation(t *testing.T) {
+	// A grows by a sector and the builder aligns B to an even LBA; the gap after B
+	// keeps its length and C follows it
+	original := newLinkedTestTable(t, []uint32{150, 151, 152, 154, 155, 0}, []uint32{4096, 4096, 100, 100, 100, 0})
+	original.Files = []CDFileInfo{
+		{FullPath: "C.BIN", LBA: 5, Size: 100},
+		{FullPath: "A.BIN", LBA: 0, Size: 4096},
+		{FullPath: "B.BIN", LBA: 2, Size: 100},
+	}
+	modified := original.Clone()
+	modified.Files = []CDFileInfo{
+		{FullPath: "A.BIN", LBA: 0, Size: 6000},
+		{FullPath: "B.BIN", LBA: 4, Size: 100},
+		{FullPath: "C.BIN", LBA: 8, Size: 100},
+	}
+
+	differences := []FLADifference{{EntryIndex: 0, SizeChanged: true, OriginalSize: 4096, ModifiedSize: 6000}}
+	if err := ApplyFLAAllocation(original, modified, differences); err != nil {
+		t.Fatalf("ApplyFLAAllocation() failed: %v", err)
+	}
+
+	if modified.Entries[0].FileSize != 6000 {
+		t.Errorf("entry 0 size = %d, want 6000", modified.Entries[0].FileSize)
+	}
+	// Start of A, inside A, B, the gap after B, C and an entry before the pregap
+	for i, want := range []uint32{150, 151, 154, 156, 158, 0} {
+		if got := modified.Entries[i].Timecode.ToSectors(); got != want {
+			t.Errorf("entry %d sectors = %d, want %d", i, got, want)
+		}
+	}
+
+	// Tables read from documents have no files and shift by the size changes
+	original.Files = nil
+	modified = original.Clone()
+	if err := ApplyFLAAllocation(original, modified, differences); err != nil {
+		t.Fatalf("ApplyFLAAllocation() failed: %v", err)
+	}
+	if got := modified.Entries[2].Timecode.ToSectors(); got != 153 {
+		t.Errorf("entry 2 sectors without files = %d, want 153", got)
+	}
+}
@@ -0,0 +1,102 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the read-only FLA verification pass: the FLA table is read back from
+// the image and every entry that pointed at a file in the original image is resolved
+// against the directory records, catching offset math errors before a disc is burned.
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// FLA verification problems
+const (
+	FLAProblemNotWritten = "not-written"   // The table read back differs from the table written
+	FLAProblemUnlinked   = "unlinked"      // The timecode no longer points at the start of a file
+	FLAProblemWrongFile  = "wrong-file"    // The timecode points at another file than in the original image
+	FLAProblemSize       = "size-mismatch" // The size differs from the directory record of the file
+)
+
+// FLAVerificationIssue is an FLA entry that does not match the image
+type FLAVerificationIssue struct {
+	EntryIndex uint32      `json:"entry_index" yaml:"entry_index"`
+	Timecode   MSFTimecode `json:"timecode" yaml:"timecode"`   // Timecode read back from the image
+	FileSize   uint32      `json:"file_size" yaml:"file_size"` // Size read back from the image
+	File       string      `json:"file" yaml:"file"`           // File the entry pointed at in the original image
+	Problem    string      `json:"problem" yaml:"problem"`
+	Detail     string      `json:"detail" yaml:"detail"`
+}
+
+// FLAVerification is the result of verifying the FLA table of an image
+type FLAVerification struct {
+	Checked int                    `json:"checked" yaml:"checked"` // Entries resolved against the directory records
+	Issues  []FLAVerificationIssue `json:"issues" yaml:"issues"`
+}
+
+// OK reports whether every checked entry matches the image
+func (v *FLAVerification) OK() bool {
+	return len(v.Issues) == 0
+}
+
+// VerifyFLATable reads the FLA table back from an image and resolves every entry that
+// pointed at a file in the original image against the actual directory records. When
+// writtenTable is not nil, the table read back must also equal it. Sizes are only checked
+// for entries whose size matched their file in the original image, either as the directory
+// record size or in the data bytes per sector of a Form 2 or CD-DA file.
+func (p *FLAProcessor) VerifyFLATable(imagePath string, originalTable, writtenTable *FileLinkAddressTable) (*FLAVerification, error) {
+	table, err := p.AnalyzeCDImage(imagePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read back FLA table: %w", err)
+	}
+	if table.Count != originalTable.Count {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("FLA table read back has %d entries, the original has %d", table.Count, originalTable.Count))
+	}
+
+	verification := &FLAVerification{}
+	for i := range table.Entries {
+		entry := table.Entries[i]
+		index := uint32(i)
+		issue := func(problem, file, detail string) {
+			verification.Issues = append(verification.Issues, FLAVerificationIssue{
+				EntryIndex: index,
+				Timecode:   entry.Timecode,
+				FileSize:   entry.FileSize,
+				File:       file,
+				Problem:    problem,
+				Detail:     detail,
+			})
+		}
+
+		if writtenTable != nil {
+			written := writtenTable.Entries[i]
+			if entry.Timecode != written.Timecode || entry.FileSize != written.FileSize {
+				issue(FLAProblemNotWritten, "", fmt.Sprintf("image holds %s/%d, %s/%d was written",
+					entry.Timecode, entry.FileSize, written.Timecode, written.FileSize))
+				continue
+			}
+		}
+
+		original := originalTable.Entries[i]
+		if original.LinkedFile == nil {
+			continue
+		}
+		verification.Checked++
+
+		switch {
+		case entry.LinkedFile == nil:
+			issue(FLAProblemUnlinked, original.LinkedFile.FullPath,
+				fmt.Sprintf("no file starts at %s", entry.TimecodeDecimal))
+		case entry.LinkedFile.FullPath != original.LinkedFile.FullPath:
+			issue(FLAProblemWrongFile, original.LinkedFile.FullPath,
+				fmt.Sprintf("%s starts at %s", entry.LinkedFile.FullPath, entry.TimecodeDecimal))
+		case original.LinkedFile.MatchesFLASize(original.FileSize) && !entry.LinkedFile.MatchesFLASize(entry.FileSize):
+			issue(FLAProblemSize, original.LinkedFile.FullPath,
+				fmt.Sprintf("directory record size is %d bytes", entry.LinkedFile.Size))
+		}
+	}
+
+	p.logger.Debug("Verified %d FLA entries of %s: %d issues", verification.Checked, imagePath, len(verification.Issues))
+	return verification, nil
+}
@@ -0,0 +1,95 @@
+// Package pkg provides tests for the read-only FLA verification pass
+package pkg
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+func TestFLAProcessor_VerifyFLATable(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "disc.bin")
+	files, lbas := writeDisc(t, imagePath, []discFile{
+		{dir: "DATA", name: "A.BIN", data: make([]byte, 3000)},
+		{dir: "DATA", name: "B.BIN", data: make([]byte, 1000)},
+		{dir: "DATA", name: "C.BIN", data: make([]byte, 500)},
+	})
+
+	processor := NewFLAProcessor()
+	originalTable, err := processor.AnalyzeCDImage(imagePath)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage() failed: %v", err)
+	}
+
+	verification, err := processor.VerifyFLATable(imagePath, originalTable, originalTable)
+	if err != nil {
+		t.Fatalf("VerifyFLATable() failed: %v", err)
+	}
+	if !verification.OK() || verification.Checked != 3 {
+		t.Fatalf("VerifyFLATable(untouched) = %+v, want 3 checked entries and no issues", verification)
+	}
+
+	// A cumulative-offset error: A.BIN shifted into its own data, C.BIN pointing at A.BIN
+	// and B.BIN with a size that no longer matches its file
+	msf := func(file discFile, offset uint32) MSFTimecode {
+		return MSFFromSectors(lbas[file.path()] + offset + psx.CD_PREGAP_SECTORS)
+	}
+	broken, err := NewFileLinkAddressTable(originalTable.Offset, []FileLinkAddressEntry{
+		NewFileLinkAddressEntry(msf(files[1], 1), 3000),
+		NewFileLinkAddressEntry(msf(files[2], 0), 1001),
+		NewFileLinkAddressEntry(msf(files[1], 0), 500),
+	})
+	if err != nil {
+		t.Fatalf("NewFileLinkAddressTable() failed: %v", err)
+	}
+	if err := processor.WriteFLATableToCD(context.Background(), imagePath, broken); err != nil {
+		t.Fatalf("WriteFLATableToCD() failed: %v", err)
+	}
+
+	verification, err = processor.VerifyFLATable(imagePath, originalTable, nil)
+	if err != nil {
+		t.Fatalf("VerifyFLATable() failed: %v", err)
+	}
+	want := []struct {
+		problem string
+		file    string
+	}{
+		{FLAProblemUnlinked, files[1].path()},
+		{FLAProblemSize, files[2].path()},
+		{FLAProblemWrongFile, files[3].path()},
+	}
+	if len(verification.Issues) != len(want) {
+		t.Fatalf("VerifyFLATable(broken) = %+v, want %d issues", verification.Issues, len(want))
+	}
+	for i, issue := range verification.Issues {
+		if issue.EntryIndex != uint32(i) || issue.Problem != want[i].problem || issue.File != want[i].file {
+			t.Errorf("issue %d = %+v, want %s for %s", i, issue, want[i].problem, want[i].file)
+		}
+	}
+
+	// The table read back must equal the table written
+	verification, err = processor.VerifyFLATable(imagePath, originalTable, originalTable)
+	if err != nil {
+		t.Fatalf("VerifyFLATable() failed: %v", err)
+	}
+	for _, issue := range verification.Issues {
+		if issue.Problem != FLAProblemNotWritten {
+			t.Errorf("issue %+v, want %s", issue, FLAProblemNotWritten)
+		}
+	}
+	if len(verification.Issues) != 3 {
+		t.Errorf("VerifyFLATable(written) reported %d issues, want 3", len(verification.Issues))
+	}
+
+	// Count mismatches cannot be resolved entry by entry
+	short, err := NewFileLinkAddressTable(originalTable.Offset, originalTable.Entries[:2])
+	if err != nil {
+		t.Fatalf("NewFileLinkAddressTable() failed: %v", err)
+	}
+	if _, err := processor.VerifyFLATable(imagePath, short, nil); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("VerifyFLATable(short) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+	}
+}
@@ -0,0 +1,296 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the batch transforms of glyph PNG trees (wfm fonttool): scaling,
+// shifting and trimming every glyph of a directory such as fonts/16 at once. Pixels are
+// copied by nearest neighbor and indexed PNGs keep their palette and color indices, so
+// the glyphs still quantize to the same 4bpp colors on encode.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Operations of a glyph tree transform
+const (
+	FontTransformScale = "scale" // Resize by ScaleX and ScaleY
+	FontTransformShift = "shift" // Move the pixels by DX and DY within the glyph
+	FontTransformTrim  = "trim"  // Cut the blank columns around the ink, keeping Spacing columns after it
+)
+
+// FontTransform is a geometric transform applied to every glyph of a tree
+type FontTransform struct {
+	Operation string
+	DX        int     // Columns to move the pixels, positive moves right (shift)
+	DY        int     // Rows to move the pixels, positive moves down (shift)
+	ScaleX    float64 // Horizontal factor (scale)
+	ScaleY    float64 // Vertical factor (scale)
+	Spacing   int     // Blank columns left after the last inked column (trim)
+}
+
+// FontTransformFile is the outcome of a transform for one glyph PNG
+type FontTransformFile struct {
+	Path      string `json:"path"` // Relative to the glyph directory
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	NewWidth  int    `json:"new_width"`
+	NewHeight int    `json:"new_height"`
+	Changed   bool   `json:"changed"`
+}
+
+// FontTransformReport lists the glyphs of a tree transform
+type FontTransformReport struct {
+	Operation string              `json:"operation"`
+	Files     []FontTransformFile `json:"files"`
+	Changed   int                 `json:"changed"`
+}
+
+// Validate checks the operation and its parameters
+func (t FontTransform) Validate() error {
+	switch t.Operation {
+	case FontTransformScale:
+		if t.ScaleX <= 0 || t.ScaleY <= 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("scale factors must be positive, got %g x %g", t.ScaleX, t.ScaleY))
+		}
+	case FontTransformShift:
+		if t.DX == 0 && t.DY == 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("shift needs a non-zero --dx or --dy"))
+		}
+	case FontTransformTrim:
+		if t.Spacing < 0 {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("spacing must not be negative, got %d", t.Spacing))
+		}
+	default:
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("unknown font transform: %s", t.Operation))
+	}
+	return nil
+}
+
+// Apply returns the transformed copy of a glyph image. Indexed images stay indexed with
+// the same palette; other images become NRGBA. Uncovered pixels are transparent.
+func (t FontTransform) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	switch t.Operation {
+	case FontTransformScale:
+		newWidth := max(1, int(math.Round(float64(width)*t.ScaleX)))
+		newHeight := max(1, int(math.Round(float64(height)*t.ScaleY)))
+		dst := newGlyphCanvas(img, newWidth, newHeight)
+		for y := 0; y < newHeight; y++ {
+			srcY := min(height-1, int(float64(y)/float64(newHeight)*float64(height)))
+			for x := 0; x < newWidth; x++ {
+				srcX := min(width-1, int(float64(x)/float64(newWidth)*float64(width)))
+				copyGlyphPixel(dst, x, y, img, bounds.Min.X+srcX, bounds.Min.Y+srcY)
+			}
+		}
+		return dst
+
+	case FontTransformShift:
+		dst := newGlyphCanvas(img, width, height)
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; x++ {
+				srcX, srcY := x-t.DX, y-t.DY
+				if srcX >= 0 && srcX < width && srcY >= 0 && srcY < height {
+					copyGlyphPixel(dst, x, y, img, bounds.Min.X+srcX, bounds.Min.Y+srcY)
+				}
+			}
+		}
+		return dst
+
+	case FontTransformTrim:
+		first, last := -1, -1
+		for x := 0; x < width; x++ {
+			if !glyphColumnBlank(img, bounds.Min.X+x) {
+				if first < 0 {
+					first = x
+				}
+				last = x
+			}
+		}
+		// Blank glyphs (spaces) keep their advance
+		if first < 0 {
+			return img
+		}
+		newWidth := last - first + 1 + t.Spacing
+		dst := newGlyphCanvas(img, newWidth, height)
+		for y := 0; y < height; y++ {
+			for x := first; x <= last; x++ {
+				copyGlyphPixel(dst, x-first, y, img, bounds.Min.X+x, bounds.Min.Y+y)
+			}
+		}
+		return dst
+	}
+	return img
+}
+
+// newGlyphCanvas returns a transparent image of the given size and of the kind of src
+func newGlyphCanvas(src image.Image, width, height int) draw.Image {
+	rect := image.Rect(0, 0, width, height)
+	paletted, ok := src.(*image.Paletted)
+	if !ok {
+		return image.NewNRGBA(rect)
+	}
+
+	dst := image.NewPaletted(rect, paletted.Palette)
+	if index := transparentIndex(paletted.Palette); index != 0 {
+		for i := range dst.Pix {
+			dst.Pix[i] = index
+		}
+	}
+	return dst
+}
+
+// transparentIndex returns the first fully transparent color of a palette (0 when none is)
+func transparentIndex(palette color.Palette) uint8 {
+	for i, c := range palette {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			return uint8(i)
+		}
+	}
+	return 0
+}
+
+// copyGlyphPixel copies a pixel of src to dst, keeping the color index of indexed images
+func copyGlyphPixel(dst draw.Image, x, y int, src image.Image, srcX, srcY int) {
+	if paletted, ok := dst.(*image.Paletted); ok {
+		paletted.SetColorIndex(x, y, src.(*image.Paletted).ColorIndexAt(srcX, srcY))
+		return
+	}
+	dst.Set(x, y, src.At(srcX, srcY))
+}
+
+// glyphColumnBlank reports whether every pixel of a column is fully transparent
+func glyphColumnBlank(img image.Image, x int) bool {
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		if _, _, _, a := img.At(x, y).RGBA(); a != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// glyphImagesEqual reports whether two images have the same size and pixels
+func glyphImagesEqual(a, b image.Image) bool {
+	if a.Bounds().Dx() != b.Bounds().Dx() || a.Bounds().Dy() != b.Bounds().Dy() {
+		return false
+	}
+	offset := b.Bounds().Min.Sub(a.Bounds().Min)
+	for y := a.Bounds().Min.Y; y < a.Bounds().Max.Y; y++ {
+		for x := a.Bounds().Min.X; x < a.Bounds().Max.X; x++ {
+			if color.NRGBAModel.Convert(a.At(x, y)) != color.NRGBAModel.Convert(b.At(x+offset.X, y+offset.Y)) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// TransformGlyphTree applies a transform to every glyph PNG below glyphDir. The results
+// are written to the same relative paths below outputDir, or over the originals when
+// outputDir is empty (unchanged glyphs are then left alone). A dry run only reports.
+func TransformGlyphTree(ctx context.Context, glyphDir, outputDir string, transform FontTransform, dryRun bool) (*FontTransformReport, error) {
+	if err := transform.Validate(); err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(glyphDir); err != nil || !info.IsDir() {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("glyph directory %s not found", glyphDir))
+	}
+
+	report := &FontTransformReport{Operation: transform.Operation, Files: []FontTransformFile{}}
+	err := filepath.WalkDir(glyphDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() || !strings.EqualFold(filepath.Ext(path), ".png") {
+			return nil
+		}
+		if err := common.Canceled(ctx); err != nil {
+			return err
+		}
+
+		relPath, err := filepath.Rel(glyphDir, path)
+		if err != nil {
+			return err
+		}
+		img, err := loadGlyphPNG(path)
+		if err != nil {
+			return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to read glyph %s: %w", path, err))
+		}
+
+		transformed := transform.Apply(img)
+		file := FontTransformFile{
+			Path:      filepath.ToSlash(relPath),
+			Width:     img.Bounds().Dx(),
+			Height:    img.Bounds().Dy(),
+			NewWidth:  transformed.Bounds().Dx(),
+			NewHeight: transformed.Bounds().Dy(),
+			Changed:   !glyphImagesEqual(img, transformed),
+		}
+		report.Files = append(report.Files, file)
+		if file.Changed {
+			report.Changed++
+			common.LogDebug("Glyph %s: %dx%d -> %dx%d", file.Path, file.Width, file.Height, file.NewWidth, file.NewHeight)
+		}
+
+		if dryRun || (outputDir == "" && !file.Changed) {
+			return nil
+		}
+		target := path
+		if outputDir != "" {
+			target = filepath.Join(outputDir, relPath)
+			if err := os.MkdirAll(filepath.Dir(target), 0o750); err != nil {
+				return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", filepath.Dir(target), err))
+			}
+		}
+		return writeGlyphPNG(target, transformed)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// loadGlyphPNG reads a glyph PNG, checking its size against the memory limit first
+func loadGlyphPNG(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	if err := common.CheckImageMemory(path, file); err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return png.Decode(file)
+}
+
+// writeGlyphPNG replaces a glyph PNG atomically, so an interrupted run never leaves a
+// truncated glyph in the tree
+func writeGlyphPNG(path string, img image.Image) error {
+	file, err := common.CreateAtomic(path)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", path, err))
+	}
+	defer file.Abort()
+
+	if err := glyphPNGEncoder.Encode(file, img); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode %s: %w", path, err))
+	}
+	return file.Commit()
+}
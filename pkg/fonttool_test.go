@@ -0,0 +1,162 @@
+// Package pkg provides tests for the glyph tree transforms
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// fontToolPalette has a duplicate of the ink color, so index-preserving copies can be told
+// apart from color lookups
+var fontToolPalette = color.Palette{
+	color.NRGBA{0, 0, 0, 0},
+	color.NRGBA{255, 255, 255, 255},
+	color.NRGBA{255, 255, 255, 255},
+}
+
+// newFontToolGlyph builds an indexed glyph from rows of '.' (transparent), '1' and '2'
+func newFontToolGlyph(rows ...string) *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, len(rows[0]), len(rows)), fontToolPalette)
+	for y, row := range rows {
+		for x, pixel := range row {
+			if pixel != '.' {
+				img.SetColorIndex(x, y, uint8(pixel-'0'))
+			}
+		}
+	}
+	return img
+}
+
+// fontToolRows returns the rows of an indexed glyph in the format of newFontToolGlyph
+func fontToolRows(t *testing.T, img image.Image) []string {
+	t.Helper()
+	paletted, ok := img.(*image.Paletted)
+	if !ok {
+		t.Fatalf("transformed glyph is a %T, want *image.Paletted", img)
+	}
+	var rows []string
+	for y := paletted.Rect.Min.Y; y < paletted.Rect.Max.Y; y++ {
+		row := ""
+		for x := paletted.Rect.Min.X; x < paletted.Rect.Max.X; x++ {
+			if index := paletted.ColorIndexAt(x, y); index == 0 {
+				row += "."
+			} else {
+				row += string(rune('0' + index))
+			}
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func TestFontTransform_Apply(t *testing.T) {
+	glyph := newFontToolGlyph(
+		"..12.",
+		"..2..",
+		".....",
+	)
+
+	tests := []struct {
+		name      string
+		transform FontTransform
+		want      []string
+	}{
+		{"shift", FontTransform{Operation: FontTransformShift, DX: 1, DY: 1}, []string{".....", "...12", "...2."}},
+		{"shift out", FontTransform{Operation: FontTransformShift, DX: -3}, []string{"2....", ".....", "....."}},
+		{"scale up", FontTransform{Operation: FontTransformScale, ScaleX: 2, ScaleY: 1}, []string{"....1122..", "....22....", ".........."}},
+		{"scale down", FontTransform{Operation: FontTransformScale, ScaleX: 0.4, ScaleY: 1}, []string{".1", ".2", ".."}},
+		{"trim", FontTransform{Operation: FontTransformTrim, Spacing: 1}, []string{"12.", "2..", "..."}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := test.transform.Apply(glyph)
+			if rows := fontToolRows(t, got); fmt.Sprint(rows) != fmt.Sprint(test.want) {
+				t.Errorf("Apply() = %q, want %q", rows, test.want)
+			}
+			if palette := got.(*image.Paletted).Palette; len(palette) != len(fontToolPalette) {
+				t.Errorf("Apply() palette has %d colors, want %d", len(palette), len(fontToolPalette))
+			}
+		})
+	}
+
+	// Spaces keep their advance
+	space := newFontToolGlyph("....", "....")
+	if got := (FontTransform{Operation: FontTransformTrim}).Apply(space); got.Bounds().Dx() != 4 {
+		t.Errorf("trimmed space is %d columns wide, want 4", got.Bounds().Dx())
+	}
+
+	for _, invalid := range []FontTransform{
+		{Operation: "rotate"},
+		{Operation: FontTransformScale, ScaleX: 0, ScaleY: 1},
+		{Operation: FontTransformShift},
+		{Operation: FontTransformTrim, Spacing: -1},
+	} {
+		if err := invalid.Validate(); common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("Validate(%+v) = %v, want a validation error", invalid, err)
+		}
+	}
+}
+
+func TestTransformGlyphTree(t *testing.T) {
+	dir := t.TempDir()
+	fontDir := filepath.Join(dir, "fonts", "16")
+	glyphs := map[string]*image.Paletted{
+		"uppercase/0041.png": newFontToolGlyph(".1.", "1.1"),
+		"symbols/0020.png":   newFontToolGlyph("...", "..."),
+	}
+	for name, img := range glyphs {
+		path := filepath.Join(fontDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create glyph directory: %v", err)
+		}
+		if err := writeGlyphPNG(path, img); err != nil {
+			t.Fatalf("writeGlyphPNG() failed: %v", err)
+		}
+	}
+	shift := FontTransform{Operation: FontTransformShift, DX: 1}
+
+	// A dry run and a transform into another directory leave the tree alone
+	report, err := TransformGlyphTree(context.Background(), fontDir, "", shift, true)
+	if err != nil || len(report.Files) != 2 || report.Changed != 1 {
+		t.Fatalf("TransformGlyphTree(dry run) = %+v, %v, want 1 of 2 glyphs changed", report, err)
+	}
+	outputDir := filepath.Join(dir, "shifted")
+	if _, err := TransformGlyphTree(context.Background(), fontDir, outputDir, shift, false); err != nil {
+		t.Fatalf("TransformGlyphTree(output) failed: %v", err)
+	}
+	shifted, err := loadGlyphPNG(filepath.Join(outputDir, "uppercase", "0041.png"))
+	if err != nil {
+		t.Fatalf("failed to read the shifted glyph: %v", err)
+	}
+	if rows := fontToolRows(t, shifted); fmt.Sprint(rows) != fmt.Sprint([]string{"..1", ".1."}) {
+		t.Errorf("shifted glyph = %q", rows)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "symbols", "0020.png")); err != nil {
+		t.Errorf("unchanged glyph missing from the output tree: %v", err)
+	}
+
+	original, err := loadGlyphPNG(filepath.Join(fontDir, "uppercase", "0041.png"))
+	if err != nil || !glyphImagesEqual(original, glyphs["uppercase/0041.png"]) {
+		t.Fatalf("source glyph changed by a dry run or an output transform (%v)", err)
+	}
+
+	// In place
+	if _, err := TransformGlyphTree(context.Background(), fontDir, "", shift, false); err != nil {
+		t.Fatalf("TransformGlyphTree(in place) failed: %v", err)
+	}
+	inPlace, err := loadGlyphPNG(filepath.Join(fontDir, "uppercase", "0041.png"))
+	if err != nil || !glyphImagesEqual(inPlace, shifted) {
+		t.Errorf("in-place glyph differs from the shifted one (%v)", err)
+	}
+
+	if _, err := TransformGlyphTree(context.Background(), filepath.Join(dir, "missing"), "", shift, false); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("TransformGlyphTree(missing) error = %v, want an input error", err)
+	}
+}
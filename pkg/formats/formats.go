@@ -0,0 +1,68 @@
+// Package formats provides the file format documentation shipped inside the tombatools binary.
+// Every topic is a plain text file with field tables and offsets of a game format, embedded
+// at build time so the documentation is available offline through the help command.
+package formats
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+//go:embed data/*.txt
+var embedded embed.FS
+
+// Topic is the documentation of a single file format
+type Topic struct {
+	Name  string // Topic name used on the command line (e.g. wfm)
+	Title string // First line of the documentation
+	Text  string // Documentation body after the title
+}
+
+// List returns every embedded format topic, sorted by name
+func List() ([]Topic, error) {
+	files, err := fs.Glob(embedded, "data/*.txt")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list format topics: %w", err)
+	}
+
+	topics := make([]Topic, 0, len(files))
+	for _, file := range files {
+		topic, err := load(file)
+		if err != nil {
+			return nil, err
+		}
+		topics = append(topics, *topic)
+	}
+	sort.Slice(topics, func(i, j int) bool { return topics[i].Name < topics[j].Name })
+	return topics, nil
+}
+
+// Get returns the format topic with the given name
+func Get(name string) (*Topic, error) {
+	topic, err := load(path.Join("data", strings.ToLower(name)+".txt"))
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("format topic not found: %s", name))
+	}
+	return topic, nil
+}
+
+// load reads and splits an embedded topic file
+func load(file string) (*Topic, error) {
+	data, err := embedded.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read format topic %s: %w", file, err)
+	}
+
+	title, text, _ := strings.Cut(string(data), "\n")
+	return &Topic{
+		Name:  strings.TrimSuffix(path.Base(file), ".txt"),
+		Title: strings.TrimSpace(title),
+		Text:  strings.TrimLeft(text, "\n"),
+	}, nil
+}
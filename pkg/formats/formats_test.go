@@ -0,0 +1,120 @@
+// Package formats provides tests for the embedded format documentation.
+package formats
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestList(t *testing.T) {
+	topics, err := List()
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+
+	var names []string
+	for _, topic := range topics {
+		names = append(names, topic.Name)
+		if topic.Title == "" || topic.Text == "" {
+			t.Errorf("topic %s has an empty title or text", topic.Name)
+		}
+	}
+	if got := strings.Join(names, ","); got != "fla,gam,wfm" {
+		t.Errorf("List() names = %s, want fla,gam,wfm", got)
+	}
+}
+
+func TestGet_MatchesPackageTables(t *testing.T) {
+	wfm, err := Get("WFM")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	wants := []string{fmt.Sprintf("Header (%d bytes)", pkg.WFMHeaderSize), fmt.Sprintf("at 0x%X", pkg.WFMHeaderSize)}
+	for _, code := range []uint16{pkg.FFF2, pkg.HALT, pkg.F4, pkg.PROMPT, pkg.F6, pkg.CHANGE_COLOR_TO, pkg.INIT_TAIL,
+		pkg.PAUSE_FOR, pkg.INIT_TEXT_BOX, pkg.DOUBLE_NEWLINE, pkg.WAIT_FOR_INPUT, pkg.NEWLINE, pkg.C04D, pkg.C04E,
+		pkg.SPEAKER, pkg.NAME_WINDOW, pkg.CLOSE_NAME_WINDOW} {
+		wants = append(wants, fmt.Sprintf("0x%04X", code))
+	}
+	for _, want := range wants {
+		if !strings.Contains(wfm.Text, want) {
+			t.Errorf("wfm topic does not mention %q", want)
+		}
+	}
+
+	gam, err := Get("gam")
+	if err != nil {
+		t.Fatalf("Get() failed: %v", err)
+	}
+	if want := fmt.Sprintf("Header (%d bytes)", pkg.GAMHeaderSize); !strings.Contains(gam.Text, want) {
+		t.Errorf("gam topic does not mention %q", want)
+	}
+
+	if _, err := Get("iso"); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("Get(unknown) = %v, want input-not-found error", err)
+	}
+}
+
+func TestSchemas_MatchPackageLayouts(t *testing.T) {
+	schemas, err := Schemas(SchemaKindJSON)
+	if err != nil {
+		t.Fatalf("Schemas() failed: %v", err)
+	}
+
+	sizes := make(map[string]int)
+	for _, schema := range schemas {
+		var layout struct {
+			Types []struct {
+				Name string `json:"name"`
+				Size int    `json:"size"`
+			} `json:"types"`
+		}
+		if err := json.Unmarshal(schema.Data, &layout); err != nil {
+			t.Fatalf("%s is not valid JSON: %v", schema.File, err)
+		}
+		for _, layoutType := range layout.Types {
+			sizes[schema.Format+"."+layoutType.Name] = layoutType.Size
+		}
+	}
+
+	for name, want := range map[string]int{
+		"wfm.header": pkg.WFMHeaderSize, "gam.header": pkg.GAMHeaderSize, "fla.entry": 8, "wfm.glyph": 0,
+	} {
+		if got, found := sizes[name]; !found || got != want {
+			t.Errorf("%s size = %d (listed %v), want %d", name, got, found, want)
+		}
+	}
+
+	if _, err := Schemas("xml"); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("Schemas(xml) = %v, want validation error", err)
+	}
+}
+
+func TestExportSchemas(t *testing.T) {
+	dir := t.TempDir()
+	paths, err := ExportSchemas(dir, SchemaKindKaitai)
+	if err != nil {
+		t.Fatalf("ExportSchemas() failed: %v", err)
+	}
+
+	var names []string
+	for _, schemaPath := range paths {
+		names = append(names, filepath.Base(schemaPath))
+		data, err := os.ReadFile(schemaPath)
+		if err != nil {
+			t.Fatalf("failed to read %s: %v", schemaPath, err)
+		}
+		if !strings.Contains(string(data), "meta:\n  id: "+strings.TrimSuffix(filepath.Base(schemaPath), ".ksy")) {
+			t.Errorf("%s has no Kaitai meta id", schemaPath)
+		}
+	}
+	if got := strings.Join(names, ","); got != "fla.ksy,gam.ksy,wfm.ksy" {
+		t.Errorf("ExportSchemas() wrote %s, want fla.ksy,gam.ksy,wfm.ksy", got)
+	}
+}
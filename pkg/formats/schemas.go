@@ -0,0 +1,89 @@
+// Package formats provides the file format documentation shipped inside the tombatools binary.
+// This file contains the machine-readable format descriptors: a Kaitai Struct (.ksy) file
+// and a JSON layout descriptor per format, generated from the Go structs the formats are
+// decoded with, so other tools and hex-editor templates stay in sync with tombatools.
+package formats
+
+//go:generate go run ../../internal/genschemas -in schemas.yaml -root ../.. -out data/schemas
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Kinds of format descriptors
+const (
+	SchemaKindKaitai = "ksy"  // Kaitai Struct description
+	SchemaKindJSON   = "json" // JSON layout descriptor (field offsets, sizes and types)
+)
+
+//go:embed data/schemas
+var embeddedSchemas embed.FS
+
+// Schema is a machine-readable descriptor of a file format
+type Schema struct {
+	Format string // Format name (e.g. wfm)
+	Kind   string // SchemaKindKaitai or SchemaKindJSON
+	File   string // File name of the descriptor (e.g. wfm.ksy)
+	Data   []byte
+}
+
+// Schemas returns the embedded descriptors of the given kind ("" for every kind), sorted
+// by file name
+func Schemas(kind string) ([]Schema, error) {
+	if kind != "" && kind != SchemaKindKaitai && kind != SchemaKindJSON {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("unknown schema kind %q: must be %s or %s", kind, SchemaKindKaitai, SchemaKindJSON))
+	}
+
+	files, err := fs.Glob(embeddedSchemas, "data/schemas/*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list format schemas: %w", err)
+	}
+	sort.Strings(files)
+
+	schemas := make([]Schema, 0, len(files))
+	for _, file := range files {
+		name := path.Base(file)
+		format, fileKind, _ := strings.Cut(name, ".")
+		if kind != "" && fileKind != kind {
+			continue
+		}
+		data, err := embeddedSchemas.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read format schema %s: %w", name, err)
+		}
+		schemas = append(schemas, Schema{Format: format, Kind: fileKind, File: name, Data: data})
+	}
+	return schemas, nil
+}
+
+// ExportSchemas writes the descriptors of the given kind ("" for every kind) into
+// outputDir and returns the paths written
+func ExportSchemas(outputDir, kind string) ([]string, error) {
+	schemas, err := Schemas(kind)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(outputDir, 0o750); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create output directory: %w", err))
+	}
+
+	paths := make([]string, 0, len(schemas))
+	for _, schema := range schemas {
+		schemaPath := filepath.Join(outputDir, schema.File)
+		if err := common.WriteOutput(schemaPath, schema.Data, 0644); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", schemaPath, err))
+		}
+		paths = append(paths, schemaPath)
+	}
+	return paths, nil
+}
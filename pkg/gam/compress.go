@@ -0,0 +1,203 @@
+// Package gam implements the GAM container of the Tomba! PlayStation game.
+// This file contains the compression presets and the block-parallel LZ parse: large
+// payloads are split into fixed-size blocks parsed concurrently, and the token sequences
+// of the blocks are joined into a single compressed stream.
+package gam
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Compression presets, from the fastest to the smallest output
+const (
+	PresetFast    = "fast"    // Nearest distances only, stops at the first long match
+	PresetDefault = "default" // Longest match in the whole window at every position
+	PresetMax     = "max"     // Optimal parse: cheapest token sequence of every block
+)
+
+const (
+	WindowSize    = 255       // Largest reference distance and length
+	BlockSize     = 64 * 1024 // Payload bytes parsed per block; fixed so output does not depend on the CPU count
+	LiteralBits   = 9         // Literal byte plus its bitmask flag
+	ReferenceBits = 17        // Distance/length pair plus its bitmask flag
+
+	cancelCheckInterval = 64 * 1024 // Positions parsed between cancellation checks
+)
+
+// preset is the match search depth of a compression preset
+type preset struct {
+	depth      int  // Distances tried at every position
+	goodLength int  // Stop searching once a match this long is found
+	optimal    bool // Cheapest token sequence instead of the longest match at every position
+}
+
+// presets maps preset names to their match search settings
+var presets = map[string]preset{
+	PresetFast:    {depth: 32, goodLength: 32},
+	PresetDefault: {depth: WindowSize, goodLength: WindowSize},
+	PresetMax:     {depth: WindowSize, goodLength: WindowSize, optimal: true},
+}
+
+// ValidatePreset reports whether the preset name is fast, default or max
+func ValidatePreset(name string) error {
+	if _, ok := presets[name]; !ok {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid compression preset %q (want %s, %s or %s)", name, PresetFast, PresetDefault, PresetMax))
+	}
+	return nil
+}
+
+// Parse returns the token sequence of the input for a preset (default when empty), as
+// the number of bytes produced by the token starting at each position (1 for a literal)
+// and the distance of references. Blocks are parsed concurrently: a block may reference
+// the window before its start, which the decompressor has already produced, but no token
+// crosses its end, so the block parses join into one valid stream.
+func Parse(ctx context.Context, input []byte, name string) (lengths, distances []int, err error) {
+	if name == "" {
+		name = PresetDefault
+	}
+	if err := ValidatePreset(name); err != nil {
+		return nil, nil, err
+	}
+	settings := presets[name]
+
+	lengths = make([]int, len(input))
+	distances = make([]int, len(input))
+
+	blocks := (len(input) + BlockSize - 1) / BlockSize
+	next := make(chan int)
+	errs := make(chan error, blocks)
+	var wg sync.WaitGroup
+	for worker := 0; worker < common.Workers(blocks); worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for block := range next {
+				start := block * BlockSize
+				end := min(start+BlockSize, len(input))
+				if settings.optimal {
+					errs <- optimalBlock(ctx, input, start, end, settings, lengths, distances)
+				} else {
+					errs <- greedyBlock(ctx, input, start, end, settings, lengths, distances)
+				}
+			}
+		}()
+	}
+	for block := 0; block < blocks; block++ {
+		next <- block
+	}
+	close(next)
+	wg.Wait()
+	close(errs)
+
+	for blockErr := range errs {
+		if blockErr != nil {
+			return nil, nil, blockErr
+		}
+	}
+	common.LogDebug("LZ parse: %d bytes in %d blocks", len(input), blocks)
+	return lengths, distances, nil
+}
+
+// Emit writes a parsed token sequence as a compressed stream of 16-token bitmask blocks
+func Emit(input []byte, lengths, distances []int) []byte {
+	output := make([]byte, 0, len(input)/2)
+	pos := 0
+	for pos < len(input) {
+		bitmask := uint16(0)
+		bitmaskPos := len(output)
+		output = append(output, 0, 0) // Reserve space for bitmask
+
+		for bit := 0; bit < 16 && pos < len(input); bit++ {
+			if lengths[pos] > 1 {
+				bitmask |= 1 << bit
+				output = append(output, byte(distances[pos]), byte(lengths[pos]))
+				pos += lengths[pos]
+				continue
+			}
+			output = append(output, input[pos])
+			pos++
+		}
+
+		output[bitmaskPos] = byte(bitmask)
+		output[bitmaskPos+1] = byte(bitmask >> 8)
+	}
+	return output
+}
+
+// greedyBlock takes the longest match found at every position of input[start:end]
+func greedyBlock(ctx context.Context, input []byte, start, end int, settings preset, lengths, distances []int) error {
+	for pos := start; pos < end; {
+		if (pos-start)%cancelCheckInterval == 0 {
+			if err := common.Canceled(ctx); err != nil {
+				return err
+			}
+		}
+
+		distance, length := findMatch(input[:end], pos, settings)
+		if length < 2 {
+			lengths[pos] = 1
+			pos++
+			continue
+		}
+		lengths[pos], distances[pos] = length, distance
+		pos += length
+	}
+	return nil
+}
+
+// optimalBlock finds the cheapest token sequence of input[start:end]. Costs are counted
+// in bits, including the bitmask flag of every token.
+func optimalBlock(ctx context.Context, input []byte, start, end int, settings preset, lengths, distances []int) error {
+	cost := make([]int, end-start+1)
+	for pos := end - 1; pos >= start; pos-- {
+		if (pos-start)%cancelCheckInterval == 0 {
+			if err := common.Canceled(ctx); err != nil {
+				return err
+			}
+		}
+
+		i := pos - start
+		cost[i] = cost[i+1] + LiteralBits
+		lengths[pos], distances[pos] = 1, 0
+
+		// Every prefix of the longest match is a valid reference with the same distance
+		distance, matchLength := findMatch(input[:end], pos, settings)
+		for length := 2; length <= matchLength; length++ {
+			if referenceCost := cost[i+length] + ReferenceBits; referenceCost < cost[i] {
+				cost[i] = referenceCost
+				lengths[pos] = length
+				distances[pos] = distance
+			}
+		}
+	}
+	return nil
+}
+
+// findMatch finds the longest match for data[pos:] within the preset's search depth.
+// References may overlap the bytes they produce; the nearest distance wins ties.
+func findMatch(data []byte, pos int, settings preset) (distance, length int) {
+	maxDistance := min(pos, WindowSize, settings.depth)
+	for d := 1; d <= maxDistance; d++ {
+		srcPos := pos - d
+		matchLength := 0
+		for matchLength < WindowSize && pos+matchLength < len(data) &&
+			data[srcPos+matchLength%d] == data[pos+matchLength] {
+			matchLength++
+		}
+
+		if matchLength > length {
+			distance, length = d, matchLength
+		}
+
+		// No later distance can be longer than a maximal match
+		if length >= settings.goodLength || pos+length == len(data) {
+			break
+		}
+	}
+	return distance, length
+}
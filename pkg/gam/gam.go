@@ -0,0 +1,221 @@
+// Package gam implements the GAM container of the Tomba! PlayStation game: an 8-byte
+// header followed by an LZ-compressed payload.
+// The package depends only on the standard library and pkg/common, so the codec can be
+// embedded in other tools without the command line or the YAML adapters of pkg.
+package gam
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// HeaderSize is the size of the GAM header in bytes
+const HeaderSize = 8
+
+// Magic identifies a GAM file
+var Magic = [3]byte{'G', 'A', 'M'}
+
+// Header represents the 8-byte header of a GAM file
+type Header struct {
+	Magic            [3]byte // "GAM"
+	Reserved         byte    // Padding byte (typically 0x00)
+	UncompressedSize uint32  // Size of the decompressed data
+}
+
+// File represents a complete GAM file structure
+type File struct {
+	Header           Header
+	CompressedData   []byte
+	UncompressedData []byte
+	OriginalSize     int64
+}
+
+// New returns a GAM file holding the payload, not yet compressed
+func New(payload []byte) (*File, error) {
+	uncompressedSize, err := common.SafeIntToUint32(len(payload))
+	if err != nil {
+		return nil, fmt.Errorf("uncompressed data too large: %w", err)
+	}
+
+	return &File{
+		Header: Header{
+			Magic:            Magic,
+			Reserved:         0x00,
+			UncompressedSize: uncompressedSize,
+		},
+		UncompressedData: payload,
+	}, nil
+}
+
+// Read parses the header and compressed data of a GAM file of the given size.
+// The payload is not decompressed; see Decompress.
+func Read(reader io.Reader, fileSize int64) (*File, error) {
+	file := &File{
+		OriginalSize: fileSize,
+	}
+
+	// Read header (8 bytes)
+	if err := binary.Read(reader, binary.LittleEndian, &file.Header); err != nil {
+		return nil, fmt.Errorf("failed to read GAM header: %w", err)
+	}
+
+	// Verify magic
+	if file.Header.Magic != Magic {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid GAM magic: expected 'GAM', got '%s'", string(file.Header.Magic[:])))
+	}
+
+	// The compressed data and the decompressed payload are held in memory
+	compressedSize := fileSize - HeaderSize
+	if err := common.CheckMemory("GAM data", compressedSize+int64(file.Header.UncompressedSize)); err != nil {
+		return nil, err
+	}
+
+	// Read compressed data (rest of file)
+	file.CompressedData = make([]byte, compressedSize)
+	if _, err := io.ReadFull(reader, file.CompressedData); err != nil {
+		return nil, fmt.Errorf("failed to read compressed data: %w", err)
+	}
+
+	common.LogDebug("GAM header read: magic=%s, uncompressed_size=%d",
+		string(file.Header.Magic[:]), file.Header.UncompressedSize)
+
+	return file, nil
+}
+
+// Decode parses GAM file data held in memory and decompresses its payload
+func Decode(data []byte) (*File, error) {
+	file, err := Read(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GAM data: %w", err)
+	}
+
+	if err := file.Decompress(); err != nil {
+		return nil, fmt.Errorf("failed to decompress GAM data: %w", err)
+	}
+
+	return file, nil
+}
+
+// Write writes the header and compressed data of the file
+func (f *File) Write(writer io.Writer) error {
+	// Write header
+	if err := binary.Write(writer, binary.LittleEndian, f.Header); err != nil {
+		return fmt.Errorf("failed to write header: %w", err)
+	}
+
+	// Write compressed data
+	if _, err := writer.Write(f.CompressedData); err != nil {
+		return fmt.Errorf("failed to write compressed data: %w", err)
+	}
+	return nil
+}
+
+// Size returns the size of the file once written, header included
+func (f *File) Size() int64 {
+	return int64(HeaderSize + len(f.CompressedData))
+}
+
+// Decompress expands the compressed data into UncompressedData.
+// The output buffer is allocated once at the uncompressed size; literal runs are
+// copied in bulk and references use copy() unless source and destination overlap.
+func (f *File) Decompress() error {
+	compressed := f.CompressedData
+	targetSize := int(f.Header.UncompressedSize)
+
+	// Preallocate the full output buffer; unwritten bytes stay zero as padding
+	output := make([]byte, targetSize)
+	outPos := 0  // Position in output data
+	compPos := 0 // Position in compressed data
+
+	common.LogDebug("Starting LZ decompression: target size = %d bytes", targetSize)
+
+	for outPos < targetSize && compPos < len(compressed) {
+		// Check if we have enough bytes for bitmask
+		if compPos+1 >= len(compressed) {
+			break
+		}
+
+		// Read 2-byte bitmask (little endian)
+		bitmask := binary.LittleEndian.Uint16(compressed[compPos : compPos+2])
+		compPos += 2
+
+		// Process 16 bits of the bitmask
+		for bit := 0; bit < 16 && outPos < targetSize && compPos < len(compressed); {
+			if (bitmask & (1 << bit)) == 0 {
+				// Bits are 0: run of literal bytes
+				run := 0
+				for bit+run < 16 && (bitmask&(1<<(bit+run))) == 0 {
+					run++
+				}
+				run = min(run, targetSize-outPos, len(compressed)-compPos)
+
+				copy(output[outPos:outPos+run], compressed[compPos:compPos+run])
+				outPos += run
+				compPos += run
+				bit += run
+				continue
+			}
+
+			// Bit is 1: LZ reference
+			if compPos+1 >= len(compressed) {
+				break
+			}
+
+			offset := int(compressed[compPos])
+			length := int(compressed[compPos+1])
+			compPos += 2
+			bit++
+
+			// Validate offset
+			if offset > outPos {
+				return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid LZ offset: %d (output size: %d)", offset, outPos))
+			}
+			if offset == 0 && length > 0 {
+				return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid LZ reference: zero offset with length %d at output position %d", length, outPos))
+			}
+
+			// Copy data from previous position
+			length = min(length, targetSize-outPos)
+			srcPos := outPos - offset
+			if offset >= length {
+				copy(output[outPos:outPos+length], output[srcPos:srcPos+length])
+			} else {
+				// Overlapping reference repeats the last offset bytes
+				for i := 0; i < length; i++ {
+					output[outPos+i] = output[srcPos+i]
+				}
+			}
+			outPos += length
+		}
+	}
+
+	// Report padding if compressed data ended early
+	if outPos < targetSize {
+		common.LogDebug("Adding %d bytes of padding", targetSize-outPos)
+	}
+
+	f.UncompressedData = output
+	common.LogDebug("LZ decompression completed: %d -> %d bytes", len(f.CompressedData), len(output))
+
+	return nil
+}
+
+// Compress compresses UncompressedData into CompressedData with a preset (see Presets)
+func (f *File) Compress(ctx context.Context, preset string) error {
+	input := f.UncompressedData
+	common.LogDebug("Starting LZ compression: input size = %d bytes", len(input))
+
+	lengths, distances, err := Parse(ctx, input, preset)
+	if err != nil {
+		return err
+	}
+	f.CompressedData = Emit(input, lengths, distances)
+
+	common.LogDebug("LZ compression completed: %d -> %d bytes", len(input), len(f.CompressedData))
+	return nil
+}
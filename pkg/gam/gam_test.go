@@ -0,0 +1,173 @@
+// Package gam provides tests for GAM LZ compression and decompression
+package gam
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// testPayload builds a payload mixing repeated runs and noise, similar to game data
+func testPayload(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	payload := make([]byte, 0, size)
+	for len(payload) < size {
+		if random.Intn(3) == 0 {
+			payload = append(payload, byte(random.Intn(256)))
+			continue
+		}
+		run := bytes.Repeat([]byte{byte(random.Intn(8))}, 1+random.Intn(40))
+		payload = append(payload, run...)
+	}
+	return payload[:size]
+}
+
+// compressed returns a GAM file compressed from the payload with the default preset
+func compressed(tb testing.TB, payload []byte) *File {
+	tb.Helper()
+	file, err := New(payload)
+	if err != nil {
+		tb.Fatalf("New() failed: %v", err)
+	}
+	if err := file.Compress(context.Background(), PresetDefault); err != nil {
+		tb.Fatalf("Compress() failed: %v", err)
+	}
+	return file
+}
+
+func TestFile_Decompress_RoundTrip(t *testing.T) {
+	payload := testPayload(64 * 1024)
+	file := compressed(t, payload)
+
+	var buf bytes.Buffer
+	if err := file.Write(&buf); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+	if int64(buf.Len()) != file.Size() {
+		t.Errorf("Write() wrote %d bytes, Size() = %d", buf.Len(), file.Size())
+	}
+
+	decoded, err := Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if !bytes.Equal(decoded.UncompressedData, payload) {
+		t.Error("Decode() output differs from the original payload")
+	}
+
+	if _, err := Decode([]byte("GAX\x00\x00\x00\x00\x00")); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("Decode() with a bad magic = %v, want a format error", err)
+	}
+}
+
+func TestFile_Decompress(t *testing.T) {
+	tests := []struct {
+		name       string
+		compressed []byte
+		size       uint32
+		expected   []byte
+		wantErr    bool
+	}{
+		{
+			name:       "literals",
+			compressed: []byte{0x00, 0x00, 'A', 'B', 'C'},
+			size:       3,
+			expected:   []byte("ABC"),
+		},
+		{
+			name:       "overlapping reference",
+			compressed: []byte{0x04, 0x00, 'A', 'B', 0x02, 0x05},
+			size:       7,
+			expected:   []byte("ABABABA"),
+		},
+		{
+			name:       "reference truncated at target size",
+			compressed: []byte{0x02, 0x00, 'A', 0x01, 0x10},
+			size:       4,
+			expected:   []byte("AAAA"),
+		},
+		{
+			name:       "padding when data ends early",
+			compressed: []byte{0x00, 0x00, 'A'},
+			size:       3,
+			expected:   []byte{'A', 0x00, 0x00},
+		},
+		{
+			name:       "offset beyond output",
+			compressed: []byte{0x02, 0x00, 'A', 0x05, 0x01},
+			size:       4,
+			wantErr:    true,
+		},
+		{
+			name:       "zero offset",
+			compressed: []byte{0x02, 0x00, 'A', 0x00, 0x01},
+			size:       4,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := &File{
+				Header:         Header{UncompressedSize: tt.size},
+				CompressedData: tt.compressed,
+			}
+
+			err := file.Decompress()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decompress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !bytes.Equal(file.UncompressedData, tt.expected) {
+				t.Errorf("Decompress() = %q, want %q", file.UncompressedData, tt.expected)
+			}
+		})
+	}
+}
+
+func BenchmarkFile_Decompress(b *testing.B) {
+	file := compressed(b, testPayload(512*1024))
+
+	b.SetBytes(int64(file.Header.UncompressedSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := file.Decompress(); err != nil {
+			b.Fatalf("Decompress() failed: %v", err)
+		}
+	}
+}
+
+func TestParse_Presets(t *testing.T) {
+	// Three blocks, so references reach back across block boundaries
+	payload := testPayload(3*BlockSize - 100)
+
+	sizes := make(map[string]int)
+	for _, preset := range []string{PresetFast, PresetDefault, PresetMax} {
+		lengths, distances, err := Parse(context.Background(), payload, preset)
+		if err != nil {
+			t.Fatalf("Parse(%q) failed: %v", preset, err)
+		}
+		file := &File{
+			Header:         Header{UncompressedSize: uint32(len(payload))},
+			CompressedData: Emit(payload, lengths, distances),
+		}
+		sizes[preset] = len(file.CompressedData)
+
+		if err := file.Decompress(); err != nil {
+			t.Fatalf("%s: Decompress() failed: %v", preset, err)
+		}
+		if !bytes.Equal(file.UncompressedData, payload) {
+			t.Errorf("%s: output does not decompress to the original payload", preset)
+		}
+	}
+	if sizes[PresetMax] > sizes[PresetDefault] || sizes[PresetDefault] > sizes[PresetFast] {
+		t.Errorf("preset sizes not ordered: fast %d, default %d, max %d",
+			sizes[PresetFast], sizes[PresetDefault], sizes[PresetMax])
+	}
+
+	if _, _, err := Parse(context.Background(), payload, "ultra"); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("Parse(ultra) = %v, want a validation error", err)
+	}
+}
@@ -0,0 +1,316 @@
+// Package gam implements the GAM container of the Tomba! PlayStation game.
+// This file contains the compression that reuses the tokens of an original stream: the
+// token sequence of a retail GAM file is read back and a payload is recompressed by copying
+// the original tokens wherever they still produce the same bytes. The bytes no original
+// token covers are parsed greedily with length limits and a distance order fitted to the
+// original tokens; that parse is an approximation and does not reproduce the game's own
+// compressor. An unchanged payload therefore packs to the original file byte for byte, but
+// the stream around an edit is this package's, not the retail compressor's.
+package gam
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Token is an element of a compressed stream
+type Token struct {
+	Reference bool // Distance/length pair instead of a literal byte
+	Distance  int  // Distance back in the output (references only)
+	Length    int  // Length byte of a reference; 1 for a literal
+}
+
+// Stream is the token sequence of a compressed stream
+type Stream struct {
+	Tokens  []Token
+	Starts  []int  // Output position of every token
+	Output  int    // Bytes produced by the tokens
+	PadBits uint16 // Flags of the bits of the last bitmask that no token uses
+	Trailer []byte // Bytes after the last token, which the decompressor never reads
+}
+
+// produced returns the bytes a token writes at pos of an output of size bytes
+func (t Token) produced(pos, size int) int {
+	if !t.Reference {
+		return 1
+	}
+	return min(t.Length, size-pos)
+}
+
+// ReadStream reads the token sequence of a compressed stream the way Decompress walks it
+func ReadStream(compressed []byte, size int) (*Stream, error) {
+	stream := &Stream{}
+	outPos, compPos := 0, 0
+	for outPos < size && compPos+1 < len(compressed) {
+		bitmask := binary.LittleEndian.Uint16(compressed[compPos:])
+		compPos += 2
+
+		bit := 0
+		for ; bit < 16 && outPos < size && compPos < len(compressed); bit++ {
+			if bitmask&(1<<bit) == 0 {
+				stream.Tokens = append(stream.Tokens, Token{Length: 1})
+				stream.Starts = append(stream.Starts, outPos)
+				outPos++
+				compPos++
+				continue
+			}
+
+			if compPos+1 >= len(compressed) {
+				break // The decompressor ignores a truncated reference
+			}
+			token := Token{Reference: true, Distance: int(compressed[compPos]), Length: int(compressed[compPos+1])}
+			if token.Distance > outPos || (token.Distance == 0 && token.Length > 0) {
+				return nil, common.WithCategory(common.ErrCategoryFormat,
+					fmt.Errorf("invalid LZ reference: distance %d at output position %d", token.Distance, outPos))
+			}
+			stream.Tokens = append(stream.Tokens, token)
+			stream.Starts = append(stream.Starts, outPos)
+			outPos += token.produced(outPos, size)
+			compPos += 2
+		}
+		if bit == 0 {
+			compPos -= 2 // A bitmask without tokens ends the stream and belongs to the trailer
+			break
+		}
+		if bit < 16 {
+			stream.PadBits = bitmask &^ (1<<bit - 1)
+		} else {
+			stream.PadBits = 0
+		}
+	}
+
+	stream.Output = outPos
+	stream.Trailer = compressed[compPos:]
+	return stream, nil
+}
+
+// Heuristic is a greedy parse taking the longest match of the window at every position,
+// with the length limits and distance order fitted to an existing stream
+type Heuristic struct {
+	MinLength int     // Shortest reference; shorter matches are written as literals
+	MaxLength int     // Longest reference
+	Farthest  bool    // Equally long matches take the farthest distance instead of the nearest
+	Agreement float64 // Share of the measured tokens the heuristic reproduces (0-1)
+}
+
+// String describes the heuristic for reports
+func (h Heuristic) String() string {
+	tieBreak := "nearest"
+	if h.Farthest {
+		tieBreak = "farthest"
+	}
+	return fmt.Sprintf("greedy references of %d-%d bytes, %s distance first, fitting %.1f%% of the original tokens",
+		h.MinLength, h.MaxLength, tieBreak, h.Agreement*100)
+}
+
+// next returns the token the heuristic writes at pos of data
+func (h Heuristic) next(data []byte, pos int) Token {
+	distance, length := 0, 0
+	for d := 1; d <= min(pos, WindowSize); d++ {
+		matchLength := 0
+		for matchLength < h.MaxLength && pos+matchLength < len(data) && data[pos-d+matchLength%d] == data[pos+matchLength] {
+			matchLength++
+		}
+		if matchLength > length || (h.Farthest && matchLength == length && length > 0) {
+			distance, length = d, matchLength
+		}
+	}
+	if length < h.MinLength {
+		return Token{Length: 1}
+	}
+	return Token{Reference: true, Distance: distance, Length: length}
+}
+
+// FitHeuristic fits the greedy parse to the tokens of a stream over its payload. The
+// length limits are the shortest and longest references of the stream; the distance order
+// is the one that reproduces more of its tokens. The agreement says how close the fit is;
+// it is not the search of the compressor that wrote the stream.
+func FitHeuristic(payload []byte, stream *Stream) Heuristic {
+	h := Heuristic{MinLength: WindowSize + 1, MaxLength: WindowSize}
+	longest := 0
+	for _, token := range stream.Tokens {
+		if token.Reference && token.Length > 0 {
+			h.MinLength = min(h.MinLength, token.Length)
+			longest = max(longest, token.Length)
+		}
+	}
+	if longest > 0 {
+		h.MaxLength = longest
+	}
+
+	best, measured := -1, 0
+	for _, farthest := range []bool{false, true} {
+		candidate := h
+		candidate.Farthest = farthest
+		reproduced := 0
+		measured = 0
+		for i, token := range stream.Tokens {
+			if token.Reference && token.Length == 0 {
+				continue // Empty references write nothing and no search produces them
+			}
+			measured++
+			if candidate.next(payload[:stream.Output], stream.Starts[i]) == token {
+				reproduced++
+			}
+		}
+		if reproduced > best {
+			best, h = reproduced, candidate
+		}
+	}
+	if measured > 0 {
+		h.Agreement = float64(best) / float64(measured)
+	}
+	return h
+}
+
+// ReuseReport describes a compression reusing the tokens of an original stream
+type ReuseReport struct {
+	Heuristic Heuristic // Greedy parse used for the bytes no original token covers
+	Tokens    int       // Tokens written
+	Reused    int       // Tokens reused from the original stream
+}
+
+// CompressReusing compresses UncompressedData with the tokens of the stream of an original
+// file, whose payload must be decompressed: original tokens are reused where they still
+// produce the same bytes at the same place (counted from the end after a size change), the
+// rest is parsed with the heuristic fitted to the original, and the original trailer, unused
+// bitmask flags, reserved header byte and omitted zero padding are kept.
+func (f *File) CompressReusing(ctx context.Context, original *File) (*ReuseReport, error) {
+	source := original.UncompressedData
+	stream, err := ReadStream(original.CompressedData, len(source))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the original stream: %w", err)
+	}
+	report := &ReuseReport{Heuristic: FitHeuristic(source, stream)}
+	common.LogDebug("Fill-in parse fitted to the original stream: %s", report.Heuristic)
+
+	input := f.UncompressedData
+	end := len(input)
+	if omitted := len(source) - stream.Output; omitted > 0 && omitted <= len(input) && allZero(input[len(input)-omitted:]) {
+		end = len(input) - omitted // The original leaves its trailing zeros to the decompression buffer
+	}
+
+	// Positions of the unchanged prefix map to the same original position, those of the
+	// unchanged suffix to the original position as many bytes from the end
+	prefix := 0
+	for prefix < min(len(input), len(source)) && input[prefix] == source[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < min(len(input), len(source))-prefix && input[len(input)-1-suffix] == source[len(source)-1-suffix] {
+		suffix++
+	}
+	delta := len(input) - len(source)
+	firstToken := make(map[int]int, len(stream.Tokens))
+	for i := len(stream.Tokens) - 1; i >= 0; i-- {
+		firstToken[stream.Starts[i]] = i
+	}
+	originalToken := func(pos, next int) (int, bool) {
+		originalPos := -1
+		switch {
+		case pos < prefix:
+			originalPos = pos
+		case pos >= len(input)-suffix:
+			originalPos = pos - delta
+		}
+		if originalPos < 0 {
+			return 0, false
+		}
+		if next < len(stream.Tokens) && stream.Starts[next] == originalPos {
+			return next, true
+		}
+		i, ok := firstToken[originalPos]
+		return i, ok
+	}
+
+	var tokens []Token
+	next := len(stream.Tokens)
+	for pos := 0; pos < end; {
+		if pos%cancelCheckInterval == 0 {
+			if err := common.Canceled(ctx); err != nil {
+				return nil, err
+			}
+		}
+
+		if i, ok := originalToken(pos, next); ok && validToken(input[:end], pos, stream.Tokens[i]) {
+			tokens = append(tokens, stream.Tokens[i])
+			pos += stream.Tokens[i].produced(pos, end)
+			next = i + 1
+			report.Reused++
+			continue
+		}
+		token := report.Heuristic.next(input[:end], pos)
+		tokens = append(tokens, token)
+		pos += token.produced(pos, end)
+		next = len(stream.Tokens)
+	}
+	// Empty references the original wrote after its last byte follow the last reused token
+	for ; next < len(stream.Tokens) && stream.Tokens[next].produced(stream.Output, stream.Output) == 0; next++ {
+		tokens = append(tokens, stream.Tokens[next])
+		report.Reused++
+	}
+	report.Tokens = len(tokens)
+
+	f.CompressedData = emitTokens(tokens, input[:end], stream.PadBits, stream.Trailer)
+	f.Header.Reserved = original.Header.Reserved
+	common.LogDebug("Reused the original stream: %d of %d tokens", report.Reused, report.Tokens)
+	return report, nil
+}
+
+// validToken reports whether a token writes data[pos:] correctly; references past the
+// end of data are only valid as the last token, which the decompressor cuts short
+func validToken(data []byte, pos int, token Token) bool {
+	if !token.Reference {
+		return true
+	}
+	if token.Distance > pos || (token.Distance == 0 && token.Length > 0) {
+		return false
+	}
+	for k := 0; k < min(token.Length, len(data)-pos); k++ {
+		if data[pos+k] != data[pos+k-token.Distance] {
+			return false
+		}
+	}
+	return true
+}
+
+// emitTokens writes tokens as a compressed stream of 16-token bitmask blocks, setting the
+// unused flags of the last bitmask to padBits and appending the trailer
+func emitTokens(tokens []Token, input []byte, padBits uint16, trailer []byte) []byte {
+	output := make([]byte, 0, len(input)/2+len(trailer))
+	pos := 0
+	for start := 0; start < len(tokens); start += 16 {
+		group := tokens[start:min(start+16, len(tokens))]
+		bitmask := uint16(0)
+		if len(group) < 16 {
+			bitmask = padBits &^ (1<<len(group) - 1)
+		}
+		bitmaskPos := len(output)
+		output = append(output, 0, 0)
+		for bit, token := range group {
+			if token.Reference {
+				bitmask |= 1 << bit
+				output = append(output, byte(token.Distance), byte(token.Length))
+				pos += token.produced(pos, len(input))
+				continue
+			}
+			output = append(output, input[pos])
+			pos++
+		}
+		binary.LittleEndian.PutUint16(output[bitmaskPos:], bitmask)
+	}
+	return append(output, trailer...)
+}
+
+// allZero reports whether every byte of data is zero
+func allZero(data []byte) bool {
+	for _, b := range data {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
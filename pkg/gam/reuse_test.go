@@ -0,0 +1,93 @@
+// Package gam provides tests for the compression reusing the tokens of an original stream
+package gam
+
+import (
+	"bytes"
+	"context"
+	"slices"
+	"testing"
+)
+
+// originalFile returns a GAM file standing for a retail one: its payload is compressed with
+// a heuristic other than the presets, its trailing zeros are left to the decompressor and
+// its stream and header carry bytes the decompressor ignores
+func originalFile(tb testing.TB, payload []byte, h Heuristic, zeros int) *File {
+	tb.Helper()
+	data := payload[:len(payload)-zeros]
+	var tokens []Token
+	for pos := 0; pos < len(data); {
+		token := h.next(data, pos)
+		tokens = append(tokens, token)
+		pos += token.produced(pos, len(data))
+	}
+
+	file, err := New(payload)
+	if err != nil {
+		tb.Fatalf("New() failed: %v", err)
+	}
+	file.CompressedData = emitTokens(tokens, data, 0xFFFF, []byte{0, 0})
+	file.Header.Reserved = 1
+	return file
+}
+
+func TestFitHeuristic(t *testing.T) {
+	payload := testPayload(16 * 1024)
+	h := Heuristic{MinLength: 3, MaxLength: 18, Farthest: true}
+	original := originalFile(t, payload, h, 0)
+
+	stream, err := ReadStream(original.CompressedData, len(payload))
+	if err != nil {
+		t.Fatalf("ReadStream() failed: %v", err)
+	}
+	if !bytes.Equal(stream.Trailer, []byte{0, 0}) || stream.Output != len(payload) {
+		t.Errorf("stream ends at %d with trailer % X, want %d and 00 00", stream.Output, stream.Trailer, len(payload))
+	}
+
+	fitted := FitHeuristic(payload, stream)
+	h.Agreement = 1
+	if fitted != h {
+		t.Errorf("FitHeuristic() = %+v, want %+v", fitted, h)
+	}
+}
+
+func TestFile_CompressReusing(t *testing.T) {
+	payload := append(testPayload(16*1024), make([]byte, 32)...)
+	original := originalFile(t, payload, Heuristic{MinLength: 2, MaxLength: 40}, 32)
+	if err := original.Decompress(); err != nil {
+		t.Fatalf("Decompress() failed: %v", err)
+	}
+
+	// The unchanged payload packs to the original file
+	file, err := New(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := file.CompressReusing(context.Background(), original)
+	if err != nil {
+		t.Fatalf("CompressReusing() failed: %v", err)
+	}
+	if !bytes.Equal(file.CompressedData, original.CompressedData) || file.Header != original.Header {
+		t.Error("CompressReusing() of the unchanged payload differs from the original file")
+	}
+	if report.Reused != report.Tokens {
+		t.Errorf("reused %d of %d tokens, want all", report.Reused, report.Tokens)
+	}
+
+	// An edit in the middle keeps the original tokens around it
+	edited := slices.Insert(slices.Clone(payload), 8*1024, []byte("EDITED TEXT")...)
+	if file, err = New(edited); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = file.CompressReusing(context.Background(), original); err != nil {
+		t.Fatalf("CompressReusing(edited) failed: %v", err)
+	}
+	if err := file.Decompress(); err != nil {
+		t.Fatalf("Decompress(edited) failed: %v", err)
+	}
+	if !bytes.Equal(file.UncompressedData, edited) {
+		t.Error("the edited payload does not survive the token-reusing compression")
+	}
+	if report.Reused*10 < report.Tokens*9 {
+		t.Errorf("reused %d of %d tokens, want at least 90%%", report.Reused, report.Tokens)
+	}
+}
@@ -0,0 +1,194 @@
+// Package pkg provides tests for GAM presets, fitting and tracing
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/gam"
+)
+
+// benchmarkGAMPayload builds a payload mixing repeated runs and noise, similar to game data
+func benchmarkGAMPayload(size int) []byte {
+	random := rand.New(rand.NewSource(1))
+	payload := make([]byte, 0, size)
+	for len(payload) < size {
+		if random.Intn(3) == 0 {
+			payload = append(payload, byte(random.Intn(256)))
+			continue
+		}
+		run := bytes.Repeat([]byte{byte(random.Intn(8))}, 1+random.Intn(40))
+		payload = append(payload, run...)
+	}
+	return payload[:size]
+}
+
+// compressedGAM returns a GAM structure compressed from the payload
+func compressedGAM(tb testing.TB, payload []byte) *GAMFile {
+	tb.Helper()
+	gamFile, err := gam.New(payload)
+	if err != nil {
+		tb.Fatalf("gam.New() failed: %v", err)
+	}
+	if err := gamFile.Compress(context.Background(), GAMPresetDefault); err != nil {
+		tb.Fatalf("Compress() failed: %v", err)
+	}
+	return gamFile
+}
+
+func TestGAMProcessor_Trace(t *testing.T) {
+	payload := benchmarkGAMPayload(8 * 1024)
+	trace := NewGAMProcessor().Trace(compressedGAM(t, payload))
+
+	if trace.Error != "" {
+		t.Fatalf("Trace() error = %q, want none", trace.Error)
+	}
+	if trace.OutputSize != len(payload) || trace.LiteralBytes+trace.ReferenceBytes != len(payload) {
+		t.Errorf("Trace() produced %d bytes (%d literal + %d reference), want %d",
+			trace.OutputSize, trace.LiteralBytes, trace.ReferenceBytes, len(payload))
+	}
+	if trace.Tokens[0].Kind != GAMTokenBitmask || trace.Tokens[0].InputOffset != GAMHeaderSize {
+		t.Errorf("first token = %+v, want bitmask at offset %d", trace.Tokens[0], GAMHeaderSize)
+	}
+}
+
+func TestGAMProcessor_Trace_InvalidReference(t *testing.T) {
+	gam := &GAMFile{
+		Header: GAMHeader{UncompressedSize: 8},
+		// Bitmask 0x0004: two literals then a reference reaching 5 bytes back
+		CompressedData: []byte{0x04, 0x00, 'A', 'B', 0x05, 0x02},
+	}
+
+	trace := NewGAMProcessor().Trace(gam)
+	if trace.Error == "" {
+		t.Fatal("Trace() should report the invalid reference")
+	}
+	if trace.OutputSize != 2 {
+		t.Errorf("OutputSize = %d, want 2", trace.OutputSize)
+	}
+	last := trace.Tokens[len(trace.Tokens)-1]
+	if last.Kind != GAMTokenReference || last.InputOffset != GAMHeaderSize+4 {
+		t.Errorf("last token = %+v, want reference at offset %d", last, GAMHeaderSize+4)
+	}
+	if detail := describeToken(last); !strings.Contains(detail, "src=<before start>") {
+		t.Errorf("describeToken() = %q, want the source before the start of the output", detail)
+	}
+}
+
+func TestWriteGAMTrace(t *testing.T) {
+	trace := NewGAMProcessor().Trace(compressedGAM(t, []byte("ABABABAB")))
+
+	for _, format := range []string{TraceFormatText, TraceFormatJSON, TraceFormatHTML} {
+		var buf bytes.Buffer
+		if err := WriteGAMTrace(trace, format, &buf); err != nil {
+			t.Errorf("WriteGAMTrace(%s) failed: %v", format, err)
+		}
+		if !bytes.Contains(buf.Bytes(), []byte("reference")) {
+			t.Errorf("WriteGAMTrace(%s) output has no reference token", format)
+		}
+	}
+
+	if err := WriteGAMTrace(trace, "xml", &bytes.Buffer{}); err == nil {
+		t.Error("WriteGAMTrace(xml) should fail")
+	}
+}
+
+func TestGAMProcessor_SetPreset(t *testing.T) {
+	payload := benchmarkGAMPayload(32 * 1024)
+
+	sizes := make(map[string]int)
+	for _, preset := range []string{GAMPresetFast, GAMPresetDefault, GAMPresetMax} {
+		processor := NewGAMProcessor()
+		if err := processor.SetPreset(preset); err != nil {
+			t.Fatalf("SetPreset(%q) failed: %v", preset, err)
+		}
+		outputFile := filepath.Join(t.TempDir(), "OUT.GAM")
+		if _, err := processor.SaveGAM(context.Background(), payload, outputFile); err != nil {
+			t.Fatalf("%s: SaveGAM() failed: %v", preset, err)
+		}
+
+		gamFile, err := processor.LoadGAM(outputFile)
+		if err != nil {
+			t.Fatalf("%s: LoadGAM() failed: %v", preset, err)
+		}
+		if !bytes.Equal(gamFile.UncompressedData, payload) {
+			t.Errorf("%s: output does not decompress to the original payload", preset)
+		}
+		sizes[preset] = len(gamFile.CompressedData)
+	}
+	if sizes[GAMPresetMax] > sizes[GAMPresetDefault] || sizes[GAMPresetDefault] > sizes[GAMPresetFast] {
+		t.Errorf("preset sizes not ordered: fast %d, default %d, max %d",
+			sizes[GAMPresetFast], sizes[GAMPresetDefault], sizes[GAMPresetMax])
+	}
+
+	err := NewGAMProcessor().SetPreset("ultra")
+	if err == nil || common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("SetPreset(ultra) = %v, want a validation error", err)
+	}
+}
+
+func TestGAMProcessor_SaveGAM_Fit(t *testing.T) {
+	random := rand.New(rand.NewSource(2))
+	noise := make([]byte, 4096)
+	random.Read(noise)
+	payload := append(append([]byte{}, noise...), make([]byte, 16*1024)...)
+	greedySize := int64(GAMHeaderSize + len(compressedGAM(t, payload).CompressedData))
+
+	tests := []struct {
+		name       string
+		targetSize int64
+		keep       bool
+		wantMethod string
+		wantErr    bool
+	}{
+		{"fits as is", greedySize, false, GAMMethodGreedy, false},
+		{"padding trimmed", greedySize - 100, false, GAMMethodOptimalTrim, false},
+		{"padding kept", greedySize - 100, true, "", true},
+		{"too small", 1024, false, GAMMethodOptimalTrim, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputFile := filepath.Join(t.TempDir(), "OUT.GAM")
+			processor := NewGAMProcessor()
+			processor.SetTargetSize(tt.targetSize)
+			processor.SetKeepPadding(tt.keep)
+
+			_, err := processor.SaveGAM(context.Background(), payload, outputFile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SaveGAM() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			report := processor.FitReport()
+			if tt.wantMethod != "" && report.Method != tt.wantMethod {
+				t.Errorf("Method = %q, want %q", report.Method, tt.wantMethod)
+			}
+
+			if tt.wantErr {
+				if common.ExitCodeFor(err) != common.ExitValidationFailed {
+					t.Errorf("exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+				}
+				if len(report.Chunks) == 0 || report.Chunks[0].Offset >= len(noise) {
+					t.Errorf("Chunks = %+v, want a noise chunk first", report.Chunks)
+				}
+				if _, err := os.Stat(outputFile); !os.IsNotExist(err) {
+					t.Error("SaveGAM() wrote an output file that does not fit")
+				}
+				return
+			}
+
+			gam, err := processor.LoadGAM(outputFile)
+			if err != nil {
+				t.Fatalf("LoadGAM() failed: %v", err)
+			}
+			if gam.OriginalSize > tt.targetSize || !bytes.Equal(gam.UncompressedData, payload) {
+				t.Errorf("output is %d bytes (target %d) or differs from the payload", gam.OriginalSize, tt.targetSize)
+			}
+		})
+	}
+}
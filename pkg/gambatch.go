@@ -0,0 +1,261 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the GAM batch mode. gam unpack-all walks a dumped CD directory,
+// detects GAM files by their magic and unpacks all of them, recording the path and
+// original size of each one in a YAML manifest; gam pack-all packs the edited payloads
+// listed in the manifest back into the same directory layout, fitting each file into the
+// disc slot of its original.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/gam"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// GAMManifestFile is the manifest unpack-all writes into its output directory
+	GAMManifestFile = "gam-manifest.yaml"
+	// gamUnpackedExt is appended to the path of every unpacked payload
+	gamUnpackedExt = ".UNGAM"
+)
+
+// GAMManifestEntry is a GAM file of a batch
+type GAMManifestEntry struct {
+	Path             string `yaml:"path"`              // GAM file, relative to the source directory
+	Unpacked         string `yaml:"unpacked"`          // Uncompressed payload, relative to the manifest
+	OriginalSize     int64  `yaml:"original_size"`     // Size of the original GAM file, header included
+	UncompressedSize int    `yaml:"uncompressed_size"` // Size of the payload
+}
+
+// GAMManifest lists the GAM files unpacked from a directory
+type GAMManifest struct {
+	Source string             `yaml:"source"` // Directory the GAM files were found in, relative to the manifest when possible
+	Files  []GAMManifestEntry `yaml:"files"`
+}
+
+// GAMBatchOptions selects how pack-all compresses the files of a manifest
+type GAMBatchOptions struct {
+	Fit         bool // Fit every file into the sectors of its original size
+	ReuseTokens bool // Reuse the tokens of the original file (see SetReuseTokens)
+}
+
+// GAMBatchFile is the pack result of one file of a manifest
+type GAMBatchFile struct {
+	Path       string `json:"path"`
+	Size       int64  `json:"size,omitempty"`        // Packed size, header included
+	TargetSize int64  `json:"target_size,omitempty"` // Disc slot of the original (with Fit)
+	Error      string `json:"error,omitempty"`
+}
+
+// GAMBatchReport lists the pack results of every file of a manifest
+type GAMBatchReport struct {
+	Packed int            `json:"packed"`
+	Failed int            `json:"failed"`
+	Files  []GAMBatchFile `json:"files"`
+}
+
+// OK reports whether every file of the manifest was packed
+func (r *GAMBatchReport) OK() bool {
+	return r.Failed == 0
+}
+
+// gamSlotSize returns the disc slot of a file: its size rounded up to whole sectors
+func gamSlotSize(size int64) int64 {
+	return (size + psx.CD_DATA_SIZE - 1) / psx.CD_DATA_SIZE * psx.CD_DATA_SIZE
+}
+
+// isGAMFile reports whether a file starts with the GAM magic
+func isGAMFile(path string) (bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	magic := make([]byte, len(gam.Magic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false, nil // Shorter than the magic
+	}
+	return bytes.Equal(magic, gam.Magic[:]), nil
+}
+
+// UnpackAll unpacks every GAM file below inputDir into outputDir, keeping the directory
+// layout and appending .UNGAM to the names, and writes the manifest of the batch into
+// outputDir. Files are detected by their magic, whatever their extension.
+func (p *GAMProcessor) UnpackAll(ctx context.Context, inputDir, outputDir string) (*GAMManifest, error) {
+	source, err := filepath.Abs(inputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", inputDir, err)
+	}
+	output, err := filepath.Abs(outputDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s: %w", outputDir, err)
+	}
+
+	var paths []string
+	err = filepath.WalkDir(source, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == output {
+				return filepath.SkipDir // Earlier batches written inside the dump
+			}
+			return nil
+		}
+		found, err := isGAMFile(path)
+		if err != nil {
+			return err
+		}
+		if found {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to scan %s: %w", inputDir, err))
+	}
+	if len(paths) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("no GAM files found in %s", inputDir))
+	}
+
+	manifest := &GAMManifest{Source: source, Files: []GAMManifestEntry{}}
+	for _, path := range paths {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+
+		relative, err := filepath.Rel(source, path)
+		if err != nil {
+			return nil, err
+		}
+		gamFile, err := p.LoadGAM(path)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", relative, err)
+		}
+
+		entry := GAMManifestEntry{
+			Path:             filepath.ToSlash(relative),
+			Unpacked:         filepath.ToSlash(relative) + gamUnpackedExt,
+			OriginalSize:     gamFile.OriginalSize,
+			UncompressedSize: len(gamFile.UncompressedData),
+		}
+		outputFile := filepath.Join(outputDir, filepath.FromSlash(entry.Unpacked))
+		if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create output directory: %w", err))
+		}
+		if err := p.writeDecompressedData(gamFile, outputFile); err != nil {
+			return nil, fmt.Errorf("failed to write decompressed data of %s: %w", relative, err)
+		}
+		p.logger.Debug("Unpacked %s: %d -> %d bytes", entry.Path, entry.OriginalSize, entry.UncompressedSize)
+		manifest.Files = append(manifest.Files, entry)
+	}
+
+	// A relative source keeps the manifest valid when the project directory is moved
+	if relative, err := filepath.Rel(output, source); err == nil {
+		manifest.Source = filepath.ToSlash(relative)
+	}
+	var data bytes.Buffer
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := common.WriteOutput(filepath.Join(outputDir, GAMManifestFile), data.Bytes(), 0644); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write manifest: %w", err))
+	}
+
+	common.LogInfo("Unpacked %d GAM files from %s into %s", len(manifest.Files), inputDir, outputDir)
+	return manifest, nil
+}
+
+// LoadGAMManifest reads a manifest written by UnpackAll
+func LoadGAMManifest(manifestFile string) (*GAMManifest, error) {
+	data, err := os.ReadFile(manifestFile)
+	if err != nil {
+		return nil, common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+
+	var manifest GAMManifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+	return &manifest, nil
+}
+
+// PackAll packs the payload of every file of a manifest into outputDir, at the path of the
+// original GAM file. Payloads are read relative to the manifest, originals (for
+// ReuseTokens) relative to its source directory. A file that fails is reported and the
+// others are still packed.
+func (p *GAMProcessor) PackAll(ctx context.Context, manifestFile, outputDir string, options GAMBatchOptions) (*GAMBatchReport, error) {
+	manifest, err := LoadGAMManifest(manifestFile)
+	if err != nil {
+		return nil, err
+	}
+	manifestDir := filepath.Dir(manifestFile)
+	source := filepath.FromSlash(manifest.Source)
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(manifestDir, source)
+	}
+
+	report := &GAMBatchReport{Files: []GAMBatchFile{}}
+	for _, entry := range manifest.Files {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+
+		result := GAMBatchFile{Path: entry.Path}
+		if options.Fit {
+			result.TargetSize = gamSlotSize(entry.OriginalSize)
+		}
+		size, err := p.packManifestEntry(ctx, source, manifestDir, entry, outputDir, result.TargetSize, options)
+		if err != nil {
+			result.Error = err.Error()
+			report.Failed++
+			common.LogWarn("%s: %v", entry.Path, err)
+		} else {
+			result.Size = size
+			report.Packed++
+		}
+		report.Files = append(report.Files, result)
+	}
+
+	common.LogInfo("Packed %d of %d GAM files into %s", report.Packed, len(manifest.Files), outputDir)
+	return report, nil
+}
+
+// packManifestEntry packs one file of a manifest and returns its size. A copy of the
+// processor carries the target size and the original of the file.
+func (p *GAMProcessor) packManifestEntry(ctx context.Context, source, manifestDir string, entry GAMManifestEntry, outputDir string, targetSize int64, options GAMBatchOptions) (int64, error) {
+	processor := *p
+	processor.SetTargetSize(targetSize)
+	if options.ReuseTokens {
+		if err := processor.SetReuseTokens(filepath.Join(source, filepath.FromSlash(entry.Path))); err != nil {
+			return 0, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(manifestDir, filepath.FromSlash(entry.Unpacked)))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read unpacked data: %w", err)
+	}
+
+	outputFile := filepath.Join(outputDir, filepath.FromSlash(entry.Path))
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		return 0, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create output directory: %w", err))
+	}
+	gamFile, err := processor.SaveGAM(ctx, data, outputFile)
+	if err != nil {
+		return 0, err
+	}
+	return gamFile.Size(), nil
+}
@@ -0,0 +1,87 @@
+// Package pkg provides tests for the GAM batch mode
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGAMProcessor_UnpackAllPackAll(t *testing.T) {
+	dir := t.TempDir()
+	dumpDir := filepath.Join(dir, "dump")
+	gamDir := filepath.Join(dir, "gam")
+
+	// A dump with two GAM files, one of them without the .GAM extension, and other files
+	processor := NewGAMProcessor()
+	if err := processor.SetPreset(GAMPresetFast); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(dumpDir, "STAGE"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processor.SaveGAM(context.Background(), benchmarkGAMPayload(20000), filepath.Join(dumpDir, "STAGE", "MAP01.GAM")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := processor.SaveGAM(context.Background(), benchmarkGAMPayload(3000), filepath.Join(dumpDir, "ITEM.BIN")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dumpDir, "README.TXT"), []byte("GA"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := NewGAMProcessor().UnpackAll(context.Background(), dumpDir, gamDir)
+	if err != nil {
+		t.Fatalf("UnpackAll() failed: %v", err)
+	}
+	if len(manifest.Files) != 2 || manifest.Files[0].Path != "ITEM.BIN" || manifest.Files[1].Unpacked != "STAGE/MAP01.GAM.UNGAM" {
+		t.Fatalf("manifest files = %+v, want ITEM.BIN and STAGE/MAP01.GAM", manifest.Files)
+	}
+	loaded, err := LoadGAMManifest(filepath.Join(gamDir, GAMManifestFile))
+	if err != nil {
+		t.Fatalf("LoadGAMManifest() failed: %v", err)
+	}
+	if loaded.Source != "../dump" || loaded.Files[1].UncompressedSize != 20000 {
+		t.Errorf("manifest = %+v, want source ../dump and a 20000 byte payload", loaded)
+	}
+
+	// Unchanged payloads pack to their originals; a payload grown past its slot fails alone
+	grown := filepath.Join(gamDir, "ITEM.BIN.UNGAM")
+	payload, err := os.ReadFile(grown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	noise := make([]byte, 8192)
+	for i := range noise {
+		noise[i] = byte(i * 7919 >> 3)
+	}
+	if err := os.WriteFile(grown, append(payload, noise...), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	packedDir := filepath.Join(dir, "packed")
+	report, err := NewGAMProcessor().PackAll(context.Background(), filepath.Join(gamDir, GAMManifestFile), packedDir, GAMBatchOptions{Fit: true, ReuseTokens: true})
+	if err != nil {
+		t.Fatalf("PackAll() failed: %v", err)
+	}
+	if report.OK() || report.Packed != 1 || report.Files[0].Error == "" {
+		t.Errorf("report = %+v, want ITEM.BIN failed and MAP01.GAM packed", report)
+	}
+	original, err := os.ReadFile(filepath.Join(dumpDir, "STAGE", "MAP01.GAM"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packed, err := os.ReadFile(filepath.Join(packedDir, "STAGE", "MAP01.GAM"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(packed, original) {
+		t.Error("PackAll() of an unchanged payload differs from the original file")
+	}
+
+	if _, err := NewGAMProcessor().UnpackAll(context.Background(), filepath.Join(dumpDir, "STAGE", "empty"), gamDir); err == nil {
+		t.Error("UnpackAll() of a missing directory succeeded")
+	}
+}
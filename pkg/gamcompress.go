@@ -0,0 +1,72 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the selection of the GAM compression preset, or of the original file
+// whose tokens are reused; the presets, the block-parallel LZ parse and the token reuse
+// live in the gam package.
+package pkg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/gam"
+)
+
+// GAM compression presets, from the fastest to the smallest output
+const (
+	GAMPresetFast    = gam.PresetFast    // Nearest distances only, stops at the first long match
+	GAMPresetDefault = gam.PresetDefault // Longest match in the whole window at every position
+	GAMPresetMax     = gam.PresetMax     // Optimal parse: cheapest token sequence of every block
+)
+
+// SetPreset selects the compression preset of SaveGAM and PackGAM: fast, default or max
+func (p *GAMProcessor) SetPreset(preset string) error {
+	if err := gam.ValidatePreset(preset); err != nil {
+		return err
+	}
+	p.preset = preset
+	return nil
+}
+
+// compressionPreset returns the selected preset (default when unset)
+func (p *GAMProcessor) compressionPreset() string {
+	if p.preset == "" {
+		return GAMPresetDefault
+	}
+	return p.preset
+}
+
+// GAMReuseReport describes a compression reusing the tokens of an original stream (see the gam package)
+type GAMReuseReport = gam.ReuseReport
+
+// SetReuseTokens makes SaveGAM copy the tokens of an original GAM file's stream wherever
+// they still produce the same bytes instead of compressing with the preset: an unchanged
+// payload packs to the original file byte for byte, and the rest is a greedy parse
+func (p *GAMProcessor) SetReuseTokens(originalFile string) error {
+	original, err := p.LoadGAM(originalFile)
+	if err != nil {
+		return fmt.Errorf("failed to load original GAM file: %w", err)
+	}
+	p.reuseFile = original
+	return nil
+}
+
+// ReuseReport returns the token reuse report of the last SaveGAM, or nil if no original was set
+func (p *GAMProcessor) ReuseReport() *GAMReuseReport {
+	return p.reuseReport
+}
+
+// compress compresses a GAM file with the selected preset, or with the original's tokens
+func (p *GAMProcessor) compress(ctx context.Context, file *GAMFile) error {
+	p.reuseReport = nil
+	if p.reuseFile == nil {
+		return file.Compress(ctx, p.compressionPreset())
+	}
+
+	report, err := file.CompressReusing(ctx, p.reuseFile)
+	if err != nil {
+		return err
+	}
+	p.reuseReport = report
+	p.logger.Debug("Reused %d of %d original tokens (%s)", report.Reused, report.Tokens, report.Heuristic)
+	return nil
+}
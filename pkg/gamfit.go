@@ -0,0 +1,231 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the GAM target-size fitting stage: a repacked GAM larger than its
+// original slot is reported right after compression, recompressed with an optimal parse
+// and, as a last resort, without its trailing zero padding, and the chunks that grew the
+// most are suggested for shrinking.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/gam"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// GAM compression methods tried by the fitting stage, in order
+const (
+	GAMMethodFast        = "fast"         // Nearest-distance matches (preset fast)
+	GAMMethodGreedy      = "greedy"       // Longest match at every position (preset default)
+	GAMMethodOptimal     = "optimal"      // Cheapest token sequence for the whole payload
+	GAMMethodOptimalTrim = "optimal+trim" // Optimal parse without the trailing zero padding
+	GAMMethodReuse       = "reuse"        // Tokens of the original stream (SetReuseTokens)
+)
+
+const (
+	gamFitChunkSize   = psx.CD_DATA_SIZE // Payload chunk size used for shrink suggestions
+	gamFitSuggestions = 5                // Chunks suggested when the file does not fit
+)
+
+// GAMFitAttempt is the file size reached by one compression method
+type GAMFitAttempt struct {
+	Method string `json:"method"`
+	Size   int64  `json:"size"` // GAM file size including the header
+}
+
+// GAMFitChunk is a payload chunk and its share of the compressed stream
+type GAMFitChunk struct {
+	Offset                 int `json:"offset"`                             // Uncompressed offset
+	Size                   int `json:"size"`                               // Uncompressed size
+	CompressedSize         int `json:"compressed_size"`                    // Compressed bytes of the chunk
+	OriginalCompressedSize int `json:"original_compressed_size,omitempty"` // Compressed bytes of the same chunk of the original
+	Growth                 int `json:"growth,omitempty"`                   // CompressedSize - OriginalCompressedSize
+}
+
+// GAMFitReport describes how a GAM file was fitted to its target size
+type GAMFitReport struct {
+	TargetSize   int64           `json:"target_size"`
+	Size         int64           `json:"size"`                    // Size of the selected (or smallest) attempt
+	Method       string          `json:"method"`                  // Method of the selected (or smallest) attempt
+	TrimmedBytes int             `json:"trimmed_bytes,omitempty"` // Trailing zero bytes left to the decompression buffer
+	Attempts     []GAMFitAttempt `json:"attempts"`
+	Chunks       []GAMFitChunk   `json:"chunks,omitempty"` // Chunks to shrink, only when the file does not fit
+}
+
+// Fits reports whether the selected attempt fits the target size
+func (r *GAMFitReport) Fits() bool {
+	return r.Size <= r.TargetSize
+}
+
+// Overflow returns the number of bytes the file is over its target (0 if it fits)
+func (r *GAMFitReport) Overflow() int64 {
+	return max(r.Size-r.TargetSize, 0)
+}
+
+// SetTargetSize makes SaveGAM fit the GAM file (header included) into size bytes (0 disables)
+func (p *GAMProcessor) SetTargetSize(size int64) {
+	p.targetSize = size
+}
+
+// SetFitOriginal fits SaveGAM output into the sectors of an original GAM file, and compares
+// the payload with the original's when suggesting chunks to shrink
+func (p *GAMProcessor) SetFitOriginal(originalFile string) error {
+	original, err := p.LoadGAM(originalFile)
+	if err != nil {
+		return fmt.Errorf("failed to load original GAM file: %w", err)
+	}
+
+	p.targetSize = gamSlotSize(original.OriginalSize)
+	p.fitOriginal = original.UncompressedData
+	p.logger.Debug("Fitting to %d bytes (%d sectors of %s)", p.targetSize, p.targetSize/psx.CD_DATA_SIZE, originalFile)
+	return nil
+}
+
+// SetKeepPadding stops the fitting stage from trimming the trailing zero padding of the payload
+func (p *GAMProcessor) SetKeepPadding(keep bool) {
+	p.keepPadding = keep
+}
+
+// FitReport returns the fitting report of the last SaveGAM, or nil if no target size was set
+func (p *GAMProcessor) FitReport() *GAMFitReport {
+	return p.fitReport
+}
+
+// fitGAM checks the compressed GAM against the target size and tries harder compression
+// when it overflows. The smallest fitting attempt replaces the compressed data; if none
+// fits, the report lists the chunks to shrink and an error is returned.
+func (p *GAMProcessor) fitGAM(ctx context.Context, file *GAMFile) error {
+	input := file.UncompressedData
+	report := &GAMFitReport{TargetSize: p.targetSize}
+	p.fitReport = report
+
+	record := func(method string, compressed []byte) bool {
+		size := int64(gam.HeaderSize + len(compressed))
+		report.Attempts = append(report.Attempts, GAMFitAttempt{Method: method, Size: size})
+		if report.Method == "" || size < report.Size {
+			report.Method, report.Size = method, size
+			file.CompressedData = compressed
+		}
+		return size <= p.targetSize
+	}
+
+	// The first attempt is the output of the selected preset or of the original's tokens
+	first := GAMMethodGreedy
+	switch {
+	case p.reuseFile != nil:
+		first = GAMMethodReuse
+	case p.compressionPreset() == GAMPresetMax:
+		first = GAMMethodOptimal
+	case p.compressionPreset() == GAMPresetFast:
+		first = GAMMethodFast
+	}
+	if record(first, file.CompressedData) {
+		return nil
+	}
+	common.LogWarn("GAM file is %d bytes, %d over the %d byte target; trying harder compression",
+		report.Size, report.Overflow(), p.targetSize)
+
+	lengths, distances, err := p.optimalLZParse(ctx, input)
+	if err != nil {
+		return err
+	}
+	if first != GAMMethodOptimal && record(GAMMethodOptimal, gam.Emit(input, lengths, distances)) {
+		return nil
+	}
+
+	// The decompression buffer is zero-filled, so trailing zeros need not be stored
+	trimmed := len(input)
+	for trimmed > 0 && input[trimmed-1] == 0 {
+		trimmed--
+	}
+	if !p.keepPadding && trimmed < len(input) {
+		trimLengths, trimDistances, err := p.optimalLZParse(ctx, input[:trimmed])
+		if err != nil {
+			return err
+		}
+		if record(GAMMethodOptimalTrim, gam.Emit(input[:trimmed], trimLengths, trimDistances)) {
+			report.TrimmedBytes = len(input) - trimmed
+			common.LogWarn("Trimmed %d trailing zero bytes; the game must zero its decompression buffer", report.TrimmedBytes)
+			return nil
+		}
+	}
+
+	chunks, err := p.shrinkSuggestions(ctx, input, lengths)
+	if err != nil {
+		return err
+	}
+	report.Chunks = chunks
+	return common.WithCategory(common.ErrCategoryValidationFailed,
+		fmt.Errorf("GAM file is %d bytes, %d over the %d byte target", report.Size, report.Overflow(), p.targetSize))
+}
+
+// optimalLZParse returns the cheapest token sequence for the input (see gam.Parse)
+func (p *GAMProcessor) optimalLZParse(ctx context.Context, input []byte) (lengths, distances []int, err error) {
+	return gam.Parse(ctx, input, GAMPresetMax)
+}
+
+// lzChunkCosts returns the compressed bytes of every gamFitChunkSize chunk of a parsed
+// payload. Tokens are charged to the chunk they start in.
+func lzChunkCosts(lengths []int) []int {
+	bits := make([]int, (len(lengths)+gamFitChunkSize-1)/gamFitChunkSize)
+	for pos := 0; pos < len(lengths); pos += lengths[pos] {
+		if lengths[pos] > 1 {
+			bits[pos/gamFitChunkSize] += gam.ReferenceBits
+		} else {
+			bits[pos/gamFitChunkSize] += gam.LiteralBits
+		}
+	}
+
+	costs := make([]int, len(bits))
+	for i, chunkBits := range bits {
+		costs[i] = (chunkBits + 7) / 8
+	}
+	return costs
+}
+
+// shrinkSuggestions returns the chunks worth shrinking: those that grew the most against
+// the original payload, or the most expensive ones when no original is known
+func (p *GAMProcessor) shrinkSuggestions(ctx context.Context, input []byte, lengths []int) ([]GAMFitChunk, error) {
+	costs := lzChunkCosts(lengths)
+
+	var originalCosts []int
+	if p.fitOriginal != nil {
+		originalLengths, _, err := p.optimalLZParse(ctx, p.fitOriginal)
+		if err != nil {
+			return nil, err
+		}
+		originalCosts = lzChunkCosts(originalLengths)
+	}
+
+	chunks := make([]GAMFitChunk, 0, len(costs))
+	for i, cost := range costs {
+		chunk := GAMFitChunk{
+			Offset:         i * gamFitChunkSize,
+			Size:           min(gamFitChunkSize, len(input)-i*gamFitChunkSize),
+			CompressedSize: cost,
+		}
+		if originalCosts != nil {
+			if i < len(originalCosts) {
+				chunk.OriginalCompressedSize = originalCosts[i]
+			}
+			chunk.Growth = chunk.CompressedSize - chunk.OriginalCompressedSize
+			if chunk.Growth <= 0 {
+				continue
+			}
+		}
+		chunks = append(chunks, chunk)
+	}
+
+	sort.SliceStable(chunks, func(i, j int) bool {
+		if chunks[i].Growth != chunks[j].Growth {
+			return chunks[i].Growth > chunks[j].Growth
+		}
+		return chunks[i].CompressedSize > chunks[j].CompressedSize
+	})
+	if len(chunks) > gamFitSuggestions {
+		chunks = chunks[:gamFitSuggestions]
+	}
+	return chunks, nil
+}
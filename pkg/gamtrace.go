@@ -0,0 +1,282 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the GAM compressed stream tracer, which lists every bitmask,
+// literal run and LZ reference of a GAM file for reverse engineering and for
+// comparing the output of the compressor against retail archives.
+package pkg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/gam"
+)
+
+// GAM header size in bytes; compressed stream offsets in a trace are file offsets
+const GAMHeaderSize = gam.HeaderSize
+
+// GAM trace token kinds
+const (
+	GAMTokenBitmask   = "bitmask"
+	GAMTokenLiteral   = "literal"
+	GAMTokenReference = "reference"
+)
+
+// GAM trace output formats
+const (
+	TraceFormatText = "text"
+	TraceFormatJSON = "json"
+	TraceFormatHTML = "html"
+)
+
+// GAMTraceToken is a single element of the compressed stream
+type GAMTraceToken struct {
+	Kind         string `json:"kind"`
+	InputOffset  int    `json:"input_offset"`          // File offset of the token
+	OutputOffset int    `json:"output_offset"`         // Decompressed offset the token writes to
+	Bitmask      uint16 `json:"bitmask,omitempty"`     // Flags of the following 16 tokens (bitmask only)
+	Length       int    `json:"length,omitempty"`      // Bytes produced by a literal run or reference
+	Distance     int    `json:"distance,omitempty"`    // Distance back in the output (reference only)
+	Overlapping  bool   `json:"overlapping,omitempty"` // Reference reads bytes it is writing
+	Bytes        string `json:"bytes,omitempty"`       // Literal bytes as hex
+}
+
+// GAMTrace is the decoded token stream of a GAM file
+type GAMTrace struct {
+	UncompressedSize int             `json:"uncompressed_size"`
+	CompressedSize   int             `json:"compressed_size"`
+	OutputSize       int             `json:"output_size"` // Bytes produced before the stream ended
+	Bitmasks         int             `json:"bitmasks"`
+	LiteralBytes     int             `json:"literal_bytes"`
+	References       int             `json:"references"`
+	ReferenceBytes   int             `json:"reference_bytes"`
+	Error            string          `json:"error,omitempty"` // Why tracing stopped early, if it did
+	Tokens           []GAMTraceToken `json:"tokens"`
+}
+
+// Trace walks the compressed stream of a GAM file without decompressing it.
+// Invalid references do not abort the trace: they are recorded and the trace stops there,
+// so corrupted archives can be inspected up to the point of failure.
+func (p *GAMProcessor) Trace(gam *GAMFile) *GAMTrace {
+	compressed := gam.CompressedData
+	targetSize := int(gam.Header.UncompressedSize)
+
+	trace := &GAMTrace{
+		UncompressedSize: targetSize,
+		CompressedSize:   len(compressed),
+		Tokens:           []GAMTraceToken{},
+	}
+
+	outPos := 0
+	compPos := 0
+
+	for outPos < targetSize && compPos+1 < len(compressed) {
+		bitmask := binary.LittleEndian.Uint16(compressed[compPos : compPos+2])
+		trace.Tokens = append(trace.Tokens, GAMTraceToken{
+			Kind:         GAMTokenBitmask,
+			InputOffset:  GAMHeaderSize + compPos,
+			OutputOffset: outPos,
+			Bitmask:      bitmask,
+		})
+		trace.Bitmasks++
+		compPos += 2
+
+		for bit := 0; bit < 16 && outPos < targetSize && compPos < len(compressed); {
+			if (bitmask & (1 << bit)) == 0 {
+				run := 0
+				for bit+run < 16 && (bitmask&(1<<(bit+run))) == 0 {
+					run++
+				}
+				run = min(run, targetSize-outPos, len(compressed)-compPos)
+
+				trace.Tokens = append(trace.Tokens, GAMTraceToken{
+					Kind:         GAMTokenLiteral,
+					InputOffset:  GAMHeaderSize + compPos,
+					OutputOffset: outPos,
+					Length:       run,
+					Bytes:        hex.EncodeToString(compressed[compPos : compPos+run]),
+				})
+				trace.LiteralBytes += run
+				outPos += run
+				compPos += run
+				bit += run
+				continue
+			}
+
+			if compPos+1 >= len(compressed) {
+				trace.Error = fmt.Sprintf("truncated reference at offset 0x%X", GAMHeaderSize+compPos)
+				trace.OutputSize = outPos
+				return trace
+			}
+
+			distance := int(compressed[compPos])
+			length := min(int(compressed[compPos+1]), targetSize-outPos)
+			token := GAMTraceToken{
+				Kind:         GAMTokenReference,
+				InputOffset:  GAMHeaderSize + compPos,
+				OutputOffset: outPos,
+				Length:       length,
+				Distance:     distance,
+				Overlapping:  distance < length,
+			}
+			trace.Tokens = append(trace.Tokens, token)
+
+			if distance > outPos || (distance == 0 && length > 0) {
+				trace.Error = fmt.Sprintf("invalid reference at offset 0x%X: distance %d at output position %d",
+					token.InputOffset, distance, outPos)
+				trace.OutputSize = outPos
+				return trace
+			}
+
+			trace.References++
+			trace.ReferenceBytes += length
+			outPos += length
+			compPos += 2
+			bit++
+		}
+	}
+
+	trace.OutputSize = outPos
+	if outPos < targetSize {
+		trace.Error = fmt.Sprintf("stream ended after %d of %d bytes", outPos, targetSize)
+	}
+	return trace
+}
+
+// TraceFile reads a GAM file and traces its compressed stream
+func (p *GAMProcessor) TraceFile(inputFile string) (*GAMTrace, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open GAM file: %w", err)
+	}
+	defer file.Close()
+
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get file info: %w", err)
+	}
+
+	gamFile, err := gam.Read(file, fileInfo.Size())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read GAM file: %w", err)
+	}
+
+	return p.Trace(gamFile), nil
+}
+
+// WriteGAMTrace writes the trace in the requested format (text, json or html)
+func WriteGAMTrace(trace *GAMTrace, format string, writer io.Writer) error {
+	switch format {
+	case TraceFormatText:
+		return writeGAMTraceText(trace, writer)
+	case TraceFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(trace); err != nil {
+			return fmt.Errorf("failed to encode JSON trace: %w", err)
+		}
+		return nil
+	case TraceFormatHTML:
+		return writeGAMTraceHTML(trace, writer)
+	default:
+		return fmt.Errorf("unsupported trace format: %s", format)
+	}
+}
+
+// describeToken returns the detail column of a trace token
+func describeToken(token GAMTraceToken) string {
+	switch token.Kind {
+	case GAMTokenBitmask:
+		return fmt.Sprintf("0x%04X %016b", token.Bitmask, token.Bitmask)
+	case GAMTokenLiteral:
+		return fmt.Sprintf("len=%d %s", token.Length, token.Bytes)
+	default:
+		source := fmt.Sprintf("0x%X", token.OutputOffset-token.Distance)
+		if token.Distance > token.OutputOffset {
+			source = "<before start>" // Invalid reference reaching back past the output
+		}
+		detail := fmt.Sprintf("dist=%d len=%d src=%s", token.Distance, token.Length, source)
+		if token.Overlapping {
+			detail += " overlap"
+		}
+		return detail
+	}
+}
+
+// traceSummaryLines returns the summary lines shared by the text and HTML formats
+func traceSummaryLines(trace *GAMTrace) []string {
+	lines := []string{
+		fmt.Sprintf("Compressed size: %d bytes", trace.CompressedSize),
+		fmt.Sprintf("Uncompressed size: %d bytes (%d produced)", trace.UncompressedSize, trace.OutputSize),
+		fmt.Sprintf("Bitmasks: %d", trace.Bitmasks),
+		fmt.Sprintf("Literal bytes: %d", trace.LiteralBytes),
+		fmt.Sprintf("References: %d (%d bytes)", trace.References, trace.ReferenceBytes),
+	}
+	if trace.Error != "" {
+		lines = append(lines, "Error: "+trace.Error)
+	}
+	return lines
+}
+
+// writeGAMTraceText renders the trace as a fixed-width listing suitable for diffing
+func writeGAMTraceText(trace *GAMTrace, writer io.Writer) error {
+	var sb strings.Builder
+
+	for _, line := range traceSummaryLines(trace) {
+		sb.WriteString(line + "\n")
+	}
+	sb.WriteString("\nINPUT    OUTPUT   TOKEN     DETAIL\n")
+	for _, token := range trace.Tokens {
+		sb.WriteString(fmt.Sprintf("%08X %08X %-9s %s\n", token.InputOffset, token.OutputOffset, token.Kind, describeToken(token)))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write text trace: %w", err)
+	}
+	return nil
+}
+
+// writeGAMTraceHTML renders the trace as a standalone annotated HTML page
+func writeGAMTraceHTML(trace *GAMTrace, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>GAM Trace</title>\n<style>\n")
+	sb.WriteString("body { font-family: monospace; }\n")
+	sb.WriteString("table { border-collapse: collapse; }\n")
+	sb.WriteString("td, th { padding: 2px 8px; text-align: left; }\n")
+	sb.WriteString("tr.bitmask { background: #e0e0e0; font-weight: bold; }\n")
+	sb.WriteString("tr.literal { background: #e6f4ea; }\n")
+	sb.WriteString("tr.reference { background: #e8f0fe; }\n")
+	sb.WriteString("tr.overlap { background: #fef7e0; }\n")
+	sb.WriteString(".error { color: #c5221f; font-weight: bold; }\n")
+	sb.WriteString("</style>\n</head>\n<body>\n<h1>GAM Trace</h1>\n<ul>\n")
+
+	for _, line := range traceSummaryLines(trace) {
+		if strings.HasPrefix(line, "Error: ") {
+			sb.WriteString(fmt.Sprintf("<li class=\"error\">%s</li>\n", html.EscapeString(line)))
+		} else {
+			sb.WriteString(fmt.Sprintf("<li>%s</li>\n", html.EscapeString(line)))
+		}
+	}
+
+	sb.WriteString("</ul>\n<table>\n<tr><th>Input</th><th>Output</th><th>Token</th><th>Detail</th></tr>\n")
+	for _, token := range trace.Tokens {
+		class := token.Kind
+		if token.Overlapping {
+			class += " overlap"
+		}
+		sb.WriteString(fmt.Sprintf("<tr class=\"%s\" id=\"in-%X\"><td>%08X</td><td>%08X</td><td>%s</td><td>%s</td></tr>\n",
+			class, token.InputOffset, token.InputOffset, token.OutputOffset, token.Kind, describeToken(token)))
+	}
+	sb.WriteString("</table>\n</body>\n</html>\n")
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write HTML trace: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,180 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains translation glossaries (source term to approved translation) and the
+// glossary lint rule, which flags dialogues using non-approved variants of a term.
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultGlossaryFile is the glossary file looked up when none is given
+const DefaultGlossaryFile = "glossary.yaml"
+
+// GlossaryRuleName identifies issues raised by the glossary rule
+const GlossaryRuleName = "glossary"
+
+// GlossaryTerm maps a source term to its approved translation
+type GlossaryTerm struct {
+	Source        string   `yaml:"source"`                   // Term as written in the original text
+	Approved      string   `yaml:"approved"`                 // Approved translation
+	Variants      []string `yaml:"variants,omitempty"`       // Known non-approved translations
+	CaseSensitive bool     `yaml:"case_sensitive,omitempty"` // Match approved text and variants exactly
+	Notes         string   `yaml:"notes,omitempty"`
+}
+
+// Glossary is the content of a glossary file
+type Glossary struct {
+	Terms []GlossaryTerm `yaml:"terms"`
+}
+
+// LoadGlossary reads and validates a glossary file
+func LoadGlossary(path string) (*Glossary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("glossary file %s not found", path))
+		}
+		return nil, fmt.Errorf("failed to read glossary file: %w", err)
+	}
+
+	var glossary Glossary
+	if err := yaml.Unmarshal(data, &glossary); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse glossary file: %w", err))
+	}
+	for i, term := range glossary.Terms {
+		if term.Approved == "" {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("glossary term %d (%q) has no approved translation", i, term.Source))
+		}
+		if term.Source == "" && len(term.Variants) == 0 {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("glossary term %q needs a source term or variants", term.Approved))
+		}
+	}
+	return &glossary, nil
+}
+
+// GlossaryRule flags dialogues that use a non-approved variant of a glossary term and,
+// when the original dialogues are known, translations of dialogues containing a source
+// term that lack its approved translation
+type GlossaryRule struct {
+	glossary *Glossary
+	original map[int]DialogueEntry // Original dialogues by ID (nil skips the missing-term check)
+}
+
+// NewGlossaryRule creates the glossary rule. original may be nil.
+func NewGlossaryRule(glossary *Glossary, original []DialogueEntry) *GlossaryRule {
+	rule := &GlossaryRule{glossary: glossary}
+	if original != nil {
+		rule.original = make(map[int]DialogueEntry, len(original))
+		for _, dialogue := range original {
+			rule.original[dialogue.ID] = dialogue
+		}
+	}
+	return rule
+}
+
+// LoadGlossaryRule creates the glossary rule from a glossary file and, when originalFile
+// is not empty, the original dialogue YAML file
+func LoadGlossaryRule(glossaryFile, originalFile string) (*GlossaryRule, error) {
+	glossary, err := LoadGlossary(glossaryFile)
+	if err != nil {
+		return nil, err
+	}
+	if originalFile == "" {
+		return NewGlossaryRule(glossary, nil), nil
+	}
+
+	original, err := dialogueyaml.Read(originalFile)
+	if err != nil {
+		return nil, err
+	}
+	return NewGlossaryRule(glossary, original.Dialogues), nil
+}
+
+// Name returns the rule name
+func (r *GlossaryRule) Name() string {
+	return GlossaryRuleName
+}
+
+// Check returns the glossary issues of every dialogue
+func (r *GlossaryRule) Check(dialogues []DialogueEntry) []LintIssue {
+	var issues []LintIssue
+	for _, dialogue := range dialogues {
+		text := glossaryText(dialogue)
+		for _, term := range r.glossary.Terms {
+			issues = append(issues, r.checkTerm(dialogue.ID, text, term)...)
+		}
+	}
+	return issues
+}
+
+// checkTerm checks a single term against the text of a dialogue
+func (r *GlossaryRule) checkTerm(dialogueID int, text string, term GlossaryTerm) []LintIssue {
+	var issues []LintIssue
+	label := term.Approved
+	if term.Source != "" {
+		label = fmt.Sprintf("%s → %s", term.Source, term.Approved)
+	}
+
+	haystack, approved := text, term.Approved
+	if !term.CaseSensitive {
+		haystack, approved = strings.ToLower(haystack), strings.ToLower(approved)
+	}
+
+	// Blank out approved occurrences so variants contained in the approved term
+	// (e.g. "Pig" in "Evil Pig") are not reported
+	remaining := strings.ReplaceAll(haystack, approved, strings.Repeat(" ", len(approved)))
+
+	// Longer variants are matched first and blanked out, so "Pig" is not reported
+	// again inside "Wicked Pig"
+	variants := append([]string(nil), term.Variants...)
+	sort.SliceStable(variants, func(i, j int) bool { return len(variants[i]) > len(variants[j]) })
+	for _, variant := range variants {
+		needle := variant
+		if !term.CaseSensitive {
+			needle = strings.ToLower(variant)
+		}
+		count := strings.Count(remaining, needle)
+		remaining = strings.ReplaceAll(remaining, needle, strings.Repeat(" ", len(needle)))
+		if count > 0 {
+			issues = append(issues, LintIssue{
+				Rule:       GlossaryRuleName,
+				Severity:   SeverityError,
+				DialogueID: dialogueID,
+				Term:       label,
+				Message:    fmt.Sprintf("uses %q (%d×) instead of approved %q", variant, count, term.Approved),
+			})
+		}
+	}
+
+	if r.original == nil || term.Source == "" {
+		return issues
+	}
+	original, exists := r.original[dialogueID]
+	if !exists || !strings.Contains(glossaryText(original), term.Source) {
+		return issues
+	}
+	if !strings.Contains(haystack, approved) {
+		issues = append(issues, LintIssue{
+			Rule:       GlossaryRuleName,
+			Severity:   SeverityWarning,
+			DialogueID: dialogueID,
+			Term:       label,
+			Message:    fmt.Sprintf("original contains %q but the translation lacks %q", term.Source, term.Approved),
+		})
+	}
+	return issues
+}
+
+// glossaryText joins the text items of a dialogue with control tags removed, so terms
+// split by [NEWLINE] still match
+func glossaryText(dialogue DialogueEntry) string {
+	text := strings.Join(dialogueTexts(dialogue), " ")
+	return strings.Join(strings.Fields(controlTagRegex.ReplaceAllString(text, " ")), " ")
+}
@@ -0,0 +1,106 @@
+// Package pkg provides tests for glossaries and the dialogue linter
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// textDialogue builds a dialogue entry holding the given text items
+func textDialogue(id int, texts ...string) DialogueEntry {
+	content := make([]map[string]interface{}, 0, len(texts))
+	for _, text := range texts {
+		content = append(content, map[string]interface{}{"text": text})
+	}
+	return DialogueEntry{ID: id, Type: "dialogue", FontHeight: 16, Content: content}
+}
+
+func TestGlossaryRule_Check(t *testing.T) {
+	glossary := &Glossary{Terms: []GlossaryTerm{
+		{Source: "ブタ", Approved: "Evil Pig", Variants: []string{"Wicked Pig", "Pig"}},
+		{Approved: "Tomba", Variants: []string{"Tombi"}, CaseSensitive: true},
+	}}
+	original := []DialogueEntry{
+		textDialogue(0, "ブタだ！"),
+		textDialogue(1, "ブタ[NEWLINE]"),
+		textDialogue(2, "トンバ"),
+	}
+	translated := []DialogueEntry{
+		textDialogue(0, "The Evil[NEWLINE]Pig is here!"),
+		textDialogue(1, "The wicked pig laughs."),
+		textDialogue(2, "Tombi and tombi"),
+	}
+
+	report := NewLinter(NewGlossaryRule(glossary, original)).Check(translated)
+
+	type key struct {
+		id       int
+		severity string
+	}
+	got := make(map[key]int)
+	for _, issue := range report.Issues {
+		got[key{issue.DialogueID, issue.Severity}]++
+	}
+	want := map[key]int{
+		{1, SeverityError}:   1, // "wicked pig" matches the Wicked Pig variant
+		{1, SeverityWarning}: 1, // ブタ in the original but no Evil Pig
+		{2, SeverityError}:   1, // Case-sensitive: only "Tombi" matches
+	}
+	if len(got) != len(want) {
+		t.Fatalf("issues = %+v, want %v", report.Issues, want)
+	}
+	for k, count := range want {
+		if got[k] != count {
+			t.Errorf("dialogue %d %s issues = %d, want %d", k.id, k.severity, got[k], count)
+		}
+	}
+	if report.Errors != 2 || report.Warnings != 1 {
+		t.Errorf("errors/warnings = %d/%d, want 2/1", report.Errors, report.Warnings)
+	}
+}
+
+func TestLoadGlossary(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "glossary.yaml")
+	if err := os.WriteFile(valid, []byte("terms:\n  - source: ブタ\n    approved: Evil Pig\n    variants: [Wicked Pig]\n"), 0644); err != nil {
+		t.Fatalf("failed to write glossary: %v", err)
+	}
+	glossary, err := LoadGlossary(valid)
+	if err != nil {
+		t.Fatalf("LoadGlossary() failed: %v", err)
+	}
+	if len(glossary.Terms) != 1 || glossary.Terms[0].Variants[0] != "Wicked Pig" {
+		t.Errorf("LoadGlossary() = %+v", glossary)
+	}
+
+	invalid := filepath.Join(dir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("terms:\n  - source: ブタ\n"), 0644); err != nil {
+		t.Fatalf("failed to write glossary: %v", err)
+	}
+	if _, err := LoadGlossary(invalid); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("LoadGlossary() without approved = %v, want format error", err)
+	}
+}
+
+func TestWriteLintReport_GroupsByTerm(t *testing.T) {
+	report := &LintReport{File: "translated.yaml", Dialogues: 3, Errors: 2, Issues: []LintIssue{
+		{Rule: GlossaryRuleName, Severity: SeverityError, DialogueID: 1, Term: "ブタ → Evil Pig", Message: "uses \"Wicked Pig\""},
+		{Rule: GlossaryRuleName, Severity: SeverityError, DialogueID: 2, Term: "Tomba", Message: "uses \"Tombi\""},
+	}}
+
+	var buffer bytes.Buffer
+	if err := WriteLintReport(report, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteLintReport() failed: %v", err)
+	}
+	output := buffer.String()
+	for _, want := range []string{"## glossary", "### Tomba (1)", "### ブタ → Evil Pig (1)"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("markdown report missing %q:\n%s", want, output)
+		}
+	}
+}
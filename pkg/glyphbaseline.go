@@ -0,0 +1,478 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the glyph baseline alignment: it compares the vertical ink bounds of the
+// glyphs used by an encode with the original font and shifts the glyph rows so that text of
+// mixed font heights (event captions next to dialogue) keeps the original vertical placement.
+// Per-character overrides take precedence over the automatic shifts.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// Sources of the shift applied to a glyph
+const (
+	BaselineSourceOriginal = "original" // Matches the ink bounds of the original glyph of the character
+	BaselineSourceHeight   = "height"   // Moves the baseline of the font height onto the original one
+	BaselineSourceOverride = "override" // Set by the overrides file
+)
+
+// glyphInk holds the first and last rows of a glyph holding a non-transparent pixel
+type glyphInk struct {
+	top    int
+	bottom int
+}
+
+// GlyphBaselineReference holds the vertical ink bounds of an original font
+type GlyphBaselineReference struct {
+	File      string
+	baselines map[int]int               // Bottom ink row most glyphs share, by font height
+	bounds    map[int]map[rune]glyphInk // Ink bounds of the mapped characters, by font height
+}
+
+// GlyphBaselineOverride sets the shift of a character instead of the automatic one
+type GlyphBaselineOverride struct {
+	Character string `yaml:"character"`
+	Height    int    `yaml:"height,omitempty"` // Font height the override applies to (0: every height)
+	Shift     int    `yaml:"shift"`            // Rows to move the glyph, positive moves it down
+}
+
+// GlyphBaselineOverrides is the per-character overrides file of the baseline alignment
+type GlyphBaselineOverrides struct {
+	Overrides []GlyphBaselineOverride `yaml:"overrides"`
+}
+
+// GlyphBaselineHeight summarizes the baseline of a font height in both fonts
+type GlyphBaselineHeight struct {
+	Height           int  `json:"height"`
+	InOriginal       bool `json:"in_original"`       // The original font has glyphs of this height
+	OriginalBaseline int  `json:"original_baseline"` // Bottom ink row most original glyphs share
+	NewBaseline      int  `json:"new_baseline"`      // Bottom ink row most new glyphs without an original share
+	Shift            int  `json:"shift"`             // Rows applied to the glyphs without an original
+	Glyphs           int  `json:"glyphs"`
+	Shifted          int  `json:"shifted"`
+}
+
+// GlyphBaselineGlyph compares the ink bounds of a new glyph with the original font
+type GlyphBaselineGlyph struct {
+	Character      string `json:"character"`
+	Codepoint      string `json:"codepoint"`
+	Height         int    `json:"height"`
+	Top            int    `json:"top"`    // First inked row of the new glyph
+	Bottom         int    `json:"bottom"` // Last inked row of the new glyph
+	InOriginal     bool   `json:"in_original"`
+	OriginalTop    int    `json:"original_top"`
+	OriginalBottom int    `json:"original_bottom"`
+	Shift          int    `json:"shift"`             // Rows the glyph is moved, positive moves it down
+	Source         string `json:"source"`            // original, height or override
+	Clamped        bool   `json:"clamped,omitempty"` // The shift was limited to the blank rows of the glyph
+}
+
+// GlyphBaselineReport lists the baseline of every font height and the shift of every glyph
+type GlyphBaselineReport struct {
+	Original string                `json:"original,omitempty"`
+	Heights  []GlyphBaselineHeight `json:"heights"`
+	Glyphs   []GlyphBaselineGlyph  `json:"glyphs"`
+}
+
+// SetBaselineAlignment makes Encode shift the glyph rows to the ink bounds of the original
+// font (nil disables) and applies the per-character overrides (nil applies none)
+func (e *WFMFileEncoder) SetBaselineAlignment(reference *GlyphBaselineReference, overrides *GlyphBaselineOverrides) {
+	e.baselineReference = reference
+	e.baselineOverrides = overrides
+}
+
+// LoadGlyphBaselineReference measures the glyphs of an original WFM file. Glyphs are
+// mapped to characters with the reference fonts of fontDir, the same way decode does;
+// an empty fontDir only measures the baseline of every font height.
+func LoadGlyphBaselineReference(wfmFile, fontDir string) (*GlyphBaselineReference, error) {
+	file, err := os.Open(wfmFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open original WFM file: %w", err))
+	}
+	defer file.Close()
+
+	wfm, err := NewWFMDecoder().Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode original WFM file %s: %w", wfmFile, err)
+	}
+
+	var glyphMapping map[uint16]string
+	if fontDir != "" {
+		if glyphMapping, err = NewWFMExporter().buildGlyphMappingFromGlyphs(wfm.Glyphs, fontDir); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to map glyphs: %w", err))
+		}
+	}
+
+	reference := NewGlyphBaselineReference(wfm.Glyphs, glyphMapping)
+	reference.File = wfmFile
+	return reference, nil
+}
+
+// NewGlyphBaselineReference measures the ink bounds of original glyphs; glyphMapping
+// gives the character of the glyph indices it holds
+func NewGlyphBaselineReference(glyphs []Glyph, glyphMapping map[uint16]string) *GlyphBaselineReference {
+	reference := &GlyphBaselineReference{
+		baselines: make(map[int]int),
+		bounds:    make(map[int]map[rune]glyphInk),
+	}
+
+	bottoms := make(map[int][]int)
+	for i, glyph := range glyphs {
+		ink, ok := glyphInkBounds(glyph)
+		if !ok {
+			continue
+		}
+		height := int(glyph.GlyphHeight)
+		bottoms[height] = append(bottoms[height], ink.bottom)
+
+		chars := []rune(glyphMapping[uint16(i)])
+		if len(chars) != 1 {
+			continue
+		}
+		if reference.bounds[height] == nil {
+			reference.bounds[height] = make(map[rune]glyphInk)
+		}
+		reference.bounds[height][chars[0]] = ink
+	}
+	for height, rows := range bottoms {
+		reference.baselines[height] = mostCommonRow(rows, -1)
+	}
+	return reference
+}
+
+// LoadGlyphBaselineOverrides reads and validates a baseline overrides file
+func LoadGlyphBaselineOverrides(path string) (*GlyphBaselineOverrides, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("baseline overrides file %s not found", path))
+		}
+		return nil, fmt.Errorf("failed to read baseline overrides file: %w", err)
+	}
+
+	var overrides GlyphBaselineOverrides
+	if err := yaml.Unmarshal(data, &overrides); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse baseline overrides file: %w", err))
+	}
+	seen := make(map[string]bool)
+	for i, override := range overrides.Overrides {
+		if len([]rune(override.Character)) != 1 {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("baseline override %d: character %q must be a single character", i, override.Character))
+		}
+		if override.Height < 0 {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("baseline override %d: invalid font height %d", i, override.Height))
+		}
+		key := fmt.Sprintf("%s/%d", override.Character, override.Height)
+		if seen[key] {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("baseline override %d: %q at height %d is overridden twice", i, override.Character, override.Height))
+		}
+		seen[key] = true
+	}
+	return &overrides, nil
+}
+
+// lookup returns the override of a character at a font height; an override of that
+// height wins over one applying to every height
+func (o *GlyphBaselineOverrides) lookup(char rune, height int) (int, bool) {
+	if o == nil {
+		return 0, false
+	}
+	shift, found := 0, false
+	for _, override := range o.Overrides {
+		if override.Character != string(char) {
+			continue
+		}
+		if override.Height == height {
+			return override.Shift, true
+		}
+		if override.Height == 0 {
+			shift, found = override.Shift, true
+		}
+	}
+	return shift, found
+}
+
+// AnalyzeGlyphBaselines compares the glyphs an encode of yamlFile would load from the
+// fonts/ PNG tree with the original WFM file, without encoding anything
+func AnalyzeGlyphBaselines(originalFile, yamlFile, fontDir string, overrides *GlyphBaselineOverrides) (*GlyphBaselineReport, error) {
+	reference, err := LoadGlyphBaselineReference(originalFile, fontDir)
+	if err != nil {
+		return nil, err
+	}
+
+	encoder := NewWFMEncoder()
+	dialogues, _, err := encoder.LoadDialogues(yamlFile)
+	if err != nil {
+		return nil, common.FormatError(common.ErrFailedToLoadDialogues, err)
+	}
+	if encoder.palettes, err = LoadProjectPalettes(filepath.Dir(yamlFile)); err != nil {
+		return nil, err
+	}
+	glyphMap, err := encoder.mapGlyphsByDialogue(dialogues)
+	if err != nil {
+		return nil, common.FormatError(common.ErrFailedToMapGlyphs, err)
+	}
+
+	return BuildGlyphBaselineReport(glyphMap, reference, overrides), nil
+}
+
+// BuildGlyphBaselineReport works out the shift of every glyph of glyphMap. A character
+// of the original font gets the ink bounds of its original glyph; the other characters
+// of a font height are moved so that their most common bottom row lands on the original
+// baseline of that height. Overrides replace both, and shifts are limited to the blank
+// rows of the glyph. A nil reference only applies the overrides.
+func BuildGlyphBaselineReport(glyphMap map[int]map[rune]Glyph, reference *GlyphBaselineReference, overrides *GlyphBaselineOverrides) *GlyphBaselineReport {
+	report := &GlyphBaselineReport{Heights: []GlyphBaselineHeight{}, Glyphs: []GlyphBaselineGlyph{}}
+	if reference != nil {
+		report.Original = reference.File
+	}
+
+	heights := make([]int, 0, len(glyphMap))
+	for height := range glyphMap {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+
+	for _, height := range heights {
+		chars := make([]rune, 0, len(glyphMap[height]))
+		inks := make(map[rune]glyphInk)
+		for char, glyph := range glyphMap[height] {
+			if ink, ok := glyphInkBounds(glyph); ok {
+				chars = append(chars, char)
+				inks[char] = ink
+			}
+		}
+		if len(chars) == 0 {
+			continue
+		}
+		sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+
+		summary := GlyphBaselineHeight{Height: height, Glyphs: len(chars), OriginalBaseline: -1}
+		var originalBounds map[rune]glyphInk
+		if reference != nil {
+			summary.OriginalBaseline, summary.InOriginal = reference.baselines[height]
+			if !summary.InOriginal {
+				summary.OriginalBaseline = -1
+			}
+			originalBounds = reference.bounds[height]
+		}
+
+		// The glyphs without an original decide the baseline of the new font
+		var bottoms []int
+		for _, char := range chars {
+			if _, known := originalBounds[char]; !known {
+				bottoms = append(bottoms, inks[char].bottom)
+			}
+		}
+		if len(bottoms) == 0 {
+			for _, char := range chars {
+				bottoms = append(bottoms, inks[char].bottom)
+			}
+		}
+		summary.NewBaseline = mostCommonRow(bottoms, summary.OriginalBaseline)
+		if summary.InOriginal {
+			summary.Shift = summary.OriginalBaseline - summary.NewBaseline
+		}
+
+		for _, char := range chars {
+			ink := inks[char]
+			entry := GlyphBaselineGlyph{
+				Character: string(char),
+				Codepoint: fmt.Sprintf("U+%04X", char),
+				Height:    height,
+				Top:       ink.top,
+				Bottom:    ink.bottom,
+				Shift:     summary.Shift,
+				Source:    BaselineSourceHeight,
+			}
+			if original, known := originalBounds[char]; known {
+				entry.InOriginal = true
+				entry.OriginalTop, entry.OriginalBottom = original.top, original.bottom
+				entry.Shift, entry.Source = original.bottom-ink.bottom, BaselineSourceOriginal
+			}
+			if shift, ok := overrides.lookup(char, height); ok {
+				entry.Shift, entry.Source = shift, BaselineSourceOverride
+			}
+
+			// Rows moved out of the glyph must be blank
+			glyphHeight := int(glyphMap[height][char].GlyphHeight)
+			if limit := glyphHeight - 1 - ink.bottom; entry.Shift > limit {
+				entry.Shift, entry.Clamped = limit, true
+			}
+			if entry.Shift < -ink.top {
+				entry.Shift, entry.Clamped = -ink.top, true
+			}
+			if entry.Shift != 0 {
+				summary.Shifted++
+			}
+			report.Glyphs = append(report.Glyphs, entry)
+		}
+		report.Heights = append(report.Heights, summary)
+	}
+	return report
+}
+
+// applyGlyphBaselines moves the rows of the glyphs of glyphMap by the shifts of a report
+func applyGlyphBaselines(glyphMap map[int]map[rune]Glyph, report *GlyphBaselineReport) {
+	for _, entry := range report.Glyphs {
+		if entry.Clamped {
+			common.LogWarn("Glyph '%s' (%s) at font height %d can only move %d rows", entry.Character, entry.Codepoint, entry.Height, entry.Shift)
+		}
+		if entry.Shift == 0 {
+			continue
+		}
+		char := []rune(entry.Character)[0]
+		glyphMap[entry.Height][char] = shiftGlyphRows(glyphMap[entry.Height][char], entry.Shift)
+		common.LogDebug("Glyph '%s' (%s) at font height %d moved %+d rows (%s)", entry.Character, entry.Codepoint, entry.Height, entry.Shift, entry.Source)
+	}
+}
+
+// glyphInkBounds returns the first and last rows of a glyph holding a non-transparent
+// pixel (palette index 0 is transparent); ok is false for blank glyphs
+func glyphInkBounds(glyph Glyph) (glyphInk, bool) {
+	data, err := glyph.Image()
+	if err != nil || glyph.IsPlaceholder() {
+		return glyphInk{}, false
+	}
+	tile := &psx.PSXTile{Width: int(glyph.GlyphWidth), Height: int(glyph.GlyphHeight), Data: data}
+
+	ink := glyphInk{top: -1, bottom: -1}
+	for y := 0; y < tile.Height; y++ {
+		for x := 0; x < tile.Width; x++ {
+			if index, err := tile.GetPixel(x, y); err == nil && index != 0 {
+				if ink.top < 0 {
+					ink.top = y
+				}
+				ink.bottom = y
+				break
+			}
+		}
+	}
+	return ink, ink.top >= 0
+}
+
+// shiftGlyphRows returns a copy of a glyph with its rows moved down by shift (up when
+// negative); rows moved in are transparent
+func shiftGlyphRows(glyph Glyph, shift int) Glyph {
+	data, err := glyph.Image()
+	if err != nil {
+		return glyph
+	}
+	source := &psx.PSXTile{Width: int(glyph.GlyphWidth), Height: int(glyph.GlyphHeight), Data: data}
+	shifted := &psx.PSXTile{Width: source.Width, Height: source.Height, Data: make([]byte, len(data))}
+	for y := 0; y < source.Height; y++ {
+		from := y - shift
+		if from < 0 || from >= source.Height {
+			continue
+		}
+		for x := 0; x < source.Width; x++ {
+			if index, err := source.GetPixel(x, from); err == nil {
+				_ = shifted.SetPixel(x, y, index)
+			}
+		}
+	}
+	glyph.GlyphImage = shifted.Data
+	return glyph
+}
+
+// mostCommonRow returns the row that occurs most often; ties go to the row closest to
+// preferred (the lowest row when preferred is negative)
+func mostCommonRow(rows []int, preferred int) int {
+	counts := make(map[int]int)
+	for _, row := range rows {
+		counts[row]++
+	}
+	best, bestCount := -1, 0
+	for row, count := range counts {
+		if count > bestCount || (count == bestCount && closerRow(row, best, preferred)) {
+			best, bestCount = row, count
+		}
+	}
+	return best
+}
+
+// closerRow reports whether row breaks a tie with best: it is closer to preferred or,
+// at the same distance or without a preferred row, lower
+func closerRow(row, best, preferred int) bool {
+	if preferred >= 0 && abs(row-preferred) != abs(best-preferred) {
+		return abs(row-preferred) < abs(best-preferred)
+	}
+	return row > best
+}
+
+// WriteGlyphBaselineReport writes a baseline report as JSON or markdown
+func WriteGlyphBaselineReport(report *GlyphBaselineReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeGlyphBaselineMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeGlyphBaselineMarkdown writes a baseline report as markdown tables
+func writeGlyphBaselineMarkdown(report *GlyphBaselineReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Glyph Baselines")
+	if report.Original != "" {
+		sb.WriteString(": " + report.Original)
+	}
+	sb.WriteString("\n\n| Height | Original baseline | New baseline | Shift | Glyphs | Shifted |\n")
+	sb.WriteString("|--------|-------------------|--------------|-------|--------|---------|\n")
+	for _, height := range report.Heights {
+		original := "-"
+		if height.InOriginal {
+			original = fmt.Sprintf("%d", height.OriginalBaseline)
+		}
+		sb.WriteString(fmt.Sprintf("| %d | %s | %d | %+d | %d | %d |\n", height.Height, original,
+			height.NewBaseline, height.Shift, height.Glyphs, height.Shifted))
+	}
+
+	var shifted []GlyphBaselineGlyph
+	for _, glyph := range report.Glyphs {
+		if glyph.Shift != 0 || glyph.Clamped {
+			shifted = append(shifted, glyph)
+		}
+	}
+	if len(shifted) == 0 {
+		sb.WriteString("\nNo glyph needs to move.\n")
+	} else {
+		sb.WriteString("\n| Character | Code | Height | Ink rows | Original ink rows | Shift | Source |\n")
+		sb.WriteString("|-----------|------|--------|----------|-------------------|-------|--------|\n")
+		for _, glyph := range shifted {
+			original := "-"
+			if glyph.InOriginal {
+				original = fmt.Sprintf("%d-%d", glyph.OriginalTop, glyph.OriginalBottom)
+			}
+			shift := fmt.Sprintf("%+d", glyph.Shift)
+			if glyph.Clamped {
+				shift += " (clamped)"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d-%d | %s | %s | %s |\n", glyph.Character, glyph.Codepoint,
+				glyph.Height, glyph.Top, glyph.Bottom, original, shift, glyph.Source))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
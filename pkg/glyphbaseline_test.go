@@ -0,0 +1,119 @@
+// Package pkg provides tests for the glyph baseline alignment
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// baselineGlyph creates a 4x8 glyph inked from row top to row bottom
+func baselineGlyph(top, bottom int) Glyph {
+	tile := &psx.PSXTile{Width: 4, Height: 8, Data: make([]byte, 16)}
+	for y := top; y <= bottom; y++ {
+		_ = tile.SetPixel(1, y, 3)
+	}
+	return Glyph{GlyphHeight: 8, GlyphWidth: 4, GlyphImage: tile.Data}
+}
+
+func TestBuildGlyphBaselineReport(t *testing.T) {
+	// Original font: baseline at row 6, 'g' descends to row 7
+	original := []Glyph{baselineGlyph(1, 6), baselineGlyph(2, 6), baselineGlyph(3, 7), baselineGlyph(1, 6)}
+	reference := NewGlyphBaselineReference(original, map[uint16]string{0: "A", 2: "g"})
+
+	// New glyphs drawn two rows too high, 'A' redrawn one row too low
+	glyphMap := map[int]map[rune]Glyph{8: {
+		'A': baselineGlyph(2, 7),
+		'g': baselineGlyph(3, 7),
+		'é': baselineGlyph(0, 4),
+		'ç': baselineGlyph(1, 5),
+		'x': baselineGlyph(2, 4),
+		'^': baselineGlyph(0, 1),
+		' ': {GlyphHeight: 8, GlyphWidth: 4, GlyphImage: make([]byte, 16)},
+	}}
+	overrides := &GlyphBaselineOverrides{Overrides: []GlyphBaselineOverride{
+		{Character: "^", Shift: -3},
+		{Character: "x", Height: 16, Shift: 5},
+	}}
+
+	report := BuildGlyphBaselineReport(glyphMap, reference, overrides)
+
+	wantHeight := GlyphBaselineHeight{Height: 8, InOriginal: true, OriginalBaseline: 6, NewBaseline: 4, Shift: 2, Glyphs: 6, Shifted: 4}
+	if len(report.Heights) != 1 || report.Heights[0] != wantHeight {
+		t.Fatalf("Heights = %+v, want %+v", report.Heights, wantHeight)
+	}
+
+	shifts := make(map[string]GlyphBaselineGlyph)
+	for _, glyph := range report.Glyphs {
+		shifts[glyph.Character] = glyph
+	}
+	want := map[string]struct {
+		shift   int
+		source  string
+		clamped bool
+	}{
+		"A": {-1, BaselineSourceOriginal, false},
+		"g": {0, BaselineSourceOriginal, false},
+		"é": {2, BaselineSourceHeight, false},
+		"ç": {2, BaselineSourceHeight, false},
+		"x": {2, BaselineSourceHeight, false}, // The override only applies to height 16
+		"^": {0, BaselineSourceOverride, true},
+	}
+	if len(shifts) != len(want) {
+		t.Errorf("Glyphs = %+v, want the %d inked glyphs", report.Glyphs, len(want))
+	}
+	for char, w := range want {
+		got := shifts[char]
+		if got.Shift != w.shift || got.Source != w.source || got.Clamped != w.clamped {
+			t.Errorf("glyph %q = %+v, want shift %d from %s (clamped %v)", char, got, w.shift, w.source, w.clamped)
+		}
+	}
+
+	applyGlyphBaselines(glyphMap, report)
+	if ink, _ := glyphInkBounds(glyphMap[8]['é']); ink != (glyphInk{top: 2, bottom: 6}) {
+		t.Errorf("shifted 'é' ink = %+v, want rows 2-6", ink)
+	}
+	if ink, _ := glyphInkBounds(glyphMap[8]['A']); ink != (glyphInk{top: 1, bottom: 6}) {
+		t.Errorf("shifted 'A' ink = %+v, want rows 1-6", ink)
+	}
+
+	var sb strings.Builder
+	if err := WriteGlyphBaselineReport(report, ReportFormatMarkdown, &sb); err != nil {
+		t.Fatalf("WriteGlyphBaselineReport() failed: %v", err)
+	}
+	if !strings.Contains(sb.String(), "| 8 | 6 | 4 | +2 | 6 | 4 |") || !strings.Contains(sb.String(), "| ^ | U+005E | 8 | 0-1 | - | +0 (clamped) | override |") {
+		t.Errorf("markdown report lacks the expected rows:\n%s", sb.String())
+	}
+}
+
+func TestLoadGlyphBaselineOverrides(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "baseline.yaml")
+	if err := os.WriteFile(path, []byte("overrides:\n  - character: \"j\"\n    shift: 1\n  - character: \"j\"\n    height: 24\n    shift: -1\n"), 0644); err != nil {
+		t.Fatalf("failed to write overrides: %v", err)
+	}
+	overrides, err := LoadGlyphBaselineOverrides(path)
+	if err != nil {
+		t.Fatalf("LoadGlyphBaselineOverrides() failed: %v", err)
+	}
+	if shift, ok := overrides.lookup('j', 24); !ok || shift != -1 {
+		t.Errorf("lookup('j', 24) = %d, %v; want the height 24 override", shift, ok)
+	}
+	if shift, ok := overrides.lookup('j', 16); !ok || shift != 1 {
+		t.Errorf("lookup('j', 16) = %d, %v; want the override of every height", shift, ok)
+	}
+
+	if err := os.WriteFile(path, []byte("overrides:\n  - character: \"ab\"\n    shift: 1\n"), 0644); err != nil {
+		t.Fatalf("failed to write overrides: %v", err)
+	}
+	if _, err := LoadGlyphBaselineOverrides(path); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("LoadGlyphBaselineOverrides(two characters) = %v, want a format error", err)
+	}
+	if _, err := LoadGlyphBaselineOverrides(filepath.Join(dir, "missing.yaml")); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("LoadGlyphBaselineOverrides(missing) = %v, want an input not found error", err)
+	}
+}
@@ -0,0 +1,221 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file lets the WFM encoder take its glyph table from an existing (donor) WFM file
+// instead of the fonts/ PNG tree. The donor glyph table is copied unchanged and the
+// character of each glyph is learned from the donor dialogues that were left unedited.
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// SetGlyphDonor makes Encode reuse the glyph table of an existing WFM file
+func (e *WFMFileEncoder) SetGlyphDonor(donorFile string) error {
+	file, err := os.Open(donorFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open glyph donor WFM: %w", err))
+	}
+	defer file.Close()
+
+	donor, err := NewWFMDecoder().Decode(file)
+	if err != nil {
+		return fmt.Errorf("failed to decode glyph donor WFM %s: %w", donorFile, err)
+	}
+
+	e.donor = donor
+	e.donorFile = donorFile
+	return nil
+}
+
+// mapDonorGlyphs builds the encode mappings from the donor WFM. Glyphs keep their
+// donor index, and every character used by the dialogues must have been seen in an
+// unedited donor dialogue of the same font height.
+func (e *WFMFileEncoder) mapDonorGlyphs(dialogues []DialogueEntry) (glyphEncodeMap map[int]map[rune]uint16, encodeValueMap map[uint16]GlyphEncodeInfo, encodeOrder []uint16, err error) {
+	// Votes of the aligned dialogues: [fontHeight][glyph][char] = count
+	votes := make(map[int]map[uint16]map[rune]int)
+
+	aligned := 0
+	for _, dialogue := range dialogues {
+		if dialogue.ID < 0 || dialogue.ID >= len(e.donor.Dialogues) {
+			continue
+		}
+		learned, ok := e.alignDonorDialogue(dialogue, e.donor.Dialogues[dialogue.ID])
+		if !ok {
+			continue
+		}
+		aligned++
+
+		if votes[dialogue.FontHeight] == nil {
+			votes[dialogue.FontHeight] = make(map[uint16]map[rune]int)
+		}
+		for char, encodeValue := range learned {
+			if votes[dialogue.FontHeight][encodeValue] == nil {
+				votes[dialogue.FontHeight][encodeValue] = make(map[rune]int)
+			}
+			votes[dialogue.FontHeight][encodeValue][char]++
+		}
+	}
+	common.LogInfo("Glyph donor: %d of %d dialogues matched the donor text", aligned, len(dialogues))
+
+	glyphEncodeMap = resolveDonorVotes(votes)
+
+	if missing := e.missingDonorCharacters(dialogues, glyphEncodeMap); len(missing) > 0 {
+		return nil, nil, nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("characters without a donor glyph: %s", strings.Join(missing, ", ")))
+	}
+
+	encodeValueMap = make(map[uint16]GlyphEncodeInfo, len(e.donor.Glyphs))
+	encodeOrder = make([]uint16, 0, len(e.donor.Glyphs))
+	characters := make(map[uint16]GlyphEncodeInfo)
+	for fontHeight, chars := range glyphEncodeMap {
+		for char, encodeValue := range chars {
+			characters[encodeValue] = GlyphEncodeInfo{Character: char, FontHeight: fontHeight}
+		}
+	}
+	for i, glyph := range e.donor.Glyphs {
+		encodeValue := uint16(GLYPH_ID_BASE + i)
+		info := characters[encodeValue]
+		info.Glyph = glyph
+		encodeValueMap[encodeValue] = info
+		encodeOrder = append(encodeOrder, encodeValue)
+	}
+
+	return glyphEncodeMap, encodeValueMap, encodeOrder, nil
+}
+
+// resolveDonorVotes picks the character of each donor glyph by majority, so that a
+// same-length edit in one dialogue cannot relabel a glyph used elsewhere. When a
+// character wins several glyphs (duplicated in the font) the most voted glyph is used.
+// Ties are broken by the lowest character or glyph ID to keep the output deterministic.
+func resolveDonorVotes(votes map[int]map[uint16]map[rune]int) map[int]map[rune]uint16 {
+	glyphEncodeMap := make(map[int]map[rune]uint16)
+
+	for fontHeight, glyphs := range votes {
+		best := make(map[rune]int) // Votes of the glyph currently chosen for each character
+		glyphEncodeMap[fontHeight] = make(map[rune]uint16)
+
+		encodeValues := make([]uint16, 0, len(glyphs))
+		for encodeValue := range glyphs {
+			encodeValues = append(encodeValues, encodeValue)
+		}
+		sort.Slice(encodeValues, func(i, j int) bool { return encodeValues[i] < encodeValues[j] })
+
+		for _, encodeValue := range encodeValues {
+			var winner rune
+			winnerVotes := 0
+			for char, count := range glyphs[encodeValue] {
+				if count > winnerVotes || (count == winnerVotes && char < winner) {
+					winner, winnerVotes = char, count
+				}
+			}
+			if len(glyphs[encodeValue]) > 1 {
+				common.LogDebug("Glyph donor: glyph %04X matched %d characters, using '%c'", encodeValue, len(glyphs[encodeValue]), winner)
+			}
+
+			if winnerVotes > best[winner] {
+				glyphEncodeMap[fontHeight][winner] = encodeValue
+				best[winner] = winnerVotes
+			}
+		}
+	}
+
+	return glyphEncodeMap
+}
+
+// alignDonorDialogue pairs the text items of a YAML dialogue with the donor dialogue
+// and returns the glyph of every character, or false if the texts differ
+func (e *WFMFileEncoder) alignDonorDialogue(dialogue DialogueEntry, donorDialogue Dialogue) (map[rune]uint16, bool) {
+	donorContent, _, _, _, _ := processDialogueText(donorDialogue.Data, nil, e.donor.Glyphs, e.pageBreaks)
+
+	texts := dialogueTexts(dialogue)
+	donorTexts := dialogueTexts(DialogueEntry{Content: donorContent})
+	if len(texts) != len(donorTexts) {
+		return nil, false
+	}
+
+	learned := make(map[rune]uint16)
+	for i := range texts {
+		if !alignDonorText([]rune(texts[i]), []rune(donorTexts[i]), learned) {
+			return nil, false
+		}
+	}
+	return learned, true
+}
+
+// alignDonorText matches YAML text against donor text decoded without a glyph mapping,
+// where each glyph appears as a [XXXX] tag, and collects the character of each glyph
+func alignDonorText(text, donorText []rune, learned map[rune]uint16) bool {
+	i := 0
+	for j := 0; j < len(donorText); {
+		token := donorGlyphToken(donorText, j)
+
+		// Identical runs (tags, newlines and glyphs left as [XXXX] in the YAML) match as is
+		if token == 0 || (i+6 <= len(text) && string(text[i:i+6]) == string(donorText[j:j+6])) {
+			advance := 1
+			if token != 0 {
+				advance = 6
+			}
+			if i+advance > len(text) || string(text[i:i+advance]) != string(donorText[j:j+advance]) {
+				return false
+			}
+			i += advance
+			j += advance
+			continue
+		}
+
+		if i >= len(text) || text[i] == '[' || text[i] == '\n' {
+			return false
+		}
+		if existing, exists := learned[text[i]]; exists && existing != token {
+			return false
+		}
+		learned[text[i]] = token
+		i++
+		j += 6
+	}
+	return i == len(text)
+}
+
+// donorGlyphToken returns the glyph ID of a [XXXX] glyph tag at position i, or 0
+func donorGlyphToken(runes []rune, i int) uint16 {
+	if i+6 > len(runes) || runes[i] != '[' || runes[i+5] != ']' {
+		return 0
+	}
+	value, err := strconv.ParseUint(string(runes[i+1:i+5]), 16, 16)
+	if err != nil || value < GLYPH_ID_BASE || value > 0xFFF0 {
+		return 0
+	}
+	return uint16(value)
+}
+
+// missingDonorCharacters lists the characters of the dialogues that no donor glyph was found for
+func (e *WFMFileEncoder) missingDonorCharacters(dialogues []DialogueEntry, glyphEncodeMap map[int]map[rune]uint16) []string {
+	seen := make(map[string]bool)
+	var missing []string
+
+	for _, dialogue := range dialogues {
+		for _, text := range dialogueTexts(dialogue) {
+			for _, char := range e.cleanTextForGlyphMapping(text) {
+				if _, special := e.getSpecialUnicodeCode(char); special {
+					continue
+				}
+				if _, exists := glyphEncodeMap[dialogue.FontHeight][char]; exists {
+					continue
+				}
+				key := fmt.Sprintf("'%c' (U+%04X) at height %d", char, char, dialogue.FontHeight)
+				if !seen[key] {
+					seen[key] = true
+					missing = append(missing, key)
+				}
+			}
+		}
+	}
+
+	sort.Strings(missing)
+	return missing
+}
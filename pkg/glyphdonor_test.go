@@ -0,0 +1,175 @@
+// Package pkg provides tests for encoding WFM files with glyphs from a donor WFM
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// writeDonorWFM writes a WFM with glyphs for 'A' (0x8000) and 'B' (0x8001)
+// and the dialogues "AB" and "B"
+func writeDonorWFM(t *testing.T, path string) {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	buffer.WriteString(common.WFMFileMagic)
+	writeBinary(t, &buffer, uint32(0))   // Padding
+	writeBinary(t, &buffer, uint32(228)) // DialoguePointerTable
+	writeBinary(t, &buffer, uint16(2))   // TotalDialogues
+	writeBinary(t, &buffer, uint16(2))   // TotalGlyphs
+	buffer.Write(make([]byte, 128))      // Reserved
+
+	writeBinary(t, &buffer, []uint16{0, 0}) // Glyph pointer table
+	for _, fill := range []byte{0x11, 0x22} {
+		writeBinary(t, &buffer, []uint16{0x1234, 8, 8, 0})
+		buffer.Write(bytes.Repeat([]byte{fill}, 32))
+	}
+
+	writeBinary(t, &buffer, []uint16{4, 10})                  // Dialogue pointer table
+	writeBinary(t, &buffer, []uint16{0x8000, 0x8001, 0xFFFF}) // "AB"
+	writeBinary(t, &buffer, []uint16{0x8001, 0xFFFF})         // "B"
+
+	if err := os.WriteFile(path, buffer.Bytes(), 0644); err != nil {
+		t.Fatalf("failed to write donor WFM: %v", err)
+	}
+}
+
+func TestAlignDonorText(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		donorText string
+		want      bool
+		learned   map[rune]uint16
+	}{
+		{"glyphs", "AB", "[8000][8001]", true, map[rune]uint16{'A': 0x8000, 'B': 0x8001}},
+		{"newline and tag", "A\n[HALT]B", "[8000]\n[HALT][8001]", true, map[rune]uint16{'A': 0x8000, 'B': 0x8001}},
+		{"glyph kept as tag", "[8000]B", "[8000][8001]", true, map[rune]uint16{'B': 0x8001}},
+		{"edited text", "ABC", "[8000][8001]", false, nil},
+		{"conflicting glyph", "AA", "[8000][8001]", false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			learned := make(map[rune]uint16)
+			got := alignDonorText([]rune(tt.text), []rune(tt.donorText), learned)
+			if got != tt.want {
+				t.Fatalf("alignDonorText() = %v, want %v", got, tt.want)
+			}
+			for char, code := range tt.learned {
+				if learned[char] != code {
+					t.Errorf("learned['%c'] = %04X, want %04X", char, learned[char], code)
+				}
+			}
+		})
+	}
+}
+
+func TestResolveDonorVotes(t *testing.T) {
+	votes := map[int]map[uint16]map[rune]int{
+		16: {
+			0x8000: {'A': 5, 'X': 1}, // 'X' comes from an edited dialogue
+			0x8001: {'B': 2},
+			0x8002: {'B': 7}, // Duplicated glyph with more uses
+		},
+	}
+
+	got := resolveDonorVotes(votes)
+	want := map[rune]uint16{'A': 0x8000, 'B': 0x8002}
+	if len(got[16]) != len(want) {
+		t.Fatalf("len(got[16]) = %d, want %d", len(got[16]), len(want))
+	}
+	for char, code := range want {
+		if got[16][char] != code {
+			t.Errorf("got[16]['%c'] = %04X, want %04X", char, got[16][char], code)
+		}
+	}
+}
+
+func TestWFMFileEncoder_EncodeWithGlyphDonor(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{
+		TotalDialogues: 2,
+		Dialogues: []DialogueEntry{
+			{ID: 0, Type: "dialogue", FontHeight: 8, FontClut: 0x1234, Terminator: 2, Content: []map[string]interface{}{{"text": "AB"}}},
+			{ID: 1, Type: "dialogue", FontHeight: 8, FontClut: 0x1234, Terminator: 2, Content: []map[string]interface{}{{"text": "BAB"}}},
+		},
+	}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(donorFile); err != nil {
+		t.Fatalf("SetGlyphDonor() failed: %v", err)
+	}
+
+	outputFile := filepath.Join(dir, "OUT.WFM")
+	if err := encoder.Encode(context.Background(), yamlFile, outputFile); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	output, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(output))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	if len(wfm.Glyphs) != 2 {
+		t.Fatalf("len(Glyphs) = %d, want 2", len(wfm.Glyphs))
+	}
+	for i, fill := range []byte{0x11, 0x22} {
+		if !bytes.Equal(wfm.Glyphs[i].GlyphImage, bytes.Repeat([]byte{fill}, 32)) {
+			t.Errorf("Glyphs[%d] image differs from the donor", i)
+		}
+	}
+
+	want := []byte{0x01, 0x80, 0x00, 0x80, 0x01, 0x80}
+	if !bytes.Equal(wfm.Dialogues[1].Data, want) {
+		t.Errorf("Dialogues[1].Data = % X, want % X", wfm.Dialogues[1].Data, want)
+	}
+}
+
+func TestWFMFileEncoder_EncodeWithGlyphDonor_MissingCharacter(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{
+		TotalDialogues: 2,
+		Dialogues: []DialogueEntry{
+			{ID: 0, Type: "dialogue", FontHeight: 8, Terminator: 2, Content: []map[string]interface{}{{"text": "AB"}}},
+			{ID: 1, Type: "dialogue", FontHeight: 8, Terminator: 2, Content: []map[string]interface{}{{"text": "C"}}},
+		},
+	}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(donorFile); err != nil {
+		t.Fatalf("SetGlyphDonor() failed: %v", err)
+	}
+
+	err := encoder.Encode(context.Background(), yamlFile, filepath.Join(dir, "OUT.WFM"))
+	if err == nil {
+		t.Fatal("Encode() succeeded, want missing glyph error")
+	}
+	if got := common.ExitCodeFor(err); got != common.ExitValidationFailed {
+		t.Errorf("ExitCodeFor() = %d, want %d", got, common.ExitValidationFailed)
+	}
+}
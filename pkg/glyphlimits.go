@@ -0,0 +1,136 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the glyph width limits of the game renderer. Glyphs are uploaded into
+// fixed-width VRAM cells per font height; a wider glyph wraps past its cell and corrupts the
+// glyphs drawn next to it. Encode refuses such glyph PNGs and the glyph-width lint rule
+// reports them before encoding.
+package pkg
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	_ "image/png" // Glyph PNG files
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// GlyphWidthRuleName identifies issues raised by the glyph-width rule
+const GlyphWidthRuleName = "glyph-width"
+
+// errGlyphTooWide marks glyphs wider than the limit of their font height
+var errGlyphTooWide = common.WithCategory(common.ErrCategoryValidationFailed, errors.New("glyph too wide"))
+
+// GlyphWidthLimits maps font heights to the widest glyph the game renderer draws at that height.
+// Font heights without a limit accept any width.
+type GlyphWidthLimits map[int]int
+
+// Check returns an error when a glyph of the given width exceeds the limit of its font height
+func (l GlyphWidthLimits) Check(fontHeight, width int) error {
+	limit, ok := l[fontHeight]
+	if !ok || width <= limit {
+		return nil
+	}
+	return fmt.Errorf("%w: %d px wide, %d px fonts allow at most %d px (wider glyphs wrap VRAM and corrupt the adjacent glyphs)",
+		errGlyphTooWide, width, fontHeight, limit)
+}
+
+// GlyphWidthRule reports characters whose glyph PNG in the fonts directory is wider than
+// the renderer limit of the dialogue font height, which encode would refuse
+type GlyphWidthRule struct {
+	fontRoot string
+	limits   GlyphWidthLimits
+	widths   map[glyphKey]int // Width of every PNG checked, -1 when the PNG is missing or unreadable
+}
+
+// glyphKey identifies the glyph of a character at a font height
+type glyphKey struct {
+	char   rune
+	height int
+}
+
+// NewGlyphWidthRule creates the glyph-width rule reading glyph PNGs from fontRoot (fonts/)
+func NewGlyphWidthRule(fontRoot string, limits GlyphWidthLimits) *GlyphWidthRule {
+	return &GlyphWidthRule{fontRoot: fontRoot, limits: limits, widths: make(map[glyphKey]int)}
+}
+
+// Name returns the rule name
+func (r *GlyphWidthRule) Name() string {
+	return GlyphWidthRuleName
+}
+
+// Check returns an error for every character of a dialogue whose glyph PNG is too wide.
+// Characters without a PNG are left to encode, which reports them.
+func (r *GlyphWidthRule) Check(dialogues []DialogueEntry) []LintIssue {
+	var issues []LintIssue
+	for _, dialogue := range dialogues {
+		if _, limited := r.limits[dialogue.FontHeight]; !limited || dialogue.Raw != "" {
+			continue
+		}
+		var wide []string
+		for _, char := range dialogueCharacters(dialogue) {
+			width := r.glyphWidth(char, dialogue.FontHeight)
+			if err := r.limits.Check(dialogue.FontHeight, width); err != nil {
+				wide = append(wide, fmt.Sprintf("'%c' (%d px)", char, width))
+			}
+		}
+		if len(wide) > 0 {
+			issues = append(issues, LintIssue{
+				Rule:       GlyphWidthRuleName,
+				Severity:   SeverityError,
+				DialogueID: dialogue.ID,
+				Message: fmt.Sprintf("glyphs wider than the %d px limit of %d px fonts: %s",
+					r.limits[dialogue.FontHeight], dialogue.FontHeight, strings.Join(wide, ", ")),
+			})
+		}
+	}
+	return issues
+}
+
+// glyphWidth returns the width of the glyph PNG of a character, or -1 without one
+func (r *GlyphWidthRule) glyphWidth(char rune, height int) int {
+	key := glyphKey{char: char, height: height}
+	if width, ok := r.widths[key]; ok {
+		return width
+	}
+
+	width := -1
+	if path, err := findGlyphPNG(r.fontRoot, char, height); err == nil {
+		if file, err := os.Open(path); err == nil {
+			if config, _, err := image.DecodeConfig(file); err == nil {
+				width = config.Width
+			} else {
+				common.LogDebug("Failed to read glyph %s: %v", path, err)
+			}
+			file.Close()
+		}
+	}
+	r.widths[key] = width
+	return width
+}
+
+// dialogueCharacters returns the distinct characters drawn by the text content of a
+// dialogue, sorted; control tags, line breaks and zero-width markers are skipped
+func dialogueCharacters(dialogue DialogueEntry) []rune {
+	seen := make(map[rune]bool)
+	var chars []rune
+	for _, contentItem := range dialogue.Content {
+		text, ok := contentItem["text"].(string)
+		if !ok {
+			continue
+		}
+		text = strings.ReplaceAll(text, PageBreakTag, "")
+		text = stripZeroWidth(controlTagRegex.ReplaceAllString(text, ""))
+		for _, char := range text {
+			if char == '\n' || seen[char] {
+				continue
+			}
+			seen[char] = true
+			chars = append(chars, char)
+		}
+	}
+	sort.Slice(chars, func(i, j int) bool { return chars[i] < chars[j] })
+	return chars
+}
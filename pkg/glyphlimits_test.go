@@ -0,0 +1,89 @@
+// Package pkg provides tests for the glyph width limits
+package pkg
+
+import (
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// writeGlyphLimitTestPNG writes an empty glyph PNG of the given size into the encode
+// region of a fonts directory
+func writeGlyphLimitTestPNG(t *testing.T, fontRoot, name string, width, height int) {
+	t.Helper()
+	dir := filepath.Join(fontRoot, encodeFontRegion, "16", "uppercase")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if err := png.Encode(file, image.NewNRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGlyphWidthLimits_Check(t *testing.T) {
+	limits := GlyphWidthLimits{16: 16}
+	if err := limits.Check(16, 16); err != nil {
+		t.Errorf("Check(16, 16) = %v, want nil", err)
+	}
+	if err := limits.Check(24, 40); err != nil {
+		t.Errorf("Check() of a font height without limit = %v, want nil", err)
+	}
+
+	err := limits.Check(16, 18)
+	if !errors.Is(err, errGlyphTooWide) || common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Fatalf("Check(16, 18) = %v, want a validation error", err)
+	}
+	if !strings.Contains(err.Error(), "18 px wide, 16 px fonts allow at most 16 px") {
+		t.Errorf("Check(16, 18) message = %q", err)
+	}
+}
+
+func TestGlyphWidthRule(t *testing.T) {
+	fontRoot := t.TempDir()
+	writeGlyphLimitTestPNG(t, fontRoot, "0041.png", 12, 16)
+	writeGlyphLimitTestPNG(t, fontRoot, "0057.png", 20, 16)
+
+	dialogues := []DialogueEntry{
+		{ID: 0, FontHeight: 16, Content: []map[string]interface{}{{"text": "AWA[NEWLINE]W"}}},
+		{ID: 1, FontHeight: 16, Content: []map[string]interface{}{{"text": "AZ"}}},
+		{ID: 2, FontHeight: 8, Content: []map[string]interface{}{{"text": "W"}}},
+	}
+	issues := NewGlyphWidthRule(fontRoot, GlyphWidthLimits{16: 16}).Check(dialogues)
+	if len(issues) != 1 || issues[0].DialogueID != 0 || issues[0].Severity != SeverityError {
+		t.Fatalf("issues = %+v, want one error for dialogue 0", issues)
+	}
+	if want := "glyphs wider than the 16 px limit of 16 px fonts: 'W' (20 px)"; issues[0].Message != want {
+		t.Errorf("message = %q, want %q", issues[0].Message, want)
+	}
+}
+
+func TestLoadSingleGlyph_WidthLimit(t *testing.T) {
+	t.Chdir(t.TempDir())
+	writeGlyphLimitTestPNG(t, DefaultFontDir, "0057.png", 20, 16)
+
+	encoder := NewWFMEncoder()
+	if _, err := encoder.loadSingleGlyph('W', 16, 0); err != nil {
+		t.Fatalf("loadSingleGlyph() without limits failed: %v", err)
+	}
+
+	encoder.SetGlyphWidthLimits(GlyphWidthLimits{16: 16})
+	_, err := encoder.loadSingleGlyph('W', 16, 0)
+	if !errors.Is(err, errGlyphTooWide) || !strings.Contains(err.Error(), "0057.png of 'W' (U+0057)") {
+		t.Fatalf("loadSingleGlyph() = %v, want a too-wide error naming the PNG", err)
+	}
+	cache := map[int]map[rune]Glyph{16: {}}
+	if err := encoder.tryLoadGlyph('W', 16, 0, cache); !errors.Is(err, errGlyphTooWide) {
+		t.Errorf("tryLoadGlyph() = %v, want the too-wide error instead of a warning", err)
+	}
+}
@@ -0,0 +1,240 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the project history: once 'history init' has created
+// .tombatools/history.jsonl, every tombatools invocation in the project appends a JSON
+// line with its arguments, exit code and the hashes of the files it read and wrote.
+// Replaying the history re-runs the recorded commands, optionally against fresh inputs,
+// so the exact steps that produced a released patch are documented and repeatable.
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// DefaultHistoryFile is the history log inside the project store directory. Commands
+// are only recorded when this file exists (see history init).
+const DefaultHistoryFile = "history.jsonl"
+
+// HistoryEntry is a recorded tombatools invocation
+type HistoryEntry struct {
+	ID       int            `json:"id"`
+	Time     time.Time      `json:"time"`
+	Version  string         `json:"version"`
+	Command  string         `json:"command"` // Command path, e.g. "tombatools wfm encode"
+	Args     []string       `json:"args"`    // Arguments after the program name
+	ExitCode int            `json:"exit_code"`
+	Inputs   []ArtifactFile `json:"inputs"`  // Existing files and directories named by the arguments, before the run
+	Outputs  []ArtifactFile `json:"outputs"` // Files written by the run
+}
+
+// HistoryPath returns the history log of a project directory
+func HistoryPath(projectDir string) string {
+	return filepath.Join(projectDir, DefaultStoreDir, DefaultHistoryFile)
+}
+
+// HistoryEnabled reports whether a project directory records its invocations
+func HistoryEnabled(projectDir string) bool {
+	info, err := os.Stat(HistoryPath(projectDir))
+	return err == nil && info.Mode().IsRegular()
+}
+
+// InitHistory enables the history of a project directory by creating an empty history
+// log, keeping an existing one
+func InitHistory(projectDir string) (string, error) {
+	path := HistoryPath(projectDir)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err))
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return "", common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", path, err))
+	}
+	return path, file.Close()
+}
+
+// LoadHistory reads the entries of a history log
+func LoadHistory(path string) ([]HistoryEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound,
+				fmt.Errorf("history %s not found; run 'tombatools history init'", path))
+		}
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var entries []HistoryEntry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var entry HistoryEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("%s line %d: %w", path, line, err))
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// AppendHistory numbers an entry after the last one of the log and appends it
+func AppendHistory(path string, entry *HistoryEntry) error {
+	entries, err := LoadHistory(path)
+	if err != nil {
+		return err
+	}
+	entry.ID = 1
+	if len(entries) > 0 {
+		entry.ID = entries[len(entries)-1].ID + 1
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode history entry: %w", err)
+	}
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to open %s: %w", path, err))
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to append to %s: %w", path, err))
+	}
+	return nil
+}
+
+// historyArgPaths returns the candidate paths of an argument: the argument itself and,
+// for FLAG=VALUE and DISC_PATH=FILE forms, the part after the last '='
+func historyArgPaths(arg string) []string {
+	var paths []string
+	if !strings.HasPrefix(arg, "-") {
+		paths = append(paths, arg)
+	}
+	if index := strings.LastIndex(arg, "="); index >= 0 && index < len(arg)-1 {
+		paths = append(paths, arg[index+1:])
+	}
+	return paths
+}
+
+// HashHistoryInputs hashes the existing files and directories named by the arguments of
+// an invocation. Arguments that are not paths are skipped.
+func HashHistoryInputs(args []string) ([]ArtifactFile, error) {
+	inputs := []ArtifactFile{}
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		for _, path := range historyArgPaths(arg) {
+			if seen[path] {
+				continue
+			}
+			seen[path] = true
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			input, err := hashArtifactInput(path)
+			if err != nil {
+				return nil, err
+			}
+			inputs = append(inputs, input)
+		}
+	}
+	return inputs, nil
+}
+
+// ParseHistoryReplacements parses OLD=NEW arguments naming the fresh inputs of a replay
+func ParseHistoryReplacements(specs []string) (map[string]string, error) {
+	replacements := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		old, fresh, ok := strings.Cut(spec, "=")
+		if !ok || old == "" || fresh == "" {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid input %q: expected OLD=NEW", spec))
+		}
+		replacements[old] = fresh
+	}
+	return replacements, nil
+}
+
+// ReplaceHistoryArgs returns the arguments of an entry with the replaced paths: whole
+// arguments, and the value after the last '=' of FLAG=VALUE and DISC_PATH=FILE forms
+func ReplaceHistoryArgs(args []string, replacements map[string]string) []string {
+	replaced := make([]string, len(args))
+	for i, arg := range args {
+		replaced[i] = arg
+		if fresh, ok := replacements[arg]; ok {
+			replaced[i] = fresh
+			continue
+		}
+		if index := strings.LastIndex(arg, "="); index >= 0 {
+			if fresh, ok := replacements[arg[index+1:]]; ok {
+				replaced[i] = arg[:index+1] + fresh
+			}
+		}
+	}
+	return replaced
+}
+
+// HistoryOutputCheck compares the outputs of a replayed entry with the recorded ones
+type HistoryOutputCheck struct {
+	Matching  []string // Outputs with the recorded content
+	Differing []string // Outputs with other content, or missing
+}
+
+// CheckHistoryOutputs hashes the recorded outputs of an entry (with replaced paths) and
+// compares them with the recorded hashes
+func CheckHistoryOutputs(entry HistoryEntry, replacements map[string]string) (*HistoryOutputCheck, error) {
+	check := &HistoryOutputCheck{}
+	for _, output := range entry.Outputs {
+		path := filepath.FromSlash(output.Path)
+		if fresh, ok := replacements[output.Path]; ok {
+			path = fresh
+		}
+		current, err := hashArtifactInput(path)
+		if err != nil {
+			return nil, err
+		}
+		if current.Hash == output.Hash {
+			check.Matching = append(check.Matching, path)
+		} else {
+			check.Differing = append(check.Differing, path)
+		}
+	}
+	return check, nil
+}
+
+// ChangedHistoryInputs returns the recorded inputs of an entry whose content changed
+// since it was recorded (missing inputs included). Replaced inputs are not compared.
+func ChangedHistoryInputs(entry HistoryEntry, replacements map[string]string) ([]string, error) {
+	var changed []string
+	for _, input := range entry.Inputs {
+		if _, ok := replacements[input.Path]; ok {
+			continue
+		}
+		current, err := hashArtifactInput(filepath.FromSlash(input.Path))
+		if err != nil {
+			return nil, err
+		}
+		if current.Hash != input.Hash {
+			changed = append(changed, input.Path)
+		}
+	}
+	return changed, nil
+}
+
+// FormatHistorySummary returns a one-line description of an entry for listings
+func FormatHistorySummary(entry *HistoryEntry) string {
+	status := "ok"
+	if entry.ExitCode != 0 {
+		status = fmt.Sprintf("exit %d", entry.ExitCode)
+	}
+	return fmt.Sprintf("#%d  %s  %-8s tombatools %s", entry.ID, entry.Time.Local().Format("2006-01-02 15:04:05"),
+		status, strings.Join(entry.Args, " "))
+}
@@ -0,0 +1,109 @@
+// Package pkg provides tests for the project history
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestHistory_AppendLoad(t *testing.T) {
+	dir := t.TempDir()
+	if HistoryEnabled(dir) {
+		t.Fatal("HistoryEnabled() = true before history init")
+	}
+	if _, err := LoadHistory(HistoryPath(dir)); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("LoadHistory() without a history error = %v, want an input not found error", err)
+	}
+
+	path, err := InitHistory(dir)
+	if err != nil {
+		t.Fatalf("InitHistory() failed: %v", err)
+	}
+	if !HistoryEnabled(dir) {
+		t.Fatal("HistoryEnabled() = false after history init")
+	}
+
+	for _, args := range [][]string{{"wfm", "decode", "CFNT999H.WFM", "out"}, {"gam", "unpack", "GAME.GAM", "out.UNGAM"}} {
+		entry := &HistoryEntry{Command: "tombatools " + args[0] + " " + args[1], Args: args}
+		if err := AppendHistory(path, entry); err != nil {
+			t.Fatalf("AppendHistory() failed: %v", err)
+		}
+	}
+	// Initializing again keeps the recorded entries
+	if _, err := InitHistory(dir); err != nil {
+		t.Fatalf("InitHistory() again failed: %v", err)
+	}
+
+	entries, err := LoadHistory(path)
+	if err != nil {
+		t.Fatalf("LoadHistory() failed: %v", err)
+	}
+	if len(entries) != 2 || entries[0].ID != 1 || entries[1].ID != 2 || entries[1].Args[0] != "gam" {
+		t.Fatalf("entries = %+v, want entries 1 and 2 in order", entries)
+	}
+
+	if err := os.WriteFile(path, []byte("{\"id\":1}\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadHistory(path); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("LoadHistory(corrupt) error = %v, want a format error", err)
+	}
+}
+
+func TestReplaceHistoryArgs(t *testing.T) {
+	replacements, err := ParseHistoryReplacements([]string{"original.bin=fresh.bin", "SCUS.EXE=patched.exe"})
+	if err != nil {
+		t.Fatalf("ParseHistoryReplacements() failed: %v", err)
+	}
+	args := []string{"cd", "build", "original.bin", "out.bin", "SLUS_002.33=SCUS.EXE", "--image=original.bin", "-v"}
+	want := []string{"cd", "build", "fresh.bin", "out.bin", "SLUS_002.33=patched.exe", "--image=fresh.bin", "-v"}
+	if got := ReplaceHistoryArgs(args, replacements); !reflect.DeepEqual(got, want) {
+		t.Errorf("ReplaceHistoryArgs() = %q, want %q", got, want)
+	}
+
+	for _, spec := range []string{"original.bin", "=fresh.bin", "original.bin="} {
+		if _, err := ParseHistoryReplacements([]string{spec}); common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("ParseHistoryReplacements(%q) error = %v, want a validation error", spec, err)
+		}
+	}
+}
+
+func TestHistory_InputsOutputs(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "dialogues.yaml")
+	output := filepath.Join(dir, "out.WFM")
+	writeStoreTestFile(t, input, "dialogues: []\n")
+	writeStoreTestFile(t, output, "first build")
+
+	inputs, err := HashHistoryInputs([]string{input, "--output=" + output, "-v", filepath.Join(dir, "missing")})
+	if err != nil {
+		t.Fatalf("HashHistoryInputs() failed: %v", err)
+	}
+	if len(inputs) != 2 || inputs[0].Path != filepath.ToSlash(input) || inputs[1].Path != filepath.ToSlash(output) {
+		t.Fatalf("inputs = %+v, want the existing input and output files", inputs)
+	}
+
+	entry := HistoryEntry{Inputs: inputs[:1], Outputs: inputs[1:]}
+	if changed, err := ChangedHistoryInputs(entry, nil); err != nil || len(changed) != 0 {
+		t.Errorf("ChangedHistoryInputs() = %v, %v, want none", changed, err)
+	}
+	if check, err := CheckHistoryOutputs(entry, nil); err != nil || len(check.Matching) != 1 || len(check.Differing) != 0 {
+		t.Errorf("CheckHistoryOutputs() = %+v, %v, want the output reproduced", check, err)
+	}
+
+	writeStoreTestFile(t, input, "dialogues: [changed]\n")
+	writeStoreTestFile(t, output, "second build")
+	if changed, err := ChangedHistoryInputs(entry, nil); err != nil || len(changed) != 1 {
+		t.Errorf("ChangedHistoryInputs() after a change = %v, %v, want the input", changed, err)
+	}
+	if changed, err := ChangedHistoryInputs(entry, map[string]string{inputs[0].Path: "fresh.yaml"}); err != nil || len(changed) != 0 {
+		t.Errorf("ChangedHistoryInputs() of a replaced input = %v, %v, want none", changed, err)
+	}
+	if check, err := CheckHistoryOutputs(entry, nil); err != nil || len(check.Differing) != 1 {
+		t.Errorf("CheckHistoryOutputs() after a change = %+v, %v, want the output differing", check, err)
+	}
+}
@@ -0,0 +1,84 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the characters of dialogue text that draw no glyph. The symbols of the
+// control code table (⧗, ▼, ⏷) are virtual characters encoded as their code; the ignored
+// characters declared by the game profile are markers translators leave in the text, which
+// encode drops. Neither is looked up in the fonts or counted in line widths.
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// ignoredCharacters holds the characters declared by SetIgnoredCharacters
+var ignoredCharacters atomic.Pointer[map[rune]bool]
+
+// SetIgnoredCharacters declares the marker characters encode drops from dialogue text,
+// replacing the previous list (nil clears it). Every entry must be a single character
+// that is not the symbol of a control code.
+func SetIgnoredCharacters(chars []string) error {
+	ignored := make(map[rune]bool, len(chars))
+	for _, entry := range chars {
+		char, size := utf8.DecodeRuneInString(entry)
+		if size == 0 || size != len(entry) || char == utf8.RuneError {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("ignored character %q must be a single character", entry))
+		}
+		if _, found := controlCodesBySymbol[char]; found {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("ignored character %q is the symbol of a control code", entry))
+		}
+		ignored[char] = true
+	}
+	ignoredCharacters.Store(&ignored)
+	return nil
+}
+
+// IgnoredCharacters returns the declared marker characters, sorted
+func IgnoredCharacters() []string {
+	var chars []string
+	if ignored := ignoredCharacters.Load(); ignored != nil {
+		for char := range *ignored {
+			chars = append(chars, string(char))
+		}
+	}
+	sort.Strings(chars)
+	return chars
+}
+
+// isIgnoredCharacter reports whether char is a marker declared by SetIgnoredCharacters
+func isIgnoredCharacter(char rune) bool {
+	ignored := ignoredCharacters.Load()
+	return ignored != nil && (*ignored)[char]
+}
+
+// needsNoGlyph reports whether char draws no glyph: a control code symbol or an ignored marker
+func needsNoGlyph(char rune) bool {
+	if _, found := controlCodesBySymbol[char]; found {
+		return true
+	}
+	return isIgnoredCharacter(char)
+}
+
+// stripZeroWidth removes the characters that draw no glyph from text
+func stripZeroWidth(text string) string {
+	return replaceZeroWidth(text, -1)
+}
+
+// replaceZeroWidth replaces the characters that draw no glyph with replacement (-1 removes them)
+func replaceZeroWidth(text string, replacement rune) string {
+	if !strings.ContainsFunc(text, needsNoGlyph) {
+		return text
+	}
+	return strings.Map(func(char rune) rune {
+		if needsNoGlyph(char) {
+			return replacement
+		}
+		return char
+	}, text)
+}
@@ -0,0 +1,41 @@
+// Package pkg provides tests for the characters that draw no glyph
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSetIgnoredCharacters(t *testing.T) {
+	t.Cleanup(func() { _ = SetIgnoredCharacters(nil) })
+
+	if err := SetIgnoredCharacters([]string{"※", "†"}); err != nil {
+		t.Fatalf("SetIgnoredCharacters() failed: %v", err)
+	}
+	if got := IgnoredCharacters(); !reflect.DeepEqual(got, []string{"†", "※"}) {
+		t.Errorf("IgnoredCharacters() = %q, want † and ※", got)
+	}
+	if got := stripZeroWidth("A※B⧗C▼"); got != "ABC" {
+		t.Errorf("stripZeroWidth() = %q, want ABC", got)
+	}
+	if !needsNoGlyph('⏷') || needsNoGlyph('A') {
+		t.Error("needsNoGlyph() does not tell control code symbols from glyphs")
+	}
+
+	// Encode drops the markers and keeps the control code symbols
+	encoder := NewWFMEncoder()
+	glyphEncodeMap := map[int]map[rune]uint16{16: {'A': 0x8000}}
+	got, _, err := encoder.processTextContent("※A⧗†", 16, glyphEncodeMap, 0)
+	if err != nil {
+		t.Fatalf("processTextContent() failed: %v", err)
+	}
+	if want := []uint16{0x8000, WAIT_FOR_INPUT}; !reflect.DeepEqual(got, want) {
+		t.Errorf("processTextContent() = %04X, want %04X", got, want)
+	}
+
+	for _, invalid := range [][]string{{"AB"}, {""}, {"⧗"}} {
+		if err := SetIgnoredCharacters(invalid); err == nil {
+			t.Errorf("SetIgnoredCharacters(%q) succeeded", invalid)
+		}
+	}
+}
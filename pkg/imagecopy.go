@@ -0,0 +1,79 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the unsafe-write guard for commands that patch a CD image: by default
+// the image is copied and only the copy is patched, so a failed or mistaken patch never
+// touches the user's only good dump.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// CopiedImagePath returns the default output of a command patching a copy of an image:
+// the input path with suffix added before the extension (modified.bin → modified_recalc.bin)
+func CopiedImagePath(input, suffix string) string {
+	extension := filepath.Ext(input)
+	return strings.TrimSuffix(input, extension) + suffix + extension
+}
+
+// WithImageCopy copies the image at input to a temporary file next to output, runs patch
+// on the copy and moves it over output once patch succeeds, unless ctx was canceled. The
+// input is never opened for writing; output must not be the input itself.
+func WithImageCopy(ctx context.Context, input, output string, patch func(path string) error) error {
+	if sameFile(input, output) {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("output %s is the input image; use --in-place to modify it", output))
+	}
+
+	source, err := os.Open(input)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open CD image: %w", err))
+	}
+	defer source.Close()
+
+	info, err := source.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat CD image: %w", err)
+	}
+
+	target, err := common.CreateAtomic(output)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", output, err))
+	}
+	defer target.Abort()
+
+	common.LogDebug("Copying %s to %s", input, output)
+	if _, err := io.Copy(common.NewProgressWriter(ctx, target, output, info.Size()), source); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to copy CD image: %w", err))
+	}
+	if err := target.Sync(); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to flush %s: %w", output, err))
+	}
+
+	if err := patch(target.Name()); err != nil {
+		return err
+	}
+	if err := common.Canceled(ctx); err != nil {
+		return err
+	}
+	return target.Commit()
+}
+
+// sameFile reports whether two paths name the same existing file
+func sameFile(a, b string) bool {
+	aInfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	bInfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(aInfo, bInfo)
+}
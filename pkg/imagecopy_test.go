@@ -0,0 +1,68 @@
+// Package pkg provides tests for the unsafe-write guard of image patching commands
+package pkg
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestCopiedImagePath(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"modified.bin", "modified_recalc.bin"},
+		{filepath.Join("build", "tomba.bin"), filepath.Join("build", "tomba_recalc.bin")},
+		{"image", "image_recalc"},
+	}
+	for _, tt := range tests {
+		if got := CopiedImagePath(tt.input, "_recalc"); got != tt.want {
+			t.Errorf("CopiedImagePath(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestWithImageCopy(t *testing.T) {
+	dir := t.TempDir()
+	input := filepath.Join(dir, "modified.bin")
+	if err := os.WriteFile(input, []byte("original"), 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+	patch := func(path string) error {
+		return os.WriteFile(path, []byte("patched"), 0644)
+	}
+
+	output := filepath.Join(dir, "patched.bin")
+	if err := WithImageCopy(context.Background(), input, output, patch); err != nil {
+		t.Fatalf("WithImageCopy() failed: %v", err)
+	}
+	if data, _ := os.ReadFile(output); string(data) != "patched" {
+		t.Errorf("output = %q, want %q", data, "patched")
+	}
+	if data, _ := os.ReadFile(input); string(data) != "original" {
+		t.Errorf("input = %q, want it untouched", data)
+	}
+
+	// A failed patch leaves no output behind
+	failed := filepath.Join(dir, "failed.bin")
+	patchErr := errors.New("patch failed")
+	if err := WithImageCopy(context.Background(), input, failed, func(string) error { return patchErr }); !errors.Is(err, patchErr) {
+		t.Errorf("WithImageCopy(failing patch) = %v, want %v", err, patchErr)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+		t.Errorf("directory holds %d files after a failed patch, want 2", len(entries))
+	}
+
+	err := WithImageCopy(context.Background(), input, filepath.Join(dir, ".", "modified.bin"), patch)
+	if common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("WithImageCopy(input as output) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+	}
+	if data, _ := os.ReadFile(input); string(data) != "original" {
+		t.Errorf("input = %q, want it untouched", data)
+	}
+}
@@ -0,0 +1,382 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the importer that converts legacy per-line script dumps stored in
+// Shift-JIS, Windows-1252 or UTF-8 into the dialogues.yaml structure.
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/japanese"
+	"gopkg.in/yaml.v3"
+)
+
+// Source text encodings accepted by the legacy script importer
+const (
+	EncodingAuto        = "auto"
+	EncodingUTF8        = "utf-8"
+	EncodingShiftJIS    = "shift-jis"
+	EncodingWindows1252 = "windows-1252"
+	EncodingASCII       = "ascii"
+)
+
+// Legacy script markers
+const (
+	legacyCommentPrefix  = "#"   // Lines starting with this prefix are ignored
+	legacyDialoguePrefix = "@"   // "@12" starts the block of dialogue 12
+	legacySegmentBreak   = "---" // Separates text items inside a dialogue block
+)
+
+// LegacyMarkupMapping maps legacy control-code markup to tombatools tags
+type LegacyMarkupMapping struct {
+	Markup map[string]string `yaml:"markup"`
+}
+
+// LegacyDialogue holds the text segments imported for a single dialogue
+type LegacyDialogue struct {
+	ID       int
+	Segments []string
+}
+
+// LegacyScriptImporter converts legacy per-line script dumps into dialogue entries
+type LegacyScriptImporter struct {
+	Encoding   string            // Source encoding (auto, utf-8, shift-jis, windows-1252)
+	Markup     map[string]string // Legacy markup replacements applied to every segment
+	FontHeight int               // Font height for dialogues created without a base file
+}
+
+// NewLegacyScriptImporter creates a new legacy script importer instance
+func NewLegacyScriptImporter() *LegacyScriptImporter {
+	return &LegacyScriptImporter{
+		Encoding:   EncodingAuto,
+		Markup:     make(map[string]string),
+		FontHeight: 16,
+	}
+}
+
+// LoadMarkupMapping loads legacy markup replacements from a YAML mapping file
+func (i *LegacyScriptImporter) LoadMarkupMapping(mappingFile string) error {
+	data, err := os.ReadFile(mappingFile)
+	if err != nil {
+		return fmt.Errorf("failed to read mapping file: %w", err)
+	}
+
+	var mapping LegacyMarkupMapping
+	if err := yaml.Unmarshal(data, &mapping); err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse mapping file: %w", err))
+	}
+
+	for from, to := range mapping.Markup {
+		i.Markup[from] = to
+	}
+
+	common.LogDebug("Loaded %d legacy markup mappings", len(mapping.Markup))
+	return nil
+}
+
+// DetectEncoding guesses the encoding of legacy script data.
+// Valid UTF-8 wins; data whose high bytes all form valid Shift-JIS
+// double-byte pairs is treated as Shift-JIS; anything else as Windows-1252.
+func DetectEncoding(data []byte) string {
+	if bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}) || utf8.Valid(data) {
+		return EncodingUTF8
+	}
+
+	if isShiftJIS(data) {
+		return EncodingShiftJIS
+	}
+
+	return EncodingWindows1252
+}
+
+// isShiftJIS reports whether every non-ASCII byte belongs to a Shift-JIS double-byte pair
+func isShiftJIS(data []byte) bool {
+	pairs := 0
+	for idx := 0; idx < len(data); idx++ {
+		b := data[idx]
+		if b < 0x80 {
+			continue
+		}
+
+		isLead := (b >= 0x81 && b <= 0x9F) || (b >= 0xE0 && b <= 0xFC)
+		if !isLead || idx+1 >= len(data) {
+			return false
+		}
+
+		trail := data[idx+1]
+		if trail < 0x40 || trail == 0x7F || trail > 0xFC {
+			return false
+		}
+
+		pairs++
+		idx++
+	}
+	return pairs > 0
+}
+
+// DecodeText converts legacy script data to UTF-8 using the given or detected encoding
+func DecodeText(data []byte, sourceEncoding string) (string, string, error) {
+	if sourceEncoding == EncodingAuto || sourceEncoding == "" {
+		sourceEncoding = DetectEncoding(data)
+	}
+
+	var decoder *encoding.Decoder
+	switch strings.ToLower(sourceEncoding) {
+	case EncodingASCII:
+		for idx, b := range data {
+			if b >= 0x80 {
+				return "", "", fmt.Errorf("non-ASCII byte 0x%02X at offset %d", b, idx)
+			}
+		}
+		return string(data), EncodingASCII, nil
+	case EncodingUTF8, "utf8":
+		return string(bytes.TrimPrefix(data, []byte{0xEF, 0xBB, 0xBF})), EncodingUTF8, nil
+	case EncodingShiftJIS, "sjis", "shiftjis":
+		decoder = japanese.ShiftJIS.NewDecoder()
+		sourceEncoding = EncodingShiftJIS
+	case EncodingWindows1252, "cp1252":
+		decoder = charmap.Windows1252.NewDecoder()
+		sourceEncoding = EncodingWindows1252
+	default:
+		return "", "", fmt.Errorf("unsupported source encoding: %s", sourceEncoding)
+	}
+
+	decoded, err := decoder.Bytes(data)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to decode %s text: %w", sourceEncoding, err)
+	}
+
+	return string(decoded), sourceEncoding, nil
+}
+
+// EncodeText converts UTF-8 text to the given target encoding
+func EncodeText(text string, targetEncoding string) ([]byte, error) {
+	var encoder *encoding.Encoder
+	switch strings.ToLower(targetEncoding) {
+	case EncodingASCII:
+		for _, char := range text {
+			if char >= 0x80 {
+				return nil, fmt.Errorf("character %q cannot be encoded as ASCII", char)
+			}
+		}
+		return []byte(text), nil
+	case EncodingUTF8, "utf8":
+		return []byte(text), nil
+	case EncodingShiftJIS, "sjis", "shiftjis":
+		encoder = japanese.ShiftJIS.NewEncoder()
+	case EncodingWindows1252, "cp1252":
+		encoder = charmap.Windows1252.NewEncoder()
+	default:
+		return nil, fmt.Errorf("unsupported target encoding: %s", targetEncoding)
+	}
+
+	encoded, err := encoder.Bytes([]byte(text))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode text as %s: %w", targetEncoding, err)
+	}
+
+	return encoded, nil
+}
+
+// ParseScript splits decoded script text into dialogues.
+// Scripts using "@ID" markers are read as blocks: every line up to the next
+// marker belongs to that dialogue and "---" lines separate text items.
+// Scripts without markers hold one dialogue per non-empty line, numbered from 0.
+// Lines starting with "#" are comments in both layouts.
+func (i *LegacyScriptImporter) ParseScript(text string) ([]LegacyDialogue, error) {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	lines := strings.Split(text, "\n")
+
+	blockMode := false
+	for _, line := range lines {
+		if strings.HasPrefix(line, legacyDialoguePrefix) {
+			blockMode = true
+			break
+		}
+	}
+
+	if !blockMode {
+		var dialogues []LegacyDialogue
+		for _, line := range lines {
+			if line == "" || strings.HasPrefix(line, legacyCommentPrefix) {
+				continue
+			}
+			dialogues = append(dialogues, LegacyDialogue{
+				ID:       len(dialogues),
+				Segments: []string{i.applyMarkup(line)},
+			})
+		}
+		return dialogues, nil
+	}
+
+	var dialogues []LegacyDialogue
+	var current *LegacyDialogue
+	var segment []string
+
+	flushSegment := func() {
+		if current != nil {
+			current.Segments = append(current.Segments, i.applyMarkup(strings.Join(segment, "\n")))
+		}
+		segment = nil
+	}
+
+	for lineNumber, line := range lines {
+		switch {
+		case strings.HasPrefix(line, legacyCommentPrefix):
+			continue
+		case strings.HasPrefix(line, legacyDialoguePrefix):
+			flushSegment()
+			id, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, legacyDialoguePrefix)))
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid dialogue marker %q", lineNumber+1, line)
+			}
+			dialogues = append(dialogues, LegacyDialogue{ID: id})
+			current = &dialogues[len(dialogues)-1]
+		case strings.TrimSpace(line) == legacySegmentBreak:
+			flushSegment()
+		default:
+			if current == nil {
+				if strings.TrimSpace(line) != "" {
+					return nil, fmt.Errorf("line %d: text before first dialogue marker", lineNumber+1)
+				}
+				continue
+			}
+			segment = append(segment, line)
+		}
+	}
+	flushSegment()
+
+	// Drop trailing empty lines left before the next marker
+	for idx := range dialogues {
+		for s := range dialogues[idx].Segments {
+			dialogues[idx].Segments[s] = strings.TrimRight(dialogues[idx].Segments[s], "\n")
+		}
+	}
+
+	return dialogues, nil
+}
+
+// applyMarkup replaces legacy markup with tombatools tags, longest markup first
+func (i *LegacyScriptImporter) applyMarkup(text string) string {
+	if len(i.Markup) == 0 {
+		return text
+	}
+
+	keys := make([]string, 0, len(i.Markup))
+	for key := range i.Markup {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool {
+		if len(keys[a]) != len(keys[b]) {
+			return len(keys[a]) > len(keys[b])
+		}
+		return keys[a] < keys[b]
+	})
+
+	replacements := make([]string, 0, len(keys)*2)
+	for _, key := range keys {
+		replacements = append(replacements, key, i.Markup[key])
+	}
+
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// Merge applies imported dialogues onto a base dialogue file.
+// Segments replace the base text items in order; dialogues missing from the
+// base are appended as plain text dialogues.
+func (i *LegacyScriptImporter) Merge(base *DialoguesYAML, imported []LegacyDialogue) {
+	indexByID := make(map[int]int, len(base.Dialogues))
+	for idx, entry := range base.Dialogues {
+		indexByID[entry.ID] = idx
+	}
+
+	for _, legacy := range imported {
+		idx, found := indexByID[legacy.ID]
+		if !found {
+			base.Dialogues = append(base.Dialogues, i.newDialogue(legacy))
+			indexByID[legacy.ID] = len(base.Dialogues) - 1
+			continue
+		}
+
+		entry := &base.Dialogues[idx]
+		segment := 0
+		for _, contentItem := range entry.Content {
+			if _, isText := contentItem["text"]; !isText {
+				continue
+			}
+			if segment < len(legacy.Segments) {
+				contentItem["text"] = legacy.Segments[segment]
+			}
+			segment++
+		}
+
+		if segment != len(legacy.Segments) {
+			common.LogWarn("Dialogue %d: %d imported segments for %d text items", legacy.ID, len(legacy.Segments), segment)
+		}
+	}
+
+	sort.SliceStable(base.Dialogues, func(a, b int) bool {
+		return base.Dialogues[a].ID < base.Dialogues[b].ID
+	})
+	base.TotalDialogues = len(base.Dialogues)
+}
+
+// newDialogue creates a plain text dialogue entry for an imported dialogue
+func (i *LegacyScriptImporter) newDialogue(legacy LegacyDialogue) DialogueEntry {
+	entry := DialogueEntry{
+		ID:         legacy.ID,
+		Type:       "dialogue",
+		FontHeight: i.FontHeight,
+		Terminator: TerminatorHalt,
+	}
+	for _, segment := range legacy.Segments {
+		entry.Content = append(entry.Content, map[string]interface{}{"text": segment})
+	}
+	return entry
+}
+
+// Import reads a legacy script and writes it as a dialogues.yaml file.
+// When baseFile is set, the imported text is merged into that export so the
+// box, tail and other control items are kept.
+func (i *LegacyScriptImporter) Import(scriptFile, baseFile, outputFile string) (int, error) {
+	data, err := os.ReadFile(scriptFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read script file: %w", err)
+	}
+
+	text, detected, err := DecodeText(data, i.Encoding)
+	if err != nil {
+		return 0, err
+	}
+	common.LogInfo("Script encoding: %s", detected)
+
+	imported, err := i.ParseScript(text)
+	if err != nil {
+		return 0, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse script: %w", err))
+	}
+
+	dialogues := &DialoguesYAML{}
+	if baseFile != "" {
+		dialogues, err = dialogueyaml.Read(baseFile)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load base dialogues: %w", err)
+		}
+	}
+
+	i.Merge(dialogues, imported)
+
+	if err := dialogueyaml.Write(outputFile, dialogues); err != nil {
+		return 0, fmt.Errorf("failed to write dialogues: %w", err)
+	}
+
+	return len(imported), nil
+}
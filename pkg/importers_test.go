@@ -0,0 +1,105 @@
+// Package pkg provides tests for the legacy script importer
+package pkg
+
+import (
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		expected string
+	}{
+		{"ascii", []byte("Hello"), EncodingUTF8},
+		{"utf-8", []byte("Olá"), EncodingUTF8},
+		{"shift-jis", []byte{0x82, 0xA0, 0x82, 0xA2}, EncodingShiftJIS},
+		{"windows-1252", []byte{'O', 'l', 0xE1, '!'}, EncodingWindows1252},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DetectEncoding(tt.data); got != tt.expected {
+				t.Errorf("DetectEncoding() = %q, want %q", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDecodeText(t *testing.T) {
+	text, detected, err := DecodeText([]byte{0x82, 0xA0, 0x82, 0xA2}, EncodingAuto)
+	if err != nil {
+		t.Fatalf("DecodeText() failed: %v", err)
+	}
+	if text != "あい" || detected != EncodingShiftJIS {
+		t.Errorf("DecodeText() = %q (%s), want %q (%s)", text, detected, "あい", EncodingShiftJIS)
+	}
+
+	text, _, err = DecodeText([]byte{'O', 'l', 0xE1}, EncodingWindows1252)
+	if err != nil {
+		t.Fatalf("DecodeText() failed: %v", err)
+	}
+	if text != "Olá" {
+		t.Errorf("DecodeText() = %q, want %q", text, "Olá")
+	}
+
+	if _, _, err := DecodeText([]byte("x"), "ebcdic"); err == nil {
+		t.Error("DecodeText() should fail for unsupported encoding")
+	}
+}
+
+func TestLegacyScriptImporter_ParseScript(t *testing.T) {
+	importer := NewLegacyScriptImporter()
+	importer.Markup = map[string]string{"<W>": "[WAIT FOR INPUT]", "<": "?"}
+
+	lines, err := importer.ParseScript("# comment\nFirst<W>\n\nSecond\n")
+	if err != nil {
+		t.Fatalf("ParseScript() failed: %v", err)
+	}
+	if len(lines) != 2 || lines[0].Segments[0] != "First[WAIT FOR INPUT]" || lines[1].ID != 1 {
+		t.Errorf("ParseScript(line mode) = %+v", lines)
+	}
+
+	blocks, err := importer.ParseScript("@5\nHello\nthere\n---\nBye\n\n@7\nEnd\n")
+	if err != nil {
+		t.Fatalf("ParseScript() failed: %v", err)
+	}
+	if len(blocks) != 2 || blocks[0].ID != 5 || blocks[1].ID != 7 {
+		t.Fatalf("ParseScript(block mode) = %+v", blocks)
+	}
+	if len(blocks[0].Segments) != 2 || blocks[0].Segments[0] != "Hello\nthere" || blocks[0].Segments[1] != "Bye" {
+		t.Errorf("dialogue 5 segments = %q", blocks[0].Segments)
+	}
+
+	if _, err := importer.ParseScript("@x\nHello\n"); err == nil {
+		t.Error("ParseScript() should fail for invalid dialogue marker")
+	}
+}
+
+func TestLegacyScriptImporter_Merge(t *testing.T) {
+	base := &DialoguesYAML{Dialogues: []DialogueEntry{
+		{ID: 0, Content: []map[string]interface{}{
+			{"box": map[string]interface{}{"width": 10, "height": 2}},
+			{"text": "Original"},
+		}},
+	}}
+
+	importer := NewLegacyScriptImporter()
+	importer.Merge(base, []LegacyDialogue{
+		{ID: 0, Segments: []string{"Traduzido"}},
+		{ID: 1, Segments: []string{"Novo"}},
+	})
+
+	if base.TotalDialogues != 2 {
+		t.Errorf("TotalDialogues = %d, want 2", base.TotalDialogues)
+	}
+	if _, hasBox := base.Dialogues[0].Content[0]["box"]; !hasBox {
+		t.Error("Merge() dropped box item from base dialogue")
+	}
+	if got := dialogueTexts(base.Dialogues[0]); len(got) != 1 || got[0] != "Traduzido" {
+		t.Errorf("dialogue 0 texts = %q, want [Traduzido]", got)
+	}
+	if got := dialogueTexts(base.Dialogues[1]); len(got) != 1 || got[0] != "Novo" {
+		t.Errorf("dialogue 1 texts = %q, want [Novo]", got)
+	}
+}
@@ -0,0 +1,369 @@
+// Package pkg provides an end-to-end test of the translation pipeline on a synthetic disc image
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// discFirstFileLBA is the first sector used by files in a synthetic disc; sectors 16 to 20
+// hold the volume descriptors and the root, DATA and EXE directories
+const discFirstFileLBA = 21
+
+// discFile is a file stored in a synthetic disc image
+type discFile struct {
+	dir  string
+	name string
+	data []byte
+}
+
+// path returns the path of the file as reported by the FLA linker
+func (f discFile) path() string {
+	return f.dir + "/" + f.name
+}
+
+// writeISODirRecord writes an ISO9660 directory record and returns its length
+func writeISODirRecord(data []byte, name string, lba, size uint32, flags byte) int {
+	length := 33 + len(name)
+	if length%2 != 0 {
+		length++
+	}
+	data[0] = byte(length)
+	binary.LittleEndian.PutUint32(data[2:6], lba)
+	binary.BigEndian.PutUint32(data[6:10], lba)
+	binary.LittleEndian.PutUint32(data[10:14], size)
+	binary.BigEndian.PutUint32(data[14:18], size)
+	data[25] = flags
+	data[32] = byte(len(name))
+	copy(data[33:], name)
+	return length
+}
+
+// writeSyntheticDisc writes a Mode 2 image with the root, DATA and EXE directories and the
+// files stored one after the other, the way a rebuild tool lays them out. Returns the LBA
+// of every file by path.
+func writeSyntheticDisc(t *testing.T, imagePath string, files []discFile) map[string]uint32 {
+	t.Helper()
+
+	lbas := make(map[string]uint32, len(files))
+	next := uint32(discFirstFileLBA)
+	for _, file := range files {
+		lbas[file.path()] = next
+		next += psx.DataSectors(uint32(len(file.data)))
+	}
+
+	sectors := int(next)
+	image := make([]byte, sectors*psx.CD_SECTOR_SIZE)
+	sectorData := func(lba uint32) []byte {
+		raw := image[int(lba)*psx.CD_SECTOR_SIZE : int(lba+1)*psx.CD_SECTOR_SIZE]
+		return raw[24 : 24+psx.CD_DATA_SIZE]
+	}
+	for lba := 0; lba < sectors; lba++ {
+		image[lba*psx.CD_SECTOR_SIZE+15] = 2
+	}
+
+	const rootLBA, dataLBA, exeLBA = 18, 19, 20
+	pvd := sectorData(16)
+	copy(pvd, "\x01CD001\x01")
+	copy(pvd[8:40], "PLAYSTATION                     ")
+	copy(pvd[40:72], "TOMBA                           ")
+	binary.LittleEndian.PutUint32(pvd[80:84], uint32(sectors))
+	binary.BigEndian.PutUint32(pvd[84:88], uint32(sectors))
+	writeISODirRecord(pvd[156:190], "\x00", rootLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	copy(sectorData(17), "\xFFCD001\x01")
+
+	root := sectorData(rootLBA)
+	offset := writeISODirRecord(root, "\x00", rootLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	offset += writeISODirRecord(root[offset:], "\x01", rootLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	offset += writeISODirRecord(root[offset:], "DATA", dataLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	writeISODirRecord(root[offset:], "EXE", exeLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+
+	directories := map[string][]byte{"DATA": sectorData(dataLBA), "EXE": sectorData(exeLBA)}
+	offsets := make(map[string]int)
+	for name, lba := range map[string]uint32{"DATA": dataLBA, "EXE": exeLBA} {
+		directory := directories[name]
+		offsets[name] = writeISODirRecord(directory, "\x00", lba, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+		offsets[name] += writeISODirRecord(directory[offsets[name]:], "\x01", rootLBA, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	}
+
+	for _, file := range files {
+		directory := directories[file.dir]
+		lba := lbas[file.path()]
+		offsets[file.dir] += writeISODirRecord(directory[offsets[file.dir]:], file.name+";1", lba, uint32(len(file.data)), 0)
+		for written := 0; written < len(file.data); written += psx.CD_DATA_SIZE {
+			copy(sectorData(lba+uint32(written/psx.CD_DATA_SIZE)), file.data[written:])
+		}
+	}
+
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write disc image: %v", err)
+	}
+	return lbas
+}
+
+// syntheticExecutableSize returns the size of a MAIN0.EXE linking the given files; a
+// zeroed entry ends the FLA table
+func syntheticExecutableSize(files []discFile) int {
+	return flaTableExeOffset + 8*(len(files)+1)
+}
+
+// syntheticExecutable returns a MAIN0.EXE whose FLA table links the given files
+func syntheticExecutable(files []discFile, lbas map[string]uint32) []byte {
+	exe := make([]byte, syntheticExecutableSize(files))
+	copy(exe, psx.PSX_EXE_MAGIC)
+	for i, file := range files {
+		entry := exe[flaTableExeOffset+8*i:]
+		msf := MSFFromSectors(lbas[file.path()] + psx.CD_PREGAP_SECTORS)
+		copy(entry, []byte{msf.Minutes, msf.Seconds, msf.Sectors, 0})
+		binary.LittleEndian.PutUint32(entry[4:], uint32(len(file.data)))
+	}
+	return exe
+}
+
+// writeDisc writes a disc holding MAIN0.EXE followed by the data files, with the FLA
+// table of MAIN0.EXE pointing at the data files of this disc
+func writeDisc(t *testing.T, imagePath string, data []discFile) ([]discFile, map[string]uint32) {
+	t.Helper()
+
+	// The executable size does not depend on the table contents, so the layout of a
+	// placeholder executable is the final layout
+	files := append([]discFile{{dir: "EXE", name: "MAIN0.EXE", data: make([]byte, syntheticExecutableSize(data))}}, data...)
+	lbas := writeSyntheticDisc(t, imagePath, files)
+	files[0].data = syntheticExecutable(data, lbas)
+	return files, writeSyntheticDisc(t, imagePath, files)
+}
+
+// readDumpedFile reads a file extracted by a CD dump
+func readDumpedFile(t *testing.T, dumpDir string, file discFile) []byte {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(dumpDir, file.dir, file.name))
+	if err != nil {
+		t.Fatalf("failed to read dumped %s: %v", file.path(), err)
+	}
+	return data
+}
+
+func TestPipeline_SyntheticDisc(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping end-to-end pipeline in short mode")
+	}
+
+	dir := t.TempDir()
+
+	// Original disc: MAIN0.EXE, a WFM font, a GAM with a string table and a trailing file
+	// that must move when the files before it grow
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+	font, err := os.ReadFile(fontFile)
+	if err != nil {
+		t.Fatalf("failed to read font: %v", err)
+	}
+
+	payload := make([]byte, 0x30)
+	copy(payload[0x10:], "Apple\x00")
+	copy(payload[0x18:], "Sword\x00")
+	copy(payload[0x20:], "Key\x00")
+	gamFile := filepath.Join(dir, "ITEM.GAM")
+	if _, err := NewGAMProcessor().SaveGAM(context.Background(), payload, gamFile); err != nil {
+		t.Fatalf("SaveGAM() failed: %v", err)
+	}
+	gam, err := os.ReadFile(gamFile)
+	if err != nil {
+		t.Fatalf("failed to read GAM: %v", err)
+	}
+
+	originalImage := filepath.Join(dir, "original.bin")
+	originalFiles, _ := writeDisc(t, originalImage, []discFile{
+		{dir: "DATA", name: "FONT.WFM", data: font},
+		{dir: "DATA", name: "ITEM.GAM", data: gam},
+		{dir: "DATA", name: "LAST.BIN", data: bytes.Repeat([]byte{0x5A}, 3000)},
+	})
+
+	// cd dump
+	dumpDir := filepath.Join(dir, "dump")
+	if err := NewCDProcessor().Dump(context.Background(), originalImage, dumpDir); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	for _, file := range originalFiles {
+		if !bytes.Equal(readDumpedFile(t, dumpDir, file), file.data) {
+			t.Errorf("dumped %s differs from the disc contents", file.path())
+		}
+	}
+	dumpedFont := filepath.Join(dumpDir, "DATA", "FONT.WFM")
+	dumpedGAM := filepath.Join(dumpDir, "DATA", "ITEM.GAM")
+
+	// wfm decode, then translate: dialogue 0 keeps its text so the dumped font can serve
+	// as glyph donor, dialogue 1 grows past a sector
+	projectDir := filepath.Join(dir, "project")
+	if err := NewWFMProcessor().Process(dumpedFont, projectDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+	yamlFile := filepath.Join(projectDir, "dialogues.yaml")
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("failed to read decoded dialogues: %v", err)
+	}
+	if len(dialogues.Dialogues) != 2 || dialogues.OriginalSize != int64(len(font)) {
+		t.Fatalf("decoded %d dialogues of a %d-byte file, want 2 of %d", len(dialogues.Dialogues), dialogues.OriginalSize, len(font))
+	}
+	longText := strings.Repeat("BA", 1200)
+	dialogues.Dialogues[0].Content = []map[string]interface{}{{"text": "AB"}}
+	dialogues.Dialogues[1].Content = []map[string]interface{}{{"text": longText}}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("failed to write translated dialogues: %v", err)
+	}
+
+	// wfm encode
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(dumpedFont); err != nil {
+		t.Fatalf("SetGlyphDonor() failed: %v", err)
+	}
+	encodedFont := filepath.Join(dir, "build", "FONT.WFM")
+	if err := os.MkdirAll(filepath.Dir(encodedFont), 0755); err != nil {
+		t.Fatalf("failed to create build dir: %v", err)
+	}
+	if err := encoder.Encode(context.Background(), yamlFile, encodedFont); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	newFont, err := os.ReadFile(encodedFont)
+	if err != nil {
+		t.Fatalf("failed to read encoded font: %v", err)
+	}
+	if psx.DataSectors(uint32(len(newFont))) <= psx.DataSectors(uint32(len(font))) {
+		t.Fatalf("encoded font is %d bytes, want it to grow past %d bytes by a sector", len(newFont), len(font))
+	}
+
+	// gam roundtrip and string table inject
+	if decoded, err := NewGAMProcessor().DecodeGAM(readDumpedFile(t, dumpDir, originalFiles[2])); err != nil || !bytes.Equal(decoded.UncompressedData, payload) {
+		t.Fatalf("DecodeGAM() = %v, want the original payload", err)
+	}
+	var profile StringTableProfile
+	if err := yaml.Unmarshal([]byte(testTableProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+	stringsFile := filepath.Join(projectDir, "items.yaml")
+	translated := []byte("file: ITEM.GAM\ntables:\n  - name: items\n    entries:\n      - index: 1\n        text: Faca\n")
+	if err := os.WriteFile(stringsFile, translated, 0644); err != nil {
+		t.Fatalf("failed to write strings file: %v", err)
+	}
+	injectedGAM := filepath.Join(dir, "build", "ITEM.GAM")
+	if err := NewStringTableProcessor().Inject(context.Background(), dumpedGAM, &profile, stringsFile, injectedGAM); err != nil {
+		t.Fatalf("Inject() failed: %v", err)
+	}
+	newGAM, err := os.ReadFile(injectedGAM)
+	if err != nil {
+		t.Fatalf("failed to read injected GAM: %v", err)
+	}
+
+	// Rebuilt disc: new files in place of the old ones, MAIN0.EXE still carrying the
+	// original FLA table
+	modifiedImage := filepath.Join(dir, "modified.bin")
+	modifiedFiles := []discFile{
+		originalFiles[0],
+		{dir: "DATA", name: "FONT.WFM", data: newFont},
+		{dir: "DATA", name: "ITEM.GAM", data: newGAM},
+		originalFiles[3],
+	}
+	modifiedLBAs := writeSyntheticDisc(t, modifiedImage, modifiedFiles)
+
+	// fla recalc
+	processor := NewFLAProcessor()
+	originalTable, err := processor.AnalyzeCDImage(originalImage)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage(original) failed: %v", err)
+	}
+	modifiedTable, err := processor.AnalyzeCDImage(modifiedImage)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage(modified) failed: %v", err)
+	}
+	differences, err := processor.CompareCDFiles(originalImage, modifiedImage, originalTable, modifiedTable)
+	if err != nil {
+		t.Fatalf("CompareCDFiles() failed: %v", err)
+	}
+	if len(differences) == 0 {
+		t.Fatal("CompareCDFiles() found no differences")
+	}
+	if err := processor.RecalculateFLATable(context.Background(), modifiedImage, originalTable, modifiedTable, differences); err != nil {
+		t.Fatalf("RecalculateFLATable() failed: %v", err)
+	}
+	if verification, err := processor.VerifyFLATable(modifiedImage, originalTable, modifiedTable); err != nil || !verification.OK() {
+		t.Fatalf("VerifyFLATable() = %+v, %v, want no issues", verification, err)
+	}
+
+	// The sectors holding the FLA table get their EDC/ECC regenerated
+	image, err := os.ReadFile(modifiedImage)
+	if err != nil {
+		t.Fatalf("failed to read final image: %v", err)
+	}
+	exeLBA := int(modifiedLBAs[modifiedFiles[0].path()])
+	tableSector := exeLBA + flaTableExeOffset/psx.CD_DATA_SIZE
+	for lba := tableSector; lba <= exeLBA+(syntheticExecutableSize(modifiedFiles[1:])-1)/psx.CD_DATA_SIZE; lba++ {
+		sector := image[lba*psx.CD_SECTOR_SIZE : (lba+1)*psx.CD_SECTOR_SIZE]
+		repaired := append([]byte(nil), sector...)
+		psx.RepairSectorEDC(repaired)
+		if !bytes.Equal(sector, repaired) {
+			t.Errorf("sector %d of the FLA table has a stale EDC/ECC", lba)
+		}
+	}
+
+	// The final image links every FLA entry to its rebuilt file and keeps the rest of
+	// MAIN0.EXE untouched
+	finalTable, err := processor.AnalyzeCDImage(modifiedImage)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage(final) failed: %v", err)
+	}
+	if finalTable.Count != 3 {
+		t.Fatalf("final FLA table has %d entries, want 3", finalTable.Count)
+	}
+	for i, file := range modifiedFiles[1:] {
+		entry := finalTable.Entries[i]
+		if want := psx.LBAToMSF(modifiedLBAs[file.path()]); entry.TimecodeDecimal != want {
+			t.Errorf("entry %d (%s) timecode = %s, want %s", i, file.path(), entry.TimecodeDecimal, want)
+		}
+		if entry.FileSize != uint32(len(file.data)) {
+			t.Errorf("entry %d (%s) size = %d, want %d", i, file.path(), entry.FileSize, len(file.data))
+		}
+		if entry.LinkedFile == nil || entry.LinkedFile.FullPath != file.path() {
+			t.Errorf("entry %d linked to %+v, want %s", i, entry.LinkedFile, file.path())
+		}
+	}
+
+	finalDump := filepath.Join(dir, "final")
+	if err := NewCDProcessor().Dump(context.Background(), modifiedImage, finalDump); err != nil {
+		t.Fatalf("Dump(final) failed: %v", err)
+	}
+	for _, file := range modifiedFiles[1:] {
+		if !bytes.Equal(readDumpedFile(t, finalDump, file), file.data) {
+			t.Errorf("final %s differs from the rebuilt file", file.path())
+		}
+	}
+	finalExe := readDumpedFile(t, finalDump, modifiedFiles[0])
+	if !bytes.Equal(finalExe[:flaTableExeOffset], modifiedFiles[0].data[:flaTableExeOffset]) {
+		t.Error("FLA table write modified MAIN0.EXE outside the table")
+	}
+
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(readDumpedFile(t, finalDump, modifiedFiles[1])))
+	if err != nil {
+		t.Fatalf("Decode(final font) failed: %v", err)
+	}
+	if got := len(wfm.Dialogues[1].Data); got != 2*len(longText) {
+		t.Errorf("final dialogue 1 is %d bytes, want %d", got, 2*len(longText))
+	}
+	items, err := NewGAMProcessor().DecodeGAM(readDumpedFile(t, finalDump, modifiedFiles[2]))
+	if err != nil {
+		t.Fatalf("DecodeGAM(final) failed: %v", err)
+	}
+	if got := string(items.UncompressedData[0x18:0x1D]); got != "Faca\x00" {
+		t.Errorf("final item 1 = %q, want %q", got, "Faca\x00")
+	}
+}
@@ -0,0 +1,82 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the ISO9660 conformance check entry point and its report writers.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// VerifyISO9660 checks the file system of a CD image against ISO9660; strict adds the
+// ordering, padding and identifier rules
+func (p *CDFileProcessor) VerifyISO9660(imageFile string, strict bool) (*psx.ISOVerifyReport, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	report, err := reader.VerifyISO9660(strict)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify CD image: %w", err)
+	}
+
+	p.logger.Debug("ISO9660 check of %s: %d directories, %d files, %d violations (%d errors)",
+		imageFile, report.Directories, report.Files, len(report.Violations), report.ErrorCount())
+	return report, nil
+}
+
+// WriteISOVerifyReport writes the report in the requested format (json or markdown)
+func WriteISOVerifyReport(report *psx.ISOVerifyReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeISOVerifyMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeISOVerifyMarkdown renders the report as a markdown document
+func writeISOVerifyMarkdown(report *psx.ISOVerifyReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# ISO9660 Verification\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Strict | %t |\n", report.Strict))
+	sb.WriteString(fmt.Sprintf("| Volume sectors | %d |\n", report.VolumeSectors))
+	sb.WriteString(fmt.Sprintf("| Image sectors | %d |\n", report.ImageSectors))
+	if report.TrailingBytes > 0 {
+		sb.WriteString(fmt.Sprintf("| Trailing bytes | %d |\n", report.TrailingBytes))
+	}
+	sb.WriteString(fmt.Sprintf("| Directories | %d |\n", report.Directories))
+	sb.WriteString(fmt.Sprintf("| Files | %d |\n", report.Files))
+
+	sb.WriteString("\n## Violations\n\n")
+	if len(report.Violations) == 0 {
+		sb.WriteString("No violations found.\n")
+	} else {
+		sb.WriteString("| Severity | Clause | Check | Path | Message |\n")
+		sb.WriteString("|----------|--------|-------|------|---------|\n")
+		for _, violation := range report.Violations {
+			sb.WriteString(fmt.Sprintf("| %s | ECMA-119 %s | %s | %s | %s |\n",
+				violation.Severity, violation.Clause, violation.Check, violation.Path, violation.Message))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue width annotations: decode --widths measures the pixel width
+// of every line with the glyph widths of the font and stores it in the YAML export, and the
+// line-width lint rule warns when an edited line is wider than the widest original line.
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// LineWidthRuleName identifies issues raised by the line-width rule
+const LineWidthRuleName = "line-width"
+
+// DialogueWidths is the measured width metadata of a dialogue
+type DialogueWidths = dialogueyaml.Widths
+
+// MeasureDialogueLines returns the pixel width of every line of raw dialogue data, as the
+// sum of the widths of its glyphs. Lines end at NEWLINE (DOUBLE_NEWLINE ends two) and a
+// new text box starts a new line.
+func MeasureDialogueLines(data []byte, glyphs []Glyph) []int {
+	lines := []int{0}
+	for i := 0; i+1 < len(data); i += 2 {
+		code := binary.LittleEndian.Uint16(data[i:])
+		switch {
+		case code == TERMINATOR_1 || code == TERMINATOR_2:
+			return lines
+		case code == NEWLINE:
+			lines = append(lines, 0)
+		case code == DOUBLE_NEWLINE:
+			lines = append(lines, 0, 0)
+		case code == INIT_TEXT_BOX && lines[len(lines)-1] > 0:
+			lines = append(lines, 0)
+		}
+
+		if parameters := controlCodeArgs(code); parameters > 0 {
+			i += parameters * 2
+			continue
+		}
+		if code >= GLYPH_ID_BASE && code <= 0xFFF0 && int(code-GLYPH_ID_BASE) < len(glyphs) {
+			lines[len(lines)-1] += int(glyphs[code-GLYPH_ID_BASE].GlyphWidth)
+		}
+	}
+	return lines
+}
+
+// newDialogueWidths measures a dialogue and records its widest line as the width limit
+func newDialogueWidths(data []byte, glyphs []Glyph) *DialogueWidths {
+	widths := &DialogueWidths{Lines: MeasureDialogueLines(data, glyphs)}
+	for _, width := range widths.Lines {
+		widths.Max = max(widths.Max, width)
+	}
+	return widths
+}
+
+// glyphWidthTable returns the width of every mapped character by font height. When a
+// character has several glyphs of the same height, the widest is kept.
+func glyphWidthTable(glyphMapping map[uint16]string, glyphs []Glyph) map[int]map[string]int {
+	table := make(map[int]map[string]int)
+	for index, char := range glyphMapping {
+		if int(index) >= len(glyphs) {
+			continue
+		}
+		glyph := glyphs[index]
+		height := int(glyph.GlyphHeight)
+		if table[height] == nil {
+			table[height] = make(map[string]int)
+		}
+		table[height][char] = max(table[height][char], int(glyph.GlyphWidth))
+	}
+	return table
+}
+
+// SetLineWidths makes ExportDialogues store the measured line widths of every dialogue
+// and the glyph widths of the font
+func (e *WFMFileExporter) SetLineWidths(enabled bool) {
+	e.lineWidths = enabled
+}
+
+// LineWidthRule warns about dialogue lines wider than the widest line of the original
+// dialogue, using the widths metadata and glyph widths stored by decode --widths
+type LineWidthRule struct {
+	glyphWidths map[int]map[string]int
+}
+
+// NewLineWidthRule creates the line-width rule. Glyph widths are taken from the linted file.
+func NewLineWidthRule() *LineWidthRule {
+	return &LineWidthRule{}
+}
+
+// Name returns the rule name
+func (r *LineWidthRule) Name() string {
+	return LineWidthRuleName
+}
+
+// SetFile takes the glyph widths of the dialogue file being linted
+func (r *LineWidthRule) SetFile(file *DialoguesYAML) {
+	r.glyphWidths = file.GlyphWidths
+}
+
+// Check returns a warning for every line wider than its dialogue's original widest line.
+// Dialogues without widths metadata or glyph widths for their font height are skipped.
+func (r *LineWidthRule) Check(dialogues []DialogueEntry) []LintIssue {
+	var issues []LintIssue
+	for _, dialogue := range dialogues {
+		widths := r.glyphWidths[dialogue.FontHeight]
+		if dialogue.Widths == nil || len(widths) == 0 || dialogue.Raw != "" {
+			continue
+		}
+		for line, width := range measureTextLines(dialogue, widths) {
+			if width > dialogue.Widths.Max {
+				issues = append(issues, LintIssue{
+					Rule:       LineWidthRuleName,
+					Severity:   SeverityWarning,
+					DialogueID: dialogue.ID,
+					Message: fmt.Sprintf("line %d is %d px wide, the widest original line is %d px",
+						line+1, width, dialogue.Widths.Max),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// measureTextLines returns the pixel width of every line of the text content of a dialogue,
+// splitting lines the same way as MeasureDialogueLines. Control tags are ignored and
+// characters without a known width count as the widest glyph of the font.
+func measureTextLines(dialogue DialogueEntry, widths map[string]int) []int {
+	widest := 0
+	for _, width := range widths {
+		widest = max(widest, width)
+	}
+
+	lines := []int{0}
+	for _, contentItem := range dialogue.Content {
+		if _, isBox := contentItem["box"]; isBox && lines[len(lines)-1] > 0 {
+			lines = append(lines, 0)
+		}
+		text, ok := contentItem["text"].(string)
+		if !ok {
+			continue
+		}
+
+		// A page break starts a new box, counted like the two lines of DOUBLE_NEWLINE
+		text = strings.ReplaceAll(text, PageBreakTag, "\n\n")
+		text = stripZeroWidth(controlTagRegex.ReplaceAllString(text, ""))
+		for _, char := range text {
+			if char == '\n' {
+				lines = append(lines, 0)
+				continue
+			}
+			width, known := widths[string(char)]
+			if !known {
+				width = widest
+			}
+			lines[len(lines)-1] += width
+		}
+	}
+	return lines
+}
@@ -0,0 +1,75 @@
+// Package pkg provides tests for dialogue width annotations and the line-width lint rule
+package pkg
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+func TestMeasureDialogueLines(t *testing.T) {
+	glyphs := []Glyph{{GlyphWidth: 8}, {GlyphWidth: 6}}
+	words := []uint16{
+		INIT_TEXT_BOX, 100, 40, 0x8000, 0x8001, NEWLINE,
+		0x8000, CHANGE_COLOR_TO, 0x8001, 0x8001, DOUBLE_NEWLINE,
+		0x8001, 0x9000, TERMINATOR_2, 0x8000,
+	}
+	data := make([]byte, len(words)*2)
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[i*2:], word)
+	}
+
+	// The color parameter 0x8001 is not a glyph and glyph 0x9000 is out of range
+	want := []int{14, 14, 0, 6}
+	if got := MeasureDialogueLines(data, glyphs); !reflect.DeepEqual(got, want) {
+		t.Errorf("MeasureDialogueLines() = %v, want %v", got, want)
+	}
+	if widths := newDialogueWidths(data, glyphs); widths.Max != 14 {
+		t.Errorf("Max = %d, want 14", widths.Max)
+	}
+}
+
+func TestLineWidthRule_Lint(t *testing.T) {
+	boxed := func(id int, text string) DialogueEntry {
+		dialogue := textDialogue(id, text)
+		dialogue.Content = append([]map[string]interface{}{{"box": map[string]interface{}{"width": 100, "height": 40}}}, dialogue.Content...)
+		dialogue.Widths = &DialogueWidths{Lines: []int{14, 14}, Max: 14}
+		return dialogue
+	}
+	unmeasured := textDialogue(3, "ABABAB")
+
+	file := &DialoguesYAML{
+		TotalDialogues: 4,
+		GlyphWidths:    map[int]map[string]int{16: {"A": 8, "B": 6}},
+		Dialogues: []DialogueEntry{
+			boxed(0, "AB[HALT]\n⧗BA"),
+			boxed(1, "AB\nABA"),
+			boxed(2, "ZZ"),
+			unmeasured,
+		},
+	}
+	yamlFile := filepath.Join(t.TempDir(), "translated.yaml")
+	if err := dialogueyaml.Write(yamlFile, file); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	report, err := NewLinter(NewLineWidthRule()).Lint(yamlFile)
+	if err != nil {
+		t.Fatalf("Lint() failed: %v", err)
+	}
+
+	var got []int
+	for _, issue := range report.Issues {
+		if issue.Rule != LineWidthRuleName || issue.Severity != SeverityWarning {
+			t.Errorf("issue %+v, want a line-width warning", issue)
+		}
+		got = append(got, issue.DialogueID)
+	}
+	// Dialogue 1 has a 22 px line; the unknown characters of dialogue 2 count as 8 px each
+	if want := []int{1, 2}; !reflect.DeepEqual(got, want) {
+		t.Errorf("issues for dialogues %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,177 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue linter, which runs a set of rules over a dialogue YAML
+// file and reports the issues found, and its report writers.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// Lint issue severities
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// LintIssue is a problem found in a dialogue by a lint rule
+type LintIssue struct {
+	Rule       string `json:"rule"`
+	Severity   string `json:"severity"`
+	DialogueID int    `json:"dialogue_id"`
+	Term       string `json:"term,omitempty"` // Subject the issue is grouped by (e.g. a glossary term)
+	Message    string `json:"message"`
+}
+
+// LintReport lists the issues found in a dialogue file
+type LintReport struct {
+	File      string      `json:"file"`
+	Dialogues int         `json:"dialogues"`
+	Errors    int         `json:"errors"`
+	Warnings  int         `json:"warnings"`
+	Issues    []LintIssue `json:"issues"`
+}
+
+// LintRule checks the dialogues of a file and returns the issues found
+type LintRule interface {
+	Name() string
+	Check(dialogues []DialogueEntry) []LintIssue
+}
+
+// FileLintRule is a lint rule that also needs the file-level data of the dialogue file
+type FileLintRule interface {
+	LintRule
+	SetFile(file *DialoguesYAML)
+}
+
+// Linter runs lint rules over dialogue files
+type Linter struct {
+	rules []LintRule
+}
+
+// NewLinter creates a linter running the given rules
+func NewLinter(rules ...LintRule) *Linter {
+	return &Linter{rules: rules}
+}
+
+// Lint loads a dialogue YAML file and checks it with every rule
+func (l *Linter) Lint(yamlFile string) (*LintReport, error) {
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		return nil, err
+	}
+	for _, rule := range l.rules {
+		if fileRule, ok := rule.(FileLintRule); ok {
+			fileRule.SetFile(dialogues)
+		}
+	}
+
+	report := l.Check(dialogues.Dialogues)
+	report.File = yamlFile
+	return report, nil
+}
+
+// Check runs every rule over the dialogues; issues are sorted by dialogue ID then rule
+func (l *Linter) Check(dialogues []DialogueEntry) *LintReport {
+	report := &LintReport{Dialogues: len(dialogues), Issues: make([]LintIssue, 0)}
+	for _, rule := range l.rules {
+		report.Issues = append(report.Issues, rule.Check(dialogues)...)
+	}
+
+	sort.SliceStable(report.Issues, func(i, j int) bool {
+		if report.Issues[i].DialogueID != report.Issues[j].DialogueID {
+			return report.Issues[i].DialogueID < report.Issues[j].DialogueID
+		}
+		return report.Issues[i].Rule < report.Issues[j].Rule
+	})
+
+	for _, issue := range report.Issues {
+		if issue.Severity == SeverityError {
+			report.Errors++
+		} else {
+			report.Warnings++
+		}
+	}
+	return report
+}
+
+// WriteLintReport writes the report in the requested format (json or markdown)
+func WriteLintReport(report *LintReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeLintMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeLintMarkdown renders the report as a markdown document, with one section per
+// rule and issues grouped by term within each rule
+func writeLintMarkdown(report *LintReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Dialogue Lint\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| File | %s |\n", report.File))
+	sb.WriteString(fmt.Sprintf("| Dialogues | %d |\n", report.Dialogues))
+	sb.WriteString(fmt.Sprintf("| Errors | %d |\n", report.Errors))
+	sb.WriteString(fmt.Sprintf("| Warnings | %d |\n", report.Warnings))
+
+	if len(report.Issues) == 0 {
+		sb.WriteString("\nNo issues found.\n")
+	}
+
+	// Group issues by rule, then by term, keeping the order of first appearance
+	var rules []string
+	byRule := make(map[string][]LintIssue)
+	for _, issue := range report.Issues {
+		if _, exists := byRule[issue.Rule]; !exists {
+			rules = append(rules, issue.Rule)
+		}
+		byRule[issue.Rule] = append(byRule[issue.Rule], issue)
+	}
+	sort.Strings(rules)
+
+	for _, rule := range rules {
+		sb.WriteString(fmt.Sprintf("\n## %s\n", rule))
+
+		var terms []string
+		byTerm := make(map[string][]LintIssue)
+		for _, issue := range byRule[rule] {
+			if _, exists := byTerm[issue.Term]; !exists {
+				terms = append(terms, issue.Term)
+			}
+			byTerm[issue.Term] = append(byTerm[issue.Term], issue)
+		}
+		sort.Strings(terms)
+
+		for _, term := range terms {
+			if term != "" {
+				sb.WriteString(fmt.Sprintf("\n### %s (%d)\n", term, len(byTerm[term])))
+			}
+			sb.WriteString("\n| Dialogue | Severity | Message |\n")
+			sb.WriteString("|----------|----------|---------|\n")
+			for _, issue := range byTerm[term] {
+				sb.WriteString(fmt.Sprintf("| %d | %s | %s |\n", issue.DialogueID, issue.Severity, markdownCell(issue.Message)))
+			}
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
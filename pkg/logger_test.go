@@ -0,0 +1,116 @@
+// Package pkg provides tests for running decoders and encoders concurrently with their own loggers
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// TestConcurrentOperations_PerProcessorLogger runs decodes and encodes in parallel with
+// different loggers while the process-wide verbose mode is toggled; run with -race.
+func TestConcurrentOperations_PerProcessorLogger(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+	yamlFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{
+		TotalDialogues: 1,
+		Dialogues: []DialogueEntry{
+			{ID: 0, Type: "dialogue", FontHeight: 8, FontClut: 0x1234, Terminator: 2, Content: []map[string]interface{}{{"text": "AB"}}},
+		},
+	}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	defer common.SetVerboseMode(false)
+
+	const workers = 4
+	errs := make(chan error, 2*workers+1)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		verbose := i%2 == 0
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			file, err := os.Open(donorFile)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer file.Close()
+			decoder := NewWFMDecoder()
+			decoder.SetLogger(common.NewLogger(verbose))
+			if _, err := decoder.Decode(file); err != nil {
+				errs <- fmt.Errorf("Decode() failed: %w", err)
+			}
+		}()
+		go func(output string) {
+			defer wg.Done()
+			encoder := NewWFMEncoder()
+			encoder.SetLogger(common.NewLogger(verbose))
+			if err := encoder.SetGlyphDonor(donorFile); err != nil {
+				errs <- err
+				return
+			}
+			if err := encoder.Encode(context.Background(), yamlFile, output); err != nil {
+				errs <- fmt.Errorf("Encode() failed: %w", err)
+			}
+		}(filepath.Join(dir, fmt.Sprintf("OUT%d.WFM", i)))
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			common.SetVerboseMode(i%2 == 0)
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if !strings.Contains(buf.String(), "[DEBUG]") {
+		t.Error("verbose loggers wrote no debug messages")
+	}
+}
+
+func TestWFMFileDecoder_SetLogger_Quiet(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+	common.SetVerboseMode(true)
+	defer common.SetVerboseMode(false)
+
+	file, err := os.Open(donorFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	decoder := NewWFMDecoder()
+	decoder.SetLogger(common.NewLogger(false))
+	if _, err := decoder.Decode(file); err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if strings.Contains(buf.String(), "[DEBUG]") {
+		t.Errorf("decoder with a non-verbose logger wrote debug messages under SetVerboseMode(true): %q", buf.String())
+	}
+}
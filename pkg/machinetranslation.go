@@ -0,0 +1,348 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the machine translation pre-pass, which sends untranslated dialogues
+// to an MT backend and stores the results as drafts next to the dialogue content. Drafts
+// are never encoded: a translator reviews them and moves the text into the content.
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// Reasons a draft is marked for human attention
+const (
+	DraftAttentionOverBudget = "over budget"
+	DraftAttentionCodesLost  = "control codes lost"
+)
+
+// DefaultMTTimeout is the time a single MT backend request may take
+const DefaultMTTimeout = 30 * time.Second
+
+// DialogueDraft is a machine translated draft of the text items of a dialogue
+type DialogueDraft = dialogueyaml.Draft
+
+// MTBackend translates texts from one language to another
+type MTBackend interface {
+	Name() string
+	Translate(texts []string, source, target string) ([]string, error)
+}
+
+// mtRequest is the body posted to an HTTP MT backend
+type mtRequest struct {
+	Source string   `json:"source"`
+	Target string   `json:"target"`
+	Texts  []string `json:"texts"`
+}
+
+// mtResponse is the body an HTTP MT backend answers with
+type mtResponse struct {
+	Translations []string `json:"translations"`
+	Error        string   `json:"error,omitempty"`
+}
+
+// HTTPMTBackend sends texts to an HTTP endpoint. The endpoint receives a JSON POST of
+// {"source", "target", "texts"} and answers with {"translations"}, one per text, so any
+// MT service can be plugged in through a small adapter.
+type HTTPMTBackend struct {
+	URL    string
+	APIKey string // Sent as a bearer token when set
+	Client *http.Client
+}
+
+// NewHTTPMTBackend creates an HTTP MT backend for the endpoint url
+func NewHTTPMTBackend(url, apiKey string, timeout time.Duration) *HTTPMTBackend {
+	return &HTTPMTBackend{URL: url, APIKey: apiKey, Client: &http.Client{Timeout: timeout}}
+}
+
+// Name returns the endpoint URL
+func (b *HTTPMTBackend) Name() string {
+	return b.URL
+}
+
+// Translate posts the texts to the endpoint and returns its translations
+func (b *HTTPMTBackend) Translate(texts []string, source, target string) ([]string, error) {
+	body, err := json.Marshal(mtRequest{Source: source, Target: target, Texts: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode MT request: %w", err)
+	}
+
+	request, err := http.NewRequest(http.MethodPost, b.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create MT request: %w", err)
+	}
+	request.Header.Set("Content-Type", "application/json")
+	if b.APIKey != "" {
+		request.Header.Set("Authorization", "Bearer "+b.APIKey)
+	}
+
+	response, err := b.Client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("MT request failed: %w", err)
+	}
+	defer response.Body.Close()
+
+	data, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read MT response: %w", err)
+	}
+
+	var decoded mtResponse
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		if response.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("MT backend returned %s", response.Status)
+		}
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse MT response: %w", err))
+	}
+	if response.StatusCode != http.StatusOK {
+		if decoded.Error != "" {
+			return nil, fmt.Errorf("MT backend returned %s: %s", response.Status, decoded.Error)
+		}
+		return nil, fmt.Errorf("MT backend returned %s", response.Status)
+	}
+	if len(decoded.Translations) != len(texts) {
+		return nil, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("MT backend returned %d translations for %d texts", len(decoded.Translations), len(texts)))
+	}
+	return decoded.Translations, nil
+}
+
+// MTOptions controls the machine translation pre-pass
+type MTOptions struct {
+	Source        string // Language of the original dialogues
+	Target        string // Language of the drafts; drafts are stored under this key
+	BudgetPercent int    // Share of the original encoded size a draft may take (100 keeps the size)
+	Limit         int    // Maximum number of dialogues sent (0 sends all)
+	Overwrite     bool   // Replace existing drafts of the target language
+}
+
+// MTReport summarizes a machine translation pre-pass
+type MTReport struct {
+	Untranslated int   // Untranslated dialogues found
+	Translated   int   // Dialogues given a new draft
+	Skipped      int   // Untranslated dialogues that already had a draft
+	OverBudget   []int // IDs of drafts larger than their budget
+	CodesLost    []int // IDs of drafts missing control codes of the original
+}
+
+// MachineTranslator fills the drafts of untranslated dialogues through an MT backend
+type MachineTranslator struct {
+	backend MTBackend
+}
+
+// NewMachineTranslator creates a machine translator using backend
+func NewMachineTranslator(backend MTBackend) *MachineTranslator {
+	return &MachineTranslator{backend: backend}
+}
+
+// leadingTagRegex matches a bracketed control tag at the start of a text
+var leadingTagRegex = regexp.MustCompile(`^\[[^\]]*\]`)
+
+// mtTokenRegex matches the tokens that stand for control codes in the text sent to the backend
+var mtTokenRegex = regexp.MustCompile(`\{(\d+)\}`)
+
+// maskControlCodes replaces the control tags and symbols of text with numbered {N} tokens,
+// which MT backends leave alone, and returns the codes in token order
+func maskControlCodes(text string) (string, []string) {
+	var sb strings.Builder
+	var codes []string
+	runes := []rune(text)
+	for i := 0; i < len(runes); i++ {
+		code := ""
+		if runes[i] == '[' {
+			code = leadingTagRegex.FindString(string(runes[i:]))
+		} else if _, found := controlCodesBySymbol[runes[i]]; found {
+			code = string(runes[i])
+		}
+
+		if code == "" {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		sb.WriteString("{" + strconv.Itoa(len(codes)) + "}")
+		codes = append(codes, code)
+		i += len([]rune(code)) - 1
+	}
+	return sb.String(), codes
+}
+
+// unmaskControlCodes puts the control codes back in place of their tokens. It reports
+// false when a token is missing, repeated or unknown.
+func unmaskControlCodes(text string, codes []string) (string, bool) {
+	seen := make([]bool, len(codes))
+	complete := true
+	result := mtTokenRegex.ReplaceAllStringFunc(text, func(token string) string {
+		index, err := strconv.Atoi(token[1 : len(token)-1])
+		if err != nil || index >= len(codes) || seen[index] {
+			complete = false
+			return token
+		}
+		seen[index] = true
+		return codes[index]
+	})
+	for _, found := range seen {
+		complete = complete && found
+	}
+	return result, complete
+}
+
+// EstimateTextBytes estimates the encoded size of a dialogue text: every character,
+// control tag, inline tag arg, control symbol and [XXXX] value takes one 16-bit code, as
+// does a double newline unless pageBreaks is set
+func EstimateTextBytes(text string, pageBreaks bool) int {
+	runes := []rune(text)
+	units := 0
+	for i := 0; i < len(runes); i++ {
+		units++
+		switch runes[i] {
+		case '[':
+			if match := leadingTagRegex.FindString(string(runes[i:])); match != "" {
+				i += len([]rune(match)) - 1
+				// Inline args such as [PAUSE FOR 30] are one word each
+				if _, args, found := parseControlTag(match); found {
+					units += len(args)
+				}
+			}
+		case '\n':
+			if !pageBreaks && i+1 < len(runes) && runes[i+1] == '\n' {
+				i++
+			}
+		}
+	}
+	return units * 2
+}
+
+// Translate sends the dialogues of translated that are still untranslated compared to
+// original to the backend and stores the results in their draft for the target language
+func (t *MachineTranslator) Translate(original []DialogueEntry, translated *DialoguesYAML, options MTOptions) (*MTReport, error) {
+	if options.Target == "" {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no target language given"))
+	}
+	if options.BudgetPercent <= 0 {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid budget %d%%: must be greater than zero", options.BudgetPercent))
+	}
+
+	pageBreaks := translated.DoubleNewline == DoubleNewlineAsPage
+	progress := NewProgressAnalyzer().Compare(original, translated.Dialogues)
+	untranslated := make(map[int]bool)
+	for _, dialogue := range progress.Dialogues {
+		if dialogue.Status == StatusUntranslated {
+			untranslated[dialogue.ID] = true
+		}
+	}
+
+	report := &MTReport{Untranslated: len(untranslated)}
+	for i := range translated.Dialogues {
+		entry := &translated.Dialogues[i]
+		if !untranslated[entry.ID] {
+			continue
+		}
+		if _, exists := entry.Drafts[options.Target]; exists && !options.Overwrite {
+			report.Skipped++
+			continue
+		}
+		if options.Limit > 0 && report.Translated >= options.Limit {
+			break
+		}
+
+		draft, err := t.translateDialogue(*entry, pageBreaks, options)
+		if err != nil {
+			return report, fmt.Errorf("failed to translate dialogue %d: %w", entry.ID, err)
+		}
+		if entry.Drafts == nil {
+			entry.Drafts = make(map[string]*DialogueDraft)
+		}
+		entry.Drafts[options.Target] = draft
+		report.Translated++
+
+		for _, reason := range draft.Attention {
+			switch reason {
+			case DraftAttentionOverBudget:
+				report.OverBudget = append(report.OverBudget, entry.ID)
+			case DraftAttentionCodesLost:
+				report.CodesLost = append(report.CodesLost, entry.ID)
+			}
+		}
+		common.LogDebug("Dialogue %d: draft of %d bytes (budget %d)", entry.ID, draft.Bytes, draft.Budget)
+	}
+
+	return report, nil
+}
+
+// translateDialogue translates the text items of a dialogue into a draft
+func (t *MachineTranslator) translateDialogue(entry DialogueEntry, pageBreaks bool, options MTOptions) (*DialogueDraft, error) {
+	texts := dialogueTexts(entry)
+	masked := make([]string, len(texts))
+	codes := make([][]string, len(texts))
+	originalBytes := 0
+	for i, text := range texts {
+		masked[i], codes[i] = maskControlCodes(text)
+		originalBytes += EstimateTextBytes(text, pageBreaks)
+	}
+
+	translations, err := t.backend.Translate(masked, options.Source, options.Target)
+	if err != nil {
+		return nil, err
+	}
+
+	draft := &DialogueDraft{
+		Backend: t.backend.Name(),
+		Text:    make([]string, len(translations)),
+		Budget:  originalBytes * options.BudgetPercent / 100,
+	}
+	codesLost := false
+	for i, translation := range translations {
+		text, complete := unmaskControlCodes(translation, codes[i])
+		codesLost = codesLost || !complete
+		draft.Text[i] = text
+		draft.Bytes += EstimateTextBytes(text, pageBreaks)
+	}
+
+	if draft.Bytes > draft.Budget {
+		draft.Attention = append(draft.Attention, DraftAttentionOverBudget)
+	}
+	if codesLost {
+		draft.Attention = append(draft.Attention, DraftAttentionCodesLost)
+	}
+	return draft, nil
+}
+
+// TranslateFile runs the pre-pass over a translated dialogue YAML file and writes the
+// file with its drafts to outputFile
+func (t *MachineTranslator) TranslateFile(originalFile, translatedFile, outputFile string, options MTOptions) (*MTReport, error) {
+	original, err := dialogueyaml.Read(originalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load original dialogues: %w", err)
+	}
+
+	translated, err := dialogueyaml.Read(translatedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translated dialogues: %w", err)
+	}
+
+	report, err := t.Translate(original.Dialogues, translated, options)
+	if err != nil {
+		// Keep the drafts made before the failure
+		if report != nil && report.Translated > 0 {
+			if writeErr := dialogueyaml.Write(outputFile, translated); writeErr != nil {
+				common.LogWarn("Failed to save partial drafts: %v", writeErr)
+			}
+		}
+		return report, err
+	}
+
+	if err := dialogueyaml.Write(outputFile, translated); err != nil {
+		return report, fmt.Errorf("failed to write dialogues: %w", err)
+	}
+	return report, nil
+}
@@ -0,0 +1,171 @@
+// Package pkg provides tests for the machine translation pre-pass
+package pkg
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// newMTServer starts an MT backend answering from a fixed phrase table
+func newMTServer(t *testing.T, phrases map[string]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_ = json.NewEncoder(w).Encode(mtResponse{Error: "bad key"})
+			return
+		}
+		var request mtRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		response := mtResponse{}
+		for _, text := range request.Texts {
+			response.Translations = append(response.Translations, phrases[text])
+		}
+		_ = json.NewEncoder(w).Encode(response)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestMaskControlCodes(t *testing.T) {
+	masked, codes := maskControlCodes("Hi[HALT]\nthere" + TriangleDown + "[8030]")
+	if masked != "Hi{0}\nthere{1}{2}" {
+		t.Errorf("masked = %q", masked)
+	}
+	if want := []string{"[HALT]", TriangleDown, "[8030]"}; !reflect.DeepEqual(codes, want) {
+		t.Errorf("codes = %q, want %q", codes, want)
+	}
+
+	text, complete := unmaskControlCodes("Oi{0}\nali{1}{2}", codes)
+	if !complete || text != "Oi[HALT]\nali"+TriangleDown+"[8030]" {
+		t.Errorf("unmask = %q, %v", text, complete)
+	}
+	if _, complete := unmaskControlCodes("Oi{0}{0}", codes); complete {
+		t.Error("repeated and missing tokens reported complete")
+	}
+}
+
+func TestEstimateTextBytes(t *testing.T) {
+	tests := []struct {
+		text       string
+		pageBreaks bool
+		want       int
+	}{
+		{"Hello", false, 10},
+		{"Hi[HALT]", false, 6},
+		{"A\n\nB", false, 6},
+		{"A\n\nB", true, 8},
+		{"A[8030]" + TriangleDown, false, 6},
+		{"A[PAUSE FOR 30]B", false, 8},
+	}
+	for _, test := range tests {
+		if got := EstimateTextBytes(test.text, test.pageBreaks); got != test.want {
+			t.Errorf("EstimateTextBytes(%q, %v) = %d, want %d", test.text, test.pageBreaks, got, test.want)
+		}
+	}
+}
+
+func TestMachineTranslator_Translate(t *testing.T) {
+	server := newMTServer(t, map[string]string{
+		"Hello{0}":           "Ola{0}",
+		"Good bye":           "Tchau",
+		"Go away":            "Por favor, va embora daqui",
+		"Wait{0}":            "Vai",
+		"Already translated": "unused",
+	})
+	backend := NewHTTPMTBackend(server.URL, "secret", DefaultMTTimeout)
+
+	original := []DialogueEntry{
+		textEntry(0, "Hello[HALT]", "Good bye"),
+		textEntry(1, "Go away"),
+		textEntry(2, "Wait[HALT]"),
+		textEntry(3, "Already translated"),
+		textEntry(4, "Hello[HALT]"),
+	}
+	translated := &DialoguesYAML{Dialogues: []DialogueEntry{
+		textEntry(0, "Hello[HALT]", "Good bye"),
+		textEntry(1, "Go away"),
+		textEntry(2, "Wait[HALT]"),
+		textEntry(3, "Ja traduzido"),
+		textEntry(4, "Hello[HALT]"),
+	}}
+	translated.Dialogues[4].Drafts = map[string]*DialogueDraft{"pt": {Text: []string{"kept"}}}
+
+	report, err := NewMachineTranslator(backend).Translate(original, translated, MTOptions{Source: "en", Target: "pt", BudgetPercent: 100})
+	if err != nil {
+		t.Fatalf("Translate failed: %v", err)
+	}
+
+	if report.Untranslated != 4 || report.Translated != 3 || report.Skipped != 1 {
+		t.Errorf("report = %+v, want 4 untranslated, 3 translated, 1 skipped", report)
+	}
+	if !reflect.DeepEqual(report.OverBudget, []int{1}) || !reflect.DeepEqual(report.CodesLost, []int{2}) {
+		t.Errorf("over budget %v, codes lost %v, want [1] and [2]", report.OverBudget, report.CodesLost)
+	}
+
+	draft := translated.Dialogues[0].Drafts["pt"]
+	if draft == nil || !reflect.DeepEqual(draft.Text, []string{"Ola[HALT]", "Tchau"}) {
+		t.Fatalf("dialogue 0 draft = %+v", draft)
+	}
+	if draft.Bytes != 18 || draft.Budget != 28 || len(draft.Attention) != 0 {
+		t.Errorf("dialogue 0 draft bytes %d, budget %d, attention %v", draft.Bytes, draft.Budget, draft.Attention)
+	}
+	if attention := translated.Dialogues[1].Drafts["pt"].Attention; !reflect.DeepEqual(attention, []string{DraftAttentionOverBudget}) {
+		t.Errorf("dialogue 1 attention = %v", attention)
+	}
+	if translated.Dialogues[3].Drafts != nil {
+		t.Error("translated dialogue was given a draft")
+	}
+	if translated.Dialogues[4].Drafts["pt"].Text[0] != "kept" {
+		t.Error("existing draft was overwritten")
+	}
+	// The content itself is never changed
+	if texts := dialogueTexts(translated.Dialogues[0]); texts[0] != "Hello[HALT]" {
+		t.Errorf("content changed to %q", texts)
+	}
+}
+
+func TestMachineTranslator_TranslateFile(t *testing.T) {
+	server := newMTServer(t, map[string]string{"Hello": "Ola"})
+	dir := t.TempDir()
+	originalFile := filepath.Join(dir, "original.yaml")
+	translatedFile := filepath.Join(dir, "translated.yaml")
+	dialogues := &DialoguesYAML{TotalDialogues: 1, Dialogues: []DialogueEntry{textEntry(0, "Hello")}}
+	if err := dialogueyaml.Write(originalFile, dialogues); err != nil {
+		t.Fatal(err)
+	}
+	if err := dialogueyaml.Write(translatedFile, dialogues); err != nil {
+		t.Fatal(err)
+	}
+
+	translator := NewMachineTranslator(NewHTTPMTBackend(server.URL, "secret", DefaultMTTimeout))
+	if _, err := translator.TranslateFile(originalFile, translatedFile, translatedFile, MTOptions{Target: "pt", BudgetPercent: 100}); err != nil {
+		t.Fatalf("TranslateFile failed: %v", err)
+	}
+
+	result, err := dialogueyaml.Read(translatedFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	draft := result.Dialogues[0].Drafts["pt"]
+	if draft == nil || draft.Text[0] != "Ola" || draft.Backend != server.URL {
+		t.Errorf("draft = %+v", draft)
+	}
+
+	// A rejected key is reported with the backend's message
+	translator = NewMachineTranslator(NewHTTPMTBackend(server.URL, "wrong", DefaultMTTimeout))
+	_, err = translator.TranslateFile(originalFile, originalFile, filepath.Join(dir, "out.yaml"), MTOptions{Target: "es", BudgetPercent: 100})
+	if err == nil || !strings.Contains(err.Error(), "bad key") {
+		t.Errorf("error = %v, want the backend message", err)
+	}
+}
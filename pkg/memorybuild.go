@@ -0,0 +1,407 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the in-memory build: it encodes WFM files, injects them and other
+// rebuilt files into a copy-on-write view of a CD image and updates the FLA table, then
+// writes the final image and a report. No intermediate file is written, so CI machines
+// with slow disks or little scratch space run the whole build in one pass.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// MemoryBuildFile is a file of the disc replaced by the in-memory build. Exactly one
+// of Dialogues and Source is set.
+type MemoryBuildFile struct {
+	Path      string // Path of the file on the disc, e.g. DATA/CFNT999H.WFM
+	Dialogues string // Dialogue YAML encoded into a WFM file (as wfm encode does)
+	Source    string // Prebuilt file copied as it is (e.g. a packed GAM)
+}
+
+// MemoryBuildOptions lists the files replaced by an in-memory build, in order
+type MemoryBuildOptions struct {
+	Files          []MemoryBuildFile
+	GlyphsFromDisc bool // Encode with the glyphs of the WFM file being replaced (as --glyphs-from does)
+}
+
+// MemoryBuildFileResult is the outcome of replacing a file
+type MemoryBuildFileResult struct {
+	Path         string `json:"path"`
+	Source       string `json:"source"`
+	LBA          uint32 `json:"lba"`
+	OriginalSize uint32 `json:"original_size"`
+	Size         uint32 `json:"size"`
+	Sectors      uint32 `json:"sectors"` // Sectors of the extents, which the new file must fit
+	Changed      bool   `json:"changed"`
+}
+
+// MemoryBuildFLAResult is an FLA entry whose size was updated
+type MemoryBuildFLAResult struct {
+	Entry        uint32 `json:"entry"`
+	File         string `json:"file"`
+	PreviousSize uint32 `json:"previous_size"`
+	Size         uint32 `json:"size"`
+}
+
+// MemoryBuildReport summarizes an in-memory build. It holds no timestamps, so
+// identical inputs produce identical reports.
+type MemoryBuildReport struct {
+	Image          string                  `json:"image"`
+	Output         string                  `json:"output"`
+	Files          []MemoryBuildFileResult `json:"files"`
+	FLA            []MemoryBuildFLAResult  `json:"fla"`
+	ChangedSectors int                     `json:"changed_sectors"`
+	Size           int64                   `json:"size"`
+	SHA256         string                  `json:"sha256"`
+}
+
+// ParseMemoryBuildFile parses a DISC_PATH=LOCAL_FILE argument. dialogues selects
+// whether the local file is a dialogue YAML to encode or a prebuilt file.
+func ParseMemoryBuildFile(spec string, dialogues bool) (MemoryBuildFile, error) {
+	discPath, localPath, ok := strings.Cut(spec, "=")
+	if !ok || discPath == "" || localPath == "" {
+		return MemoryBuildFile{}, fmt.Errorf("invalid file %q: expected DISC_PATH=LOCAL_FILE", spec)
+	}
+	file := MemoryBuildFile{Path: strings.Trim(filepath.ToSlash(discPath), "/")}
+	if dialogues {
+		file.Dialogues = localPath
+	} else {
+		file.Source = localPath
+	}
+	return file, nil
+}
+
+// BuildInMemory replaces files of a CD image and writes the result to outputFile. The
+// image is only read: every change goes to a copy-on-write view of it, and the final
+// image is streamed to outputFile at the end. Files are replaced in place, so each new
+// file must fit the sectors of the file it replaces; the FLA entries of the replaced
+// files get their new sizes. Files that grow past their sectors need a disc rebuild.
+func (p *CDFileProcessor) BuildInMemory(ctx context.Context, imageFile, outputFile string, options MemoryBuildOptions) (*MemoryBuildReport, error) {
+	if len(options.Files) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no files to build"))
+	}
+	if sameFile(imageFile, outputFile) {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("the output %s is the input image; the in-memory build writes a new image", outputFile))
+	}
+
+	base, err := psx.OpenImage(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer base.Close()
+
+	overlay := psx.NewOverlayImage(base)
+	reader := psx.NewCDReaderFromImage(overlay)
+	if err := reader.ValidateISO9660(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid ISO9660 image: %w", err))
+	}
+	descriptor, err := reader.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+
+	flaProcessor := NewFLAProcessor()
+	flaProcessor.SetLogger(p.logger)
+	table, err := flaProcessor.analyzeCDReader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read FLA table: %w", err)
+	}
+
+	report := &MemoryBuildReport{Image: imageFile, Output: outputFile, Files: []MemoryBuildFileResult{}, FLA: []MemoryBuildFLAResult{}}
+	sizes := make(map[uint32]uint32) // New sizes of the replaced files by LBA
+	for _, file := range options.Files {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+		result, err := p.replaceFile(ctx, reader, overlay, rootLBA, rootSize, file, options.GlyphsFromDisc)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := sizes[result.LBA]; ok {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s is replaced more than once", file.Path))
+		}
+		sizes[result.LBA] = result.Size
+		report.Files = append(report.Files, *result)
+	}
+
+	// The files keep their positions, so only the sizes of their FLA entries change
+	executable, err := reader.FindEntry(rootLBA, rootSize, mainExecutablePath)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to find %s: %w", mainExecutablePath, err))
+	}
+	for i, entry := range table.Entries {
+		if entry.LinkedFile == nil {
+			continue
+		}
+		size, ok := sizes[entry.LinkedFile.LBA]
+		if !ok || size == entry.FileSize {
+			continue
+		}
+		data := make([]byte, 4)
+		binary.LittleEndian.PutUint32(data, size)
+		if err := overlay.WriteFileData(executable.LBA, flaTableExeOffset+8*uint32(i)+4, data); err != nil {
+			return nil, fmt.Errorf("failed to write FLA entry %d: %w", i, err)
+		}
+		p.logger.Debug("FLA entry %d (%s): size %d -> %d", i, entry.LinkedFile.FullPath, entry.FileSize, size)
+		report.FLA = append(report.FLA, MemoryBuildFLAResult{Entry: uint32(i), File: entry.LinkedFile.FullPath, PreviousSize: entry.FileSize, Size: size})
+	}
+
+	if err := writeOverlayImage(ctx, overlay, outputFile, report); err != nil {
+		return nil, err
+	}
+	report.ChangedSectors = overlay.ChangedSectors()
+	common.LogInfo("Built %s in memory: %d files replaced, %d FLA entries and %d sectors changed",
+		outputFile, len(report.Files), len(report.FLA), report.ChangedSectors)
+	return report, nil
+}
+
+// replaceFile builds a file and writes it over the file of the disc at the same path
+func (p *CDFileProcessor) replaceFile(ctx context.Context, reader *psx.CDReader, overlay *psx.OverlayImage, rootLBA, rootSize uint32, file MemoryBuildFile, glyphsFromDisc bool) (*MemoryBuildFileResult, error) {
+	entry, err := reader.FindEntry(rootLBA, rootSize, file.Path)
+	if err != nil || entry.IsDir {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("%s not found on the disc", file.Path))
+	}
+	switch payload := psx.SectorPayload(entry.XAAttributes); payload {
+	case psx.CD_DATA_SIZE:
+	case psx.CD_XA_DATA_SIZE:
+		return p.replaceXAFile(reader, overlay, entry, file)
+	default:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s is stored in %d-byte sectors; only Form 1 and XA files can be replaced", file.Path, payload))
+	}
+
+	original, err := reader.ReadEntry(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var data []byte
+	result := &MemoryBuildFileResult{Path: file.Path, LBA: entry.LBA, OriginalSize: entry.Size, Sectors: entry.ExtentSize}
+	switch {
+	case file.Dialogues != "" && file.Source == "":
+		result.Source = file.Dialogues
+		encoder := NewWFMEncoder()
+		encoder.SetLogger(p.logger)
+		if glyphsFromDisc {
+			if encoder.donor, err = NewWFMDecoder().Decode(bytes.NewReader(original)); err != nil {
+				return nil, fmt.Errorf("failed to decode glyph donor %s: %w", file.Path, err)
+			}
+			encoder.donorFile = file.Path
+		}
+		if data, err = encoder.EncodeBytes(ctx, file.Dialogues, path.Base(file.Path)); err != nil {
+			return nil, fmt.Errorf("failed to encode %s: %w", file.Dialogues, err)
+		}
+	case file.Source != "" && file.Dialogues == "":
+		result.Source = file.Source
+		if data, err = os.ReadFile(file.Source); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Source, err)
+		}
+	default:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s needs either dialogues or a source file", file.Path))
+	}
+
+	size, err := common.SafeIntToUint32(len(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s is too large: %w", file.Path, err)
+	}
+	result.Size = size
+	if psx.DataSectors(size) > result.Sectors {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s grew to %d sectors, past the %d sectors it occupies; the in-memory build cannot move files, so rebuild the disc and run fla recalc instead",
+				file.Path, psx.DataSectors(size), result.Sectors))
+	}
+
+	result.Changed = !bytes.Equal(original, data)
+	if !result.Changed {
+		return result, nil
+	}
+
+	// Clear the bytes of the old file past the end of the new one
+	padded := data
+	if len(original) > len(data) {
+		padded = append(bytes.Clone(data), make([]byte, len(original)-len(data))...)
+	}
+	if err := overlay.WriteEntryData(entry, 0, padded); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+	}
+	if size != entry.Size {
+		if err := overlay.SetEntrySize(entry, size); err != nil {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("failed to resize %s: %w", file.Path, err))
+		}
+	}
+	p.logger.Debug("Replaced %s at LBA %d: %d -> %d bytes", file.Path, entry.LBA, entry.Size, size)
+	return result, nil
+}
+
+// replaceXAFile writes an XA file over the Form 2 sectors of the disc file at the same
+// path. The directory records keep their sizes, so the XA file may not hold more sectors.
+func (p *CDFileProcessor) replaceXAFile(reader *psx.CDReader, overlay *psx.OverlayImage, entry psx.CDFileEntry, file MemoryBuildFile) (*MemoryBuildFileResult, error) {
+	if file.Source == "" || file.Dialogues != "" {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s is an XA file and needs a prebuilt XA file", file.Path))
+	}
+
+	data, err := os.ReadFile(file.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Source, err)
+	}
+	xa, err := psx.ParseXAFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", file.Source, err)
+	}
+	original, err := reader.ReadXAFile(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &MemoryBuildFileResult{Path: file.Path, Source: file.Source, LBA: entry.LBA, OriginalSize: entry.Size, Size: entry.Size, Sectors: entry.ExtentSize}
+	if len(xa.Sectors) > len(original.Sectors) {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s holds %d sectors, past the %d sectors of %s; XA files cannot grow in place", file.Source, len(xa.Sectors), len(original.Sectors), file.Path))
+	}
+	for i := range xa.Sectors {
+		if !bytes.Equal(xa.Payload(i), original.Payload(i)) {
+			result.Changed = true
+			break
+		}
+	}
+	if !result.Changed {
+		return result, nil
+	}
+
+	if err := overlay.WriteXASectors(entry, xa); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", file.Path, err)
+	}
+	p.logger.Debug("Replaced XA file %s at LBA %d: %d of %d sectors", file.Path, entry.LBA, len(xa.Sectors), len(original.Sectors))
+	return result, nil
+}
+
+// writeOverlayImage streams the overlay image to outputFile, recording its size and hash;
+// the copy stops once ctx is canceled
+func writeOverlayImage(ctx context.Context, overlay *psx.OverlayImage, outputFile string, report *MemoryBuildReport) error {
+	output, err := common.CreateAtomic(outputFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", outputFile, err))
+	}
+	defer output.Abort()
+
+	hash := sha256.New()
+	writer := common.NewProgressWriter(ctx, output, outputFile, overlay.Size())
+	if report.Size, err = overlay.WriteTo(io.MultiWriter(writer, hash)); err != nil {
+		if common.IsAborted(err) {
+			return err
+		}
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", outputFile, err))
+	}
+	report.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return output.Commit()
+}
+
+// memoryFile is an in-memory io.WriteSeeker collecting an encoded file
+type memoryFile struct {
+	data     []byte
+	position int64
+}
+
+// Write writes p at the current position, growing the file as needed
+func (f *memoryFile) Write(p []byte) (int, error) {
+	if end := f.position + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[f.position:], p)
+	f.position += int64(len(p))
+	return len(p), nil
+}
+
+// Seek sets the position of the next write
+func (f *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.position
+	case io.SeekEnd:
+		offset += int64(len(f.data))
+	default:
+		return 0, fmt.Errorf("invalid whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	f.position = offset
+	return offset, nil
+}
+
+// Bytes returns the contents of the file
+func (f *memoryFile) Bytes() []byte {
+	return f.data
+}
+
+// WriteMemoryBuildReport writes the report in the requested format (json or markdown)
+func WriteMemoryBuildReport(report *MemoryBuildReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeMemoryBuildMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeMemoryBuildMarkdown renders the report as a markdown document
+func writeMemoryBuildMarkdown(report *MemoryBuildReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# In-Memory Build: %s\n\n", report.Output))
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Image | %s |\n", report.Image))
+	sb.WriteString(fmt.Sprintf("| Size | %d |\n", report.Size))
+	sb.WriteString(fmt.Sprintf("| SHA-256 | %s |\n", report.SHA256))
+	sb.WriteString(fmt.Sprintf("| Changed sectors | %d |\n", report.ChangedSectors))
+
+	sb.WriteString("\n## Files\n\n")
+	sb.WriteString("| File | Source | LBA | Original | New | Sectors | Changed |\n")
+	sb.WriteString("|------|--------|-----|----------|-----|---------|---------|\n")
+	for _, file := range report.Files {
+		sb.WriteString(fmt.Sprintf("| %s | %s | %d | %d | %d | %d | %t |\n",
+			file.Path, file.Source, file.LBA, file.OriginalSize, file.Size, file.Sectors, file.Changed))
+	}
+
+	sb.WriteString("\n## FLA Entries\n\n")
+	if len(report.FLA) == 0 {
+		sb.WriteString("No FLA entry changed.\n")
+	} else {
+		sb.WriteString("| Entry | File | Previous Size | New Size |\n")
+		sb.WriteString("|-------|------|---------------|----------|\n")
+		for _, entry := range report.FLA {
+			sb.WriteString(fmt.Sprintf("| %04X | %s | %d | %d |\n", entry.Entry, entry.File, entry.PreviousSize, entry.Size))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package pkg provides tests for the in-memory build of a CD image.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+func TestCDFileProcessor_BuildInMemory(t *testing.T) {
+	dir := t.TempDir()
+	fontFile := filepath.Join(dir, "FONT.WFM")
+	writeDonorWFM(t, fontFile)
+	font, err := os.ReadFile(fontFile)
+	if err != nil {
+		t.Fatalf("failed to read font: %v", err)
+	}
+
+	imagePath := filepath.Join(dir, "original.bin")
+	files, _ := writeDisc(t, imagePath, []discFile{
+		{dir: "DATA", name: "FONT.WFM", data: font},
+		{dir: "DATA", name: "ITEM.BIN", data: bytes.Repeat([]byte{0x11}, 3000)},
+		{dir: "DATA", name: "LAST.BIN", data: bytes.Repeat([]byte{0x5A}, 100)},
+	})
+	original, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+
+	// Dialogues decoded from the font; dialogue 0 keeps its text so the disc font
+	// serves as glyph donor
+	projectDir := filepath.Join(dir, "project")
+	if err := NewWFMProcessor().Process(fontFile, projectDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+	yamlFile := filepath.Join(projectDir, "dialogues.yaml")
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("failed to read decoded dialogues: %v", err)
+	}
+	dialogues.Dialogues[0].Content = []map[string]interface{}{{"text": "AB"}}
+	dialogues.Dialogues[1].Content = []map[string]interface{}{{"text": "BAB"}}
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("failed to write translated dialogues: %v", err)
+	}
+
+	// A prebuilt file that shrinks within its sectors
+	item := bytes.Repeat([]byte{0x22}, 2500)
+	itemFile := filepath.Join(dir, "ITEM.BIN")
+	if err := os.WriteFile(itemFile, item, 0644); err != nil {
+		t.Fatalf("failed to write item file: %v", err)
+	}
+
+	options := MemoryBuildOptions{
+		Files: []MemoryBuildFile{
+			{Path: "DATA/FONT.WFM", Dialogues: yamlFile},
+			{Path: "DATA/ITEM.BIN", Source: itemFile},
+		},
+		GlyphsFromDisc: true,
+	}
+	outputPath := filepath.Join(dir, "built.bin")
+	report, err := NewCDProcessor().BuildInMemory(context.Background(), imagePath, outputPath, options)
+	if err != nil {
+		t.Fatalf("BuildInMemory() failed: %v", err)
+	}
+
+	if current, _ := os.ReadFile(imagePath); !bytes.Equal(current, original) {
+		t.Error("BuildInMemory() changed the input image")
+	}
+	if len(report.Files) != 2 || !report.Files[0].Changed || report.Files[1].Size != 2500 {
+		t.Errorf("Files = %+v, want both files replaced", report.Files)
+	}
+	wantFLA := []MemoryBuildFLAResult{
+		{Entry: 0, File: "DATA/FONT.WFM", PreviousSize: uint32(len(font)), Size: report.Files[0].Size},
+		{Entry: 1, File: "DATA/ITEM.BIN", PreviousSize: 3000, Size: 2500},
+	}
+	if !reflect.DeepEqual(report.FLA, wantFLA) {
+		t.Errorf("FLA = %+v, want %+v", report.FLA, wantFLA)
+	}
+
+	// The built image links the resized file and holds the new contents
+	table, err := NewFLAProcessor().AnalyzeCDImage(outputPath)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage(built) failed: %v", err)
+	}
+	if entry := table.Entries[1]; entry.FileSize != 2500 || entry.LinkedFile == nil || entry.LinkedFile.Size != 2500 {
+		t.Errorf("FLA entry 1 = %d bytes linked to %+v, want 2500 bytes", entry.FileSize, entry.LinkedFile)
+	}
+	dumpDir := filepath.Join(dir, "dump")
+	if err := NewCDProcessor().Dump(context.Background(), outputPath, dumpDir); err != nil {
+		t.Fatalf("Dump(built) failed: %v", err)
+	}
+	if got := readDumpedFile(t, dumpDir, files[2]); !bytes.Equal(got, item) {
+		t.Errorf("built ITEM.BIN is %d bytes, want the 2500-byte source", len(got))
+	}
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(readDumpedFile(t, dumpDir, files[1])))
+	if err != nil {
+		t.Fatalf("Decode(built font) failed: %v", err)
+	}
+	if got := len(wfm.Dialogues[1].Data); got < 6 {
+		t.Errorf("built dialogue 1 is %d bytes, want the 3 encoded characters", got)
+	}
+
+	// Identical inputs build an identical image
+	again, err := NewCDProcessor().BuildInMemory(context.Background(), imagePath, filepath.Join(dir, "again.bin"), options)
+	if err != nil {
+		t.Fatalf("BuildInMemory(again) failed: %v", err)
+	}
+	if again.SHA256 != report.SHA256 {
+		t.Errorf("rebuilt image hash %s, want %s", again.SHA256, report.SHA256)
+	}
+
+	var sb strings.Builder
+	if err := WriteMemoryBuildReport(report, ReportFormatMarkdown, &sb); err != nil {
+		t.Fatalf("WriteMemoryBuildReport() failed: %v", err)
+	}
+	if !strings.Contains(sb.String(), "| 0001 | DATA/ITEM.BIN | 3000 | 2500 |") {
+		t.Errorf("markdown report lacks the FLA row:\n%s", sb.String())
+	}
+
+	// A file growing past its sectors is refused and nothing is written
+	if err := os.WriteFile(itemFile, make([]byte, 5000), 0644); err != nil {
+		t.Fatalf("failed to write item file: %v", err)
+	}
+	refused := filepath.Join(dir, "refused.bin")
+	if _, err := NewCDProcessor().BuildInMemory(context.Background(), imagePath, refused, options); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("BuildInMemory(grown file) = %v, want a validation error", err)
+	}
+	if _, err := os.Stat(refused); !os.IsNotExist(err) {
+		t.Error("refused build wrote an output image")
+	}
+}
@@ -0,0 +1,508 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the opcode discovery analysis: undecoded 0xC0xx and 0xFFxx words are
+// collected across the dialogues of WFM files and clustered by the number of parameter
+// words following them, the codes next to them and their position in the text. Every code
+// gets a hypothesis (likely argument count and confidence) that can seed controlcodes.yaml.
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+// OpcodeFormatYAML writes the hypotheses as controlcodes.yaml entries
+const OpcodeFormatYAML = "yaml"
+
+// Positions of an opcode in the text of a dialogue
+const (
+	OpcodePositionStart     = "start"      // Before the first glyph of the dialogue
+	OpcodePositionEnd       = "end"        // After the last glyph of the dialogue
+	OpcodePositionLineStart = "line-start" // After NEWLINE or DOUBLE_NEWLINE
+	OpcodePositionInline    = "inline"     // Between glyphs of a line
+)
+
+// Neighbour names that are not codes
+const (
+	opcodeNeighbourStart = "(start)" // Nothing before the opcode
+	opcodeNeighbourEnd   = "(end)"   // Nothing after the opcode and its parameters
+	opcodeNeighbourGlyph = "(glyph)"
+	opcodeNeighbourValue = "(value)" // A parameter word not claimed by any code
+)
+
+const (
+	// maxOpcodeArgs is the largest argument count proposed; longer runs of parameter
+	// words are more likely data than arguments
+	maxOpcodeArgs = 4
+
+	// opcodeExampleLimit is the number of occurrences kept as examples per opcode
+	opcodeExampleLimit = 5
+
+	// opcodeNeighbourLimit is the number of neighbours listed per side
+	opcodeNeighbourLimit = 3
+)
+
+// OpcodeExample is one occurrence of an opcode
+type OpcodeExample struct {
+	File       string   `json:"file"`
+	DialogueID int      `json:"dialogue_id"`
+	Offset     int      `json:"offset"` // Byte offset in the dialogue data
+	Words      []string `json:"words"`  // Parameter words following the code
+}
+
+// OpcodeNeighbour is a code (or glyph, start or end) next to an opcode and how often
+type OpcodeNeighbour struct {
+	Code  string `json:"code"`
+	Count int    `json:"count"`
+}
+
+// OpcodeArgRange summarizes the values of one argument under the likely argument count
+type OpcodeArgRange struct {
+	Min      uint16 `json:"min"`
+	Max      uint16 `json:"max"`
+	Distinct int    `json:"distinct"`
+}
+
+// OpcodeHypothesis is what the analysis concludes about one undecoded code
+type OpcodeHypothesis struct {
+	Code        string            `json:"code"`
+	Occurrences int               `json:"occurrences"`
+	Dialogues   int               `json:"dialogues"`
+	Files       int               `json:"files"`
+	LikelyArgs  int               `json:"likely_args"`
+	Confidence  float64           `json:"confidence"` // Share of occurrences followed by exactly LikelyArgs parameter words
+	ArgCounts   map[int]int       `json:"arg_counts"` // Parameter words seen after the code → occurrences
+	ArgRanges   []OpcodeArgRange  `json:"arg_ranges,omitempty"`
+	Positions   map[string]int    `json:"positions"`
+	Before      []OpcodeNeighbour `json:"before"`
+	After       []OpcodeNeighbour `json:"after"`
+	Hints       []string          `json:"hints,omitempty"`
+	Examples    []OpcodeExample   `json:"examples"`
+
+	value     uint16
+	runs      [][]uint16 // Parameter words after every occurrence
+	dialogues map[string]bool
+	files     map[string]bool
+	before    map[string]int
+	after     map[string]int
+}
+
+// OpcodeDiscoveryReport lists the hypotheses of every undecoded code, most frequent first
+type OpcodeDiscoveryReport struct {
+	Files      []string           `json:"files"`
+	Dialogues  int                `json:"dialogues"`
+	Hypotheses []OpcodeHypothesis `json:"hypotheses"`
+}
+
+// OpcodeDiscovery collects undecoded codes across dialogues
+type OpcodeDiscovery struct {
+	files     []string
+	dialogues int
+	codes     map[uint16]*OpcodeHypothesis
+}
+
+// NewOpcodeDiscovery creates an empty opcode discovery
+func NewOpcodeDiscovery() *OpcodeDiscovery {
+	return &OpcodeDiscovery{codes: make(map[uint16]*OpcodeHypothesis)}
+}
+
+// DiscoverOpcodes analyzes the dialogues of the given WFM files
+func DiscoverOpcodes(paths []string) (*OpcodeDiscoveryReport, error) {
+	discovery := NewOpcodeDiscovery()
+	for _, path := range paths {
+		if err := discovery.AddWFMFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return discovery.Report(), nil
+}
+
+// AddWFMFile decodes a WFM file and adds its dialogues
+func (d *OpcodeDiscovery) AddWFMFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+
+	d.files = append(d.files, path)
+	for id, dialogue := range wfm.Dialogues {
+		d.AddDialogue(path, id, dialogue.Data)
+	}
+	return nil
+}
+
+// isUndecodedOpcode reports whether a word is a 0xC0xx or 0xFFxx code missing from the
+// control code table
+func isUndecodedOpcode(word uint16) bool {
+	if _, known := LookupControlCode(word); known {
+		return false
+	}
+	return word&0xFF00 == 0xC000 || word&0xFF00 == 0xFF00
+}
+
+// isParameterWord reports whether a word can only be a parameter: glyph IDs start at
+// GLYPH_ID_BASE and control codes above them
+func isParameterWord(word uint16) bool {
+	return word < GLYPH_ID_BASE
+}
+
+// opcodeNeighbourName names a word next to an opcode
+func opcodeNeighbourName(word uint16) string {
+	if code, known := LookupControlCode(word); known {
+		return code.Name
+	}
+	switch {
+	case isUndecodedOpcode(word):
+		return fmt.Sprintf("%04X", word)
+	case isParameterWord(word):
+		return opcodeNeighbourValue
+	default:
+		return opcodeNeighbourGlyph
+	}
+}
+
+// AddDialogue adds the undecoded codes of one dialogue (data without the terminator)
+func (d *OpcodeDiscovery) AddDialogue(file string, id int, data []byte) {
+	d.dialogues++
+
+	words := make([]uint16, 0, len(data)/2)
+	for i := 0; i+1 < len(data); i += 2 {
+		word := binary.LittleEndian.Uint16(data[i:])
+		if word == TERMINATOR_1 || word == TERMINATOR_2 {
+			break
+		}
+		words = append(words, word)
+	}
+
+	lastGlyph := -1
+	for i, word := range words {
+		if opcodeNeighbourName(word) == opcodeNeighbourGlyph {
+			lastGlyph = i
+		}
+	}
+
+	previous := opcodeNeighbourStart
+	seenGlyph := false
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+
+		if code, known := LookupControlCode(word); known {
+			previous = code.Name
+			i += code.Args
+			continue
+		}
+		if !isUndecodedOpcode(word) {
+			previous = opcodeNeighbourName(word)
+			if previous == opcodeNeighbourGlyph {
+				seenGlyph = true
+			}
+			continue
+		}
+
+		// The parameter words following the code are its candidate arguments
+		run := 0
+		for i+1+run < len(words) && isParameterWord(words[i+1+run]) {
+			run++
+		}
+		next := opcodeNeighbourEnd
+		if i+1+run < len(words) {
+			next = opcodeNeighbourName(words[i+1+run])
+		}
+
+		position := OpcodePositionInline
+		switch {
+		case !seenGlyph:
+			position = OpcodePositionStart
+		case lastGlyph < i:
+			position = OpcodePositionEnd
+		case previous == "NEWLINE" || previous == "DOUBLE_NEWLINE":
+			position = OpcodePositionLineStart
+		}
+
+		d.record(word, file, id, i*2, words[i+1:i+1+run], position, previous, next)
+		previous = fmt.Sprintf("%04X", word)
+		i += run
+	}
+}
+
+// record adds one occurrence of an undecoded code
+func (d *OpcodeDiscovery) record(word uint16, file string, id, offset int, run []uint16, position, before, after string) {
+	hypothesis, found := d.codes[word]
+	if !found {
+		hypothesis = &OpcodeHypothesis{
+			Code:      fmt.Sprintf("%04X", word),
+			ArgCounts: make(map[int]int),
+			Positions: make(map[string]int),
+			value:     word,
+			dialogues: make(map[string]bool),
+			files:     make(map[string]bool),
+			before:    make(map[string]int),
+			after:     make(map[string]int),
+		}
+		d.codes[word] = hypothesis
+	}
+
+	hypothesis.Occurrences++
+	hypothesis.ArgCounts[len(run)]++
+	hypothesis.Positions[position]++
+	hypothesis.runs = append(hypothesis.runs, append([]uint16(nil), run...))
+	hypothesis.dialogues[fmt.Sprintf("%s#%d", file, id)] = true
+	hypothesis.files[file] = true
+	hypothesis.before[before]++
+	hypothesis.after[after]++
+
+	if len(hypothesis.Examples) < opcodeExampleLimit {
+		example := OpcodeExample{File: file, DialogueID: id, Offset: offset, Words: []string{}}
+		for _, value := range run {
+			example.Words = append(example.Words, fmt.Sprintf("%04X", value))
+		}
+		hypothesis.Examples = append(hypothesis.Examples, example)
+	}
+}
+
+// Report concludes a hypothesis for every code collected so far
+func (d *OpcodeDiscovery) Report() *OpcodeDiscoveryReport {
+	report := &OpcodeDiscoveryReport{
+		Files:      append([]string{}, d.files...),
+		Dialogues:  d.dialogues,
+		Hypotheses: []OpcodeHypothesis{},
+	}
+
+	for _, hypothesis := range d.codes {
+		hypothesis.conclude()
+		report.Hypotheses = append(report.Hypotheses, *hypothesis)
+	}
+	sort.Slice(report.Hypotheses, func(i, j int) bool {
+		a, b := report.Hypotheses[i], report.Hypotheses[j]
+		if a.Occurrences != b.Occurrences {
+			return a.Occurrences > b.Occurrences
+		}
+		return a.value < b.value
+	})
+	return report
+}
+
+// conclude picks the likely argument count and fills in the summaries and hints. The
+// likely count is the most frequent length of the parameter word runs after the code (the
+// shorter one on ties, at most maxOpcodeArgs): a shorter run means an argument fell in the
+// glyph range, a longer one that the text went on with values.
+func (h *OpcodeHypothesis) conclude() {
+	h.Dialogues = len(h.dialogues)
+	h.Files = len(h.files)
+
+	best, bestCount := 0, -1
+	for count := 0; count <= maxOpcodeArgs; count++ {
+		if h.ArgCounts[count] > bestCount {
+			best, bestCount = count, h.ArgCounts[count]
+		}
+	}
+	h.LikelyArgs = best
+	h.Confidence = float64(bestCount) / float64(h.Occurrences)
+
+	h.ArgRanges = nil
+	for arg := 0; arg < h.LikelyArgs; arg++ {
+		values := make(map[uint16]bool)
+		argRange := OpcodeArgRange{Min: 0xFFFF}
+		for _, run := range h.runs {
+			if len(run) < h.LikelyArgs {
+				continue
+			}
+			value := run[arg]
+			values[value] = true
+			argRange.Min = min(argRange.Min, value)
+			argRange.Max = max(argRange.Max, value)
+		}
+		argRange.Distinct = len(values)
+		h.ArgRanges = append(h.ArgRanges, argRange)
+	}
+
+	h.Before = topOpcodeNeighbours(h.before)
+	h.After = topOpcodeNeighbours(h.after)
+	h.Hints = h.hints()
+}
+
+// hints describes the patterns that support or qualify the hypothesis
+func (h *OpcodeHypothesis) hints() []string {
+	var hints []string
+
+	if h.Confidence == 1 && h.Occurrences > 1 {
+		hints = append(hints, fmt.Sprintf("all %d occurrences are followed by %d parameter words", h.Occurrences, h.LikelyArgs))
+	} else if h.Confidence < 0.5 {
+		hints = append(hints, "parameter word counts disagree: arguments may include glyph-range values")
+	}
+
+	for _, position := range []string{OpcodePositionStart, OpcodePositionEnd, OpcodePositionLineStart} {
+		if h.Positions[position] == h.Occurrences && h.Occurrences > 1 {
+			hints = append(hints, fmt.Sprintf("always at the %s of the text", strings.ReplaceAll(position, "-", " ")))
+		}
+	}
+
+	if len(h.Before) > 0 && h.Before[0].Count == h.Occurrences && h.Occurrences > 1 {
+		hints = append(hints, fmt.Sprintf("always preceded by %s", h.Before[0].Code))
+	}
+	if len(h.After) > 0 && h.After[0].Count == h.Occurrences && h.Occurrences > 1 {
+		hints = append(hints, fmt.Sprintf("always followed by %s", h.After[0].Code))
+	}
+
+	for arg, argRange := range h.ArgRanges {
+		if argRange.Distinct == 1 && h.Occurrences > 1 {
+			hints = append(hints, fmt.Sprintf("argument %d is always 0x%04X", arg+1, argRange.Min))
+		}
+	}
+
+	return hints
+}
+
+// topOpcodeNeighbours returns the most frequent neighbours
+func topOpcodeNeighbours(counts map[string]int) []OpcodeNeighbour {
+	neighbours := make([]OpcodeNeighbour, 0, len(counts))
+	for code, count := range counts {
+		neighbours = append(neighbours, OpcodeNeighbour{Code: code, Count: count})
+	}
+	sort.Slice(neighbours, func(i, j int) bool {
+		if neighbours[i].Count != neighbours[j].Count {
+			return neighbours[i].Count > neighbours[j].Count
+		}
+		return neighbours[i].Code < neighbours[j].Code
+	})
+	if len(neighbours) > opcodeNeighbourLimit {
+		neighbours = neighbours[:opcodeNeighbourLimit]
+	}
+	return neighbours
+}
+
+// WriteOpcodeReport writes the report in the requested format: json, markdown, or yaml
+// for controlcodes.yaml entries
+func WriteOpcodeReport(report *OpcodeDiscoveryReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeOpcodeMarkdown(report, writer)
+	case OpcodeFormatYAML:
+		return writeOpcodeCodesYAML(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeOpcodeMarkdown renders the report as a markdown document
+func writeOpcodeMarkdown(report *OpcodeDiscoveryReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Opcode Discovery\n\n")
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Files | %d |\n", len(report.Files)))
+	sb.WriteString(fmt.Sprintf("| Dialogues | %d |\n", report.Dialogues))
+	sb.WriteString(fmt.Sprintf("| Undecoded codes | %d |\n", len(report.Hypotheses)))
+
+	sb.WriteString("\n## Hypotheses\n\n")
+	if len(report.Hypotheses) == 0 {
+		sb.WriteString("No undecoded codes found.\n")
+	} else {
+		sb.WriteString("| Code | Occurrences | Dialogues | Likely args | Confidence | Arg counts | Positions | Before | After |\n")
+		sb.WriteString("|------|-------------|-----------|-------------|------------|------------|-----------|--------|-------|\n")
+		for _, hypothesis := range report.Hypotheses {
+			sb.WriteString(fmt.Sprintf("| %s | %d | %d | %d | %.0f%% | %s | %s | %s | %s |\n",
+				hypothesis.Code, hypothesis.Occurrences, hypothesis.Dialogues, hypothesis.LikelyArgs,
+				hypothesis.Confidence*100, formatOpcodeCounts(hypothesis.ArgCounts),
+				formatOpcodePositions(hypothesis.Positions),
+				formatOpcodeNeighbours(hypothesis.Before), formatOpcodeNeighbours(hypothesis.After)))
+		}
+
+		sb.WriteString("\n## Details\n")
+		for _, hypothesis := range report.Hypotheses {
+			sb.WriteString(fmt.Sprintf("\n### %s\n\n", hypothesis.Code))
+			for _, hint := range hypothesis.Hints {
+				sb.WriteString(fmt.Sprintf("- %s\n", hint))
+			}
+			for arg, argRange := range hypothesis.ArgRanges {
+				sb.WriteString(fmt.Sprintf("- argument %d: 0x%04X-0x%04X (%d distinct values)\n",
+					arg+1, argRange.Min, argRange.Max, argRange.Distinct))
+			}
+			for _, example := range hypothesis.Examples {
+				sb.WriteString(fmt.Sprintf("- example: %s dialogue %d at 0x%X: `%s`\n", example.File, example.DialogueID,
+					example.Offset, markdownCell(strings.TrimSpace(hypothesis.Code+" "+strings.Join(example.Words, " ")))))
+			}
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
+
+// writeOpcodeCodesYAML writes one controlcodes.yaml entry per hypothesis
+func writeOpcodeCodesYAML(report *OpcodeDiscoveryReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Opcode hypotheses from tombatools wfm opcodes. Review every entry before\n")
+	sb.WriteString("# merging it into controlcodes.yaml: the argument counts are guesses.\n")
+	sb.WriteString("codes:\n")
+	for _, hypothesis := range report.Hypotheses {
+		sb.WriteString(fmt.Sprintf("  - name: %s\n", hypothesis.Code))
+		sb.WriteString(fmt.Sprintf("    value: 0x%s\n", hypothesis.Code))
+		if hypothesis.LikelyArgs > 0 {
+			sb.WriteString(fmt.Sprintf("    args: %d\n", hypothesis.LikelyArgs))
+		}
+		sb.WriteString(fmt.Sprintf("    tag: \"[%s]\"\n", hypothesis.Code))
+		sb.WriteString(fmt.Sprintf("    comment: \"hypothesis: args %d (%.0f%% of %d occurrences)\"\n",
+			hypothesis.LikelyArgs, hypothesis.Confidence*100, hypothesis.Occurrences))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write codes YAML: %w", err)
+	}
+	return nil
+}
+
+// formatOpcodeCounts renders argument counts as "0×3, 2×10"
+func formatOpcodeCounts(counts map[int]int) string {
+	keys := make([]int, 0, len(counts))
+	for count := range counts {
+		keys = append(keys, count)
+	}
+	sort.Ints(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, count := range keys {
+		parts = append(parts, fmt.Sprintf("%d×%d", count, counts[count]))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatOpcodePositions renders positions in a fixed order as "start 3, inline 1"
+func formatOpcodePositions(positions map[string]int) string {
+	var parts []string
+	for _, position := range []string{OpcodePositionStart, OpcodePositionLineStart, OpcodePositionInline, OpcodePositionEnd} {
+		if positions[position] > 0 {
+			parts = append(parts, fmt.Sprintf("%s %d", position, positions[position]))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatOpcodeNeighbours renders neighbours as "NEWLINE 4, (glyph) 1"
+func formatOpcodeNeighbours(neighbours []OpcodeNeighbour) string {
+	parts := make([]string, 0, len(neighbours))
+	for _, neighbour := range neighbours {
+		parts = append(parts, fmt.Sprintf("%s %d", neighbour.Code, neighbour.Count))
+	}
+	return markdownCell(strings.Join(parts, ", "))
+}
@@ -0,0 +1,86 @@
+// Package pkg provides tests for the opcode discovery analysis
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// opcodeTestDialogue encodes dialogue words as little endian data
+func opcodeTestDialogue(words ...uint16) []byte {
+	data := make([]byte, len(words)*2)
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[i*2:], word)
+	}
+	return data
+}
+
+// findOpcodeHypothesis returns the hypothesis of a code, or nil
+func findOpcodeHypothesis(report *OpcodeDiscoveryReport, code string) *OpcodeHypothesis {
+	for i := range report.Hypotheses {
+		if report.Hypotheses[i].Code == code {
+			return &report.Hypotheses[i]
+		}
+	}
+	return nil
+}
+
+func TestOpcodeDiscovery(t *testing.T) {
+	discovery := NewOpcodeDiscovery()
+	discovery.AddDialogue("A.WFM", 0, opcodeTestDialogue(
+		INIT_TEXT_BOX, 0x0010, 0x0002, 0xC0A0, 0x0001, 0x0002, 0x8001, NEWLINE, 0xC0A1, 0x8002, C04D, TERMINATOR_2))
+	discovery.AddDialogue("A.WFM", 1, opcodeTestDialogue(0xC0A0, 0x0001, 0x0005, 0x8003, 0xFFF0))
+	discovery.AddDialogue("B.WFM", 0, opcodeTestDialogue(0x8004, 0xC0A0, 0x0001, 0x8005))
+	report := discovery.Report()
+
+	if report.Dialogues != 3 || len(report.Hypotheses) != 3 {
+		t.Fatalf("dialogues = %d, hypotheses = %d, want 3 and 3: %+v", report.Dialogues, len(report.Hypotheses), report.Hypotheses)
+	}
+	if report.Hypotheses[0].Code != "C0A0" {
+		t.Errorf("most frequent code = %s, want C0A0", report.Hypotheses[0].Code)
+	}
+
+	c0a0 := findOpcodeHypothesis(report, "C0A0")
+	if c0a0.Occurrences != 3 || c0a0.Files != 2 || c0a0.LikelyArgs != 2 {
+		t.Errorf("C0A0 = %d occurrences in %d files, %d args, want 3, 2, 2", c0a0.Occurrences, c0a0.Files, c0a0.LikelyArgs)
+	}
+	if c0a0.Positions[OpcodePositionStart] != 2 || c0a0.Positions[OpcodePositionInline] != 1 {
+		t.Errorf("C0A0 positions = %v, want start 2, inline 1", c0a0.Positions)
+	}
+	if len(c0a0.ArgRanges) != 2 || c0a0.ArgRanges[0].Distinct != 1 || c0a0.ArgRanges[1].Max != 0x0005 {
+		t.Errorf("C0A0 argument ranges = %+v", c0a0.ArgRanges)
+	}
+	if len(c0a0.Before) != 3 || c0a0.After[0] != (OpcodeNeighbour{Code: opcodeNeighbourGlyph, Count: 3}) {
+		t.Errorf("C0A0 neighbours = %+v / %+v", c0a0.Before, c0a0.After)
+	}
+	if !strings.Contains(strings.Join(c0a0.Hints, "|"), "always followed by (glyph)") {
+		t.Errorf("C0A0 hints = %q", c0a0.Hints)
+	}
+
+	c0a1 := findOpcodeHypothesis(report, "C0A1")
+	if c0a1.LikelyArgs != 0 || c0a1.Positions[OpcodePositionLineStart] != 1 || c0a1.Before[0].Code != "NEWLINE" {
+		t.Errorf("C0A1 = %+v, want no args after NEWLINE", c0a1)
+	}
+
+	fff0 := findOpcodeHypothesis(report, "FFF0")
+	if fff0.Positions[OpcodePositionEnd] != 1 || fff0.After[0].Code != opcodeNeighbourEnd {
+		t.Errorf("FFF0 = %+v, want at the end of the text", fff0)
+	}
+}
+
+func TestWriteOpcodeReport_YAML(t *testing.T) {
+	discovery := NewOpcodeDiscovery()
+	discovery.AddDialogue("A.WFM", 0, opcodeTestDialogue(0xC0A0, 0x0001, 0x0002, 0x8001))
+
+	var buffer bytes.Buffer
+	if err := WriteOpcodeReport(discovery.Report(), OpcodeFormatYAML, &buffer); err != nil {
+		t.Fatalf("WriteOpcodeReport() failed: %v", err)
+	}
+	for _, want := range []string{"name: C0A0", "value: 0xC0A0", "args: 2", `tag: "[C0A0]"`} {
+		if !strings.Contains(buffer.String(), want) {
+			t.Errorf("codes YAML misses %q:\n%s", want, buffer.String())
+		}
+	}
+}
@@ -0,0 +1,431 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the profile-driven dumper and rebuilder for the event tables of stage
+// overlays (.OVL). Each event record triggers a WFM dialogue by its slot, so exporting the
+// event to dialogue mapping gives translators the context of every dialogue and lets the
+// indices be checked after the dialogues are edited.
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+// overlayEventPreviewLength is the maximum number of characters of dialogue text shown next to an event
+const overlayEventPreviewLength = 60
+
+// OverlayEventField locates an integer field inside an event record
+type OverlayEventField struct {
+	At   int    `yaml:"at"`             // Position of the field inside the record
+	Type string `yaml:"type,omitempty"` // u8, u16 or u32 little endian (defaults to u16)
+}
+
+// OverlayEventTableDefinition describes a table of fixed-size event records inside an overlay,
+// either at a fixed offset or at the single match of a byte pattern
+type OverlayEventTableDefinition struct {
+	Name     string             `yaml:"name"`
+	Offset   *int               `yaml:"offset,omitempty"`   // File offset of the first record
+	Pattern  string             `yaml:"pattern,omitempty"`  // Hex bytes with ?? wildcards (e.g. "45 56 ?? ??")
+	StartAt  int                `yaml:"start_at,omitempty"` // Position of the first record relative to the pattern match
+	Stride   int                `yaml:"stride"`             // Distance in bytes between records
+	Count    int                `yaml:"count"`              // Number of records
+	Event    *OverlayEventField `yaml:"event,omitempty"`    // Event ID field
+	Flag     *OverlayEventField `yaml:"flag,omitempty"`     // Story flag field
+	Dialogue OverlayEventField  `yaml:"dialogue"`           // Dialogue slot field
+	Labels   map[int]string     `yaml:"labels,omitempty"`   // NPC or scene of records, by index
+}
+
+// OverlayEventFileProfile lists the event tables of a single overlay
+type OverlayEventFileProfile struct {
+	WFM    string                        `yaml:"wfm,omitempty"` // WFM file holding the referenced dialogues
+	Tables []OverlayEventTableDefinition `yaml:"tables"`
+}
+
+// OverlayEventProfile maps overlay file names to their event table layouts
+type OverlayEventProfile struct {
+	Files map[string]OverlayEventFileProfile `yaml:"files"`
+}
+
+// OverlayEvent is a single event record and the dialogue it triggers
+type OverlayEvent struct {
+	Index    int    `yaml:"index"`
+	Offset   int    `yaml:"offset"` // File offset of the record
+	Event    *int   `yaml:"event,omitempty"`
+	Flag     *int   `yaml:"flag,omitempty"`
+	Dialogue int    `yaml:"dialogue"`
+	Label    string `yaml:"label,omitempty"`
+	Text     string `yaml:"text,omitempty"` // Start of the dialogue text, for context only
+}
+
+// OverlayEventTable holds the records of an event table
+type OverlayEventTable struct {
+	Name    string         `yaml:"name"`
+	Entries []OverlayEvent `yaml:"entries"`
+}
+
+// OverlayEventsYAML is the event mapping document written by the dumper
+type OverlayEventsYAML struct {
+	File   string              `yaml:"file"`
+	WFM    string              `yaml:"wfm,omitempty"`
+	Tables []OverlayEventTable `yaml:"tables"`
+}
+
+// OverlayEventProcessor dumps and rebuilds the event tables of stage overlays
+type OverlayEventProcessor struct{}
+
+// NewOverlayEventProcessor creates a new overlay event processor instance
+func NewOverlayEventProcessor() *OverlayEventProcessor {
+	return &OverlayEventProcessor{}
+}
+
+// LoadOverlayEventProfile loads an overlay event profile from a YAML file
+func LoadOverlayEventProfile(profileFile string) (*OverlayEventProfile, error) {
+	data, err := os.ReadFile(profileFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event profile: %w", err)
+	}
+
+	var profile OverlayEventProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse event profile: %w", err))
+	}
+
+	return &profile, nil
+}
+
+// EventsFor returns the event tables configured for an overlay (matched by base name)
+func (p *OverlayEventProfile) EventsFor(ovlFile string) (*OverlayEventFileProfile, error) {
+	baseName := filepath.Base(ovlFile)
+	for name, fileProfile := range p.Files {
+		if strings.EqualFold(name, baseName) {
+			return &fileProfile, nil
+		}
+	}
+	return nil, fmt.Errorf("no event tables configured for %s", baseName)
+}
+
+// size returns the width in bytes of the field
+func (f OverlayEventField) size() (int, error) {
+	switch f.Type {
+	case "u8":
+		return 1, nil
+	case "", "u16":
+		return 2, nil
+	case "u32":
+		return 4, nil
+	default:
+		return 0, fmt.Errorf("unsupported field type %q (use u8, u16 or u32)", f.Type)
+	}
+}
+
+// read decodes the field of the record starting at offset
+func (f OverlayEventField) read(data []byte, offset int) int {
+	position := offset + f.At
+	switch size, _ := f.size(); size {
+	case 1:
+		return int(data[position])
+	case 2:
+		return int(binary.LittleEndian.Uint16(data[position:]))
+	default:
+		return int(binary.LittleEndian.Uint32(data[position:]))
+	}
+}
+
+// write encodes a value into the field of the record starting at offset
+func (f OverlayEventField) write(data []byte, offset, value int) error {
+	size, _ := f.size()
+	if value < 0 || uint64(value) >= 1<<(8*size) {
+		return fmt.Errorf("value %d does not fit a %d-byte field", value, size)
+	}
+
+	position := offset + f.At
+	switch size {
+	case 1:
+		data[position] = byte(value)
+	case 2:
+		binary.LittleEndian.PutUint16(data[position:], uint16(value))
+	default:
+		binary.LittleEndian.PutUint32(data[position:], uint32(value))
+	}
+	return nil
+}
+
+// fields returns the configured fields of a record by name
+func (d OverlayEventTableDefinition) fields() map[string]OverlayEventField {
+	fields := map[string]OverlayEventField{"dialogue": d.Dialogue}
+	if d.Event != nil {
+		fields["event"] = *d.Event
+	}
+	if d.Flag != nil {
+		fields["flag"] = *d.Flag
+	}
+	return fields
+}
+
+// locate validates the table definition against the overlay data and returns the offset of
+// its first record
+func (d OverlayEventTableDefinition) locate(data []byte) (int, error) {
+	if d.Stride <= 0 || d.Count <= 0 {
+		return 0, fmt.Errorf("table %s: stride and count must be positive", d.Name)
+	}
+	for name, field := range d.fields() {
+		size, err := field.size()
+		if err != nil {
+			return 0, fmt.Errorf("table %s field %s: %w", d.Name, name, err)
+		}
+		if field.At < 0 || field.At+size > d.Stride {
+			return 0, fmt.Errorf("table %s field %s: %d-byte field at %d is outside the %d-byte record", d.Name, name, size, field.At, d.Stride)
+		}
+	}
+
+	var start int
+	switch {
+	case d.Offset != nil && d.Pattern == "":
+		start = *d.Offset
+	case d.Offset == nil && d.Pattern != "":
+		values, mask, err := parseBytePattern(d.Pattern)
+		if err != nil {
+			return 0, fmt.Errorf("table %s: %w", d.Name, err)
+		}
+		matches := matchBytePattern(data, values, mask)
+		if len(matches) != 1 {
+			return 0, fmt.Errorf("table %s: pattern matched %d times, want exactly one match", d.Name, len(matches))
+		}
+		start = matches[0] + d.StartAt
+	default:
+		return 0, fmt.Errorf("table %s: exactly one of offset or pattern is required", d.Name)
+	}
+
+	end := start + d.Count*d.Stride
+	if start < 0 || end > len(data) {
+		return 0, fmt.Errorf("table %s: records 0x%X-0x%X are outside the overlay (0x%X bytes)", d.Name, start, end, len(data))
+	}
+	return start, nil
+}
+
+// ReadEvents decodes the records of an event table from overlay data
+func (p *OverlayEventProcessor) ReadEvents(data []byte, definition OverlayEventTableDefinition) (*OverlayEventTable, error) {
+	start, err := definition.locate(data)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	table := &OverlayEventTable{Name: definition.Name}
+	for index := 0; index < definition.Count; index++ {
+		offset := start + index*definition.Stride
+		event := OverlayEvent{
+			Index:    index,
+			Offset:   offset,
+			Dialogue: definition.Dialogue.read(data, offset),
+			Label:    definition.Labels[index],
+		}
+		if definition.Event != nil {
+			value := definition.Event.read(data, offset)
+			event.Event = &value
+		}
+		if definition.Flag != nil {
+			value := definition.Flag.read(data, offset)
+			event.Flag = &value
+		}
+		table.Entries = append(table.Entries, event)
+	}
+
+	common.LogDebug("Read event table %s: %d records at 0x%X", definition.Name, definition.Count, start)
+	return table, nil
+}
+
+// WriteEvents encodes the event IDs, flags and dialogue slots of a table into overlay data.
+// Offsets, labels and text of the entries are informational and ignored.
+func (p *OverlayEventProcessor) WriteEvents(data []byte, definition OverlayEventTableDefinition, table OverlayEventTable) error {
+	start, err := definition.locate(data)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	for _, event := range table.Entries {
+		if event.Index < 0 || event.Index >= definition.Count {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("table %s: record index %d out of range (count %d)", definition.Name, event.Index, definition.Count))
+		}
+
+		offset := start + event.Index*definition.Stride
+		values := []struct {
+			name  string
+			field *OverlayEventField
+			value *int
+		}{
+			{"dialogue", &definition.Dialogue, &event.Dialogue},
+			{"event", definition.Event, event.Event},
+			{"flag", definition.Flag, event.Flag},
+		}
+		for _, value := range values {
+			if value.field == nil || value.value == nil {
+				continue
+			}
+			if err := value.field.write(data, offset, *value.value); err != nil {
+				return common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("table %s record %d %s: %w", definition.Name, event.Index, value.name, err))
+			}
+		}
+	}
+
+	common.LogDebug("Wrote event table %s: %d records at 0x%X", definition.Name, len(table.Entries), start)
+	return nil
+}
+
+// Dump reads every configured event table of an overlay and writes them to a YAML file.
+// When dialoguesFile is set, each event is annotated with the start of its dialogue text.
+func (p *OverlayEventProcessor) Dump(ovlFile string, profile *OverlayEventProfile, dialoguesFile, outputFile string) error {
+	fileProfile, err := profile.EventsFor(ovlFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(ovlFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read overlay file: %w", err))
+	}
+
+	previews := make(map[int]string)
+	if dialoguesFile != "" {
+		dialogues, err := dialogueyaml.Read(dialoguesFile)
+		if err != nil {
+			return err
+		}
+		for _, dialogue := range dialogues.Dialogues {
+			previews[dialogue.ID] = dialoguePreview(dialogue)
+		}
+	}
+
+	document := OverlayEventsYAML{File: filepath.Base(ovlFile), WFM: fileProfile.WFM}
+	for _, definition := range fileProfile.Tables {
+		table, err := p.ReadEvents(data, definition)
+		if err != nil {
+			return err
+		}
+		for i := range table.Entries {
+			table.Entries[i].Text = previews[table.Entries[i].Dialogue]
+		}
+		document.Tables = append(document.Tables, *table)
+	}
+
+	yamlWriter, err := common.CreateOutput(outputFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create YAML file: %w", err))
+	}
+	defer yamlWriter.Close()
+
+	encoder := yaml.NewEncoder(yamlWriter)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode YAML: %w", err))
+	}
+
+	common.LogInfo("Dumped %d event tables from %s", len(document.Tables), ovlFile)
+	return nil
+}
+
+// Rebuild writes the event tables of a YAML file into a copy of an overlay
+func (p *OverlayEventProcessor) Rebuild(ovlFile string, profile *OverlayEventProfile, eventsFile, outputFile string) error {
+	fileProfile, err := profile.EventsFor(ovlFile)
+	if err != nil {
+		return err
+	}
+
+	yamlData, err := os.ReadFile(eventsFile)
+	if err != nil {
+		return common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+
+	var document OverlayEventsYAML
+	if err := yaml.Unmarshal(yamlData, &document); err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+
+	data, err := os.ReadFile(ovlFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read overlay file: %w", err))
+	}
+
+	definitionsByName := make(map[string]OverlayEventTableDefinition, len(fileProfile.Tables))
+	for _, definition := range fileProfile.Tables {
+		definitionsByName[definition.Name] = definition
+	}
+
+	for _, table := range document.Tables {
+		definition, found := definitionsByName[table.Name]
+		if !found {
+			return fmt.Errorf("event table %s is not configured for %s", table.Name, filepath.Base(ovlFile))
+		}
+		if err := p.WriteEvents(data, definition, table); err != nil {
+			return err
+		}
+	}
+
+	output, err := common.CreateAtomic(outputFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create overlay file: %w", err))
+	}
+	defer output.Abort()
+
+	if _, err := output.Write(data); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write overlay file: %w", err))
+	}
+	if err := output.Commit(); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to save overlay file: %w", err))
+	}
+
+	common.LogInfo("Rebuilt %d event tables into %s", len(document.Tables), outputFile)
+	return nil
+}
+
+// Check reads the event tables of an overlay and compares the dialogue slots they trigger
+// with the dialogues of a dialogues.yaml file. Returns one warning message per problem.
+func (p *OverlayEventProcessor) Check(ovlFile string, profile *OverlayEventProfile, dialoguesFile string) ([]string, error) {
+	fileProfile, err := profile.EventsFor(ovlFile)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(ovlFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read overlay file: %w", err))
+	}
+
+	dialogues, err := dialogueyaml.Read(dialoguesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var references []DialogueReference
+	for _, definition := range fileProfile.Tables {
+		table, err := p.ReadEvents(data, definition)
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range table.Entries {
+			name := fmt.Sprintf("%s[%d]", table.Name, event.Index)
+			if event.Label != "" {
+				name += " " + event.Label
+			}
+			references = append(references, DialogueReference{Name: name, Offset: event.Offset, Index: event.Dialogue})
+		}
+	}
+
+	return CheckDialogueReferences(references, dialogues.Dialogues, 0), nil
+}
+
+// dialoguePreview returns the start of the text of a dialogue with control tags removed
+func dialoguePreview(dialogue DialogueEntry) string {
+	text := []rune(glossaryText(dialogue))
+	if len(text) > overlayEventPreviewLength {
+		return string(text[:overlayEventPreviewLength]) + "…"
+	}
+	return string(text)
+}
@@ -0,0 +1,152 @@
+// Package pkg provides tests for the stage overlay event table dumper and rebuilder
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"gopkg.in/yaml.v3"
+)
+
+const testEventProfile = `
+files:
+  STAGE01.OVL:
+    wfm: CFNT01.WFM
+    tables:
+      - name: npc_talk
+        pattern: "45 56 54 ??"
+        start_at: 4
+        stride: 6
+        count: 3
+        event: {at: 0, type: u16}
+        flag: {at: 2, type: u8}
+        dialogue: {at: 4, type: u16}
+        labels:
+          1: Village elder
+`
+
+// writeTestOverlay writes an overlay holding three event records behind an "EVT" marker
+func writeTestOverlay(t *testing.T, path string) {
+	t.Helper()
+	data := make([]byte, 0x30)
+	copy(data[0x08:], "EVT\x01")
+	copy(data[0x0C:], []byte{
+		0x10, 0x00, 0x01, 0x00, 0x00, 0x00, // event 16, flag 1, dialogue 0
+		0x11, 0x00, 0x02, 0x00, 0x02, 0x00, // event 17, flag 2, dialogue 2
+		0x12, 0x00, 0x03, 0x00, 0x05, 0x00, // event 18, flag 3, dialogue 5
+	})
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write overlay: %v", err)
+	}
+}
+
+func TestOverlayEventProcessor_ReadWriteEvents(t *testing.T) {
+	var profile OverlayEventProfile
+	if err := yaml.Unmarshal([]byte(testEventProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+	fileProfile, err := profile.EventsFor("/some/dir/stage01.ovl")
+	if err != nil {
+		t.Fatalf("EventsFor() failed: %v", err)
+	}
+	definition := fileProfile.Tables[0]
+
+	path := filepath.Join(t.TempDir(), "STAGE01.OVL")
+	writeTestOverlay(t, path)
+	data, _ := os.ReadFile(path)
+
+	processor := NewOverlayEventProcessor()
+	table, err := processor.ReadEvents(data, definition)
+	if err != nil {
+		t.Fatalf("ReadEvents() failed: %v", err)
+	}
+	if len(table.Entries) != 3 {
+		t.Fatalf("ReadEvents() read %d records, want 3", len(table.Entries))
+	}
+	elder := table.Entries[1]
+	if elder.Offset != 0x12 || *elder.Event != 0x11 || *elder.Flag != 2 || elder.Dialogue != 2 || elder.Label != "Village elder" {
+		t.Errorf("record 1 = %+v, want offset 0x12, event 0x11, flag 2, dialogue 2, label Village elder", elder)
+	}
+
+	elder.Dialogue = 3
+	if err := processor.WriteEvents(data, definition, OverlayEventTable{Name: "npc_talk", Entries: []OverlayEvent{elder}}); err != nil {
+		t.Fatalf("WriteEvents() failed: %v", err)
+	}
+	if data[0x16] != 3 || data[0x10] != 0 {
+		t.Errorf("dialogue slots = %d, %d, want 3 for record 1 and record 0 untouched", data[0x16], data[0x10])
+	}
+
+	tooLarge := 0x100
+	elder.Flag = &tooLarge
+	if err := processor.WriteEvents(data, definition, OverlayEventTable{Entries: []OverlayEvent{elder}}); err == nil {
+		t.Error("WriteEvents() should fail for values larger than the field")
+	}
+
+	definition.Stride = 5
+	if _, err := processor.ReadEvents(data, definition); err == nil {
+		t.Error("ReadEvents() should fail for fields outside the record")
+	}
+}
+
+func TestOverlayEventProcessor_DumpRebuildCheck(t *testing.T) {
+	var profile OverlayEventProfile
+	if err := yaml.Unmarshal([]byte(testEventProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+
+	dir := t.TempDir()
+	ovlFile := filepath.Join(dir, "STAGE01.OVL")
+	writeTestOverlay(t, ovlFile)
+
+	dialoguesFile := filepath.Join(dir, "dialogues.yaml")
+	dialogues := &DialoguesYAML{}
+	for id := 0; id < 5; id++ {
+		text := "Dialogue " + string(rune('A'+id)) + "[NEWLINE]continues"
+		dialogues.Dialogues = append(dialogues.Dialogues, DialogueEntry{ID: id, Content: []map[string]interface{}{{"text": text}}})
+	}
+	if err := dialogueyaml.Write(dialoguesFile, dialogues); err != nil {
+		t.Fatalf("failed to write dialogues: %v", err)
+	}
+
+	processor := NewOverlayEventProcessor()
+	eventsFile := filepath.Join(dir, "events.yaml")
+	if err := processor.Dump(ovlFile, &profile, dialoguesFile, eventsFile); err != nil {
+		t.Fatalf("Dump() failed: %v", err)
+	}
+	dumped, _ := os.ReadFile(eventsFile)
+	if !strings.Contains(string(dumped), "text: Dialogue C continues") || !strings.Contains(string(dumped), "wfm: CFNT01.WFM") {
+		t.Errorf("dumped events lack the dialogue context:\n%s", dumped)
+	}
+
+	// Dialogue slot 5 does not exist
+	warnings, err := processor.Check(ovlFile, &profile, dialoguesFile)
+	if err != nil {
+		t.Fatalf("Check() failed: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "npc_talk[2]") {
+		t.Errorf("Check() = %v, want one warning for npc_talk[2]", warnings)
+	}
+
+	edited := strings.Replace(string(dumped), "dialogue: 5", "dialogue: 4", 1)
+	if err := os.WriteFile(eventsFile, []byte(edited), 0644); err != nil {
+		t.Fatalf("failed to write events file: %v", err)
+	}
+	outputFile := filepath.Join(dir, "out", "STAGE01.OVL")
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		t.Fatalf("failed to create output dir: %v", err)
+	}
+	if err := processor.Rebuild(ovlFile, &profile, eventsFile, outputFile); err != nil {
+		t.Fatalf("Rebuild() failed: %v", err)
+	}
+
+	warnings, err = processor.Check(outputFile, &profile, dialoguesFile)
+	if err != nil {
+		t.Fatalf("Check(rebuilt) failed: %v", err)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("Check(rebuilt) = %v, want no warnings", warnings)
+	}
+}
@@ -0,0 +1,50 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the DOUBLE_NEWLINE (0xFFFB) modes. Some scripts use the code as a page
+// break that clears the text box rather than as a blank line, so it can be decoded as an
+// explicit [PAGE] tag instead of an empty line.
+package pkg
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// PageBreakTag is the text form of DOUBLE_NEWLINE in page mode
+const PageBreakTag = "[PAGE]"
+
+// DOUBLE_NEWLINE modes
+const (
+	DoubleNewlineAsNewline = "newline" // Decoded as a blank line ("\n\n"), the default
+	DoubleNewlineAsPage    = "page"    // Decoded as [PAGE]; "\n\n" encodes as two NEWLINE codes
+)
+
+// ValidateDoubleNewlineMode checks a DOUBLE_NEWLINE mode; an empty mode selects the default
+func ValidateDoubleNewlineMode(mode string) error {
+	switch mode {
+	case "", DoubleNewlineAsNewline, DoubleNewlineAsPage:
+		return nil
+	default:
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid double newline mode %q (want %s or %s)", mode, DoubleNewlineAsNewline, DoubleNewlineAsPage))
+	}
+}
+
+// SetDoubleNewlineMode selects how ExportDialogues writes DOUBLE_NEWLINE codes
+func (e *WFMFileExporter) SetDoubleNewlineMode(mode string) error {
+	if err := ValidateDoubleNewlineMode(mode); err != nil {
+		return err
+	}
+	e.pageBreaks = mode == DoubleNewlineAsPage
+	return nil
+}
+
+// SetDoubleNewlineMode selects how "\n\n" is encoded. An empty mode uses the
+// double_newline mode recorded in the YAML file by decode.
+func (e *WFMFileEncoder) SetDoubleNewlineMode(mode string) error {
+	if err := ValidateDoubleNewlineMode(mode); err != nil {
+		return err
+	}
+	e.doubleNewline = mode
+	return nil
+}
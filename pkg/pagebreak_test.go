@@ -0,0 +1,91 @@
+// Package pkg provides tests for the DOUBLE_NEWLINE page break mode
+package pkg
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+func TestProcessDialogueText_PageBreaks(t *testing.T) {
+	data := []byte{0x00, 0x80, 0xFB, 0xFF, 0x01, 0x80, 0xFD, 0xFF, 0x00, 0x80, 0xFF, 0xFF}
+	tests := []struct {
+		pageBreaks bool
+		want       string
+	}{
+		{false, "[8000]\n\n[8001]\n[8000]"},
+		{true, "[8000][PAGE][8001]\n[8000]"},
+	}
+
+	for _, tt := range tests {
+		content, _, _, _, _ := processDialogueText(data, nil, nil, tt.pageBreaks)
+		if len(content) != 1 || content[0]["text"] != tt.want {
+			t.Errorf("processDialogueText(pageBreaks=%v) = %v, want text %q", tt.pageBreaks, content, tt.want)
+		}
+	}
+}
+
+func TestWFMFileEncoder_PageBreaks(t *testing.T) {
+	glyphEncodeMap := map[int]map[rune]uint16{16: {'A': 0x8000, 'B': 0x8001}}
+	tests := []struct {
+		pageBreaks bool
+		text       string
+		want       []uint16
+	}{
+		{false, "A\n\nB\nA", []uint16{0x8000, DOUBLE_NEWLINE, 0x8001, NEWLINE, 0x8000}},
+		{false, "A[PAGE]B", []uint16{0x8000, DOUBLE_NEWLINE, 0x8001}},
+		{true, "A[PAGE]B\n\nA", []uint16{0x8000, DOUBLE_NEWLINE, 0x8001, NEWLINE, NEWLINE, 0x8000}},
+	}
+
+	for _, tt := range tests {
+		encoder := NewWFMEncoder()
+		encoder.pageBreaks = tt.pageBreaks
+		got, _, err := encoder.processTextContent(tt.text, 16, glyphEncodeMap, 0)
+		if err != nil {
+			t.Fatalf("processTextContent(%q) failed: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("processTextContent(%q, pageBreaks=%v) = %04X, want %04X", tt.text, tt.pageBreaks, got, tt.want)
+		}
+	}
+}
+
+func TestWFMFileEncoder_DoubleNewlineMode(t *testing.T) {
+	yamlFile := filepath.Join(t.TempDir(), "dialogues.yaml")
+	file := &DialoguesYAML{
+		TotalDialogues: 1,
+		DoubleNewline:  DoubleNewlineAsPage,
+		Dialogues:      []DialogueEntry{textDialogue(0, "A[PAGE]B")},
+	}
+	if err := dialogueyaml.Write(yamlFile, file); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	tests := []struct {
+		mode string
+		want bool
+	}{
+		{"", true}, // Mode recorded by decode
+		{DoubleNewlineAsNewline, false},
+		{DoubleNewlineAsPage, true},
+	}
+	for _, tt := range tests {
+		encoder := NewWFMEncoder()
+		if err := encoder.SetDoubleNewlineMode(tt.mode); err != nil {
+			t.Fatalf("SetDoubleNewlineMode(%q) failed: %v", tt.mode, err)
+		}
+		if _, _, err := encoder.LoadDialogues(yamlFile); err != nil {
+			t.Fatalf("LoadDialogues() failed: %v", err)
+		}
+		if encoder.pageBreaks != tt.want {
+			t.Errorf("mode %q: pageBreaks = %v, want %v", tt.mode, encoder.pageBreaks, tt.want)
+		}
+	}
+
+	if err := NewWFMEncoder().SetDoubleNewlineMode("box"); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("SetDoubleNewlineMode(box) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitValidationFailed)
+	}
+}
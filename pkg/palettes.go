@@ -0,0 +1,309 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains palette discovery: the CLUTs referenced by the GlyphClut values of a
+// WFM file are read from a VRAM dump or the executable and stored in the project palette
+// file, which export and encode use instead of the built-in DialogueClut/EventClut.
+package pkg
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPaletteFile is the project palette file written next to dialogues.yaml
+const DefaultPaletteFile = "palettes.yaml"
+
+// PaletteEntry is a 16-color CLUT identified by the GlyphClut value that references it
+type PaletteEntry struct {
+	Clut   uint16   `yaml:"clut"`
+	Source string   `yaml:"source"`
+	Colors []uint16 `yaml:"colors,flow"`
+}
+
+// PaletteSet is the content of a project palette file
+type PaletteSet struct {
+	Palettes []PaletteEntry `yaml:"palettes"`
+}
+
+// PaletteSources holds the data palettes are discovered from
+type PaletteSources struct {
+	VRAM       []byte           // Raw 1024x512 16-bit VRAM dump (nil if not available)
+	VRAMName   string           // Name recorded as the source of VRAM palettes
+	EXE        []byte           // Executable image (nil if not available)
+	EXEName    string           // Name recorded as the source of executable palettes
+	EXEOffsets map[uint16]int64 // File offset of the CLUT for each GlyphClut value in the executable
+}
+
+// Lookup returns the colors stored for a GlyphClut value
+func (s *PaletteSet) Lookup(clut uint16) ([psx.MaxPaletteSize4bpp]uint16, bool) {
+	var colors [psx.MaxPaletteSize4bpp]uint16
+	if s == nil {
+		return colors, false
+	}
+	for _, entry := range s.Palettes {
+		if entry.Clut == clut && len(entry.Colors) == psx.MaxPaletteSize4bpp {
+			copy(colors[:], entry.Colors)
+			return colors, true
+		}
+	}
+	return colors, false
+}
+
+// Set stores the colors of a GlyphClut value, replacing any previous entry
+func (s *PaletteSet) Set(clut uint16, colors [psx.MaxPaletteSize4bpp]uint16, source string) {
+	entry := PaletteEntry{Clut: clut, Source: source, Colors: colors[:]}
+	for i := range s.Palettes {
+		if s.Palettes[i].Clut == clut {
+			s.Palettes[i] = entry
+			return
+		}
+	}
+	s.Palettes = append(s.Palettes, entry)
+	sort.Slice(s.Palettes, func(i, j int) bool { return s.Palettes[i].Clut < s.Palettes[j].Clut })
+}
+
+// LoadPaletteSet reads a project palette file
+func LoadPaletteSet(path string) (*PaletteSet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("palette file %s not found", path))
+		}
+		return nil, fmt.Errorf("failed to read palette file: %w", err)
+	}
+
+	var set PaletteSet
+	if err := yaml.Unmarshal(data, &set); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse palette file: %w", err))
+	}
+	for _, entry := range set.Palettes {
+		if len(entry.Colors) != psx.MaxPaletteSize4bpp {
+			return nil, common.WithCategory(common.ErrCategoryFormat,
+				fmt.Errorf("palette 0x%04X has %d colors, want %d", entry.Clut, len(entry.Colors), psx.MaxPaletteSize4bpp))
+		}
+	}
+	return &set, nil
+}
+
+// LoadProjectPalettes loads the palette file of a project directory, returning nil
+// when the project has none so the built-in palettes are used
+func LoadProjectPalettes(projectDir string) (*PaletteSet, error) {
+	path := filepath.Join(projectDir, DefaultPaletteFile)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil, nil
+	}
+	return LoadPaletteSet(path)
+}
+
+// SavePaletteSet writes a project palette file
+func SavePaletteSet(path string, set *PaletteSet) error {
+	data, err := yaml.Marshal(set)
+	if err != nil {
+		return fmt.Errorf("failed to encode palettes: %w", err)
+	}
+	if err := common.WriteOutput(path, data, 0644); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write palette file: %w", err))
+	}
+	return nil
+}
+
+// ParseEXEPaletteOffsets parses CLUT=OFFSET pairs (e.g. 0x7F3C=0x1A2B0) naming where the
+// CLUT referenced by a GlyphClut value is stored in the executable
+func ParseEXEPaletteOffsets(specs []string) (map[uint16]int64, error) {
+	offsets := make(map[uint16]int64)
+	for _, spec := range specs {
+		clutText, offsetText, found := strings.Cut(spec, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid executable palette %q: want CLUT=OFFSET", spec)
+		}
+		clut, err := strconv.ParseUint(strings.TrimSpace(clutText), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLUT value in %q: %w", spec, err)
+		}
+		offset, err := strconv.ParseInt(strings.TrimSpace(offsetText), 0, 64)
+		if err != nil || offset < 0 {
+			return nil, fmt.Errorf("invalid executable offset in %q", spec)
+		}
+		offsets[uint16(clut)] = offset
+	}
+	return offsets, nil
+}
+
+// GlyphCluts returns the distinct GlyphClut values referenced by the glyphs, in ascending order
+func GlyphCluts(glyphs []Glyph) []uint16 {
+	seen := make(map[uint16]bool)
+	var cluts []uint16
+	for _, glyph := range glyphs {
+		if glyph.ImageSize() == 0 || seen[glyph.GlyphClut] {
+			continue
+		}
+		seen[glyph.GlyphClut] = true
+		cluts = append(cluts, glyph.GlyphClut)
+	}
+	sort.Slice(cluts, func(i, j int) bool { return cluts[i] < cluts[j] })
+	return cluts
+}
+
+// DiscoverPalettes reads the CLUT of every GlyphClut value from the sources into set.
+// Executable offsets take precedence over the VRAM dump. The values no source could
+// provide are returned as missing.
+func DiscoverPalettes(set *PaletteSet, cluts []uint16, sources PaletteSources) (missing []uint16, err error) {
+	for _, clut := range cluts {
+		if offset, ok := sources.EXEOffsets[clut]; ok {
+			if sources.EXE == nil {
+				return nil, fmt.Errorf("CLUT 0x%04X has an executable offset but no executable was given", clut)
+			}
+			if offset+psx.MaxPaletteSize4bpp*2 > int64(len(sources.EXE)) {
+				return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("CLUT 0x%04X offset 0x%X runs past the end of the executable", clut, offset))
+			}
+			var colors [psx.MaxPaletteSize4bpp]uint16
+			for i := range colors {
+				colors[i] = binary.LittleEndian.Uint16(sources.EXE[offset+int64(i*2):])
+			}
+			set.Set(clut, colors, fmt.Sprintf("%s@0x%X", sources.EXEName, offset))
+			common.LogDebug("CLUT 0x%04X read from %s at 0x%X", clut, sources.EXEName, offset)
+			continue
+		}
+
+		if sources.VRAM != nil {
+			colors, err := psx.ReadVRAMClut(sources.VRAM, clut)
+			if err != nil {
+				return nil, err
+			}
+			x, y := psx.ClutPosition(clut)
+			set.Set(clut, colors, fmt.Sprintf("%s@%d,%d", sources.VRAMName, x, y))
+			common.LogDebug("CLUT 0x%04X read from %s at (%d, %d)", clut, sources.VRAMName, x, y)
+			continue
+		}
+
+		missing = append(missing, clut)
+	}
+	return missing, nil
+}
+
+// DiscoverPalettes decodes a WFM file and stores the CLUTs referenced by its glyphs in
+// the palette file at paletteFile, keeping the entries already stored for other values
+func (p *WFMFileProcessor) DiscoverPalettes(inputFile, paletteFile string, sources PaletteSources) (*PaletteSet, []uint16, error) {
+	file, err := os.Open(inputFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open input file: %w", err)
+	}
+	defer file.Close()
+
+	wfm, err := p.Decode(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to decode WFM file: %w", err)
+	}
+
+	set := &PaletteSet{}
+	if _, err := os.Stat(paletteFile); err == nil {
+		if set, err = LoadPaletteSet(paletteFile); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	missing, err := DiscoverPalettes(set, GlyphCluts(wfm.Glyphs), sources)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := SavePaletteSet(paletteFile, set); err != nil {
+		return nil, nil, err
+	}
+	return set, missing, nil
+}
+
+// Palettes a dialogue can be drawn with, as recorded in the palette field of decoded dialogues
+const (
+	PaletteProject  = "project"  // Project palette stored in palettes.yaml for the GlyphClut value
+	PaletteDialogue = "dialogue" // Built-in DialogueClut
+	PaletteEvent    = "event"    // Built-in EventClut
+)
+
+// glyphPaletteName names the palette glyphPalette picks for a GlyphClut value
+func glyphPaletteName(set *PaletteSet, clut uint16, height int) string {
+	if _, ok := set.Lookup(clut); ok {
+		return PaletteProject
+	}
+	if height == 24 {
+		return PaletteEvent
+	}
+	return PaletteDialogue
+}
+
+// SetFontCluts sets the GlyphClut values the game has a palette for, with the name of
+// that palette (nil leaves the check to the project palettes)
+func (e *WFMFileEncoder) SetFontCluts(cluts map[uint16]string) {
+	e.fontCluts = cluts
+}
+
+// checkFontCluts makes sure the font_clut of every dialogue drawing text references a
+// palette the game has: one stored in the project palette file or listed by the game
+// profile. A glyph with another CLUT is drawn with whatever VRAM holds there, usually
+// black boxes. The check is skipped when neither lists any CLUT.
+func (e *WFMFileEncoder) checkFontCluts(dialogues []DialogueEntry) error {
+	known := make(map[uint16]bool)
+	for clut := range e.fontCluts {
+		known[clut] = true
+	}
+	if e.palettes != nil {
+		for _, entry := range e.palettes.Palettes {
+			known[entry.Clut] = true
+		}
+	}
+	if len(known) == 0 {
+		e.logger.Debug("No project palettes or profile font_cluts, font_clut values not checked")
+		return nil
+	}
+
+	unknown := make(map[uint16][]string)
+	for _, dialogue := range dialogues {
+		if known[dialogue.FontClut] || strings.TrimSpace(e.cleanTextForGlyphMapping(strings.Join(dialogueTexts(dialogue), ""))) == "" {
+			continue
+		}
+		unknown[dialogue.FontClut] = append(unknown[dialogue.FontClut], strconv.Itoa(dialogue.ID))
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	cluts := make([]uint16, 0, len(unknown))
+	for clut := range unknown {
+		cluts = append(cluts, clut)
+	}
+	sort.Slice(cluts, func(i, j int) bool { return cluts[i] < cluts[j] })
+	problems := make([]string, 0, len(cluts))
+	for _, clut := range cluts {
+		problems = append(problems, fmt.Sprintf("font_clut 0x%04X (dialogues %s)", clut, strings.Join(unknown[clut], ", ")))
+	}
+	knownList := make([]string, 0, len(known))
+	for clut := range known {
+		knownList = append(knownList, fmt.Sprintf("0x%04X", clut))
+	}
+	sort.Strings(knownList)
+	return common.WithCategory(common.ErrCategoryValidationFailed,
+		fmt.Errorf("%s: no palette is known for these CLUTs, so the game would draw the glyphs with a missing palette; "+
+			"use one of %s, or add the palette to %s (wfm palettes) or to the profile font_cluts",
+			strings.Join(problems, "; "), strings.Join(knownList, ", "), DefaultPaletteFile))
+}
+
+// glyphPalette returns the palette for a GlyphClut value: the project palette when one
+// is stored, otherwise EventClut for 24-pixel glyphs and DialogueClut for the rest
+func glyphPalette(set *PaletteSet, clut uint16, height int) psx.PSXPalette {
+	if colors, ok := set.Lookup(clut); ok {
+		return psx.NewPSXPalette(colors)
+	}
+	if height == 24 {
+		return psx.NewPSXPalette(EventClut)
+	}
+	return psx.NewPSXPalette(DialogueClut)
+}
@@ -0,0 +1,158 @@
+// Package pkg provides tests for palette discovery and project palette files
+package pkg
+
+import (
+	"encoding/binary"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+func TestDiscoverPalettes(t *testing.T) {
+	vram := make([]byte, psx.VRAM_SIZE)
+	vramOffset := (508*psx.VRAM_WIDTH + 960) * 2
+	binary.LittleEndian.PutUint16(vram[vramOffset+2:], 0x7FFF)
+
+	exe := make([]byte, 0x100)
+	binary.LittleEndian.PutUint16(exe[0x42:], 0x001F)
+
+	sources := PaletteSources{
+		VRAM:       vram,
+		VRAMName:   "vram.bin",
+		EXE:        exe,
+		EXEName:    "SLUS_006.23",
+		EXEOffsets: map[uint16]int64{0x7F00: 0x40},
+	}
+
+	set := &PaletteSet{}
+	missing, err := DiscoverPalettes(set, []uint16{0x7F00, 0x7F3C}, sources)
+	if err != nil {
+		t.Fatalf("DiscoverPalettes() failed: %v", err)
+	}
+	if len(missing) != 0 {
+		t.Errorf("missing = %v, want none", missing)
+	}
+
+	if colors, ok := set.Lookup(0x7F00); !ok || colors[1] != 0x001F {
+		t.Errorf("Lookup(0x7F00) = %04X, %v, want color 1 = 001F from the executable", colors, ok)
+	}
+	if colors, ok := set.Lookup(0x7F3C); !ok || colors[1] != 0x7FFF {
+		t.Errorf("Lookup(0x7F3C) = %04X, %v, want color 1 = 7FFF from VRAM", colors, ok)
+	}
+
+	// Without a VRAM dump, values without an executable offset are missing
+	missing, err = DiscoverPalettes(&PaletteSet{}, []uint16{0x7F00, 0x7F3C}, PaletteSources{EXE: exe, EXEOffsets: sources.EXEOffsets})
+	if err != nil {
+		t.Fatalf("DiscoverPalettes() failed: %v", err)
+	}
+	if len(missing) != 1 || missing[0] != 0x7F3C {
+		t.Errorf("missing = %v, want [0x7F3C]", missing)
+	}
+
+	// Offsets past the end of the executable are rejected
+	if _, err := DiscoverPalettes(&PaletteSet{}, []uint16{0x7F00}, PaletteSources{EXE: exe[:0x48], EXEOffsets: sources.EXEOffsets}); err == nil {
+		t.Error("DiscoverPalettes() accepted an offset past the end of the executable")
+	}
+}
+
+func TestPaletteSet_SaveLoad(t *testing.T) {
+	var colors [psx.MaxPaletteSize4bpp]uint16
+	colors[3] = 0x1234
+
+	set := &PaletteSet{}
+	set.Set(0x7F3C, colors, "vram.bin@960,508")
+	set.Set(0x7F00, colors, "SLUS_006.23@0x40")
+
+	dir := t.TempDir()
+	if err := SavePaletteSet(filepath.Join(dir, DefaultPaletteFile), set); err != nil {
+		t.Fatalf("SavePaletteSet() failed: %v", err)
+	}
+
+	loaded, err := LoadProjectPalettes(dir)
+	if err != nil {
+		t.Fatalf("LoadProjectPalettes() failed: %v", err)
+	}
+	if len(loaded.Palettes) != 2 || loaded.Palettes[0].Clut != 0x7F00 {
+		t.Fatalf("loaded palettes = %+v, want 2 sorted by CLUT", loaded.Palettes)
+	}
+	if got, _ := loaded.Lookup(0x7F3C); got[3] != 0x1234 {
+		t.Errorf("Lookup(0x7F3C)[3] = %04X, want 1234", got[3])
+	}
+
+	none, err := LoadProjectPalettes(t.TempDir())
+	if err != nil || none != nil {
+		t.Errorf("LoadProjectPalettes() without a file = %v, %v, want nil, nil", none, err)
+	}
+}
+
+func TestGlyphPalette_Fallback(t *testing.T) {
+	if got := glyphPalette(nil, 0x7F3C, 24); got != psx.NewPSXPalette(EventClut) {
+		t.Error("glyphPalette() for height 24 without project palettes is not EventClut")
+	}
+	if got := glyphPalette(&PaletteSet{}, 0x7F3C, 16); got != psx.NewPSXPalette(DialogueClut) {
+		t.Error("glyphPalette() for an unknown CLUT is not DialogueClut")
+	}
+}
+
+func TestGlyphPaletteName(t *testing.T) {
+	set := &PaletteSet{}
+	set.Set(0x7F00, [psx.MaxPaletteSize4bpp]uint16{}, "vram.bin")
+	tests := []struct {
+		clut   uint16
+		height int
+		want   string
+	}{
+		{0x7F00, 24, PaletteProject},
+		{0x7F3C, 24, PaletteEvent},
+		{0x7F3C, 16, PaletteDialogue},
+	}
+	for _, tt := range tests {
+		if got := glyphPaletteName(set, tt.clut, tt.height); got != tt.want {
+			t.Errorf("glyphPaletteName(0x%04X, %d) = %q, want %q", tt.clut, tt.height, got, tt.want)
+		}
+	}
+}
+
+func TestWFMFileEncoder_CheckFontCluts(t *testing.T) {
+	dialogues := []DialogueEntry{
+		{ID: 0, FontClut: 0x7F00, Content: []map[string]interface{}{{"text": "Hi"}}},
+		{ID: 1, FontClut: 0x7F3C, Content: []map[string]interface{}{{"text": "Yo"}}},
+		{ID: 2, FontClut: 0x1234, Content: []map[string]interface{}{{"text": "Oh"}}},
+		{ID: 3, FontClut: 0, Content: []map[string]interface{}{{"box": map[string]interface{}{"width": 1}}}}, // Draws no glyphs
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.checkFontCluts(dialogues); err != nil {
+		t.Errorf("checkFontCluts() without known CLUTs = %v, want the check skipped", err)
+	}
+
+	encoder.palettes = &PaletteSet{}
+	encoder.palettes.Set(0x7F00, [psx.MaxPaletteSize4bpp]uint16{}, "vram.bin")
+	encoder.SetFontCluts(map[uint16]string{0x7F3C: "event"})
+	err := encoder.checkFontCluts(dialogues)
+	if common.ExitCodeFor(err) != common.ExitValidationFailed || !strings.Contains(err.Error(), "font_clut 0x1234 (dialogues 2)") {
+		t.Errorf("checkFontCluts() = %v, want a validation error for dialogue 2 only", err)
+	}
+	if err != nil && strings.Contains(err.Error(), "0x0000 (") {
+		t.Errorf("checkFontCluts() reported the dialogue without glyphs: %v", err)
+	}
+}
+
+func TestParseEXEPaletteOffsets(t *testing.T) {
+	offsets, err := ParseEXEPaletteOffsets([]string{"0x7F3C=0x1A2B0", "32512 = 64"})
+	if err != nil {
+		t.Fatalf("ParseEXEPaletteOffsets() failed: %v", err)
+	}
+	if offsets[0x7F3C] != 0x1A2B0 || offsets[0x7F00] != 64 {
+		t.Errorf("offsets = %v", offsets)
+	}
+
+	for _, spec := range []string{"0x7F3C", "0x10000=0", "0x7F3C=-1"} {
+		if _, err := ParseEXEPaletteOffsets([]string{spec}); err == nil {
+			t.Errorf("ParseEXEPaletteOffsets(%q) succeeded, want error", spec)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the pause analyzer that reports [PAUSE FOR] durations and prompts
+// across a dialogue YAML export and can scale or cap pause values globally.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// DefaultPauseOutlierFactor flags pauses longer or shorter than the median by this factor
+const DefaultPauseOutlierFactor = 3.0
+
+// promptTags lists the text tags that wait for player input
+var promptTags = []string{"[PROMPT]", "[WAIT FOR INPUT]"}
+
+// PauseOccurrence locates a single [PAUSE FOR] command in a dialogue
+type PauseOccurrence struct {
+	DialogueID int `json:"dialogue_id"`
+	ItemIndex  int `json:"item_index"`
+	Duration   int `json:"duration"`
+}
+
+// InvalidPause locates a [PAUSE FOR] command whose duration the encoder rejects
+type InvalidPause struct {
+	DialogueID int    `json:"dialogue_id"`
+	ItemIndex  int    `json:"item_index"`
+	Value      string `json:"value"`
+	Error      string `json:"error"`
+}
+
+// PauseReport summarizes pause durations and prompts across a dialogue file
+type PauseReport struct {
+	TotalDialogues  int               `json:"total_dialogues"`
+	TotalPauses     int               `json:"total_pauses"`
+	TotalPrompts    int               `json:"total_prompts"`
+	MinDuration     int               `json:"min_duration"`
+	MaxDuration     int               `json:"max_duration"`
+	MeanDuration    float64           `json:"mean_duration"`
+	MedianDuration  int               `json:"median_duration"`
+	DurationCounts  map[int]int       `json:"duration_counts"`
+	Outliers        []PauseOccurrence `json:"outliers"`
+	PromptDialogues map[int]int       `json:"prompt_dialogues,omitempty"`
+	Invalid         []InvalidPause    `json:"invalid,omitempty"`
+}
+
+// PauseNormalizeOptions controls how pause durations are rewritten
+type PauseNormalizeOptions struct {
+	Scale       float64 // Multiplier applied to every duration (1.0 keeps values)
+	MaxDuration int     // Upper bound applied after scaling (0 disables)
+}
+
+// PauseAnalyzer scans and rewrites [PAUSE FOR] commands in dialogue entries
+type PauseAnalyzer struct {
+	OutlierFactor float64 // Ratio to the median beyond which a pause is reported as an outlier
+}
+
+// NewPauseAnalyzer creates a new pause analyzer instance
+func NewPauseAnalyzer() *PauseAnalyzer {
+	return &PauseAnalyzer{OutlierFactor: DefaultPauseOutlierFactor}
+}
+
+// pauseDuration returns the duration of a pause content item, if the item is one.
+// The duration is parsed like the encoder does, so every YAML numeric form it accepts
+// is read; a value the encoder rejects is returned as an error.
+func pauseDuration(contentItem map[string]interface{}) (pauseMap map[string]interface{}, duration int, ok bool, err error) {
+	pauseValue, exists := contentItem["pause"]
+	if !exists {
+		return nil, 0, false, nil
+	}
+
+	pauseMap, isMap := pauseValue.(map[string]interface{})
+	if !isMap {
+		return nil, 0, false, nil
+	}
+
+	value, err := common.SafeValueToUint16(pauseMap["duration"])
+	if err != nil {
+		return pauseMap, 0, true, err
+	}
+
+	return pauseMap, int(value), true, nil
+}
+
+// collectPauses returns every pause command found in the dialogues and the ones whose
+// duration is not valid
+func (a *PauseAnalyzer) collectPauses(dialogues []DialogueEntry) ([]PauseOccurrence, []InvalidPause) {
+	var pauses []PauseOccurrence
+	var invalid []InvalidPause
+	for _, dialogue := range dialogues {
+		for itemIndex, contentItem := range dialogue.Content {
+			pauseMap, duration, ok, err := pauseDuration(contentItem)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				invalid = append(invalid, InvalidPause{
+					DialogueID: dialogue.ID,
+					ItemIndex:  itemIndex,
+					Value:      fmt.Sprint(pauseMap["duration"]),
+					Error:      err.Error(),
+				})
+				continue
+			}
+			pauses = append(pauses, PauseOccurrence{
+				DialogueID: dialogue.ID,
+				ItemIndex:  itemIndex,
+				Duration:   duration,
+			})
+		}
+	}
+	return pauses, invalid
+}
+
+// countPrompts counts the input prompt tags in a dialogue's text items
+func countPrompts(dialogue DialogueEntry) int {
+	prompts := 0
+	for _, text := range dialogueTexts(dialogue) {
+		for _, tag := range promptTags {
+			prompts += strings.Count(text, tag)
+		}
+	}
+	return prompts
+}
+
+// Analyze computes pause statistics and outliers for the dialogues
+func (a *PauseAnalyzer) Analyze(dialogues []DialogueEntry) *PauseReport {
+	report := &PauseReport{
+		TotalDialogues:  len(dialogues),
+		DurationCounts:  make(map[int]int),
+		PromptDialogues: make(map[int]int),
+		Outliers:        []PauseOccurrence{},
+	}
+
+	for _, dialogue := range dialogues {
+		if prompts := countPrompts(dialogue); prompts > 0 {
+			report.PromptDialogues[dialogue.ID] = prompts
+			report.TotalPrompts += prompts
+		}
+	}
+
+	pauses, invalid := a.collectPauses(dialogues)
+	report.Invalid = invalid
+	report.TotalPauses = len(pauses)
+	if len(pauses) == 0 {
+		return report
+	}
+
+	durations := make([]int, 0, len(pauses))
+	total := 0
+	for _, pause := range pauses {
+		durations = append(durations, pause.Duration)
+		report.DurationCounts[pause.Duration]++
+		total += pause.Duration
+	}
+	sort.Ints(durations)
+
+	report.MinDuration = durations[0]
+	report.MaxDuration = durations[len(durations)-1]
+	report.MeanDuration = float64(total) / float64(len(durations))
+	report.MedianDuration = durations[len(durations)/2]
+
+	for _, pause := range pauses {
+		if a.isOutlier(pause.Duration, report.MedianDuration) {
+			report.Outliers = append(report.Outliers, pause)
+		}
+	}
+
+	common.LogDebug("Found %d pauses (%d outliers) and %d prompts", report.TotalPauses, len(report.Outliers), report.TotalPrompts)
+	return report
+}
+
+// AnalyzeFile loads a dialogue YAML file and computes its pause report
+func (a *PauseAnalyzer) AnalyzeFile(yamlFile string) (*PauseReport, error) {
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load dialogues: %w", err)
+	}
+	return a.Analyze(dialogues.Dialogues), nil
+}
+
+// isOutlier reports whether a duration deviates from the median by more than the outlier factor
+func (a *PauseAnalyzer) isOutlier(duration, median int) bool {
+	if a.OutlierFactor <= 0 || median == 0 {
+		return false
+	}
+	ratio := float64(duration) / float64(median)
+	return ratio > a.OutlierFactor || ratio < 1/a.OutlierFactor
+}
+
+// Normalize rewrites pause durations in place according to the options.
+// Only the duration argument of pause items is changed, so text and other
+// control codes are preserved. Non-zero pauses never drop below 1.
+// Returns the number of pauses whose duration changed.
+func (a *PauseAnalyzer) Normalize(dialogues []DialogueEntry, options PauseNormalizeOptions) (int, error) {
+	if options.Scale <= 0 {
+		return 0, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid pause scale %g: must be greater than zero", options.Scale))
+	}
+	if options.MaxDuration < 0 {
+		return 0, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("invalid pause cap %d: must not be negative", options.MaxDuration))
+	}
+
+	changed := 0
+	for _, dialogue := range dialogues {
+		for _, contentItem := range dialogue.Content {
+			pauseMap, duration, ok, err := pauseDuration(contentItem)
+			if !ok {
+				continue
+			}
+			if err != nil {
+				return changed, common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("pause in dialogue %d has an invalid duration: %w", dialogue.ID, err))
+			}
+
+			newDuration := int(math.Round(float64(duration) * options.Scale))
+			if options.MaxDuration > 0 && newDuration > options.MaxDuration {
+				newDuration = options.MaxDuration
+			}
+			if duration > 0 && newDuration < 1 {
+				newDuration = 1
+			}
+			if _, err := common.SafeIntToUint16(newDuration); err != nil {
+				return changed, common.WithCategory(common.ErrCategoryValidationFailed,
+					fmt.Errorf("pause in dialogue %d scales out of range (%d): %w", dialogue.ID, newDuration, err))
+			}
+
+			if newDuration != duration {
+				pauseMap["duration"] = newDuration
+				changed++
+				common.LogDebug("Dialogue %d: pause %d -> %d", dialogue.ID, duration, newDuration)
+			}
+		}
+	}
+
+	return changed, nil
+}
+
+// NormalizeFile loads a dialogue YAML file, rewrites its pauses and saves the result
+func (a *PauseAnalyzer) NormalizeFile(inputFile, outputFile string, options PauseNormalizeOptions) (int, error) {
+	dialogues, err := dialogueyaml.Read(inputFile)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load dialogues: %w", err)
+	}
+
+	changed, err := a.Normalize(dialogues.Dialogues, options)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := dialogueyaml.Write(outputFile, dialogues); err != nil {
+		return 0, fmt.Errorf("failed to write dialogues: %w", err)
+	}
+
+	return changed, nil
+}
+
+// WritePauseReport writes the report in the requested format (json or markdown)
+func WritePauseReport(report *PauseReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writePauseMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writePauseMarkdown renders the report as a markdown document
+func writePauseMarkdown(report *PauseReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Pause Report\n\n")
+	sb.WriteString("| Metric | Value |\n")
+	sb.WriteString("|--------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Total dialogues | %d |\n", report.TotalDialogues))
+	sb.WriteString(fmt.Sprintf("| Pauses | %d |\n", report.TotalPauses))
+	sb.WriteString(fmt.Sprintf("| Prompts | %d |\n", report.TotalPrompts))
+	sb.WriteString(fmt.Sprintf("| Min duration | %d |\n", report.MinDuration))
+	sb.WriteString(fmt.Sprintf("| Max duration | %d |\n", report.MaxDuration))
+	sb.WriteString(fmt.Sprintf("| Mean duration | %.1f |\n", report.MeanDuration))
+	sb.WriteString(fmt.Sprintf("| Median duration | %d |\n", report.MedianDuration))
+
+	sb.WriteString("\n## Durations\n\n")
+	sb.WriteString("| Duration | Count |\n")
+	sb.WriteString("|----------|-------|\n")
+	durations := make([]int, 0, len(report.DurationCounts))
+	for duration := range report.DurationCounts {
+		durations = append(durations, duration)
+	}
+	sort.Ints(durations)
+	for _, duration := range durations {
+		sb.WriteString(fmt.Sprintf("| %d | %d |\n", duration, report.DurationCounts[duration]))
+	}
+
+	sb.WriteString("\n## Outliers\n\n")
+	sb.WriteString("| Dialogue | Item | Duration |\n")
+	sb.WriteString("|----------|------|----------|\n")
+	for _, outlier := range report.Outliers {
+		sb.WriteString(fmt.Sprintf("| %d | %d | %d |\n", outlier.DialogueID, outlier.ItemIndex, outlier.Duration))
+	}
+
+	if len(report.Invalid) > 0 {
+		sb.WriteString("\n## Invalid Durations\n\n")
+		sb.WriteString("| Dialogue | Item | Value | Error |\n")
+		sb.WriteString("|----------|------|-------|-------|\n")
+		for _, pause := range report.Invalid {
+			sb.WriteString(fmt.Sprintf("| %d | %d | %s | %s |\n", pause.DialogueID, pause.ItemIndex, pause.Value, pause.Error))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+// Package pkg provides tests for the pause analyzer
+package pkg
+
+import (
+	"testing"
+)
+
+// pauseEntry builds a dialogue entry with a text item followed by pause items
+func pauseEntry(id int, text string, durations ...int) DialogueEntry {
+	entry := textEntry(id, text)
+	for _, duration := range durations {
+		entry.Content = append(entry.Content, map[string]interface{}{
+			"pause": map[string]interface{}{"duration": duration},
+		})
+	}
+	return entry
+}
+
+func TestPauseAnalyzer_Analyze(t *testing.T) {
+	dialogues := []DialogueEntry{
+		pauseEntry(0, "Hello[PROMPT]", 10, 10),
+		pauseEntry(1, "Wait[WAIT FOR INPUT]", 12),
+		pauseEntry(2, "Long", 60),
+		pauseEntry(3, "None"),
+	}
+
+	report := NewPauseAnalyzer().Analyze(dialogues)
+
+	if report.TotalPauses != 4 {
+		t.Errorf("TotalPauses = %d, want 4", report.TotalPauses)
+	}
+	if report.TotalPrompts != 2 {
+		t.Errorf("TotalPrompts = %d, want 2", report.TotalPrompts)
+	}
+	if report.MinDuration != 10 || report.MaxDuration != 60 || report.MedianDuration != 12 {
+		t.Errorf("min/max/median = %d/%d/%d, want 10/60/12",
+			report.MinDuration, report.MaxDuration, report.MedianDuration)
+	}
+	if len(report.Outliers) != 1 || report.Outliers[0].DialogueID != 2 {
+		t.Errorf("Outliers = %v, want dialogue 2 only", report.Outliers)
+	}
+}
+
+func TestPauseAnalyzer_Normalize(t *testing.T) {
+	dialogues := []DialogueEntry{
+		pauseEntry(0, "Hello", 10, 1, 60),
+	}
+
+	changed, err := NewPauseAnalyzer().Normalize(dialogues, PauseNormalizeOptions{Scale: 0.5, MaxDuration: 20})
+	if err != nil {
+		t.Fatalf("Normalize() failed: %v", err)
+	}
+	if changed != 2 {
+		t.Errorf("Normalize() changed = %d, want 2", changed)
+	}
+
+	expected := []int{5, 1, 20}
+	for i, want := range expected {
+		_, got, _, _ := pauseDuration(dialogues[0].Content[i+1])
+		if got != want {
+			t.Errorf("pause %d duration = %d, want %d", i, got, want)
+		}
+	}
+
+	if text := dialogueTexts(dialogues[0]); len(text) != 1 || text[0] != "Hello" {
+		t.Errorf("Normalize() changed text items: %v", text)
+	}
+
+	if _, err := NewPauseAnalyzer().Normalize(dialogues, PauseNormalizeOptions{Scale: 0}); err == nil {
+		t.Error("Normalize() should fail for zero scale")
+	}
+}
+
+func TestPauseAnalyzer_Analyze_NumericForms(t *testing.T) {
+	entry := textEntry(0, "Hello")
+	for _, duration := range []interface{}{10, uint64(12), 14.0, "0x10", "fast", -1} {
+		entry.Content = append(entry.Content, map[string]interface{}{
+			"pause": map[string]interface{}{"duration": duration},
+		})
+	}
+
+	report := NewPauseAnalyzer().Analyze([]DialogueEntry{entry})
+
+	if report.TotalPauses != 4 || report.MinDuration != 10 || report.MaxDuration != 16 {
+		t.Errorf("pauses/min/max = %d/%d/%d, want 4/10/16", report.TotalPauses, report.MinDuration, report.MaxDuration)
+	}
+	if len(report.Invalid) != 2 || report.Invalid[0].Value != "fast" || report.Invalid[1].ItemIndex != 6 {
+		t.Errorf("Invalid = %v, want the \"fast\" and -1 pauses", report.Invalid)
+	}
+
+	if _, err := NewPauseAnalyzer().Normalize([]DialogueEntry{entry}, PauseNormalizeOptions{Scale: 1}); err == nil {
+		t.Error("Normalize() should fail for an invalid duration")
+	}
+}
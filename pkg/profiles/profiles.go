@@ -0,0 +1,390 @@
+// Package profiles provides the format profiles shipped inside the tombatools binary.
+// A profile is a YAML data file with the region offsets, control-code table, palettes
+// and format constraints of a game release. Profiles are embedded at build time so
+// release bundles work without extra files, and users can add or replace profiles by
+// placing YAML files in an override directory.
+package profiles
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"gopkg.in/yaml.v3"
+)
+
+// OverrideDirEnv is the environment variable that selects the profile override directory
+const OverrideDirEnv = "TOMBATOOLS_PROFILES"
+
+// EmbeddedSource is the Source value of profiles loaded from the binary
+const EmbeddedSource = "embedded"
+
+// paletteSize is the number of colors of a 4bpp palette
+const paletteSize = 16
+
+//go:embed data/*.yaml
+var embedded embed.FS
+
+// Constraints holds the limits of the game formats
+type Constraints struct {
+	GlyphIDBase uint16 `yaml:"glyph_id_base"`
+	MaxGlyphID  uint16 `yaml:"max_glyph_id"`
+	FontHeights []int  `yaml:"font_heights"`
+	SectorSize  int    `yaml:"sector_size"`
+
+	// MaxGlyphWidths is the widest glyph the game renderer draws per font height; wider
+	// glyphs wrap their VRAM cell and corrupt the adjacent glyphs
+	MaxGlyphWidths map[int]int `yaml:"max_glyph_widths"`
+}
+
+// Capability is a row of the capability matrix: what a profile supports for one format feature
+type Capability struct {
+	Name  string
+	Value string
+}
+
+// Capabilities returns the capability matrix rows of the profile
+func (p *Profile) Capabilities() []Capability {
+	c := p.Constraints
+
+	glyphIDs := "-"
+	if c.MaxGlyphID != 0 {
+		glyphIDs = fmt.Sprintf("0x%04X-0x%04X (%d glyphs)", c.GlyphIDBase, c.MaxGlyphID, int(c.MaxGlyphID-c.GlyphIDBase)+1)
+	}
+
+	heights := make([]string, 0, len(c.FontHeights))
+	for _, height := range c.FontHeights {
+		heights = append(heights, fmt.Sprintf("%d", height))
+	}
+
+	widthHeights := make([]int, 0, len(c.MaxGlyphWidths))
+	for height := range c.MaxGlyphWidths {
+		widthHeights = append(widthHeights, height)
+	}
+	sort.Ints(widthHeights)
+	widths := make([]string, 0, len(widthHeights))
+	for _, height := range widthHeights {
+		widths = append(widths, fmt.Sprintf("%d:%d", height, c.MaxGlyphWidths[height]))
+	}
+
+	fontCluts := make([]string, 0, len(p.FontCluts))
+	for clut, name := range p.FontCluts {
+		fontCluts = append(fontCluts, fmt.Sprintf("0x%04X:%s", clut, name))
+	}
+	sort.Strings(fontCluts)
+
+	conversions := make([]string, 0, len(p.Conversions))
+	for _, conversion := range p.Conversions {
+		conversions = append(conversions, conversion.Serial+"->"+conversion.To)
+	}
+
+	orNone := func(values []string, sep string) string {
+		if len(values) == 0 {
+			return "-"
+		}
+		return strings.Join(values, sep)
+	}
+	return []Capability{
+		{Name: "Glyph pointers", Value: "16-bit, glyph records up to 0xFFFF"},
+		{Name: "Glyph IDs", Value: glyphIDs},
+		{Name: "Font heights", Value: orNone(heights, ", ")},
+		{Name: "Max glyph widths", Value: orNone(widths, " ")},
+		{Name: "Font CLUTs", Value: orNone(fontCluts, " ")},
+		{Name: "Ignored characters", Value: orNone(p.IgnoredCharacters, " ")},
+		{Name: "Known releases", Value: fmt.Sprintf("%d", len(p.Releases))},
+		{Name: "Region conversions", Value: orNone(conversions, ", ")},
+	}
+}
+
+// Release identifies a pressing of the game by the serial of its boot executable
+type Release struct {
+	Serial    string `yaml:"serial" json:"serial"`                             // Product code, e.g. SCUS-94236
+	Region    string `yaml:"region" json:"region"`                             // NTSC-U, NTSC-J or PAL
+	Title     string `yaml:"title" json:"title"`                               // Title printed on the release
+	BuildDate string `yaml:"build_date,omitempty" json:"build_date,omitempty"` // Volume creation date, tells revisions apart
+}
+
+// FLARepoint points an FLA entry at another file of the image, with its position and size
+type FLARepoint struct {
+	Entry uint32 `yaml:"entry" json:"entry"` // Index in the FLA table
+	File  string `yaml:"file" json:"file"`   // Path inside the image, e.g. XA/NTSC.STR
+}
+
+// RegionConversion lists the changes converting a release to another region: byte
+// patches of its files (video mode flags, timing constants), FLA entries to re-point
+// and the steps that cannot be automated
+type RegionConversion struct {
+	Serial  string          `yaml:"serial"`  // Release the patches were made for
+	To      string          `yaml:"to"`      // Target region: NTSC-U, NTSC-J or PAL
+	Patches []psx.FilePatch `yaml:"patches"` // Applied in order
+	FLA     []FLARepoint    `yaml:"fla"`
+	Manual  []string        `yaml:"manual"` // Steps left to the user, listed after converting
+}
+
+// Profile describes the format details of a game release
+type Profile struct {
+	Name              string              `yaml:"name"`
+	Description       string              `yaml:"description"`
+	Game              string              `yaml:"game"`
+	Regions           []string            `yaml:"regions"`
+	Offsets           map[string]uint32   `yaml:"offsets"`
+	ControlCodes      map[string]uint16   `yaml:"control_codes"`
+	Palettes          map[string][]uint16 `yaml:"palettes"`
+	FontCluts         map[uint16]string   `yaml:"font_cluts"`         // GlyphClut values the game loads a palette for, by palette name
+	Speakers          map[uint16]string   `yaml:"speakers"`           // Names of the speaker ids of the SPEAKER code, written by decode
+	IgnoredCharacters []string            `yaml:"ignored_characters"` // Marker characters encode drops from dialogue text
+	Constraints       Constraints         `yaml:"constraints"`
+	Releases          []Release           `yaml:"releases"`
+	Conversions       []RegionConversion  `yaml:"conversions"`
+
+	// DoubleNewline is how wfm decode writes DOUBLE_NEWLINE: "newline" (blank line, the
+	// default) or "page" ([PAGE] tag) for scripts where it clears the text box
+	DoubleNewline string `yaml:"double_newline,omitempty"`
+
+	Source string `yaml:"-"` // "embedded" or the path of the override file
+	Raw    []byte `yaml:"-"` // File contents as loaded
+}
+
+// Validate checks the profile for missing names and malformed tables
+func (p *Profile) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile has no name")
+	}
+	for name, palette := range p.Palettes {
+		if len(palette) != paletteSize {
+			return fmt.Errorf("palette %s has %d colors, want %d", name, len(palette), paletteSize)
+		}
+	}
+	for clut, name := range p.FontCluts {
+		if _, ok := p.Palettes[name]; !ok {
+			return fmt.Errorf("font_cluts entry 0x%04X names unknown palette %q", clut, name)
+		}
+	}
+	if p.Constraints.MaxGlyphID != 0 && p.Constraints.MaxGlyphID < p.Constraints.GlyphIDBase {
+		return fmt.Errorf("max_glyph_id 0x%04X is below glyph_id_base 0x%04X",
+			p.Constraints.MaxGlyphID, p.Constraints.GlyphIDBase)
+	}
+	for _, height := range p.Constraints.FontHeights {
+		if height <= 0 {
+			return fmt.Errorf("invalid font height %d", height)
+		}
+	}
+	for height, width := range p.Constraints.MaxGlyphWidths {
+		if height <= 0 || width <= 0 {
+			return fmt.Errorf("invalid max_glyph_widths entry %d: %d", height, width)
+		}
+	}
+	for i, release := range p.Releases {
+		if release.Serial == "" {
+			return fmt.Errorf("release %d has no serial", i)
+		}
+	}
+	for i, conversion := range p.Conversions {
+		if conversion.Serial == "" {
+			return fmt.Errorf("conversion %d has no serial", i)
+		}
+		switch conversion.To {
+		case psx.RegionNTSCU, psx.RegionNTSCJ, psx.RegionPAL:
+		default:
+			return fmt.Errorf("conversion %d has invalid target region %q (want NTSC-U, NTSC-J or PAL)", i, conversion.To)
+		}
+		for _, patch := range conversion.Patches {
+			if err := patch.Validate(); err != nil {
+				return fmt.Errorf("conversion of %s to %s: %w", conversion.Serial, conversion.To, err)
+			}
+		}
+		for _, repoint := range conversion.FLA {
+			if repoint.File == "" {
+				return fmt.Errorf("conversion of %s to %s: FLA entry %d names no file", conversion.Serial, conversion.To, repoint.Entry)
+			}
+		}
+	}
+	for _, char := range p.IgnoredCharacters {
+		if utf8.RuneCountInString(char) != 1 {
+			return fmt.Errorf("ignored_characters entry %q must be a single character", char)
+		}
+	}
+	switch p.DoubleNewline {
+	case "", "newline", "page":
+	default:
+		return fmt.Errorf("invalid double_newline %q (want newline or page)", p.DoubleNewline)
+	}
+	return nil
+}
+
+// FindRelease returns the release with the given serial, or nil if the profile does not list it.
+// When several releases share the serial, the one with a matching build date is preferred.
+func (p *Profile) FindRelease(serial, buildDate string) *Release {
+	var found *Release
+	for i := range p.Releases {
+		release := &p.Releases[i]
+		if !strings.EqualFold(release.Serial, serial) {
+			continue
+		}
+		if release.BuildDate != "" && release.BuildDate == buildDate {
+			return release
+		}
+		if found == nil || (found.BuildDate != "" && release.BuildDate == "") {
+			found = release
+		}
+	}
+	return found
+}
+
+// FindConversion returns the conversion of the release with the given serial to a
+// region, or nil if the profile does not list one
+func (p *Profile) FindConversion(serial, region string) *RegionConversion {
+	for i := range p.Conversions {
+		conversion := &p.Conversions[i]
+		if strings.EqualFold(conversion.Serial, serial) && strings.EqualFold(conversion.To, region) {
+			return conversion
+		}
+	}
+	return nil
+}
+
+// DefaultOverrideDir returns the directory searched for user-supplied profiles:
+// $TOMBATOOLS_PROFILES if set, otherwise <user config dir>/tombatools/profiles
+func DefaultOverrideDir() string {
+	if dir := os.Getenv(OverrideDirEnv); dir != "" {
+		return dir
+	}
+	configDir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(configDir, "tombatools", "profiles")
+}
+
+// List returns the embedded profiles merged with the profiles of overrideDir, sorted by name.
+// A user profile replaces the embedded profile with the same name. A missing override
+// directory is not an error.
+func List(overrideDir string) ([]*Profile, error) {
+	byName := make(map[string]*Profile)
+
+	files, err := fs.Glob(embedded, "data/*.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list embedded profiles: %w", err)
+	}
+	for _, file := range files {
+		data, err := embedded.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embedded profile %s: %w", file, err)
+		}
+		profile, err := parse(data, EmbeddedSource)
+		if err != nil {
+			return nil, fmt.Errorf("invalid embedded profile %s: %w", file, err)
+		}
+		byName[profile.Name] = profile
+	}
+
+	overrides, err := loadOverrides(overrideDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range overrides {
+		if _, exists := byName[profile.Name]; exists {
+			common.LogDebug("Profile %s overridden by %s", profile.Name, profile.Source)
+		}
+		byName[profile.Name] = profile
+	}
+
+	result := make([]*Profile, 0, len(byName))
+	for _, profile := range byName {
+		result = append(result, profile)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// Load returns the profile with the given name, looking in overrideDir first
+func Load(name, overrideDir string) (*Profile, error) {
+	all, err := List(overrideDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, profile := range all {
+		if profile.Name == name {
+			return profile, nil
+		}
+	}
+	return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("profile not found: %s", name))
+}
+
+// ForDisc returns the profile and release matching a disc serial and build date.
+// User-supplied profiles are preferred over embedded ones, so a region-specific
+// override profile listing the serial is selected instead of the generic profile.
+func ForDisc(serial, buildDate, overrideDir string) (*Profile, *Release, error) {
+	if serial == "" {
+		return nil, nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("disc has no serial"))
+	}
+
+	all, err := List(overrideDir)
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.SliceStable(all, func(i, j int) bool {
+		return all[i].Source != EmbeddedSource && all[j].Source == EmbeddedSource
+	})
+	for _, profile := range all {
+		if release := profile.FindRelease(serial, buildDate); release != nil {
+			return profile, release, nil
+		}
+	}
+	return nil, nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("no profile lists release %s", serial))
+}
+
+// loadOverrides parses every *.yaml and *.yml file of the override directory
+func loadOverrides(dir string) ([]*Profile, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read profile directory: %w", err)
+	}
+
+	var result []*Profile
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read profile %s: %w", path, err)
+		}
+		profile, err := parse(data, path)
+		if err != nil {
+			return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid profile %s: %w", path, err))
+		}
+		result = append(result, profile)
+	}
+	return result, nil
+}
+
+// parse decodes and validates a profile file
+func parse(data []byte, source string) (*Profile, error) {
+	var profile Profile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+	if err := profile.Validate(); err != nil {
+		return nil, err
+	}
+	profile.Source = source
+	profile.Raw = data
+	return &profile, nil
+}
@@ -0,0 +1,179 @@
+// Package profiles provides tests for the embedded format profiles.
+package profiles
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg"
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestLoad_EmbeddedMatchesPackageTables(t *testing.T) {
+	profile, err := Load("tomba", "")
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	if profile.Source != EmbeddedSource {
+		t.Errorf("Source = %q, want %q", profile.Source, EmbeddedSource)
+	}
+
+	// The profile table and the generated package table (controlcodes.yaml) list the
+	// same codes, so a code added to one of them fails here until added to the other
+	codes := pkg.ControlCodes()
+	for _, code := range codes {
+		if got, found := profile.ControlCodes[code.Name]; !found || got != code.Value {
+			t.Errorf("ControlCodes[%s] = 0x%04X (found %v), want 0x%04X", code.Name, got, found, code.Value)
+		}
+	}
+	for name, value := range profile.ControlCodes {
+		if code, found := pkg.LookupControlCode(value); !found || code.Name != name {
+			t.Errorf("profile control code %s = 0x%04X is not in controlcodes.yaml", name, value)
+		}
+	}
+
+	palettes := map[string][16]uint16{"dialogue": pkg.DialogueClut, "event": pkg.EventClut}
+	for name, want := range palettes {
+		got := profile.Palettes[name]
+		if len(got) != len(want) {
+			t.Fatalf("len(Palettes[%s]) = %d, want %d", name, len(got), len(want))
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("Palettes[%s][%d] = 0x%04X, want 0x%04X", name, i, got[i], want[i])
+			}
+		}
+	}
+
+	if profile.Constraints.GlyphIDBase != pkg.GLYPH_ID_BASE {
+		t.Errorf("GlyphIDBase = 0x%04X, want 0x%04X", profile.Constraints.GlyphIDBase, pkg.GLYPH_ID_BASE)
+	}
+	for _, height := range profile.Constraints.FontHeights {
+		if profile.Constraints.MaxGlyphWidths[height] <= 0 {
+			t.Errorf("MaxGlyphWidths has no limit for %d px fonts", height)
+		}
+	}
+	if capabilities := profile.Capabilities(); len(capabilities) == 0 || capabilities[0].Value != "16-bit, glyph records up to 0xFFFF" {
+		t.Errorf("Capabilities() = %+v, want the 16-bit glyph pointers first", capabilities)
+	}
+	if profile.DoubleNewline != pkg.DoubleNewlineAsNewline {
+		t.Errorf("DoubleNewline = %q, want %q", profile.DoubleNewline, pkg.DoubleNewlineAsNewline)
+	}
+}
+
+func TestList_OverrideDirectory(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"tomba.yaml":  "name: tomba\ndescription: patched\noffsets:\n  fla_table: 0x1000\n",
+		"custom.yml":  "name: custom\nregions: [PAL]\n",
+		"readme.txt":  "not a profile",
+		"ignored.bak": "name: ignored\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+
+	all, err := List(dir)
+	if err != nil {
+		t.Fatalf("List() failed: %v", err)
+	}
+	if len(all) != 2 || all[0].Name != "custom" || all[1].Name != "tomba" {
+		t.Fatalf("List() returned %d profiles, want custom and tomba", len(all))
+	}
+
+	tomba := all[1]
+	if tomba.Description != "patched" || tomba.Offsets["fla_table"] != 0x1000 {
+		t.Errorf("override was not applied: %+v", tomba)
+	}
+	if tomba.Source != filepath.Join(dir, "tomba.yaml") {
+		t.Errorf("Source = %q, want override path", tomba.Source)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	if _, err := Load("missing", ""); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("Load(missing) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitInputNotFound)
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: bad\npalettes:\n  short: [1, 2]\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: bad\ndouble_newline: box\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad double_newline) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: bad\nconstraints:\n  max_glyph_widths:\n    16: 0\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad max_glyph_widths) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: bad\npalettes: {}\nfont_cluts:\n  0x7F3C: dialogue\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad font_cluts) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte("name: bad\nignored_characters: [\"**\"]\n"), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad ignored_characters) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+
+	conversion := "name: bad\nconversions:\n  - serial: SCES-01330\n    to: NTSC-U\n    patches:\n      - {name: mode, file: EXE/MAIN0.EXE, original: '01 00', patched: '00'}\n"
+	if err := os.WriteFile(filepath.Join(dir, "bad.yaml"), []byte(conversion), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+	if _, err := List(dir); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("List(bad conversion patch) exit code = %d, want %d", common.ExitCodeFor(err), common.ExitFormatError)
+	}
+}
+
+func TestForDisc(t *testing.T) {
+	profile, release, err := ForDisc("scus-94236", "", "")
+	if err != nil {
+		t.Fatalf("ForDisc() failed: %v", err)
+	}
+	if profile.Name != "tomba" || release.Region != "NTSC-U" {
+		t.Errorf("ForDisc() = %s/%+v, want tomba NTSC-U release", profile.Name, release)
+	}
+
+	dir := t.TempDir()
+	override := "name: tomba-us-rev1\nreleases:\n" +
+		"  - {serial: SCUS-94236, region: NTSC-U, title: Tomba!}\n" +
+		"  - {serial: SCUS-94236, region: NTSC-U, title: Tomba! (Rev 1), build_date: \"1998-01-02 03:04:05\"}\n"
+	if err := os.WriteFile(filepath.Join(dir, "tomba-us.yaml"), []byte(override), 0644); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	profile, release, err = ForDisc("SCUS-94236", "1998-01-02 03:04:05", dir)
+	if err != nil {
+		t.Fatalf("ForDisc() failed: %v", err)
+	}
+	if profile.Name != "tomba-us-rev1" || release.Title != "Tomba! (Rev 1)" {
+		t.Errorf("ForDisc() = %s/%+v, want the override profile and its revision", profile.Name, release)
+	}
+	if _, release, _ := ForDisc("SCUS-94236", "1997-01-01 00:00:00", dir); release == nil || release.BuildDate != "" {
+		t.Errorf("ForDisc(unknown build) = %+v, want the release without a build date", release)
+	}
+
+	for _, serial := range []string{"", "SLUS-00000"} {
+		if _, _, err := ForDisc(serial, "", ""); common.ExitCodeFor(err) != common.ExitInputNotFound {
+			t.Errorf("ForDisc(%q) exit code = %d, want %d", serial, common.ExitCodeFor(err), common.ExitInputNotFound)
+		}
+	}
+}
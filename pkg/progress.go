@@ -0,0 +1,250 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the translation progress analyzer that compares an original
+// dialogue YAML export against its translated counterpart.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// Translation status values reported for each dialogue
+const (
+	StatusUntranslated = "untranslated"
+	StatusPartial      = "partial"
+	StatusComplete     = "complete"
+)
+
+// Report output formats supported by WriteProgressReport
+const (
+	ReportFormatJSON     = "json"
+	ReportFormatMarkdown = "markdown"
+	ReportFormatCSV      = "csv" // Tabular reports only, e.g. wfm measure
+)
+
+// PlaceholderMarkers lists the markers translators leave in unfinished text.
+// A dialogue containing any of them is never reported as complete.
+var PlaceholderMarkers = []string{"TODO", "TBD", "FIXME", "???"}
+
+// controlTagRegex matches bracketed control tags and unmapped bytes such as [HALT] or [8030]
+var controlTagRegex = regexp.MustCompile(`\[[^\]]*\]`)
+
+// DialogueProgress holds the translation status of a single dialogue
+type DialogueProgress struct {
+	ID              int    `json:"id"`
+	Status          string `json:"status"`
+	OriginalWords   int    `json:"original_words"`
+	TranslatedWords int    `json:"translated_words"`
+	HasPlaceholder  bool   `json:"has_placeholder,omitempty"`
+}
+
+// ProgressReport summarizes translation progress across a dialogue file
+type ProgressReport struct {
+	TotalDialogues       int                `json:"total_dialogues"`
+	Untranslated         int                `json:"untranslated"`
+	Partial              int                `json:"partial"`
+	Complete             int                `json:"complete"`
+	MissingInTranslation int                `json:"missing_in_translation"`
+	TotalOriginalWords   int                `json:"total_original_words"`
+	TotalTranslatedWords int                `json:"total_translated_words"`
+	CompletionPercentage float64            `json:"completion_percentage"`
+	Dialogues            []DialogueProgress `json:"dialogues"`
+}
+
+// ProgressAnalyzer compares original and translated dialogue files
+type ProgressAnalyzer struct{}
+
+// NewProgressAnalyzer creates a new translation progress analyzer instance
+func NewProgressAnalyzer() *ProgressAnalyzer {
+	return &ProgressAnalyzer{}
+}
+
+// dialogueTexts returns the text items of a dialogue in content order
+func dialogueTexts(entry DialogueEntry) []string {
+	var texts []string
+	for _, contentItem := range entry.Content {
+		if textValue, exists := contentItem["text"]; exists {
+			if textStr, ok := textValue.(string); ok {
+				texts = append(texts, textStr)
+			}
+		}
+	}
+	return texts
+}
+
+// countWords counts the words of a dialogue text, ignoring control tags and symbols
+func countWords(text string) int {
+	cleanText := controlTagRegex.ReplaceAllString(text, " ")
+	cleanText = replaceZeroWidth(cleanText, ' ')
+	return len(strings.Fields(cleanText))
+}
+
+// hasPlaceholder reports whether the text contains any placeholder marker
+func hasPlaceholder(text string) bool {
+	for _, marker := range PlaceholderMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// Analyze loads both YAML files and computes the translation progress report
+func (a *ProgressAnalyzer) Analyze(originalFile, translatedFile string) (*ProgressReport, error) {
+	original, err := dialogueyaml.Read(originalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load original dialogues: %w", err)
+	}
+
+	translated, err := dialogueyaml.Read(translatedFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load translated dialogues: %w", err)
+	}
+
+	return a.Compare(original.Dialogues, translated.Dialogues), nil
+}
+
+// Compare computes the translation progress report for two dialogue lists matched by ID
+func (a *ProgressAnalyzer) Compare(original, translated []DialogueEntry) *ProgressReport {
+	translatedByID := make(map[int]DialogueEntry, len(translated))
+	for _, entry := range translated {
+		translatedByID[entry.ID] = entry
+	}
+
+	report := &ProgressReport{
+		TotalDialogues: len(original),
+		Dialogues:      make([]DialogueProgress, 0, len(original)),
+	}
+
+	for _, originalEntry := range original {
+		translatedEntry, found := translatedByID[originalEntry.ID]
+		if !found {
+			report.MissingInTranslation++
+			common.LogDebug("Dialogue %d missing in translated file", originalEntry.ID)
+		}
+
+		progress := a.classifyDialogue(originalEntry, translatedEntry)
+		switch progress.Status {
+		case StatusUntranslated:
+			report.Untranslated++
+		case StatusPartial:
+			report.Partial++
+		case StatusComplete:
+			report.Complete++
+		}
+
+		report.TotalOriginalWords += progress.OriginalWords
+		report.TotalTranslatedWords += progress.TranslatedWords
+		report.Dialogues = append(report.Dialogues, progress)
+	}
+
+	sort.Slice(report.Dialogues, func(i, j int) bool {
+		return report.Dialogues[i].ID < report.Dialogues[j].ID
+	})
+
+	if report.TotalDialogues > 0 {
+		report.CompletionPercentage = float64(report.Complete) * 100 / float64(report.TotalDialogues)
+	}
+
+	return report
+}
+
+// classifyDialogue determines the translation status of a single dialogue.
+// Text items identical to the original count as untranslated; a mix of changed
+// and unchanged items, or any placeholder marker, makes the dialogue partial.
+func (a *ProgressAnalyzer) classifyDialogue(original, translated DialogueEntry) DialogueProgress {
+	originalTexts := dialogueTexts(original)
+	translatedTexts := dialogueTexts(translated)
+
+	progress := DialogueProgress{ID: original.ID}
+	for _, text := range originalTexts {
+		progress.OriginalWords += countWords(text)
+	}
+	for _, text := range translatedTexts {
+		progress.TranslatedWords += countWords(text)
+		if hasPlaceholder(text) {
+			progress.HasPlaceholder = true
+		}
+	}
+
+	// Dialogues without any text (control codes only) need no translation
+	if progress.OriginalWords == 0 {
+		progress.Status = StatusComplete
+		return progress
+	}
+
+	unchanged := 0
+	for i, text := range originalTexts {
+		if i < len(translatedTexts) && translatedTexts[i] == text {
+			unchanged++
+		}
+	}
+
+	switch {
+	case len(translatedTexts) == 0 || (unchanged == len(originalTexts) && len(translatedTexts) == len(originalTexts)):
+		progress.Status = StatusUntranslated
+	case unchanged > 0 || progress.HasPlaceholder:
+		progress.Status = StatusPartial
+	default:
+		progress.Status = StatusComplete
+	}
+
+	return progress
+}
+
+// WriteProgressReport writes the report in the requested format (json or markdown)
+func WriteProgressReport(report *ProgressReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeProgressMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeProgressMarkdown renders the report as a markdown document
+func writeProgressMarkdown(report *ProgressReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Translation Progress\n\n")
+	sb.WriteString("| Metric | Value |\n")
+	sb.WriteString("|--------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Total dialogues | %d |\n", report.TotalDialogues))
+	sb.WriteString(fmt.Sprintf("| Complete | %d |\n", report.Complete))
+	sb.WriteString(fmt.Sprintf("| Partial | %d |\n", report.Partial))
+	sb.WriteString(fmt.Sprintf("| Untranslated | %d |\n", report.Untranslated))
+	sb.WriteString(fmt.Sprintf("| Missing in translation | %d |\n", report.MissingInTranslation))
+	sb.WriteString(fmt.Sprintf("| Original words | %d |\n", report.TotalOriginalWords))
+	sb.WriteString(fmt.Sprintf("| Translated words | %d |\n", report.TotalTranslatedWords))
+	sb.WriteString(fmt.Sprintf("| Completion | %.1f%% |\n", report.CompletionPercentage))
+
+	sb.WriteString("\n## Pending Dialogues\n\n")
+	sb.WriteString("| ID | Status | Original words | Translated words |\n")
+	sb.WriteString("|----|--------|----------------|------------------|\n")
+	for _, dialogue := range report.Dialogues {
+		if dialogue.Status == StatusComplete {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("| %d | %s | %d | %d |\n",
+			dialogue.ID, dialogue.Status, dialogue.OriginalWords, dialogue.TranslatedWords))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
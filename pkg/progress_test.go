@@ -0,0 +1,105 @@
+// Package pkg provides tests for the translation progress analyzer
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// textEntry builds a dialogue entry whose content holds the given text items
+func textEntry(id int, texts ...string) DialogueEntry {
+	entry := DialogueEntry{ID: id}
+	for _, text := range texts {
+		entry.Content = append(entry.Content, map[string]interface{}{"text": text})
+	}
+	return entry
+}
+
+func TestProgressAnalyzer_Compare(t *testing.T) {
+	original := []DialogueEntry{
+		textEntry(0, "Hello there"),
+		textEntry(1, "First page", "Second page"),
+		textEntry(2, "Good bye"),
+		textEntry(3, "Fix me"),
+		{ID: 4, Content: []map[string]interface{}{{"box": map[string]interface{}{"width": 1, "height": 2}}}},
+		textEntry(5, "Missing"),
+	}
+	translated := []DialogueEntry{
+		textEntry(0, "Hello there"),
+		textEntry(1, "Primeira pagina", "Second page"),
+		textEntry(2, "Adeus"),
+		textEntry(3, "TODO traduzir"),
+		{ID: 4, Content: []map[string]interface{}{{"box": map[string]interface{}{"width": 1, "height": 2}}}},
+	}
+
+	report := NewProgressAnalyzer().Compare(original, translated)
+
+	want := map[int]string{
+		0: StatusUntranslated,
+		1: StatusPartial,
+		2: StatusComplete,
+		3: StatusPartial,
+		4: StatusComplete,
+		5: StatusUntranslated,
+	}
+	for _, dialogue := range report.Dialogues {
+		if dialogue.Status != want[dialogue.ID] {
+			t.Errorf("dialogue %d status = %q, want %q", dialogue.ID, dialogue.Status, want[dialogue.ID])
+		}
+	}
+
+	if report.Complete != 2 || report.Partial != 2 || report.Untranslated != 2 {
+		t.Errorf("counts = complete %d, partial %d, untranslated %d, want 2/2/2",
+			report.Complete, report.Partial, report.Untranslated)
+	}
+
+	if report.MissingInTranslation != 1 {
+		t.Errorf("MissingInTranslation = %d, want 1", report.MissingInTranslation)
+	}
+}
+
+func TestCountWords(t *testing.T) {
+	tests := []struct {
+		text     string
+		expected int
+	}{
+		{"Hello there", 2},
+		{"[HALT]Hello[8030] world▼", 2},
+		{"", 0},
+		{"one\ntwo\n\nthree⧗", 3},
+	}
+
+	for _, tt := range tests {
+		if got := countWords(tt.text); got != tt.expected {
+			t.Errorf("countWords(%q) = %d, want %d", tt.text, got, tt.expected)
+		}
+	}
+}
+
+func TestWriteProgressReport(t *testing.T) {
+	report := NewProgressAnalyzer().Compare(
+		[]DialogueEntry{textEntry(0, "Hello")},
+		[]DialogueEntry{textEntry(0, "Hello")},
+	)
+
+	var buffer bytes.Buffer
+	if err := WriteProgressReport(report, ReportFormatJSON, &buffer); err != nil {
+		t.Fatalf("WriteProgressReport(json) failed: %v", err)
+	}
+	if !strings.Contains(buffer.String(), `"untranslated": 1`) {
+		t.Errorf("JSON report missing untranslated count: %s", buffer.String())
+	}
+
+	buffer.Reset()
+	if err := WriteProgressReport(report, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteProgressReport(markdown) failed: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "| 0 | untranslated |") {
+		t.Errorf("markdown report missing pending dialogue row: %s", buffer.String())
+	}
+
+	if err := WriteProgressReport(report, "xml", &buffer); err == nil {
+		t.Error("WriteProgressReport() should fail for unsupported format")
+	}
+}
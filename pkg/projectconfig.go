@@ -0,0 +1,196 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the project configuration (tombatools.yaml), which names tasks
+// (sequences of tombatools command lines) and aliases (shortcuts for a single command
+// line) run through 'tombatools run'.
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultProjectConfigFile is the project configuration looked up when none is given
+const DefaultProjectConfigFile = "tombatools.yaml"
+
+// ProjectConfig is the content of a project configuration file
+type ProjectConfig struct {
+	Tasks   map[string][]string `yaml:"tasks"`   // Task name to the command lines it runs in order
+	Aliases map[string]string   `yaml:"aliases"` // Alias name to the command line it expands to
+}
+
+// ProjectStep is one command line of a task or alias, split into arguments
+type ProjectStep struct {
+	Line string   // Command line as written in the configuration
+	Args []string // Arguments without the leading "tombatools"
+}
+
+// LoadProjectConfig reads and validates a project configuration file
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("project configuration %s not found", path))
+		}
+		return nil, fmt.Errorf("failed to read project configuration: %w", err)
+	}
+
+	var config ProjectConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse project configuration: %w", err))
+	}
+	if err := config.Validate(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid project configuration %s: %w", path, err))
+	}
+	return &config, nil
+}
+
+// Validate checks that every task and alias has a unique name and well-formed
+// command lines. Tasks and aliases cannot call 'run' themselves.
+func (c *ProjectConfig) Validate() error {
+	for name, lines := range c.Tasks {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("a task has an empty name")
+		}
+		if len(lines) == 0 {
+			return fmt.Errorf("task %q has no steps", name)
+		}
+		for i, line := range lines {
+			if _, err := parseProjectStep(line); err != nil {
+				return fmt.Errorf("task %q step %d: %w", name, i+1, err)
+			}
+		}
+	}
+	for name, line := range c.Aliases {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("an alias has an empty name")
+		}
+		if _, ok := c.Tasks[name]; ok {
+			return fmt.Errorf("%q is defined both as a task and as an alias", name)
+		}
+		if _, err := parseProjectStep(line); err != nil {
+			return fmt.Errorf("alias %q: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Names returns the task and alias names in alphabetical order
+func (c *ProjectConfig) Names() []string {
+	names := make([]string, 0, len(c.Tasks)+len(c.Aliases))
+	for name := range c.Tasks {
+		names = append(names, name)
+	}
+	for name := range c.Aliases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Steps expands a task or alias into the command lines to run. Extra arguments are
+// appended to an alias; tasks take none.
+func (c *ProjectConfig) Steps(name string, extra []string) ([]ProjectStep, error) {
+	if lines, ok := c.Tasks[name]; ok {
+		if len(extra) > 0 {
+			return nil, fmt.Errorf("task %s takes no arguments (got %s)", name, strings.Join(extra, " "))
+		}
+		steps := make([]ProjectStep, 0, len(lines))
+		for _, line := range lines {
+			step, err := parseProjectStep(line)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+		return steps, nil
+	}
+	if line, ok := c.Aliases[name]; ok {
+		step, err := parseProjectStep(line)
+		if err != nil {
+			return nil, err
+		}
+		step.Args = append(step.Args, extra...)
+		if len(extra) > 0 {
+			step.Line = line + " " + strings.Join(extra, " ")
+		}
+		return []ProjectStep{step}, nil
+	}
+	return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no task or alias named %q", name))
+}
+
+// parseProjectStep splits a command line into its arguments
+func parseProjectStep(line string) (ProjectStep, error) {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return ProjectStep{}, err
+	}
+	if len(args) > 0 && args[0] == "tombatools" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return ProjectStep{}, fmt.Errorf("empty command line")
+	}
+	if args[0] == "run" {
+		return ProjectStep{}, fmt.Errorf("%q: tasks and aliases cannot call run", line)
+	}
+	return ProjectStep{Line: line, Args: args}, nil
+}
+
+// splitCommandLine splits a command line on whitespace like a POSIX shell would,
+// honoring single quotes, double quotes and backslash escapes
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\' && quote != '\'':
+			if i+1 == len(runes) {
+				return nil, fmt.Errorf("%q ends with a backslash", line)
+			}
+			i++
+			current.WriteRune(runes[i])
+			inArg = true
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\'' || r == '"':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t' || r == '\n':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("%q has an unterminated %c quote", line, quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,87 @@
+// Package pkg provides tests for the project configuration of tasks and aliases
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestLoadProjectConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultProjectConfigFile)
+	config := `tasks:
+  rebuild:
+    - wfm encode dialogues.yaml "out/CFNT999H.WFM"
+    - tombatools fla recalc --in-place 'Tomba (USA).bin'
+aliases:
+  enc: wfm encode -v
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	loaded, err := LoadProjectConfig(path)
+	if err != nil {
+		t.Fatalf("LoadProjectConfig() failed: %v", err)
+	}
+	if got := loaded.Names(); !reflect.DeepEqual(got, []string{"enc", "rebuild"}) {
+		t.Errorf("Names() = %v, want [enc rebuild]", got)
+	}
+
+	steps, err := loaded.Steps("rebuild", nil)
+	if err != nil {
+		t.Fatalf("Steps(rebuild) failed: %v", err)
+	}
+	want := [][]string{
+		{"wfm", "encode", "dialogues.yaml", "out/CFNT999H.WFM"},
+		{"fla", "recalc", "--in-place", "Tomba (USA).bin"},
+	}
+	if len(steps) != 2 || !reflect.DeepEqual(steps[0].Args, want[0]) || !reflect.DeepEqual(steps[1].Args, want[1]) {
+		t.Errorf("Steps(rebuild) = %+v, want %v", steps, want)
+	}
+	if _, err := loaded.Steps("rebuild", []string{"extra"}); err == nil {
+		t.Error("Steps(rebuild, extra) succeeded, want an error for task arguments")
+	}
+
+	// Alias arguments are appended to the expanded command line
+	steps, err = loaded.Steps("enc", []string{"a.yaml", "b.WFM"})
+	if err != nil {
+		t.Fatalf("Steps(enc) failed: %v", err)
+	}
+	if want := []string{"wfm", "encode", "-v", "a.yaml", "b.WFM"}; len(steps) != 1 || !reflect.DeepEqual(steps[0].Args, want) {
+		t.Errorf("Steps(enc) = %+v, want %v", steps, want)
+	}
+
+	if _, err := loaded.Steps("missing", nil); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("Steps(missing) = %v, want a validation error", err)
+	}
+
+	if _, err := LoadProjectConfig(filepath.Join(t.TempDir(), "missing.yaml")); common.ExitCodeFor(err) != common.ExitInputNotFound {
+		t.Errorf("LoadProjectConfig(missing) = %v, want an input-not-found error", err)
+	}
+}
+
+func TestProjectConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ProjectConfig
+		wantErr bool
+	}{
+		{"valid", ProjectConfig{Tasks: map[string][]string{"a": {"doctor"}}, Aliases: map[string]string{"b": "doctor"}}, false},
+		{"no steps", ProjectConfig{Tasks: map[string][]string{"a": {}}}, true},
+		{"empty step", ProjectConfig{Tasks: map[string][]string{"a": {"tombatools"}}}, true},
+		{"nested run", ProjectConfig{Tasks: map[string][]string{"a": {"run b"}}}, true},
+		{"unterminated quote", ProjectConfig{Aliases: map[string]string{"a": `wfm decode "a.WFM`}}, true},
+		{"duplicate name", ProjectConfig{Tasks: map[string][]string{"a": {"doctor"}}, Aliases: map[string]string{"a": "doctor"}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
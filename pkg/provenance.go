@@ -0,0 +1,91 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the provenance trailer: a short JSON record of the tool version, the
+// source YAML hash and the encoding time, stored in the final padding of encoded WFM files
+// so a distributed file can be traced back to the build that produced it.
+package pkg
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// provenanceMagic ends a WFM file carrying a provenance trailer
+const provenanceMagic = "TTPV"
+
+// provenanceFooterSize is the size of the payload length and the magic after the payload
+const provenanceFooterSize = 2 + len(provenanceMagic)
+
+// Provenance records which build produced an encoded file
+type Provenance struct {
+	Tool         string `json:"tool"`
+	Version      string `json:"version"`
+	SourceSHA256 string `json:"source_sha256"`
+	Created      string `json:"created"`
+}
+
+// NewProvenance builds the provenance of a file encoded from sourceFile
+func NewProvenance(version, sourceFile string) (*Provenance, error) {
+	data, err := os.ReadFile(sourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash source file: %w", err)
+	}
+	sum := sha256.Sum256(data)
+
+	return &Provenance{
+		Tool:         "tombatools",
+		Version:      version,
+		SourceSHA256: hex.EncodeToString(sum[:]),
+		Created:      time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+// Trailer returns the bytes stored at the end of the file:
+// JSON payload, payload length (uint16 little endian) and the TTPV magic
+func (p *Provenance) Trailer() ([]byte, error) {
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode provenance: %w", err)
+	}
+
+	trailer := make([]byte, len(payload)+provenanceFooterSize)
+	copy(trailer, payload)
+	binary.LittleEndian.PutUint16(trailer[len(payload):], uint16(len(payload)))
+	copy(trailer[len(payload)+2:], provenanceMagic)
+	return trailer, nil
+}
+
+// ReadProvenance extracts the provenance trailer from the contents of an encoded file
+func ReadProvenance(data []byte) (*Provenance, error) {
+	if len(data) < provenanceFooterSize || !bytes.HasSuffix(data, []byte(provenanceMagic)) {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("no provenance trailer found"))
+	}
+
+	footer := len(data) - provenanceFooterSize
+	size := int(binary.LittleEndian.Uint16(data[footer:]))
+	if size > footer {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("provenance trailer length %d exceeds the file", size))
+	}
+
+	var provenance Provenance
+	if err := json.Unmarshal(data[footer-size:footer], &provenance); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid provenance trailer: %w", err))
+	}
+	return &provenance, nil
+}
+
+// ReadProvenanceFile extracts the provenance trailer of an encoded file
+func ReadProvenanceFile(path string) (*Provenance, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return ReadProvenance(data)
+}
@@ -0,0 +1,100 @@
+// Package pkg provides tests for the provenance trailer of encoded WFM files
+package pkg
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestProvenance_RoundTrip(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "dialogues.yaml")
+	if err := os.WriteFile(source, []byte("dialogues: []\n"), 0644); err != nil {
+		t.Fatalf("failed to write source: %v", err)
+	}
+
+	provenance, err := NewProvenance("v1.2.3", source)
+	if err != nil {
+		t.Fatalf("NewProvenance() failed: %v", err)
+	}
+	trailer, err := provenance.Trailer()
+	if err != nil {
+		t.Fatalf("Trailer() failed: %v", err)
+	}
+
+	data := append(bytes.Repeat([]byte{0xFF}, 64), trailer...)
+	got, err := ReadProvenance(data)
+	if err != nil {
+		t.Fatalf("ReadProvenance() failed: %v", err)
+	}
+	if *got != *provenance {
+		t.Errorf("ReadProvenance() = %+v, want %+v", got, provenance)
+	}
+	if len(got.SourceSHA256) != 64 {
+		t.Errorf("SourceSHA256 = %q, want 64 hex digits", got.SourceSHA256)
+	}
+
+	if _, err := ReadProvenance(bytes.Repeat([]byte{0xFF}, 64)); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("ReadProvenance() without trailer = %v, want format error", err)
+	}
+}
+
+func TestWFMFileEncoder_ApplyFinalPadding_Provenance(t *testing.T) {
+	provenance := &Provenance{Tool: "tombatools", Version: "dev", SourceSHA256: "00", Created: "2025-01-01T00:00:00Z"}
+	trailer, err := provenance.Trailer()
+	if err != nil {
+		t.Fatalf("Trailer() failed: %v", err)
+	}
+
+	tests := []struct {
+		name         string
+		originalSize int64
+		wantErr      bool
+	}{
+		{name: "fits in padding", originalSize: 16 + int64(len(trailer)) + 8},
+		{name: "padding too small", originalSize: 16 + int64(len(trailer)) - 1, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "out.wfm")
+			file, err := os.Create(path)
+			if err != nil {
+				t.Fatalf("failed to create file: %v", err)
+			}
+			defer file.Close()
+			content := bytes.Repeat([]byte{0xAB}, 16)
+			if _, err := file.Write(content); err != nil {
+				t.Fatalf("failed to write content: %v", err)
+			}
+
+			encoder := NewWFMEncoder()
+			encoder.originalSize = tt.originalSize
+			encoder.provenance = provenance
+			err = encoder.applyFinalPadding(file)
+			if tt.wantErr {
+				if common.ExitCodeFor(err) != common.ExitValidationFailed {
+					t.Errorf("applyFinalPadding() = %v, want validation error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("applyFinalPadding() failed: %v", err)
+			}
+
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("failed to read output: %v", err)
+			}
+			if int64(len(data)) != tt.originalSize || !bytes.HasPrefix(data, content) {
+				t.Errorf("output is %d bytes, want %d with content untouched", len(data), tt.originalSize)
+			}
+			if got, err := ReadProvenance(data); err != nil || *got != *provenance {
+				t.Errorf("ReadProvenance() = %+v, %v, want %+v", got, err, provenance)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Package psx provides PlayStation-specific tile and graphics processing functionality.
+// This file contains the alpha preprocessing applied to PNG images before they are
+// quantized to a 4bpp palette, so antialiased edges do not produce stray colors.
+package psx
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// AlphaOptions controls how semi-transparent pixels are normalized before quantization
+type AlphaOptions struct {
+	Threshold     uint8       // Pixels with alpha below this become transparent, the rest opaque (0 disables)
+	Matte         *color.RGBA // Optional color semi-transparent pixels are blended over before thresholding
+	Premultiplied bool        // Color channels were stored premultiplied by alpha and must be divided back
+}
+
+// Enabled reports whether the options modify pixels at all
+func (o AlphaOptions) Enabled() bool {
+	return o.Threshold > 0 || o.Matte != nil || o.Premultiplied
+}
+
+// CountPartialAlpha returns the number of pixels that are neither fully transparent nor fully opaque
+func CountPartialAlpha(img image.Image) int {
+	bounds := img.Bounds()
+	partial := 0
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			_, _, _, a := img.At(x, y).RGBA()
+			if a != 0 && a != 0xFFFF {
+				partial++
+			}
+		}
+	}
+	return partial
+}
+
+// PreprocessAlpha returns a copy of img with its transparency normalized according to the options.
+// Fully transparent pixels are always cleared to (0,0,0,0) so they map to palette index 0.
+func PreprocessAlpha(img image.Image, options AlphaOptions) *image.NRGBA {
+	bounds := img.Bounds()
+	result := image.NewNRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	binarize := options.Threshold > 0 || options.Matte != nil
+
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			c, ok := color.NRGBAModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.NRGBA)
+			if !ok || c.A == 0 {
+				continue
+			}
+
+			if options.Premultiplied && c.A < 0xFF {
+				c.R = unpremultiply(c.R, c.A)
+				c.G = unpremultiply(c.G, c.A)
+				c.B = unpremultiply(c.B, c.A)
+			}
+
+			if options.Matte != nil && c.A < 0xFF {
+				c.R = blendChannel(c.R, options.Matte.R, c.A)
+				c.G = blendChannel(c.G, options.Matte.G, c.A)
+				c.B = blendChannel(c.B, options.Matte.B, c.A)
+			}
+
+			if binarize {
+				if c.A < options.Threshold {
+					continue
+				}
+				c.A = 0xFF
+			}
+
+			result.SetNRGBA(x, y, c)
+		}
+	}
+
+	return result
+}
+
+// unpremultiply divides a premultiplied channel by its alpha, clamping to 255
+func unpremultiply(channel, alpha uint8) uint8 {
+	return common.SafeUint32ToUint8(uint32(channel) * 0xFF / uint32(alpha))
+}
+
+// blendChannel composites a straight-alpha channel over a matte channel
+func blendChannel(channel, matte, alpha uint8) uint8 {
+	a := uint32(alpha)
+	return common.SafeUint32ToUint8((uint32(channel)*a + uint32(matte)*(0xFF-a) + 0x7F) / 0xFF)
+}
+
+// ParseHexColor parses an RRGGBB color, with or without a leading '#'
+func ParseHexColor(value string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(value, "#")
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: expected RRGGBB", value)
+	}
+
+	rgb, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid color %q: %w", value, err)
+	}
+
+	return color.RGBA{R: uint8(rgb >> 16), G: uint8(rgb >> 8), B: uint8(rgb), A: 0xFF}, nil
+}
@@ -0,0 +1,75 @@
+// Package psx provides tests for glyph alpha preprocessing.
+package psx
+
+import (
+	"image"
+	"image/color"
+	"testing"
+)
+
+func TestPreprocessAlpha(t *testing.T) {
+	black := color.RGBA{0, 0, 0, 255}
+
+	tests := []struct {
+		name    string
+		input   color.NRGBA
+		options AlphaOptions
+		want    color.NRGBA
+	}{
+		{"disabled keeps partial alpha", color.NRGBA{200, 100, 50, 128}, AlphaOptions{}, color.NRGBA{200, 100, 50, 128}},
+		{"transparent is cleared", color.NRGBA{200, 100, 50, 0}, AlphaOptions{Threshold: 128}, color.NRGBA{}},
+		{"below threshold", color.NRGBA{255, 255, 255, 100}, AlphaOptions{Threshold: 128}, color.NRGBA{}},
+		{"above threshold", color.NRGBA{255, 255, 255, 200}, AlphaOptions{Threshold: 128}, color.NRGBA{255, 255, 255, 255}},
+		{"matte blend", color.NRGBA{255, 255, 255, 128}, AlphaOptions{Matte: &black}, color.NRGBA{128, 128, 128, 255}},
+		{"premultiplied", color.NRGBA{64, 32, 0, 128}, AlphaOptions{Premultiplied: true}, color.NRGBA{127, 63, 0, 128}},
+		{"premultiplied clamps", color.NRGBA{200, 0, 0, 100}, AlphaOptions{Premultiplied: true}, color.NRGBA{255, 0, 0, 100}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := image.NewNRGBA(image.Rect(0, 0, 1, 1))
+			img.SetNRGBA(0, 0, tt.input)
+
+			got := PreprocessAlpha(img, tt.options).NRGBAAt(0, 0)
+			if got != tt.want {
+				t.Errorf("PreprocessAlpha(%v) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCountPartialAlpha(t *testing.T) {
+	img := image.NewNRGBA(image.Rect(0, 0, 3, 1))
+	img.SetNRGBA(0, 0, color.NRGBA{255, 255, 255, 255})
+	img.SetNRGBA(1, 0, color.NRGBA{255, 255, 255, 64})
+	img.SetNRGBA(2, 0, color.NRGBA{})
+
+	if got := CountPartialAlpha(img); got != 1 {
+		t.Errorf("CountPartialAlpha() = %d, want 1", got)
+	}
+}
+
+func TestParseHexColor(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{"#FF8000", color.RGBA{255, 128, 0, 255}, false},
+		{"000010", color.RGBA{0, 0, 16, 255}, false},
+		{"FFF", color.RGBA{}, true},
+		{"GGGGGG", color.RGBA{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseHexColor(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseHexColor(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseHexColor(%q) = %v, want %v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
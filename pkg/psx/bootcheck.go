@@ -0,0 +1,378 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the boot coherency checks for PlayStation CD images:
+// license sector region, SYSTEM.CNF boot path, executable header and TOC sizes.
+package psx
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// PlayStation disc regions
+const (
+	RegionNTSCU   = "NTSC-U"
+	RegionNTSCJ   = "NTSC-J"
+	RegionPAL     = "PAL"
+	RegionUnknown = "unknown"
+)
+
+// Boot check issue severities
+const (
+	BootCheckError   = "error"   // The image will most likely not boot
+	BootCheckWarning = "warning" // Unusual, but consoles and emulators may accept it
+)
+
+// PSX boot layout constants
+const (
+	LICENSE_SECTOR        = 4          // Sector holding the license text
+	PSX_EXE_MAGIC         = "PS-X EXE" // Executable header magic
+	PSX_EXE_REGION_OFFSET = 0x4C       // Offset of the region string in the executable header
+	PSX_SYSTEM_ID         = "PLAYSTATION"
+	SYSTEM_CNF_NAME       = "SYSTEM.CNF"
+	LEGACY_BOOT_NAME      = "PSX.EXE" // Booted when SYSTEM.CNF is absent
+)
+
+// licenseRegions maps the license text of sector 4 (whitespace removed) to regions
+var licenseRegions = []struct {
+	marker string
+	region string
+}{
+	{"SonyComputerEntertainmentAmerica", RegionNTSCU},
+	{"SonyComputerEntertainmentEurope", RegionPAL},
+	{"SonyComputerEntertainmentInc", RegionNTSCJ},
+}
+
+// exeHeaderRegions maps the executable header region string to regions
+var exeHeaderRegions = []struct {
+	marker string
+	region string
+}{
+	{"North America area", RegionNTSCU},
+	{"Europe area", RegionPAL},
+	{"Japan area", RegionNTSCJ},
+}
+
+// executablePrefixes maps product code prefixes of boot executables to regions
+var executablePrefixes = map[string]string{
+	"SCUS": RegionNTSCU, "SLUS": RegionNTSCU,
+	"SCES": RegionPAL, "SLES": RegionPAL, "SCED": RegionPAL, "SLED": RegionPAL,
+	"SCPS": RegionNTSCJ, "SLPS": RegionNTSCJ, "SLPM": RegionNTSCJ, "SCPM": RegionNTSCJ, "SIPS": RegionNTSCJ,
+}
+
+// BootCheckIssue is a single problem found by the boot check
+type BootCheckIssue struct {
+	Severity string `json:"severity"`
+	Check    string `json:"check"`
+	Message  string `json:"message"`
+}
+
+// BootCheckReport summarizes the boot-relevant metadata of a CD image
+type BootCheckReport struct {
+	SystemID         string           `json:"system_id"`
+	VolumeID         string           `json:"volume_id"`
+	VolumeSectors    uint32           `json:"volume_sectors"`
+	ImageSectors     int64            `json:"image_sectors"`
+	LicenseRegion    string           `json:"license_region"`
+	BootPath         string           `json:"boot_path"`
+	BootFile         string           `json:"boot_file"`
+	ExecutableRegion string           `json:"executable_region"`
+	ExeHeaderRegion  string           `json:"exe_header_region"`
+	Issues           []BootCheckIssue `json:"issues"`
+}
+
+// addIssue records a problem in the report
+func (r *BootCheckReport) addIssue(severity, check, format string, args ...interface{}) {
+	r.Issues = append(r.Issues, BootCheckIssue{
+		Severity: severity,
+		Check:    check,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// ErrorCount returns the number of error-severity issues
+func (r *BootCheckReport) ErrorCount() int {
+	count := 0
+	for _, issue := range r.Issues {
+		if issue.Severity == BootCheckError {
+			count++
+		}
+	}
+	return count
+}
+
+// RegionFromLicense identifies the region from the license sector user data
+func RegionFromLicense(data []byte) string {
+	compact := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == 0 {
+			return -1
+		}
+		return r
+	}, string(data))
+
+	for _, license := range licenseRegions {
+		if strings.Contains(compact, license.marker) {
+			return license.region
+		}
+	}
+	return RegionUnknown
+}
+
+// RegionFromExecutableName identifies the region from a product code file name (e.g. SLUS_006.23)
+func RegionFromExecutableName(name string) string {
+	base := strings.ToUpper(path.Base(name))
+	if len(base) < 4 {
+		return RegionUnknown
+	}
+	if region, found := executablePrefixes[base[:4]]; found {
+		return region
+	}
+	return RegionUnknown
+}
+
+// RegionFromExeHeader identifies the region from the string in a PS-X EXE header
+func RegionFromExeHeader(header []byte) string {
+	if len(header) <= PSX_EXE_REGION_OFFSET {
+		return RegionUnknown
+	}
+	text := string(header[PSX_EXE_REGION_OFFSET:])
+	for _, exeRegion := range exeHeaderRegions {
+		if strings.Contains(text, exeRegion.marker) {
+			return exeRegion.region
+		}
+	}
+	return RegionUnknown
+}
+
+// ParseSystemCNF parses SYSTEM.CNF "KEY = VALUE" lines into a map with upper-case keys
+func ParseSystemCNF(data []byte) map[string]string {
+	values := make(map[string]string)
+	for _, line := range strings.Split(string(data), "\n") {
+		key, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		values[strings.ToUpper(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	return values
+}
+
+// BootFilePath converts a SYSTEM.CNF BOOT value (cdrom:\DIR\FILE;1) to an image path (DIR/FILE)
+func BootFilePath(boot string) (string, error) {
+	if !strings.HasPrefix(strings.ToLower(boot), "cdrom:") {
+		return "", fmt.Errorf("boot path %q does not start with cdrom:", boot)
+	}
+
+	filePath := strings.ReplaceAll(boot[len("cdrom:"):], "\\", "/")
+	if idx := strings.Index(filePath, ";"); idx != -1 {
+		filePath = filePath[:idx]
+	}
+	filePath = strings.Trim(filePath, "/ ")
+	if filePath == "" {
+		return "", fmt.Errorf("boot path %q does not name a file", boot)
+	}
+	return filePath, nil
+}
+
+// readSectorData reads the 2048-byte user data of a sector
+func (r *CDReader) readSectorData(lba int64) ([]byte, error) {
+	if err := r.SeekToSector(lba); err != nil {
+		return nil, err
+	}
+	data := make([]byte, CD_DATA_SIZE)
+	if _, err := r.ReadBytes(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// ReadEntry reads the complete contents of a file entry into memory
+func (r *CDReader) ReadEntry(entry CDFileEntry) ([]byte, error) {
+	var buffer bytes.Buffer
+	for _, extent := range entry.Extents {
+		if err := r.copyExtent(&buffer, extent.LBA, extent.Size, entry.XAAttributes); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", entry.Name, err)
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// FindEntry looks up a slash-separated path (case-insensitive) starting at the given directory
+func (r *CDReader) FindEntry(dirLBA uint32, dirSize uint32, filePath string) (CDFileEntry, error) {
+	components := strings.Split(strings.Trim(filePath, "/"), "/")
+	for i, component := range components {
+		entries, err := r.ParseDirectoryEntries(int64(dirLBA), dirSize)
+		if err != nil {
+			return CDFileEntry{}, err
+		}
+
+		found := false
+		for _, entry := range entries {
+			if !strings.EqualFold(entry.Name, component) {
+				continue
+			}
+			if i == len(components)-1 {
+				return entry, nil
+			}
+			if entry.IsDir {
+				dirLBA, dirSize = entry.LBA, entry.Size
+				found = true
+				break
+			}
+		}
+		if !found {
+			break
+		}
+	}
+	return CDFileEntry{}, fmt.Errorf("%s not found", filePath)
+}
+
+// CheckBoot inspects the image for the mistakes that make patched discs unbootable.
+// Problems are reported as issues; an error is only returned if the image cannot be read.
+func (r *CDReader) CheckBoot() (*BootCheckReport, error) {
+	report := &BootCheckReport{
+		ImageSectors:     r.totalSectors,
+		LicenseRegion:    RegionUnknown,
+		ExecutableRegion: RegionUnknown,
+		ExeHeaderRegion:  RegionUnknown,
+		Issues:           []BootCheckIssue{},
+	}
+
+	if size := r.image.Size(); size%int64(r.geometry.SectorSize) != 0 {
+		report.addIssue(BootCheckError, "toc", "image size %d is not a multiple of %d bytes (truncated or not a raw image)",
+			size, r.geometry.SectorSize)
+	}
+	if !r.geometry.IsRaw() {
+		report.addIssue(BootCheckWarning, "toc", "image is %s without sector headers; burning needs a raw %s image",
+			r.geometry.Name, GeometryMode2Raw.Name)
+	}
+
+	if err := r.ValidateISO9660(); err != nil {
+		report.addIssue(BootCheckError, "toc", "no ISO9660 volume descriptor: %v", err)
+		return report, nil
+	}
+	if mode, err := r.DetectTrackMode(); err == nil && mode != TrackMode2 {
+		report.addIssue(BootCheckWarning, "toc", "data track is not Mode 2 (XA); PlayStation discs use MODE2/2352")
+	}
+
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		report.addIssue(BootCheckError, "toc", "failed to read volume descriptor: %v", err)
+		return report, nil
+	}
+	r.checkVolume(report, descriptor)
+	r.checkLicense(report)
+	r.checkBootExecutable(report, descriptor)
+	r.checkRegionCoherence(report)
+
+	return report, nil
+}
+
+// checkVolume compares the volume descriptor against the image size
+func (r *CDReader) checkVolume(report *BootCheckReport, descriptor *ISODescriptor) {
+	report.SystemID = strings.TrimSpace(string(descriptor.SystemID[:]))
+	report.VolumeID = strings.TrimSpace(string(descriptor.VolumeID[:]))
+	report.VolumeSectors = descriptor.VolumeSpaceSizeLSB
+
+	if report.SystemID != PSX_SYSTEM_ID {
+		report.addIssue(BootCheckWarning, "volume", "system identifier is %q, expected %q", report.SystemID, PSX_SYSTEM_ID)
+	}
+	if descriptor.VolumeSpaceSizeLSB != descriptor.VolumeSpaceSizeMSB {
+		report.addIssue(BootCheckError, "toc", "volume size mismatch: little-endian %d, big-endian %d",
+			descriptor.VolumeSpaceSizeLSB, descriptor.VolumeSpaceSizeMSB)
+	}
+	if int64(descriptor.VolumeSpaceSizeLSB) > r.totalSectors {
+		report.addIssue(BootCheckError, "toc", "volume size is %d sectors but the image only has %d",
+			descriptor.VolumeSpaceSizeLSB, r.totalSectors)
+	}
+}
+
+// checkLicense reads the region from the license sectors
+func (r *CDReader) checkLicense(report *BootCheckReport) {
+	data, err := r.readSectorData(LICENSE_SECTOR)
+	if err != nil {
+		report.addIssue(BootCheckError, "license", "failed to read license sector: %v", err)
+		return
+	}
+
+	report.LicenseRegion = RegionFromLicense(data)
+	if report.LicenseRegion == RegionUnknown {
+		report.addIssue(BootCheckError, "license", "license sector %d has no Sony license text (blank or corrupted license data)", LICENSE_SECTOR)
+	}
+}
+
+// checkBootExecutable resolves the boot path from SYSTEM.CNF and validates the executable header
+func (r *CDReader) checkBootExecutable(report *BootCheckReport, descriptor *ISODescriptor) {
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+
+	bootFile := LEGACY_BOOT_NAME
+	cnfEntry, err := r.FindEntry(rootLBA, rootSize, SYSTEM_CNF_NAME)
+	if err == nil {
+		cnfData, err := r.ReadEntry(cnfEntry)
+		if err != nil {
+			report.addIssue(BootCheckError, "system.cnf", "failed to read %s: %v", SYSTEM_CNF_NAME, err)
+			return
+		}
+
+		report.BootPath = ParseSystemCNF(cnfData)["BOOT"]
+		if report.BootPath == "" {
+			report.addIssue(BootCheckError, "system.cnf", "%s has no BOOT line", SYSTEM_CNF_NAME)
+			return
+		}
+
+		bootFile, err = BootFilePath(report.BootPath)
+		if err != nil {
+			report.addIssue(BootCheckError, "system.cnf", "%v", err)
+			return
+		}
+	} else {
+		report.addIssue(BootCheckWarning, "system.cnf", "%s not found in root directory, falling back to %s", SYSTEM_CNF_NAME, LEGACY_BOOT_NAME)
+	}
+
+	exeEntry, err := r.FindEntry(rootLBA, rootSize, bootFile)
+	if err != nil {
+		report.addIssue(BootCheckError, "boot", "boot executable %s not found in the file system", bootFile)
+		return
+	}
+	report.BootFile = bootFile
+	report.ExecutableRegion = RegionFromExecutableName(bootFile)
+
+	for _, extent := range exeEntry.Extents {
+		lastSector := int64(extent.LBA) + int64(DataSectors(extent.Size))
+		if lastSector > r.totalSectors || lastSector > int64(report.VolumeSectors) {
+			report.addIssue(BootCheckError, "toc", "boot executable extent at LBA %d (%d bytes) lies beyond the end of the volume", extent.LBA, extent.Size)
+			return
+		}
+	}
+
+	header, err := r.readSectorData(int64(exeEntry.LBA))
+	if err != nil {
+		report.addIssue(BootCheckError, "boot", "failed to read boot executable: %v", err)
+		return
+	}
+	if !bytes.HasPrefix(header, []byte(PSX_EXE_MAGIC)) {
+		report.addIssue(BootCheckError, "boot", "boot executable %s has no %q header", bootFile, PSX_EXE_MAGIC)
+		return
+	}
+	report.ExeHeaderRegion = RegionFromExeHeader(header)
+}
+
+// checkRegionCoherence compares the regions found in the license, executable name and header
+func (r *CDReader) checkRegionCoherence(report *BootCheckReport) {
+	if report.LicenseRegion == RegionUnknown {
+		return
+	}
+	if report.ExecutableRegion != RegionUnknown && report.ExecutableRegion != report.LicenseRegion {
+		report.addIssue(BootCheckError, "region", "license sectors are %s but boot executable %s is %s",
+			report.LicenseRegion, report.BootFile, report.ExecutableRegion)
+	}
+	if report.ExeHeaderRegion != RegionUnknown && report.ExeHeaderRegion != report.LicenseRegion {
+		report.addIssue(BootCheckWarning, "region", "license sectors are %s but the executable header says %s",
+			report.LicenseRegion, report.ExeHeaderRegion)
+	}
+}
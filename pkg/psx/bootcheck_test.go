@@ -0,0 +1,182 @@
+// Package psx provides tests for CD image boot checks.
+package psx
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// bootImageOptions controls the contents of a synthetic bootable image
+type bootImageOptions struct {
+	license   string
+	systemCNF string
+	exeName   string
+	exeRegion string
+}
+
+// writeDirRecord writes an ISO9660 directory record and returns its length
+func writeDirRecord(data []byte, name string, lba, size uint32, flags byte) int {
+	length := 33 + len(name)
+	if length%2 != 0 {
+		length++
+	}
+	data[0] = byte(length)
+	binary.LittleEndian.PutUint32(data[2:6], lba)
+	binary.BigEndian.PutUint32(data[6:10], lba)
+	binary.LittleEndian.PutUint32(data[10:14], size)
+	binary.BigEndian.PutUint32(data[14:18], size)
+	data[25] = flags
+	data[32] = byte(len(name))
+	copy(data[33:], name)
+	return length
+}
+
+// writeBootImage creates a minimal Mode 2 image with license, PVD, root directory, SYSTEM.CNF and executable
+func writeBootImage(t *testing.T, options bootImageOptions) string {
+	t.Helper()
+
+	const sectors = 24
+	image := make([]byte, sectors*CD_SECTOR_SIZE)
+	sectorData := func(lba int) []byte {
+		raw := image[lba*CD_SECTOR_SIZE : (lba+1)*CD_SECTOR_SIZE]
+		return raw[24 : 24+CD_DATA_SIZE]
+	}
+	for lba := 0; lba < sectors; lba++ {
+		image[lba*CD_SECTOR_SIZE+15] = 2
+	}
+
+	copy(sectorData(LICENSE_SECTOR), options.license)
+
+	pvd := sectorData(16)
+	copy(pvd, "\x01CD001\x01")
+	copy(pvd[8:40], "PLAYSTATION                     ")
+	copy(pvd[40:72], "TOMBA                           ")
+	binary.LittleEndian.PutUint32(pvd[80:84], sectors)
+	binary.BigEndian.PutUint32(pvd[84:88], sectors)
+	writeDirRecord(pvd[156:190], "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+
+	root := sectorData(18)
+	offset := writeDirRecord(root, "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "\x01", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	if options.systemCNF != "" {
+		offset += writeDirRecord(root[offset:], "SYSTEM.CNF;1", 19, uint32(len(options.systemCNF)), 0)
+		copy(sectorData(19), options.systemCNF)
+	}
+	writeDirRecord(root[offset:], options.exeName+";1", 20, CD_DATA_SIZE, 0)
+
+	exe := sectorData(20)
+	copy(exe, PSX_EXE_MAGIC)
+	copy(exe[PSX_EXE_REGION_OFFSET:], "Sony Computer Entertainment Inc. for "+options.exeRegion)
+
+	imagePath := filepath.Join(t.TempDir(), "boot.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestCDReader_CheckBoot(t *testing.T) {
+	const usLicense = "          Licensed  by          Sony Computer Entertainment Amer  ica "
+	const euLicense = "          Licensed  by          Sony Computer Entertainment Euro pe   "
+
+	tests := []struct {
+		name       string
+		options    bootImageOptions
+		wantErrors int
+		wantCheck  string
+	}{
+		{
+			name:    "coherent NTSC-U image",
+			options: bootImageOptions{usLicense, "BOOT = cdrom:\\SLUS_006.23;1\r\nTCB = 4\r\n", "SLUS_006.23", "North America area"},
+		},
+		{
+			name:       "wrong region license",
+			options:    bootImageOptions{euLicense, "BOOT = cdrom:\\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"},
+			wantErrors: 1,
+			wantCheck:  "region",
+		},
+		{
+			name:       "boot path to missing file",
+			options:    bootImageOptions{usLicense, "BOOT = cdrom:\\SLUS_999.99;1\r\n", "SLUS_006.23", "North America area"},
+			wantErrors: 1,
+			wantCheck:  "boot",
+		},
+		{
+			name:       "boot path without cdrom prefix",
+			options:    bootImageOptions{usLicense, "BOOT = \\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"},
+			wantErrors: 1,
+			wantCheck:  "system.cnf",
+		},
+		{
+			name:       "blank license sectors",
+			options:    bootImageOptions{"", "BOOT = cdrom:\\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"},
+			wantErrors: 1,
+			wantCheck:  "license",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewCDReader(writeBootImage(t, tt.options))
+			if err != nil {
+				t.Fatalf("NewCDReader() failed: %v", err)
+			}
+			defer reader.Close()
+
+			report, err := reader.CheckBoot()
+			if err != nil {
+				t.Fatalf("CheckBoot() failed: %v", err)
+			}
+
+			if got := report.ErrorCount(); got != tt.wantErrors {
+				t.Fatalf("ErrorCount() = %d, want %d (issues: %+v)", got, tt.wantErrors, report.Issues)
+			}
+			if tt.wantCheck != "" && report.Issues[0].Check != tt.wantCheck {
+				t.Errorf("Issues[0].Check = %q, want %q", report.Issues[0].Check, tt.wantCheck)
+			}
+		})
+	}
+}
+
+func TestBootFilePath(t *testing.T) {
+	tests := []struct {
+		boot    string
+		want    string
+		wantErr bool
+	}{
+		{"cdrom:\\SLUS_006.23;1", "SLUS_006.23", false},
+		{"cdrom:\\GAME\\MAIN.EXE;1", "GAME/MAIN.EXE", false},
+		{"CDROM:SCES_012.34", "SCES_012.34", false},
+		{"\\SLUS_006.23;1", "", true},
+		{"cdrom:\\", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.boot, func(t *testing.T) {
+			got, err := BootFilePath(tt.boot)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BootFilePath(%q) error = %v, wantErr %v", tt.boot, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("BootFilePath(%q) = %q, want %q", tt.boot, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegionFromExecutableName(t *testing.T) {
+	tests := map[string]string{
+		"SLUS_006.23":      RegionNTSCU,
+		"GAME/sces_012.34": RegionPAL,
+		"SLPS_012.00":      RegionNTSCJ,
+		"MAIN.EXE":         RegionUnknown,
+	}
+
+	for name, want := range tests {
+		if got := RegionFromExecutableName(name); got != want {
+			t.Errorf("RegionFromExecutableName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
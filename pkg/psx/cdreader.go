@@ -3,10 +3,12 @@
 package psx
 
 import (
+	"context"
 	"encoding/binary"
 	"fmt"
 	"io"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"unicode"
@@ -17,80 +19,122 @@ import (
 
 // CDReader provides functionality to read CD image files with mkpsxiso-style parsing
 type CDReader struct {
-	file          *os.File
+	image         ImageBackend
+	geometry      SectorGeometry
 	totalSectors  int64
 	currentSector int64
 	currentOffset int
 	sectorBuffer  []byte
+	cache         *sectorCache // Revisited sectors (nil disables)
+	path          string       // Image file of the data track (empty for a backend opened elsewhere)
+	tracks        []Track      // Tracks of the CUE sheet (nil without one)
+	rawXA         bool         // Extract XA and STR files as whole stored sectors
 }
 
-// NewCDReader creates a new CD reader instance
+// NewCDReader creates a new CD reader instance. Plain, ECM and CHD images are read
+// through the backend OpenImage selects. A .cue file opens its data track, and the
+// tracks of a CUE sheet next to an image (same name) are listed by Tracks.
 func NewCDReader(filename string) (*CDReader, error) {
-	file, err := os.Open(filename)
-	if err != nil {
-		return nil, err
+	if strings.EqualFold(filepath.Ext(filename), ".cue") {
+		return openCueSheet(filename)
 	}
 
-	// Get total sectors
-	fileInfo, err := file.Stat()
+	image, err := OpenImage(filename)
 	if err != nil {
-		file.Close()
 		return nil, err
 	}
-	totalSectors := fileInfo.Size() / CD_SECTOR_SIZE
+	reader := NewCDReaderFromImage(image)
+	reader.path = filename
+	reader.attachCueSheet()
+	return reader, nil
+}
+
+// NewCDReaderFromImage creates a CD reader over an open image backend, such as an
+// OverlayImage. Closing the reader closes the backend. Sectors are cached (see
+// SetDefaultSectorCacheSize), except for an OverlayImage, which changes under the reader.
+func NewCDReaderFromImage(image ImageBackend) *CDReader {
+	geometry := DetectGeometry(image, image.Size())
 
-	return &CDReader{
-		file:          file,
-		totalSectors:  totalSectors,
+	reader := &CDReader{
+		image:         image,
+		geometry:      geometry,
+		totalSectors:  geometry.Sectors(image.Size()),
 		currentSector: -1,
-		sectorBuffer:  make([]byte, CD_SECTOR_SIZE),
-	}, nil
+		sectorBuffer:  make([]byte, geometry.SectorSize),
+	}
+	if _, overlay := image.(*OverlayImage); !overlay {
+		reader.cache = newSectorCache(int(defaultSectorCacheSize.Load()))
+	}
+	return reader
 }
 
-func (r *CDReader) Close() error {
-	if r.file != nil {
-		return r.file.Close()
-	}
-	return nil
+// SetSectorCacheSize replaces the sector cache with an empty one of the given number of
+// sectors (0 or less disables it)
+func (r *CDReader) SetSectorCacheSize(sectors int) {
+	r.cache = newSectorCache(sectors)
+}
+
+// SetRawXA makes file extraction keep the whole sectors of files whose XA attributes mark
+// Form 2 or interleaved sectors (XA audio, STR movies): 2352 bytes per sector from a raw
+// image, 2336 from a MODE2/2336 one. Other files are extracted as data either way.
+func (r *CDReader) SetRawXA(enabled bool) {
+	r.rawXA = enabled
 }
 
-// getDataStart determines the data start offset based on sector mode
-func (r *CDReader) getDataStart() int {
-	if len(r.sectorBuffer) < 16 {
-		return 16 // Default to Mode 1
+// SectorCacheStats returns the counters of the sector cache (zero when disabled)
+func (r *CDReader) SectorCacheStats() SectorCacheStats {
+	if r.cache == nil {
+		return SectorCacheStats{}
 	}
+	return r.cache.snapshot()
+}
 
-	// Check mode byte at position 15
-	mode := r.sectorBuffer[15]
+// Geometry returns the sector geometry detected for the image
+func (r *CDReader) Geometry() SectorGeometry {
+	return r.geometry
+}
 
-	if mode == 1 {
-		// Mode 1: sync(12) + header(4) + data(2048) + edc/ecc(320)
-		return 16
-	} else if mode == 2 {
-		// Mode 2: sync(12) + header(4) + subheader(8) + data(2048) + edc(4) + ecc(276)
-		return 24
-	}
+// ImageSize returns the size in bytes of the plain image
+func (r *CDReader) ImageSize() int64 {
+	return r.image.Size()
+}
+
+// Format returns the format of the image file (one of the ImageFormat values)
+func (r *CDReader) Format() string {
+	return r.image.Format()
+}
 
-	// Default to Mode 1 if unclear
-	return 16
+// Close closes the image backend
+func (r *CDReader) Close() error {
+	if stats := r.SectorCacheStats(); stats.Hits+stats.Misses > 0 {
+		common.LogDebug("Sector cache: %d hits, %d misses (%.0f%%), %d evictions",
+			stats.Hits, stats.Misses, 100*stats.HitRate(), stats.Evictions)
+	}
+	if r.image != nil {
+		return r.image.Close()
+	}
+	return nil
 }
 
 // SeekToSector seeks to a specific sector - based on mkpsxiso SeekToSector
 func (r *CDReader) SeekToSector(lba int64) error {
+	return r.loadSector(lba, r.cache)
+}
+
+// loadSector reads a sector into the buffer through cache (nil reads the image directly)
+func (r *CDReader) loadSector(lba int64, cache *sectorCache) error {
 	if lba >= r.totalSectors || lba < 0 {
 		return fmt.Errorf("LBA %d out of bounds (total: %d)", lba, r.totalSectors)
 	}
 
-	offset := lba * CD_SECTOR_SIZE
-	_, err := r.file.Seek(offset, io.SeekStart)
-	if err != nil {
-		return err
-	}
-
 	// Read the sector into buffer
-	_, err = io.ReadFull(r.file, r.sectorBuffer)
-	if err != nil {
-		return err
+	if cache == nil || !cache.get(lba, r.sectorBuffer) {
+		if _, err := r.image.ReadAt(r.sectorBuffer, r.geometry.SectorOffset(lba)); err != nil {
+			return err
+		}
+		if cache != nil {
+			cache.put(lba, r.sectorBuffer)
+		}
 	}
 
 	r.currentSector = lba
@@ -113,7 +157,7 @@ func (r *CDReader) ReadBytes(buffer []byte) (int, error) {
 
 		// Calculate available bytes in current sector (skip CD header/footer)
 		// Auto-detect sector mode based on current sector content
-		dataStart := r.getDataStart()
+		dataStart := r.geometry.DataOffset
 		available := CD_DATA_SIZE - r.currentOffset
 
 		if available <= 0 {
@@ -141,22 +185,23 @@ func (r *CDReader) ReadBytes(buffer []byte) (int, error) {
 
 // ValidateISO9660 - Check if file has valid ISO9660 header
 func (r *CDReader) ValidateISO9660() error {
-	err := r.SeekToSector(16) // Primary Volume Descriptor at sector 16
+	// Primary Volume Descriptor at sector 16; an image too short to hold it is no ISO9660 image
+	err := r.SeekToSector(16)
 	if err != nil {
-		return err
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("no primary volume descriptor: %w", err))
 	}
 
 	header := make([]byte, 7)
 	_, err = r.ReadBytes(header)
 	if err != nil {
-		return err
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("no primary volume descriptor: %w", err))
 	}
 
 	// Check for ISO9660 signature: 0x01 + "CD001" + 0x01
 	expected := []byte{0x01, 0x43, 0x44, 0x30, 0x30, 0x31, 0x01}
 	for i, b := range expected {
 		if header[i] != b {
-			return fmt.Errorf("invalid ISO9660 signature at byte %d: got 0x%02X, expected 0x%02X", i, header[i], b)
+			return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid ISO9660 signature at byte %d: got 0x%02X, expected 0x%02X", i, header[i], b))
 		}
 	}
 
@@ -200,6 +245,8 @@ func (r *CDReader) ReadISODescriptor() (*ISODescriptor, error) {
 	descriptor.PathTable1MSBOffs = binary.BigEndian.Uint32(data[148:152])
 	descriptor.PathTable2MSBOffs = binary.BigEndian.Uint32(data[152:156])
 	copy(descriptor.RootDirRecord[:], data[156:190])
+	copy(descriptor.VolumeCreateDate[:], data[813:830])
+	copy(descriptor.VolumeModifyDate[:], data[830:847])
 
 	return descriptor, nil
 }
@@ -211,7 +258,7 @@ func (r *CDReader) ReadPathTable(lba uint32, size uint32) ([]PathTableEntry, err
 	}
 
 	// Calculate number of sectors needed
-	sectorsNeeded := (size + CD_DATA_SIZE - 1) / CD_DATA_SIZE
+	sectorsNeeded := DataSectors(size)
 
 	var pathData []byte
 	for i := uint32(0); i < sectorsNeeded; i++ {
@@ -297,7 +344,7 @@ func (r *CDReader) ReadPathTable(lba uint32, size uint32) ([]PathTableEntry, err
 // ParseDirectoryEntries parses directory entries based on mkpsxiso ReadDirEntries implementation
 func (r *CDReader) ParseDirectoryEntries(lba int64, sizeInBytes uint32) ([]CDFileEntry, error) {
 	var entries []CDFileEntry
-	sizeInSectors := (sizeInBytes + CD_DATA_SIZE - 1) / CD_DATA_SIZE
+	sizeInSectors := DataSectors(sizeInBytes)
 	numEntries := 0 // Track entries to skip . and ..
 
 	for sector := uint32(0); sector < sizeInSectors; sector++ {
@@ -309,11 +356,14 @@ func (r *CDReader) ParseDirectoryEntries(lba int64, sizeInBytes uint32) ([]CDFil
 		r.currentOffset = 0 // Reset offset for new sector
 
 		for {
+			recordOffset := r.currentOffset
 			entry, entrySize, err := r.readDirectoryEntry()
 			if err != nil {
 				// End of sector or invalid entry
 				break
 			}
+			entry.Extents[0].recordLBA = uint32(lba) + sector
+			entry.Extents[0].recordOffset = recordOffset
 
 			// Skip first two entries (. and ..) - following mkpsxiso pattern
 			if numEntries >= 2 {
@@ -322,7 +372,7 @@ func (r *CDReader) ParseDirectoryEntries(lba int64, sizeInBytes uint32) ([]CDFil
 					entries = append(entries, entry)
 				} else {
 					// Log but continue - following mkpsxiso behavior for corrupted entries
-					if common.VerboseMode {
+					if common.IsVerbose() {
 						fmt.Printf("DEBUG: Skipping invalid entry: %s (LBA: %d, Size: %d)\n",
 							entry.Name, entry.LBA, entry.Size)
 					}
@@ -340,7 +390,31 @@ func (r *CDReader) ParseDirectoryEntries(lba int64, sizeInBytes uint32) ([]CDFil
 		}
 	}
 
-	return entries, nil
+	return mergeMultiExtentEntries(entries), nil
+}
+
+// mergeMultiExtentEntries joins consecutive records of the same file into one entry.
+// ISO9660 stores files larger than one extent as several directory records with the
+// same name, where every record except the last carries the multi-extent flag.
+func mergeMultiExtentEntries(entries []CDFileEntry) []CDFileEntry {
+	merged := make([]CDFileEntry, 0, len(entries))
+
+	for _, entry := range entries {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			if last.multiExtent && last.Name == entry.Name {
+				last.Extents = append(last.Extents, entry.Extents...)
+				last.Size += entry.Size
+				last.ExtentSize += entry.ExtentSize
+				last.multiExtent = entry.multiExtent
+				common.LogDebug("Merged extent %d of %s (LBA %d, %d bytes)", len(last.Extents), entry.Name, entry.LBA, entry.Size)
+				continue
+			}
+		}
+		merged = append(merged, entry)
+	}
+
+	return merged
 }
 
 // Read single directory entry based on mkpsxiso ReadEntry
@@ -351,7 +425,7 @@ func (r *CDReader) readDirectoryEntry() (CDFileEntry, int, error) {
 	}
 
 	// Read entry length
-	dataStart := 24 // Skip sync + header + subheader
+	dataStart := r.geometry.DataOffset
 	if dataStart+r.currentOffset >= len(r.sectorBuffer) {
 		return CDFileEntry{}, 0, fmt.Errorf("buffer overflow")
 	}
@@ -414,16 +488,35 @@ func (r *CDReader) parseEntryData(data []byte) (CDFileEntry, error) {
 		Name:       filename,
 		LBA:        uint32(lbaLE),
 		Size:       uint32(sizeLE),
-		IsDir:      (flags & 0x02) != 0,
-		ExtentSize: common.GetSizeInSectors(uint32(sizeLE)),
+		IsDir:      (flags & ISO_FLAG_DIRECTORY) != 0,
+		Hidden:     (flags & ISO_FLAG_HIDDEN) != 0,
+		ExtentSize: DataSectors(uint32(sizeLE)),
+		Extents:    []CDFileExtent{{LBA: lbaLE, Size: sizeLE}},
+
+		XAAttributes: parseXAAttributes(data[33+int(filenameLength) : length]),
+
+		multiExtent: (flags & ISO_FLAG_MULTI_EXTENT) != 0,
 	}
 
 	// Set MSF
-	entry.MSF = common.LBAToMSF(entry.LBA)
+	entry.MSF = LBAToMSF(entry.LBA)
 
 	return entry, nil
 }
 
+// parseXAAttributes returns the attributes of the CD-XA record in the system use field of
+// a directory record (the bytes after the file identifier), or 0 without an XA record
+func parseXAAttributes(systemUse []byte) uint16 {
+	// A padding byte keeps the system use field at an even offset
+	if len(systemUse)%2 != 0 {
+		systemUse = systemUse[1:]
+	}
+	if len(systemUse) < XA_RECORD_SIZE || systemUse[6] != 'X' || systemUse[7] != 'A' {
+		return 0
+	}
+	return binary.BigEndian.Uint16(systemUse[4:6])
+}
+
 // Clean identifier following mkpsxiso style
 func (r *CDReader) cleanIdentifier(name string) string {
 	// Remove version suffix (;1) common in ISO9660
@@ -500,20 +593,139 @@ func (r *CDReader) isValidFilename(name string) bool {
 }
 
 // ExtractFile extracts a single file from the CD image with improved error handling
-func (r *CDReader) ExtractFile(lba uint32, fileSize uint32, outputPath string) error {
+func (r *CDReader) ExtractFile(ctx context.Context, lba uint32, fileSize uint32, outputPath string) error {
+	return r.ExtractEntry(ctx, CDFileEntry{LBA: lba, Size: fileSize}, outputPath, nil)
+}
+
+// CopyEntry writes the contents of a file entry to the writer, concatenating all of its extents
+func (r *CDReader) CopyEntry(entry CDFileEntry, writer io.Writer) error {
+	extents := entry.extents()
+	for _, extent := range extents {
+		if err := r.copyExtent(writer, extent.LBA, extent.Size, entry.XAAttributes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExtractEntry extracts a file entry from the CD image, concatenating all of its extents.
+// The file is committed as part of batch, or on its own when batch is nil.
+func (r *CDReader) ExtractEntry(ctx context.Context, entry CDFileEntry, outputPath string, batch *common.AtomicBatch) error {
+	extents := entry.extents()
+
 	// Create output directory
 	dir := filepath.Dir(outputPath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return fmt.Errorf("failed to create directory %s: %w", dir, err)
 	}
 
-	// Create output file
-	outFile, err := os.Create(outputPath)
+	// Create output file; it only appears under its name once fully extracted
+	create := common.CreateAtomic
+	if batch != nil {
+		create = batch.Create
+	}
+	outFile, err := create(outputPath)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create file %s: %w", outputPath, err))
+	}
+	defer outFile.Abort()
+
+	var total int64
+	for _, extent := range extents {
+		total += r.extentOutputSize(extent.Size, entry.XAAttributes)
+	}
+	writer := common.NewProgressWriter(ctx, outFile, outputPath, total)
+	for _, extent := range extents {
+		if err := r.copyExtent(writer, extent.LBA, extent.Size, entry.XAAttributes); err != nil {
+			return err
+		}
+	}
+
+	return outFile.Commit()
+}
+
+// ListFiles walks the directory tree from the root and returns every file entry,
+// with Path set to its full slash-separated path (e.g. DATA/STAGE01.GAM)
+func (r *CDReader) ListFiles() ([]CDFileEntry, error) {
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ISO descriptor: %w", err)
+	}
+
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+
+	var files []CDFileEntry
+	if err := r.listDirectory(rootLBA, rootSize, "", make(map[uint32]bool), &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// listDirectory appends the files of a directory and its subdirectories to files
+func (r *CDReader) listDirectory(lba, size uint32, dirPath string, visited map[uint32]bool, files *[]CDFileEntry) error {
+	if visited[lba] {
+		return nil
+	}
+	visited[lba] = true
+
+	entries, err := r.ParseDirectoryEntries(int64(lba), size)
 	if err != nil {
-		return fmt.Errorf("failed to create file %s: %w", outputPath, err)
+		return fmt.Errorf("failed to parse directory %s/: %w", dirPath, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Name == "." || entry.Name == ".." {
+			continue
+		}
+		if entry.IsDir {
+			if err := r.listDirectory(entry.LBA, entry.Size, path.Join(dirPath, entry.Name), visited, files); err != nil {
+				common.LogWarn("%v", err)
+			}
+			continue
+		}
+		entry.Path = path.Join(dirPath, entry.Name)
+		*files = append(*files, entry)
+	}
+	return nil
+}
+
+// wholeSectors reports whether the sectors of a file with the given XA attributes are
+// extracted whole (see SetRawXA)
+func (r *CDReader) wholeSectors(xaAttributes uint16) bool {
+	return r.rawXA && r.geometry.HasSubheader() && xaAttributes&(XA_ATTR_FORM2|XA_ATTR_INTERLEAVED) != 0
+}
+
+// extentOutputSize returns the expected bytes extracted from an extent, counting the
+// sectors of a Form 2 file at their stored size with SetRawXA
+func (r *CDReader) extentOutputSize(size uint32, xaAttributes uint16) int64 {
+	if r.wholeSectors(xaAttributes) {
+		return int64(DataSectors(size)) * int64(r.geometry.SectorSize)
+	}
+	return int64(size)
+}
+
+// sectorFileData returns the file data of the loaded sector, with bytesLeft bytes of the
+// extent still to read. The size of a directory record counts 2048 bytes per sector, so a
+// Form 2 sector (submode of its subheader) holds 2324 bytes of data where a Form 1 sector
+// holds 2048; ISO images keep no subheaders and only hold Form 1 data.
+func (r *CDReader) sectorFileData(bytesLeft uint32, xaAttributes uint16) []byte {
+	if r.wholeSectors(xaAttributes) {
+		return r.sectorBuffer
+	}
+
+	dataStart := r.geometry.DataOffset
+	if r.geometry.HasSubheader() {
+		if r.sectorBuffer[dataStart-CD_SUBHEADER_SIZE+XA_SUBMODE_OFFSET]&XA_SUBMODE_FORM2 != 0 {
+			return r.sectorBuffer[dataStart : dataStart+XA_FORM2_DATA_SIZE]
+		}
 	}
-	defer outFile.Close()
+	return r.sectorBuffer[dataStart : dataStart+int(min(bytesLeft, CD_DATA_SIZE))]
+}
 
+// copyExtent writes the data of a contiguous run of sectors to the writer. Every sector
+// counts 2048 bytes of fileSize, whatever the bytes sectorFileData extracts from it.
+func (r *CDReader) copyExtent(writer io.Writer, lba uint32, fileSize uint32, xaAttributes uint16) error {
 	// Validate LBA bounds
 	if int64(lba) >= r.totalSectors {
 		return fmt.Errorf("LBA %d out of bounds (total sectors: %d)", lba, r.totalSectors)
@@ -521,47 +733,23 @@ func (r *CDReader) ExtractFile(lba uint32, fileSize uint32, outputPath string) e
 
 	// Copy file data sector by sector
 	bytesLeft := fileSize
-	totalWritten := uint32(0)
+	totalWritten := int64(0)
 	currentSector := int64(lba)
 
 	for bytesLeft > 0 {
-		// Seek to current sector
-		if err := r.SeekToSector(currentSector); err != nil {
+		// Seek to current sector; file data is read once, so it bypasses the sector cache
+		if err := r.loadSector(currentSector, nil); err != nil {
 			return fmt.Errorf("failed to seek to sector %d: %w", currentSector, err)
 		}
 
-		// Calculate how much to read from current sector
-		bytesToRead := uint32(CD_DATA_SIZE)
-		if bytesToRead > bytesLeft {
-			bytesToRead = bytesLeft
-		}
-
-		// Debug output (commented out for production)
-		// fmt.Printf("DEBUG: bytesLeft=%d, currentSector=%d, bytesToRead=%d\n", bytesLeft, currentSector, bytesToRead)
-
-		// Read data from current sector
-		buffer := make([]byte, bytesToRead)
-		bytesRead, err := r.ReadBytes(buffer)
-		if err != nil {
-			return fmt.Errorf("failed to read data at sector %d: %w", currentSector, err)
-		}
-
-		// Only write the bytes we actually read
-		if bytesRead > 0 {
-			_, err = outFile.Write(buffer[:bytesRead])
-			if err != nil {
-				return fmt.Errorf("failed to write data at offset %d: %w", totalWritten, err)
-			}
+		data := r.sectorFileData(bytesLeft, xaAttributes)
+		if _, err := writer.Write(data); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write data at offset %d: %w", totalWritten, err))
 		}
 
-		bytesLeft -= uint32(bytesRead)
-		totalWritten += uint32(bytesRead)
+		bytesLeft -= min(bytesLeft, CD_DATA_SIZE)
+		totalWritten += int64(len(data))
 		currentSector++
-
-		// Safety check to prevent infinite loops
-		if bytesRead == 0 {
-			break
-		}
 	}
 
 	return nil
@@ -593,10 +781,12 @@ func (r *CDReader) ReadSector() (*SectorM2F1, error) {
 	}
 
 	// Copy data to sector structure
-	copy(sector.Sync[:], r.sectorBuffer[0:12])
-	copy(sector.Address[:], r.sectorBuffer[12:15])
-	sector.Mode = r.sectorBuffer[15]
-	dataStart := r.getDataStart()
+	if r.geometry.IsRaw() {
+		copy(sector.Sync[:], r.sectorBuffer[0:CD_SYNC_SIZE])
+		copy(sector.Address[:], r.sectorBuffer[CD_SYNC_SIZE:CD_SYNC_SIZE+3])
+		sector.Mode = r.sectorBuffer[CD_SYNC_SIZE+3]
+	}
+	dataStart := r.geometry.DataOffset
 	copy(sector.Data[:], r.sectorBuffer[dataStart:dataStart+CD_DATA_SIZE])
 
 	return sector, nil
@@ -608,9 +798,9 @@ func (r *CDReader) ReadDataFromSector() ([]byte, error) {
 		return nil, fmt.Errorf("no sector loaded")
 	}
 
-	// For Mode 2 sectors, data starts at offset 24
+	dataStart := r.geometry.DataOffset
 	data := make([]byte, CD_DATA_SIZE)
-	copy(data, r.sectorBuffer[24:24+CD_DATA_SIZE])
+	copy(data, r.sectorBuffer[dataStart:dataStart+CD_DATA_SIZE])
 	return data, nil
 }
 
@@ -628,5 +818,83 @@ type CDFileEntry struct {
 	MSF        string // Minutes:Seconds:Frames format
 	Size       uint32 // File size in bytes
 	IsDir      bool   // Whether this is a directory
+	Hidden     bool   // Whether the record has the hidden (existence) flag
 	ExtentSize uint32 // Size in sectors
+
+	XAAttributes uint16 // CD-XA attributes of the system use field (0 without an XA record)
+
+	Extents     []CDFileExtent // Extents in file order (one entry for regular files)
+	multiExtent bool           // Record has the multi-extent flag (more records follow)
+}
+
+// CDFileExtent is a contiguous run of sectors holding part of a file
+type CDFileExtent struct {
+	LBA  uint32 // First sector of the extent
+	Size uint32 // Extent size in bytes
+
+	recordLBA    uint32 // Sector holding the directory record of the extent
+	recordOffset int    // Offset of the directory record within the user data of that sector
+}
+
+// IsMultiExtent reports whether the file is split across several extents
+func (e CDFileEntry) IsMultiExtent() bool {
+	return len(e.Extents) > 1
+}
+
+// extents returns the extents of the file, or a single extent at its LBA for entries
+// built without them
+func (e CDFileEntry) extents() []CDFileExtent {
+	if len(e.Extents) == 0 {
+		return []CDFileExtent{{LBA: e.LBA, Size: e.Size}}
+	}
+	return e.Extents
+}
+
+// extentCapacities returns the bytes each extent of the file can hold when it is
+// rewritten in place. Every extent but the last is full, as ISO9660 requires, so it keeps
+// its size; the last one may grow to the end of its last sector.
+func (e CDFileEntry) extentCapacities() []uint32 {
+	extents := e.extents()
+	capacities := make([]uint32, len(extents))
+	for i, extent := range extents {
+		capacities[i] = extent.Size
+		if i == len(extents)-1 {
+			capacities[i] = DataSectors(extent.Size) * CD_DATA_SIZE
+		}
+	}
+	return capacities
+}
+
+// writeExtentRuns splits data written at offset of the file into the runs that fall
+// within each of its extents and calls write with the LBA of the extent and the offset of
+// the run within it. Data past the capacity of the last extent is an error, reported
+// before anything is written.
+func (e CDFileEntry) writeExtentRuns(offset uint32, data []byte, write func(lba, offset uint32, data []byte) error) error {
+	extents := e.extents()
+	capacities := e.extentCapacities()
+	total := uint64(0)
+	for _, capacity := range capacities {
+		total += uint64(capacity)
+	}
+	if uint64(offset)+uint64(len(data)) > total {
+		return fmt.Errorf("%d bytes at offset %d run past the %d sectors of %s", len(data), offset, total/CD_DATA_SIZE, e.Name)
+	}
+
+	position := uint64(offset)
+	for i, capacity := range capacities {
+		if len(data) == 0 {
+			break
+		}
+		if position >= uint64(capacity) {
+			position -= uint64(capacity)
+			continue
+		}
+		run := min(uint64(len(data)), uint64(capacity)-position)
+		if err := write(extents[i].LBA, uint32(position), data[:run]); err != nil {
+			return err
+		}
+		data = data[run:]
+		position = 0
+	}
+	return nil
 }
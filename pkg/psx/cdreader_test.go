@@ -0,0 +1,296 @@
+// Package psx provides tests for CD image reading functionality.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// writeTestImage creates a Mode 2 image whose sector N data is filled with byte N
+func writeTestImage(t *testing.T, sectors int) string {
+	t.Helper()
+
+	image := make([]byte, sectors*CD_SECTOR_SIZE)
+	for sector := 0; sector < sectors; sector++ {
+		raw := image[sector*CD_SECTOR_SIZE : (sector+1)*CD_SECTOR_SIZE]
+		raw[15] = 2
+		for i := 24; i < 24+CD_DATA_SIZE; i++ {
+			raw[i] = byte(sector)
+		}
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "test.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestMergeMultiExtentEntries(t *testing.T) {
+	entries := []CDFileEntry{
+		{Name: "BIG.STR", LBA: 10, Size: 2048, ExtentSize: 1, Extents: []CDFileExtent{{LBA: 10, Size: 2048}}, multiExtent: true},
+		{Name: "BIG.STR", LBA: 20, Size: 2048, ExtentSize: 1, Extents: []CDFileExtent{{LBA: 20, Size: 2048}}, multiExtent: true},
+		{Name: "BIG.STR", LBA: 30, Size: 100, ExtentSize: 1, Extents: []CDFileExtent{{LBA: 30, Size: 100}}},
+		{Name: "SMALL.DAT", LBA: 40, Size: 10, ExtentSize: 1, Extents: []CDFileExtent{{LBA: 40, Size: 10}}},
+	}
+
+	merged := mergeMultiExtentEntries(entries)
+	if len(merged) != 2 {
+		t.Fatalf("len(merged) = %d, want 2", len(merged))
+	}
+
+	big := merged[0]
+	if !big.IsMultiExtent() || len(big.Extents) != 3 {
+		t.Errorf("BIG.STR extents = %v, want 3 extents", big.Extents)
+	}
+	if big.Size != 4196 || big.LBA != 10 || big.ExtentSize != 3 {
+		t.Errorf("BIG.STR = LBA %d, size %d, sectors %d, want LBA 10, size 4196, sectors 3", big.LBA, big.Size, big.ExtentSize)
+	}
+
+	if merged[1].IsMultiExtent() {
+		t.Error("SMALL.DAT.IsMultiExtent() = true, want false")
+	}
+}
+
+func TestCDReader_ExtractEntry_MultiExtent(t *testing.T) {
+	reader, err := NewCDReader(writeTestImage(t, 4))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	entry := CDFileEntry{
+		Name:    "FRAG.DAT",
+		LBA:     3,
+		Size:    CD_DATA_SIZE + 10,
+		Extents: []CDFileExtent{{LBA: 3, Size: CD_DATA_SIZE}, {LBA: 1, Size: 10}},
+	}
+
+	outputPath := filepath.Join(t.TempDir(), "FRAG.DAT")
+	if err := reader.ExtractEntry(context.Background(), entry, outputPath, nil); err != nil {
+		t.Fatalf("ExtractEntry() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatalf("failed to read extracted file: %v", err)
+	}
+
+	expected := append(bytes.Repeat([]byte{3}, CD_DATA_SIZE), bytes.Repeat([]byte{1}, 10)...)
+	if !bytes.Equal(data, expected) {
+		t.Errorf("extracted %d bytes, want %d bytes from sectors 3 and 1", len(data), len(expected))
+	}
+}
+
+func TestCDReader_CopyEntry_Form2(t *testing.T) {
+	imagePath := writeTestImage(t, 4)
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sector 2 is a Form 2 sector whose 2324 bytes of data are filled with 0xF2
+	raw := image[2*CD_SECTOR_SIZE : 3*CD_SECTOR_SIZE]
+	raw[18], raw[22] = XA_SUBMODE_FORM2|XA_SUBMODE_AUDIO, XA_SUBMODE_FORM2|XA_SUBMODE_AUDIO
+	copy(raw[24:], bytes.Repeat([]byte{0xF2}, XA_FORM2_DATA_SIZE))
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	entry := CDFileEntry{Name: "VOICE.XA", LBA: 1, Size: 2 * CD_DATA_SIZE, XAAttributes: XA_ATTR_FORM2 | XA_ATTR_INTERLEAVED}
+	var buffer bytes.Buffer
+	if err := reader.CopyEntry(entry, &buffer); err != nil {
+		t.Fatalf("CopyEntry() failed: %v", err)
+	}
+	expected := append(bytes.Repeat([]byte{1}, CD_DATA_SIZE), bytes.Repeat([]byte{0xF2}, XA_FORM2_DATA_SIZE)...)
+	if !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("CopyEntry() = %d bytes, want 2048 bytes of sector 1 and 2324 bytes of sector 2", buffer.Len())
+	}
+
+	// With SetRawXA the sectors of a Form 2 file are kept whole, those of other files are not
+	reader.SetRawXA(true)
+	buffer.Reset()
+	if err := reader.CopyEntry(entry, &buffer); err != nil {
+		t.Fatalf("CopyEntry() failed: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), image[CD_SECTOR_SIZE:3*CD_SECTOR_SIZE]) {
+		t.Errorf("CopyEntry() with SetRawXA = %d bytes, want raw sectors 1 and 2", buffer.Len())
+	}
+	buffer.Reset()
+	entry.XAAttributes = XA_ATTR_FORM1
+	if err := reader.CopyEntry(entry, &buffer); err != nil {
+		t.Fatalf("CopyEntry() failed: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), expected) {
+		t.Errorf("CopyEntry() of a Form 1 file with SetRawXA = %d bytes, want %d", buffer.Len(), len(expected))
+	}
+}
+
+func TestCDReader_CopyEntry_Mode1Raw(t *testing.T) {
+	// The sync pattern before the user data of a Mode 1 sector is no XA subheader
+	imagePath := writeGeometryImage(t, GeometryMode1Raw, 20)
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for offset := 0; offset < len(image); offset += CD_SECTOR_SIZE {
+		copy(image[offset:], cdSyncPattern[:])
+	}
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+	reader.SetRawXA(true)
+
+	var buffer bytes.Buffer
+	if err := reader.CopyEntry(CDFileEntry{Name: "SMALL.DAT", LBA: 5, Size: 100, XAAttributes: XA_ATTR_FORM2}, &buffer); err != nil {
+		t.Fatalf("CopyEntry() failed: %v", err)
+	}
+	if !bytes.Equal(buffer.Bytes(), bytes.Repeat([]byte{5}, 100)) {
+		t.Errorf("CopyEntry() = %d bytes, want the 100 bytes of sector 5", buffer.Len())
+	}
+}
+
+func TestCDReader_ValidateISO9660_NotISO(t *testing.T) {
+	// An image too short for a volume descriptor and one without the CD001 signature
+	for _, sectors := range []int{4, 20} {
+		reader, err := NewCDReader(writeTestImage(t, sectors))
+		if err != nil {
+			t.Fatalf("NewCDReader() failed: %v", err)
+		}
+		if err := reader.ValidateISO9660(); common.ExitCodeFor(err) != common.ExitFormatError {
+			t.Errorf("%d sectors: ValidateISO9660() error = %v, want a format error", sectors, err)
+		}
+		if sectors == 4 {
+			if _, err := reader.VerifyISO9660(false); common.ExitCodeFor(err) != common.ExitFormatError {
+				t.Errorf("VerifyISO9660() error = %v, want a format error", err)
+			}
+		}
+		reader.Close()
+	}
+}
+
+func TestCDReader_ListFiles(t *testing.T) {
+	const license = "          Licensed  by          Sony Computer Entertainment Amer  ica "
+	reader, err := NewCDReader(writeBootImage(t, bootImageOptions{license, "BOOT = cdrom:\\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"}))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	files, err := reader.ListFiles()
+	if err != nil {
+		t.Fatalf("ListFiles() failed: %v", err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	want := []string{"SYSTEM.CNF", "SLUS_006.23"}
+	if len(paths) != len(want) || paths[0] != want[0] || paths[1] != want[1] {
+		t.Errorf("ListFiles() paths = %v, want %v", paths, want)
+	}
+}
+
+func TestParseXAAttributes(t *testing.T) {
+	xaRecord := []byte{0, 0, 0, 0, 0x38, 0x00, 'X', 'A', 1, 0, 0, 0, 0, 0}
+
+	tests := []struct {
+		name      string
+		systemUse []byte
+		want      uint16
+	}{
+		{"after padding byte", append([]byte{0}, xaRecord...), 0x3800},
+		{"without padding", xaRecord, 0x3800},
+		{"no system use", nil, 0},
+		{"no XA signature", make([]byte, XA_RECORD_SIZE), 0},
+	}
+
+	for _, tt := range tests {
+		if got := parseXAAttributes(tt.systemUse); got != tt.want {
+			t.Errorf("%s: parseXAAttributes() = 0x%04X, want 0x%04X", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSectorPayload(t *testing.T) {
+	tests := []struct {
+		attributes uint16
+		want       uint32
+	}{
+		{0, CD_DATA_SIZE},
+		{XA_ATTR_FORM1, CD_DATA_SIZE},
+		{XA_ATTR_FORM1 | XA_ATTR_FORM2 | XA_ATTR_INTERLEAVED, CD_XA_DATA_SIZE},
+		{XA_ATTR_CDDA, CD_SECTOR_SIZE},
+	}
+
+	for _, tt := range tests {
+		if got := SectorPayload(tt.attributes); got != tt.want {
+			t.Errorf("SectorPayload(0x%04X) = %d, want %d", tt.attributes, got, tt.want)
+		}
+	}
+	if got := PayloadSectors(3*CD_XA_DATA_SIZE, CD_XA_DATA_SIZE); got != 3 {
+		t.Errorf("PayloadSectors() = %d, want 3", got)
+	}
+}
+
+func TestCDReader_SectorCache(t *testing.T) {
+	imagePath := writeTestImage(t, 4)
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+	reader.SetSectorCacheSize(2)
+
+	// 0 and 1 miss, 0 hits, 2 evicts 1, 1 misses again and evicts 0
+	for _, lba := range []int64{0, 1, 0, 2, 1} {
+		if err := reader.SeekToSector(lba); err != nil {
+			t.Fatalf("SeekToSector(%d) failed: %v", lba, err)
+		}
+		data, err := reader.ReadDataFromSector()
+		if err != nil {
+			t.Fatalf("ReadDataFromSector() failed: %v", err)
+		}
+		if data[0] != byte(lba) || data[CD_DATA_SIZE-1] != byte(lba) {
+			t.Errorf("sector %d holds byte %d, want %d", lba, data[0], lba)
+		}
+	}
+
+	// File data bypasses the cache
+	entry := CDFileEntry{Name: "FILE.DAT", LBA: 3, Size: CD_DATA_SIZE, Extents: []CDFileExtent{{LBA: 3, Size: CD_DATA_SIZE}}}
+	if err := reader.ExtractEntry(context.Background(), entry, filepath.Join(t.TempDir(), "FILE.DAT"), nil); err != nil {
+		t.Fatalf("ExtractEntry() failed: %v", err)
+	}
+
+	want := SectorCacheStats{Capacity: 2, Cached: 2, Hits: 1, Misses: 4, Evictions: 2}
+	if stats := reader.SectorCacheStats(); stats != want {
+		t.Errorf("SectorCacheStats() = %+v, want %+v", stats, want)
+	}
+
+	base, err := OpenImage(imagePath)
+	if err != nil {
+		t.Fatalf("OpenImage() failed: %v", err)
+	}
+	overlayReader := NewCDReaderFromImage(NewOverlayImage(base))
+	defer overlayReader.Close()
+	if stats := overlayReader.SectorCacheStats(); stats.Capacity != 0 {
+		t.Errorf("overlay reader cache capacity = %d, want 0 (disabled)", stats.Capacity)
+	}
+}
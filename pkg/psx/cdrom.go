@@ -4,11 +4,54 @@ package psx
 
 // Sector size constants for PlayStation CD-ROM
 const (
-	CD_SECTOR_SIZE  = 2352 // Full CD sector size
-	CD_DATA_SIZE    = 2048 // Data portion of Mode 1 sector
-	CD_XA_DATA_SIZE = 2336 // Data portion of Mode 2 Form 2 sector
-	CD_SYNC_SIZE    = 12   // Sync pattern size
-	CD_HEADER_SIZE  = 4    // Header size (3 address bytes + 1 mode byte)
+	CD_SECTOR_SIZE    = 2352 // Full CD sector size
+	CD_DATA_SIZE      = 2048 // Data portion of Mode 1 sector
+	CD_XA_DATA_SIZE   = 2336 // Data portion of Mode 2 Form 2 sector
+	CD_SYNC_SIZE      = 12   // Sync pattern size
+	CD_HEADER_SIZE    = 4    // Header size (3 address bytes + 1 mode byte)
+	CD_SUBHEADER_SIZE = 8    // XA subheader size of Mode 2 sectors
+	CD_MODE_OFFSET    = 15   // Offset of the mode byte in a raw sector
+)
+
+// CD addressing constants
+const (
+	CD_PREGAP_SECTORS     = 150 // Pregap length in sectors (2 seconds) before the first data track
+	CD_FRAMES_PER_SECOND  = 75  // Sectors (frames) per second
+	CD_SECONDS_PER_MINUTE = 60  // Seconds per minute
+	CD_VOLUME_DESCRIPTOR  = 16  // LBA of the Primary Volume Descriptor
+)
+
+// ISO9660 directory record flag bits
+const (
+	ISO_FLAG_HIDDEN       = 0x01 // Record is hidden from directory listings (existence bit)
+	ISO_FLAG_DIRECTORY    = 0x02 // Record describes a directory
+	ISO_FLAG_MULTI_EXTENT = 0x80 // Record is not the final extent of the file
+)
+
+// CD-XA attribute bits of the system use field of directory records (big-endian)
+const (
+	XA_ATTR_FORM1       = 0x0800 // File sectors are Mode 2 Form 1 (2048 bytes of data)
+	XA_ATTR_FORM2       = 0x1000 // File sectors are Mode 2 Form 2 (2336 bytes of data)
+	XA_ATTR_INTERLEAVED = 0x2000 // File interleaves sectors of several channels (XA audio, STR)
+	XA_ATTR_CDDA        = 0x4000 // File is a CD-DA audio track (2352 bytes per sector)
+	XA_ATTR_DIRECTORY   = 0x8000 // Record describes a directory
+
+	XA_RECORD_SIZE = 14 // Size of the XA system use record following the file identifier
+)
+
+// Submode bits of the XA subheader
+const (
+	XA_SUBMODE_EOR      = 0x01 // End of record
+	XA_SUBMODE_VIDEO    = 0x02
+	XA_SUBMODE_AUDIO    = 0x04
+	XA_SUBMODE_DATA     = 0x08
+	XA_SUBMODE_TRIGGER  = 0x10
+	XA_SUBMODE_FORM2    = 0x20
+	XA_SUBMODE_REALTIME = 0x40
+	XA_SUBMODE_EOF      = 0x80 // End of file
+
+	XA_SUBMODE_OFFSET  = 2                                       // Offset of the submode byte within the subheader
+	XA_FORM2_DATA_SIZE = CD_XA_DATA_SIZE - CD_SUBHEADER_SIZE - 4 // User data of a Form 2 sector, before the EDC
 )
 
 // SectorM2F1 represents a Mode 2 Form 1 sector (used in regular files)
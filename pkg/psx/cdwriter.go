@@ -0,0 +1,266 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the write-behind CD writer used for in-place updates of an image
+// file: writes are buffered and merged into contiguous runs, flushed in offset order and
+// synced once on commit, instead of one small write and sync per sector.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// DefaultCDWriterBufferSize is the number of buffered bytes that triggers a flush
+const DefaultCDWriterBufferSize = 8 * 1024 * 1024
+
+// CDWriterStats counts the work of a CD writer
+type CDWriterStats struct {
+	Writes     int   `json:"writes"`      // Writes buffered by the caller
+	DiskWrites int   `json:"disk_writes"` // Merged runs written to the image file
+	Bytes      int64 `json:"bytes"`       // Bytes written to the image file
+	Flushes    int   `json:"flushes"`     // Flushes that wrote buffered data
+	Syncs      int   `json:"syncs"`       // Syncs of the image file
+}
+
+// cdWriteRun is a contiguous range of bytes at an offset of the image file
+type cdWriteRun struct {
+	offset int64
+	data   []byte
+}
+
+// end returns the offset following the run
+func (r cdWriteRun) end() int64 {
+	return r.offset + int64(len(r.data))
+}
+
+// CDWriter is a write-behind writer of an image file updated in place. Writes are held in
+// memory until Flush or Commit; reads through the writer see them. The bytes replaced by
+// a flush are backed up until Commit syncs the file, so Close without Commit, a failed
+// write or a cancellation of its context restores the image as it was when the writer was
+// opened or last committed.
+type CDWriter struct {
+	ctx      context.Context
+	file     *os.File
+	path     string
+	geometry SectorGeometry
+	size     int64
+	limit    int
+	buffered int
+	pending  []cdWriteRun // Buffered runs, sorted by offset and never overlapping
+	backups  []cdWriteRun // Bytes replaced by flushes since the last commit, in write order
+	stats    CDWriterStats
+}
+
+// OpenCDWriter opens an image file for buffered in-place updates by an operation running
+// under ctx; flushes fail once ctx is canceled
+func OpenCDWriter(ctx context.Context, imagePath string) (*CDWriter, error) {
+	file, err := os.OpenFile(imagePath, os.O_RDWR, 0)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to open CD image for writing: %w", err))
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat CD image: %w", err)
+	}
+	return &CDWriter{
+		ctx:      ctx,
+		file:     file,
+		path:     imagePath,
+		geometry: DetectGeometry(file, info.Size()),
+		size:     info.Size(),
+		limit:    DefaultCDWriterBufferSize,
+	}, nil
+}
+
+// SetBufferSize sets the number of buffered bytes that triggers a flush (0 or less
+// buffers everything until Commit)
+func (w *CDWriter) SetBufferSize(size int) {
+	w.limit = size
+}
+
+// Geometry returns the sector geometry of the image
+func (w *CDWriter) Geometry() SectorGeometry {
+	return w.geometry
+}
+
+// Stats returns the counters of the writer
+func (w *CDWriter) Stats() CDWriterStats {
+	return w.stats
+}
+
+// ReadAt reads from the image file, with the buffered writes applied
+func (w *CDWriter) ReadAt(p []byte, off int64) (int, error) {
+	n, err := w.file.ReadAt(p, off)
+	end := off + int64(n)
+	for _, run := range w.pending {
+		if run.end() <= off || run.offset >= end {
+			continue
+		}
+		start := max(run.offset, off)
+		copy(p[start-off:min(run.end(), end)-off], run.data[start-run.offset:])
+	}
+	return n, err
+}
+
+// WriteAt buffers data for offset off of the image file, merging it with the buffered
+// runs it overlaps or touches. The data is copied. Writes past the end of the image
+// are refused: in-place updates never grow it.
+func (w *CDWriter) WriteAt(data []byte, off int64) (int, error) {
+	if off < 0 || off+int64(len(data)) > w.size {
+		return 0, common.WithCategory(common.ErrCategoryWrite,
+			fmt.Errorf("write of %d bytes at 0x%X is outside the image (%d bytes)", len(data), off, w.size))
+	}
+	if len(data) == 0 {
+		return 0, nil
+	}
+	w.stats.Writes++
+
+	run := cdWriteRun{offset: off, data: bytes.Clone(data)}
+	first := sort.Search(len(w.pending), func(i int) bool { return w.pending[i].end() >= run.offset })
+	last := first
+	for last < len(w.pending) && w.pending[last].offset <= run.end() {
+		last++
+	}
+	if first < last {
+		// The new data is copied over the merged runs, so it wins where they overlap
+		start := min(run.offset, w.pending[first].offset)
+		end := max(run.end(), w.pending[last-1].end())
+		merged := make([]byte, end-start)
+		for _, pending := range w.pending[first:last] {
+			copy(merged[pending.offset-start:], pending.data)
+			w.buffered -= len(pending.data)
+		}
+		copy(merged[run.offset-start:], run.data)
+		run = cdWriteRun{offset: start, data: merged}
+	}
+	w.pending = append(w.pending[:first], append([]cdWriteRun{run}, w.pending[last:]...)...)
+	w.buffered += len(run.data)
+
+	if w.limit > 0 && w.buffered >= w.limit {
+		if err := w.Flush(); err != nil {
+			return 0, err
+		}
+	}
+	return len(data), nil
+}
+
+// ReadSector reads a stored sector of the image, with the buffered writes applied
+func (w *CDWriter) ReadSector(lba int64) ([]byte, error) {
+	if lba < 0 || lba >= w.geometry.Sectors(w.size) {
+		return nil, fmt.Errorf("LBA %d out of bounds (total: %d)", lba, w.geometry.Sectors(w.size))
+	}
+	sector := make([]byte, w.geometry.SectorSize)
+	if _, err := w.ReadAt(sector, w.geometry.SectorOffset(lba)); err != nil {
+		return nil, fmt.Errorf("failed to read sector %d: %w", lba, err)
+	}
+	return sector, nil
+}
+
+// WriteFileData buffers data for offset of the file starting at lba and regenerates the
+// EDC and ECC of every raw sector it touches
+func (w *CDWriter) WriteFileData(lba, offset uint32, data []byte) error {
+	for written := 0; written < len(data); {
+		position := int64(offset) + int64(written)
+		sectorLBA := int64(lba) + position/CD_DATA_SIZE
+		sector, err := w.ReadSector(sectorLBA)
+		if err != nil {
+			return err
+		}
+		written += patchSectorData(w.geometry, sector, int(position%CD_DATA_SIZE), data[written:])
+		if _, err := w.WriteAt(sector, w.geometry.SectorOffset(sectorLBA)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteEntryData buffers data for offset of a file, following its extents, and
+// regenerates the EDC and ECC of every raw sector it touches
+func (w *CDWriter) WriteEntryData(entry CDFileEntry, offset uint32, data []byte) error {
+	return entry.writeExtentRuns(offset, data, w.WriteFileData)
+}
+
+// Flush writes the buffered runs to the image file in offset order, without syncing it.
+// The replaced bytes are backed up first; if a write fails or is interrupted, everything
+// flushed since the last commit is restored.
+func (w *CDWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	pending := w.pending
+	w.pending, w.buffered = nil, 0
+
+	for _, run := range pending {
+		err := common.Canceled(w.ctx)
+		if err == nil {
+			original := cdWriteRun{offset: run.offset, data: make([]byte, len(run.data))}
+			if _, err = w.file.ReadAt(original.data, run.offset); err != nil {
+				err = fmt.Errorf("failed to back up CD image data at 0x%X: %w", run.offset, err)
+			} else {
+				w.backups = append(w.backups, original)
+				if _, err = w.file.WriteAt(run.data, run.offset); err != nil {
+					err = common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write CD image data at 0x%X: %w", run.offset, err))
+				}
+			}
+		}
+		if err != nil {
+			w.rollback()
+			return err
+		}
+		w.stats.DiskWrites++
+		w.stats.Bytes += int64(len(run.data))
+	}
+	w.stats.Flushes++
+	return nil
+}
+
+// Commit flushes the buffered runs and syncs the image file once
+func (w *CDWriter) Commit() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if len(w.backups) == 0 {
+		return nil
+	}
+	if err := w.file.Sync(); err != nil {
+		w.rollback()
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to sync CD image: %w", err))
+	}
+	w.stats.Syncs++
+	w.backups = nil
+	common.RecordOutput(w.path)
+	common.LogDebug("Committed %d writes to %s as %d disk writes (%d bytes, %d flushes, %d syncs)",
+		w.stats.Writes, w.path, w.stats.DiskWrites, w.stats.Bytes, w.stats.Flushes, w.stats.Syncs)
+	return nil
+}
+
+// Close drops the buffered runs, restores the bytes flushed since the last commit and
+// closes the image file
+func (w *CDWriter) Close() error {
+	w.pending, w.buffered = nil, 0
+	w.rollback()
+	return w.file.Close()
+}
+
+// rollback writes the backed up bytes back, newest first
+func (w *CDWriter) rollback() {
+	if len(w.backups) == 0 {
+		return
+	}
+	for i := len(w.backups) - 1; i >= 0; i-- {
+		backup := w.backups[i]
+		if _, err := w.file.WriteAt(backup.data, backup.offset); err != nil {
+			common.LogWarn("Failed to restore CD image data at 0x%X of %s: %v", backup.offset, w.path, err)
+		}
+	}
+	if err := w.file.Sync(); err != nil {
+		common.LogWarn("Failed to sync restored CD image %s: %v", w.path, err)
+	}
+	common.LogDebug("Restored %d runs of %s", len(w.backups), w.path)
+	w.backups = nil
+}
@@ -0,0 +1,100 @@
+// Package psx provides tests for the write-behind CD writer.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeNumberedImage writes four 2048-byte blocks filled with their index
+func writeNumberedImage(t *testing.T) (string, []byte) {
+	t.Helper()
+	data := make([]byte, 4*CD_DATA_SIZE)
+	for i := range data {
+		data[i] = byte(i / CD_DATA_SIZE)
+	}
+	path := filepath.Join(t.TempDir(), "image.iso")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return path, data
+}
+
+func TestCDWriter_MergesWritesAndSyncsOnce(t *testing.T) {
+	path, want := writeNumberedImage(t)
+	writer, err := OpenCDWriter(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenCDWriter(context.Background()) failed: %v", err)
+	}
+	defer writer.Close()
+
+	writes := []struct {
+		offset int64
+		data   []byte
+	}{
+		{100, []byte("AAAA")},
+		{104, []byte("BBBB")}, // Touches the first run
+		{102, []byte("CC")},   // Overlaps it
+		{3000, []byte("DD")},  // Separate run in the next sector
+	}
+	for _, w := range writes {
+		if _, err := writer.WriteAt(w.data, w.offset); err != nil {
+			t.Fatalf("WriteAt(0x%X) failed: %v", w.offset, err)
+		}
+		copy(want[w.offset:], w.data)
+	}
+
+	// Reads see the buffered writes before anything reaches the file
+	got := make([]byte, 10)
+	if _, err := writer.ReadAt(got, 99); err != nil || !bytes.Equal(got, want[99:109]) {
+		t.Errorf("ReadAt() = %q, %v; want %q", got, err, want[99:109])
+	}
+	if image, _ := os.ReadFile(path); image[100] != 0 {
+		t.Error("buffered write reached the image file before Commit")
+	}
+
+	if err := writer.Commit(); err != nil {
+		t.Fatalf("Commit() failed: %v", err)
+	}
+	if image, _ := os.ReadFile(path); !bytes.Equal(image, want) {
+		t.Error("committed image differs from the written data")
+	}
+	stats := writer.Stats()
+	if stats.Writes != 4 || stats.DiskWrites != 2 || stats.Bytes != 10 || stats.Flushes != 1 || stats.Syncs != 1 {
+		t.Errorf("Stats() = %+v, want 4 writes as 2 disk writes of 10 bytes, 1 flush and 1 sync", stats)
+	}
+
+	if _, err := writer.WriteAt([]byte{1}, int64(len(want))); err == nil {
+		t.Error("WriteAt() past the end of the image succeeded")
+	}
+}
+
+func TestCDWriter_CloseRestoresUncommittedFlushes(t *testing.T) {
+	path, original := writeNumberedImage(t)
+	writer, err := OpenCDWriter(context.Background(), path)
+	if err != nil {
+		t.Fatalf("OpenCDWriter(context.Background()) failed: %v", err)
+	}
+	writer.SetBufferSize(CD_DATA_SIZE)
+
+	// Filling the buffer flushes a sector; the second one stays buffered
+	if _, err := writer.WriteAt(bytes.Repeat([]byte{0xAA}, CD_DATA_SIZE), CD_DATA_SIZE); err != nil {
+		t.Fatalf("WriteAt() failed: %v", err)
+	}
+	if _, err := writer.WriteAt([]byte{0xBB}, 3*CD_DATA_SIZE); err != nil {
+		t.Fatalf("WriteAt() failed: %v", err)
+	}
+	if image, _ := os.ReadFile(path); image[CD_DATA_SIZE] != 0xAA || image[3*CD_DATA_SIZE] != 3 {
+		t.Fatal("buffer limit did not flush the first write only")
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if image, _ := os.ReadFile(path); !bytes.Equal(image, original) {
+		t.Error("Close() without Commit did not restore the image")
+	}
+}
@@ -0,0 +1,631 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the CHD image backend, reading the data track of a CHD v5 CD image
+// (as written by chdman createcd) as a plain image. The zlib, LZMA and FLAC codecs chdman
+// uses by default are built in; other codecs can be added with RegisterCHDCodec.
+package psx
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Layout of CD images stored in a CHD
+const (
+	chdHeaderSize     = 124  // Size of the CHD v5 header
+	chdFrameSize      = 2448 // Bytes per frame: a raw sector and its subcode
+	chdSubcodeSize    = 96   // Subcode bytes per frame
+	chdMetaHeaderSize = 16   // Size of the header of a metadata entry
+)
+
+// Compression types of the hunk map entries
+const (
+	chdCompressionType0      = iota // Compressed with the first codec of the header
+	chdCompressionType1             // Compressed with the second codec
+	chdCompressionType2             // Compressed with the third codec
+	chdCompressionType3             // Compressed with the fourth codec
+	chdCompressionNone              // Stored uncompressed
+	chdCompressionSelf              // Copy of another hunk of the image
+	chdCompressionParent            // Copy of a hunk of the parent image
+	chdCompressionRLESmall          // Repeat the last type 3-18 times
+	chdCompressionRLELarge          // Repeat the last type 19-274 times
+	chdCompressionSelf0             // Copy of the same hunk as the last self reference
+	chdCompressionSelf1             // Copy of the hunk after the last self reference
+	chdCompressionParentSelf        // Copy of the parent hunk at the same position
+	chdCompressionParent0           // Copy of the same parent hunk as the last parent reference
+	chdCompressionParent1           // Copy of the parent hunk after the last parent reference
+)
+
+// Encoding of the compressed hunk map
+const (
+	chdMapHeaderSize     = 16 // Size of the map header
+	chdMapEntrySize      = 12 // Size of a decoded map entry checked by the map CRC
+	chdMapHuffmanCodes   = 16 // Symbols of the compression type Huffman tree
+	chdMapHuffmanMaxBits = 8  // Longest code of the compression type Huffman tree
+	chdMapFieldBitsMax   = 32 // Widest length, self or parent field
+	chdRLESmallBase      = 2  // Repeats of RLE_SMALL after the first, plus a 4-bit count
+	chdRLELargeBase      = 18 // Repeats of RLE_LARGE after the first, plus an 8-bit count
+)
+
+// Metadata tags of the CD track descriptions
+const (
+	chdMetaTrack  = "CHTR" // TRACK:%d TYPE:%s SUBTYPE:%s FRAMES:%d
+	chdMetaTrack2 = "CHT2" // CHTR with PREGAP, PGTYPE, PGSUB and POSTGAP
+)
+
+// CHDDecompressor decompresses a hunk compressed with a CHD codec into dst, which has the
+// size of the uncompressed hunk
+type CHDDecompressor func(src, dst []byte) error
+
+var (
+	chdCodecsMu sync.RWMutex
+	chdCodecs   = map[string]CHDDecompressor{"zlib": inflateHunk, "lzma": lzmaHunk, "cdfl": decompressFLACCDHunk}
+)
+
+// chdCDCodecs are the CD codecs: sector data compressed with a base codec, subcode with
+// another, and the sync pattern and ECC of Mode 1 sectors rebuilt
+var chdCDCodecs = map[string]struct{ base, subcode string }{
+	"cdzl": {"zlib", "zlib"},
+	"cdlz": {"lzma", "zlib"},
+	"cdzs": {"zstd", "zstd"},
+}
+
+// RegisterCHDCodec adds the decompressor of a CHD codec (e.g. "zstd", which also enables
+// the "cdzs" CD codec). The zlib, lzma, cdzl, cdlz and cdfl codecs are built in.
+func RegisterCHDCodec(tag string, decompress CHDDecompressor) {
+	chdCodecsMu.Lock()
+	defer chdCodecsMu.Unlock()
+	chdCodecs[tag] = decompress
+}
+
+// lookupCHDCodec returns the decompressor of a codec tag
+func lookupCHDCodec(tag string) (CHDDecompressor, error) {
+	chdCodecsMu.RLock()
+	defer chdCodecsMu.RUnlock()
+
+	if decompress, found := chdCodecs[tag]; found {
+		return decompress, nil
+	}
+	if codecs, isCD := chdCDCodecs[tag]; isCD {
+		base, baseFound := chdCodecs[codecs.base]
+		subcode, subcodeFound := chdCodecs[codecs.subcode]
+		if baseFound && subcodeFound {
+			return func(src, dst []byte) error { return decompressCDHunk(src, dst, base, subcode) }, nil
+		}
+		return nil, fmt.Errorf("CHD codec %s needs the %s codec; recompress with the default codecs of chdman createcd or register it with RegisterCHDCodec", tag, codecs.base)
+	}
+	return nil, fmt.Errorf("unsupported CHD codec %q; recompress with the default codecs of chdman createcd", tag)
+}
+
+// inflateHunk decompresses a raw deflate stream, the zlib codec of CHD
+func inflateHunk(src, dst []byte) error {
+	reader := flate.NewReader(bytes.NewReader(src))
+	defer reader.Close()
+	if _, err := io.ReadFull(reader, dst); err != nil {
+		return fmt.Errorf("failed to inflate hunk: %w", err)
+	}
+	return nil
+}
+
+// decompressCDHunk decompresses a hunk of a CD codec: a bitmap of the frames whose sync
+// pattern and ECC were removed, the length of the compressed sector data, the sector data
+// and the subcode
+func decompressCDHunk(src, dst []byte, base, subcode CHDDecompressor) error {
+	frames := len(dst) / chdFrameSize
+	lengthBytes := 2
+	if len(dst) >= 65536 {
+		lengthBytes = 3
+	}
+	eccBytes := (frames + 7) / 8
+	headerBytes := eccBytes + lengthBytes
+	if len(src) < headerBytes {
+		return fmt.Errorf("CD hunk of %d bytes is shorter than its header", len(src))
+	}
+
+	baseLength := int(binary.BigEndian.Uint16(src[eccBytes:]))
+	if lengthBytes == 3 {
+		baseLength = baseLength<<8 | int(src[eccBytes+2])
+	}
+	if headerBytes+baseLength > len(src) {
+		return fmt.Errorf("CD hunk sector data of %d bytes exceeds the hunk", baseLength)
+	}
+
+	sectors := make([]byte, frames*CD_SECTOR_SIZE)
+	if err := base(src[headerBytes:headerBytes+baseLength], sectors); err != nil {
+		return err
+	}
+	subcodes := make([]byte, frames*chdSubcodeSize)
+	if err := subcode(src[headerBytes+baseLength:], subcodes); err != nil {
+		return err
+	}
+
+	for frame := 0; frame < frames; frame++ {
+		sector := dst[frame*chdFrameSize : frame*chdFrameSize+CD_SECTOR_SIZE]
+		copy(sector, sectors[frame*CD_SECTOR_SIZE:])
+		copy(dst[frame*chdFrameSize+CD_SECTOR_SIZE:(frame+1)*chdFrameSize], subcodes[frame*chdSubcodeSize:])
+		if src[frame/8]&(1<<(frame%8)) != 0 {
+			copy(sector, cdSyncPattern)
+			generateECC(sector, false)
+		}
+	}
+	return nil
+}
+
+// chdHunk is an entry of the hunk map
+type chdHunk struct {
+	compression byte
+	length      uint32 // Compressed length in the file
+	offset      uint64 // File offset, or hunk number of self and parent references
+	crc         uint16 // CRC-16 of the uncompressed hunk
+}
+
+// chdImage reads the first track of a CHD CD image as a plain image
+type chdImage struct {
+	file        *os.File
+	compressors [4]string
+	hunkBytes   uint32
+	unitBytes   uint32
+	hunks       []chdHunk
+
+	firstFrame int64 // First frame of the track data (after a stored pregap)
+	frames     int64 // Frames of the track data
+	sectorSize int64 // Bytes of each frame that belong to the plain image
+
+	mu        sync.Mutex
+	cacheHunk int64
+	cache     []byte
+}
+
+// newCHDImage reads the header, hunk map and track metadata of an open CHD file
+func newCHDImage(file *os.File) (*chdImage, error) {
+	header := make([]byte, chdHeaderSize)
+	if _, err := file.ReadAt(header, 0); err != nil {
+		return nil, fmt.Errorf("failed to read CHD header: %w", err)
+	}
+	if version := binary.BigEndian.Uint32(header[12:16]); version != 5 {
+		return nil, fmt.Errorf("CHD version %d is not supported; update it with chdman copy", version)
+	}
+
+	image := &chdImage{
+		file:      file,
+		hunkBytes: binary.BigEndian.Uint32(header[56:60]),
+		unitBytes: binary.BigEndian.Uint32(header[60:64]),
+		cacheHunk: -1,
+	}
+	for i := range image.compressors {
+		if tag := header[16+i*4 : 20+i*4]; !bytes.Equal(tag, make([]byte, 4)) {
+			image.compressors[i] = string(tag)
+		}
+	}
+	if image.hunkBytes == 0 || image.hunkBytes%chdFrameSize != 0 || image.unitBytes != chdFrameSize {
+		return nil, fmt.Errorf("CHD with %d-byte hunks of %d-byte units is not a CD image", image.hunkBytes, image.unitBytes)
+	}
+
+	logicalBytes := binary.BigEndian.Uint64(header[32:40])
+	hunkCount := (logicalBytes + uint64(image.hunkBytes) - 1) / uint64(image.hunkBytes)
+	mapOffset := int64(binary.BigEndian.Uint64(header[40:48]))
+	var err error
+	if image.compressors[0] == "" {
+		image.hunks, err = image.readUncompressedMap(mapOffset, hunkCount)
+	} else {
+		image.hunks, err = image.readCompressedMap(mapOffset, hunkCount)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := image.readTrack(int64(binary.BigEndian.Uint64(header[48:56]))); err != nil {
+		return nil, err
+	}
+	if (image.firstFrame+image.frames)*chdFrameSize > int64(logicalBytes) {
+		return nil, fmt.Errorf("CHD track of %d frames exceeds the image", image.frames)
+	}
+	return image, nil
+}
+
+// readUncompressedMap reads the map of an uncompressed CHD: the hunk number of every hunk
+// in the file, 0 for a hunk of zeros
+func (c *chdImage) readUncompressedMap(offset int64, hunkCount uint64) ([]chdHunk, error) {
+	raw := make([]byte, hunkCount*4)
+	if _, err := c.file.ReadAt(raw, offset); err != nil {
+		return nil, fmt.Errorf("failed to read CHD map: %w", err)
+	}
+	hunks := make([]chdHunk, hunkCount)
+	for i := range hunks {
+		hunks[i] = chdHunk{compression: chdCompressionNone, offset: uint64(binary.BigEndian.Uint32(raw[i*4:])) * uint64(c.hunkBytes)}
+	}
+	return hunks, nil
+}
+
+// readCompressedMap decodes the map of a compressed CHD: Huffman-coded compression types
+// with run lengths, followed by the lengths, CRCs and references of every hunk
+func (c *chdImage) readCompressedMap(offset int64, hunkCount uint64) ([]chdHunk, error) {
+	header := make([]byte, chdMapHeaderSize)
+	if _, err := c.file.ReadAt(header, offset); err != nil {
+		return nil, fmt.Errorf("failed to read CHD map header: %w", err)
+	}
+	compressed := make([]byte, binary.BigEndian.Uint32(header[0:4]))
+	if _, err := c.file.ReadAt(compressed, offset+chdMapHeaderSize); err != nil {
+		return nil, fmt.Errorf("failed to read CHD map: %w", err)
+	}
+	currentOffset := uint64(header[4])<<40 | uint64(header[5])<<32 | uint64(binary.BigEndian.Uint32(header[6:10]))
+	mapCRC := binary.BigEndian.Uint16(header[10:12])
+	lengthBits, selfBits, parentBits := int(header[12]), int(header[13]), int(header[14])
+	if lengthBits > chdMapFieldBitsMax || selfBits > chdMapFieldBitsMax || parentBits > chdMapFieldBitsMax {
+		return nil, fmt.Errorf("corrupt CHD map header")
+	}
+
+	bits := &chdBitReader{data: compressed}
+	decoder, err := readHuffmanTree(bits, chdMapHuffmanCodes, chdMapHuffmanMaxBits)
+	if err != nil {
+		return nil, fmt.Errorf("corrupt CHD map: %w", err)
+	}
+
+	hunks := make([]chdHunk, hunkCount)
+	var lastType byte
+	repeat := 0
+	for i := range hunks {
+		if repeat > 0 {
+			hunks[i].compression = lastType
+			repeat--
+			continue
+		}
+		switch value := decoder.decode(bits); value {
+		case chdCompressionRLESmall:
+			hunks[i].compression = lastType
+			repeat = chdRLESmallBase + int(decoder.decode(bits))
+		case chdCompressionRLELarge:
+			hunks[i].compression = lastType
+			repeat = chdRLELargeBase + int(decoder.decode(bits))<<4
+			repeat += int(decoder.decode(bits))
+		default:
+			hunks[i].compression = value
+			lastType = value
+		}
+	}
+
+	var lastSelf, lastParent uint64
+	unitsPerHunk := uint64(c.hunkBytes / c.unitBytes)
+	raw := make([]byte, 0, len(hunks)*chdMapEntrySize)
+	for i := range hunks {
+		hunk := &hunks[i]
+		hunk.offset = currentOffset
+		switch hunk.compression {
+		case chdCompressionType0, chdCompressionType1, chdCompressionType2, chdCompressionType3:
+			hunk.length = uint32(bits.read(lengthBits))
+			currentOffset += uint64(hunk.length)
+			hunk.crc = uint16(bits.read(16))
+		case chdCompressionNone:
+			hunk.length = c.hunkBytes
+			currentOffset += uint64(hunk.length)
+			hunk.crc = uint16(bits.read(16))
+		case chdCompressionSelf:
+			hunk.offset = bits.read(selfBits)
+			lastSelf = hunk.offset
+		case chdCompressionParent:
+			hunk.offset = bits.read(parentBits)
+			lastParent = hunk.offset
+		case chdCompressionSelf1:
+			lastSelf++
+			fallthrough
+		case chdCompressionSelf0:
+			hunk.compression = chdCompressionSelf
+			hunk.offset = lastSelf
+		case chdCompressionParentSelf:
+			hunk.compression = chdCompressionParent
+			hunk.offset = uint64(i) * uint64(c.hunkBytes) / uint64(c.unitBytes)
+			lastParent = hunk.offset
+		case chdCompressionParent1:
+			lastParent += unitsPerHunk
+			fallthrough
+		case chdCompressionParent0:
+			hunk.compression = chdCompressionParent
+			hunk.offset = lastParent
+		default:
+			return nil, fmt.Errorf("corrupt CHD map: unknown compression type %d of hunk %d", hunk.compression, i)
+		}
+
+		entry := make([]byte, chdMapEntrySize)
+		entry[0] = hunk.compression
+		entry[1], entry[2], entry[3] = byte(hunk.length>>16), byte(hunk.length>>8), byte(hunk.length)
+		entry[4], entry[5] = byte(hunk.offset>>40), byte(hunk.offset>>32)
+		binary.BigEndian.PutUint32(entry[6:10], uint32(hunk.offset))
+		binary.BigEndian.PutUint16(entry[10:12], hunk.crc)
+		raw = append(raw, entry...)
+	}
+
+	if bits.overflow() {
+		return nil, fmt.Errorf("corrupt CHD map: truncated")
+	}
+	if crc := crc16CCITT(raw); crc != mapCRC {
+		return nil, fmt.Errorf("corrupt CHD map: CRC %04X, expected %04X", crc, mapCRC)
+	}
+	return hunks, nil
+}
+
+// readTrack finds the description of the first track in the metadata and selects the
+// frames and bytes of each frame presented as the plain image
+func (c *chdImage) readTrack(offset int64) error {
+	for offset != 0 {
+		header := make([]byte, chdMetaHeaderSize)
+		if _, err := c.file.ReadAt(header, offset); err != nil {
+			return fmt.Errorf("failed to read CHD metadata: %w", err)
+		}
+		tag := string(header[0:4])
+		length := int(header[5])<<16 | int(header[6])<<8 | int(header[7])
+		next := int64(binary.BigEndian.Uint64(header[8:16]))
+
+		if tag == chdMetaTrack || tag == chdMetaTrack2 {
+			data := make([]byte, length)
+			if _, err := c.file.ReadAt(data, offset+chdMetaHeaderSize); err != nil {
+				return fmt.Errorf("failed to read CHD track metadata: %w", err)
+			}
+			fields := parseCHDTrack(string(bytes.TrimRight(data, "\x00")))
+			if fields["TRACK"] == "1" {
+				return c.selectTrack(fields)
+			}
+		}
+		offset = next
+	}
+	return fmt.Errorf("CHD has no CD track metadata (not a CD image)")
+}
+
+// selectTrack sets up the plain image of a track from its metadata fields
+func (c *chdImage) selectTrack(fields map[string]string) error {
+	sectorSizes := map[string]int64{
+		"MODE1": CD_DATA_SIZE, "MODE1_RAW": CD_SECTOR_SIZE, "MODE2": CD_XA_DATA_SIZE, "MODE2_FORM1": CD_DATA_SIZE,
+		"MODE2_FORM_MIX": CD_XA_DATA_SIZE, "MODE2_RAW": CD_SECTOR_SIZE, "AUDIO": CD_SECTOR_SIZE,
+	}
+	sectorSize, found := sectorSizes[fields["TYPE"]]
+	if !found {
+		return fmt.Errorf("CHD track type %q is not supported", fields["TYPE"])
+	}
+
+	frames, err := strconv.ParseInt(fields["FRAMES"], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid CHD track frame count %q", fields["FRAMES"])
+	}
+	if strings.HasPrefix(fields["PGTYPE"], "V") {
+		pregap, err := strconv.ParseInt(fields["PREGAP"], 10, 64)
+		if err != nil || pregap > frames {
+			return fmt.Errorf("invalid CHD track pregap %q", fields["PREGAP"])
+		}
+		c.firstFrame = pregap
+		frames -= pregap
+	}
+	c.frames = frames
+	c.sectorSize = sectorSize
+	return nil
+}
+
+// parseCHDTrack splits a track description (TRACK:1 TYPE:MODE2_RAW ...) into its fields
+func parseCHDTrack(text string) map[string]string {
+	fields := make(map[string]string)
+	for _, field := range strings.Fields(text) {
+		if key, value, found := strings.Cut(field, ":"); found {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// ReadAt reads the plain image bytes at offset off
+func (c *chdImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	read := 0
+	for read < len(p) {
+		position := off + int64(read)
+		if position >= c.Size() {
+			return read, io.EOF
+		}
+		frame, inFrame := position/c.sectorSize, position%c.sectorSize
+		logical := (c.firstFrame+frame)*chdFrameSize + inFrame
+		hunk, err := c.readHunk(uint64(logical/int64(c.hunkBytes)), 0)
+		if err != nil {
+			return read, err
+		}
+		inHunk := logical % int64(c.hunkBytes)
+		read += copy(p[read:], hunk[inHunk:inHunk+c.sectorSize-inFrame])
+	}
+	return read, nil
+}
+
+// readHunk returns the uncompressed data of a hunk, following self references
+func (c *chdImage) readHunk(index uint64, depth int) ([]byte, error) {
+	if int64(index) == c.cacheHunk {
+		return c.cache, nil
+	}
+	if index >= uint64(len(c.hunks)) {
+		return nil, fmt.Errorf("CHD hunk %d out of range (%d hunks)", index, len(c.hunks))
+	}
+
+	hunk := c.hunks[index]
+	data := make([]byte, c.hunkBytes)
+	switch hunk.compression {
+	case chdCompressionType0, chdCompressionType1, chdCompressionType2, chdCompressionType3:
+		decompress, err := lookupCHDCodec(c.compressors[hunk.compression])
+		if err != nil {
+			return nil, err
+		}
+		compressed := make([]byte, hunk.length)
+		if _, err := c.file.ReadAt(compressed, int64(hunk.offset)); err != nil {
+			return nil, fmt.Errorf("failed to read CHD hunk %d: %w", index, err)
+		}
+		if err := decompress(compressed, data); err != nil {
+			return nil, fmt.Errorf("failed to decompress CHD hunk %d: %w", index, err)
+		}
+	case chdCompressionNone:
+		if hunk.offset != 0 {
+			if _, err := c.file.ReadAt(data, int64(hunk.offset)); err != nil {
+				return nil, fmt.Errorf("failed to read CHD hunk %d: %w", index, err)
+			}
+		}
+	case chdCompressionSelf:
+		if depth > len(c.hunks) {
+			return nil, fmt.Errorf("CHD hunk %d has circular references", index)
+		}
+		return c.readHunk(hunk.offset, depth+1)
+	default:
+		return nil, fmt.Errorf("CHD hunk %d is stored in a parent image, which is not supported", index)
+	}
+
+	if c.compressors[0] != "" {
+		if crc := crc16CCITT(data); crc != hunk.crc {
+			return nil, fmt.Errorf("CHD hunk %d fails its CRC check (%04X, expected %04X)", index, crc, hunk.crc)
+		}
+	}
+	c.cacheHunk, c.cache = int64(index), data
+	return data, nil
+}
+
+// Close closes the CHD file
+func (c *chdImage) Close() error {
+	return c.file.Close()
+}
+
+// Size returns the size of the plain image of the track
+func (c *chdImage) Size() int64 {
+	return c.frames * c.sectorSize
+}
+
+// Format returns ImageFormatCHD
+func (c *chdImage) Format() string {
+	return ImageFormatCHD
+}
+
+// chdBitReader reads big-endian bit fields; reads past the end return zero bits
+type chdBitReader struct {
+	data     []byte
+	position int // Bit position
+}
+
+// peek returns the next count bits without consuming them
+func (b *chdBitReader) peek(count int) uint64 {
+	var value uint64
+	for i := 0; i < count; i++ {
+		bit := b.position + i
+		value <<= 1
+		if bit/8 < len(b.data) {
+			value |= uint64(b.data[bit/8]>>(7-bit%8)) & 1
+		}
+	}
+	return value
+}
+
+// read consumes and returns the next count bits
+func (b *chdBitReader) read(count int) uint64 {
+	value := b.peek(count)
+	b.position += count
+	return value
+}
+
+// overflow reports whether more bits were read than the data holds
+func (b *chdBitReader) overflow() bool {
+	return b.position > len(b.data)*8
+}
+
+// huffmanDecoder decodes the canonical Huffman codes of the CHD map
+type huffmanDecoder struct {
+	maxBits int
+	lookup  []uint16 // Symbol << 5 | code length, indexed by the next maxBits bits
+}
+
+// readHuffmanTree reads the code lengths of a Huffman tree, stored with run lengths, and
+// builds the lookup table of its canonical codes
+func readHuffmanTree(bits *chdBitReader, codes, maxBits int) (*huffmanDecoder, error) {
+	lengthBits := 3
+	switch {
+	case maxBits >= 16:
+		lengthBits = 5
+	case maxBits >= 8:
+		lengthBits = 4
+	}
+
+	lengths := make([]int, 0, codes)
+	for len(lengths) < codes {
+		length := int(bits.read(lengthBits))
+		if length != 1 {
+			lengths = append(lengths, length)
+			continue
+		}
+		length = int(bits.read(lengthBits))
+		if length == 1 {
+			lengths = append(lengths, length)
+			continue
+		}
+		for repeat := int(bits.read(lengthBits)) + 3; repeat > 0; repeat-- {
+			lengths = append(lengths, length)
+		}
+	}
+	if len(lengths) != codes {
+		return nil, fmt.Errorf("Huffman tree run exceeds %d codes", codes)
+	}
+
+	// Assign canonical codes, longest codes first
+	var histogram [33]uint32
+	for _, length := range lengths {
+		if length > maxBits {
+			return nil, fmt.Errorf("Huffman code length %d exceeds %d bits", length, maxBits)
+		}
+		histogram[length]++
+	}
+	var start uint32
+	for length := 32; length > 0; length-- {
+		next := (start + histogram[length]) >> 1
+		if length != 1 && next*2 != start+histogram[length] {
+			return nil, fmt.Errorf("invalid Huffman tree")
+		}
+		histogram[length] = start
+		start = next
+	}
+
+	decoder := &huffmanDecoder{maxBits: maxBits, lookup: make([]uint16, 1<<maxBits)}
+	for symbol, length := range lengths {
+		if length == 0 {
+			continue
+		}
+		code := histogram[length]
+		histogram[length]++
+		shift := maxBits - length
+		for i := code << shift; i < (code+1)<<shift; i++ {
+			decoder.lookup[i] = uint16(symbol<<5 | length)
+		}
+	}
+	return decoder, nil
+}
+
+// decode reads one symbol
+func (d *huffmanDecoder) decode(bits *chdBitReader) byte {
+	entry := d.lookup[bits.peek(d.maxBits)]
+	bits.position += int(entry & 0x1F)
+	return byte(entry >> 5)
+}
+
+// crc16CCITT returns the CRC-16-CCITT (initial value 0xFFFF) of data, the hunk and map
+// checksum of CHD
+func crc16CCITT(data []byte) uint16 {
+	crc := uint16(0xFFFF)
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
@@ -0,0 +1,130 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains writers for CUE and CloneCD (CCD) disc description files
+// matching raw 2352-byte PlayStation CD images.
+package psx
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// TrackMode describes the sector layout of a data track
+type TrackMode byte
+
+// Supported data track modes
+const (
+	TrackModeUnknown TrackMode = 0
+	TrackMode1       TrackMode = 1
+	TrackMode2       TrackMode = 2
+)
+
+// CueString returns the track mode in CUE sheet notation (e.g. MODE2/2352)
+func (m TrackMode) CueString() string {
+	if m == TrackMode1 {
+		return fmt.Sprintf("MODE1/%d", CD_SECTOR_SIZE)
+	}
+	return fmt.Sprintf("MODE2/%d", CD_SECTOR_SIZE)
+}
+
+// DetectTrackMode reads the mode byte of the Primary Volume Descriptor sector. Images
+// without sector headers report the mode of their geometry.
+func (r *CDReader) DetectTrackMode() (TrackMode, error) {
+	if !r.geometry.IsRaw() {
+		return r.geometry.Mode, nil
+	}
+	if err := r.SeekToSector(CD_VOLUME_DESCRIPTOR); err != nil {
+		return TrackModeUnknown, fmt.Errorf("failed to read volume descriptor sector: %w", err)
+	}
+
+	switch r.sectorBuffer[CD_MODE_OFFSET] {
+	case 1:
+		return TrackMode1, nil
+	case 2:
+		return TrackMode2, nil
+	default:
+		return TrackModeUnknown, fmt.Errorf("unknown sector mode 0x%02X", r.sectorBuffer[CD_MODE_OFFSET])
+	}
+}
+
+// TotalSectors returns the number of sectors in the CD image
+func (r *CDReader) TotalSectors() int64 {
+	return r.totalSectors
+}
+
+// WriteCueSheet writes a single-track CUE sheet referencing the given image file name
+func WriteCueSheet(writer io.Writer, binFileName string, mode TrackMode) error {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("FILE \"%s\" BINARY\n", binFileName))
+	sb.WriteString(fmt.Sprintf("  TRACK 01 %s\n", mode.CueString()))
+	sb.WriteString("    INDEX 01 00:00:00\n")
+
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
+
+// ccdEntry describes a single TOC entry of a CloneCD control file
+type ccdEntry struct {
+	point   int
+	control int
+	pLBA    int64
+}
+
+// WriteCloneCDControl writes a CloneCD (.ccd) control file for a single data track image
+func WriteCloneCDControl(writer io.Writer, totalSectors int64, mode TrackMode) error {
+	// Disc type 0x20 (CD-ROM XA) for Mode 2 images, 0x00 (CD-ROM) for Mode 1
+	discType := int64(0x20)
+	if mode == TrackMode1 {
+		discType = 0x00
+	}
+
+	// Point A0/A1 encode first/last track numbers and disc type in PMin/PSec,
+	// point A2 is the lead-out position and point 1 is the first track start
+	entries := []ccdEntry{
+		{point: 0xA0, control: 0x04, pLBA: int64(MSFToSectors(1, uint32(discType), 0)) - CD_PREGAP_SECTORS},
+		{point: 0xA1, control: 0x04, pLBA: int64(MSFToSectors(1, 0, 0)) - CD_PREGAP_SECTORS},
+		{point: 0xA2, control: 0x04, pLBA: totalSectors},
+		{point: 0x01, control: 0x04, pLBA: 0},
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[CloneCD]\nVersion=3\n")
+	sb.WriteString(fmt.Sprintf("[Disc]\nTocEntries=%d\nSessions=1\nDataTracksScrambled=0\nCDTextLength=0\n", len(entries)))
+	sb.WriteString(fmt.Sprintf("[Session 1]\nPreGapMode=%d\nPreGapSubC=0\n", mode))
+
+	for i, entry := range entries {
+		pMin, pSec, pFrame := SectorsToMSF(uint32(entry.pLBA + CD_PREGAP_SECTORS))
+		sb.WriteString(fmt.Sprintf("[Entry %d]\n", i))
+		sb.WriteString("Session=1\n")
+		sb.WriteString(fmt.Sprintf("Point=0x%02x\n", entry.point))
+		sb.WriteString("ADR=0x01\n")
+		sb.WriteString(fmt.Sprintf("Control=0x%02x\n", entry.control))
+		sb.WriteString("TrackNo=0\nAMin=0\nASec=0\nAFrame=0\n")
+		sb.WriteString(fmt.Sprintf("ALBA=-%d\n", CD_PREGAP_SECTORS))
+		sb.WriteString("Zero=0\n")
+		sb.WriteString(fmt.Sprintf("PMin=%d\nPSec=%d\nPFrame=%d\nPLBA=%d\n", pMin, pSec, pFrame, entry.pLBA))
+	}
+
+	sb.WriteString(fmt.Sprintf("[TRACK 1]\nMODE=%d\nINDEX 1=0\n", mode))
+
+	_, err := io.WriteString(writer, sb.String())
+	return err
+}
+
+// Disc description formats supported by WriteDiscSheet
+const (
+	SheetFormatCUE = "cue"
+	SheetFormatCCD = "ccd"
+)
+
+// WriteDiscSheet writes a disc description of the requested format for the image
+func WriteDiscSheet(writer io.Writer, format string, binFileName string, totalSectors int64, mode TrackMode) error {
+	switch format {
+	case SheetFormatCUE:
+		return WriteCueSheet(writer, binFileName, mode)
+	case SheetFormatCCD:
+		return WriteCloneCDControl(writer, totalSectors, mode)
+	default:
+		return fmt.Errorf("unsupported sheet format: %s", format)
+	}
+}
@@ -0,0 +1,47 @@
+// Package psx provides tests for CUE and CloneCD sheet generation.
+package psx
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteCueSheet(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteCueSheet(&buffer, "game.bin", TrackMode2); err != nil {
+		t.Fatalf("WriteCueSheet() failed: %v", err)
+	}
+
+	expected := "FILE \"game.bin\" BINARY\n  TRACK 01 MODE2/2352\n    INDEX 01 00:00:00\n"
+	if buffer.String() != expected {
+		t.Errorf("WriteCueSheet() = %q, want %q", buffer.String(), expected)
+	}
+}
+
+func TestWriteCloneCDControl(t *testing.T) {
+	var buffer bytes.Buffer
+	// 1000 sectors: lead-out at LBA 1000, MSF 00:15:25 including the pregap
+	if err := WriteCloneCDControl(&buffer, 1000, TrackMode2); err != nil {
+		t.Fatalf("WriteCloneCDControl() failed: %v", err)
+	}
+
+	output := buffer.String()
+	for _, want := range []string{
+		"TocEntries=4",
+		"Point=0xa0\nADR=0x01\nControl=0x04\nTrackNo=0\nAMin=0\nASec=0\nAFrame=0\nALBA=-150\nZero=0\nPMin=1\nPSec=32\nPFrame=0\nPLBA=6750",
+		"Point=0xa2\nADR=0x01\nControl=0x04\nTrackNo=0\nAMin=0\nASec=0\nAFrame=0\nALBA=-150\nZero=0\nPMin=0\nPSec=15\nPFrame=25\nPLBA=1000",
+		"[TRACK 1]\nMODE=2\nINDEX 1=0\n",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("WriteCloneCDControl() missing %q", want)
+		}
+	}
+}
+
+func TestWriteDiscSheet_UnsupportedFormat(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := WriteDiscSheet(&buffer, "mds", "game.bin", 1000, TrackMode2); err == nil {
+		t.Error("WriteDiscSheet() should fail for unsupported format")
+	}
+}
@@ -0,0 +1,104 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the disc fingerprint: the serial of the boot executable named
+// in SYSTEM.CNF and the build date recorded in the primary volume descriptor.
+package psx
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// DiscIdentity is the fingerprint of a PlayStation disc
+type DiscIdentity struct {
+	Serial    string `json:"serial"`     // Product code (e.g. SCUS-94236), empty if the boot file has none
+	Region    string `json:"region"`     // Region of the serial, or of the license sectors without one
+	BootPath  string `json:"boot_path"`  // BOOT line of SYSTEM.CNF
+	BootFile  string `json:"boot_file"`  // Boot executable path inside the image
+	SystemID  string `json:"system_id"`  // Volume descriptor system identifier
+	VolumeID  string `json:"volume_id"`  // Volume descriptor volume identifier
+	BuildDate string `json:"build_date"` // Volume creation date (YYYY-MM-DD HH:MM:SS), empty if unset
+}
+
+// SerialFromExecutableName converts a product code file name (SCUS_942.36) to a serial (SCUS-94236).
+// Returns an empty string if the name is not a product code.
+func SerialFromExecutableName(name string) string {
+	base := strings.ToUpper(path.Base(name))
+	if RegionFromExecutableName(base) == RegionUnknown || len(base) < 5 || (base[4] != '_' && base[4] != '-') {
+		return ""
+	}
+
+	number := strings.ReplaceAll(base[5:], ".", "")
+	if number == "" {
+		return ""
+	}
+	for _, c := range number {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	return base[:4] + "-" + number
+}
+
+// ParseVolumeDate formats an ISO9660 17-byte date (YYYYMMDDHHMMSScc + timezone) as
+// YYYY-MM-DD HH:MM:SS. Returns an empty string for unset (zero-filled) dates.
+func ParseVolumeDate(date []byte) string {
+	if len(date) < 14 {
+		return ""
+	}
+	digits := string(date[:14])
+	for _, c := range digits {
+		if c < '0' || c > '9' {
+			return ""
+		}
+	}
+	if digits[:4] == "0000" {
+		return ""
+	}
+	return fmt.Sprintf("%s-%s-%s %s:%s:%s", digits[0:4], digits[4:6], digits[6:8], digits[8:10], digits[10:12], digits[12:14])
+}
+
+// Identify reads the disc serial from SYSTEM.CNF and the build date from the volume descriptor
+func (r *CDReader) Identify() (*DiscIdentity, error) {
+	if err := r.ValidateISO9660(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("no ISO9660 volume descriptor: %w", err))
+	}
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+
+	identity := &DiscIdentity{
+		Region:    RegionUnknown,
+		SystemID:  strings.TrimSpace(string(descriptor.SystemID[:])),
+		VolumeID:  strings.TrimSpace(string(descriptor.VolumeID[:])),
+		BuildDate: ParseVolumeDate(descriptor.VolumeCreateDate[:]),
+		BootFile:  LEGACY_BOOT_NAME,
+	}
+
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	if cnfEntry, err := r.FindEntry(rootLBA, rootSize, SYSTEM_CNF_NAME); err == nil {
+		cnfData, err := r.ReadEntry(cnfEntry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", SYSTEM_CNF_NAME, err)
+		}
+		identity.BootPath = ParseSystemCNF(cnfData)["BOOT"]
+		if bootFile, err := BootFilePath(identity.BootPath); err == nil {
+			identity.BootFile = bootFile
+		}
+	}
+
+	identity.Serial = SerialFromExecutableName(identity.BootFile)
+	identity.Region = RegionFromExecutableName(identity.BootFile)
+	if identity.Region == RegionUnknown {
+		if license, err := r.readSectorData(LICENSE_SECTOR); err == nil {
+			identity.Region = RegionFromLicense(license)
+		}
+	}
+
+	common.LogDebug("Disc identity: serial %q, region %s, build date %q", identity.Serial, identity.Region, identity.BuildDate)
+	return identity, nil
+}
@@ -0,0 +1,100 @@
+// Package psx provides tests for disc fingerprinting.
+package psx
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSerialFromExecutableName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"SCUS_942.36", "SCUS-94236"},
+		{"slps_012.34", "SLPS-01234"},
+		{"DATA/SCES_013.30", "SCES-01330"},
+		{"PSX.EXE", ""},
+		{"SLUS_ABC.DE", ""},
+		{"SLUS", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SerialFromExecutableName(tt.name); got != tt.want {
+			t.Errorf("SerialFromExecutableName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParseVolumeDate(t *testing.T) {
+	tests := []struct {
+		date []byte
+		want string
+	}{
+		{[]byte("1997122315304500\x24"), "1997-12-23 15:30:45"},
+		{[]byte("0000000000000000\x00"), ""},
+		{make([]byte, 17), ""},
+		{[]byte("1997"), ""},
+	}
+
+	for _, tt := range tests {
+		if got := ParseVolumeDate(tt.date); got != tt.want {
+			t.Errorf("ParseVolumeDate(%q) = %q, want %q", tt.date, got, tt.want)
+		}
+	}
+}
+
+func TestCDReader_Identify(t *testing.T) {
+	const usLicense = "          Licensed  by          Sony Computer Entertainment Amer  ica "
+
+	imagePath := writeBootImage(t, bootImageOptions{usLicense, "BOOT = cdrom:\\SCUS_942.36;1\r\n", "SCUS_942.36", "North America area"})
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatalf("failed to read test image: %v", err)
+	}
+	copy(image[16*CD_SECTOR_SIZE+24+813:], "1997122315304500")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	identity, err := reader.Identify()
+	if err != nil {
+		t.Fatalf("Identify() failed: %v", err)
+	}
+	want := DiscIdentity{
+		Serial:    "SCUS-94236",
+		Region:    RegionNTSCU,
+		BootPath:  "cdrom:\\SCUS_942.36;1",
+		BootFile:  "SCUS_942.36",
+		SystemID:  "PLAYSTATION",
+		VolumeID:  "TOMBA",
+		BuildDate: "1997-12-23 15:30:45",
+	}
+	if *identity != want {
+		t.Errorf("Identify() = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestCDReader_Identify_LegacyBoot(t *testing.T) {
+	const euLicense = "          Licensed  by          Sony Computer Entertainment Euro pe   "
+
+	reader, err := NewCDReader(writeBootImage(t, bootImageOptions{euLicense, "", "PSX.EXE", "Europe area"}))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	identity, err := reader.Identify()
+	if err != nil {
+		t.Fatalf("Identify() failed: %v", err)
+	}
+	if identity.Serial != "" || identity.Region != RegionPAL || identity.BootFile != LEGACY_BOOT_NAME {
+		t.Errorf("Identify() = %+v, want no serial, PAL region from the license and boot file PSX.EXE", *identity)
+	}
+}
@@ -0,0 +1,182 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the ECM image backend. ECM stores raw sectors without the sync
+// pattern and the EDC/ECC fields, which are rebuilt when the sectors are read.
+package psx
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+)
+
+// ECM record types
+const (
+	ecmTypeRaw        = 0 // Bytes stored as they are
+	ecmTypeMode1      = 1 // Mode 1 sectors: address and user data
+	ecmTypeMode2Form1 = 2 // Mode 2 Form 1 sectors from the subheader: subheader and user data
+	ecmTypeMode2Form2 = 3 // Mode 2 Form 2 sectors from the subheader: subheader and user data
+)
+
+// ecmSectorSizes gives the stored and rebuilt size of a sector of every sector record type
+var ecmSectorSizes = map[int]struct{ stored, output int64 }{
+	ecmTypeMode1:      {3 + CD_DATA_SIZE, CD_SECTOR_SIZE},
+	ecmTypeMode2Form1: {4 + CD_DATA_SIZE, CD_XA_DATA_SIZE},
+	ecmTypeMode2Form2: {4 + 2324, CD_XA_DATA_SIZE},
+}
+
+// ecmRecord is a run of bytes or sectors of a single type
+type ecmRecord struct {
+	recordType   int
+	count        int64 // Bytes of a raw record, sectors otherwise
+	inputOffset  int64 // Offset of the stored data in the ECM file
+	outputOffset int64 // Offset of the rebuilt data in the plain image
+}
+
+// outputSize returns the size of the rebuilt data of the record
+func (r ecmRecord) outputSize() int64 {
+	if r.recordType == ecmTypeRaw {
+		return r.count
+	}
+	return r.count * ecmSectorSizes[r.recordType].output
+}
+
+// ecmImage reads an ECM file as the plain image it was made from
+type ecmImage struct {
+	file    *os.File
+	records []ecmRecord
+	size    int64
+}
+
+// newECMImage indexes the records of an open ECM file
+func newECMImage(file *os.File) (*ecmImage, error) {
+	image := &ecmImage{file: file}
+	position := int64(len(ecmMagic))
+	readByte := func() (byte, error) {
+		var b [1]byte
+		if _, err := file.ReadAt(b[:], position); err != nil {
+			return 0, fmt.Errorf("truncated ECM record header at offset %d: %w", position, err)
+		}
+		position++
+		return b[0], nil
+	}
+
+	for {
+		c, err := readByte()
+		if err != nil {
+			return nil, err
+		}
+		recordType := int(c & 3)
+		count := uint64(c>>2) & 0x1F
+		for bits := 5; c&0x80 != 0; bits += 7 {
+			if bits > 31 {
+				return nil, fmt.Errorf("corrupt ECM record header at offset %d", position)
+			}
+			if c, err = readByte(); err != nil {
+				return nil, err
+			}
+			count |= uint64(c&0x7F) << bits
+		}
+		if count == 0xFFFFFFFF {
+			break
+		}
+		if count >= 0x80000000 {
+			return nil, fmt.Errorf("corrupt ECM record header at offset %d", position)
+		}
+
+		record := ecmRecord{recordType: recordType, count: int64(count) + 1, inputOffset: position, outputOffset: image.size}
+		if recordType == ecmTypeRaw {
+			position += record.count
+		} else {
+			position += record.count * ecmSectorSizes[recordType].stored
+		}
+		image.size += record.outputSize()
+		image.records = append(image.records, record)
+	}
+
+	return image, nil
+}
+
+// ReadAt rebuilds the plain image bytes at offset off
+func (e *ecmImage) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, fmt.Errorf("negative offset %d", off)
+	}
+
+	read := 0
+	for read < len(p) {
+		position := off + int64(read)
+		if position >= e.size {
+			return read, io.EOF
+		}
+		index := sort.Search(len(e.records), func(i int) bool {
+			return e.records[i].outputOffset+e.records[i].outputSize() > position
+		})
+		record := e.records[index]
+		inRecord := position - record.outputOffset
+
+		if record.recordType == ecmTypeRaw {
+			n := int(min(int64(len(p)-read), record.count-inRecord))
+			if _, err := e.file.ReadAt(p[read:read+n], record.inputOffset+inRecord); err != nil {
+				return read, fmt.Errorf("failed to read ECM data: %w", err)
+			}
+			read += n
+			continue
+		}
+
+		sizes := ecmSectorSizes[record.recordType]
+		sectorIndex := inRecord / sizes.output
+		sector, err := e.rebuildSector(record, sectorIndex)
+		if err != nil {
+			return read, err
+		}
+		read += copy(p[read:], sector[inRecord-sectorIndex*sizes.output:])
+	}
+	return read, nil
+}
+
+// rebuildSector rebuilds a sector of a sector record. Mode 1 sectors are rebuilt whole;
+// Mode 2 sectors from the subheader on, their sync and header being stored as raw bytes.
+func (e *ecmImage) rebuildSector(record ecmRecord, index int64) ([]byte, error) {
+	sizes := ecmSectorSizes[record.recordType]
+	stored := make([]byte, sizes.stored)
+	if _, err := e.file.ReadAt(stored, record.inputOffset+index*sizes.stored); err != nil {
+		return nil, fmt.Errorf("failed to read ECM sector: %w", err)
+	}
+
+	sector := make([]byte, CD_SECTOR_SIZE)
+	const headerEnd = CD_SYNC_SIZE + CD_HEADER_SIZE
+	switch record.recordType {
+	case ecmTypeMode1:
+		copy(sector, cdSyncPattern)
+		copy(sector[CD_SYNC_SIZE:], stored[:3])
+		sector[CD_MODE_OFFSET] = 1
+		copy(sector[headerEnd:], stored[3:])
+		generateMode1EDCECC(sector)
+		return sector, nil
+	case ecmTypeMode2Form1:
+		copy(sector[headerEnd+4:], stored)
+		copy(sector[headerEnd:headerEnd+4], stored[:4])
+		generateMode2Form1EDCECC(sector)
+	default:
+		copy(sector[headerEnd+4:], stored)
+		copy(sector[headerEnd:headerEnd+4], stored[:4])
+		generateMode2Form2EDC(sector)
+	}
+	return sector[headerEnd:], nil
+}
+
+// Close closes the ECM file
+func (e *ecmImage) Close() error {
+	return e.file.Close()
+}
+
+// Size returns the size of the plain image
+func (e *ecmImage) Size() int64 {
+	return e.size
+}
+
+// Format returns ImageFormatECM
+func (e *ecmImage) Format() string {
+	return ImageFormatECM
+}
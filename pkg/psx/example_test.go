@@ -0,0 +1,85 @@
+// Package psx provides runnable examples of the CD image API.
+package psx_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// exampleDirectoryImage writes a Mode 2 image whose sector 18 holds a directory
+// with the "." and ".." records followed by two files and a subdirectory
+func exampleDirectoryImage(path string) error {
+	const sectors = 24
+	image := make([]byte, sectors*psx.CD_SECTOR_SIZE)
+	for lba := 0; lba < sectors; lba++ {
+		image[lba*psx.CD_SECTOR_SIZE+15] = 2 // Mode 2
+	}
+
+	directory := image[18*psx.CD_SECTOR_SIZE+24:]
+	offset := 0
+	record := func(name string, lba, size uint32, flags byte) {
+		length := 33 + len(name)
+		if length%2 != 0 {
+			length++
+		}
+		data := directory[offset : offset+length]
+		data[0] = byte(length)
+		binary.LittleEndian.PutUint32(data[2:6], lba)
+		binary.BigEndian.PutUint32(data[6:10], lba)
+		binary.LittleEndian.PutUint32(data[10:14], size)
+		binary.BigEndian.PutUint32(data[14:18], size)
+		data[25] = flags
+		data[32] = byte(len(name))
+		copy(data[33:], name)
+		offset += length
+	}
+
+	record("\x00", 18, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	record("\x01", 18, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+	record("SYSTEM.CNF;1", 19, 68, 0)
+	record("STAGE01.GAM;1", 20, 5000, 0)
+	record("XA", 23, psx.CD_DATA_SIZE, psx.ISO_FLAG_DIRECTORY)
+
+	return os.WriteFile(path, image, 0644)
+}
+
+func ExampleCDReader_ParseDirectoryEntries() {
+	dir, err := os.MkdirTemp("", "cd-example")
+	if err != nil {
+		fmt.Println("failed to create temp dir:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	imagePath := filepath.Join(dir, "TOMBA.BIN")
+	if err := exampleDirectoryImage(imagePath); err != nil {
+		fmt.Println("failed to write image:", err)
+		return
+	}
+
+	reader, err := psx.NewCDReader(imagePath)
+	if err != nil {
+		fmt.Println("failed to open image:", err)
+		return
+	}
+	defer reader.Close()
+
+	entries, err := reader.ParseDirectoryEntries(18, psx.CD_DATA_SIZE)
+	if err != nil {
+		fmt.Println("failed to parse directory:", err)
+		return
+	}
+
+	for _, entry := range entries {
+		fmt.Printf("%-11s LBA %2d  %4d bytes  %d sector(s)  dir=%t\n",
+			entry.Name, entry.LBA, entry.Size, entry.ExtentSize, entry.IsDir)
+	}
+	// Output:
+	// SYSTEM.CNF  LBA 19    68 bytes  1 sector(s)  dir=false
+	// STAGE01.GAM LBA 20  5000 bytes  3 sector(s)  dir=false
+	// XA          LBA 23  2048 bytes  1 sector(s)  dir=true
+}
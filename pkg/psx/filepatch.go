@@ -0,0 +1,135 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains fixed-offset byte patches of the files of a disc image: the bytes
+// expected before patching are checked first, so a patch meant for another release or
+// revision is refused instead of corrupting the executable.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// File patch states
+const (
+	PatchPending        = "pending"         // The file holds the original bytes
+	PatchApplied        = "applied"         // The patched bytes were written
+	PatchAlreadyApplied = "already-applied" // The file already holds the patched bytes
+)
+
+// FilePatch replaces bytes of a file of a disc image at a fixed offset
+type FilePatch struct {
+	Name     string `yaml:"name" json:"name"`
+	File     string `yaml:"file" json:"file"`                     // Path inside the image, e.g. EXE/MAIN0.EXE
+	Offset   uint32 `yaml:"offset" json:"offset"`                 // Byte offset inside the file
+	Original string `yaml:"original" json:"original"`             // Bytes expected before patching (hex, spaces allowed)
+	Patched  string `yaml:"patched" json:"patched"`               // Replacement bytes (hex), as long as original
+	Note     string `yaml:"note,omitempty" json:"note,omitempty"` // What the patch changes
+}
+
+// parsePatchHex decodes a hex byte string, ignoring whitespace
+func parsePatchHex(text string) ([]byte, error) {
+	return hex.DecodeString(strings.Join(strings.Fields(text), ""))
+}
+
+// Bytes returns the original and patched bytes of the patch
+func (p FilePatch) Bytes() (original, patched []byte, err error) {
+	if original, err = parsePatchHex(p.Original); err != nil {
+		return nil, nil, fmt.Errorf("patch %s: invalid original bytes: %w", p.Name, err)
+	}
+	if patched, err = parsePatchHex(p.Patched); err != nil {
+		return nil, nil, fmt.Errorf("patch %s: invalid patched bytes: %w", p.Name, err)
+	}
+	return original, patched, nil
+}
+
+// Validate checks that the patch names a file and replaces a run of bytes by as many bytes
+func (p FilePatch) Validate() error {
+	if p.File == "" {
+		return fmt.Errorf("patch %s names no file", p.Name)
+	}
+	original, patched, err := p.Bytes()
+	if err != nil {
+		return err
+	}
+	if len(original) == 0 || len(original) != len(patched) {
+		return fmt.Errorf("patch %s replaces %d bytes by %d; both must be the same non-zero length",
+			p.Name, len(original), len(patched))
+	}
+	return nil
+}
+
+// PatchState reports whether the file of a patch holds its original bytes (pending) or
+// its patched bytes (already-applied), and returns the file entry. Any other content is
+// a validation error.
+func (r *CDReader) PatchState(patch FilePatch) (string, CDFileEntry, error) {
+	original, patched, err := patch.Bytes()
+	if err != nil {
+		return "", CDFileEntry{}, common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		return "", CDFileEntry{}, fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+	entry, err := r.FindEntry(common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:]),
+		common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:]), patch.File)
+	if err != nil {
+		return "", CDFileEntry{}, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("patch %s: %w", patch.Name, err))
+	}
+	if entry.IsDir {
+		return "", CDFileEntry{}, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("patch %s: %s is a directory", patch.Name, patch.File))
+	}
+	if uint64(patch.Offset)+uint64(len(original)) > uint64(entry.Size) {
+		return "", CDFileEntry{}, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("patch %s: offset 0x%X is past the end of %s (%d bytes)", patch.Name, patch.Offset, patch.File, entry.Size))
+	}
+
+	data, err := r.ReadEntry(entry)
+	if err != nil {
+		return "", CDFileEntry{}, err
+	}
+	current := data[patch.Offset : int(patch.Offset)+len(original)]
+	switch {
+	case bytes.Equal(current, original):
+		return PatchPending, entry, nil
+	case bytes.Equal(current, patched):
+		return PatchAlreadyApplied, entry, nil
+	default:
+		return "", CDFileEntry{}, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("patch %s: %s holds % X at 0x%X, expected % X; is this the release the patch was made for?",
+				patch.Name, patch.File, current, patch.Offset, original))
+	}
+}
+
+// patchSectorData copies data into the user data of a stored sector from offset start
+// on and regenerates the EDC and ECC of raw sectors. Returns the number of bytes copied.
+func patchSectorData(geometry SectorGeometry, sector []byte, start int, data []byte) int {
+	copied := copy(sector[geometry.DataOffset+start:geometry.DataOffset+CD_DATA_SIZE], data)
+	if geometry.IsRaw() {
+		RepairSectorEDC(sector)
+	}
+	return copied
+}
+
+// WriteFileData writes data at offset of the file starting at lba of a raw or ISO image
+// file and regenerates the EDC and ECC of every raw sector it touches. The touched sectors
+// are written through a CDWriter in one run and synced once; they are restored if a write
+// fails or is interrupted.
+func WriteFileData(ctx context.Context, imagePath string, lba, offset uint32, data []byte) error {
+	writer, err := OpenCDWriter(ctx, imagePath)
+	if err != nil {
+		return err
+	}
+	defer writer.Close()
+
+	if err := writer.WriteFileData(lba, offset, data); err != nil {
+		return err
+	}
+	return writer.Commit()
+}
@@ -0,0 +1,102 @@
+// Package psx provides tests for byte patches of the files of a CD image.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestCDReader_PatchState(t *testing.T) {
+	imagePath, _ := writeSealedBootImage(t)
+	patch := FilePatch{Name: "magic", File: "SLUS_006.23", Offset: 3, Original: "58", Patched: "59"}
+
+	state := func(patch FilePatch) (string, error) {
+		t.Helper()
+		reader, err := NewCDReader(imagePath)
+		if err != nil {
+			t.Fatalf("NewCDReader() failed: %v", err)
+		}
+		defer reader.Close()
+		state, _, err := reader.PatchState(patch)
+		return state, err
+	}
+
+	if got, err := state(patch); err != nil || got != PatchPending {
+		t.Fatalf("PatchState() = %q, %v; want %q", got, err, PatchPending)
+	}
+
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	_, entry, err := reader.PatchState(patch)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("PatchState() failed: %v", err)
+	}
+	if err := WriteFileData(context.Background(), imagePath, entry.LBA, patch.Offset, []byte{0x59}); err != nil {
+		t.Fatalf("WriteFileData(context.Background()) failed: %v", err)
+	}
+
+	if got, err := state(patch); err != nil || got != PatchAlreadyApplied {
+		t.Errorf("PatchState() after writing = %q, %v; want %q", got, err, PatchAlreadyApplied)
+	}
+
+	// The written sector keeps a valid EDC/ECC
+	image, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatalf("failed to read test image: %v", err)
+	}
+	sector := image[int(entry.LBA)*CD_SECTOR_SIZE : int(entry.LBA+1)*CD_SECTOR_SIZE]
+	if got := sector[24+3]; got != 0x59 {
+		t.Errorf("patched byte = 0x%02X, want 0x59", got)
+	}
+	sealed := bytes.Clone(sector)
+	generateMode2Form1EDCECC(sealed)
+	if !bytes.Equal(sector, sealed) {
+		t.Error("patched sector has a stale EDC/ECC")
+	}
+
+	failures := []struct {
+		name  string
+		patch FilePatch
+		code  int
+	}{
+		{"unexpected bytes", FilePatch{Name: "other", File: "SLUS_006.23", Offset: 0, Original: "00", Patched: "01"}, common.ExitValidationFailed},
+		{"past the end", FilePatch{Name: "end", File: "SLUS_006.23", Offset: CD_DATA_SIZE, Original: "00", Patched: "01"}, common.ExitValidationFailed},
+		{"missing file", FilePatch{Name: "missing", File: "MISSING.EXE", Original: "00", Patched: "01"}, common.ExitInputNotFound},
+	}
+	for _, tt := range failures {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := state(tt.patch)
+			if got := common.ExitCodeFor(err); got != tt.code {
+				t.Errorf("PatchState() = %v (exit code %d), want exit code %d", err, got, tt.code)
+			}
+		})
+	}
+}
+
+func TestFilePatch_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		patch   FilePatch
+		wantErr bool
+	}{
+		{"valid", FilePatch{Name: "a", File: "EXE/MAIN0.EXE", Original: "01 00", Patched: "0000"}, false},
+		{"no file", FilePatch{Name: "a", Original: "01", Patched: "00"}, true},
+		{"length mismatch", FilePatch{Name: "a", File: "A", Original: "01 00", Patched: "00"}, true},
+		{"empty", FilePatch{Name: "a", File: "A"}, true},
+		{"invalid hex", FilePatch{Name: "a", File: "A", Original: "0G", Patched: "00"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.patch.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,224 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the finalization of images that grew while being patched: the last
+// sector is completed, the image is optionally padded to a standard disc size and the
+// volume space size of the Primary Volume Descriptor is set to the sectors of the image.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Standard disc lengths the image can be padded to, in minutes
+const (
+	DiscMinutes74 = 74
+	DiscMinutes80 = 80
+)
+
+// finalizeChunkSectors is the number of padding sectors written at once
+const finalizeChunkSectors = 1024
+
+// DiscCapacity returns the sectors of a data track filling a disc of the given length,
+// the 2-second pregap excluded
+func DiscCapacity(minutes int) (int64, error) {
+	if minutes != DiscMinutes74 && minutes != DiscMinutes80 {
+		return 0, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("unsupported disc length %d minutes (want %d or %d)", minutes, DiscMinutes74, DiscMinutes80))
+	}
+	return int64(MSFToSectors(uint32(minutes), 0, 0)) - CD_PREGAP_SECTORS, nil
+}
+
+// FinalizeOptions selects the optional steps of FinalizeImage
+type FinalizeOptions struct {
+	PadMinutes int  // Pad the image with empty sectors to a 74- or 80-minute disc (0 keeps its size)
+	DryRun     bool // Compute the corrections without writing them
+}
+
+// FinalizeReport lists the corrections made to an image
+type FinalizeReport struct {
+	Geometry            string `json:"geometry"`
+	DryRun              bool   `json:"dry_run"`
+	TrailingBytes       int64  `json:"trailing_bytes"` // Bytes of the incomplete last sector, completed with zeros
+	ImageSectorsBefore  int64  `json:"image_sectors_before"`
+	ImageSectors        int64  `json:"image_sectors"`
+	PaddingSectors      int64  `json:"padding_sectors"` // Empty sectors appended
+	VolumeSectorsBefore uint32 `json:"volume_sectors_before"`
+	VolumeSectors       uint32 `json:"volume_sectors"`
+}
+
+// Changed reports whether the image needed any correction
+func (r *FinalizeReport) Changed() bool {
+	return r.TrailingBytes > 0 || r.PaddingSectors > 0 || r.VolumeSectors != r.VolumeSectorsBefore
+}
+
+// FinalizeImage completes the last sector of a plain image, pads it to the requested
+// disc length and sets the volume space size to the sectors of the image. Raw padding
+// sectors carry their address and EDC/ECC. The image is restored if a write fails or is
+// interrupted.
+func FinalizeImage(ctx context.Context, imagePath string, options FinalizeOptions) (*FinalizeReport, error) {
+	flags := os.O_RDWR
+	if options.DryRun {
+		flags = os.O_RDONLY
+	}
+	file, err := os.OpenFile(imagePath, flags, 0)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open CD image: %w", err))
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat CD image: %w", err)
+	}
+	size := info.Size()
+	geometry := DetectGeometry(file, size)
+
+	descriptor := make([]byte, geometry.SectorSize)
+	if _, err := file.ReadAt(descriptor, geometry.SectorOffset(CD_VOLUME_DESCRIPTOR)); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to read volume descriptor: %w", err))
+	}
+	userData := descriptor[geometry.DataOffset : geometry.DataOffset+CD_DATA_SIZE]
+	if userData[0] != 1 || string(userData[1:6]) != "CD001" {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("sector 16 holds no primary volume descriptor"))
+	}
+
+	report := &FinalizeReport{
+		Geometry:            geometry.Name,
+		DryRun:              options.DryRun,
+		TrailingBytes:       size % int64(geometry.SectorSize),
+		ImageSectorsBefore:  geometry.Sectors(size),
+		VolumeSectorsBefore: binary.LittleEndian.Uint32(userData[80:84]),
+	}
+	report.ImageSectors = report.ImageSectorsBefore
+	if report.TrailingBytes > 0 {
+		report.ImageSectors++
+	}
+	if options.PadMinutes != 0 {
+		capacity, err := DiscCapacity(options.PadMinutes)
+		if err != nil {
+			return nil, err
+		}
+		if report.ImageSectors > capacity {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("image has %d sectors, more than the %d of a %d-minute disc", report.ImageSectors, capacity, options.PadMinutes))
+		}
+		report.PaddingSectors = capacity - report.ImageSectors
+		report.ImageSectors = capacity
+	}
+	if report.ImageSectors > int64(^uint32(0)) {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("image has too many sectors: %d", report.ImageSectors))
+	}
+	report.VolumeSectors = uint32(report.ImageSectors)
+
+	if options.DryRun || !report.Changed() {
+		return report, nil
+	}
+
+	// Restore the original size and descriptor if anything below fails
+	original := bytes.Clone(descriptor)
+	lastSector := make([]byte, report.TrailingBytes)
+	if _, err := file.ReadAt(lastSector, size-report.TrailingBytes); err != nil {
+		return nil, fmt.Errorf("failed to read last sector: %w", err)
+	}
+	restore := func() {
+		if err := file.Truncate(size); err != nil {
+			common.LogWarn("Failed to restore the size of %s: %v", imagePath, err)
+		}
+		if _, err := file.WriteAt(lastSector, size-report.TrailingBytes); err != nil {
+			common.LogWarn("Failed to restore the last sector of %s: %v", imagePath, err)
+		}
+		if _, err := file.WriteAt(original, geometry.SectorOffset(CD_VOLUME_DESCRIPTOR)); err != nil {
+			common.LogWarn("Failed to restore the volume descriptor of %s: %v", imagePath, err)
+		}
+	}
+
+	if err := finalizeImage(ctx, file, geometry, size, report); err != nil {
+		restore()
+		return nil, err
+	}
+	common.RecordOutput(imagePath)
+	return report, nil
+}
+
+// finalizeImage writes the corrections of the report to the image
+func finalizeImage(ctx context.Context, file *os.File, geometry SectorGeometry, size int64, report *FinalizeReport) error {
+	if report.TrailingBytes > 0 {
+		sector := make([]byte, geometry.SectorSize)
+		lastLBA := report.ImageSectorsBefore
+		if _, err := file.ReadAt(sector[:report.TrailingBytes], geometry.SectorOffset(lastLBA)); err != nil {
+			return fmt.Errorf("failed to read last sector: %w", err)
+		}
+		if geometry.IsRaw() && bytes.HasPrefix(sector, cdSyncPattern) {
+			RepairSectorEDC(sector)
+		}
+		if _, err := file.WriteAt(sector, geometry.SectorOffset(lastLBA)); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to complete sector %d: %w", lastLBA, err))
+		}
+	}
+
+	first := report.ImageSectors - report.PaddingSectors
+	for lba := first; lba < report.ImageSectors; {
+		if err := common.Canceled(ctx); err != nil {
+			return err
+		}
+		count := min(int64(finalizeChunkSectors), report.ImageSectors-lba)
+		chunk := make([]byte, 0, count*int64(geometry.SectorSize))
+		for i := int64(0); i < count; i++ {
+			chunk = append(chunk, emptySector(geometry, lba+i)...)
+		}
+		if _, err := file.WriteAt(chunk, geometry.SectorOffset(lba)); err != nil {
+			return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write padding at sector %d: %w", lba, err))
+		}
+		lba += count
+	}
+
+	descriptor := make([]byte, geometry.SectorSize)
+	if _, err := file.ReadAt(descriptor, geometry.SectorOffset(CD_VOLUME_DESCRIPTOR)); err != nil {
+		return fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+	volumeSize := make([]byte, 8)
+	binary.LittleEndian.PutUint32(volumeSize[0:4], report.VolumeSectors)
+	binary.BigEndian.PutUint32(volumeSize[4:8], report.VolumeSectors)
+	patchSectorData(geometry, descriptor, 80, volumeSize)
+	if _, err := file.WriteAt(descriptor, geometry.SectorOffset(CD_VOLUME_DESCRIPTOR)); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write volume descriptor: %w", err))
+	}
+
+	if err := common.Canceled(ctx); err != nil {
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to sync CD image: %w", err))
+	}
+	common.LogDebug("Finalized image: %d -> %d bytes, volume %d -> %d sectors",
+		size, geometry.SectorOffset(report.ImageSectors), report.VolumeSectorsBefore, report.VolumeSectors)
+	return nil
+}
+
+// emptySector returns a zero-filled data sector as stored with the geometry. Raw sectors
+// carry the sync pattern, the address of the sector and their EDC/ECC.
+func emptySector(geometry SectorGeometry, lba int64) []byte {
+	if geometry.SectorSize == CD_DATA_SIZE {
+		return make([]byte, CD_DATA_SIZE)
+	}
+
+	sector := make([]byte, CD_SECTOR_SIZE)
+	copy(sector, cdSyncPattern)
+	minutes, seconds, frames := SectorsToMSF(uint32(lba) + CD_PREGAP_SECTORS)
+	sector[CD_SYNC_SIZE] = toBCD(minutes)
+	sector[CD_SYNC_SIZE+1] = toBCD(seconds)
+	sector[CD_SYNC_SIZE+2] = toBCD(frames)
+	sector[CD_MODE_OFFSET] = byte(geometry.Mode)
+	RepairSectorEDC(sector)
+	return sector[CD_SECTOR_SIZE-geometry.SectorSize:]
+}
+
+// toBCD converts a decimal value (0-99) to a BCD byte
+func toBCD(value uint32) byte {
+	return byte(value/10<<4 | value%10)
+}
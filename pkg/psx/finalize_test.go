@@ -0,0 +1,130 @@
+// Package psx provides tests for the finalization of grown images.
+package psx
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// growImage appends sectors whole sectors and a partial sector of trailing bytes to an image
+func growImage(t *testing.T, imagePath string, sectors, trailing int) {
+	t.Helper()
+	file, err := os.OpenFile(imagePath, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open test image: %v", err)
+	}
+	defer file.Close()
+
+	info, _ := file.Stat()
+	first := info.Size() / CD_SECTOR_SIZE
+	for lba := first; lba < first+int64(sectors); lba++ {
+		if _, err := file.Write(emptySector(GeometryMode2Raw, lba)); err != nil {
+			t.Fatalf("failed to grow test image: %v", err)
+		}
+	}
+	if _, err := file.Write(emptySector(GeometryMode2Raw, first+int64(sectors))[:trailing]); err != nil {
+		t.Fatalf("failed to grow test image: %v", err)
+	}
+}
+
+func TestFinalizeImage(t *testing.T) {
+	imagePath := writeISOImage(t, nil)
+	growImage(t, imagePath, 3, 100)
+
+	reader, err := NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	before, err := reader.VerifyISO9660(true)
+	reader.Close()
+	if err != nil {
+		t.Fatalf("VerifyISO9660() failed: %v", err)
+	}
+	if before.TrailingBytes != 100 || len(before.Violations) != 2 {
+		t.Errorf("grown image: trailing bytes %d, violations %+v; want 100 and 2", before.TrailingBytes, before.Violations)
+	}
+
+	original, _ := os.ReadFile(imagePath)
+	report, err := FinalizeImage(context.Background(), imagePath, FinalizeOptions{DryRun: true})
+	if err != nil {
+		t.Fatalf("FinalizeImage(context.Background(), dry run) failed: %v", err)
+	}
+	if current, _ := os.ReadFile(imagePath); !bytes.Equal(current, original) {
+		t.Error("dry run changed the image")
+	}
+	want := FinalizeReport{
+		Geometry:            GeometryMode2Raw.Name,
+		DryRun:              true,
+		TrailingBytes:       100,
+		ImageSectorsBefore:  isoImageSectors + 3,
+		ImageSectors:        isoImageSectors + 4,
+		VolumeSectorsBefore: isoImageSectors,
+		VolumeSectors:       isoImageSectors + 4,
+	}
+	if *report != want {
+		t.Errorf("FinalizeImage(context.Background(), dry run) = %+v, want %+v", *report, want)
+	}
+
+	if _, err := FinalizeImage(context.Background(), imagePath, FinalizeOptions{}); err != nil {
+		t.Fatalf("FinalizeImage(context.Background()) failed: %v", err)
+	}
+	finalized, _ := os.ReadFile(imagePath)
+	if len(finalized) != (isoImageSectors+4)*CD_SECTOR_SIZE {
+		t.Fatalf("finalized image is %d bytes, want %d", len(finalized), (isoImageSectors+4)*CD_SECTOR_SIZE)
+	}
+	last := finalized[len(finalized)-CD_SECTOR_SIZE:]
+	if !bytes.Equal(last, emptySector(GeometryMode2Raw, isoImageSectors+3)) {
+		t.Error("completed last sector is not a valid empty sector")
+	}
+
+	reader, err = NewCDReader(imagePath)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+	after, err := reader.VerifyISO9660(true)
+	if err != nil {
+		t.Fatalf("VerifyISO9660() failed: %v", err)
+	}
+	if len(after.Violations) != 0 || after.VolumeSectors != isoImageSectors+4 {
+		t.Errorf("finalized image: volume %d sectors, violations %+v", after.VolumeSectors, after.Violations)
+	}
+
+	report, err = FinalizeImage(context.Background(), imagePath, FinalizeOptions{})
+	if err != nil || report.Changed() {
+		t.Errorf("second FinalizeImage(context.Background()) = %+v, %v; want no changes", report, err)
+	}
+
+	if _, err := FinalizeImage(context.Background(), imagePath, FinalizeOptions{PadMinutes: 60}); err == nil {
+		t.Error("FinalizeImage(context.Background()) should fail for a 60-minute disc")
+	}
+}
+
+func TestDiscCapacity(t *testing.T) {
+	for minutes, want := range map[int]int64{DiscMinutes74: 332850, DiscMinutes80: 359850} {
+		if got, err := DiscCapacity(minutes); err != nil || got != want {
+			t.Errorf("DiscCapacity(%d) = %d, %v; want %d", minutes, got, err, want)
+		}
+	}
+}
+
+func TestEmptySector(t *testing.T) {
+	sector := emptySector(GeometryMode2Raw, 16)
+	if !bytes.Equal(sector[CD_SYNC_SIZE:CD_SYNC_SIZE+4], []byte{0x00, 0x02, 0x16, 0x02}) {
+		t.Errorf("header = % X, want 00 02 16 02 (00:02:16, mode 2)", sector[CD_SYNC_SIZE:CD_SYNC_SIZE+4])
+	}
+	// The EDC of an empty Mode 2 sector is zero; Mode 1 covers the header too
+	if mode1 := emptySector(GeometryMode1Raw, 16); mode1[CD_MODE_OFFSET] != 1 || binary.LittleEndian.Uint32(mode1[sectorEDCMode1Offset:]) == 0 {
+		t.Error("Mode 1 sector has no mode byte or EDC")
+	}
+
+	if xa := emptySector(GeometryMode2XA, 16); !bytes.Equal(xa, sector[CD_SYNC_SIZE+CD_HEADER_SIZE:]) {
+		t.Error("MODE2/2336 sector differs from the raw sector without sync and header")
+	}
+	if iso := emptySector(GeometryISO, 16); len(iso) != CD_DATA_SIZE {
+		t.Errorf("ISO sector is %d bytes, want %d", len(iso), CD_DATA_SIZE)
+	}
+}
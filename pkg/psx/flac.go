@@ -0,0 +1,446 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the FLAC decoder of the cdfl CHD codec. chdman compresses the sector
+// data of a hunk as 16-bit stereo audio, two big-endian bytes per sample, and writes the
+// FLAC frames without a stream header, so the format of the samples is fixed.
+package psx
+
+import (
+	"fmt"
+)
+
+// Format of the FLAC frames of the cdfl codec
+const (
+	flacChannels      = 2
+	flacBitsPerSample = 16
+	flacSyncCode      = 0x3FFE // 14-bit frame sync code
+)
+
+// Channel assignments of a FLAC frame past the independent ones
+const (
+	flacLeftSide  = 8
+	flacSideRight = 9
+	flacMidSide   = 10
+)
+
+// flacFixedCoefficients are the predictors of the fixed subframes, by order
+var flacFixedCoefficients = [][]int64{{}, {1}, {2, -1}, {3, -3, 1}, {4, -6, 4, -1}}
+
+// flacBitReader reads the bits of a FLAC stream, most significant bit first
+type flacBitReader struct {
+	data []byte
+	bit  int // Position in bits
+}
+
+// bits reads an unsigned count-bit value
+func (r *flacBitReader) bits(count int) (uint64, error) {
+	if r.bit+count > len(r.data)*8 {
+		return 0, fmt.Errorf("FLAC stream of %d bytes ends in the middle of a frame", len(r.data))
+	}
+	var value uint64
+	for ; count > 0; count-- {
+		value = value<<1 | uint64(r.data[r.bit>>3]>>(7-r.bit&7)&1)
+		r.bit++
+	}
+	return value, nil
+}
+
+// signed reads a two's complement count-bit value
+func (r *flacBitReader) signed(count int) (int64, error) {
+	value, err := r.bits(count)
+	if err != nil || count == 0 {
+		return 0, err
+	}
+	return int64(value<<(64-count)) >> (64 - count), nil
+}
+
+// unary counts the zero bits before the next one bit
+func (r *flacBitReader) unary() (uint64, error) {
+	var zeros uint64
+	for {
+		bit, err := r.bits(1)
+		if err != nil {
+			return 0, err
+		}
+		if bit == 1 {
+			return zeros, nil
+		}
+		zeros++
+	}
+}
+
+// rice reads a Rice coded value with the given parameter
+func (r *flacBitReader) rice(parameter int) (int64, error) {
+	quotient, err := r.unary()
+	if err != nil {
+		return 0, err
+	}
+	remainder, err := r.bits(parameter)
+	if err != nil {
+		return 0, err
+	}
+	folded := quotient<<parameter | remainder
+	return int64(folded>>1) ^ -int64(folded&1), nil
+}
+
+// align skips to the next byte boundary
+func (r *flacBitReader) align() {
+	r.bit = (r.bit + 7) &^ 7
+}
+
+// flacFrameHeader is the part of a frame header the decoder needs
+type flacFrameHeader struct {
+	blockSize int
+	channels  int // Channel assignment
+}
+
+// readHeader reads a frame header and checks its CRC-8
+func (r *flacBitReader) readHeader() (flacFrameHeader, error) {
+	var header flacFrameHeader
+	start := r.bit >> 3
+	sync, err := r.bits(15)
+	if err != nil {
+		return header, err
+	}
+	if sync != flacSyncCode<<1 {
+		return header, fmt.Errorf("no FLAC frame at offset %d", start)
+	}
+	fields, err := r.bits(17)
+	if err != nil {
+		return header, err
+	}
+	blockSizeCode := int(fields >> 12 & 0xF)
+	sampleRateCode := int(fields >> 8 & 0xF)
+	header.channels = int(fields >> 4 & 0xF)
+	sampleSizeCode := int(fields >> 1 & 0x7)
+
+	// Frame or sample number, UTF-8 coded: the leading ones of the first byte count its bytes
+	first, err := r.bits(8)
+	if err != nil {
+		return header, err
+	}
+	length := 0
+	for first&(0x80>>length) != 0 && length < 8 {
+		length++
+	}
+	if length == 1 || length > 7 {
+		return header, fmt.Errorf("FLAC frame at offset %d has an invalid frame number", start)
+	}
+	for ; length > 1; length-- {
+		if _, err := r.bits(8); err != nil {
+			return header, err
+		}
+	}
+
+	switch {
+	case blockSizeCode == 1:
+		header.blockSize = 192
+	case blockSizeCode >= 2 && blockSizeCode <= 5:
+		header.blockSize = 576 << (blockSizeCode - 2)
+	case blockSizeCode == 6 || blockSizeCode == 7:
+		size, err := r.bits(8 * (blockSizeCode - 5))
+		if err != nil {
+			return header, err
+		}
+		header.blockSize = int(size) + 1
+	case blockSizeCode >= 8:
+		header.blockSize = 256 << (blockSizeCode - 8)
+	default:
+		return header, fmt.Errorf("FLAC frame at offset %d has a reserved block size", start)
+	}
+	switch sampleRateCode {
+	case 12:
+		_, err = r.bits(8)
+	case 13, 14:
+		_, err = r.bits(16)
+	case 15:
+		err = fmt.Errorf("FLAC frame at offset %d has an invalid sample rate", start)
+	}
+	if err != nil {
+		return header, err
+	}
+	if sampleSizeCode != 0 && sampleSizeCode != 4 {
+		return header, fmt.Errorf("FLAC frame at offset %d does not hold %d-bit samples", start, flacBitsPerSample)
+	}
+	if header.channels != flacChannels-1 && (header.channels < flacLeftSide || header.channels > flacMidSide) {
+		return header, fmt.Errorf("FLAC frame at offset %d does not hold %d channels", start, flacChannels)
+	}
+
+	crc, err := r.bits(8)
+	if err != nil {
+		return header, err
+	}
+	if got := crc8(r.data[start : r.bit>>3-1]); uint64(got) != crc {
+		return header, fmt.Errorf("FLAC frame header at offset %d fails its CRC check (%02X, expected %02X)", start, got, crc)
+	}
+	return header, nil
+}
+
+// readSubframe decodes a subframe of bitsPerSample-bit samples into samples
+func (r *flacBitReader) readSubframe(samples []int64, bitsPerSample int) error {
+	header, err := r.bits(8)
+	if err != nil {
+		return err
+	}
+	if header&0x80 != 0 {
+		return fmt.Errorf("FLAC subframe has its padding bit set")
+	}
+	wasted := 0
+	if header&1 != 0 {
+		zeros, err := r.unary()
+		if err != nil {
+			return err
+		}
+		wasted = int(zeros) + 1
+		if wasted >= bitsPerSample {
+			return fmt.Errorf("FLAC subframe wastes %d of %d bits", wasted, bitsPerSample)
+		}
+		bitsPerSample -= wasted
+	}
+
+	switch kind := int(header >> 1 & 0x3F); {
+	case kind == 0:
+		value, err := r.signed(bitsPerSample)
+		if err != nil {
+			return err
+		}
+		for i := range samples {
+			samples[i] = value
+		}
+	case kind == 1:
+		for i := range samples {
+			if samples[i], err = r.signed(bitsPerSample); err != nil {
+				return err
+			}
+		}
+	case kind >= 8 && kind <= 12:
+		order := kind - 8
+		if err := r.readWarmUp(samples, order, bitsPerSample); err != nil {
+			return err
+		}
+		if err := r.readResidual(samples, order); err != nil {
+			return err
+		}
+		predict(samples, flacFixedCoefficients[order], 0)
+	case kind >= 32:
+		order := kind - 31
+		if err := r.readWarmUp(samples, order, bitsPerSample); err != nil {
+			return err
+		}
+		precision, err := r.bits(4)
+		if err != nil {
+			return err
+		}
+		if precision == 0xF {
+			return fmt.Errorf("FLAC subframe has an invalid coefficient precision")
+		}
+		shift, err := r.signed(5)
+		if err != nil {
+			return err
+		}
+		if shift < 0 {
+			return fmt.Errorf("FLAC subframe has a negative prediction shift")
+		}
+		coefficients := make([]int64, order)
+		for i := range coefficients {
+			if coefficients[i], err = r.signed(int(precision) + 1); err != nil {
+				return err
+			}
+		}
+		if err := r.readResidual(samples, order); err != nil {
+			return err
+		}
+		predict(samples, coefficients, int(shift))
+	default:
+		return fmt.Errorf("FLAC subframe has the reserved type %d", kind)
+	}
+
+	if wasted > 0 {
+		for i := range samples {
+			samples[i] <<= wasted
+		}
+	}
+	return nil
+}
+
+// readWarmUp reads the order unpredicted samples a predicted subframe starts with
+func (r *flacBitReader) readWarmUp(samples []int64, order, bitsPerSample int) error {
+	if order > len(samples) {
+		return fmt.Errorf("FLAC subframe of order %d is longer than its %d samples", order, len(samples))
+	}
+	var err error
+	for i := 0; i < order; i++ {
+		if samples[i], err = r.signed(bitsPerSample); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readResidual reads the partitioned Rice coded residual of a subframe into the samples
+// after the order warm-up samples
+func (r *flacBitReader) readResidual(samples []int64, order int) error {
+	method, err := r.bits(2)
+	if err != nil {
+		return err
+	}
+	parameterBits, escape := 4, 0xF
+	switch method {
+	case 0:
+	case 1:
+		parameterBits, escape = 5, 0x1F
+	default:
+		return fmt.Errorf("FLAC residual has the reserved coding method %d", method)
+	}
+	partitionOrder, err := r.bits(4)
+	if err != nil {
+		return err
+	}
+	partitions := 1 << partitionOrder
+	if len(samples)%partitions != 0 || len(samples)>>partitionOrder < order {
+		return fmt.Errorf("FLAC residual of %d samples cannot have %d partitions", len(samples), partitions)
+	}
+
+	i := order
+	for partition := 0; partition < partitions; partition++ {
+		end := (partition + 1) * (len(samples) >> partitionOrder)
+		parameter, err := r.bits(parameterBits)
+		if err != nil {
+			return err
+		}
+		if int(parameter) == escape {
+			rawBits, err := r.bits(5)
+			if err != nil {
+				return err
+			}
+			for ; i < end; i++ {
+				if samples[i], err = r.signed(int(rawBits)); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for ; i < end; i++ {
+			if samples[i], err = r.rice(int(parameter)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// predict turns the residual after the warm-up samples into samples
+func predict(samples []int64, coefficients []int64, shift int) {
+	for i := len(coefficients); i < len(samples); i++ {
+		var prediction int64
+		for j, coefficient := range coefficients {
+			prediction += coefficient * samples[i-1-j]
+		}
+		samples[i] += prediction >> shift
+	}
+}
+
+// decodeFLACFrames decodes the FLAC frames at the start of src into dst as big-endian
+// 16-bit stereo samples and returns the bytes of src the frames took. Samples of the last
+// frame past the end of dst are dropped.
+func decodeFLACFrames(src, dst []byte) (int, error) {
+	reader := &flacBitReader{data: src}
+	total := len(dst) / (flacChannels * flacBitsPerSample / 8)
+	var channels [flacChannels][]int64
+	for written := 0; written < total; {
+		start := reader.bit >> 3
+		header, err := reader.readHeader()
+		if err != nil {
+			return 0, err
+		}
+		for channel := range channels {
+			bitsPerSample := flacBitsPerSample
+			if (header.channels == flacLeftSide || header.channels == flacMidSide) && channel == 1 ||
+				header.channels == flacSideRight && channel == 0 {
+				bitsPerSample++ // The side channel holds a difference
+			}
+			channels[channel] = make([]int64, header.blockSize)
+			if err := reader.readSubframe(channels[channel], bitsPerSample); err != nil {
+				return 0, fmt.Errorf("FLAC frame at offset %d: %w", start, err)
+			}
+		}
+		reader.align()
+		crc, err := reader.bits(16)
+		if err != nil {
+			return 0, err
+		}
+		if got := crc16FLAC(src[start : reader.bit>>3-2]); uint64(got) != crc {
+			return 0, fmt.Errorf("FLAC frame at offset %d fails its CRC check (%04X, expected %04X)", start, got, crc)
+		}
+
+		left, right := channels[0], channels[1]
+		for i := 0; i < header.blockSize && written < total; i++ {
+			switch header.channels {
+			case flacLeftSide:
+				right[i] = left[i] - right[i]
+			case flacSideRight:
+				left[i] += right[i]
+			case flacMidSide:
+				mid := left[i]<<1 | right[i]&1
+				left[i], right[i] = (mid+right[i])>>1, (mid-right[i])>>1
+			}
+			sample := dst[written*4 : written*4+4]
+			sample[0], sample[1] = byte(left[i]>>8), byte(left[i])
+			sample[2], sample[3] = byte(right[i]>>8), byte(right[i])
+			written++
+		}
+	}
+	return reader.bit >> 3, nil
+}
+
+// crc8 computes the CRC-8 of FLAC frame headers (polynomial 0x07)
+func crc8(data []byte) byte {
+	var crc byte
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x07
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// crc16FLAC computes the CRC-16 of FLAC frames (polynomial 0x8005)
+func crc16FLAC(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// decompressFLACCDHunk decompresses a hunk of the cdfl codec: the sector data of every
+// frame as FLAC frames, then the subcode deflated. Unlike the other CD codecs it keeps
+// the sync pattern and ECC of the sectors.
+func decompressFLACCDHunk(src, dst []byte) error {
+	frames := len(dst) / chdFrameSize
+	sectors := make([]byte, frames*CD_SECTOR_SIZE)
+	length, err := decodeFLACFrames(src, sectors)
+	if err != nil {
+		return fmt.Errorf("failed to decode FLAC hunk: %w", err)
+	}
+	subcodes := make([]byte, frames*chdSubcodeSize)
+	if err := inflateHunk(src[length:], subcodes); err != nil {
+		return err
+	}
+	for frame := 0; frame < frames; frame++ {
+		copy(dst[frame*chdFrameSize:], sectors[frame*CD_SECTOR_SIZE:(frame+1)*CD_SECTOR_SIZE])
+		copy(dst[frame*chdFrameSize+CD_SECTOR_SIZE:(frame+1)*chdFrameSize], subcodes[frame*chdSubcodeSize:])
+	}
+	return nil
+}
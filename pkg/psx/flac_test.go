@@ -0,0 +1,209 @@
+// Package psx provides tests for the FLAC decoder of CHD images.
+package psx
+
+import (
+	"bytes"
+	"testing"
+)
+
+// flacTestSubframe encodes the samples of a subframe
+type flacTestSubframe func(bits *chdBitWriter, samples []int64, bitsPerSample int)
+
+// flacConstant encodes a subframe whose samples all equal the first one
+func flacConstant(bits *chdBitWriter, samples []int64, bitsPerSample int) {
+	bits.write(0, 8)
+	bits.write(uint64(samples[0]), bitsPerSample)
+}
+
+// flacVerbatim encodes a subframe of unpredicted samples
+func flacVerbatim(bits *chdBitWriter, samples []int64, bitsPerSample int) {
+	bits.write(1<<1, 8)
+	for _, sample := range samples {
+		bits.write(uint64(sample), bitsPerSample)
+	}
+}
+
+// flacFixed encodes a fixed subframe of the given order with one Rice partition
+func flacFixed(order, parameter int) flacTestSubframe {
+	return func(bits *chdBitWriter, samples []int64, bitsPerSample int) {
+		bits.write(uint64(8+order)<<1, 8)
+		writeFLACPredicted(bits, samples, bitsPerSample, flacFixedCoefficients[order], 0, parameter)
+	}
+}
+
+// flacLPC encodes an LPC subframe with the given coefficients and two Rice partitions
+// (the second one escaped to raw 20-bit values)
+func flacLPC(coefficients []int64, precision, shift, parameter int) flacTestSubframe {
+	return func(bits *chdBitWriter, samples []int64, bitsPerSample int) {
+		bits.write(uint64(31+len(coefficients))<<1, 8)
+		for _, sample := range samples[:len(coefficients)] {
+			bits.write(uint64(sample), bitsPerSample)
+		}
+		bits.write(uint64(precision-1), 4)
+		bits.write(uint64(shift), 5)
+		for _, coefficient := range coefficients {
+			bits.write(uint64(coefficient), precision)
+		}
+
+		residual := flacResidual(samples, coefficients, shift)
+		bits.write(1, 2) // 5-bit Rice parameters
+		bits.write(1, 4) // Two partitions
+		half := len(samples) / 2
+		bits.write(uint64(parameter), 5)
+		for _, value := range residual[len(coefficients):half] {
+			writeRice(bits, value, parameter)
+		}
+		bits.write(0x1F, 5)
+		bits.write(20, 5)
+		for _, value := range residual[half:] {
+			bits.write(uint64(value), 20)
+		}
+	}
+}
+
+// writeFLACPredicted writes the warm-up samples and the residual of a predicted subframe
+// as a single partition of 4-bit Rice parameters
+func writeFLACPredicted(bits *chdBitWriter, samples []int64, bitsPerSample int, coefficients []int64, shift, parameter int) {
+	for _, sample := range samples[:len(coefficients)] {
+		bits.write(uint64(sample), bitsPerSample)
+	}
+	bits.write(0, 2)
+	bits.write(0, 4)
+	bits.write(uint64(parameter), 4)
+	for _, value := range flacResidual(samples, coefficients, shift)[len(coefficients):] {
+		writeRice(bits, value, parameter)
+	}
+}
+
+// flacResidual returns the prediction errors of the samples
+func flacResidual(samples []int64, coefficients []int64, shift int) []int64 {
+	residual := make([]int64, len(samples))
+	for i := len(coefficients); i < len(samples); i++ {
+		var prediction int64
+		for j, coefficient := range coefficients {
+			prediction += coefficient * samples[i-1-j]
+		}
+		residual[i] = samples[i] - prediction>>shift
+	}
+	return residual
+}
+
+// writeRice writes a Rice coded value
+func writeRice(bits *chdBitWriter, value int64, parameter int) {
+	folded := uint64(value<<1 ^ value>>63)
+	for quotient := folded >> parameter; quotient > 0; quotient-- {
+		bits.write(0, 1)
+	}
+	bits.write(1, 1)
+	bits.write(folded, parameter)
+}
+
+// flacFrame encodes a frame of 16-bit stereo samples with a channel assignment, the way
+// the cdfl codec stores sector data
+func flacFrame(left, right []int64, assignment int, subframe flacTestSubframe) []byte {
+	bits := &chdBitWriter{}
+	bits.write(flacSyncCode<<2, 16)
+	bits.write(7, 4) // 16-bit block size after the frame number
+	bits.write(9, 4) // 44.1 kHz
+	bits.write(uint64(assignment), 4)
+	bits.write(4, 3) // 16-bit samples
+	bits.write(0, 1)
+	bits.write(0, 8) // Frame number
+	bits.write(uint64(len(left)-1), 16)
+	bits.write(uint64(crc8(bits.data)), 8)
+
+	first, second := left, right
+	firstBits, secondBits := flacBitsPerSample, flacBitsPerSample
+	side := make([]int64, len(left))
+	for i := range side {
+		side[i] = left[i] - right[i]
+	}
+	switch assignment {
+	case flacLeftSide:
+		second, secondBits = side, flacBitsPerSample+1
+	case flacSideRight:
+		first, firstBits = side, flacBitsPerSample+1
+	case flacMidSide:
+		mid := make([]int64, len(left))
+		for i := range mid {
+			mid[i] = (left[i] + right[i]) >> 1
+		}
+		first, second, secondBits = mid, side, flacBitsPerSample+1
+	}
+	subframe(bits, first, firstBits)
+	subframe(bits, second, secondBits)
+
+	bits.bits = len(bits.data) * 8
+	crc := crc16FLAC(bits.data)
+	return append(bits.data, byte(crc>>8), byte(crc))
+}
+
+// flacChannelSamples splits sector data into the big-endian left and right samples cdfl
+// compresses
+func flacChannelSamples(data []byte) (left, right []int64) {
+	for i := 0; i+4 <= len(data); i += 4 {
+		left = append(left, int64(int16(uint16(data[i])<<8|uint16(data[i+1]))))
+		right = append(right, int64(int16(uint16(data[i+2])<<8|uint16(data[i+3]))))
+	}
+	return left, right
+}
+
+func TestDecodeFLACFrames(t *testing.T) {
+	// A smooth waveform the predictors fit, with some noise
+	const blockSize = 96
+	want := make([]byte, 6*blockSize*4)
+	for i := 0; i < len(want)/4; i++ {
+		left := int16(i*i%4000 - 2000 + i%7)
+		right := int16(left/2 + int16(i%5) - 300)
+		want[i*4], want[i*4+1] = byte(left>>8), byte(left)
+		want[i*4+2], want[i*4+3] = byte(right>>8), byte(right)
+	}
+	left, right := flacChannelSamples(want)
+	constant := bytes.Repeat([]byte{0x12, 0x34, 0x12, 0x34}, blockSize)
+	copy(want[5*blockSize*4:], constant)
+
+	frames := []struct {
+		assignment int
+		subframe   flacTestSubframe
+	}{
+		{flacChannels - 1, flacVerbatim},
+		{flacLeftSide, flacFixed(2, 6)},
+		{flacSideRight, flacFixed(4, 8)},
+		{flacMidSide, flacLPC([]int64{3, -3, 1}, 4, 0, 7)},
+		{flacChannels - 1, flacLPC([]int64{15, -7}, 6, 3, 9)},
+		{flacLeftSide, flacConstant},
+	}
+	var stream []byte
+	for i, frame := range frames {
+		frameLeft, frameRight := left[i*blockSize:(i+1)*blockSize], right[i*blockSize:(i+1)*blockSize]
+		if i == 5 {
+			frameLeft, frameRight = flacChannelSamples(constant)
+		}
+		stream = append(stream, flacFrame(frameLeft, frameRight, frame.assignment, frame.subframe)...)
+	}
+	length := len(stream)
+	stream = append(stream, "subcode"...)
+
+	got := make([]byte, len(want))
+	n, err := decodeFLACFrames(stream, got)
+	if err != nil {
+		t.Fatalf("decodeFLACFrames() failed: %v", err)
+	}
+	if n != length {
+		t.Errorf("decodeFLACFrames() took %d bytes, want the %d bytes of the frames", n, length)
+	}
+	for i := 0; i < len(want); i += 4 {
+		if !bytes.Equal(got[i:i+4], want[i:i+4]) {
+			t.Fatalf("sample %d (frame %d) = % X, want % X", i/4, i/4/blockSize, got[i:i+4], want[i:i+4])
+		}
+	}
+
+	corrupt := bytes.Clone(stream)
+	corrupt[length-3] ^= 0x01
+	if _, err := decodeFLACFrames(corrupt, got); err == nil {
+		t.Error("decodeFLACFrames() of a corrupt frame succeeded, want a CRC error")
+	}
+	if _, err := decodeFLACFrames(stream[:length/2], got); err == nil {
+		t.Error("decodeFLACFrames() of a truncated stream succeeded, want an error")
+	}
+}
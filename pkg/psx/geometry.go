@@ -0,0 +1,142 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the sector geometry of CD images and the byte, sector and MSF
+// arithmetic shared by every reader and writer of disc images.
+package psx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SectorGeometry describes how the 2048-byte user data of every sector is stored in an
+// image file
+type SectorGeometry struct {
+	Name       string    // Short description (e.g. "MODE2/2352")
+	Mode       TrackMode // Track mode of the data sectors
+	SectorSize int       // Bytes per sector in the image file
+	DataOffset int       // Offset of the user data within a stored sector
+}
+
+// Sector geometries of the supported image layouts
+var (
+	// GeometryMode1Raw is a raw Mode 1 image: sync, header, data, EDC/ECC
+	GeometryMode1Raw = SectorGeometry{Name: "MODE1/2352", Mode: TrackMode1, SectorSize: CD_SECTOR_SIZE, DataOffset: CD_SYNC_SIZE + CD_HEADER_SIZE}
+	// GeometryMode2Raw is a raw Mode 2 (XA) image: sync, header, subheader, data, EDC/ECC
+	GeometryMode2Raw = SectorGeometry{Name: "MODE2/2352", Mode: TrackMode2, SectorSize: CD_SECTOR_SIZE, DataOffset: CD_SYNC_SIZE + CD_HEADER_SIZE + CD_SUBHEADER_SIZE}
+	// GeometryMode2XA is a Mode 2 image without sync and header: subheader, data, EDC/ECC
+	GeometryMode2XA = SectorGeometry{Name: "MODE2/2336", Mode: TrackMode2, SectorSize: CD_XA_DATA_SIZE, DataOffset: CD_SUBHEADER_SIZE}
+	// GeometryISO is a cooked ISO image holding only the user data
+	GeometryISO = SectorGeometry{Name: "MODE1/2048", Mode: TrackMode1, SectorSize: CD_DATA_SIZE, DataOffset: 0}
+)
+
+// IsRaw reports whether stored sectors carry the sync pattern and header
+func (g SectorGeometry) IsRaw() bool {
+	return g.SectorSize == CD_SECTOR_SIZE
+}
+
+// HasSubheader reports whether stored sectors carry the XA subheader of Mode 2 sectors,
+// just before the user data. Raw Mode 1 sectors keep the sync pattern and header there.
+func (g SectorGeometry) HasSubheader() bool {
+	return g.Mode == TrackMode2 && g.DataOffset >= CD_SUBHEADER_SIZE
+}
+
+// SectorOffset returns the byte offset of a stored sector in the image file
+func (g SectorGeometry) SectorOffset(lba int64) int64 {
+	return lba * int64(g.SectorSize)
+}
+
+// UserDataOffset returns the byte offset in the image file of the user data of a sector
+func (g SectorGeometry) UserDataOffset(lba int64) int64 {
+	return g.SectorOffset(lba) + int64(g.DataOffset)
+}
+
+// Sectors returns the number of whole sectors in an image file of the given size
+func (g SectorGeometry) Sectors(imageSize int64) int64 {
+	return imageSize / int64(g.SectorSize)
+}
+
+// DetectGeometry selects the sector geometry of an image from its size and the position
+// of the "CD001" signature of the Primary Volume Descriptor. Images whose last sector is
+// incomplete are matched by the signature alone. Raw images without a recognizable
+// descriptor use the mode byte of sector 16, defaulting to Mode 2.
+func DetectGeometry(file io.ReaderAt, imageSize int64) SectorGeometry {
+	hasSignature := func(geometry SectorGeometry, wholeSectors bool) bool {
+		if wholeSectors && imageSize%int64(geometry.SectorSize) != 0 {
+			return false
+		}
+		signature := make([]byte, 5)
+		_, err := file.ReadAt(signature, geometry.UserDataOffset(CD_VOLUME_DESCRIPTOR)+1)
+		return err == nil && bytes.Equal(signature, []byte("CD001"))
+	}
+
+	for _, wholeSectors := range []bool{true, false} {
+		for _, geometry := range []SectorGeometry{GeometryMode2Raw, GeometryMode1Raw, GeometryMode2XA, GeometryISO} {
+			if hasSignature(geometry, wholeSectors) {
+				return geometry
+			}
+		}
+	}
+
+	mode := make([]byte, 1)
+	if _, err := file.ReadAt(mode, GeometryMode1Raw.SectorOffset(CD_VOLUME_DESCRIPTOR)+CD_MODE_OFFSET); err == nil && mode[0] == 1 {
+		return GeometryMode1Raw
+	}
+	return GeometryMode2Raw
+}
+
+// DetectImageGeometry opens an image file and returns its sector geometry
+func DetectImageGeometry(imagePath string) (SectorGeometry, error) {
+	image, err := OpenImage(imagePath)
+	if err != nil {
+		return SectorGeometry{}, err
+	}
+	defer image.Close()
+
+	return DetectGeometry(image, image.Size()), nil
+}
+
+// DataSectors returns the number of sectors holding size bytes of user data
+func DataSectors(size uint32) uint32 {
+	return (size + CD_DATA_SIZE - 1) / CD_DATA_SIZE
+}
+
+// SectorPayload returns the bytes of file data per sector of a file with the given
+// CD-XA attributes: 2336 for Form 2 files, 2352 for CD-DA tracks and 2048 otherwise
+func SectorPayload(xaAttributes uint16) uint32 {
+	switch {
+	case xaAttributes&XA_ATTR_CDDA != 0:
+		return CD_SECTOR_SIZE
+	case xaAttributes&XA_ATTR_FORM2 != 0:
+		return CD_XA_DATA_SIZE
+	default:
+		return CD_DATA_SIZE
+	}
+}
+
+// PayloadSectors returns the number of sectors holding size bytes at payload bytes
+// per sector (0 means 2048)
+func PayloadSectors(size, payload uint32) uint32 {
+	if payload == 0 {
+		return DataSectors(size)
+	}
+	return (size + payload - 1) / payload
+}
+
+// SectorsToMSF splits an absolute sector count (pregap included) into minutes, seconds
+// and frames
+func SectorsToMSF(totalSectors uint32) (minutes, seconds, frames uint32) {
+	const sectorsPerMinute = CD_SECONDS_PER_MINUTE * CD_FRAMES_PER_SECOND
+	return totalSectors / sectorsPerMinute, totalSectors % sectorsPerMinute / CD_FRAMES_PER_SECOND, totalSectors % CD_FRAMES_PER_SECOND
+}
+
+// MSFToSectors returns the absolute sector count (pregap included) of a timecode
+func MSFToSectors(minutes, seconds, frames uint32) uint32 {
+	return (minutes*CD_SECONDS_PER_MINUTE+seconds)*CD_FRAMES_PER_SECOND + frames
+}
+
+// LBAToMSF returns the decimal MM:SS:FF timecode of an LBA, pregap included
+func LBAToMSF(lba uint32) string {
+	minutes, seconds, frames := SectorsToMSF(lba + CD_PREGAP_SECTORS)
+	return fmt.Sprintf("%02d:%02d:%02d", minutes, seconds, frames)
+}
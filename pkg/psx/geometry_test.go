@@ -0,0 +1,118 @@
+// Package psx provides tests for CD image sector geometry.
+package psx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeGeometryImage creates an image of the given geometry whose sector N user data is
+// filled with byte N, with the "CD001" signature in the Primary Volume Descriptor
+func writeGeometryImage(t *testing.T, geometry SectorGeometry, sectors int) string {
+	t.Helper()
+
+	image := make([]byte, sectors*geometry.SectorSize)
+	for sector := 0; sector < sectors; sector++ {
+		stored := image[geometry.SectorOffset(int64(sector)):geometry.SectorOffset(int64(sector+1))]
+		if geometry.IsRaw() {
+			stored[CD_MODE_OFFSET] = byte(geometry.Mode)
+		}
+		data := stored[geometry.DataOffset : geometry.DataOffset+CD_DATA_SIZE]
+		for i := range data {
+			data[i] = byte(sector)
+		}
+		if sector == CD_VOLUME_DESCRIPTOR {
+			copy(data, "\x01CD001\x01")
+		}
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "image.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestDetectGeometry(t *testing.T) {
+	for _, geometry := range []SectorGeometry{GeometryMode1Raw, GeometryMode2Raw, GeometryMode2XA, GeometryISO} {
+		reader, err := NewCDReader(writeGeometryImage(t, geometry, 20))
+		if err != nil {
+			t.Fatalf("NewCDReader(%s) failed: %v", geometry.Name, err)
+		}
+
+		if got := reader.Geometry(); got != geometry {
+			t.Errorf("Geometry() = %s, want %s", got.Name, geometry.Name)
+		}
+		if reader.TotalSectors() != 20 {
+			t.Errorf("%s: TotalSectors() = %d, want 20", geometry.Name, reader.TotalSectors())
+		}
+		if mode, err := reader.DetectTrackMode(); err != nil || mode != geometry.Mode {
+			t.Errorf("%s: DetectTrackMode() = %v, %v, want %v", geometry.Name, mode, err, geometry.Mode)
+		}
+
+		// A read crossing a sector boundary returns the user data of both sectors
+		if err := reader.SeekToSector(5); err != nil {
+			t.Fatalf("%s: SeekToSector() failed: %v", geometry.Name, err)
+		}
+		data := make([]byte, CD_DATA_SIZE+10)
+		if _, err := reader.ReadBytes(data); err != nil {
+			t.Fatalf("%s: ReadBytes() failed: %v", geometry.Name, err)
+		}
+		want := append(bytes.Repeat([]byte{5}, CD_DATA_SIZE), bytes.Repeat([]byte{6}, 10)...)
+		if !bytes.Equal(data, want) {
+			t.Errorf("%s: ReadBytes() did not return the user data of sectors 5 and 6", geometry.Name)
+		}
+		reader.Close()
+	}
+}
+
+func TestDetectGeometry_Fallback(t *testing.T) {
+	// Images without a volume descriptor keep the historical raw Mode 2 layout
+	reader, err := NewCDReader(writeTestImage(t, 4))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	if got := reader.Geometry(); got != GeometryMode2Raw {
+		t.Errorf("Geometry() = %s, want %s", got.Name, GeometryMode2Raw.Name)
+	}
+}
+
+func TestSectorMath(t *testing.T) {
+	tests := []struct {
+		size uint32
+		want uint32
+	}{
+		{0, 0},
+		{1, 1},
+		{CD_DATA_SIZE, 1},
+		{CD_DATA_SIZE + 1, 2},
+	}
+	for _, tt := range tests {
+		if got := DataSectors(tt.size); got != tt.want {
+			t.Errorf("DataSectors(%d) = %d, want %d", tt.size, got, tt.want)
+		}
+	}
+
+	msfTests := []struct {
+		lba  uint32
+		want string
+	}{
+		{0, "00:02:00"},
+		{16, "00:02:16"},
+		{4350, "01:00:00"},
+		{4349, "00:59:74"},
+	}
+	for _, tt := range msfTests {
+		if got := LBAToMSF(tt.lba); got != tt.want {
+			t.Errorf("LBAToMSF(%d) = %s, want %s", tt.lba, got, tt.want)
+		}
+		minutes, seconds, frames := SectorsToMSF(tt.lba + CD_PREGAP_SECTORS)
+		if got := MSFToSectors(minutes, seconds, frames); got != tt.lba+CD_PREGAP_SECTORS {
+			t.Errorf("MSFToSectors(SectorsToMSF(%d)) = %d", tt.lba+CD_PREGAP_SECTORS, got)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the image backends: every CD image is read through an ImageBackend
+// presenting the plain image bytes, so compressed dumps (ECM, CHD) are read directly
+// without converting them back to .bin first.
+package psx
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Formats of the image files a backend reads
+const (
+	ImageFormatRaw = "raw" // Plain .bin/.iso image
+	ImageFormatECM = "ecm" // ECM-compressed image (error correction data stripped)
+	ImageFormatCHD = "chd" // MAME compressed hunks of data (CHD v5)
+)
+
+// ImageBackend gives read-only access to the plain image stored in an image file
+type ImageBackend interface {
+	io.ReaderAt
+	io.Closer
+
+	// Size returns the size in bytes of the plain image
+	Size() int64
+
+	// Format returns the format of the image file (one of the ImageFormat values)
+	Format() string
+}
+
+// Magic numbers of the compressed image formats
+var (
+	ecmMagic = []byte("ECM\x00")
+	chdMagic = []byte("MComprHD")
+)
+
+// OpenImage opens an image file with the backend matching its contents: ECM and CHD files
+// are recognized by their magic number, anything else is read as a plain image
+func OpenImage(path string) (ImageBackend, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(chdMagic))
+	n, err := io.ReadFull(file, magic)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		file.Close()
+		return nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	magic = magic[:n]
+
+	var backend ImageBackend
+	switch {
+	case bytes.HasPrefix(magic, ecmMagic):
+		backend, err = newECMImage(file)
+	case bytes.HasPrefix(magic, chdMagic):
+		backend, err = newCHDImage(file)
+	default:
+		backend, err = newRawImage(file)
+	}
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return backend, nil
+}
+
+// rawImage reads a plain image file
+type rawImage struct {
+	*os.File
+	size int64
+}
+
+// newRawImage wraps an open plain image file
+func newRawImage(file *os.File) (*rawImage, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return &rawImage{File: file, size: info.Size()}, nil
+}
+
+// Size returns the size of the image file
+func (r *rawImage) Size() int64 {
+	return r.size
+}
+
+// Format returns ImageFormatRaw
+func (r *rawImage) Format() string {
+	return ImageFormatRaw
+}
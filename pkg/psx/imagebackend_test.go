@@ -0,0 +1,341 @@
+// Package psx provides tests for reading compressed CD images through the image backends.
+package psx
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// writeSealedBootImage writes a bootable Mode 2 image whose sectors carry a sync pattern
+// and valid EDC/ECC, and returns its path and contents. The unused last sector is a Mode 1
+// sector, to cover both sector types.
+func writeSealedBootImage(t *testing.T) (string, []byte) {
+	t.Helper()
+	source := writeBootImage(t, bootImageOptions{
+		license:   "          Licensed  by          Sony Computer Entertainment Amer  ica ",
+		systemCNF: "BOOT = cdrom:\\SLUS_006.23;1\r\n",
+		exeName:   "SLUS_006.23",
+		exeRegion: "North America area",
+	})
+	image, err := os.ReadFile(source)
+	if err != nil {
+		t.Fatalf("failed to read test image: %v", err)
+	}
+	for offset := 0; offset < len(image); offset += CD_SECTOR_SIZE {
+		sector := image[offset : offset+CD_SECTOR_SIZE]
+		copy(sector, cdSyncPattern)
+		if offset+CD_SECTOR_SIZE == len(image) {
+			sector[CD_MODE_OFFSET] = 1
+			copy(sector[16:], "MODE1 SECTOR")
+			generateMode1EDCECC(sector)
+			continue
+		}
+		generateMode2Form1EDCECC(sector)
+	}
+	if err := os.WriteFile(source, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return source, image
+}
+
+// ecmRecordHeader encodes the type and count of an ECM record
+func ecmRecordHeader(recordType int, count uint32) []byte {
+	value := count - 1
+	current := byte(recordType) | byte(value&0x1F)<<2
+	value >>= 5
+	var header []byte
+	for value != 0 {
+		header = append(header, current|0x80)
+		current = byte(value & 0x7F)
+		value >>= 7
+	}
+	return append(header, current)
+}
+
+// writeECMImage compresses a raw image to ECM: Mode 1 sectors as Mode 1 records, Mode 2
+// sectors as their sync and header in raw bytes followed by a Mode 2 Form 1 record
+func writeECMImage(t *testing.T, image []byte) string {
+	t.Helper()
+	ecm := append([]byte{}, ecmMagic...)
+	for offset := 0; offset < len(image); offset += CD_SECTOR_SIZE {
+		sector := image[offset : offset+CD_SECTOR_SIZE]
+		if sector[CD_MODE_OFFSET] == 1 {
+			ecm = append(ecm, ecmRecordHeader(ecmTypeMode1, 1)...)
+			ecm = append(ecm, sector[CD_SYNC_SIZE:CD_SYNC_SIZE+3]...)
+			ecm = append(ecm, sector[16:16+CD_DATA_SIZE]...)
+			continue
+		}
+		ecm = append(ecm, ecmRecordHeader(ecmTypeRaw, 16)...)
+		ecm = append(ecm, sector[:16]...)
+		ecm = append(ecm, ecmRecordHeader(ecmTypeMode2Form1, 1)...)
+		ecm = append(ecm, sector[20:24+CD_DATA_SIZE]...)
+	}
+	ecm = append(ecm, ecmRecordHeader(ecmTypeRaw, 0)...)
+	ecm = append(ecm, 0, 0, 0, 0)
+
+	path := filepath.Join(t.TempDir(), "image.bin.ecm")
+	if err := os.WriteFile(path, ecm, 0644); err != nil {
+		t.Fatalf("failed to write ECM image: %v", err)
+	}
+	return path
+}
+
+// chdBitWriter writes big-endian bit fields
+type chdBitWriter struct {
+	data []byte
+	bits int
+}
+
+func (w *chdBitWriter) write(value uint64, count int) {
+	for i := count - 1; i >= 0; i-- {
+		if w.bits%8 == 0 {
+			w.data = append(w.data, 0)
+		}
+		w.data[len(w.data)-1] |= byte(value>>i&1) << (7 - w.bits%8)
+		w.bits++
+	}
+}
+
+// deflateBytes compresses data as a raw deflate stream
+func deflateBytes(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	writer, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(data)
+	writer.Close()
+	return buf.Bytes()
+}
+
+// writeCHDImage compresses a raw image to a CHD v5 CD image with 8-frame hunks. Hunk 1 is
+// stored uncompressed, the others with the given codec (cdzl, cdlz or cdfl). cdzl and cdlz
+// remove the sync pattern and ECC of sectors whose ECC verifies as Mode 1, as chdman does.
+func writeCHDImage(t *testing.T, image []byte, codec string) string {
+	t.Helper()
+	const framesPerHunk = 8
+	const hunkBytes = framesPerHunk * chdFrameSize
+	frames := len(image) / CD_SECTOR_SIZE
+	hunkCount := (frames + framesPerHunk - 1) / framesPerHunk
+
+	type hunk struct {
+		compression byte
+		data        []byte
+		crc         uint16
+	}
+	var hunks []hunk
+	for index := 0; index < hunkCount; index++ {
+		plain := make([]byte, hunkBytes)
+		stripped := make([]byte, framesPerHunk*CD_SECTOR_SIZE)
+		eccMap := byte(0)
+		for frame := 0; frame < framesPerHunk; frame++ {
+			lba := index*framesPerHunk + frame
+			if lba >= frames {
+				break
+			}
+			sector := image[lba*CD_SECTOR_SIZE : (lba+1)*CD_SECTOR_SIZE]
+			copy(plain[frame*chdFrameSize:], sector)
+			strippedSector := stripped[frame*CD_SECTOR_SIZE : (frame+1)*CD_SECTOR_SIZE]
+			copy(strippedSector, sector)
+
+			verified := append([]byte{}, sector...)
+			generateECC(verified, false)
+			if bytes.Equal(verified, sector) {
+				clear(strippedSector[:CD_SYNC_SIZE])
+				clear(strippedSector[sectorECCPOffset:])
+				eccMap |= 1 << frame
+			}
+		}
+
+		if index == 1 {
+			hunks = append(hunks, hunk{chdCompressionNone, plain, crc16CCITT(plain)})
+			continue
+		}
+		var compressed []byte
+		switch codec {
+		case "cdfl":
+			// Two FLAC frames of 2352 samples, the block size chdman picks for 8-frame hunks
+			sectors := make([]byte, framesPerHunk*CD_SECTOR_SIZE)
+			for frame := 0; frame < framesPerHunk; frame++ {
+				copy(sectors[frame*CD_SECTOR_SIZE:], plain[frame*chdFrameSize:frame*chdFrameSize+CD_SECTOR_SIZE])
+			}
+			left, right := flacChannelSamples(sectors)
+			for start := 0; start < len(left); start += CD_SECTOR_SIZE {
+				compressed = append(compressed, flacFrame(left[start:start+CD_SECTOR_SIZE], right[start:start+CD_SECTOR_SIZE], flacMidSide, flacFixed(1, 12))...)
+			}
+		case "cdlz":
+			base := lzmaLiterals(stripped)
+			compressed = append([]byte{eccMap, byte(len(base) >> 8), byte(len(base))}, base...)
+		default:
+			base := deflateBytes(t, stripped)
+			compressed = append([]byte{eccMap, byte(len(base) >> 8), byte(len(base))}, base...)
+		}
+		compressed = append(compressed, deflateBytes(t, make([]byte, framesPerHunk*chdSubcodeSize))...)
+		hunks = append(hunks, hunk{chdCompressionType0, compressed, crc16CCITT(plain)})
+	}
+
+	metadata := []byte("TRACK:1 TYPE:MODE2_RAW SUBTYPE:NONE FRAMES:" + strconv.Itoa(frames) + " PREGAP:0 PGTYPE:MODE1 PGSUB:RW POSTGAP:0\x00")
+
+	// Map: a Huffman tree of 4-bit codes, the compression types, then lengths and CRCs
+	const lengthBits = 24
+	bits := &chdBitWriter{}
+	for code := 0; code < chdMapHuffmanCodes; code++ {
+		bits.write(4, 4)
+	}
+	for _, h := range hunks {
+		bits.write(uint64(h.compression), 4)
+	}
+	for _, h := range hunks {
+		if h.compression == chdCompressionType0 {
+			bits.write(uint64(len(h.data)), lengthBits)
+		}
+		bits.write(uint64(h.crc), 16)
+	}
+
+	mapOffset := chdHeaderSize
+	metaOffset := mapOffset + chdMapHeaderSize + len(bits.data)
+	dataOffset := metaOffset + chdMetaHeaderSize + len(metadata)
+
+	var rawMap []byte
+	offset := dataOffset
+	for _, h := range hunks {
+		entry := make([]byte, chdMapEntrySize)
+		entry[0] = h.compression
+		length := len(h.data)
+		entry[1], entry[2], entry[3] = byte(length>>16), byte(length>>8), byte(length)
+		binary.BigEndian.PutUint32(entry[6:10], uint32(offset))
+		binary.BigEndian.PutUint16(entry[10:12], h.crc)
+		rawMap = append(rawMap, entry...)
+		offset += length
+	}
+
+	header := make([]byte, chdHeaderSize)
+	copy(header, chdMagic)
+	binary.BigEndian.PutUint32(header[8:12], chdHeaderSize)
+	binary.BigEndian.PutUint32(header[12:16], 5)
+	copy(header[16:20], codec)
+	binary.BigEndian.PutUint64(header[32:40], uint64(hunkCount*hunkBytes))
+	binary.BigEndian.PutUint64(header[40:48], uint64(mapOffset))
+	binary.BigEndian.PutUint64(header[48:56], uint64(metaOffset))
+	binary.BigEndian.PutUint32(header[56:60], hunkBytes)
+	binary.BigEndian.PutUint32(header[60:64], chdFrameSize)
+
+	mapHeader := make([]byte, chdMapHeaderSize)
+	binary.BigEndian.PutUint32(mapHeader[0:4], uint32(len(bits.data)))
+	binary.BigEndian.PutUint32(mapHeader[6:10], uint32(dataOffset))
+	binary.BigEndian.PutUint16(mapHeader[10:12], crc16CCITT(rawMap))
+	mapHeader[12] = lengthBits
+
+	metaHeader := make([]byte, chdMetaHeaderSize)
+	copy(metaHeader, chdMetaTrack2)
+	metaHeader[4] = 1
+	metaHeader[6], metaHeader[7] = byte(len(metadata)>>8), byte(len(metadata))
+
+	chd := append(header, mapHeader...)
+	chd = append(chd, bits.data...)
+	chd = append(chd, metaHeader...)
+	chd = append(chd, metadata...)
+	for _, h := range hunks {
+		chd = append(chd, h.data...)
+	}
+
+	path := filepath.Join(t.TempDir(), "image.chd")
+	if err := os.WriteFile(path, chd, 0644); err != nil {
+		t.Fatalf("failed to write CHD image: %v", err)
+	}
+	return path
+}
+
+// assertSameImage checks that a backend presents exactly the raw image and that the file
+// system reads back through a CDReader
+func assertSameImage(t *testing.T, path, wantFormat string, image []byte) {
+	t.Helper()
+	backend, err := OpenImage(path)
+	if err != nil {
+		t.Fatalf("OpenImage() failed: %v", err)
+	}
+	if backend.Format() != wantFormat {
+		t.Errorf("Format() = %q, want %q", backend.Format(), wantFormat)
+	}
+	if backend.Size() != int64(len(image)) {
+		t.Fatalf("Size() = %d, want %d", backend.Size(), len(image))
+	}
+	got := make([]byte, len(image))
+	if _, err := backend.ReadAt(got, 0); err != nil {
+		t.Fatalf("ReadAt() failed: %v", err)
+	}
+	backend.Close()
+	for offset := 0; offset < len(image); offset += CD_SECTOR_SIZE {
+		if !bytes.Equal(got[offset:offset+CD_SECTOR_SIZE], image[offset:offset+CD_SECTOR_SIZE]) {
+			t.Fatalf("sector %d differs from the raw image", offset/CD_SECTOR_SIZE)
+		}
+	}
+
+	reader, err := NewCDReader(path)
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+	if reader.Geometry() != GeometryMode2Raw {
+		t.Errorf("Geometry() = %s, want %s", reader.Geometry().Name, GeometryMode2Raw.Name)
+	}
+	files, err := reader.ListFiles()
+	if err != nil {
+		t.Fatalf("ListFiles() failed: %v", err)
+	}
+	if len(files) != 2 || files[0].Path != "SYSTEM.CNF" {
+		t.Fatalf("ListFiles() = %v, want SYSTEM.CNF and the executable", files)
+	}
+	var content bytes.Buffer
+	if err := reader.CopyEntry(files[0], &content); err != nil {
+		t.Fatalf("CopyEntry() failed: %v", err)
+	}
+	if !strings.HasPrefix(content.String(), "BOOT = cdrom:") {
+		t.Errorf("SYSTEM.CNF = %q, want the boot line", content.String())
+	}
+}
+
+func TestOpenImage_Raw(t *testing.T) {
+	path, image := writeSealedBootImage(t)
+	assertSameImage(t, path, ImageFormatRaw, image)
+}
+
+func TestOpenImage_ECM(t *testing.T) {
+	_, image := writeSealedBootImage(t)
+	assertSameImage(t, writeECMImage(t, image), ImageFormatECM, image)
+}
+
+func TestOpenImage_CHD(t *testing.T) {
+	_, image := writeSealedBootImage(t)
+	for _, codec := range []string{"cdzl", "cdlz", "cdfl"} {
+		t.Run(codec, func(t *testing.T) {
+			assertSameImage(t, writeCHDImage(t, image, codec), ImageFormatCHD, image)
+		})
+	}
+}
+
+func TestOpenImage_CHDMissingCodec(t *testing.T) {
+	_, image := writeSealedBootImage(t)
+	backend, err := OpenImage(writeCHDImage(t, image, "cdzs"))
+	if err != nil {
+		t.Fatalf("OpenImage() failed: %v", err)
+	}
+	defer backend.Close()
+
+	if _, err := backend.ReadAt(make([]byte, CD_SECTOR_SIZE), 0); err == nil || !strings.Contains(err.Error(), "zstd") {
+		t.Errorf("ReadAt() error = %v, want the missing zstd codec", err)
+	}
+}
+
+func TestCRC16CCITT(t *testing.T) {
+	if got := crc16CCITT([]byte("123456789")); got != 0x29B1 {
+		t.Errorf("crc16CCITT() = %04X, want 29B1", got)
+	}
+}
@@ -0,0 +1,557 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the ISO9660 conformance checks of rebuilt images. Every violation
+// names the ECMA-119 clause it breaks. The basic checks cover what readers need to find
+// the files; strict mode adds the ordering, padding and identifier rules that lenient
+// readers ignore but picky emulators and drive firmware enforce.
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// ISO9660 violation severities
+const (
+	ISOViolationError   = "error"   // Readers may fail to find or read files
+	ISOViolationWarning = "warning" // Breaks the standard, but lenient readers accept it
+)
+
+// ISO9660 volume descriptor types
+const (
+	isoDescriptorPrimary    = 1
+	isoDescriptorTerminator = 255
+)
+
+// ISO9660 structure sizes
+const (
+	isoDirRecordHeaderSize  = 33 // Directory record size without the file identifier
+	isoPathRecordHeaderSize = 8  // Path table record size without the directory identifier
+	isoRootRecordSize       = 34
+	isoMaxDescriptors       = 32 // Volume descriptors searched for the set terminator
+)
+
+// ISOViolation is a rule of the standard broken by the image
+type ISOViolation struct {
+	Severity string `json:"severity"`
+	Clause   string `json:"clause"` // ECMA-119 clause of the rule
+	Check    string `json:"check"`
+	Path     string `json:"path,omitempty"` // Directory or file the violation was found in
+	Message  string `json:"message"`
+}
+
+// ISOVerifyReport lists the ISO9660 violations found in an image
+type ISOVerifyReport struct {
+	Strict        bool           `json:"strict"`
+	VolumeSectors uint32         `json:"volume_sectors"`
+	ImageSectors  int64          `json:"image_sectors"`
+	TrailingBytes int64          `json:"trailing_bytes,omitempty"` // Bytes of an incomplete last sector
+	Directories   int            `json:"directories"`
+	Files         int            `json:"files"`
+	Violations    []ISOViolation `json:"violations"`
+}
+
+// ErrorCount returns the number of error-severity violations
+func (r *ISOVerifyReport) ErrorCount() int {
+	count := 0
+	for _, violation := range r.Violations {
+		if violation.Severity == ISOViolationError {
+			count++
+		}
+	}
+	return count
+}
+
+// Failed reports whether the image fails verification: any violation in strict mode,
+// error-severity violations otherwise
+func (r *ISOVerifyReport) Failed() bool {
+	if r.Strict {
+		return len(r.Violations) > 0
+	}
+	return r.ErrorCount() > 0
+}
+
+// isoDirRecord is a directory record as stored on disc
+type isoDirRecord struct {
+	length     int
+	lba        uint32
+	lbaMSB     uint32
+	size       uint32
+	sizeMSB    uint32
+	flags      byte
+	identifier string
+}
+
+// isDirectory reports whether the record describes a directory
+func (d isoDirRecord) isDirectory() bool {
+	return d.flags&ISO_FLAG_DIRECTORY != 0
+}
+
+// isoPathRecord is a path table record
+type isoPathRecord struct {
+	identifier string
+	lba        uint32
+	parent     uint16
+}
+
+// isoDirectory is a directory reached from the root, in path table order
+type isoDirectory struct {
+	path       string
+	identifier string
+	lba        uint32
+	size       uint32
+	parent     int // Path table number of the parent directory (1 for the root)
+}
+
+// isoVerifier walks the volume and collects violations
+type isoVerifier struct {
+	reader        *CDReader
+	report        *ISOVerifyReport
+	volumeSectors uint32
+	directories   []isoDirectory
+}
+
+// add records a violation. Strict-only rules pass strictOnly and are skipped otherwise.
+func (v *isoVerifier) add(strictOnly bool, severity, clause, check, filePath, format string, args ...interface{}) {
+	if strictOnly && !v.report.Strict {
+		return
+	}
+	v.report.Violations = append(v.report.Violations, ISOViolation{
+		Severity: severity,
+		Clause:   clause,
+		Check:    check,
+		Path:     filePath,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// VerifyISO9660 checks the file system of the image against ISO9660 (ECMA-119). The
+// basic checks cover the volume descriptor, the root record, the directory records and
+// the path tables; strict also applies the ordering, padding and identifier rules.
+// Violations are reported; an error is only returned if the image cannot be read.
+func (r *CDReader) VerifyISO9660(strict bool) (*ISOVerifyReport, error) {
+	report := &ISOVerifyReport{
+		Strict:        strict,
+		ImageSectors:  r.totalSectors,
+		TrailingBytes: r.ImageSize() % int64(r.geometry.SectorSize),
+		Violations:    []ISOViolation{},
+	}
+	verifier := &isoVerifier{reader: r, report: report}
+
+	descriptor, err := r.readSectorData(16)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to read volume descriptor: %w", err))
+	}
+	if descriptor[0] != isoDescriptorPrimary || string(descriptor[1:6]) != "CD001" || descriptor[6] != 1 {
+		verifier.add(false, ISOViolationError, "8.4", "descriptor", "", "sector 16 holds no primary volume descriptor")
+		return report, nil
+	}
+
+	if !verifier.checkDescriptor(descriptor) {
+		return report, nil
+	}
+	verifier.checkTerminator()
+
+	root, ok := verifier.checkRootRecord(descriptor[156:190])
+	if !ok {
+		return report, nil
+	}
+	verifier.walk(root)
+	verifier.checkPathTables(descriptor)
+
+	return report, nil
+}
+
+// checkDescriptor checks the sizes of the primary volume descriptor. It returns false when
+// the volume cannot be walked.
+func (v *isoVerifier) checkDescriptor(descriptor []byte) bool {
+	volumeLSB := binary.LittleEndian.Uint32(descriptor[80:84])
+	volumeMSB := binary.BigEndian.Uint32(descriptor[84:88])
+	v.volumeSectors = volumeLSB
+	v.report.VolumeSectors = volumeLSB
+
+	if volumeLSB != volumeMSB {
+		v.add(false, ISOViolationError, "8.4.8", "volume-size", "",
+			"volume space size differs between byte orders: %d little-endian, %d big-endian", volumeLSB, volumeMSB)
+	}
+	if int64(volumeLSB) > v.reader.totalSectors {
+		v.add(false, ISOViolationError, "8.4.8", "volume-size", "",
+			"volume space size is %d sectors but the image only has %d", volumeLSB, v.reader.totalSectors)
+	} else if int64(volumeLSB) < v.reader.totalSectors {
+		v.add(true, ISOViolationWarning, "8.4.8", "volume-size", "",
+			"image has %d sectors after the %d-sector volume (fine for audio tracks, otherwise stale; see cd finalize)",
+			v.reader.totalSectors-int64(volumeLSB), volumeLSB)
+	}
+	if v.report.TrailingBytes > 0 {
+		v.add(false, ISOViolationWarning, "6.1.2", "image-size", "",
+			"image ends with an incomplete %d-byte sector (see cd finalize)", v.report.TrailingBytes)
+	}
+
+	blockLSB := binary.LittleEndian.Uint16(descriptor[128:130])
+	blockMSB := binary.BigEndian.Uint16(descriptor[130:132])
+	if blockLSB != CD_DATA_SIZE || blockMSB != CD_DATA_SIZE {
+		v.add(false, ISOViolationError, "8.4.12", "descriptor", "",
+			"logical block size is %d/%d, expected %d", blockLSB, blockMSB, CD_DATA_SIZE)
+		return false
+	}
+	return true
+}
+
+// checkTerminator looks for the volume descriptor set terminator after the primary descriptor
+func (v *isoVerifier) checkTerminator() {
+	for lba := int64(17); lba < 16+isoMaxDescriptors && lba < v.reader.totalSectors; lba++ {
+		data, err := v.reader.readSectorData(lba)
+		if err != nil {
+			break
+		}
+		if string(data[1:6]) != "CD001" {
+			break
+		}
+		if data[0] == isoDescriptorTerminator {
+			return
+		}
+	}
+	v.add(true, ISOViolationWarning, "8.3", "descriptor", "", "volume descriptor set has no terminator")
+}
+
+// parseDirRecord parses the directory record at the start of data
+func parseDirRecord(data []byte) (isoDirRecord, error) {
+	if len(data) < isoDirRecordHeaderSize+1 || int(data[0]) < isoDirRecordHeaderSize+1 {
+		return isoDirRecord{}, fmt.Errorf("record is shorter than %d bytes", isoDirRecordHeaderSize+1)
+	}
+	record := isoDirRecord{
+		length:  int(data[0]),
+		lba:     binary.LittleEndian.Uint32(data[2:6]),
+		lbaMSB:  binary.BigEndian.Uint32(data[6:10]),
+		size:    binary.LittleEndian.Uint32(data[10:14]),
+		sizeMSB: binary.BigEndian.Uint32(data[14:18]),
+		flags:   data[25],
+	}
+	identifierEnd := isoDirRecordHeaderSize + int(data[32])
+	if data[32] == 0 || identifierEnd > record.length {
+		return isoDirRecord{}, fmt.Errorf("file identifier length %d does not fit in a %d-byte record", data[32], record.length)
+	}
+	record.identifier = string(data[isoDirRecordHeaderSize:identifierEnd])
+	return record, nil
+}
+
+// checkRecordFields checks the fields every directory record shares
+func (v *isoVerifier) checkRecordFields(record isoDirRecord, filePath string) {
+	if record.lba != record.lbaMSB {
+		v.add(false, ISOViolationError, "9.1.3", "directory", filePath,
+			"extent location differs between byte orders: %d little-endian, %d big-endian", record.lba, record.lbaMSB)
+	}
+	if record.size != record.sizeMSB {
+		v.add(false, ISOViolationError, "9.1.4", "directory", filePath,
+			"data length differs between byte orders: %d little-endian, %d big-endian", record.size, record.sizeMSB)
+	}
+	if record.size > 0 && uint64(record.lba)+uint64(DataSectors(record.size)) > uint64(v.volumeSectors) {
+		v.add(false, ISOViolationError, "9.1.3", "directory", filePath,
+			"extent at LBA %d (%d bytes) ends beyond the %d-sector volume", record.lba, record.size, v.volumeSectors)
+	}
+}
+
+// checkRootRecord checks the root directory record of the volume descriptor
+func (v *isoVerifier) checkRootRecord(data []byte) (isoDirRecord, bool) {
+	root, err := parseDirRecord(data)
+	if err != nil {
+		v.add(false, ISOViolationError, "8.4.18", "root", "/", "root directory record is unreadable: %v", err)
+		return root, false
+	}
+	if root.length != isoRootRecordSize || root.identifier != "\x00" {
+		v.add(false, ISOViolationError, "8.4.18", "root", "/",
+			"root directory record is %d bytes with identifier %q, expected %d bytes with identifier 0x00",
+			root.length, root.identifier, isoRootRecordSize)
+	}
+	if !root.isDirectory() {
+		v.add(false, ISOViolationError, "9.1.6", "root", "/", "root directory record lacks the directory flag")
+	}
+	v.checkRecordFields(root, "/")
+	if root.size == 0 || root.size%CD_DATA_SIZE != 0 {
+		v.add(false, ISOViolationError, "6.8.1", "root", "/", "root directory size %d is not a whole number of sectors", root.size)
+	}
+	if root.lba == 0 || root.size == 0 || root.lba >= v.volumeSectors || int64(root.lba) >= v.reader.totalSectors {
+		return root, false
+	}
+	return root, true
+}
+
+// readDirectory reads the records of a directory extent
+func (v *isoVerifier) readDirectory(dirPath string, lba, size uint32) []isoDirRecord {
+	var records []isoDirRecord
+	for sector := uint32(0); sector < DataSectors(size); sector++ {
+		data, err := v.reader.readSectorData(int64(lba + sector))
+		if err != nil {
+			v.add(false, ISOViolationError, "6.8.1", "directory", dirPath, "failed to read directory sector %d: %v", lba+sector, err)
+			return records
+		}
+
+		for offset := 0; offset < CD_DATA_SIZE && data[offset] != 0; {
+			length := int(data[offset])
+			if offset+length > CD_DATA_SIZE {
+				v.add(false, ISOViolationError, "6.8.1.1", "directory", dirPath,
+					"record at offset %d of sector %d crosses the sector boundary", offset, lba+sector)
+				break
+			}
+			record, err := parseDirRecord(data[offset : offset+length])
+			if err != nil {
+				v.add(false, ISOViolationError, "9.1", "directory", dirPath,
+					"record at offset %d of sector %d: %v", offset, lba+sector, err)
+				break
+			}
+
+			// The padding byte keeps the system use field at an even offset
+			identifierEnd := isoDirRecordHeaderSize + len(record.identifier)
+			if len(record.identifier)%2 == 0 && (identifierEnd >= length || data[offset+identifierEnd] != 0) {
+				v.add(true, ISOViolationWarning, "9.1.12", "padding", path.Join(dirPath, record.identifier),
+					"even-length identifier is not followed by a zero padding byte")
+			}
+			records = append(records, record)
+			offset += length
+		}
+	}
+	return records
+}
+
+// walk visits every directory from the root in path table order (by level, then by
+// parent, then in directory record order) and checks its records
+func (v *isoVerifier) walk(root isoDirRecord) {
+	v.directories = []isoDirectory{{path: "/", identifier: "\x00", lba: root.lba, size: root.size, parent: 1}}
+	visited := map[uint32]bool{root.lba: true}
+
+	for index := 0; index < len(v.directories); index++ {
+		directory := v.directories[index]
+		parentLBA := v.directories[directory.parent-1].lba
+		records := v.readDirectory(directory.path, directory.lba, directory.size)
+		v.checkDotRecords(directory, parentLBA, records)
+		if len(records) > 2 {
+			records = records[2:]
+		} else {
+			records = nil
+		}
+		v.checkOrder(directory.path, records)
+
+		for _, record := range records {
+			recordPath := path.Join(directory.path, record.identifier)
+			v.checkRecordFields(record, recordPath)
+			v.checkIdentifier(record, recordPath)
+
+			if !record.isDirectory() {
+				v.report.Files++
+				continue
+			}
+			if record.size%CD_DATA_SIZE != 0 {
+				v.add(false, ISOViolationError, "6.8.1", "directory", recordPath,
+					"directory size %d is not a whole number of sectors", record.size)
+			}
+			if visited[record.lba] || record.lba == 0 || int64(record.lba) >= v.reader.totalSectors {
+				v.add(false, ISOViolationError, "6.8.2", "directory", recordPath,
+					"directory extent at LBA %d loops or lies outside the image", record.lba)
+				continue
+			}
+			visited[record.lba] = true
+			v.directories = append(v.directories, isoDirectory{
+				path:       recordPath,
+				identifier: record.identifier,
+				lba:        record.lba,
+				size:       record.size,
+				parent:     index + 1,
+			})
+		}
+	}
+	v.report.Directories = len(v.directories)
+}
+
+// checkDotRecords checks that a directory starts with its own and its parent's record
+func (v *isoVerifier) checkDotRecords(directory isoDirectory, parentLBA uint32, records []isoDirRecord) {
+	if len(records) < 1 || records[0].identifier != "\x00" || records[0].lba != directory.lba {
+		v.add(false, ISOViolationError, "6.8.2.2", "directory", directory.path,
+			"first record does not describe the directory itself (identifier 0x00, LBA %d)", directory.lba)
+	}
+	if len(records) < 2 || records[1].identifier != "\x01" || records[1].lba != parentLBA {
+		v.add(false, ISOViolationError, "6.8.2.2", "directory", directory.path,
+			"second record does not describe the parent directory (identifier 0x01, LBA %d)", parentLBA)
+	}
+}
+
+// checkOrder checks that the records of a directory are sorted by identifier
+func (v *isoVerifier) checkOrder(dirPath string, records []isoDirRecord) {
+	for i := 1; i < len(records); i++ {
+		previous, current := records[i-1], records[i]
+		// The records of a multi-extent file share the identifier
+		if previous.identifier == current.identifier && previous.flags&ISO_FLAG_MULTI_EXTENT != 0 {
+			continue
+		}
+		if compareISOIdentifiers(previous.identifier, current.identifier) >= 0 {
+			v.add(true, ISOViolationWarning, "9.3", "sorting", dirPath,
+				"%q is recorded before %q", previous.identifier, current.identifier)
+		}
+	}
+}
+
+// compareISOIdentifiers orders two file identifiers: by file name, then by extension,
+// the shorter padded with spaces, then by descending version number
+func compareISOIdentifiers(a, b string) int {
+	nameA, extensionA, versionA := splitISOIdentifier(a)
+	nameB, extensionB, versionB := splitISOIdentifier(b)
+	if result := comparePadded(nameA, nameB); result != 0 {
+		return result
+	}
+	if result := comparePadded(extensionA, extensionB); result != 0 {
+		return result
+	}
+	return -comparePadded(versionA, versionB)
+}
+
+// splitISOIdentifier splits a file identifier into file name, extension and version
+func splitISOIdentifier(identifier string) (name, extension, version string) {
+	identifier, version, _ = strings.Cut(identifier, ";")
+	name, extension, _ = strings.Cut(identifier, ".")
+	return name, extension, version
+}
+
+// comparePadded compares two strings byte by byte, padding the shorter with spaces
+func comparePadded(a, b string) int {
+	length := max(len(a), len(b))
+	return bytes.Compare([]byte(a+strings.Repeat(" ", length-len(a))), []byte(b+strings.Repeat(" ", length-len(b))))
+}
+
+// isDCharacters reports whether text only uses d-characters (A-Z, 0-9 and _)
+func isDCharacters(text string) bool {
+	for _, char := range text {
+		if !(char >= 'A' && char <= 'Z' || char >= '0' && char <= '9' || char == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// checkIdentifier checks that an identifier uses d-characters and the NAME.EXT;VERSION form
+func (v *isoVerifier) checkIdentifier(record isoDirRecord, recordPath string) {
+	if record.isDirectory() {
+		if !isDCharacters(record.identifier) {
+			v.add(true, ISOViolationWarning, "7.6.1", "identifier", recordPath, "directory identifier uses characters other than A-Z, 0-9 and _")
+		}
+		return
+	}
+
+	name, extension, version := splitISOIdentifier(record.identifier)
+	if !strings.Contains(record.identifier, ";") || version == "" {
+		v.add(true, ISOViolationWarning, "7.5.1", "identifier", recordPath, "file identifier has no ;version suffix")
+	}
+	if !isDCharacters(name) || !isDCharacters(extension) || strings.Count(record.identifier, ".") > 1 {
+		v.add(true, ISOViolationWarning, "7.5.1", "identifier", recordPath, "file identifier uses characters other than A-Z, 0-9 and _")
+	}
+}
+
+// readExtent reads size bytes of user data starting at sector lba
+func (v *isoVerifier) readExtent(lba, size uint32) ([]byte, error) {
+	var data []byte
+	for sector := uint32(0); sector < DataSectors(size); sector++ {
+		sectorData, err := v.reader.readSectorData(int64(lba + sector))
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, sectorData...)
+	}
+	return data[:size], nil
+}
+
+// parsePathTable parses the records of a path table in the given byte order
+func parsePathTable(data []byte, order binary.ByteOrder) ([]isoPathRecord, error) {
+	var records []isoPathRecord
+	for offset := 0; offset < len(data); {
+		if offset+isoPathRecordHeaderSize > len(data) || data[offset] == 0 {
+			return records, fmt.Errorf("truncated record at offset %d", offset)
+		}
+		identifierEnd := offset + isoPathRecordHeaderSize + int(data[offset])
+		if identifierEnd > len(data) {
+			return records, fmt.Errorf("record at offset %d exceeds the table", offset)
+		}
+		records = append(records, isoPathRecord{
+			identifier: string(data[offset+isoPathRecordHeaderSize : identifierEnd]),
+			lba:        order.Uint32(data[offset+2 : offset+6]),
+			parent:     order.Uint16(data[offset+6 : offset+8]),
+		})
+		// Odd-length identifiers are followed by a padding byte
+		offset = identifierEnd + identifierEnd%2
+	}
+	return records, nil
+}
+
+// checkPathTables compares the type L and type M path tables with each other and with
+// the directories reached from the root
+func (v *isoVerifier) checkPathTables(descriptor []byte) {
+	sizeLSB := binary.LittleEndian.Uint32(descriptor[132:136])
+	sizeMSB := binary.BigEndian.Uint32(descriptor[136:140])
+	if sizeLSB != sizeMSB {
+		v.add(false, ISOViolationError, "8.4.14", "path-table", "",
+			"path table size differs between byte orders: %d little-endian, %d big-endian", sizeLSB, sizeMSB)
+	}
+
+	tableL := v.readPathTable("8.4.15", "type L", binary.LittleEndian.Uint32(descriptor[140:144]), sizeLSB, binary.LittleEndian)
+	tableM := v.readPathTable("8.4.17", "type M", binary.BigEndian.Uint32(descriptor[148:152]), sizeLSB, binary.BigEndian)
+	if tableL == nil {
+		return
+	}
+	if tableM != nil && !slices.Equal(tableL, tableM) {
+		v.add(false, ISOViolationError, "6.9", "path-table", "", "type L and type M path tables differ")
+	}
+
+	directoriesByLBA := make(map[uint32]int, len(v.directories))
+	for index, directory := range v.directories {
+		directoriesByLBA[directory.lba] = index
+	}
+
+	listed := make(map[uint32]bool, len(tableL))
+	for number, record := range tableL {
+		index, found := directoriesByLBA[record.lba]
+		if !found {
+			v.add(false, ISOViolationError, "6.9", "path-table", "",
+				"record %d (%q) points to LBA %d, which is no directory of the hierarchy", number+1, record.identifier, record.lba)
+			continue
+		}
+		listed[record.lba] = true
+		directory := v.directories[index]
+		if record.identifier != directory.identifier {
+			v.add(false, ISOViolationError, "6.9", "path-table", directory.path,
+				"record %d is named %q, the directory record %q", number+1, record.identifier, directory.identifier)
+		}
+		if int(record.parent) < 1 || int(record.parent) > len(tableL) || tableL[record.parent-1].lba != v.directories[directory.parent-1].lba {
+			v.add(false, ISOViolationError, "6.9", "path-table", directory.path,
+				"record %d has parent number %d, which is not its parent directory", number+1, record.parent)
+		}
+		if index != number {
+			v.add(true, ISOViolationWarning, "6.9.1", "path-table", directory.path,
+				"record %d should be record %d (ordered by level, parent number and identifier)", number+1, index+1)
+		}
+	}
+	for _, directory := range v.directories {
+		if !listed[directory.lba] {
+			v.add(false, ISOViolationError, "6.9", "path-table", directory.path, "directory is missing from the path table")
+		}
+	}
+}
+
+// readPathTable reads and parses a path table, recording a violation when it is unreadable
+func (v *isoVerifier) readPathTable(clause, name string, lba, size uint32, order binary.ByteOrder) []isoPathRecord {
+	if lba == 0 || uint64(lba)+uint64(DataSectors(size)) > uint64(v.volumeSectors) {
+		v.add(false, ISOViolationError, clause, "path-table", "", "%s path table at LBA %d lies outside the volume", name, lba)
+		return nil
+	}
+	data, err := v.readExtent(lba, size)
+	if err != nil {
+		v.add(false, ISOViolationError, clause, "path-table", "", "failed to read %s path table: %v", name, err)
+		return nil
+	}
+	records, err := parsePathTable(data, order)
+	if err != nil {
+		v.add(false, ISOViolationError, "9.4", "path-table", "", "%s path table: %v", name, err)
+	}
+	return records
+}
@@ -0,0 +1,206 @@
+// Package psx provides tests for the ISO9660 conformance checks.
+package psx
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// isoImageSectors is the size of the synthetic conformance test image
+const isoImageSectors = 24
+
+// writePathRecord writes a path table record in the given byte order and returns its length
+func writePathRecord(data []byte, name string, lba uint32, parent uint16, order binary.ByteOrder) int {
+	data[0] = byte(len(name))
+	order.PutUint32(data[2:6], lba)
+	order.PutUint16(data[6:8], parent)
+	copy(data[8:], name)
+	return 8 + len(name) + len(name)%2
+}
+
+// writeISOImage creates a conformant Mode 2 image (root, DATA directory, path tables and
+// terminator), lets mutate break it and returns its path
+func writeISOImage(t *testing.T, mutate func(sectorData func(lba int) []byte)) string {
+	t.Helper()
+
+	image := make([]byte, isoImageSectors*CD_SECTOR_SIZE)
+	sectorData := func(lba int) []byte {
+		raw := image[lba*CD_SECTOR_SIZE : (lba+1)*CD_SECTOR_SIZE]
+		return raw[24 : 24+CD_DATA_SIZE]
+	}
+	for lba := 0; lba < isoImageSectors; lba++ {
+		image[lba*CD_SECTOR_SIZE+15] = 2
+	}
+
+	pvd := sectorData(16)
+	copy(pvd, "\x01CD001\x01")
+	binary.LittleEndian.PutUint32(pvd[80:84], isoImageSectors)
+	binary.BigEndian.PutUint32(pvd[84:88], isoImageSectors)
+	binary.LittleEndian.PutUint16(pvd[128:130], CD_DATA_SIZE)
+	binary.BigEndian.PutUint16(pvd[130:132], CD_DATA_SIZE)
+	binary.LittleEndian.PutUint32(pvd[132:136], 22)
+	binary.BigEndian.PutUint32(pvd[136:140], 22)
+	binary.LittleEndian.PutUint32(pvd[140:144], 19)
+	binary.BigEndian.PutUint32(pvd[148:152], 20)
+	writeDirRecord(pvd[156:190], "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	copy(sectorData(17), "\xFFCD001\x01")
+
+	root := sectorData(18)
+	offset := writeDirRecord(root, "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "\x01", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "DATA", 21, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	writeDirRecord(root[offset:], "SYSTEM.CNF;1", 22, 16, 0)
+
+	data := sectorData(21)
+	offset = writeDirRecord(data, "\x00", 21, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(data[offset:], "\x01", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	writeDirRecord(data[offset:], "A.BIN;1", 23, 100, 0)
+
+	for lba, order := range map[int]binary.ByteOrder{19: binary.LittleEndian, 20: binary.BigEndian} {
+		table := sectorData(lba)
+		offset := writePathRecord(table, "\x00", 18, 1, order)
+		writePathRecord(table[offset:], "DATA", 21, 1, order)
+	}
+
+	if mutate != nil {
+		mutate(sectorData)
+	}
+
+	imagePath := filepath.Join(t.TempDir(), "iso.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestCDReader_VerifyISO9660(t *testing.T) {
+	tests := []struct {
+		name       string
+		mutate     func(sectorData func(lba int) []byte)
+		wantBasic  int    // Violations without strict
+		wantStrict int    // Violations with strict
+		wantClause string // Clause of the first strict violation
+	}{
+		{
+			name: "conformant image",
+		},
+		{
+			name: "unsorted root directory",
+			mutate: func(sectorData func(int) []byte) {
+				root := sectorData(18)
+				clear(root[68:])
+				offset := 68 + writeDirRecord(root[68:], "SYSTEM.CNF;1", 22, 16, 0)
+				writeDirRecord(root[offset:], "DATA", 21, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+			},
+			wantStrict: 1,
+			wantClause: "9.3",
+		},
+		{
+			name: "even identifier without padding",
+			mutate: func(sectorData func(int) []byte) {
+				// DATA is the third record of the root; drop its padding byte
+				root := sectorData(18)
+				root[68] = 37
+				copy(root[105:], root[106:])
+			},
+			wantStrict: 1,
+			wantClause: "9.1.12",
+		},
+		{
+			name: "missing set terminator",
+			mutate: func(sectorData func(int) []byte) {
+				clear(sectorData(17))
+			},
+			wantStrict: 1,
+			wantClause: "8.3",
+		},
+		{
+			name: "type M path table differs",
+			mutate: func(sectorData func(int) []byte) {
+				binary.BigEndian.PutUint32(sectorData(20)[12:16], 22)
+			},
+			wantBasic:  1,
+			wantStrict: 1,
+			wantClause: "6.9",
+		},
+		{
+			name: "volume larger than the image",
+			mutate: func(sectorData func(int) []byte) {
+				binary.LittleEndian.PutUint32(sectorData(16)[80:84], 30)
+				binary.BigEndian.PutUint32(sectorData(16)[84:88], 30)
+			},
+			wantBasic:  1,
+			wantStrict: 1,
+			wantClause: "8.4.8",
+		},
+		{
+			name: "parent record points elsewhere",
+			mutate: func(sectorData func(int) []byte) {
+				data := sectorData(21)
+				binary.LittleEndian.PutUint32(data[36:40], 21)
+				binary.BigEndian.PutUint32(data[40:44], 21)
+			},
+			wantBasic:  1,
+			wantStrict: 1,
+			wantClause: "6.8.2.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, err := NewCDReader(writeISOImage(t, tt.mutate))
+			if err != nil {
+				t.Fatalf("NewCDReader() failed: %v", err)
+			}
+			defer reader.Close()
+
+			basic, err := reader.VerifyISO9660(false)
+			if err != nil {
+				t.Fatalf("VerifyISO9660(false) failed: %v", err)
+			}
+			if len(basic.Violations) != tt.wantBasic {
+				t.Errorf("basic violations = %+v, want %d", basic.Violations, tt.wantBasic)
+			}
+			if basic.Failed() != (tt.wantBasic > 0) {
+				t.Errorf("basic Failed() = %v", basic.Failed())
+			}
+
+			strict, err := reader.VerifyISO9660(true)
+			if err != nil {
+				t.Fatalf("VerifyISO9660(true) failed: %v", err)
+			}
+			if len(strict.Violations) != tt.wantStrict {
+				t.Fatalf("strict violations = %+v, want %d", strict.Violations, tt.wantStrict)
+			}
+			if strict.Failed() != (tt.wantStrict > 0) {
+				t.Errorf("strict Failed() = %v", strict.Failed())
+			}
+			if tt.wantClause != "" && strict.Violations[0].Clause != tt.wantClause {
+				t.Errorf("Violations[0].Clause = %q, want %q", strict.Violations[0].Clause, tt.wantClause)
+			}
+			if strict.Directories != 2 || strict.Files != 2 {
+				t.Errorf("walked %d directories and %d files, want 2 and 2", strict.Directories, strict.Files)
+			}
+		})
+	}
+}
+
+func TestCompareISOIdentifiers(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"A.BIN;1", "B.BIN;1", -1},
+		{"AB.BIN;1", "A.BIN;1", 1},       // "AB" after "A " (space-padded)
+		{"A.BIN;1", "A.BINX;1", -1},      // "BIN " before "BINX"
+		{"FILE.DAT;2", "FILE.DAT;1", -1}, // Higher version first
+		{"DATA", "DATA", 0},
+	}
+	for _, tt := range tests {
+		if got := compareISOIdentifiers(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareISOIdentifiers(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
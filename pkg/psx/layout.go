@@ -0,0 +1,160 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the disc layout of CD images, in the spirit of the XML project
+// dumpsxiso writes: every directory, file and unreferenced gap with its position, size
+// and XA attributes, ordered by LBA, so a rebuild can put everything back where it was.
+package psx
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Kinds of disc layout entries
+const (
+	LayoutEntryDir  = "dir"
+	LayoutEntryFile = "file"
+	LayoutEntryGap  = "gap" // Sectors no directory record reaches (see FindOrphans)
+)
+
+// Types of file layout entries, as named by mkpsxiso
+const (
+	LayoutTypeData = "data" // Mode 2 Form 1 (or Mode 1) data
+	LayoutTypeXA   = "xa"   // Form 2 or interleaved sectors, such as XA audio and STR video
+	LayoutTypeDA   = "da"   // CD-DA audio
+)
+
+// LayoutExtent is one extent of a multi-extent file
+type LayoutExtent struct {
+	LBA  uint32 `yaml:"lba" xml:"lba,attr"`
+	Size uint32 `yaml:"size" xml:"size,attr"`
+}
+
+// LayoutEntry is a directory, file or gap of the disc layout
+type LayoutEntry struct {
+	Kind         string         `yaml:"kind" xml:"kind,attr"`
+	Path         string         `yaml:"path,omitempty" xml:"path,attr,omitempty"`     // ISO9660 path (e.g. DATA/CFNT999H.WFM)
+	Source       string         `yaml:"source,omitempty" xml:"source,attr,omitempty"` // Dumped file, relative to the dump root
+	LBA          uint32         `yaml:"lba" xml:"lba,attr"`
+	MSF          string         `yaml:"msf" xml:"msf,attr"`
+	Sectors      uint32         `yaml:"sectors" xml:"sectors,attr"`
+	Size         uint32         `yaml:"size,omitempty" xml:"size,attr,omitempty"`
+	Type         string         `yaml:"type,omitempty" xml:"type,attr,omitempty"`
+	XAAttributes uint16         `yaml:"xa_attributes,omitempty" xml:"xa_attributes,attr,omitempty"`
+	Hidden       bool           `yaml:"hidden,omitempty" xml:"hidden,attr,omitempty"`
+	Empty        bool           `yaml:"empty,omitempty" xml:"empty,attr,omitempty"` // Gap whose user data is all zero
+	Extents      []LayoutExtent `yaml:"extents,omitempty" xml:"extent,omitempty"`
+}
+
+// DiscLayout describes where every directory, file and gap of a disc image lies
+type DiscLayout struct {
+	XMLName       xml.Name      `yaml:"-" xml:"disc_layout"`
+	Geometry      string        `yaml:"geometry" xml:"geometry,attr"`
+	SystemID      string        `yaml:"system_id" xml:"system_id,attr"`
+	VolumeID      string        `yaml:"volume_id" xml:"volume_id,attr"`
+	VolumeSectors uint32        `yaml:"volume_sectors" xml:"volume_sectors,attr"`
+	ImageSectors  int64         `yaml:"image_sectors" xml:"image_sectors,attr"`
+	SourceRoot    string        `yaml:"source_root,omitempty" xml:"source_root,attr,omitempty"` // Dump directory or archive of the sources
+	Entries       []LayoutEntry `yaml:"entries" xml:"entry"`
+}
+
+// layoutFileType returns the mkpsxiso file type matching the XA attributes of a record
+func layoutFileType(attributes uint16) string {
+	switch {
+	case attributes&XA_ATTR_CDDA != 0:
+		return LayoutTypeDA
+	case attributes&(XA_ATTR_FORM2|XA_ATTR_INTERLEAVED) != 0:
+		return LayoutTypeXA
+	default:
+		return LayoutTypeData
+	}
+}
+
+// ReadLayout walks the whole directory tree and returns every directory, file and
+// unreferenced gap of the image ordered by LBA
+func (r *CDReader) ReadLayout() (*DiscLayout, error) {
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ISO descriptor: %w", err)
+	}
+
+	layout := &DiscLayout{
+		Geometry:      r.geometry.Name,
+		SystemID:      strings.TrimSpace(string(descriptor.SystemID[:])),
+		VolumeID:      strings.TrimSpace(string(descriptor.VolumeID[:])),
+		VolumeSectors: descriptor.VolumeSpaceSizeLSB,
+		ImageSectors:  r.totalSectors,
+		Entries:       []LayoutEntry{},
+	}
+
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	layout.Entries = append(layout.Entries, LayoutEntry{
+		Kind: LayoutEntryDir, LBA: rootLBA, MSF: LBAToMSF(rootLBA), Sectors: DataSectors(rootSize), Size: rootSize,
+	})
+	r.layoutDirectory(layout, rootLBA, rootSize, "", map[uint32]bool{rootLBA: true})
+
+	orphans, err := r.FindOrphans()
+	if err != nil {
+		return nil, err
+	}
+	for _, region := range orphans.Regions {
+		layout.Entries = append(layout.Entries, LayoutEntry{
+			Kind: LayoutEntryGap, LBA: region.FirstLBA, MSF: region.MSF, Sectors: region.Sectors, Empty: region.Empty,
+		})
+	}
+
+	sort.SliceStable(layout.Entries, func(i, j int) bool { return layout.Entries[i].LBA < layout.Entries[j].LBA })
+	return layout, nil
+}
+
+// layoutDirectory adds the entries of a directory and everything below it to the layout
+func (r *CDReader) layoutDirectory(layout *DiscLayout, lba, size uint32, dirPath string, visited map[uint32]bool) {
+	entries, err := r.ParseDirectoryEntries(int64(lba), size)
+	if err != nil {
+		common.LogWarn("Failed to parse directory %s/: %v", dirPath, err)
+		return
+	}
+
+	for _, entry := range entries {
+		entryPath := strings.TrimPrefix(dirPath+"/"+entry.Name, "/")
+		item := LayoutEntry{
+			Path:         entryPath,
+			LBA:          entry.LBA,
+			MSF:          LBAToMSF(entry.LBA),
+			Size:         entry.Size,
+			XAAttributes: entry.XAAttributes,
+			Hidden:       entry.Hidden,
+		}
+
+		if entry.IsDir {
+			if visited[entry.LBA] {
+				continue
+			}
+			visited[entry.LBA] = true
+			item.Kind = LayoutEntryDir
+			item.Sectors = DataSectors(entry.Size)
+			layout.Entries = append(layout.Entries, item)
+			r.layoutDirectory(layout, entry.LBA, entry.Size, entryPath, visited)
+			continue
+		}
+
+		item.Kind = LayoutEntryFile
+		item.Type = layoutFileType(entry.XAAttributes)
+		for _, extent := range entry.Extents {
+			item.Sectors += DataSectors(extent.Size)
+		}
+		if len(entry.Extents) == 0 {
+			item.Sectors = DataSectors(entry.Size)
+		}
+		if len(entry.Extents) > 1 {
+			for _, extent := range entry.Extents {
+				item.Extents = append(item.Extents, LayoutExtent{LBA: extent.LBA, Size: extent.Size})
+			}
+		}
+		layout.Entries = append(layout.Entries, item)
+	}
+}
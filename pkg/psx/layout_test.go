@@ -0,0 +1,45 @@
+// Package psx provides tests for the disc layout of CD images
+package psx
+
+import "testing"
+
+func TestCDReader_ReadLayout(t *testing.T) {
+	const license = "          Licensed  by          Sony Computer Entertainment Amer  ica "
+	reader, err := NewCDReader(writeBootImage(t, bootImageOptions{license, "BOOT = cdrom:\\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"}))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	layout, err := reader.ReadLayout()
+	if err != nil {
+		t.Fatalf("ReadLayout() failed: %v", err)
+	}
+	if layout.SystemID != "PLAYSTATION" || layout.VolumeID != "TOMBA" || layout.VolumeSectors != 24 {
+		t.Errorf("layout = %s/%s with %d sectors, want PLAYSTATION/TOMBA with 24", layout.SystemID, layout.VolumeID, layout.VolumeSectors)
+	}
+
+	// Sector 17 holds no descriptor terminator and 21-23 are empty, so both are gaps
+	want := []struct {
+		kind    string
+		path    string
+		lba     uint32
+		sectors uint32
+	}{
+		{LayoutEntryGap, "", 17, 1},
+		{LayoutEntryDir, "", 18, 1},
+		{LayoutEntryFile, "SYSTEM.CNF", 19, 1},
+		{LayoutEntryFile, "SLUS_006.23", 20, 1},
+		{LayoutEntryGap, "", 21, 3},
+	}
+	if len(layout.Entries) != len(want) {
+		t.Fatalf("ReadLayout() = %+v, want %d entries", layout.Entries, len(want))
+	}
+	for i, w := range want {
+		entry := layout.Entries[i]
+		if entry.Kind != w.kind || entry.Path != w.path || entry.LBA != w.lba || entry.Sectors != w.sectors {
+			t.Errorf("Entries[%d] = %s %q at %d (%d sectors), want %s %q at %d (%d sectors)",
+				i, entry.Kind, entry.Path, entry.LBA, entry.Sectors, w.kind, w.path, w.lba, w.sectors)
+		}
+	}
+}
@@ -0,0 +1,331 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the LZMA decoder of the lzma CHD codec (also the sector data codec
+// of cdlz). chdman writes raw LZMA streams, without a header or an end marker, with the
+// default literal and position settings, and every hunk is a stream of its own, so the
+// hunk itself serves as the dictionary.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// LZMA settings of the CHD lzma codec
+const (
+	lzmaLiteralContextBits = 3 // lc
+	lzmaLiteralPosBits     = 0 // lp
+	lzmaPosBits            = 2 // pb
+)
+
+// LZMA model sizes
+const (
+	lzmaStates          = 12
+	lzmaPosStatesMax    = 1 << 4
+	lzmaProbBits        = 11
+	lzmaProbInit        = 1 << (lzmaProbBits - 1)
+	lzmaMoveBits        = 5
+	lzmaRangeTop        = 1 << 24
+	lzmaLiteralCoders   = 0x300
+	lzmaLengthLowBits   = 3
+	lzmaLengthHighBits  = 8
+	lzmaLenToPosStates  = 4
+	lzmaPosSlotBits     = 6
+	lzmaStartPosModel   = 4
+	lzmaEndPosModel     = 14
+	lzmaFullDistances   = 1 << (lzmaEndPosModel >> 1)
+	lzmaAlignBits       = 4
+	lzmaMatchMinLength  = 2
+	lzmaLiteralStateMax = 7 // States below hold after a literal
+)
+
+// lzmaRangeDecoder reads the bits of an LZMA stream
+type lzmaRangeDecoder struct {
+	src       []byte
+	pos       int
+	rangeSize uint32
+	code      uint32
+	overrun   bool // The decoder read past the end of src
+}
+
+// newLZMARangeDecoder starts decoding src, whose first byte is always zero
+func newLZMARangeDecoder(src []byte) (*lzmaRangeDecoder, error) {
+	if len(src) < 5 || src[0] != 0 {
+		return nil, fmt.Errorf("LZMA stream of %d bytes has no valid range coder header", len(src))
+	}
+	rc := &lzmaRangeDecoder{src: src, pos: 5, rangeSize: 0xFFFFFFFF, code: binary.BigEndian.Uint32(src[1:5])}
+	if rc.code == rc.rangeSize {
+		return nil, fmt.Errorf("LZMA stream has a corrupt range coder header")
+	}
+	return rc, nil
+}
+
+// normalize shifts in the next byte once the range gets too small
+func (rc *lzmaRangeDecoder) normalize() {
+	if rc.rangeSize >= lzmaRangeTop {
+		return
+	}
+	rc.rangeSize <<= 8
+	rc.code <<= 8
+	if rc.pos < len(rc.src) {
+		rc.code |= uint32(rc.src[rc.pos])
+	} else {
+		rc.overrun = true
+	}
+	rc.pos++
+}
+
+// bit decodes a bit with an adaptive probability
+func (rc *lzmaRangeDecoder) bit(prob *uint16) uint32 {
+	bound := (rc.rangeSize >> lzmaProbBits) * uint32(*prob)
+	var bit uint32
+	if rc.code < bound {
+		*prob += ((1 << lzmaProbBits) - *prob) >> lzmaMoveBits
+		rc.rangeSize = bound
+	} else {
+		*prob -= *prob >> lzmaMoveBits
+		rc.code -= bound
+		rc.rangeSize -= bound
+		bit = 1
+	}
+	rc.normalize()
+	return bit
+}
+
+// directBits decodes count bits of fixed probability
+func (rc *lzmaRangeDecoder) directBits(count uint32) uint32 {
+	var value uint32
+	for ; count > 0; count-- {
+		rc.rangeSize >>= 1
+		rc.code -= rc.rangeSize
+		mask := 0 - (rc.code >> 31)
+		rc.code += rc.rangeSize & mask
+		rc.normalize()
+		value = value<<1 + mask + 1
+	}
+	return value
+}
+
+// bitTree decodes a count-bit value, most significant bit first
+func (rc *lzmaRangeDecoder) bitTree(probs []uint16, count uint32) uint32 {
+	m := uint32(1)
+	for i := uint32(0); i < count; i++ {
+		m = m<<1 + rc.bit(&probs[m])
+	}
+	return m - 1<<count
+}
+
+// reverseBitTree decodes a count-bit value, least significant bit first
+func (rc *lzmaRangeDecoder) reverseBitTree(probs []uint16, count uint32) uint32 {
+	m := uint32(1)
+	var value uint32
+	for i := uint32(0); i < count; i++ {
+		bit := rc.bit(&probs[m])
+		m = m<<1 + bit
+		value |= bit << i
+	}
+	return value
+}
+
+// lzmaLengthDecoder decodes match lengths
+type lzmaLengthDecoder struct {
+	choice  uint16
+	choice2 uint16
+	low     [lzmaPosStatesMax][1 << lzmaLengthLowBits]uint16
+	mid     [lzmaPosStatesMax][1 << lzmaLengthLowBits]uint16
+	high    [1 << lzmaLengthHighBits]uint16
+}
+
+// decode returns the length of a match minus lzmaMatchMinLength
+func (l *lzmaLengthDecoder) decode(rc *lzmaRangeDecoder, posState uint32) uint32 {
+	if rc.bit(&l.choice) == 0 {
+		return rc.bitTree(l.low[posState][:], lzmaLengthLowBits)
+	}
+	if rc.bit(&l.choice2) == 0 {
+		return 1<<lzmaLengthLowBits + rc.bitTree(l.mid[posState][:], lzmaLengthLowBits)
+	}
+	return 2<<lzmaLengthLowBits + rc.bitTree(l.high[:], lzmaLengthHighBits)
+}
+
+// lzmaDecoder holds the probability model of an LZMA stream
+type lzmaDecoder struct {
+	literals   [lzmaLiteralCoders << (lzmaLiteralContextBits + lzmaLiteralPosBits)]uint16
+	posSlots   [lzmaLenToPosStates][1 << lzmaPosSlotBits]uint16
+	posCoders  [1 + lzmaFullDistances - lzmaEndPosModel]uint16
+	align      [1 << lzmaAlignBits]uint16
+	isMatch    [lzmaStates << 4]uint16
+	isRep      [lzmaStates]uint16
+	isRepG0    [lzmaStates]uint16
+	isRepG1    [lzmaStates]uint16
+	isRepG2    [lzmaStates]uint16
+	isRep0Long [lzmaStates << 4]uint16
+	length     lzmaLengthDecoder
+	repLength  lzmaLengthDecoder
+}
+
+// newLZMADecoder creates a decoder with every probability at one half
+func newLZMADecoder() *lzmaDecoder {
+	d := &lzmaDecoder{}
+	for _, probs := range [][]uint16{
+		d.literals[:], d.posCoders[:], d.align[:], d.isMatch[:], d.isRep[:], d.isRepG0[:],
+		d.isRepG1[:], d.isRepG2[:], d.isRep0Long[:],
+	} {
+		for i := range probs {
+			probs[i] = lzmaProbInit
+		}
+	}
+	for i := range d.posSlots {
+		for j := range d.posSlots[i] {
+			d.posSlots[i][j] = lzmaProbInit
+		}
+	}
+	for _, l := range []*lzmaLengthDecoder{&d.length, &d.repLength} {
+		l.choice, l.choice2 = lzmaProbInit, lzmaProbInit
+		for i := range l.high {
+			l.high[i] = lzmaProbInit
+		}
+		for posState := range l.low {
+			for i := range l.low[posState] {
+				l.low[posState][i] = lzmaProbInit
+				l.mid[posState][i] = lzmaProbInit
+			}
+		}
+	}
+	return d
+}
+
+// distance decodes the distance of a match of the given length (minus the minimum)
+func (d *lzmaDecoder) distance(rc *lzmaRangeDecoder, length uint32) uint32 {
+	lenState := min(length, lzmaLenToPosStates-1)
+	posSlot := rc.bitTree(d.posSlots[lenState][:], lzmaPosSlotBits)
+	if posSlot < lzmaStartPosModel {
+		return posSlot
+	}
+	directBits := posSlot>>1 - 1
+	distance := (2 | posSlot&1) << directBits
+	if posSlot < lzmaEndPosModel {
+		return distance + rc.reverseBitTree(d.posCoders[distance-posSlot:], directBits)
+	}
+	distance += rc.directBits(directBits-lzmaAlignBits) << lzmaAlignBits
+	return distance + rc.reverseBitTree(d.align[:], lzmaAlignBits)
+}
+
+// decode fills dst with the decoded stream
+func (d *lzmaDecoder) decode(rc *lzmaRangeDecoder, dst []byte) error {
+	var state, rep0, rep1, rep2, rep3 uint32
+	out := 0
+	for out < len(dst) {
+		posState := uint32(out) & (1<<lzmaPosBits - 1)
+		if rc.bit(&d.isMatch[state<<4+posState]) == 0 {
+			prevByte := uint32(0)
+			if out > 0 {
+				prevByte = uint32(dst[out-1])
+			}
+			literalState := (uint32(out)&(1<<lzmaLiteralPosBits-1))<<lzmaLiteralContextBits + prevByte>>(8-lzmaLiteralContextBits)
+			probs := d.literals[lzmaLiteralCoders*literalState:][:lzmaLiteralCoders]
+			symbol := uint32(1)
+			if state >= lzmaLiteralStateMax {
+				matchByte := uint32(dst[out-int(rep0)-1])
+				for symbol < 0x100 {
+					matchBit := matchByte >> 7 & 1
+					matchByte <<= 1
+					bit := rc.bit(&probs[(1+matchBit)<<8+symbol])
+					symbol = symbol<<1 | bit
+					if matchBit != bit {
+						break
+					}
+				}
+			}
+			for symbol < 0x100 {
+				symbol = symbol<<1 | rc.bit(&probs[symbol])
+			}
+			dst[out] = byte(symbol)
+			out++
+			switch {
+			case state < 4:
+				state = 0
+			case state < 10:
+				state -= 3
+			default:
+				state -= 6
+			}
+			continue
+		}
+
+		var length uint32
+		if rc.bit(&d.isRep[state]) != 0 {
+			if out == 0 {
+				return fmt.Errorf("LZMA stream repeats a match before any data")
+			}
+			if rc.bit(&d.isRepG0[state]) == 0 {
+				if rc.bit(&d.isRep0Long[state<<4+posState]) == 0 {
+					state = lzmaNextState(state, 9, 11)
+					dst[out] = dst[out-int(rep0)-1]
+					out++
+					continue
+				}
+			} else {
+				var distance uint32
+				if rc.bit(&d.isRepG1[state]) == 0 {
+					distance = rep1
+				} else {
+					if rc.bit(&d.isRepG2[state]) == 0 {
+						distance = rep2
+					} else {
+						distance = rep3
+						rep3 = rep2
+					}
+					rep2 = rep1
+				}
+				rep1 = rep0
+				rep0 = distance
+			}
+			length = d.repLength.decode(rc, posState)
+			state = lzmaNextState(state, 8, 11)
+		} else {
+			rep3, rep2, rep1 = rep2, rep1, rep0
+			length = d.length.decode(rc, posState)
+			state = lzmaNextState(state, 7, 10)
+			rep0 = d.distance(rc, length)
+			if rep0 == 0xFFFFFFFF {
+				return fmt.Errorf("LZMA stream ends after %d of %d bytes", out, len(dst))
+			}
+		}
+
+		length += lzmaMatchMinLength
+		if int64(rep0) >= int64(out) {
+			return fmt.Errorf("LZMA match at %d reaches back %d bytes, before the start of the data", out, rep0+1)
+		}
+		if int(length) > len(dst)-out {
+			return fmt.Errorf("LZMA match at %d runs %d bytes past the end of the data", out, int(length)-(len(dst)-out))
+		}
+		for ; length > 0; length-- {
+			dst[out] = dst[out-int(rep0)-1]
+			out++
+		}
+	}
+	if rc.overrun {
+		return fmt.Errorf("LZMA stream of %d bytes ends early", len(rc.src))
+	}
+	return nil
+}
+
+// lzmaNextState returns the state after a match: afterLiteral when the previous symbol was
+// a literal, afterMatch otherwise
+func lzmaNextState(state, afterLiteral, afterMatch uint32) uint32 {
+	if state < lzmaLiteralStateMax {
+		return afterLiteral
+	}
+	return afterMatch
+}
+
+// lzmaHunk decompresses a raw LZMA stream, the lzma codec of CHD
+func lzmaHunk(src, dst []byte) error {
+	rc, err := newLZMARangeDecoder(src)
+	if err != nil {
+		return err
+	}
+	if err := newLZMADecoder().decode(rc, dst); err != nil {
+		return fmt.Errorf("failed to decode LZMA hunk: %w", err)
+	}
+	return nil
+}
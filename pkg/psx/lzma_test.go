@@ -0,0 +1,112 @@
+// Package psx provides tests for the LZMA decoder of CHD images.
+package psx
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+// lzmaTestEncoder is the range encoder of an LZMA stream
+type lzmaTestEncoder struct {
+	low       uint64
+	rangeSize uint32
+	cache     byte
+	cacheSize int
+	out       []byte
+}
+
+func (e *lzmaTestEncoder) encode(prob *uint16, bit uint32) {
+	bound := (e.rangeSize >> lzmaProbBits) * uint32(*prob)
+	if bit == 0 {
+		e.rangeSize = bound
+		*prob += ((1 << lzmaProbBits) - *prob) >> lzmaMoveBits
+	} else {
+		e.low += uint64(bound)
+		e.rangeSize -= bound
+		*prob -= *prob >> lzmaMoveBits
+	}
+	for e.rangeSize < lzmaRangeTop {
+		e.rangeSize <<= 8
+		e.shiftLow()
+	}
+}
+
+func (e *lzmaTestEncoder) shiftLow() {
+	if uint32(e.low) < 0xFF000000 || e.low>>32 != 0 {
+		carry := byte(e.low >> 32)
+		for temp := e.cache; e.cacheSize > 0; e.cacheSize-- {
+			e.out = append(e.out, temp+carry)
+			temp = 0xFF
+		}
+		e.cache = byte(e.low >> 24)
+	}
+	e.cacheSize++
+	e.low = (e.low & 0x00FFFFFF) << 8
+}
+
+// lzmaLiterals encodes data as a raw LZMA stream of literals only, a minimal stand-in for
+// the compressor of chdman
+func lzmaLiterals(data []byte) []byte {
+	e := &lzmaTestEncoder{rangeSize: 0xFFFFFFFF, cacheSize: 1}
+	isMatch := make([]uint16, 1<<lzmaPosBits)
+	literals := make([]uint16, lzmaLiteralCoders<<lzmaLiteralContextBits)
+	for _, probs := range [][]uint16{isMatch, literals} {
+		for i := range probs {
+			probs[i] = lzmaProbInit
+		}
+	}
+
+	prev := byte(0)
+	for i, value := range data {
+		e.encode(&isMatch[i&(1<<lzmaPosBits-1)], 0)
+		probs := literals[lzmaLiteralCoders*int(prev>>(8-lzmaLiteralContextBits)):]
+		symbol := uint32(1)
+		for bit := 7; bit >= 0; bit-- {
+			b := uint32(value >> bit & 1)
+			e.encode(&probs[symbol], b)
+			symbol = symbol<<1 | b
+		}
+		prev = value
+	}
+	for i := 0; i < 5; i++ {
+		e.shiftLow()
+	}
+	return e.out
+}
+
+func TestLZMAHunk(t *testing.T) {
+	var want bytes.Buffer
+	for i := 0; i < 6; i++ {
+		fmt.Fprintf(&want, "TOMBA! %d: The Wild Adventures of the pink-haired boy. ", i%3)
+	}
+	for i := 0; i < 2; i++ {
+		for b := 0; b < 40; b++ {
+			want.WriteByte(byte(b))
+		}
+	}
+
+	// Compressed by liblzma (lc=3, lp=0, pb=2) with matches, repeated matches and an end
+	// marker, which the decoder never reaches
+	compressed, _ := hex.DecodeString("002a13c5d1373d0c7ac0d3cf00cf11abc056c84f648f8047e007f458c9b92778b8b0a2cfea2a55b8" +
+		"92b2558853dfd92c349d2b8145bf2db8bff035ed87430d1e3080fcb845aa5a2224e8d3deaf025b4566e000" +
+		"68c23856aa3fb490d0974004dadb1e4755bcfe2a08659e458f5fffffac91a000")
+	got := make([]byte, want.Len())
+	if err := lzmaHunk(compressed, got); err != nil || !bytes.Equal(got, want.Bytes()) {
+		t.Errorf("lzmaHunk() = %q, %v; want %q", got, err, want.Bytes())
+	}
+
+	data := bytes.Repeat([]byte("sector data "), 300)
+	got = make([]byte, len(data))
+	if err := lzmaHunk(lzmaLiterals(data), got); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("lzmaHunk(literals) = %v, want the encoded data", err)
+	}
+
+	if err := lzmaHunk(compressed[:40], make([]byte, want.Len())); err == nil {
+		t.Error("lzmaHunk() of a truncated stream succeeded, want an error")
+	}
+	if err := lzmaHunk(append([]byte{1}, compressed[1:]...), make([]byte, want.Len())); err == nil {
+		t.Error("lzmaHunk() with a bad range coder header succeeded, want an error")
+	}
+}
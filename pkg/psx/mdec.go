@@ -0,0 +1,389 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the decoder of the compressed MDEC frames of STR movies (bitstream
+// versions 2 and 3): the variable-length codes are expanded into the run-level blocks
+// the MDEC chip decodes, then dequantized, transformed by an inverse DCT and converted
+// from YCbCr 4:2:0 macroblocks to RGB.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// MDEC frame layout
+const (
+	MDEC_FRAME_HEADER_SIZE = 8      // Code count, magic, quantization scale and version
+	MDEC_FRAME_MAGIC       = 0x3800 // Second halfword of every frame header
+	MDEC_MACROBLOCK_SIZE   = 16     // Pixels per side of a macroblock
+)
+
+// mdecZigzag maps the coefficients of a block in bitstream order to their position
+var mdecZigzag = [64]int{
+	0, 1, 8, 16, 9, 2, 3, 10,
+	17, 24, 32, 25, 18, 11, 4, 5,
+	12, 19, 26, 33, 40, 48, 41, 34,
+	27, 20, 13, 6, 7, 14, 21, 28,
+	35, 42, 49, 56, 57, 50, 43, 36,
+	29, 22, 15, 23, 30, 37, 44, 51,
+	58, 59, 52, 45, 38, 31, 39, 46,
+	53, 60, 61, 54, 47, 55, 62, 63,
+}
+
+// mdecQuantTable is the intra quantization matrix games load into the MDEC
+var mdecQuantTable = [64]int32{
+	2, 16, 19, 22, 26, 27, 29, 34,
+	16, 16, 22, 24, 27, 29, 34, 37,
+	19, 22, 26, 27, 29, 34, 34, 38,
+	22, 22, 26, 27, 29, 34, 37, 40,
+	22, 26, 27, 29, 32, 35, 40, 48,
+	26, 27, 29, 32, 35, 40, 48, 58,
+	26, 27, 29, 34, 38, 46, 56, 69,
+	27, 29, 35, 38, 46, 56, 69, 83,
+}
+
+// Special runs of the AC code table
+const (
+	mdecEndOfBlock = -1
+	mdecEscape     = -2
+)
+
+// mdecACCode is a variable-length AC code (sign bit excluded) and its run and level
+type mdecACCode struct {
+	code  string
+	run   int
+	level int32
+}
+
+// mdecACCodes is the AC coefficient table of STR frames (the MPEG-1 DCT coefficient
+// table). Escaped coefficients follow 000001 with a 6-bit run and a 10-bit level.
+var mdecACCodes = []mdecACCode{
+	{"10", mdecEndOfBlock, 0}, {"000001", mdecEscape, 0},
+	{"11", 0, 1}, {"011", 1, 1}, {"0100", 0, 2}, {"0101", 2, 1},
+	{"00101", 0, 3}, {"00111", 3, 1}, {"00110", 4, 1},
+	{"000110", 1, 2}, {"000111", 5, 1}, {"000101", 6, 1}, {"000100", 7, 1},
+	{"0000110", 0, 4}, {"0000100", 2, 2}, {"0000111", 8, 1}, {"0000101", 9, 1},
+	{"00100110", 0, 5}, {"00100001", 0, 6}, {"00100101", 1, 3}, {"00100100", 3, 2},
+	{"00100111", 10, 1}, {"00100011", 11, 1}, {"00100010", 12, 1}, {"00100000", 13, 1},
+	{"0000001010", 0, 7}, {"0000001100", 1, 4}, {"0000001011", 2, 3}, {"0000001111", 4, 2},
+	{"0000001001", 5, 2}, {"0000001110", 14, 1}, {"0000001101", 15, 1}, {"0000001000", 16, 1},
+	{"000000011101", 0, 8}, {"000000011000", 0, 9}, {"000000010011", 0, 10}, {"000000010000", 0, 11},
+	{"000000011011", 1, 5}, {"000000010100", 2, 4}, {"000000011100", 3, 3}, {"000000010010", 4, 3},
+	{"000000011110", 6, 2}, {"000000010101", 7, 2}, {"000000010001", 8, 2}, {"000000011111", 17, 1},
+	{"000000011010", 18, 1}, {"000000011001", 19, 1}, {"000000010111", 20, 1}, {"000000010110", 21, 1},
+	{"0000000011010", 0, 12}, {"0000000011001", 0, 13}, {"0000000011000", 0, 14}, {"0000000010111", 0, 15},
+	{"0000000010110", 1, 6}, {"0000000010101", 1, 7}, {"0000000010100", 2, 5}, {"0000000010011", 3, 4},
+	{"0000000010010", 5, 3}, {"0000000010001", 9, 2}, {"0000000010000", 10, 2}, {"0000000011111", 22, 1},
+	{"0000000011110", 23, 1}, {"0000000011101", 24, 1}, {"0000000011100", 25, 1}, {"0000000011011", 26, 1},
+	{"00000000011111", 0, 16}, {"00000000011110", 0, 17}, {"00000000011101", 0, 18}, {"00000000011100", 0, 19},
+	{"00000000011011", 0, 20}, {"00000000011010", 0, 21}, {"00000000011001", 0, 22}, {"00000000011000", 0, 23},
+	{"00000000010111", 0, 24}, {"00000000010110", 0, 25}, {"00000000010101", 0, 26}, {"00000000010100", 0, 27},
+	{"00000000010011", 0, 28}, {"00000000010010", 0, 29}, {"00000000010001", 0, 30}, {"00000000010000", 0, 31},
+	{"000000000011000", 0, 32}, {"000000000010111", 0, 33}, {"000000000010110", 0, 34}, {"000000000010101", 0, 35},
+	{"000000000010100", 0, 36}, {"000000000010011", 0, 37}, {"000000000010010", 0, 38}, {"000000000010001", 0, 39},
+	{"000000000010000", 0, 40}, {"000000000011111", 1, 8}, {"000000000011110", 1, 9}, {"000000000011101", 1, 10},
+	{"000000000011100", 1, 11}, {"000000000011011", 1, 12}, {"000000000011010", 1, 13}, {"000000000011001", 1, 14},
+	{"0000000000010011", 1, 15}, {"0000000000010010", 1, 16}, {"0000000000010001", 1, 17}, {"0000000000010000", 1, 18},
+	{"0000000000010100", 6, 3}, {"0000000000011010", 11, 2}, {"0000000000011001", 12, 2}, {"0000000000011000", 13, 2},
+	{"0000000000010111", 14, 2}, {"0000000000010110", 15, 2}, {"0000000000010101", 16, 2}, {"0000000000011111", 27, 1},
+	{"0000000000011110", 28, 1}, {"0000000000011101", 29, 1}, {"0000000000011100", 30, 1}, {"0000000000011011", 31, 1},
+}
+
+// mdecDCSize is a variable-length code of the size of a version 3 DC difference
+type mdecDCSize struct {
+	code string
+	size int
+}
+
+// DC difference size codes of version 3 frames (the MPEG-1 tables)
+var (
+	mdecLumaDCSizes = []mdecDCSize{
+		{"100", 0}, {"00", 1}, {"01", 2}, {"101", 3}, {"110", 4},
+		{"1110", 5}, {"11110", 6}, {"111110", 7}, {"1111110", 8},
+	}
+	mdecChromaDCSizes = []mdecDCSize{
+		{"00", 0}, {"01", 1}, {"10", 2}, {"110", 3}, {"1110", 4},
+		{"11110", 5}, {"111110", 6}, {"1111110", 7}, {"11111110", 8},
+	}
+)
+
+// mdecVLCKey identifies a code by its length and bits
+type mdecVLCKey struct {
+	length int
+	bits   uint32
+}
+
+// Lookup maps of the code tables and the IDCT basis, built once
+var (
+	mdecACLookup       = make(map[mdecVLCKey]mdecACCode)
+	mdecLumaDCLookup   = make(map[mdecVLCKey]int)
+	mdecChromaDCLookup = make(map[mdecVLCKey]int)
+	mdecIDCTBasis      [8][8]float64 // [position][frequency]
+)
+
+func init() {
+	for _, code := range mdecACCodes {
+		mdecACLookup[mdecCodeKey(code.code)] = code
+	}
+	for _, code := range mdecLumaDCSizes {
+		mdecLumaDCLookup[mdecCodeKey(code.code)] = code.size
+	}
+	for _, code := range mdecChromaDCSizes {
+		mdecChromaDCLookup[mdecCodeKey(code.code)] = code.size
+	}
+	for x := 0; x < 8; x++ {
+		for u := 0; u < 8; u++ {
+			scale := 0.5
+			if u == 0 {
+				scale = 0.5 / math.Sqrt2
+			}
+			mdecIDCTBasis[x][u] = scale * math.Cos(float64((2*x+1)*u)*math.Pi/16)
+		}
+	}
+}
+
+// mdecCodeKey returns the lookup key of a code written as a string of bits
+func mdecCodeKey(code string) mdecVLCKey {
+	key := mdecVLCKey{length: len(code)}
+	for _, bit := range code {
+		key.bits = key.bits<<1 | uint32(bit-'0')
+	}
+	return key
+}
+
+// mdecBitReader reads the bitstream of a frame: 16-bit little-endian words, most
+// significant bit first
+type mdecBitReader struct {
+	data     []byte
+	position int // Bit position
+}
+
+// bits reads an unsigned value of n bits
+func (r *mdecBitReader) bits(n int) (uint32, error) {
+	var value uint32
+	for i := 0; i < n; i++ {
+		word := r.position / 16 * 2
+		if word+1 >= len(r.data) {
+			return 0, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("MDEC bitstream ends at bit %d", r.position))
+		}
+		bit := binary.LittleEndian.Uint16(r.data[word:]) >> (15 - r.position%16) & 1
+		value = value<<1 | uint32(bit)
+		r.position++
+	}
+	return value, nil
+}
+
+// signed reads a two's complement value of n bits
+func (r *mdecBitReader) signed(n int) (int32, error) {
+	value, err := r.bits(n)
+	if err != nil {
+		return 0, err
+	}
+	return int32(value<<(32-n)) >> (32 - n), nil
+}
+
+// mdecReadCode reads a variable-length code of a lookup map, up to 16 bits long
+func mdecReadCode[T any](r *mdecBitReader, lookup map[mdecVLCKey]T) (T, error) {
+	key := mdecVLCKey{}
+	for key.length < 16 {
+		bit, err := r.bits(1)
+		if err != nil {
+			var zero T
+			return zero, err
+		}
+		key.bits, key.length = key.bits<<1|bit, key.length+1
+		if value, ok := lookup[key]; ok {
+			return value, nil
+		}
+	}
+	var zero T
+	return zero, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid MDEC code at bit %d", r.position-key.length))
+}
+
+// mdecFrameDecoder holds the state of the frame being decoded
+type mdecFrameDecoder struct {
+	reader  mdecBitReader
+	version int
+	qscale  int32
+	dc      [3]int32 // Version 3 DC predictors of Cr, Cb and Y
+}
+
+// Block components of a macroblock, in bitstream order
+const (
+	mdecBlockCr = iota
+	mdecBlockCb
+	mdecBlockY
+)
+
+// decodeBlock reads the codes of a block and returns its dequantized coefficients
+func (d *mdecFrameDecoder) decodeBlock(component int) ([64]int32, error) {
+	var coefficients [64]int32
+
+	dc, err := d.readDC(component)
+	if err != nil {
+		return coefficients, err
+	}
+	coefficients[0] = dc * mdecQuantTable[0]
+
+	for index := 0; ; {
+		code, err := mdecReadCode(&d.reader, mdecACLookup)
+		if err != nil {
+			return coefficients, err
+		}
+		run, level := code.run, code.level
+		switch run {
+		case mdecEndOfBlock:
+			return coefficients, nil
+		case mdecEscape:
+			escaped, err := d.reader.bits(6)
+			if err != nil {
+				return coefficients, err
+			}
+			if level, err = d.reader.signed(10); err != nil {
+				return coefficients, err
+			}
+			run = int(escaped)
+		default:
+			sign, err := d.reader.bits(1)
+			if err != nil {
+				return coefficients, err
+			}
+			if sign == 1 {
+				level = -level
+			}
+		}
+
+		index += run + 1
+		if index > 63 {
+			return coefficients, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("MDEC block overflows at bit %d", d.reader.position))
+		}
+		position := mdecZigzag[index]
+		coefficients[position] = (level*mdecQuantTable[position]*d.qscale + 4) >> 3
+	}
+}
+
+// readDC reads the DC coefficient of a block: a 10-bit value in version 2 frames, a
+// difference to the previous block of the same component in version 3 frames
+func (d *mdecFrameDecoder) readDC(component int) (int32, error) {
+	if d.version == 2 {
+		return d.reader.signed(10)
+	}
+
+	lookup := mdecChromaDCLookup
+	if component == mdecBlockY {
+		lookup = mdecLumaDCLookup
+	}
+	size, err := mdecReadCode(&d.reader, lookup)
+	if err != nil {
+		return 0, err
+	}
+	var difference int32
+	if size > 0 {
+		bits, err := d.reader.bits(size)
+		if err != nil {
+			return 0, err
+		}
+		difference = int32(bits)
+		if bits < 1<<(size-1) {
+			difference -= 1<<size - 1
+		}
+	}
+	d.dc[component] += difference * 4
+	if d.dc[component] < -512 || d.dc[component] > 511 {
+		return 0, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("MDEC DC coefficient %d out of range", d.dc[component]))
+	}
+	return d.dc[component], nil
+}
+
+// mdecIDCT transforms dequantized coefficients into signed 8-bit samples
+func mdecIDCT(coefficients [64]int32) [64]int32 {
+	var rows [64]float64
+	for v := 0; v < 8; v++ {
+		for x := 0; x < 8; x++ {
+			var sum float64
+			for u := 0; u < 8; u++ {
+				sum += mdecIDCTBasis[x][u] * float64(coefficients[v*8+u])
+			}
+			rows[v*8+x] = sum
+		}
+	}
+
+	var samples [64]int32
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			var sum float64
+			for v := 0; v < 8; v++ {
+				sum += mdecIDCTBasis[y][v] * rows[v*8+x]
+			}
+			samples[y*8+x] = max(-128, min(127, int32(math.Round(sum))))
+		}
+	}
+	return samples
+}
+
+// DecodeMDECFrame decodes the bitstream of an STR frame (the demuxed frame data, header
+// included) into an RGB image of the given size. Macroblocks are stored column by
+// column, each as its Cr, Cb and four Y blocks.
+func DecodeMDECFrame(data []byte, width, height int) (*image.NRGBA, error) {
+	if len(data) < MDEC_FRAME_HEADER_SIZE || binary.LittleEndian.Uint16(data[2:]) != MDEC_FRAME_MAGIC {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("not an MDEC frame"))
+	}
+	if width <= 0 || height <= 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid frame size %dx%d", width, height))
+	}
+	decoder := &mdecFrameDecoder{
+		reader:  mdecBitReader{data: data[MDEC_FRAME_HEADER_SIZE:]},
+		qscale:  int32(binary.LittleEndian.Uint16(data[4:])),
+		version: int(binary.LittleEndian.Uint16(data[6:])),
+	}
+	if decoder.version != 2 && decoder.version != 3 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("unsupported MDEC bitstream version %d", decoder.version))
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	columns := (width + MDEC_MACROBLOCK_SIZE - 1) / MDEC_MACROBLOCK_SIZE
+	rows := (height + MDEC_MACROBLOCK_SIZE - 1) / MDEC_MACROBLOCK_SIZE
+	for column := 0; column < columns; column++ {
+		for row := 0; row < rows; row++ {
+			var blocks [6][64]int32
+			for i := range blocks {
+				component := min(i, mdecBlockY)
+				coefficients, err := decoder.decodeBlock(component)
+				if err != nil {
+					return nil, fmt.Errorf("macroblock %d,%d: %w", column, row, err)
+				}
+				blocks[i] = mdecIDCT(coefficients)
+			}
+			drawMacroblock(img, column*MDEC_MACROBLOCK_SIZE, row*MDEC_MACROBLOCK_SIZE, blocks)
+		}
+	}
+	return img, nil
+}
+
+// drawMacroblock converts the Cr, Cb and Y blocks of a macroblock to RGB pixels
+func drawMacroblock(img *image.NRGBA, left, top int, blocks [6][64]int32) {
+	bounds := img.Bounds()
+	for y := 0; y < MDEC_MACROBLOCK_SIZE && top+y < bounds.Max.Y; y++ {
+		for x := 0; x < MDEC_MACROBLOCK_SIZE && left+x < bounds.Max.X; x++ {
+			block := 2 + y/8*2 + x/8
+			luma := float64(blocks[block][y%8*8+x%8] + 128)
+			cr := float64(blocks[mdecBlockCr][y/2*8+x/2])
+			cb := float64(blocks[mdecBlockCb][y/2*8+x/2])
+			img.SetNRGBA(left+x, top+y, color.NRGBA{
+				R: mdecClampByte(luma + 1.402*cr),
+				G: mdecClampByte(luma - 0.3437*cb - 0.7143*cr),
+				B: mdecClampByte(luma + 1.772*cb),
+				A: 0xFF,
+			})
+		}
+	}
+}
+
+// mdecClampByte rounds a color component to the 0-255 range
+func mdecClampByte(value float64) uint8 {
+	return uint8(max(0, min(255, math.Round(value))))
+}
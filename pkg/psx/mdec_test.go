@@ -0,0 +1,160 @@
+// Package psx provides tests for the MDEC frame decoder and the STR demuxer
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// mdecTestFrame returns an MDEC frame of the given version whose bitstream is the
+// concatenation of the bit strings
+func mdecTestFrame(version, qscale int, bits ...string) []byte {
+	stream := strings.Join(bits, "")
+	stream += strings.Repeat("0", (32 - len(stream)%16)) // Padding words
+
+	frame := make([]byte, MDEC_FRAME_HEADER_SIZE)
+	binary.LittleEndian.PutUint16(frame[2:], MDEC_FRAME_MAGIC)
+	binary.LittleEndian.PutUint16(frame[4:], uint16(qscale))
+	binary.LittleEndian.PutUint16(frame[6:], uint16(version))
+	for i := 0; i+16 <= len(stream); i += 16 {
+		var word uint16
+		for _, bit := range stream[i : i+16] {
+			word = word<<1 | uint16(bit-'0')
+		}
+		frame = binary.LittleEndian.AppendUint16(frame, word)
+	}
+	return frame
+}
+
+// mdecDC returns the 10-bit DC code of a version 2 block
+func mdecDC(value int) string {
+	return fmt.Sprintf("%010b", uint16(value)&0x3FF)
+}
+
+func TestMDECCodeTables_PrefixFree(t *testing.T) {
+	tables := map[string][]string{}
+	for _, code := range mdecACCodes {
+		tables["AC"] = append(tables["AC"], code.code)
+	}
+	for _, code := range mdecLumaDCSizes {
+		tables["luma DC"] = append(tables["luma DC"], code.code)
+	}
+	for _, code := range mdecChromaDCSizes {
+		tables["chroma DC"] = append(tables["chroma DC"], code.code)
+	}
+
+	for name, codes := range tables {
+		for i, a := range codes {
+			for j, b := range codes {
+				if i != j && strings.HasPrefix(b, a) {
+					t.Errorf("%s code %s is a prefix of %s", name, a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeMDECFrame(t *testing.T) {
+	const eob = "10"
+	// Two macroblocks side by side: gray, then Y 128 with Cr 40. The first block also
+	// holds an escaped coefficient of level 0, which changes nothing.
+	frame := mdecTestFrame(2, 1,
+		mdecDC(0), "000001", "000101", mdecDC(0), eob, mdecDC(0), eob,
+		mdecDC(200), eob, mdecDC(200), eob, mdecDC(200), eob, mdecDC(200), eob,
+		mdecDC(160), eob, mdecDC(0), eob,
+		mdecDC(0), eob, mdecDC(0), eob, mdecDC(0), eob, mdecDC(0), eob,
+	)
+
+	img, err := DecodeMDECFrame(frame, 32, 16)
+	if err != nil {
+		t.Fatalf("DecodeMDECFrame() failed: %v", err)
+	}
+	if got := img.NRGBAAt(3, 12); got != (color.NRGBA{178, 178, 178, 255}) {
+		t.Errorf("pixel 3,12 = %v, want gray 178", got)
+	}
+	if got := img.NRGBAAt(20, 5); got != (color.NRGBA{184, 99, 128, 255}) {
+		t.Errorf("pixel 20,5 = %v, want 184,99,128", got)
+	}
+
+	// Version 3 carries the DC as differences: +50 (x4) for the first Y block only
+	v3 := mdecTestFrame(3, 1,
+		"00", eob, "00", eob,
+		"11110110010", eob, "100", eob, "100", eob, "100", eob,
+	)
+	if img, err = DecodeMDECFrame(v3, 16, 16); err != nil {
+		t.Fatalf("DecodeMDECFrame(v3) failed: %v", err)
+	}
+	if got := img.NRGBAAt(15, 15); got != (color.NRGBA{178, 178, 178, 255}) {
+		t.Errorf("v3 pixel 15,15 = %v, want gray 178", got)
+	}
+
+	for name, invalid := range map[string][]byte{
+		"version 1": mdecTestFrame(1, 1, mdecDC(0), eob),
+		"truncated": mdecTestFrame(2, 1, mdecDC(0), eob),
+		"no magic":  make([]byte, 16),
+	} {
+		if _, err := DecodeMDECFrame(invalid, 16, 16); common.ExitCodeFor(err) != common.ExitFormatError {
+			t.Errorf("%s: DecodeMDECFrame() error = %v, want a format error", name, err)
+		}
+	}
+}
+
+// strTestSector returns the user data of a video sector
+func strTestSector(frame uint32, chunk, chunks uint16, frameSize uint32, data []byte) []byte {
+	sector := make([]byte, CD_DATA_SIZE)
+	copy(sector, strVideoMagic)
+	binary.LittleEndian.PutUint16(sector[4:], chunk)
+	binary.LittleEndian.PutUint16(sector[6:], chunks)
+	binary.LittleEndian.PutUint32(sector[8:], frame)
+	binary.LittleEndian.PutUint32(sector[12:], frameSize)
+	binary.LittleEndian.PutUint16(sector[16:], 16)
+	binary.LittleEndian.PutUint16(sector[18:], 16)
+	copy(sector[STR_HEADER_SIZE:], data)
+	return sector
+}
+
+func TestSTRDemuxer(t *testing.T) {
+	first := bytes.Repeat([]byte{0xAA}, STR_CHUNK_SIZE)
+	second := []byte{0xBB, 0xBB}
+	size := uint32(STR_CHUNK_SIZE + len(second))
+
+	demuxer := &STRDemuxer{}
+	sectors := [][]byte{
+		strTestSector(1, 0, 2, size, first),
+		make([]byte, CD_DATA_SIZE), // Not video
+		strTestSector(2, 0, 2, size, first),
+		strTestSector(2, 1, 2, size, second), // Frame 1 was left incomplete
+	}
+	var frames []*STRFrame
+	for _, sector := range sectors {
+		frame, err := demuxer.AddSector(sector)
+		if err != nil {
+			t.Fatalf("AddSector() failed: %v", err)
+		}
+		if frame != nil {
+			frames = append(frames, frame)
+		}
+	}
+
+	if len(frames) != 1 || frames[0].Number != 2 {
+		t.Fatalf("frames = %+v, want frame 2 only", frames)
+	}
+	if want := append(bytes.Clone(first), second...); !bytes.Equal(frames[0].Data, want) {
+		t.Errorf("frame data = %d bytes, want the %d bytes of both chunks", len(frames[0].Data), len(want))
+	}
+	if frames[0].Width != 16 || frames[0].Height != 16 {
+		t.Errorf("frame size = %dx%d, want 16x16", frames[0].Width, frames[0].Height)
+	}
+
+	huge := strTestSector(3, 0, 1, 0, nil)
+	binary.LittleEndian.PutUint16(huge[16:], 4096)
+	if _, err := demuxer.AddSector(huge); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("AddSector(4096 wide) error = %v, want a format error", err)
+	}
+}
@@ -0,0 +1,36 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the main RAM address map used when patching memory of a
+// running emulator.
+package psx
+
+import "fmt"
+
+// Main RAM size and segment bases of the PlayStation address space
+const (
+	PSX_RAM_SIZE   = 0x200000   // 2 MB of main RAM
+	PSX_KUSEG_BASE = 0x00000000 // Cached user segment mirror
+	PSX_KSEG0_BASE = 0x80000000 // Cached kernel segment, used by game code
+	PSX_KSEG1_BASE = 0xA0000000 // Uncached kernel segment
+)
+
+// RAMOffset returns the offset into main RAM of a KUSEG, KSEG0 or KSEG1 address
+func RAMOffset(address uint32) (uint32, bool) {
+	for _, base := range []uint32{PSX_KUSEG_BASE, PSX_KSEG0_BASE, PSX_KSEG1_BASE} {
+		if address >= base && address-base < PSX_RAM_SIZE {
+			return address - base, true
+		}
+	}
+	return 0, false
+}
+
+// ValidateRAMRange checks that size bytes starting at address lie inside main RAM
+func ValidateRAMRange(address uint32, size int) error {
+	offset, ok := RAMOffset(address)
+	if !ok {
+		return fmt.Errorf("address 0x%08X is not in main RAM (0x80000000-0x801FFFFF)", address)
+	}
+	if size < 0 || uint64(offset)+uint64(size) > PSX_RAM_SIZE {
+		return fmt.Errorf("%d bytes at 0x%08X run past the end of main RAM", size, address)
+	}
+	return nil
+}
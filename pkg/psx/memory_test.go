@@ -0,0 +1,30 @@
+// Package psx provides tests for the main RAM address map.
+package psx
+
+import "testing"
+
+func TestValidateRAMRange(t *testing.T) {
+	tests := []struct {
+		name    string
+		address uint32
+		size    int
+		wantErr bool
+	}{
+		{"kseg0 start", 0x80000000, 16, false},
+		{"kseg0 end", 0x801FFFF0, 16, false},
+		{"kuseg", 0x00010000, 16, false},
+		{"kseg1", 0xA0100000, 16, false},
+		{"past end", 0x801FFFF0, 17, true},
+		{"scratchpad", 0x1F800000, 4, true},
+		{"bios", 0xBFC00000, 4, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRAMRange(tt.address, tt.size)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRAMRange(0x%08X, %d) error = %v, wantErr %v", tt.address, tt.size, err, tt.wantErr)
+			}
+		})
+	}
+}
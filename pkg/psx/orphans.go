@@ -0,0 +1,211 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the orphaned sector analysis of CD images: every sector that is
+// not part of the system area, a volume descriptor, a path table, a directory or a
+// file extent is reported, together with directory records carrying the hidden flag.
+package psx
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// ISO9660 layout constants used by the orphan analysis
+const (
+	ISO_SYSTEM_AREA_SECTORS    = 16  // Sectors 0-15 are reserved for the system (license, logo)
+	ISO_DESCRIPTOR_TERMINATOR  = 255 // Volume descriptor set terminator type
+	ISO_MAX_VOLUME_DESCRIPTORS = 32  // Upper bound when scanning the descriptor set
+)
+
+// Owners of referenced sectors that are not files or directories
+const (
+	unreferencedSector   = -1
+	systemAreaOwner      = "(system area)"
+	descriptorOwner      = "(volume descriptors)"
+	pathTableOwnerFormat = "(path table %d)"
+)
+
+// OrphanRegion is a run of sectors not referenced by the file system
+type OrphanRegion struct {
+	FirstLBA     uint32 `json:"first_lba"`
+	Sectors      uint32 `json:"sectors"`
+	MSF          string `json:"msf"`
+	Empty        bool   `json:"empty"`           // Every user data byte is zero
+	BeyondVolume bool   `json:"beyond_volume"`   // Region lies after the volume size of the descriptor
+	After        string `json:"after,omitempty"` // Referenced item right before the region
+	File         string `json:"file,omitempty"`  // Dump file of the region, if written
+}
+
+// HiddenEntry is a directory record with the hidden (existence) flag set
+type HiddenEntry struct {
+	Path  string `json:"path"`
+	LBA   uint32 `json:"lba"`
+	Size  uint32 `json:"size"`
+	IsDir bool   `json:"is_dir"`
+}
+
+// OrphanReport is the result of the orphaned sector analysis
+type OrphanReport struct {
+	VolumeSectors     uint32         `json:"volume_sectors"`
+	ImageSectors      int64          `json:"image_sectors"`
+	ReferencedSectors uint32         `json:"referenced_sectors"`
+	OrphanSectors     uint32         `json:"orphan_sectors"`
+	Regions           []OrphanRegion `json:"regions"`
+	HiddenEntries     []HiddenEntry  `json:"hidden_entries"`
+}
+
+// sectorOwners records which referenced item each sector belongs to
+type sectorOwners struct {
+	owners []int
+	names  []string
+}
+
+// mark assigns a sector range to a named owner, clipped to the image
+func (s *sectorOwners) mark(name string, firstLBA uint32, sectors uint32) {
+	index := len(s.names)
+	s.names = append(s.names, name)
+	for lba := int64(firstLBA); lba < int64(firstLBA)+int64(sectors) && lba < int64(len(s.owners)); lba++ {
+		s.owners[lba] = index
+	}
+}
+
+// FindOrphans walks the whole directory tree and reports unreferenced sectors and hidden records
+func (r *CDReader) FindOrphans() (*OrphanReport, error) {
+	descriptor, err := r.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ISO descriptor: %w", err)
+	}
+
+	report := &OrphanReport{
+		VolumeSectors: descriptor.VolumeSpaceSizeLSB,
+		ImageSectors:  r.totalSectors,
+		Regions:       []OrphanRegion{},
+		HiddenEntries: []HiddenEntry{},
+	}
+
+	owners := &sectorOwners{owners: make([]int, r.totalSectors)}
+	for i := range owners.owners {
+		owners.owners[i] = unreferencedSector
+	}
+
+	owners.mark(systemAreaOwner, 0, ISO_SYSTEM_AREA_SECTORS)
+	owners.mark(descriptorOwner, ISO_SYSTEM_AREA_SECTORS, r.countVolumeDescriptors())
+
+	pathTableSectors := DataSectors(descriptor.PathTableSizeLSB)
+	for i, lba := range []uint32{descriptor.PathTable1Offs, descriptor.PathTable2Offs, descriptor.PathTable1MSBOffs, descriptor.PathTable2MSBOffs} {
+		if lba != 0 {
+			owners.mark(fmt.Sprintf(pathTableOwnerFormat, i+1), lba, pathTableSectors)
+		}
+	}
+
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	r.markDirectory(report, owners, rootLBA, rootSize, "", make(map[uint32]bool))
+
+	r.collectOrphanRegions(report, owners)
+	return report, nil
+}
+
+// countVolumeDescriptors returns the number of descriptor sectors up to and including the terminator
+func (r *CDReader) countVolumeDescriptors() uint32 {
+	for i := uint32(0); i < ISO_MAX_VOLUME_DESCRIPTORS; i++ {
+		data, err := r.readSectorData(int64(ISO_SYSTEM_AREA_SECTORS + i))
+		if err != nil || string(data[1:6]) != "CD001" {
+			return i
+		}
+		if data[0] == ISO_DESCRIPTOR_TERMINATOR {
+			return i + 1
+		}
+	}
+	return ISO_MAX_VOLUME_DESCRIPTORS
+}
+
+// markDirectory marks a directory extent and everything below it as referenced
+func (r *CDReader) markDirectory(report *OrphanReport, owners *sectorOwners, lba, size uint32, dirPath string, visited map[uint32]bool) {
+	if visited[lba] {
+		return
+	}
+	visited[lba] = true
+	owners.mark(dirPath+"/", lba, DataSectors(size))
+
+	entries, err := r.ParseDirectoryEntries(int64(lba), size)
+	if err != nil {
+		common.LogWarn("Failed to parse directory %s/: %v", dirPath, err)
+		return
+	}
+
+	for _, entry := range entries {
+		entryPath := dirPath + "/" + entry.Name
+		if entry.Hidden {
+			report.HiddenEntries = append(report.HiddenEntries, HiddenEntry{
+				Path: entryPath, LBA: entry.LBA, Size: entry.Size, IsDir: entry.IsDir,
+			})
+		}
+
+		if entry.IsDir {
+			r.markDirectory(report, owners, entry.LBA, entry.Size, entryPath, visited)
+			continue
+		}
+		for _, extent := range entry.Extents {
+			owners.mark(entryPath, extent.LBA, DataSectors(extent.Size))
+		}
+	}
+}
+
+// collectOrphanRegions groups unreferenced sectors into regions and classifies them
+func (r *CDReader) collectOrphanRegions(report *OrphanReport, owners *sectorOwners) {
+	volumeEnd := int64(report.VolumeSectors)
+	for lba := int64(0); lba < r.totalSectors; {
+		if owners.owners[lba] != unreferencedSector {
+			report.ReferencedSectors++
+			lba++
+			continue
+		}
+
+		// Regions are split at the end of the volume so trailing padding is reported apart
+		first := lba
+		for lba < r.totalSectors && owners.owners[lba] == unreferencedSector && (first >= volumeEnd || lba < volumeEnd) {
+			lba++
+		}
+
+		region := OrphanRegion{
+			FirstLBA:     uint32(first),
+			Sectors:      uint32(lba - first),
+			MSF:          LBAToMSF(uint32(first)),
+			BeyondVolume: first >= volumeEnd,
+			Empty:        r.regionIsEmpty(first, lba),
+		}
+		if first > 0 && owners.owners[first-1] != unreferencedSector {
+			region.After = owners.names[owners.owners[first-1]]
+		}
+
+		report.OrphanSectors += region.Sectors
+		report.Regions = append(report.Regions, region)
+	}
+}
+
+// regionIsEmpty reports whether the user data of every sector in [first, end) is zero
+func (r *CDReader) regionIsEmpty(first, end int64) bool {
+	zero := make([]byte, CD_DATA_SIZE)
+	for lba := first; lba < end; lba++ {
+		data, err := r.readSectorData(lba)
+		if err != nil || !bytes.Equal(data, zero) {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadRegion reads the user data of every sector of an orphan region
+func (r *CDReader) ReadRegion(region OrphanRegion) ([]byte, error) {
+	var buffer bytes.Buffer
+	for lba := int64(region.FirstLBA); lba < int64(region.FirstLBA)+int64(region.Sectors); lba++ {
+		data, err := r.readSectorData(lba)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sector %d: %w", lba, err)
+		}
+		buffer.Write(data)
+	}
+	return buffer.Bytes(), nil
+}
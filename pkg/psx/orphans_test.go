@@ -0,0 +1,105 @@
+// Package psx provides tests for the orphaned sector analysis.
+package psx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeOrphanImage creates a 30-sector image whose volume ends at sector 28 with:
+// descriptors at 16-17, path table at 18, root at 19, a DATA directory at 20, files
+// at 21 and 22-23, unreferenced debug data at 25 and a hidden file at 26
+func writeOrphanImage(t *testing.T) string {
+	t.Helper()
+
+	const sectors = 30
+	image := make([]byte, sectors*CD_SECTOR_SIZE)
+	sectorData := func(lba int) []byte {
+		raw := image[lba*CD_SECTOR_SIZE : (lba+1)*CD_SECTOR_SIZE]
+		return raw[24 : 24+CD_DATA_SIZE]
+	}
+	for lba := 0; lba < sectors; lba++ {
+		image[lba*CD_SECTOR_SIZE+15] = 2
+	}
+
+	pvd := sectorData(16)
+	copy(pvd, "\x01CD001\x01")
+	pvd[80] = 28 // Volume size (LSB)
+	pvd[87] = 28 // Volume size (MSB)
+	pvd[132] = 10
+	pvd[140] = 18 // Type-L path table
+	writeDirRecord(pvd[156:190], "\x00", 19, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	copy(sectorData(17), "\xFFCD001\x01")
+
+	root := sectorData(19)
+	offset := writeDirRecord(root, "\x00", 19, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "\x01", 19, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "DATA", 20, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "MAIN.EXE;1", 21, 100, 0)
+	writeDirRecord(root[offset:], "SECRET.BIN;1", 26, 10, ISO_FLAG_HIDDEN)
+
+	data := sectorData(20)
+	offset = writeDirRecord(data, "\x00", 20, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(data[offset:], "\x01", 19, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	writeDirRecord(data[offset:], "STAGE.GAM;1", 22, CD_DATA_SIZE+1, 0)
+
+	copy(sectorData(25), "DEBUG LEFTOVER")
+
+	imagePath := filepath.Join(t.TempDir(), "orphans.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestCDReader_FindOrphans(t *testing.T) {
+	reader, err := NewCDReader(writeOrphanImage(t))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	report, err := reader.FindOrphans()
+	if err != nil {
+		t.Fatalf("FindOrphans() failed: %v", err)
+	}
+
+	want := []OrphanRegion{
+		{FirstLBA: 24, Sectors: 2, Empty: false, After: "/DATA/STAGE.GAM"},
+		{FirstLBA: 27, Sectors: 1, Empty: true, After: "/SECRET.BIN"},
+		{FirstLBA: 28, Sectors: 2, Empty: true, BeyondVolume: true},
+	}
+
+	if len(report.Regions) != len(want) {
+		t.Fatalf("len(Regions) = %d, want %d: %+v", len(report.Regions), len(want), report.Regions)
+	}
+	for i, region := range report.Regions {
+		if region.FirstLBA != want[i].FirstLBA || region.Sectors != want[i].Sectors ||
+			region.Empty != want[i].Empty || region.BeyondVolume != want[i].BeyondVolume {
+			t.Errorf("Regions[%d] = %+v, want %+v", i, region, want[i])
+		}
+		if want[i].After != "" && region.After != want[i].After {
+			t.Errorf("Regions[%d].After = %q, want %q", i, region.After, want[i].After)
+		}
+	}
+
+	if report.OrphanSectors != 5 {
+		t.Errorf("OrphanSectors = %d, want 5", report.OrphanSectors)
+	}
+	if report.ReferencedSectors != 25 {
+		t.Errorf("ReferencedSectors = %d, want 25", report.ReferencedSectors)
+	}
+
+	if len(report.HiddenEntries) != 1 || report.HiddenEntries[0].Path != "/SECRET.BIN" {
+		t.Errorf("HiddenEntries = %+v, want /SECRET.BIN", report.HiddenEntries)
+	}
+
+	data, err := reader.ReadRegion(report.Regions[0])
+	if err != nil {
+		t.Fatalf("ReadRegion() failed: %v", err)
+	}
+	if len(data) != 2*CD_DATA_SIZE || string(data[CD_DATA_SIZE:CD_DATA_SIZE+14]) != "DEBUG LEFTOVER" {
+		t.Errorf("ReadRegion() did not return the debug data")
+	}
+}
@@ -0,0 +1,190 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the overlay image: a copy-on-write view of an image backend that
+// keeps written sectors in memory, so a disc can be patched and written out as a new
+// image without copying the original or touching it.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// overlayCopyChunk is the number of sectors copied at once by OverlayImage.WriteTo
+const overlayCopyChunk = 256
+
+// OverlayImage is a copy-on-write view of an image backend. Reads return the sectors
+// written to the overlay, or the base image elsewhere; the base is never written.
+type OverlayImage struct {
+	base     ImageBackend
+	geometry SectorGeometry
+	sectors  map[int64][]byte // Written sectors by LBA
+}
+
+// NewOverlayImage creates an empty overlay over an open image backend
+func NewOverlayImage(base ImageBackend) *OverlayImage {
+	return &OverlayImage{
+		base:     base,
+		geometry: DetectGeometry(base, base.Size()),
+		sectors:  make(map[int64][]byte),
+	}
+}
+
+// Geometry returns the sector geometry of the base image
+func (o *OverlayImage) Geometry() SectorGeometry {
+	return o.geometry
+}
+
+// Size returns the size of the base image; writes never grow the image
+func (o *OverlayImage) Size() int64 {
+	return o.base.Size()
+}
+
+// Format returns the format of the base image file
+func (o *OverlayImage) Format() string {
+	return o.base.Format()
+}
+
+// Close does nothing: the base image belongs to the caller, which closes it once the
+// overlay and the readers over it are no longer used
+func (o *OverlayImage) Close() error {
+	return nil
+}
+
+// ChangedSectors returns the number of sectors written to the overlay
+func (o *OverlayImage) ChangedSectors() int {
+	return len(o.sectors)
+}
+
+// ReadAt reads from the written sectors where there are any and from the base image
+// everywhere else
+func (o *OverlayImage) ReadAt(p []byte, off int64) (int, error) {
+	sectorSize := int64(o.geometry.SectorSize)
+	read := 0
+	for read < len(p) {
+		position := off + int64(read)
+		if position >= o.Size() {
+			return read, io.EOF
+		}
+		lba := position / sectorSize
+		start := position % sectorSize
+		size := int(sectorSize - start)
+		if size > len(p)-read {
+			size = len(p) - read
+		}
+
+		if sector, ok := o.sectors[lba]; ok {
+			copy(p[read:read+size], sector[start:])
+		} else if n, err := o.base.ReadAt(p[read:read+size], position); err != nil {
+			return read + n, err
+		}
+		read += size
+	}
+	return read, nil
+}
+
+// sector returns the overlay copy of a sector, copying it from the base image first
+func (o *OverlayImage) sector(lba int64) ([]byte, error) {
+	if sector, ok := o.sectors[lba]; ok {
+		return sector, nil
+	}
+	if lba < 0 || lba >= o.geometry.Sectors(o.Size()) {
+		return nil, fmt.Errorf("LBA %d out of bounds (total: %d)", lba, o.geometry.Sectors(o.Size()))
+	}
+	sector := make([]byte, o.geometry.SectorSize)
+	if _, err := o.base.ReadAt(sector, o.geometry.SectorOffset(lba)); err != nil {
+		return nil, fmt.Errorf("failed to read sector %d: %w", lba, err)
+	}
+	o.sectors[lba] = sector
+	return sector, nil
+}
+
+// WriteFileData writes data at offset of the file starting at lba and regenerates the
+// EDC and ECC of every raw sector it touches, like WriteFileData does on image files
+func (o *OverlayImage) WriteFileData(lba, offset uint32, data []byte) error {
+	for written := 0; written < len(data); {
+		position := int64(offset) + int64(written)
+		sector, err := o.sector(int64(lba) + position/CD_DATA_SIZE)
+		if err != nil {
+			return err
+		}
+		written += patchSectorData(o.geometry, sector, int(position%CD_DATA_SIZE), data[written:])
+	}
+	return nil
+}
+
+// WriteEntryData writes data at offset of a file, following its extents, and regenerates
+// the EDC and ECC of every raw sector it touches
+func (o *OverlayImage) WriteEntryData(entry CDFileEntry, offset uint32, data []byte) error {
+	return entry.writeExtentRuns(offset, data, o.WriteFileData)
+}
+
+// SetEntrySize rewrites the size of a file in its directory records (both byte orders).
+// The extents of the file are unchanged, so the size must fit their sectors. The size is
+// spread over the extents in order: every extent but the last stays full, the extents
+// past the end of the data are left empty.
+func (o *OverlayImage) SetEntrySize(entry CDFileEntry, size uint32) error {
+	extents := entry.extents()
+	capacities := entry.extentCapacities()
+	total := uint64(0)
+	for _, capacity := range capacities {
+		total += uint64(capacity)
+	}
+	if uint64(size) > total {
+		return fmt.Errorf("%s needs %d sectors, its extents hold %d", entry.Name, DataSectors(size), total/CD_DATA_SIZE)
+	}
+
+	remaining := size
+	for i, extent := range extents {
+		extentSize := min(remaining, capacities[i])
+		remaining -= extentSize
+		if extentSize == extent.Size {
+			continue
+		}
+		if extent.recordLBA == 0 {
+			return fmt.Errorf("%s has no directory record location", entry.Name)
+		}
+		sizes := make([]byte, 8)
+		binary.LittleEndian.PutUint32(sizes[0:4], extentSize)
+		binary.BigEndian.PutUint32(sizes[4:8], extentSize)
+		if err := o.WriteFileData(extent.recordLBA, uint32(extent.recordOffset)+10, sizes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteTo writes the complete image, written sectors included, to w. A cancellable copy
+// passes a common.ProgressWriter, which fails once its operation is canceled.
+func (o *OverlayImage) WriteTo(w io.Writer) (int64, error) {
+	lbas := make([]int64, 0, len(o.sectors))
+	for lba := range o.sectors {
+		lbas = append(lbas, lba)
+	}
+	sort.Slice(lbas, func(i, j int) bool { return lbas[i] < lbas[j] })
+
+	// Copy the base image in chunks, replacing the written sectors
+	sectorSize := int64(o.geometry.SectorSize)
+	buffer := make([]byte, overlayCopyChunk*sectorSize)
+	var written int64
+	for written < o.Size() {
+		chunk := buffer
+		if remaining := o.Size() - written; remaining < int64(len(chunk)) {
+			chunk = chunk[:remaining]
+		}
+		if _, err := o.base.ReadAt(chunk, written); err != nil && err != io.EOF {
+			return written, fmt.Errorf("failed to read image at 0x%X: %w", written, err)
+		}
+		for len(lbas) > 0 && lbas[0]*sectorSize < written+int64(len(chunk)) {
+			copy(chunk[lbas[0]*sectorSize-written:], o.sectors[lbas[0]])
+			lbas = lbas[1:]
+		}
+		n, err := w.Write(chunk)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
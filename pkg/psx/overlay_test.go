@@ -0,0 +1,174 @@
+// Package psx provides tests for the copy-on-write overlay image.
+package psx
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestOverlayImage(t *testing.T) {
+	imagePath, original := writeSealedBootImage(t)
+	base, err := OpenImage(imagePath)
+	if err != nil {
+		t.Fatalf("OpenImage() failed: %v", err)
+	}
+	defer base.Close()
+
+	overlay := NewOverlayImage(base)
+	reader := NewCDReaderFromImage(overlay)
+	descriptor, err := reader.ReadISODescriptor()
+	if err != nil {
+		t.Fatalf("ReadISODescriptor() failed: %v", err)
+	}
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	entry, err := reader.FindEntry(rootLBA, rootSize, "SLUS_006.23")
+	if err != nil {
+		t.Fatalf("FindEntry() failed: %v", err)
+	}
+
+	if err := overlay.WriteFileData(entry.LBA, 0, []byte("NEW")); err != nil {
+		t.Fatalf("WriteFileData() failed: %v", err)
+	}
+	if err := overlay.SetEntrySize(entry, 3); err != nil {
+		t.Fatalf("SetEntrySize() failed: %v", err)
+	}
+	if err := overlay.SetEntrySize(entry, entry.Size+CD_DATA_SIZE); err == nil {
+		t.Error("SetEntrySize() past the extent succeeded, want an error")
+	}
+
+	// Readers over the overlay see the changes, the base image is untouched
+	resized, err := reader.FindEntry(rootLBA, rootSize, "SLUS_006.23")
+	if err != nil {
+		t.Fatalf("FindEntry(resized) failed: %v", err)
+	}
+	if data, err := reader.ReadEntry(resized); err != nil || string(data) != "NEW" {
+		t.Errorf("ReadEntry() = %q, %v; want %q", data, err, "NEW")
+	}
+	if current, _ := os.ReadFile(imagePath); !bytes.Equal(current, original) {
+		t.Error("overlay writes changed the base image")
+	}
+	if got := overlay.ChangedSectors(); got != 2 {
+		t.Errorf("ChangedSectors() = %d, want 2 (file data and directory record)", got)
+	}
+
+	var output bytes.Buffer
+	if n, err := overlay.WriteTo(&output); err != nil || n != int64(len(original)) {
+		t.Fatalf("WriteTo() = %d, %v; want %d bytes", n, err, len(original))
+	}
+	image := output.Bytes()
+	sector := image[int(entry.LBA)*CD_SECTOR_SIZE : int(entry.LBA+1)*CD_SECTOR_SIZE]
+	if got := string(sector[24:27]); got != "NEW" {
+		t.Errorf("written file data = %q, want %q", got, "NEW")
+	}
+	sealed := bytes.Clone(sector)
+	generateMode2Form1EDCECC(sealed)
+	if !bytes.Equal(sector, sealed) {
+		t.Error("written sector has a stale EDC/ECC")
+	}
+	changed := 0
+	for offset := 0; offset < len(image); offset += CD_SECTOR_SIZE {
+		if !bytes.Equal(image[offset:offset+CD_SECTOR_SIZE], original[offset:offset+CD_SECTOR_SIZE]) {
+			changed++
+		}
+	}
+	if changed != 2 {
+		t.Errorf("WriteTo() changed %d sectors, want 2", changed)
+	}
+}
+
+// writeMultiExtentImage creates a Mode 2 image whose root directory at sector 18 holds
+// FRAG.DAT, stored as a full extent at sector 22 followed by a 100-byte extent at 20
+func writeMultiExtentImage(t *testing.T) string {
+	t.Helper()
+
+	const sectors = 24
+	image := make([]byte, sectors*CD_SECTOR_SIZE)
+	sectorData := func(lba int) []byte {
+		raw := image[lba*CD_SECTOR_SIZE : (lba+1)*CD_SECTOR_SIZE]
+		return raw[24 : 24+CD_DATA_SIZE]
+	}
+	for lba := 0; lba < sectors; lba++ {
+		image[lba*CD_SECTOR_SIZE+15] = 2
+	}
+
+	pvd := sectorData(16)
+	copy(pvd, "\x01CD001\x01")
+	writeDirRecord(pvd[156:190], "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+
+	root := sectorData(18)
+	offset := writeDirRecord(root, "\x00", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "\x01", 18, CD_DATA_SIZE, ISO_FLAG_DIRECTORY)
+	offset += writeDirRecord(root[offset:], "FRAG.DAT;1", 22, CD_DATA_SIZE, ISO_FLAG_MULTI_EXTENT)
+	writeDirRecord(root[offset:], "FRAG.DAT;1", 20, 100, 0)
+	copy(sectorData(22), bytes.Repeat([]byte{'A'}, CD_DATA_SIZE))
+	copy(sectorData(20), bytes.Repeat([]byte{'B'}, 100))
+
+	imagePath := filepath.Join(t.TempDir(), "fragments.bin")
+	if err := os.WriteFile(imagePath, image, 0644); err != nil {
+		t.Fatalf("failed to write test image: %v", err)
+	}
+	return imagePath
+}
+
+func TestOverlayImage_MultiExtent(t *testing.T) {
+	base, err := OpenImage(writeMultiExtentImage(t))
+	if err != nil {
+		t.Fatalf("OpenImage() failed: %v", err)
+	}
+	defer base.Close()
+
+	overlay := NewOverlayImage(base)
+	reader := NewCDReaderFromImage(overlay)
+	findEntry := func() CDFileEntry {
+		t.Helper()
+		entry, err := reader.FindEntry(18, CD_DATA_SIZE, "FRAG.DAT")
+		if err != nil {
+			t.Fatalf("FindEntry() failed: %v", err)
+		}
+		return entry
+	}
+	entry := findEntry()
+	if !entry.IsMultiExtent() || entry.Size != CD_DATA_SIZE+100 {
+		t.Fatalf("FRAG.DAT = %d bytes in %d extents, want %d bytes in 2", entry.Size, len(entry.Extents), CD_DATA_SIZE+100)
+	}
+
+	// A write across the end of the first extent continues at the start of the second
+	if err := overlay.WriteEntryData(entry, CD_DATA_SIZE-4, []byte("12345678")); err != nil {
+		t.Fatalf("WriteEntryData() failed: %v", err)
+	}
+	if err := overlay.SetEntrySize(entry, CD_DATA_SIZE+200); err != nil {
+		t.Fatalf("SetEntrySize() failed: %v", err)
+	}
+	resized := findEntry()
+	data, err := reader.ReadEntry(resized)
+	if err != nil {
+		t.Fatalf("ReadEntry() failed: %v", err)
+	}
+	if len(data) != CD_DATA_SIZE+200 || string(data[CD_DATA_SIZE-4:CD_DATA_SIZE+4]) != "12345678" {
+		t.Errorf("ReadEntry() = %d bytes holding %q at the extent boundary, want %d bytes holding %q",
+			len(data), data[CD_DATA_SIZE-4:CD_DATA_SIZE+4], CD_DATA_SIZE+200, "12345678")
+	}
+	if resized.Extents[0].Size != CD_DATA_SIZE || resized.Extents[1].Size != 200 {
+		t.Errorf("extent sizes = %d, %d; want %d, 200", resized.Extents[0].Size, resized.Extents[1].Size, CD_DATA_SIZE)
+	}
+
+	// Shrinking leaves the extents past the end of the data empty
+	if err := overlay.SetEntrySize(resized, 1000); err != nil {
+		t.Fatalf("SetEntrySize(shrink) failed: %v", err)
+	}
+	if shrunk := findEntry(); shrunk.Size != 1000 || shrunk.Extents[1].Size != 0 {
+		t.Errorf("shrunk FRAG.DAT = %d bytes, last extent %d; want 1000 and 0", shrunk.Size, shrunk.Extents[1].Size)
+	}
+
+	if err := overlay.SetEntrySize(entry, 2*CD_DATA_SIZE+1); err == nil {
+		t.Error("SetEntrySize() past the extents succeeded, want an error")
+	}
+	if err := overlay.WriteEntryData(entry, 2*CD_DATA_SIZE-2, []byte("1234")); err == nil {
+		t.Error("WriteEntryData() past the extents succeeded, want an error")
+	}
+}
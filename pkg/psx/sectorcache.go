@@ -0,0 +1,108 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the sector cache of CDReader: a small LRU of stored sectors that
+// serves the directory, path table and descriptor sectors tree walks and FLA linking
+// revisit. File data streamed by extraction bypasses it, so one large file does not
+// evict the sectors worth keeping.
+package psx
+
+import (
+	"bytes"
+	"container/list"
+	"sync/atomic"
+)
+
+// DefaultSectorCacheSize is the number of sectors a CDReader caches by default
+const DefaultSectorCacheSize = 256
+
+// defaultSectorCacheSize is the cache size of new readers (see SetDefaultSectorCacheSize)
+var defaultSectorCacheSize atomic.Int64
+
+func init() {
+	defaultSectorCacheSize.Store(DefaultSectorCacheSize)
+}
+
+// SetDefaultSectorCacheSize sets the number of sectors cached by the CD readers created
+// afterwards (0 or less disables the cache)
+func SetDefaultSectorCacheSize(sectors int) {
+	defaultSectorCacheSize.Store(int64(max(sectors, 0)))
+}
+
+// SectorCacheStats counts the lookups of a sector cache
+type SectorCacheStats struct {
+	Capacity  int   `json:"capacity"`
+	Cached    int   `json:"cached"` // Sectors held
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// HitRate returns the share of lookups served from the cache (0 without lookups)
+func (s SectorCacheStats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// cachedSector is a stored sector held by the cache
+type cachedSector struct {
+	lba  int64
+	data []byte
+}
+
+// sectorCache is a least recently used cache of stored sectors by LBA
+type sectorCache struct {
+	capacity int
+	order    *list.List // Most recently used first
+	sectors  map[int64]*list.Element
+	stats    SectorCacheStats
+}
+
+// newSectorCache creates a cache of up to capacity sectors (nil when capacity is 0 or less)
+func newSectorCache(capacity int) *sectorCache {
+	if capacity <= 0 {
+		return nil
+	}
+	return &sectorCache{
+		capacity: capacity,
+		order:    list.New(),
+		sectors:  make(map[int64]*list.Element, capacity),
+		stats:    SectorCacheStats{Capacity: capacity},
+	}
+}
+
+// get copies the cached sector at lba into buffer and reports whether it was cached
+func (c *sectorCache) get(lba int64, buffer []byte) bool {
+	element, found := c.sectors[lba]
+	if !found {
+		c.stats.Misses++
+		return false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+	copy(buffer, element.Value.(*cachedSector).data)
+	return true
+}
+
+// put stores a copy of the sector at lba, evicting the least recently used sector when full
+func (c *sectorCache) put(lba int64, data []byte) {
+	if element, found := c.sectors[lba]; found {
+		element.Value.(*cachedSector).data = bytes.Clone(data)
+		c.order.MoveToFront(element)
+		return
+	}
+	if c.order.Len() >= c.capacity {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.sectors, oldest.Value.(*cachedSector).lba)
+		c.stats.Evictions++
+	}
+	c.sectors[lba] = c.order.PushFront(&cachedSector{lba: lba, data: bytes.Clone(data)})
+}
+
+// snapshot returns the counters with the number of sectors held
+func (c *sectorCache) snapshot() SectorCacheStats {
+	stats := c.stats
+	stats.Cached = c.order.Len()
+	return stats
+}
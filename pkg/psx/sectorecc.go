@@ -0,0 +1,132 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the EDC and ECC (ECMA-130 P and Q parity) generation of raw sectors,
+// used to rebuild the sectors compressed image formats store without their error
+// correction data.
+package psx
+
+import "encoding/binary"
+
+// Offsets of the error detection and correction fields in a raw sector
+const (
+	sectorEDCMode1Offset = 0x810 // EDC of a Mode 1 sector, after the user data
+	sectorECCPOffset     = 0x81C // P parity bytes
+	sectorECCQOffset     = 0x8C8 // Q parity bytes
+)
+
+// cdSyncPattern is the sync pattern starting every raw sector
+var cdSyncPattern = []byte{0x00, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x00}
+
+// Lookup tables of the EDC polynomial and the ECC Galois field
+var (
+	edcTable  [256]uint32
+	eccFTable [256]byte
+	eccBTable [256]byte
+)
+
+func init() {
+	for i := 0; i < 256; i++ {
+		j := i << 1
+		if i&0x80 != 0 {
+			j ^= 0x11D
+		}
+		eccFTable[i] = byte(j)
+		eccBTable[i^j&0xFF] = byte(i)
+
+		edc := uint32(i)
+		for k := 0; k < 8; k++ {
+			if edc&1 != 0 {
+				edc = edc>>1 ^ 0xD8018001
+			} else {
+				edc >>= 1
+			}
+		}
+		edcTable[i] = edc
+	}
+}
+
+// computeEDC returns the EDC checksum of data
+func computeEDC(data []byte) uint32 {
+	var edc uint32
+	for _, b := range data {
+		edc = edc>>8 ^ edcTable[byte(edc)^b]
+	}
+	return edc
+}
+
+// computeECCBlock computes one set of parity bytes (P or Q) over the header and data of a
+// sector into dest
+func computeECCBlock(src []byte, majorCount, minorCount, majorMult, minorInc int, dest []byte) {
+	size := majorCount * minorCount
+	for major := 0; major < majorCount; major++ {
+		index := (major>>1)*majorMult + major&1
+		var eccA, eccB byte
+		for minor := 0; minor < minorCount; minor++ {
+			value := src[index]
+			index += minorInc
+			if index >= size {
+				index -= size
+			}
+			eccA ^= value
+			eccB ^= value
+			eccA = eccFTable[eccA]
+		}
+		eccA = eccBTable[eccFTable[eccA]^eccB]
+		dest[major] = eccA
+		dest[major+majorCount] = eccA ^ eccB
+	}
+}
+
+// generateECC writes the P and Q parity of a raw sector. Mode 2 sectors compute the parity
+// with the header address zeroed.
+func generateECC(sector []byte, zeroAddress bool) {
+	var header [4]byte
+	if zeroAddress {
+		copy(header[:], sector[CD_SYNC_SIZE:CD_SYNC_SIZE+4])
+		clear(sector[CD_SYNC_SIZE : CD_SYNC_SIZE+4])
+	}
+	computeECCBlock(sector[CD_SYNC_SIZE:], 86, 24, 2, 86, sector[sectorECCPOffset:])
+	computeECCBlock(sector[CD_SYNC_SIZE:], 52, 43, 86, 88, sector[sectorECCQOffset:])
+	if zeroAddress {
+		copy(sector[CD_SYNC_SIZE:CD_SYNC_SIZE+4], header[:])
+	}
+}
+
+// generateMode1EDCECC fills the EDC, the zero padding and the parity of a raw Mode 1 sector
+func generateMode1EDCECC(sector []byte) {
+	binary.LittleEndian.PutUint32(sector[sectorEDCMode1Offset:], computeEDC(sector[:sectorEDCMode1Offset]))
+	clear(sector[sectorEDCMode1Offset+4 : sectorECCPOffset])
+	generateECC(sector, false)
+}
+
+// generateMode2Form1EDCECC fills the EDC and the parity of a raw Mode 2 Form 1 sector
+func generateMode2Form1EDCECC(sector []byte) {
+	const dataEnd = CD_SYNC_SIZE + CD_HEADER_SIZE + CD_SUBHEADER_SIZE + CD_DATA_SIZE
+	binary.LittleEndian.PutUint32(sector[dataEnd:], computeEDC(sector[CD_SYNC_SIZE+CD_HEADER_SIZE:dataEnd]))
+	generateECC(sector, true)
+}
+
+// generateMode2Form2EDC fills the EDC of a raw Mode 2 Form 2 sector
+func generateMode2Form2EDC(sector []byte) {
+	const edcOffset = CD_SECTOR_SIZE - 4
+	binary.LittleEndian.PutUint32(sector[edcOffset:], computeEDC(sector[CD_SYNC_SIZE+CD_HEADER_SIZE:edcOffset]))
+}
+
+// RepairSectorEDC regenerates the EDC and ECC of a raw sector after its user data
+// changed, following the mode byte and, for Mode 2, the form bit of the subheader
+func RepairSectorEDC(sector []byte) {
+	const submodeOffset = CD_SYNC_SIZE + CD_HEADER_SIZE + 2
+	const submodeForm2 = 0x20
+	if len(sector) != CD_SECTOR_SIZE {
+		return
+	}
+	switch sector[CD_MODE_OFFSET] {
+	case 1:
+		generateMode1EDCECC(sector)
+	case 2:
+		if sector[submodeOffset]&submodeForm2 != 0 {
+			generateMode2Form2EDC(sector)
+		} else {
+			generateMode2Form1EDCECC(sector)
+		}
+	}
+}
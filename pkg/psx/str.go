@@ -0,0 +1,113 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the demuxer of STR movies: every video sector starts with a 32-byte
+// header naming its frame and its chunk within the frame, and the chunks of a frame are
+// joined into the MDEC bitstream that DecodeMDECFrame decodes. Audio sectors are plain
+// XA-ADPCM sectors interleaved with the video.
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// STR video sector layout
+const (
+	STR_HEADER_SIZE = 32                             // Header of every video sector
+	STR_CHUNK_SIZE  = CD_DATA_SIZE - STR_HEADER_SIZE // Frame data of a video sector
+	STR_MAX_WIDTH   = 640
+	STR_MAX_HEIGHT  = 480
+)
+
+// strVideoMagic is the status (0x0160) and type (0x8001) starting every video sector
+var strVideoMagic = []byte{0x60, 0x01, 0x01, 0x80}
+
+// STRSectorHeader is the header of an STR video sector
+type STRSectorHeader struct {
+	Chunk     uint16 // Chunk of the frame held by the sector
+	Chunks    uint16 // Chunks of the frame
+	Frame     uint32 // Frame number, starting at 1
+	FrameSize uint32 // Bytes of frame data
+	Width     uint16
+	Height    uint16
+}
+
+// ParseSTRSectorHeader reads the header of a video sector (the 2048 bytes of user data).
+// It reports false for sectors that do not hold video.
+func ParseSTRSectorHeader(data []byte) (STRSectorHeader, bool) {
+	if len(data) < CD_DATA_SIZE || !bytes.HasPrefix(data, strVideoMagic) {
+		return STRSectorHeader{}, false
+	}
+	header := STRSectorHeader{
+		Chunk:     binary.LittleEndian.Uint16(data[4:]),
+		Chunks:    binary.LittleEndian.Uint16(data[6:]),
+		Frame:     binary.LittleEndian.Uint32(data[8:]),
+		FrameSize: binary.LittleEndian.Uint32(data[12:]),
+		Width:     binary.LittleEndian.Uint16(data[16:]),
+		Height:    binary.LittleEndian.Uint16(data[18:]),
+	}
+	if header.Chunks == 0 || header.Chunk >= header.Chunks {
+		return STRSectorHeader{}, false
+	}
+	return header, true
+}
+
+// STRFrame is the demuxed bitstream of a frame
+type STRFrame struct {
+	Number uint32
+	Width  int
+	Height int
+	Data   []byte // MDEC bitstream, frame header included
+}
+
+// STRDemuxer joins the chunks of the video sectors of a movie into frames
+type STRDemuxer struct {
+	header STRSectorHeader // Header of the frame being joined
+	chunks [][]byte
+	joined int
+}
+
+// AddSector adds the user data of a sector and returns the frame it completes, if any.
+// Sectors that do not hold video are ignored. A frame whose chunks stop before it is
+// complete is dropped with a warning.
+func (d *STRDemuxer) AddSector(data []byte) (*STRFrame, error) {
+	header, ok := ParseSTRSectorHeader(data)
+	if !ok {
+		return nil, nil
+	}
+	if header.Width == 0 || header.Height == 0 || header.Width > STR_MAX_WIDTH || header.Height > STR_MAX_HEIGHT {
+		return nil, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("frame %d has an invalid size of %dx%d", header.Frame, header.Width, header.Height))
+	}
+
+	if d.chunks == nil || header.Frame != d.header.Frame || header.Chunks != d.header.Chunks {
+		if d.chunks != nil {
+			common.LogWarn("Frame %d is missing %d of its %d chunks; skipped", d.header.Frame, len(d.chunks)-d.joined, len(d.chunks))
+		}
+		d.header, d.chunks, d.joined = header, make([][]byte, header.Chunks), 0
+	}
+	if d.chunks[header.Chunk] == nil {
+		d.chunks[header.Chunk] = data[STR_HEADER_SIZE:CD_DATA_SIZE]
+		d.joined++
+	}
+	if d.joined < len(d.chunks) {
+		return nil, nil
+	}
+
+	frame := &STRFrame{Number: header.Frame, Width: int(header.Width), Height: int(header.Height), Data: bytes.Join(d.chunks, nil)}
+	if size := int(header.FrameSize); size > 0 && size < len(frame.Data) {
+		frame.Data = frame.Data[:size]
+	}
+	d.chunks = nil
+	return frame, nil
+}
+
+// Flush reports a frame left incomplete at the end of the movie
+func (d *STRDemuxer) Flush() {
+	if d.chunks != nil {
+		common.LogWarn("Frame %d is missing %d of its %d chunks; skipped", d.header.Frame, len(d.chunks)-d.joined, len(d.chunks))
+		d.chunks = nil
+	}
+}
@@ -81,6 +81,15 @@ func (p PSXPalette) GetColor(index uint8) color.RGBA {
 	return p[index].ToRGBA()
 }
 
+// ColorPalette returns the palette as a Go color palette, one entry per palette index
+func (p PSXPalette) ColorPalette() color.Palette {
+	palette := make(color.Palette, MaxPaletteSize4bpp)
+	for i := range p {
+		palette[i] = p[i].ToRGBA()
+	}
+	return palette
+}
+
 // FindClosestColor finds the closest palette index for a given RGBA color
 func (p PSXPalette) FindClosestColor(c color.RGBA) uint8 {
 	targetPSX := PSXColorFromRGBA(c.R, c.G, c.B, c.A)
@@ -219,6 +228,45 @@ func (t *PSXTile) ToImage() *image.RGBA {
 	return img
 }
 
+// ToPaletted converts the PSX tile to an indexed-color image that keeps the 4bpp
+// palette indices instead of expanding every pixel to RGBA. It needs a quarter of the
+// memory of ToImage and At returns the same colors. The palette is cut after the highest
+// index used, so the PNG encoder picks the smallest bit depth (1, 2 or 4 bits per pixel)
+// and writes no unused palette entries.
+func (t *PSXTile) ToPaletted() *image.Paletted {
+	img := image.NewPaletted(image.Rect(0, 0, t.Width, t.Height), nil)
+
+	const noData = 0xFF // Marks pixels beyond the tile data
+	var highest uint8
+	short := false
+	for y := 0; y < t.Height; y++ {
+		for x := 0; x < t.Width; x++ {
+			paletteIndex, err := t.GetPixel(x, y)
+			if err != nil {
+				paletteIndex = noData
+				short = true
+			} else if paletteIndex > highest {
+				highest = paletteIndex
+			}
+			img.Pix[y*img.Stride+x] = paletteIndex
+		}
+	}
+
+	img.Palette = t.Palette.ColorPalette()[:highest+1]
+	if short {
+		// Pixels without data are transparent, as in ToImage
+		transparent := highest + 1
+		img.Palette = append(img.Palette, color.RGBA{})
+		for i, index := range img.Pix {
+			if index == noData {
+				img.Pix[i] = transparent
+			}
+		}
+	}
+
+	return img
+}
+
 // FromImage creates a PSX tile from a standard Go image using the specified palette
 func (t *PSXTile) FromImage(img image.Image) error {
 	bounds := img.Bounds()
@@ -276,3 +324,12 @@ func (p *PSXTileProcessor) ConvertFromTile(tile *PSXTile) (*image.RGBA, error) {
 
 	return tile.ToImage(), nil
 }
+
+// ConvertFromTilePaletted converts a PSX tile to an indexed-color image
+func (p *PSXTileProcessor) ConvertFromTilePaletted(tile *PSXTile) (*image.Paletted, error) {
+	if tile == nil {
+		return nil, fmt.Errorf("tile is nil")
+	}
+
+	return tile.ToPaletted(), nil
+}
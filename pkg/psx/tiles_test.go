@@ -2,8 +2,10 @@
 package psx
 
 import (
+	"bytes"
 	"image"
 	"image/color"
+	"image/png"
 	"testing"
 )
 
@@ -235,3 +237,73 @@ func TestPSXTileProcessor(t *testing.T) {
 		t.Error("ConvertFromTile should fail with nil tile")
 	}
 }
+
+func TestPSXTile_ToPaletted(t *testing.T) {
+	palette := NewPSXPalette([MaxPaletteSize4bpp]uint16{
+		0x0000, 0x001F, 0x03E0, 0x7C00, 0x7FFF,
+		0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000, 0x0000,
+	})
+
+	// 3x2 tile: odd width, so pixels of different rows share a byte
+	tile := &PSXTile{Width: 3, Height: 2, Data: []byte{0x10, 0x32, 0x04}, Palette: palette}
+
+	paletted := tile.ToPaletted()
+	if got := len(paletted.Palette); got != 5 {
+		t.Errorf("palette size = %d, want 5 (cut after the highest index used)", got)
+	}
+	if got := paletted.ColorIndexAt(1, 0); got != 1 {
+		t.Errorf("index at (1, 0) = %d, want 1", got)
+	}
+	assertSameColors(t, paletted, tile.ToImage())
+
+	// The pixel without data gets a transparent entry, as in ToImage
+	short := &PSXTile{Width: 3, Height: 2, Data: []byte{0x44, 0x44}, Palette: palette}
+	paletted = short.ToPaletted()
+	if got := len(paletted.Palette); got != 6 {
+		t.Errorf("palette size of short tile = %d, want 6", got)
+	}
+	assertSameColors(t, paletted, short.ToImage())
+}
+
+func TestPSXTile_ToPalettedPNG(t *testing.T) {
+	palette := NewPSXPalette([MaxPaletteSize4bpp]uint16{0x0000, 0x7FFF, 0x001F, 0x03E0})
+	tile := NewPSXTile(16, 24, palette)
+	for i := range tile.Data {
+		tile.Data[i] = byte(i*7) & 0x33 // Mix of the first four colors
+	}
+
+	var buffer bytes.Buffer
+	if err := png.Encode(&buffer, tile.ToPaletted()); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+
+	// IHDR: bit depth at offset 24, color type at offset 25 (3 = indexed color)
+	header := buffer.Bytes()
+	if header[24] != 2 || header[25] != 3 {
+		t.Errorf("bit depth = %d, color type = %d, want a 2-bit indexed PNG", header[24], header[25])
+	}
+
+	decoded, err := png.Decode(&buffer)
+	if err != nil {
+		t.Fatalf("png.Decode failed: %v", err)
+	}
+	assertSameColors(t, decoded, tile.ToImage())
+}
+
+// assertSameColors fails the test when the two images differ in any pixel
+func assertSameColors(t *testing.T, got, want image.Image) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("bounds = %v, want %v", got.Bounds(), want.Bounds())
+	}
+	bounds := want.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gotColor := color.RGBAModel.Convert(got.At(x, y))
+			wantColor := color.RGBAModel.Convert(want.At(x, y))
+			if gotColor != wantColor {
+				t.Errorf("color at (%d, %d) = %v, want %v", x, y, gotColor, wantColor)
+			}
+		}
+	}
+}
@@ -0,0 +1,379 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the TIM image format: a header, an optional CLUT block and an image
+// block of 4bpp or 8bpp palette indices or 16bpp/24bpp direct colors, each block tagged
+// with the VRAM rectangle it is uploaded to.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// TIM header values
+const (
+	TIM_MAGIC             = 0x10 // First word of every TIM file
+	TIM_HEADER_SIZE       = 8    // Magic and flags
+	TIM_BLOCK_HEADER_SIZE = 12   // Block length, VRAM X/Y and width/height in 16-bit units
+	TIM_FLAG_CLUT         = 0x08 // The flags word announces a CLUT block
+	TIM_MODE_MASK         = 0x07 // Pixel mode bits of the flags word: 0 4bpp, 1 8bpp, 2 16bpp, 3 24bpp
+)
+
+// PSXColorSTP is the semi-transparency bit of a 16-bit color. The GPU draws color 0 as
+// transparent, so opaque black is stored with this bit set.
+const PSXColorSTP = 0x8000
+
+// TIM is a decoded TIM image. The CLUT block is kept as it was read, so files rebuilt
+// with Bytes keep every palette, including the ones the image does not use.
+type TIM struct {
+	BPP        int        // Bits per pixel: 4, 8, 16 or 24
+	ClutX      uint16     // VRAM X of the CLUT block
+	ClutY      uint16     // VRAM Y of the CLUT block
+	ClutWidth  int        // Width of the CLUT block in colors
+	ClutHeight int        // Height of the CLUT block in rows
+	Clut       []PSXColor // Colors of the CLUT block, row after row (nil without a CLUT)
+	X          uint16     // VRAM X of the image block (16-bit units)
+	Y          uint16     // VRAM Y of the image block
+	Width      int        // Width in pixels
+	Height     int        // Height in pixels
+	Data       []byte     // Pixel data, rows of Stride bytes
+}
+
+// timModes maps the pixel mode of the flags word to bits per pixel
+var timModes = map[uint32]int{0: 4, 1: 8, 2: 16, 3: 24}
+
+// timPixelsPerUnit returns how many pixels a 16-bit VRAM unit holds, as a fraction
+func timPixelsPerUnit(bpp int) (num, den int) {
+	if bpp == 24 {
+		return 2, 3
+	}
+	return 16 / bpp, 1
+}
+
+// PaletteSize returns the colors of one CLUT at the bit depth of the image (0 for 16bpp
+// and 24bpp images, which have none)
+func (t *TIM) PaletteSize() int {
+	switch t.BPP {
+	case 4:
+		return MaxPaletteSize4bpp
+	case 8:
+		return 256
+	}
+	return 0
+}
+
+// Palettes returns how many CLUTs the CLUT block holds
+func (t *TIM) Palettes() int {
+	if t.PaletteSize() == 0 {
+		return 0
+	}
+	return len(t.Clut) / t.PaletteSize()
+}
+
+// Palette returns a CLUT of the CLUT block
+func (t *TIM) Palette(index int) ([]PSXColor, error) {
+	if index < 0 || index >= t.Palettes() {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("CLUT %d out of range: the TIM holds %d", index, t.Palettes()))
+	}
+	size := t.PaletteSize()
+	return t.Clut[index*size : (index+1)*size], nil
+}
+
+// Stride returns the bytes of a row of pixel data
+func (t *TIM) Stride() int {
+	num, den := timPixelsPerUnit(t.BPP)
+	return (t.Width*den + num - 1) / num * 2
+}
+
+// ParseTIM reads a TIM file
+func ParseTIM(data []byte) (*TIM, error) {
+	if len(data) < TIM_HEADER_SIZE || binary.LittleEndian.Uint32(data) != TIM_MAGIC {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("not a TIM file: bad magic"))
+	}
+	flags := binary.LittleEndian.Uint32(data[4:])
+	bpp, ok := timModes[flags&TIM_MODE_MASK]
+	if !ok {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("unsupported TIM pixel mode %d", flags&TIM_MODE_MASK))
+	}
+	tim := &TIM{BPP: bpp}
+
+	offset := TIM_HEADER_SIZE
+	if flags&TIM_FLAG_CLUT != 0 {
+		block, x, y, w, h, err := readTIMBlock(data, offset, "CLUT")
+		if err != nil {
+			return nil, err
+		}
+		tim.ClutX, tim.ClutY, tim.ClutWidth, tim.ClutHeight = x, y, w, h
+		tim.Clut = make([]PSXColor, w*h)
+		for i := range tim.Clut {
+			tim.Clut[i] = PSXColor(binary.LittleEndian.Uint16(block[i*2:]))
+		}
+		offset += TIM_BLOCK_HEADER_SIZE + len(block)
+	}
+	if tim.PaletteSize() > 0 && tim.Palettes() == 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("%dbpp TIM without a CLUT of %d colors", bpp, tim.PaletteSize()))
+	}
+
+	block, x, y, w, h, err := readTIMBlock(data, offset, "image")
+	if err != nil {
+		return nil, err
+	}
+	num, den := timPixelsPerUnit(bpp)
+	tim.X, tim.Y = x, y
+	tim.Width, tim.Height = w*num/den, h
+	tim.Data = block
+	return tim, nil
+}
+
+// readTIMBlock reads the header of the block at offset and returns its data and its
+// VRAM rectangle
+func readTIMBlock(data []byte, offset int, name string) (block []byte, x, y uint16, w, h int, err error) {
+	if offset+TIM_BLOCK_HEADER_SIZE > len(data) {
+		return nil, 0, 0, 0, 0, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("TIM %s block header truncated", name))
+	}
+	x = binary.LittleEndian.Uint16(data[offset+4:])
+	y = binary.LittleEndian.Uint16(data[offset+6:])
+	w = int(binary.LittleEndian.Uint16(data[offset+8:]))
+	h = int(binary.LittleEndian.Uint16(data[offset+10:]))
+	if w > VRAM_WIDTH || h > VRAM_HEIGHT {
+		return nil, 0, 0, 0, 0, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("TIM %s block of %dx%d is larger than VRAM", name, w, h))
+	}
+	size := w * h * 2
+	start := offset + TIM_BLOCK_HEADER_SIZE
+	if start+size > len(data) {
+		return nil, 0, 0, 0, 0, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("TIM %s block of %dx%d truncated: %d of %d bytes", name, w, h, len(data)-start, size))
+	}
+	return data[start : start+size], x, y, w, h, nil
+}
+
+// Bytes returns the TIM file
+func (t *TIM) Bytes() []byte {
+	modes := map[int]uint32{4: 0, 8: 1, 16: 2, 24: 3}
+	flags := modes[t.BPP]
+	if t.Clut != nil {
+		flags |= TIM_FLAG_CLUT
+	}
+	data := binary.LittleEndian.AppendUint32(nil, TIM_MAGIC)
+	data = binary.LittleEndian.AppendUint32(data, flags)
+
+	if t.Clut != nil {
+		clut := make([]byte, len(t.Clut)*2)
+		for i, c := range t.Clut {
+			binary.LittleEndian.PutUint16(clut[i*2:], uint16(c))
+		}
+		data = appendTIMBlock(data, t.ClutX, t.ClutY, t.ClutWidth, t.ClutHeight, clut)
+	}
+	return appendTIMBlock(data, t.X, t.Y, t.Stride()/2, t.Height, t.Data)
+}
+
+// appendTIMBlock appends a block with its header
+func appendTIMBlock(data []byte, x, y uint16, w, h int, block []byte) []byte {
+	data = binary.LittleEndian.AppendUint32(data, uint32(TIM_BLOCK_HEADER_SIZE+len(block)))
+	data = binary.LittleEndian.AppendUint16(data, x)
+	data = binary.LittleEndian.AppendUint16(data, y)
+	data = binary.LittleEndian.AppendUint16(data, uint16(w))
+	data = binary.LittleEndian.AppendUint16(data, uint16(h))
+	return append(data, block...)
+}
+
+// ToImage converts the TIM to an image. 4bpp and 8bpp images become indexed-color images
+// holding the palette indices and every color of the selected CLUT, so an edited PNG
+// encodes back to the same indices; 16bpp and 24bpp images become NRGBA images.
+func (t *TIM) ToImage(clut int) (image.Image, error) {
+	rect := image.Rect(0, 0, t.Width, t.Height)
+	stride := t.Stride()
+
+	switch t.BPP {
+	case 4, 8:
+		colors, err := t.Palette(clut)
+		if err != nil {
+			return nil, err
+		}
+		palette := make(color.Palette, len(colors))
+		for i, c := range colors {
+			palette[i] = c.ToRGBA()
+		}
+		img := image.NewPaletted(rect, palette)
+		if t.BPP == 4 {
+			tile := &PSXTile{Width: stride * PixelsPerByte4bpp, Height: t.Height, Data: t.Data}
+			for y := 0; y < t.Height; y++ {
+				for x := 0; x < t.Width; x++ {
+					index, err := tile.GetPixel(x, y)
+					if err != nil {
+						return nil, common.WithCategory(common.ErrCategoryFormat, err)
+					}
+					img.Pix[y*img.Stride+x] = index
+				}
+			}
+		} else {
+			for y := 0; y < t.Height; y++ {
+				copy(img.Pix[y*img.Stride:y*img.Stride+t.Width], t.Data[y*stride:])
+			}
+		}
+		return img, nil
+
+	case 16:
+		img := image.NewNRGBA(rect)
+		for y := 0; y < t.Height; y++ {
+			for x := 0; x < t.Width; x++ {
+				img.Set(x, y, PSXColor(binary.LittleEndian.Uint16(t.Data[y*stride+x*2:])).ToRGBA())
+			}
+		}
+		return img, nil
+
+	default:
+		img := image.NewNRGBA(rect)
+		for y := 0; y < t.Height; y++ {
+			for x := 0; x < t.Width; x++ {
+				pixel := t.Data[y*stride+x*3:]
+				img.SetNRGBA(x, y, color.NRGBA{R: pixel[0], G: pixel[1], B: pixel[2], A: 255})
+			}
+		}
+		return img, nil
+	}
+}
+
+// TIMColor converts a color to a 16-bit TIM color: transparent pixels become color 0 and
+// opaque black gets the semi-transparency bit, so it is not drawn as transparent
+func TIMColor(c color.Color) PSXColor {
+	rgba, _ := color.NRGBAModel.Convert(c).(color.NRGBA)
+	psxColor := PSXColorFromRGBA(rgba.R, rgba.G, rgba.B, rgba.A)
+	if psxColor == 0 && rgba.A != 0 {
+		psxColor = PSXColorSTP
+	}
+	return psxColor
+}
+
+// NewTIM encodes an image as a TIM of 4, 8 or 16 bits per pixel at VRAM position 0,0.
+// 4bpp and 8bpp images are quantized against colors, a CLUT of 16 or 256 colors; without
+// one, the CLUT is built from the colors of the image (in palette order for indexed-color
+// images). An indexed-color image whose palette is the CLUT keeps its indices.
+func NewTIM(img image.Image, bpp int, colors []PSXColor) (*TIM, error) {
+	bounds := img.Bounds()
+	tim := &TIM{BPP: bpp, Width: bounds.Dx(), Height: bounds.Dy()}
+	num, _ := timPixelsPerUnit(bpp)
+	switch {
+	case bpp != 4 && bpp != 8 && bpp != 16:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("unsupported bit depth %d: use 4, 8 or 16", bpp))
+	case tim.Width%num != 0:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("a %dbpp TIM is a whole number of 16-bit units wide: width %d is not a multiple of %d", bpp, tim.Width, num))
+	case tim.Width/num > VRAM_WIDTH || tim.Height > VRAM_HEIGHT:
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("image of %dx%d does not fit in VRAM", tim.Width, tim.Height))
+	}
+	stride := tim.Stride()
+	tim.Data = make([]byte, stride*tim.Height)
+
+	if bpp == 16 {
+		for y := 0; y < tim.Height; y++ {
+			for x := 0; x < tim.Width; x++ {
+				binary.LittleEndian.PutUint16(tim.Data[y*stride+x*2:], uint16(TIMColor(img.At(bounds.Min.X+x, bounds.Min.Y+y))))
+			}
+		}
+		return tim, nil
+	}
+
+	size := MaxPaletteSize4bpp
+	if bpp == 8 {
+		size = 256
+	}
+	if colors == nil {
+		var err error
+		if colors, err = timImagePalette(img, size); err != nil {
+			return nil, err
+		}
+	}
+	if len(colors) != size {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("a %dbpp CLUT holds %d colors, not %d", bpp, size, len(colors)))
+	}
+	tim.ClutWidth, tim.ClutHeight = size, 1
+	tim.Clut = append([]PSXColor(nil), colors...)
+
+	indices := timPaletteIndices(img, colors)
+	tile := &PSXTile{Width: stride * PixelsPerByte4bpp, Height: tim.Height, Data: tim.Data}
+	for y := 0; y < tim.Height; y++ {
+		for x := 0; x < tim.Width; x++ {
+			index := indices(x, y)
+			if bpp == 8 {
+				tim.Data[y*stride+x] = index
+			} else if err := tile.SetPixel(x, y, index); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return tim, nil
+}
+
+// timImagePalette builds a CLUT from the colors of an image: the palette of an
+// indexed-color image, otherwise its distinct colors in the order they appear
+func timImagePalette(img image.Image, size int) ([]PSXColor, error) {
+	colors := make([]PSXColor, 0, size)
+	if paletted, ok := img.(*image.Paletted); ok && len(paletted.Palette) <= size {
+		for _, c := range paletted.Palette {
+			colors = append(colors, TIMColor(c))
+		}
+	} else {
+		seen := make(map[PSXColor]bool)
+		bounds := img.Bounds()
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				c := TIMColor(img.At(x, y))
+				if seen[c] {
+					continue
+				}
+				if len(colors) == size {
+					return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+						fmt.Errorf("the image has more than %d colors; reduce its colors or give a CLUT", size))
+				}
+				seen[c] = true
+				colors = append(colors, c)
+			}
+		}
+	}
+	return append(colors, make([]PSXColor, size-len(colors))...), nil
+}
+
+// timPaletteIndices returns the palette index of each pixel: the pixel's own index when
+// the image is indexed-color with the CLUT as its palette, otherwise the closest color
+// of the CLUT. Opaque pixels only map to transparent entries when nothing else is left.
+func timPaletteIndices(img image.Image, colors []PSXColor) func(x, y int) uint8 {
+	bounds := img.Bounds()
+	if paletted, ok := img.(*image.Paletted); ok && len(paletted.Palette) <= len(colors) {
+		same := true
+		for i, c := range paletted.Palette {
+			same = same && TIMColor(c) == colors[i]
+		}
+		if same {
+			return func(x, y int) uint8 { return paletted.ColorIndexAt(bounds.Min.X+x, bounds.Min.Y+y) }
+		}
+	}
+
+	cache := make(map[PSXColor]uint8)
+	return func(x, y int) uint8 {
+		target := TIMColor(img.At(bounds.Min.X+x, bounds.Min.Y+y))
+		if index, ok := cache[target]; ok {
+			return index
+		}
+		best, bestDistance := -1, uint32(0)
+		for i, c := range colors {
+			if (c == 0) != (target == 0) {
+				continue
+			}
+			if distance := colorDistance(target, c); best < 0 || distance < bestDistance {
+				best, bestDistance = i, distance
+			}
+		}
+		if best < 0 {
+			best = 0
+		}
+		cache[target] = uint8(best)
+		return uint8(best)
+	}
+}
@@ -0,0 +1,125 @@
+// Package psx provides tests for the TIM image format
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// timTestFile returns a 4bpp 4x2 TIM with two CLUTs of 16 colors, whose pixels hold the
+// indices 0 to 7
+func timTestFile() []byte {
+	data := binary.LittleEndian.AppendUint32(nil, TIM_MAGIC)
+	data = binary.LittleEndian.AppendUint32(data, TIM_FLAG_CLUT)
+	clut := make([]byte, 2*MaxPaletteSize4bpp*2)
+	for i := 1; i < 2*MaxPaletteSize4bpp; i++ {
+		binary.LittleEndian.PutUint16(clut[i*2:], uint16(i)) // Shades of red
+	}
+	data = appendTIMBlock(data, 0, 480, MaxPaletteSize4bpp, 2, clut)
+	return appendTIMBlock(data, 640, 0, 1, 2, []byte{0x10, 0x32, 0x54, 0x76})
+}
+
+func TestParseTIM(t *testing.T) {
+	data := timTestFile()
+	tim, err := ParseTIM(data)
+	if err != nil {
+		t.Fatalf("ParseTIM() failed: %v", err)
+	}
+	if tim.BPP != 4 || tim.Width != 4 || tim.Height != 2 || tim.X != 640 || tim.ClutY != 480 || tim.Palettes() != 2 {
+		t.Errorf("TIM = %dbpp %dx%d at %d, CLUT at %d, %d palettes; want 4bpp 4x2 at 640, CLUT at 480, 2 palettes",
+			tim.BPP, tim.Width, tim.Height, tim.X, tim.ClutY, tim.Palettes())
+	}
+	if !bytes.Equal(tim.Bytes(), data) {
+		t.Error("Bytes() does not rebuild the parsed file")
+	}
+
+	img, err := tim.ToImage(1)
+	if err != nil {
+		t.Fatalf("ToImage(1) failed: %v", err)
+	}
+	paletted, ok := img.(*image.Paletted)
+	if !ok || len(paletted.Palette) != MaxPaletteSize4bpp {
+		t.Fatalf("ToImage() = %T, want an indexed-color image with 16 colors", img)
+	}
+	if index := paletted.ColorIndexAt(3, 1); index != 7 {
+		t.Errorf("pixel 3,1 index = %d, want 7", index)
+	}
+	if got := paletted.At(3, 1); got != PSXColor(16+7).ToRGBA() {
+		t.Errorf("pixel 3,1 = %v, want color 7 of CLUT 1", got)
+	}
+	if _, err := tim.ToImage(2); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("ToImage(2) error = %v, want a validation error", err)
+	}
+
+	for name, invalid := range map[string][]byte{
+		"magic":     {0x11, 0, 0, 0, 0, 0, 0, 0},
+		"truncated": data[:len(data)-1],
+		"no CLUT":   appendTIMBlock(binary.LittleEndian.AppendUint64(nil, TIM_MAGIC), 0, 0, 1, 1, []byte{0, 0}),
+	} {
+		if _, err := ParseTIM(invalid); common.ExitCodeFor(err) != common.ExitFormatError {
+			t.Errorf("%s: ParseTIM() error = %v, want a format error", name, err)
+		}
+	}
+}
+
+func TestNewTIM(t *testing.T) {
+	red := color.NRGBA{R: 255, A: 255}
+	black := color.NRGBA{A: 255}
+	img := image.NewNRGBA(image.Rect(0, 0, 4, 1))
+	img.SetNRGBA(1, 0, red)
+	img.SetNRGBA(2, 0, black)
+	img.SetNRGBA(3, 0, red)
+
+	// The CLUT is built from the colors of the image in the order they appear
+	tim, err := NewTIM(img, 4, nil)
+	if err != nil {
+		t.Fatalf("NewTIM(4) failed: %v", err)
+	}
+	if tim.Clut[0] != 0 || tim.Clut[1] != 0x1F || tim.Clut[2] != PSXColorSTP || len(tim.Clut) != MaxPaletteSize4bpp {
+		t.Errorf("CLUT = %04X, want transparent, red and opaque black", tim.Clut)
+	}
+	if !bytes.Equal(tim.Data, []byte{0x10, 0x12}) {
+		t.Errorf("4bpp data = % X, want 10 12", tim.Data)
+	}
+
+	// Quantized against a given CLUT, opaque pixels skip the transparent entries
+	colors := make([]PSXColor, 256)
+	colors[5], colors[9] = 0x001C, PSXColorSTP
+	if tim, err = NewTIM(img, 8, colors); err != nil {
+		t.Fatalf("NewTIM(8) failed: %v", err)
+	}
+	if !bytes.Equal(tim.Data, []byte{0, 5, 9, 5}) {
+		t.Errorf("8bpp data = % X, want 00 05 09 05", tim.Data)
+	}
+
+	if tim, err = NewTIM(img, 16, nil); err != nil {
+		t.Fatalf("NewTIM(16) failed: %v", err)
+	}
+	decoded, err := ParseTIM(tim.Bytes())
+	if err != nil {
+		t.Fatalf("ParseTIM(16bpp) failed: %v", err)
+	}
+	rgba, _ := decoded.ToImage(0)
+	if got := color.NRGBAModel.Convert(rgba.At(2, 0)); got != black {
+		t.Errorf("16bpp black = %v, want opaque black", got)
+	}
+	if decoded.Clut != nil {
+		t.Error("16bpp TIM has a CLUT")
+	}
+
+	if _, err := NewTIM(image.NewNRGBA(image.Rect(0, 0, 3, 1)), 4, nil); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("NewTIM(3 pixels wide) error = %v, want a validation error", err)
+	}
+	noisy := image.NewNRGBA(image.Rect(0, 0, 20, 1))
+	for x := 0; x < 20; x++ {
+		noisy.SetNRGBA(x, 0, color.NRGBA{R: uint8(x * 8), A: 255})
+	}
+	if _, err := NewTIM(noisy, 4, nil); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("NewTIM(20 colors) error = %v, want a validation error", err)
+	}
+}
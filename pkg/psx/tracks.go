@@ -0,0 +1,374 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the tracks of multi-track discs: the CUE sheet parser (single-file and
+// one-file-per-track images), the track list of a CDReader and the export of CD-DA audio
+// tracks as WAV files. The ISO9660 file system is always read from the first (data) track.
+package psx
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// TrackTypeAudio is the CUE track type of CD-DA audio tracks
+const TrackTypeAudio = "AUDIO"
+
+// CD-DA audio is 44.1 kHz 16-bit little endian stereo PCM
+const (
+	audioSampleRate = 44100
+	audioChannels   = 2
+)
+
+// cueTrackSectorSizes maps the CUE track types to the size of their stored sectors
+var cueTrackSectorSizes = map[string]int{
+	TrackTypeAudio: CD_SECTOR_SIZE,
+	"MODE1/2352":   CD_SECTOR_SIZE,
+	"MODE2/2352":   CD_SECTOR_SIZE,
+	"MODE2/2336":   CD_XA_DATA_SIZE,
+	"MODE1/2048":   CD_DATA_SIZE,
+}
+
+// Track is a track of a disc image
+type Track struct {
+	Number     int    `json:"number"`
+	Type       string `json:"type"`        // CUE track type (MODE2/2352, AUDIO...)
+	File       string `json:"file"`        // Image file holding the track
+	FileOffset int64  `json:"file_offset"` // Byte offset of INDEX 01 in File
+	SectorSize int    `json:"sector_size"`
+	LBA        int64  `json:"lba"`     // Disc LBA of INDEX 01 (the data track starts at 0)
+	Pregap     int64  `json:"pregap"`  // Sectors before INDEX 01 (INDEX 00 and PREGAP)
+	Sectors    int64  `json:"sectors"` // Sectors from INDEX 01 to the next track
+}
+
+// IsAudio reports whether the track holds CD-DA audio
+func (t Track) IsAudio() bool {
+	return t.Type == TrackTypeAudio
+}
+
+// MSF returns the disc position of INDEX 01 in MM:SS:FF notation
+func (t Track) MSF() string {
+	return LBAToMSF(uint32(t.LBA))
+}
+
+// CueSheet is a parsed CUE sheet
+type CueSheet struct {
+	Path   string
+	Tracks []Track
+}
+
+// cueFile collects the tracks of a FILE entry until its size is known
+type cueFile struct {
+	path   string
+	tracks []cueTrack
+}
+
+// cueTrack is a track as listed by the sheet, with positions in sectors of its file
+type cueTrack struct {
+	number        int
+	trackType     string
+	index0        int64 // INDEX 00 (-1 without)
+	index1        int64 // INDEX 01 (-1 without)
+	virtualPregap int64 // PREGAP sectors, not stored in the file
+}
+
+// ParseCueSheet reads a CUE sheet and the sizes of the image files it references, which
+// are resolved relative to the sheet
+func ParseCueSheet(path string) (*CueSheet, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open CUE sheet: %w", err))
+	}
+	defer file.Close()
+
+	sheet, err := parseCueSheet(file, filepath.Dir(path), func(name string) (int64, error) {
+		info, err := os.Stat(name)
+		if err != nil {
+			return 0, common.WithCategory(common.ErrCategoryInputNotFound, err)
+		}
+		return info.Size(), nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	sheet.Path = path
+	return sheet, nil
+}
+
+// parseCueSheet parses the FILE, TRACK, INDEX and PREGAP commands of a CUE sheet; fileSize
+// returns the size of a referenced image file
+func parseCueSheet(reader io.Reader, dir string, fileSize func(string) (int64, error)) (*CueSheet, error) {
+	invalid := func(line int, format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("line %d: %s", line, fmt.Sprintf(format, args...)))
+	}
+
+	var files []*cueFile
+	var current *cueTrack
+	lastNumber := 0
+	scanner := bufio.NewScanner(reader)
+	for line := 1; scanner.Scan(); line++ {
+		fields := cueFields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch strings.ToUpper(fields[0]) {
+		case "FILE":
+			if len(fields) < 2 {
+				return nil, invalid(line, "FILE without a file name")
+			}
+			name := fields[1]
+			if !filepath.IsAbs(name) {
+				name = filepath.Join(dir, name)
+			}
+			files = append(files, &cueFile{path: name})
+			current = nil
+		case "TRACK":
+			if len(files) == 0 {
+				return nil, invalid(line, "TRACK before FILE")
+			}
+			if len(fields) < 3 {
+				return nil, invalid(line, "TRACK needs a number and a type")
+			}
+			number, err := strconv.Atoi(fields[1])
+			if err != nil || number <= lastNumber {
+				return nil, invalid(line, "track number %q must follow %d", fields[1], lastNumber)
+			}
+			trackType := strings.ToUpper(fields[2])
+			if _, supported := cueTrackSectorSizes[trackType]; !supported {
+				return nil, invalid(line, "unsupported track type %s", fields[2])
+			}
+			lastNumber = number
+			owner := files[len(files)-1]
+			owner.tracks = append(owner.tracks, cueTrack{number: number, trackType: trackType, index0: -1, index1: -1})
+			current = &owner.tracks[len(owner.tracks)-1]
+		case "INDEX":
+			if current == nil || len(fields) < 3 {
+				return nil, invalid(line, "INDEX needs a track, a number and a position")
+			}
+			position, err := parseCueMSF(fields[2])
+			if err != nil {
+				return nil, invalid(line, "%v", err)
+			}
+			switch fields[1] {
+			case "00", "0":
+				current.index0 = position
+			case "01", "1":
+				current.index1 = position
+			}
+		case "PREGAP":
+			if current == nil || len(fields) < 2 {
+				return nil, invalid(line, "PREGAP needs a track and a length")
+			}
+			length, err := parseCueMSF(fields[1])
+			if err != nil {
+				return nil, invalid(line, "%v", err)
+			}
+			current.virtualPregap = length
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read CUE sheet: %w", err)
+	}
+
+	sheet := &CueSheet{}
+	var discBase int64 // Disc LBA of the start of the current file
+	for _, file := range files {
+		if len(file.tracks) == 0 {
+			continue
+		}
+		size, err := fileSize(file.path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read track file: %w", err)
+		}
+		sectorSize := cueTrackSectorSizes[file.tracks[0].trackType]
+		fileSectors := size / int64(sectorSize)
+
+		for i, track := range file.tracks {
+			if track.index1 < 0 {
+				return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("track %02d has no INDEX 01", track.number))
+			}
+			end := fileSectors
+			if i+1 < len(file.tracks) {
+				next := file.tracks[i+1]
+				end = next.index1
+				if next.index0 >= 0 {
+					end = next.index0
+				}
+			}
+			if end < track.index1 {
+				return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("track %02d starts past the end of %s", track.number, filepath.Base(file.path)))
+			}
+
+			pregap := track.virtualPregap
+			if track.index0 >= 0 {
+				pregap += track.index1 - track.index0
+			}
+			discBase += track.virtualPregap
+			sheet.Tracks = append(sheet.Tracks, Track{
+				Number:     track.number,
+				Type:       track.trackType,
+				File:       file.path,
+				FileOffset: track.index1 * int64(sectorSize),
+				SectorSize: sectorSize,
+				LBA:        discBase + track.index1,
+				Pregap:     pregap,
+				Sectors:    end - track.index1,
+			})
+		}
+		discBase += fileSectors
+	}
+	if len(sheet.Tracks) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("CUE sheet lists no tracks"))
+	}
+	return sheet, nil
+}
+
+// cueFields splits a CUE sheet line into fields; double quotes group words
+func cueFields(line string) []string {
+	var fields []string
+	var field strings.Builder
+	quoted, started := false, false
+	for _, r := range strings.TrimSpace(line) {
+		switch {
+		case r == '"':
+			quoted, started = !quoted, true
+		case (r == ' ' || r == '\t') && !quoted:
+			if started {
+				fields = append(fields, field.String())
+				field.Reset()
+				started = false
+			}
+		default:
+			field.WriteRune(r)
+			started = true
+		}
+	}
+	if started {
+		fields = append(fields, field.String())
+	}
+	return fields
+}
+
+// parseCueMSF parses an MM:SS:FF position of a CUE sheet into sectors
+func parseCueMSF(value string) (int64, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("invalid position %q: want MM:SS:FF", value)
+	}
+	var msf [3]uint32
+	for i, part := range parts {
+		number, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid position %q: want MM:SS:FF", value)
+		}
+		msf[i] = uint32(number)
+	}
+	if msf[1] >= CD_SECONDS_PER_MINUTE || msf[2] >= CD_FRAMES_PER_SECOND {
+		return 0, fmt.Errorf("invalid position %q: seconds or frames out of range", value)
+	}
+	return int64(MSFToSectors(msf[0], msf[1], msf[2])), nil
+}
+
+// openCueSheet opens the data track of a CUE sheet. The ISO9660 file system lives in the
+// first track, which must start its file.
+func openCueSheet(path string) (*CDReader, error) {
+	sheet, err := ParseCueSheet(path)
+	if err != nil {
+		return nil, err
+	}
+	first := sheet.Tracks[0]
+	if first.IsAudio() {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("%s: the first track is audio, not a data track", path))
+	}
+	if first.FileOffset != 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("%s: the data track does not start its file", path))
+	}
+
+	image, err := OpenImage(first.File)
+	if err != nil {
+		return nil, err
+	}
+	reader := NewCDReaderFromImage(image)
+	reader.path = first.File
+	reader.tracks = sheet.Tracks
+	return reader, nil
+}
+
+// attachCueSheet attaches the tracks of the CUE sheet next to the image (same name, .cue
+// extension), when the sheet starts with that image
+func (r *CDReader) attachCueSheet() {
+	cuePath := strings.TrimSuffix(r.path, filepath.Ext(r.path)) + ".cue"
+	if _, err := os.Stat(cuePath); err != nil {
+		return
+	}
+	sheet, err := ParseCueSheet(cuePath)
+	if err != nil {
+		common.LogDebug("Ignoring CUE sheet %s: %v", cuePath, err)
+		return
+	}
+	imagePath, err1 := filepath.Abs(r.path)
+	trackPath, err2 := filepath.Abs(sheet.Tracks[0].File)
+	if err1 != nil || err2 != nil || imagePath != trackPath || sheet.Tracks[0].IsAudio() {
+		common.LogDebug("Ignoring CUE sheet %s: it does not start with %s", cuePath, r.path)
+		return
+	}
+	r.tracks = sheet.Tracks
+}
+
+// Tracks returns the tracks of the disc: those of its CUE sheet, or the single data track
+// of an image without one
+func (r *CDReader) Tracks() []Track {
+	if r.tracks != nil {
+		return append([]Track(nil), r.tracks...)
+	}
+	return []Track{{
+		Number:     1,
+		Type:       r.geometry.Name,
+		File:       r.path,
+		SectorSize: r.geometry.SectorSize,
+		Sectors:    r.totalSectors,
+	}}
+}
+
+// WriteTrackWAV writes a CD-DA audio track as a 44.1 kHz 16-bit stereo WAV file
+func (r *CDReader) WriteTrackWAV(number int, writer io.Writer) error {
+	var track *Track
+	for i := range r.tracks {
+		if r.tracks[i].Number == number {
+			track = &r.tracks[i]
+		}
+	}
+	if track == nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("track %02d not found", number))
+	}
+	if !track.IsAudio() {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("track %02d is a %s track, not audio", number, track.Type))
+	}
+
+	image, err := OpenImage(track.File)
+	if err != nil {
+		return fmt.Errorf("failed to open track %02d: %w", number, err)
+	}
+	defer image.Close()
+
+	dataSize, err := common.SafeInt64ToUint32(track.Sectors * CD_SECTOR_SIZE)
+	if err != nil {
+		return fmt.Errorf("track %02d too large for WAV: %w", number, err)
+	}
+	if err := writeWAVHeader(writer, audioSampleRate, audioChannels, dataSize); err != nil {
+		return err
+	}
+
+	// Raw CD-DA sectors already hold little endian PCM frames
+	section := io.NewSectionReader(image, track.FileOffset, int64(dataSize))
+	if _, err := io.CopyBuffer(writer, section, make([]byte, 64*CD_SECTOR_SIZE)); err != nil {
+		return fmt.Errorf("failed to write track %02d: %w", number, err)
+	}
+	return nil
+}
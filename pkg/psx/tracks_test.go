@@ -0,0 +1,125 @@
+// Package psx provides tests for CUE sheets and multi-track images
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestParseCueSheet(t *testing.T) {
+	sizes := map[string]int64{
+		"game.bin":    1000 * CD_SECTOR_SIZE,
+		"track03.bin": 300 * CD_SECTOR_SIZE,
+	}
+	fileSize := func(name string) (int64, error) { return sizes[filepath.Base(name)], nil }
+
+	// Tracks 1 and 2 share a file, track 3 has its own with a PREGAP not stored in it
+	sheet := `FILE "game.bin" BINARY
+  TRACK 01 MODE2/2352
+    INDEX 01 00:00:00
+  TRACK 02 AUDIO
+    INDEX 00 00:10:00
+    INDEX 01 00:12:00
+FILE "track03.bin" BINARY
+  TRACK 03 AUDIO
+    PREGAP 00:02:00
+    INDEX 01 00:00:00
+`
+	parsed, err := parseCueSheet(strings.NewReader(sheet), "disc", fileSize)
+	if err != nil {
+		t.Fatalf("parseCueSheet() failed: %v", err)
+	}
+
+	want := []Track{
+		{Number: 1, Type: "MODE2/2352", File: filepath.Join("disc", "game.bin"), SectorSize: CD_SECTOR_SIZE, Sectors: 750},
+		{Number: 2, Type: TrackTypeAudio, File: filepath.Join("disc", "game.bin"), FileOffset: 900 * CD_SECTOR_SIZE,
+			SectorSize: CD_SECTOR_SIZE, LBA: 900, Pregap: 150, Sectors: 100},
+		{Number: 3, Type: TrackTypeAudio, File: filepath.Join("disc", "track03.bin"), SectorSize: CD_SECTOR_SIZE,
+			LBA: 1150, Pregap: 150, Sectors: 300},
+	}
+	if len(parsed.Tracks) != len(want) {
+		t.Fatalf("Tracks = %+v, want %+v", parsed.Tracks, want)
+	}
+	for i := range want {
+		if parsed.Tracks[i] != want[i] {
+			t.Errorf("Tracks[%d] = %+v, want %+v", i, parsed.Tracks[i], want[i])
+		}
+	}
+	if msf := parsed.Tracks[1].MSF(); msf != "00:14:00" {
+		t.Errorf("track 2 MSF = %s, want 00:14:00", msf)
+	}
+
+	for name, invalid := range map[string]string{
+		"no file":     "TRACK 01 MODE2/2352\n",
+		"no index 01": "FILE \"game.bin\" BINARY\nTRACK 01 MODE2/2352\n",
+		"bad type":    "FILE \"game.bin\" BINARY\nTRACK 01 CDG\nINDEX 01 00:00:00\n",
+		"bad msf":     "FILE \"game.bin\" BINARY\nTRACK 01 MODE2/2352\nINDEX 01 00:75:00\n",
+		"order":       "FILE \"game.bin\" BINARY\nTRACK 02 AUDIO\nINDEX 01 00:00:00\nTRACK 01 AUDIO\nINDEX 01 00:01:00\n",
+		"empty":       "REM nothing\n",
+	} {
+		_, err := parseCueSheet(strings.NewReader(invalid), "disc", fileSize)
+		if common.ExitCodeFor(err) != common.ExitFormatError {
+			t.Errorf("parseCueSheet(%s) error = %v, want a format error", name, err)
+		}
+	}
+}
+
+func TestCDReader_CueSheetTracks(t *testing.T) {
+	const license = "          Licensed  by          Sony Computer Entertainment Amer  ica "
+	imagePath := writeBootImage(t, bootImageOptions{license, "BOOT = cdrom:\\SLUS_006.23;1\r\n", "SLUS_006.23", "North America area"})
+	dir := filepath.Dir(imagePath)
+
+	audio := make([]byte, 2*CD_SECTOR_SIZE)
+	for i := range audio {
+		audio[i] = byte(i)
+	}
+	audioPath := filepath.Join(dir, "audio.bin")
+	if err := os.WriteFile(audioPath, audio, 0644); err != nil {
+		t.Fatalf("failed to write audio track: %v", err)
+	}
+	sheet := "FILE \"" + filepath.Base(imagePath) + "\" BINARY\n  TRACK 01 MODE2/2352\n    INDEX 01 00:00:00\n" +
+		"FILE \"audio.bin\" BINARY\n  TRACK 02 AUDIO\n    INDEX 00 00:00:00\n    INDEX 01 00:00:01\n"
+	cuePath := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".cue"
+	if err := os.WriteFile(cuePath, []byte(sheet), 0644); err != nil {
+		t.Fatalf("failed to write CUE sheet: %v", err)
+	}
+
+	// The sheet is opened directly and found next to the image
+	for _, path := range []string{cuePath, imagePath} {
+		reader, err := NewCDReader(path)
+		if err != nil {
+			t.Fatalf("NewCDReader(%s) failed: %v", path, err)
+		}
+		defer reader.Close()
+		if err := reader.ValidateISO9660(); err != nil {
+			t.Errorf("%s: data track is not readable: %v", path, err)
+		}
+		tracks := reader.Tracks()
+		if len(tracks) != 2 || tracks[1].LBA != 25 || tracks[1].Sectors != 1 || !tracks[1].IsAudio() {
+			t.Fatalf("%s: Tracks() = %+v, want the data track and one audio sector at LBA 25", path, tracks)
+		}
+
+		var wav bytes.Buffer
+		if err := reader.WriteTrackWAV(2, &wav); err != nil {
+			t.Fatalf("WriteTrackWAV() failed: %v", err)
+		}
+		header := wav.Bytes()[:44]
+		if string(header[:4]) != "RIFF" || string(header[8:16]) != "WAVEfmt " || binary.LittleEndian.Uint32(header[24:]) != 44100 ||
+			binary.LittleEndian.Uint32(header[40:]) != CD_SECTOR_SIZE {
+			t.Errorf("WAV header = % X, want 44.1 kHz PCM with one sector of samples", header)
+		}
+		// INDEX 00 is the pregap; the samples start at INDEX 01
+		if !bytes.Equal(wav.Bytes()[44:], audio[CD_SECTOR_SIZE:]) {
+			t.Error("WAV samples differ from the sectors after INDEX 01")
+		}
+		if err := reader.WriteTrackWAV(1, &wav); common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("WriteTrackWAV(data track) error = %v, want a validation error", err)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the VRAM layout used to read color lookup tables from
+// emulator VRAM dumps.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// VRAM dimensions: 1024x512 16-bit pixels
+const (
+	VRAM_WIDTH  = 1024
+	VRAM_HEIGHT = 512
+	VRAM_SIZE   = VRAM_WIDTH * VRAM_HEIGHT * 2 // Size of a raw VRAM dump in bytes
+)
+
+// ClutPosition returns the VRAM coordinates of a CLUT attribute as used by the GPU:
+// bits 0-5 hold X/16 and bits 6-14 hold Y
+func ClutPosition(clut uint16) (x, y int) {
+	return int(clut&0x3F) * 16, int(clut>>6) & 0x1FF
+}
+
+// ReadVRAMClut reads the 16 colors of a 4bpp CLUT from a raw little endian VRAM dump
+func ReadVRAMClut(vram []byte, clut uint16) ([MaxPaletteSize4bpp]uint16, error) {
+	var colors [MaxPaletteSize4bpp]uint16
+	if len(vram) != VRAM_SIZE {
+		return colors, fmt.Errorf("VRAM dump is %d bytes, want %d (raw 1024x512 16-bit)", len(vram), VRAM_SIZE)
+	}
+
+	x, y := ClutPosition(clut)
+	if y >= VRAM_HEIGHT {
+		return colors, fmt.Errorf("CLUT 0x%04X points outside VRAM (y=%d)", clut, y)
+	}
+
+	offset := (y*VRAM_WIDTH + x) * 2
+	for i := range colors {
+		colors[i] = binary.LittleEndian.Uint16(vram[offset+i*2:])
+	}
+	return colors, nil
+}
@@ -0,0 +1,46 @@
+// Package psx provides tests for VRAM CLUT access.
+package psx
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestClutPosition(t *testing.T) {
+	tests := []struct {
+		clut  uint16
+		wantX int
+		wantY int
+	}{
+		{0x0000, 0, 0},
+		{0x7F3C, 960, 508},
+		{0x0041, 16, 1},
+	}
+
+	for _, tt := range tests {
+		x, y := ClutPosition(tt.clut)
+		if x != tt.wantX || y != tt.wantY {
+			t.Errorf("ClutPosition(0x%04X) = (%d, %d), want (%d, %d)", tt.clut, x, y, tt.wantX, tt.wantY)
+		}
+	}
+}
+
+func TestReadVRAMClut(t *testing.T) {
+	vram := make([]byte, VRAM_SIZE)
+	offset := (508*VRAM_WIDTH + 960) * 2
+	for i := 0; i < MaxPaletteSize4bpp; i++ {
+		binary.LittleEndian.PutUint16(vram[offset+i*2:], uint16(0x1000+i))
+	}
+
+	colors, err := ReadVRAMClut(vram, 0x7F3C)
+	if err != nil {
+		t.Fatalf("ReadVRAMClut() failed: %v", err)
+	}
+	if colors[0] != 0x1000 || colors[15] != 0x100F {
+		t.Errorf("ReadVRAMClut() = %04X, want 1000..100F", colors)
+	}
+
+	if _, err := ReadVRAMClut(vram[:1024], 0x7F3C); err == nil {
+		t.Error("ReadVRAMClut() accepted a truncated dump")
+	}
+}
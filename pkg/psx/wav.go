@@ -0,0 +1,127 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains the 16-bit PCM WAV files the audio of a disc is exported to and
+// imported from: CD-DA tracks and decoded XA-ADPCM streams.
+package psx
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// wavBitsPerSample is the sample size of the WAV files written and read (16-bit PCM)
+const wavBitsPerSample = 16
+
+// WAVAudio is 16-bit PCM audio with the samples of the channels interleaved
+type WAVAudio struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+// Frames returns the number of samples per channel
+func (a *WAVAudio) Frames() int {
+	if a.Channels == 0 {
+		return 0
+	}
+	return len(a.Samples) / a.Channels
+}
+
+// WriteWAV writes audio as a 16-bit PCM WAV file
+func WriteWAV(writer io.Writer, audio *WAVAudio) error {
+	dataSize, err := common.SafeIntToUint32(2 * len(audio.Samples))
+	if err != nil {
+		return fmt.Errorf("audio too large for WAV: %w", err)
+	}
+	if err := writeWAVHeader(writer, audio.SampleRate, audio.Channels, dataSize); err != nil {
+		return err
+	}
+
+	data := make([]byte, 0, dataSize)
+	for _, sample := range audio.Samples {
+		data = binary.LittleEndian.AppendUint16(data, uint16(sample))
+	}
+	if _, err := writer.Write(data); err != nil {
+		return fmt.Errorf("failed to write WAV samples: %w", err)
+	}
+	return nil
+}
+
+// writeWAVHeader writes the RIFF header of a 16-bit PCM WAV file holding dataSize bytes
+// of samples
+func writeWAVHeader(writer io.Writer, sampleRate, channels int, dataSize uint32) error {
+	blockAlign := channels * wavBitsPerSample / 8
+	header := make([]byte, 0, 44)
+	header = append(header, "RIFF"...)
+	header = binary.LittleEndian.AppendUint32(header, 36+dataSize)
+	header = append(header, "WAVEfmt "...)
+	header = binary.LittleEndian.AppendUint32(header, 16)
+	header = binary.LittleEndian.AppendUint16(header, 1) // PCM
+	header = binary.LittleEndian.AppendUint16(header, uint16(channels))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate))
+	header = binary.LittleEndian.AppendUint32(header, uint32(sampleRate*blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, uint16(blockAlign))
+	header = binary.LittleEndian.AppendUint16(header, wavBitsPerSample)
+	header = append(header, "data"...)
+	header = binary.LittleEndian.AppendUint32(header, dataSize)
+
+	if _, err := writer.Write(header); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+	return nil
+}
+
+// ReadWAV reads a 16-bit PCM WAV file. Chunks other than fmt and data are skipped.
+func ReadWAV(reader io.Reader) (*WAVAudio, error) {
+	formatError := func(format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf(format, args...))
+	}
+
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, formatError("failed to read WAV header: %w", err)
+	}
+	if string(header[0:4]) != "RIFF" || string(header[8:12]) != "WAVE" {
+		return nil, formatError("not a RIFF WAVE file")
+	}
+
+	var audio *WAVAudio
+	chunk := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return nil, formatError("WAV file has no data chunk")
+		}
+		id, size := string(chunk[0:4]), binary.LittleEndian.Uint32(chunk[4:8])
+		// Chunks are padded to an even size; a truncated data chunk keeps the samples it has
+		body := make([]byte, size+size%2)
+		n, err := io.ReadFull(reader, body)
+		if err != nil && id != "data" {
+			return nil, formatError("failed to read WAV %s chunk: %w", id, err)
+		}
+		body = body[:min(n, int(size))]
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, formatError("WAV fmt chunk is %d bytes", size)
+			}
+			format, channels := binary.LittleEndian.Uint16(body[0:2]), binary.LittleEndian.Uint16(body[2:4])
+			bits := binary.LittleEndian.Uint16(body[14:16])
+			if format != 1 || bits != wavBitsPerSample || channels == 0 {
+				return nil, formatError("WAV file is not 16-bit PCM (format %d, %d bits, %d channels)", format, bits, channels)
+			}
+			audio = &WAVAudio{SampleRate: int(binary.LittleEndian.Uint32(body[4:8])), Channels: int(channels)}
+		case "data":
+			if audio == nil {
+				return nil, formatError("WAV data chunk comes before the fmt chunk")
+			}
+			audio.Samples = make([]int16, len(body)/2)
+			for i := range audio.Samples {
+				audio.Samples[i] = int16(binary.LittleEndian.Uint16(body[2*i:]))
+			}
+			return audio, nil
+		}
+	}
+}
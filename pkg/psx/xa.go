@@ -0,0 +1,351 @@
+// Package psx provides PlayStation-specific structures and functionality.
+// This file contains XA audio: the Mode 2 Form 2 sectors of interleaved XA files, their
+// subheaders (file and channel numbers, coding information) and the XA-ADPCM codec that
+// turns the 18 sound groups of an audio sector into 16-bit PCM and back.
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Coding information bits of the XA subheader of audio sectors
+const (
+	XA_CODING_STEREO    = 0x01 // Bits 0-1: 0 mono, 1 stereo
+	XA_CODING_HALF_RATE = 0x04 // Bits 2-3: 0 37800 Hz, 1 18900 Hz
+	XA_CODING_8BIT      = 0x10 // Bits 4-5: 0 4-bit, 1 8-bit samples
+	XA_CODING_EMPHASIS  = 0x40
+)
+
+// XA-ADPCM layout of an audio sector
+const (
+	XA_SOUND_GROUP_SIZE  = 128                                   // Bytes of a sound group: 16 parameter bytes and 112 sample bytes
+	XA_SOUND_GROUPS      = 18                                    // Sound groups per sector
+	XA_AUDIO_DATA_SIZE   = XA_SOUND_GROUPS * XA_SOUND_GROUP_SIZE // Audio bytes of a sector, followed by 20 zero bytes
+	XA_SOUND_UNIT_FRAMES = 28                                    // Samples of a sound unit
+)
+
+// xaFilterPositive and xaFilterNegative are the prediction coefficients (in 64ths) of
+// the four XA-ADPCM filters
+var (
+	xaFilterPositive = [4]int32{0, 60, 115, 98}
+	xaFilterNegative = [4]int32{0, 0, -52, -55}
+)
+
+// XASubheader is the subheader of a Mode 2 sector
+type XASubheader struct {
+	File       uint8
+	Channel    uint8
+	Submode    uint8
+	CodingInfo uint8
+}
+
+// ParseXASubheader reads the first copy of a subheader
+func ParseXASubheader(data []byte) XASubheader {
+	return XASubheader{File: data[0], Channel: data[1], Submode: data[2], CodingInfo: data[3]}
+}
+
+// IsAudio reports whether the sector holds XA-ADPCM audio
+func (h XASubheader) IsAudio() bool {
+	return h.Submode&XA_SUBMODE_AUDIO != 0 && h.Submode&XA_SUBMODE_FORM2 != 0
+}
+
+// Channels returns 2 for stereo audio and 1 for mono audio
+func (h XASubheader) Channels() int {
+	if h.CodingInfo&0x03 == XA_CODING_STEREO {
+		return 2
+	}
+	return 1
+}
+
+// SampleRate returns the sample rate of audio sectors
+func (h XASubheader) SampleRate() int {
+	if h.CodingInfo&0x0C == XA_CODING_HALF_RATE {
+		return 18900
+	}
+	return 37800
+}
+
+// BitsPerSample returns 8 or 4, the size of the ADPCM samples of audio sectors
+func (h XASubheader) BitsPerSample() int {
+	if h.CodingInfo&0x30 == XA_CODING_8BIT {
+		return 8
+	}
+	return 4
+}
+
+// Frames returns the samples per channel an audio sector holds
+func (h XASubheader) Frames() int {
+	units := 8
+	if h.BitsPerSample() == 8 {
+		units = 4
+	}
+	return XA_SOUND_GROUPS * units * XA_SOUND_UNIT_FRAMES / h.Channels()
+}
+
+// xaADPCMState holds the last two decoded samples of a channel
+type xaADPCMState struct {
+	old   int32
+	older int32
+}
+
+// predict returns the filter prediction of the next sample
+func (s xaADPCMState) predict(filter int) int32 {
+	return (s.old*xaFilterPositive[filter] + s.older*xaFilterNegative[filter] + 32) >> 6
+}
+
+// push records a decoded sample
+func (s *xaADPCMState) push(sample int32) {
+	s.older, s.old = s.old, sample
+}
+
+// clampSample limits a value to the 16-bit sample range
+func clampSample(value int32) int32 {
+	return max(-32768, min(32767, value))
+}
+
+// XAADPCMDecoder decodes the audio sectors of one stream. The prediction carries over
+// from a sector to the next, so every stream needs its own decoder.
+type XAADPCMDecoder struct {
+	state [2]xaADPCMState
+}
+
+// DecodeSector decodes the audio data of a sector (XA_AUDIO_DATA_SIZE bytes following the
+// subheader) into 16-bit samples, interleaved for stereo
+func (d *XAADPCMDecoder) DecodeSector(data []byte, header XASubheader) []int16 {
+	channels, bits := header.Channels(), header.BitsPerSample()
+	units := 8
+	if bits == 8 {
+		units = 4
+	}
+
+	samples := make([]int16, 0, header.Frames()*channels)
+	unitSamples := make([][]int16, units)
+	for group := 0; group < XA_SOUND_GROUPS; group++ {
+		groupData := data[group*XA_SOUND_GROUP_SIZE : (group+1)*XA_SOUND_GROUP_SIZE]
+		for unit := 0; unit < units; unit++ {
+			parameter := groupData[4+unit]
+			shift, filter := int(parameter&0x0F), int(parameter>>4)&0x03
+			if shift > 12 {
+				shift = 9
+			}
+			state := &d.state[unit%channels]
+
+			unitSamples[unit] = unitSamples[unit][:0]
+			for frame := 0; frame < XA_SOUND_UNIT_FRAMES; frame++ {
+				var residual int32
+				if bits == 8 {
+					residual = int32(int8(groupData[16+frame*4+unit])) << 8
+				} else {
+					nibble := groupData[16+frame*4+unit/2] >> (4 * (unit & 1)) & 0x0F
+					residual = int32(int8(nibble<<4)) << 8
+				}
+				sample := clampSample(residual>>shift + state.predict(filter))
+				state.push(sample)
+				unitSamples[unit] = append(unitSamples[unit], int16(sample))
+			}
+		}
+
+		// Mono units follow each other; stereo units alternate left and right
+		for unit := 0; unit < units; unit += channels {
+			for frame := 0; frame < XA_SOUND_UNIT_FRAMES; frame++ {
+				for channel := 0; channel < channels; channel++ {
+					samples = append(samples, unitSamples[unit+channel][frame])
+				}
+			}
+		}
+	}
+	return samples
+}
+
+// XAADPCMEncoder encodes the audio sectors of one stream as 4-bit XA-ADPCM
+type XAADPCMEncoder struct {
+	state [2]xaADPCMState
+}
+
+// EncodeSector encodes one sector of 16-bit samples (interleaved for stereo, zero-padded
+// when short) into XA_AUDIO_DATA_SIZE bytes of sound groups. Every sound unit takes the
+// filter and shift with the smallest error against the decoded result.
+func (e *XAADPCMEncoder) EncodeSector(samples []int16, header XASubheader) ([]byte, error) {
+	if header.BitsPerSample() != 4 {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("only 4-bit XA-ADPCM can be encoded"))
+	}
+	channels := header.Channels()
+	if len(samples) > header.Frames()*channels {
+		return nil, fmt.Errorf("%d samples exceed the %d of a sector", len(samples), header.Frames()*channels)
+	}
+
+	data := make([]byte, XA_AUDIO_DATA_SIZE)
+	unit := make([]int32, XA_SOUND_UNIT_FRAMES)
+	for group := 0; group < XA_SOUND_GROUPS; group++ {
+		groupData := data[group*XA_SOUND_GROUP_SIZE : (group+1)*XA_SOUND_GROUP_SIZE]
+		for unitIndex := 0; unitIndex < 8; unitIndex++ {
+			// Frame of the group, channel of the unit
+			channel := unitIndex % channels
+			firstFrame := (group*8 + unitIndex - channel) / channels * XA_SOUND_UNIT_FRAMES
+			for frame := range unit {
+				unit[frame] = 0
+				if index := (firstFrame+frame)*channels + channel; index < len(samples) {
+					unit[frame] = int32(samples[index])
+				}
+			}
+
+			parameter, nibbles := e.encodeUnit(unit, &e.state[channel])
+			groupData[4+unitIndex] = parameter
+			for frame, nibble := range nibbles {
+				groupData[16+frame*4+unitIndex/2] |= nibble << (4 * (unitIndex & 1))
+			}
+		}
+		// The parameters are stored twice
+		copy(groupData[0:4], groupData[4:8])
+		copy(groupData[12:16], groupData[8:12])
+	}
+	return data, nil
+}
+
+// encodeUnit encodes 28 samples with the filter and shift of least squared error and
+// advances the channel state as the decoder will
+func (e *XAADPCMEncoder) encodeUnit(unit []int32, state *xaADPCMState) (byte, []byte) {
+	var (
+		bestError     int64 = -1
+		bestParameter byte
+		bestNibbles   = make([]byte, len(unit))
+		bestState     xaADPCMState
+		nibbles       = make([]byte, len(unit))
+	)
+	for filter := 0; filter < 4; filter++ {
+		for shift := 0; shift <= 12; shift++ {
+			trial := *state
+			step := int32(1) << (12 - shift)
+			var squaredError int64
+			for frame, sample := range unit {
+				prediction := trial.predict(filter)
+				residual := sample - prediction
+				// Round to the nearest step
+				quantized := residual + step/2
+				if quantized < 0 {
+					quantized -= step - 1
+				}
+				quantized = max(-8, min(7, quantized/step))
+				decoded := clampSample(quantized*step + prediction)
+				trial.push(decoded)
+				nibbles[frame] = byte(quantized) & 0x0F
+
+				difference := int64(sample - decoded)
+				squaredError += difference * difference
+				if bestError >= 0 && squaredError >= bestError {
+					break
+				}
+			}
+			if bestError < 0 || squaredError < bestError {
+				bestError, bestParameter, bestState = squaredError, byte(filter<<4|shift), trial
+				copy(bestNibbles, nibbles)
+			}
+		}
+	}
+	*state = bestState
+	return bestParameter, bestNibbles
+}
+
+// XAFile holds the sectors of an XA file, either as 2336-byte Mode 2 sectors (subheader,
+// data and EDC, as mkpsxiso and dumpsxiso store them) or as raw 2352-byte sectors
+type XAFile struct {
+	SectorSize int      // CD_XA_DATA_SIZE or CD_SECTOR_SIZE
+	Sectors    [][]byte // Stored sectors
+}
+
+// ParseXAFile splits XA file data into its sectors. Raw sectors are recognized by the
+// sync pattern of the first sector.
+func ParseXAFile(data []byte) (*XAFile, error) {
+	sectorSize := CD_XA_DATA_SIZE
+	if len(data)%CD_SECTOR_SIZE == 0 && len(data) > 0 && bytes.Equal(data[:CD_SYNC_SIZE], cdSyncPattern[:]) {
+		sectorSize = CD_SECTOR_SIZE
+	} else if len(data) == 0 || len(data)%CD_XA_DATA_SIZE != 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("%d bytes are not whole 2336-byte or 2352-byte XA sectors", len(data)))
+	}
+
+	file := &XAFile{SectorSize: sectorSize}
+	for offset := 0; offset < len(data); offset += sectorSize {
+		file.Sectors = append(file.Sectors, data[offset:offset+sectorSize])
+	}
+	return file, nil
+}
+
+// Payload returns the subheader, data and EDC of a sector (CD_XA_DATA_SIZE bytes)
+func (f *XAFile) Payload(index int) []byte {
+	return f.Sectors[index][f.SectorSize-CD_XA_DATA_SIZE:]
+}
+
+// Subheader returns the subheader of a sector
+func (f *XAFile) Subheader(index int) XASubheader {
+	return ParseXASubheader(f.Payload(index))
+}
+
+// SetAudio replaces the audio data of a sector and regenerates its EDC
+func (f *XAFile) SetAudio(index int, audio []byte) {
+	payload := f.Payload(index)
+	data := payload[CD_SUBHEADER_SIZE : CD_SUBHEADER_SIZE+XA_FORM2_DATA_SIZE]
+	copy(data, audio)
+	clear(data[len(audio):])
+	binary.LittleEndian.PutUint32(payload[CD_XA_DATA_SIZE-4:], computeEDC(payload[:CD_XA_DATA_SIZE-4]))
+}
+
+// Bytes returns the file data
+func (f *XAFile) Bytes() []byte {
+	return bytes.Join(f.Sectors, nil)
+}
+
+// ReadXAFile reads the sectors of a Form 2 file of the image as 2336-byte sectors. ISO
+// and Mode 1 images hold no subheaders, so they cannot carry XA files.
+func (r *CDReader) ReadXAFile(entry CDFileEntry) (*XAFile, error) {
+	if !r.geometry.HasSubheader() {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s images keep no subheaders; XA audio needs a Mode 2 image", r.geometry.Name))
+	}
+	extents := entry.extents()
+
+	file := &XAFile{SectorSize: CD_XA_DATA_SIZE}
+	start := r.geometry.DataOffset - CD_SUBHEADER_SIZE
+	for _, extent := range extents {
+		for lba := int64(extent.LBA); lba < int64(extent.LBA)+int64(DataSectors(extent.Size)); lba++ {
+			if err := r.loadSector(lba, nil); err != nil {
+				return nil, fmt.Errorf("failed to read sector %d of %s: %w", lba, entry.Name, err)
+			}
+			file.Sectors = append(file.Sectors, bytes.Clone(r.sectorBuffer[start:start+CD_XA_DATA_SIZE]))
+		}
+	}
+	return file, nil
+}
+
+// WriteXASectors writes the 2336-byte sectors of an XA file over the sectors of a file of
+// the image, in the order of its extents, regenerating the EDC of raw sectors. The XA file
+// may not hold more sectors than the extents of the file.
+func (o *OverlayImage) WriteXASectors(entry CDFileEntry, file *XAFile) error {
+	if !o.geometry.HasSubheader() {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s images keep no subheaders; XA audio needs a Mode 2 image", o.geometry.Name))
+	}
+	start := o.geometry.DataOffset - CD_SUBHEADER_SIZE
+	index := 0
+	for _, extent := range entry.extents() {
+		for lba := int64(extent.LBA); lba < int64(extent.LBA)+int64(DataSectors(extent.Size)) && index < len(file.Sectors); lba++ {
+			sector, err := o.sector(lba)
+			if err != nil {
+				return err
+			}
+			copy(sector[start:], file.Payload(index))
+			if o.geometry.IsRaw() {
+				RepairSectorEDC(sector)
+			}
+			index++
+		}
+	}
+	if index < len(file.Sectors) {
+		return fmt.Errorf("%d sectors of %s run past its extents", len(file.Sectors)-index, entry.Name)
+	}
+	return nil
+}
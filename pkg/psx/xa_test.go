@@ -0,0 +1,159 @@
+// Package psx provides tests for XA audio sectors and the XA-ADPCM codec
+package psx
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// xaSine returns frames of a sine (a different frequency per channel), interleaved
+func xaSine(frames, channels int, sampleRate float64) []int16 {
+	samples := make([]int16, 0, frames*channels)
+	for frame := 0; frame < frames; frame++ {
+		for channel := 0; channel < channels; channel++ {
+			frequency := 440.0 * float64(channel+1)
+			samples = append(samples, int16(12000*math.Sin(2*math.Pi*frequency*float64(frame)/sampleRate)))
+		}
+	}
+	return samples
+}
+
+// xaSNR returns the signal to noise ratio of decoded samples in dB
+func xaSNR(original, decoded []int16) float64 {
+	var signal, noise float64
+	for i := range original {
+		difference := float64(original[i]) - float64(decoded[i])
+		signal += float64(original[i]) * float64(original[i])
+		noise += difference * difference
+	}
+	return 10 * math.Log10(signal/max(noise, 1))
+}
+
+func TestXASubheader(t *testing.T) {
+	header := ParseXASubheader([]byte{1, 3, XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2 | XA_SUBMODE_REALTIME, XA_CODING_STEREO | XA_CODING_HALF_RATE})
+	if !header.IsAudio() || header.File != 1 || header.Channel != 3 {
+		t.Errorf("header = %+v, want an audio sector of file 1 channel 3", header)
+	}
+	if header.Channels() != 2 || header.SampleRate() != 18900 || header.BitsPerSample() != 4 {
+		t.Errorf("format = %d channels %d Hz %d-bit, want 2 channels 18900 Hz 4-bit",
+			header.Channels(), header.SampleRate(), header.BitsPerSample())
+	}
+	if frames := header.Frames(); frames != 2016 {
+		t.Errorf("Frames() = %d, want 2016", frames)
+	}
+
+	data := ParseXASubheader([]byte{1, 0, XA_SUBMODE_DATA, 0})
+	if data.IsAudio() {
+		t.Error("data sector reported as audio")
+	}
+	if mono := ParseXASubheader([]byte{1, 0, XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2, 0}); mono.Frames() != 4032 || mono.SampleRate() != 37800 {
+		t.Errorf("mono sector = %d frames at %d Hz, want 4032 at 37800 Hz", mono.Frames(), mono.SampleRate())
+	}
+}
+
+func TestXAADPCM_RoundTrip(t *testing.T) {
+	for _, coding := range []uint8{0, XA_CODING_STEREO} {
+		header := XASubheader{Submode: XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2, CodingInfo: coding}
+		channels := header.Channels()
+		original := xaSine(3*header.Frames(), channels, float64(header.SampleRate()))
+
+		encoder, decoder := &XAADPCMEncoder{}, &XAADPCMDecoder{}
+		var decoded []int16
+		perSector := header.Frames() * channels
+		for start := 0; start < len(original); start += perSector {
+			data, err := encoder.EncodeSector(original[start:start+perSector], header)
+			if err != nil {
+				t.Fatalf("EncodeSector() failed: %v", err)
+			}
+			if len(data) != XA_AUDIO_DATA_SIZE {
+				t.Fatalf("EncodeSector() = %d bytes, want %d", len(data), XA_AUDIO_DATA_SIZE)
+			}
+			decoded = append(decoded, decoder.DecodeSector(data, header)...)
+		}
+
+		if len(decoded) != len(original) {
+			t.Fatalf("%d channel(s): decoded %d samples, want %d", channels, len(decoded), len(original))
+		}
+		if snr := xaSNR(original, decoded); snr < 30 {
+			t.Errorf("%d channel(s): SNR = %.1f dB, want at least 30 dB", channels, snr)
+		}
+	}
+
+	eightBit := XASubheader{Submode: XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2, CodingInfo: XA_CODING_8BIT}
+	_, err := (&XAADPCMEncoder{}).EncodeSector(nil, eightBit)
+	if common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("8-bit EncodeSector() error = %v, want a validation failure", err)
+	}
+}
+
+func TestParseXAFile(t *testing.T) {
+	payload := make([]byte, CD_XA_DATA_SIZE)
+	copy(payload, []byte{1, 0, XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2, 0, 1, 0, XA_SUBMODE_AUDIO | XA_SUBMODE_FORM2, 0})
+
+	file, err := ParseXAFile(bytes.Repeat(payload, 2))
+	if err != nil {
+		t.Fatalf("ParseXAFile() failed: %v", err)
+	}
+	if file.SectorSize != CD_XA_DATA_SIZE || len(file.Sectors) != 2 || !file.Subheader(1).IsAudio() {
+		t.Fatalf("ParseXAFile() = %d sectors of %d bytes, want 2 audio sectors of 2336", len(file.Sectors), file.SectorSize)
+	}
+
+	// SetAudio regenerates the EDC over the subheader and data
+	file.SetAudio(0, []byte{0x12, 0x34})
+	edc := binary.LittleEndian.Uint32(file.Payload(0)[CD_XA_DATA_SIZE-4:])
+	if want := computeEDC(file.Payload(0)[:CD_XA_DATA_SIZE-4]); edc != want || edc == 0 {
+		t.Errorf("EDC = %08X, want %08X", edc, want)
+	}
+
+	raw := make([]byte, CD_SECTOR_SIZE)
+	copy(raw, cdSyncPattern)
+	copy(raw[CD_SECTOR_SIZE-CD_XA_DATA_SIZE:], payload)
+	if file, err := ParseXAFile(raw); err != nil || file.SectorSize != CD_SECTOR_SIZE || !file.Subheader(0).IsAudio() {
+		t.Errorf("ParseXAFile(raw) = %+v, %v, want one raw audio sector", file, err)
+	}
+
+	if _, err := ParseXAFile(make([]byte, 1000)); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("ParseXAFile(1000 bytes) error = %v, want a format error", err)
+	}
+}
+
+func TestCDReader_ReadXAFile_Mode1(t *testing.T) {
+	reader, err := NewCDReader(writeGeometryImage(t, GeometryMode1Raw, 20))
+	if err != nil {
+		t.Fatalf("NewCDReader() failed: %v", err)
+	}
+	defer reader.Close()
+
+	if _, err := reader.ReadXAFile(CDFileEntry{Name: "VOICE.XA", LBA: 5, Size: CD_DATA_SIZE}); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("ReadXAFile() of a Mode 1 image error = %v, want a validation error", err)
+	}
+}
+
+func TestWAV_RoundTrip(t *testing.T) {
+	audio := &WAVAudio{SampleRate: 37800, Channels: 2, Samples: []int16{1, -1, 32767, -32768}}
+	var buffer bytes.Buffer
+	if err := WriteWAV(&buffer, audio); err != nil {
+		t.Fatalf("WriteWAV() failed: %v", err)
+	}
+
+	read, err := ReadWAV(&buffer)
+	if err != nil {
+		t.Fatalf("ReadWAV() failed: %v", err)
+	}
+	if read.SampleRate != audio.SampleRate || read.Channels != audio.Channels || read.Frames() != 2 {
+		t.Errorf("ReadWAV() = %d Hz %d channels %d frames, want 37800 Hz 2 channels 2 frames", read.SampleRate, read.Channels, read.Frames())
+	}
+	for i := range audio.Samples {
+		if read.Samples[i] != audio.Samples[i] {
+			t.Errorf("sample %d = %d, want %d", i, read.Samples[i], audio.Samples[i])
+		}
+	}
+
+	if _, err := ReadWAV(bytes.NewReader([]byte("RIFF\x04\x00\x00\x00AVI "))); common.ExitCodeFor(err) != common.ExitFormatError {
+		t.Errorf("ReadWAV(AVI) error = %v, want a format error", err)
+	}
+}
@@ -0,0 +1,71 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the raw dialogue mode: decode can store the original bytes of every
+// dialogue as hex next to the decoded content, and encode writes dialogues with a raw
+// entry verbatim. This keeps dialogues using still-unknown opcodes lossless.
+package pkg
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// FormatRawDialogue formats dialogue bytes as space-separated 16-bit words in file byte order
+// (e.g. "FAFF 0080 0180")
+func FormatRawDialogue(data []byte) string {
+	words := make([]string, 0, (len(data)+1)/2)
+	for start := 0; start < len(data); start += 2 {
+		end := min(start+2, len(data))
+		words = append(words, strings.ToUpper(hex.EncodeToString(data[start:end])))
+	}
+	return strings.Join(words, " ")
+}
+
+// ParseRawDialogue parses a raw dialogue hex string into 16-bit little endian words.
+// Whitespace is ignored; the data must hold a whole number of words.
+func ParseRawDialogue(raw string) ([]uint16, error) {
+	data, err := hex.DecodeString(strings.Join(strings.Fields(raw), ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw dialogue hex: %w", err)
+	}
+	if len(data)%2 != 0 {
+		return nil, fmt.Errorf("raw dialogue has %d bytes, want a multiple of 2", len(data))
+	}
+
+	words := make([]uint16, len(data)/2)
+	for i := range words {
+		words[i] = binary.LittleEndian.Uint16(data[i*2:])
+	}
+	return words, nil
+}
+
+// SetRawDialogues makes ExportDialogues store the original bytes of every dialogue
+func (e *WFMFileExporter) SetRawDialogues(enabled bool) {
+	e.rawDialogues = enabled
+}
+
+// recodeRawDialogue encodes a dialogue from its raw bytes. Decoded dialogue data stops at
+// the 0xFFFF terminator, so the terminator is appended after the raw words.
+func (e *WFMFileEncoder) recodeRawDialogue(dialogue DialogueEntry) (RecodedDialogue, error) {
+	words, err := ParseRawDialogue(dialogue.Raw)
+	if err != nil {
+		return RecodedDialogue{}, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("dialogue %d: %w", dialogue.ID, err))
+	}
+
+	safeFontHeight, err := common.SafeIntToUint16(dialogue.FontHeight)
+	if err != nil {
+		return RecodedDialogue{}, fmt.Errorf("invalid font height %d: %w", dialogue.FontHeight, err)
+	}
+
+	e.logger.Debug("Dialogue %d encoded from %d raw words", dialogue.ID, len(words))
+	return RecodedDialogue{
+		ID:           dialogue.ID,
+		Type:         dialogue.Type,
+		FontHeight:   safeFontHeight,
+		OriginalText: dialogue.Raw,
+		EncodedText:  append(words, 0xFFFF),
+	}, nil
+}
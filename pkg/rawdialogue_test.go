@@ -0,0 +1,106 @@
+// Package pkg provides tests for the raw dialogue hex export and verbatim encoding
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+func TestParseRawDialogue(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    []uint16
+		wantErr bool
+	}{
+		{raw: "FAFF 0080 0180", want: []uint16{0xFFFA, 0x8000, 0x8001}},
+		{raw: "faff\n0080", want: []uint16{0xFFFA, 0x8000}},
+		{raw: "", want: []uint16{}},
+		{raw: "FAFF 00", wantErr: true},
+		{raw: "XYZW", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRawDialogue(tt.raw)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRawDialogue(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseRawDialogue(%q) = %04X, want %04X", tt.raw, got, tt.want)
+			continue
+		}
+		for i := range tt.want {
+			if got[i] != tt.want[i] {
+				t.Errorf("ParseRawDialogue(%q)[%d] = %04X, want %04X", tt.raw, i, got[i], tt.want[i])
+			}
+		}
+	}
+
+	if got := FormatRawDialogue([]byte{0xFA, 0xFF, 0x00, 0x80}); got != "FAFF 0080" {
+		t.Errorf("FormatRawDialogue() = %q, want %q", got, "FAFF 0080")
+	}
+}
+
+func TestRawDialogues_RoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	donorFile := filepath.Join(dir, "DONOR.WFM")
+	writeDonorWFM(t, donorFile)
+
+	outputDir := filepath.Join(dir, "output")
+	processor := NewWFMProcessor()
+	processor.SetRawDialogues(true)
+	if err := processor.Process(donorFile, outputDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+
+	yamlFile := filepath.Join(outputDir, "dialogues.yaml")
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		t.Fatalf("dialogueyaml.Read() failed: %v", err)
+	}
+	if got := dialogues.Dialogues[0].Raw; got != "0080 0180" {
+		t.Fatalf("Dialogues[0].Raw = %q, want %q", got, "0080 0180")
+	}
+
+	// An unknown opcode only survives through the raw entry
+	dialogues.Dialogues[1].Raw = "ABCD 0180"
+	if err := dialogueyaml.Write(yamlFile, dialogues); err != nil {
+		t.Fatalf("dialogueyaml.Write() failed: %v", err)
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(donorFile); err != nil {
+		t.Fatalf("SetGlyphDonor() failed: %v", err)
+	}
+	outputFile := filepath.Join(dir, "OUT.WFM")
+	if err := encoder.Encode(context.Background(), yamlFile, outputFile); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+
+	output, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(output))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+
+	tests := []struct {
+		index int
+		want  []byte
+	}{
+		{0, []byte{0x00, 0x80, 0x01, 0x80}},
+		{1, []byte{0xAB, 0xCD, 0x01, 0x80}},
+	}
+	for _, tt := range tests {
+		if !bytes.Equal(wfm.Dialogues[tt.index].Data, tt.want) {
+			t.Errorf("Dialogues[%d].Data = % X, want % X", tt.index, wfm.Dialogues[tt.index].Data, tt.want)
+		}
+	}
+}
@@ -0,0 +1,327 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the region conversion assistant: it applies the byte patches of a
+// conversion profile (video mode flags, timing constants) to the files of a CD image,
+// re-points FLA entries at the files of the target region and lists the steps left to
+// the user, such as the license sectors and boot executable name.
+package pkg
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// mainExecutablePath is the path of the executable holding the FLA table
+const mainExecutablePath = "EXE/MAIN0.EXE"
+
+// RegionConversionOptions lists the changes of a region conversion
+type RegionConversionOptions struct {
+	To      string            // Target region: NTSC-U, NTSC-J or PAL
+	Patches []psx.FilePatch   // Byte patches, applied in order
+	FLA     map[uint32]string // FLA entries to point at files of the image, by index
+	Manual  []string          // Steps left to the user
+	DryRun  bool              // Check and report the changes without writing them
+}
+
+// RegionPatchResult is the outcome of a byte patch
+type RegionPatchResult struct {
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Offset uint32 `json:"offset"`
+	Status string `json:"status"` // pending (dry run), applied or already-applied
+	Note   string `json:"note,omitempty"`
+}
+
+// RegionFLAResult is the outcome of re-pointing an FLA entry
+type RegionFLAResult struct {
+	Entry            uint32      `json:"entry"`
+	File             string      `json:"file"`
+	PreviousTimecode MSFTimecode `json:"previous_timecode"`
+	PreviousSize     uint32      `json:"previous_size"`
+	Timecode         MSFTimecode `json:"timecode"`
+	Size             uint32      `json:"size"`
+	Changed          bool        `json:"changed"`
+}
+
+// RegionConversionReport summarizes a region conversion
+type RegionConversionReport struct {
+	Image   string              `json:"image"`
+	To      string              `json:"to"`
+	DryRun  bool                `json:"dry_run"`
+	Patches []RegionPatchResult `json:"patches"`
+	FLA     []RegionFLAResult   `json:"fla"`
+	Manual  []string            `json:"manual"` // Steps left to the user
+}
+
+// ConvertRegion applies a region conversion to a raw CD image in place. Every patch is
+// checked before anything is written, so an image of another release is refused whole.
+func (p *CDFileProcessor) ConvertRegion(ctx context.Context, imageFile string, options RegionConversionOptions) (*RegionConversionReport, error) {
+	report := &RegionConversionReport{
+		Image:   imageFile,
+		To:      options.To,
+		DryRun:  options.DryRun,
+		Patches: []RegionPatchResult{},
+		FLA:     []RegionFLAResult{},
+		Manual:  []string{},
+	}
+
+	entries, err := p.checkRegionPatches(imageFile, options, report)
+	if err != nil {
+		return nil, err
+	}
+
+	// Patches and FLA entries are buffered and synced once; a failure restores the image
+	var writer *psx.CDWriter
+	if !options.DryRun {
+		if writer, err = psx.OpenCDWriter(ctx, imageFile); err != nil {
+			return nil, err
+		}
+		defer writer.Close()
+	}
+
+	for i, patch := range options.Patches {
+		if options.DryRun || report.Patches[i].Status != psx.PatchPending {
+			continue
+		}
+		_, patched, err := patch.Bytes()
+		if err != nil {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+		}
+		if err := writer.WriteEntryData(entries[i], patch.Offset, patched); err != nil {
+			return nil, fmt.Errorf("failed to apply patch %s: %w", patch.Name, err)
+		}
+		report.Patches[i].Status = psx.PatchApplied
+		p.logger.Debug("Patched %s at 0x%X (%s)", patch.File, patch.Offset, patch.Name)
+	}
+
+	if len(options.FLA) > 0 {
+		// The FLA table is read from the image file, so it must see the patched executable
+		if writer != nil {
+			if err := writer.Flush(); err != nil {
+				return nil, err
+			}
+		}
+		if err := p.repointFLAEntries(imageFile, writer, options, report); err != nil {
+			return nil, err
+		}
+	}
+
+	if writer != nil {
+		if err := writer.Commit(); err != nil {
+			return nil, err
+		}
+		stats := writer.Stats()
+		p.logger.Debug("Region conversion: %d writes as %d disk writes, %d syncs", stats.Writes, stats.DiskWrites, stats.Syncs)
+	}
+
+	manual, err := p.regionManualSteps(imageFile, options.To)
+	if err != nil {
+		return nil, err
+	}
+	report.Manual = append(manual, options.Manual...)
+	return report, nil
+}
+
+// checkRegionPatches reads the state of every patch and returns the file entry each
+// patch writes to
+func (p *CDFileProcessor) checkRegionPatches(imageFile string, options RegionConversionOptions, report *RegionConversionReport) ([]psx.CDFileEntry, error) {
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	if format := reader.Format(); format != psx.ImageFormatRaw && !options.DryRun {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s is a %s image, which cannot be patched; decompress it to a .bin first", imageFile, format))
+	}
+	if err := reader.ValidateISO9660(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid ISO9660 image: %w", err))
+	}
+
+	entries := make([]psx.CDFileEntry, len(options.Patches))
+	for i, patch := range options.Patches {
+		state, entry, err := reader.PatchState(patch)
+		if err != nil {
+			return nil, err
+		}
+		entries[i] = entry
+		report.Patches = append(report.Patches, RegionPatchResult{
+			Name:   patch.Name,
+			File:   patch.File,
+			Offset: patch.Offset,
+			Status: state,
+			Note:   patch.Note,
+		})
+	}
+	return entries, nil
+}
+
+// repointFLAEntries points the FLA entries of the options at their files and buffers the
+// changed entries of MAIN0.EXE in the writer (nil on a dry run)
+func (p *CDFileProcessor) repointFLAEntries(imageFile string, writer *psx.CDWriter, options RegionConversionOptions, report *RegionConversionReport) error {
+	flaProcessor := NewFLAProcessor()
+	flaProcessor.SetLogger(p.logger)
+	table, err := flaProcessor.AnalyzeCDImage(imageFile)
+	if err != nil {
+		return fmt.Errorf("failed to read FLA table: %w", err)
+	}
+
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	descriptor, err := reader.ReadISODescriptor()
+	if err != nil {
+		return fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	executable, err := reader.FindEntry(rootLBA, rootSize, mainExecutablePath)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to find %s: %w", mainExecutablePath, err))
+	}
+
+	indices := make([]uint32, 0, len(options.FLA))
+	for index := range options.FLA {
+		indices = append(indices, index)
+	}
+	sort.Slice(indices, func(i, j int) bool { return indices[i] < indices[j] })
+
+	for _, index := range indices {
+		filePath := options.FLA[index]
+		if index >= table.Count {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("FLA entry %d is out of range (the table has %d entries)", index, table.Count))
+		}
+		file, err := reader.FindEntry(rootLBA, rootSize, filePath)
+		if err != nil || file.IsDir {
+			return common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("FLA entry %d: %s not found", index, filePath))
+		}
+
+		entry := &table.Entries[index]
+		target := CDFileInfo{Name: file.Name, FullPath: filePath, LBA: file.LBA, Size: file.Size, SectorPayload: psx.SectorPayload(file.XAAttributes)}
+		result := RegionFLAResult{
+			Entry:            index,
+			File:             filePath,
+			PreviousTimecode: entry.Timecode,
+			PreviousSize:     entry.FileSize,
+			Timecode:         MSFFromSectors(file.LBA + psx.CD_PREGAP_SECTORS),
+			Size:             target.Size,
+		}
+		// Keep expressing the size the way the entry did for its previous file
+		if linked := entry.LinkedFile; linked != nil && entry.FileSize != linked.Size && entry.FileSize == linked.FLASize() {
+			result.Size = target.FLASize()
+		}
+		result.Changed = result.Timecode != entry.Timecode || result.Size != entry.FileSize
+
+		if result.Changed && !options.DryRun {
+			data := make([]byte, 8)
+			copy(data, []byte{result.Timecode.Minutes, result.Timecode.Seconds, result.Timecode.Sectors, entry.Timecode.Unused})
+			binary.LittleEndian.PutUint32(data[4:], result.Size)
+			if err := writer.WriteFileData(executable.LBA, flaTableExeOffset+8*index, data); err != nil {
+				return fmt.Errorf("failed to write FLA entry %d: %w", index, err)
+			}
+			p.logger.Debug("FLA entry %d: %s/%d -> %s/%d (%s)", index, entry.Timecode, entry.FileSize, result.Timecode, result.Size, filePath)
+		}
+		report.FLA = append(report.FLA, result)
+	}
+	return nil
+}
+
+// regionManualSteps lists the region markers of the image that still name another
+// region than the target; they are left to the user
+func (p *CDFileProcessor) regionManualSteps(imageFile, region string) ([]string, error) {
+	boot, err := p.CheckBoot(imageFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var steps []string
+	if boot.LicenseRegion != region {
+		steps = append(steps, fmt.Sprintf("The license sectors (0-15) are %s; rebuild the image with %s license data or boot it on hardware or an emulator that ignores the region",
+			boot.LicenseRegion, region))
+	}
+	if boot.ExecutableRegion != region {
+		steps = append(steps, fmt.Sprintf("The boot executable %s has a %s product code; rename it and the BOOT line of SYSTEM.CNF if the target needs a %s serial",
+			boot.BootFile, boot.ExecutableRegion, region))
+	}
+	if boot.ExeHeaderRegion != psx.RegionUnknown && boot.ExeHeaderRegion != region {
+		steps = append(steps, fmt.Sprintf("The PS-X EXE header of %s names the %s area", boot.BootFile, boot.ExeHeaderRegion))
+	}
+	return steps, nil
+}
+
+// WriteRegionConversionReport writes the report in the requested format (json or markdown)
+func WriteRegionConversionReport(report *RegionConversionReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeRegionConversionMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeRegionConversionMarkdown renders the report as a markdown document
+func writeRegionConversionMarkdown(report *RegionConversionReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	title := "Region Conversion"
+	if report.DryRun {
+		title += " (dry run)"
+	}
+	sb.WriteString(fmt.Sprintf("# %s: %s to %s\n\n", title, report.Image, report.To))
+
+	sb.WriteString("## Patches\n\n")
+	if len(report.Patches) == 0 {
+		sb.WriteString("The conversion has no patches.\n")
+	} else {
+		sb.WriteString("| Patch | File | Offset | Status | Note |\n")
+		sb.WriteString("|-------|------|--------|--------|------|\n")
+		for _, patch := range report.Patches {
+			sb.WriteString(fmt.Sprintf("| %s | %s | 0x%X | %s | %s |\n", patch.Name, patch.File, patch.Offset, patch.Status, patch.Note))
+		}
+	}
+
+	if len(report.FLA) > 0 {
+		sb.WriteString("\n## FLA Entries\n\n")
+		sb.WriteString("| Entry | File | Previous | New |\n")
+		sb.WriteString("|-------|------|----------|-----|\n")
+		for _, entry := range report.FLA {
+			updated := "unchanged"
+			if entry.Changed {
+				updated = fmt.Sprintf("%s / %d", entry.Timecode, entry.Size)
+			}
+			sb.WriteString(fmt.Sprintf("| %04X | %s | %s / %d | %s |\n", entry.Entry, entry.File, entry.PreviousTimecode, entry.PreviousSize, updated))
+		}
+	}
+
+	sb.WriteString("\n## Manual Steps\n\n")
+	if len(report.Manual) == 0 {
+		sb.WriteString("None.\n")
+	}
+	for i, step := range report.Manual {
+		sb.WriteString(fmt.Sprintf("%d. %s\n", i+1, step))
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
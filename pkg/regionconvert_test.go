@@ -0,0 +1,94 @@
+// Package pkg provides tests for the region conversion assistant.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+func TestCDFileProcessor_ConvertRegion(t *testing.T) {
+	imagePath := filepath.Join(t.TempDir(), "pal.bin")
+	writeDisc(t, imagePath, []discFile{
+		{dir: "DATA", name: "PAL.STR", data: bytes.Repeat([]byte{0x50}, 3000)},
+		{dir: "DATA", name: "NTSC.STR", data: bytes.Repeat([]byte{0x4E}, 5000)},
+	})
+	options := RegionConversionOptions{
+		To:      psx.RegionNTSCU,
+		Patches: []psx.FilePatch{{Name: "video-mode", File: "DATA/PAL.STR", Offset: 16, Original: "50 50", Patched: "00 01"}},
+		FLA:     map[uint32]string{0: "DATA/NTSC.STR"},
+		Manual:  []string{"Re-time the FMV audio"},
+	}
+	processor := NewCDProcessor()
+
+	// A dry run reports the changes without writing them
+	before, err := os.ReadFile(imagePath)
+	if err != nil {
+		t.Fatalf("failed to read image: %v", err)
+	}
+	dryRun := options
+	dryRun.DryRun = true
+	report, err := processor.ConvertRegion(context.Background(), imagePath, dryRun)
+	if err != nil {
+		t.Fatalf("ConvertRegion(dry run) failed: %v", err)
+	}
+	if got := report.Patches[0].Status; got != psx.PatchPending {
+		t.Errorf("dry run patch status = %q, want %q", got, psx.PatchPending)
+	}
+	if len(report.FLA) != 1 || !report.FLA[0].Changed || report.FLA[0].Size != 5000 {
+		t.Errorf("dry run FLA = %+v, want entry 0 changed to 5000 bytes", report.FLA)
+	}
+	if after, _ := os.ReadFile(imagePath); !bytes.Equal(before, after) {
+		t.Error("dry run changed the image")
+	}
+
+	report, err = processor.ConvertRegion(context.Background(), imagePath, options)
+	if err != nil {
+		t.Fatalf("ConvertRegion() failed: %v", err)
+	}
+	if got := report.Patches[0].Status; got != psx.PatchApplied {
+		t.Errorf("patch status = %q, want %q", got, psx.PatchApplied)
+	}
+	if last := report.Manual[len(report.Manual)-1]; last != "Re-time the FMV audio" {
+		t.Errorf("last manual step = %q, want the conversion's own step", last)
+	}
+
+	table, err := NewFLAProcessor().AnalyzeCDImage(imagePath)
+	if err != nil {
+		t.Fatalf("AnalyzeCDImage() failed: %v", err)
+	}
+	entry := table.Entries[0]
+	if entry.LinkedFile == nil || entry.LinkedFile.FullPath != "DATA/NTSC.STR" || entry.FileSize != 5000 {
+		t.Errorf("FLA entry 0 = %s/%d linked to %+v, want DATA/NTSC.STR with 5000 bytes", entry.Timecode, entry.FileSize, entry.LinkedFile)
+	}
+
+	// Converting again finds every change in place
+	report, err = processor.ConvertRegion(context.Background(), imagePath, options)
+	if err != nil {
+		t.Fatalf("ConvertRegion(again) failed: %v", err)
+	}
+	if report.Patches[0].Status != psx.PatchAlreadyApplied || report.FLA[0].Changed {
+		t.Errorf("second conversion = %+v / %+v, want nothing left to change", report.Patches, report.FLA)
+	}
+
+	var sb strings.Builder
+	if err := WriteRegionConversionReport(report, ReportFormatMarkdown, &sb); err != nil {
+		t.Fatalf("WriteRegionConversionReport() failed: %v", err)
+	}
+	if !strings.Contains(sb.String(), "| video-mode | DATA/PAL.STR | 0x10 | already-applied |") {
+		t.Errorf("markdown report lacks the patch row:\n%s", sb.String())
+	}
+
+	// A patch made for another release is refused before anything is written
+	other := options
+	other.Patches = []psx.FilePatch{{Name: "other", File: "DATA/NTSC.STR", Offset: 0, Original: "00", Patched: "01"}}
+	if _, err := processor.ConvertRegion(context.Background(), imagePath, other); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("ConvertRegion(mismatched patch) = %v, want a validation error", err)
+	}
+}
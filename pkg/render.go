@@ -0,0 +1,256 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the text renderer, which draws arbitrary strings with the glyphs of a WFM
+// font so external tools (chat bots, web previewers) can show translated text in the game font.
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// DefaultFontDir is the reference font directory used to map glyphs to characters
+const DefaultFontDir = "fonts"
+
+// TextRenderer draws text with the glyphs of a WFM font
+type TextRenderer struct {
+	wfm      *WFMFile
+	glyphs   map[int]map[string]int // Glyph index by font height and character
+	palettes *PaletteSet
+}
+
+// NewTextRenderer maps the glyphs of a WFM font to characters with the reference fonts of
+// fontDir, the same way decode does
+func NewTextRenderer(wfm *WFMFile, fontDir string) (*TextRenderer, error) {
+	glyphMapping, err := NewWFMExporter().buildGlyphMappingFromGlyphs(wfm.Glyphs, fontDir)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to map glyphs: %w", err))
+	}
+
+	// Glyphs are visited in index order so the first glyph of a character wins
+	indices := make([]int, 0, len(glyphMapping))
+	for index := range glyphMapping {
+		indices = append(indices, int(index))
+	}
+	sort.Ints(indices)
+
+	glyphs := make(map[int]map[string]int)
+	for _, index := range indices {
+		height := int(wfm.Glyphs[index].GlyphHeight)
+		if glyphs[height] == nil {
+			glyphs[height] = make(map[string]int)
+		}
+		char := glyphMapping[uint16(index)]
+		if _, found := glyphs[height][char]; !found {
+			glyphs[height][char] = index
+		}
+	}
+
+	return &TextRenderer{wfm: wfm, glyphs: glyphs}, nil
+}
+
+// LoadTextRenderer decodes a WFM file and creates a renderer for its font
+func LoadTextRenderer(wfmFile, fontDir string) (*TextRenderer, error) {
+	file, err := os.Open(wfmFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open WFM file: %w", err))
+	}
+	defer file.Close()
+
+	wfm, err := NewWFMDecoder().Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WFM file %s: %w", wfmFile, err)
+	}
+	return NewTextRenderer(wfm, fontDir)
+}
+
+// SetPalettes sets the project palettes used to draw glyphs (nil uses the built-in CLUTs)
+func (r *TextRenderer) SetPalettes(set *PaletteSet) {
+	r.palettes = set
+}
+
+// placedGlyph is a character laid out by the renderer
+type placedGlyph struct {
+	Char  string
+	Index int             // Glyph index, or -1 for a character without a glyph
+	Line  int             // Line of the character, from 0
+	Rect  image.Rectangle // Cell of the character on the rendered image
+}
+
+// textLayout is the placement of every character of a rendered string
+type textLayout struct {
+	Width, Height int
+	Glyphs        []placedGlyph
+}
+
+// RenderString draws text with the glyphs of the given font height on a transparent image.
+// Lines end at newlines and [PAGE]; other control tags are ignored. With a positive width,
+// lines are wrapped at spaces (or anywhere inside words wider than a line) to fit that many
+// pixels and the image is exactly that wide. Characters without a glyph are left blank with
+// the width of the widest glyph, as the line-width lint rule counts them.
+func (r *TextRenderer) RenderString(text string, height, width int) (image.Image, error) {
+	layout, err := r.layoutString(text, height, width)
+	if err != nil {
+		return nil, err
+	}
+	return r.draw(layout), nil
+}
+
+// layoutString places the characters of text the way RenderString draws them
+func (r *TextRenderer) layoutString(text string, height, width int) (*textLayout, error) {
+	glyphs := r.glyphs[height]
+	if len(glyphs) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("the font has no mapped glyphs of height %d", height))
+	}
+
+	widest := 0
+	for _, index := range glyphs {
+		widest = max(widest, int(r.wfm.Glyphs[index].GlyphWidth))
+	}
+	advance := func(char string) int {
+		if index, found := glyphs[char]; found {
+			return int(r.wfm.Glyphs[index].GlyphWidth)
+		}
+		return widest
+	}
+
+	text = strings.ReplaceAll(text, PageBreakTag, "\n\n")
+	text = stripZeroWidth(controlTagRegex.ReplaceAllString(text, ""))
+
+	var lines [][]string
+	for _, paragraph := range strings.Split(text, "\n") {
+		lines = append(lines, wrapLine(splitChars(paragraph), width, advance)...)
+	}
+
+	layout := &textLayout{Width: width, Height: len(lines) * height}
+	if layout.Width <= 0 {
+		for _, line := range lines {
+			layout.Width = max(layout.Width, lineWidth(line, advance))
+		}
+	}
+	layout.Width = max(layout.Width, 1)
+
+	missing := make(map[string]bool)
+	for row, line := range lines {
+		x := 0
+		for _, char := range line {
+			index, found := glyphs[char]
+			if !found {
+				if char != " " && !missing[char] {
+					missing[char] = true
+					common.LogWarn("No glyph of height %d for '%s'", height, char)
+				}
+				layout.Glyphs = append(layout.Glyphs, placedGlyph{Char: char, Index: -1, Line: row,
+					Rect: image.Rect(x, row*height, x+widest, (row+1)*height)})
+				x += widest
+				continue
+			}
+
+			glyph := r.wfm.Glyphs[index]
+			layout.Glyphs = append(layout.Glyphs, placedGlyph{Char: char, Index: index, Line: row,
+				Rect: image.Rect(x, row*height, x+int(glyph.GlyphWidth), row*height+int(glyph.GlyphHeight))})
+			x += int(glyph.GlyphWidth)
+		}
+	}
+
+	return layout, nil
+}
+
+// draw draws the glyphs of a layout on a transparent image
+func (r *TextRenderer) draw(layout *textLayout) *image.RGBA {
+	canvas := image.NewRGBA(image.Rect(0, 0, layout.Width, layout.Height))
+	for _, placed := range layout.Glyphs {
+		if placed.Index < 0 {
+			continue
+		}
+		glyph := r.wfm.Glyphs[placed.Index]
+		imageData, err := glyph.Image()
+		if err != nil {
+			common.LogWarn("Glyph %d not drawn: %v", placed.Index, err)
+			continue
+		}
+		tile := &psx.PSXTile{
+			Width:   int(glyph.GlyphWidth),
+			Height:  int(glyph.GlyphHeight),
+			Data:    imageData,
+			Palette: glyphPalette(r.palettes, glyph.GlyphClut, int(glyph.GlyphHeight)),
+		}
+		glyphImage := tile.ToPaletted()
+		draw.Draw(canvas, placed.Rect, glyphImage, glyphImage.Bounds().Min, draw.Over)
+	}
+	return canvas
+}
+
+// RenderString draws text with the glyphs of a WFM font, mapping glyphs to characters with
+// the reference fonts of the default font directory
+func RenderString(wfm *WFMFile, text string, height, width int) (image.Image, error) {
+	renderer, err := NewTextRenderer(wfm, DefaultFontDir)
+	if err != nil {
+		return nil, err
+	}
+	return renderer.RenderString(text, height, width)
+}
+
+// splitChars splits text into characters, the unit the glyph mapping is keyed by
+func splitChars(text string) []string {
+	chars := make([]string, 0, len(text))
+	for _, char := range text {
+		chars = append(chars, string(char))
+	}
+	return chars
+}
+
+// lineWidth returns the pixel width of a line
+func lineWidth(line []string, advance func(string) int) int {
+	width := 0
+	for _, char := range line {
+		width += advance(char)
+	}
+	return width
+}
+
+// wrapLine breaks a line into lines no wider than width pixels (0 disables wrapping).
+// Lines break at spaces, which are dropped at the break; words wider than a line are
+// broken between characters.
+func wrapLine(chars []string, width int, advance func(string) int) [][]string {
+	if width <= 0 || lineWidth(chars, advance) <= width {
+		return [][]string{chars}
+	}
+
+	var lines [][]string
+	var line []string
+	for _, word := range strings.Split(strings.Join(chars, ""), " ") {
+		wordChars := splitChars(word)
+		candidate := wordChars
+		if len(line) > 0 {
+			candidate = append(append(append([]string{}, line...), " "), wordChars...)
+		}
+		if lineWidth(candidate, advance) <= width {
+			line = candidate
+			continue
+		}
+
+		if len(line) > 0 {
+			lines = append(lines, line)
+			line = nil
+		}
+		for lineWidth(wordChars, advance) > width {
+			split, used := 0, 0
+			for split < len(wordChars) && used+advance(wordChars[split]) <= width {
+				used += advance(wordChars[split])
+				split++
+			}
+			split = max(split, 1)
+			lines = append(lines, wordChars[:split])
+			wordChars = wordChars[split:]
+		}
+		line = wordChars
+	}
+	return append(lines, line)
+}
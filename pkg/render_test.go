@@ -0,0 +1,94 @@
+// Package pkg provides tests for rendering arbitrary text with a WFM font
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newRenderTestFont returns a WFM font with 4x16 glyphs for "A", "B" and space, and a
+// reference font directory matching them
+func newRenderTestFont(t *testing.T) (*WFMFile, string) {
+	t.Helper()
+	fontDir := t.TempDir()
+	wfm := &WFMFile{}
+	exporter := NewWFMExporter()
+	for i, char := range []rune{'A', 'B', ' '} {
+		fill := map[rune]byte{'A': 0x11, 'B': 0x22, ' ': 0x00}[char]
+		glyph := Glyph{GlyphWidth: 4, GlyphHeight: 16, GlyphImage: bytes.Repeat([]byte{fill}, 32)}
+		wfm.Glyphs = append(wfm.Glyphs, glyph)
+
+		img, err := exporter.convertGlyphToImage(glyph)
+		if err != nil {
+			t.Fatalf("convertGlyphToImage(%d) failed: %v", i, err)
+		}
+		file, err := os.Create(filepath.Join(fontDir, fmt.Sprintf("%04X.png", char)))
+		if err != nil {
+			t.Fatalf("failed to create font file: %v", err)
+		}
+		if err := png.Encode(file, img); err != nil {
+			t.Fatalf("failed to encode font file: %v", err)
+		}
+		file.Close()
+	}
+	return wfm, fontDir
+}
+
+func TestTextRenderer_RenderString(t *testing.T) {
+	wfm, fontDir := newRenderTestFont(t)
+	renderer, err := NewTextRenderer(wfm, fontDir)
+	if err != nil {
+		t.Fatalf("NewTextRenderer() failed: %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		text          string
+		width         int
+		wantW, wantH  int
+		opaqueX       []int // Columns of the first row expected to be drawn
+		transparentX  []int // Columns of the first row expected to be empty
+		secondRowFrom int   // Column of the second line expected to be drawn (-1 for none)
+	}{
+		{"single line", "AB A", 0, 16, 16, []int{0, 5, 12}, []int{9}, -1},
+		{"control tags ignored", "A[WAIT FOR INPUT]B", 0, 8, 16, []int{0, 4}, nil, -1},
+		{"newline", "A\nB", 0, 4, 32, []int{0}, nil, 0},
+		{"wrapped at spaces", "AB A", 8, 8, 32, []int{0, 4}, nil, 0},
+		{"long word broken", "ABA", 8, 8, 32, []int{0, 4}, nil, 0},
+		{"unknown character left blank", "ACA", 0, 12, 16, []int{0, 8}, []int{5}, -1},
+	}
+	for _, tt := range tests {
+		img, err := renderer.RenderString(tt.text, 16, tt.width)
+		if err != nil {
+			t.Fatalf("%s: RenderString() failed: %v", tt.name, err)
+		}
+		bounds := img.Bounds()
+		if bounds.Dx() != tt.wantW || bounds.Dy() != tt.wantH {
+			t.Errorf("%s: image size = %dx%d, want %dx%d", tt.name, bounds.Dx(), bounds.Dy(), tt.wantW, tt.wantH)
+			continue
+		}
+		for _, x := range tt.opaqueX {
+			if _, _, _, a := img.At(x, 0).RGBA(); a == 0 {
+				t.Errorf("%s: pixel (%d, 0) is transparent, want a glyph", tt.name, x)
+			}
+		}
+		for _, x := range tt.transparentX {
+			if _, _, _, a := img.At(x, 0).RGBA(); a != 0 {
+				t.Errorf("%s: pixel (%d, 0) is drawn, want it transparent", tt.name, x)
+			}
+		}
+		if tt.secondRowFrom >= 0 {
+			if _, _, _, a := img.At(tt.secondRowFrom, 16).RGBA(); a == 0 {
+				t.Errorf("%s: second line is empty", tt.name)
+			}
+		}
+	}
+
+	if _, err := renderer.RenderString("A", 24, 0); err == nil {
+		t.Error("RenderString() should fail for a font height without glyphs")
+	}
+}
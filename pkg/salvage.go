@@ -0,0 +1,272 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the error-tolerant WFM decoder used by decode --salvage. Instead of
+// stopping at the first bad field it locates every glyph and dialogue through its pointer,
+// skips what cannot be read and records each problem in a recovery report, so as much of
+// a corrupted file as possible can be rescued.
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRecoveryReportFile is the name of the recovery report written by decode --salvage
+const DefaultRecoveryReportFile = "recovery-report.yaml"
+
+// salvageMaxGlyphSize is the largest glyph width or height accepted as plausible
+const salvageMaxGlyphSize = 64
+
+// Salvage results of a recovery report issue
+const (
+	SalvageLost      = "lost"      // The item could not be read and was left empty
+	SalvageRecovered = "recovered" // The item was read from a fallback location
+	SalvageTruncated = "truncated" // The item was read up to the end of the file
+	SalvageIgnored   = "ignored"   // The field is invalid but decoding went on
+)
+
+// SalvageIssue is a problem found while salvaging a WFM file
+type SalvageIssue struct {
+	Section string `yaml:"section"`         // header, glyph_pointers, glyph, dialogue_pointers or dialogue
+	Index   *int   `yaml:"index,omitempty"` // Glyph or dialogue index (nil for whole sections)
+	Offset  int    `yaml:"offset"`          // File offset of the bad data
+	Error   string `yaml:"error"`
+	Result  string `yaml:"result"` // lost, recovered, truncated or ignored
+}
+
+// SalvageCount summarizes the items of a section
+type SalvageCount struct {
+	Total     int `yaml:"total"`
+	Recovered int `yaml:"recovered"`
+	Lost      int `yaml:"lost"`
+}
+
+// SalvageReport lists what was lost while decoding a corrupted WFM file
+type SalvageReport struct {
+	File          string         `yaml:"file"`
+	Glyphs        SalvageCount   `yaml:"glyphs"`
+	Dialogues     SalvageCount   `yaml:"dialogues"`
+	LostGlyphs    []int          `yaml:"lost_glyphs,omitempty"`
+	LostDialogues []int          `yaml:"lost_dialogues,omitempty"`
+	Issues        []SalvageIssue `yaml:"issues,omitempty"`
+}
+
+// addIssue records a problem; index is negative for whole sections
+func (r *SalvageReport) addIssue(section string, index, offset int, result string, format string, args ...interface{}) {
+	issue := SalvageIssue{Section: section, Offset: offset, Error: fmt.Sprintf(format, args...), Result: result}
+	if index >= 0 {
+		issue.Index = &index
+	}
+	r.Issues = append(r.Issues, issue)
+	common.LogDebug("Salvage %s %d at 0x%X: %s (%s)", section, index, offset, issue.Error, result)
+}
+
+// DecodeSalvage decodes a WFM file without stopping at bad fields. Glyphs and dialogues
+// are located through their pointers; unreadable ones are stored as placeholder glyphs
+// and empty dialogues so the indices of the others are kept. Only a file too short to
+// hold a header is an error.
+func (d *WFMFileDecoder) DecodeSalvage(data []byte) (*WFMFile, *SalvageReport, error) {
+	if len(data) < WFMHeaderSize {
+		return nil, nil, common.WithCategory(common.ErrCategoryFormat,
+			fmt.Errorf("file has %d bytes, too short for the %d-byte header", len(data), WFMHeaderSize))
+	}
+
+	// Read the header fields directly so an invalid magic does not stop decoding
+	header := &WFMHeader{}
+	if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, header); err != nil {
+		return nil, nil, fmt.Errorf("failed to read header: %w", err)
+	}
+
+	report := &SalvageReport{}
+	if string(header.Magic[:]) != common.WFMFileMagic {
+		report.addIssue("header", -1, 0, SalvageIgnored, "invalid magic %q, expected %q", header.Magic[:], common.WFMFileMagic)
+	}
+
+	wfm := &WFMFile{Header: *header}
+	wfm.GlyphPointerTable, wfm.Glyphs = d.salvageGlyphs(data, header, report)
+	wfm.DialoguePointerTable, wfm.Dialogues = d.salvageDialogues(data, header, report)
+	return wfm, report, nil
+}
+
+// salvagePointers reads a table of uint16 pointers, reporting entries beyond the end of the file
+func salvagePointers(data []byte, offset, count int, section string, report *SalvageReport) ([]uint16, int) {
+	pointers := make([]uint16, count)
+	available := 0
+	if offset < len(data) {
+		available = min(count, (len(data)-offset)/2)
+	}
+	for i := 0; i < available; i++ {
+		pointers[i] = binary.LittleEndian.Uint16(data[offset+i*2:])
+	}
+	if available < count {
+		report.addIssue(section, -1, offset, SalvageIgnored,
+			"table of %d pointers ends past the end of the file, %d pointers readable", count, available)
+	}
+	return pointers, available
+}
+
+// salvageGlyphs reads every glyph through the glyph pointer table. A glyph whose pointer
+// is unusable is retried right after the previous glyph record.
+func (d *WFMFileDecoder) salvageGlyphs(data []byte, header *WFMHeader, report *SalvageReport) ([]uint16, []Glyph) {
+	count := int(header.TotalGlyphs)
+	pointers, available := salvagePointers(data, WFMHeaderSize, count, "glyph_pointers", report)
+	glyphs := make([]Glyph, count)
+	report.Glyphs.Total = count
+
+	next := WFMHeaderSize + count*2
+	for i := 0; i < count; i++ {
+		offset := -1
+		if i < available {
+			offset = int(pointers[i])
+		}
+
+		glyph, size, err := parseSalvageGlyph(data, offset)
+		if err != nil && next != offset {
+			if fallback, fallbackSize, fallbackErr := parseSalvageGlyph(data, next); fallbackErr == nil {
+				report.addIssue("glyph", i, offset, SalvageRecovered, "%v; read after the previous glyph at 0x%X", err, next)
+				glyph, size, offset, err = fallback, fallbackSize, next, nil
+			}
+		}
+		if err != nil {
+			report.addIssue("glyph", i, max(offset, 0), SalvageLost, "%v", err)
+			report.LostGlyphs = append(report.LostGlyphs, i)
+			glyphs[i] = NewPlaceholderGlyph()
+			continue
+		}
+
+		glyphs[i] = glyph
+		report.Glyphs.Recovered++
+		next = offset + size + size%wfmAlignment
+	}
+	report.Glyphs.Lost = len(report.LostGlyphs)
+	return pointers, glyphs
+}
+
+// parseSalvageGlyph reads a glyph record at offset and checks that it is plausible.
+// Returns the glyph and the size of its record.
+func parseSalvageGlyph(data []byte, offset int) (Glyph, int, error) {
+	if offset < WFMHeaderSize || offset+wfmGlyphAttributesSize > len(data) {
+		return Glyph{}, 0, fmt.Errorf("glyph offset 0x%X outside the file", max(offset, 0))
+	}
+
+	glyph := Glyph{
+		GlyphClut:       binary.LittleEndian.Uint16(data[offset:]),
+		GlyphHeight:     binary.LittleEndian.Uint16(data[offset+2:]),
+		GlyphWidth:      binary.LittleEndian.Uint16(data[offset+4:]),
+		GlyphHandakuten: binary.LittleEndian.Uint16(data[offset+6:]),
+		GlyphImage:      []byte{},
+	}
+	if glyph.IsPlaceholder() {
+		return glyph, wfmGlyphAttributesSize, nil
+	}
+	if glyph.GlyphWidth > salvageMaxGlyphSize || glyph.GlyphHeight > salvageMaxGlyphSize {
+		return Glyph{}, 0, fmt.Errorf("implausible glyph size %dx%d", glyph.GlyphWidth, glyph.GlyphHeight)
+	}
+
+	imageSize := (int(glyph.GlyphWidth)*int(glyph.GlyphHeight) + 1) / 2
+	start := offset + wfmGlyphAttributesSize
+	if start+imageSize > len(data) {
+		return Glyph{}, 0, fmt.Errorf("glyph image of %d bytes ends past the end of the file", imageSize)
+	}
+	glyph.GlyphImage = append([]byte{}, data[start:start+imageSize]...)
+	return glyph, wfmGlyphAttributesSize + imageSize, nil
+}
+
+// salvageDialogues reads every dialogue through the dialogue pointer table. A dialogue
+// without a terminator is kept up to the end of the file.
+func (d *WFMFileDecoder) salvageDialogues(data []byte, header *WFMHeader, report *SalvageReport) ([]uint16, []Dialogue) {
+	count := int(header.TotalDialogues)
+	tableOffset := int(header.DialoguePointerTable)
+	dialogues := make([]Dialogue, count)
+	report.Dialogues.Total = count
+
+	if tableOffset < WFMHeaderSize || tableOffset >= len(data) {
+		report.addIssue("dialogue_pointers", -1, tableOffset, SalvageLost, "dialogue pointer table offset outside the file")
+	}
+	pointers, available := salvagePointers(data, tableOffset, count, "dialogue_pointers", report)
+
+	for i := 0; i < count; i++ {
+		dialogues[i] = Dialogue{Data: []byte{}}
+		if i >= available || tableOffset < WFMHeaderSize {
+			report.LostDialogues = append(report.LostDialogues, i)
+			continue
+		}
+		if pointers[i] == 0 {
+			report.Dialogues.Recovered++
+			continue
+		}
+
+		offset := tableOffset + int(pointers[i])
+		if offset+2 > len(data) {
+			report.addIssue("dialogue", i, offset, SalvageLost, "dialogue offset outside the file")
+			report.LostDialogues = append(report.LostDialogues, i)
+			continue
+		}
+
+		end := offset
+		for end+2 <= len(data) && binary.LittleEndian.Uint16(data[end:]) != TERMINATOR_2 {
+			end += 2
+		}
+		if end+2 > len(data) {
+			report.addIssue("dialogue", i, offset, SalvageTruncated, "no terminator before the end of the file")
+		}
+		dialogues[i] = Dialogue{Data: append([]byte{}, data[offset:end]...)}
+		report.Dialogues.Recovered++
+	}
+	report.Dialogues.Lost = len(report.LostDialogues)
+	return pointers, dialogues
+}
+
+// WriteSalvageReport writes a recovery report to a YAML file
+func WriteSalvageReport(path string, report *SalvageReport) error {
+	writer, err := common.CreateOutput(path)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create recovery report: %w", err))
+	}
+	defer writer.Close()
+
+	encoder := yaml.NewEncoder(writer)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(report); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode recovery report: %w", err))
+	}
+	return nil
+}
+
+// SetSalvage makes Process decode with DecodeSalvage and write a recovery report
+func (p *WFMFileProcessor) SetSalvage(enabled bool) {
+	p.salvage = enabled
+}
+
+// RecoveryReport returns the recovery report of the last salvaged file (nil without --salvage)
+func (p *WFMFileProcessor) RecoveryReport() *SalvageReport {
+	return p.recovery
+}
+
+// salvageDecode reads a whole WFM file and decodes it with DecodeSalvage
+func (p *WFMFileProcessor) salvageDecode(file *os.File, size int64) (*WFMFile, error) {
+	if err := common.CheckMemory(file.Name(), size); err != nil {
+		return nil, err
+	}
+	data := make([]byte, size)
+	if _, err := file.ReadAt(data, 0); err != nil {
+		return nil, fmt.Errorf("failed to read input file: %w", err)
+	}
+
+	wfm, report, err := p.DecodeSalvage(data)
+	if err != nil {
+		return nil, err
+	}
+	report.File = file.Name()
+	p.recovery = report
+
+	if report.Glyphs.Lost > 0 || report.Dialogues.Lost > 0 {
+		common.LogWarn("Salvage: %d of %d glyphs and %d of %d dialogues lost", report.Glyphs.Lost, report.Glyphs.Total,
+			report.Dialogues.Lost, report.Dialogues.Total)
+	}
+	return wfm, nil
+}
@@ -0,0 +1,113 @@
+// Package pkg provides tests for the error-tolerant WFM decoder and its recovery report
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// salvageFixture returns the donor WFM with a valid glyph pointer table:
+// glyph records at 148 and 188, dialogue pointer table at 228, dialogues at 232 and 238
+func salvageFixture(t *testing.T) []byte {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "DONOR.WFM")
+	writeDonorWFM(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	binary.LittleEndian.PutUint16(data[144:], 148)
+	binary.LittleEndian.PutUint16(data[146:], 188)
+	return data
+}
+
+func TestWFMFileDecoder_DecodeSalvage_Clean(t *testing.T) {
+	wfm, report, err := NewWFMDecoder().DecodeSalvage(salvageFixture(t))
+	if err != nil {
+		t.Fatalf("DecodeSalvage() failed: %v", err)
+	}
+	if len(report.Issues) != 0 || report.Glyphs.Recovered != 2 || report.Dialogues.Recovered != 2 {
+		t.Errorf("report = %+v, want 2 glyphs and 2 dialogues without issues", report)
+	}
+	if !bytes.Equal(wfm.Dialogues[0].Data, []byte{0x00, 0x80, 0x01, 0x80}) {
+		t.Errorf("Dialogues[0].Data = % X, want 00 80 01 80", wfm.Dialogues[0].Data)
+	}
+}
+
+func TestWFMFileDecoder_DecodeSalvage_Corrupted(t *testing.T) {
+	data := salvageFixture(t)
+	copy(data, "XXXX")                                  // Bad magic
+	binary.LittleEndian.PutUint16(data[148+2:], 0x500)  // Glyph 0: implausible height
+	binary.LittleEndian.PutUint16(data[228+2:], 0x7FFF) // Dialogue 1: pointer past the end
+	data = append(data, 0x00, 0x80)                     // Unterminated dialogue appended at 242
+	binary.LittleEndian.PutUint16(data[228:], 242-228)  // Dialogue 0 points to it
+
+	wfm, report, err := NewWFMDecoder().DecodeSalvage(data)
+	if err != nil {
+		t.Fatalf("DecodeSalvage() failed: %v", err)
+	}
+
+	if len(report.LostGlyphs) != 1 || report.LostGlyphs[0] != 0 {
+		t.Errorf("LostGlyphs = %v, want [0]", report.LostGlyphs)
+	}
+	if !wfm.Glyphs[0].IsPlaceholder() || !bytes.Equal(wfm.Glyphs[1].GlyphImage, bytes.Repeat([]byte{0x22}, 32)) {
+		t.Error("glyph 0 should be a placeholder and glyph 1 recovered")
+	}
+	if len(report.LostDialogues) != 1 || report.LostDialogues[0] != 1 {
+		t.Errorf("LostDialogues = %v, want [1]", report.LostDialogues)
+	}
+	if !bytes.Equal(wfm.Dialogues[0].Data, []byte{0x00, 0x80}) {
+		t.Errorf("Dialogues[0].Data = % X, want 00 80", wfm.Dialogues[0].Data)
+	}
+
+	results := make(map[string]int)
+	for _, issue := range report.Issues {
+		results[issue.Section+"/"+issue.Result]++
+	}
+	for _, want := range []string{"header/ignored", "glyph/lost", "dialogue/lost", "dialogue/truncated"} {
+		if results[want] != 1 {
+			t.Errorf("issues %v, want one %s", results, want)
+		}
+	}
+
+	if _, _, err := NewWFMDecoder().DecodeSalvage(data[:100]); err == nil {
+		t.Error("DecodeSalvage() of a truncated header succeeded, want error")
+	}
+}
+
+func TestWFMFileProcessor_Process_Salvage(t *testing.T) {
+	dir := t.TempDir()
+	data := salvageFixture(t)
+	binary.LittleEndian.PutUint16(data[148+2:], 0x500)
+	inputFile := filepath.Join(dir, "BROKEN.WFM")
+	if err := os.WriteFile(inputFile, data, 0644); err != nil {
+		t.Fatalf("failed to write input: %v", err)
+	}
+
+	outputDir := filepath.Join(dir, "rescued")
+	processor := NewWFMProcessor()
+	processor.SetSalvage(true)
+	if err := processor.Process(inputFile, outputDir); err != nil {
+		t.Fatalf("Process() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(filepath.Join(outputDir, DefaultRecoveryReportFile))
+	if err != nil {
+		t.Fatalf("failed to read recovery report: %v", err)
+	}
+	var report SalvageReport
+	if err := yaml.Unmarshal(content, &report); err != nil {
+		t.Fatalf("failed to parse recovery report: %v", err)
+	}
+	if report.Glyphs.Lost != 1 || report.Dialogues.Lost != 0 || report.File != inputFile {
+		t.Errorf("report = %+v, want 1 lost glyph of %s", report, inputFile)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "dialogues.yaml")); err != nil {
+		t.Errorf("dialogues.yaml not written: %v", err)
+	}
+}
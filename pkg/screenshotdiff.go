@@ -0,0 +1,301 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the screenshot comparison used for QA: a text box captured from an emulator
+// is aligned with the box the renderer expects for a dialogue, and the pixels and glyphs that
+// differ are reported together with a visual diff image.
+package pkg
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// DefaultScreenshotTolerance is the color distance from the box background above which a
+// screenshot pixel counts as drawn
+const DefaultScreenshotTolerance = 48
+
+// Colors of the screenshot diff image
+var (
+	diffMatchColor    = color.RGBA{R: 0xFF, G: 0xFF, B: 0xFF, A: 0xFF} // Drawn in both
+	diffExpectedColor = color.RGBA{R: 0xFF, G: 0x30, B: 0x30, A: 0xFF} // Expected but missing in the screenshot
+	diffExtraColor    = color.RGBA{R: 0x30, G: 0xFF, B: 0x30, A: 0xFF} // Drawn in the screenshot only
+	diffEmptyColor    = color.RGBA{A: 0xFF}
+)
+
+// ScreenshotDiffOptions configures how a screenshot is compared with the expected text box
+type ScreenshotDiffOptions struct {
+	Box       int          // Text box of the dialogue to compare, from 0 (boxes start at box items and [PAGE])
+	Width     int          // Wrap lines to this many pixels (0 disables wrapping)
+	Scale     int          // Integer upscaling of the emulator output (0 or 1 for native resolution)
+	Tolerance int          // Color distance from the background above which a pixel counts as drawn (0 uses the default)
+	Offset    *image.Point // Position of the text in the downscaled screenshot (nil searches for the best match)
+}
+
+// GlyphMismatch is a character of the expected box whose pixels differ from the screenshot
+type GlyphMismatch struct {
+	Char   string `json:"char" yaml:"char"`
+	Line   int    `json:"line" yaml:"line"`     // Line of the character in the box, from 0
+	X      int    `json:"x" yaml:"x"`           // Position of the character in the box
+	Pixels int    `json:"pixels" yaml:"pixels"` // Number of differing pixels inside the character cell
+}
+
+// ScreenshotDiffReport is the result of comparing a screenshot with the expected text box
+type ScreenshotDiffReport struct {
+	DialogueID int             `json:"dialogue_id" yaml:"dialogue_id"`
+	Box        int             `json:"box" yaml:"box"`
+	Text       string          `json:"text" yaml:"text"`
+	OffsetX    int             `json:"offset_x" yaml:"offset_x"` // Position of the box in the downscaled screenshot
+	OffsetY    int             `json:"offset_y" yaml:"offset_y"`
+	Pixels     int             `json:"pixels" yaml:"pixels"`         // Pixels compared
+	Mismatched int             `json:"mismatched" yaml:"mismatched"` // Pixels drawn in only one of the images
+	Glyphs     []GlyphMismatch `json:"glyphs,omitempty" yaml:"glyphs,omitempty"`
+
+	// Diff shows the aligned box: white where both images draw, red where only the expected
+	// box draws and green where only the screenshot draws
+	Diff *image.RGBA `json:"-" yaml:"-"`
+}
+
+// Matches reports whether the screenshot shows exactly the expected box
+func (r *ScreenshotDiffReport) Matches() bool {
+	return r.Mismatched == 0
+}
+
+// dialogueBoxTexts returns the text of every box of a dialogue. A box item starts a new box
+// once text has been written, and [PAGE] separates boxes inside a text item.
+func dialogueBoxTexts(entry DialogueEntry) []string {
+	boxes := []string{""}
+	for _, contentItem := range entry.Content {
+		if _, isBox := contentItem["box"]; isBox && boxes[len(boxes)-1] != "" {
+			boxes = append(boxes, "")
+		}
+		text, ok := contentItem["text"].(string)
+		if !ok {
+			continue
+		}
+		pages := strings.Split(text, PageBreakTag)
+		boxes[len(boxes)-1] += pages[0]
+		boxes = append(boxes, pages[1:]...)
+	}
+	return boxes
+}
+
+// CompareScreenshot renders a box of a dialogue and compares it with an emulator screenshot
+// of that box. The screenshot is downscaled by options.Scale, its background is taken as its
+// most common color, and pixels farther from it than the tolerance count as drawn. Unless an
+// offset is given, the expected box is placed where the fewest pixels differ.
+func (r *TextRenderer) CompareScreenshot(entry DialogueEntry, screenshot image.Image, options ScreenshotDiffOptions) (*ScreenshotDiffReport, error) {
+	boxes := dialogueBoxTexts(entry)
+	if options.Box < 0 || options.Box >= len(boxes) {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("dialogue %d has %d boxes, box %d does not exist", entry.ID, len(boxes), options.Box))
+	}
+
+	text := boxes[options.Box]
+	layout, err := r.layoutString(text, entry.FontHeight, options.Width)
+	if err != nil {
+		return nil, err
+	}
+	expected := inkMask(r.draw(layout))
+
+	scale := max(options.Scale, 1)
+	tolerance := options.Tolerance
+	if tolerance <= 0 {
+		tolerance = DefaultScreenshotTolerance
+	}
+	actual := screenshotMask(screenshot, scale, tolerance)
+	if actual.width < expected.width || actual.height < expected.height {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("the screenshot (%dx%d at scale %d) is smaller than the expected box (%dx%d)",
+				actual.width, actual.height, scale, expected.width, expected.height))
+	}
+
+	offset := image.Point{}
+	if options.Offset != nil {
+		offset = *options.Offset
+		if offset.X < 0 || offset.Y < 0 || offset.X+expected.width > actual.width || offset.Y+expected.height > actual.height {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("the expected box at offset %d,%d does not fit in the screenshot", offset.X, offset.Y))
+		}
+	} else {
+		offset = bestAlignment(expected, actual)
+	}
+	common.LogDebug("Dialogue %d box %d aligned at %d,%d", entry.ID, options.Box, offset.X, offset.Y)
+
+	report := &ScreenshotDiffReport{
+		DialogueID: entry.ID,
+		Box:        options.Box,
+		Text:       text,
+		OffsetX:    offset.X,
+		OffsetY:    offset.Y,
+		Pixels:     expected.width * expected.height,
+		Diff:       image.NewRGBA(image.Rect(0, 0, expected.width, expected.height)),
+	}
+	for y := 0; y < expected.height; y++ {
+		for x := 0; x < expected.width; x++ {
+			want := expected.at(x, y)
+			got := actual.at(x+offset.X, y+offset.Y)
+			switch {
+			case want && got:
+				report.Diff.SetRGBA(x, y, diffMatchColor)
+			case want:
+				report.Diff.SetRGBA(x, y, diffExpectedColor)
+			case got:
+				report.Diff.SetRGBA(x, y, diffExtraColor)
+			default:
+				report.Diff.SetRGBA(x, y, diffEmptyColor)
+			}
+			if want != got {
+				report.Mismatched++
+			}
+		}
+	}
+
+	for _, placed := range layout.Glyphs {
+		pixels := 0
+		for y := placed.Rect.Min.Y; y < placed.Rect.Max.Y; y++ {
+			for x := placed.Rect.Min.X; x < placed.Rect.Max.X; x++ {
+				if expected.at(x, y) != actual.at(x+offset.X, y+offset.Y) {
+					pixels++
+				}
+			}
+		}
+		if pixels > 0 {
+			report.Glyphs = append(report.Glyphs, GlyphMismatch{Char: placed.Char, Line: placed.Line, X: placed.Rect.Min.X, Pixels: pixels})
+		}
+	}
+
+	return report, nil
+}
+
+// pixelMask records which pixels of an image are drawn
+type pixelMask struct {
+	width, height int
+	bits          []bool
+}
+
+// at reports whether a pixel is drawn; pixels outside the mask are not
+func (m *pixelMask) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= m.width || y >= m.height {
+		return false
+	}
+	return m.bits[y*m.width+x]
+}
+
+// inkMask marks the non-transparent pixels of a rendered box
+func inkMask(img *image.RGBA) *pixelMask {
+	bounds := img.Bounds()
+	mask := &pixelMask{width: bounds.Dx(), height: bounds.Dy(), bits: make([]bool, bounds.Dx()*bounds.Dy())}
+	for y := 0; y < mask.height; y++ {
+		for x := 0; x < mask.width; x++ {
+			mask.bits[y*mask.width+x] = img.RGBAAt(bounds.Min.X+x, bounds.Min.Y+y).A != 0
+		}
+	}
+	return mask
+}
+
+// screenshotMask downscales a screenshot by sampling the center of every scale x scale block
+// and marks the pixels whose color is farther than tolerance from the most common color
+func screenshotMask(img image.Image, scale, tolerance int) *pixelMask {
+	bounds := img.Bounds()
+	mask := &pixelMask{width: bounds.Dx() / scale, height: bounds.Dy() / scale}
+	mask.bits = make([]bool, mask.width*mask.height)
+
+	samples := make([]color.RGBA, len(mask.bits))
+	counts := make(map[color.RGBA]int)
+	var background color.RGBA
+	for y := 0; y < mask.height; y++ {
+		for x := 0; x < mask.width; x++ {
+			sample := color.RGBAModel.Convert(img.At(bounds.Min.X+x*scale+scale/2, bounds.Min.Y+y*scale+scale/2)).(color.RGBA)
+			samples[y*mask.width+x] = sample
+			counts[sample]++
+			if counts[sample] > counts[background] {
+				background = sample
+			}
+		}
+	}
+
+	for i, sample := range samples {
+		mask.bits[i] = colorDistance(sample, background) > tolerance
+	}
+	return mask
+}
+
+// colorDistance returns the largest difference between the channels of two colors
+func colorDistance(a, b color.RGBA) int {
+	distance := 0
+	for _, pair := range [][2]uint8{{a.R, b.R}, {a.G, b.G}, {a.B, b.B}} {
+		distance = max(distance, abs(int(pair[0])-int(pair[1])))
+	}
+	return distance
+}
+
+// abs returns the absolute value of n
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+// bestAlignment returns the position of the expected box in the screenshot where the fewest
+// pixels differ. For every candidate the difference is the drawn pixels of both areas minus
+// twice the pixels drawn in both, using a summed-area table of the screenshot.
+func bestAlignment(expected, actual *pixelMask) image.Point {
+	stride := actual.width + 1
+	sums := make([]int, stride*(actual.height+1))
+	for y := 0; y < actual.height; y++ {
+		for x := 0; x < actual.width; x++ {
+			drawn := 0
+			if actual.bits[y*actual.width+x] {
+				drawn = 1
+			}
+			sums[(y+1)*stride+x+1] = drawn + sums[y*stride+x+1] + sums[(y+1)*stride+x] - sums[y*stride+x]
+		}
+	}
+
+	var inked []image.Point
+	for y := 0; y < expected.height; y++ {
+		for x := 0; x < expected.width; x++ {
+			if expected.bits[y*expected.width+x] {
+				inked = append(inked, image.Pt(x, y))
+			}
+		}
+	}
+
+	best, bestScore := image.Point{}, -1
+	for oy := 0; oy+expected.height <= actual.height; oy++ {
+		for ox := 0; ox+expected.width <= actual.width; ox++ {
+			area := sums[(oy+expected.height)*stride+ox+expected.width] - sums[oy*stride+ox+expected.width] -
+				sums[(oy+expected.height)*stride+ox] + sums[oy*stride+ox]
+			both := 0
+			for _, p := range inked {
+				if actual.bits[(p.Y+oy)*actual.width+p.X+ox] {
+					both++
+				}
+			}
+			score := len(inked) + area - 2*both
+			if bestScore < 0 || score < bestScore {
+				best, bestScore = image.Pt(ox, oy), score
+			}
+		}
+	}
+	return best
+}
+
+// LoadDialogue reads a dialogue YAML file and returns the dialogue with the given ID
+func LoadDialogue(yamlFile string, id int) (*DialogueEntry, error) {
+	dialogues, err := dialogueyaml.Read(yamlFile)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dialogues.Dialogues {
+		if dialogues.Dialogues[i].ID == id {
+			return &dialogues.Dialogues[i], nil
+		}
+	}
+	return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("dialogue %d not found in %s", id, yamlFile))
+}
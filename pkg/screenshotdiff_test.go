@@ -0,0 +1,94 @@
+// Package pkg provides tests for comparing emulator screenshots with the expected text boxes
+package pkg
+
+import (
+	"image"
+	"image/color"
+	"reflect"
+	"testing"
+)
+
+// newTestScreenshot draws text with the renderer on a 160x120 box background at the given
+// position and upscales it by scale, the way an emulator window shows it
+func newTestScreenshot(t *testing.T, renderer *TextRenderer, text string, at image.Point, scale int) image.Image {
+	t.Helper()
+	rendered, err := renderer.RenderString(text, 16, 0)
+	if err != nil {
+		t.Fatalf("RenderString() failed: %v", err)
+	}
+
+	background := color.RGBA{R: 0x10, G: 0x10, B: 0x60, A: 0xFF}
+	ink := color.RGBA{R: 0xF0, G: 0xF0, B: 0xF0, A: 0xFF}
+	screenshot := image.NewRGBA(image.Rect(0, 0, 160*scale, 120*scale))
+	for y := 0; y < 120*scale; y++ {
+		for x := 0; x < 160*scale; x++ {
+			pixel := background
+			rx, ry := x/scale-at.X, y/scale-at.Y
+			if image.Pt(rx, ry).In(rendered.Bounds()) {
+				if _, _, _, a := rendered.At(rx, ry).RGBA(); a != 0 {
+					pixel = ink
+				}
+			}
+			screenshot.SetRGBA(x, y, pixel)
+		}
+	}
+	return screenshot
+}
+
+func TestTextRenderer_CompareScreenshot(t *testing.T) {
+	wfm, fontDir := newRenderTestFont(t)
+	renderer, err := NewTextRenderer(wfm, fontDir)
+	if err != nil {
+		t.Fatalf("NewTextRenderer() failed: %v", err)
+	}
+	entry := DialogueEntry{ID: 7, FontHeight: 16, Content: []map[string]interface{}{{"text": "AB[PAGE]A B"}}}
+
+	report, err := renderer.CompareScreenshot(entry, newTestScreenshot(t, renderer, "AB", image.Pt(10, 20), 2), ScreenshotDiffOptions{Scale: 2})
+	if err != nil {
+		t.Fatalf("CompareScreenshot() failed: %v", err)
+	}
+	if report.OffsetX != 10 || report.OffsetY != 20 {
+		t.Errorf("offset = %d,%d, want 10,20", report.OffsetX, report.OffsetY)
+	}
+	if !report.Matches() || len(report.Glyphs) != 0 {
+		t.Errorf("matching screenshot reported %d mismatched pixels and glyphs %v", report.Mismatched, report.Glyphs)
+	}
+
+	// The second box expects "A B" while the game drew "AB"
+	offset := image.Pt(10, 20)
+	options := ScreenshotDiffOptions{Box: 1, Scale: 2, Offset: &offset}
+	report, err = renderer.CompareScreenshot(entry, newTestScreenshot(t, renderer, "AB", offset, 2), options)
+	if err != nil {
+		t.Fatalf("CompareScreenshot() failed: %v", err)
+	}
+	wantGlyphs := []GlyphMismatch{{Char: " ", X: 4, Pixels: 64}, {Char: "B", X: 8, Pixels: 64}}
+	if !reflect.DeepEqual(report.Glyphs, wantGlyphs) {
+		t.Errorf("glyph mismatches = %v, want %v", report.Glyphs, wantGlyphs)
+	}
+	if report.Mismatched != 128 {
+		t.Errorf("mismatched pixels = %d, want 128", report.Mismatched)
+	}
+	if got := report.Diff.RGBAAt(5, 0); got != diffExtraColor {
+		t.Errorf("diff pixel (5, 0) = %v, want the screenshot-only color", got)
+	}
+	if got := report.Diff.RGBAAt(9, 0); got != diffExpectedColor {
+		t.Errorf("diff pixel (9, 0) = %v, want the expected-only color", got)
+	}
+
+	if _, err := renderer.CompareScreenshot(entry, newTestScreenshot(t, renderer, "AB", offset, 1), ScreenshotDiffOptions{Box: 2}); err == nil {
+		t.Error("CompareScreenshot() should fail for a box the dialogue does not have")
+	}
+}
+
+func TestDialogueBoxTexts(t *testing.T) {
+	entry := DialogueEntry{Content: []map[string]interface{}{
+		{"box": map[string]interface{}{"width": 100, "height": 40}},
+		{"text": "One"},
+		{"box": map[string]interface{}{"width": 100, "height": 40}},
+		{"text": "Two[PAGE]Three"},
+	}}
+	want := []string{"One", "Two", "Three"}
+	if got := dialogueBoxTexts(entry); !reflect.DeepEqual(got, want) {
+		t.Errorf("dialogueBoxTexts() = %q, want %q", got, want)
+	}
+}
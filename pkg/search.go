@@ -0,0 +1,314 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the disc-wide text search, which looks for a term in every file of a
+// CD image: decompressed GAM payloads, decoded WFM dialogues and the raw bytes of all
+// other files (executables included), and its report writers.
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// DefaultSearchContext is the number of bytes (or characters) shown around each match
+const DefaultSearchContext = 16
+
+// Kinds of data a search match was found in
+const (
+	SearchKindRaw = "raw" // Raw file bytes (executables, tables, anything not decoded)
+	SearchKindGAM = "gam" // Decompressed GAM payload
+	SearchKindWFM = "wfm" // Decoded WFM dialogue text
+)
+
+// searchEncodings are the byte encodings of the term looked for in raw and GAM data
+var searchEncodings = []string{EncodingUTF8, EncodingShiftJIS, EncodingWindows1252}
+
+// SearchOptions controls how a search is performed
+type SearchOptions struct {
+	IgnoreCase  bool   // Match ASCII letters regardless of case
+	FontDir     string // Reference font directory used to decode WFM dialogues (default: fonts)
+	ContextSize int    // Bytes or characters shown around each match (0 uses DefaultSearchContext)
+}
+
+// SearchMatch is a single occurrence of the search term
+type SearchMatch struct {
+	File     string `json:"file"`
+	Kind     string `json:"kind"`
+	Offset   int64  `json:"offset"`             // Byte offset in the file, GAM payload or WFM file
+	Dialogue int    `json:"dialogue,omitempty"` // Dialogue ID for WFM matches
+	Encoding string `json:"encoding,omitempty"` // Byte encoding that matched (raw and GAM matches)
+	Context  string `json:"context"`
+}
+
+// SearchReport lists every occurrence of the term found in a CD image
+type SearchReport struct {
+	Image        string        `json:"image"`
+	Term         string        `json:"term"`
+	FilesScanned int           `json:"files_scanned"`
+	Matches      []SearchMatch `json:"matches"`
+}
+
+// Search looks for term in every file of a CD image
+func (p *CDFileProcessor) Search(imageFile, term string, options SearchOptions) (*SearchReport, error) {
+	if term == "" {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("search term is empty"))
+	}
+	if options.FontDir == "" {
+		options.FontDir = DefaultFontDir
+	}
+	if options.ContextSize <= 0 {
+		options.ContextSize = DefaultSearchContext
+	}
+
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	if err := reader.ValidateISO9660(); err != nil {
+		return nil, fmt.Errorf("invalid ISO9660 image: %w", err)
+	}
+
+	files, err := reader.ListFiles()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CD image files: %w", err)
+	}
+
+	report := &SearchReport{Image: imageFile, Term: term, Matches: make([]SearchMatch, 0)}
+	for _, entry := range files {
+		if err := common.CheckMemory(entry.Path, int64(entry.Size)); err != nil {
+			common.LogWarn("Skipping %s: %v", entry.Path, err)
+			continue
+		}
+		data, err := reader.ReadEntry(entry)
+		if err != nil {
+			common.LogWarn("Skipping %s: %v", entry.Path, err)
+			continue
+		}
+		report.FilesScanned++
+		report.Matches = append(report.Matches, SearchData(entry.Path, data, term, options)...)
+	}
+
+	p.logger.Debug("Searched %d files of %s: %d matches", report.FilesScanned, imageFile, len(report.Matches))
+	return report, nil
+}
+
+// SearchData looks for term in the contents of a single file. GAM files are searched
+// after decompression and WFM files through their decoded dialogues; everything else
+// is scanned byte by byte.
+func SearchData(name string, data []byte, term string, options SearchOptions) []SearchMatch {
+	if options.ContextSize <= 0 {
+		options.ContextSize = DefaultSearchContext
+	}
+
+	switch {
+	case bytes.HasPrefix(data, []byte("GAM")):
+		gam, err := NewGAMProcessor().DecodeGAM(data)
+		if err == nil {
+			return searchBytes(name, SearchKindGAM, gam.UncompressedData, term, options)
+		}
+		common.LogDebug("%s looks like a GAM file but could not be decompressed: %v", name, err)
+	case bytes.HasPrefix(data, []byte("WFM3")):
+		matches, err := searchWFM(name, data, term, options)
+		if err == nil {
+			return matches
+		}
+		common.LogDebug("%s looks like a WFM file but could not be decoded: %v", name, err)
+	}
+
+	return searchBytes(name, SearchKindRaw, data, term, options)
+}
+
+// searchWFM decodes the dialogues of a WFM file and looks for term in their text
+func searchWFM(name string, data []byte, term string, options SearchOptions) ([]SearchMatch, error) {
+	wfm, err := NewWFMDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	exporter := NewWFMExporter()
+	glyphMapping, err := exporter.buildGlyphMappingFromGlyphs(wfm.Glyphs, options.FontDir)
+	if err != nil {
+		common.LogDebug("Searching %s without glyph mapping: %v", name, err)
+	}
+
+	needle := []rune(term)
+	if options.IgnoreCase {
+		needle = []rune(strings.ToLower(term))
+	}
+
+	var matches []SearchMatch
+	for i, dialogue := range wfm.Dialogues {
+		content, _, _, _, _ := processDialogueText(dialogue.Data, glyphMapping, wfm.Glyphs, false)
+		text := []rune(strings.Join(dialogueTexts(DialogueEntry{Content: content}), ""))
+		haystack := text
+		if options.IgnoreCase {
+			haystack = []rune(strings.ToLower(string(text)))
+		}
+
+		offset := int64(wfm.Header.DialoguePointerTable)
+		if i < len(wfm.DialoguePointerTable) {
+			offset += int64(wfm.DialoguePointerTable[i])
+		}
+
+		for _, index := range indexAllRunes(haystack, needle) {
+			start := max(index-options.ContextSize, 0)
+			end := min(index+len(needle)+options.ContextSize, len(text))
+			matches = append(matches, SearchMatch{
+				File:     name,
+				Kind:     SearchKindWFM,
+				Offset:   offset,
+				Dialogue: i,
+				Context:  string(text[start:end]),
+			})
+		}
+	}
+	return matches, nil
+}
+
+// searchBytes looks for every encoding of term in data
+func searchBytes(name, kind string, data []byte, term string, options SearchOptions) []SearchMatch {
+	haystack := data
+	if options.IgnoreCase {
+		haystack = asciiLower(data)
+	}
+
+	var matches []SearchMatch
+	seen := make(map[string]bool)
+	for _, encoding := range searchEncodings {
+		needle, err := EncodeText(term, encoding)
+		if err != nil || len(needle) == 0 {
+			continue
+		}
+		if options.IgnoreCase {
+			needle = asciiLower(needle)
+		}
+		// Encodings agree on ASCII terms; report each byte sequence once
+		if seen[string(needle)] {
+			continue
+		}
+		seen[string(needle)] = true
+
+		for offset := 0; ; {
+			index := bytes.Index(haystack[offset:], needle)
+			if index < 0 {
+				break
+			}
+			position := offset + index
+			matches = append(matches, SearchMatch{
+				File:     name,
+				Kind:     kind,
+				Offset:   int64(position),
+				Encoding: encoding,
+				Context:  printableContext(data, position, len(needle), options.ContextSize),
+			})
+			offset = position + 1
+		}
+	}
+	return matches
+}
+
+// indexAllRunes returns the start index of every occurrence of needle in haystack
+func indexAllRunes(haystack, needle []rune) []int {
+	var indexes []int
+	for i := 0; i+len(needle) <= len(haystack); i++ {
+		if string(haystack[i:i+len(needle)]) == string(needle) {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
+
+// asciiLower returns a copy of data with ASCII upper-case letters lowered; other bytes
+// are kept, so offsets stay valid for any encoding
+func asciiLower(data []byte) []byte {
+	lowered := make([]byte, len(data))
+	for i, b := range data {
+		if b >= 'A' && b <= 'Z' {
+			b += 'a' - 'A'
+		}
+		lowered[i] = b
+	}
+	return lowered
+}
+
+// printableContext renders the bytes around a match, replacing non-printable bytes with '.'
+func printableContext(data []byte, position, length, size int) string {
+	start := max(position-size, 0)
+	end := min(position+length+size, len(data))
+
+	var sb strings.Builder
+	for _, b := range data[start:end] {
+		if b >= 0x20 && b < 0x7F {
+			sb.WriteByte(b)
+		} else {
+			sb.WriteByte('.')
+		}
+	}
+	return sb.String()
+}
+
+// WriteSearchReport writes the report in the requested format (json or markdown)
+func WriteSearchReport(report *SearchReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeSearchMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeSearchMarkdown renders the report as a markdown document
+func writeSearchMarkdown(report *SearchReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Search Results for %q\n\n", report.Term))
+	sb.WriteString("| Field | Value |\n")
+	sb.WriteString("|-------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Image | %s |\n", report.Image))
+	sb.WriteString(fmt.Sprintf("| Files scanned | %d |\n", report.FilesScanned))
+	sb.WriteString(fmt.Sprintf("| Matches | %d |\n", len(report.Matches)))
+
+	sb.WriteString("\n## Matches\n\n")
+	if len(report.Matches) == 0 {
+		sb.WriteString("No matches found.\n")
+	} else {
+		sb.WriteString("| File | Kind | Offset | Dialogue | Encoding | Context |\n")
+		sb.WriteString("|------|------|--------|----------|----------|---------|\n")
+		for _, match := range report.Matches {
+			dialogue := "-"
+			if match.Kind == SearchKindWFM {
+				dialogue = fmt.Sprintf("%d", match.Dialogue)
+			}
+			encoding := match.Encoding
+			if encoding == "" {
+				encoding = "-"
+			}
+			sb.WriteString(fmt.Sprintf("| %s | %s | 0x%X | %s | %s | `%s` |\n",
+				match.File, match.Kind, match.Offset, dialogue, encoding, markdownCell(match.Context)))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
+
+// markdownCell escapes the characters that would break a markdown table cell
+func markdownCell(text string) string {
+	return strings.NewReplacer("|", "\\|", "`", "'", "\n", " ").Replace(text)
+}
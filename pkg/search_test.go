@@ -0,0 +1,100 @@
+// Package pkg provides tests for the disc-wide text search
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSearchData_Raw(t *testing.T) {
+	data := []byte("\x00\x01Hello Baron!\x00\x00baron\xFF")
+
+	tests := []struct {
+		name       string
+		options    SearchOptions
+		wantOffset []int64
+	}{
+		{name: "case sensitive", wantOffset: []int64{8}},
+		{name: "ignore case", options: SearchOptions{IgnoreCase: true}, wantOffset: []int64{8, 16}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := SearchData("SLUS_006.23", data, "Baron", tt.options)
+			if len(matches) != len(tt.wantOffset) {
+				t.Fatalf("SearchData() returned %d matches, want %d", len(matches), len(tt.wantOffset))
+			}
+			for i, match := range matches {
+				if match.Offset != tt.wantOffset[i] || match.Kind != SearchKindRaw {
+					t.Errorf("match %d = %s at %d, want raw at %d", i, match.Kind, match.Offset, tt.wantOffset[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSearchData_ShiftJIS(t *testing.T) {
+	term := "トンバ"
+	encoded, err := EncodeText(term, EncodingShiftJIS)
+	if err != nil {
+		t.Fatalf("EncodeText() failed: %v", err)
+	}
+	data := append([]byte("TEXT"), encoded...)
+
+	matches := SearchData("DATA.BIN", data, term, SearchOptions{})
+	if len(matches) != 1 || matches[0].Offset != 4 || matches[0].Encoding != EncodingShiftJIS {
+		t.Errorf("SearchData() = %+v, want one Shift-JIS match at 4", matches)
+	}
+}
+
+func TestSearchData_GAM(t *testing.T) {
+	payload := append(bytes.Repeat([]byte{0x11, 0x22}, 64), []byte("Evil Pig Baron")...)
+	gamPath := filepath.Join(t.TempDir(), "STAGE.GAM")
+	if _, err := NewGAMProcessor().SaveGAM(context.Background(), payload, gamPath); err != nil {
+		t.Fatalf("SaveGAM() failed: %v", err)
+	}
+	data, err := os.ReadFile(gamPath)
+	if err != nil {
+		t.Fatalf("failed to read GAM file: %v", err)
+	}
+
+	matches := SearchData("STAGE.GAM", data, "Baron", SearchOptions{})
+	if len(matches) != 1 {
+		t.Fatalf("SearchData() returned %d matches, want 1", len(matches))
+	}
+	if matches[0].Kind != SearchKindGAM || matches[0].Offset != 137 {
+		t.Errorf("match = %s at %d, want gam at 137", matches[0].Kind, matches[0].Offset)
+	}
+}
+
+func TestPrintableContext(t *testing.T) {
+	got := printableContext([]byte("\x01ab\x00Baron\xFFcd"), 4, 5, 2)
+	if got != "b.Baron.c" {
+		t.Errorf("printableContext() = %q, want %q", got, "b.Baron.c")
+	}
+}
+
+func TestWriteSearchReport(t *testing.T) {
+	report := &SearchReport{
+		Image:        "original.bin",
+		Term:         "Baron",
+		FilesScanned: 2,
+		Matches:      []SearchMatch{{File: "CD/CFNT999H.WFM", Kind: SearchKindWFM, Offset: 0x120, Dialogue: 3, Context: "the Baron|"}},
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteSearchReport(report, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteSearchReport() failed: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "| CD/CFNT999H.WFM | wfm | 0x120 | 3 | - | `the Baron\\|` |") {
+		t.Errorf("markdown report missing match row:\n%s", buffer.String())
+	}
+
+	if err := WriteSearchReport(report, "xml", &buffer); err == nil {
+		t.Error("WriteSearchReport() accepted an unsupported format")
+	}
+}
@@ -0,0 +1,34 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the speaker names of the name tag codes. The codes themselves are
+// in the control code table; decode writes the name of the speaker next to its id, so
+// exported scripts show who is speaking. Encode reads the id only.
+package pkg
+
+import "github.com/hansbonini/tombatools/pkg/common"
+
+// SpeakerNameParam is the key of the speaker name in speaker items, written by decode
+// for translators and ignored by encode
+const SpeakerNameParam = "name"
+
+// SetSpeakerNames sets the names written next to the id of speaker items (nil writes ids only)
+func (e *WFMFileExporter) SetSpeakerNames(names map[uint16]string) {
+	e.speakerNames = names
+}
+
+// nameSpeakers adds the speaker name to every speaker item of a decoded dialogue
+func nameSpeakers(content []map[string]interface{}, names map[uint16]string) {
+	code, _ := LookupControlCode(SPEAKER)
+	for _, item := range content {
+		params, ok := item[code.Content].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		id, err := common.SafeValueToUint16(params[code.Params[0]])
+		if err != nil {
+			continue
+		}
+		if name, found := names[id]; found {
+			params[SpeakerNameParam] = name
+		}
+	}
+}
@@ -0,0 +1,64 @@
+// Package pkg provides tests for the speaker name tag codes
+package pkg
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestProcessDialogueText_SpeakerCodes(t *testing.T) {
+	data := []byte{0x40, 0xC0, 0x03, 0x00, 0x41, 0xC0, 0x40, 0x00, 0x10, 0x00, 0x00, 0x80, 0x42, 0xC0, 0xFF, 0xFF}
+	content, _, _, _, _ := processDialogueText(data, nil, nil, false)
+
+	want := []map[string]interface{}{
+		{"speaker": map[string]interface{}{"id": 3}},
+		{"name_window": map[string]interface{}{"width": 0x40, "height": 0x10}},
+		{"text": "[8000][CLOSE NAME WINDOW]"},
+	}
+	if !reflect.DeepEqual(content, want) {
+		t.Fatalf("processDialogueText() = %v, want %v", content, want)
+	}
+
+	nameSpeakers(content, map[uint16]string{3: "Tomba"})
+	if got := content[0]["speaker"].(map[string]interface{})[SpeakerNameParam]; got != "Tomba" {
+		t.Errorf("speaker name = %v, want Tomba", got)
+	}
+}
+
+func TestWFMFileEncoder_SpeakerCodes(t *testing.T) {
+	encoder := NewWFMEncoder()
+	tests := []struct {
+		item map[string]interface{}
+		want []uint16
+	}{
+		{map[string]interface{}{"speaker": map[string]interface{}{"id": 3, SpeakerNameParam: "Tomba"}}, []uint16{SPEAKER, 3}},
+		{map[string]interface{}{"name_window": map[string]interface{}{"width": 0x40, "height": 0x10}}, []uint16{NAME_WINDOW, 0x40, 0x10}},
+	}
+	for _, tt := range tests {
+		got, _, err := encoder.processContentItem(tt.item, 16, nil, 0)
+		if err != nil {
+			t.Fatalf("processContentItem(%v) failed: %v", tt.item, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("processContentItem(%v) = %04X, want %04X", tt.item, got, tt.want)
+		}
+	}
+}
+
+func TestNameSpeakers_NumericForms(t *testing.T) {
+	content := []map[string]interface{}{
+		{"speaker": map[string]interface{}{"id": uint64(3)}},
+		{"speaker": map[string]interface{}{"id": "0x3"}},
+		{"speaker": map[string]interface{}{"id": 3.0}},
+		{"speaker": map[string]interface{}{"id": "Tomba"}},
+	}
+	nameSpeakers(content, map[uint16]string{3: "Tomba"})
+	for i, item := range content[:3] {
+		if got := item["speaker"].(map[string]interface{})[SpeakerNameParam]; got != "Tomba" {
+			t.Errorf("item %d speaker name = %v, want Tomba", i, got)
+		}
+	}
+	if _, named := content[3]["speaker"].(map[string]interface{})[SpeakerNameParam]; named {
+		t.Error("speaker with an invalid id should not be named")
+	}
+}
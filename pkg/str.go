@@ -0,0 +1,146 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the STR movie processor: the video sectors of a movie are joined
+// into MDEC frames written as a PNG sequence, and its interleaved XA-ADPCM audio is
+// written as WAV, so translators can time subtitles against the FMVs.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// STRReport describes a decoded movie
+type STRReport struct {
+	Source  string     `json:"source"`
+	Sectors int        `json:"sectors"`
+	Width   int        `json:"width"`
+	Height  int        `json:"height"`
+	Frames  int        `json:"frames"`  // Frames written as PNG
+	Skipped int        `json:"skipped"` // Frames whose bitstream could not be decoded
+	Streams []XAStream `json:"streams"` // Audio streams written as WAV
+}
+
+// STRProcessor decodes STR movies
+type STRProcessor struct {
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
+
+// NewSTRProcessor creates a new STR movie processor instance
+func NewSTRProcessor() *STRProcessor {
+	return &STRProcessor{}
+}
+
+// SetLogger sets the logging configuration of the processor (nil follows SetVerboseMode)
+func (p *STRProcessor) SetLogger(logger *common.Logger) {
+	p.logger = logger
+}
+
+// loadSTRFile reads the sectors of a movie. Movies read from the disc or dumped with
+// their subheaders (2336-byte or 2352-byte sectors) come back as an XA file; movies
+// copied by cd dump keep only 2048 bytes per sector, the video without the audio, and
+// come back as those sectors.
+func loadSTRFile(source, imageFile string) (*psx.XAFile, [][]byte, error) {
+	if imageFile != "" {
+		xa, err := LoadXAFile(source, imageFile)
+		return xa, nil, err
+	}
+
+	data, err := os.ReadFile(source)
+	if err != nil {
+		return nil, nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read %s: %w", source, err))
+	}
+	if _, ok := psx.ParseSTRSectorHeader(data); ok && len(data)%psx.CD_DATA_SIZE == 0 {
+		var sectors [][]byte
+		for offset := 0; offset < len(data); offset += psx.CD_DATA_SIZE {
+			sectors = append(sectors, data[offset:offset+psx.CD_DATA_SIZE])
+		}
+		return nil, sectors, nil
+	}
+	xa, err := psx.ParseXAFile(data)
+	return xa, nil, err
+}
+
+// Decode writes the frames of a movie to outputDir as frame_NNNNN.png (numbered as the
+// sector headers number them) and its audio streams as WAV files named as xa decode names
+// them. The source is a local file or, with imageFile, a path of the disc.
+func (p *STRProcessor) Decode(ctx context.Context, source, imageFile, outputDir string) (*STRReport, error) {
+	xa, sectors, err := loadSTRFile(source, imageFile)
+	if err != nil {
+		return nil, err
+	}
+	if xa != nil {
+		for i := range xa.Sectors {
+			// Audio sectors hold no video; the user data of the others follows the subheader
+			if !xa.Subheader(i).IsAudio() {
+				sectors = append(sectors, xa.Payload(i)[psx.CD_SUBHEADER_SIZE:psx.CD_SUBHEADER_SIZE+psx.CD_DATA_SIZE])
+			}
+		}
+	}
+	if err := os.MkdirAll(outputDir, 0o750); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", outputDir, err))
+	}
+
+	report := &STRReport{Source: source, Sectors: len(sectors), Streams: []XAStream{}}
+	demuxer := &psx.STRDemuxer{}
+	for _, sector := range sectors {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+		frame, err := demuxer.AddSector(sector)
+		if err != nil {
+			return nil, err
+		}
+		if frame == nil {
+			continue
+		}
+
+		img, err := psx.DecodeMDECFrame(frame.Data, frame.Width, frame.Height)
+		if err != nil {
+			common.LogWarn("Frame %d of %s: %v; skipped", frame.Number, source, err)
+			report.Skipped++
+			continue
+		}
+		framePath := filepath.Join(outputDir, fmt.Sprintf("frame_%05d.png", frame.Number))
+		if err := writeFramePNG(framePath, img); err != nil {
+			return nil, err
+		}
+		report.Width, report.Height = frame.Width, frame.Height
+		report.Frames++
+		p.logger.Debug("Frame %d: %dx%d, %d bytes written to %s", frame.Number, frame.Width, frame.Height, len(frame.Data), framePath)
+	}
+	demuxer.Flush()
+
+	if xa != nil {
+		audio := NewXAProcessor()
+		audio.SetLogger(p.logger)
+		if report.Streams, err = audio.decodeStreams(ctx, xa, source, outputDir); err != nil {
+			return nil, err
+		}
+		report.Sectors = len(xa.Sectors)
+	}
+	if report.Frames == 0 && len(report.Streams) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("%s holds no decodable video frames or XA audio", source))
+	}
+	return report, nil
+}
+
+// writeFramePNG writes a decoded frame atomically
+func writeFramePNG(path string, img image.Image) error {
+	file, err := common.CreateAtomic(path)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", path, err))
+	}
+	defer file.Abort()
+
+	if err := png.Encode(file, img); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode %s: %w", path, err))
+	}
+	return file.Commit()
+}
@@ -0,0 +1,99 @@
+// Package pkg provides tests for the STR movie processor
+package pkg
+
+import (
+	"context"
+	"encoding/binary"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// strTestVideo returns the user data of the single video sector of a 16x16 frame whose
+// six blocks hold a DC of 0 (mid gray)
+func strTestVideo(frame uint32) []byte {
+	sector := make([]byte, psx.CD_DATA_SIZE)
+	copy(sector, []byte{0x60, 0x01, 0x01, 0x80})
+	binary.LittleEndian.PutUint16(sector[6:], 1)
+	binary.LittleEndian.PutUint32(sector[8:], frame)
+	binary.LittleEndian.PutUint16(sector[16:], 16)
+	binary.LittleEndian.PutUint16(sector[18:], 16)
+
+	// Frame header, then six blocks of a zero DC (10 bits) and an end of block (10),
+	// 72 bits in 16-bit little-endian words
+	bitstream := sector[psx.STR_HEADER_SIZE:]
+	binary.LittleEndian.PutUint16(bitstream[2:], psx.MDEC_FRAME_MAGIC)
+	binary.LittleEndian.PutUint16(bitstream[4:], 1)
+	binary.LittleEndian.PutUint16(bitstream[6:], 2)
+	for block := 0; block < 6; block++ {
+		bit := block*12 + 10
+		word := psx.MDEC_FRAME_HEADER_SIZE + bit/16*2
+		binary.LittleEndian.PutUint16(bitstream[word:], binary.LittleEndian.Uint16(bitstream[word:])|1<<(15-bit%16))
+	}
+	return sector
+}
+
+func TestSTRProcessor_Decode(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two frames and an audio sector of channel 1 in 2336-byte sectors
+	var data []byte
+	for _, frame := range []uint32{1, 2} {
+		sector := make([]byte, psx.CD_XA_DATA_SIZE)
+		copy(sector, []byte{1, 0, psx.XA_SUBMODE_DATA, 0, 1, 0, psx.XA_SUBMODE_DATA, 0})
+		copy(sector[psx.CD_SUBHEADER_SIZE:], strTestVideo(frame))
+		data = append(data, sector...)
+	}
+	audio := make([]byte, psx.CD_XA_DATA_SIZE)
+	copy(audio, []byte{1, 1, psx.XA_SUBMODE_AUDIO | psx.XA_SUBMODE_FORM2, 0, 1, 1, psx.XA_SUBMODE_AUDIO | psx.XA_SUBMODE_FORM2, 0})
+	data = append(data, audio...)
+	source := filepath.Join(dir, "OPENING.STR")
+	if err := os.WriteFile(source, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	outputDir := filepath.Join(dir, "out")
+	report, err := NewSTRProcessor().Decode(context.Background(), source, "", outputDir)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if report.Frames != 2 || report.Skipped != 0 || report.Width != 16 || report.Height != 16 || report.Sectors != 3 {
+		t.Errorf("report = %+v, want 2 frames of 16x16 from 3 sectors", report)
+	}
+	if len(report.Streams) != 1 || report.Streams[0].Channel != 1 {
+		t.Errorf("streams = %+v, want channel 1", report.Streams)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, XAWAVName(source, 1, 1))); err != nil {
+		t.Errorf("WAV of channel 1 missing: %v", err)
+	}
+
+	file, err := os.Open(filepath.Join(outputDir, "frame_00002.png"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	img, err := png.Decode(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := color.NRGBAModel.Convert(img.At(8, 8)); got != (color.NRGBA{128, 128, 128, 255}) {
+		t.Errorf("pixel 8,8 = %v, want gray 128", got)
+	}
+
+	// A copy made by cd dump keeps the 2048-byte video sectors only
+	dumped := filepath.Join(dir, "DUMPED.STR")
+	if err := os.WriteFile(dumped, append(strTestVideo(1), strTestVideo(2)...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	report, err = NewSTRProcessor().Decode(context.Background(), dumped, "", filepath.Join(dir, "dumped"))
+	if err != nil {
+		t.Fatalf("Decode(dumped) failed: %v", err)
+	}
+	if report.Frames != 2 || len(report.Streams) != 0 {
+		t.Errorf("dumped report = %+v, want 2 frames and no audio", report)
+	}
+}
@@ -0,0 +1,279 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the profile-driven extractor and injector for fixed-length
+// string tables (item and event names) stored inside GAM payloads.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// StringTableDefinition describes a fixed-length string table inside a GAM payload
+type StringTableDefinition struct {
+	Name       string `yaml:"name"`
+	Offset     int    `yaml:"offset"`               // Offset of the first entry in the decompressed payload
+	Stride     int    `yaml:"stride"`               // Distance in bytes between entries
+	Count      int    `yaml:"count"`                // Number of entries
+	Length     int    `yaml:"length,omitempty"`     // Maximum string length in bytes (defaults to stride)
+	Charset    string `yaml:"charset,omitempty"`    // ascii, windows-1252 or shift-jis (defaults to ascii)
+	Terminator int    `yaml:"terminator,omitempty"` // Byte ending a string shorter than the length
+	PadByte    *int   `yaml:"pad_byte,omitempty"`   // Byte filling unused space (defaults to the terminator)
+}
+
+// StringTableFileProfile lists the string tables of a single GAM file
+type StringTableFileProfile struct {
+	Tables []StringTableDefinition `yaml:"tables"`
+}
+
+// StringTableProfile maps GAM file names to their string table layouts
+type StringTableProfile struct {
+	Files map[string]StringTableFileProfile `yaml:"files"`
+}
+
+// StringTableEntry is a single translatable string of a table
+type StringTableEntry struct {
+	Index int    `yaml:"index"`
+	Text  string `yaml:"text"`
+}
+
+// StringTable holds the extracted strings of a table
+type StringTable struct {
+	Name    string             `yaml:"name"`
+	Entries []StringTableEntry `yaml:"entries"`
+}
+
+// StringTablesYAML is the translatable strings document written by the extractor
+type StringTablesYAML struct {
+	File   string        `yaml:"file"`
+	Tables []StringTable `yaml:"tables"`
+}
+
+// StringTableProcessor extracts and injects fixed-length string tables in GAM files
+type StringTableProcessor struct {
+	gam *GAMProcessor
+}
+
+// NewStringTableProcessor creates a new string table processor instance
+func NewStringTableProcessor() *StringTableProcessor {
+	return &StringTableProcessor{gam: NewGAMProcessor()}
+}
+
+// LoadStringTableProfile loads a string table profile from a YAML file
+func LoadStringTableProfile(profileFile string) (*StringTableProfile, error) {
+	data, err := os.ReadFile(profileFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table profile: %w", err)
+	}
+
+	var profile StringTableProfile
+	if err := yaml.Unmarshal(data, &profile); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse table profile: %w", err))
+	}
+
+	return &profile, nil
+}
+
+// TablesFor returns the table definitions configured for a GAM file (matched by base name)
+func (p *StringTableProfile) TablesFor(gamFile string) ([]StringTableDefinition, error) {
+	baseName := filepath.Base(gamFile)
+	for name, fileProfile := range p.Files {
+		if strings.EqualFold(name, baseName) {
+			return fileProfile.Tables, nil
+		}
+	}
+	return nil, fmt.Errorf("no string tables configured for %s", baseName)
+}
+
+// length returns the maximum string length of the table
+func (d StringTableDefinition) length() int {
+	if d.Length > 0 {
+		return d.Length
+	}
+	return d.Stride
+}
+
+// charset returns the table charset, defaulting to ASCII
+func (d StringTableDefinition) charset() string {
+	if d.Charset == "" {
+		return EncodingASCII
+	}
+	return d.Charset
+}
+
+// padByte returns the byte filling unused string space
+func (d StringTableDefinition) padByte() byte {
+	if d.PadByte != nil {
+		return byte(*d.PadByte)
+	}
+	return byte(d.Terminator)
+}
+
+// validate checks the table definition against the payload size
+func (d StringTableDefinition) validate(payloadSize int) error {
+	if d.Offset < 0 || d.Stride <= 0 || d.Count <= 0 {
+		return fmt.Errorf("table %s: offset, stride and count must be positive", d.Name)
+	}
+	if d.length() > d.Stride {
+		return fmt.Errorf("table %s: length %d exceeds stride %d", d.Name, d.length(), d.Stride)
+	}
+	if d.Terminator < 0 || d.Terminator > 0xFF || (d.PadByte != nil && (*d.PadByte < 0 || *d.PadByte > 0xFF)) {
+		return fmt.Errorf("table %s: terminator and pad byte must be in range 0x00-0xFF", d.Name)
+	}
+
+	end := d.Offset + (d.Count-1)*d.Stride + d.length()
+	if end > payloadSize {
+		return fmt.Errorf("table %s: ends at 0x%X beyond payload size 0x%X", d.Name, end, payloadSize)
+	}
+	return nil
+}
+
+// ReadTable decodes the strings of a table from a decompressed payload
+func (p *StringTableProcessor) ReadTable(data []byte, definition StringTableDefinition) (*StringTable, error) {
+	if err := definition.validate(len(data)); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	table := &StringTable{Name: definition.Name}
+	for index := 0; index < definition.Count; index++ {
+		start := definition.Offset + index*definition.Stride
+		raw := data[start : start+definition.length()]
+		if end := bytes.IndexByte(raw, byte(definition.Terminator)); end >= 0 {
+			raw = raw[:end]
+		}
+
+		text, _, err := DecodeText(raw, definition.charset())
+		if err != nil {
+			return nil, fmt.Errorf("table %s entry %d: %w", definition.Name, index, err)
+		}
+
+		table.Entries = append(table.Entries, StringTableEntry{Index: index, Text: text})
+	}
+
+	common.LogDebug("Read table %s: %d entries at 0x%X", definition.Name, definition.Count, definition.Offset)
+	return table, nil
+}
+
+// WriteTable encodes the strings of a table into a decompressed payload
+func (p *StringTableProcessor) WriteTable(data []byte, definition StringTableDefinition, table StringTable) error {
+	if err := definition.validate(len(data)); err != nil {
+		return common.WithCategory(common.ErrCategoryValidationFailed, err)
+	}
+
+	for _, entry := range table.Entries {
+		if entry.Index < 0 || entry.Index >= definition.Count {
+			return common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("table %s: entry index %d out of range (count %d)", definition.Name, entry.Index, definition.Count))
+		}
+
+		encoded, err := EncodeText(entry.Text, definition.charset())
+		if err != nil {
+			return fmt.Errorf("table %s entry %d: %w", definition.Name, entry.Index, err)
+		}
+		if len(encoded) > definition.length() {
+			return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("table %s entry %d: %q is %d bytes, maximum is %d",
+				definition.Name, entry.Index, entry.Text, len(encoded), definition.length()))
+		}
+
+		start := definition.Offset + entry.Index*definition.Stride
+		slot := data[start : start+definition.length()]
+		copy(slot, encoded)
+		if len(encoded) < len(slot) {
+			slot[len(encoded)] = byte(definition.Terminator)
+			for i := len(encoded) + 1; i < len(slot); i++ {
+				slot[i] = definition.padByte()
+			}
+		}
+	}
+
+	common.LogDebug("Wrote table %s: %d entries at 0x%X", definition.Name, len(table.Entries), definition.Offset)
+	return nil
+}
+
+// Extract reads every configured table of a GAM file and writes them to a YAML file
+func (p *StringTableProcessor) Extract(gamFile string, profile *StringTableProfile, outputFile string) error {
+	definitions, err := profile.TablesFor(gamFile)
+	if err != nil {
+		return err
+	}
+
+	gam, err := p.gam.LoadGAM(gamFile)
+	if err != nil {
+		return err
+	}
+
+	document := StringTablesYAML{File: filepath.Base(gamFile)}
+	for _, definition := range definitions {
+		table, err := p.ReadTable(gam.UncompressedData, definition)
+		if err != nil {
+			return err
+		}
+		document.Tables = append(document.Tables, *table)
+	}
+
+	yamlWriter, err := common.CreateOutput(outputFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create YAML file: %w", err))
+	}
+	defer yamlWriter.Close()
+
+	encoder := yaml.NewEncoder(yamlWriter)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(document); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to encode YAML: %w", err))
+	}
+
+	common.LogInfo("Extracted %d string tables from %s", len(document.Tables), gamFile)
+	return nil
+}
+
+// Inject writes translated strings from a YAML file into a GAM file and recompresses it
+func (p *StringTableProcessor) Inject(ctx context.Context, gamFile string, profile *StringTableProfile, stringsFile, outputFile string) error {
+	definitions, err := profile.TablesFor(gamFile)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(stringsFile)
+	if err != nil {
+		return common.FormatError(common.ErrFailedToReadYAMLFile, err)
+	}
+
+	var document StringTablesYAML
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return common.WithCategory(common.ErrCategoryFormat, common.FormatError(common.ErrFailedToParseYAML, err))
+	}
+
+	gam, err := p.gam.LoadGAM(gamFile)
+	if err != nil {
+		return err
+	}
+
+	definitionsByName := make(map[string]StringTableDefinition, len(definitions))
+	for _, definition := range definitions {
+		definitionsByName[definition.Name] = definition
+	}
+
+	for _, table := range document.Tables {
+		definition, found := definitionsByName[table.Name]
+		if !found {
+			return fmt.Errorf("table %s is not configured for %s", table.Name, filepath.Base(gamFile))
+		}
+		if err := p.WriteTable(gam.UncompressedData, definition, table); err != nil {
+			return err
+		}
+	}
+
+	if _, err := p.gam.SaveGAM(ctx, gam.UncompressedData, outputFile); err != nil {
+		return err
+	}
+
+	common.LogInfo("Injected %d string tables into %s", len(document.Tables), outputFile)
+	return nil
+}
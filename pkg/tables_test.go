@@ -0,0 +1,113 @@
+// Package pkg provides tests for GAM string table extraction and injection
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const testTableProfile = `
+files:
+  ITEM.GAM:
+    tables:
+      - name: items
+        offset: 0x10
+        stride: 8
+        count: 3
+        length: 6
+        pad_byte: 0xFF
+`
+
+func TestStringTableProcessor_ReadWriteTable(t *testing.T) {
+	var profile StringTableProfile
+	if err := yaml.Unmarshal([]byte(testTableProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+
+	definitions, err := profile.TablesFor("/some/dir/item.gam")
+	if err != nil {
+		t.Fatalf("TablesFor() failed: %v", err)
+	}
+	definition := definitions[0]
+	if definition.Offset != 0x10 || definition.padByte() != 0xFF {
+		t.Fatalf("definition = %+v, want offset 0x10 and pad byte 0xFF", definition)
+	}
+
+	data := make([]byte, 0x30)
+	copy(data[0x10:], "Apple\x00")
+	copy(data[0x18:], "Sword\x00")
+	copy(data[0x20:], "Key\x00")
+
+	processor := NewStringTableProcessor()
+	table, err := processor.ReadTable(data, definition)
+	if err != nil {
+		t.Fatalf("ReadTable() failed: %v", err)
+	}
+	if len(table.Entries) != 3 || table.Entries[1].Text != "Sword" {
+		t.Errorf("ReadTable() entries = %+v", table.Entries)
+	}
+
+	table.Entries[2].Text = "Chave"
+	if err := processor.WriteTable(data, definition, *table); err != nil {
+		t.Fatalf("WriteTable() failed: %v", err)
+	}
+	if got := string(data[0x20:0x26]); got != "Chave\x00" {
+		t.Errorf("entry 2 = %q, want %q", got, "Chave\x00")
+	}
+
+	table.Entries[0].Text = "Too long"
+	if err := processor.WriteTable(data, definition, *table); err == nil {
+		t.Error("WriteTable() should fail for strings longer than the table length")
+	}
+
+	if _, err := profile.TablesFor("OTHER.GAM"); err == nil {
+		t.Error("TablesFor() should fail for unconfigured files")
+	}
+}
+
+func TestStringTableProcessor_ExtractInject(t *testing.T) {
+	var profile StringTableProfile
+	if err := yaml.Unmarshal([]byte(testTableProfile), &profile); err != nil {
+		t.Fatalf("failed to parse profile: %v", err)
+	}
+
+	dir := t.TempDir()
+	gamFile := filepath.Join(dir, "ITEM.GAM")
+	payload := make([]byte, 0x30)
+	copy(payload[0x10:], "Apple\x00")
+
+	if _, err := NewGAMProcessor().SaveGAM(context.Background(), payload, gamFile); err != nil {
+		t.Fatalf("SaveGAM() failed: %v", err)
+	}
+
+	processor := NewStringTableProcessor()
+	stringsFile := filepath.Join(dir, "items.yaml")
+	if err := processor.Extract(gamFile, &profile, stringsFile); err != nil {
+		t.Fatalf("Extract() failed: %v", err)
+	}
+
+	translated := []byte("file: ITEM.GAM\ntables:\n  - name: items\n    entries:\n      - index: 0\n        text: Maca\n")
+	if err := os.WriteFile(stringsFile, translated, 0644); err != nil {
+		t.Fatalf("failed to write strings file: %v", err)
+	}
+
+	outputFile := filepath.Join(dir, "out", "ITEM.GAM")
+	if err := os.MkdirAll(filepath.Dir(outputFile), 0755); err != nil {
+		t.Fatalf("failed to create output dir: %v", err)
+	}
+	if err := processor.Inject(context.Background(), gamFile, &profile, stringsFile, outputFile); err != nil {
+		t.Fatalf("Inject() failed: %v", err)
+	}
+
+	gam, err := NewGAMProcessor().LoadGAM(outputFile)
+	if err != nil {
+		t.Fatalf("LoadGAM() failed: %v", err)
+	}
+	if got := string(gam.UncompressedData[0x10:0x16]); got != "Maca\x00\xFF" {
+		t.Errorf("injected entry = %q, want %q", got, "Maca\x00\xFF")
+	}
+}
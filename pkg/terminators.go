@@ -0,0 +1,130 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the dialogue terminators. The word ending a dialogue decides whether
+// control returns to the event script: 0xFFFE (TERMINATOR_1) hands it back as soon as the
+// text is shown, 0xFFFF (TERMINATOR_2) keeps it until the box is closed. Dialogue YAML
+// files name them continue and halt; the numbers 1 and 2 of older files are still read.
+package pkg
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// TerminatorRuleName identifies issues raised by the terminator rule
+const TerminatorRuleName = "terminator"
+
+// DialogueTerminator is the terminator of a dialogue in a YAML file
+type DialogueTerminator = dialogueyaml.Terminator
+
+// Dialogue terminators; the values are the numbers used by older YAML files
+const (
+	TerminatorContinue = dialogueyaml.TerminatorContinue // TERMINATOR_1: control returns to the event script at once
+	TerminatorHalt     = dialogueyaml.TerminatorHalt     // TERMINATOR_2: control returns once the box is closed
+)
+
+// TerminatorFromCode returns the terminator of a terminator word; unknown words are halt
+func TerminatorFromCode(code uint16) DialogueTerminator {
+	return dialogueyaml.TerminatorFromCode(code)
+}
+
+// lastDialogueTag returns the control tag the text of a dialogue ends with, if any
+func lastDialogueTag(dialogue DialogueEntry) string {
+	if len(dialogue.Content) == 0 {
+		return ""
+	}
+	text, ok := dialogue.Content[len(dialogue.Content)-1]["text"].(string)
+	if !ok {
+		return ""
+	}
+	for _, code := range []uint16{HALT, PROMPT} {
+		if controlCode, found := LookupControlCode(code); found && strings.HasSuffix(text, controlCode.Tag) {
+			return controlCode.Tag
+		}
+	}
+	return ""
+}
+
+// ValidateTerminator checks that the terminator of a dialogue fits the control code before
+// it. A [PROMPT] waits for an answer the event script reads once the dialogue ends, so a
+// dialogue ending with [PROMPT] must halt. Raw dialogues keep their original terminator.
+func ValidateTerminator(dialogue DialogueEntry) error {
+	if dialogue.Raw != "" {
+		return nil
+	}
+	if tag := lastDialogueTag(dialogue); tag == "[PROMPT]" && dialogue.Terminator == TerminatorContinue {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("dialogue %d ends with %s but its terminator is continue: the event script would resume before the answer", dialogue.ID, tag))
+	}
+	return nil
+}
+
+// TerminatorRule checks the terminator of every dialogue: invalid [PROMPT] combinations
+// (errors), a [HALT] made redundant by a halt terminator and, when the original dialogues
+// are given, terminators changed from the original (warnings)
+type TerminatorRule struct {
+	original map[int]DialogueTerminator
+}
+
+// NewTerminatorRule creates the terminator rule. original may be nil.
+func NewTerminatorRule(original []DialogueEntry) *TerminatorRule {
+	rule := &TerminatorRule{}
+	if original != nil {
+		rule.original = make(map[int]DialogueTerminator, len(original))
+		for _, dialogue := range original {
+			rule.original[dialogue.ID] = dialogue.Terminator
+		}
+	}
+	return rule
+}
+
+// LoadTerminatorRule creates the terminator rule, reading the original dialogues when
+// originalFile is not empty
+func LoadTerminatorRule(originalFile string) (*TerminatorRule, error) {
+	if originalFile == "" {
+		return NewTerminatorRule(nil), nil
+	}
+	original, err := dialogueyaml.Read(originalFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read original dialogues: %w", err)
+	}
+	return NewTerminatorRule(original.Dialogues), nil
+}
+
+// Name returns the rule name
+func (r *TerminatorRule) Name() string {
+	return TerminatorRuleName
+}
+
+// Check returns the terminator issues of every dialogue
+func (r *TerminatorRule) Check(dialogues []DialogueEntry) []LintIssue {
+	var issues []LintIssue
+	add := func(dialogue DialogueEntry, severity, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{
+			Rule:       TerminatorRuleName,
+			Severity:   severity,
+			DialogueID: dialogue.ID,
+			Term:       dialogue.Terminator.String(),
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	for _, dialogue := range dialogues {
+		if dialogue.Raw != "" {
+			continue
+		}
+		if err := ValidateTerminator(dialogue); err != nil {
+			add(dialogue, SeverityError, "ends with [PROMPT] but the terminator is continue; use halt")
+		}
+		if lastDialogueTag(dialogue) == "[HALT]" && dialogue.Terminator != TerminatorContinue {
+			add(dialogue, SeverityWarning, "[HALT] right before a halt terminator is redundant")
+		}
+		if original, found := r.original[dialogue.ID]; found && original.Code() != dialogue.Terminator.Code() {
+			add(dialogue, SeverityWarning, "terminator changed from %s to %s; the event script resumes at a different time",
+				original, dialogue.Terminator)
+		}
+	}
+	return issues
+}
@@ -0,0 +1,55 @@
+// Package pkg provides tests for the dialogue terminators and the terminator lint rule
+package pkg
+
+import (
+	"testing"
+)
+
+func TestDialogueTerminator_Code(t *testing.T) {
+	if got := TerminatorContinue.Code(); got != TERMINATOR_1 {
+		t.Errorf("TerminatorContinue.Code() = 0x%04X, want 0x%04X", got, TERMINATOR_1)
+	}
+	if got := DialogueTerminator(0).Code(); got != TERMINATOR_2 {
+		t.Errorf("missing terminator Code() = 0x%04X, want 0x%04X", got, TERMINATOR_2)
+	}
+	if got := TerminatorFromCode(TERMINATOR_1); got != TerminatorContinue {
+		t.Errorf("TerminatorFromCode(TERMINATOR_1) = %v, want continue", got)
+	}
+}
+
+func TestValidateTerminator(t *testing.T) {
+	prompt := []map[string]interface{}{{"text": "Yes or no?[PROMPT]"}}
+
+	if err := ValidateTerminator(DialogueEntry{Terminator: TerminatorContinue, Content: prompt}); err == nil {
+		t.Error("ValidateTerminator() accepted [PROMPT] with continue")
+	}
+	if err := ValidateTerminator(DialogueEntry{Terminator: TerminatorHalt, Content: prompt}); err != nil {
+		t.Errorf("ValidateTerminator() with halt = %v, want nil", err)
+	}
+	if err := ValidateTerminator(DialogueEntry{Terminator: TerminatorContinue, Content: prompt, Raw: "FFFE"}); err != nil {
+		t.Errorf("ValidateTerminator() of a raw dialogue = %v, want nil", err)
+	}
+}
+
+func TestTerminatorRule_Check(t *testing.T) {
+	original := []DialogueEntry{
+		{ID: 0, Terminator: TerminatorHalt},
+		{ID: 1, Terminator: TerminatorHalt},
+		{ID: 2, Terminator: TerminatorHalt},
+	}
+	translated := []DialogueEntry{
+		{ID: 0, Terminator: TerminatorContinue, Content: []map[string]interface{}{{"text": "Really?[PROMPT]"}}},
+		{ID: 1, Terminator: TerminatorHalt, Content: []map[string]interface{}{{"text": "Wait.[HALT]"}}},
+		{ID: 2, Terminator: TerminatorHalt, Content: []map[string]interface{}{{"text": "Fine."}}},
+	}
+
+	report := NewLinter(NewTerminatorRule(original)).Check(translated)
+	if report.Errors != 1 || report.Warnings != 2 {
+		t.Fatalf("errors = %d, warnings = %d, want 1 and 2: %+v", report.Errors, report.Warnings, report.Issues)
+	}
+	for _, issue := range report.Issues {
+		if issue.DialogueID == 2 {
+			t.Errorf("unexpected issue for dialogue 2: %+v", issue)
+		}
+	}
+}
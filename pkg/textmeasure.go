@@ -0,0 +1,448 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains wfm measure, the wrap planning report: for every font height of a WFM
+// font it lists how many characters of representative strings fit on a line, a histogram
+// of the text length of every text box page, and the pages of a dialogue file predicted to
+// overflow their line width.
+package pkg
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+)
+
+// textLengthBucketSize is the width in characters of a page length histogram bucket
+const textLengthBucketSize = 10
+
+// TextMeasureOptions selects the line width and the representative strings of a measurement
+type TextMeasureOptions struct {
+	Width   int      // Line width in pixels; 0 uses the widest original line of each font height
+	Samples []string // Strings measured in addition to the widest, narrowest and average glyphs
+}
+
+// TextMeasureSample is the number of characters of a representative string that fit on a line
+type TextMeasureSample struct {
+	Name         string  `json:"name"`
+	Text         string  `json:"text,omitempty"`
+	Advance      float64 `json:"advance"`        // Average pixel width of a character of the sample
+	CharsPerLine int     `json:"chars_per_line"` // Characters that fit on a line, the sample repeated as needed
+}
+
+// TextLengthBucket counts the pages whose text length falls in [From, To]
+type TextLengthBucket struct {
+	From  int `json:"from"`
+	To    int `json:"to"`
+	Pages int `json:"pages"`
+}
+
+// TextMeasureHeight is the measurement of a font height
+type TextMeasureHeight struct {
+	FontHeight int                 `json:"font_height"`
+	LineWidth  int                 `json:"line_width"` // Pixel width of a line, 0 if unknown
+	Samples    []TextMeasureSample `json:"samples"`
+	Histogram  []TextLengthBucket  `json:"histogram"` // Text length of the pages, in characters
+}
+
+// TextMeasurePage is the measurement of a text box page of a dialogue
+type TextMeasurePage struct {
+	DialogueID    int `json:"dialogue_id"`
+	Page          int `json:"page"` // From 1
+	FontHeight    int `json:"font_height"`
+	Lines         int `json:"lines"`
+	Chars         int `json:"chars"`          // Characters drawn, spaces included
+	WidestLine    int `json:"widest_line"`    // Pixel width of the widest line
+	LineWidth     int `json:"line_width"`     // Pixel width available, 0 if unknown
+	OverflowLines int `json:"overflow_lines"` // Lines wider than LineWidth
+	Overflow      int `json:"overflow"`       // Pixels the widest line exceeds LineWidth by
+}
+
+// TextMeasureReport is the result of wfm measure
+type TextMeasureReport struct {
+	Font        string              `json:"font"`
+	Dialogues   string              `json:"dialogues,omitempty"`
+	Heights     []TextMeasureHeight `json:"heights"`
+	Pages       []TextMeasurePage   `json:"pages"`
+	Overflowing int                 `json:"overflowing"` // Dialogues with at least one overflowing page
+}
+
+// measuredPage is a text box page split into lines by measureDialoguePages
+type measuredPage struct {
+	lines []int // Pixel width of every line
+	chars int
+}
+
+// MeasureTextFiles measures the font of a WFM file, mapping its glyphs to characters with
+// the reference fonts of fontDir, and the dialogues of yamlFile when given
+func MeasureTextFiles(wfmFile, yamlFile, fontDir string, options TextMeasureOptions) (*TextMeasureReport, error) {
+	file, err := os.Open(wfmFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to open WFM file: %w", err))
+	}
+	defer file.Close()
+
+	// Only the glyphs compared while mapping characters are read
+	decoder := NewWFMDecoder()
+	decoder.SetLazyGlyphs(true)
+	wfm, err := decoder.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode WFM file %s: %w", wfmFile, err)
+	}
+	glyphMapping, err := NewWFMExporter().buildGlyphMappingFromGlyphs(wfm.Glyphs, fontDir)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to map glyphs: %w", err))
+	}
+
+	var dialogues *DialoguesYAML
+	if yamlFile != "" {
+		if dialogues, err = dialogueyaml.Read(yamlFile); err != nil {
+			return nil, err
+		}
+	}
+
+	report := MeasureText(wfm, glyphMapping, dialogues, options)
+	report.Font = wfmFile
+	report.Dialogues = yamlFile
+	return report, nil
+}
+
+// MeasureText measures the font heights of a WFM font and the pages of the dialogues (nil
+// measures the font only). A dialogue is measured against options.Width, else the widest
+// original line recorded by decode --widths, else the widest original line of its font
+// height in the WFM file.
+func MeasureText(wfm *WFMFile, glyphMapping map[uint16]string, dialogues *DialoguesYAML, options TextMeasureOptions) *TextMeasureReport {
+	report := &TextMeasureReport{Heights: []TextMeasureHeight{}, Pages: []TextMeasurePage{}}
+	widthTable := glyphWidthTable(glyphMapping, wfm.Glyphs)
+
+	// The widest original line of each font height is the default line width
+	lineWidths := make(map[int]int)
+	for _, dialogue := range wfm.Dialogues {
+		if len(dialogue.Data) == 0 {
+			continue
+		}
+		_, _, fontHeight, _, _ := processDialogueText(dialogue.Data, glyphMapping, wfm.Glyphs, false)
+		for _, width := range MeasureDialogueLines(dialogue.Data, wfm.Glyphs) {
+			lineWidths[fontHeight] = max(lineWidths[fontHeight], width)
+		}
+	}
+	lineWidth := func(height int) int {
+		if options.Width > 0 {
+			return options.Width
+		}
+		return lineWidths[height]
+	}
+
+	// Character frequencies and page lengths of the dialogues by font height
+	frequencies := make(map[int]map[string]int)
+	pageLengths := make(map[int][]int)
+	overflowing := make(map[int]bool)
+	if dialogues != nil {
+		for _, dialogue := range dialogues.Dialogues {
+			widths := widthTable[dialogue.FontHeight]
+			if dialogue.Raw != "" || len(widths) == 0 {
+				continue
+			}
+			limit := lineWidth(dialogue.FontHeight)
+			if options.Width <= 0 && dialogue.Widths != nil && dialogue.Widths.Max > 0 {
+				limit = dialogue.Widths.Max
+			}
+			if frequencies[dialogue.FontHeight] == nil {
+				frequencies[dialogue.FontHeight] = make(map[string]int)
+			}
+
+			for i, page := range measureDialoguePages(dialogue, widths, frequencies[dialogue.FontHeight]) {
+				measured := TextMeasurePage{
+					DialogueID: dialogue.ID,
+					Page:       i + 1,
+					FontHeight: dialogue.FontHeight,
+					Lines:      len(page.lines),
+					Chars:      page.chars,
+					LineWidth:  limit,
+				}
+				for _, width := range page.lines {
+					measured.WidestLine = max(measured.WidestLine, width)
+					if limit > 0 && width > limit {
+						measured.OverflowLines++
+					}
+				}
+				if limit > 0 && measured.WidestLine > limit {
+					measured.Overflow = measured.WidestLine - limit
+					overflowing[dialogue.ID] = true
+				}
+				report.Pages = append(report.Pages, measured)
+				pageLengths[dialogue.FontHeight] = append(pageLengths[dialogue.FontHeight], page.chars)
+			}
+		}
+	}
+	report.Overflowing = len(overflowing)
+
+	heights := make([]int, 0, len(widthTable))
+	for height := range widthTable {
+		heights = append(heights, height)
+	}
+	sort.Ints(heights)
+	for _, height := range heights {
+		measured := TextMeasureHeight{FontHeight: height, LineWidth: lineWidth(height)}
+		measured.Samples = measureSamples(widthTable[height], frequencies[height], measured.LineWidth, options.Samples)
+		measured.Histogram = textLengthHistogram(pageLengths[height])
+		report.Heights = append(report.Heights, measured)
+	}
+	return report
+}
+
+// measureDialoguePages splits the text content of a dialogue into text box pages, which
+// start at every box item and [PAGE] tag, and measures their lines the same way as
+// measureTextLines. The characters drawn are counted into frequencies.
+func measureDialoguePages(dialogue DialogueEntry, widths map[string]int, frequencies map[string]int) []measuredPage {
+	widest := 0
+	for _, width := range widths {
+		widest = max(widest, width)
+	}
+
+	pages := []measuredPage{{lines: []int{0}}}
+	current := func() *measuredPage { return &pages[len(pages)-1] }
+	newPage := func() {
+		if page := current(); page.chars > 0 || len(page.lines) > 1 {
+			pages = append(pages, measuredPage{lines: []int{0}})
+		}
+	}
+	for _, contentItem := range dialogue.Content {
+		if _, isBox := contentItem["box"]; isBox {
+			newPage()
+		}
+		text, ok := contentItem["text"].(string)
+		if !ok {
+			continue
+		}
+
+		for i, part := range strings.Split(text, PageBreakTag) {
+			if i > 0 {
+				newPage()
+			}
+			part = stripZeroWidth(controlTagRegex.ReplaceAllString(part, ""))
+			for _, char := range part {
+				page := current()
+				if char == '\n' {
+					page.lines = append(page.lines, 0)
+					continue
+				}
+				width, known := widths[string(char)]
+				if !known {
+					width = widest
+				}
+				page.lines[len(page.lines)-1] += width
+				page.chars++
+				frequencies[string(char)]++
+			}
+		}
+	}
+	return pages
+}
+
+// measureSamples measures the widest and narrowest glyphs, the average character of the
+// script (of the font when no text was measured) and the given strings against a line width
+func measureSamples(widths, frequencies map[string]int, lineWidth int, samples []string) []TextMeasureSample {
+	chars := make([]string, 0, len(widths))
+	for char := range widths {
+		chars = append(chars, char)
+	}
+	sort.Strings(chars)
+
+	// Spaces are left out of the glyph extremes: they say nothing about the text
+	widest, narrowest := "", ""
+	for _, char := range chars {
+		if char == " " {
+			continue
+		}
+		if widest == "" || widths[char] > widths[widest] {
+			widest = char
+		}
+		if widths[char] > 0 && (narrowest == "" || widths[char] < widths[narrowest]) {
+			narrowest = char
+		}
+	}
+
+	var result []TextMeasureSample
+	if widest != "" {
+		result = append(result, measureSample("widest glyph", widest, widths, lineWidth))
+	}
+	if narrowest != "" {
+		result = append(result, measureSample("narrowest glyph", narrowest, widths, lineWidth))
+	}
+
+	// The average character is weighted by how often the script uses it
+	name, total, count := "average character (script)", 0, 0
+	for char, uses := range frequencies {
+		if width, known := widths[char]; known {
+			total += width * uses
+			count += uses
+		}
+	}
+	if count == 0 {
+		name = "average character (font)"
+		for _, char := range chars {
+			total += widths[char]
+			count++
+		}
+	}
+	if count > 0 && total > 0 {
+		average := TextMeasureSample{Name: name, Advance: float64(total) / float64(count)}
+		if lineWidth > 0 {
+			average.CharsPerLine = lineWidth * count / total
+		}
+		result = append(result, average)
+	}
+
+	for _, sample := range samples {
+		result = append(result, measureSample("sample", sample, widths, lineWidth))
+	}
+	return result
+}
+
+// measureSample counts the characters of text, repeated as needed, that fit on a line.
+// Characters without a known width count as the widest glyph of the font.
+func measureSample(name, text string, widths map[string]int, limit int) TextMeasureSample {
+	widest := 0
+	for _, width := range widths {
+		widest = max(widest, width)
+	}
+	advance := func(char string) int {
+		if width, known := widths[char]; known {
+			return width
+		}
+		return widest
+	}
+
+	chars := splitChars(text)
+	sample := TextMeasureSample{Name: name, Text: text}
+	total := lineWidth(chars, advance)
+	if len(chars) == 0 || total == 0 {
+		return sample
+	}
+	sample.Advance = float64(total) / float64(len(chars))
+	if limit <= 0 {
+		return sample
+	}
+
+	// Whole repetitions first, then the characters of the last partial one
+	sample.CharsPerLine = limit / total * len(chars)
+	used := limit / total * total
+	for _, char := range chars {
+		if used+advance(char) > limit {
+			break
+		}
+		used += advance(char)
+		sample.CharsPerLine++
+	}
+	return sample
+}
+
+// textLengthHistogram buckets page lengths by textLengthBucketSize characters, from the
+// first bucket to the bucket of the longest page
+func textLengthHistogram(lengths []int) []TextLengthBucket {
+	histogram := []TextLengthBucket{}
+	for _, length := range lengths {
+		bucket := length / textLengthBucketSize
+		for len(histogram) <= bucket {
+			from := len(histogram) * textLengthBucketSize
+			histogram = append(histogram, TextLengthBucket{From: from, To: from + textLengthBucketSize - 1})
+		}
+		histogram[bucket].Pages++
+	}
+	return histogram
+}
+
+// WriteTextMeasureReport writes the report in the requested format: json, markdown, or csv
+// (one row per page)
+func WriteTextMeasureReport(report *TextMeasureReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeTextMeasureMarkdown(report, writer)
+	case ReportFormatCSV:
+		return writeTextMeasureCSV(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeTextMeasureCSV writes the measured pages as CSV rows
+func writeTextMeasureCSV(report *TextMeasureReport, writer io.Writer) error {
+	w := csv.NewWriter(writer)
+	rows := [][]string{{"dialogue_id", "page", "font_height", "lines", "chars", "widest_line", "line_width", "overflow_lines", "overflow"}}
+	for _, page := range report.Pages {
+		rows = append(rows, []string{
+			strconv.Itoa(page.DialogueID), strconv.Itoa(page.Page), strconv.Itoa(page.FontHeight),
+			strconv.Itoa(page.Lines), strconv.Itoa(page.Chars), strconv.Itoa(page.WidestLine),
+			strconv.Itoa(page.LineWidth), strconv.Itoa(page.OverflowLines), strconv.Itoa(page.Overflow),
+		})
+	}
+	if err := w.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write CSV report: %w", err)
+	}
+	return nil
+}
+
+// writeTextMeasureMarkdown renders the report as a markdown document
+func writeTextMeasureMarkdown(report *TextMeasureReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Text Measurement: %s\n", report.Font))
+	for _, height := range report.Heights {
+		sb.WriteString(fmt.Sprintf("\n## Font Height %d\n\n", height.FontHeight))
+		if height.LineWidth > 0 {
+			sb.WriteString(fmt.Sprintf("Line width: %d px\n\n", height.LineWidth))
+		} else {
+			sb.WriteString("Line width: unknown (no original dialogue of this height; use --width)\n\n")
+		}
+
+		sb.WriteString("| Sample | Text | Advance | Chars per line |\n")
+		sb.WriteString("|--------|------|---------|----------------|\n")
+		for _, sample := range height.Samples {
+			sb.WriteString(fmt.Sprintf("| %s | %s | %.1f | %d |\n", sample.Name, sample.Text, sample.Advance, sample.CharsPerLine))
+		}
+
+		if len(height.Histogram) > 0 {
+			sb.WriteString("\n| Page length | Pages |\n")
+			sb.WriteString("|-------------|-------|\n")
+			for _, bucket := range height.Histogram {
+				sb.WriteString(fmt.Sprintf("| %d-%d | %d |\n", bucket.From, bucket.To, bucket.Pages))
+			}
+		}
+	}
+
+	if report.Dialogues != "" {
+		sb.WriteString(fmt.Sprintf("\n## Overflow: %s\n\n", report.Dialogues))
+		if report.Overflowing == 0 {
+			sb.WriteString("No page is predicted to overflow.\n")
+		} else {
+			sb.WriteString(fmt.Sprintf("%d dialogue(s) predicted to overflow.\n\n", report.Overflowing))
+			sb.WriteString("| Dialogue | Page | Height | Widest line | Line width | Overflow | Lines over |\n")
+			sb.WriteString("|----------|------|--------|-------------|------------|----------|------------|\n")
+			for _, page := range report.Pages {
+				if page.Overflow > 0 {
+					sb.WriteString(fmt.Sprintf("| %d | %d | %d | %d | %d | %d | %d |\n", page.DialogueID, page.Page,
+						page.FontHeight, page.WidestLine, page.LineWidth, page.Overflow, page.OverflowLines))
+				}
+			}
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
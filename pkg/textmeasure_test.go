@@ -0,0 +1,79 @@
+// Package pkg provides tests for the wfm measure wrap planning report
+package pkg
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMeasureText(t *testing.T) {
+	wfm, fontDir := newRenderTestFont(t)
+	glyphMapping, err := NewWFMExporter().buildGlyphMappingFromGlyphs(wfm.Glyphs, fontDir)
+	if err != nil {
+		t.Fatalf("buildGlyphMappingFromGlyphs() failed: %v", err)
+	}
+	// Glyphs are mapped by image, so B can be widened afterwards
+	wfm.Glyphs[1].GlyphWidth = 6
+
+	// The original dialogue "ABA" sets the line width of height 16 to 14 px
+	words := []uint16{0x8000, 0x8001, 0x8000, TERMINATOR_2}
+	data := make([]byte, len(words)*2)
+	for i, word := range words {
+		binary.LittleEndian.PutUint16(data[i*2:], word)
+	}
+	wfm.Dialogues = []Dialogue{{Data: data}}
+
+	measured := textDialogue(1, "AB[WAIT FOR INPUT]B")
+	measured.Widths = &DialogueWidths{Max: 20}
+	dialogues := &DialoguesYAML{Dialogues: []DialogueEntry{
+		textDialogue(0, "AB A\nBB[PAGE]A"),
+		measured,
+	}}
+
+	report := MeasureText(wfm, glyphMapping, dialogues, TextMeasureOptions{Samples: []string{"AB"}})
+
+	if len(report.Heights) != 1 || report.Heights[0].LineWidth != 14 {
+		t.Fatalf("Heights = %+v, want height 16 with a 14 px line", report.Heights)
+	}
+	var got []int
+	for _, sample := range report.Heights[0].Samples {
+		got = append(got, sample.CharsPerLine)
+	}
+	// Widest B: 2, narrowest A: 3, script average 50/10 px: 2, "AB" repeated: ABA
+	if want := []int{2, 3, 2, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("chars per line = %v, want %v (%+v)", got, want, report.Heights[0].Samples)
+	}
+	if want := []TextLengthBucket{{From: 0, To: 9, Pages: 3}}; !reflect.DeepEqual(report.Heights[0].Histogram, want) {
+		t.Errorf("Histogram = %+v, want %+v", report.Heights[0].Histogram, want)
+	}
+
+	// Dialogue 0 overflows on its first page only; dialogue 1 fits its recorded 20 px
+	wantPages := []TextMeasurePage{
+		{DialogueID: 0, Page: 1, FontHeight: 16, Lines: 2, Chars: 6, WidestLine: 18, LineWidth: 14, OverflowLines: 1, Overflow: 4},
+		{DialogueID: 0, Page: 2, FontHeight: 16, Lines: 1, Chars: 1, WidestLine: 4, LineWidth: 14},
+		{DialogueID: 1, Page: 1, FontHeight: 16, Lines: 1, Chars: 3, WidestLine: 16, LineWidth: 20},
+	}
+	if !reflect.DeepEqual(report.Pages, wantPages) {
+		t.Errorf("Pages = %+v, want %+v", report.Pages, wantPages)
+	}
+	if report.Overflowing != 1 {
+		t.Errorf("Overflowing = %d, want 1", report.Overflowing)
+	}
+
+	var sb strings.Builder
+	if err := WriteTextMeasureReport(report, ReportFormatCSV, &sb); err != nil {
+		t.Fatalf("WriteTextMeasureReport(csv) failed: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(sb.String()), "\n")
+	if len(lines) != 4 || lines[1] != "0,1,16,2,6,18,14,1,4" {
+		t.Errorf("CSV report =\n%s", sb.String())
+	}
+
+	// A fixed width replaces the measured line widths
+	report = MeasureText(wfm, glyphMapping, dialogues, TextMeasureOptions{Width: 24})
+	if report.Heights[0].LineWidth != 24 || report.Overflowing != 0 {
+		t.Errorf("with --width 24: line width %d, %d overflowing, want 24 and none", report.Heights[0].LineWidth, report.Overflowing)
+	}
+}
@@ -0,0 +1,172 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the TIM image processor: TIM files are decoded to PNG (indexed-color
+// for 4bpp and 8bpp images, so palette indices survive editing) and edited PNG files are
+// encoded back, reusing the CLUT and VRAM positions of the original TIM.
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// TIMReport describes a decoded or encoded TIM image
+type TIMReport struct {
+	Source   string `json:"source"`
+	BPP      int    `json:"bpp"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Palettes int    `json:"palettes"` // CLUTs of the CLUT block
+	Clut     int    `json:"clut"`     // CLUT used for the image
+}
+
+// TIMEncodeOptions controls how a PNG image is encoded as a TIM
+type TIMEncodeOptions struct {
+	BPP          int    // 4, 8 or 16 (0 takes the depth of ClutFile, or 4 without one)
+	ClutFile     string // TIM whose CLUT block and VRAM positions are reused ("" builds the CLUT from the image)
+	ClutIndex    int    // CLUT of ClutFile the image is quantized against
+	Position     string // VRAM position X,Y of the image ("" keeps the one of ClutFile, or 0,0)
+	ClutPosition string // VRAM position X,Y of the CLUT ("" keeps the one of ClutFile, or 0,0)
+}
+
+// TIMProcessor decodes and encodes TIM images
+type TIMProcessor struct {
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
+
+// NewTIMProcessor creates a new TIM image processor instance
+func NewTIMProcessor() *TIMProcessor {
+	return &TIMProcessor{}
+}
+
+// SetLogger sets the logging configuration of the processor (nil follows SetVerboseMode)
+func (p *TIMProcessor) SetLogger(logger *common.Logger) {
+	p.logger = logger
+}
+
+// LoadTIMFile reads and parses a TIM file
+func LoadTIMFile(path string) (*psx.TIM, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read %s: %w", path, err))
+	}
+	tim, err := psx.ParseTIM(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return tim, nil
+}
+
+// ParseVRAMPosition parses an X,Y VRAM position (decimal or 0x hexadecimal)
+func ParseVRAMPosition(value string) (x, y uint16, err error) {
+	xs, ys, ok := strings.Cut(value, ",")
+	px, errX := strconv.ParseUint(strings.TrimSpace(xs), 0, 16)
+	py, errY := strconv.ParseUint(strings.TrimSpace(ys), 0, 16)
+	if !ok || errX != nil || errY != nil || px >= psx.VRAM_WIDTH || py >= psx.VRAM_HEIGHT {
+		return 0, 0, common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("invalid VRAM position %q: expected X,Y inside %dx%d", value, psx.VRAM_WIDTH, psx.VRAM_HEIGHT))
+	}
+	return uint16(px), uint16(py), nil
+}
+
+// Decode writes a TIM file as a PNG image using one of its CLUTs
+func (p *TIMProcessor) Decode(inputFile, outputFile string, clut int) (*TIMReport, error) {
+	tim, err := LoadTIMFile(inputFile)
+	if err != nil {
+		return nil, err
+	}
+	img, err := tim.ToImage(clut)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", inputFile, err)
+	}
+	if err := writeFramePNG(outputFile, img); err != nil {
+		return nil, err
+	}
+
+	p.logger.Debug("%s: %dbpp %dx%d at %d,%d, CLUT %d of %d at %d,%d", inputFile, tim.BPP, tim.Width, tim.Height,
+		tim.X, tim.Y, clut, tim.Palettes(), tim.ClutX, tim.ClutY)
+	return &TIMReport{Source: inputFile, BPP: tim.BPP, Width: tim.Width, Height: tim.Height, Palettes: tim.Palettes(), Clut: clut}, nil
+}
+
+// Encode writes a PNG image as a TIM file
+func (p *TIMProcessor) Encode(inputFile, outputFile string, options TIMEncodeOptions) (*TIMReport, error) {
+	var original *psx.TIM
+	if options.ClutFile != "" {
+		var err error
+		if original, err = LoadTIMFile(options.ClutFile); err != nil {
+			return nil, err
+		}
+		if original.Palettes() == 0 {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s has no CLUT", options.ClutFile))
+		}
+		if options.BPP == 0 {
+			options.BPP = original.BPP
+		}
+	}
+	if options.BPP == 0 {
+		options.BPP = 4
+	}
+
+	img, err := loadGlyphPNG(inputFile)
+	if err != nil {
+		if common.ExitCodeFor(err) == common.ExitFailure {
+			err = common.WithCategory(common.ErrCategoryFormat, err) // Not a PNG image
+		}
+		return nil, fmt.Errorf("failed to read %s: %w", inputFile, err)
+	}
+
+	var colors []psx.PSXColor
+	if original != nil {
+		if options.BPP == 16 {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("16bpp images have no CLUT: drop --clut"))
+		}
+		if original.BPP != options.BPP {
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("%s is a %dbpp TIM, its CLUTs do not fit a %dbpp image", options.ClutFile, original.BPP, options.BPP))
+		}
+		if colors, err = original.Palette(options.ClutIndex); err != nil {
+			return nil, fmt.Errorf("%s: %w", options.ClutFile, err)
+		}
+	}
+
+	tim, err := psx.NewTIM(img, options.BPP, colors)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", inputFile, err)
+	}
+	if original != nil {
+		// The image takes the place of the original: same VRAM rectangle, every CLUT kept
+		tim.X, tim.Y = original.X, original.Y
+		tim.ClutX, tim.ClutY = original.ClutX, original.ClutY
+		tim.ClutWidth, tim.ClutHeight = original.ClutWidth, original.ClutHeight
+		tim.Clut = append([]psx.PSXColor(nil), original.Clut...)
+	}
+	if options.Position != "" {
+		if tim.X, tim.Y, err = ParseVRAMPosition(options.Position); err != nil {
+			return nil, err
+		}
+	}
+	if options.ClutPosition != "" {
+		if tim.ClutX, tim.ClutY, err = ParseVRAMPosition(options.ClutPosition); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := common.CreateAtomic(outputFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", outputFile, err))
+	}
+	defer output.Abort()
+	if _, err := output.Write(tim.Bytes()); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", outputFile, err))
+	}
+	if err := output.Commit(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, err)
+	}
+
+	p.logger.Debug("%s: %dbpp %dx%d at %d,%d, CLUT at %d,%d", outputFile, tim.BPP, tim.Width, tim.Height, tim.X, tim.Y, tim.ClutX, tim.ClutY)
+	return &TIMReport{Source: inputFile, BPP: tim.BPP, Width: tim.Width, Height: tim.Height, Palettes: tim.Palettes(), Clut: options.ClutIndex}, nil
+}
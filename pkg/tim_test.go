@@ -0,0 +1,93 @@
+// Package pkg provides tests for the TIM image processor
+package pkg
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+func TestTIMProcessor_DecodeEncode(t *testing.T) {
+	dir := t.TempDir()
+
+	// A 4bpp original with two CLUTs whose second one repeats a color of the first
+	img := image.NewNRGBA(image.Rect(0, 0, 8, 2))
+	for x := 0; x < 8; x++ {
+		img.SetNRGBA(x, 1, color.NRGBA{R: uint8(x * 32), G: 64, A: 255})
+	}
+	original, err := psx.NewTIM(img, 4, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	original.X, original.Y, original.ClutX, original.ClutY = 640, 0, 0, 480
+	original.ClutHeight = 2
+	original.Clut = append(original.Clut, original.Clut...)
+	originalFile := filepath.Join(dir, "TITLE.TIM")
+	if err := os.WriteFile(originalFile, original.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	processor := NewTIMProcessor()
+	pngFile := filepath.Join(dir, "title.png")
+	report, err := processor.Decode(originalFile, pngFile, 1)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if report.BPP != 4 || report.Width != 8 || report.Palettes != 2 {
+		t.Errorf("report = %+v, want a 4bpp image 8 wide with 2 palettes", report)
+	}
+
+	// The unedited PNG encodes back to the original file
+	rebuilt := filepath.Join(dir, "TITLE_new.TIM")
+	if _, err := processor.Encode(pngFile, rebuilt, TIMEncodeOptions{ClutFile: originalFile, ClutIndex: 1}); err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	data, err := os.ReadFile(rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, original.Bytes()) {
+		t.Error("Encode() of the decoded PNG does not rebuild the original TIM")
+	}
+
+	// Without --clut, the positions come from the flags
+	if _, err := processor.Encode(pngFile, rebuilt, TIMEncodeOptions{BPP: 8, Position: "0x100,16", ClutPosition: "0,500"}); err != nil {
+		t.Fatalf("Encode(8bpp) failed: %v", err)
+	}
+	tim, err := LoadTIMFile(rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tim.BPP != 8 || tim.X != 256 || tim.Y != 16 || tim.ClutY != 500 {
+		t.Errorf("TIM = %dbpp at %d,%d, CLUT Y %d; want 8bpp at 256,16, CLUT Y 500", tim.BPP, tim.X, tim.Y, tim.ClutY)
+	}
+
+	for name, options := range map[string]TIMEncodeOptions{
+		"16bpp with CLUT": {BPP: 16, ClutFile: originalFile},
+		"CLUT index":      {ClutFile: originalFile, ClutIndex: 2},
+		"position":        {Position: "1024,0"},
+	} {
+		if _, err := processor.Encode(pngFile, rebuilt, options); common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("%s: Encode() error = %v, want a validation error", name, err)
+		}
+	}
+
+	// The decoded PNG is indexed-color
+	file, err := os.Open(pngFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if decoded, err := png.Decode(file); err != nil {
+		t.Fatal(err)
+	} else if _, ok := decoded.(*image.Paletted); !ok {
+		t.Errorf("decoded PNG is %T, want indexed-color", decoded)
+	}
+}
@@ -3,38 +3,17 @@ package pkg
 import (
 	"fmt"
 	"io"
-)
 
-// Special control codes constants
-const (
-	// Text box initialization
-	INIT_TEXT_BOX = 0xFFFA
-
-	// Special control codes
-	FFF2            = 0xFFF2 // args: 1
-	HALT            = 0xFFF3
-	F4              = 0xFFF4
-	PROMPT          = 0xFFF5
-	F6              = 0xFFF6 // args: 2
-	CHANGE_COLOR_TO = 0xFFF7 // args: 1
-	INIT_TAIL       = 0xFFF8 // args: 2
-	PAUSE_FOR       = 0xFFF9 // args: 1
-	DOUBLE_NEWLINE  = 0xFFFB
-	WAIT_FOR_INPUT  = 0xFFFC
-	NEWLINE         = 0xFFFD
-
-	// Additional special commands
-	C04D = 0xC04D // Special character
-	C04E = 0xC04E // Special character
-
-	// Termination markers
-	TERMINATOR_1 = 0xFFFE
-	TERMINATOR_2 = 0xFFFF
-
-	// Glyph ID base offset
-	GLYPH_ID_BASE = 0x8000
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/dialogueyaml"
+	"github.com/hansbonini/tombatools/pkg/gam"
+	"github.com/hansbonini/tombatools/pkg/psx"
+	"github.com/hansbonini/tombatools/pkg/wfm"
 )
 
+// Glyph ID base offset; control codes are generated in controlcodes_gen.go
+const GLYPH_ID_BASE = 0x8000
+
 // Default CLUT (Color Look-Up Table) palettes for glyph rendering
 // Each palette contains 16 colors in PlayStation PSX 15-bit format
 var DialogueClut = [16]uint16{
@@ -95,50 +74,27 @@ type TextContent struct {
 
 func (t TextContent) isDialogueContentItem() {}
 
-// DialogueEntry represents a single dialogue with the new structure
-type DialogueEntry struct {
-	ID         int                      `yaml:"id"`
-	Type       string                   `yaml:"type"`
-	FontHeight int                      `yaml:"font_height"`
-	FontClut   uint16                   `yaml:"font_clut"`
-	Terminator uint16                   `yaml:"terminator"`
-	Special    bool                     `yaml:"special,omitempty"`
-	Content    []map[string]interface{} `yaml:"content"`
-}
+// DialogueEntry is a single dialogue of a dialogue YAML file
+type DialogueEntry = dialogueyaml.Entry
 
-// WFMHeader represents the main header of a WFM file structure
-type WFMHeader struct {
-	Magic                [4]byte // Always "WFM3"
-	Padding              uint32
-	DialoguePointerTable uint32
-	TotalDialogues       uint16
-	TotalGlyphs          uint16
-	Reserved             [128]byte // Reserved section (may contain special dialogue IDs)
-}
+// WFMHeader represents the main header of a WFM file structure (see the wfm package)
+type WFMHeader = wfm.Header
 
-// Glyph represents the data for a single glyph
-type Glyph struct {
-	GlyphClut       uint16 // Color lookup table data
-	GlyphHeight     uint16 // Height of the glyph
-	GlyphWidth      uint16 // Width of the glyph
-	GlyphHandakuten uint16 // Handakuten marker (Japanese diacritical mark)
-	GlyphImage      []byte // Raw image data
-}
+// Glyph represents the data for a single glyph (see the wfm package)
+type Glyph = wfm.Glyph
 
-// Dialogue represents a dialog entry in the WFM file
-type Dialogue struct {
-	Data []byte
+// NewPlaceholderGlyph creates an empty placeholder glyph (0x0 dimensions).
+// Placeholders keep their slot in the glyph pointer table so that encode values
+// referencing later glyphs are not shifted.
+func NewPlaceholderGlyph() Glyph {
+	return wfm.NewPlaceholderGlyph()
 }
 
-// WFMFile represents the complete structure of a WFM file
-type WFMFile struct {
-	Header               WFMHeader
-	GlyphPointerTable    []uint16
-	Glyphs               []Glyph
-	DialoguePointerTable []uint16
-	Dialogues            []Dialogue
-	OriginalSize         int64 // Size of the original WFM file in bytes
-}
+// Dialogue represents a dialog entry in the WFM file (see the wfm package)
+type Dialogue = wfm.Dialogue
+
+// WFMFile represents the complete structure of a WFM file (see the wfm package)
+type WFMFile = wfm.File
 
 // WFMDecoder interface defines methods for decoding WFM files
 type WFMDecoder interface {
@@ -171,33 +127,52 @@ type WFMProcessor interface {
 	Process(inputFile string, outputDir string) error
 }
 
-// GAMHeader represents the 8-byte header of a GAM file
-type GAMHeader struct {
-	Magic            [3]byte // "GAM"
-	Reserved         byte    // Padding byte (typically 0x00)
-	UncompressedSize uint32  // Size of the decompressed data
-}
+// GAMHeader represents the 8-byte header of a GAM file (see the gam package)
+type GAMHeader = gam.Header
 
-// GAMFile represents a complete GAM file structure
-type GAMFile struct {
-	Header           GAMHeader
-	CompressedData   []byte
-	UncompressedData []byte
-	OriginalSize     int64
-}
+// GAMFile represents a complete GAM file structure (see the gam package)
+type GAMFile = gam.File
 
 // GAMProcessor handles GAM file operations (unpack/pack)
-type GAMProcessor struct{}
+type GAMProcessor struct {
+	targetSize  int64           // Largest allowed GAM file size, header included (0 disables fitting)
+	fitOriginal []byte          // Uncompressed payload of the original GAM, compared when suggesting chunks
+	keepPadding bool            // Never trim trailing zero padding to fit the target size
+	fitReport   *GAMFitReport   // Fitting report of the last SaveGAM (nil without a target size)
+	preset      string          // Compression preset: fast, default or max (empty is default)
+	reuseFile   *GAMFile        // Original GAM whose tokens SaveGAM reuses (nil uses the preset)
+	reuseReport *GAMReuseReport // Token reuse report of the last SaveGAM (nil without an original)
+
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
 
-// CDProcessor handles CD image operations (dump)
+// CDProcessor handles CD image operations (dump, sheet)
 type CDProcessor interface {
 	Dump(inputFile string, outputDir string) error
+	GenerateSheets(imageFile string, formats []string) ([]string, error)
+	CheckBoot(imageFile string) (*psx.BootCheckReport, error)
+	FindOrphans(imageFile, outputDir string, includeEmpty bool) (*psx.OrphanReport, error)
 }
 
 // CDFileProcessor implements the CDProcessor interface
-type CDFileProcessor struct{}
+type CDFileProcessor struct {
+	maxFileSize  int64 // Per-file extraction cap in bytes (0 uses DefaultMaxExtractFileSize)
+	maxTotalSize int64 // Total extraction cap in bytes (0 scales with the image size)
 
-// MSFTimecode represents a Minutes:Seconds:Sectors timecode used in PlayStation CD-ROM addressing
+	nameTemplate *DumpNameTemplate // Output file name template (nil keeps the ISO9660 names)
+	logger       *common.Logger    // Logging configuration (nil follows SetVerboseMode)
+
+	layoutFile       string // Layout manifest written by Dump ("" disables)
+	layoutSourceRoot string // Dump directory or archive recorded in the layout manifest
+
+	audioTracks bool // Dump also writes the CD-DA tracks of the disc as WAV files
+	rawXA       bool // Dump keeps the whole sectors of XA and STR files
+}
+
+// MSFTimecode represents a Minutes:Seconds:Sectors timecode used in PlayStation CD-ROM addressing.
+// Components are stored in BCD, exactly as they appear in the executable. The timecode
+// serializes to JSON and YAML as "MM:SS:FF" (BCD digits), with a fourth ":UU" component
+// only when the unused byte is non-zero.
 type MSFTimecode struct {
 	Minutes byte // Minutes component (0-99)
 	Seconds byte // Seconds component (0-59)
@@ -214,64 +189,57 @@ func (msf MSFTimecode) String() string {
 // ToDecimalString returns the MSF timecode in decimal MM:SS:FF format
 // This is used for comparing with CD file MSF values
 func (msf MSFTimecode) ToDecimalString() string {
-	// Convert BCD to decimal
-	minutes := int(msf.Minutes>>4)*10 + int(msf.Minutes&0x0F)
-	seconds := int(msf.Seconds>>4)*10 + int(msf.Seconds&0x0F)
-	sectors := int(msf.Sectors>>4)*10 + int(msf.Sectors&0x0F)
-
-	return fmt.Sprintf("%02d:%02d:%02d", minutes, seconds, sectors)
+	return fmt.Sprintf("%02d:%02d:%02d", fromBCD(msf.Minutes), fromBCD(msf.Seconds), fromBCD(msf.Sectors))
 }
 
 // ToSectors converts MSF timecode to total sectors count
 func (msf MSFTimecode) ToSectors() uint32 {
-	// Convert BCD to decimal
-	minutes := uint32(msf.Minutes>>4)*10 + uint32(msf.Minutes&0x0F)
-	seconds := uint32(msf.Seconds>>4)*10 + uint32(msf.Seconds&0x0F)
-	sectors := uint32(msf.Sectors>>4)*10 + uint32(msf.Sectors&0x0F)
-
-	// Each minute = 60 seconds, each second = 75 sectors
-	return minutes*60*75 + seconds*75 + sectors
+	return psx.MSFToSectors(fromBCD(msf.Minutes), fromBCD(msf.Seconds), fromBCD(msf.Sectors))
 }
 
 // MSFFromSectors creates an MSF timecode from total sectors count
 func MSFFromSectors(totalSectors uint32) MSFTimecode {
-	// Calculate minutes, seconds, and sectors
-	minutes := totalSectors / (60 * 75)
-	remainder := totalSectors % (60 * 75)
-	seconds := remainder / 75
-	sectors := remainder % 75
-
-	// Convert to BCD format
-	minutesBCD := byte((minutes/10)<<4) | byte(minutes%10)
-	secondsBCD := byte((seconds/10)<<4) | byte(seconds%10)
-	sectorsBCD := byte((sectors/10)<<4) | byte(sectors%10)
-
+	minutes, seconds, sectors := psx.SectorsToMSF(totalSectors)
 	return MSFTimecode{
-		Minutes: minutesBCD,
-		Seconds: secondsBCD,
-		Sectors: sectorsBCD,
+		Minutes: toBCD(minutes),
+		Seconds: toBCD(seconds),
+		Sectors: toBCD(sectors),
 		Unused:  0x00,
 	}
 }
 
+// fromBCD converts a BCD byte to its decimal value
+func fromBCD(value byte) uint32 {
+	return uint32(value>>4)*10 + uint32(value&0x0F)
+}
+
+// toBCD converts a decimal value (0-99) to a BCD byte
+func toBCD(value uint32) byte {
+	return byte((value/10)<<4) | byte(value%10)
+}
+
 // FileLinkAddressEntry represents a single entry in the File Link Address table
 // Each entry is 8 bytes total:
 // - 4 bytes (big-endian): MSF timecode (minutes, seconds, sectors, unused)
 // - 4 bytes (little-endian): file size
+// Use NewFileLinkAddressEntry to keep TimecodeDecimal in sync with Timecode.
 type FileLinkAddressEntry struct {
-	Timecode        MSFTimecode // MSF timecode (4 bytes, big-endian)
-	FileSize        uint32      // File size in bytes (4 bytes, little-endian)
-	LinkedFile      *CDFileInfo // Linked file information from CD (optional)
-	TimecodeDecimal string      // Decimal representation of MSF for comparison
+	Timecode        MSFTimecode `json:"timecode" yaml:"timecode"`                                     // MSF timecode (4 bytes, big-endian)
+	FileSize        uint32      `json:"file_size" yaml:"file_size"`                                   // File size in bytes (4 bytes, little-endian)
+	LinkedFile      *CDFileInfo `json:"linked_file,omitempty" yaml:"linked_file,omitempty"`           // Linked file information from CD (optional)
+	TimecodeDecimal string      `json:"timecode_decimal,omitempty" yaml:"timecode_decimal,omitempty"` // Decimal representation of MSF for comparison
 }
 
-// CDFileInfo contains information about a file found in the CD image
+// CDFileInfo contains information about a file found in the CD image.
+// It is attached to FLA entries whose timecode matches the file position.
 type CDFileInfo struct {
-	Name     string // File name
-	FullPath string // Complete path within CD
-	LBA      uint32 // Logical Block Address
-	Size     uint32 // File size in bytes
-	MSF      string // MSF timecode in MM:SS:FF format
+	Name     string `json:"name" yaml:"name"`           // File name
+	FullPath string `json:"full_path" yaml:"full_path"` // Complete path within CD
+	LBA      uint32 `json:"lba" yaml:"lba"`             // Logical Block Address
+	Size     uint32 `json:"size" yaml:"size"`           // File size in bytes
+	MSF      string `json:"msf" yaml:"msf"`             // MSF timecode in MM:SS:FF format
+
+	SectorPayload uint32 `json:"sector_payload,omitempty" yaml:"sector_payload,omitempty"` // Data bytes per sector from the XA attributes (0 means 2048)
 }
 
 // String returns a formatted representation of the FLA entry
@@ -283,26 +251,39 @@ func (fla FileLinkAddressEntry) String() string {
 	return fmt.Sprintf("MSF: %s (%s), Size: %d bytes", fla.Timecode.String(), fla.TimecodeDecimal, fla.FileSize)
 }
 
-// FileLinkAddressTable represents the complete FLA table from a PlayStation executable
+// FileLinkAddressTable represents the complete FLA table from a PlayStation executable.
+// Count always equals len(Entries); use NewFileLinkAddressTable to build one.
 type FileLinkAddressTable struct {
-	Entries []FileLinkAddressEntry // Array of FLA entries
-	Offset  uint32                 // Offset in the executable where the table was found
-	Count   uint32                 // Number of entries in the table
+	Entries []FileLinkAddressEntry `json:"entries" yaml:"entries"` // Array of FLA entries
+	Offset  uint32                 `json:"offset" yaml:"offset"`   // Offset in the executable where the table was found
+	Count   uint32                 `json:"count" yaml:"count"`     // Number of entries in the table
+
+	Files []CDFileInfo `json:"-" yaml:"-"` // Files of the image the table was read from (nil for tables read from documents)
 }
 
-// FLADifference represents a difference between two FLA entries
+// FLADifference represents a difference between two FLA entries.
+// The original and modified values describe the file the entry points to, so a
+// list of differences is enough to update a table with ApplyFLADifferences.
 type FLADifference struct {
-	EntryIndex      uint32 // Index of the entry in the FLA table
-	TimecodeChanged bool   // Whether the MSF timecode changed
-	SizeChanged     bool   // Whether the file size changed
-	Description     string // Human-readable description of the change
+	EntryIndex       uint32      `json:"entry_index" yaml:"entry_index"`             // Index of the entry in the FLA table
+	TimecodeChanged  bool        `json:"timecode_changed" yaml:"timecode_changed"`   // Whether the MSF timecode changed
+	SizeChanged      bool        `json:"size_changed" yaml:"size_changed"`           // Whether the file size changed
+	OriginalTimecode MSFTimecode `json:"original_timecode" yaml:"original_timecode"` // Timecode in the original table
+	ModifiedTimecode MSFTimecode `json:"modified_timecode" yaml:"modified_timecode"` // Timecode in the modified table
+	OriginalSize     uint32      `json:"original_size" yaml:"original_size"`         // File size in the original image
+	ModifiedSize     uint32      `json:"modified_size" yaml:"modified_size"`         // File size in the modified image
+	Description      string      `json:"description" yaml:"description"`             // Human-readable description of the change
+
+	SectorPayload uint32 `json:"sector_payload,omitempty" yaml:"sector_payload,omitempty"` // Bytes per sector the sizes are expressed in (0 means 2048)
 }
 
 // FLAComparisonResult represents the result of comparing two FLA tables
 type FLAComparisonResult struct {
-	Differences  []FLADifference // List of differences found
-	TotalChanges int             // Total number of changes detected
+	Differences  []FLADifference `json:"differences" yaml:"differences"`     // List of differences found
+	TotalChanges int             `json:"total_changes" yaml:"total_changes"` // Total number of changes detected
 }
 
 // FLAProcessor handles File Link Address operations
-type FLAProcessor struct{}
+type FLAProcessor struct {
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
@@ -202,6 +202,22 @@ func TestGlyph(t *testing.T) {
 	}
 }
 
+func TestGlyph_IsPlaceholder(t *testing.T) {
+	placeholder := NewPlaceholderGlyph()
+	if !placeholder.IsPlaceholder() {
+		t.Error("NewPlaceholderGlyph().IsPlaceholder() = false, want true")
+	}
+
+	if len(placeholder.GlyphImage) != 0 {
+		t.Errorf("len(placeholder.GlyphImage) = %d, want 0", len(placeholder.GlyphImage))
+	}
+
+	glyph := Glyph{GlyphHeight: 16, GlyphWidth: 8, GlyphImage: make([]byte, 64)}
+	if glyph.IsPlaceholder() {
+		t.Error("Glyph{16x8}.IsPlaceholder() = true, want false")
+	}
+}
+
 func TestDialogue(t *testing.T) {
 	dialogueData := []byte{0xFF, 0xFA, 0x00, 0x10, 0x00, 0x08}
 	dialogue := Dialogue{Data: dialogueData}
@@ -297,6 +313,9 @@ func TestConstants(t *testing.T) {
 		{"NEWLINE", NEWLINE, 0xFFFD},
 		{"C04D", C04D, 0xC04D},
 		{"C04E", C04E, 0xC04E},
+		{"SPEAKER", SPEAKER, 0xC040},
+		{"NAME_WINDOW", NAME_WINDOW, 0xC041},
+		{"CLOSE_NAME_WINDOW", CLOSE_NAME_WINDOW, 0xC042},
 		{"TERMINATOR_1", TERMINATOR_1, 0xFFFE},
 		{"TERMINATOR_2", TERMINATOR_2, 0xFFFF},
 		{"GLYPH_ID_BASE", GLYPH_ID_BASE, 0x8000},
@@ -0,0 +1,258 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the cumulative dictionary of unmapped codes: glyph IDs without a
+// font character ([XXXX]) and unknown control codes (<XXXX>) found in dialogue text are
+// recorded with their file, dialogue ID and count across runs, so the remaining opcodes
+// can be researched and named.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultUnmappedCodesFile is the project file the unmapped code dictionary is kept in
+const DefaultUnmappedCodesFile = "unmapped-codes.yaml"
+
+// unmappedCodeRegex matches unmapped glyph IDs ([8030]) and unknown control codes (<FFF0>)
+var unmappedCodeRegex = regexp.MustCompile(`\[[0-9A-F]{4}\]|<[0-9A-F]{4}>`)
+
+// UnmappedOccurrence records how often a code appears in one dialogue of one file
+type UnmappedOccurrence struct {
+	File       string `yaml:"file" json:"file"`
+	DialogueID int    `yaml:"dialogue_id" json:"dialogue_id"`
+	Count      int    `yaml:"count" json:"count"`
+}
+
+// UnmappedCode is a dictionary entry. Name and Notes are left to researchers and
+// are preserved when the dictionary is updated.
+type UnmappedCode struct {
+	Code        string               `yaml:"code" json:"code"`
+	Total       int                  `yaml:"total" json:"total"`
+	Name        string               `yaml:"name,omitempty" json:"name,omitempty"`
+	Notes       string               `yaml:"notes,omitempty" json:"notes,omitempty"`
+	Occurrences []UnmappedOccurrence `yaml:"occurrences" json:"occurrences"`
+}
+
+// UnmappedDictionary is the content of the unmapped codes file
+type UnmappedDictionary struct {
+	Runs  int            `yaml:"runs" json:"runs"`
+	Codes []UnmappedCode `yaml:"codes" json:"codes"`
+}
+
+// LoadUnmappedDictionary reads a dictionary file; a missing file yields an empty dictionary
+func LoadUnmappedDictionary(path string) (*UnmappedDictionary, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &UnmappedDictionary{Codes: []UnmappedCode{}}, nil
+		}
+		return nil, fmt.Errorf("failed to read unmapped codes file: %w", err)
+	}
+
+	var dictionary UnmappedDictionary
+	if err := yaml.Unmarshal(data, &dictionary); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("failed to parse unmapped codes file: %w", err))
+	}
+	if dictionary.Codes == nil {
+		dictionary.Codes = []UnmappedCode{}
+	}
+	return &dictionary, nil
+}
+
+// SaveUnmappedDictionary writes a dictionary file
+func SaveUnmappedDictionary(path string, dictionary *UnmappedDictionary) error {
+	data, err := yaml.Marshal(dictionary)
+	if err != nil {
+		return fmt.Errorf("failed to encode unmapped codes: %w", err)
+	}
+	if err := common.WriteOutput(path, data, 0644); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write unmapped codes file: %w", err))
+	}
+	return nil
+}
+
+// CollectUnmappedCodes counts the unmapped codes of every dialogue, keyed by code then dialogue ID.
+// Codes that are known tags written in hex form ([FFF2], [C04D], [C04E]) are skipped.
+func CollectUnmappedCodes(dialogues []DialogueEntry) map[string]map[int]int {
+	counts := make(map[string]map[int]int)
+	for _, dialogue := range dialogues {
+		for _, text := range dialogueTexts(dialogue) {
+			for _, match := range unmappedCodeRegex.FindAllString(text, -1) {
+				if isKnownHexTag(match) {
+					continue
+				}
+				if counts[match] == nil {
+					counts[match] = make(map[int]int)
+				}
+				counts[match][dialogue.ID]++
+			}
+		}
+	}
+	return counts
+}
+
+// isKnownHexTag reports whether a bracketed code is a control tag the encoder understands
+func isKnownHexTag(token string) bool {
+	if token[0] != '[' {
+		return false
+	}
+	value, err := strconv.ParseUint(token[1:5], 16, 16)
+	if err != nil {
+		return false
+	}
+	switch uint16(value) {
+	case FFF2, C04D, C04E:
+		return true
+	default:
+		return false
+	}
+}
+
+// Merge replaces the occurrences recorded for file with the codes found in dialogues.
+// Merging the same file again does not inflate the counts.
+func (d *UnmappedDictionary) Merge(file string, dialogues []DialogueEntry) {
+	counts := CollectUnmappedCodes(dialogues)
+	d.Runs++
+
+	index := make(map[string]int, len(d.Codes))
+	for i := range d.Codes {
+		kept := d.Codes[i].Occurrences[:0]
+		for _, occurrence := range d.Codes[i].Occurrences {
+			if occurrence.File != file {
+				kept = append(kept, occurrence)
+			}
+		}
+		d.Codes[i].Occurrences = kept
+		index[d.Codes[i].Code] = i
+	}
+
+	for token, perDialogue := range counts {
+		i, exists := index[token]
+		if !exists {
+			i = len(d.Codes)
+			index[token] = i
+			d.Codes = append(d.Codes, UnmappedCode{Code: token})
+		}
+		for dialogueID, count := range perDialogue {
+			d.Codes[i].Occurrences = append(d.Codes[i].Occurrences, UnmappedOccurrence{File: file, DialogueID: dialogueID, Count: count})
+		}
+	}
+
+	d.normalize()
+}
+
+// normalize recomputes totals, drops codes that are no longer seen and have no
+// research notes, and sorts codes and occurrences for stable output
+func (d *UnmappedDictionary) normalize() {
+	codes := d.Codes[:0]
+	for _, code := range d.Codes {
+		code.Total = 0
+		for _, occurrence := range code.Occurrences {
+			code.Total += occurrence.Count
+		}
+		if code.Total == 0 && code.Name == "" && code.Notes == "" {
+			continue
+		}
+		sort.Slice(code.Occurrences, func(i, j int) bool {
+			if code.Occurrences[i].File != code.Occurrences[j].File {
+				return code.Occurrences[i].File < code.Occurrences[j].File
+			}
+			return code.Occurrences[i].DialogueID < code.Occurrences[j].DialogueID
+		})
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool { return codes[i].Code < codes[j].Code })
+	d.Codes = codes
+}
+
+// RecordUnmappedCodes merges the codes found in dialogues into the dictionary file at path
+func RecordUnmappedCodes(path, file string, dialogues []DialogueEntry) error {
+	dictionary, err := LoadUnmappedDictionary(path)
+	if err != nil {
+		return err
+	}
+	dictionary.Merge(file, dialogues)
+	if err := SaveUnmappedDictionary(path, dictionary); err != nil {
+		return err
+	}
+	common.LogInfo("Unmapped codes: %d distinct codes recorded in %s", len(dictionary.Codes), path)
+	return nil
+}
+
+// UnmappedSummary is one row of the cross-run summary
+type UnmappedSummary struct {
+	Code      string `json:"code"`
+	Name      string `json:"name,omitempty"`
+	Total     int    `json:"total"`
+	Files     int    `json:"files"`
+	Dialogues int    `json:"dialogues"`
+}
+
+// SummarizeUnmappedCodes returns one row per code, most frequent first
+func SummarizeUnmappedCodes(dictionary *UnmappedDictionary) []UnmappedSummary {
+	summary := make([]UnmappedSummary, 0, len(dictionary.Codes))
+	for _, code := range dictionary.Codes {
+		files := make(map[string]bool)
+		for _, occurrence := range code.Occurrences {
+			files[occurrence.File] = true
+		}
+		summary = append(summary, UnmappedSummary{
+			Code:      code.Code,
+			Name:      code.Name,
+			Total:     code.Total,
+			Files:     len(files),
+			Dialogues: len(code.Occurrences),
+		})
+	}
+	sort.SliceStable(summary, func(i, j int) bool { return summary[i].Total > summary[j].Total })
+	return summary
+}
+
+// WriteUnmappedReport writes the summary of the dictionary in the requested format (json or markdown)
+func WriteUnmappedReport(dictionary *UnmappedDictionary, format string, writer io.Writer) error {
+	summary := SummarizeUnmappedCodes(dictionary)
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(summary); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeUnmappedMarkdown(dictionary.Runs, summary, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeUnmappedMarkdown renders the summary as a markdown document
+func writeUnmappedMarkdown(runs int, summary []UnmappedSummary, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString("# Unmapped Codes\n\n")
+	sb.WriteString(fmt.Sprintf("Recorded over %d runs.\n\n", runs))
+	if len(summary) == 0 {
+		sb.WriteString("No unmapped codes recorded.\n")
+	} else {
+		sb.WriteString("| Code | Name | Total | Files | Dialogues |\n")
+		sb.WriteString("|------|------|-------|-------|-----------|\n")
+		for _, row := range summary {
+			sb.WriteString(fmt.Sprintf("| `%s` | %s | %d | %d | %d |\n", row.Code, row.Name, row.Total, row.Files, row.Dialogues))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
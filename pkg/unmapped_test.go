@@ -0,0 +1,98 @@
+// Package pkg provides tests for the cumulative unmapped code dictionary
+package pkg
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func unmappedDialogues(texts ...string) []DialogueEntry {
+	dialogues := make([]DialogueEntry, len(texts))
+	for i, text := range texts {
+		dialogues[i] = DialogueEntry{ID: i, Content: []map[string]interface{}{{"text": text}}}
+	}
+	return dialogues
+}
+
+func TestCollectUnmappedCodes(t *testing.T) {
+	dialogues := unmappedDialogues("A[8030]B[8030]", "[FFF2][C04D]<FFF0>", "[HALT][8031]")
+
+	counts := CollectUnmappedCodes(dialogues)
+
+	tests := []struct {
+		code       string
+		dialogueID int
+		want       int
+	}{
+		{"[8030]", 0, 2},
+		{"<FFF0>", 1, 1},
+		{"[8031]", 2, 1},
+	}
+	for _, tt := range tests {
+		if got := counts[tt.code][tt.dialogueID]; got != tt.want {
+			t.Errorf("counts[%s][%d] = %d, want %d", tt.code, tt.dialogueID, got, tt.want)
+		}
+	}
+	if len(counts) != 3 {
+		t.Errorf("len(counts) = %d, want 3 (known hex tags must be skipped)", len(counts))
+	}
+}
+
+func TestUnmappedDictionary_Merge(t *testing.T) {
+	dictionary := &UnmappedDictionary{
+		Codes: []UnmappedCode{{Code: "[8031]", Name: "heart", Notes: "seen in shop dialogues"}},
+	}
+
+	dictionary.Merge("A.WFM", unmappedDialogues("[8030][8030]"))
+	dictionary.Merge("B.WFM", unmappedDialogues("[8030]", "[8031]"))
+	// Decoding A.WFM again replaces its occurrences instead of adding to them
+	dictionary.Merge("A.WFM", unmappedDialogues("[8030]"))
+
+	if dictionary.Runs != 3 {
+		t.Errorf("Runs = %d, want 3", dictionary.Runs)
+	}
+	if len(dictionary.Codes) != 2 {
+		t.Fatalf("len(Codes) = %d, want 2", len(dictionary.Codes))
+	}
+
+	code := dictionary.Codes[0]
+	if code.Code != "[8030]" || code.Total != 2 || len(code.Occurrences) != 2 {
+		t.Errorf("Codes[0] = %+v, want [8030] with total 2 in 2 files", code)
+	}
+
+	named := dictionary.Codes[1]
+	if named.Name != "heart" || named.Notes == "" || named.Total != 1 {
+		t.Errorf("Codes[1] = %+v, want research notes kept and total 1", named)
+	}
+}
+
+func TestRecordUnmappedCodes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultUnmappedCodesFile)
+
+	if err := RecordUnmappedCodes(path, "A.WFM", unmappedDialogues("[8030]")); err != nil {
+		t.Fatalf("RecordUnmappedCodes() failed: %v", err)
+	}
+	if err := RecordUnmappedCodes(path, "B.WFM", unmappedDialogues("[8030]<FFF0>")); err != nil {
+		t.Fatalf("RecordUnmappedCodes() failed: %v", err)
+	}
+
+	dictionary, err := LoadUnmappedDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUnmappedDictionary() failed: %v", err)
+	}
+
+	summary := SummarizeUnmappedCodes(dictionary)
+	if len(summary) != 2 || summary[0].Code != "[8030]" || summary[0].Files != 2 || summary[0].Total != 2 {
+		t.Errorf("SummarizeUnmappedCodes() = %+v, want [8030] first in 2 files", summary)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteUnmappedReport(dictionary, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteUnmappedReport() failed: %v", err)
+	}
+	if !strings.Contains(buffer.String(), "Recorded over 2 runs") || !strings.Contains(buffer.String(), "| `<FFF0>` |") {
+		t.Errorf("markdown report missing runs or codes:\n%s", buffer.String())
+	}
+}
@@ -0,0 +1,328 @@
+// Package wfm implements the binary WFM3 font and dialogue container of the Tomba!
+// PlayStation game.
+// This file contains the decoder reading WFM file structures and data.
+package wfm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Decoder decodes WFM files into structured data
+type Decoder struct {
+	logger     *common.Logger // Logging configuration (nil follows SetVerboseMode)
+	lazyGlyphs bool           // Record glyph image offsets instead of reading the images
+}
+
+// NewDecoder creates a new WFM decoder instance
+func NewDecoder() *Decoder {
+	return &Decoder{}
+}
+
+// SetLogger sets the logging configuration of the decoder (nil follows SetVerboseMode)
+func (d *Decoder) SetLogger(logger *common.Logger) {
+	d.logger = logger
+}
+
+// SetLazyGlyphs makes Decode record where every glyph image is instead of reading it,
+// when the reader supports io.ReaderAt and io.Seeker (an *os.File or *bytes.Reader).
+// Glyph.Image then reads the bytes on demand, which keeps the images of large fonts out
+// of memory; the reader must stay open while the glyphs are used.
+func (d *Decoder) SetLazyGlyphs(enabled bool) {
+	d.lazyGlyphs = enabled
+}
+
+// Decode reads and parses a complete WFM file from the provided reader.
+// This is the main entry point for WFM file parsing, handling header, glyphs, and dialogues.
+// Parameters:
+//   - reader: io.Reader containing WFM file data to decode
+//
+// Returns a pointer to the decoded File structure, or an error if parsing fails.
+func (d *Decoder) Decode(reader io.Reader) (*File, error) {
+	file := &File{}
+
+	// Decode the WFM file header first
+	header, err := d.DecodeHeader(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+	file.Header = *header
+
+	// Decode glyph data
+	glyphPointers, glyphs, err := d.DecodeGlyphs(reader, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode glyphs: %w", err)
+	}
+	file.GlyphPointerTable = glyphPointers
+	file.Glyphs = glyphs
+
+	// Decode dialogue data
+	dialoguePointers, dialogues, err := d.DecodeDialogues(reader, header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode dialogue: %w", err)
+	}
+	file.DialoguePointerTable = dialoguePointers
+	file.Dialogues = dialogues
+
+	return file, nil
+}
+
+// readError tags an error reading the file structures as a format error: the file ends
+// before the structures its header announces
+func readError(err error, format string, args ...any) error {
+	return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf(format+": %w", append(args, err)...))
+}
+
+// DecodeHeader reads and parses the WFM file header structure.
+// The header contains metadata about the file including magic signature,
+// dialogue counts, glyph information, and pointer tables.
+// Parameters:
+//   - reader: io.Reader positioned at the start of the WFM file
+//
+// Returns a pointer to the decoded Header structure, or an error if parsing fails.
+func (d *Decoder) DecodeHeader(reader io.Reader) (*Header, error) {
+	header := &Header{}
+
+	// Read and validate magic header signature
+	if err := binary.Read(reader, binary.LittleEndian, &header.Magic); err != nil {
+		return nil, readError(err, "failed to read magic header")
+	}
+
+	// Validate magic header
+	if string(header.Magic[:]) != common.WFMFileMagic {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("invalid magic header: expected '%s', got '%s'", common.WFMFileMagic, string(header.Magic[:])))
+	}
+
+	// Read padding
+	if err := binary.Read(reader, binary.LittleEndian, &header.Padding); err != nil {
+		return nil, readError(err, "failed to read padding")
+	}
+
+	// Read dialog pointer table offset
+	if err := binary.Read(reader, binary.LittleEndian, &header.DialoguePointerTable); err != nil {
+		return nil, readError(err, "failed to read dialogue pointer table")
+	}
+	d.logger.Debug(common.DebugHeaderPointerTable, header.DialoguePointerTable, header.DialoguePointerTable)
+
+	// Read total dialogs count
+	if err := binary.Read(reader, binary.LittleEndian, &header.TotalDialogues); err != nil {
+		return nil, readError(err, "failed to read total dialogues")
+	}
+
+	// Read total glyphs count
+	if err := binary.Read(reader, binary.LittleEndian, &header.TotalGlyphs); err != nil {
+		return nil, readError(err, "failed to read total glyphs")
+	}
+
+	// Skip reserved 128 bytes
+	if err := binary.Read(reader, binary.LittleEndian, &header.Reserved); err != nil {
+		return nil, readError(err, "failed to read reserved bytes")
+	}
+
+	return header, nil
+}
+
+// DecodeGlyphs reads the glyph pointer table and glyph data
+func (d *Decoder) DecodeGlyphs(reader io.Reader, header *Header) ([]uint16, []Glyph, error) {
+	glyphPointers, err := d.readGlyphPointers(reader, header.TotalGlyphs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	glyphs, err := d.readGlyphData(reader, header.TotalGlyphs)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return glyphPointers, glyphs, nil
+}
+
+// readGlyphPointers reads the glyph pointer table
+func (d *Decoder) readGlyphPointers(reader io.Reader, totalGlyphs uint16) ([]uint16, error) {
+	glyphPointers := make([]uint16, totalGlyphs)
+
+	for i := uint16(0); i < totalGlyphs; i++ {
+		if err := binary.Read(reader, binary.LittleEndian, &glyphPointers[i]); err != nil {
+			return nil, readError(err, "failed to read glyph pointer %d", i)
+		}
+	}
+
+	return glyphPointers, nil
+}
+
+// readGlyphData reads glyph data for all glyphs
+func (d *Decoder) readGlyphData(reader io.Reader, totalGlyphs uint16) ([]Glyph, error) {
+	glyphs := make([]Glyph, totalGlyphs)
+
+	for i := uint16(0); i < totalGlyphs; i++ {
+		glyph, err := d.readSingleGlyph(reader)
+		if err != nil {
+			// Keep the slot as a placeholder so later glyph indices are preserved
+			d.logger.Debug("Glyph %d could not be read, storing placeholder: %v", i, err)
+			glyph = NewPlaceholderGlyph()
+		}
+		glyphs[i] = glyph
+	}
+
+	return glyphs, nil
+}
+
+// readSingleGlyph reads a single glyph structure
+func (d *Decoder) readSingleGlyph(reader io.Reader) (Glyph, error) {
+	glyph := Glyph{}
+
+	// Read glyph header
+	if err := d.readGlyphHeader(reader, &glyph); err != nil {
+		return glyph, err
+	}
+
+	// Read glyph image data
+	if err := d.readGlyphImage(reader, &glyph); err != nil {
+		return glyph, err
+	}
+
+	return glyph, nil
+}
+
+// readGlyphHeader reads the glyph header (clut, height, width, handakuten)
+func (d *Decoder) readGlyphHeader(reader io.Reader, glyph *Glyph) error {
+	if err := binary.Read(reader, binary.LittleEndian, &glyph.GlyphClut); err != nil {
+		return err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &glyph.GlyphHeight); err != nil {
+		return err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &glyph.GlyphWidth); err != nil {
+		return err
+	}
+	if err := binary.Read(reader, binary.LittleEndian, &glyph.GlyphHandakuten); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readGlyphImage reads the glyph image data
+func (d *Decoder) readGlyphImage(reader io.Reader, glyph *Glyph) error {
+	// Calculate expected image size (4bpp = 4 bits per pixel = 0.5 bytes per pixel)
+	if glyph.GlyphWidth == 0 || glyph.GlyphHeight == 0 {
+		glyph.GlyphImage = []byte{}
+		return nil
+	}
+
+	imageSize := (int(glyph.GlyphWidth)*int(glyph.GlyphHeight) + 1) / 2
+	if imageSize <= 0 || imageSize >= 10000 { // Reasonable size limit
+		glyph.GlyphImage = []byte{}
+		return nil
+	}
+
+	if d.lazyGlyphs {
+		if lazy, ok := reader.(interface {
+			io.ReaderAt
+			io.Seeker
+		}); ok {
+			return d.skipGlyphImage(lazy, glyph, imageSize)
+		}
+	}
+
+	glyph.GlyphImage = make([]byte, imageSize)
+	if _, err := io.ReadFull(reader, glyph.GlyphImage); err != nil {
+		glyph.GlyphImage = []byte{}
+		return err
+	}
+
+	return nil
+}
+
+// skipGlyphImage records the offset of the glyph image and seeks past it. The last byte
+// is read so a truncated image fails here, as it does when read in full.
+func (d *Decoder) skipGlyphImage(reader interface {
+	io.ReaderAt
+	io.Seeker
+}, glyph *Glyph, imageSize int) error {
+	offset, err := reader.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := reader.ReadAt(make([]byte, 1), offset+int64(imageSize)-1); err != nil {
+		glyph.GlyphImage = []byte{}
+		return io.ErrUnexpectedEOF
+	}
+	if _, err := reader.Seek(int64(imageSize), io.SeekCurrent); err != nil {
+		return err
+	}
+	glyph.source, glyph.imageOffset, glyph.imageSize = reader, offset, imageSize
+	return nil
+}
+
+// DecodeDialogs reads the dialog pointer table and dialog data
+func (d *Decoder) DecodeDialogues(reader io.Reader, header *Header) ([]uint16, []Dialogue, error) {
+	dialoguePointers := make([]uint16, header.TotalDialogues)
+	dialogues := make([]Dialogue, header.TotalDialogues)
+
+	d.logger.Debug(common.DebugReadingDialoguePointers, header.TotalDialogues)
+
+	// Read dialog pointer table
+	for i := uint16(0); i < header.TotalDialogues; i++ {
+		if err := binary.Read(reader, binary.LittleEndian, &dialoguePointers[i]); err != nil {
+			return nil, nil, readError(err, "failed to read dialog pointer %d", i)
+		}
+		if i < 10 { // Show first 10 pointers for debugging
+			d.logger.Debug(common.DebugDialoguePointer, i, dialoguePointers[i], dialoguePointers[i])
+		}
+	}
+
+	// Calculate base offset for dialogue data (start of dialogue pointer table)
+	dialogueTableStart := int64(header.DialoguePointerTable)
+
+	// Read dialogue data using pointers
+	for i := uint16(0); i < header.TotalDialogues; i++ {
+		pointer := dialoguePointers[i]
+
+		// Skip null pointers
+		if pointer == 0 {
+			dialogues[i] = Dialogue{Data: []byte{}}
+			continue
+		}
+
+		// Calculate absolute offset: base address + relative pointer
+		absoluteOffset := dialogueTableStart + int64(pointer)
+
+		// Create a seeker from the reader if possible
+		if seeker, ok := reader.(io.ReadSeeker); ok {
+			// Seek to dialogue position
+			_, err := seeker.Seek(absoluteOffset, io.SeekStart)
+			if err != nil {
+				common.LogWarn(common.WarnSeekToDialogue, i, absoluteOffset, err)
+				dialogues[i] = Dialogue{Data: []byte{}}
+				continue
+			}
+
+			// Read dialogue data until 0xFFFF terminator
+			var dialogueData []byte
+			for {
+				var word uint16
+				if err := binary.Read(reader, binary.LittleEndian, &word); err != nil {
+					break // End of file or read error
+				}
+
+				// Check for terminator
+				if word == 0xFFFF {
+					break
+				}
+
+				// Add word to dialogue data (little endian)
+				dialogueData = append(dialogueData, byte(word&0xFF), byte((word>>8)&0xFF))
+			}
+
+			dialogues[i] = Dialogue{Data: dialogueData}
+		} else {
+			// If we can't seek, create empty dialogue
+			dialogues[i] = Dialogue{Data: []byte{}}
+		}
+	}
+
+	return dialoguePointers, dialogues, nil
+}
@@ -0,0 +1,154 @@
+// Package wfm implements the binary WFM3 font and dialogue container of the Tomba!
+// PlayStation game.
+// This file contains the layout phase of WFM encoding: the offset of every section is
+// planned once, header fields and pointer tables are derived from that plan, and the
+// writer checks that each section lands at its planned offset.
+package wfm
+
+import (
+	"fmt"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Layout is the planned position of every section of an encoded WFM file
+type Layout struct {
+	GlyphPointerTable    uint32   // Offset of the glyph pointer table
+	Glyphs               []uint32 // Offset of each glyph record
+	GlyphPadding         []uint32 // Padding bytes written after each glyph record
+	TablePadding         uint32   // Padding bytes before the dialogue pointer table
+	DialoguePointerTable uint32   // Offset of the dialogue pointer table
+	Dialogues            []uint32 // Offset of each dialogue
+	DialoguePadding      []uint32 // Padding bytes written after each dialogue
+	ContentSize          uint32   // Size of the file before the final padding
+}
+
+// PlanLayout computes the offset of every section for the given glyphs and dialogues
+func PlanLayout(glyphs []Glyph, dialogues []Dialogue) (*Layout, error) {
+	glyphTableSize, err := common.SafeIntToUint32(len(glyphs) * 2)
+	if err != nil {
+		return nil, fmt.Errorf("glyph table size calculation failed: %w", err)
+	}
+
+	layout := &Layout{
+		GlyphPointerTable: HeaderSize,
+		Glyphs:            make([]uint32, len(glyphs)),
+		GlyphPadding:      make([]uint32, len(glyphs)),
+		Dialogues:         make([]uint32, len(dialogues)),
+		DialoguePadding:   make([]uint32, len(dialogues)),
+	}
+
+	offset := layout.GlyphPointerTable + glyphTableSize
+	for i, glyph := range glyphs {
+		recordSize, err := common.SafeIntToUint32(GlyphAttributesSize + glyph.ImageSize())
+		if err != nil {
+			return nil, fmt.Errorf("glyph %d image too large: %w", i, err)
+		}
+		layout.Glyphs[i] = offset
+		layout.GlyphPadding[i] = alignTo(recordSize, Alignment) - recordSize
+		offset += recordSize + layout.GlyphPadding[i]
+	}
+
+	layout.DialoguePointerTable = alignTo(offset, Alignment)
+	layout.TablePadding = layout.DialoguePointerTable - offset
+
+	dialogueTableSize, err := common.SafeIntToUint32(len(dialogues) * 2)
+	if err != nil {
+		return nil, fmt.Errorf("dialogue table size calculation failed: %w", err)
+	}
+	offset = layout.DialoguePointerTable + dialogueTableSize
+	for i, dialogue := range dialogues {
+		dataSize, err := common.SafeIntToUint32(len(dialogue.Data))
+		if err != nil {
+			return nil, fmt.Errorf("dialogue %d data too large: %w", i, err)
+		}
+		layout.Dialogues[i] = offset
+		// The last dialogue is not padded
+		if i < len(dialogues)-1 {
+			layout.DialoguePadding[i] = alignTo(dataSize, Alignment) - dataSize
+		}
+		offset += dataSize + layout.DialoguePadding[i]
+	}
+	layout.ContentSize = offset
+
+	return layout, nil
+}
+
+// GlyphPointers returns the glyph pointer table: absolute offsets of the glyph records.
+// The game reads 16-bit pointers, so no record can start past 0xFFFF; the error tells
+// how far the glyph section is over the limit.
+func (l *Layout) GlyphPointers() ([]uint16, error) {
+	pointers := make([]uint16, len(l.Glyphs))
+	for i, offset := range l.Glyphs {
+		if offset > MaxPointer {
+			excess := l.Glyphs[len(l.Glyphs)-1] - MaxPointer
+			return nil, common.WithCategory(common.ErrCategoryValidationFailed,
+				fmt.Errorf("glyph %d of %d starts at 0x%X, past the 0x%X reach of the 16-bit glyph pointers the game reads; "+
+					"the glyph section is %d bytes too large: remove or shrink glyphs",
+					i, len(l.Glyphs), offset, MaxPointer, excess))
+		}
+		pointers[i] = uint16(offset)
+	}
+	return pointers, nil
+}
+
+// DialoguePointers returns the dialogue pointer table: offsets relative to the table start
+func (l *Layout) DialoguePointers() ([]uint16, error) {
+	pointers := make([]uint16, len(l.Dialogues))
+	for i, offset := range l.Dialogues {
+		pointer, err := common.SafeUint32ToUint16(offset - l.DialoguePointerTable)
+		if err != nil {
+			return nil, fmt.Errorf("dialogue %d offset too large: %d", i, offset-l.DialoguePointerTable)
+		}
+		pointers[i] = pointer
+	}
+	return pointers, nil
+}
+
+// Verify checks that the header fields and pointer tables of a built WFM file match the plan
+func (l *Layout) Verify(file *File) error {
+	if file.Header.DialoguePointerTable != l.DialoguePointerTable {
+		return common.FormatErrorString(common.ErrLayoutMismatch, "header dialogue pointer table 0x%X, planned 0x%X",
+			file.Header.DialoguePointerTable, l.DialoguePointerTable)
+	}
+
+	glyphPointers, err := l.GlyphPointers()
+	if err != nil {
+		return err
+	}
+	if len(file.GlyphPointerTable) != len(glyphPointers) {
+		return common.FormatErrorString(common.ErrLayoutMismatch, "%d glyph pointers, planned %d",
+			len(file.GlyphPointerTable), len(glyphPointers))
+	}
+	for i, pointer := range glyphPointers {
+		if file.GlyphPointerTable[i] != pointer {
+			return common.FormatErrorString(common.ErrLayoutMismatch, "glyph pointer %d is 0x%X, planned 0x%X",
+				i, file.GlyphPointerTable[i], pointer)
+		}
+	}
+
+	dialoguePointers, err := l.DialoguePointers()
+	if err != nil {
+		return err
+	}
+	if len(file.DialoguePointerTable) != len(dialoguePointers) {
+		return common.FormatErrorString(common.ErrLayoutMismatch, "%d dialogue pointers, planned %d",
+			len(file.DialoguePointerTable), len(dialoguePointers))
+	}
+	for i, pointer := range dialoguePointers {
+		if file.DialoguePointerTable[i] != pointer {
+			return common.FormatErrorString(common.ErrLayoutMismatch, "dialogue pointer %d is 0x%X, planned 0x%X",
+				i, file.DialoguePointerTable[i], pointer)
+		}
+	}
+
+	return nil
+}
+
+// alignTo rounds a value up to the specified byte boundary
+func alignTo(value, alignment uint32) uint32 {
+	if alignment == 0 {
+		return value
+	}
+	return ((value + alignment - 1) / alignment) * alignment
+}
@@ -0,0 +1,118 @@
+// Package wfm implements the binary WFM3 font and dialogue container of the Tomba!
+// PlayStation game: the header, the glyph records and the dialogue streams.
+// The package depends only on the standard library and pkg/common, so the codec can be
+// embedded in other tools; the YAML adapter lives in pkg/dialogueyaml and the PNG adapter
+// in pkg.
+package wfm
+
+import (
+	"fmt"
+	"io"
+)
+
+// HeaderSize is the size of the WFM header:
+// Magic + Padding + DialoguePointerTable + TotalDialogues + TotalGlyphs + Reserved
+const HeaderSize = 4 + 4 + 4 + 2 + 2 + 128
+
+// GlyphAttributesSize is the size of the glyph attributes before the image data:
+// GlyphClut + GlyphHeight + GlyphWidth + GlyphHandakuten
+const GlyphAttributesSize = 2 + 2 + 2 + 2
+
+// Alignment is the alignment of glyph records, the dialogue pointer table and dialogues
+const Alignment = 2
+
+// MaxPointer is the largest value of a 16-bit glyph or dialogue pointer
+const MaxPointer = 0xFFFF
+
+// Header represents the main header of a WFM file structure
+type Header struct {
+	Magic                [4]byte // Always "WFM3"
+	Padding              uint32
+	DialoguePointerTable uint32
+	TotalDialogues       uint16
+	TotalGlyphs          uint16
+	Reserved             [128]byte // Reserved section (may contain special dialogue IDs)
+}
+
+// Glyph represents the data for a single glyph
+type Glyph struct {
+	GlyphClut       uint16 // Color lookup table data
+	GlyphHeight     uint16 // Height of the glyph
+	GlyphWidth      uint16 // Width of the glyph
+	GlyphHandakuten uint16 // Handakuten marker (Japanese diacritical mark)
+	GlyphImage      []byte // Raw image data (nil while a lazily decoded image is not loaded)
+
+	// Lazily decoded glyphs keep the position of their image in the WFM file instead
+	// of its bytes; see Decoder.SetLazyGlyphs
+	source      io.ReaderAt
+	imageOffset int64
+	imageSize   int
+}
+
+// NewPlaceholderGlyph creates an empty placeholder glyph (0x0 dimensions).
+// Placeholders keep their slot in the glyph pointer table so that encode values
+// referencing later glyphs are not shifted.
+func NewPlaceholderGlyph() Glyph {
+	return Glyph{
+		GlyphClut:       0,
+		GlyphHeight:     0,
+		GlyphWidth:      0,
+		GlyphHandakuten: 0,
+		GlyphImage:      []byte{},
+	}
+}
+
+// IsPlaceholder reports whether the glyph is an empty placeholder slot
+func (g Glyph) IsPlaceholder() bool {
+	return g.GlyphWidth == 0 || g.GlyphHeight == 0
+}
+
+// Image returns the raw image data of the glyph, reading it from the WFM file when the
+// glyph was decoded lazily. The bytes read are not kept, so every call reads them again.
+func (g Glyph) Image() ([]byte, error) {
+	if g.source == nil {
+		return g.GlyphImage, nil
+	}
+	data := make([]byte, g.imageSize)
+	if _, err := g.source.ReadAt(data, g.imageOffset); err != nil {
+		return nil, fmt.Errorf("failed to read glyph image at offset 0x%X: %w", g.imageOffset, err)
+	}
+	return data, nil
+}
+
+// ImageSize returns the size in bytes of the raw image data, without loading it
+func (g Glyph) ImageSize() int {
+	if g.source == nil {
+		return len(g.GlyphImage)
+	}
+	return g.imageSize
+}
+
+// LoadImage reads a lazily decoded image into GlyphImage, so the glyph no longer depends
+// on the WFM file staying open
+func (g *Glyph) LoadImage() error {
+	if g.source == nil {
+		return nil
+	}
+	data, err := g.Image()
+	if err != nil {
+		return err
+	}
+	g.GlyphImage, g.source = data, nil
+	return nil
+}
+
+// Dialogue represents a dialog entry in the WFM file
+type Dialogue struct {
+	Data []byte
+}
+
+// File represents the complete structure of a WFM file
+type File struct {
+	Header               Header
+	GlyphPointerTable    []uint16
+	Glyphs               []Glyph
+	DialoguePointerTable []uint16
+	Dialogues            []Dialogue
+	OriginalSize         int64 // Size of the original WFM file in bytes
+}
@@ -0,0 +1,153 @@
+// Package wfm provides tests for the WFM layout, writer and decoder
+package wfm
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestPlanLayout(t *testing.T) {
+	glyphs := []Glyph{
+		{GlyphImage: make([]byte, 3)}, // Odd record size needs one padding byte
+		{GlyphImage: make([]byte, 32)},
+	}
+	dialogues := []Dialogue{
+		{Data: make([]byte, 5)},
+		{Data: make([]byte, 4)},
+		{Data: make([]byte, 3)}, // Last dialogue is never padded
+	}
+
+	layout, err := PlanLayout(glyphs, dialogues)
+	if err != nil {
+		t.Fatalf("PlanLayout() failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		got  interface{}
+		want interface{}
+	}{
+		{"GlyphPointerTable", layout.GlyphPointerTable, uint32(HeaderSize)},
+		{"Glyphs[0]", layout.Glyphs[0], uint32(HeaderSize + 4)},
+		{"GlyphPadding[0]", layout.GlyphPadding[0], uint32(1)},
+		{"Glyphs[1]", layout.Glyphs[1], uint32(HeaderSize + 4 + 12)},
+		{"DialoguePointerTable", layout.DialoguePointerTable, uint32(HeaderSize + 4 + 12 + 40)},
+		{"Dialogues[0]", layout.Dialogues[0], uint32(HeaderSize + 56 + 6)},
+		{"Dialogues[1]", layout.Dialogues[1], uint32(HeaderSize + 56 + 12)},
+		{"Dialogues[2]", layout.Dialogues[2], uint32(HeaderSize + 56 + 16)},
+		{"DialoguePadding[2]", layout.DialoguePadding[2], uint32(0)},
+		{"ContentSize", layout.ContentSize, uint32(HeaderSize + 56 + 19)},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+
+	pointers, err := layout.DialoguePointers()
+	if err != nil {
+		t.Fatalf("dialoguePointers() failed: %v", err)
+	}
+	if want := []uint16{6, 12, 16}; pointers[0] != want[0] || pointers[1] != want[1] || pointers[2] != want[2] {
+		t.Errorf("dialoguePointers() = %v, want %v", pointers, want)
+	}
+}
+
+// testFile builds a WFM file with two glyphs and two dialogues laid out by PlanLayout
+func testFile(t *testing.T) *File {
+	t.Helper()
+	file := &File{
+		Glyphs: []Glyph{
+			{GlyphClut: 0x1234, GlyphHeight: 2, GlyphWidth: 2, GlyphImage: []byte{0x11, 0x22}},
+			{GlyphClut: 0x1234, GlyphHeight: 8, GlyphWidth: 8, GlyphImage: bytes.Repeat([]byte{0x44}, 32)},
+		},
+		Dialogues: []Dialogue{
+			{Data: []byte{0x00, 0x80, 0x01, 0x80, 0xFF, 0xFF}},
+			{Data: []byte{0x01, 0x80, 0xFF, 0xFF}},
+		},
+	}
+	copy(file.Header.Magic[:], common.WFMFileMagic)
+	file.Header.TotalGlyphs = uint16(len(file.Glyphs))
+	file.Header.TotalDialogues = uint16(len(file.Dialogues))
+
+	layout, err := PlanLayout(file.Glyphs, file.Dialogues)
+	if err != nil {
+		t.Fatalf("PlanLayout() failed: %v", err)
+	}
+	file.Header.DialoguePointerTable = layout.DialoguePointerTable
+	if file.GlyphPointerTable, err = layout.GlyphPointers(); err != nil {
+		t.Fatalf("GlyphPointers() failed: %v", err)
+	}
+	if file.DialoguePointerTable, err = layout.DialoguePointers(); err != nil {
+		t.Fatalf("DialoguePointers() failed: %v", err)
+	}
+	return file
+}
+
+// memoryFile is an in-memory io.WriteSeeker
+type memoryFile struct {
+	data     []byte
+	position int64
+}
+
+func (m *memoryFile) Write(p []byte) (int, error) {
+	m.data = append(m.data[:m.position], p...)
+	m.position += int64(len(p))
+	return len(p), nil
+}
+
+func (m *memoryFile) Seek(offset int64, whence int) (int64, error) {
+	if whence == 1 {
+		offset += m.position
+	}
+	m.position = offset
+	return offset, nil
+}
+
+func TestWrite_DecodeRoundTrip(t *testing.T) {
+	file := testFile(t)
+	var output memoryFile
+	if err := Write(context.Background(), &output, file); err != nil {
+		t.Fatalf("Write() failed: %v", err)
+	}
+
+	decoder := NewDecoder()
+	decoder.SetLazyGlyphs(true)
+	decoded, err := decoder.Decode(bytes.NewReader(output.data))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(decoded.Glyphs) != 2 || len(decoded.Dialogues) != 2 || decoded.GlyphPointerTable[1] != file.GlyphPointerTable[1] {
+		t.Fatalf("Decode() = %+v", decoded)
+	}
+	image, err := decoded.Glyphs[1].Image()
+	if err != nil || !bytes.Equal(image, file.Glyphs[1].GlyphImage) {
+		t.Errorf("lazy glyph image = % X, %v", image, err)
+	}
+	if !bytes.Equal(decoded.Dialogues[1].Data, []byte{0x01, 0x80}) {
+		t.Errorf("dialogue 1 = % X, want 01 80", decoded.Dialogues[1].Data)
+	}
+
+	file.GlyphPointerTable[1]++
+	if err := Write(context.Background(), &memoryFile{}, file); err == nil {
+		t.Error("Write() should fail when a glyph pointer differs from the layout")
+	}
+}
+
+func TestLayout_GlyphPointers_Overflow(t *testing.T) {
+	// Three 32 KiB glyph records: the third starts past the 16-bit reach
+	glyphs := make([]Glyph, 3)
+	for i := range glyphs {
+		glyphs[i] = Glyph{GlyphImage: make([]byte, 0x8000)}
+	}
+	layout, err := PlanLayout(glyphs, nil)
+	if err != nil {
+		t.Fatalf("PlanLayout() failed: %v", err)
+	}
+	if _, err := layout.GlyphPointers(); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("GlyphPointers() = %v, want a validation error", err)
+	}
+}
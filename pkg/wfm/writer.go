@@ -0,0 +1,184 @@
+// Package wfm implements the binary WFM3 font and dialogue container of the Tomba!
+// PlayStation game.
+// This file contains the writer laying out an encoded WFM file section by section.
+package wfm
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Write writes the WFM file up to the end of its last dialogue; any final padding is
+// left to the caller. The layout is planned first and checked against the header and
+// pointer tables; while writing, every section is checked against its planned offset.
+// The glyphs stop being written once ctx is canceled.
+func Write(ctx context.Context, file io.WriteSeeker, wfm *File) error {
+	layout, err := PlanLayout(wfm.Glyphs, wfm.Dialogues)
+	if err != nil {
+		return err
+	}
+	if err := layout.Verify(wfm); err != nil {
+		return err
+	}
+
+	// Write header
+	if err := writeHeader(file, &wfm.Header); err != nil {
+		return err
+	}
+
+	// Write glyph pointer table
+	if err := checkOffset(file, layout.GlyphPointerTable, "glyph pointer table"); err != nil {
+		return err
+	}
+	if err := writeGlyphPointerTable(file, wfm.GlyphPointerTable); err != nil {
+		return err
+	}
+
+	// Write glyphs
+	if err := writeGlyphs(ctx, file, wfm.Glyphs, layout); err != nil {
+		return err
+	}
+
+	// Pad up to the dialogue pointer table
+	if err := writeZeroPadding(file, layout.TablePadding, common.ErrFailedToWritePadding); err != nil {
+		return err
+	}
+
+	// Write dialogue pointer table
+	if err := checkOffset(file, layout.DialoguePointerTable, "dialogue pointer table"); err != nil {
+		return err
+	}
+	if err := writeDialoguePointerTable(file, wfm.DialoguePointerTable); err != nil {
+		return err
+	}
+
+	// Write dialogues
+	if err := writeDialogues(file, wfm.Dialogues, layout); err != nil {
+		return err
+	}
+	return checkOffset(file, layout.ContentSize, "end of content")
+}
+
+// writeHeader writes the WFM header to file
+func writeHeader(file io.Writer, header *Header) error {
+	err := binary.Write(file, binary.LittleEndian, header)
+	if err != nil {
+		return common.FormatError(common.ErrFailedToWriteHeader, err)
+	}
+	return nil
+}
+
+// writeGlyphPointerTable writes the glyph pointer table to file
+func writeGlyphPointerTable(file io.Writer, glyphPointerTable []uint16) error {
+	for _, pointer := range glyphPointerTable {
+		err := binary.Write(file, binary.LittleEndian, pointer)
+		if err != nil {
+			return common.FormatError(common.ErrFailedToWriteGlyphPointer, err)
+		}
+	}
+	return nil
+}
+
+// writeGlyphs writes all glyphs to file at their planned offsets
+func writeGlyphs(ctx context.Context, file io.WriteSeeker, glyphs []Glyph, layout *Layout) error {
+	for i, glyph := range glyphs {
+		if err := common.Canceled(ctx); err != nil {
+			return err
+		}
+		if err := checkOffset(file, layout.Glyphs[i], fmt.Sprintf("glyph %d", i)); err != nil {
+			return err
+		}
+		if err := writeSingleGlyph(file, glyph); err != nil {
+			return err
+		}
+		if err := writeZeroPadding(file, layout.GlyphPadding[i], common.ErrFailedToWriteGlyphPadding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSingleGlyph writes a single glyph to file
+func writeSingleGlyph(file io.Writer, glyph Glyph) error {
+	// Write glyph attributes
+	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphClut); err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphClut, err)
+	}
+
+	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphHeight); err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphHeight, err)
+	}
+
+	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphWidth); err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphWidth, err)
+	}
+
+	if err := binary.Write(file, binary.LittleEndian, glyph.GlyphHandakuten); err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphHandakuten, err)
+	}
+
+	// Write image data
+	imageData, err := glyph.Image()
+	if err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphImage, err)
+	}
+	if _, err := file.Write(imageData); err != nil {
+		return common.FormatError(common.ErrFailedToWriteGlyphImage, err)
+	}
+
+	return nil
+}
+
+// writeZeroPadding writes size zero bytes
+func writeZeroPadding(file io.Writer, size uint32, errorMessage string) error {
+	if size == 0 {
+		return nil
+	}
+	if _, err := file.Write(make([]byte, size)); err != nil {
+		return common.FormatError(errorMessage, err)
+	}
+	return nil
+}
+
+// writeDialoguePointerTable writes the dialogue pointer table to file
+func writeDialoguePointerTable(file io.Writer, dialoguePointerTable []uint16) error {
+	for _, pointer := range dialoguePointerTable {
+		err := binary.Write(file, binary.LittleEndian, pointer)
+		if err != nil {
+			return common.FormatError(common.ErrFailedToWriteDialoguePointer, err)
+		}
+	}
+	return nil
+}
+
+// writeDialogues writes all dialogues to file at their planned offsets
+func writeDialogues(file io.WriteSeeker, dialogues []Dialogue, layout *Layout) error {
+	for i, dialogue := range dialogues {
+		if err := checkOffset(file, layout.Dialogues[i], fmt.Sprintf("dialogue %d", i)); err != nil {
+			return err
+		}
+		if _, err := file.Write(dialogue.Data); err != nil {
+			return common.FormatError(common.ErrFailedToWriteDialogueData, err)
+		}
+		if err := writeZeroPadding(file, layout.DialoguePadding[i], common.ErrFailedToWriteDialoguePadding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkOffset compares the current write position with the planned offset of a section
+func checkOffset(writer io.Seeker, planned uint32, section string) error {
+	position, err := writer.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return common.FormatError(common.ErrFailedToGetFilePosition, err)
+	}
+	if position != int64(planned) {
+		return common.FormatErrorString(common.ErrLayoutMismatch, "%s written at 0x%X, planned 0x%X", section, position, planned)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file binds the layout constants and the layout planner of the wfm package, which
+// holds the binary WFM codec, to the names used throughout this package.
+package pkg
+
+import (
+	"github.com/hansbonini/tombatools/pkg/wfm"
+)
+
+// WFMHeaderSize is the size of the WFM header
+const WFMHeaderSize = wfm.HeaderSize
+
+// wfmGlyphAttributesSize is the size of the glyph attributes before the image data
+const wfmGlyphAttributesSize = wfm.GlyphAttributesSize
+
+// wfmAlignment is the alignment of glyph records, the dialogue pointer table and dialogues
+const wfmAlignment = wfm.Alignment
+
+// wfmLayout is the planned position of every section of an encoded WFM file
+type wfmLayout = wfm.Layout
+
+// planWFMLayout computes the offset of every section for the given glyphs and dialogues
+func planWFMLayout(glyphs []Glyph, dialogues []Dialogue) (*wfmLayout, error) {
+	return wfm.PlanLayout(glyphs, dialogues)
+}
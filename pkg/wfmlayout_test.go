@@ -0,0 +1,94 @@
+// Package pkg provides tests for the planned WFM layout
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+func TestWFMFileEncoder_WriteWFMFile_MatchesLayout(t *testing.T) {
+	encoder := NewWFMEncoder()
+	glyphs := []Glyph{
+		{GlyphClut: 0x1234, GlyphHeight: 2, GlyphWidth: 2, GlyphImage: []byte{0x11, 0x22}},
+		{GlyphClut: 0x1234, GlyphHeight: 8, GlyphWidth: 8, GlyphImage: bytes.Repeat([]byte{0x44}, 32)},
+	}
+	dialogues := []Dialogue{
+		{Data: []byte{0x00, 0x80, 0x01, 0x80, 0xFF, 0xFF}},
+		{Data: []byte{0x01, 0x80, 0xFF, 0xFF}},
+	}
+
+	wfm, err := encoder.buildWFMFile(nil, map[uint16]GlyphEncodeInfo{
+		0x8000: {Glyph: glyphs[0]},
+		0x8001: {Glyph: glyphs[1]},
+	}, []uint16{0x8000, 0x8001}, []RecodedDialogue{
+		{ID: 0, EncodedText: []uint16{0x8000, 0x8001, 0xFFFF}},
+		{ID: 1, EncodedText: []uint16{0x8001, 0xFFFF}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("buildWFMFile() failed: %v", err)
+	}
+
+	outputFile := filepath.Join(t.TempDir(), "OUT.WFM")
+	if err := encoder.writeWFMFile(context.Background(), wfm, outputFile); err != nil {
+		t.Fatalf("writeWFMFile() failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("failed to read output: %v", err)
+	}
+	decoded, err := NewWFMDecoder().Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	for i, glyph := range glyphs {
+		if !bytes.Equal(decoded.Glyphs[i].GlyphImage, glyph.GlyphImage) {
+			t.Errorf("Glyphs[%d] image = % X, want % X", i, decoded.Glyphs[i].GlyphImage, glyph.GlyphImage)
+		}
+	}
+	for i, dialogue := range dialogues {
+		// The decoder stops at the terminator and does not keep it
+		want := dialogue.Data[:len(dialogue.Data)-2]
+		if !bytes.Equal(decoded.Dialogues[i].Data, want) {
+			t.Errorf("Dialogues[%d] = % X, want % X", i, decoded.Dialogues[i].Data, want)
+		}
+	}
+
+	// A header that drifted from the plan is rejected before anything is written
+	wfm.Header.DialoguePointerTable += 2
+	if err := encoder.writeWFMFile(context.Background(), wfm, filepath.Join(t.TempDir(), "BAD.WFM")); err == nil {
+		t.Error("writeWFMFile() succeeded with a drifted header, want layout mismatch")
+	}
+}
+
+// overflowTestGlyphs returns enough 24x24 glyphs to push the last glyph records past 0xFFFF
+func overflowTestGlyphs() (map[uint16]GlyphEncodeInfo, []uint16) {
+	glyphs := make(map[uint16]GlyphEncodeInfo)
+	var order []uint16
+	for i := 0; i < 230; i++ {
+		id := uint16(0x8000 + i)
+		glyphs[id] = GlyphEncodeInfo{Glyph: Glyph{GlyphClut: 0x1234, GlyphHeight: 24, GlyphWidth: 24, GlyphImage: bytes.Repeat([]byte{byte(i)}, 288)}}
+		order = append(order, id)
+	}
+	return glyphs, order
+}
+
+func TestWFMFileEncoder_GlyphSectionOverflow(t *testing.T) {
+	glyphs, order := overflowTestGlyphs()
+	dialogues := []RecodedDialogue{{ID: 0, EncodedText: []uint16{0x8000, 0x80E5, 0xFFFF}}}
+
+	// The 16-bit glyph pointers the game reads cannot reach the last glyphs
+	_, err := NewWFMEncoder().buildWFMFile(nil, glyphs, order, dialogues, nil)
+	if common.ExitCodeFor(err) != common.ExitValidationFailed || !strings.Contains(err.Error(), "16-bit glyph pointers") {
+		t.Fatalf("buildWFMFile() = %v, want a validation error naming the 16-bit glyph pointers", err)
+	}
+	if !strings.Contains(err.Error(), "bytes too large") {
+		t.Errorf("buildWFMFile() = %v, want the excess of the glyph section", err)
+	}
+}
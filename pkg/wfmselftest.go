@@ -0,0 +1,279 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains wfm selftest: every WFM file of a user-supplied corpus is decoded and
+// encoded again, and the bytes that differ from the original are attributed to the section
+// of the original file they fall in. Users with legal dumps run it locally, so the codec is
+// checked against the retail files without distributing game data.
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// Sections of a WFM file outside the header and pointer tables, used to attribute differences
+const (
+	SelfTestSectionGap     = "gap"     // Bytes between sections no pointer reaches
+	SelfTestSectionPadding = "padding" // Final padding after the last section
+	SelfTestSectionSize    = "size"    // Bytes only one of the files has
+)
+
+// WFMSelfTestSection counts the differing bytes of one section of the original file
+type WFMSelfTestSection struct {
+	Section     string `json:"section"`
+	FirstOffset int    `json:"first_offset"` // Offset of the first differing byte
+	Bytes       int    `json:"bytes"`        // Differing bytes in the section
+}
+
+// WFMSelfTestFile is the round-trip result of one WFM file of the corpus
+type WFMSelfTestFile struct {
+	File         string               `json:"file"`
+	OriginalSize int                  `json:"original_size"`
+	EncodedSize  int                  `json:"encoded_size"`
+	Identical    bool                 `json:"identical"`
+	Sections     []WFMSelfTestSection `json:"sections,omitempty"`
+	Error        string               `json:"error,omitempty"` // Decode or encode failure
+}
+
+// WFMSelfTestReport lists the round-trip results of every WFM file of a corpus
+type WFMSelfTestReport struct {
+	Corpus    string            `json:"corpus"`
+	Identical int               `json:"identical"`
+	Different int               `json:"different"`
+	Failed    int               `json:"failed"`
+	Files     []WFMSelfTestFile `json:"files"`
+}
+
+// OK reports whether every file of the corpus was encoded back byte for byte
+func (r *WFMSelfTestReport) OK() bool {
+	return r.Different == 0 && r.Failed == 0
+}
+
+// SelfTestWFMCorpus decodes and encodes again every .WFM file below corpusDir and compares
+// the result with the original. Glyph records are taken from the original file (see
+// SetGlyphDonor), so the round trip covers the dialogue streams, the header, the pointer
+// tables, the layout and the final padding.
+func SelfTestWFMCorpus(ctx context.Context, corpusDir string) (*WFMSelfTestReport, error) {
+	var files []string
+	err := filepath.WalkDir(corpusDir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".wfm") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to scan corpus %s: %w", corpusDir, err))
+	}
+	if len(files) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("no WFM files found in %s", corpusDir))
+	}
+
+	report := &WFMSelfTestReport{Corpus: corpusDir, Files: []WFMSelfTestFile{}}
+	for _, path := range files {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+
+		result := selfTestWFMFile(ctx, path)
+		switch {
+		case result.Error != "":
+			report.Failed++
+		case result.Identical:
+			report.Identical++
+		default:
+			report.Different++
+		}
+		report.Files = append(report.Files, result)
+	}
+
+	common.LogDebug("Self-tested %d WFM files in %s: %d identical, %d different, %d failed",
+		len(files), corpusDir, report.Identical, report.Different, report.Failed)
+	return report, nil
+}
+
+// selfTestWFMFile runs the round trip of one WFM file in a temporary project directory
+func selfTestWFMFile(ctx context.Context, path string) WFMSelfTestFile {
+	result := WFMSelfTestFile{File: path}
+	fail := func(err error) WFMSelfTestFile {
+		result.Error = err.Error()
+		return result
+	}
+
+	original, err := os.ReadFile(path)
+	if err != nil {
+		return fail(fmt.Errorf("failed to read file: %w", err))
+	}
+	result.OriginalSize = len(original)
+
+	header, err := NewWFMDecoder().DecodeHeader(bytes.NewReader(original))
+	if err != nil {
+		return fail(fmt.Errorf("failed to decode header: %w", err))
+	}
+	parsed, _, err := parseWFMSections(original, header)
+	if err != nil {
+		return fail(err)
+	}
+
+	projectDir, err := common.MkdirTemp("selftest-")
+	if err != nil {
+		return fail(err)
+	}
+	defer common.RemoveTemp(projectDir)
+
+	processor := NewWFMProcessor()
+	processor.SetDialoguesOnly(true)
+	if err := processor.Process(path, projectDir); err != nil {
+		return fail(fmt.Errorf("decode failed: %w", err))
+	}
+
+	encoder := NewWFMEncoder()
+	if err := encoder.SetGlyphDonor(path); err != nil {
+		return fail(err)
+	}
+	if err := encoder.SetPaddingPolicy(0, selfTestPadByte(original, parsed.sections)); err != nil {
+		return fail(err)
+	}
+	encoded, err := encoder.EncodeBytes(ctx, filepath.Join(projectDir, "dialogues.yaml"), filepath.Base(path))
+	if err != nil {
+		return fail(fmt.Errorf("encode failed: %w", err))
+	}
+	result.EncodedSize = len(encoded)
+
+	result.Sections = diffWFMSections(original, encoded, parsed.sections)
+	result.Identical = len(result.Sections) == 0
+	return result
+}
+
+// selfTestPadByte returns the byte of the final padding of the original file, so encode
+// pads the same way (0xFF when the file has no final padding)
+func selfTestPadByte(data []byte, sections []wfmSection) byte {
+	end := 0
+	for _, section := range sections {
+		end = max(end, section.end)
+	}
+	if end < len(data) {
+		return data[end]
+	}
+	return 0xFF
+}
+
+// diffWFMSections attributes every byte that differs between the original and the
+// encoded file to the section of the original it falls in. Bytes past the end of the
+// shorter file are counted as a size difference.
+func diffWFMSections(original, encoded []byte, sections []wfmSection) []WFMSelfTestSection {
+	sorted := append([]wfmSection(nil), sections...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].start < sorted[j].start })
+	end := 0
+	for _, section := range sorted {
+		end = max(end, section.end)
+	}
+
+	// sectionOf returns the name of the last section starting at or before the offset
+	// that still covers it; shared dialogues only appear once in the sections
+	sectionOf := func(offset int) string {
+		i := sort.Search(len(sorted), func(i int) bool { return sorted[i].start > offset })
+		for i--; i >= 0; i-- {
+			if offset < sorted[i].end {
+				return sorted[i].name
+			}
+		}
+		if offset >= end {
+			return SelfTestSectionPadding
+		}
+		return SelfTestSectionGap
+	}
+
+	var diffs []WFMSelfTestSection
+	index := make(map[string]int)
+	count := func(name string, offset, size int) {
+		if i, found := index[name]; found {
+			diffs[i].Bytes += size
+			return
+		}
+		index[name] = len(diffs)
+		diffs = append(diffs, WFMSelfTestSection{Section: name, FirstOffset: offset, Bytes: size})
+	}
+
+	shared := min(len(original), len(encoded))
+	for offset := 0; offset < shared; offset++ {
+		if original[offset] != encoded[offset] {
+			count(sectionOf(offset), offset, 1)
+		}
+	}
+	if len(original) != len(encoded) {
+		count(SelfTestSectionSize, shared, max(len(original), len(encoded))-shared)
+	}
+	return diffs
+}
+
+// WriteWFMSelfTestReport writes the self-test report in the requested format (json or markdown)
+func WriteWFMSelfTestReport(report *WFMSelfTestReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeWFMSelfTestMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeWFMSelfTestMarkdown renders the self-test report as a markdown document
+func writeWFMSelfTestMarkdown(report *WFMSelfTestReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# WFM Self-Test: %s\n\n", report.Corpus))
+	sb.WriteString("| Metric | Files |\n")
+	sb.WriteString("|--------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| Identical | %d |\n", report.Identical))
+	sb.WriteString(fmt.Sprintf("| Different | %d |\n", report.Different))
+	sb.WriteString(fmt.Sprintf("| Failed | %d |\n", report.Failed))
+
+	sb.WriteString("\n## Files\n\n")
+	sb.WriteString("| File | Original size | Encoded size | Result |\n")
+	sb.WriteString("|------|---------------|--------------|--------|\n")
+	for _, file := range report.Files {
+		result := "identical"
+		switch {
+		case file.Error != "":
+			result = "failed: " + file.Error
+		case !file.Identical:
+			result = fmt.Sprintf("%d sections differ", len(file.Sections))
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %d | %d | %s |\n", file.File, file.OriginalSize, file.EncodedSize, result))
+	}
+
+	for _, file := range report.Files {
+		if len(file.Sections) == 0 {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\n## Differences: %s\n\n", file.File))
+		sb.WriteString("| Section | First offset | Bytes |\n")
+		sb.WriteString("|---------|--------------|-------|\n")
+		for _, section := range file.Sections {
+			sb.WriteString(fmt.Sprintf("| %s | 0x%X | %d |\n", section.Section, section.FirstOffset, section.Bytes))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
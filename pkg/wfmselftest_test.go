@@ -0,0 +1,87 @@
+// Package pkg provides tests for the WFM corpus self-test
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeRetailLayoutWFM writes the donor WFM with valid glyph pointers
+// and zero final padding
+func writeRetailLayoutWFM(t *testing.T, path string) {
+	t.Helper()
+	writeDonorWFM(t, path)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read donor WFM: %v", err)
+	}
+	binary.LittleEndian.PutUint16(data[WFMHeaderSize:], 148)   // Glyph 0
+	binary.LittleEndian.PutUint16(data[WFMHeaderSize+2:], 188) // Glyph 1
+	data = append(data, make([]byte, 14)...)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatalf("failed to write WFM: %v", err)
+	}
+}
+
+func TestSelfTestWFMCorpus(t *testing.T) {
+	corpus := t.TempDir()
+	writeRetailLayoutWFM(t, filepath.Join(corpus, "FONT.WFM"))
+	if err := os.MkdirAll(filepath.Join(corpus, "CD", "DATA"), 0755); err != nil {
+		t.Fatalf("failed to create corpus dir: %v", err)
+	}
+	writeRetailLayoutWFM(t, filepath.Join(corpus, "CD", "DATA", "font2.wfm"))
+	if err := os.WriteFile(filepath.Join(corpus, "BROKEN.WFM"), []byte("WFM3"), 0644); err != nil {
+		t.Fatalf("failed to write broken WFM: %v", err)
+	}
+
+	report, err := SelfTestWFMCorpus(context.Background(), corpus)
+	if err != nil {
+		t.Fatalf("SelfTestWFMCorpus() failed: %v", err)
+	}
+	if report.Identical != 2 || report.Different != 0 || report.Failed != 1 || report.OK() {
+		t.Fatalf("report = %+v, want 2 identical files and 1 failed", report)
+	}
+
+	// The unpacked donor layout is reported against the glyph pointer table
+	writeDonorWFM(t, filepath.Join(corpus, "FONT.WFM"))
+	report, err = SelfTestWFMCorpus(context.Background(), corpus)
+	if err != nil {
+		t.Fatalf("SelfTestWFMCorpus() failed: %v", err)
+	}
+	var buffer bytes.Buffer
+	if err := WriteWFMSelfTestReport(report, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteWFMSelfTestReport() failed: %v", err)
+	}
+	if report.Different != 1 || !bytes.Contains(buffer.Bytes(), []byte("| glyph pointer table | 0x90 | 2 |")) {
+		t.Errorf("report = %+v, want FONT.WFM to differ in the glyph pointer table:\n%s", report, buffer.String())
+	}
+
+	if _, err := SelfTestWFMCorpus(context.Background(), t.TempDir()); err == nil {
+		t.Error("SelfTestWFMCorpus() of an empty corpus succeeded")
+	}
+}
+
+func TestDiffWFMSections(t *testing.T) {
+	sections := []wfmSection{{name: "header", start: 0, end: 4}, {name: "dialogue 0", start: 6, end: 10}}
+	original := []byte{0, 1, 2, 3, 0, 0, 4, 5, 6, 7, 0xFF, 0xFF}
+	encoded := []byte{0, 9, 2, 3, 1, 0, 4, 8, 8, 7, 0xFF, 0x00, 0xFF}
+
+	want := []WFMSelfTestSection{
+		{Section: "header", FirstOffset: 1, Bytes: 1},
+		{Section: SelfTestSectionGap, FirstOffset: 4, Bytes: 1},
+		{Section: "dialogue 0", FirstOffset: 7, Bytes: 2},
+		{Section: SelfTestSectionPadding, FirstOffset: 11, Bytes: 1},
+		{Section: SelfTestSectionSize, FirstOffset: 12, Bytes: 1},
+	}
+	if got := diffWFMSections(original, encoded, sections); !reflect.DeepEqual(got, want) {
+		t.Errorf("diffWFMSections() = %+v, want %+v", got, want)
+	}
+	if got := diffWFMSections(original, original, sections); len(got) != 0 {
+		t.Errorf("diffWFMSections() of identical files = %+v, want none", got)
+	}
+}
@@ -0,0 +1,306 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains wfm stats: a summary of the sections of an original WFM file and,
+// with --space, the unused ranges between them. Encoding packs every section back to
+// back and pads to the original size, so the bytes saved by repacking plus the final
+// padding are what new text and glyphs can use without growing the file.
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/wfm"
+)
+
+// Kinds of unused ranges found by the space analysis
+const (
+	GapAlignment = "alignment" // Padding needed to align the next section
+	GapUnused    = "unused"    // Bytes no pointer reaches
+	GapTrailing  = "trailing"  // Final padding after the last section
+)
+
+// wfmMaxPointer is the largest value of a glyph or dialogue pointer
+const wfmMaxPointer = wfm.MaxPointer
+
+// WFMSpaceGap is an unused range of a WFM file
+type WFMSpaceGap struct {
+	Offset int    `json:"offset"`
+	Size   int    `json:"size"`
+	Kind   string `json:"kind"`  // alignment, unused or trailing
+	After  string `json:"after"` // Section ending where the gap starts
+}
+
+// WFMSpaceReport is the free space analysis of wfm stats --space
+type WFMSpaceReport struct {
+	Gaps             []WFMSpaceGap `json:"gaps"`
+	GapBytes         int           `json:"gap_bytes"`         // Unused bytes between sections
+	TrailingPadding  int           `json:"trailing_padding"`  // Bytes after the last section
+	RepackedSize     int           `json:"repacked_size"`     // Content size when encoded again unchanged
+	Available        int           `json:"available"`         // Bytes free for new content without growing the file
+	GlyphHeadroom    int           `json:"glyph_headroom"`    // Extra glyph bytes before glyph pointers overflow
+	DialogueHeadroom int           `json:"dialogue_headroom"` // Extra dialogue bytes before dialogue pointers overflow
+}
+
+// WFMStats summarizes the sections of a WFM file
+type WFMStats struct {
+	File              string          `json:"file"`
+	FileSize          int             `json:"file_size"`
+	Glyphs            int             `json:"glyphs"`
+	PlaceholderGlyphs int             `json:"placeholder_glyphs"`
+	GlyphBytes        int             `json:"glyph_bytes"` // Glyph records, attributes included
+	Dialogues         int             `json:"dialogues"`
+	NullDialogues     int             `json:"null_dialogues"`
+	SharedDialogues   int             `json:"shared_dialogues"` // Pointers reusing the data of an earlier dialogue
+	DialogueBytes     int             `json:"dialogue_bytes"`   // Dialogue data, terminators included
+	Space             *WFMSpaceReport `json:"space,omitempty"`
+}
+
+// wfmSection is a byte range of a WFM file referenced by the header or a pointer
+type wfmSection struct {
+	name       string
+	start, end int
+}
+
+// wfmSections lists the sections of a parsed WFM file together with the glyphs and the
+// raw dialogue data (terminator included) needed to plan the repacked layout
+type wfmSections struct {
+	sections  []wfmSection
+	glyphs    []Glyph
+	dialogues []Dialogue
+}
+
+// AnalyzeWFMFile reads a WFM file and summarizes its sections; space adds the free
+// space analysis
+func AnalyzeWFMFile(path string, space bool) (*WFMStats, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	stats, err := AnalyzeWFM(data, space)
+	if err != nil {
+		return nil, err
+	}
+	stats.File = path
+	return stats, nil
+}
+
+// AnalyzeWFM summarizes the sections of WFM data; space adds the free space analysis
+func AnalyzeWFM(data []byte, space bool) (*WFMStats, error) {
+	header, err := NewWFMDecoder().DecodeHeader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode header: %w", err)
+	}
+
+	parsed, stats, err := parseWFMSections(data, header)
+	if err != nil {
+		return nil, err
+	}
+	stats.FileSize = len(data)
+
+	if space {
+		stats.Space, err = analyzeWFMSpace(data, parsed)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stats, nil
+}
+
+// parseWFMSections locates every glyph record and dialogue through its pointer
+func parseWFMSections(data []byte, header *WFMHeader) (*wfmSections, *WFMStats, error) {
+	stats := &WFMStats{Glyphs: int(header.TotalGlyphs), Dialogues: int(header.TotalDialogues)}
+	parsed := &wfmSections{sections: []wfmSection{{name: "header", start: 0, end: WFMHeaderSize}}}
+
+	outOfRange := func(format string, args ...interface{}) error {
+		return common.WithCategory(common.ErrCategoryFormat, fmt.Errorf(format, args...))
+	}
+
+	glyphTable := WFMHeaderSize
+	glyphTableEnd := glyphTable + stats.Glyphs*2
+	if glyphTableEnd > len(data) {
+		return nil, nil, outOfRange("glyph pointer table ends at 0x%X, past the end of the file", glyphTableEnd)
+	}
+	parsed.sections = append(parsed.sections, wfmSection{name: "glyph pointer table", start: glyphTable, end: glyphTableEnd})
+
+	for i := 0; i < stats.Glyphs; i++ {
+		offset := int(binary.LittleEndian.Uint16(data[glyphTable+i*2:]))
+		if offset+wfmGlyphAttributesSize > len(data) {
+			return nil, nil, outOfRange("glyph %d at 0x%X is past the end of the file", i, offset)
+		}
+		glyph := Glyph{
+			GlyphClut:       binary.LittleEndian.Uint16(data[offset:]),
+			GlyphHeight:     binary.LittleEndian.Uint16(data[offset+2:]),
+			GlyphWidth:      binary.LittleEndian.Uint16(data[offset+4:]),
+			GlyphHandakuten: binary.LittleEndian.Uint16(data[offset+6:]),
+		}
+		imageSize := 0
+		if !glyph.IsPlaceholder() {
+			imageSize = (int(glyph.GlyphWidth)*int(glyph.GlyphHeight) + 1) / 2
+		} else {
+			stats.PlaceholderGlyphs++
+		}
+		end := offset + wfmGlyphAttributesSize + imageSize
+		if end > len(data) {
+			return nil, nil, outOfRange("glyph %d at 0x%X ends past the end of the file", i, offset)
+		}
+		glyph.GlyphImage = data[offset+wfmGlyphAttributesSize : end]
+
+		parsed.glyphs = append(parsed.glyphs, glyph)
+		parsed.sections = append(parsed.sections, wfmSection{name: fmt.Sprintf("glyph %d", i), start: offset, end: end})
+		stats.GlyphBytes += end - offset
+	}
+
+	dialogueTable := int(header.DialoguePointerTable)
+	dialogueTableEnd := dialogueTable + stats.Dialogues*2
+	if dialogueTableEnd > len(data) {
+		return nil, nil, outOfRange("dialogue pointer table ends at 0x%X, past the end of the file", dialogueTableEnd)
+	}
+	parsed.sections = append(parsed.sections, wfmSection{name: "dialogue pointer table", start: dialogueTable, end: dialogueTableEnd})
+
+	seen := make(map[int]bool)
+	for i := 0; i < stats.Dialogues; i++ {
+		pointer := int(binary.LittleEndian.Uint16(data[dialogueTable+i*2:]))
+		if pointer == 0 {
+			stats.NullDialogues++
+			parsed.dialogues = append(parsed.dialogues, Dialogue{})
+			continue
+		}
+
+		offset := dialogueTable + pointer
+		end := offset
+		for {
+			if end+2 > len(data) {
+				return nil, nil, outOfRange("dialogue %d at 0x%X has no terminator", i, offset)
+			}
+			word := binary.LittleEndian.Uint16(data[end:])
+			end += 2
+			if word == 0xFFFF {
+				break
+			}
+		}
+
+		parsed.dialogues = append(parsed.dialogues, Dialogue{Data: data[offset:end]})
+		if seen[offset] {
+			stats.SharedDialogues++
+			continue
+		}
+		seen[offset] = true
+		parsed.sections = append(parsed.sections, wfmSection{name: fmt.Sprintf("dialogue %d", i), start: offset, end: end})
+		stats.DialogueBytes += end - offset
+	}
+
+	return parsed, stats, nil
+}
+
+// analyzeWFMSpace finds the unused ranges between sections and the space left for new
+// content once the file is repacked by encode
+func analyzeWFMSpace(data []byte, parsed *wfmSections) (*WFMSpaceReport, error) {
+	sections := append([]wfmSection(nil), parsed.sections...)
+	sort.SliceStable(sections, func(i, j int) bool { return sections[i].start < sections[j].start })
+
+	report := &WFMSpaceReport{Gaps: []WFMSpaceGap{}}
+	end, after := 0, ""
+	for _, section := range sections {
+		if section.start > end {
+			kind := GapUnused
+			if section.start-end < wfmAlignment && section.start%wfmAlignment == 0 {
+				kind = GapAlignment
+			}
+			report.Gaps = append(report.Gaps, WFMSpaceGap{Offset: end, Size: section.start - end, Kind: kind, After: after})
+			report.GapBytes += section.start - end
+		}
+		if section.end > end {
+			end, after = section.end, section.name
+		}
+	}
+	if end < len(data) {
+		report.TrailingPadding = len(data) - end
+		report.Gaps = append(report.Gaps, WFMSpaceGap{Offset: end, Size: report.TrailingPadding, Kind: GapTrailing, After: after})
+	}
+
+	layout, err := planWFMLayout(parsed.glyphs, parsed.dialogues)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan the repacked layout: %w", err)
+	}
+	report.RepackedSize = int(layout.ContentSize)
+	report.Available = max(0, len(data)-report.RepackedSize)
+
+	// Glyph pointers are absolute and dialogue pointers relative to their table, so
+	// each kind of content can only grow until its last pointer reaches the maximum
+	report.GlyphHeadroom = report.Available
+	if count := len(layout.Glyphs); count > 0 {
+		report.GlyphHeadroom = min(report.Available, max(0, wfmMaxPointer-int(layout.Glyphs[count-1])))
+	}
+	report.DialogueHeadroom = report.Available
+	if count := len(layout.Dialogues); count > 0 {
+		last := int(layout.Dialogues[count-1] - layout.DialoguePointerTable)
+		report.DialogueHeadroom = min(report.Available, max(0, wfmMaxPointer-last))
+	}
+
+	return report, nil
+}
+
+// WriteWFMStats writes the stats in the requested format (json or markdown)
+func WriteWFMStats(stats *WFMStats, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(stats); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeWFMStatsMarkdown(stats, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeWFMStatsMarkdown renders the stats as a markdown document
+func writeWFMStatsMarkdown(stats *WFMStats, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# WFM Stats: %s\n\n", stats.File))
+	sb.WriteString("| Metric | Value |\n")
+	sb.WriteString("|--------|-------|\n")
+	sb.WriteString(fmt.Sprintf("| File size | %d |\n", stats.FileSize))
+	sb.WriteString(fmt.Sprintf("| Glyphs | %d |\n", stats.Glyphs))
+	sb.WriteString(fmt.Sprintf("| Placeholder glyphs | %d |\n", stats.PlaceholderGlyphs))
+	sb.WriteString(fmt.Sprintf("| Glyph bytes | %d |\n", stats.GlyphBytes))
+	sb.WriteString(fmt.Sprintf("| Dialogues | %d |\n", stats.Dialogues))
+	sb.WriteString(fmt.Sprintf("| Null dialogues | %d |\n", stats.NullDialogues))
+	sb.WriteString(fmt.Sprintf("| Shared dialogues | %d |\n", stats.SharedDialogues))
+	sb.WriteString(fmt.Sprintf("| Dialogue bytes | %d |\n", stats.DialogueBytes))
+
+	if space := stats.Space; space != nil {
+		sb.WriteString("\n## Free Space\n\n")
+		sb.WriteString("| Metric | Bytes |\n")
+		sb.WriteString("|--------|-------|\n")
+		sb.WriteString(fmt.Sprintf("| Gaps between sections | %d |\n", space.GapBytes))
+		sb.WriteString(fmt.Sprintf("| Trailing padding | %d |\n", space.TrailingPadding))
+		sb.WriteString(fmt.Sprintf("| Repacked content size | %d |\n", space.RepackedSize))
+		sb.WriteString(fmt.Sprintf("| Available without growing the file | %d |\n", space.Available))
+		sb.WriteString(fmt.Sprintf("| Available for glyphs | %d |\n", space.GlyphHeadroom))
+		sb.WriteString(fmt.Sprintf("| Available for dialogues | %d |\n", space.DialogueHeadroom))
+
+		sb.WriteString("\n## Gaps\n\n")
+		sb.WriteString("| Offset | Size | Kind | After |\n")
+		sb.WriteString("|--------|------|------|-------|\n")
+		for _, gap := range space.Gaps {
+			sb.WriteString(fmt.Sprintf("| 0x%X | %d | %s | %s |\n", gap.Offset, gap.Size, gap.Kind, gap.After))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+// Package pkg provides tests for the WFM stats and free space analysis
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestAnalyzeWFM_Space(t *testing.T) {
+	// The fixture content ends at 242; pad it like an original file
+	data := append(salvageFixture(t), bytes.Repeat([]byte{0xFF}, 14)...)
+
+	stats, err := AnalyzeWFM(data, true)
+	if err != nil {
+		t.Fatalf("AnalyzeWFM() failed: %v", err)
+	}
+	if stats.Glyphs != 2 || stats.GlyphBytes != 80 || stats.Dialogues != 2 || stats.DialogueBytes != 10 {
+		t.Errorf("stats = %+v, want 2 glyphs of 80 bytes and 2 dialogues of 10 bytes", stats)
+	}
+
+	space := stats.Space
+	if space.GapBytes != 0 || space.TrailingPadding != 14 {
+		t.Errorf("gaps = %d, trailing = %d, want 0 and 14", space.GapBytes, space.TrailingPadding)
+	}
+	if len(space.Gaps) != 1 || space.Gaps[0] != (WFMSpaceGap{Offset: 242, Size: 14, Kind: GapTrailing, After: "dialogue 1"}) {
+		t.Errorf("Gaps = %+v, want the trailing padding at 242", space.Gaps)
+	}
+	if space.RepackedSize != 242 || space.Available != 14 {
+		t.Errorf("repacked = %d, available = %d, want 242 and 14", space.RepackedSize, space.Available)
+	}
+	if space.GlyphHeadroom != 14 || space.DialogueHeadroom != 14 {
+		t.Errorf("headroom = %d/%d, want 14/14", space.GlyphHeadroom, space.DialogueHeadroom)
+	}
+}
+
+func TestAnalyzeWFM_SharedDialogue(t *testing.T) {
+	// Point dialogue 0 at the data of dialogue 1, leaving its old bytes unused
+	data := salvageFixture(t)
+	binary.LittleEndian.PutUint16(data[228:], 10)
+
+	stats, err := AnalyzeWFM(data, true)
+	if err != nil {
+		t.Fatalf("AnalyzeWFM() failed: %v", err)
+	}
+	if stats.SharedDialogues != 1 {
+		t.Errorf("SharedDialogues = %d, want 1", stats.SharedDialogues)
+	}
+
+	space := stats.Space
+	want := WFMSpaceGap{Offset: 232, Size: 6, Kind: GapUnused, After: "dialogue pointer table"}
+	if len(space.Gaps) != 1 || space.Gaps[0] != want {
+		t.Errorf("Gaps = %+v, want %+v", space.Gaps, want)
+	}
+	// Encoding writes the shared dialogue twice, reclaiming only part of the gap
+	if space.RepackedSize != 240 || space.Available != 2 {
+		t.Errorf("repacked = %d, available = %d, want 240 and 2", space.RepackedSize, space.Available)
+	}
+}
+
+func TestAnalyzeWFM_MissingTerminator(t *testing.T) {
+	data := salvageFixture(t)
+	data = data[:len(data)-2]
+
+	if _, err := AnalyzeWFM(data, true); err == nil || !strings.Contains(err.Error(), "no terminator") {
+		t.Errorf("AnalyzeWFM() error = %v, want a missing terminator", err)
+	}
+}
@@ -0,0 +1,231 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the glyph width report written at encode time: it compares the width of
+// every character in the new font with the original font (the glyph_widths stored by decode
+// --widths) and the resulting line widths of every dialogue, so layout regressions of a
+// replaced font show up before playtesting.
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+)
+
+// GlyphWidthChange compares the width of a character in the original and the new font
+type GlyphWidthChange struct {
+	Character  string `json:"character"`
+	Codepoint  string `json:"codepoint"`
+	Height     int    `json:"height"`
+	Original   int    `json:"original"`    // Width in the original font (0 when it lacks the character)
+	New        int    `json:"new"`         // Width in the encoded font
+	Delta      int    `json:"delta"`       // New minus original width (0 when the original lacks the character)
+	InOriginal bool   `json:"in_original"` // The original font has the character
+}
+
+// LineWidthChange compares the width of a dialogue line drawn with both fonts
+type LineWidthChange struct {
+	Line     int `json:"line"` // Line number, from 1
+	Original int `json:"original"`
+	New      int `json:"new"`
+	Delta    int `json:"delta"`
+}
+
+// DialogueWidthChange lists the lines of a dialogue whose width changes with the new font
+type DialogueWidthChange struct {
+	ID          int               `json:"id"`
+	FontHeight  int               `json:"font_height"`
+	NetDelta    int               `json:"net_delta"`              // Sum of the line deltas
+	Lines       []LineWidthChange `json:"lines"`                  // Lines whose width changes
+	OriginalMax int               `json:"original_max,omitempty"` // Widest original line (widths metadata), 0 if unknown
+	OverMax     bool              `json:"over_max,omitempty"`     // A line is wider than the widest original line
+}
+
+// WidthReport compares the glyph widths of an encoded font with the original font
+type WidthReport struct {
+	File      string                `json:"file"`
+	Glyphs    []GlyphWidthChange    `json:"glyphs"`
+	Dialogues []DialogueWidthChange `json:"dialogues"` // Dialogues with at least one changed line
+}
+
+// SetWidthReport makes Encode write the glyph width report to path after the WFM file
+// (empty disables). A .json path is written as JSON, anything else as markdown.
+func (e *WFMFileEncoder) SetWidthReport(path string) {
+	e.widthReportFile = path
+}
+
+// encodedGlyphWidths returns the width of every encoded character by font height
+func encodedGlyphWidths(encodeValueMap map[uint16]GlyphEncodeInfo) map[int]map[string]int {
+	table := make(map[int]map[string]int)
+	for _, info := range encodeValueMap {
+		if info.Character == 0 || info.Glyph.IsPlaceholder() {
+			continue
+		}
+		if table[info.FontHeight] == nil {
+			table[info.FontHeight] = make(map[string]int)
+		}
+		char := string(info.Character)
+		table[info.FontHeight][char] = max(table[info.FontHeight][char], int(info.Glyph.GlyphWidth))
+	}
+	return table
+}
+
+// BuildWidthReport compares the original glyph widths with the new ones for every
+// character and every dialogue line. Characters the original font lacks are measured
+// with their new width, so line deltas only come from characters whose width changed.
+func BuildWidthReport(file string, dialogues []DialogueEntry, originalWidths, newWidths map[int]map[string]int) *WidthReport {
+	report := &WidthReport{File: file, Glyphs: []GlyphWidthChange{}, Dialogues: []DialogueWidthChange{}}
+
+	for height, widths := range newWidths {
+		for char, width := range widths {
+			change := GlyphWidthChange{
+				Character: char,
+				Codepoint: fmt.Sprintf("U+%04X", []rune(char)[0]),
+				Height:    height,
+				New:       width,
+			}
+			change.Original, change.InOriginal = originalWidths[height][char]
+			if change.InOriginal {
+				change.Delta = change.New - change.Original
+			}
+			report.Glyphs = append(report.Glyphs, change)
+		}
+	}
+	sort.Slice(report.Glyphs, func(i, j int) bool {
+		if report.Glyphs[i].Height != report.Glyphs[j].Height {
+			return report.Glyphs[i].Height < report.Glyphs[j].Height
+		}
+		return report.Glyphs[i].Character < report.Glyphs[j].Character
+	})
+
+	for _, dialogue := range dialogues {
+		if dialogue.Raw != "" || len(newWidths[dialogue.FontHeight]) == 0 {
+			continue
+		}
+		if change, changed := compareDialogueWidths(dialogue, originalWidths[dialogue.FontHeight], newWidths[dialogue.FontHeight]); changed {
+			report.Dialogues = append(report.Dialogues, change)
+		}
+	}
+	return report
+}
+
+// compareDialogueWidths measures a dialogue with both fonts and reports whether any line changed
+func compareDialogueWidths(dialogue DialogueEntry, originalWidths, newWidths map[string]int) (DialogueWidthChange, bool) {
+	merged := make(map[string]int, len(newWidths))
+	for char, width := range newWidths {
+		merged[char] = width
+	}
+	for char, width := range originalWidths {
+		if _, used := newWidths[char]; used {
+			merged[char] = width
+		}
+	}
+
+	originalLines := measureTextLines(dialogue, merged)
+	newLines := measureTextLines(dialogue, newWidths)
+	change := DialogueWidthChange{ID: dialogue.ID, FontHeight: dialogue.FontHeight}
+	if dialogue.Widths != nil {
+		change.OriginalMax = dialogue.Widths.Max
+	}
+
+	for line := range newLines {
+		if change.OriginalMax > 0 && newLines[line] > change.OriginalMax {
+			change.OverMax = true
+		}
+		delta := newLines[line] - originalLines[line]
+		if delta == 0 {
+			continue
+		}
+		change.NetDelta += delta
+		change.Lines = append(change.Lines, LineWidthChange{
+			Line:     line + 1,
+			Original: originalLines[line],
+			New:      newLines[line],
+			Delta:    delta,
+		})
+	}
+	return change, len(change.Lines) > 0
+}
+
+// writeWidthReport builds the width report of an encode and writes it to the report file
+func (e *WFMFileEncoder) writeWidthReport(outputFile string, dialogues []DialogueEntry, encodeValueMap map[uint16]GlyphEncodeInfo) error {
+	if len(e.originalGlyphWidths) == 0 {
+		common.LogWarn("No original glyph widths in the dialogue file (decode with --widths); every character is reported as new")
+	}
+	report := BuildWidthReport(filepath.Base(outputFile), dialogues, e.originalGlyphWidths, encodedGlyphWidths(encodeValueMap))
+
+	writer, err := common.CreateOutput(e.widthReportFile)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create width report: %w", err))
+	}
+	defer writer.Close()
+
+	format := ReportFormatMarkdown
+	if strings.EqualFold(filepath.Ext(e.widthReportFile), ".json") {
+		format = ReportFormatJSON
+	}
+	return WriteWidthReport(report, format, writer)
+}
+
+// WriteWidthReport writes the report in the requested format (json or markdown)
+func WriteWidthReport(report *WidthReport, format string, writer io.Writer) error {
+	switch format {
+	case ReportFormatJSON:
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return fmt.Errorf("failed to encode JSON report: %w", err)
+		}
+		return nil
+	case ReportFormatMarkdown, "md":
+		return writeWidthMarkdown(report, writer)
+	default:
+		return fmt.Errorf("unsupported report format: %s", format)
+	}
+}
+
+// writeWidthMarkdown renders the report as a markdown document
+func writeWidthMarkdown(report *WidthReport, writer io.Writer) error {
+	var sb strings.Builder
+
+	sb.WriteString(fmt.Sprintf("# Glyph Widths: %s\n\n", report.File))
+	sb.WriteString("## Characters\n\n")
+	sb.WriteString("| Height | Character | Code point | Original | New | Delta |\n")
+	sb.WriteString("|--------|-----------|------------|----------|-----|-------|\n")
+	for _, glyph := range report.Glyphs {
+		original, delta := "new", "-"
+		if glyph.InOriginal {
+			original, delta = fmt.Sprint(glyph.Original), fmt.Sprintf("%+d", glyph.Delta)
+		}
+		sb.WriteString(fmt.Sprintf("| %d | `%s` | %s | %s | %d | %s |\n",
+			glyph.Height, glyph.Character, glyph.Codepoint, original, glyph.New, delta))
+	}
+
+	sb.WriteString("\n## Dialogues\n\n")
+	if len(report.Dialogues) == 0 {
+		sb.WriteString("No line changes width.\n")
+	} else {
+		sb.WriteString("| ID | Line | Original | New | Delta |\n")
+		sb.WriteString("|----|------|----------|-----|-------|\n")
+		for _, dialogue := range report.Dialogues {
+			for _, line := range dialogue.Lines {
+				sb.WriteString(fmt.Sprintf("| %d | %d | %d | %d | %+d |\n",
+					dialogue.ID, line.Line, line.Original, line.New, line.Delta))
+			}
+			note := ""
+			if dialogue.OverMax {
+				note = fmt.Sprintf(" (wider than the widest original line, %d px)", dialogue.OriginalMax)
+			}
+			sb.WriteString(fmt.Sprintf("| %d | net | | | %+d%s |\n", dialogue.ID, dialogue.NetDelta, note))
+		}
+	}
+
+	if _, err := io.WriteString(writer, sb.String()); err != nil {
+		return fmt.Errorf("failed to write markdown report: %w", err)
+	}
+	return nil
+}
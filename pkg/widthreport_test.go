@@ -0,0 +1,62 @@
+// Package pkg provides tests for the encode-time glyph width report
+package pkg
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuildWidthReport(t *testing.T) {
+	originalWidths := map[int]map[string]int{16: {"A": 8, "B": 8, "C": 10}}
+	newWidths := map[int]map[string]int{16: {"A": 6, "B": 8, "x": 5}}
+
+	dialogues := []DialogueEntry{
+		textEntry(0, "AB\nBB"),
+		textEntry(1, "BBx"),
+		textEntry(2, "AA"),
+	}
+	for i := range dialogues {
+		dialogues[i].FontHeight = 16
+	}
+	dialogues[2].Widths = &DialogueWidths{Lines: []int{16}, Max: 11}
+
+	report := BuildWidthReport("CFNT999H.WFM", dialogues, originalWidths, newWidths)
+
+	want := []GlyphWidthChange{
+		{Character: "A", Codepoint: "U+0041", Height: 16, Original: 8, New: 6, Delta: -2, InOriginal: true},
+		{Character: "B", Codepoint: "U+0042", Height: 16, Original: 8, New: 8, InOriginal: true},
+		{Character: "x", Codepoint: "U+0078", Height: 16, New: 5},
+	}
+	if len(report.Glyphs) != len(want) {
+		t.Fatalf("glyphs = %+v, want %+v", report.Glyphs, want)
+	}
+	for i := range want {
+		if report.Glyphs[i] != want[i] {
+			t.Errorf("glyph %d = %+v, want %+v", i, report.Glyphs[i], want[i])
+		}
+	}
+
+	// Dialogue 1 only uses unchanged or new characters, so no line changes width
+	if len(report.Dialogues) != 2 {
+		t.Fatalf("dialogues = %+v, want 0 and 2", report.Dialogues)
+	}
+	first := report.Dialogues[0]
+	if first.ID != 0 || first.NetDelta != -2 || len(first.Lines) != 1 || first.Lines[0] != (LineWidthChange{Line: 1, Original: 16, New: 14, Delta: -2}) {
+		t.Errorf("dialogue 0 = %+v", first)
+	}
+	second := report.Dialogues[1]
+	if second.ID != 2 || second.NetDelta != -4 || !second.OverMax || second.OriginalMax != 11 {
+		t.Errorf("dialogue 2 = %+v", second)
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteWidthReport(report, ReportFormatMarkdown, &buffer); err != nil {
+		t.Fatalf("WriteWidthReport failed: %v", err)
+	}
+	for _, fragment := range []string{"| 16 | `A` | U+0041 | 8 | 6 | -2 |", "| 16 | `x` | U+0078 | new | 5 | - |", "| 2 | net | | | -4 (wider than the widest original line, 11 px) |"} {
+		if !strings.Contains(buffer.String(), fragment) {
+			t.Errorf("markdown report lacks %q:\n%s", fragment, buffer.String())
+		}
+	}
+}
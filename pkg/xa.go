@@ -0,0 +1,300 @@
+// Package pkg provides functionality for processing WFM font files from the Tomba! PlayStation game.
+// This file contains the XA audio processor: interleaved XA files hold several voice and
+// music streams, told apart by the file and channel numbers of their sector subheaders.
+// Decode splits them into one WAV file per stream; Encode re-encodes edited WAV files
+// into the sectors of their stream, keeping the interleave so the file can be injected
+// back with cd build --file.
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// XAStream describes one audio stream of an XA file
+type XAStream struct {
+	File          uint8  `json:"file"`
+	Channel       uint8  `json:"channel"`
+	SampleRate    int    `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bits_per_sample"`
+	Sectors       int    `json:"sectors"`
+	Frames        int    `json:"frames"` // Samples per channel
+	WAV           string `json:"wav,omitempty"`
+	Encoded       bool   `json:"encoded,omitempty"` // Re-encoded from the WAV file (encode)
+}
+
+// XAReport lists the streams of an XA file
+type XAReport struct {
+	Source  string     `json:"source"`
+	Output  string     `json:"output,omitempty"`
+	Sectors int        `json:"sectors"`
+	Streams []XAStream `json:"streams"`
+}
+
+// XAProcessor decodes and re-encodes XA audio files
+type XAProcessor struct {
+	logger *common.Logger // Logging configuration (nil follows SetVerboseMode)
+}
+
+// NewXAProcessor creates a new XA audio processor instance
+func NewXAProcessor() *XAProcessor {
+	return &XAProcessor{}
+}
+
+// SetLogger sets the logging configuration of the processor (nil follows SetVerboseMode)
+func (p *XAProcessor) SetLogger(logger *common.Logger) {
+	p.logger = logger
+}
+
+// xaStreamKey identifies a stream by the file and channel numbers of its subheaders
+type xaStreamKey struct {
+	file    uint8
+	channel uint8
+}
+
+// xaStreamSectors is a stream and the indexes of its sectors in the file
+type xaStreamSectors struct {
+	stream  XAStream
+	header  psx.XASubheader // Subheader of the first sector, giving the format
+	sectors []int
+}
+
+// XAWAVName returns the name of the WAV file of a stream: <base>_f<file>_c<channel>.wav
+func XAWAVName(source string, file, channel uint8) string {
+	base := path.Base(filepath.ToSlash(source))
+	base = strings.TrimSuffix(base, path.Ext(base))
+	return fmt.Sprintf("%s_f%02d_c%02d.wav", base, file, channel)
+}
+
+// LoadXAFile reads an XA file, either a local file of 2336-byte or 2352-byte sectors or,
+// when imageFile is set, the file at that path of a Mode 2 disc image
+func LoadXAFile(source, imageFile string) (*psx.XAFile, error) {
+	if imageFile == "" {
+		data, err := os.ReadFile(source)
+		if err != nil {
+			return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("failed to read %s: %w", source, err))
+		}
+		return psx.ParseXAFile(data)
+	}
+
+	reader, err := psx.NewCDReader(imageFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CD image file: %w", err)
+	}
+	defer reader.Close()
+
+	descriptor, err := reader.ReadISODescriptor()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read volume descriptor: %w", err)
+	}
+	rootLBA := common.ExtractLBAFromDirRecord(descriptor.RootDirRecord[:])
+	rootSize := common.ExtractSizeFromDirRecord(descriptor.RootDirRecord[:])
+	entry, err := reader.FindEntry(rootLBA, rootSize, strings.Trim(filepath.ToSlash(source), "/"))
+	if err != nil || entry.IsDir {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("%s not found on the disc", source))
+	}
+	return reader.ReadXAFile(entry)
+}
+
+// streams groups the audio sectors of an XA file by stream, in order of first appearance.
+// Sectors whose format differs from the first sector of their stream are left out.
+func (p *XAProcessor) streams(xa *psx.XAFile) []*xaStreamSectors {
+	var ordered []*xaStreamSectors
+	byKey := make(map[xaStreamKey]*xaStreamSectors)
+	for i := range xa.Sectors {
+		header := xa.Subheader(i)
+		if !header.IsAudio() {
+			continue
+		}
+		key := xaStreamKey{file: header.File, channel: header.Channel}
+		stream, ok := byKey[key]
+		if !ok {
+			stream = &xaStreamSectors{header: header, stream: XAStream{
+				File:          header.File,
+				Channel:       header.Channel,
+				SampleRate:    header.SampleRate(),
+				Channels:      header.Channels(),
+				BitsPerSample: header.BitsPerSample(),
+			}}
+			byKey[key] = stream
+			ordered = append(ordered, stream)
+		} else if header.CodingInfo&0x3F != stream.header.CodingInfo&0x3F {
+			common.LogWarn("Sector %d of stream f%02d c%02d changes the audio format; skipped", i, header.File, header.Channel)
+			continue
+		}
+		stream.sectors = append(stream.sectors, i)
+		stream.stream.Sectors++
+		stream.stream.Frames += header.Frames()
+	}
+	return ordered
+}
+
+// Decode writes every audio stream of an XA file to outputDir as a WAV file. The source
+// is a local XA file or, with imageFile, a path of the disc.
+func (p *XAProcessor) Decode(ctx context.Context, source, imageFile, outputDir string) (*XAReport, error) {
+	xa, err := LoadXAFile(source, imageFile)
+	if err != nil {
+		return nil, err
+	}
+	streams, err := p.decodeStreams(ctx, xa, source, outputDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(streams) == 0 {
+		return nil, common.WithCategory(common.ErrCategoryFormat, fmt.Errorf("%s holds no XA audio sectors", source))
+	}
+	return &XAReport{Source: source, Sectors: len(xa.Sectors), Streams: streams}, nil
+}
+
+// decodeStreams writes the audio streams of an XA file to outputDir, named after source
+func (p *XAProcessor) decodeStreams(ctx context.Context, xa *psx.XAFile, source, outputDir string) ([]XAStream, error) {
+	streams := p.streams(xa)
+	if len(streams) == 0 {
+		return []XAStream{}, nil
+	}
+	if err := os.MkdirAll(outputDir, 0o750); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", outputDir, err))
+	}
+
+	decoded := make([]XAStream, 0, len(streams))
+	for _, stream := range streams {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+
+		decoder := &psx.XAADPCMDecoder{}
+		audio := &psx.WAVAudio{SampleRate: stream.stream.SampleRate, Channels: stream.stream.Channels}
+		for _, index := range stream.sectors {
+			data := xa.Payload(index)[psx.CD_SUBHEADER_SIZE:]
+			audio.Samples = append(audio.Samples, decoder.DecodeSector(data, stream.header)...)
+		}
+
+		wavPath := filepath.Join(outputDir, XAWAVName(source, stream.stream.File, stream.stream.Channel))
+		if err := writeXAWAV(wavPath, audio); err != nil {
+			return nil, err
+		}
+		stream.stream.WAV = wavPath
+		p.logger.Debug("Stream f%02d c%02d: %d sectors, %d Hz %d-bit %d channel(s) written to %s",
+			stream.stream.File, stream.stream.Channel, stream.stream.Sectors,
+			stream.stream.SampleRate, stream.stream.BitsPerSample, stream.stream.Channels, wavPath)
+		decoded = append(decoded, stream.stream)
+	}
+	return decoded, nil
+}
+
+// Encode re-encodes the streams of an XA file that have a WAV file in wavDir (named as
+// Decode names them) and writes the result to outputFile. The sample rate and channels of
+// each WAV file must match its stream; shorter audio is padded with silence, longer audio
+// is refused since the interleave cannot grow. Other sectors are copied unchanged.
+func (p *XAProcessor) Encode(ctx context.Context, source, imageFile, wavDir, outputFile string) (*XAReport, error) {
+	xa, err := LoadXAFile(source, imageFile)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(wavDir); err != nil || !info.IsDir() {
+		return nil, common.WithCategory(common.ErrCategoryInputNotFound, fmt.Errorf("WAV directory %s not found", wavDir))
+	}
+
+	report := &XAReport{Source: source, Output: outputFile, Sectors: len(xa.Sectors), Streams: []XAStream{}}
+	encoded := 0
+	for _, stream := range p.streams(xa) {
+		if err := common.Canceled(ctx); err != nil {
+			return nil, err
+		}
+
+		wavPath := filepath.Join(wavDir, XAWAVName(source, stream.stream.File, stream.stream.Channel))
+		if _, err := os.Stat(wavPath); err != nil {
+			p.logger.Debug("Stream f%02d c%02d: no %s, kept", stream.stream.File, stream.stream.Channel, wavPath)
+			report.Streams = append(report.Streams, stream.stream)
+			continue
+		}
+		if err := p.encodeStream(xa, stream, wavPath); err != nil {
+			return nil, err
+		}
+		stream.stream.WAV = wavPath
+		stream.stream.Encoded = true
+		report.Streams = append(report.Streams, stream.stream)
+		encoded++
+	}
+	if encoded == 0 {
+		return nil, common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("no WAV file in %s matches a stream of %s", wavDir, source))
+	}
+
+	output, err := common.CreateAtomic(outputFile)
+	if err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", outputFile, err))
+	}
+	defer output.Abort()
+	if _, err := output.Write(xa.Bytes()); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", outputFile, err))
+	}
+	if err := output.Commit(); err != nil {
+		return nil, common.WithCategory(common.ErrCategoryWrite, err)
+	}
+	return report, nil
+}
+
+// encodeStream encodes a WAV file into the sectors of a stream
+func (p *XAProcessor) encodeStream(xa *psx.XAFile, stream *xaStreamSectors, wavPath string) error {
+	name := fmt.Sprintf("stream f%02d c%02d", stream.stream.File, stream.stream.Channel)
+	if stream.stream.BitsPerSample != 4 {
+		return common.WithCategory(common.ErrCategoryValidationFailed, fmt.Errorf("%s is 8-bit XA-ADPCM; only 4-bit streams can be encoded", name))
+	}
+
+	file, err := os.Open(wavPath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", wavPath, err)
+	}
+	defer file.Close()
+	audio, err := psx.ReadWAV(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", wavPath, err)
+	}
+	if audio.SampleRate != stream.stream.SampleRate || audio.Channels != stream.stream.Channels {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s is %d Hz with %d channel(s), but %s needs %d Hz with %d channel(s)",
+				wavPath, audio.SampleRate, audio.Channels, name, stream.stream.SampleRate, stream.stream.Channels))
+	}
+	if audio.Frames() > stream.stream.Frames {
+		return common.WithCategory(common.ErrCategoryValidationFailed,
+			fmt.Errorf("%s holds %d samples per channel, past the %d that fit the %d sectors of %s",
+				wavPath, audio.Frames(), stream.stream.Frames, stream.stream.Sectors, name))
+	}
+
+	encoder := &psx.XAADPCMEncoder{}
+	perSector := stream.header.Frames() * stream.stream.Channels
+	for i, index := range stream.sectors {
+		start := min(i*perSector, len(audio.Samples))
+		end := min(start+perSector, len(audio.Samples))
+		data, err := encoder.EncodeSector(audio.Samples[start:end], stream.header)
+		if err != nil {
+			return fmt.Errorf("failed to encode sector %d of %s: %w", index, name, err)
+		}
+		xa.SetAudio(index, data)
+	}
+	p.logger.Debug("Stream f%02d c%02d: %d samples encoded from %s into %d sectors",
+		stream.stream.File, stream.stream.Channel, audio.Frames(), wavPath, stream.stream.Sectors)
+	return nil
+}
+
+// writeXAWAV writes the audio of a stream to a WAV file atomically
+func writeXAWAV(wavPath string, audio *psx.WAVAudio) error {
+	output, err := common.CreateAtomic(wavPath)
+	if err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to create %s: %w", wavPath, err))
+	}
+	defer output.Abort()
+
+	if err := psx.WriteWAV(output, audio); err != nil {
+		return common.WithCategory(common.ErrCategoryWrite, fmt.Errorf("failed to write %s: %w", wavPath, err))
+	}
+	return common.WithCategory(common.ErrCategoryWrite, output.Commit())
+}
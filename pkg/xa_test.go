@@ -0,0 +1,147 @@
+// Package pkg provides tests for the XA audio processor
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/hansbonini/tombatools/pkg/common"
+	"github.com/hansbonini/tombatools/pkg/psx"
+)
+
+// writeTestXAFile writes an XA file interleaving two mono streams (channels 0 and 1 of
+// file 1, two sectors each) with a data sector, and returns its path
+func writeTestXAFile(t *testing.T, dir string) string {
+	t.Helper()
+	var data []byte
+	for _, channel := range []byte{0, 1, 0, 1, 0xFF} {
+		sector := make([]byte, psx.CD_XA_DATA_SIZE)
+		submode := byte(psx.XA_SUBMODE_AUDIO | psx.XA_SUBMODE_FORM2)
+		if channel == 0xFF {
+			channel, submode = 0, psx.XA_SUBMODE_DATA
+		}
+		copy(sector, []byte{1, channel, submode, 0, 1, channel, submode, 0})
+		data = append(data, sector...)
+	}
+	path := filepath.Join(dir, "VOICE.XA")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestXAProcessor_DecodeEncode(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestXAFile(t, dir)
+	wavDir := filepath.Join(dir, "audio")
+
+	processor := NewXAProcessor()
+	report, err := processor.Decode(context.Background(), source, "", wavDir)
+	if err != nil {
+		t.Fatalf("Decode() failed: %v", err)
+	}
+	if len(report.Streams) != 2 {
+		t.Fatalf("Decode() = %d streams, want 2", len(report.Streams))
+	}
+	for i, stream := range report.Streams {
+		if stream.Channel != uint8(i) || stream.Sectors != 2 || stream.Frames != 2*4032 || stream.SampleRate != 37800 {
+			t.Errorf("stream %d = %+v, want channel %d with 2 sectors of 4032 frames at 37800 Hz", i, stream, i)
+		}
+		if filepath.Base(stream.WAV) != XAWAVName(source, 1, uint8(i)) {
+			t.Errorf("stream %d WAV = %s, want %s", i, stream.WAV, XAWAVName(source, 1, uint8(i)))
+		}
+	}
+
+	// Replace channel 1 with a ramp shorter than the stream and keep channel 0 as is
+	if err := os.Remove(report.Streams[0].WAV); err != nil {
+		t.Fatal(err)
+	}
+	ramp := &psx.WAVAudio{SampleRate: 37800, Channels: 1}
+	for i := 0; i < 5000; i++ {
+		ramp.Samples = append(ramp.Samples, int16(i))
+	}
+	var buffer bytes.Buffer
+	if err := psx.WriteWAV(&buffer, ramp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(report.Streams[1].WAV, buffer.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "VOICE_new.XA")
+	encoded, err := processor.Encode(context.Background(), source, "", wavDir, output)
+	if err != nil {
+		t.Fatalf("Encode() failed: %v", err)
+	}
+	if encoded.Streams[0].Encoded || !encoded.Streams[1].Encoded {
+		t.Errorf("Encode() streams = %+v, want only channel 1 encoded", encoded.Streams)
+	}
+
+	original, _ := os.ReadFile(source)
+	result, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result) != len(original) {
+		t.Fatalf("output = %d bytes, want %d", len(result), len(original))
+	}
+	for _, sector := range []int{0, 2, 4} {
+		start, end := sector*psx.CD_XA_DATA_SIZE, (sector+1)*psx.CD_XA_DATA_SIZE
+		if !bytes.Equal(result[start:end], original[start:end]) {
+			t.Errorf("sector %d changed, want it copied", sector)
+		}
+	}
+
+	redecoded, err := processor.Decode(context.Background(), output, "", filepath.Join(dir, "check"))
+	if err != nil {
+		t.Fatalf("Decode(output) failed: %v", err)
+	}
+	file, err := os.Open(redecoded.Streams[1].WAV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	audio, err := psx.ReadWAV(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{1000, 4900} {
+		if difference := int(audio.Samples[i]) - i; difference < -16 || difference > 16 {
+			t.Errorf("sample %d = %d, want about %d", i, audio.Samples[i], i)
+		}
+	}
+}
+
+func TestXAProcessor_Encode_Validation(t *testing.T) {
+	dir := t.TempDir()
+	source := writeTestXAFile(t, dir)
+
+	for name, audio := range map[string]*psx.WAVAudio{
+		"stereo":   {SampleRate: 37800, Channels: 2, Samples: make([]int16, 2)},
+		"too long": {SampleRate: 37800, Channels: 1, Samples: make([]int16, 2*4032+1)},
+	} {
+		wavDir := filepath.Join(dir, name)
+		if err := os.MkdirAll(wavDir, 0o750); err != nil {
+			t.Fatal(err)
+		}
+		var buffer bytes.Buffer
+		if err := psx.WriteWAV(&buffer, audio); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(wavDir, XAWAVName(source, 1, 0)), buffer.Bytes(), 0o600); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := NewXAProcessor().Encode(context.Background(), source, "", wavDir, filepath.Join(dir, name+".XA"))
+		if common.ExitCodeFor(err) != common.ExitValidationFailed {
+			t.Errorf("%s: Encode() error = %v, want a validation failure", name, err)
+		}
+	}
+
+	if _, err := NewXAProcessor().Encode(context.Background(), source, "", t.TempDir(), filepath.Join(dir, "none.XA")); common.ExitCodeFor(err) != common.ExitValidationFailed {
+		t.Errorf("Encode() without WAV files error = %v, want a validation failure", err)
+	}
+}